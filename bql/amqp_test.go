@@ -0,0 +1,382 @@
+package bql
+
+import (
+	"context"
+	"errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testAMQPBroker is a fake broker replacing dialAMQP. It delivers messages
+// sent to deliveries and records acknowledgements and published messages.
+type testAMQPBroker struct {
+	m          sync.Mutex
+	deliveries chan amqp.Delivery
+	acks       []string
+	published  []testAMQPPublishing
+	notifies   []chan *amqp.Error
+	dials      int
+	dialErr    error
+	nack       bool
+}
+
+type testAMQPPublishing struct {
+	exchange string
+	key      string
+	msg      amqp.Publishing
+}
+
+func newTestAMQPBroker() *testAMQPBroker {
+	return &testAMQPBroker{
+		deliveries: make(chan amqp.Delivery),
+	}
+}
+
+func (b *testAMQPBroker) dial(p *amqpConnParams) (amqpConnection, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.dials++
+	if b.dialErr != nil {
+		return nil, b.dialErr
+	}
+	return &testAMQPChannel{b: b}, nil
+}
+
+// closeChannels closes all channels with an error as if the connection was
+// lost.
+func (b *testAMQPBroker) closeChannels() {
+	b.m.Lock()
+	defer b.m.Unlock()
+	for _, c := range b.notifies {
+		c <- &amqp.Error{Code: amqp.ConnectionForced, Reason: "connection lost"}
+	}
+	b.notifies = nil
+}
+
+func (b *testAMQPBroker) acknowledged() []string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return append([]string{}, b.acks...)
+}
+
+func (b *testAMQPBroker) ack(s string) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.acks = append(b.acks, s)
+	return nil
+}
+
+func (b *testAMQPBroker) Ack(tag uint64, multiple bool) error {
+	return b.ack("ack")
+}
+
+func (b *testAMQPBroker) Nack(tag uint64, multiple, requeue bool) error {
+	if requeue {
+		return b.ack("nack requeue")
+	}
+	return b.ack("nack")
+}
+
+func (b *testAMQPBroker) Reject(tag uint64, requeue bool) error {
+	if requeue {
+		return b.ack("reject requeue")
+	}
+	return b.ack("reject")
+}
+
+// testAMQPChannel implements both amqpConnection and amqpChannel.
+type testAMQPChannel struct {
+	b        *testAMQPBroker
+	confirms chan amqp.Confirmation
+	tag      uint64
+}
+
+func (c *testAMQPChannel) Channel() (amqpChannel, error) {
+	return c, nil
+}
+
+func (c *testAMQPChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	return nil
+}
+
+func (c *testAMQPChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	if queue != "sensors" {
+		return nil, errors.New("no queue")
+	}
+	return c.b.deliveries, nil
+}
+
+func (c *testAMQPChannel) Confirm(noWait bool) error {
+	return nil
+}
+
+func (c *testAMQPChannel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	c.confirms = confirm
+	return confirm
+}
+
+func (c *testAMQPChannel) NotifyClose(ch chan *amqp.Error) chan *amqp.Error {
+	c.b.m.Lock()
+	defer c.b.m.Unlock()
+	c.b.notifies = append(c.b.notifies, ch)
+	return ch
+}
+
+func (c *testAMQPChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	c.b.m.Lock()
+	defer c.b.m.Unlock()
+	c.b.published = append(c.b.published, testAMQPPublishing{exchange, key, msg})
+	if c.confirms != nil {
+		c.tag++
+		c.confirms <- amqp.Confirmation{DeliveryTag: c.tag, Ack: !c.b.nack}
+	}
+	return nil
+}
+
+func (c *testAMQPChannel) Close() error {
+	return nil
+}
+
+type testFailingWriter struct{}
+
+func (testFailingWriter) Write(ctx *core.Context, t *core.Tuple) error {
+	return errors.New("the destination is unavailable")
+}
+
+func TestAMQPSource(t *testing.T) {
+	Convey("Given an AMQP broker", t, func() {
+		b := newTestAMQPBroker()
+		dial := dialAMQP
+		dialAMQP = b.dial
+		Reset(func() {
+			dialAMQP = dial
+		})
+
+		ctx := core.NewContext(nil)
+		params := data.Map{
+			"url":                    data.String("amqp://localhost:5672/"),
+			"queue":                  data.String("sensors"),
+			"min_reconnect_interval": data.String("10ms"),
+		}
+		w := &testFileWriter{}
+		w.c = sync.NewCond(&w.m)
+		run := func(w core.Writer) core.Source {
+			s, err := createAMQPSource(ctx, &IOParams{Name: "amqp_test"}, params)
+			So(err, ShouldBeNil)
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, w)
+			}()
+			Reset(func() {
+				s.Stop(ctx)
+				<-ch
+			})
+			return s
+		}
+		ts := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+		deliver := func(body string) {
+			b.deliveries <- amqp.Delivery{
+				Acknowledger: b,
+				RoutingKey:   "sensors.temp",
+				Timestamp:    ts,
+				Body:         []byte(body),
+			}
+		}
+
+		Convey("When consuming messages", func() {
+			params["routing_key_field"] = data.String("key")
+			s := run(w)
+			deliver(`{"v":1.5}`)
+			deliver(`not json`)
+			deliver(`{"v":2}`)
+
+			Convey("Then it should emit a tuple for each message and acknowledge it", func() {
+				ds := w.snapshot(2)
+				So(ds[0], ShouldResemble, data.Map{"v": data.Float(1.5), "key": data.String("sensors.temp")})
+				So(ds[1]["v"], ShouldEqual, data.Int(2))
+				w.m.Lock()
+				So(w.tss[0], ShouldResemble, ts)
+				w.m.Unlock()
+
+				for i := 0; len(b.acknowledged()) < 3; i++ {
+					So(i, ShouldBeLessThan, 1000)
+					time.Sleep(time.Millisecond)
+				}
+				So(b.acknowledged(), ShouldResemble, []string{"ack", "reject", "ack"})
+				st := s.(core.Statuser).Status()["internal_source"].(data.Map)
+				So(st["num_acked"], ShouldEqual, 2)
+				So(st["num_rejected"], ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the destination fails", func() {
+			run(testFailingWriter{})
+			deliver(`{"v":1}`)
+
+			Convey("Then the message should be requeued", func() {
+				for i := 0; len(b.acknowledged()) < 1; i++ {
+					So(i, ShouldBeLessThan, 1000)
+					time.Sleep(time.Millisecond)
+				}
+				So(b.acknowledged(), ShouldResemble, []string{"nack requeue"})
+			})
+		})
+
+		Convey("When the connection is lost", func() {
+			s := run(w)
+			deliver(`{"v":1}`)
+			w.snapshot(1)
+			b.closeChannels()
+
+			Convey("Then the source should reconnect and continue", func() {
+				deliver(`{"v":2}`)
+				ds := w.snapshot(2)
+				So(ds[1]["v"], ShouldEqual, data.Int(2))
+				So(s.(core.Statuser).Status()["internal_source"].(data.Map)["reconnects"], ShouldBeGreaterThan, 0)
+			})
+		})
+
+		Convey("When creating a source with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"invalid url":             {"url": data.String("http://localhost")},
+				"zero prefetch":           {"prefetch": data.Int(0)},
+				"unsupported format":      {"format": data.String("csv")},
+				"invalid json_number":     {"json_number": data.String("decimal")},
+				"negative heartbeat":      {"heartbeat": data.Int(-1)},
+				"invalid reconnect range": {"min_reconnect_interval": data.Int(2), "max_reconnect_interval": data.Int(1)},
+			}
+			for name, c := range cases {
+				c := c
+				Convey("Then "+name+" should result in an error", func() {
+					ps := params.Copy()
+					for k, v := range c {
+						ps[k] = v
+					}
+					_, err := createAMQPSource(ctx, &IOParams{Name: "amqp_test"}, ps)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestAMQPSink(t *testing.T) {
+	Convey("Given an AMQP broker", t, func() {
+		b := newTestAMQPBroker()
+		dial := dialAMQP
+		dialAMQP = b.dial
+		Reset(func() {
+			dialAMQP = dial
+		})
+
+		ctx := core.NewContext(nil)
+		params := data.Map{
+			"url":         data.String("amqp://localhost:5672/"),
+			"exchange":    data.String("events"),
+			"routing_key": data.String("sensors.{type}"),
+		}
+		ts := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+		tuple := core.NewTuple(data.Map{"type": data.String("temp"), "v": data.Int(1)})
+		tuple.Timestamp = ts
+
+		Convey("When writing a tuple", func() {
+			s, err := createAMQPSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+			So(s.Write(ctx, tuple), ShouldBeNil)
+
+			Convey("Then it should be published with the routing key", func() {
+				So(b.published, ShouldHaveLength, 1)
+				p := b.published[0]
+				So(p.exchange, ShouldEqual, "events")
+				So(p.key, ShouldEqual, "sensors.temp")
+				So(string(p.msg.Body), ShouldEqual, `{"type":"temp","v":1}`)
+				So(p.msg.ContentType, ShouldEqual, "application/json")
+				So(p.msg.DeliveryMode, ShouldEqual, amqp.Persistent)
+				So(p.msg.Timestamp, ShouldResemble, ts)
+			})
+
+			Convey("Then the connection should be reused", func() {
+				So(s.Write(ctx, tuple), ShouldBeNil)
+				So(b.dials, ShouldEqual, 1)
+			})
+
+			Convey("Then it should reconnect after the connection is lost", func() {
+				b.closeChannels()
+				So(s.Write(ctx, tuple), ShouldBeNil)
+				So(b.dials, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the broker doesn't accept the message", func() {
+			b.nack = true
+			s, err := createAMQPSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+
+			Convey("Then writing should fail", func() {
+				So(s.Write(ctx, tuple), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the broker is unavailable", func() {
+			b.dialErr = errors.New("connection refused")
+			s, err := createAMQPSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+
+			Convey("Then writing should fail", func() {
+				So(s.Write(ctx, tuple), ShouldNotBeNil)
+
+				Convey("And it should succeed after the broker recovers", func() {
+					b.dialErr = nil
+					So(s.Write(ctx, tuple), ShouldBeNil)
+				})
+			})
+		})
+
+		Convey("When writing a tuple without a value for the routing key", func() {
+			s, err := createAMQPSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+
+			Convey("Then it should fail", func() {
+				So(s.Write(ctx, core.NewTuple(data.Map{})), ShouldNotBeNil)
+				So(b.published, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When creating a sink with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"missing url":          {"url": data.String("")},
+				"invalid routing_key":  {"routing_key": data.String("sensors.{type")},
+				"zero publish_timeout": {"publish_timeout": data.Int(0)},
+				"unsupported format":   {"format": data.String("xml")},
+			}
+			for name, c := range cases {
+				c := c
+				Convey("Then "+name+" should result in an error", func() {
+					ps := params.Copy()
+					for k, v := range c {
+						ps[k] = v
+					}
+					_, err := createAMQPSink(ctx, &IOParams{}, ps)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
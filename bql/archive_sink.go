@@ -0,0 +1,293 @@
+package bql
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archiveFile writes tuples to a file in a specific format such as CSV or
+// Parquet. It's created by archiveSink every time the sink rotates files.
+type archiveFile interface {
+	// Write writes a tuple to the file.
+	Write(m data.Map) error
+
+	// Size returns the approximate number of bytes written to the file
+	// including data buffered in the archiveFile.
+	Size() int64
+
+	// Close flushes buffered data. It doesn't close the underlying writer.
+	Close() error
+}
+
+// archiveFileCreator creates a new archiveFile writing to w. m is the first
+// tuple written to the file.
+type archiveFileCreator func(w *countingWriter, m data.Map) (archiveFile, error)
+
+// archiveParams has parameters shared by sinks archiving tuples to rotating
+// files.
+type archiveParams struct {
+	// Path is the path of the file. When rotation is enabled, each file
+	// has a timestamp inserted before the extension of the path, e.g.
+	// "out-20160102T150405.000.csv" for path="out.csv".
+	Path string `bql:",required"`
+
+	// RotateSize is the size of a file in bytes which triggers rotation.
+	RotateSize int64
+
+	// RotateInterval is the maximum duration for which a file is written.
+	RotateInterval time.Duration
+}
+
+func (p *archiveParams) validate() error {
+	if p.RotateSize < 0 {
+		return fmt.Errorf("rotate_size must not be negative: %v", p.RotateSize)
+	}
+	if p.RotateInterval < 0 {
+		return fmt.Errorf("rotate_interval must not be negative: %v", p.RotateInterval)
+	}
+	return nil
+}
+
+func (p *archiveParams) rotates() bool {
+	return p.RotateSize > 0 || p.RotateInterval > 0
+}
+
+// archiveSink writes tuples to files which are rotated based on their sizes
+// and ages. A file is created lazily when a tuple is written, so no empty
+// file is created while no tuple arrives.
+type archiveSink struct {
+	params archiveParams
+
+	// ext is appended to the name of each file, e.g. ".gz".
+	ext string
+
+	// partial is appended to the name of a file being written. The file is
+	// renamed when it's closed so that other tools can process only
+	// completed files. When it's empty, a file is written in place.
+	partial string
+
+	// appends is true when the sink appends tuples to an existing file
+	// instead of truncating it. It's only used when rotation is disabled.
+	appends bool
+
+	newFile archiveFileCreator
+
+	m      sync.Mutex
+	file   *os.File
+	af     archiveFile
+	name   string
+	opened time.Time
+	closed bool
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+func newArchiveSink(ctx *core.Context, params archiveParams, ext, partial string, appends bool,
+	newFile archiveFileCreator) (*archiveSink, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	s := &archiveSink{
+		params:  params,
+		ext:     ext,
+		partial: partial,
+		appends: appends,
+		newFile: newFile,
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+	if params.RotateInterval > 0 {
+		go s.rotateOnInterval(ctx)
+	} else {
+		close(s.doneCh)
+	}
+	return s, nil
+}
+
+// rotateOnInterval closes the current file when it becomes older than
+// rotate_interval even if no tuple is written.
+func (s *archiveSink) rotateOnInterval(ctx *core.Context) {
+	defer close(s.doneCh)
+	check := s.params.RotateInterval / 10
+	if check < 10*time.Millisecond {
+		check = 10 * time.Millisecond
+	} else if check > time.Second {
+		check = time.Second
+	}
+	t := time.NewTicker(check)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-t.C:
+		}
+
+		s.m.Lock()
+		if s.af != nil && time.Now().Sub(s.opened) >= s.params.RotateInterval {
+			name := s.name
+			if err := s.closeFile(); err != nil {
+				ctx.ErrLog(err).WithField("path", name).Error("Cannot close the file")
+			}
+		}
+		s.m.Unlock()
+	}
+}
+
+func (s *archiveSink) Write(ctx *core.Context, t *core.Tuple) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return fmt.Errorf("the sink is already closed")
+	}
+
+	if s.af != nil && s.shouldRotate() {
+		if err := s.closeFile(); err != nil {
+			return err
+		}
+	}
+	if s.af == nil {
+		if err := s.openFile(t.Data); err != nil {
+			return err
+		}
+	}
+	return s.af.Write(t.Data)
+}
+
+func (s *archiveSink) shouldRotate() bool {
+	if s.params.RotateSize > 0 && s.af.Size() >= s.params.RotateSize {
+		return true
+	}
+	if s.params.RotateInterval > 0 && time.Now().Sub(s.opened) >= s.params.RotateInterval {
+		return true
+	}
+	return false
+}
+
+func (s *archiveSink) openFile(m data.Map) error {
+	now := time.Now()
+	name, err := s.fileName(now)
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if s.appends && !s.params.rotates() {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(name+s.partial, flags, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	c := &countingWriter{w: f, n: info.Size()}
+	af, err := s.newFile(c, m)
+	if err != nil {
+		f.Close()
+		if info.Size() == 0 {
+			os.Remove(name + s.partial)
+		}
+		return err
+	}
+	s.file = f
+	s.af = af
+	s.name = name
+	s.opened = now
+	return nil
+}
+
+// fileName returns the name of a new file. When rotation is enabled, the
+// name has the given time. When a file having the same name already exists,
+// the time is advanced by a millisecond so that names of files can be sorted
+// in the order of creation.
+func (s *archiveSink) fileName(now time.Time) (string, error) {
+	if !s.params.rotates() {
+		return s.params.Path + s.ext, nil
+	}
+
+	dir, base := filepath.Split(s.params.Path)
+	ext := ""
+	if i := strings.Index(base, "."); i > 0 {
+		base, ext = base[:i], base[i:]
+	}
+	for t := now.UTC(); ; t = t.Add(time.Millisecond) {
+		name := filepath.Join(dir, fmt.Sprint(base, "-", t.Format("20060102T150405.000"), ext, s.ext))
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			if _, err := os.Stat(name + s.partial); os.IsNotExist(err) {
+				return name, nil
+			}
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// closeFile closes the current file. The caller must hold the lock.
+func (s *archiveSink) closeFile() error {
+	if s.af == nil {
+		return nil
+	}
+	err := s.af.Close()
+	if e := s.file.Close(); err == nil {
+		err = e
+	}
+	if s.partial != "" && err == nil {
+		err = os.Rename(s.name+s.partial, s.name)
+	}
+	s.file = nil
+	s.af = nil
+	return err
+}
+
+func (s *archiveSink) Close(ctx *core.Context) error {
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.stopCh)
+	err := s.closeFile()
+	s.m.Unlock()
+
+	<-s.doneCh
+	return err
+}
+
+// Status returns the status of the sink.
+func (s *archiveSink) Status() data.Map {
+	s.m.Lock()
+	defer s.m.Unlock()
+	st := data.Map{
+		"path": data.String(s.params.Path),
+	}
+	if s.af != nil {
+		st["current_file"] = data.String(s.name)
+		st["current_size"] = data.Int(s.af.Size())
+	}
+	return st
+}
+
+// countingWriter counts the number of bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
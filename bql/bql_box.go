@@ -1,23 +1,41 @@
 package bql
 
 import (
+	"errors"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/sensorbee/sensorbee.v0/bql/execution"
 	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
 	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrProcessingTimeout is the error reported with a tuple dropped by a box
+// because processing it took longer than the processing_timeout option of
+// the stream.
+var ErrProcessingTimeout = errors.New("processing the tuple timed out")
+
 type bqlBox struct {
 	// stmt is the BQL statement executed by this box
 	stmt *parser.SelectStmt
 	// reg holds functions that can be used in this box
 	reg udf.FunctionRegistry
+	// caseInsensitive is true when column references in stmt should
+	// match keys of input tuples case-insensitively
+	caseInsensitive bool
 	// plan is the execution plan for the SELECT statement in there
 	execPlan execution.PhysicalPlan
+	// columns has the top-level keys of the output in the order of the
+	// projection list. See execution.LogicalPlan.OutputColumns.
+	columns []string
+	// ordering sorts and truncates results computed from a tuple as
+	// specified by the ORDER BY and LIMIT clauses. It's nil when the
+	// statement doesn't have them.
+	ordering *execution.ResultOrdering
 	// mutex protects access to shared state
 	mutex sync.Mutex
 	// timeEmitterMutex protects access to those resources
@@ -32,6 +50,9 @@ type bqlBox struct {
 	// emitterSamplingType holds a value different from
 	// parser.UnspecifiedSamplingType if output sampling is active
 	emitterSamplingType parser.EmitterSamplingType
+	// rand generates random numbers for the randomized sampling. It's nil
+	// when the sampling isn't seeded and the global source is used instead.
+	rand *rand.Rand
 	// genCount holds the number of items generated so far
 	// (i.e. computed by the underlying execution plan). this is only
 	// used if the count-based sampling is active.
@@ -50,6 +71,17 @@ type bqlBox struct {
 	// removeMe is a function to remove this bqlBox from its
 	// topology. A nil check must be done before calling.
 	removeMe func()
+	// samplesMutex protects samples
+	samplesMutex sync.Mutex
+	// samples holds the last tuple received from each input. They're
+	// used to estimate memory footprints of input buffers.
+	samples map[string]*core.Tuple
+	// processingTimeout is the maximum duration to process a tuple. It's
+	// disabled when it isn't positive.
+	processingTimeout time.Duration
+	// numTimeouts is the number of tuples abandoned due to the timeout.
+	// It must be accessed atomically.
+	numTimeouts int64
 }
 
 func NewBQLBox(stmt *parser.SelectStmt, reg udf.FunctionRegistry) *bqlBox {
@@ -65,14 +97,26 @@ func (b *bqlBox) Init(ctx *core.Context) error {
 	b.emitterLimit = analyzedPlan.EmitterLimit
 	b.emitterSampling = analyzedPlan.EmitterSampling
 	b.emitterSamplingType = analyzedPlan.EmitterSamplingType
+	if seed := analyzedPlan.EmitterSamplingSeed; seed != parser.UnspecifiedSeed {
+		b.rand = rand.New(rand.NewSource(seed))
+	}
+	analyzedPlan.CaseInsensitive = b.caseInsensitive
 	optimizedPlan, err := analyzedPlan.LogicalOptimize()
 	if err != nil {
 		return err
 	}
+	b.columns, err = optimizedPlan.OutputColumns()
+	if err != nil {
+		return err
+	}
 	b.execPlan, err = optimizedPlan.MakePhysicalPlan(b.reg)
 	if err != nil {
 		return err
 	}
+	b.ordering, err = optimizedPlan.MakeResultOrdering(b.reg)
+	if err != nil {
+		return err
+	}
 	if b.emitterSamplingType == parser.TimeBasedSampling {
 		go b.timeEmitter(ctx)
 	}
@@ -80,8 +124,61 @@ func (b *bqlBox) Init(ctx *core.Context) error {
 }
 
 func (b *bqlBox) Process(ctx *core.Context, t *core.Tuple, s core.Writer) error {
+	if b.processingTimeout > 0 {
+		return b.processWithTimeout(ctx, t, s)
+	}
+
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
+	return b.process(ctx, t, s)
+}
+
+// processWithTimeout processes a tuple in another goroutine and abandons it
+// when it isn't done within the processing timeout. Because the execution
+// plan can't be interrupted, an abandoned tuple may still be added to
+// windows, but its results are never written. A tuple which times out while
+// waiting for an abandoned one is skipped without being processed so that
+// one slow tuple doesn't block the following ones for longer than the
+// timeout.
+//
+// The goroutine processes a copy of the tuple because the caller reports the
+// tuple as a dropped tuple, which modifies it, while an abandoned goroutine
+// is still running.
+func (b *bqlBox) processWithTimeout(ctx *core.Context, t *core.Tuple, s core.Writer) error {
+	w := &abandonableWriter{w: s}
+	done := make(chan error, 1)
+	copied := t.ShallowCopy()
+	go func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if w.isAbandoned() {
+			done <- nil
+			return
+		}
+		done <- b.process(ctx, copied, w)
+	}()
+
+	timer := time.NewTimer(b.processingTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		w.abandon()
+		atomic.AddInt64(&b.numTimeouts, 1)
+		return ErrProcessingTimeout
+	}
+}
+
+// process processes a tuple. The caller must hold b.mutex.
+func (b *bqlBox) process(ctx *core.Context, t *core.Tuple, s core.Writer) error {
+	b.samplesMutex.Lock()
+	if b.samples == nil {
+		b.samples = map[string]*core.Tuple{}
+	}
+	// t itself can be modified when it's reported as a dropped tuple
+	b.samples[t.InputName] = t.ShallowCopy()
+	b.samplesMutex.Unlock()
 
 	// deal with statements that have an emitter limit. in particular,
 	// if we are already over the limit, exit here
@@ -98,11 +195,21 @@ func (b *bqlBox) Process(ctx *core.Context, t *core.Tuple, s core.Writer) error
 	if err != nil {
 		return err
 	}
+	if b.ordering != nil {
+		if resultData, err = b.ordering.Apply(resultData); err != nil {
+			return err
+		}
+	}
 
 	// emit result data as tuples
 	for _, data := range resultData {
+		// the result inherits metadata such as the correlation ID from the
+		// tuple which triggered the computation, even in joins
 		tup := t.ShallowCopy()
 		tup.Data = data
+		tup.Columns = execution.OrderColumns(b.columns, data)
+		// results computed on a heartbeat are regular tuples
+		tup.Flags.Clear(core.TFHeartbeat)
 		// This method can't tell if data was originally shared by some tuples.
 		// Therefore, TFSharedData flag cannot be cleared here. Data of some
 		// Tuples can be shared when they have reference types such as Blob,
@@ -117,7 +224,11 @@ func (b *bqlBox) Process(ctx *core.Context, t *core.Tuple, s core.Writer) error
 			b.genCount += 1
 		} else if b.emitterSamplingType == parser.RandomizedSampling {
 			// emitterSampling is in [0,1], not [0,100] any more
-			shouldWriteTuple = rand.Float64() < b.emitterSampling
+			if b.rand != nil {
+				shouldWriteTuple = b.rand.Float64() < b.emitterSampling
+			} else {
+				shouldWriteTuple = rand.Float64() < b.emitterSampling
+			}
 		} else if b.emitterSamplingType == parser.TimeBasedSampling {
 			// we will never emit something from this function
 			// when the time-based emitter is used
@@ -147,6 +258,14 @@ func (b *bqlBox) Process(ctx *core.Context, t *core.Tuple, s core.Writer) error
 		}
 	}
 
+	// forward the heartbeat so that windows of downstream boxes can also
+	// be closed
+	if t.Flags.IsSet(core.TFHeartbeat) {
+		if err := s.Write(ctx, t); err != nil {
+			return err
+		}
+	}
+
 	// remove this box if we are over the limit
 	b.timeEmitterMutex.Lock()
 	if b.emitterLimit >= 0 && b.emitCount >= b.emitterLimit {
@@ -228,9 +347,188 @@ func (b *bqlBox) Terminate(ctx *core.Context) error {
 	return nil
 }
 
+// Status returns the estimated memory footprint of the input buffer of each
+// input stream, which is computed from the last tuple received from it.
+// Inputs which haven't received any tuple yet aren't included.
+func (b *bqlBox) Status() data.Map {
+	b.samplesMutex.Lock()
+	defer b.samplesMutex.Unlock()
+
+	footprints := data.Map{}
+	for _, rel := range b.stmt.Relations {
+		if rel.Type != parser.ActualStream {
+			continue
+		}
+		if _, ok := footprints[rel.Name]; ok {
+			// only the first occurrence is used for the input config
+			continue
+		}
+		t, ok := b.samples[rel.Name]
+		if !ok {
+			continue
+		}
+		footprints[rel.Name] = data.Int(EstimateWindowFootprint(&rel.StreamWindowAST, t))
+	}
+	st := data.Map{
+		"estimated_buffer_bytes": footprints,
+	}
+	if b.processingTimeout > 0 {
+		st["processing_timeout"] = data.Float(b.processingTimeout.Seconds())
+		st["num_processing_timeouts"] = data.Int(atomic.LoadInt64(&b.numTimeouts))
+	}
+	return st
+}
+
+// abandonableWriter discards tuples written after the tuple being processed
+// is abandoned.
+type abandonableWriter struct {
+	w         core.Writer
+	m         sync.Mutex
+	abandoned bool
+}
+
+func (a *abandonableWriter) Write(ctx *core.Context, t *core.Tuple) error {
+	a.m.Lock()
+	defer a.m.Unlock()
+	if a.abandoned {
+		return nil
+	}
+	return a.w.Write(ctx, t)
+}
+
+func (a *abandonableWriter) abandon() {
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.abandoned = true
+}
+
+func (a *abandonableWriter) isAbandoned() bool {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.abandoned
+}
+
 func (b *bqlBox) callRemoveMeIgnoringPanic() {
 	defer func() {
 		recover()
 	}()
 	b.removeMe()
 }
+
+// orderedUnionBox executes SELECT statements of SELECT ... UNION ALL ORDERED
+// in one box. Each input tuple is processed by the statements in the order
+// of declaration so that all results of a statement are written before
+// results of the next one.
+type orderedUnionBox struct {
+	branches []*bqlBox
+	// inputs has names of inputs each branch reads from.
+	inputs []map[string]bool
+}
+
+func newOrderedUnionBox(stmt *parser.SelectUnionStmt, reg udf.FunctionRegistry) *orderedUnionBox {
+	b := &orderedUnionBox{
+		branches: make([]*bqlBox, len(stmt.Selects)),
+		inputs:   make([]map[string]bool, len(stmt.Selects)),
+	}
+	for i := range stmt.Selects {
+		b.branches[i] = NewBQLBox(&stmt.Selects[i], reg)
+		b.inputs[i] = map[string]bool{}
+		for _, rel := range stmt.Selects[i].Relations {
+			b.inputs[i][rel.Name] = true
+		}
+	}
+	return b
+}
+
+func (b *orderedUnionBox) Init(ctx *core.Context) error {
+	for i, br := range b.branches {
+		if err := br.Init(ctx); err != nil {
+			for _, initialized := range b.branches[:i] {
+				initialized.Terminate(ctx)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *orderedUnionBox) Process(ctx *core.Context, t *core.Tuple, w core.Writer) error {
+	for i, br := range b.branches {
+		if !b.inputs[i][t.InputName] {
+			continue
+		}
+		if err := br.Process(ctx, t.ShallowCopy(), w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *orderedUnionBox) Terminate(ctx *core.Context) error {
+	for _, br := range b.branches {
+		br.Terminate(ctx)
+	}
+	return nil
+}
+
+// recursiveUnionBox executes SELECT statements of CREATE RECURSIVE STREAM.
+// Each result is written to the output and also fed back to the statements
+// referring to the stream itself, which is repeated until no more results
+// are computed or results have been fed back maxIterations times.
+type recursiveUnionBox struct {
+	*orderedUnionBox
+	name          string
+	maxIterations int64
+}
+
+func newRecursiveUnionBox(name string, stmt *parser.CreateStreamAsSelectUnionStmt,
+	reg udf.FunctionRegistry) *recursiveUnionBox {
+	return &recursiveUnionBox{
+		orderedUnionBox: newOrderedUnionBox(&stmt.SelectUnionStmt, reg),
+		name:            name,
+		maxIterations:   stmt.MaxIterations,
+	}
+}
+
+func (b *recursiveUnionBox) Process(ctx *core.Context, t *core.Tuple, w core.Writer) error {
+	// Results are fed back after the current tuple has been processed
+	// because bqlBox.Process cannot be called recursively.
+	fw := &feedbackWriter{
+		w:    w,
+		name: b.name,
+		feed: true,
+	}
+	if err := b.orderedUnionBox.Process(ctx, t, fw); err != nil {
+		return err
+	}
+	for i := int64(1); i <= b.maxIterations && len(fw.tuples) > 0; i++ {
+		pending := fw.tuples
+		fw.tuples = nil
+		fw.feed = i < b.maxIterations
+		for _, ft := range pending {
+			if err := b.orderedUnionBox.Process(ctx, ft, fw); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// feedbackWriter writes tuples to w and keeps their copies so that they
+// can be fed back to the recursive stream.
+type feedbackWriter struct {
+	w      core.Writer
+	name   string
+	feed   bool
+	tuples []*core.Tuple
+}
+
+func (fw *feedbackWriter) Write(ctx *core.Context, t *core.Tuple) error {
+	if fw.feed {
+		// t can be modified by the destination after being written
+		ft := t.Copy()
+		ft.InputName = fw.name
+		fw.tuples = append(fw.tuples, ft)
+	}
+	return fw.w.Write(ctx, t)
+}
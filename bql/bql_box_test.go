@@ -3,9 +3,11 @@ package bql
 import (
 	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
 	_ "gopkg.in/sensorbee/sensorbee.v0/bql/udf/builtin"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
 	"testing"
 	"time"
 )
@@ -61,6 +63,8 @@ func TestBasicBQLBoxConnectivity(t *testing.T) {
 		Convey("When 4 tuples are emitted by the source", func() {
 			tup2.Data["x"] = data.String(fmt.Sprintf("%d", ((2 + 1) % 3)))
 			tup4.Data["x"] = data.String(fmt.Sprintf("%d", ((4 + 1) % 3)))
+			tup2.Columns = []string{"int", "x"}
+			tup4.Columns = []string{"int", "x"}
 
 			Convey("Then the sink receives 2 tuples", func() {
 				si.Wait(2)
@@ -140,6 +144,7 @@ func TestBQLBoxEmitterParams(t *testing.T) {
 
 		Convey("When 4 tuples are emitted by the source", func() {
 			tup2.Data["x"] = data.String(fmt.Sprintf("%d", ((2 + 1) % 3)))
+			tup2.Columns = []string{"int", "x"}
 
 			Convey("Then the sink receives 1 tuple", func() {
 				si.Wait(1)
@@ -381,6 +386,95 @@ func TestBQLBoxEmitterParams(t *testing.T) {
 			})
 		})
 	})
+
+	Convey("Given a BQL statement with a seeded SAMPLE clause", t, func() {
+		s := "CREATE STREAM box AS SELECT " +
+			`RSTREAM [SAMPLE 50% SEED 7 LIMIT 10] int, str((int+1) % 3) AS x FROM duplicate("source", 10) [RANGE 1 TUPLES]`
+		run := func() []data.Value {
+			tb, err := setupTopology(s, false)
+			So(err, ShouldBeNil)
+			dt := tb.Topology()
+			defer dt.Stop()
+
+			sin, err := dt.Sink("snk")
+			So(err, ShouldBeNil)
+			si := sin.Sink().(*tupleCollectorSink)
+			si.Wait(10)
+			So(si.len(), ShouldEqual, 10)
+
+			res := []data.Value{}
+			si.forEachTuple(func(t *core.Tuple) {
+				res = append(res, t.Data["int"])
+			})
+			return res
+		}
+
+		Convey("When running the statement twice", func() {
+			first := run()
+			second := run()
+
+			Convey("Then the same tuples should be selected", func() {
+				So(second, ShouldResemble, first)
+			})
+		})
+	})
+}
+
+func TestBQLBoxWithNamedSelects(t *testing.T) {
+	Convey("Given a statement having a WITH clause in BQL", t, func() {
+		s := "CREATE STREAM box AS " +
+			"WITH even AS (SELECT RSTREAM int FROM source [RANGE 1 TUPLES] WHERE int % 2 = 0) " +
+			"SELECT RSTREAM even:int * 10 AS x FROM even [RANGE 1 TUPLES]"
+		tb, err := setupTopology(s, false)
+		So(err, ShouldBeNil)
+		dt := tb.Topology()
+		Reset(func() {
+			dt.Stop()
+		})
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+
+		Convey("When 4 tuples are emitted by the source", func() {
+			Convey("Then the sink receives the results computed from the named statement", func() {
+				si.Wait(2)
+				So(si.len(), ShouldEqual, 2)
+				res := []data.Value{}
+				si.forEachTuple(func(t *core.Tuple) {
+					res = append(res, t.Data["x"])
+				})
+				So(res, ShouldResemble, []data.Value{data.Int(20), data.Int(40)})
+			})
+		})
+	})
+
+	Convey("Given a WITH clause whose named statements refer to each other in BQL", t, func() {
+		s := "CREATE STREAM box AS " +
+			"WITH even AS (SELECT RSTREAM int FROM source [RANGE 1 TUPLES] WHERE int % 2 = 0), " +
+			"large AS (SELECT RSTREAM int FROM even [RANGE 1 TUPLES] WHERE int > 2) " +
+			"SELECT RSTREAM int FROM large [RANGE 1 TUPLES]"
+		tb, err := setupTopology(s, false)
+		So(err, ShouldBeNil)
+		dt := tb.Topology()
+		Reset(func() {
+			dt.Stop()
+		})
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+
+		Convey("When 4 tuples are emitted by the source", func() {
+			Convey("Then the sink receives the results of the whole pipeline", func() {
+				si.Wait(1)
+				So(si.len(), ShouldEqual, 1)
+				si.forEachTuple(func(t *core.Tuple) {
+					So(t.Data["int"], ShouldEqual, data.Int(4))
+				})
+			})
+		})
+	})
 }
 
 func TestBasicBQLBoxUnionCapability(t *testing.T) {
@@ -622,6 +716,151 @@ func TestBQLBoxJoinCapability(t *testing.T) {
 	})
 }
 
+func TestBQLBoxCorrelationID(t *testing.T) {
+	Convey("Given a source assigning correlation IDs and a join with a UDSF", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		err = addBQLToTopology(tb, `
+			CREATE PAUSED SOURCE source TYPE dummy WITH num=4, correlation_id="int";
+			CREATE STREAM box AS SELECT ISTREAM
+				source:int AS a, source:correlation_id() AS c, d:correlation_id() AS dc
+			FROM source [RANGE 4 TUPLES], duplicate("source", 2) [RANGE 8 TUPLES] AS d
+			WHERE source:int = d:int;
+			CREATE SINK snk TYPE collector;
+			INSERT INTO snk FROM box;`)
+		So(err, ShouldBeNil)
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+
+		Convey("When the source emits tuples", func() {
+			So(addBQLToTopology(tb, "RESUME SOURCE source;"), ShouldBeNil)
+			si.Wait(4)
+
+			Convey("Then the correlation IDs should reach the sink intact", func() {
+				So(si.len(), ShouldBeGreaterThanOrEqualTo, 4)
+				si.forEachTuple(func(t *core.Tuple) {
+					id := fmt.Sprint(t.Data["a"])
+					So(t.CorrelationID, ShouldEqual, id)
+					So(t.Data["c"], ShouldEqual, data.String(id))
+					So(t.Data["dc"], ShouldEqual, data.String(id))
+				})
+			})
+		})
+	})
+
+	Convey("Given a source without correlation IDs", t, func() {
+		s := `CREATE STREAM box AS SELECT RSTREAM int, correlation_id() FROM source [RANGE 1 TUPLES]`
+		tb, err := setupTopology(s, false)
+		So(err, ShouldBeNil)
+		dt := tb.Topology()
+		Reset(func() {
+			dt.Stop()
+		})
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+
+		Convey("When the source emits tuples", func() {
+			si.Wait(4)
+
+			Convey("Then correlation_id() should return null", func() {
+				si.forEachTuple(func(t *core.Tuple) {
+					So(t.CorrelationID, ShouldBeEmpty)
+					So(t.Data["correlation_id"], ShouldResemble, data.Null{})
+				})
+			})
+		})
+	})
+
+	Convey("Given a topology builder", t, func() {
+		tb, err := NewTopologyBuilder(newTestTopology())
+		So(err, ShouldBeNil)
+		Reset(func() {
+			tb.Topology().Stop()
+		})
+
+		Convey("When creating a source with an invalid correlation_id", func() {
+			for _, v := range []string{"1", `"a["`} {
+				err := addBQLToTopology(tb, "CREATE SOURCE source TYPE dummy WITH correlation_id="+v)
+
+				Convey("Then it should fail with "+v, func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "correlation_id")
+				})
+			}
+		})
+	})
+}
+
+func TestBQLBoxTupleID(t *testing.T) {
+	Convey("Given a sink generating IDs of tuples from columns", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		err = addBQLToTopology(tb, `
+			CREATE PAUSED SOURCE source TYPE dummy WITH num=4;
+			CREATE STREAM box AS SELECT RSTREAM
+				int, {"x": int % 2, "y": [int]} AS m, ts() AS ts
+			FROM duplicate("source", 2) [RANGE 1 TUPLES];
+			CREATE SINK snk TYPE collector WITH id_columns=["int", "m.y"];
+			INSERT INTO snk FROM box;`)
+		So(err, ShouldBeNil)
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+
+		Convey("When the source emits tuples", func() {
+			So(addBQLToTopology(tb, "RESUME SOURCE source;"), ShouldBeNil)
+			si.Wait(8)
+
+			Convey("Then tuples having the same columns should have the same ID", func() {
+				So(si.len(), ShouldEqual, 8)
+				ids := map[string]data.Value{}
+				si.forEachTuple(func(t *core.Tuple) {
+					So(t.ID, ShouldNotBeEmpty)
+					if v, ok := ids[t.ID]; ok {
+						So(t.Data["int"], ShouldEqual, v)
+					}
+					ids[t.ID] = t.Data["int"]
+				})
+				So(len(ids), ShouldEqual, 4)
+			})
+		})
+	})
+
+	Convey("Given a topology builder", t, func() {
+		tb, err := NewTopologyBuilder(newTestTopology())
+		So(err, ShouldBeNil)
+		Reset(func() {
+			tb.Topology().Stop()
+		})
+
+		Convey("When creating a sink with invalid id_columns", func() {
+			for _, v := range []string{"1", `"a"`, "[]", "[1]", `["a["]`} {
+				err := addBQLToTopology(tb, "CREATE SINK snk TYPE collector WITH id_columns="+v)
+
+				Convey("Then it should fail with "+v, func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "id_columns")
+				})
+			}
+		})
+	})
+}
+
 func TestBQLBoxGroupByCapability(t *testing.T) {
 	Convey("Given an ISTREAM/2 SECONDS BQL statement", t, func() {
 		s := "CREATE STREAM box AS SELECT " +
@@ -655,6 +894,437 @@ func TestBQLBoxGroupByCapability(t *testing.T) {
 	})
 }
 
+func TestBQLBoxEmptyWindow(t *testing.T) {
+	stmt := "CREATE STREAM box AS SELECT RSTREAM %v count(1) FROM source [RANGE 1 TUPLES] WHERE int %% 2 = 0"
+
+	Convey("Given an aggregate statement emitting rows for empty windows", t, func() {
+		tb, err := setupTopology(fmt.Sprintf(stmt, "[EMIT EMPTY]"), false)
+		So(err, ShouldBeNil)
+		dt := tb.Topology()
+		Reset(func() {
+			dt.Stop()
+		})
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+
+		Convey("When 4 tuples are emitted by the source", func() {
+			Convey("Then the sink receives a tuple for each window", func() {
+				si.Wait(4)
+				So(si.len(), ShouldEqual, 4)
+				for i := 0; i < 4; i++ {
+					So(si.get(i).Data["count"], ShouldResemble, data.Int(i%2))
+				}
+			})
+		})
+	})
+
+	Convey("Given an aggregate statement skipping empty windows", t, func() {
+		tb, err := setupTopology(fmt.Sprintf(stmt, "[SKIP EMPTY]"), false)
+		So(err, ShouldBeNil)
+		dt := tb.Topology()
+		Reset(func() {
+			dt.Stop()
+		})
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+
+		Convey("When 4 tuples are emitted by the source", func() {
+			Convey("Then the sink only receives tuples for windows having rows", func() {
+				// the last tuple from the source isn't filtered out, so all
+				// tuples have been processed once the second one arrives
+				si.Wait(2)
+				So(si.len(), ShouldEqual, 2)
+				for i := 0; i < 2; i++ {
+					So(si.get(i).Data["count"], ShouldResemble, data.Int(1))
+				}
+			})
+		})
+	})
+}
+
+func TestBQLBoxProjectionAlias(t *testing.T) {
+	Convey("Given a statement referring to an alias of a preceding projection", t, func() {
+		tb, err := setupTopology("CREATE STREAM box AS SELECT "+
+			"RSTREAM int + 1 AS a, a * 2 AS b FROM source [RANGE 1 TUPLES]", false)
+		So(err, ShouldBeNil)
+		dt := tb.Topology()
+		Reset(func() {
+			dt.Stop()
+		})
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+
+		Convey("When 4 tuples are emitted by the source", func() {
+			Convey("Then the sink receives tuples computed from the alias", func() {
+				si.Wait(4)
+				So(si.len(), ShouldEqual, 4)
+				for i := 0; i < 4; i++ {
+					So(si.get(i).Data, ShouldResemble, data.Map{
+						"a": data.Int(i + 2),
+						"b": data.Int((i + 2) * 2),
+					})
+				}
+			})
+		})
+	})
+}
+
+func TestBQLBoxOrderByLimit(t *testing.T) {
+	Convey("Given a statement with ORDER BY and LIMIT", t, func() {
+		tb, err := setupTopology("CREATE STREAM box AS SELECT "+
+			"RSTREAM int AS x FROM source [RANGE 3 TUPLES] ORDER BY x DESC LIMIT 2 OFFSET 1", false)
+		So(err, ShouldBeNil)
+		dt := tb.Topology()
+		Reset(func() {
+			dt.Stop()
+		})
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+
+		Convey("When 4 tuples are emitted by the source", func() {
+			Convey("Then the sink receives sorted and truncated results of each window", func() {
+				si.Wait(5)
+				So(si.len(), ShouldEqual, 5)
+				expected := []int64{1, 2, 1, 3, 2}
+				for i, x := range expected {
+					So(si.get(i).Data, ShouldResemble, data.Map{"x": data.Int(x)})
+				}
+			})
+		})
+	})
+
+	Convey("Given a statement referring to an input relation in ORDER BY", t, func() {
+		_, err := setupTopology("CREATE STREAM box AS SELECT "+
+			"RSTREAM int FROM source [RANGE 3 TUPLES] ORDER BY source:int", false)
+
+		Convey("Then it should fail", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "ORDER BY")
+		})
+	})
+}
+
+func TestBQLBoxColumns(t *testing.T) {
+	Convey("Given a statement having aliases and a wildcard", t, func() {
+		tb, err := setupTopology("CREATE STREAM box AS SELECT "+
+			`RSTREAM int * 2 AS z, *, "x" AS b.c, int + 1 AS a, "y" AS b.d `+
+			"FROM source [RANGE 1 TUPLES]", false)
+		So(err, ShouldBeNil)
+		dt := tb.Topology()
+		Reset(func() {
+			dt.Stop()
+		})
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+
+		Convey("When 4 tuples are emitted by the source", func() {
+			Convey("Then the tuples should have columns in the order of projections", func() {
+				si.Wait(4)
+				So(si.len(), ShouldEqual, 4)
+				for i := 0; i < 4; i++ {
+					So(si.get(i).Columns, ShouldResemble, []string{"z", "int", "b", "a"})
+				}
+			})
+		})
+	})
+}
+
+func TestBQLBoxStatus(t *testing.T) {
+	Convey("Given a statement with BUFFER SIZE", t, func() {
+		tb, err := setupTopology("CREATE STREAM box AS SELECT "+
+			"RSTREAM int FROM source [RANGE 1 TUPLES, BUFFER SIZE 10]", false)
+		So(err, ShouldBeNil)
+		dt := tb.Topology()
+		Reset(func() {
+			dt.Stop()
+		})
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+
+		Convey("When 4 tuples are emitted by the source", func() {
+			si.Wait(4)
+
+			Convey("Then the status should have the estimated footprint of the buffer", func() {
+				bn, err := dt.Box("box")
+				So(err, ShouldBeNil)
+				v, err := bn.Status().Get(data.MustCompilePath("box.estimated_buffer_bytes.source"))
+				So(err, ShouldBeNil)
+				est, err := data.AsInt(v)
+				So(err, ShouldBeNil)
+				So(est, ShouldBeGreaterThan, 0)
+				So(est%10, ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestBQLBoxProcessingTimeout(t *testing.T) {
+	Convey("Given a stream with a processing timeout calling a slow UDF", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		// block_on_2 blocks the tuple having 2 until release is closed
+		release := make(chan struct{})
+		var once sync.Once
+		unblock := func() {
+			once.Do(func() {
+				close(release)
+			})
+		}
+		Reset(unblock)
+		So(tb.Reg.Register("block_on_2", udf.MustConvertGeneric(func(i int) int {
+			if i == 2 {
+				<-release
+			}
+			return i
+		})), ShouldBeNil)
+
+		_, err = dt.AddSource("dropped", core.NewDroppedTupleCollectorSource(), nil)
+		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `
+			CREATE PAUSED SOURCE source TYPE dummy WITH num=4;
+			CREATE STREAM box WITH processing_timeout=0.2 AS
+				SELECT ISTREAM block_on_2(int) AS int FROM source [RANGE 1 TUPLES];
+			CREATE SINK snk TYPE collector;
+			INSERT INTO snk FROM box;
+			CREATE SINK dropped_snk TYPE collector;
+			INSERT INTO dropped_snk FROM dropped;
+			RESUME SOURCE source;`), ShouldBeNil)
+
+		bn, err := dt.Box("box")
+		So(err, ShouldBeNil)
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+		dsin, err := dt.Sink("dropped_snk")
+		So(err, ShouldBeNil)
+		dsi := dsin.Sink().(*tupleCollectorSink)
+
+		numTimeouts := func() int64 {
+			v, err := bn.Status().Get(data.MustCompilePath("box.num_processing_timeouts"))
+			So(err, ShouldBeNil)
+			n, err := data.AsInt(v)
+			So(err, ShouldBeNil)
+			return n
+		}
+
+		Convey("When the slow tuple exceeds the timeout", func() {
+			for deadline := time.Now().Add(5 * time.Second); numTimeouts() == 0 && time.Now().Before(deadline); {
+				time.Sleep(5 * time.Millisecond)
+			}
+			// the following tuple is waiting for the slow one
+			unblock()
+			si.Wait(3)
+			dsi.Wait(1)
+
+			Convey("Then the slow tuple should be abandoned and counted", func() {
+				So(numTimeouts(), ShouldEqual, 1)
+				dropped := dsi.get(0)
+				So(dropped.Data["node_name"], ShouldEqual, data.String("box"))
+				So(dropped.Data["error"], ShouldEqual, data.String(ErrProcessingTimeout.Error()))
+				So(dropped.Data["data"], ShouldResemble, data.Map{"int": data.Int(2)})
+
+				v, err := bn.Status().Get(data.MustCompilePath("input_stats.num_errors"))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(1))
+			})
+
+			Convey("Then the other tuples should pass normally", func() {
+				So(si.len(), ShouldEqual, 3)
+				for i, n := range []int64{1, 3, 4} {
+					So(si.get(i).Data, ShouldResemble, data.Map{"int": data.Int(n)})
+				}
+			})
+		})
+	})
+}
+
+func TestBQLBoxProcessingTimeoutWithDroppedTuples(t *testing.T) {
+	Convey("Given a stream with a processing timeout calling a UDF which finishes after the timeout", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		// sleep_on_2 doesn't synchronize with the topology so that the race
+		// detector can find accesses to the tuple after it's reported as
+		// a dropped tuple
+		So(tb.Reg.Register("sleep_on_2", udf.MustConvertGeneric(func(i int) int {
+			if i == 2 {
+				time.Sleep(700 * time.Millisecond)
+			}
+			return i
+		})), ShouldBeNil)
+
+		_, err = dt.AddSource("dropped", core.NewDroppedTupleCollectorSource(), nil)
+		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `
+			CREATE PAUSED SOURCE source TYPE dummy WITH num=4;
+			CREATE STREAM box WITH processing_timeout=0.5 AS
+				SELECT ISTREAM sleep_on_2(int) AS int FROM source [RANGE 1 TUPLES];
+			CREATE SINK snk TYPE collector;
+			INSERT INTO snk FROM box;
+			CREATE SINK dropped_snk TYPE collector;
+			INSERT INTO dropped_snk FROM dropped;
+			RESUME SOURCE source;`), ShouldBeNil)
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+		dsin, err := dt.Sink("dropped_snk")
+		So(err, ShouldBeNil)
+		dsi := dsin.Sink().(*tupleCollectorSink)
+
+		Convey("When the slow tuple is reported as a dropped tuple", func() {
+			dsi.Wait(1)
+			si.Wait(3)
+
+			Convey("Then the abandoned processing shouldn't affect the dropped tuple", func() {
+				So(dsi.get(0).Data["data"], ShouldResemble, data.Map{"int": data.Int(2)})
+				for i, n := range []int64{1, 3, 4} {
+					So(si.get(i).Data, ShouldResemble, data.Map{"int": data.Int(n)})
+				}
+			})
+		})
+	})
+}
+
+func TestBQLBoxRecursiveStream(t *testing.T) {
+	Convey("Given a recursive stream computing a transitive closure", t, func() {
+		// edges form a cycle: 1 -> 2 -> 3 -> 1
+		tb, err := setupTopology(`
+			CREATE STREAM edges AS SELECT RSTREAM int AS src, int % 3 + 1 AS dst
+				FROM source [RANGE 1 TUPLES] WHERE int <= 3;
+			CREATE RECURSIVE STREAM box MAX ITERATIONS 2 AS
+				SELECT RSTREAM src, dst, 1 AS len FROM edges [RANGE 1 TUPLES]
+				UNION ALL
+				SELECT ISTREAM p:src AS src, e:dst AS dst, p:len + 1 AS len
+				FROM box [RANGE 100 TUPLES] AS p, edges [RANGE 100 TUPLES] AS e
+				WHERE p:dst = e:src`, false)
+		So(err, ShouldBeNil)
+		dt := tb.Topology()
+		Reset(func() {
+			dt.Stop()
+		})
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+
+		Convey("When 3 edges are emitted", func() {
+			Convey("Then the sink receives all reachable pairs", func() {
+				si.Wait(12)
+				So(si.len(), ShouldEqual, 12)
+
+				pairs := map[[2]int64]bool{}
+				for i := 0; i < si.len(); i++ {
+					m := si.get(i).Data
+					src, _ := data.AsInt(m["src"])
+					dst, _ := data.AsInt(m["dst"])
+					pairs[[2]int64{src, dst}] = true
+				}
+				So(len(pairs), ShouldEqual, 9)
+				for src := int64(1); src <= 3; src++ {
+					for dst := int64(1); dst <= 3; dst++ {
+						So(pairs[[2]int64{src, dst}], ShouldBeTrue)
+					}
+				}
+			})
+		})
+	})
+
+	Convey("Given a recursive stream which never reaches a fixpoint", t, func() {
+		tb, err := setupTopology(`CREATE RECURSIVE STREAM box MAX ITERATIONS 3 AS
+			SELECT RSTREAM int AS n FROM source [RANGE 1 TUPLES]
+			UNION ALL
+			SELECT RSTREAM n + 1 AS n FROM box [RANGE 1 TUPLES]`, false)
+		So(err, ShouldBeNil)
+		dt := tb.Topology()
+		Reset(func() {
+			dt.Stop()
+		})
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+
+		Convey("When 4 tuples are emitted by the source", func() {
+			Convey("Then results should be fed back at most MAX ITERATIONS times", func() {
+				si.Wait(16)
+				So(si.len(), ShouldEqual, 16)
+				for i := 0; i < 4; i++ {
+					for j := 0; j < 4; j++ {
+						So(si.get(i*4+j).Data, ShouldResemble, data.Map{
+							"n": data.Int(i + j + 1),
+						})
+					}
+				}
+			})
+		})
+	})
+
+	Convey("Given a topology builder", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, "CREATE PAUSED SOURCE source TYPE dummy"), ShouldBeNil)
+
+		Convey("When creating invalid recursive streams", func() {
+			stmts := []string{
+				// MAX ITERATIONS must be positive
+				`CREATE RECURSIVE STREAM box MAX ITERATIONS 0 AS
+					SELECT RSTREAM int FROM source [RANGE 1 TUPLES]
+					UNION ALL SELECT RSTREAM int FROM box [RANGE 1 TUPLES]`,
+				// no base statement
+				`CREATE RECURSIVE STREAM box MAX ITERATIONS 1 AS
+					SELECT RSTREAM int FROM box [RANGE 1 TUPLES]
+					UNION ALL SELECT RSTREAM int FROM box [RANGE 1 TUPLES]`,
+				// no recursive statement
+				`CREATE RECURSIVE STREAM box MAX ITERATIONS 1 AS
+					SELECT RSTREAM int FROM source [RANGE 1 TUPLES]
+					UNION ALL SELECT RSTREAM int FROM source [RANGE 1 TUPLES]`,
+				// ORDERED is not supported
+				`CREATE RECURSIVE STREAM box MAX ITERATIONS 1 AS
+					SELECT RSTREAM int FROM source [RANGE 1 TUPLES]
+					UNION ALL SELECT RSTREAM int FROM box [RANGE 1 TUPLES] ORDERED`,
+				// time-based sampling is not supported
+				`CREATE RECURSIVE STREAM box MAX ITERATIONS 1 AS
+					SELECT RSTREAM [EVERY 1 SECONDS] int FROM source [RANGE 1 TUPLES]
+					UNION ALL SELECT RSTREAM int FROM box [RANGE 1 TUPLES]`,
+			}
+
+			Convey("Then they should fail", func() {
+				for _, s := range stmts {
+					So(addBQLToTopology(tb, s), ShouldNotBeNil)
+					_, err := dt.Box("box")
+					So(err, ShouldNotBeNil)
+				}
+			})
+		})
+	})
+}
+
 func TestBQLBoxUDSF(t *testing.T) {
 	Convey("Given a topology using UDSF", t, func() {
 		tb, err := setupTopology(`CREATE STREAM box AS SELECT RSTREAM duplicate:int FROM duplicate("source", 3) [RANGE 1 TUPLES]`, false)
@@ -3,7 +3,6 @@ package bql
 import (
 	"bufio"
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -42,8 +41,8 @@ func init() {
 
 type readerSource struct {
 	filename string
-	tsField  data.Path
 	ioParams *IOParams
+	emitter  *lineEmitter
 
 	// repeat is the number of times that the input data is read. When its value
 	// is less than 0, the source will read the input again and again until it's
@@ -55,7 +54,8 @@ type readerSource struct {
 	// When its value is less than or equal to 0, the source tries to emit
 	// tuples as fast as possible.
 	interval time.Duration
-	stopCh   chan struct{}
+
+	stopCh chan struct{}
 }
 
 func (s *readerSource) GenerateStream(ctx *core.Context, w core.Writer) error {
@@ -81,7 +81,7 @@ func (s *readerSource) generateStream(ctx *core.Context, w core.Writer) error {
 
 	r := bufio.NewReader(f)
 	next := time.Now()
-	for lineNumber := 0; ; lineNumber++ {
+	for lineNumber := int64(0); ; lineNumber++ {
 		line, err := r.ReadBytes('\n')
 		if err != nil && err != io.EOF {
 			return err
@@ -95,36 +95,16 @@ func (s *readerSource) generateStream(ctx *core.Context, w core.Writer) error {
 			continue
 		}
 
-		m := data.Map{}
-		if err := json.Unmarshal(line, &m); err != nil {
-			ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
-				WithField("jsonl_line_number", lineNumber).
-				WithField("body", string(line)).Warning("Ignoring the line due to a json parse error")
-			continue
-		}
-
-		t := core.NewTuple(m)
+		var ts time.Time
 		if s.interval > 0 {
 			// When the interval parameter is given, a proper application
 			// timestamp should be assigned to each tuple.
-			t.Timestamp = next
-		}
-		if s.tsField != nil {
-			if v, err := t.Data.Get(s.tsField); err == nil {
-				if ts, err := data.ToTimestamp(v); err != nil {
-					ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
-						WithField("jsonl_line_number", lineNumber).
-						WithField("timestamp_field", s.tsField).
-						WithField("timestamp_field_value", v).
-						Warning("Cannot convert a value in timestamp_field to a timestamp")
-				} else {
-					t.Timestamp = ts
-				}
-			}
+			ts = next
 		}
-
-		if err := w.Write(ctx, t); err != nil {
+		if written, err := s.emitter.emit(ctx, w, s.filename, lineNumber, line, ts); err != nil {
 			return err
+		} else if !written {
+			continue
 		}
 
 		if s.interval > 0 {
@@ -153,37 +133,135 @@ func (s *readerSource) Stop(ctx *core.Context) error {
 	return nil
 }
 
+// lineEmitter converts lines read by file sources into tuples and writes
+// them to a Writer.
+type lineEmitter struct {
+	ioParams  *IOParams
+	dec       LineDecoder
+	tsField   data.Path
+	pathField data.Path
+}
+
+// emit decodes the line and writes it as a tuple. The timestamp of the tuple
+// is set to ts unless it's zero or the tuple has a timestamp in the
+// timestamp field. A line which cannot be decoded is logged and ignored. It
+// returns true when the tuple is written.
+func (e *lineEmitter) emit(ctx *core.Context, w core.Writer, path string, lineNumber int64,
+	line []byte, ts time.Time) (bool, error) {
+	m, err := e.dec.Decode(line)
+	if err != nil {
+		ctx.ErrLog(err).WithField("node_name", e.ioParams.Name).
+			WithField("path", path).
+			WithField("line_number", lineNumber).
+			WithField("body", string(line)).Warning("Ignoring the line due to a parse error")
+		return false, nil
+	}
+	if m == nil {
+		return false, nil
+	}
+
+	t := core.NewTuple(m)
+	if !ts.IsZero() {
+		t.Timestamp = ts
+	}
+	if e.tsField != nil {
+		if v, err := t.Data.Get(e.tsField); err == nil {
+			if ts, err := data.ToTimestamp(v); err != nil {
+				ctx.ErrLog(err).WithField("node_name", e.ioParams.Name).
+					WithField("path", path).
+					WithField("line_number", lineNumber).
+					WithField("timestamp_field", e.tsField).
+					WithField("timestamp_field_value", v).
+					Warning("Cannot convert a value in timestamp_field to a timestamp")
+			} else {
+				t.Timestamp = ts
+			}
+		}
+	}
+	if e.pathField != nil {
+		if err := t.Data.Set(e.pathField, data.String(path)); err != nil {
+			ctx.ErrLog(err).WithField("node_name", e.ioParams.Name).
+				WithField("path", path).
+				WithField("line_number", lineNumber).
+				Warning("Cannot set the path to path_field")
+		}
+	}
+	if err := w.Write(ctx, t); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// createFileSource creates a source reading lines from a file. When "follow"
+// parameter is true, the source keeps reading lines appended to files like
+// tail -F. See NewLineDecoder for the formats of lines.
 func createFileSource(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Source, error) {
-	// TODO: add format parameter
+	// "format" and parameters related to it are handled by the decoder
+	dec, err := NewLineDecoder(params)
+	if err != nil {
+		return nil, err
+	}
 
 	v := &struct {
 		Path           string `bql:",required"`
 		Rewindable     bool
 		TimestampField string
+		PathField      string
 		Repeat         int64
 		Interval       time.Duration
+
+		// parameters for follow mode
+		Follow         bool
+		StartPosition  string
+		PollInterval   time.Duration
+		CheckpointPath string
 	}{
 		Rewindable:     false,
 		TimestampField: "",
 		Repeat:         0,
+		StartPosition:  "end",
+		PollInterval:   time.Second,
 	}
-	dec := data.NewDecoder(nil)
-	if err := dec.Decode(params, v); err != nil {
+	if err := data.NewDecoder(nil).Decode(params, v); err != nil {
 		return nil, err
 	}
 
-	var tsField data.Path
+	e := &lineEmitter{
+		ioParams: ioParams,
+		dec:      dec,
+	}
 	if v.TimestampField != "" {
-		var err error
-		if tsField, err = data.CompilePath(v.TimestampField); err != nil {
+		if e.tsField, err = data.CompilePath(v.TimestampField); err != nil {
 			return nil, fmt.Errorf("'timestamp_field' parameter doesn't have a valid path: %v", err)
 		}
 	}
+	if v.PathField != "" {
+		if e.pathField, err = data.CompilePath(v.PathField); err != nil {
+			return nil, fmt.Errorf("'path_field' parameter doesn't have a valid path: %v", err)
+		}
+	}
 
+	if v.Follow {
+		if v.Repeat != 0 || v.Interval != 0 {
+			return nil, errors.New("repeat and interval parameters cannot be used with follow")
+		}
+		s, err := newTailSource(ioParams, e, v.Path, v.StartPosition, v.PollInterval, v.CheckpointPath)
+		if err != nil {
+			return nil, err
+		}
+		if v.Rewindable {
+			return s, nil
+		}
+		return core.ImplementSourceStop(s), nil
+	}
+
+	if v.CheckpointPath != "" {
+		return nil, errors.New("checkpoint_path parameter requires follow")
+	}
 	s := &readerSource{
 		filename: v.Path,
-		tsField:  tsField,
 		ioParams: ioParams,
+		emitter:  e,
 		repeat:   v.Repeat,
 		interval: v.Interval,
 		stopCh:   make(chan struct{}),
@@ -201,24 +279,27 @@ func init() {
 type writerSink struct {
 	m           sync.Mutex
 	w           io.Writer
+	enc         TupleEncoder
 	shouldClose bool
 }
 
 func (s *writerSink) Write(ctx *core.Context, t *core.Tuple) error {
-	// TODO: support custom formatting. There're several things that need to
-	// be considered such as concurrent formatting, zero-copy write, and so on.
-	// While encoding tuples outside the lock supports concurrent formatting,
-	// it makes it difficult to support zero-copy write.
+	// TODO: support zero-copy write. While encoding tuples outside the lock
+	// supports concurrent formatting, it makes it difficult to support
+	// zero-copy write.
 
-	js := t.Data.String() // Format this outside the lock
+	b, err := s.enc.Encode(t.Data) // Format this outside the lock
+	if err != nil {
+		return err
+	}
 
-	// This lock is required to avoid interleaving JSONs.
+	// This lock is required to avoid interleaving records.
 	s.m.Lock()
 	defer s.m.Unlock()
 	if s.w == nil {
 		return errors.New("the sink is already closed")
 	}
-	_, err := fmt.Fprintln(s.w, js)
+	_, err = s.w.Write(b)
 	return err
 }
 
@@ -237,18 +318,27 @@ func (s *writerSink) Close(ctx *core.Context) error {
 }
 
 func createStdoutSink(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Sink, error) {
+	enc, err := NewTupleEncoder(params)
+	if err != nil {
+		return nil, err
+	}
 	return &writerSink{
-		w: os.Stdout,
+		w:   os.Stdout,
+		enc: enc,
 	}, nil
 }
 
 func createFileSink(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Sink, error) {
 	// TODO: currently this sink isn't secure because it accepts any path.
 	// TODO: support buffering
-	// TODO: provide "format" parameter to support output formats other than "jsonl".
-	//       "jsonl" should be the default value.
 	// TODO: support "compression" parameter with values like "gz".
 
+	// "format" and parameters related to it are handled by the encoder
+	enc, err := NewTupleEncoder(params)
+	if err != nil {
+		return nil, err
+	}
+
 	v := &struct {
 		Path     string `bql:",required"`
 		Truncate bool
@@ -296,6 +386,7 @@ func createFileSink(ctx *core.Context, ioParams *IOParams, params data.Map) (cor
 	}
 	return &writerSink{
 		w:           w,
+		enc:         enc,
 		shouldClose: true,
 	}, nil
 }
@@ -327,7 +418,7 @@ func (s *nodeStatusSource) GenerateStream(ctx *core.Context, w core.Writer) erro
 			return nil
 		case <-time.After(next.Sub(time.Now())):
 		}
-		now := time.Now()
+		now := ctx.Now()
 
 		for name, n := range s.topology.Nodes() {
 			t := &core.Tuple{
@@ -391,7 +482,7 @@ func (s *edgeStatusSource) GenerateStream(ctx *core.Context, w core.Writer) erro
 			return nil
 		case <-time.After(next.Sub(time.Now())):
 		}
-		now := time.Now()
+		now := ctx.Now()
 
 		// collect all nodes that can receive data
 		receivers := map[string]core.Node{}
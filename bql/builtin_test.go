@@ -22,6 +22,7 @@ type testFileWriter struct {
 	c   *sync.Cond
 	cnt int
 	tss []time.Time
+	ds  []data.Map
 }
 
 func (w *testFileWriter) Write(ctx *core.Context, t *core.Tuple) error {
@@ -29,6 +30,7 @@ func (w *testFileWriter) Write(ctx *core.Context, t *core.Tuple) error {
 	defer w.m.Unlock()
 	w.cnt++
 	w.tss = append(w.tss, t.Timestamp)
+	w.ds = append(w.ds, t.Data)
 	w.c.Broadcast()
 	return nil
 }
@@ -220,6 +222,32 @@ func TestFileSource(t *testing.T) {
 			})
 		})
 
+		Convey("When reading the file with a json_number parameter", func() {
+			for _, c := range []struct {
+				policy string
+				typ    data.TypeID
+			}{
+				{"preserve", data.TypeInt},
+				{"int", data.TypeInt},
+				{"float", data.TypeFloat},
+			} {
+				params["json_number"] = data.String(c.policy)
+				s, err := createFileSource(ctx, &IOParams{}, params)
+				So(err, ShouldBeNil)
+				w.ds = nil
+				So(s.GenerateStream(ctx, w), ShouldBeNil)
+				So(s.Stop(ctx), ShouldBeNil)
+
+				Convey("Then numbers should be parsed according to "+c.policy, func() {
+					So(len(w.ds), ShouldEqual, 3)
+					for i, d := range w.ds {
+						So(d["int"].Type(), ShouldEqual, c.typ)
+						So(data.Equal(d["int"], data.Int(i+1)), ShouldBeTrue)
+					}
+				})
+			}
+		})
+
 		Convey("When creating a file source with invalid parameters", func() {
 			Convey("Then missing path parameter should result in an error", func() {
 				delete(params, "path")
@@ -256,6 +284,12 @@ func TestFileSource(t *testing.T) {
 				_, err := createFileSource(ctx, &IOParams{}, params)
 				So(err, ShouldNotBeNil)
 			})
+
+			Convey("Then unknown json_number value should result in an error", func() {
+				params["json_number"] = data.String("decimal")
+				_, err := createFileSource(ctx, &IOParams{}, params)
+				So(err, ShouldNotBeNil)
+			})
 		})
 	})
 }
@@ -304,6 +338,40 @@ func TestFileSink(t *testing.T) {
 			})
 		})
 
+		Convey("When create file sink with csv format", func() {
+			fn := filepath.Join(tdir, "file_sink.csv")
+			params := data.Map{
+				"path":    data.String(fn),
+				"format":  data.String("csv"),
+				"columns": data.Array{data.String("k"), data.String("v")},
+			}
+			si, err := createFileSink(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				si.Close(ctx)
+			})
+			Convey("And when write tuples to the sink", func() {
+				So(si.Write(ctx, core.NewTuple(data.Map{"k": data.Int(-1), "v": data.String("a")})), ShouldBeNil)
+				So(si.Write(ctx, core.NewTuple(data.Map{"k": data.Int(2)})), ShouldBeNil)
+				Convey("Then the tuples should be written in the file as csv", func() {
+					actualByte, err := ioutil.ReadFile(fn)
+					So(err, ShouldBeNil)
+					So(string(actualByte), ShouldEqual, "-1,a\n2,\n")
+				})
+			})
+		})
+
+		Convey("When create file sink with an unsupported format", func() {
+			params := data.Map{
+				"path":   data.String(filepath.Join(tdir, "file_sink.xml")),
+				"format": data.String("xml"),
+			}
+			_, err := createFileSink(ctx, ioParams, params)
+			Convey("Then the sink should not be created", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
 		Convey("When create file sink with truncate flag", func() {
 			fn := filepath.Join(tdir, "file_sink2.jsonl")
 			So(ioutil.WriteFile(fn, []byte(`{"k":-2}
@@ -166,7 +166,8 @@ func failingUDSFCreator(decl udf.UDSFDeclarer, stream string, dup int) (udf.UDSF
 }
 
 func init() {
-	udf.MustRegisterGlobalUDSFCreator("duplicate", udf.MustConvertToUDSFCreator(createDuplicateUDSF))
+	udf.MustRegisterGlobalUDSFCreator("duplicate", udf.MustWithParamNames(
+		udf.MustConvertToUDSFCreator(createDuplicateUDSF), "stream", "times"))
 	udf.MustRegisterGlobalUDSFCreator("failing_duplicate", udf.MustConvertToUDSFCreator(failingUDSFCreator))
 }
 
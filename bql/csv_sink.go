@@ -0,0 +1,117 @@
+package bql
+
+import (
+	"compress/gzip"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"strings"
+)
+
+type csvFile struct {
+	enc *csvEncoder
+	c   *countingWriter
+	w   io.Writer
+	gz  *gzip.Writer
+}
+
+func (f *csvFile) Write(m data.Map) error {
+	b, err := f.enc.Encode(m)
+	if err != nil {
+		return err
+	}
+	_, err = f.w.Write(b)
+	return err
+}
+
+func (f *csvFile) Size() int64 {
+	return f.c.n
+}
+
+func (f *csvFile) Close() error {
+	if f.gz != nil {
+		return f.gz.Close()
+	}
+	return nil
+}
+
+// createCSVSink creates a sink writing tuples to rotating CSV files. It
+// accepts following parameters in addition to archiveParams:
+//
+//   - columns: an array of paths of values written to each line (required)
+//   - delimiter: the delimiter of fields, "," by default
+//   - header: true when each file has a header line having the column names
+//     (default: true)
+//   - compression: "none" (default) or "gzip". ".gz" is appended to the name
+//     of each file when it's gzip.
+//
+// When rotation is disabled, tuples are appended to the file.
+func createCSVSink(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Sink, error) {
+	return newCSVSink(ctx, params, ',')
+}
+
+// createTSVSink creates a sink writing tuples to rotating TSV files. It's the
+// same as the csv sink except that the default delimiter is a tab.
+func createTSVSink(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Sink, error) {
+	return newCSVSink(ctx, params, '\t')
+}
+
+func newCSVSink(ctx *core.Context, params data.Map, delimiter rune) (core.Sink, error) {
+	_, hasDelimiter := params["delimiter"]
+	enc, err := newCSVEncoder(params)
+	if err != nil {
+		return nil, err
+	}
+	if !hasDelimiter {
+		enc.delimiter = delimiter
+	}
+
+	v := &struct {
+		archiveParams
+		Header      bool
+		Compression string
+	}{
+		Header:      true,
+		Compression: "none",
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+
+	ext := ""
+	switch strings.ToLower(v.Compression) {
+	case "none":
+	case "gzip":
+		ext = ".gz"
+	default:
+		return nil, fmt.Errorf("unsupported compression: %v", v.Compression)
+	}
+
+	return newArchiveSink(ctx, v.archiveParams, ext, "", true, func(c *countingWriter, m data.Map) (archiveFile, error) {
+		f := &csvFile{
+			enc: enc,
+			c:   c,
+			w:   c,
+		}
+		if ext == ".gz" {
+			f.gz = gzip.NewWriter(c)
+			f.w = f.gz
+		}
+		if v.Header && c.n == 0 {
+			h, err := enc.Header()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := f.w.Write(h); err != nil {
+				return nil, err
+			}
+		}
+		return f, nil
+	})
+}
+
+func init() {
+	MustRegisterGlobalSinkCreator("csv", SinkCreatorFunc(createCSVSink))
+	MustRegisterGlobalSinkCreator("tsv", SinkCreatorFunc(createTSVSink))
+}
@@ -0,0 +1,182 @@
+package bql
+
+import (
+	"compress/gzip"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// archivedFiles returns the names of files in the directory.
+func archivedFiles(dir string) []string {
+	fs, err := ioutil.ReadDir(dir)
+	So(err, ShouldBeNil)
+	var names []string
+	for _, f := range fs {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readFileString(path string) string {
+	b, err := ioutil.ReadFile(path)
+	So(err, ShouldBeNil)
+	return string(b)
+}
+
+func TestCSVSink(t *testing.T) {
+	Convey("Given a directory", t, func() {
+		dir, err := ioutil.TempDir("", "sbtest_bql_csv_sink")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		ctx := core.NewContext(nil)
+		path := filepath.Join(dir, "out.csv")
+		params := data.Map{
+			"path":    data.String(path),
+			"columns": data.Array{data.String("a"), data.String("b.c")},
+		}
+		write := func(s core.Sink, n int) {
+			for i := 0; i < n; i++ {
+				So(s.Write(ctx, core.NewTuple(data.Map{
+					"a": data.Int(i),
+					"b": data.Map{"c": data.String("x,y")},
+				})), ShouldBeNil)
+			}
+		}
+
+		Convey("When writing tuples to a csv sink", func() {
+			s, err := createCSVSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			write(s, 2)
+			So(s.Close(ctx), ShouldBeNil)
+
+			Convey("Then the file should have a header and the tuples", func() {
+				So(readFileString(path), ShouldEqual, "a,b.c\n0,\"x,y\"\n1,\"x,y\"\n")
+			})
+
+			Convey("Then another sink should append tuples without a header", func() {
+				s, err := createCSVSink(ctx, &IOParams{}, data.Map{
+					"path":    data.String(path),
+					"columns": data.Array{data.String("a"), data.String("b.c")},
+				})
+				So(err, ShouldBeNil)
+				write(s, 1)
+				So(s.Close(ctx), ShouldBeNil)
+				So(readFileString(path), ShouldEqual, "a,b.c\n0,\"x,y\"\n1,\"x,y\"\n0,\"x,y\"\n")
+			})
+		})
+
+		Convey("When writing tuples to a tsv sink without a header", func() {
+			params["header"] = data.False
+			s, err := createTSVSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			write(s, 1)
+			So(s.Close(ctx), ShouldBeNil)
+
+			Convey("Then fields should be separated by tabs", func() {
+				So(readFileString(path), ShouldEqual, "0\tx,y\n")
+			})
+		})
+
+		Convey("When writing tuples to a sink rotating files by size", func() {
+			params["rotate_size"] = data.Int(20)
+			s, err := createCSVSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			write(s, 5)
+			So(s.Close(ctx), ShouldBeNil)
+
+			Convey("Then tuples should be split into files each having a header", func() {
+				names := archivedFiles(dir)
+				So(names, ShouldHaveLength, 3)
+				lines := ""
+				for _, n := range names {
+					So(n, ShouldStartWith, "out-")
+					So(n, ShouldEndWith, ".csv")
+					c := readFileString(filepath.Join(dir, n))
+					So(c, ShouldStartWith, "a,b.c\n")
+					lines += c[len("a,b.c\n"):]
+				}
+				So(lines, ShouldEqual, "0,\"x,y\"\n1,\"x,y\"\n2,\"x,y\"\n3,\"x,y\"\n4,\"x,y\"\n")
+			})
+		})
+
+		Convey("When writing tuples to a sink rotating files by interval", func() {
+			params["rotate_interval"] = data.String("50ms")
+			s, err := createCSVSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+			write(s, 1)
+			So(s.(core.Statuser).Status()["current_file"], ShouldNotBeNil)
+
+			Convey("Then the file should be closed after the interval", func() {
+				for i := 0; i < 100; i++ {
+					if _, ok := s.(core.Statuser).Status()["current_file"]; !ok {
+						break
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+				So(s.(core.Statuser).Status()["current_file"], ShouldBeNil)
+
+				write(s, 1)
+				So(s.Close(ctx), ShouldBeNil)
+				So(archivedFiles(dir), ShouldHaveLength, 2)
+			})
+		})
+
+		Convey("When writing tuples with gzip compression", func() {
+			params["compression"] = data.String("gzip")
+			s, err := createCSVSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			write(s, 1)
+			So(s.Close(ctx), ShouldBeNil)
+
+			Convey("Then the file should be compressed", func() {
+				f, err := os.Open(path + ".gz")
+				So(err, ShouldBeNil)
+				defer f.Close()
+				r, err := gzip.NewReader(f)
+				So(err, ShouldBeNil)
+				b, err := ioutil.ReadAll(r)
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "a,b.c\n0,\"x,y\"\n")
+			})
+		})
+
+		Convey("When creating a sink with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"no path":                  {"columns": data.Array{data.String("a")}},
+				"no columns":               {"path": data.String(path)},
+				"unsupported compression":  {"compression": data.String("lz4")},
+				"negative rotate_size":     {"rotate_size": data.Int(-1)},
+				"negative rotate_interval": {"rotate_interval": data.Int(-1)},
+			}
+			for name, c := range cases {
+				c := c
+				Convey("Then "+name+" should result in an error", func() {
+					ps := params.Copy()
+					for k, v := range c {
+						ps[k] = v
+					}
+					if _, ok := c["path"]; ok {
+						delete(ps, "columns")
+					} else if _, ok := c["columns"]; ok {
+						delete(ps, "path")
+					}
+					_, err := createCSVSink(ctx, &IOParams{}, ps)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
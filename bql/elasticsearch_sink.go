@@ -0,0 +1,376 @@
+package bql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// esBulkItem is an action and a document of the bulk API.
+type esBulkItem struct {
+	action []byte
+	doc    []byte
+}
+
+// esBulkResponse is a part of the response of the bulk API.
+type esBulkResponse struct {
+	Items []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+type esSink struct {
+	client   *http.Client
+	url      string
+	username string
+	password string
+
+	index          *tupleTemplate
+	indexSrc       string
+	action         string
+	idField        data.Path
+	timestampField string
+
+	batchSize     int
+	maxRetries    int
+	retryInterval time.Duration
+
+	m          sync.Mutex
+	items      []*esBulkItem
+	numWritten int64
+	numFailed  int64
+	lastError  error
+	closed     bool
+	stopOnce   sync.Once
+	stopCh     chan struct{}
+	doneCh     chan struct{}
+}
+
+func (s *esSink) Write(ctx *core.Context, t *core.Tuple) error {
+	item, err := s.newItem(t)
+	if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return errors.New("the sink is already closed")
+	}
+	s.items = append(s.items, item)
+	if len(s.items) < s.batchSize {
+		return nil
+	}
+	return s.flush()
+}
+
+func (s *esSink) newItem(t *core.Tuple) (*esBulkItem, error) {
+	// Elasticsearch doesn't allow upper case letters in index names.
+	index, err := s.index.render(t)
+	if err != nil {
+		return nil, err
+	}
+	meta := map[string]string{"_index": strings.ToLower(index)}
+	if s.idField != nil {
+		v, err := t.Data.Get(s.idField)
+		if err != nil {
+			return nil, fmt.Errorf("the tuple doesn't have the id: %v", err)
+		}
+		id, err := data.ToString(v)
+		if err != nil {
+			return nil, err
+		}
+		meta["_id"] = id
+	}
+	action, err := json.Marshal(map[string]interface{}{s.action: meta})
+	if err != nil {
+		return nil, err
+	}
+
+	doc := t.Data
+	if s.timestampField != "" {
+		doc = doc.Copy()
+		doc[s.timestampField] = data.Timestamp(t.Timestamp)
+	}
+	return &esBulkItem{
+		action: action,
+		doc:    []byte(doc.String()),
+	}, nil
+}
+
+// flush sends buffered documents with the bulk API. Documents rejected with
+// 429 and requests failed temporarily are retried with backoff, and they're
+// dropped after all retries fail. The caller must hold the lock.
+func (s *esSink) flush() error {
+	if len(s.items) == 0 {
+		return nil
+	}
+	items := s.items
+	s.items = nil
+
+	var err error
+	failed := s.numFailed
+	wait := s.retryInterval
+	for i := 0; ; i++ {
+		if items, err = s.bulk(items); len(items) == 0 {
+			if n := s.numFailed - failed; n > 0 {
+				return fmt.Errorf("cannot index %v tuples: %v", n, s.lastError)
+			}
+			return nil
+		}
+		if i >= s.maxRetries {
+			break
+		}
+
+		select {
+		case <-s.stopCh:
+			// retry immediately while closing
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+	s.numFailed += int64(len(items))
+	s.lastError = err
+	return fmt.Errorf("cannot index %v tuples: %v", len(items), err)
+}
+
+// bulk sends items with a bulk request and returns items to be retried with
+// the reason. Items failed permanently are counted as failures.
+func (s *esSink) bulk(items []*esBulkItem) ([]*esBulkItem, error) {
+	body := bytes.NewBuffer(nil)
+	for _, it := range items {
+		body.Write(it.action)
+		body.WriteByte('\n')
+		body.Write(it.doc)
+		body.WriteByte('\n')
+	}
+	req, err := http.NewRequest("POST", s.url+"/_bulk", body)
+	if err != nil {
+		return items, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return items, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return items, err
+	}
+
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		return items, fmt.Errorf("the bulk request failed with status %v: %s", res.StatusCode, b)
+	case res.StatusCode >= 300:
+		s.numFailed += int64(len(items))
+		s.lastError = fmt.Errorf("the bulk request was rejected with status %v: %s", res.StatusCode, b)
+		return nil, nil
+	}
+
+	r := &esBulkResponse{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return items, fmt.Errorf("cannot parse the response of the bulk request: %v", err)
+	}
+	if len(r.Items) != len(items) {
+		return items, fmt.Errorf("the bulk response has %v items for %v documents", len(r.Items), len(items))
+	}
+
+	var (
+		retries  []*esBulkItem
+		retryErr error
+	)
+	for i, ri := range r.Items {
+		for _, res := range ri { // each item has only one action
+			switch {
+			case res.Status == http.StatusTooManyRequests:
+				retries = append(retries, items[i])
+				retryErr = fmt.Errorf("the document was rejected with status %v: %s", res.Status, res.Error)
+			case res.Status >= 300:
+				s.numFailed++
+				s.lastError = fmt.Errorf("the document was rejected with status %v: %s", res.Status, res.Error)
+			default:
+				s.numWritten++
+			}
+		}
+	}
+	return retries, retryErr
+}
+
+// flushPeriodically sends buffered documents every flush_interval.
+func (s *esSink) flushPeriodically(ctx *core.Context, interval time.Duration) {
+	defer close(s.doneCh)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-t.C:
+		}
+
+		s.m.Lock()
+		if err := s.flush(); err != nil {
+			ctx.ErrLog(err).WithField("index", s.indexSrc).Error("Cannot index tuples to Elasticsearch")
+		}
+		s.m.Unlock()
+	}
+}
+
+func (s *esSink) Close(ctx *core.Context) error {
+	// stopCh is closed without the lock so that retries in flush can be
+	// interrupted.
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+	<-s.doneCh
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.flush()
+}
+
+// Status returns the status of the sink.
+func (s *esSink) Status() data.Map {
+	s.m.Lock()
+	defer s.m.Unlock()
+	st := data.Map{
+		"index":       data.String(s.indexSrc),
+		"num_written": data.Int(s.numWritten),
+		"num_failed":  data.Int(s.numFailed),
+		"num_pending": data.Int(len(s.items)),
+	}
+	if s.lastError != nil {
+		st["last_error"] = data.String(s.lastError.Error())
+	}
+	return st
+}
+
+// createESSink creates an elasticsearch sink indexing tuples into
+// Elasticsearch or OpenSearch with the bulk API. It accepts following
+// parameters:
+//
+//   - url: the base URL of the cluster (default: "http://localhost:9200")
+//   - username, password: credentials of basic authentication
+//   - index: the name of the index (required). It can have "{path}", which is
+//     replaced with the value of the path in the tuple, and "{path:layout}",
+//     which is replaced with the value formatted as a timestamp with the
+//     layout of Go's time.Format, e.g. "logs-{@timestamp:2006.01.02}".
+//     "@timestamp" refers to the timestamp of the tuple. The name is
+//     converted to lower case.
+//   - id_field: the path of the value used as the id of the document. The id
+//     is generated by Elasticsearch when it's omitted.
+//   - action: "index" (default) or "create". "create" fails when the
+//     document having the same id already exists.
+//   - timestamp_field: the name of the field to which the timestamp of the
+//     tuple is added, e.g. "@timestamp" for Kibana
+//   - batch_size: the maximum number of documents sent by a request
+//     (default: 500)
+//   - flush_interval: the interval at which buffered documents are sent
+//     even if the batch isn't full (default: 1s)
+//   - max_retries: the number of retries of documents rejected with 429 Too
+//     Many Requests or of a request failed temporarily (default: 3)
+//   - retry_interval: the initial interval of retries, which doubles on each
+//     retry (default: 1s)
+//   - timeout: the timeout of a request (default: 30s)
+//
+// Documents rejected for other reasons, e.g. a mapping error, aren't retried.
+func createESSink(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Sink, error) {
+	v := &struct {
+		URL            string
+		Username       string
+		Password       string
+		Index          string `bql:",required"`
+		IDField        string
+		Action         string
+		TimestampField string
+		BatchSize      int
+		FlushInterval  time.Duration
+		MaxRetries     int
+		RetryInterval  time.Duration
+		Timeout        time.Duration
+	}{
+		URL:           "http://localhost:9200",
+		Action:        "index",
+		BatchSize:     500,
+		FlushInterval: time.Second,
+		MaxRetries:    3,
+		RetryInterval: time.Second,
+		Timeout:       30 * time.Second,
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+
+	if v.Index == "" {
+		return nil, errors.New("index must not be empty")
+	}
+	index, err := parseTupleTemplate("index", v.Index)
+	if err != nil {
+		return nil, err
+	}
+	if v.Action != "index" && v.Action != "create" {
+		return nil, fmt.Errorf("unsupported action: %v", v.Action)
+	}
+	if v.BatchSize <= 0 {
+		return nil, fmt.Errorf("batch_size must be positive: %v", v.BatchSize)
+	}
+	if v.FlushInterval <= 0 {
+		return nil, fmt.Errorf("flush_interval must be positive: %v", v.FlushInterval)
+	}
+	if v.MaxRetries < 0 {
+		return nil, fmt.Errorf("max_retries must not be negative: %v", v.MaxRetries)
+	}
+	if v.RetryInterval < 0 {
+		return nil, fmt.Errorf("retry_interval must not be negative: %v", v.RetryInterval)
+	}
+	if v.Timeout <= 0 {
+		return nil, fmt.Errorf("timeout must be positive: %v", v.Timeout)
+	}
+
+	s := &esSink{
+		client:         &http.Client{Timeout: v.Timeout},
+		url:            strings.TrimRight(v.URL, "/"),
+		username:       v.Username,
+		password:       v.Password,
+		index:          index,
+		indexSrc:       v.Index,
+		action:         v.Action,
+		timestampField: v.TimestampField,
+		batchSize:      v.BatchSize,
+		maxRetries:     v.MaxRetries,
+		retryInterval:  v.RetryInterval,
+		stopCh:         make(chan struct{}),
+		doneCh:         make(chan struct{}),
+	}
+	if v.IDField != "" {
+		p, err := data.CompilePath(v.IDField)
+		if err != nil {
+			return nil, fmt.Errorf("'id_field' parameter doesn't have a valid path: %v", err)
+		}
+		s.idField = p
+	}
+	go s.flushPeriodically(ctx, v.FlushInterval)
+	return s, nil
+}
+
+func init() {
+	MustRegisterGlobalSinkCreator("elasticsearch", SinkCreatorFunc(createESSink))
+}
@@ -0,0 +1,242 @@
+package bql
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testESServer is a fake bulk API of Elasticsearch. It records bulk requests
+// and responds with the given statuses of documents in order. A status
+// larger than 999 is returned as the status of the whole request after
+// subtracting 1000.
+type testESServer struct {
+	m        sync.Mutex
+	requests [][]string
+	statuses []int
+}
+
+func (s *testESServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	var lines []string
+	sc := bufio.NewScanner(r.Body)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.requests = append(s.requests, lines)
+	if len(s.statuses) > 0 && s.statuses[0] > 999 {
+		w.WriteHeader(s.statuses[0] - 1000)
+		s.statuses = s.statuses[1:]
+		return
+	}
+
+	var items []string
+	for i := 0; i < len(lines)/2; i++ {
+		status := 201
+		if len(s.statuses) > 0 {
+			status = s.statuses[0]
+			s.statuses = s.statuses[1:]
+		}
+		if status >= 300 {
+			items = append(items, fmt.Sprintf(`{"index":{"status":%v,"error":{"type":"error_%v"}}}`, status, status))
+		} else {
+			items = append(items, fmt.Sprintf(`{"index":{"status":%v}}`, status))
+		}
+	}
+	fmt.Fprintf(w, `{"errors":false,"items":[%v]}`, strings.Join(items, ","))
+}
+
+func (s *testESServer) received() [][]string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([][]string{}, s.requests...)
+}
+
+func TestESSink(t *testing.T) {
+	Convey("Given an elasticsearch sink", t, func() {
+		es := &testESServer{}
+		srv := httptest.NewServer(es)
+		Reset(srv.Close)
+
+		ctx := core.NewContext(nil)
+		params := data.Map{
+			"url":            data.String(srv.URL + "/"),
+			"index":          data.String("Logs-{host}-{@timestamp:2006.01.02}"),
+			"batch_size":     data.Int(2),
+			"flush_interval": data.String("1h"),
+			"retry_interval": data.Int(0),
+		}
+		ts := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+		tuple := func(i int) *core.Tuple {
+			t := core.NewTuple(data.Map{
+				"id":   data.Int(i),
+				"host": data.String("web"),
+			})
+			t.Timestamp = ts
+			return t
+		}
+
+		Convey("When writing tuples", func() {
+			params["id_field"] = data.String("id")
+			params["timestamp_field"] = data.String("@timestamp")
+			s, err := createESSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			for i := 0; i < 3; i++ {
+				So(s.Write(ctx, tuple(i)), ShouldBeNil)
+			}
+
+			Convey("Then a full batch should be sent by a bulk request", func() {
+				reqs := es.received()
+				So(reqs, ShouldHaveLength, 1)
+				So(reqs[0], ShouldHaveLength, 4)
+				So(reqs[0][0], ShouldEqual, `{"index":{"_id":"0","_index":"logs-web-2016.01.02"}}`)
+
+				doc := map[string]interface{}{}
+				So(json.Unmarshal([]byte(reqs[0][1]), &doc), ShouldBeNil)
+				So(doc, ShouldResemble, map[string]interface{}{
+					"id":         float64(0),
+					"host":       "web",
+					"@timestamp": "2016-01-02T03:04:05Z",
+				})
+				So(s.(core.Statuser).Status()["num_pending"], ShouldEqual, 1)
+			})
+
+			Convey("Then closing the sink should send the rest", func() {
+				So(s.Close(ctx), ShouldBeNil)
+				So(es.received(), ShouldHaveLength, 2)
+				So(s.(core.Statuser).Status()["num_written"], ShouldEqual, 3)
+			})
+		})
+
+		Convey("When tuples aren't enough to fill a batch", func() {
+			params["flush_interval"] = data.String("10ms")
+			params["batch_size"] = data.Int(100)
+			s, err := createESSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+			So(s.Write(ctx, tuple(1)), ShouldBeNil)
+
+			Convey("Then they should be sent after the flush interval", func() {
+				var reqs [][]string
+				for i := 0; i < 100 && len(reqs) == 0; i++ {
+					time.Sleep(10 * time.Millisecond)
+					reqs = es.received()
+				}
+				So(reqs, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When some documents are rejected with 429", func() {
+			es.statuses = []int{429, 400, 201}
+			s, err := createESSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			So(s.Write(ctx, tuple(1)), ShouldBeNil)
+			err = s.Write(ctx, tuple(2))
+
+			Convey("Then only they should be retried", func() {
+				So(err, ShouldNotBeNil)
+				reqs := es.received()
+				So(reqs, ShouldHaveLength, 2)
+				So(reqs[1], ShouldHaveLength, 2)
+				So(reqs[1][1], ShouldContainSubstring, `"id":1`)
+
+				st := s.(core.Statuser).Status()
+				So(st["num_written"], ShouldEqual, 1)
+				So(st["num_failed"], ShouldEqual, 1)
+				msg, _ := data.AsString(st["last_error"])
+				So(msg, ShouldContainSubstring, "error_400")
+				So(s.Close(ctx), ShouldBeNil)
+			})
+		})
+
+		Convey("When the cluster keeps responding with 429", func() {
+			es.statuses = []int{1429, 1429, 1429}
+			params["max_retries"] = data.Int(1)
+			s, err := createESSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			So(s.Write(ctx, tuple(1)), ShouldBeNil)
+			err = s.Write(ctx, tuple(2))
+
+			Convey("Then tuples should be dropped after retries", func() {
+				So(err, ShouldNotBeNil)
+				So(es.received(), ShouldHaveLength, 2)
+				st := s.(core.Statuser).Status()
+				So(st["num_failed"], ShouldEqual, 2)
+				So(st["num_pending"], ShouldEqual, 0)
+				So(s.Close(ctx), ShouldBeNil)
+			})
+		})
+
+		Convey("When the bulk request is rejected", func() {
+			es.statuses = []int{1400}
+			s, err := createESSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			So(s.Write(ctx, tuple(1)), ShouldBeNil)
+			err = s.Write(ctx, tuple(2))
+
+			Convey("Then it shouldn't be retried", func() {
+				So(err, ShouldNotBeNil)
+				So(es.received(), ShouldHaveLength, 1)
+				So(s.(core.Statuser).Status()["num_failed"], ShouldEqual, 2)
+				So(s.Close(ctx), ShouldBeNil)
+			})
+		})
+
+		Convey("When writing a tuple without a value for the index", func() {
+			s, err := createESSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+
+			Convey("Then it should fail", func() {
+				So(s.Write(ctx, core.NewTuple(data.Map{})), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When creating a sink with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"empty index":              {"index": data.String("")},
+				"unclosed index":           {"index": data.String("logs-{host")},
+				"unmatched brace":          {"index": data.String("logs-}")},
+				"invalid index path":       {"index": data.String("logs-{a[}")},
+				"timestamp without layout": {"index": data.String("logs-{@timestamp}")},
+				"unsupported action":       {"action": data.String("delete")},
+				"invalid id_field":         {"id_field": data.String("a[")},
+				"zero batch_size":          {"batch_size": data.Int(0)},
+				"zero flush_interval":      {"flush_interval": data.Int(0)},
+				"negative max_retries":     {"max_retries": data.Int(-1)},
+				"zero timeout":             {"timeout": data.Int(0)},
+				"negative retry_interval":  {"retry_interval": data.Int(-1)},
+			}
+			for name, c := range cases {
+				c := c
+				Convey("Then "+name+" should result in an error", func() {
+					ps := params.Copy()
+					for k, v := range c {
+						ps[k] = v
+					}
+					_, err := createESSink(ctx, &IOParams{}, ps)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
@@ -0,0 +1,87 @@
+package execution
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+)
+
+// OutputColumns returns the top-level keys of maps computed by the plan in
+// the order of the projection list. For example, the columns of
+// `SELECT a, b + 1 AS c.d, count(*)` are "a", "c", and "count". A column
+// written by multiple projections, e.g. `x AS c.d, y AS c.e`, is only listed
+// at its first position.
+//
+// A wildcard projection is represented by "*" since the keys it pulls up
+// from input tuples aren't known until a row is computed. OrderColumns
+// resolves it for each row. Wildcards can be removed beforehand by
+// ExpandWildcards when schemas of input streams are known.
+func (lp *LogicalPlan) OutputColumns() ([]string, error) {
+	cols := make([]string, 0, len(lp.Projections))
+	seen := map[string]bool{}
+	for _, proj := range lp.Projections {
+		var col string
+		switch proj.alias {
+		case ":having:":
+			continue
+		case "*":
+			col = "*"
+		default:
+			// the top-level key of a path like a.b[0] is obtained by
+			// assigning a value to an empty map
+			path, err := data.CompilePath(proj.alias)
+			if err != nil {
+				return nil, err
+			}
+			m := data.Map{}
+			if err := m.Set(path, data.Null{}); err != nil {
+				return nil, err
+			}
+			for k := range m {
+				col = k
+			}
+		}
+		if seen[col] {
+			continue
+		}
+		seen[col] = true
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// OrderColumns returns the keys of m in the order of columns returned by
+// OutputColumns. Keys of m which aren't in columns are the ones pulled up by
+// a wildcard. Because the order of keys in an input map isn't defined, they
+// are sorted lexicographically and placed at the position of the first
+// wildcard. Columns missing in m are omitted.
+func OrderColumns(columns []string, m data.Map) []string {
+	res := make([]string, 0, len(m))
+	explicit := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		explicit[c] = true
+	}
+
+	wildcardDone := false
+	for _, c := range columns {
+		if c != "*" {
+			if _, ok := m[c]; ok {
+				res = append(res, c)
+			}
+			continue
+		}
+		if wildcardDone {
+			continue
+		}
+		wildcardDone = true
+
+		pulled := []string{}
+		for k := range m {
+			if !explicit[k] {
+				pulled = append(pulled, k)
+			}
+		}
+		sort.Strings(pulled)
+		res = append(res, pulled...)
+	}
+	return res
+}
@@ -0,0 +1,98 @@
+package execution
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestOutputColumns(t *testing.T) {
+	reg := udf.CopyGlobalUDFRegistry(core.NewContext(nil))
+	columns := func(stmt parser.SelectStmt) []string {
+		lp, err := Analyze(stmt, reg)
+		So(err, ShouldBeNil)
+		cols, err := lp.OutputColumns()
+		So(err, ShouldBeNil)
+		return cols
+	}
+	parse := func(s string) parser.SelectStmt {
+		stmt, _, err := parser.New().ParseStmt(s)
+		So(err, ShouldBeNil)
+		return stmt.(parser.SelectStmt)
+	}
+
+	Convey("Given a statement having aliases and implicit column names", t, func() {
+		stmt := parse(`SELECT RSTREAM b, a + 1 AS x.y, abs(a), a..c, ts(), 1 AS x.z, a AS w[0]
+			FROM s [RANGE 1 TUPLES]`)
+
+		Convey("When getting its output columns", func() {
+			cols := columns(stmt)
+
+			Convey("Then they should be in the order of projections", func() {
+				So(cols, ShouldResemble, []string{"b", "x", "abs", "col_3", "ts", "w"})
+			})
+		})
+	})
+
+	Convey("Given a statement having a HAVING clause", t, func() {
+		stmt := parse(`SELECT RSTREAM b, count(*) FROM s [RANGE 2 TUPLES]
+			GROUP BY b HAVING count(*) > 1`)
+
+		Convey("When getting its output columns", func() {
+			cols := columns(stmt)
+
+			Convey("Then the HAVING clause shouldn't be a column", func() {
+				So(cols, ShouldResemble, []string{"b", "count"})
+			})
+		})
+	})
+
+	Convey("Given a statement having a wildcard", t, func() {
+		stmt := parse(`SELECT RSTREAM x AS z, *, b + 1 AS a FROM s [RANGE 1 TUPLES]`)
+
+		Convey("When getting its output columns", func() {
+			cols := columns(stmt)
+
+			Convey("Then the wildcard should be kept as a placeholder", func() {
+				So(cols, ShouldResemble, []string{"z", "*", "a"})
+			})
+
+			Convey("Then keys pulled up by the wildcard should be sorted", func() {
+				m := data.Map{
+					"z": data.Int(1),
+					"a": data.Int(2),
+					"d": data.Int(3),
+					"c": data.Int(4),
+					"b": data.Int(5),
+				}
+				So(OrderColumns(cols, m), ShouldResemble, []string{"z", "b", "c", "d", "a"})
+			})
+		})
+
+		Convey("When expanding the wildcard with a schema", func() {
+			expanded, err := ExpandWildcards(stmt, map[string][]string{
+				"s": {"c", "a", "b"},
+			})
+			So(err, ShouldBeNil)
+			cols := columns(expanded)
+
+			Convey("Then columns should be in the order of the schema", func() {
+				So(cols, ShouldResemble, []string{"z", "c", "b", "a"})
+			})
+		})
+	})
+
+	Convey("Given columns of a statement", t, func() {
+		cols := []string{"a", "b", "c"}
+
+		Convey("When ordering keys of a map missing a column", func() {
+			Convey("Then the missing column should be omitted", func() {
+				So(OrderColumns(cols, data.Map{"c": data.Int(1), "a": data.Int(2)}),
+					ShouldResemble, []string{"a", "c"})
+			})
+		})
+	})
+}
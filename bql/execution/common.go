@@ -19,18 +19,32 @@ type aliasedEvaluator struct {
 type commonExecutionPlan struct {
 	projections []aliasedEvaluator
 	groupList   []Evaluator
+	// subexprs caches results of subexpressions shared by projections.
+	// It's nil when there's no shared subexpression.
+	subexprs *subexpressionCache
 	// filter stores the evaluator of the filter condition,
 	// or nil if there is no WHERE clause.
 	filter Evaluator
+	// ctx provides the clock used for now(). It can be nil.
+	ctx *core.Context
 }
 
-func prepareProjections(projections []aliasedExpression, reg udf.FunctionRegistry) ([]aliasedEvaluator, error) {
+// prepareProjections creates evaluators of projections. Function calls
+// appearing in more than one place in projections share their results via
+// the returned cache, which has to be reset for each input row.
+func prepareProjections(projections []aliasedExpression, reg udf.FunctionRegistry, ignoreCase bool) ([]aliasedEvaluator, *subexpressionCache, error) {
+	exprs := make([]FlatExpression, len(projections))
+	for i, proj := range projections {
+		exprs[i] = proj.expr
+	}
+	exprs, cache := shareSubexpressions(exprs, reg)
+
 	output := make([]aliasedEvaluator, len(projections))
 	for i, proj := range projections {
 		// compute evaluators for each column
-		plan, err := ExpressionToEvaluator(proj.expr, reg)
+		plan, err := expressionToEvaluator(exprs[i], reg, ignoreCase)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		containsAggregate := len(proj.aggrInputs) > 0
 		// compute evaluators for the aggregate inputs
@@ -38,9 +52,9 @@ func prepareProjections(projections []aliasedExpression, reg udf.FunctionRegistr
 		if containsAggregate {
 			aggrEvals = make(map[string]Evaluator, len(proj.aggrInputs))
 			for key, aggrInput := range proj.aggrInputs {
-				aggrEval, err := ExpressionToEvaluator(aggrInput, reg)
+				aggrEval, err := expressionToEvaluator(aggrInput, reg, ignoreCase)
 				if err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 				aggrEvals[key] = aggrEval
 			}
@@ -49,26 +63,26 @@ func prepareProjections(projections []aliasedExpression, reg udf.FunctionRegistr
 		if proj.alias != "*" && proj.alias != ":having:" {
 			path, err = data.CompilePath(proj.alias)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 		}
 		output[i] = aliasedEvaluator{proj.alias, path, plan, containsAggregate, aggrEvals}
 	}
-	return output, nil
+	return output, cache, nil
 }
 
-func prepareFilter(filter FlatExpression, reg udf.FunctionRegistry) (Evaluator, error) {
+func prepareFilter(filter FlatExpression, reg udf.FunctionRegistry, ignoreCase bool) (Evaluator, error) {
 	if filter != nil {
-		return ExpressionToEvaluator(filter, reg)
+		return expressionToEvaluator(filter, reg, ignoreCase)
 	}
 	return nil, nil
 }
 
-func prepareGroupList(groupList []FlatExpression, reg udf.FunctionRegistry) ([]Evaluator, error) {
+func prepareGroupList(groupList []FlatExpression, reg udf.FunctionRegistry, ignoreCase bool) ([]Evaluator, error) {
 	output := make([]Evaluator, len(groupList))
 	for i, expr := range groupList {
 		// compute evaluators for each expression
-		plan, err := ExpressionToEvaluator(expr, reg)
+		plan, err := expressionToEvaluator(expr, reg, ignoreCase)
 		if err != nil {
 			return nil, err
 		}
@@ -82,12 +96,20 @@ func prepareGroupList(groupList []FlatExpression, reg udf.FunctionRegistry) ([]E
 //   {"alias": {"col_0": ..., "col_1": ...}}
 // is transformed into
 //   {"alias": {"col_0": ..., "col_1": ...},
-//    "alias:meta:TS": (timestamp of the given tuple)}
+//    "alias:meta:TS": (timestamp of the given tuple),
+//    "alias:meta:CORRELATION_ID": (correlation ID of the given tuple)}
 // so that the Evaluator created from a parser.RowMeta AST struct works correctly.
+// The correlation ID is Null when the tuple doesn't have one.
 func setMetadata(where data.Map, alias string, t *core.Tuple) {
-	// this key format is also used in ExpressionToEvaluator()
+	// this key format is also used in expressionToEvaluator()
 	tsKey := fmt.Sprintf("%s:meta:%s", alias, parser.TimestampMeta)
 	where[tsKey] = data.Timestamp(t.Timestamp)
+	cidKey := fmt.Sprintf("%s:meta:%s", alias, parser.CorrelationIDMeta)
+	if t.CorrelationID == "" {
+		where[cidKey] = data.Null{}
+	} else {
+		where[cidKey] = data.String(t.CorrelationID)
+	}
 }
 
 // assignOutputValue writes the given Value `value` to the given
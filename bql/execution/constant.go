@@ -0,0 +1,106 @@
+package execution
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+)
+
+// ValidateConstant returns an error if expr cannot be used at a position
+// requiring a constant value, i.e. if it isn't foldable. position describes
+// the position in the statement and is used in the error message together
+// with the innermost subexpression making expr non-constant, such as a
+// column reference.
+func ValidateConstant(position string, expr parser.Expression) error {
+	if sub := nonFoldableSubexpression(expr); sub != nil {
+		return fmt.Errorf("%v must be a constant, but %v isn't", position, sub)
+	}
+	return nil
+}
+
+// UDSFParamPosition returns the description of the position of the i-th
+// (0-origin) parameter of a UDSF used in ValidateConstant. A named argument
+// is described by its name.
+func UDSFParamPosition(rel *parser.AliasedStreamWindowAST, i int) string {
+	if arg, ok := rel.Params[i].(parser.NamedArgAST); ok {
+		return fmt.Sprintf("parameter '%v' of UDSF '%v'", arg.Name, rel.Name)
+	}
+	return fmt.Sprintf("parameter %v of UDSF '%v'", i+1, rel.Name)
+}
+
+// validateConstants checks that expressions at positions requiring constant
+// values in the given statement are foldable.
+func validateConstants(s *parser.SelectStmt) error {
+	for _, rel := range s.Relations {
+		if rel.Type != parser.UDSFStream {
+			continue
+		}
+		for i, expr := range rel.Params {
+			if err := ValidateConstant(UDSFParamPosition(&rel, i), expr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nonFoldableSubexpression returns the innermost subexpression of expr which
+// isn't foldable. It returns nil when expr is foldable.
+func nonFoldableSubexpression(expr parser.Expression) parser.Expression {
+	if expr.Foldable() {
+		return nil
+	}
+
+	var children []parser.Expression
+	addCase := func(c parser.ConditionCaseAST) {
+		for _, pair := range c.Checks {
+			children = append(children, pair.When, pair.Then)
+		}
+		if c.Else != nil {
+			children = append(children, c.Else)
+		}
+	}
+	switch obj := expr.(type) {
+	case parser.AliasAST:
+		children = []parser.Expression{obj.Expr}
+	case parser.BinaryOpAST:
+		children = []parser.Expression{obj.Left, obj.Right}
+	case parser.UnaryOpAST:
+		children = []parser.Expression{obj.Expr}
+	case parser.TypeCastAST:
+		children = []parser.Expression{obj.Expr}
+	case parser.NamedArgAST:
+		children = []parser.Expression{obj.Expr}
+	case parser.FuncAppAST:
+		children = append(children, obj.Expressions...)
+		for _, o := range obj.Ordering {
+			children = append(children, o.Expr)
+		}
+		if obj.Filter != nil {
+			children = append(children, obj.Filter)
+		}
+	case parser.ArrayAST:
+		children = obj.Expressions
+	case parser.LikePatternAST:
+		children = []parser.Expression{obj.Pattern}
+	case parser.MapAST:
+		for _, pair := range obj.Entries {
+			if pair.KeyExpr != nil {
+				children = append(children, pair.KeyExpr)
+			}
+			children = append(children, pair.Value)
+		}
+	case parser.ConditionCaseAST:
+		addCase(obj)
+	case parser.ExpressionCaseAST:
+		children = []parser.Expression{obj.Expr}
+		addCase(obj.ConditionCaseAST)
+	}
+
+	for _, c := range children {
+		if sub := nonFoldableSubexpression(c); sub != nil {
+			return sub
+		}
+	}
+	// expr itself isn't foldable, e.g. a column reference or now()
+	return expr
+}
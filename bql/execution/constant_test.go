@@ -0,0 +1,71 @@
+package execution
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"testing"
+)
+
+func TestValidateConstant(t *testing.T) {
+	parse := func(s string) parser.Expression {
+		stmt, _, err := parser.New().ParseStmt("EVAL " + s)
+		So(err, ShouldBeNil)
+		return stmt.(parser.EvalStmt).Expr
+	}
+
+	Convey("Given a position requiring a constant", t, func() {
+		position := "the LIMIT parameter"
+
+		Convey("When validating a constant expression", func() {
+			err := ValidateConstant(position, parse(`2 * (3 + 1)`))
+
+			Convey("Then it should succeed", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When validating a column reference", func() {
+			err := ValidateConstant(position, parse(`a`))
+
+			Convey("Then it should fail naming the position and the column", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "the LIMIT parameter must be a constant, but a isn't")
+			})
+		})
+
+		Convey("When validating an expression containing a column reference", func() {
+			err := ValidateConstant(position, parse(`2 * abs(1 + x:b)`))
+
+			Convey("Then it should fail naming the column", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "the LIMIT parameter must be a constant, but x:b isn't")
+			})
+		})
+
+		Convey("When validating an expression containing now()", func() {
+			err := ValidateConstant(position, parse(`[1, now()]`))
+
+			Convey("Then it should fail naming the function call", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "the LIMIT parameter must be a constant, but now() isn't")
+			})
+		})
+	})
+
+	Convey("Given a SELECT statement using a UDSF", t, func() {
+		reg := udf.CopyGlobalUDFRegistry(core.NewContext(nil))
+
+		Convey("When a parameter of the UDSF is a column reference", func() {
+			stmt, _, err := parser.New().ParseStmt(`SELECT RSTREAM * FROM f("s", c) [RANGE 1 TUPLES]`)
+			So(err, ShouldBeNil)
+			_, err = Analyze(stmt.(parser.SelectStmt), reg)
+
+			Convey("Then the analysis should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "parameter 2 of UDSF 'f' must be a constant, but c isn't")
+			})
+		})
+	})
+}
@@ -0,0 +1,53 @@
+package execution
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+)
+
+// removeDuplicateConjuncts removes conjuncts of the top-level AND chain of
+// expr which are identical to a preceding one. Such duplicates are typically
+// created when a predicate of an upstream statement is copied into a
+// downstream one having the same predicate.
+//
+// Only exact duplicates compared by parser.EqualAST are removed, and a
+// conjunct containing a volatile expression such as a function call is
+// always kept because `random() < 0.5 AND random() < 0.5` doesn't mean the
+// same as `random() < 0.5`. For the other conjuncts, `x AND x` has the same
+// value as `x` in the three-valued logic, so the result doesn't change. The
+// relative order of the remaining conjuncts is kept.
+func removeDuplicateConjuncts(expr FlatExpression) FlatExpression {
+	conjuncts := splitConjuncts(expr, nil)
+	if len(conjuncts) < 2 {
+		return expr
+	}
+	kept := make([]FlatExpression, 0, len(conjuncts))
+	for _, c := range conjuncts {
+		if !containsConjunct(kept, c) {
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) == len(conjuncts) {
+		return expr
+	}
+
+	// rebuild the left-associative chain as created by the parser
+	result := kept[0]
+	for _, c := range kept[1:] {
+		result = binaryOpAST{parser.And, result, c}
+	}
+	return result
+}
+
+// containsConjunct returns true when conjuncts has an expression identical
+// to c and c can safely be removed as a duplicate of it.
+func containsConjunct(conjuncts []FlatExpression, c FlatExpression) bool {
+	if c.Volatility() == Volatile {
+		return false
+	}
+	for _, e := range conjuncts {
+		if parser.EqualAST(e, c) {
+			return true
+		}
+	}
+	return false
+}
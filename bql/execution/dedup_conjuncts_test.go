@@ -0,0 +1,92 @@
+package execution
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestRemoveDuplicateConjuncts(t *testing.T) {
+	ctx := core.NewContext(nil)
+	reg := udf.CopyGlobalUDFRegistry(ctx)
+
+	plan := func(where string) (*LogicalPlan, *LogicalPlan) {
+		stmt, _, err := parser.New().ParseStmt("SELECT RSTREAM a FROM s [RANGE 1 TUPLES] WHERE " + where)
+		So(err, ShouldBeNil)
+		lp, err := Analyze(stmt.(parser.SelectStmt), reg)
+		So(err, ShouldBeNil)
+		optimized, err := lp.LogicalOptimize()
+		So(err, ShouldBeNil)
+		return lp, optimized
+	}
+
+	Convey("Given a WHERE clause having a predicate copied from an upstream statement", t, func() {
+		// e.g. `SELECT ... FROM (SELECT ... WHERE a > 1 AND b = "x") WHERE a > 1`
+		// after inlining the upstream statement
+		lp, optimized := plan(`(a > 1 AND b = "x") AND a > 1`)
+
+		Convey("When optimizing the plan", func() {
+			Convey("Then exactly one copy of the predicate should be removed", func() {
+				So(optimized.Filter.Repr(), ShouldEqual, "((s:a)>(1))AND((s:b)=(x))")
+			})
+
+			Convey("Then the original plan should be untouched", func() {
+				So(lp.Filter.Repr(), ShouldEqual, "(((s:a)>(1))AND((s:b)=(x)))AND((s:a)>(1))")
+			})
+
+			Convey("Then the predicate should be semantically equivalent", func() {
+				orig, err := ExpressionToEvaluator(lp.Filter, reg)
+				So(err, ShouldBeNil)
+				opt, err := ExpressionToEvaluator(optimized.Filter, reg)
+				So(err, ShouldBeNil)
+
+				for _, m := range []data.Map{
+					{"a": data.Int(2), "b": data.String("x")},
+					{"a": data.Int(1), "b": data.String("x")},
+					{"a": data.Null{}, "b": data.String("x")},
+					{"a": data.Int(2), "b": data.Null{}},
+				} {
+					input := data.Map{"s": m}
+					expected, err := orig.Eval(input)
+					So(err, ShouldBeNil)
+					actual, err := opt.Eval(input)
+					So(err, ShouldBeNil)
+					So(actual, ShouldResemble, expected)
+				}
+			})
+		})
+	})
+
+	Convey("Given a WHERE clause having similar but different predicates", t, func() {
+		lp, optimized := plan(`a > 1 AND a > 2 AND a >= 1 AND b = "1" AND b = 1`)
+
+		Convey("When optimizing the plan", func() {
+			Convey("Then all predicates should be kept", func() {
+				So(optimized.Filter, ShouldResemble, lp.Filter)
+			})
+		})
+	})
+
+	Convey("Given a WHERE clause having duplicated volatile predicates", t, func() {
+		lp, optimized := plan(`random() < 0.5 AND random() < 0.5`)
+
+		Convey("When optimizing the plan", func() {
+			Convey("Then both predicates should be kept", func() {
+				So(optimized.Filter, ShouldResemble, lp.Filter)
+			})
+		})
+	})
+
+	Convey("Given a WHERE clause having a duplicated predicate in OR", t, func() {
+		lp, optimized := plan(`a > 1 OR a > 1`)
+
+		Convey("When optimizing the plan", func() {
+			Convey("Then the filter shouldn't change", func() {
+				So(optimized.Filter, ShouldResemble, lp.Filter)
+			})
+		})
+	})
+}
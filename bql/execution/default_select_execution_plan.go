@@ -89,6 +89,7 @@ func (ep *defaultSelectExecutionPlan) performQueryOnBuffer() error {
 		}
 		// otherwise, compute all the expressions
 		d := *io.input
+		ep.subexprs.reset()
 		result := data.Map(make(map[string]data.Value, len(ep.projections)))
 		for _, proj := range ep.projections {
 			value, err := proj.evaluator.Eval(d)
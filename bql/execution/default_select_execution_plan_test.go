@@ -2048,6 +2048,266 @@ func TestDefaultSelectExecutionPlanJoin(t *testing.T) {
 	})
 }
 
+func TestDefaultSelectExecutionPlanOuterJoin(t *testing.T) {
+	// src1: {int: 1, l: l0}, src2: {int: 1, r: r1}, src2: {int: 5, r: r2},
+	// src1: {int: 4, l: l3}
+	getJoinTuples := func() []*core.Tuple {
+		tuples := getTuples(4)
+		for i, t := range tuples {
+			if i == 0 || i == 3 {
+				t.InputName = "src1"
+				t.Data["l"] = data.String(fmt.Sprintf("l%d", i))
+			} else {
+				t.InputName = "src2"
+				t.Data["r"] = data.String(fmt.Sprintf("r%d", i))
+			}
+		}
+		tuples[1].Data["int"] = data.Int(1)
+		tuples[2].Data["int"] = data.Int(5)
+		return tuples
+	}
+	row := func(l, r string) data.Map {
+		m := data.Map{"l": data.Null{}, "r": data.Null{}}
+		if l != "" {
+			m["l"] = data.String(l)
+		}
+		if r != "" {
+			m["r"] = data.String(r)
+		}
+		return m
+	}
+
+	cases := []struct {
+		join     string
+		expected [][]data.Map
+	}{
+		{"LEFT OUTER JOIN", [][]data.Map{
+			{row("l0", "")},
+			{row("l0", "r1")},
+			{row("l0", "r1")},
+			{row("l0", "r1"), row("l3", "")},
+		}},
+		{"RIGHT JOIN", [][]data.Map{
+			nil,
+			{row("l0", "r1")},
+			{row("l0", "r1"), row("", "r2")},
+			{row("l0", "r1"), row("", "r2")},
+		}},
+		{"FULL OUTER JOIN", [][]data.Map{
+			{row("l0", "")},
+			{row("l0", "r1")},
+			{row("l0", "r1"), row("", "r2")},
+			{row("l0", "r1"), row("", "r2"), row("l3", "")},
+		}},
+	}
+
+	for _, c := range cases {
+		c := c
+		Convey(fmt.Sprintf("Given a %v selecting from left and right", c.join), t, func() {
+			tuples := getJoinTuples()
+			s := `CREATE STREAM box AS SELECT RSTREAM src1:l, src2:r FROM src1 [RANGE 2 TUPLES] ` +
+				c.join + ` src2 [RANGE 2 TUPLES] ON src1:int = src2:int`
+			plan, err := createDefaultSelectPlan(s, t)
+			So(err, ShouldBeNil)
+
+			Convey("When feeding it with tuples", func() {
+				for idx, inTup := range tuples {
+					out, err := plan.Process(inTup)
+					So(err, ShouldBeNil)
+					sort.Sort(tupleList(out))
+					expected := c.expected[idx]
+					sort.Sort(tupleList(expected))
+
+					Convey(fmt.Sprintf("Then rows without partners should be padded with NULL in %v", idx), func() {
+						So(len(out), ShouldEqual, len(expected))
+						for i := range expected {
+							So(out[i], ShouldResemble, expected[i])
+						}
+					})
+				}
+			})
+		})
+	}
+
+	Convey("Given a LEFT OUTER JOIN with a wildcard", t, func() {
+		tuples := getJoinTuples()
+		s := `CREATE STREAM box AS SELECT RSTREAM * FROM src1 [RANGE 2 TUPLES] ` +
+			`LEFT OUTER JOIN src2 [RANGE 2 TUPLES] ON src1:int = src2:int`
+		plan, err := createDefaultSelectPlan(s, t)
+		So(err, ShouldBeNil)
+
+		Convey("When feeding it with a tuple without partners", func() {
+			out, err := plan.Process(tuples[0])
+			So(err, ShouldBeNil)
+
+			Convey("Then only columns of the left relation should be emitted", func() {
+				So(out, ShouldResemble, []data.Map{{"int": data.Int(1), "l": data.String("l0")}})
+			})
+		})
+	})
+
+	Convey("Given a LEFT OUTER JOIN with a time-based window", t, func() {
+		tuples := getJoinTuples()
+		s := `CREATE STREAM box AS SELECT ISTREAM src1:l, src2:r FROM src1 [RANGE 2 TUPLES] ` +
+			`LEFT OUTER JOIN src2 [RANGE 1 SECONDS] ON src1:int = src2:int`
+		plan, err := createDefaultSelectPlan(s, t)
+		So(err, ShouldBeNil)
+
+		Convey("When the partner of a tuple is removed by a heartbeat", func() {
+			for _, inTup := range tuples[:2] {
+				_, err := plan.Process(inTup)
+				So(err, ShouldBeNil)
+			}
+			hb := core.NewTuple(nil)
+			hb.Flags.Set(core.TFHeartbeat)
+			hb.Timestamp = tuples[1].Timestamp.Add(2 * time.Second)
+			out, err := plan.Process(hb)
+			So(err, ShouldBeNil)
+
+			Convey("Then the tuple should be emitted with NULL", func() {
+				So(out, ShouldResemble, []data.Map{row("l0", "")})
+			})
+		})
+	})
+
+	Convey("Given a LEFT OUTER JOIN with an aggregate in ON", t, func() {
+		s := `CREATE STREAM box AS SELECT RSTREAM src1:l FROM src1 [RANGE 2 TUPLES] ` +
+			`LEFT OUTER JOIN src2 [RANGE 2 TUPLES] ON count(src1:int) = src2:int`
+		_, err := createDefaultSelectPlan(s, t)
+
+		Convey("Then it should fail", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "aggregates not allowed in ON clause")
+		})
+	})
+
+	Convey("Given a LEFT OUTER JOIN referring to an unknown relation in ON", t, func() {
+		s := `CREATE STREAM box AS SELECT RSTREAM src1:l FROM src1 [RANGE 2 TUPLES] ` +
+			`LEFT OUTER JOIN src2 [RANGE 2 TUPLES] ON src1:int = src3:int`
+		_, err := createDefaultSelectPlan(s, t)
+
+		Convey("Then it should fail", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestDefaultSelectExecutionPlanSlide(t *testing.T) {
+	Convey("Given a time-based window with a SLIDE", t, func() {
+		tuples := getTuples(5)
+		s := `CREATE STREAM box AS SELECT RSTREAM int FROM src [RANGE 10 SECONDS, SLIDE 2 SECONDS]`
+		plan, err := createDefaultSelectPlan(s, t)
+		So(err, ShouldBeNil)
+
+		ints := func(out []data.Map) []int64 {
+			res := make([]int64, 0, len(out))
+			for _, m := range out {
+				i, _ := data.AsInt(m["int"])
+				res = append(res, i)
+			}
+			return res
+		}
+
+		Convey("When feeding it with tuples", func() {
+			outs := make([][]data.Map, len(tuples))
+			for idx, inTup := range tuples {
+				out, err := plan.Process(inTup)
+				So(err, ShouldBeNil)
+				outs[idx] = out
+			}
+
+			Convey("Then results should only be emitted at slide boundaries", func() {
+				So(outs[0], ShouldBeEmpty)
+				So(outs[1], ShouldBeEmpty)
+				So(ints(outs[2]), ShouldResemble, []int64{1, 2})
+				So(outs[3], ShouldBeEmpty)
+				So(ints(outs[4]), ShouldResemble, []int64{1, 2, 3, 4})
+			})
+
+			Convey("And a heartbeat passes the next slide boundary", func() {
+				hb := core.NewTuple(nil)
+				hb.Flags.Set(core.TFHeartbeat)
+				hb.Timestamp = tuples[4].Timestamp.Add(2500 * time.Millisecond)
+				out, err := plan.Process(hb)
+				So(err, ShouldBeNil)
+
+				Convey("Then the window should be evaluated", func() {
+					So(ints(out), ShouldResemble, []int64{1, 2, 3, 4, 5})
+				})
+
+				Convey("Then a heartbeat before the following boundary shouldn't trigger an evaluation", func() {
+					hb2 := core.NewTuple(nil)
+					hb2.Flags.Set(core.TFHeartbeat)
+					hb2.Timestamp = hb.Timestamp.Add(time.Second)
+					out, err := plan.Process(hb2)
+					So(err, ShouldBeNil)
+					So(out, ShouldBeEmpty)
+				})
+			})
+		})
+	})
+
+	Convey("Given a SLIDE with a non-time-based unit", t, func() {
+		s := `CREATE STREAM box AS SELECT RSTREAM int FROM src [RANGE 10 SECONDS, SLIDE 2 TUPLES]`
+		_, err := createDefaultSelectPlan(s, t)
+
+		Convey("Then it should fail", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "SLIDE must be given in SECONDS or MILLISECONDS, not TUPLES")
+		})
+	})
+}
+
+func TestDefaultSelectExecutionPlanDistinct(t *testing.T) {
+	Convey("Given a SELECT DISTINCT clause with an ISTREAM emitter", t, func() {
+		tuples := getTuples(4)
+		s := `CREATE STREAM box AS SELECT ISTREAM DISTINCT int % 2 AS x FROM src [RANGE 3 TUPLES]`
+		plan, err := createDefaultSelectPlan(s, t)
+		So(err, ShouldBeNil)
+
+		Convey("When feeding it with tuples", func() {
+			expected := [][]data.Map{
+				{{"x": data.Int(1)}},
+				{{"x": data.Int(0)}},
+				nil,
+				nil,
+			}
+			for idx, inTup := range tuples {
+				out, err := plan.Process(inTup)
+				So(err, ShouldBeNil)
+
+				Convey(fmt.Sprintf("Then only new distinct rows should be emitted in %v", idx), func() {
+					So(out, ShouldResemble, expected[idx])
+				})
+			}
+		})
+	})
+
+	Convey("Given a SELECT DISTINCT clause with an RSTREAM emitter", t, func() {
+		tuples := getTuples(4)
+		s := `CREATE STREAM box AS SELECT RSTREAM DISTINCT int % 2 AS x FROM src [RANGE 3 TUPLES]`
+		plan, err := createDefaultSelectPlan(s, t)
+		So(err, ShouldBeNil)
+
+		Convey("When feeding it with tuples", func() {
+			expected := [][]data.Map{
+				{{"x": data.Int(1)}},
+				{{"x": data.Int(1)}, {"x": data.Int(0)}},
+				{{"x": data.Int(1)}, {"x": data.Int(0)}},
+				{{"x": data.Int(0)}, {"x": data.Int(1)}},
+			}
+			for idx, inTup := range tuples {
+				out, err := plan.Process(inTup)
+				So(err, ShouldBeNil)
+
+				Convey(fmt.Sprintf("Then each row should be emitted once in %v", idx), func() {
+					So(out, ShouldResemble, expected[idx])
+				})
+			}
+		})
+	})
+}
+
 func createDefaultSelectPlan2(s string) (PhysicalPlan, error) {
 	p := parser.New()
 	reg := udf.CopyGlobalUDFRegistry(core.NewContext(nil))
@@ -2214,3 +2474,88 @@ func BenchmarkNormalJoin(b *testing.B) {
 		}
 	}
 }
+
+func TestDefaultSelectExecutionPlanWithFakeClock(t *testing.T) {
+	Convey("Given a time-based window and a context having a fake clock", t, func() {
+		t0 := time.Date(2015, time.April, 10, 10, 23, 0, 0, time.UTC)
+		clock := core.NewFakeClock(t0)
+		reg := udf.CopyGlobalUDFRegistry(core.NewContext(&core.ContextConfig{
+			Clock: clock,
+		}))
+		stmt, _, err := parser.New().ParseStmt(`SELECT RSTREAM int, now() AS n FROM src [RANGE 2 SECONDS]`)
+		So(err, ShouldBeNil)
+		lp, err := Analyze(stmt.(parser.SelectStmt), reg)
+		So(err, ShouldBeNil)
+		plan, err := NewDefaultSelectExecutionPlan(lp, reg)
+		So(err, ShouldBeNil)
+
+		// fed has the time when each tuple was processed
+		fed := map[int64]time.Time{}
+		newTuple := func(i int) *core.Tuple {
+			now := clock.Now()
+			fed[int64(i)] = now
+			return &core.Tuple{
+				Data:          data.Map{"int": data.Int(i)},
+				InputName:     "src",
+				Timestamp:     now,
+				ProcTimestamp: now,
+			}
+		}
+		window := func(out []data.Map) []int64 {
+			ints := []int64{}
+			for _, m := range out {
+				i, err := data.AsInt(m["int"])
+				So(err, ShouldBeNil)
+				// now() is computed only once for each input row
+				n, err := data.AsTimestamp(m["n"])
+				So(err, ShouldBeNil)
+				So(n.Equal(fed[i]), ShouldBeTrue)
+				ints = append(ints, i)
+			}
+			sort.Sort(int64Slice(ints))
+			return ints
+		}
+
+		Convey("When advancing the clock while feeding tuples", func() {
+			steps := []struct {
+				advance  time.Duration
+				expected []int64
+			}{
+				{0, []int64{1}},
+				{time.Second, []int64{1, 2}},
+				// a tuple exactly at the boundary is still in the window
+				{time.Second, []int64{1, 2, 3}},
+				{500 * time.Millisecond, []int64{2, 3, 4}},
+			}
+
+			Convey("Then the window should have tuples within the range", func() {
+				for i, s := range steps {
+					clock.Advance(s.advance)
+					out, err := plan.Process(newTuple(i + 1))
+					So(err, ShouldBeNil)
+					So(window(out), ShouldResemble, s.expected)
+				}
+
+				Convey("And heartbeats should close the window at the clock's time", func() {
+					out, err := plan.Process(core.NewHeartbeatTuple(clock.Advance(1500 * time.Millisecond)))
+					So(err, ShouldBeNil)
+					So(window(out), ShouldResemble, []int64{3, 4})
+
+					out, err = plan.Process(core.NewHeartbeatTuple(clock.Advance(500 * time.Millisecond)))
+					So(err, ShouldBeNil)
+					So(window(out), ShouldResemble, []int64{4})
+
+					out, err = plan.Process(core.NewHeartbeatTuple(clock.Advance(time.Millisecond)))
+					So(err, ShouldBeNil)
+					So(window(out), ShouldBeEmpty)
+				})
+			})
+		})
+	})
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -8,8 +8,10 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"math"
 	"reflect"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 )
 
 // An Evaluator represents an expression such as `colX + 2` or
@@ -54,6 +56,38 @@ func EvaluateFoldable(expr parser.Expression, reg udf.FunctionRegistry) (data.Va
 	return evaluator.Eval(nil)
 }
 
+// EvaluateUDSFArgs evaluates the parameters of the UDSF referred to by the
+// relation. Positional arguments are returned in order and named arguments
+// are returned in a map. They can be arranged for the UDSFCreator by
+// udf.ArrangeUDSFArgs. It fails when a parameter isn't a constant, as in
+// `udsf(7, col)`.
+func EvaluateUDSFArgs(rel *parser.AliasedStreamWindowAST, reg udf.FunctionRegistry) ([]data.Value, data.Map, error) {
+	args := make([]data.Value, 0, len(rel.Params))
+	var named data.Map
+	for i, expr := range rel.Params {
+		if err := ValidateConstant(UDSFParamPosition(rel, i), expr); err != nil {
+			return nil, nil, err
+		}
+		arg, isNamed := expr.(parser.NamedArgAST)
+		if isNamed {
+			expr = arg.Expr
+		}
+		v, err := EvaluateFoldable(expr, reg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if isNamed {
+			if named == nil {
+				named = data.Map{}
+			}
+			named[arg.Name] = v
+		} else {
+			args = append(args, v)
+		}
+	}
+	return args, named, nil
+}
+
 // EvaluateOnInput evaluates a (not necessarily foldable)
 // expression, given a Map that represents a row of data.
 func EvaluateOnInput(expr parser.Expression, input data.Value, reg udf.FunctionRegistry) (data.Value, error) {
@@ -73,22 +107,30 @@ func EvaluateOnInput(expr parser.Expression, input data.Value, reg udf.FunctionR
 // an Evaluator that can be used to evaluate an expression given a particular
 // input Value.
 func ExpressionToEvaluator(ast FlatExpression, reg udf.FunctionRegistry) (Evaluator, error) {
+	return expressionToEvaluator(ast, reg, false)
+}
+
+// expressionToEvaluator works like ExpressionToEvaluator. When ignoreCase
+// is true, column references are resolved case-insensitively.
+func expressionToEvaluator(ast FlatExpression, reg udf.FunctionRegistry, ignoreCase bool) (Evaluator, error) {
 	switch obj := ast.(type) {
 	case rowMeta:
 		// construct a key for reading as used in setMetadata() for writing
 		metaKey := fmt.Sprintf(`["%s:meta:%s"]`, obj.Relation, obj.MetaType)
 		if obj.MetaType == parser.TimestampMeta {
-			pa, err := newPathAccess(metaKey)
+			pa, err := newPathAccess(metaKey, false)
 			if err != nil {
 				return nil, err
 			}
 			return &timestampCast{pa}, nil
+		} else if obj.MetaType == parser.CorrelationIDMeta {
+			return newPathAccess(metaKey, false)
 		}
 	case stmtMeta:
 		// construct a key for reading as used in setMetadata() for writing
 		metaKey := fmt.Sprintf(`[":meta:%s"]`, obj.MetaType)
 		if obj.MetaType == parser.NowMeta {
-			pa, err := newPathAccess(metaKey)
+			pa, err := newPathAccess(metaKey, false)
 			if err != nil {
 				return nil, err
 			}
@@ -103,9 +145,14 @@ func ExpressionToEvaluator(ast FlatExpression, reg udf.FunctionRegistry) (Evalua
 				path = obj.Relation + "." + path
 			}
 		}
-		return newPathAccess(path)
+		eval, err := newPathAccess(path, ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		eval.(*pathAccess).relation = obj.Relation
+		return eval, nil
 	case aggInputRef:
-		return newPathAccess(obj.Ref)
+		return newPathAccess(obj.Ref, false)
 	case nullLiteral:
 		return &nullConstant{}, nil
 	case numericLiteral:
@@ -116,13 +163,32 @@ func ExpressionToEvaluator(ast FlatExpression, reg udf.FunctionRegistry) (Evalua
 		return &boolConstant{obj.Value}, nil
 	case stringLiteral:
 		return &stringConstant{obj.Value}, nil
+	case intervalLiteral:
+		return nil, fmt.Errorf("%v can only be added to or subtracted from a timestamp", obj.Repr())
 	case binaryOpAST:
+		// an interval isn't evaluated to a value, but it shifts the
+		// timestamp on the other side
+		if obj.Op == parser.Plus || obj.Op == parser.Minus {
+			if i, ok := obj.Right.(intervalLiteral); ok {
+				ts, err := expressionToEvaluator(obj.Left, reg, ignoreCase)
+				if err != nil {
+					return nil, err
+				}
+				return &timestampShift{ts, i.Value, obj.Op == parser.Minus}, nil
+			} else if i, ok := obj.Left.(intervalLiteral); ok && obj.Op == parser.Plus {
+				ts, err := expressionToEvaluator(obj.Right, reg, ignoreCase)
+				if err != nil {
+					return nil, err
+				}
+				return &timestampShift{ts, i.Value, false}, nil
+			}
+		}
 		// recurse
-		left, err := ExpressionToEvaluator(obj.Left, reg)
+		left, err := expressionToEvaluator(obj.Left, reg, ignoreCase)
 		if err != nil {
 			return nil, err
 		}
-		right, err := ExpressionToEvaluator(obj.Right, reg)
+		right, err := expressionToEvaluator(obj.Right, reg, ignoreCase)
 		if err != nil {
 			return nil, err
 		}
@@ -148,6 +214,22 @@ func ExpressionToEvaluator(ast FlatExpression, reg udf.FunctionRegistry) (Evalua
 			return newGreaterOrnewEqual(bo), nil
 		case parser.NotEqual:
 			return newNot(newEqual(bo)), nil
+		case parser.Contains:
+			return newContains(bo), nil
+		case parser.HasKey:
+			return newHasKey(bo), nil
+		case parser.In:
+			return newIn(bo), nil
+		case parser.Between:
+			return newBetween(bo), nil
+		case parser.Like:
+			escape := '\\'
+			if lp, ok := obj.Right.(likePatternAST); ok {
+				escape = lp.Escape
+			}
+			return newLike(bo, escape), nil
+		case parser.RegexpMatch:
+			return newRegexpMatch(bo), nil
 		case parser.Concat:
 			return &concat{bo}, nil
 		case parser.Is:
@@ -175,7 +257,7 @@ func ExpressionToEvaluator(ast FlatExpression, reg udf.FunctionRegistry) (Evalua
 		}
 	case unaryOpAST:
 		// recurse
-		expr, err := ExpressionToEvaluator(obj.Expr, reg)
+		expr, err := expressionToEvaluator(obj.Expr, reg, ignoreCase)
 		if err != nil {
 			return nil, err
 		}
@@ -193,18 +275,21 @@ func ExpressionToEvaluator(ast FlatExpression, reg udf.FunctionRegistry) (Evalua
 		}
 	case missing:
 		// recurse
-		expr, err := ExpressionToEvaluator(obj.Expr, reg)
+		expr, err := expressionToEvaluator(obj.Expr, reg, ignoreCase)
 		if err != nil {
 			return nil, err
 		}
 		return newMissingPathCheck(expr, obj.Not)
 	case typeCastAST:
 		// recurse
-		expr, err := ExpressionToEvaluator(obj.Expr, reg)
+		expr, err := expressionToEvaluator(obj.Expr, reg, ignoreCase)
 		if err != nil {
 			return nil, err
 		}
 		return newTypeCast(expr, obj.Target)
+	case likePatternAST:
+		// the escape character is handled by the evaluator of LIKE
+		return expressionToEvaluator(obj.Pattern, reg, ignoreCase)
 	case funcAppAST:
 		// lookup function in function registry
 		// (the registry will decide if the requested function
@@ -217,20 +302,33 @@ func ExpressionToEvaluator(ast FlatExpression, reg udf.FunctionRegistry) (Evalua
 		// compute child Evaluators
 		evals := make([]Evaluator, len(obj.Expressions))
 		for i, ast := range obj.Expressions {
-			eval, err := ExpressionToEvaluator(ast, reg)
+			eval, err := expressionToEvaluator(ast, reg, ignoreCase)
 			if err != nil {
 				return nil, err
 			}
 			evals[i] = eval
 		}
+		if eval := newMergeableAggFuncApp(fName, f, reg.Context(), evals); eval != nil {
+			return eval, nil
+		}
 		return FuncApp(fName, f, reg.Context(), evals), nil
+	case sharedSubexpressionAST:
+		// all occurrences of the subexpression share one evaluator
+		if obj.s.eval == nil {
+			eval, err := expressionToEvaluator(obj.FlatExpression, reg, ignoreCase)
+			if err != nil {
+				return nil, err
+			}
+			obj.s.eval = eval
+		}
+		return &sharedEvaluator{obj.s}, nil
 	case aggregateInputSorter:
-		return newSortedInputAggFuncApp(obj.funcAppAST, obj.ID, obj.Ordering, reg)
+		return newSortedInputAggFuncApp(obj, reg, ignoreCase)
 	case arrayAST:
 		// compute child Evaluators
 		evals := make([]Evaluator, len(obj.Expressions))
 		for i, ast := range obj.Expressions {
-			eval, err := ExpressionToEvaluator(ast, reg)
+			eval, err := expressionToEvaluator(ast, reg, ignoreCase)
 			if err != nil {
 				return nil, err
 			}
@@ -240,19 +338,27 @@ func ExpressionToEvaluator(ast FlatExpression, reg udf.FunctionRegistry) (Evalua
 	case mapAST:
 		// compute child Evaluators
 		names := make([]string, len(obj.Entries))
+		keys := make([]Evaluator, len(obj.Entries))
 		evals := make([]Evaluator, len(obj.Entries))
 		for i, pair := range obj.Entries {
-			eval, err := ExpressionToEvaluator(pair.Value, reg)
+			eval, err := expressionToEvaluator(pair.Value, reg, ignoreCase)
 			if err != nil {
 				return nil, err
 			}
 			evals[i] = eval
 			names[i] = pair.Key
+			if pair.KeyExpr != nil {
+				key, err := expressionToEvaluator(pair.KeyExpr, reg, ignoreCase)
+				if err != nil {
+					return nil, err
+				}
+				keys[i] = key
+			}
 		}
-		return newMapBuilder(names, evals)
+		return newMapBuilder(names, keys, evals)
 	case caseAST:
 		// compute the Evaluator for the thing we match against
-		ref, err := ExpressionToEvaluator(obj.Reference, reg)
+		ref, err := expressionToEvaluator(obj.Reference, reg, ignoreCase)
 		if err != nil {
 			return nil, err
 		}
@@ -260,19 +366,19 @@ func ExpressionToEvaluator(ast FlatExpression, reg udf.FunctionRegistry) (Evalua
 		whens := make([]Evaluator, len(obj.Checks))
 		thens := make([]Evaluator, len(obj.Checks))
 		for i, pair := range obj.Checks {
-			eval, err := ExpressionToEvaluator(pair.When, reg)
+			eval, err := expressionToEvaluator(pair.When, reg, ignoreCase)
 			if err != nil {
 				return nil, err
 			}
 			whens[i] = eval
-			eval, err = ExpressionToEvaluator(pair.Then, reg)
+			eval, err = expressionToEvaluator(pair.Then, reg, ignoreCase)
 			if err != nil {
 				return nil, err
 			}
 			thens[i] = eval
 		}
 		// compute the Evaluator for the default value (if nothing matches)
-		def, err := ExpressionToEvaluator(obj.Default, reg)
+		def, err := expressionToEvaluator(obj.Default, reg, ignoreCase)
 		if err != nil {
 			return nil, err
 		}
@@ -337,6 +443,10 @@ func (s *stringConstant) Eval(input data.Value) (data.Value, error) {
 // JSON path.
 type pathAccess struct {
 	path data.Path
+	// relation is the alias of the input relation the path refers to.
+	// When the relation is padded with NULL by an outer join, the path
+	// evaluates to NULL.
+	relation string
 }
 
 func (fa *pathAccess) Eval(input data.Value) (data.Value, error) {
@@ -344,15 +454,29 @@ func (fa *pathAccess) Eval(input data.Value) (data.Value, error) {
 	if err != nil {
 		return nil, err
 	}
-	return aMap.Get(fa.path)
+	v, err := aMap.Get(fa.path)
+	if err != nil && fa.relation != "" {
+		if r, ok := aMap[fa.relation]; ok && r.Type() == data.TypeNull {
+			return data.Null{}, nil
+		}
+	}
+	return v, err
 }
 
-func newPathAccess(s string) (Evaluator, error) {
-	path, err := data.CompilePath(s)
+// newPathAccess creates a pathAccess for the given JSON Path. When
+// ignoreCase is true, keys are matched case-insensitively, which makes
+// lookups of keys not matching exactly slower (see
+// data.CompileCaseInsensitivePath).
+func newPathAccess(s string, ignoreCase bool) (Evaluator, error) {
+	compile := data.CompilePath
+	if ignoreCase {
+		compile = data.CompileCaseInsensitivePath
+	}
+	path, err := compile(s)
 	if err != nil {
 		return nil, err
 	}
-	return &pathAccess{path}, nil
+	return &pathAccess{path: path}, nil
 }
 
 type missingPathCheck struct {
@@ -376,7 +500,8 @@ func newMissingPathCheck(eval Evaluator, negate bool) (Evaluator, error) {
 	if !ok {
 		return nil, fmt.Errorf("expected pathAccess before IS [NOT] MISSING, not %v", eval)
 	}
-	return &missingPathCheck{*pa, negate}, nil
+	// a column of a relation padded with NULL is missing
+	return &missingPathCheck{pathAccess{path: pa.path}, negate}, nil
 }
 
 type typeCast struct {
@@ -452,6 +577,16 @@ func newTypeCast(e Evaluator, t parser.Type) (Evaluator, error) {
 			return data.Timestamp(x), nil
 		}
 		return &typeCast{e, conv}, nil
+	case parser.Array:
+		conv := func(v data.Value) (data.Value, error) {
+			return data.ToArray(v)
+		}
+		return &typeCast{e, conv}, nil
+	case parser.Map:
+		conv := func(v data.Value) (data.Value, error) {
+			return data.ToMap(v)
+		}
+		return &typeCast{e, conv}, nil
 	}
 	return nil, fmt.Errorf("no converter for type %s known", t)
 }
@@ -472,6 +607,36 @@ func (t *timestampCast) Eval(input data.Value) (data.Value, error) {
 	return val, nil
 }
 
+// timestampShift adds an interval to or subtracts it from a timestamp.
+type timestampShift struct {
+	ts       Evaluator
+	interval time.Duration
+	subtract bool
+}
+
+func (t *timestampShift) Eval(input data.Value) (data.Value, error) {
+	val, err := t.ts.Eval(input)
+	if err != nil {
+		return nil, err
+	}
+	// NULL propagation
+	if val.Type() == data.TypeNull {
+		return data.Null{}, nil
+	}
+	ts, err := data.AsTimestamp(val)
+	if err != nil {
+		verb := "add an interval to"
+		if t.subtract {
+			verb = "subtract an interval from"
+		}
+		return nil, fmt.Errorf("cannot %s %T", verb, val)
+	}
+	if t.subtract {
+		return data.Timestamp(ts.Add(-t.interval)), nil
+	}
+	return data.Timestamp(ts.Add(t.interval)), nil
+}
+
 type binOp struct {
 	left  Evaluator
 	right Evaluator
@@ -491,6 +656,11 @@ func (bo *binOp) evalLeftAndRight(input data.Value) (data.Value, data.Value, err
 
 /// Binary Logical Operations
 
+// or evaluates a logical OR. The right operand isn't evaluated when the left
+// operand is true because the result is true regardless of the right operand.
+// Otherwise, i.e. when the left operand is false or NULL, the right operand is
+// always evaluated. Therefore, an expensive or error-prone expression can be
+// guarded like `x IS NULL OR f(x)`.
 type or struct {
 	binOp
 }
@@ -553,6 +723,11 @@ func (o *or) Eval(input data.Value) (data.Value, error) {
 	}
 }
 
+// and evaluates a logical AND. The right operand isn't evaluated when the left
+// operand is false because the result is false regardless of the right
+// operand. Otherwise, i.e. when the left operand is true or NULL, the right
+// operand is always evaluated, so `x IS NOT NULL AND f(x)` never calls f with
+// NULL.
 type and struct {
 	binOp
 }
@@ -674,53 +849,55 @@ func newEqual(bo binOp) Evaluator {
 }
 
 func newLess(bo binOp) Evaluator {
-	cmpOp := func(leftVal data.Value, rightVal data.Value) (bool, error) {
-		leftType := leftVal.Type()
-		rightType := rightVal.Type()
-		stdErr := fmt.Errorf("cannot compare %T and %T", leftVal, rightVal)
-		if leftType == rightType {
-			retVal := false
-			switch leftType {
-			default:
-				return false, stdErr
-			case data.TypeInt:
-				l, _ := data.AsInt(leftVal)
-				r, _ := data.AsInt(rightVal)
-				retVal = l < r
-			case data.TypeFloat:
-				l, _ := data.AsFloat(leftVal)
-				r, _ := data.AsFloat(rightVal)
-				retVal = l < r
-			case data.TypeString:
-				l, _ := data.AsString(leftVal)
-				r, _ := data.AsString(rightVal)
-				retVal = l < r
-			case data.TypeBool:
-				l, _ := data.AsBool(leftVal)
-				r, _ := data.AsBool(rightVal)
-				retVal = (l == false) && (r == true)
-			case data.TypeTimestamp:
-				l, _ := data.AsTimestamp(leftVal)
-				r, _ := data.AsTimestamp(rightVal)
-				retVal = l.Before(r)
-			}
-			return retVal, nil
-		} else if leftType == data.TypeInt && rightType == data.TypeFloat {
-			// left is integer
+	return &compBinOp{bo, less}
+}
+
+// less returns true if leftVal is strictly less than rightVal.
+func less(leftVal data.Value, rightVal data.Value) (bool, error) {
+	leftType := leftVal.Type()
+	rightType := rightVal.Type()
+	stdErr := fmt.Errorf("cannot compare %T and %T", leftVal, rightVal)
+	if leftType == rightType {
+		retVal := false
+		switch leftType {
+		default:
+			return false, stdErr
+		case data.TypeInt:
 			l, _ := data.AsInt(leftVal)
-			// right is float; also convert left to float to avoid overflow
-			r, _ := data.AsFloat(rightVal)
-			return float64(l) < r, nil
-		} else if leftType == data.TypeFloat && rightType == data.TypeInt {
-			// left is float
-			l, _ := data.AsFloat(leftVal)
-			// right is int; convert right to float to avoid overflow
 			r, _ := data.AsInt(rightVal)
-			return l < float64(r), nil
-		}
-		return false, stdErr
+			retVal = l < r
+		case data.TypeFloat:
+			l, _ := data.AsFloat(leftVal)
+			r, _ := data.AsFloat(rightVal)
+			retVal = l < r
+		case data.TypeString:
+			l, _ := data.AsString(leftVal)
+			r, _ := data.AsString(rightVal)
+			retVal = l < r
+		case data.TypeBool:
+			l, _ := data.AsBool(leftVal)
+			r, _ := data.AsBool(rightVal)
+			retVal = (l == false) && (r == true)
+		case data.TypeTimestamp:
+			l, _ := data.AsTimestamp(leftVal)
+			r, _ := data.AsTimestamp(rightVal)
+			retVal = l.Before(r)
+		}
+		return retVal, nil
+	} else if leftType == data.TypeInt && rightType == data.TypeFloat {
+		// left is integer
+		l, _ := data.AsInt(leftVal)
+		// right is float; also convert left to float to avoid overflow
+		r, _ := data.AsFloat(rightVal)
+		return float64(l) < r, nil
+	} else if leftType == data.TypeFloat && rightType == data.TypeInt {
+		// left is float
+		l, _ := data.AsFloat(leftVal)
+		// right is int; convert right to float to avoid overflow
+		r, _ := data.AsInt(rightVal)
+		return l < float64(r), nil
 	}
-	return &compBinOp{bo, cmpOp}
+	return false, stdErr
 }
 
 func newLessOrEqual(bo binOp) Evaluator {
@@ -739,6 +916,174 @@ func newNotEqual(bo binOp) Evaluator {
 	return newNot(newEqual(bo))
 }
 
+func newContains(bo binOp) Evaluator {
+	cmpOp := func(leftVal data.Value, rightVal data.Value) (bool, error) {
+		arr, err := data.AsArray(leftVal)
+		if err != nil {
+			return false, fmt.Errorf("cannot check if %T contains %T", leftVal, rightVal)
+		}
+		for _, elem := range arr {
+			if data.Equal(elem, rightVal) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return &compBinOp{bo, cmpOp}
+}
+
+func newHasKey(bo binOp) Evaluator {
+	cmpOp := func(leftVal data.Value, rightVal data.Value) (bool, error) {
+		stdErr := fmt.Errorf("cannot check if %T has key %T", leftVal, rightVal)
+		m, err := data.AsMap(leftVal)
+		if err != nil {
+			return false, stdErr
+		}
+		key, err := data.AsString(rightVal)
+		if err != nil {
+			return false, stdErr
+		}
+		_, ok := m[key]
+		return ok, nil
+	}
+	return &compBinOp{bo, cmpOp}
+}
+
+func newIn(bo binOp) Evaluator {
+	cmpOp := func(leftVal data.Value, rightVal data.Value) (bool, error) {
+		arr, err := data.AsArray(rightVal)
+		if err != nil {
+			return false, fmt.Errorf("cannot check if %T is in %T", leftVal, rightVal)
+		}
+		for _, elem := range arr {
+			if data.Equal(leftVal, elem) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return &compBinOp{bo, cmpOp}
+}
+
+// between checks if a value lies in a closed interval. The right
+// operand is an array holding the lower and the upper bound.
+type between struct {
+	binOp
+}
+
+func (b *between) Eval(input data.Value) (data.Value, error) {
+	val, boundsVal, err := b.evalLeftAndRight(input)
+	if err != nil {
+		return nil, err
+	}
+	// NULL propagation
+	if val.Type() == data.TypeNull || boundsVal.Type() == data.TypeNull {
+		return data.Null{}, nil
+	}
+	bounds, err := data.AsArray(boundsVal)
+	if err != nil || len(bounds) != 2 {
+		return nil, fmt.Errorf("cannot use %T as bounds of BETWEEN", boundsVal)
+	}
+	lower, upper := bounds[0], bounds[1]
+	if lower.Type() == data.TypeNull || upper.Type() == data.TypeNull {
+		return data.Null{}, nil
+	}
+	if below, err := less(val, lower); err != nil {
+		return nil, err
+	} else if below {
+		return data.Bool(false), nil
+	}
+	above, err := less(upper, val)
+	if err != nil {
+		return nil, err
+	}
+	return data.Bool(!above), nil
+}
+
+func newBetween(bo binOp) Evaluator {
+	return &between{bo}
+}
+
+// maxCachedPatterns is the maximum number of compiled patterns that a
+// single pattern matching evaluator keeps.
+const maxCachedPatterns = 64
+
+// newPatternMatch creates an evaluator that matches a string on the left
+// side against a pattern on the right side. Compiled patterns are cached
+// in the evaluator, i.e., per execution plan, so that a constant pattern
+// is only compiled once.
+func newPatternMatch(bo binOp, verb string, compile func(string) (*regexp.Regexp, error)) Evaluator {
+	cache := map[string]*regexp.Regexp{}
+	cmpOp := func(leftVal data.Value, rightVal data.Value) (bool, error) {
+		stdErr := fmt.Errorf("cannot check if %T %s %T", leftVal, verb, rightVal)
+		str, err := data.AsString(leftVal)
+		if err != nil {
+			return false, stdErr
+		}
+		pattern, err := data.AsString(rightVal)
+		if err != nil {
+			return false, stdErr
+		}
+		re, ok := cache[pattern]
+		if !ok {
+			re, err = compile(pattern)
+			if err != nil {
+				return false, err
+			}
+			if len(cache) >= maxCachedPatterns {
+				cache = map[string]*regexp.Regexp{}
+			}
+			cache[pattern] = re
+		}
+		return re.MatchString(str), nil
+	}
+	return &compBinOp{bo, cmpOp}
+}
+
+// newLike creates an evaluator for `str LIKE pattern`. In the pattern,
+// '%' matches any sequence of characters and '_' matches any single
+// character. They can be escaped with the escape character, which is a
+// backslash unless ESCAPE is given. The pattern has to match the whole
+// string.
+func newLike(bo binOp, escape rune) Evaluator {
+	return newPatternMatch(bo, "is like", func(pattern string) (*regexp.Regexp, error) {
+		return likePatternToRegexp(pattern, escape)
+	})
+}
+
+func likePatternToRegexp(pattern string, escape rune) (*regexp.Regexp, error) {
+	expr := []string{"(?s)^"}
+	escaped := false
+	for _, r := range pattern {
+		if escaped {
+			expr = append(expr, regexp.QuoteMeta(string(r)))
+			escaped = false
+			continue
+		}
+		switch r {
+		case escape:
+			escaped = true
+		case '%':
+			expr = append(expr, ".*")
+		case '_':
+			expr = append(expr, ".")
+		default:
+			expr = append(expr, regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("LIKE pattern must not end with an escape character: %s", pattern)
+	}
+	expr = append(expr, "$")
+	return regexp.Compile(strings.Join(expr, ""))
+}
+
+// newRegexpMatch creates an evaluator for `str =~ regexp`. The string
+// matches if any part of it matches the regular expression.
+func newRegexpMatch(bo binOp) Evaluator {
+	return newPatternMatch(bo, "matches", regexp.Compile)
+}
+
 /// A Unary Comparison Operation
 
 type isNull struct {
@@ -967,7 +1312,13 @@ type sortEvaluator struct {
 type sortedInputAggFuncApp struct {
 	f         Evaluator
 	inOutKeys map[string]string
-	ordering  []sortEvaluator
+	// keys has the keys of inOutKeys in a fixed order
+	keys     []string
+	ordering []sortEvaluator
+	distinct bool
+	// filter evaluates to the array of the results of the FILTER
+	// condition. It's nil when there's no FILTER clause.
+	filter Evaluator
 }
 
 func (s *sortedInputAggFuncApp) Eval(input data.Value) (v data.Value, err error) {
@@ -982,10 +1333,25 @@ func (s *sortedInputAggFuncApp) Eval(input data.Value) (v data.Value, err error)
 	if err != nil {
 		return nil, err
 	}
-	// extract the arrays that contain the data that the sort is based on
-	if len(s.ordering) == 0 {
+	if len(s.ordering) == 0 && !s.distinct && s.filter == nil {
 		return nil, fmt.Errorf("order definition must not be empty")
 	}
+
+	// extract the arrays that contain the aggregated data
+	unsortedArrs := make([]data.Array, len(s.keys))
+	for i, unsortedKey := range s.keys {
+		unsortedData, ok := inputMap[unsortedKey]
+		if !ok {
+			return nil, fmt.Errorf("there was no unsorted data with key '%s'", unsortedKey)
+		}
+		unsortedArr, err := data.AsArray(unsortedData)
+		if err != nil {
+			return nil, err
+		}
+		unsortedArrs[i] = unsortedArr
+	}
+
+	// extract the arrays that contain the data that the sort is based on
 	sortData := make([]sortArray, len(s.ordering))
 	for i, sortEval := range s.ordering {
 		val, err := sortEval.eval.Eval(input)
@@ -1001,39 +1367,132 @@ func (s *sortedInputAggFuncApp) Eval(input data.Value) (v data.Value, err error)
 
 	// sort an array of indexes, then write the actual data to a new array
 	// using the sorted index array
-	indexes := make([]int, len(sortData[0].values))
+	n := 0
+	if len(sortData) > 0 {
+		n = len(sortData[0].values)
+	} else if len(unsortedArrs) > 0 {
+		n = len(unsortedArrs[0])
+	}
+	for i, unsortedArr := range unsortedArrs {
+		if len(unsortedArr) != n {
+			return nil, fmt.Errorf("aggregate data with key '%s' had bad length (%d, not %d)",
+				s.keys[i], len(unsortedArr), n)
+		}
+	}
+	indexes := make([]int, n)
 	for i := range indexes {
 		indexes[i] = i
 	}
+	// only keep the indexes of rows satisfying the FILTER condition
+	if s.filter != nil {
+		val, err := s.filter.Eval(input)
+		if err != nil {
+			return nil, fmt.Errorf("could not get data for filtering: %s", err.Error())
+		}
+		conds, err := data.AsArray(val)
+		if err != nil {
+			return nil, err
+		}
+		if len(conds) != n {
+			return nil, fmt.Errorf("filter data had bad length (%d, not %d)", len(conds), n)
+		}
+		indexes, err = filterIndexes(indexes, conds)
+		if err != nil {
+			return nil, err
+		}
+		for i := range sortData {
+			sortData[i].values = filterValues(sortData[i].values, indexes)
+		}
+		for i := range unsortedArrs {
+			unsortedArrs[i] = filterValues(unsortedArrs[i], indexes)
+		}
+		n = len(indexes)
+		for i := range indexes {
+			indexes[i] = i
+		}
+	}
 	// sort the index array
-	is := &indexSlice{indexes, sortData}
-	sort.Sort(is)
+	if len(sortData) > 0 {
+		is := &indexSlice{indexes, sortData}
+		sort.Sort(is)
+	}
+	// only keep the first index of each distinct combination of values
+	if s.distinct {
+		indexes = distinctIndexes(indexes, unsortedArrs)
+	}
 
 	// now use the sorted index array to write a sorted copy of the data
-	for unsortedKey, sortedKey := range s.inOutKeys {
-		unsortedData, ok := inputMap[unsortedKey]
-		if !ok {
-			return nil, fmt.Errorf("there was no unsorted data with key '%s'", unsortedKey)
+	for i, unsortedKey := range s.keys {
+		unsortedArr := unsortedArrs[i]
+		sortedArr := make(data.Array, len(indexes))
+		for j, idx := range indexes {
+			sortedArr[j] = unsortedArr[idx]
 		}
-		unsortedArr, err := data.AsArray(unsortedData)
+		inputMap[s.inOutKeys[unsortedKey]] = sortedArr
+	}
+
+	return s.f.Eval(input)
+}
+
+// distinctIndexes removes indexes pointing to a combination of values
+// in arrs that has already appeared at a former index. The order of
+// indexes is preserved.
+func distinctIndexes(indexes []int, arrs []data.Array) []int {
+	seen := map[data.HashValue][]data.Value{}
+	result := make([]int, 0, len(indexes))
+	for _, idx := range indexes {
+		row := make(data.Array, len(arrs))
+		for i, arr := range arrs {
+			row[i] = arr[idx]
+		}
+		h := data.Hash(row)
+		dup := false
+		for _, v := range seen[h] {
+			if data.Equal(v, row) {
+				dup = true
+				break
+			}
+		}
+		if dup {
+			continue
+		}
+		seen[h] = append(seen[h], row)
+		result = append(result, idx)
+	}
+	return result
+}
+
+// filterIndexes returns the indexes at which conds has true. A NULL
+// condition is regarded as false.
+func filterIndexes(indexes []int, conds data.Array) ([]int, error) {
+	result := make([]int, 0, len(indexes))
+	for _, idx := range indexes {
+		c := conds[idx]
+		if c.Type() == data.TypeNull {
+			continue
+		}
+		b, err := data.AsBool(c)
 		if err != nil {
 			return nil, err
 		}
-		if len(unsortedArr) != len(indexes) {
-			return nil, fmt.Errorf("aggregate data with key '%s' had bad length (%d, not %d)",
-				unsortedKey, len(unsortedArr), len(indexes))
-		}
-		sortedArr := make(data.Array, len(unsortedArr))
-		for i := range unsortedArr {
-			sortedArr[i] = unsortedArr[indexes[i]]
+		if b {
+			result = append(result, idx)
 		}
-		inputMap[sortedKey] = sortedArr
 	}
+	return result, nil
+}
 
-	return s.f.Eval(input)
+// filterValues returns the values of arr at the given indexes.
+func filterValues(arr data.Array, indexes []int) data.Array {
+	result := make(data.Array, len(indexes))
+	for i, idx := range indexes {
+		result[i] = arr[idx]
+	}
+	return result
 }
 
-func newSortedInputAggFuncApp(obj funcAppAST, id string, ordering []sortExpression, reg udf.FunctionRegistry) (Evaluator, error) {
+func newSortedInputAggFuncApp(a aggregateInputSorter, reg udf.FunctionRegistry, ignoreCase bool) (Evaluator, error) {
+	obj, id, ordering, distinct := a.funcAppAST, a.ID, a.Ordering, a.Distinct
 	// We may have a function call as complex as
 	//  f(a, b, c ORDER BY d ASC, e DESC)
 	// where a and c are aggregate parameters but b is not.
@@ -1067,13 +1526,28 @@ func newSortedInputAggFuncApp(obj funcAppAST, id string, ordering []sortExpressi
 	//    and obj.Expressions[2] to use these sorted versions.
 	// The second approach may not provide optimal performance, but it
 	// avoids weird side effects when using multiple aggregates.
-
-	if len(ordering) == 0 {
+	//
+	// If distinct is true, the copied arrays only contain the first
+	// occurrence of each combination of aggregate parameter values,
+	// e.g., f(DISTINCT a, c) would be called with g_ahash_abc and
+	// g_chash_abc not having duplicated pairs of a and c. Similarly,
+	// with a FILTER clause, the copied arrays only contain the values
+	// of rows for which the condition is true.
+
+	if len(ordering) == 0 && !distinct && a.Filter == nil {
 		return nil, fmt.Errorf("order definition must not be empty")
 	}
+	var filter Evaluator
+	if a.Filter != nil {
+		e, err := expressionToEvaluator(*a.Filter, reg, ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		filter = e
+	}
 	sortEvals := make([]sortEvaluator, len(ordering))
 	for i, sortExpr := range ordering {
-		e, err := ExpressionToEvaluator(sortExpr.Value, reg)
+		e, err := expressionToEvaluator(sortExpr.Value, reg, ignoreCase)
 		if err != nil {
 			return nil, err
 		}
@@ -1090,14 +1564,18 @@ func newSortedInputAggFuncApp(obj funcAppAST, id string, ordering []sortExpressi
 	}
 	// compute child Evaluators
 	inOutKeys := map[string]string{}
+	keys := []string{}
 	evals := make([]Evaluator, len(obj.Expressions))
 	for i, ast := range obj.Expressions {
 		if inputRef, ok := ast.(aggInputRef); ok {
 			newRef := inputRef.Ref + "_" + id
 			ast = aggInputRef{newRef}
+			if _, ok := inOutKeys[inputRef.Ref]; !ok {
+				keys = append(keys, inputRef.Ref)
+			}
 			inOutKeys[inputRef.Ref] = newRef
 		}
-		eval, err := ExpressionToEvaluator(ast, reg)
+		eval, err := expressionToEvaluator(ast, reg, ignoreCase)
 		if err != nil {
 			return nil, err
 		}
@@ -1105,7 +1583,7 @@ func newSortedInputAggFuncApp(obj funcAppAST, id string, ordering []sortExpressi
 	}
 	backendFun := FuncApp(fName, f, reg.Context(), evals)
 
-	return &sortedInputAggFuncApp{backendFun, inOutKeys, sortEvals}, nil
+	return &sortedInputAggFuncApp{backendFun, inOutKeys, keys, sortEvals, distinct, filter}, nil
 }
 
 /// JSON-like data structures
@@ -1131,8 +1609,12 @@ func newArrayBuilder(elems []Evaluator) Evaluator {
 	return &arrayBuilder{elems}
 }
 
+// mapBuilder builds a map from its entries. The key of the i-th entry is
+// computed by keys[i] when it isn't nil, and is names[i] otherwise. When
+// multiple entries have the same key, the last one is used.
 type mapBuilder struct {
 	names []string
+	keys  []Evaluator
 	elems []Evaluator
 }
 
@@ -1140,20 +1622,33 @@ func (m *mapBuilder) Eval(input data.Value) (v data.Value, err error) {
 	results := make(data.Map, len(m.elems))
 	// evaluate all the parameters and store the results
 	for i, elem := range m.elems {
+		name := m.names[i]
+		if k := m.keys[i]; k != nil {
+			key, err := k.Eval(input)
+			if err != nil {
+				return nil, err
+			}
+			// other types including NULL aren't converted to a string
+			// implicitly so that a wrong key doesn't go unnoticed
+			if key.Type() != data.TypeString {
+				return nil, fmt.Errorf("a computed map key must be a string: %v", key)
+			}
+			name, _ = data.AsString(key)
+		}
 		value, err := elem.Eval(input)
 		if err != nil {
 			return nil, err
 		}
-		results[m.names[i]] = value
+		results[name] = value
 	}
 	return results, nil
 }
 
-func newMapBuilder(names []string, elems []Evaluator) (Evaluator, error) {
-	if len(names) != len(elems) {
+func newMapBuilder(names []string, keys []Evaluator, elems []Evaluator) (Evaluator, error) {
+	if len(names) != len(elems) || len(keys) != len(elems) {
 		return nil, fmt.Errorf("number of keys and values does not match")
 	}
-	return &mapBuilder{names, elems}, nil
+	return &mapBuilder{names, keys, elems}, nil
 }
 
 // CASE statement
@@ -1215,6 +1710,10 @@ func (w *wildcard) Eval(input data.Value) (data.Value, error) {
 		if !exists {
 			return nil, fmt.Errorf("there is no entry with key '%s'", w.Relation)
 		}
+		if subElement.Type() == data.TypeNull {
+			// padded with NULL by an outer join
+			return output, nil
+		}
 		subMap, err := data.AsMap(subElement)
 		if err != nil {
 			return nil, err
@@ -1225,7 +1724,7 @@ func (w *wildcard) Eval(input data.Value) (data.Value, error) {
 	} else {
 		// if we have *, take items from all submaps
 		for alias, subElement := range aMap {
-			if strings.Contains(alias, ":meta:") {
+			if strings.Contains(alias, ":meta:") || subElement.Type() == data.TypeNull {
 				continue
 			}
 			subMap, err := data.AsMap(subElement)
@@ -70,6 +70,10 @@ func TestFoldableExecution(t *testing.T) {
 			true, data.Bool(true)},
 		{parser.StringLiteral{"foo"},
 			true, data.String("foo")},
+		{parser.BinaryOpAST{parser.Plus,
+			parser.TypeCastAST{parser.StringLiteral{"2015-04-10T10:23:00Z"}, parser.Timestamp},
+			parser.IntervalLiteral{90*time.Minute + time.Nanosecond}},
+			true, data.Timestamp(time.Date(2015, time.April, 10, 11, 53, 0, 1, time.UTC))},
 		// Access to column data should always be false
 		{parser.RowMeta{"s", parser.TimestampMeta},
 			false, nil},
@@ -131,21 +135,25 @@ func TestFoldableExecution(t *testing.T) {
 		{parser.TypeCastAST{parser.NumericLiteral{7}, parser.Float},
 			true, data.Float(7.0)},
 		{parser.FuncAppAST{parser.FuncName("now"),
-			parser.ExpressionsAST{[]parser.Expression{}}, nil},
+			parser.ExpressionsAST{[]parser.Expression{}}, nil, false, nil},
 			false, nil},
 		{parser.FuncAppAST{parser.FuncName("plusone"),
-			parser.ExpressionsAST{[]parser.Expression{parser.RowValue{"", "a"}}}, nil},
+			parser.ExpressionsAST{[]parser.Expression{parser.RowValue{"", "a"}}}, nil, false, nil},
 			false, nil},
 		{parser.FuncAppAST{parser.FuncName("plusone"),
-			parser.ExpressionsAST{[]parser.Expression{parser.NumericLiteral{7}}}, nil},
+			parser.ExpressionsAST{[]parser.Expression{parser.NumericLiteral{7}}}, nil, false, nil},
 			true, data.Int(8)},
 		{parser.ArrayAST{parser.ExpressionsAST{[]parser.Expression{parser.RowValue{"", "a"}}}},
 			false, nil},
 		{parser.ArrayAST{parser.ExpressionsAST{[]parser.Expression{parser.NumericLiteral{7}}}},
 			true, data.Array{data.Int(7)}},
-		{parser.MapAST{[]parser.KeyValuePairAST{{"a", parser.RowValue{"", "a"}}}},
+		{parser.MapAST{[]parser.KeyValuePairAST{{"a", parser.RowValue{"", "a"}, nil}}},
 			false, nil},
-		{parser.MapAST{[]parser.KeyValuePairAST{{"a", parser.NumericLiteral{7}}}},
+		{parser.MapAST{[]parser.KeyValuePairAST{{"a", parser.NumericLiteral{7}, nil}}},
+			true, data.Map{"a": data.Int(7)}},
+		{parser.MapAST{[]parser.KeyValuePairAST{{"", parser.NumericLiteral{7}, parser.RowValue{"", "a"}}}},
+			false, nil},
+		{parser.MapAST{[]parser.KeyValuePairAST{{"", parser.NumericLiteral{7}, parser.StringLiteral{"a"}}}},
 			true, data.Map{"a": data.Int(7)}},
 		{parser.ExpressionCaseAST{parser.RowValue{"", "a"}, parser.ConditionCaseAST{[]parser.WhenThenPairAST{
 			{parser.NumericLiteral{2}, parser.NumericLiteral{3}}}, parser.NullLiteral{}}},
@@ -220,6 +228,146 @@ func TestFoldableExecution(t *testing.T) {
 	}
 }
 
+func TestIntervalArithmetic(t *testing.T) {
+	reg := &testFuncRegistry{ctx: core.NewContext(nil)}
+	ts := time.Date(2015, time.April, 10, 10, 23, 0, 0, time.UTC)
+
+	Convey("Given expressions adding intervals to a timestamp", t, func() {
+		for expr, expected := range map[string]time.Time{
+			"a + INTERVAL 90 MINUTES":                         ts.Add(90 * time.Minute),
+			"INTERVAL 1 DAY + a":                              ts.AddDate(0, 0, 1),
+			`a - INTERVAL "1 02:03:04.5" DAY TO SECOND`:       ts.Add(-(26*time.Hour + 3*time.Minute + 4500*time.Millisecond)),
+			"a + INTERVAL 1 HOUR - INTERVAL 250 MILLISECONDS": ts.Add(time.Hour - 250*time.Millisecond),
+			"a - INTERVAL 1.000000001 SECONDS":                ts.Add(-time.Second - time.Nanosecond),
+			"n + INTERVAL 1 HOUR":                             time.Time{},
+		} {
+			expr, expected := expr, expected
+
+			Convey("When evaluating "+expr, func() {
+				stmt, _, err := parser.New().ParseStmt("EVAL " + expr)
+				So(err, ShouldBeNil)
+				flatExpr, err := ParserExprToFlatExpr(stmt.(parser.EvalStmt).Expr, reg)
+				So(err, ShouldBeNil)
+				eval, err := ExpressionToEvaluator(flatExpr, reg)
+				So(err, ShouldBeNil)
+				actual, err := eval.Eval(data.Map{"a": data.Timestamp(ts), "n": data.Null{}})
+
+				Convey("Then the result should be the shifted timestamp", func() {
+					So(err, ShouldBeNil)
+					if expected.IsZero() {
+						So(actual, ShouldResemble, data.Null{})
+					} else {
+						So(actual, ShouldResemble, data.Timestamp(expected))
+					}
+				})
+			})
+		}
+	})
+
+	Convey("Given expressions using intervals without a timestamp", t, func() {
+		for _, expr := range []string{
+			"INTERVAL 90 MINUTES",
+			"INTERVAL 1 HOUR - a",
+			"a * INTERVAL 1 HOUR",
+			"INTERVAL 1 HOUR + INTERVAL 1 HOUR",
+		} {
+			expr := expr
+
+			Convey("When converting "+expr+" to an evaluator", func() {
+				stmt, _, err := parser.New().ParseStmt("EVAL " + expr)
+				So(err, ShouldBeNil)
+				flatExpr, err := ParserExprToFlatExpr(stmt.(parser.EvalStmt).Expr, reg)
+				So(err, ShouldBeNil)
+				_, err = ExpressionToEvaluator(flatExpr, reg)
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+
+		for _, expr := range []string{
+			"i + INTERVAL 1 HOUR",
+			"a + i",
+		} {
+			expr := expr
+
+			Convey("When evaluating "+expr, func() {
+				stmt, _, err := parser.New().ParseStmt("EVAL " + expr)
+				So(err, ShouldBeNil)
+				flatExpr, err := ParserExprToFlatExpr(stmt.(parser.EvalStmt).Expr, reg)
+				So(err, ShouldBeNil)
+				eval, err := ExpressionToEvaluator(flatExpr, reg)
+				So(err, ShouldBeNil)
+				_, err = eval.Eval(data.Map{"a": data.Timestamp(ts), "i": data.Int(5400)})
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
+
+func TestShortCircuitEvaluation(t *testing.T) {
+	reg := &testFuncRegistry{ctx: core.NewContext(nil)}
+	a := parser.RowValue{"", "a"}
+	fail := parser.FuncAppAST{parser.FuncName("fail"),
+		parser.ExpressionsAST{[]parser.Expression{a}}, nil, false, nil}
+	aIsNotNull := parser.BinaryOpAST{parser.IsNot, a, parser.NullLiteral{}}
+	aIsNull := parser.BinaryOpAST{parser.Is, a, parser.NullLiteral{}}
+
+	testCases := []struct {
+		title    string
+		ast      parser.Expression
+		input    data.Map
+		expected data.Value // nil when the right operand must be evaluated
+	}{
+		{"false AND fail(a)", parser.BinaryOpAST{parser.And, a, fail},
+			data.Map{"a": data.False}, data.False},
+		{"a IS NOT NULL AND fail(a)", parser.BinaryOpAST{parser.And, aIsNotNull, fail},
+			data.Map{"a": data.Null{}}, data.False},
+		{"true OR fail(a)", parser.BinaryOpAST{parser.Or, a, fail},
+			data.Map{"a": data.True}, data.True},
+		{"a IS NULL OR fail(a)", parser.BinaryOpAST{parser.Or, aIsNull, fail},
+			data.Map{"a": data.Null{}}, data.True},
+		{"true AND fail(a)", parser.BinaryOpAST{parser.And, a, fail},
+			data.Map{"a": data.True}, nil},
+		{"NULL AND fail(a)", parser.BinaryOpAST{parser.And, a, fail},
+			data.Map{"a": data.Null{}}, nil},
+		{"false OR fail(a)", parser.BinaryOpAST{parser.Or, a, fail},
+			data.Map{"a": data.False}, nil},
+		{"NULL OR fail(a)", parser.BinaryOpAST{parser.Or, a, fail},
+			data.Map{"a": data.Null{}}, nil},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		Convey(fmt.Sprintf("Given %v", tc.title), t, func() {
+			flatExpr, err := ParserExprToFlatExpr(tc.ast, reg)
+			So(err, ShouldBeNil)
+			eval, err := ExpressionToEvaluator(flatExpr, reg)
+			So(err, ShouldBeNil)
+
+			Convey("When evaluating it", func() {
+				actual, err := eval.Eval(tc.input)
+
+				if tc.expected != nil {
+					Convey("Then the right operand should be skipped", func() {
+						So(err, ShouldBeNil)
+						So(actual, ShouldResemble, tc.expected)
+					})
+				} else {
+					Convey("Then the right operand should be evaluated", func() {
+						So(err, ShouldNotBeNil)
+						So(err.Error(), ShouldContainSubstring, "must not be evaluated")
+					})
+				}
+			})
+		})
+	}
+}
+
 func TestFuncAppConversion(t *testing.T) {
 	Convey("Given a function registry", t, func() {
 		reg := &testFuncRegistry{ctx: core.NewContext(nil)}
@@ -228,7 +376,7 @@ func TestFuncAppConversion(t *testing.T) {
 			ast := parser.FuncAppAST{parser.FuncName("plusone"),
 				parser.ExpressionsAST{[]parser.Expression{
 					parser.RowValue{"", "a"},
-				}}, nil}
+				}}, nil, false, nil}
 
 			Convey("Then we obtain an evaluatable funcApp", func() {
 				flatExpr, err := ParserExprToFlatExpr(ast, reg)
@@ -243,7 +391,7 @@ func TestFuncAppConversion(t *testing.T) {
 			ast := parser.FuncAppAST{parser.FuncName("fun"),
 				parser.ExpressionsAST{[]parser.Expression{
 					parser.RowValue{"", "a"},
-				}}, nil}
+				}}, nil, false, nil}
 
 			Convey("Then converting to an Evaluator fails", func() {
 				// we cannot even get the flat expression in that case
@@ -257,7 +405,7 @@ func TestFuncAppConversion(t *testing.T) {
 				parser.ExpressionsAST{[]parser.Expression{
 					parser.RowValue{"", "a"},
 				}},
-				[]parser.SortedExpressionAST{{parser.RowValue{"", "a"}, parser.Yes}}}
+				[]parser.SortedExpressionAST{{parser.RowValue{"", "a"}, parser.Yes}}, false, nil}
 
 			Convey("Then converting to an Evaluator fails", func() {
 				// we cannot even get the flat expression in that case
@@ -268,9 +416,23 @@ func TestFuncAppConversion(t *testing.T) {
 			})
 		})
 
+		Convey("When the function uses DISTINCT", func() {
+			ast := parser.FuncAppAST{parser.FuncName("plusone"),
+				parser.ExpressionsAST{[]parser.Expression{
+					parser.RowValue{"", "a"},
+				}}, nil, true, nil}
+
+			Convey("Then converting to an Evaluator fails", func() {
+				_, err := ParserExprToFlatExpr(ast, reg)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual,
+					"you cannot use DISTINCT in non-aggregate function 'plusone'")
+			})
+		})
+
 		Convey("When the now() function is used", func() {
 			ast := parser.FuncAppAST{parser.FuncName("now"),
-				parser.ExpressionsAST{[]parser.Expression{}}, nil}
+				parser.ExpressionsAST{[]parser.Expression{}}, nil, false, nil}
 
 			Convey("Then we obtain an evaluatable timestampCast", func() {
 				flatExpr, err := ParserExprToFlatExpr(ast, reg)
@@ -304,6 +466,8 @@ func TestAggFuncAppConversion(t *testing.T) {
 				funcAppAST{"array_agg", []FlatExpression{aggInputRef{"g_f12cd6bc"}}},
 				[]sortExpression{sortExpression{aggInputRef{"g_f12cd6bc"}, true}},
 				"ccd0ef22",
+				false,
+				nil,
 			},
 			map[string]FlatExpression{
 				"g_f12cd6bc": rowValue{"x", "a"},
@@ -331,6 +495,8 @@ func TestAggFuncAppConversion(t *testing.T) {
 				funcAppAST{"array_agg", []FlatExpression{aggInputRef{"g_f12cd6bc"}}},
 				[]sortExpression{sortExpression{aggInputRef{"g_77d2dd39"}, false}},
 				"d7196f56",
+				false,
+				nil,
 			},
 			map[string]FlatExpression{
 				"g_f12cd6bc": rowValue{"x", "a"},
@@ -370,6 +536,8 @@ func TestAggFuncAppConversion(t *testing.T) {
 				[]sortExpression{sortExpression{aggInputRef{"g_77d2dd39"}, false},
 					sortExpression{aggInputRef{"g_f12cd6bc"}, true}},
 				"24925706",
+				false,
+				nil,
 			},
 			map[string]FlatExpression{
 				"g_f12cd6bc": rowValue{"x", "a"},
@@ -408,7 +576,7 @@ func TestAggFuncAppConversion(t *testing.T) {
 							[]FlatExpression{aggInputRef{Ref: "g_f12cd6bc"}}},
 						[]sortExpression{sortExpression{aggInputRef{"g_77d2dd39"},
 							false}},
-						"d7196f56"},
+						"d7196f56", false, nil},
 					parser.String},
 				typeCastAST{
 					aggregateInputSorter{
@@ -416,7 +584,7 @@ func TestAggFuncAppConversion(t *testing.T) {
 							[]FlatExpression{aggInputRef{Ref: "g_f12cd6bc"}}},
 						[]sortExpression{sortExpression{aggInputRef{"g_77d2dd39"},
 							true}},
-						"cd35e18d"},
+						"cd35e18d", false, nil},
 					parser.String},
 			},
 			map[string]FlatExpression{
@@ -444,12 +612,59 @@ func TestAggFuncAppConversion(t *testing.T) {
 			},
 		},
 
+		// remove duplicated values
+		{"array_agg(DISTINCT a) FROM x [RANGE 1 TUPLES]", "",
+			aggregateInputSorter{
+				funcAppAST{"array_agg", []FlatExpression{aggInputRef{"g_f12cd6bc"}}},
+				[]sortExpression{},
+				"ca62518a",
+				true,
+				nil,
+			},
+			map[string]FlatExpression{
+				"g_f12cd6bc": rowValue{"x", "a"},
+			},
+			[]evalTest{
+				// not a map:
+				{data.Int(17), nil},
+				// map does not contain the correct key
+				{data.Map{"a": data.Array{data.Int(1), data.Int(2)}}, nil},
+				// correct input
+				{data.Map{"g_f12cd6bc": data.Array{data.Int(2), data.Int(1), data.Int(2),
+					data.Float(1.0), data.Null{}, data.Null{}}},
+					data.Array{data.Int(2), data.Int(1), data.Null{}}},
+			},
+		},
+
+		// remove duplicated values after sorting
+		{"array_agg(DISTINCT a ORDER BY b DESC) FROM x [RANGE 1 TUPLES]", "",
+			aggregateInputSorter{
+				funcAppAST{"array_agg", []FlatExpression{aggInputRef{"g_f12cd6bc"}}},
+				[]sortExpression{sortExpression{aggInputRef{"g_77d2dd39"}, false}},
+				"f8273243",
+				true,
+				nil,
+			},
+			map[string]FlatExpression{
+				"g_f12cd6bc": rowValue{"x", "a"},
+				"g_77d2dd39": rowValue{"x", "b"},
+			},
+			[]evalTest{
+				// correct input
+				{data.Map{"g_f12cd6bc": data.Array{data.Int(1), data.Int(2), data.Int(1)},
+					"g_77d2dd39": data.Array{data.Int(3), data.Int(4), data.Int(5)}},
+					data.Array{data.Int(1), data.Int(2)}},
+			},
+		},
+
 		// order by a volatile expression
 		{"array_agg(f(a) ORDER BY f(a)) FROM x [RANGE 1 TUPLES] GROUP BY a", "",
 			aggregateInputSorter{
 				funcAppAST{"array_agg", []FlatExpression{aggInputRef{"g_2523c3a2_0"}}},
 				[]sortExpression{sortExpression{aggInputRef{"g_2523c3a2_1"}, true}},
 				"cf2e24d7",
+				false,
+				nil,
 			},
 			map[string]FlatExpression{
 				"g_2523c3a2_0": funcAppAST{"f", []FlatExpression{rowValue{"x", "a"}}},
@@ -554,6 +769,12 @@ var (
 		}
 		return data.Int(len(m)), nil
 	})
+
+	// Fail always returns an error. It's used to check that an operand isn't
+	// evaluated.
+	Fail = udf.UnaryFunc(func(ctx *core.Context, v data.Value) (data.Value, error) {
+		return nil, fmt.Errorf("fail(%v) must not be evaluated", v)
+	})
 )
 
 // testFuncRegistry returns the PlusOne function above for any parameter.
@@ -570,6 +791,8 @@ func (tfr *testFuncRegistry) Lookup(name string, arity int) (udf.UDF, error) {
 		return PlusOne, nil
 	} else if name == "maplen" && arity == 1 {
 		return MapLen, nil
+	} else if name == "fail" && arity == 1 {
+		return Fail, nil
 	}
 	return nil, fmt.Errorf("no such function: %s", name)
 }
@@ -1422,6 +1645,260 @@ func getTestCases() []struct {
 					"b": data.String("b")}, data.String("ab")},
 			}, nullOps...),
 		},
+		// Contains
+		{parser.BinaryOpAST{parser.Contains, parser.RowValue{"", "a"}, parser.RowValue{"", "b"}},
+			append([]evalTest{
+				// not a map:
+				{data.Int(17), nil},
+				// keys not present:
+				{data.Map{"x": data.Int(17)}, nil},
+				// only left present => error
+				{data.Map{"a": data.Array{data.Int(2)}}, nil},
+				// only right present => error
+				{data.Map{"b": data.Int(2)}, nil},
+				// left is not an array => error
+				{data.Map{"a": data.Int(2),
+					"b": data.Int(2)}, nil},
+				{data.Map{"a": data.String("hoge"),
+					"b": data.String("h")}, nil},
+				{data.Map{"a": data.Map{"b": data.Int(2)},
+					"b": data.String("b")}, nil},
+				// left contains right => true
+				{data.Map{"a": data.Array{data.Int(1), data.Int(2)},
+					"b": data.Int(2)}, data.Bool(true)},
+				{data.Map{"a": data.Array{data.Int(1), data.Int(2)},
+					"b": data.Float(2.0)}, data.Bool(true)},
+				{data.Map{"a": data.Array{data.String("hoge"), data.Int(2)},
+					"b": data.String("hoge")}, data.Bool(true)},
+				{data.Map{"a": data.Array{data.Array{data.Int(2)}},
+					"b": data.Array{data.Int(2)}}, data.Bool(true)},
+				// left doesn't contain right => false
+				{data.Map{"a": data.Array{data.Int(1), data.Int(2)},
+					"b": data.Int(3)}, data.Bool(false)},
+				{data.Map{"a": data.Array{data.Int(1), data.Int(2)},
+					"b": data.String("1")}, data.Bool(false)},
+				{data.Map{"a": data.Array{data.Array{data.Int(2)}},
+					"b": data.Int(2)}, data.Bool(false)},
+				{data.Map{"a": data.Array{},
+					"b": data.Int(2)}, data.Bool(false)},
+			}, nullOps...),
+		},
+		// HasKey
+		{parser.BinaryOpAST{parser.HasKey, parser.RowValue{"", "a"}, parser.RowValue{"", "b"}},
+			append([]evalTest{
+				// not a map:
+				{data.Int(17), nil},
+				// keys not present:
+				{data.Map{"x": data.Int(17)}, nil},
+				// only left present => error
+				{data.Map{"a": data.Map{"b": data.Int(2)}}, nil},
+				// only right present => error
+				{data.Map{"b": data.String("b")}, nil},
+				// left is not a map or right is not a string => error
+				{data.Map{"a": data.Array{data.String("b")},
+					"b": data.String("b")}, nil},
+				{data.Map{"a": data.String("b"),
+					"b": data.String("b")}, nil},
+				{data.Map{"a": data.Map{"1": data.Int(2)},
+					"b": data.Int(1)}, nil},
+				// left has right as a key => true
+				{data.Map{"a": data.Map{"b": data.Int(2)},
+					"b": data.String("b")}, data.Bool(true)},
+				{data.Map{"a": data.Map{"b": data.Null{}},
+					"b": data.String("b")}, data.Bool(true)},
+				// left doesn't have right as a key => false
+				{data.Map{"a": data.Map{"b": data.Int(2)},
+					"b": data.String("c")}, data.Bool(false)},
+				{data.Map{"a": data.Map{"b": data.Map{"c": data.Int(2)}},
+					"b": data.String("c")}, data.Bool(false)},
+				{data.Map{"a": data.Map{},
+					"b": data.String("b")}, data.Bool(false)},
+			}, nullOps...),
+		},
+		// In
+		{parser.BinaryOpAST{parser.In, parser.RowValue{"", "a"}, parser.RowValue{"", "b"}},
+			append([]evalTest{
+				// not a map:
+				{data.Int(17), nil},
+				// keys not present:
+				{data.Map{"x": data.Int(17)}, nil},
+				// only left present => error
+				{data.Map{"a": data.Int(2)}, nil},
+				// only right present => error
+				{data.Map{"b": data.Array{data.Int(2)}}, nil},
+				// right is not an array => error
+				{data.Map{"a": data.Int(2),
+					"b": data.Int(2)}, nil},
+				{data.Map{"a": data.String("h"),
+					"b": data.String("hoge")}, nil},
+				// right contains left => true
+				{data.Map{"a": data.Int(2),
+					"b": data.Array{data.Int(1), data.Int(2)}}, data.Bool(true)},
+				{data.Map{"a": data.Float(2.0),
+					"b": data.Array{data.Int(1), data.Int(2)}}, data.Bool(true)},
+				{data.Map{"a": data.Array{data.Int(2)},
+					"b": data.Array{data.Array{data.Int(2)}}}, data.Bool(true)},
+				// right doesn't contain left => false
+				{data.Map{"a": data.Int(3),
+					"b": data.Array{data.Int(1), data.Int(2)}}, data.Bool(false)},
+				{data.Map{"a": data.String("1"),
+					"b": data.Array{data.Int(1), data.Int(2)}}, data.Bool(false)},
+				{data.Map{"a": data.Int(2),
+					"b": data.Array{}}, data.Bool(false)},
+			}, nullOps...),
+		},
+		// Between
+		{parser.BinaryOpAST{parser.Between, parser.RowValue{"", "a"}, parser.RowValue{"", "b"}},
+			append([]evalTest{
+				// not a map:
+				{data.Int(17), nil},
+				// keys not present:
+				{data.Map{"x": data.Int(17)}, nil},
+				// only left present => error
+				{data.Map{"a": data.Int(2)}, nil},
+				// right is not an array of two bounds => error
+				{data.Map{"a": data.Int(2),
+					"b": data.Int(2)}, nil},
+				{data.Map{"a": data.Int(2),
+					"b": data.Array{data.Int(1)}}, nil},
+				{data.Map{"a": data.Int(2),
+					"b": data.Array{data.Int(1), data.Int(2), data.Int(3)}}, nil},
+				// incomparable types => error
+				{data.Map{"a": data.Int(2),
+					"b": data.Array{data.String("a"), data.String("z")}}, nil},
+				// NULL bounds => NULL
+				{data.Map{"a": data.Int(2),
+					"b": data.Array{data.Null{}, data.Int(3)}}, data.Null{}},
+				{data.Map{"a": data.Int(2),
+					"b": data.Array{data.Int(1), data.Null{}}}, data.Null{}},
+				// left is within the bounds => true
+				{data.Map{"a": data.Int(2),
+					"b": data.Array{data.Int(1), data.Int(3)}}, data.Bool(true)},
+				{data.Map{"a": data.Int(1),
+					"b": data.Array{data.Int(1), data.Int(3)}}, data.Bool(true)},
+				{data.Map{"a": data.Int(3),
+					"b": data.Array{data.Int(1), data.Int(3)}}, data.Bool(true)},
+				{data.Map{"a": data.Float(2.5),
+					"b": data.Array{data.Int(1), data.Int(3)}}, data.Bool(true)},
+				{data.Map{"a": data.String("hoge"),
+					"b": data.Array{data.String("a"), data.String("z")}}, data.Bool(true)},
+				// left is outside of the bounds => false
+				{data.Map{"a": data.Int(0),
+					"b": data.Array{data.Int(1), data.Int(3)}}, data.Bool(false)},
+				{data.Map{"a": data.Float(3.5),
+					"b": data.Array{data.Int(1), data.Int(3)}}, data.Bool(false)},
+				{data.Map{"a": data.Int(2),
+					"b": data.Array{data.Int(3), data.Int(1)}}, data.Bool(false)},
+			}, nullOps...),
+		},
+		// Like
+		{parser.BinaryOpAST{parser.Like, parser.RowValue{"", "a"}, parser.RowValue{"", "b"}},
+			append([]evalTest{
+				// not a map:
+				{data.Int(17), nil},
+				// keys not present:
+				{data.Map{"x": data.Int(17)}, nil},
+				// only left present => error
+				{data.Map{"a": data.String("hoge")}, nil},
+				// left or right is not a string => error
+				{data.Map{"a": data.Int(2),
+					"b": data.String("2")}, nil},
+				{data.Map{"a": data.String("2"),
+					"b": data.Int(2)}, nil},
+				// invalid pattern => error
+				{data.Map{"a": data.String("a"),
+					"b": data.String(`a\`)}, nil},
+				// left matches right => true
+				{data.Map{"a": data.String("hoge"),
+					"b": data.String("hoge")}, data.Bool(true)},
+				{data.Map{"a": data.String("hoge"),
+					"b": data.String("ho%")}, data.Bool(true)},
+				{data.Map{"a": data.String("hoge"),
+					"b": data.String("%")}, data.Bool(true)},
+				{data.Map{"a": data.String("ho\nge"),
+					"b": data.String("h_%e")}, data.Bool(true)},
+				{data.Map{"a": data.String("h.*e"),
+					"b": data.String("h.*e")}, data.Bool(true)},
+				{data.Map{"a": data.String("100%"),
+					"b": data.String(`100\%`)}, data.Bool(true)},
+				// left doesn't match right => false
+				{data.Map{"a": data.String("hoge"),
+					"b": data.String("ho")}, data.Bool(false)},
+				{data.Map{"a": data.String("hoge"),
+					"b": data.String("HO%")}, data.Bool(false)},
+				{data.Map{"a": data.String("hoge"),
+					"b": data.String("h.*e")}, data.Bool(false)},
+				{data.Map{"a": data.String("1000"),
+					"b": data.String(`100\%`)}, data.Bool(false)},
+			}, nullOps...),
+		},
+		// Like with ESCAPE
+		{parser.BinaryOpAST{parser.Like, parser.RowValue{"", "a"},
+			parser.LikePatternAST{parser.RowValue{"", "b"}, parser.StringLiteral{`\`}}},
+			append([]evalTest{
+				// invalid pattern => error
+				{data.Map{"a": data.String("a"),
+					"b": data.String(`a\`)}, nil},
+				// escaped wildcards only match themselves
+				{data.Map{"a": data.String("a_b"),
+					"b": data.String(`a\_b`)}, data.Bool(true)},
+				{data.Map{"a": data.String("axb"),
+					"b": data.String(`a\_b`)}, data.Bool(false)},
+			}, nullOps...),
+		},
+		{parser.BinaryOpAST{parser.Like, parser.RowValue{"", "a"},
+			parser.LikePatternAST{parser.RowValue{"", "b"}, parser.StringLiteral{"|"}}},
+			append([]evalTest{
+				// invalid pattern => error
+				{data.Map{"a": data.String("a"),
+					"b": data.String("a|")}, nil},
+				// the custom escape character escapes wildcards
+				{data.Map{"a": data.String("a_b"),
+					"b": data.String("a|_b")}, data.Bool(true)},
+				{data.Map{"a": data.String("axb"),
+					"b": data.String("a|_b")}, data.Bool(false)},
+				{data.Map{"a": data.String("100%"),
+					"b": data.String("100|%")}, data.Bool(true)},
+				{data.Map{"a": data.String("a|b"),
+					"b": data.String("a||b")}, data.Bool(true)},
+				// a backslash is an ordinary character
+				{data.Map{"a": data.String(`a\xb`),
+					"b": data.String(`a\_b`)}, data.Bool(true)},
+				{data.Map{"a": data.String("a_b"),
+					"b": data.String(`a\_b`)}, data.Bool(false)},
+			}, nullOps...),
+		},
+		// RegexpMatch
+		{parser.BinaryOpAST{parser.RegexpMatch, parser.RowValue{"", "a"}, parser.RowValue{"", "b"}},
+			append([]evalTest{
+				// not a map:
+				{data.Int(17), nil},
+				// keys not present:
+				{data.Map{"x": data.Int(17)}, nil},
+				// only left present => error
+				{data.Map{"a": data.String("hoge")}, nil},
+				// left or right is not a string => error
+				{data.Map{"a": data.Int(2),
+					"b": data.String("2")}, nil},
+				{data.Map{"a": data.String("2"),
+					"b": data.Int(2)}, nil},
+				// invalid regular expression => error
+				{data.Map{"a": data.String("hoge"),
+					"b": data.String("ho(")}, nil},
+				// left matches right => true
+				{data.Map{"a": data.String("hoge"),
+					"b": data.String("og")}, data.Bool(true)},
+				{data.Map{"a": data.String("hoge"),
+					"b": data.String("^h.*e$")}, data.Bool(true)},
+				{data.Map{"a": data.String("hoge"),
+					"b": data.String("(?i)HOGE")}, data.Bool(true)},
+				// left doesn't match right => false
+				{data.Map{"a": data.String("hoge"),
+					"b": data.String("^o")}, data.Bool(false)},
+				{data.Map{"a": data.String("hoge"),
+					"b": data.String("HOGE")}, data.Bool(false)},
+			}, nullOps...),
+		},
 		// IsNull
 		{parser.BinaryOpAST{parser.Is, parser.RowValue{"", "a"}, parser.NullLiteral{}},
 			[]evalTest{
@@ -1687,13 +2164,53 @@ func getTestCases() []struct {
 				{data.Map{"a": data.Blob("hoge")}, data.String("aG9nZQ==")},
 				{data.Map{"a": data.Array{data.Int(2)}}, data.String("[2]")},
 				{data.Map{"a": data.Map{"b": data.Int(3)}}, data.String("{\"b\":3}")},
+				// keys of maps are sorted
+				{data.Map{"a": data.Map{"c": data.Int(3), "b": data.Map{"z": data.Null{}, "y": data.True}}},
+					data.String(`{"b":{"y":true,"z":null},"c":3}`)},
 				// null propagation
 				{data.Map{"a": data.Null{}}, data.Null{}},
 			},
 		},
+		{parser.TypeCastAST{parser.RowValue{"", "a"}, parser.Map},
+			[]evalTest{
+				// not a map:
+				{data.Int(17), nil},
+				// keys not present:
+				{data.Map{"x": data.Int(17)}, nil},
+				// key present and convertable => ok
+				{data.Map{"a": data.Map{"b": data.Int(3)}}, data.Map{"b": data.Int(3)}},
+				{data.Map{"a": data.String(`{"b":{"y":true,"z":null},"c":[3.5]}`)},
+					data.Map{"b": data.Map{"y": data.True, "z": data.Null{}}, "c": data.Array{data.Float(3.5)}}},
+				// null propagation
+				{data.Map{"a": data.Null{}}, data.Null{}},
+				// key present and other data type => error
+				{data.Map{"a": data.Int(17)}, nil},
+				{data.Map{"a": data.String("[1]")}, nil},
+				{data.Map{"a": data.String("日本語")}, nil},
+				{data.Map{"a": data.Array{data.Int(2)}}, nil},
+			},
+		},
+		{parser.TypeCastAST{parser.RowValue{"", "a"}, parser.Array},
+			[]evalTest{
+				// not a map:
+				{data.Int(17), nil},
+				// keys not present:
+				{data.Map{"x": data.Int(17)}, nil},
+				// key present and convertable => ok
+				{data.Map{"a": data.Array{data.Int(2)}}, data.Array{data.Int(2)}},
+				{data.Map{"a": data.String(`[1,"b",{"c":null}]`)},
+					data.Array{data.Int(1), data.String("b"), data.Map{"c": data.Null{}}}},
+				// null propagation
+				{data.Map{"a": data.Null{}}, data.Null{}},
+				// key present and other data type => error
+				{data.Map{"a": data.Int(17)}, nil},
+				{data.Map{"a": data.String(`{"b":1}`)}, nil},
+				{data.Map{"a": data.Map{"b": data.Int(3)}}, nil},
+			},
+		},
 		/// Function Application
 		{parser.FuncAppAST{parser.FuncName("plusone"),
-			parser.ExpressionsAST{[]parser.Expression{parser.RowValue{"", "a"}}}, nil},
+			parser.ExpressionsAST{[]parser.Expression{parser.RowValue{"", "a"}}}, nil, false, nil},
 			// NB. This only tests the behavior of funcApp.Eval.
 			// It does *not* test the function registry, mismatch
 			// in parameter counts or any particular function.
@@ -1725,8 +2242,8 @@ func getTestCases() []struct {
 				{data.Map{"a": data.Null{}}, data.Array{data.Int(2), data.Null{}}},
 			},
 		},
-		{parser.MapAST{[]parser.KeyValuePairAST{{"two", parser.NumericLiteral{2}},
-			{"a", parser.RowValue{"", "a"}}}},
+		{parser.MapAST{[]parser.KeyValuePairAST{{"two", parser.NumericLiteral{2}, nil},
+			{"a", parser.RowValue{"", "a"}, nil}}},
 			[]evalTest{
 				// not a map:
 				{data.Int(17), nil},
@@ -1741,6 +2258,25 @@ func getTestCases() []struct {
 				{data.Map{"a": data.Null{}}, data.Map{"two": data.Int(2), "a": data.Null{}}},
 			},
 		},
+		// a map having a computed key
+		{parser.MapAST{[]parser.KeyValuePairAST{{"two", parser.NumericLiteral{2}, nil},
+			{"", parser.RowValue{"", "b"}, parser.RowValue{"", "a"}}}},
+			[]evalTest{
+				// not a map:
+				{data.Int(17), nil},
+				// keys not present:
+				{data.Map{"a": data.String("x")}, nil},
+				{data.Map{"b": data.Int(17)}, nil},
+				// the key is a string
+				{data.Map{"a": data.String("x"), "b": data.Int(17)}, data.Map{"two": data.Int(2), "x": data.Int(17)}},
+				{data.Map{"a": data.String("日本語"), "b": data.Null{}}, data.Map{"two": data.Int(2), "日本語": data.Null{}}},
+				// the key is the same as a static key => the latter wins
+				{data.Map{"a": data.String("two"), "b": data.Int(17)}, data.Map{"two": data.Int(17)}},
+				// the key isn't a string
+				{data.Map{"a": data.Int(1), "b": data.Int(17)}, nil},
+				{data.Map{"a": data.Null{}, "b": data.Int(17)}, nil},
+			},
+		},
 		// CASE a WHEN ... THEN ... ELSE ... END
 		{parser.ExpressionCaseAST{parser.RowValue{"", "a"}, parser.ConditionCaseAST{[]parser.WhenThenPairAST{
 			{parser.NumericLiteral{2}, parser.NumericLiteral{3}}}, parser.NullLiteral{}}},
@@ -1806,7 +2342,7 @@ func getTestCases() []struct {
 		// Using now() should find the timestamp at the
 		// correct position
 		{parser.FuncAppAST{parser.FuncName("now"),
-			parser.ExpressionsAST{[]parser.Expression{}}, nil},
+			parser.ExpressionsAST{[]parser.Expression{}}, nil, false, nil},
 			[]evalTest{
 				// not a map:
 				{data.Int(17), nil},
@@ -1867,8 +2403,8 @@ func getTestCases() []struct {
 					data.Array{data.Int(2), data.Map{"b": data.Int(3), "d": data.Int(4)}}},
 			},
 		},
-		{parser.MapAST{[]parser.KeyValuePairAST{{"two", parser.NumericLiteral{2}},
-			{"x", parser.Wildcard{"a"}}}},
+		{parser.MapAST{[]parser.KeyValuePairAST{{"two", parser.NumericLiteral{2}, nil},
+			{"x", parser.Wildcard{"a"}, nil}}},
 			[]evalTest{
 				// not a map:
 				{data.Int(17), nil},
@@ -1886,7 +2422,7 @@ func getTestCases() []struct {
 			},
 		},
 		{parser.FuncAppAST{parser.FuncName("maplen"),
-			parser.ExpressionsAST{[]parser.Expression{parser.Wildcard{}}}, nil},
+			parser.ExpressionsAST{[]parser.Expression{parser.Wildcard{}}}, nil, false, nil},
 			[]evalTest{
 				// not a map:
 				{data.Int(17), nil},
@@ -1903,7 +2439,7 @@ func getTestCases() []struct {
 			},
 		},
 		{parser.FuncAppAST{parser.FuncName("maplen"),
-			parser.ExpressionsAST{[]parser.Expression{parser.Wildcard{"a"}}}, nil},
+			parser.ExpressionsAST{[]parser.Expression{parser.Wildcard{"a"}}}, nil, false, nil},
 			[]evalTest{
 				// not a map:
 				{data.Int(17), nil},
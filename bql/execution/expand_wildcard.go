@@ -0,0 +1,99 @@
+package execution
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"strings"
+)
+
+// ExpandWildcards rewrites wildcard projections (`*` and `rel:*`) of a
+// SELECT statement into explicit column references so that the columns
+// emitted by the statement no longer depend on the input tuples. schema
+// has the column names of each input stream in the FROM clause. Its keys
+// are names of streams rather than their aliases.
+//
+// The rewritten statement emits the same columns as the original one as
+// long as input tuples follow the schema:
+//
+//  * A column also emitted by a non-wildcard projection is omitted because
+//    the non-wildcard projection takes precedence.
+//  * When multiple relations have a column with the same name, the column
+//    of the relation appearing first in the FROM clause is used.
+//  * A projection whose column name depends on its position, e.g. col_1,
+//    gets an alias so that the name doesn't change.
+//
+// Wildcards that aren't projections themselves, such as `count(*)` or
+// `* AS x`, are left untouched.
+func ExpandWildcards(stmt parser.SelectStmt, schema map[string][]string) (parser.SelectStmt, error) {
+	// aliases of relations in the order of declaration
+	rels := make([]string, len(stmt.Relations))
+	names := map[string]string{}
+	for i, rel := range stmt.Relations {
+		rels[i] = rel.Alias
+		if rels[i] == "" {
+			rels[i] = rel.Name
+		}
+		names[rels[i]] = rel.Name
+	}
+
+	used := map[string]bool{}
+	for i, expr := range stmt.Projections {
+		if _, ok := expr.(parser.Wildcard); !ok {
+			used[projectionColumnHeader(expr, i)] = true
+		}
+	}
+
+	projs := make([]parser.Expression, 0, len(stmt.Projections))
+	for i, expr := range stmt.Projections {
+		w, ok := expr.(parser.Wildcard)
+		if !ok {
+			if header := fmt.Sprintf("col_%v", i); projectionColumnHeader(expr, i) == header &&
+				len(projs) != i {
+				// keep the name computed from the original position
+				expr = parser.AliasAST{expr, header}
+			}
+			projs = append(projs, expr)
+			continue
+		}
+
+		targets := rels
+		if w.Relation != "" {
+			targets = []string{w.Relation}
+		}
+		for _, rel := range targets {
+			name, ok := names[rel]
+			if !ok {
+				return parser.SelectStmt{}, fmt.Errorf("cannot refer to relation '%v' "+
+					"that does not appear in the FROM clause", rel)
+			}
+			cols, ok := schema[name]
+			if !ok {
+				return parser.SelectStmt{}, fmt.Errorf("the schema of stream '%v' is not given", name)
+			}
+			qualifier := rel
+			if w.Relation == "" && len(rels) == 1 {
+				qualifier = ""
+			}
+			for _, col := range cols {
+				if used[col] {
+					continue
+				}
+				used[col] = true
+				projs = append(projs, columnProjection(qualifier, col))
+			}
+		}
+	}
+
+	stmt.Projections = projs
+	return stmt, nil
+}
+
+// columnProjection returns a projection emitting the column of the relation
+// with the same name.
+func columnProjection(rel, col string) parser.Expression {
+	if simpleColumnNameRe.MatchString(col) {
+		return parser.RowValue{rel, col}
+	}
+	path := fmt.Sprintf(`["%v"]`, strings.Replace(col, `"`, `""`, -1))
+	return parser.AliasAST{parser.RowValue{rel, path}, path}
+}
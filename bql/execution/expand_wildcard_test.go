@@ -0,0 +1,106 @@
+package execution
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"testing"
+)
+
+func TestExpandWildcards(t *testing.T) {
+	schema := map[string][]string{
+		"s": {"a", "b", "Upper Case"},
+		"t": {"b", "c"},
+		"u": {"x"},
+	}
+
+	expand := func(stmt string) []parser.Expression {
+		istmt, _, err := parser.New().ParseStmt(stmt)
+		So(err, ShouldBeNil)
+		s := istmt.(parser.SelectStmt)
+		expanded, err := ExpandWildcards(s, schema)
+		So(err, ShouldBeNil)
+
+		Convey("Then the rewritten statement should be valid BQL", func() {
+			_, _, err := parser.New().ParseStmt(expanded.String())
+			So(err, ShouldBeNil)
+		})
+		return expanded.Projections
+	}
+
+	Convey("Given a schema of relations", t, func() {
+		Convey("When expanding * of a single relation", func() {
+			projs := expand(`SELECT RSTREAM * FROM s [RANGE 1 TUPLES]`)
+
+			Convey("Then it should be replaced by all columns of the relation", func() {
+				So(projs, ShouldResemble, []parser.Expression{
+					parser.RowValue{"", "a"},
+					parser.RowValue{"", "b"},
+					parser.AliasAST{parser.RowValue{"", `["Upper Case"]`}, `["Upper Case"]`},
+				})
+			})
+		})
+
+		Convey("When expanding * of multiple relations", func() {
+			projs := expand(`SELECT RSTREAM *, c + 1, b AS x
+				FROM s [RANGE 1 TUPLES], t [RANGE 1 TUPLES] AS v, u [RANGE 1 TUPLES]`)
+
+			Convey("Then it should be replaced by columns not emitted by other projections", func() {
+				So(projs, ShouldResemble, []parser.Expression{
+					parser.RowValue{"s", "a"},
+					parser.RowValue{"s", "b"},
+					parser.AliasAST{parser.RowValue{"s", `["Upper Case"]`}, `["Upper Case"]`},
+					parser.RowValue{"v", "c"},
+					parser.AliasAST{parser.BinaryOpAST{parser.Plus, parser.RowValue{"", "c"}, parser.NumericLiteral{1}}, "col_1"},
+					parser.AliasAST{parser.RowValue{"", "b"}, "x"},
+				})
+			})
+		})
+
+		Convey("When expanding rel:* of a relation", func() {
+			projs := expand(`SELECT RSTREAM a:x, v:*, a:a AS c, ts()
+				FROM s [RANGE 1 TUPLES] AS a, t [RANGE 1 TUPLES] AS v`)
+
+			Convey("Then it should be replaced by columns of the relation", func() {
+				So(projs, ShouldResemble, []parser.Expression{
+					parser.RowValue{"a", "x"},
+					parser.RowValue{"v", "b"},
+					parser.AliasAST{parser.RowValue{"a", "a"}, "c"},
+					parser.RowMeta{"", parser.TimestampMeta},
+				})
+			})
+		})
+
+		Convey("When expanding a statement without wildcard projections", func() {
+			projs := expand(`SELECT RSTREAM a, count(*), b + 1 FROM s [RANGE 1 TUPLES]`)
+
+			Convey("Then the projections should be untouched", func() {
+				So(projs, ShouldResemble, []parser.Expression{
+					parser.RowValue{"", "a"},
+					parser.FuncAppAST{"count", parser.ExpressionsAST{[]parser.Expression{parser.Wildcard{}}}, nil, false, nil},
+					parser.BinaryOpAST{parser.Plus, parser.RowValue{"", "b"}, parser.NumericLiteral{1}},
+				})
+			})
+		})
+
+		Convey("When the schema of a relation is missing", func() {
+			istmt, _, err := parser.New().ParseStmt(`SELECT RSTREAM * FROM s [RANGE 1 TUPLES], w [RANGE 1 TUPLES]`)
+			So(err, ShouldBeNil)
+			_, err = ExpandWildcards(istmt.(parser.SelectStmt), schema)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "'w'")
+			})
+		})
+
+		Convey("When expanding rel:* of an unknown relation", func() {
+			istmt, _, err := parser.New().ParseStmt(`SELECT RSTREAM t:* FROM t [RANGE 1 TUPLES] AS v`)
+			So(err, ShouldBeNil)
+			_, err = ExpandWildcards(istmt.(parser.SelectStmt), schema)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
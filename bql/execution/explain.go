@@ -0,0 +1,146 @@
+package execution
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// Explain describes how the physical plan created by MakePhysicalPlan
+// executes the statement. The description has the following keys:
+//
+//  - plan: "filter", "default", or "groupby" depending on the physical plan
+//  - emitter: the emitter of the statement such as "ISTREAM"
+//  - window_strategy: "none" when input tuples aren't buffered, "tuple"
+//    when the statement is evaluated on every input tuple, or "slide" when
+//    it's evaluated once per slide interval given as slide_ms
+//  - relations: the input relations with their window specifications and,
+//    for explicit joins, the type and the condition of the join
+//  - join_order: the aliases of the relations in the order they're joined
+//  - join_method: "none", "nested_loop", or "incremental_nested_loop"
+//    which only joins the new input tuple with the other buffers
+//  - incremental_aggregation: whether aggregates are updated incrementally
+//    instead of being recomputed from the whole window
+//  - estimated_parallelism: the number of goroutines processing the plan
+//  - filter: the WHERE clause after the logical optimization, if any
+//  - group_by: the expressions of the GROUP BY clause, if any
+//
+// The physical plan is actually built so that Explain fails in the same way
+// as MakePhysicalPlan does.
+func (lp *LogicalPlan) Explain(reg udf.FunctionRegistry) (data.Map, error) {
+	pp, err := lp.MakePhysicalPlan(reg)
+	if err != nil {
+		return nil, err
+	}
+
+	res := data.Map{
+		"emitter": data.String(lp.EmitterType.String()),
+		// a PhysicalPlan isn't thread-safe and is always processed by a
+		// single goroutine of the box running the statement
+		"estimated_parallelism": data.Int(1),
+		"incremental_aggregation": data.False,
+	}
+
+	rels := make(data.Array, len(lp.Relations))
+	order := make(data.Array, len(lp.Relations))
+	for i, rel := range lp.Relations {
+		r := explainRelation(&rel)
+		if lp.Joins != nil && i > 0 {
+			r["join_type"] = data.String(lp.Joins[i-1].Type.String())
+			if cond := lp.JoinConditions[i-1]; cond != nil {
+				r["join_condition"] = data.String(cond.Repr())
+			}
+		}
+		rels[i] = r
+		order[i] = data.String(rel.Alias)
+	}
+	res["relations"] = rels
+	res["join_order"] = order
+
+	switch p := pp.(type) {
+	case *filterPlan:
+		res["plan"] = data.String("filter")
+	case *defaultSelectExecutionPlan:
+		res["plan"] = data.String("default")
+	case *groupbyExecutionPlan:
+		res["plan"] = data.String("groupby")
+		// otherwise aggregates are recomputed from the whole window
+		// every time the statement is evaluated
+		res["incremental_aggregation"] = data.Bool(p.incremental != nil)
+	}
+
+	if _, ok := pp.(*filterPlan); ok {
+		// the filter plan only looks at the current input tuple
+		res["window_strategy"] = data.String("none")
+	} else if slide := lp.slideMillis(); slide > 0 {
+		res["window_strategy"] = data.String("slide")
+		res["slide_ms"] = data.Float(slide)
+	} else {
+		res["window_strategy"] = data.String("tuple")
+	}
+
+	switch {
+	case len(lp.Relations) < 2:
+		res["join_method"] = data.String("none")
+	case lp.Joins != nil:
+		// explicit joins are recomputed from all buffers from left to
+		// right in the order of the FROM clause
+		res["join_method"] = data.String("nested_loop")
+	default:
+		res["join_method"] = data.String("incremental_nested_loop")
+	}
+
+	if lp.Filter != nil {
+		res["filter"] = data.String(lp.Filter.Repr())
+	}
+	if len(lp.GroupList) > 0 {
+		groups := make(data.Array, len(lp.GroupList))
+		for i, g := range lp.GroupList {
+			groups[i] = data.String(g.Repr())
+		}
+		res["group_by"] = groups
+	}
+	return res, nil
+}
+
+// slideMillis returns the interval in milliseconds at which the statement is
+// evaluated. It's the shortest SLIDE of the relations, or 0 when none of them
+// has one.
+func (lp *LogicalPlan) slideMillis() float64 {
+	var slide float64
+	for _, rel := range lp.Relations {
+		d := slideDuration(rel.Slide).Seconds() * 1000
+		if d > 0 && (slide == 0 || d < slide) {
+			slide = d
+		}
+	}
+	return slide
+}
+
+// explainRelation describes an input relation of a plan.
+func explainRelation(rel *parser.AliasedStreamWindowAST) data.Map {
+	m := data.Map{
+		"name":  data.String(rel.Name),
+		"alias": data.String(rel.Alias),
+		"range": data.Float(rel.Value),
+		"unit":  data.String(rel.Unit.String()),
+	}
+	switch rel.Type {
+	case parser.UDSFStream:
+		m["type"] = data.String("udsf")
+	case parser.DroppedTuplesStream:
+		m["type"] = data.String("dropped_tuples")
+	case parser.MatchRecognizeStream:
+		m["type"] = data.String("match_recognize")
+	default:
+		m["type"] = data.String("stream")
+	}
+	if rel.Capacity != parser.UnspecifiedCapacity {
+		m["capacity"] = data.Int(rel.Capacity)
+		m["capacity_unit"] = data.String(rel.CapacityUnit.String())
+	}
+	if rel.Shedding != parser.UnspecifiedSheddingOption {
+		m["shedding"] = data.String(rel.Shedding.String())
+	}
+	return m
+}
@@ -0,0 +1,120 @@
+package execution
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	reg := udf.CopyGlobalUDFRegistry(core.NewContext(nil))
+	explain := func(s string) (data.Map, error) {
+		stmt, _, err := parser.New().ParseStmt(s)
+		So(err, ShouldBeNil)
+		lp, err := Analyze(stmt.(parser.SelectStmt), reg)
+		So(err, ShouldBeNil)
+		lp, err = lp.LogicalOptimize()
+		So(err, ShouldBeNil)
+		return lp.Explain(reg)
+	}
+
+	Convey("Given a statement which can be processed by the filter plan", t, func() {
+		s := `SELECT RSTREAM a FROM s [RANGE 1 TUPLES] WHERE a > 1`
+
+		Convey("When explaining it", func() {
+			m, err := explain(s)
+			So(err, ShouldBeNil)
+
+			Convey("Then it shouldn't buffer input tuples", func() {
+				So(m["plan"], ShouldEqual, data.String("filter"))
+				So(m["window_strategy"], ShouldEqual, data.String("none"))
+				So(m["join_method"], ShouldEqual, data.String("none"))
+				So(m["filter"], ShouldNotBeNil)
+				So(m["estimated_parallelism"], ShouldEqual, data.Int(1))
+			})
+		})
+	})
+
+	Convey("Given an aggregating statement with a SLIDE", t, func() {
+		s := `SELECT ISTREAM b, count(*) FROM s [RANGE 10 SECONDS, SLIDE 2 SECONDS, BUFFER SIZE 16]
+			GROUP BY b`
+
+		Convey("When explaining it", func() {
+			m, err := explain(s)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should describe the groupby plan", func() {
+				So(m["plan"], ShouldEqual, data.String("groupby"))
+				So(m["emitter"], ShouldEqual, data.String("ISTREAM"))
+				So(m["window_strategy"], ShouldEqual, data.String("slide"))
+				So(m["slide_ms"], ShouldEqual, data.Float(2000))
+				So(m["incremental_aggregation"], ShouldEqual, data.True)
+				So(m["group_by"], ShouldResemble, data.Array{data.String("s:b")})
+				So(m["relations"], ShouldResemble, data.Array{data.Map{
+					"name":          data.String("s"),
+					"alias":         data.String("s"),
+					"type":          data.String("stream"),
+					"range":         data.Float(10),
+					"unit":          data.String("SECONDS"),
+					"capacity":      data.Int(16),
+					"capacity_unit": data.String("TUPLES"),
+				}})
+			})
+		})
+	})
+
+	Convey("Given an aggregating statement with a non-incremental aggregate", t, func() {
+		s := `SELECT ISTREAM count(*), median(a) FROM s [RANGE 10 TUPLES]`
+
+		Convey("When explaining it", func() {
+			m, err := explain(s)
+			So(err, ShouldBeNil)
+
+			Convey("Then aggregates should be recomputed from the whole window", func() {
+				So(m["plan"], ShouldEqual, data.String("groupby"))
+				So(m["incremental_aggregation"], ShouldEqual, data.False)
+			})
+		})
+	})
+
+	Convey("Given a statement with explicit joins", t, func() {
+		s := `SELECT ISTREAM a:x FROM a [RANGE 3 TUPLES]
+			LEFT OUTER JOIN b [RANGE 3 TUPLES] ON a:id = b:id, c [RANGE 1 TUPLES]`
+
+		Convey("When explaining it", func() {
+			m, err := explain(s)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should describe the join order", func() {
+				So(m["plan"], ShouldEqual, data.String("default"))
+				So(m["window_strategy"], ShouldEqual, data.String("tuple"))
+				So(m["join_method"], ShouldEqual, data.String("nested_loop"))
+				So(m["join_order"], ShouldResemble, data.Array{
+					data.String("a"), data.String("b"), data.String("c")})
+
+				rels := m["relations"].(data.Array)
+				So(rels[0].(data.Map)["join_type"], ShouldBeNil)
+				So(rels[1].(data.Map)["join_type"], ShouldEqual, data.String("LEFT OUTER JOIN"))
+				So(rels[1].(data.Map)["join_condition"], ShouldNotBeNil)
+				So(rels[2].(data.Map)["join_type"], ShouldEqual, data.String("CROSS JOIN"))
+				So(rels[2].(data.Map)["join_condition"], ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a statement joining relations with commas", t, func() {
+		s := `SELECT ISTREAM a:x FROM a [RANGE 3 TUPLES], b [RANGE 3 TUPLES] WHERE a:id = b:id`
+
+		Convey("When explaining it", func() {
+			m, err := explain(s)
+			So(err, ShouldBeNil)
+
+			Convey("Then only the new tuple should be joined", func() {
+				So(m["join_method"], ShouldEqual, data.String("incremental_nested_loop"))
+			})
+		})
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
 	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
 	"strings"
+	"time"
 )
 
 // aliasedExpression represents an expression in a SELECT clause
@@ -97,6 +98,8 @@ func ParserExprToFlatExpr(e parser.Expression, reg udf.FunctionRegistry) (FlatEx
 		return numericLiteral{obj.Value}, nil
 	case parser.FloatLiteral:
 		return floatLiteral{obj.Value}, nil
+	case parser.IntervalLiteral:
+		return intervalLiteral{obj.Value}, nil
 	case parser.BoolLiteral:
 		return boolLiteral{obj.Value}, nil
 	case parser.StringLiteral:
@@ -165,6 +168,14 @@ func ParserExprToFlatExpr(e parser.Expression, reg udf.FunctionRegistry) (FlatEx
 			err := fmt.Errorf("you cannot use ORDER BY in non-aggregate "+
 				"function '%s'", obj.Function)
 			return nil, err
+		} else if obj.Distinct {
+			err := fmt.Errorf("you cannot use DISTINCT in non-aggregate "+
+				"function '%s'", obj.Function)
+			return nil, err
+		} else if obj.Filter != nil {
+			err := fmt.Errorf("you cannot use FILTER in non-aggregate "+
+				"function '%s'", obj.Function)
+			return nil, err
 		}
 		// compute child expressions
 		exprs := make([]FlatExpression, len(obj.Expressions))
@@ -187,6 +198,16 @@ func ParserExprToFlatExpr(e parser.Expression, reg udf.FunctionRegistry) (FlatEx
 			exprs[i] = expr
 		}
 		return arrayAST{exprs}, nil
+	case parser.LikePatternAST:
+		pattern, err := ParserExprToFlatExpr(obj.Pattern, reg)
+		if err != nil {
+			return nil, err
+		}
+		escape, err := likeEscapeRune(obj.Escape)
+		if err != nil {
+			return nil, err
+		}
+		return likePatternAST{pattern, escape}, nil
 	case parser.MapAST:
 		// compute child expressions
 		pairs := make([]keyValuePair, len(obj.Entries))
@@ -195,7 +216,14 @@ func ParserExprToFlatExpr(e parser.Expression, reg udf.FunctionRegistry) (FlatEx
 			if err != nil {
 				return nil, err
 			}
-			pairs[i] = keyValuePair{pair.Key, expr}
+			pairs[i] = keyValuePair{pair.Key, expr, nil}
+			if pair.KeyExpr != nil {
+				key, err := ParserExprToFlatExpr(pair.KeyExpr, reg)
+				if err != nil {
+					return nil, err
+				}
+				pairs[i].KeyExpr = key
+			}
 		}
 		return mapAST{pairs}, nil
 	case parser.ConditionCaseAST:
@@ -236,6 +264,10 @@ func ParserExprToFlatExpr(e parser.Expression, reg udf.FunctionRegistry) (FlatEx
 		return caseAST{ref, c.Checks, c.Default}, nil
 	case parser.Wildcard:
 		return wildcardAST{obj.Relation}, nil
+	case parser.Placeholder:
+		return nil, fmt.Errorf("parameter %s is not bound", obj)
+	case parser.NamedArgAST:
+		return nil, fmt.Errorf("named arguments can only be given to UDSFs: %s", obj)
 	}
 	err := fmt.Errorf("don't know how to convert type %#v", e)
 	return nil, err
@@ -367,8 +399,8 @@ func ParserExprToMaybeAggregate(e parser.Expression, aggIdx int, reg udf.Functio
 				}
 			}
 
-			// deal with ORDER BY specifications
-			if len(obj.Ordering) > 0 {
+			// deal with ORDER BY specifications, DISTINCT, and FILTER
+			if len(obj.Ordering) > 0 || obj.Distinct || obj.Filter != nil {
 				ordering := make([]sortExpression, len(obj.Ordering))
 				// we need a string that uniquely identifies this ordering in order
 				// to allow `SELECT f(a ORDER BY b), f(a ORDER BY c)`
@@ -413,14 +445,57 @@ func ParserExprToMaybeAggregate(e parser.Expression, aggIdx int, reg udf.Functio
 					}
 					returnAgg[exprID] = expr
 				}
+				if obj.Distinct {
+					// the deduplicated values depend on the set of
+					// aggregation parameters, e.g., `f(DISTINCT a, b)`
+					// and `g(DISTINCT a, c)` need different arrays for a
+					orderHash.Write([]byte("DISTINCT"))
+					for _, e := range exprs {
+						if ref, ok := e.(aggInputRef); ok {
+							orderHash.Write([]byte("," + ref.Ref))
+						}
+					}
+				}
+				var filter *aggInputRef
+				if obj.Filter != nil {
+					// the condition is evaluated on each row and
+					// aggregated like other parameters
+					expr, err := ParserExprToFlatExpr(obj.Filter, reg)
+					if err != nil {
+						// return a prettier error message
+						if strings.HasPrefix(err.Error(), "you cannot use aggregate") {
+							err = fmt.Errorf("aggregate functions cannot be used in FILTER")
+						}
+						return nil, nil, err
+					}
+					h := sha1.New()
+					h.Write([]byte(fmt.Sprintf("%s", expr.Repr())))
+					exprID := "g_" + hex.EncodeToString(h.Sum(nil))[:8]
+					if expr.Volatility() == Volatile {
+						exprID += fmt.Sprintf("_%d", aggIdx+len(returnAgg))
+					}
+					orderHash.Write([]byte("FILTER," + exprID))
+					filter = &aggInputRef{exprID}
+					returnAgg[exprID] = expr
+				}
 				return aggregateInputSorter{
 					funcAppAST{obj.Function, exprs},
 					ordering,
 					hex.EncodeToString(orderHash.Sum(nil))[:8],
+					obj.Distinct,
+					filter,
 				}, returnAgg, nil
 			}
 
 		} else {
+			if obj.Distinct {
+				return nil, nil, fmt.Errorf("you cannot use DISTINCT in "+
+					"non-aggregate function '%s'", obj.Function)
+			}
+			if obj.Filter != nil {
+				return nil, nil, fmt.Errorf("you cannot use FILTER in "+
+					"non-aggregate function '%s'", obj.Function)
+			}
 			for i, ast := range obj.Expressions {
 				expr, agg, err := ParserExprToMaybeAggregate(ast, aggIdx, reg)
 				if err != nil {
@@ -456,6 +531,16 @@ func ParserExprToMaybeAggregate(e parser.Expression, aggIdx int, reg udf.Functio
 			returnAgg = nil
 		}
 		return arrayAST{exprs}, returnAgg, nil
+	case parser.LikePatternAST:
+		pattern, agg, err := ParserExprToMaybeAggregate(obj.Pattern, aggIdx, reg)
+		if err != nil {
+			return nil, nil, err
+		}
+		escape, err := likeEscapeRune(obj.Escape)
+		if err != nil {
+			return nil, nil, err
+		}
+		return likePatternAST{pattern, escape}, agg, nil
 	case parser.MapAST:
 		// compute child expressions
 		pairs := make([]keyValuePair, len(obj.Entries))
@@ -470,7 +555,18 @@ func ParserExprToMaybeAggregate(e parser.Expression, aggIdx int, reg udf.Functio
 			for key, val := range agg {
 				returnAgg[key] = val
 			}
-			pairs[i] = keyValuePair{pair.Key, expr}
+			pairs[i] = keyValuePair{pair.Key, expr, nil}
+			if pair.KeyExpr != nil {
+				newAggIdx := aggIdx + len(returnAgg)
+				keyExpr, agg, err := ParserExprToMaybeAggregate(pair.KeyExpr, newAggIdx, reg)
+				if err != nil {
+					return nil, nil, err
+				}
+				for key, val := range agg {
+					returnAgg[key] = val
+				}
+				pairs[i].KeyExpr = keyExpr
+			}
 		}
 		if len(returnAgg) == 0 {
 			returnAgg = nil
@@ -678,6 +774,37 @@ func (t typeCastAST) ContainsWildcard() bool {
 	return t.Expr.ContainsWildcard()
 }
 
+// likePatternAST is the right operand of LIKE having an ESCAPE clause.
+type likePatternAST struct {
+	Pattern FlatExpression
+	Escape  rune
+}
+
+func (l likePatternAST) Repr() string {
+	return fmt.Sprintf("%s ESCAPE %q", l.Pattern.Repr(), l.Escape)
+}
+
+func (l likePatternAST) Columns() []rowValue {
+	return l.Pattern.Columns()
+}
+
+func (l likePatternAST) Volatility() VolatilityType {
+	return l.Pattern.Volatility()
+}
+
+func (l likePatternAST) ContainsWildcard() bool {
+	return l.Pattern.ContainsWildcard()
+}
+
+// likeEscapeRune returns the escape character of LIKE given by ESCAPE.
+func likeEscapeRune(escape parser.StringLiteral) (rune, error) {
+	rs := []rune(escape.Value)
+	if len(rs) != 1 {
+		return 0, fmt.Errorf("the escape character of LIKE must be a single character: %v", escape)
+	}
+	return rs[0], nil
+}
+
 type funcAppAST struct {
 	Function    parser.FuncName
 	Expressions []FlatExpression
@@ -720,10 +847,18 @@ type sortExpression struct {
 	Ascending bool
 }
 
+// aggregateInputSorter is an aggregate function call whose aggregated
+// input values are sorted by Ordering, deduplicated when Distinct is true,
+// and/or restricted to the rows satisfying Filter before the function is
+// called.
 type aggregateInputSorter struct {
 	funcAppAST
 	Ordering []sortExpression
 	ID       string
+	Distinct bool
+	// Filter refers to the aggregated values of the condition of a
+	// FILTER clause. It's nil when there's no FILTER clause.
+	Filter *aggInputRef
 }
 
 func (a aggregateInputSorter) Repr() string {
@@ -731,17 +866,29 @@ func (a aggregateInputSorter) Repr() string {
 	for i, e := range a.Expressions {
 		reprs[i] = e.Repr()
 	}
-	ordering := make([]string, len(a.Ordering))
-	for i, e := range a.Ordering {
-		ordering[i] = e.Value.Repr()
-		if e.Ascending {
-			ordering[i] += " ASC"
-		} else {
-			ordering[i] += " DESC"
+	distinct := ""
+	if a.Distinct {
+		distinct = "DISTINCT "
+	}
+	order := ""
+	if len(a.Ordering) > 0 {
+		ordering := make([]string, len(a.Ordering))
+		for i, e := range a.Ordering {
+			ordering[i] = e.Value.Repr()
+			if e.Ascending {
+				ordering[i] += " ASC"
+			} else {
+				ordering[i] += " DESC"
+			}
 		}
+		order = " ORDER BY " + strings.Join(ordering, ",")
+	}
+	filter := ""
+	if a.Filter != nil {
+		filter = fmt.Sprintf(" FILTER (WHERE %s)", a.Filter.Repr())
 	}
-	return fmt.Sprintf("%s(%s ORDER BY %s)", a.Function,
-		strings.Join(reprs, ","), strings.Join(ordering, ","))
+	return fmt.Sprintf("%s(%s%s%s)%s", a.Function, distinct,
+		strings.Join(reprs, ","), order, filter)
 }
 
 type arrayAST struct {
@@ -791,6 +938,10 @@ type mapAST struct {
 func (m mapAST) Repr() string {
 	reprs := make([]string, len(m.Entries))
 	for i, p := range m.Entries {
+		if p.KeyExpr != nil {
+			reprs[i] = fmt.Sprintf("(%s):%s", p.KeyExpr.Repr(), p.Value.Repr())
+			continue
+		}
 		reprs[i] = fmt.Sprintf("\"%s\":%s", p.Key, p.Value.Repr())
 	}
 	return fmt.Sprintf("{%s}", strings.Join(reprs, ", "))
@@ -799,6 +950,9 @@ func (m mapAST) Repr() string {
 func (m mapAST) Columns() []rowValue {
 	var allColumns []rowValue
 	for _, p := range m.Entries {
+		if p.KeyExpr != nil {
+			allColumns = append(allColumns, p.KeyExpr.Columns()...)
+		}
 		allColumns = append(allColumns, p.Value.Columns()...)
 	}
 	return allColumns
@@ -811,6 +965,11 @@ func (m mapAST) Volatility() VolatilityType {
 		if v < lv {
 			lv = v
 		}
+		if p.KeyExpr != nil {
+			if v := p.KeyExpr.Volatility(); v < lv {
+				lv = v
+			}
+		}
 	}
 	return lv
 }
@@ -824,9 +983,12 @@ func (m mapAST) ContainsWildcard() bool {
 	return false
 }
 
+// keyValuePair is an entry of mapAST. When KeyExpr isn't nil, it computes
+// the key and Key is ignored.
 type keyValuePair struct {
-	Key   string
-	Value FlatExpression
+	Key     string
+	Value   FlatExpression
+	KeyExpr FlatExpression
 }
 
 type caseAST struct {
@@ -1049,6 +1211,28 @@ func (l floatLiteral) ContainsWildcard() bool {
 	return false
 }
 
+// intervalLiteral is a length of time. It isn't a value by itself, but it
+// can only be added to or subtracted from a timestamp.
+type intervalLiteral struct {
+	Value time.Duration
+}
+
+func (l intervalLiteral) Repr() string {
+	return parser.IntervalLiteral{l.Value}.String()
+}
+
+func (l intervalLiteral) Columns() []rowValue {
+	return nil
+}
+
+func (l intervalLiteral) Volatility() VolatilityType {
+	return Immutable
+}
+
+func (l intervalLiteral) ContainsWildcard() bool {
+	return false
+}
+
 type nullLiteral struct {
 }
 
@@ -18,16 +18,17 @@ func TestFlatExpressionConverter(t *testing.T) {
 		r []rowValue
 	}{
 		// Base Expressions
-		"true":  {boolLiteral{true}, Immutable, false, nil},
-		"NULL":  {nullLiteral{}, Immutable, false, nil},
-		"a":     {rowValue{"", "a"}, Immutable, false, []rowValue{{"", "a"}}},
-		"ts()":  {rowMeta{"", parser.TimestampMeta}, Immutable, false, nil},
-		"now()": {stmtMeta{parser.NowMeta}, Stable, false, nil},
-		"2":     {numericLiteral{2}, Immutable, false, nil},
-		"1.2":   {floatLiteral{1.2}, Immutable, false, nil},
-		`"bql"`: {stringLiteral{"bql"}, Immutable, false, nil},
-		"*":     {wildcardAST{}, Stable, true, nil},
-		"x:*":   {wildcardAST{"x"}, Stable, true, nil},
+		"true":             {boolLiteral{true}, Immutable, false, nil},
+		"NULL":             {nullLiteral{}, Immutable, false, nil},
+		"a":                {rowValue{"", "a"}, Immutable, false, []rowValue{{"", "a"}}},
+		"ts()":             {rowMeta{"", parser.TimestampMeta}, Immutable, false, nil},
+		"correlation_id()": {rowMeta{"", parser.CorrelationIDMeta}, Immutable, false, nil},
+		"now()":            {stmtMeta{parser.NowMeta}, Stable, false, nil},
+		"2":                {numericLiteral{2}, Immutable, false, nil},
+		"1.2":              {floatLiteral{1.2}, Immutable, false, nil},
+		`"bql"`:            {stringLiteral{"bql"}, Immutable, false, nil},
+		"*":                {wildcardAST{}, Stable, true, nil},
+		"x:*":              {wildcardAST{"x"}, Stable, true, nil},
 		// Type Cast
 		"CAST(2 AS FLOAT)": {typeCastAST{numericLiteral{2}, parser.Float}, Immutable, false, nil},
 		// Function Application
@@ -47,12 +48,12 @@ func TestFlatExpressionConverter(t *testing.T) {
 			[]FlatExpression{rowValue{"", "a"}}}, boolLiteral{true}}}, Volatile, false, []rowValue{{"", "a"}}},
 		// Maps
 		"{}":          {mapAST{[]keyValuePair{}}, Immutable, false, nil},
-		`{"hoge": 2}`: {mapAST{[]keyValuePair{{"hoge", numericLiteral{2}}}}, Immutable, false, nil},
-		`{"a": *}`:    {mapAST{[]keyValuePair{{"a", wildcardAST{}}}}, Stable, true, nil},
-		`{"a":a, "now":now()}`: {mapAST{[]keyValuePair{{"a", rowValue{"", "a"}},
-			{"now", stmtMeta{parser.NowMeta}}}}, Stable, false, []rowValue{{"", "a"}}},
+		`{"hoge": 2}`: {mapAST{[]keyValuePair{{"hoge", numericLiteral{2}, nil}}}, Immutable, false, nil},
+		`{"a": *}`:    {mapAST{[]keyValuePair{{"a", wildcardAST{}, nil}}}, Stable, true, nil},
+		`{"a":a, "now":now()}`: {mapAST{[]keyValuePair{{"a", rowValue{"", "a"}, nil},
+			{"now", stmtMeta{parser.NowMeta}, nil}}}, Stable, false, []rowValue{{"", "a"}}},
 		`{"f":f(a),"b":true}`: {mapAST{[]keyValuePair{{"f", funcAppAST{parser.FuncName("f"),
-			[]FlatExpression{rowValue{"", "a"}}}}, {"b", boolLiteral{true}}}}, Volatile, false, []rowValue{{"", "a"}}},
+			[]FlatExpression{rowValue{"", "a"}}}, nil}, {"b", boolLiteral{true}, nil}}}, Volatile, false, []rowValue{{"", "a"}}},
 		// CASE expressions
 		"CASE a WHEN 2 THEN 3 END":            {caseAST{rowValue{"", "a"}, []whenThenPair{{numericLiteral{2}, numericLiteral{3}}}, nullLiteral{}}, Immutable, false, nil},
 		"CASE WHEN true THEN 3 END":           {caseAST{boolLiteral{true}, []whenThenPair{{boolLiteral{true}, numericLiteral{3}}}, nullLiteral{}}, Immutable, false, nil},
@@ -22,7 +22,8 @@ func CanBuildFilterPlan(lp *LogicalPlan, reg udf.FunctionRegistry) bool {
 	return !lp.GroupingStmt &&
 		lp.EmitterType == parser.Rstream &&
 		lp.Relations[0].Unit == parser.Tuples &&
-		lp.Relations[0].Value == 1
+		lp.Relations[0].Value == 1 &&
+		lp.Relations[0].Slide.Unit == parser.UnspecifiedIntervalUnit
 }
 
 // NewFilterPlan creates a fast and simple plan for the case where the
@@ -31,22 +32,29 @@ func CanBuildFilterPlan(lp *LogicalPlan, reg udf.FunctionRegistry) bool {
 // perform the check with less memory and faster than the default plan.
 func NewFilterPlan(lp *LogicalPlan, reg udf.FunctionRegistry) (PhysicalPlan, error) {
 	// prepare projection components
-	projs, err := prepareProjections(lp.Projections, reg)
+	projs, subexprs, err := prepareProjections(lp.Projections, reg, lp.CaseInsensitive)
 	if err != nil {
 		return nil, err
 	}
 	// compute evaluator for the filter
-	filter, err := prepareFilter(lp.Filter, reg)
+	filter, err := prepareFilter(lp.Filter, reg, lp.CaseInsensitive)
 	if err != nil {
 		return nil, err
 	}
 	return &filterPlan{commonExecutionPlan{
 		projections: projs,
+		subexprs:    subexprs,
 		filter:      filter,
+		ctx:         reg.Context(),
 	}, lp.Relations[0].Alias}, nil
 }
 
 func (ep *filterPlan) Process(input *core.Tuple) ([]data.Map, error) {
+	// this plan has no window, so a heartbeat doesn't change anything
+	if input.Flags.IsSet(core.TFHeartbeat) {
+		return nil, nil
+	}
+
 	// nest the data in a one-element map using the alias as the key
 	d := data.Map{ep.relAlias: input.Data}
 	setMetadata(d, ep.relAlias, input)
@@ -55,7 +63,7 @@ func (ep *filterPlan) Process(input *core.Tuple) ([]data.Map, error) {
 
 	// add the information accessed by the now() function
 	// to each item
-	d[":meta:NOW"] = data.Timestamp(time.Now().In(time.UTC))
+	d[":meta:NOW"] = data.Timestamp(ep.ctx.Now().In(time.UTC))
 
 	// evaluate filter condition and convert to bool
 	if ep.filter != nil {
@@ -79,6 +87,7 @@ func (ep *filterPlan) Process(input *core.Tuple) ([]data.Map, error) {
 		}
 	}
 	// otherwise, compute all the expressions
+	ep.subexprs.reset()
 	result := data.Map(make(map[string]data.Value, len(ep.projections)))
 	for _, proj := range ep.projections {
 		value, err := proj.evaluator.Eval(d)
@@ -457,3 +457,61 @@ func BenchmarkFilterWithWhere(b *testing.B) {
 		}
 	}
 }
+
+func TestFilterPlanCaseInsensitive(t *testing.T) {
+	createPlan := func(s string) PhysicalPlan {
+		p := parser.New()
+		reg := udf.CopyGlobalUDFRegistry(core.NewContext(nil))
+		_stmt, _, err := p.ParseStmt(s)
+		So(err, ShouldBeNil)
+		So(_stmt, ShouldHaveSameTypeAs, parser.CreateStreamAsSelectStmt{})
+		stmt := _stmt.(parser.CreateStreamAsSelectStmt)
+		logicalPlan, err := Analyze(stmt.Select, reg)
+		So(err, ShouldBeNil)
+		logicalPlan.CaseInsensitive = stmt.CaseInsensitive == parser.Yes
+		plan, err := NewFilterPlan(logicalPlan, reg)
+		So(err, ShouldBeNil)
+		return plan
+	}
+
+	Convey("Given a tuple having a key with upper case letters", t, func() {
+		tup := core.NewTuple(data.Map{"Temp": data.Float(25.5)})
+
+		Convey("When using a case-insensitive SELECT statement", func() {
+			plan := createPlan(`CREATE STREAM box CASE INSENSITIVE AS SELECT RSTREAM temp, TEMP AS t2
+				FROM src [RANGE 1 TUPLES] WHERE temp > 20.0`)
+
+			Convey("Then the key should be found using a different case", func() {
+				out, err := plan.Process(tup)
+				So(err, ShouldBeNil)
+				So(len(out), ShouldEqual, 1)
+				So(out[0], ShouldResemble, data.Map{
+					"temp": data.Float(25.5),
+					"t2":   data.Float(25.5),
+				})
+			})
+		})
+
+		Convey("When using a case-sensitive SELECT statement", func() {
+			plan := createPlan(`CREATE STREAM box AS SELECT RSTREAM temp
+				FROM src [RANGE 1 TUPLES] WHERE temp > 20.0`)
+
+			Convey("Then the key should not be found using a different case", func() {
+				_, err := plan.Process(tup)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When using a case-sensitive SELECT statement with the exact case", func() {
+			plan := createPlan(`CREATE STREAM box CASE SENSITIVE AS SELECT RSTREAM Temp AS t
+				FROM src [RANGE 1 TUPLES] WHERE Temp > 20.0`)
+
+			Convey("Then the key should be found", func() {
+				out, err := plan.Process(tup)
+				So(err, ShouldBeNil)
+				So(len(out), ShouldEqual, 1)
+				So(out[0], ShouldResemble, data.Map{"t": data.Float(25.5)})
+			})
+		})
+	})
+}
@@ -0,0 +1,46 @@
+package execution
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// groupKey has values of expressions in a GROUP BY clause computed for a row,
+// in order of the expressions.
+//
+// Two rows belong to the same group when their keys are equal. Unlike
+// comparison operators in expressions, which return NULL when either operand
+// is NULL, NULLs are regarded as equal to each other in keys as in SQL. All
+// rows having NULL for a grouping expression are therefore put into one group,
+// which is distinct from groups having non-NULL values. This is the same rule
+// as data.Equal, which is also used to compare result rows of ISTREAM and
+// DSTREAM.
+type groupKey data.Array
+
+// hash returns the hash value of the key. Keys equal to each other have the
+// same hash value.
+func (k groupKey) hash() data.HashValue {
+	return data.Hash(data.Array(k))
+}
+
+// equal returns true when k and o represent the same group.
+func (k groupKey) equal(o groupKey) bool {
+	if len(k) != len(o) {
+		return false
+	}
+	for i, v := range k {
+		if !groupValueEqual(v, o[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// groupValueEqual compares two values of a grouping expression. NULL is
+// equal to NULL and isn't equal to any other value.
+func groupValueEqual(v1, v2 data.Value) bool {
+	n1, n2 := v1.Type() == data.TypeNull, v2.Type() == data.TypeNull
+	if n1 || n2 {
+		return n1 && n2
+	}
+	return data.Equal(v1, v2)
+}
@@ -0,0 +1,42 @@
+package execution
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestGroupKey(t *testing.T) {
+	Convey("Given group keys", t, func() {
+		cases := []struct {
+			title    string
+			k1, k2   groupKey
+			expected bool
+		}{
+			{"NULLs", groupKey{data.Null{}}, groupKey{data.Null{}}, true},
+			{"NULL and a value", groupKey{data.Null{}}, groupKey{data.Int(0)}, false},
+			{"a value and NULL", groupKey{data.String("")}, groupKey{data.Null{}}, false},
+			{"NULLs with other values", groupKey{data.Int(1), data.Null{}}, groupKey{data.Int(1), data.Null{}}, true},
+			{"NULLs with different values", groupKey{data.Int(1), data.Null{}}, groupKey{data.Int(2), data.Null{}}, false},
+			{"an int and a float", groupKey{data.Int(2)}, groupKey{data.Float(2)}, true},
+			{"nested NULLs", groupKey{data.Array{data.Null{}}}, groupKey{data.Array{data.Null{}}}, true},
+			{"different lengths", groupKey{data.Null{}}, groupKey{data.Null{}, data.Null{}}, false},
+		}
+
+		for _, c := range cases {
+			c := c
+			Convey("When comparing "+c.title, func() {
+				Convey("Then the result should be correct", func() {
+					So(c.k1.equal(c.k2), ShouldEqual, c.expected)
+					So(c.k2.equal(c.k1), ShouldEqual, c.expected)
+				})
+
+				if c.expected {
+					Convey("Then they should have the same hash value", func() {
+						So(c.k1.hash(), ShouldEqual, c.k2.hash())
+					})
+				}
+			})
+		}
+	})
+}
@@ -9,6 +9,13 @@ import (
 
 type groupbyExecutionPlan struct {
 	streamRelationStreamExecutionPlan
+	// skipEmptyWindow is true when no row should be emitted for a window
+	// having no row matching the statement.
+	skipEmptyWindow bool
+	// incremental maintains the results of aggregate functions when all
+	// of them can be computed incrementally. It's nil when aggregates are
+	// recomputed from the whole window every time.
+	incremental *incrementalAggregation
 }
 
 // tmpGroupData is an intermediate data structure to represent
@@ -16,7 +23,7 @@ type groupbyExecutionPlan struct {
 type tmpGroupData struct {
 	// this is the group (e.g. [1, "toy"]), where the values are
 	// in order of the items in the GROUP BY clause
-	group data.Array
+	group groupKey
 	// for each aggregate function, we hold an array with the
 	// input values.
 	aggData map[string][]data.Value
@@ -46,9 +53,25 @@ func NewGroupbyExecutionPlan(lp *LogicalPlan, reg udf.FunctionRegistry) (Physica
 	if err != nil {
 		return nil, err
 	}
-	return &groupbyExecutionPlan{
-		*underlying,
-	}, nil
+	ep := &groupbyExecutionPlan{
+		streamRelationStreamExecutionPlan: *underlying,
+		skipEmptyWindow:                   lp.SkipEmptyWindow,
+	}
+
+	// use accumulators instead of recomputing aggregates when possible
+	projs, incremental, err := newIncrementalAggregation(lp, reg, ep.groupList)
+	if err != nil {
+		return nil, err
+	}
+	if incremental != nil {
+		ep.projections, ep.subexprs, err = prepareProjections(projs, reg, lp.CaseInsensitive)
+		if err != nil {
+			return nil, err
+		}
+		ep.incremental = incremental
+		ep.rowObserver = incremental
+	}
+	return ep, nil
 }
 
 // Process takes an input tuple and returns a slice of Map values that
@@ -76,7 +99,13 @@ func (ep *groupbyExecutionPlan) performQueryOnBuffer() error {
 	// remember the previous results
 	ep.prevResults = ep.curResults
 
-	rollback := func() {
+	var err error
+	if ep.incremental != nil {
+		output, err = ep.evalIncrementalGroups(output)
+	} else {
+		output, err = ep.evalGroups(output)
+	}
+	if err != nil {
 		// NB. ep.prevResults currently points to an slice with
 		//     results from the previous run. ep.curResults points
 		//     to the same slice. output points to a different slice
@@ -88,8 +117,16 @@ func (ep *groupbyExecutionPlan) performQueryOnBuffer() error {
 		//     different underlying arrays or ISTREAM/DSTREAM will
 		//     return wrong results.
 		ep.prevResults = output
+		return err
 	}
+	ep.curResults = output
+	return nil
+}
 
+// evalGroups groups the rows in ep.filteredInputRows, calls the aggregate
+// functions with all input values of each group, and appends the results
+// to output.
+func (ep *groupbyExecutionPlan) evalGroups(output []resultRow) ([]resultRow, error) {
 	// collect a list of all aggregate parameter evaluators in all
 	// projections. this is necessary to avoid duplicate evaluation
 	// if the same parameter is used in multiple aggregation funcs.
@@ -111,7 +148,7 @@ func (ep *groupbyExecutionPlan) performQueryOnBuffer() error {
 	// groupValues in the `groups`map. if there is no such
 	// group, a new one is created and a copy of the given map
 	// is used as a representative of this group's values.
-	findOrCreateGroup := func(groupValues []data.Value, groupHash data.HashValue, nonGroupValues data.Map) (*tmpGroupData, error) {
+	findOrCreateGroup := func(groupValues groupKey, groupHash data.HashValue, nonGroupValues data.Map) (*tmpGroupData, error) {
 		mkGroup := func() *tmpGroupData {
 			newGroup := &tmpGroupData{
 				// the values that make up this group
@@ -144,7 +181,7 @@ func (ep *groupbyExecutionPlan) performQueryOnBuffer() error {
 			// if we arrive here, there is a group with the same hash value
 			// but we need to validate the data is actually the same
 			for _, groupCandidate := range groupCandidates {
-				if data.Equal(data.Array(groupValues), groupCandidate.group) {
+				if groupValues.equal(groupCandidate.group) {
 					group = groupCandidate
 					break
 				}
@@ -184,10 +221,10 @@ func (ep *groupbyExecutionPlan) performQueryOnBuffer() error {
 				itemGroupValues[i] = value
 			}
 			io.cache = itemGroupValues
-			io.hash = data.Hash(io.cache)
+			io.hash = groupKey(itemGroupValues).hash()
 		}
 
-		itemGroup, err := findOrCreateGroup(itemGroupValues, io.hash, *io.input)
+		itemGroup, err := findOrCreateGroup(groupKey(itemGroupValues), io.hash, *io.input)
 		if err != nil {
 			return err
 		}
@@ -205,67 +242,37 @@ func (ep *groupbyExecutionPlan) performQueryOnBuffer() error {
 		return nil
 	}
 
-	evalGroup := func(group *tmpGroupData) error {
-		result := data.Map(make(map[string]data.Value, len(ep.projections)))
-		// collect input for aggregate functions into an array
-		// within each group
-		for key := range allAggEvaluators {
-			group.nonAggData[key] = data.Array(group.aggData[key])
-			delete(group.aggData, key)
-		}
-		// evaluate HAVING condition, if there is one
-		for _, proj := range ep.projections {
-			if proj.alias == ":having:" {
-				havingResult, err := proj.evaluator.Eval(group.nonAggData)
-				if err != nil {
-					return err
-				}
-				// a NULL value is definitely not "true", so since we
-				// have only a binary decision, we should drop tuples
-				// where the condition evaluates to NULL
-				havingResultBool := false
-				if havingResult.Type() != data.TypeNull {
-					havingResultBool, err = data.AsBool(havingResult)
-					if err != nil {
-						return err
-					}
-				}
-				// if it evaluated to false, do not further process this group
-				if !havingResultBool {
-					return nil
-				}
-				break
-			}
+	// compute the output for each item in ep.filteredInputRows
+	for e := ep.filteredInputRows.Front(); e != nil; e = e.Next() {
+		item := e.Value.(*inputRowWithCachedResult)
+		if err := evalItem(item); err != nil {
+			return output, err
 		}
-		// now evaluate all other projections
-		for _, proj := range ep.projections {
-			if proj.alias == ":having:" {
-				continue
+	}
+
+	// if we arrive here, then the input for the aggregation functions
+	// is in the `group` list and we need to compute aggregation and output.
+	// NB. we do not directly loop over the `groups` map to avoid random order.
+	for _, groupKey := range groupKeys {
+		groupsWithSameHash := groups[groupKey]
+		for _, group := range groupsWithSameHash {
+			// collect input for aggregate functions into an array
+			// within each group
+			for key := range allAggEvaluators {
+				group.nonAggData[key] = data.Array(group.aggData[key])
+				delete(group.aggData, key)
 			}
-			// now evaluate this projection on the flattened data
-			value, err := proj.evaluator.Eval(group.nonAggData)
+			res, err := ep.evalGroup(group.nonAggData)
 			if err != nil {
-				return err
+				return output, err
 			}
-			if err := assignOutputValue(result, proj.alias, proj.aliasPath, value); err != nil {
-				return err
+			if res != nil {
+				output = append(output, *res)
 			}
 		}
-		output = append(output, resultRow{row: result, hash: data.Hash(result)})
-		return nil
 	}
-
-	evalNoGroup := func() error {
-		// if we have an empty group list *and* a GROUP BY clause,
-		// we have to return an empty result (because there are no
-		// rows with "the same values"). but if the list is empty and
-		// we *don't* have a GROUP BY clause, then we need to compute
-		// all foldables and aggregates with an empty input
-		if len(ep.groupList) > 0 {
-			return nil
-		}
+	if len(groups) == 0 {
 		input := data.Map{}
-		result := data.Map(make(map[string]data.Value, len(ep.projections)))
 		for _, proj := range ep.projections {
 			// collect input for aggregate functions
 			if proj.hasAggregate {
@@ -273,51 +280,134 @@ func (ep *groupbyExecutionPlan) performQueryOnBuffer() error {
 					input[key] = data.Array{}
 				}
 			}
-			// now evaluate this projection on the flattened data.
-			// note that input has *only* the keys of the empty
-			// arrays, no other columns, but we cannot have other
-			// columns involved in the projection (since we know
-			// that GROUP BY is empty).
-			value, err := proj.evaluator.Eval(input)
-			if err != nil {
-				return err
-			}
-			if err := assignOutputValue(result, proj.alias, proj.aliasPath, value); err != nil {
-				return err
-			}
 		}
-		output = append(output, resultRow{row: result, hash: data.Hash(result)})
-		return nil
+		res, err := ep.evalNoGroup(input)
+		if err != nil {
+			return output, err
+		}
+		if res != nil {
+			output = append(output, *res)
+		}
 	}
+	return output, nil
+}
 
-	// compute the output for each item in ep.filteredInputRows
-	for e := ep.filteredInputRows.Front(); e != nil; e = e.Next() {
-		item := e.Value.(*inputRowWithCachedResult)
-		if err := evalItem(item); err != nil {
-			rollback()
-			return err
+// evalIncrementalGroups appends the results computed from the accumulators
+// of each group to output.
+func (ep *groupbyExecutionPlan) evalIncrementalGroups(output []resultRow) ([]resultRow, error) {
+	if err := ep.incremental.err(); err != nil {
+		return output, err
+	}
+	groups := ep.incremental.sortedGroups()
+	for _, g := range groups {
+		input, err := ep.incremental.groupInput(g)
+		if err != nil {
+			return output, err
+		}
+		res, err := ep.evalGroup(input)
+		if err != nil {
+			return output, err
+		}
+		if res != nil {
+			output = append(output, *res)
+		}
+	}
+	if len(groups) == 0 {
+		input, err := ep.incremental.emptyInput()
+		if err != nil {
+			return output, err
+		}
+		res, err := ep.evalNoGroup(input)
+		if err != nil {
+			return output, err
+		}
+		if res != nil {
+			output = append(output, *res)
 		}
 	}
+	return output, nil
+}
 
-	// if we arrive here, then the input for the aggregation functions
-	// is in the `group` list and we need to compute aggregation and output.
-	// NB. we do not directly loop over the `groups` map to avoid random order.
-	for _, groupKey := range groupKeys {
-		groupsWithSameHash := groups[groupKey]
-		for _, group := range groupsWithSameHash {
-			if err := evalGroup(group); err != nil {
-				rollback()
-				return err
+// evalGroup evaluates the HAVING condition and the projections on the input
+// of a group, which has the values of aggregate inputs or the results of
+// aggregate functions in addition to the columns of a row in the group. It
+// returns nil when the group doesn't satisfy the HAVING condition.
+func (ep *groupbyExecutionPlan) evalGroup(input data.Map) (*resultRow, error) {
+	ep.subexprs.reset()
+	result := data.Map(make(map[string]data.Value, len(ep.projections)))
+	// evaluate HAVING condition, if there is one
+	for _, proj := range ep.projections {
+		if proj.alias == ":having:" {
+			havingResult, err := proj.evaluator.Eval(input)
+			if err != nil {
+				return nil, err
+			}
+			// a NULL value is definitely not "true", so since we
+			// have only a binary decision, we should drop tuples
+			// where the condition evaluates to NULL
+			havingResultBool := false
+			if havingResult.Type() != data.TypeNull {
+				havingResultBool, err = data.AsBool(havingResult)
+				if err != nil {
+					return nil, err
+				}
+			}
+			// if it evaluated to false, do not further process this group
+			if !havingResultBool {
+				return nil, nil
 			}
+			break
 		}
 	}
-	if len(groups) == 0 {
-		if err := evalNoGroup(); err != nil {
-			rollback()
-			return err
+	// now evaluate all other projections
+	for _, proj := range ep.projections {
+		if proj.alias == ":having:" {
+			continue
+		}
+		// now evaluate this projection on the flattened data
+		value, err := proj.evaluator.Eval(input)
+		if err != nil {
+			return nil, err
+		}
+		if err := assignOutputValue(result, proj.alias, proj.aliasPath, value); err != nil {
+			return nil, err
 		}
 	}
+	return &resultRow{row: result, hash: data.Hash(result)}, nil
+}
 
-	ep.curResults = output
-	return nil
+// evalNoGroup computes the row emitted for a window having no input row.
+// input has the values of aggregate inputs or the results of aggregate
+// functions computed from an empty input. It returns nil when no row is
+// emitted.
+func (ep *groupbyExecutionPlan) evalNoGroup(input data.Map) (*resultRow, error) {
+	// if we have an empty group list *and* a GROUP BY clause,
+	// we have to return an empty result (because there are no
+	// rows with "the same values"). but if the list is empty and
+	// we *don't* have a GROUP BY clause, then we need to compute
+	// all foldables and aggregates with an empty input
+	if len(ep.groupList) > 0 {
+		return nil, nil
+	}
+	// the same applies when the statement has [SKIP EMPTY] option
+	if ep.skipEmptyWindow {
+		return nil, nil
+	}
+	ep.subexprs.reset()
+	result := data.Map(make(map[string]data.Value, len(ep.projections)))
+	for _, proj := range ep.projections {
+		// now evaluate this projection on the flattened data.
+		// note that input has *only* the keys of the aggregates,
+		// no other columns, but we cannot have other columns
+		// involved in the projection (since we know that GROUP BY
+		// is empty).
+		value, err := proj.evaluator.Eval(input)
+		if err != nil {
+			return nil, err
+		}
+		if err := assignOutputValue(result, proj.alias, proj.aliasPath, value); err != nil {
+			return nil, err
+		}
+	}
+	return &resultRow{row: result, hash: data.Hash(result)}, nil
 }
@@ -227,6 +227,103 @@ func TestGroupbyExecutionPlan(t *testing.T) {
 		})
 	})
 
+	Convey("Given a SELECT clause with count and count DISTINCT", t, func() {
+		tuples := getOtherTuples()
+		// int will be 1, 1, 2, 1
+		tuples[1].Data["int"] = data.Int(1)
+		tuples[2].Data["int"] = data.Int(2)
+		tuples[3].Data["int"] = data.Int(1)
+
+		s := `CREATE STREAM box AS SELECT RSTREAM count(int) AS a,
+			count(DISTINCT int) AS b FROM src [RANGE 3 TUPLES]`
+		plan, err := createGroupbyPlan(s, t)
+		So(err, ShouldBeNil)
+
+		Convey("When feeding it with tuples", func() {
+			expected := []data.Map{
+				{"a": data.Int(1), "b": data.Int(1)},
+				{"a": data.Int(2), "b": data.Int(1)},
+				{"a": data.Int(3), "b": data.Int(2)},
+				{"a": data.Int(3), "b": data.Int(2)},
+			}
+			for idx, inTup := range tuples {
+				out, err := plan.Process(inTup)
+				So(err, ShouldBeNil)
+
+				Convey(fmt.Sprintf("Then duplicates should only be removed from b in %v", idx), func() {
+					So(len(out), ShouldEqual, 1)
+					So(out[0], ShouldResemble, expected[idx])
+				})
+			}
+		})
+	})
+
+	Convey("Given a SELECT clause with aggregates having FILTER clauses", t, func() {
+		tuples := getOtherTuples()
+		s := `CREATE STREAM box AS SELECT RSTREAM count(*) FILTER (WHERE foo = 2) AS a,
+			sum(int) FILTER (WHERE int % 2 = 1) AS b,
+			array_agg(int ORDER BY int DESC) FILTER (WHERE foo = 1) AS c FROM src [RANGE 3 TUPLES]`
+		plan, err := createGroupbyPlan(s, t)
+		So(err, ShouldBeNil)
+
+		Convey("When feeding it with tuples", func() {
+			expected := []data.Map{
+				{"a": data.Int(0), "b": data.Int(1), "c": data.Array{data.Int(1)}},
+				{"a": data.Int(0), "b": data.Int(1), "c": data.Array{data.Int(2), data.Int(1)}},
+				{"a": data.Int(1), "b": data.Int(4), "c": data.Array{data.Int(2), data.Int(1)}},
+				{"a": data.Int(2), "b": data.Int(3), "c": data.Array{data.Int(2)}},
+			}
+			for idx, inTup := range tuples {
+				out, err := plan.Process(inTup)
+				So(err, ShouldBeNil)
+
+				Convey(fmt.Sprintf("Then only rows satisfying the conditions should be aggregated in %v", idx), func() {
+					So(len(out), ShouldEqual, 1)
+					So(out[0], ShouldResemble, expected[idx])
+				})
+			}
+		})
+	})
+
+	Convey("Given a SELECT clause with an invalid FILTER clause", t, func() {
+		for _, s := range []string{
+			`CREATE STREAM box AS SELECT RSTREAM abs(int) FILTER (WHERE foo = 1) FROM src [RANGE 3 TUPLES]`,
+			`CREATE STREAM box AS SELECT RSTREAM count(*) FILTER (WHERE count(int) > 1) FROM src [RANGE 3 TUPLES]`,
+		} {
+			Convey("When creating a plan for "+s, func() {
+				_, err := createGroupbyPlan(s, t)
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+
+	Convey("Given a SELECT DISTINCT clause with GROUP BY", t, func() {
+		tuples := getOtherTuples()
+		s := `CREATE STREAM box AS SELECT RSTREAM DISTINCT foo FROM src [RANGE 3 TUPLES] GROUP BY foo, int`
+		plan, err := createGroupbyPlan(s, t)
+		So(err, ShouldBeNil)
+
+		Convey("When feeding it with tuples", func() {
+			expected := [][]data.Map{
+				{{"foo": data.Int(1)}},
+				{{"foo": data.Int(1)}},
+				{{"foo": data.Int(1)}, {"foo": data.Int(2)}},
+				{{"foo": data.Int(1)}, {"foo": data.Int(2)}},
+			}
+			for idx, inTup := range tuples {
+				out, err := plan.Process(inTup)
+				So(err, ShouldBeNil)
+
+				Convey(fmt.Sprintf("Then duplicated groups should be emitted once in %v", idx), func() {
+					So(out, ShouldResemble, expected[idx])
+				})
+			}
+		})
+	})
+
 	Convey("Given a SELECT clause with a simple aggregation and GROUP BY", t, func() {
 		tuples := getOtherTuples()
 		tuples[3].Data["int"] = data.Null{} // NULL should not be counted
@@ -726,6 +823,33 @@ func TestGroupbyExecutionPlan(t *testing.T) {
 		})
 	})
 
+	Convey("Given a SELECT clause with GROUP BY on a column having NULLs", t, func() {
+		tuples := getOtherTuples()
+		tuples[0].Data["foo"] = data.Null{}
+		tuples[2].Data["foo"] = data.Null{}
+		s := `CREATE STREAM box AS SELECT RSTREAM foo, count(*) AS c FROM src [RANGE 4 TUPLES] GROUP BY foo`
+		plan, err := createGroupbyPlan(s, t)
+		So(err, ShouldBeNil)
+
+		Convey("When feeding it with tuples", func() {
+			var out []data.Map
+			for _, inTup := range tuples {
+				out, err = plan.Process(inTup)
+				So(err, ShouldBeNil)
+			}
+
+			Convey("Then tuples having NULL should form a single group", func() {
+				So(len(out), ShouldEqual, 3)
+				So(out[0], ShouldResemble,
+					data.Map{"foo": data.Null{}, "c": data.Int(2)})
+				So(out[1], ShouldResemble,
+					data.Map{"foo": data.Int(1), "c": data.Int(1)})
+				So(out[2], ShouldResemble,
+					data.Map{"foo": data.Int(2), "c": data.Int(1)})
+			})
+		})
+	})
+
 	Convey("Given a SELECT clause with a JOIN and two columns in the GROUP BY clause", t, func() {
 		tuples := getOtherTuples()
 		s := `CREATE STREAM box AS SELECT RSTREAM count(b:foo) FROM
@@ -0,0 +1,431 @@
+package execution
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+)
+
+// inputRowObserver is notified when an input row enters or leaves the
+// window of a streamRelationStreamExecutionPlan. It's only used when the
+// statement doesn't have an explicit join, since rows of a join are
+// recomputed from all buffers.
+type inputRowObserver interface {
+	rowAdded(r *inputRowWithCachedResult)
+	rowRemoved(r *inputRowWithCachedResult)
+}
+
+// incrementalAggregation maintains the results of aggregate functions
+// implementing udf.IncrementalAggregate for each group of the input rows
+// in the window. Rows are added to and removed from accumulators as they
+// enter and leave the window, so a statement doesn't have to call the
+// aggregate functions with all values in the window every time it's
+// evaluated.
+//
+// Errors occurring while a row is accumulated, e.g. when evaluating the
+// GROUP BY clause, are reported by err as long as the row stays in the
+// window, in the same way as a plan recomputing aggregates from the whole
+// window fails.
+type incrementalAggregation struct {
+	ctx       *core.Context
+	groupList []Evaluator
+	// inputs has the evaluators of the aggregate inputs. A value
+	// evaluated by inputs[i] is passed to each aggregate whose input
+	// is i.
+	inputs []Evaluator
+	aggs   []incrementalAggregate
+	groups map[data.HashValue][]*incrementalGroup
+	rows   map[*inputRowWithCachedResult]*accumulatedRow
+	// failed has rows which couldn't be accumulated in the order they
+	// were added.
+	failed *list.List
+	// seq is the sequence number of the next row.
+	seq int64
+}
+
+// incrementalAggregate is a call to an aggregate function whose result
+// is referred to as key in projections.
+type incrementalAggregate struct {
+	key   string
+	f     udf.IncrementalAggregate
+	input int
+}
+
+// incrementalGroup has accumulators of a group of input rows having the
+// same values for GROUP BY expressions. accs[i] corresponds to the i-th
+// aggregate of incrementalAggregation.
+type incrementalGroup struct {
+	key  groupKey
+	accs []udf.Accumulator
+	// rows has accumulatedRows of the group in the order they were
+	// added. The oldest row represents the group's non-aggregate values.
+	rows *list.List
+	// err is set when a value couldn't be removed from an accumulator.
+	err error
+}
+
+// accumulatedRow is an input row whose aggregate inputs have been added
+// to the accumulators of group.
+type accumulatedRow struct {
+	row    *inputRowWithCachedResult
+	seq    int64
+	group  *incrementalGroup
+	inputs []data.Value
+	// err is the error which occurred while accumulating the row. The row
+	// doesn't belong to any group in that case.
+	err  error
+	elem *list.Element
+}
+
+// newIncrementalAggregation rewrites the projections so that each call to an
+// aggregate function implementing udf.IncrementalAggregate refers to the
+// result maintained by the returned incrementalAggregation. It returns nil
+// when aggregates can't be computed incrementally, i.e. when the statement
+// has an explicit join or when any aggregate call doesn't implement the
+// interface, sorts or deduplicates its input, or has an input which isn't
+// deterministic.
+func newIncrementalAggregation(lp *LogicalPlan, reg udf.FunctionRegistry, groupList []Evaluator) ([]aliasedExpression, *incrementalAggregation, error) {
+	if lp.Joins != nil {
+		return nil, nil, nil
+	}
+	b := &incrementalAggregationBuilder{
+		reg:        reg,
+		aggrInputs: map[string]FlatExpression{},
+		aggIdx:     map[string]int{},
+		inputIdx:   map[string]int{},
+		ok:         true,
+	}
+	for _, proj := range lp.Projections {
+		for key, input := range proj.aggrInputs {
+			b.aggrInputs[key] = input
+		}
+	}
+	if len(b.aggrInputs) == 0 {
+		return nil, nil, nil
+	}
+
+	projs := make([]aliasedExpression, len(lp.Projections))
+	for i, proj := range lp.Projections {
+		projs[i] = aliasedExpression{proj.alias, b.replace(proj.expr), nil}
+		if !b.ok {
+			return nil, nil, nil
+		}
+	}
+
+	a := &incrementalAggregation{
+		ctx:       reg.Context(),
+		groupList: groupList,
+		inputs:    make([]Evaluator, len(b.inputKeys)),
+		aggs:      b.aggs,
+		groups:    map[data.HashValue][]*incrementalGroup{},
+		rows:      map[*inputRowWithCachedResult]*accumulatedRow{},
+		failed:    list.New(),
+	}
+	for i, key := range b.inputKeys {
+		eval, err := expressionToEvaluator(b.aggrInputs[key], reg, lp.CaseInsensitive)
+		if err != nil {
+			return nil, nil, err
+		}
+		a.inputs[i] = eval
+	}
+	return projs, a, nil
+}
+
+type incrementalAggregationBuilder struct {
+	reg        udf.FunctionRegistry
+	aggrInputs map[string]FlatExpression
+	aggs       []incrementalAggregate
+	aggIdx     map[string]int
+	inputKeys  []string
+	inputIdx   map[string]int
+	// ok becomes false when an aggregate call which cannot be computed
+	// incrementally is found.
+	ok bool
+}
+
+// replace returns a copy of expr in which calls to aggregate functions are
+// replaced with references to their results.
+func (b *incrementalAggregationBuilder) replace(expr FlatExpression) FlatExpression {
+	replaceAll := func(es []FlatExpression) []FlatExpression {
+		result := make([]FlatExpression, len(es))
+		for i, e := range es {
+			result[i] = b.replace(e)
+		}
+		return result
+	}
+
+	switch obj := expr.(type) {
+	case binaryOpAST:
+		return binaryOpAST{obj.Op, b.replace(obj.Left), b.replace(obj.Right)}
+	case unaryOpAST:
+		return unaryOpAST{obj.Op, b.replace(obj.Expr)}
+	case typeCastAST:
+		return typeCastAST{b.replace(obj.Expr), obj.Target}
+	case funcAppAST:
+		if len(obj.Expressions) == 1 {
+			if ref, ok := obj.Expressions[0].(aggInputRef); ok {
+				return b.aggregate(obj, ref)
+			}
+		}
+		return funcAppAST{obj.Function, replaceAll(obj.Expressions)}
+	case arrayAST:
+		return arrayAST{replaceAll(obj.Expressions)}
+	case likePatternAST:
+		return likePatternAST{b.replace(obj.Pattern), obj.Escape}
+	case mapAST:
+		entries := make([]keyValuePair, len(obj.Entries))
+		for i, p := range obj.Entries {
+			entries[i] = keyValuePair{p.Key, b.replace(p.Value), nil}
+			if p.KeyExpr != nil {
+				entries[i].KeyExpr = b.replace(p.KeyExpr)
+			}
+		}
+		return mapAST{entries}
+	case caseAST:
+		checks := make([]whenThenPair, len(obj.Checks))
+		for i, p := range obj.Checks {
+			checks[i] = whenThenPair{b.replace(p.When), b.replace(p.Then)}
+		}
+		return caseAST{b.replace(obj.Reference), checks, b.replace(obj.Default)}
+	case aggInputRef, aggregateInputSorter:
+		// an aggregate having more than one parameter or having
+		// ORDER BY or DISTINCT
+		b.ok = false
+	}
+	return expr
+}
+
+// aggregate registers a call to an aggregate function having ref as its
+// only parameter and returns the reference to its result.
+func (b *incrementalAggregationBuilder) aggregate(f funcAppAST, ref aggInputRef) FlatExpression {
+	input := b.aggrInputs[ref.Ref]
+	if input == nil || !isDeterministic(input, b.reg) {
+		// the value of a nondeterministic input could differ from the
+		// one computed when the statement is evaluated
+		b.ok = false
+		return f
+	}
+	u, err := b.reg.Lookup(string(f.Function), 1)
+	if err != nil {
+		b.ok = false
+		return f
+	}
+	ia, ok := u.(udf.IncrementalAggregate)
+	if !ok {
+		b.ok = false
+		return f
+	}
+
+	h := sha1.New()
+	h.Write([]byte(fmt.Sprintf("%s(%s)", f.Function, ref.Ref)))
+	key := "i_" + hex.EncodeToString(h.Sum(nil))[:8]
+	if _, ok := b.aggIdx[key]; !ok {
+		idx, ok := b.inputIdx[ref.Ref]
+		if !ok {
+			idx = len(b.inputKeys)
+			b.inputIdx[ref.Ref] = idx
+			b.inputKeys = append(b.inputKeys, ref.Ref)
+		}
+		b.aggIdx[key] = len(b.aggs)
+		b.aggs = append(b.aggs, incrementalAggregate{key, ia, idx})
+	}
+	return aggInputRef{key}
+}
+
+// rowAdded accumulates the aggregate inputs of a row entering the window.
+func (a *incrementalAggregation) rowAdded(io *inputRowWithCachedResult) {
+	r := &accumulatedRow{
+		row: io,
+		seq: a.seq,
+	}
+	a.seq++
+	a.rows[io] = r
+	if err := a.accumulate(r); err != nil {
+		r.err = err
+		r.elem = a.failed.PushBack(r)
+	}
+}
+
+func (a *incrementalAggregation) accumulate(r *accumulatedRow) error {
+	io := r.row
+	if io.cache == nil {
+		values := make(data.Array, len(a.groupList))
+		for i, eval := range a.groupList {
+			v, err := eval.Eval(*io.input)
+			if err != nil {
+				return err
+			}
+			values[i] = v
+		}
+		io.cache = values
+		io.hash = groupKey(values).hash()
+	}
+	values, err := data.AsArray(io.cache)
+	if err != nil {
+		return fmt.Errorf("cached data was not an array: %v", io.cache)
+	}
+
+	r.inputs = make([]data.Value, len(a.inputs))
+	for i, eval := range a.inputs {
+		v, err := eval.Eval(*io.input)
+		if err != nil {
+			return err
+		}
+		r.inputs[i] = v
+	}
+
+	g := a.findGroup(groupKey(values), io.hash)
+	isNew := g == nil
+	if isNew {
+		g = &incrementalGroup{
+			key:  groupKey(values),
+			accs: make([]udf.Accumulator, len(a.aggs)),
+			rows: list.New(),
+		}
+		for i, agg := range a.aggs {
+			acc, err := agg.f.NewAccumulator(a.ctx)
+			if err != nil {
+				return err
+			}
+			g.accs[i] = acc
+		}
+	}
+	for i, agg := range a.aggs {
+		if err := g.accs[i].Add(r.inputs[agg.input]); err != nil {
+			// undo the values added so far so that the group doesn't
+			// have a part of the row
+			for j := 0; j < i; j++ {
+				g.accs[j].Remove(r.inputs[a.aggs[j].input])
+			}
+			return err
+		}
+	}
+	if isNew {
+		a.groups[io.hash] = append(a.groups[io.hash], g)
+	}
+	r.group = g
+	r.elem = g.rows.PushBack(r)
+	return nil
+}
+
+func (a *incrementalAggregation) findGroup(key groupKey, hash data.HashValue) *incrementalGroup {
+	for _, g := range a.groups[hash] {
+		if g.key.equal(key) {
+			return g
+		}
+	}
+	return nil
+}
+
+// rowRemoved removes the aggregate inputs of a row leaving the window from
+// the accumulators.
+func (a *incrementalAggregation) rowRemoved(io *inputRowWithCachedResult) {
+	r, ok := a.rows[io]
+	if !ok {
+		return
+	}
+	delete(a.rows, io)
+	if r.err != nil {
+		a.failed.Remove(r.elem)
+		return
+	}
+
+	g := r.group
+	for i, agg := range a.aggs {
+		if err := g.accs[i].Remove(r.inputs[agg.input]); err != nil && g.err == nil {
+			g.err = err
+		}
+	}
+	g.rows.Remove(r.elem)
+	if g.rows.Len() > 0 {
+		return
+	}
+	gs := a.groups[io.hash]
+	for i, x := range gs {
+		if x == g {
+			gs = append(gs[:i], gs[i+1:]...)
+			break
+		}
+	}
+	if len(gs) == 0 {
+		delete(a.groups, io.hash)
+	} else {
+		a.groups[io.hash] = gs
+	}
+}
+
+// err returns the error of the oldest row in the window which couldn't be
+// accumulated.
+func (a *incrementalAggregation) err() error {
+	if e := a.failed.Front(); e != nil {
+		return e.Value.(*accumulatedRow).err
+	}
+	return nil
+}
+
+// sortedGroups returns all groups in the order of their oldest rows, which
+// is the order in which the groups appear in the window.
+func (a *incrementalAggregation) sortedGroups() []*incrementalGroup {
+	gs := make(incrementalGroups, 0, len(a.groups))
+	for _, x := range a.groups {
+		gs = append(gs, x...)
+	}
+	sort.Sort(gs)
+	return gs
+}
+
+type incrementalGroups []*incrementalGroup
+
+func (g incrementalGroups) Len() int      { return len(g) }
+func (g incrementalGroups) Swap(i, j int) { g[i], g[j] = g[j], g[i] }
+func (g incrementalGroups) Less(i, j int) bool {
+	return g[i].oldest().seq < g[j].oldest().seq
+}
+
+func (g *incrementalGroup) oldest() *accumulatedRow {
+	return g.rows.Front().Value.(*accumulatedRow)
+}
+
+// groupInput returns the input of projections for the group. It has the
+// columns of the group's oldest row and the results of the aggregates.
+func (a *incrementalAggregation) groupInput(g *incrementalGroup) (data.Map, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	row := *g.oldest().row.input
+	input := make(data.Map, len(row)+len(a.aggs))
+	for k, v := range row {
+		input[k] = v
+	}
+	for i, agg := range a.aggs {
+		v, err := g.accs[i].Result()
+		if err != nil {
+			return nil, err
+		}
+		input[agg.key] = v
+	}
+	return input, nil
+}
+
+// emptyInput returns the input of projections for a window having no row.
+// It has the results of the aggregates without any value.
+func (a *incrementalAggregation) emptyInput() (data.Map, error) {
+	input := make(data.Map, len(a.aggs))
+	for _, agg := range a.aggs {
+		acc, err := agg.f.NewAccumulator(a.ctx)
+		if err != nil {
+			return nil, err
+		}
+		v, err := acc.Result()
+		if err != nil {
+			return nil, err
+		}
+		input[agg.key] = v
+	}
+	return input, nil
+}
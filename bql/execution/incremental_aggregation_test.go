@@ -0,0 +1,99 @@
+package execution
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestIncrementalAggregation(t *testing.T) {
+	reg := udf.CopyGlobalUDFRegistry(core.NewContext(nil))
+	reg.Register("udaf", &dummyAggregate{})
+	plans := func(s string) (*groupbyExecutionPlan, *groupbyExecutionPlan) {
+		stmt, _, err := parser.New().ParseStmt(s)
+		So(err, ShouldBeNil)
+		lp, err := Analyze(stmt.(parser.SelectStmt), reg)
+		So(err, ShouldBeNil)
+		p, err := NewGroupbyExecutionPlan(lp, reg)
+		So(err, ShouldBeNil)
+		// the plan recomputing aggregates from the whole window
+		underlying, err := newStreamRelationStreamExecutionPlan(lp, reg)
+		So(err, ShouldBeNil)
+		return p.(*groupbyExecutionPlan), &groupbyExecutionPlan{
+			streamRelationStreamExecutionPlan: *underlying,
+			skipEmptyWindow:                   lp.SkipEmptyWindow,
+		}
+	}
+	tuples := func() []*core.Tuple {
+		ts := getTuples(12)
+		for i, t := range ts {
+			t.Data["g"] = data.Int(i % 3)
+			switch i % 4 {
+			case 1:
+				t.Data["v"] = data.Float(float64(i) / 4)
+			case 2:
+				t.Data["v"] = data.Null{}
+			default:
+				t.Data["v"] = data.Int(i)
+			}
+		}
+		// a value which sum and avg cannot accept
+		ts[5].Data["v"] = data.String("x")
+		return ts
+	}
+
+	for _, s := range []string{
+		`SELECT RSTREAM g, count(v) AS c, sum(v) AS s, avg(v) AS a FROM src [RANGE 4 TUPLES] GROUP BY g`,
+		`SELECT ISTREAM sum(v) + count(*) AS x, count(v) / 2 AS y FROM src [RANGE 3 SECONDS]`,
+		`SELECT DSTREAM g, sum(v * 2) AS s FROM src [RANGE 5 TUPLES] WHERE int > 2 GROUP BY g HAVING count(*) > 1`,
+	} {
+		s := s
+
+		Convey("Given the statement "+s, t, func() {
+			incremental, recomputing := plans(s)
+			So(incremental.incremental, ShouldNotBeNil)
+
+			Convey("When processing tuples", func() {
+				for _, tup := range tuples() {
+					expected, expectedErr := recomputing.Process(tup)
+					actual, err := incremental.Process(tup)
+
+					Convey("Then the results should be the same as recomputed ones at "+tup.Data["int"].String(), func() {
+						if expectedErr != nil {
+							So(err, ShouldNotBeNil)
+							return
+						}
+						So(err, ShouldBeNil)
+						So(actual, ShouldResemble, expected)
+					})
+				}
+
+				Convey("Then rows leaving the window should be removed from accumulators", func() {
+					So(len(incremental.incremental.rows), ShouldEqual, incremental.filteredInputRows.Len())
+				})
+			})
+		})
+	}
+
+	Convey("Given statements which cannot be computed incrementally", t, func() {
+		for _, s := range []string{
+			`SELECT RSTREAM median(int) FROM src [RANGE 2 TUPLES]`,
+			`SELECT RSTREAM count(DISTINCT int) FROM src [RANGE 2 TUPLES]`,
+			`SELECT RSTREAM count(*) FILTER (WHERE int > 1) FROM src [RANGE 2 TUPLES]`,
+			`SELECT RSTREAM sum(int), udaf(int) FROM src [RANGE 2 TUPLES]`,
+			`SELECT RSTREAM sum(random()) FROM src [RANGE 2 TUPLES]`,
+			`SELECT RSTREAM count(*) FROM a [RANGE 2 TUPLES] LEFT JOIN b [RANGE 2 TUPLES] ON a:x = b:x`,
+		} {
+			Convey("When creating a plan for "+s, func() {
+				p, _ := plans(s)
+
+				Convey("Then it should recompute aggregates", func() {
+					So(p.incremental, ShouldBeNil)
+				})
+			})
+		}
+	})
+}
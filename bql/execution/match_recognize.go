@@ -0,0 +1,314 @@
+package execution
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// MatchPrevRelation is the name referring to the previous row of a partial
+// match in conditions of a DEFINE clause, as in `DEFINE b AS v > prev:v`.
+// It evaluates to NULL at the first row of a match.
+const MatchPrevRelation = "prev"
+
+// matchRecognizeMaxRuns is the maximum number of partial matches kept for
+// each partition. The oldest ones are discarded when there are more.
+const matchRecognizeMaxRuns = 1024
+
+// MatchRecognizer finds sequences of rows matching the pattern of a
+// MATCH_RECOGNIZE clause. Rows are partitioned by the PARTITION BY
+// expressions and each partition is matched independently by a
+// nondeterministic finite automaton whose states are positions in the
+// pattern.
+//
+// A match is reported as soon as a row completes the pattern, and matching
+// restarts from the row following the match. When more than one partial
+// match is completed by the same row, the one which started first is
+// reported.
+//
+// In a condition of the DEFINE clause, a column without a relation refers
+// to the row being matched, a pattern variable refers to the last row bound
+// to it, and MatchPrevRelation refers to the previous row of the match.
+// Columns of MEASURES must be prefixed by pattern variables. A variable
+// without any bound row evaluates to NULL, and a condition evaluating to
+// NULL doesn't match.
+type MatchRecognizer struct {
+	partitionBy []Evaluator
+	measures    []matchMeasure
+	pattern     []matchPatternElem
+	// optionalFrom[i] is true when all elements from i can match no rows.
+	optionalFrom []bool
+	partitions   map[data.HashValue][]*matchPartition
+}
+
+type matchMeasure struct {
+	alias string
+	path  data.Path
+	eval  Evaluator
+}
+
+type matchPatternElem struct {
+	parser.MatchPatternElemAST
+	// cond is nil when the variable matches any row.
+	cond Evaluator
+}
+
+type matchPartition struct {
+	key  groupKey
+	runs []*matchRun
+}
+
+// matchRun is a partial match. elem is the index of the pattern element
+// which matched the last row and count is the number of rows it has
+// matched so far.
+type matchRun struct {
+	elem  int
+	count int64
+	// vars has the last row bound to each pattern variable and the last
+	// row of the match as MatchPrevRelation.
+	vars data.Map
+}
+
+// NewMatchRecognizer creates a MatchRecognizer from the given clause.
+func NewMatchRecognizer(mr *parser.MatchRecognizeAST, reg udf.FunctionRegistry) (*MatchRecognizer, error) {
+	if len(mr.Pattern) == 0 {
+		return nil, fmt.Errorf("the pattern of MATCH_RECOGNIZE is empty")
+	}
+	vars := map[string]bool{}
+	for _, p := range mr.Pattern {
+		if p.Var == MatchPrevRelation {
+			return nil, fmt.Errorf("'%v' cannot be used as a pattern variable", p.Var)
+		}
+		vars[p.Var] = true
+	}
+	toEvaluator := func(expr parser.Expression) (Evaluator, error) {
+		flatExpr, err := ParserExprToFlatExpr(expr, reg)
+		if err != nil {
+			return nil, err
+		}
+		return ExpressionToEvaluator(flatExpr, reg)
+	}
+
+	m := &MatchRecognizer{
+		partitions: map[data.HashValue][]*matchPartition{},
+	}
+	for _, expr := range mr.PartitionBy {
+		for rel := range expr.ReferencedRelations() {
+			if rel != "" {
+				return nil, fmt.Errorf("stream prefixes cannot be used in PARTITION BY: %v", rel)
+			}
+		}
+		eval, err := toEvaluator(expr)
+		if err != nil {
+			return nil, err
+		}
+		m.partitionBy = append(m.partitionBy, eval)
+	}
+
+	for _, expr := range mr.Measures {
+		alias, ok := expr.(parser.AliasAST)
+		if !ok {
+			return nil, fmt.Errorf("a measure must have a name: %v", expr)
+		}
+		for rel := range alias.Expr.ReferencedRelations() {
+			if !vars[rel] {
+				return nil, fmt.Errorf("columns in MEASURES must be prefixed by a pattern variable: %v", alias.Expr)
+			}
+		}
+		eval, err := toEvaluator(alias.Expr)
+		if err != nil {
+			return nil, err
+		}
+		var path data.Path
+		if alias.Alias != "*" {
+			path, err = data.CompilePath(alias.Alias)
+			if err != nil {
+				return nil, err
+			}
+		}
+		m.measures = append(m.measures, matchMeasure{alias.Alias, path, eval})
+	}
+
+	conds := map[string]Evaluator{}
+	for _, d := range mr.Define {
+		cond := d.Cond.RenameReferencedRelation("", d.Var)
+		for rel := range cond.ReferencedRelations() {
+			if !vars[rel] && rel != MatchPrevRelation {
+				return nil, fmt.Errorf("'%v' is not a pattern variable", rel)
+			}
+		}
+		eval, err := toEvaluator(cond)
+		if err != nil {
+			return nil, err
+		}
+		conds[d.Var] = eval
+	}
+
+	m.pattern = make([]matchPatternElem, len(mr.Pattern))
+	m.optionalFrom = make([]bool, len(mr.Pattern)+1)
+	m.optionalFrom[len(mr.Pattern)] = true
+	for i := len(mr.Pattern) - 1; i >= 0; i-- {
+		p := mr.Pattern[i]
+		m.pattern[i] = matchPatternElem{p, conds[p.Var]}
+		m.optionalFrom[i] = m.optionalFrom[i+1] && p.Min == 0
+	}
+	return m, nil
+}
+
+// Process feeds a row to the matcher and returns the measures of the match
+// completed by the row. It returns nil when the row doesn't complete any
+// match. The state of the matcher doesn't change when an error occurs.
+func (m *MatchRecognizer) Process(row data.Map) (data.Map, error) {
+	key := make(groupKey, len(m.partitionBy))
+	for i, eval := range m.partitionBy {
+		v, err := eval.Eval(row)
+		if err != nil {
+			return nil, err
+		}
+		key[i] = v
+	}
+	hash := key.hash()
+	p := m.findPartition(key, hash)
+
+	var runs []*matchRun
+	if p != nil {
+		runs = p.runs
+	}
+	// a new match can start from every row
+	runs = append(runs[:len(runs):len(runs)], m.newRun())
+
+	var next []*matchRun
+	for _, r := range runs {
+		for i := r.elem; i < len(m.pattern); i++ {
+			e := &m.pattern[i]
+			var count int64
+			if i == r.elem {
+				count = r.count
+			}
+			if e.Max < 0 || count < e.Max {
+				ok, err := m.matches(e, r, row)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					nr := r.advance(i, count+1, e.Var, row)
+					if nr.count >= e.Min && m.optionalFrom[i+1] {
+						res, err := m.measure(nr)
+						if err != nil {
+							return nil, err
+						}
+						m.removePartition(p, hash)
+						return res, nil
+					}
+					next = append(next, nr)
+				}
+			}
+			if count < e.Min {
+				// the following elements cannot match before this one
+				// matches enough rows
+				break
+			}
+		}
+	}
+
+	if len(next) > matchRecognizeMaxRuns {
+		next = next[len(next)-matchRecognizeMaxRuns:]
+	}
+	if len(next) == 0 {
+		m.removePartition(p, hash)
+		return nil, nil
+	}
+	if p == nil {
+		p = &matchPartition{key: key}
+		m.partitions[hash] = append(m.partitions[hash], p)
+	}
+	p.runs = next
+	return nil, nil
+}
+
+func (m *MatchRecognizer) findPartition(key groupKey, hash data.HashValue) *matchPartition {
+	for _, p := range m.partitions[hash] {
+		if p.key.equal(key) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (m *MatchRecognizer) removePartition(p *matchPartition, hash data.HashValue) {
+	if p == nil {
+		return
+	}
+	ps := m.partitions[hash]
+	for i, q := range ps {
+		if q == p {
+			ps = append(ps[:i], ps[i+1:]...)
+			break
+		}
+	}
+	if len(ps) == 0 {
+		delete(m.partitions, hash)
+	} else {
+		m.partitions[hash] = ps
+	}
+}
+
+func (m *MatchRecognizer) newRun() *matchRun {
+	vars := make(data.Map, len(m.pattern)+1)
+	for _, e := range m.pattern {
+		vars[e.Var] = data.Null{}
+	}
+	vars[MatchPrevRelation] = data.Null{}
+	return &matchRun{vars: vars}
+}
+
+// matches returns true when the row can be bound to the variable of e after
+// the rows of r.
+func (m *MatchRecognizer) matches(e *matchPatternElem, r *matchRun, row data.Map) (bool, error) {
+	if e.cond == nil {
+		return true, nil
+	}
+	// the condition refers to the row being matched by the variable
+	prev := r.vars[e.Var]
+	r.vars[e.Var] = row
+	v, err := e.cond.Eval(r.vars)
+	r.vars[e.Var] = prev
+	if err != nil {
+		return false, err
+	}
+	if v.Type() == data.TypeNull {
+		return false, nil
+	}
+	return data.AsBool(v)
+}
+
+func (m *MatchRecognizer) measure(r *matchRun) (data.Map, error) {
+	res := make(data.Map, len(m.measures))
+	for _, ms := range m.measures {
+		v, err := ms.eval.Eval(r.vars)
+		if err != nil {
+			return nil, err
+		}
+		if err := assignOutputValue(res, ms.alias, ms.path, v); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// advance returns a new run having the row bound to the variable of the
+// i-th pattern element.
+func (r *matchRun) advance(i int, count int64, v string, row data.Map) *matchRun {
+	vars := make(data.Map, len(r.vars))
+	for k, x := range r.vars {
+		vars[k] = x
+	}
+	vars[v] = row
+	vars[MatchPrevRelation] = row
+	return &matchRun{
+		elem:  i,
+		count: count,
+		vars:  vars,
+	}
+}
@@ -0,0 +1,111 @@
+package execution
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestMatchRecognizer(t *testing.T) {
+	reg := udf.CopyGlobalUDFRegistry(core.NewContext(nil))
+	newMatcher := func(clause string) (*MatchRecognizer, error) {
+		stmt, _, err := parser.New().ParseStmt("SELECT ISTREAM * FROM s MATCH_RECOGNIZE (" +
+			clause + ") [RANGE 1 TUPLES]")
+		So(err, ShouldBeNil)
+		return NewMatchRecognizer(stmt.(parser.SelectStmt).Relations[0].MatchRecognize, reg)
+	}
+	feed := func(m *MatchRecognizer, rows ...data.Map) []data.Map {
+		res := []data.Map{}
+		for _, r := range rows {
+			out, err := m.Process(r)
+			So(err, ShouldBeNil)
+			if out != nil {
+				res = append(res, out)
+			}
+		}
+		return res
+	}
+	row := func(id, v int64) data.Map {
+		return data.Map{"id": data.Int(id), "v": data.Int(v)}
+	}
+
+	Convey("Given a matcher detecting a V-shaped sequence", t, func() {
+		m, err := newMatcher(`MEASURES a:v AS start, b:v AS bottom, c:v AS end
+			PATTERN (a b+ c) DEFINE b AS v < prev:v, c AS v > prev:v`)
+		So(err, ShouldBeNil)
+
+		Convey("When feeding rows containing V shapes", func() {
+			res := feed(m, row(0, 10), row(0, 8), row(0, 6), row(0, 7),
+				row(0, 5), row(0, 4), row(0, 6))
+
+			Convey("Then it should report the matches starting first", func() {
+				So(res, ShouldResemble, []data.Map{
+					{"start": data.Int(10), "bottom": data.Int(6), "end": data.Int(7)},
+					{"start": data.Int(5), "bottom": data.Int(4), "end": data.Int(6)},
+				})
+			})
+		})
+
+		Convey("When feeding rows increasing monotonically", func() {
+			res := feed(m, row(0, 1), row(0, 2), row(0, 3))
+
+			Convey("Then it shouldn't report any match", func() {
+				So(res, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a matcher partitioning rows", t, func() {
+		m, err := newMatcher(`PARTITION BY id MEASURES a:id AS id, a:v AS first, b:v AS second
+			PATTERN (a b) DEFINE b AS v = a:v`)
+		So(err, ShouldBeNil)
+
+		Convey("When feeding rows of interleaved partitions", func() {
+			res := feed(m, row(1, 5), row(2, 6), row(1, 5), row(2, 7), row(2, 7))
+
+			Convey("Then rows should be matched in each partition", func() {
+				So(res, ShouldResemble, []data.Map{
+					{"id": data.Int(1), "first": data.Int(5), "second": data.Int(5)},
+					{"id": data.Int(2), "first": data.Int(7), "second": data.Int(7)},
+				})
+				So(m.partitions, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a matcher with bounded quantifiers", t, func() {
+		m, err := newMatcher(`MEASURES a:v AS a, b:v AS b PATTERN (a{2} b?) DEFINE a AS v > 0, b AS v < 0`)
+		So(err, ShouldBeNil)
+
+		Convey("When feeding rows", func() {
+			res := feed(m, row(0, -1), row(0, 1), row(0, 2), row(0, 3))
+
+			Convey("Then the match should end when the required rows are matched", func() {
+				So(res, ShouldResemble, []data.Map{
+					{"a": data.Int(2), "b": data.Null{}},
+				})
+			})
+		})
+	})
+
+	Convey("Given invalid MATCH_RECOGNIZE clauses", t, func() {
+		for _, clause := range []string{
+			"MEASURES v AS v PATTERN (a)",
+			"MEASURES a:v AS v PATTERN (a) DEFINE a AS v > x:v",
+			"MEASURES prev:v AS v PATTERN (prev)",
+			"PARTITION BY a:id MEASURES a:v AS v PATTERN (a)",
+		} {
+			clause := clause
+			Convey("When creating a matcher with "+clause, func() {
+				_, err := newMatcher(clause)
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package execution
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+)
+
+// orderByExpression is an expression of the ORDER BY clause.
+type orderByExpression struct {
+	expr      FlatExpression
+	ascending bool
+}
+
+// ResultOrdering sorts and truncates the results computed from an input
+// tuple as specified by the ORDER BY and LIMIT clauses of a statement.
+type ResultOrdering struct {
+	ordering []sortEvaluator
+	limit    int64
+	offset   int64
+}
+
+// MakeResultOrdering creates a ResultOrdering for the plan. It returns nil
+// when the statement has neither ORDER BY nor LIMIT clause.
+func (lp *LogicalPlan) MakeResultOrdering(reg udf.FunctionRegistry) (*ResultOrdering, error) {
+	if len(lp.OrderBy) == 0 && !lp.HasLimit {
+		return nil, nil
+	}
+
+	ordering := make([]sortEvaluator, len(lp.OrderBy))
+	for i, o := range lp.OrderBy {
+		eval, err := expressionToEvaluator(o.expr, reg, lp.CaseInsensitive)
+		if err != nil {
+			return nil, err
+		}
+		ordering[i] = sortEvaluator{eval, o.ascending}
+	}
+	limit := int64(-1)
+	if lp.HasLimit {
+		limit = lp.Limit
+	}
+	return &ResultOrdering{
+		ordering: ordering,
+		limit:    limit,
+		offset:   lp.Offset,
+	}, nil
+}
+
+// Apply returns the results to be emitted in the order of the ORDER BY
+// clause. Results which are equal in terms of the ORDER BY clause keep their
+// relative order. Results before the OFFSET are skipped and at most LIMIT
+// results are returned.
+func (o *ResultOrdering) Apply(results []data.Map) ([]data.Map, error) {
+	if len(o.ordering) > 0 && len(results) > 1 {
+		sortData := make([]sortArray, len(o.ordering))
+		for i, sortEval := range o.ordering {
+			arr := make(data.Array, len(results))
+			for j, r := range results {
+				v, err := sortEval.eval.Eval(r)
+				if err != nil {
+					return nil, err
+				}
+				arr[j] = v
+			}
+			sortData[i] = sortArray{arr, sortEval.ascending}
+		}
+
+		indexes := make([]int, len(results))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		sort.Stable(&indexSlice{indexes, sortData})
+		sorted := make([]data.Map, len(results))
+		for i, idx := range indexes {
+			sorted[i] = results[idx]
+		}
+		results = sorted
+	}
+
+	if o.offset >= int64(len(results)) {
+		return nil, nil
+	}
+	results = results[o.offset:]
+	if o.limit >= 0 && o.limit < int64(len(results)) {
+		results = results[:o.limit]
+	}
+	return results, nil
+}
@@ -0,0 +1,98 @@
+package execution
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestResultOrdering(t *testing.T) {
+	reg := udf.CopyGlobalUDFRegistry(core.NewContext(nil))
+	makeOrdering := func(stmt string) (*ResultOrdering, error) {
+		s, _, err := parser.New().ParseStmt(stmt)
+		So(err, ShouldBeNil)
+		lp, err := Analyze(s.(parser.SelectStmt), reg)
+		if err != nil {
+			return nil, err
+		}
+		return lp.MakeResultOrdering(reg)
+	}
+	rows := func(xs ...int64) []data.Map {
+		res := make([]data.Map, len(xs))
+		for i, x := range xs {
+			res[i] = data.Map{"a": data.Int(x / 10), "b": data.Int(x % 10)}
+		}
+		return res
+	}
+
+	Convey("Given a statement without ORDER BY and LIMIT", t, func() {
+		o, err := makeOrdering("SELECT RSTREAM a FROM s [RANGE 1 TUPLES]")
+
+		Convey("Then no ordering should be created", func() {
+			So(err, ShouldBeNil)
+			So(o, ShouldBeNil)
+		})
+	})
+
+	Convey("Given statements with ORDER BY and LIMIT", t, func() {
+		input := []int64{12, 31, 11, 22, 21}
+		cases := []struct {
+			clauses  string
+			expected []int64
+		}{
+			{"ORDER BY a", []int64{12, 11, 22, 21, 31}},
+			{"ORDER BY a DESC", []int64{31, 22, 21, 12, 11}},
+			{"ORDER BY a, b", []int64{11, 12, 21, 22, 31}},
+			{"ORDER BY a ASC, b DESC", []int64{12, 11, 22, 21, 31}},
+			{"ORDER BY -a", []int64{31, 22, 21, 12, 11}},
+			{"ORDER BY a LIMIT 2", []int64{12, 11}},
+			{"ORDER BY a LIMIT 2 OFFSET 3", []int64{21, 31}},
+			{"LIMIT 3", []int64{12, 31, 11}},
+			{"LIMIT 10 OFFSET 4", []int64{21}},
+			{"LIMIT 10 OFFSET 5", []int64{}},
+			{"LIMIT 0", []int64{}},
+		}
+
+		for _, c := range cases {
+			c := c
+			Convey("When applying "+c.clauses, func() {
+				o, err := makeOrdering("SELECT RSTREAM a, b FROM s [RANGE 1 TUPLES] " + c.clauses)
+				So(err, ShouldBeNil)
+				res, err := o.Apply(rows(input...))
+				So(err, ShouldBeNil)
+
+				Convey("Then the results should be sorted and truncated", func() {
+					So(len(res), ShouldEqual, len(c.expected))
+					for i, r := range rows(c.expected...) {
+						So(res[i], ShouldResemble, r)
+					}
+				})
+			})
+		}
+	})
+
+	Convey("Given a statement ordering by a missing column", t, func() {
+		o, err := makeOrdering("SELECT RSTREAM a FROM s [RANGE 1 TUPLES] ORDER BY c")
+		So(err, ShouldBeNil)
+
+		Convey("When applying it", func() {
+			_, err := o.Apply(rows(1, 2))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a statement with an aggregate in ORDER BY", t, func() {
+		_, err := makeOrdering("SELECT RSTREAM count(a) AS c FROM s [RANGE 1 TUPLES] ORDER BY count(a)")
+
+		Convey("Then it should fail", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "aggregates not allowed in ORDER BY clause")
+		})
+	})
+}
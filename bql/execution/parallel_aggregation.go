@@ -0,0 +1,112 @@
+package execution
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"runtime"
+	"sync"
+)
+
+var (
+	// parallelAggregationChunkSize is the minimum number of values
+	// aggregated by one goroutine. Values of an aggregate function
+	// implementing udf.MergeableAggregate are aggregated on the calling
+	// goroutine when there are fewer values than twice this size.
+	parallelAggregationChunkSize = 4096
+
+	// parallelAggregationWorkers returns the maximum number of goroutines
+	// aggregating values of one aggregate function call.
+	parallelAggregationWorkers = func() int {
+		return runtime.GOMAXPROCS(0)
+	}
+)
+
+// mergeableAggFuncApp evaluates an aggregate function implementing
+// udf.MergeableAggregate. When the parameter has many values, they're
+// split into chunks whose partial states are computed by multiple
+// goroutines in parallel and then merged in the order of the chunks.
+type mergeableAggFuncApp struct {
+	name  string
+	f     udf.UDF
+	m     udf.MergeableAggregate
+	ctx   *core.Context
+	param Evaluator
+}
+
+// newMergeableAggFuncApp returns a mergeableAggFuncApp when f is an
+// aggregate function having exactly one parameter and implementing
+// udf.MergeableAggregate. Otherwise, it returns nil.
+func newMergeableAggFuncApp(name string, f udf.UDF, ctx *core.Context, params []Evaluator) Evaluator {
+	m, ok := f.(udf.MergeableAggregate)
+	if !ok || len(params) != 1 || !f.IsAggregationParameter(0) {
+		return nil
+	}
+	return &mergeableAggFuncApp{
+		name:  name,
+		f:     f,
+		m:     m,
+		ctx:   ctx,
+		param: params[0],
+	}
+}
+
+func (a *mergeableAggFuncApp) Eval(input data.Value) (v data.Value, err error) {
+	// catch panic (e.g., in called function)
+	defer func() {
+		if r := recover(); r != nil {
+			v = nil
+			err = fmt.Errorf("evaluating '%s' paniced: %s", a.name, r)
+		}
+	}()
+	value, err := a.param.Eval(input)
+	if err != nil {
+		return nil, err
+	}
+	arr, err := data.AsArray(value)
+	if err != nil {
+		// let the function report the error
+		return a.f.Call(a.ctx, value)
+	}
+
+	n := len(arr) / parallelAggregationChunkSize
+	if w := parallelAggregationWorkers(); n > w {
+		n = w
+	}
+	if n < 2 {
+		return a.f.Call(a.ctx, arr)
+	}
+
+	states := make([]data.Value, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		chunk := arr[i*len(arr)/n : (i+1)*len(arr)/n]
+		wg.Add(1)
+		go func(i int, chunk data.Array) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = fmt.Errorf("evaluating '%s' paniced: %s", a.name, r)
+				}
+			}()
+			states[i], errs[i] = a.m.Partial(a.ctx, chunk)
+		}(i, chunk)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	state := states[0]
+	for _, s := range states[1:] {
+		state, err = a.m.Combine(a.ctx, state, s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return a.m.Final(a.ctx, state)
+}
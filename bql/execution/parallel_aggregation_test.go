@@ -0,0 +1,133 @@
+package execution
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync/atomic"
+	"testing"
+)
+
+// chunkCounter is a mergeable aggregate function returning the number of
+// values. It counts how many chunks it has aggregated.
+type chunkCounter struct {
+	chunks int32
+}
+
+func (c *chunkCounter) Call(ctx *core.Context, args ...data.Value) (data.Value, error) {
+	return c.Partial(ctx, args[0].(data.Array))
+}
+
+func (c *chunkCounter) Accept(arity int) bool {
+	return arity == 1
+}
+
+func (c *chunkCounter) IsAggregationParameter(k int) bool {
+	return k == 0
+}
+
+func (c *chunkCounter) Partial(ctx *core.Context, values data.Array) (data.Value, error) {
+	atomic.AddInt32(&c.chunks, 1)
+	for _, v := range values {
+		if v.Type() == data.TypeString {
+			return nil, fmt.Errorf("invalid value: %v", v)
+		}
+	}
+	return data.Int(len(values)), nil
+}
+
+func (c *chunkCounter) Combine(ctx *core.Context, a, b data.Value) (data.Value, error) {
+	return data.Int(a.(data.Int) + b.(data.Int)), nil
+}
+
+func (c *chunkCounter) Final(ctx *core.Context, state data.Value) (data.Value, error) {
+	return state, nil
+}
+
+func TestMergeableAggregation(t *testing.T) {
+	chunkSize, workers := parallelAggregationChunkSize, parallelAggregationWorkers
+	defer func() {
+		parallelAggregationChunkSize, parallelAggregationWorkers = chunkSize, workers
+	}()
+	parallelAggregationChunkSize = 2
+	parallelAggregationWorkers = func() int {
+		return 3
+	}
+
+	reg := udf.CopyGlobalUDFRegistry(core.NewContext(nil))
+	counter := &chunkCounter{}
+	reg.Register("chunk_count", counter)
+	newEvaluator := func(name string) Evaluator {
+		eval, err := ExpressionToEvaluator(funcAppAST{parser.FuncName(name),
+			[]FlatExpression{aggInputRef{"x"}}}, reg)
+		So(err, ShouldBeNil)
+		return eval
+	}
+	values := func(n int) data.Map {
+		arr := make(data.Array, n)
+		for i := range arr {
+			arr[i] = data.Int(i)
+		}
+		return data.Map{"x": arr}
+	}
+
+	Convey("Given an aggregate function implementing udf.MergeableAggregate", t, func() {
+		counter.chunks = 0
+		eval := newEvaluator("chunk_count")
+		So(eval, ShouldHaveSameTypeAs, &mergeableAggFuncApp{})
+
+		Convey("When evaluating it on a few values", func() {
+			v, err := eval.Eval(values(3))
+
+			Convey("Then the values should be aggregated at once", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(3))
+				So(counter.chunks, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When evaluating it on many values", func() {
+			v, err := eval.Eval(values(11))
+
+			Convey("Then the values should be aggregated by the workers", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(11))
+				So(counter.chunks, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When a chunk cannot be aggregated", func() {
+			in := values(11)
+			in["x"].(data.Array)[9] = data.String("x")
+			_, err := eval.Eval(in)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given builtin aggregate functions", t, func() {
+		in := values(101)
+		in["x"].(data.Array)[50] = data.Null{}
+		for _, name := range []string{"count", "sum", "avg", "max", "min"} {
+			name := name
+
+			Convey("When evaluating "+name+" on many values", func() {
+				f, err := reg.Lookup(name, 1)
+				So(err, ShouldBeNil)
+				expected, err := f.Call(nil, in["x"])
+				So(err, ShouldBeNil)
+				actual, err := newEvaluator(name).Eval(in)
+
+				Convey("Then the result should be the same as the one computed at once", func() {
+					So(err, ShouldBeNil)
+					So(actual, ShouldResemble, expected)
+				})
+			})
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package execution
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+)
+
+// ReferencedColumns returns the top-level keys of input tuples referred to
+// by the plan, keyed by the alias of each relation. For example, the columns
+// of `SELECT a.b, count(c) FROM s [RANGE 1 TUPLES] WHERE d > 0 GROUP BY a.b`
+// are "a", "c", and "d" for "s". Keys are sorted lexicographically, and a
+// relation whose keys aren't referred to at all has an empty list.
+//
+// Keys not returned can be removed from input tuples without changing the
+// results of the plan. However, that isn't possible when the plan has a
+// wildcard, which pulls up all keys of input tuples, or when keys are matched
+// case-insensitively. The second return value is false in those cases.
+func (lp *LogicalPlan) ReferencedColumns() (map[string][]string, bool) {
+	if lp.CaseInsensitive {
+		return nil, false
+	}
+
+	exprs := []FlatExpression{}
+	for _, proj := range lp.Projections {
+		exprs = append(exprs, proj.expr)
+		for _, e := range proj.aggrInputs {
+			exprs = append(exprs, e)
+		}
+	}
+	for _, cond := range lp.JoinConditions {
+		if cond != nil {
+			exprs = append(exprs, cond)
+		}
+	}
+	if lp.Filter != nil {
+		exprs = append(exprs, lp.Filter)
+	}
+	exprs = append(exprs, lp.GroupList...)
+
+	cols := make(map[string]map[string]bool, len(lp.Relations))
+	for _, rel := range lp.Relations {
+		cols[rel.Alias] = map[string]bool{}
+	}
+	for _, e := range exprs {
+		if e.ContainsWildcard() {
+			return nil, false
+		}
+		for _, rv := range e.Columns() {
+			c, ok := cols[rv.Relation]
+			if !ok {
+				return nil, false
+			}
+			key, ok := topLevelKey(rv.Column)
+			if !ok {
+				return nil, false
+			}
+			c[key] = true
+		}
+	}
+
+	res := make(map[string][]string, len(cols))
+	for rel, c := range cols {
+		keys := make([]string, 0, len(c))
+		for k := range c {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		res[rel] = keys
+	}
+	return res, true
+}
+
+// topLevelKey returns the top-level key of a path referring to a column of
+// an input tuple, e.g. "a" for a.b[0]. It returns false when the path doesn't
+// start with a key.
+func topLevelKey(path string) (string, bool) {
+	p, err := data.CompilePath(path)
+	if err != nil {
+		return "", false
+	}
+	// the top-level key of a path is obtained by assigning a value to an
+	// empty map as OutputColumns does
+	m := data.Map{}
+	if err := m.Set(p, data.Null{}); err != nil {
+		return "", false
+	}
+	for k := range m {
+		return k, true
+	}
+	return "", false
+}
+
+// pruneColumns returns a map only having the given keys of m. Values are
+// shared with m.
+func pruneColumns(m data.Map, keys map[string]bool) data.Map {
+	res := make(data.Map, len(keys))
+	for k := range keys {
+		if v, ok := m[k]; ok {
+			res[k] = v
+		}
+	}
+	return res
+}
@@ -0,0 +1,156 @@
+package execution
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestReferencedColumns(t *testing.T) {
+	reg := udf.CopyGlobalUDFRegistry(core.NewContext(nil))
+	analyze := func(stmt string) *LogicalPlan {
+		s, _, err := parser.New().ParseStmt(stmt)
+		So(err, ShouldBeNil)
+		lp, err := Analyze(s.(parser.SelectStmt), reg)
+		So(err, ShouldBeNil)
+		return lp
+	}
+
+	Convey("Given SELECT statements", t, func() {
+		cases := []struct {
+			stmt     string
+			expected map[string][]string
+		}{
+			{"SELECT RSTREAM a FROM s [RANGE 1 TUPLES]",
+				map[string][]string{"s": {"a"}}},
+			{"SELECT RSTREAM a.b[0], c[\"d\"] AS x FROM s [RANGE 1 TUPLES] WHERE e > 0",
+				map[string][]string{"s": {"a", "c", "e"}}},
+			{"SELECT RSTREAM a, count(b), array_agg(c ORDER BY d) FROM s [RANGE 1 TUPLES] GROUP BY a HAVING max(e) > 1",
+				map[string][]string{"s": {"a", "b", "c", "d", "e"}}},
+			{"SELECT RSTREAM count(*) FROM s [RANGE 1 TUPLES]",
+				map[string][]string{"s": {}}},
+			{"SELECT RSTREAM x:a, y:b FROM s [RANGE 1 TUPLES] AS x, s [RANGE 1 TUPLES] AS y WHERE x:c = y:c",
+				map[string][]string{"x": {"a", "c"}, "y": {"b", "c"}}},
+		}
+
+		for _, c := range cases {
+			c := c
+			Convey("When getting referenced columns of "+c.stmt, func() {
+				cols, ok := analyze(c.stmt).ReferencedColumns()
+
+				Convey("Then they should be the columns used in the statement", func() {
+					So(ok, ShouldBeTrue)
+					So(cols, ShouldResemble, c.expected)
+				})
+			})
+		}
+
+		for _, stmt := range []string{
+			"SELECT RSTREAM * FROM s [RANGE 1 TUPLES]",
+			"SELECT RSTREAM x:a, x:* FROM s [RANGE 1 TUPLES] AS x",
+		} {
+			stmt := stmt
+			Convey("When getting referenced columns of "+stmt, func() {
+				_, ok := analyze(stmt).ReferencedColumns()
+
+				Convey("Then they shouldn't be determined", func() {
+					So(ok, ShouldBeFalse)
+				})
+			})
+		}
+
+		Convey("When getting referenced columns of a case-insensitive statement", func() {
+			lp := analyze("SELECT RSTREAM a FROM s [RANGE 1 TUPLES]")
+			lp.CaseInsensitive = true
+			_, ok := lp.ReferencedColumns()
+
+			Convey("Then they shouldn't be determined", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given an execution plan", t, func() {
+		plan := func(stmt string) (PhysicalPlan, *streamRelationStreamExecutionPlan) {
+			lp := analyze(stmt)
+			if lp.GroupingStmt {
+				p, err := NewGroupbyExecutionPlan(lp, reg)
+				So(err, ShouldBeNil)
+				return p, &p.(*groupbyExecutionPlan).streamRelationStreamExecutionPlan
+			}
+			p, err := NewDefaultSelectExecutionPlan(lp, reg)
+			So(err, ShouldBeNil)
+			return p, &p.(*defaultSelectExecutionPlan).streamRelationStreamExecutionPlan
+		}
+		input := func() *core.Tuple {
+			return &core.Tuple{
+				InputName: "s",
+				Data: data.Map{
+					"a": data.Int(1),
+					"b": data.Map{"c": data.Int(2)},
+					"d": data.String("unused"),
+				},
+			}
+		}
+		buffered := func(ep *streamRelationStreamExecutionPlan, alias string) data.Map {
+			b := ep.buffers[alias].tuples
+			So(b.Len(), ShouldEqual, 1)
+			m, err := b.Front().Value.(*tupleWithDerivedInputRows).tuple.Data.Get(data.MustCompilePath(alias))
+			So(err, ShouldBeNil)
+			return m.(data.Map)
+		}
+
+		Convey("When the statement only uses some columns", func() {
+			p, ep := plan("SELECT RSTREAM a, b.c AS c FROM s [RANGE 2 TUPLES]")
+			t := input()
+			res, err := p.Process(t)
+			So(err, ShouldBeNil)
+
+			Convey("Then the result should be correct", func() {
+				So(res, ShouldResemble, []data.Map{{"a": data.Int(1), "c": data.Int(2)}})
+			})
+
+			Convey("Then unused columns should be removed from the buffer", func() {
+				So(buffered(ep, "s"), ShouldResemble, data.Map{
+					"a": data.Int(1),
+					"b": data.Map{"c": data.Int(2)},
+				})
+			})
+
+			Convey("Then the input tuple should be untouched", func() {
+				So(t.Data, ShouldResemble, input().Data)
+			})
+		})
+
+		Convey("When the statement has aggregates", func() {
+			p, ep := plan("SELECT RSTREAM count(*) AS n FROM s [RANGE 2 TUPLES] AS x WHERE x:a > 0")
+			res, err := p.Process(input())
+			So(err, ShouldBeNil)
+
+			Convey("Then the result should be correct", func() {
+				So(res, ShouldResemble, []data.Map{{"n": data.Int(1)}})
+			})
+
+			Convey("Then only columns used by the statement should be buffered", func() {
+				So(buffered(ep, "x"), ShouldResemble, data.Map{"a": data.Int(1)})
+			})
+		})
+
+		Convey("When the statement has a wildcard", func() {
+			p, ep := plan("SELECT RSTREAM * FROM s [RANGE 2 TUPLES]")
+			res, err := p.Process(input())
+			So(err, ShouldBeNil)
+
+			Convey("Then all columns should be emitted", func() {
+				So(res, ShouldResemble, []data.Map{input().Data})
+			})
+
+			Convey("Then all columns should be buffered", func() {
+				So(buffered(ep, "s"), ShouldResemble, input().Data)
+			})
+		})
+	})
+}
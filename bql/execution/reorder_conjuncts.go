@@ -0,0 +1,133 @@
+package execution
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+)
+
+// reorderConjuncts splits the top-level AND chain of expr and rebuilds it
+// so that conjuncts which cannot fail, such as simple comparisons, are
+// evaluated before conjuncts having function calls. Because AND is evaluated
+// from left to right and stops at the first false operand, expensive
+// conjuncts are then skipped for tuples already rejected by cheap ones.
+//
+// The result of the expression is the same as the original one, including
+// NULL, because AND is commutative in the three-valued logic. A conjunct
+// which can fail, e.g. one having a cast, arithmetic, or a function call,
+// keeps its position relative to other conjuncts, so a guard written before
+// it like `is_num(s) AND s::INT > 0` or `x IS NOT NULL AND f(x)` still
+// protects it. Only conjuncts regarded as not failing by cannotFail are
+// moved, and they're moved just before the first conjunct having a function
+// call. Moving them never raises an error which the original expression
+// didn't raise.
+func reorderConjuncts(expr FlatExpression) FlatExpression {
+	conjuncts := splitConjuncts(expr, nil)
+	if len(conjuncts) < 2 {
+		return expr
+	}
+
+	reordered := make([]FlatExpression, 0, len(conjuncts))
+	firstExpensive := -1 // the index of the first conjunct having a call
+	for _, c := range conjuncts {
+		switch {
+		case firstExpensive >= 0 && cannotFail(c):
+			reordered = append(reordered, nil)
+			copy(reordered[firstExpensive+1:], reordered[firstExpensive:])
+			reordered[firstExpensive] = c
+			firstExpensive++
+		case firstExpensive < 0 && hasFuncApp(c):
+			firstExpensive = len(reordered)
+			fallthrough
+		default:
+			reordered = append(reordered, c)
+		}
+	}
+
+	// rebuild the left-associative chain as created by the parser
+	result := reordered[0]
+	for _, c := range reordered[1:] {
+		result = binaryOpAST{parser.And, result, c}
+	}
+	return result
+}
+
+// cannotFail returns true when evaluating expr as a conjunct never results
+// in an error. It's true for a boolean or NULL literal and for =, !=, and
+// IS [NOT] NULL or MISSING whose operands are literals or columns. Other
+// comparisons such as < aren't included because they fail for values of
+// incomparable types, and a column alone isn't included because AND fails
+// for a non-boolean value. Note that a reference to a column which doesn't
+// exist is an error, but it's regarded as a mistake in the statement, which
+// a guard isn't supposed to protect against, rather than a failure of the
+// conjunct. A guard against such columns can be written as
+// `x IS NOT MISSING`, which keeps the order because it cannot fail either.
+func cannotFail(expr FlatExpression) bool {
+	isSimple := func(e FlatExpression) bool {
+		switch e.(type) {
+		case rowValue, nullLiteral, boolLiteral, numericLiteral, floatLiteral, stringLiteral:
+			return true
+		}
+		return false
+	}
+
+	switch obj := expr.(type) {
+	case boolLiteral, nullLiteral, missing:
+		return true
+	case binaryOpAST:
+		switch obj.Op {
+		case parser.Equal, parser.NotEqual:
+			return isSimple(obj.Left) && isSimple(obj.Right)
+		case parser.Is, parser.IsNot:
+			return isSimple(obj.Left) && obj.Right == (nullLiteral{})
+		}
+	}
+	return false
+}
+
+// splitConjuncts appends the operands of the top-level AND chain of expr to
+// conjuncts in the order of evaluation.
+func splitConjuncts(expr FlatExpression, conjuncts []FlatExpression) []FlatExpression {
+	if b, ok := expr.(binaryOpAST); ok && b.Op == parser.And {
+		conjuncts = splitConjuncts(b.Left, conjuncts)
+		return splitConjuncts(b.Right, conjuncts)
+	}
+	return append(conjuncts, expr)
+}
+
+// hasFuncApp returns true when expr has a function call, which is usually
+// much more expensive than operators and column references.
+func hasFuncApp(expr FlatExpression) bool {
+	switch obj := expr.(type) {
+	case binaryOpAST:
+		return hasFuncApp(obj.Left) || hasFuncApp(obj.Right)
+	case unaryOpAST:
+		return hasFuncApp(obj.Expr)
+	case typeCastAST:
+		return hasFuncApp(obj.Expr)
+	case funcAppAST:
+		return true
+	case arrayAST:
+		for _, e := range obj.Expressions {
+			if hasFuncApp(e) {
+				return true
+			}
+		}
+	case likePatternAST:
+		return hasFuncApp(obj.Pattern)
+	case mapAST:
+		for _, p := range obj.Entries {
+			if hasFuncApp(p.Value) || (p.KeyExpr != nil && hasFuncApp(p.KeyExpr)) {
+				return true
+			}
+		}
+	case caseAST:
+		if hasFuncApp(obj.Reference) || hasFuncApp(obj.Default) {
+			return true
+		}
+		for _, p := range obj.Checks {
+			if hasFuncApp(p.When) || hasFuncApp(p.Then) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package execution
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestReorderConjuncts(t *testing.T) {
+	ctx := core.NewContext(nil)
+	reg := udf.CopyGlobalUDFRegistry(ctx)
+	numCalls := 0
+	if err := reg.Register("expensive", udf.UnaryFunc(func(ctx *core.Context, v data.Value) (data.Value, error) {
+		numCalls++
+		return v, nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register("is_num", udf.UnaryFunc(func(ctx *core.Context, v data.Value) (data.Value, error) {
+		return data.Bool(v.Type() == data.TypeInt || v.Type() == data.TypeFloat), nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := func(where string) (*LogicalPlan, *LogicalPlan) {
+		stmt, _, err := parser.New().ParseStmt("SELECT RSTREAM a FROM s [RANGE 1 TUPLES] WHERE " + where)
+		So(err, ShouldBeNil)
+		lp, err := Analyze(stmt.(parser.SelectStmt), reg)
+		So(err, ShouldBeNil)
+		optimized, err := lp.LogicalOptimize()
+		So(err, ShouldBeNil)
+		return lp, optimized
+	}
+
+	tuples := []data.Map{
+		{"a": data.Int(1), "b": data.String("x"), "c": data.Bool(true)},
+		{"a": data.Int(2), "b": data.String("x"), "c": data.Bool(false)},
+		{"a": data.Int(20), "b": data.String("x"), "c": data.Bool(true)},
+		{"a": data.Int(3), "b": data.String("y"), "c": data.Bool(true)},
+		{"a": data.Null{}, "b": data.String("x"), "c": data.Bool(true)},
+		{"a": data.Int(3), "b": data.Null{}, "c": data.Bool(true)},
+		{"a": data.Int(3), "b": data.String("x"), "c": data.Null{}},
+	}
+
+	Convey("Given a WHERE clause having an expensive conjunct before cheap ones", t, func() {
+		lp, optimized := plan(`expensive(a > 1) AND b = "x" AND c AND a < 10`)
+
+		Convey("When optimizing the plan", func() {
+			Convey("Then only the conjunct which cannot fail should be moved before the expensive one", func() {
+				So(optimized.Filter.Repr(), ShouldEqual,
+					"((((s:b)=(x))AND(expensive((s:a)>(1))))AND(s:c))AND((s:a)<(10))")
+			})
+
+			Convey("Then the original plan should be untouched", func() {
+				So(lp.Filter.Repr(), ShouldStartWith, "(((expensive")
+			})
+
+			Convey("Then the predicate should be semantically equivalent", func() {
+				orig, err := ExpressionToEvaluator(lp.Filter, reg)
+				So(err, ShouldBeNil)
+				opt, err := ExpressionToEvaluator(optimized.Filter, reg)
+				So(err, ShouldBeNil)
+
+				numCalls = 0
+				for _, m := range tuples {
+					input := data.Map{"s": m}
+					expected, err := orig.Eval(input)
+					So(err, ShouldBeNil)
+					actual, err := opt.Eval(input)
+					So(err, ShouldBeNil)
+					So(actual, ShouldResemble, expected)
+				}
+
+				Convey("And the expensive conjunct should be evaluated less often", func() {
+					// 7 calls by the original predicate and 6 calls
+					// by the optimized one
+					So(numCalls, ShouldEqual, 13)
+				})
+			})
+		})
+	})
+
+	Convey("Given a WHERE clause having only cheap conjuncts", t, func() {
+		lp, optimized := plan(`a > 1 AND b = "x" OR c`)
+
+		Convey("When optimizing the plan", func() {
+			Convey("Then the filter shouldn't change", func() {
+				So(optimized.Filter, ShouldResemble, lp.Filter)
+			})
+		})
+	})
+
+	Convey("Given a WHERE clause having a guard before function calls", t, func() {
+		_, optimized := plan(`a IS NOT NULL AND expensive(a) > 1 AND abs(a) < 10`)
+
+		Convey("When optimizing the plan", func() {
+			Convey("Then the order of the conjuncts should be kept", func() {
+				So(optimized.Filter.Repr(), ShouldEqual,
+					"(((s:a)IS NOT(NULL))AND((expensive(s:a))>(1)))AND((abs(s:a))<(10))")
+			})
+		})
+	})
+	Convey("Given a WHERE clause having a function call guarding a cast", t, func() {
+		lp, optimized := plan(`is_num(b) AND b::INT > 0 AND a = 3`)
+
+		Convey("When optimizing the plan", func() {
+			Convey("Then only the comparison should be moved before the guard", func() {
+				So(optimized.Filter.Repr(), ShouldEqual,
+					"(((s:a)=(3))AND(is_num(s:b)))AND((CAST(s:b AS INT))>(0))")
+			})
+
+			Convey("Then the guard should still protect the cast", func() {
+				orig, err := ExpressionToEvaluator(lp.Filter, reg)
+				So(err, ShouldBeNil)
+				opt, err := ExpressionToEvaluator(optimized.Filter, reg)
+				So(err, ShouldBeNil)
+
+				for _, m := range tuples {
+					input := data.Map{"s": m}
+					expected, err := orig.Eval(input)
+					So(err, ShouldBeNil)
+					actual, err := opt.Eval(input)
+					So(err, ShouldBeNil)
+					So(actual, ShouldResemble, expected)
+				}
+			})
+		})
+	})
+}
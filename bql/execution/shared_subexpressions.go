@@ -0,0 +1,215 @@
+package execution
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// subexpressionCache holds the results of function calls appearing more
+// than once in the projections of a statement, e.g. f(x) in
+// `f(x) + 1, f(x) * 2`, so that each of them is evaluated only once per
+// input row. A plan must call reset before evaluating the projections on a
+// new input row.
+type subexpressionCache struct {
+	// gen identifies the current input row. A result computed for another
+	// generation is stale.
+	gen int64
+}
+
+// reset invalidates all cached results. It does nothing when c is nil,
+// i.e. when the statement doesn't have any shared subexpression.
+func (c *subexpressionCache) reset() {
+	if c != nil {
+		c.gen++
+	}
+}
+
+// sharedSubexpression is a function call shared by multiple projections.
+type sharedSubexpression struct {
+	cache *subexpressionCache
+	expr  FlatExpression
+	eval  Evaluator
+
+	// gen is the generation of the input row value and err were computed
+	// from.
+	gen   int64
+	value data.Value
+	err   error
+}
+
+// sharedEvaluator evaluates a shared subexpression unless its result for
+// the current input row is cached.
+type sharedEvaluator struct {
+	s *sharedSubexpression
+}
+
+func (e *sharedEvaluator) Eval(input data.Value) (data.Value, error) {
+	s := e.s
+	if s.gen != s.cache.gen {
+		s.value, s.err = s.eval.Eval(input)
+		s.gen = s.cache.gen
+	}
+	return s.value, s.err
+}
+
+// sharedSubexpressionAST marks an occurrence of a shared subexpression in
+// an expression so that expressionToEvaluator creates a sharedEvaluator
+// for it.
+type sharedSubexpressionAST struct {
+	FlatExpression
+	s *sharedSubexpression
+}
+
+// shareSubexpressions finds calls to deterministic functions appearing more
+// than once in projections, compared by parser.EqualAST, and replaces each
+// occurrence with a sharedSubexpressionAST. A call to a function which
+// isn't deterministic is never shared since calling it only once could
+// change the result. It returns nil as the cache when nothing is shared.
+func shareSubexpressions(projections []FlatExpression, reg udf.FunctionRegistry) ([]FlatExpression, *subexpressionCache) {
+	var candidates []FlatExpression
+	var counts []int
+	for _, p := range projections {
+		walkFuncApps(p, func(f funcAppAST) {
+			if !isDeterministic(f, reg) {
+				return
+			}
+			for i, c := range candidates {
+				if parser.EqualAST(c, f) {
+					counts[i]++
+					return
+				}
+			}
+			candidates = append(candidates, f)
+			counts = append(counts, 1)
+		})
+	}
+
+	cache := &subexpressionCache{gen: 1}
+	var shared []*sharedSubexpression
+	for i, c := range candidates {
+		if counts[i] > 1 {
+			shared = append(shared, &sharedSubexpression{cache: cache, expr: c})
+		}
+	}
+	if len(shared) == 0 {
+		return projections, nil
+	}
+
+	result := make([]FlatExpression, len(projections))
+	for i, p := range projections {
+		result[i] = replaceSharedSubexpressions(p, shared)
+	}
+	return result, cache
+}
+
+// walkFuncApps calls f for each function call in expr, including nested
+// ones. Aggregate function calls aren't visited.
+func walkFuncApps(expr FlatExpression, f func(funcAppAST)) {
+	switch obj := expr.(type) {
+	case binaryOpAST:
+		walkFuncApps(obj.Left, f)
+		walkFuncApps(obj.Right, f)
+	case unaryOpAST:
+		walkFuncApps(obj.Expr, f)
+	case typeCastAST:
+		walkFuncApps(obj.Expr, f)
+	case funcAppAST:
+		f(obj)
+		for _, e := range obj.Expressions {
+			walkFuncApps(e, f)
+		}
+	case arrayAST:
+		for _, e := range obj.Expressions {
+			walkFuncApps(e, f)
+		}
+	case likePatternAST:
+		walkFuncApps(obj.Pattern, f)
+	case mapAST:
+		for _, p := range obj.Entries {
+			if p.KeyExpr != nil {
+				walkFuncApps(p.KeyExpr, f)
+			}
+			walkFuncApps(p.Value, f)
+		}
+	case caseAST:
+		walkFuncApps(obj.Reference, f)
+		walkFuncApps(obj.Default, f)
+		for _, p := range obj.Checks {
+			walkFuncApps(p.When, f)
+			walkFuncApps(p.Then, f)
+		}
+	}
+}
+
+// replaceSharedSubexpressions returns a copy of expr in which occurrences
+// of the shared subexpressions are replaced with sharedSubexpressionASTs.
+func replaceSharedSubexpressions(expr FlatExpression, shared []*sharedSubexpression) FlatExpression {
+	replace := func(e FlatExpression) FlatExpression {
+		return replaceSharedSubexpressions(e, shared)
+	}
+	replaceAll := func(es []FlatExpression) []FlatExpression {
+		result := make([]FlatExpression, len(es))
+		for i, e := range es {
+			result[i] = replace(e)
+		}
+		return result
+	}
+
+	switch obj := expr.(type) {
+	case binaryOpAST:
+		return binaryOpAST{obj.Op, replace(obj.Left), replace(obj.Right)}
+	case unaryOpAST:
+		return unaryOpAST{obj.Op, replace(obj.Expr)}
+	case typeCastAST:
+		return typeCastAST{replace(obj.Expr), obj.Target}
+	case funcAppAST:
+		f := funcAppAST{obj.Function, replaceAll(obj.Expressions)}
+		for _, s := range shared {
+			if parser.EqualAST(s.expr, obj) {
+				return sharedSubexpressionAST{f, s}
+			}
+		}
+		return f
+	case arrayAST:
+		return arrayAST{replaceAll(obj.Expressions)}
+	case likePatternAST:
+		return likePatternAST{replace(obj.Pattern), obj.Escape}
+	case mapAST:
+		entries := make([]keyValuePair, len(obj.Entries))
+		for i, p := range obj.Entries {
+			entries[i] = keyValuePair{p.Key, replace(p.Value), nil}
+			if p.KeyExpr != nil {
+				entries[i].KeyExpr = replace(p.KeyExpr)
+			}
+		}
+		return mapAST{entries}
+	case caseAST:
+		checks := make([]whenThenPair, len(obj.Checks))
+		for i, p := range obj.Checks {
+			checks[i] = whenThenPair{replace(p.When), replace(p.Then)}
+		}
+		return caseAST{replace(obj.Reference), checks, replace(obj.Default)}
+	}
+	return expr
+}
+
+// isDeterministic returns true when expr always returns the same value for
+// the same input row, i.e. when all functions called in it report that
+// they're deterministic by implementing udf.Deterministic.
+func isDeterministic(expr FlatExpression, reg udf.FunctionRegistry) bool {
+	deterministic := true
+	walkFuncApps(expr, func(f funcAppAST) {
+		if !deterministic {
+			return
+		}
+		u, err := reg.Lookup(string(f.Function), len(f.Expressions))
+		if err != nil {
+			deterministic = false
+			return
+		}
+		d, ok := u.(udf.Deterministic)
+		deterministic = ok && d.IsDeterministic()
+	})
+	return deterministic
+}
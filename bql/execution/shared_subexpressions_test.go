@@ -0,0 +1,160 @@
+package execution
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestSharedSubexpressions(t *testing.T) {
+	ctx := core.NewContext(nil)
+	reg := udf.CopyGlobalUDFRegistry(ctx)
+	numPureCalls, numImpureCalls := 0, 0
+	pure, err := udf.ConvertGeneric(func(i int) int {
+		numPureCalls++
+		return i * 10
+	}, udf.WithDeterministic(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register("pure", pure); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register("impure", udf.UnaryFunc(func(ctx *core.Context, v data.Value) (data.Value, error) {
+		numImpureCalls++
+		return v, nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	plans := func(projections, rng string) []PhysicalPlan {
+		stmt, _, err := parser.New().ParseStmt("SELECT RSTREAM " + projections + " FROM src [RANGE " + rng + " TUPLES]")
+		So(err, ShouldBeNil)
+		lp, err := Analyze(stmt.(parser.SelectStmt), reg)
+		So(err, ShouldBeNil)
+		var ps []PhysicalPlan
+		if CanBuildFilterPlan(lp, reg) {
+			p, err := NewFilterPlan(lp, reg)
+			So(err, ShouldBeNil)
+			ps = append(ps, p)
+		}
+		p, err := NewDefaultSelectExecutionPlan(lp, reg)
+		So(err, ShouldBeNil)
+		return append(ps, p)
+	}
+
+	Convey("Given projections sharing a call to a deterministic function", t, func() {
+		ps := plans("pure(int) + 1 AS a, pure(int) * 2 AS b, pure(int + 1) AS c", "1")
+		So(len(ps), ShouldEqual, 2)
+
+		for _, p := range ps {
+			Convey("When processing tuples with a "+planName(p), func() {
+				numPureCalls = 0
+				var results [][]data.Map
+				for _, tup := range getTuples(4) {
+					out, err := p.Process(tup)
+					So(err, ShouldBeNil)
+					results = append(results, out)
+				}
+
+				Convey("Then each result should be correct", func() {
+					for i, out := range results {
+						n := int64(i + 1)
+						So(out, ShouldResemble, []data.Map{{
+							"a": data.Int(n*10 + 1),
+							"b": data.Int(n * 20),
+							"c": data.Int((n + 1) * 10),
+						}})
+					}
+				})
+
+				Convey("Then the shared call should be evaluated once per tuple", func() {
+					So(numPureCalls, ShouldEqual, 8)
+				})
+			})
+		}
+	})
+
+	Convey("Given projections of a window sharing a call to a deterministic function", t, func() {
+		ps := plans("pure(int) AS a, pure(int) + 1 AS b", "2")
+
+		Convey("When processing tuples", func() {
+			numPureCalls = 0
+			var out []data.Map
+			for _, tup := range getTuples(3) {
+				var err error
+				out, err = ps[0].Process(tup)
+				So(err, ShouldBeNil)
+			}
+
+			Convey("Then the result should be computed for each row", func() {
+				So(out, ShouldHaveLength, 2)
+				So(out, ShouldContain, data.Map{"a": data.Int(20), "b": data.Int(21)})
+				So(out, ShouldContain, data.Map{"a": data.Int(30), "b": data.Int(31)})
+			})
+
+			Convey("Then the shared call should be evaluated once per row", func() {
+				So(numPureCalls, ShouldEqual, 3)
+			})
+		})
+	})
+
+	Convey("Given projections sharing a call to a non-deterministic function", t, func() {
+		ps := plans("impure(int) + 1 AS a, impure(int) * 2 AS b, pure(impure(int)) AS c, pure(impure(int)) AS d", "1")
+
+		for _, p := range ps {
+			Convey("When processing tuples with a "+planName(p), func() {
+				numPureCalls, numImpureCalls = 0, 0
+				for _, tup := range getTuples(4) {
+					_, err := p.Process(tup)
+					So(err, ShouldBeNil)
+				}
+
+				Convey("Then the calls shouldn't be shared", func() {
+					So(numImpureCalls, ShouldEqual, 16)
+					So(numPureCalls, ShouldEqual, 8)
+				})
+			})
+		}
+	})
+
+	Convey("Given a HAVING clause and projections sharing a call to a deterministic function", t, func() {
+		stmt, _, err := parser.New().ParseStmt(`SELECT RSTREAM pure(int) AS a, count(*) AS c FROM src [RANGE 1 TUPLES] GROUP BY int HAVING pure(int) > 10`)
+		So(err, ShouldBeNil)
+		lp, err := Analyze(stmt.(parser.SelectStmt), reg)
+		So(err, ShouldBeNil)
+		p, err := NewGroupbyExecutionPlan(lp, reg)
+		So(err, ShouldBeNil)
+
+		Convey("When processing tuples", func() {
+			numPureCalls = 0
+			var results [][]data.Map
+			for _, tup := range getTuples(3) {
+				out, err := p.Process(tup)
+				So(err, ShouldBeNil)
+				results = append(results, out)
+			}
+
+			Convey("Then the groups should be filtered", func() {
+				So(results[0], ShouldBeEmpty)
+				So(results[1], ShouldResemble, []data.Map{{"a": data.Int(20), "c": data.Int(1)}})
+				So(results[2], ShouldResemble, []data.Map{{"a": data.Int(30), "c": data.Int(1)}})
+			})
+
+			Convey("Then the shared call should be evaluated once per group", func() {
+				So(numPureCalls, ShouldEqual, 3)
+			})
+		})
+	})
+}
+
+func planName(p PhysicalPlan) string {
+	switch p.(type) {
+	case *filterPlan:
+		return "filter plan"
+	}
+	return "default plan"
+}
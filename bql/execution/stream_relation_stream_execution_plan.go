@@ -82,6 +82,9 @@ type streamRelationStreamExecutionPlan struct {
 	buffers map[string]*inputBuffer
 	// emitter configuration
 	emitterType parser.Emitter
+	// distinct is true when duplicate rows have to be removed from
+	// curResults before they're emitted.
+	distinct bool
 	// curResults holds results of a query over the buffer.
 	curResults []resultRow
 	// prevResults holds results of a query over the buffer
@@ -104,24 +107,63 @@ type streamRelationStreamExecutionPlan struct {
 	// the last tuple was appended to. this is valid after
 	// `addTupleToBuffer` has returned.
 	lastTupleBuffers map[string]bool
+	// bufferedColumns holds the keys of input tuples stored in each
+	// buffer, keyed by the alias of the input stream. Other keys aren't
+	// referred to by the statement, so they're removed before buffering
+	// to reduce memory. It's nil when all keys have to be stored, e.g.
+	// when the statement has a wildcard.
+	bufferedColumns map[string]map[string]bool
+	// joins holds the joins of the FROM clause and joinConds the
+	// evaluators of their ON conditions (nil for a cross join). joins is
+	// nil when the FROM clause doesn't have an explicit join. Otherwise,
+	// input rows are recomputed from all buffers by joinInputTuples.
+	joins     []parser.JoinAST
+	joinConds []Evaluator
+	// slide is the interval at which the statement is evaluated. When
+	// it's zero, the statement is evaluated on every input tuple.
+	// nextEvaluation is the slide boundary at which the next evaluation
+	// takes place.
+	slide          time.Duration
+	nextEvaluation time.Time
+	// rowObserver is notified when an input row is added to or removed
+	// from filteredInputRows. It's nil when no plan needs to track rows
+	// and is never used when joins isn't nil.
+	rowObserver inputRowObserver
 }
 
 func newStreamRelationStreamExecutionPlan(lp *LogicalPlan, reg udf.FunctionRegistry) (*streamRelationStreamExecutionPlan, error) {
 	// prepare projection components
-	projs, err := prepareProjections(lp.Projections, reg)
+	projs, subexprs, err := prepareProjections(lp.Projections, reg, lp.CaseInsensitive)
 	if err != nil {
 		return nil, err
 	}
 	// compute evaluator for the filter
-	filter, err := prepareFilter(lp.Filter, reg)
+	filter, err := prepareFilter(lp.Filter, reg, lp.CaseInsensitive)
 	if err != nil {
 		return nil, err
 	}
 	// compute evaluators for the group clause
-	groupList, err := prepareGroupList(lp.GroupList, reg)
+	groupList, err := prepareGroupList(lp.GroupList, reg, lp.CaseInsensitive)
 	if err != nil {
 		return nil, err
 	}
+	// compute evaluators for the join conditions
+	joinConds := make([]Evaluator, len(lp.JoinConditions))
+	for i, cond := range lp.JoinConditions {
+		if joinConds[i], err = prepareFilter(cond, reg, lp.CaseInsensitive); err != nil {
+			return nil, err
+		}
+	}
+	// when more than one relation has a SLIDE specification, the
+	// statement is evaluated at the shortest interval
+	var slide time.Duration
+	for _, rel := range lp.Relations {
+		d := slideDuration(rel.Slide)
+		if d > 0 && (slide == 0 || d < slide) {
+			slide = d
+		}
+	}
+
 	// for compatibility with the old syntax, take the last RANGE
 	// specification as valid for all buffers
 
@@ -137,22 +179,53 @@ func newStreamRelationStreamExecutionPlan(lp *LogicalPlan, reg udf.FunctionRegis
 		}
 	}
 
+	var bufferedColumns map[string]map[string]bool
+	if cols, ok := lp.ReferencedColumns(); ok {
+		bufferedColumns = make(map[string]map[string]bool, len(cols))
+		for rel, keys := range cols {
+			m := make(map[string]bool, len(keys))
+			for _, k := range keys {
+				m[k] = true
+			}
+			bufferedColumns[rel] = m
+		}
+	}
+
 	return &streamRelationStreamExecutionPlan{
 		commonExecutionPlan: commonExecutionPlan{
 			projections: projs,
+			subexprs:    subexprs,
 			groupList:   groupList,
 			filter:      filter,
+			ctx:         reg.Context(),
 		},
 		relations:            lp.Relations,
 		buffers:              buffers,
 		emitterType:          lp.EmitterType,
+		distinct:             lp.Distinct,
 		curResults:           []resultRow{},
 		prevResults:          []resultRow{},
 		prevHashesForIstream: map[data.HashValue][]resultRowCount{},
 		filteredInputRows:    list.New(),
+		bufferedColumns:      bufferedColumns,
+		joins:                lp.Joins,
+		joinConds:            joinConds,
+		slide:                slide,
 	}, nil
 }
 
+// slideDuration converts a SLIDE specification to a time.Duration. It
+// returns 0 when the specification is empty.
+func slideDuration(slide parser.IntervalAST) time.Duration {
+	switch slide.Unit {
+	case parser.Seconds:
+		return time.Duration(slide.Value * float64(time.Second))
+	case parser.Milliseconds:
+		return time.Duration(slide.Value * float64(time.Millisecond))
+	}
+	return 0
+}
+
 // relationKey computes the InputName that belongs to a relation.
 // For a real stream this equals the stream's name (independent of)
 // the alias, but for a UDSF we need to use the same method that
@@ -198,8 +271,12 @@ func (ep *streamRelationStreamExecutionPlan) addTupleToBuffer(t *core.Tuple) err
 		if t.InputName == ep.relationKey(&rel) {
 			// because the tuple is always cached, ShallowCopy is required here.
 			editTuple := t.ShallowCopy()
+			d := editTuple.Data
+			if keys, ok := ep.bufferedColumns[rel.Alias]; ok {
+				d = pruneColumns(d, keys)
+			}
 			// nest the data in a one-element map using the alias as the key
-			editTuple.Data = data.Map{rel.Alias: editTuple.Data}
+			editTuple.Data = data.Map{rel.Alias: d}
 			// wrap this in a container struct
 			editTupleCont := tupleWithDerivedInputRows{
 				tuple: editTuple,
@@ -273,12 +350,29 @@ func (ep *streamRelationStreamExecutionPlan) removeOutdatedTuplesFromBuffer(curT
 		itemPtr := e.Value.(*inputRowWithCachedResult)
 		if toDelete := expiredInputRows[itemPtr]; toDelete {
 			ep.filteredInputRows.Remove(e)
+			if ep.rowObserver != nil {
+				ep.rowObserver.rowRemoved(itemPtr)
+			}
 		}
 	}
 
 	return nil
 }
 
+// distinctResults returns the rows of curResults without duplicates.
+// The first occurrence of each row is kept and the order is preserved.
+func (ep *streamRelationStreamExecutionPlan) distinctResults() []resultRow {
+	seen := make(map[data.HashValue][]resultRowCount, len(ep.curResults))
+	results := make([]resultRow, 0, len(ep.curResults))
+	for _, res := range ep.curResults {
+		if ep.incrAndGetMultiplicity(&res, seen) > 1 {
+			continue
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
 // previousMultiplicity returns how often the given map was emitted
 // in the previous run. This is required for an ISTREAM emitter.
 func (ep *streamRelationStreamExecutionPlan) previousMultiplicity(r *resultRow) int {
@@ -335,6 +429,12 @@ func (ep *streamRelationStreamExecutionPlan) incrAndGetMultiplicity(r *resultRow
 // be emitted as per the Emitter specification (Rstream = new,
 // Istream = new-old, Dstream = old-new).
 func (ep *streamRelationStreamExecutionPlan) computeResultTuples() ([]data.Map, error) {
+	if ep.distinct {
+		// deduplicated results are also kept as prevResults so that
+		// ISTREAM and DSTREAM compare the distinct rows of both runs
+		ep.curResults = ep.distinctResults()
+	}
+
 	// TODO turn this into an iterator/generator pattern
 	var output []data.Map
 	if ep.emitterType == parser.Rstream {
@@ -408,7 +508,14 @@ func (ep *streamRelationStreamExecutionPlan) computeResultTuples() ([]data.Map,
 // to the results of the query represented by this execution plan. Note that the
 // order of items in the returned slice is undefined and cannot be relied on.
 func (ep *streamRelationStreamExecutionPlan) process(input *core.Tuple, performQueryOnBuffer func() error) ([]data.Map, error) {
-	ep.now = time.Now().In(time.UTC)
+	ep.now = ep.ctx.Now().In(time.UTC)
+
+	if ep.slide > 0 {
+		return ep.processSliding(input, performQueryOnBuffer)
+	}
+	if input.Flags.IsSet(core.TFHeartbeat) {
+		return ep.processHeartbeat(input, performQueryOnBuffer)
+	}
 
 	// stream-to-relation:
 	// updates the internal buffer with correct window data
@@ -434,7 +541,95 @@ func (ep *streamRelationStreamExecutionPlan) process(input *core.Tuple, performQ
 	return ep.computeResultTuples()
 }
 
+// processHeartbeat only removes outdated tuples from the buffer using the
+// timestamp of the heartbeat tuple. The payload of the heartbeat is never
+// added to the buffer. Results are only computed when the window was changed.
+func (ep *streamRelationStreamExecutionPlan) processHeartbeat(input *core.Tuple, performQueryOnBuffer func() error) ([]data.Map, error) {
+	bufferedTuples := func() int {
+		n := 0
+		for _, buffer := range ep.buffers {
+			n += buffer.tuples.Len()
+		}
+		return n
+	}
+
+	before := bufferedTuples()
+	if err := ep.removeOutdatedTuplesFromBuffer(input.Timestamp); err != nil {
+		return nil, err
+	}
+	if bufferedTuples() == before {
+		return nil, nil
+	}
+
+	if ep.joins != nil {
+		// removing a tuple may leave its partners of an outer join
+		// without a match, so rows have to be joined again
+		if err := ep.joinInputTuples(); err != nil {
+			return nil, err
+		}
+	}
+	if err := performQueryOnBuffer(); err != nil {
+		return nil, err
+	}
+	return ep.computeResultTuples()
+}
+
+// processSliding is used instead of process and processHeartbeat when the
+// statement has a SLIDE specification. Input tuples are only buffered and
+// the query is performed once per slide interval: the first tuple or
+// heartbeat at or after a slide boundary triggers the evaluation of the
+// window as it was at that boundary, before the triggering tuple is added.
+// Heartbeats therefore act as the timer that keeps results coming when no
+// tuples arrive.
+func (ep *streamRelationStreamExecutionPlan) processSliding(input *core.Tuple, performQueryOnBuffer func() error) ([]data.Map, error) {
+	var output []data.Map
+	if ep.nextEvaluation.IsZero() {
+		ep.nextEvaluation = input.Timestamp.Truncate(ep.slide).Add(ep.slide)
+	} else if !input.Timestamp.Before(ep.nextEvaluation) {
+		boundary := input.Timestamp.Truncate(ep.slide)
+		if err := ep.removeOutdatedTuplesFromBuffer(boundary); err != nil {
+			return nil, err
+		}
+		if ep.joins != nil {
+			if err := ep.joinInputTuples(); err != nil {
+				return nil, err
+			}
+		}
+		if err := performQueryOnBuffer(); err != nil {
+			return nil, err
+		}
+		res, err := ep.computeResultTuples()
+		if err != nil {
+			return nil, err
+		}
+		output = res
+		ep.nextEvaluation = boundary.Add(ep.slide)
+	}
+
+	if input.Flags.IsSet(core.TFHeartbeat) {
+		return output, nil
+	}
+	if err := ep.addTupleToBuffer(input); err != nil {
+		return nil, err
+	}
+	if err := ep.removeOutdatedTuplesFromBuffer(input.Timestamp); err != nil {
+		return nil, err
+	}
+	if ep.joins == nil {
+		// rows of a join are recomputed from all buffers at the next
+		// evaluation, so only the cross product is updated per tuple
+		if err := ep.filterInputTuples(); err != nil {
+			return nil, err
+		}
+	}
+	return output, nil
+}
+
 func (ep *streamRelationStreamExecutionPlan) filterInputTuples() error {
+	if ep.joins != nil {
+		return ep.joinInputTuples()
+	}
+
 	// we need to make a cross product of the data in all buffers,
 	// combine it to get an input like
 	//  {"streamA": {data}, "streamB": {data}, "streamC": {data}}
@@ -521,6 +716,11 @@ func (ep *streamRelationStreamExecutionPlan) filterInputTuples() error {
 	// (NB. the items appended here will be cleaned up in future
 	// runs by `removeOutdatedTuplesFromBuffer`)
 	ep.filteredInputRows.PushBackList(ep.filteredInputRowsBuffer)
+	if ep.rowObserver != nil {
+		for e := ep.filteredInputRowsBuffer.Front(); e != nil; e = e.Next() {
+			ep.rowObserver.rowAdded(e.Value.(*inputRowWithCachedResult))
+		}
+	}
 	return nil
 }
 
@@ -570,20 +770,10 @@ func (ep *streamRelationStreamExecutionPlan) preprocCartProdInt(dataHolder data.
 
 		// evaluate filter condition
 		if ep.filter != nil {
-			filterResult, err := ep.filter.Eval(dataHolder)
+			filterResultBool, err := evalCondition(ep.filter, dataHolder)
 			if err != nil {
 				return err
 			}
-			// a NULL value is definitely not "true", so since we
-			// have only a binary decision, we should drop tuples
-			// where the filter condition evaluates to NULL
-			filterResultBool := false
-			if filterResult.Type() != data.TypeNull {
-				filterResultBool, err = data.AsBool(filterResult)
-				if err != nil {
-					return err
-				}
-			}
 			// if it evaluated to false, do not further process this tuple
 			if !filterResultBool {
 				return nil
@@ -609,3 +799,153 @@ func (ep *streamRelationStreamExecutionPlan) preprocCartProdInt(dataHolder data.
 	}
 	return nil
 }
+
+// joinInputTuples computes the input rows for the relation-to-relation
+// operation when the FROM clause has explicit joins. Relations are joined
+// from left to right, and tuples of an outer join having no partner
+// matching the ON condition are padded with NULL. Because a new tuple can
+// turn a NULL-padded row into a joined one and vice versa, all rows are
+// recomputed from the buffers instead of only adding the rows derived
+// from the new tuple as filterInputTuples does.
+func (ep *streamRelationStreamExecutionPlan) joinInputTuples() error {
+	// joinedRow is a row of the relations joined so far together with
+	// the tuples it originates from
+	type joinedRow struct {
+		row    data.Map
+		origin []*tupleWithDerivedInputRows
+	}
+	newRow := func() data.Map {
+		return data.Map{":meta:NOW": data.Timestamp(ep.now)}
+	}
+	copyRow := func(r data.Map) data.Map {
+		c := make(data.Map, len(r)+3)
+		for k, v := range r {
+			c[k] = v
+		}
+		return c
+	}
+	addTuple := func(row data.Map, alias string, t *tupleWithDerivedInputRows) {
+		row[alias] = t.tuple.Data[alias]
+		setMetadata(row, alias, t.tuple)
+	}
+
+	rows := []joinedRow{}
+	first := ep.relations[0].Alias
+	for e := ep.buffers[first].tuples.Front(); e != nil; e = e.Next() {
+		t := e.Value.(*tupleWithDerivedInputRows)
+		row := newRow()
+		addTuple(row, first, t)
+		rows = append(rows, joinedRow{row, []*tupleWithDerivedInputRows{t}})
+	}
+
+	for i, join := range ep.joins {
+		alias := ep.relations[i+1].Alias
+		buffer := ep.buffers[alias]
+		cond := ep.joinConds[i]
+		rightMatched := map[*tupleWithDerivedInputRows]bool{}
+		joined := make([]joinedRow, 0, len(rows))
+
+		for _, left := range rows {
+			leftMatched := false
+			for e := buffer.tuples.Front(); e != nil; e = e.Next() {
+				t := e.Value.(*tupleWithDerivedInputRows)
+				row := copyRow(left.row)
+				addTuple(row, alias, t)
+				if cond != nil {
+					match, err := evalCondition(cond, row)
+					if err != nil {
+						return err
+					}
+					if !match {
+						continue
+					}
+				}
+				leftMatched = true
+				rightMatched[t] = true
+				origin := make([]*tupleWithDerivedInputRows, len(left.origin), len(left.origin)+1)
+				copy(origin, left.origin)
+				joined = append(joined, joinedRow{row, append(origin, t)})
+			}
+			if !leftMatched && (join.Type == parser.LeftOuterJoin || join.Type == parser.FullOuterJoin) {
+				row := copyRow(left.row)
+				setNullRelation(row, alias)
+				joined = append(joined, joinedRow{row, left.origin})
+			}
+		}
+
+		if join.Type == parser.RightOuterJoin || join.Type == parser.FullOuterJoin {
+			for e := buffer.tuples.Front(); e != nil; e = e.Next() {
+				t := e.Value.(*tupleWithDerivedInputRows)
+				if rightMatched[t] {
+					continue
+				}
+				row := newRow()
+				for _, rel := range ep.relations[:i+1] {
+					setNullRelation(row, rel.Alias)
+				}
+				addTuple(row, alias, t)
+				joined = append(joined, joinedRow{row, []*tupleWithDerivedInputRows{t}})
+			}
+		}
+		rows = joined
+	}
+
+	// we write the results to a separate list so that the previous
+	// rows stay valid if something fails
+	filtered := make([]joinedRow, 0, len(rows))
+	for _, r := range rows {
+		if ep.filter != nil {
+			match, err := evalCondition(ep.filter, r.row)
+			if err != nil {
+				return err
+			}
+			if !match {
+				continue
+			}
+		}
+		filtered = append(filtered, r)
+	}
+
+	// replace the rows derived in the previous run
+	for _, buffer := range ep.buffers {
+		for e := buffer.tuples.Front(); e != nil; e = e.Next() {
+			e.Value.(*tupleWithDerivedInputRows).rows = nil
+		}
+	}
+	ep.filteredInputRows = list.New()
+	for _, r := range filtered {
+		row := r.row
+		item := &inputRowWithCachedResult{
+			input: &row,
+		}
+		for _, t := range r.origin {
+			t.rows = append(t.rows, item)
+		}
+		ep.filteredInputRows.PushBack(item)
+	}
+	return nil
+}
+
+// setNullRelation adds NULL as the data and the metadata of the relation
+// having the given alias to the given Map. It's used for relations padded
+// by an outer join.
+func setNullRelation(where data.Map, alias string) {
+	where[alias] = data.Null{}
+	where[fmt.Sprintf("%s:meta:%s", alias, parser.TimestampMeta)] = data.Null{}
+	where[fmt.Sprintf("%s:meta:%s", alias, parser.CorrelationIDMeta)] = data.Null{}
+}
+
+// evalCondition evaluates the given condition, such as a WHERE clause, on
+// the given row. A NULL value is definitely not "true", so since we have
+// only a binary decision, the condition is regarded as false when it
+// evaluates to NULL.
+func evalCondition(cond Evaluator, row data.Map) (bool, error) {
+	res, err := cond.Eval(row)
+	if err != nil {
+		return false, err
+	}
+	if res.Type() == data.TypeNull {
+		return false, nil
+	}
+	return data.AsBool(res)
+}
@@ -42,11 +42,34 @@ type LogicalPlan struct {
 	EmitterLimit        int64
 	EmitterSampling     float64
 	EmitterSamplingType parser.EmitterSamplingType
-	Projections         []aliasedExpression
+	// EmitterSamplingSeed is the seed of the random number generator used
+	// for RandomizedSampling. It's parser.UnspecifiedSeed when the sampling
+	// doesn't have to be reproducible.
+	EmitterSamplingSeed int64
+	// SkipEmptyWindow is true when a statement having aggregate functions
+	// without GROUP BY shouldn't emit a row for a window having no row
+	// matching the statement.
+	SkipEmptyWindow bool
+	Projections     []aliasedExpression
+	// Distinct is true when duplicate result rows of each evaluation
+	// have to be removed (SELECT DISTINCT).
+	Distinct bool
 	parser.WindowedFromAST
-	Filter    FlatExpression
-	GroupList []FlatExpression
+	// JoinConditions are the ON conditions of the joins in the FROM clause.
+	// JoinConditions[i] corresponds to Joins[i] and is nil for a cross join.
+	// It's nil when the FROM clause doesn't have an explicit join.
+	JoinConditions []FlatExpression
+	Filter         FlatExpression
+	GroupList      []FlatExpression
 	parser.HavingAST
+	// OrderBy has the expressions of the ORDER BY clause. They're evaluated
+	// on the results of the statement rather than on input rows.
+	OrderBy []orderByExpression
+	parser.LimitAST
+	// CaseInsensitive is true when column references should match
+	// keys of input tuples case-insensitively. Note that this makes
+	// lookups of keys not matching exactly O(n) in the number of keys.
+	CaseInsensitive bool
 }
 
 // PhysicalPlan is a physical interface that is capable of
@@ -65,6 +88,9 @@ type PhysicalPlan interface {
 	// core.TFSharedData flag of the input tuple must be set and the plan must
 	// not modify the Data.
 	//
+	// When the input tuple has core.TFHeartbeat flag, its Data must be
+	// ignored and only its Timestamp can be used to update the plan's state.
+	//
 	// NB. Process is not thread-safe, i.e., it must be called in
 	// a single-threaded context.
 	Process(input *core.Tuple) ([]data.Map, error)
@@ -89,10 +115,18 @@ func Analyze(s parser.SelectStmt, reg udf.FunctionRegistry) (*LogicalPlan, error
 	   >   compatible types.
 	*/
 
+	if err := validateConstants(&s); err != nil {
+		return nil, err
+	}
+
 	if err := makeRelationAliases(&s); err != nil {
 		return nil, err
 	}
 
+	if err := resolveProjectionAliases(&s); err != nil {
+		return nil, err
+	}
+
 	if err := validateReferences(&s); err != nil {
 		return nil, err
 	}
@@ -113,6 +147,49 @@ func isAggregateFunc(f udf.UDF, arity int) bool {
 	return agg
 }
 
+// projectionColumnHeader returns the key of the output column computed
+// by the i-th projection expr.
+func projectionColumnHeader(expr parser.Expression, i int) string {
+	colHeader := fmt.Sprintf("col_%v", i)
+	switch projType := expr.(type) {
+	case parser.RowMeta:
+		if projType.MetaType == parser.TimestampMeta {
+			colHeader = "ts"
+		} else if projType.MetaType == parser.CorrelationIDMeta {
+			colHeader = "correlation_id"
+		}
+	case parser.RowValue:
+		// We can only use the column name as an alias if it is not
+		// a complex JSON Path. For example, `SELECT a` will be treated
+		// like `SELECT a AS a`, but for `SELECT a..b` we will have to
+		// use the col_N form.
+		if simpleColumnNameRe.MatchString(projType.Column) {
+			colHeader = projType.Column
+		}
+	case parser.AliasAST:
+		colHeader = projType.Alias
+	case parser.FuncAppAST:
+		colHeader = string(projType.Function)
+	case parser.Wildcard:
+		// The wildcard projection (without AS) is very special in that
+		// it is the only case where the BQL user does not determine
+		// the output key names (implicitly or explicitly). The
+		// Evaluator interface is designed such that Evaluator
+		// has 100% control over the returned value, but 0% control
+		// over how it is named, therefore the wildcard evaluation
+		// requires handling in multiple locations.
+		// As a workaround, we will return the complete Map from
+		// the wildcard Evaluator, nest it under a hard-coded key
+		// called "*" and flatten them later (this is done correctly
+		// by the assignOutputValue function).
+		// Note that if it is desired at some point that there are
+		// more evaluators with that behavior, we should change the
+		// Evaluator.Eval interface.
+		colHeader = "*"
+	}
+	return colHeader
+}
+
 // flattenExpressions separates the aggregate and non-aggregate
 // part in a statement and returns with an error if there are
 // aggregates in structures that may not have some
@@ -135,41 +212,7 @@ func flattenExpressions(s *parser.SelectStmt, reg udf.FunctionRegistry) (*Logica
 			groupingMode = true
 		}
 		// compute column name
-		colHeader := fmt.Sprintf("col_%v", i)
-		switch projType := expr.(type) {
-		case parser.RowMeta:
-			if projType.MetaType == parser.TimestampMeta {
-				colHeader = "ts"
-			}
-		case parser.RowValue:
-			// We can only use the column name as an alias if it is not
-			// a complex JSON Path. For example, `SELECT a` will be treated
-			// like `SELECT a AS a`, but for `SELECT a..b` we will have to
-			// use the col_N form.
-			if simpleColumnNameRe.MatchString(projType.Column) {
-				colHeader = projType.Column
-			}
-		case parser.AliasAST:
-			colHeader = projType.Alias
-		case parser.FuncAppAST:
-			colHeader = string(projType.Function)
-		case parser.Wildcard:
-			// The wildcard projection (without AS) is very special in that
-			// it is the only case where the BQL user does not determine
-			// the output key names (implicitly or explicitly). The
-			// Evaluator interface is designed such that Evaluator
-			// has 100% control over the returned value, but 0% control
-			// over how it is named, therefore the wildcard evaluation
-			// requires handling in multiple locations.
-			// As a workaround, we will return the complete Map from
-			// the wildcard Evaluator, nest it under a hard-coded key
-			// called "*" and flatten them later (this is done correctly
-			// by the assignOutputValue function).
-			// Note that if it is desired at some point that there are
-			// more evaluators with that behavior, we should change the
-			// Evaluator.Eval interface.
-			colHeader = "*"
-		}
+		colHeader := projectionColumnHeader(expr, i)
 		flatProjExprs[i] = aliasedExpression{colHeader, flatExpr, aggrs}
 	}
 
@@ -200,6 +243,38 @@ func flattenExpressions(s *parser.SelectStmt, reg udf.FunctionRegistry) (*Logica
 		filterExpr = filterFlatExpr
 	}
 
+	var joinConds []FlatExpression
+	if s.Joins != nil {
+		joinConds = make([]FlatExpression, len(s.Joins))
+		for i, join := range s.Joins {
+			if join.On == nil {
+				continue
+			}
+			flatExpr, err := ParserExprToFlatExpr(join.On, reg)
+			if err != nil {
+				// return a prettier error message
+				if strings.HasPrefix(err.Error(), "you cannot use aggregate") {
+					err = fmt.Errorf("aggregates not allowed in ON clause")
+				}
+				return nil, err
+			}
+			joinConds[i] = flatExpr
+		}
+	}
+
+	orderBy := make([]orderByExpression, len(s.OrderBy))
+	for i, sortExpr := range s.OrderBy {
+		flatExpr, err := ParserExprToFlatExpr(sortExpr.Expr, reg)
+		if err != nil {
+			// return a prettier error message
+			if strings.HasPrefix(err.Error(), "you cannot use aggregate") {
+				err = fmt.Errorf("aggregates not allowed in ORDER BY clause")
+			}
+			return nil, err
+		}
+		orderBy[i] = orderByExpression{flatExpr, sortExpr.Ascending != parser.No}
+	}
+
 	groupCols := make([]rowValue, len(s.GroupList))
 	flatGroupExprs := make([]FlatExpression, len(s.GroupList))
 	for i, expr := range s.GroupList {
@@ -262,10 +337,14 @@ func flattenExpressions(s *parser.SelectStmt, reg udf.FunctionRegistry) (*Logica
 	emitLimit := int64(-1)
 	emitSampling := float64(-1)
 	emitSamplingType := parser.UnspecifiedSamplingType
+	emitSamplingSeed := parser.UnspecifiedSeed
+	skipEmptyWindow := false
 	for _, opt := range s.EmitterAST.EmitterOptions {
 		switch obj := opt.(type) {
 		default:
 			return nil, fmt.Errorf("unknown emitter options: %+v", obj)
+		case parser.EmitterEmptyWindow:
+			skipEmptyWindow = obj.Skip
 		case parser.EmitterLimit:
 			l := obj.Limit
 			if l < 0 {
@@ -302,6 +381,7 @@ func flattenExpressions(s *parser.SelectStmt, reg udf.FunctionRegistry) (*Logica
 						"value between 0 and 100, not %d", v)
 				}
 				emitSampling = v / 100 // project to [0,1] interval
+				emitSamplingSeed = obj.Seed
 			}
 			emitSamplingType = obj.Type
 		}
@@ -313,17 +393,25 @@ func flattenExpressions(s *parser.SelectStmt, reg udf.FunctionRegistry) (*Logica
 		emitLimit,
 		emitSampling,
 		emitSamplingType,
+		emitSamplingSeed,
+		skipEmptyWindow,
 		flatProjExprs,
+		s.Distinct,
 		s.WindowedFromAST,
+		joinConds,
 		filterExpr,
 		flatGroupExprs,
 		s.HavingAST,
+		orderBy,
+		s.LimitAST,
+		false,
 	}, nil
 }
 
 // makeRelationAliases will assign an internal alias to every relation
 // does not yet have one (given by the user). It will also detect if
-// there is a conflict between aliases.
+// there is a conflict between aliases or between an alias and the name
+// of another relation.
 func makeRelationAliases(s *parser.SelectStmt) error {
 	relNames := make(map[string]parser.AliasedStreamWindowAST, len(s.Relations))
 	newRels := make([]parser.AliasedStreamWindowAST, len(s.Relations))
@@ -341,15 +429,236 @@ func makeRelationAliases(s *parser.SelectStmt) error {
 		relNames[aliasedRel.Alias] = aliasedRel
 		newRels[i] = aliasedRel
 	}
+
+	// an alias must not hide another relation, e.g. in `FROM a AS b, b AS c`
+	// it's unclear whether `b:x` refers to a or b.
+	for _, aliasedRel := range newRels {
+		if aliasedRel.Alias == aliasedRel.Name {
+			continue
+		}
+		for _, otherRel := range newRels {
+			if otherRel.Name == aliasedRel.Alias {
+				return fmt.Errorf("cannot use the alias '%s' for relation '%s' "+
+					"because it is the name of another relation",
+					aliasedRel.Alias, aliasedRel.Name)
+			}
+		}
+	}
 	s.Relations = newRels
 	return nil
 }
 
+// resolveProjectionAliases replaces references to aliases of projections
+// in later projections by the aliased expressions, e.g. it rewrites
+// `SELECT int + 1 AS a, a * 2 AS b` into
+// `SELECT int + 1 AS a, (int + 1) * 2 AS b`. Aliases are visible from left
+// to right:
+//
+//  * Only a column reference without a relation name, such as `a`, can
+//    refer to an alias. It refers to the input column with the same name
+//    when there's no such alias in preceding projections.
+//  * An alias hides the input column with the same name in succeeding
+//    projections, but not in its own projection, e.g. `a + 1 AS a` refers
+//    to the input column `a`.
+//  * A reference to an alias of a succeeding projection is an error because
+//    it would otherwise allow circular references like
+//    `SELECT b AS a, a AS b`.
+func resolveProjectionAliases(s *parser.SelectStmt) error {
+	aliases := map[string]parser.Expression{}
+	newProjs := make([]parser.Expression, len(s.Projections))
+	for i, proj := range s.Projections {
+		later := map[string]bool{}
+		for _, p := range s.Projections[i+1:] {
+			if a, ok := p.(parser.AliasAST); ok {
+				later[a.Alias] = true
+			}
+		}
+
+		alias, isAlias := proj.(parser.AliasAST)
+		expr := proj
+		if isAlias {
+			expr = alias.Expr
+		}
+
+		newExpr, err := replaceRowValues(expr, func(rv parser.RowValue) (parser.Expression, error) {
+			if rv.Relation != "" {
+				return rv, nil
+			}
+			if e, ok := aliases[rv.Column]; ok {
+				return e, nil
+			}
+			if later[rv.Column] {
+				return nil, fmt.Errorf("cannot refer to '%s' before it is "+
+					"defined as an alias of a projection", rv.Column)
+			}
+			return rv, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if isAlias {
+			aliases[alias.Alias] = newExpr
+			newProjs[i] = parser.AliasAST{newExpr, alias.Alias}
+		} else {
+			newProjs[i] = newExpr
+		}
+	}
+	s.Projections = newProjs
+	return nil
+}
+
+// replaceRowValues returns a copy of expr in which each RowValue is
+// replaced by the expression returned from f.
+func replaceRowValues(expr parser.Expression, f func(parser.RowValue) (parser.Expression, error)) (parser.Expression, error) {
+	replaceAll := func(exprs []parser.Expression) ([]parser.Expression, error) {
+		newExprs := make([]parser.Expression, len(exprs))
+		for i, e := range exprs {
+			newExpr, err := replaceRowValues(e, f)
+			if err != nil {
+				return nil, err
+			}
+			newExprs[i] = newExpr
+		}
+		return newExprs, nil
+	}
+
+	switch obj := expr.(type) {
+	case parser.RowValue:
+		return f(obj)
+	case parser.AliasAST:
+		e, err := replaceRowValues(obj.Expr, f)
+		if err != nil {
+			return nil, err
+		}
+		return parser.AliasAST{e, obj.Alias}, nil
+	case parser.BinaryOpAST:
+		es, err := replaceAll([]parser.Expression{obj.Left, obj.Right})
+		if err != nil {
+			return nil, err
+		}
+		return parser.BinaryOpAST{obj.Op, es[0], es[1]}, nil
+	case parser.UnaryOpAST:
+		e, err := replaceRowValues(obj.Expr, f)
+		if err != nil {
+			return nil, err
+		}
+		return parser.UnaryOpAST{obj.Op, e}, nil
+	case parser.TypeCastAST:
+		e, err := replaceRowValues(obj.Expr, f)
+		if err != nil {
+			return nil, err
+		}
+		return parser.TypeCastAST{e, obj.Target}, nil
+	case parser.FuncAppAST:
+		es, err := replaceAll(obj.Expressions)
+		if err != nil {
+			return nil, err
+		}
+		obj.ExpressionsAST = parser.ExpressionsAST{es}
+		if obj.Ordering != nil {
+			ordering := make([]parser.SortedExpressionAST, len(obj.Ordering))
+			for i, o := range obj.Ordering {
+				e, err := replaceRowValues(o.Expr, f)
+				if err != nil {
+					return nil, err
+				}
+				ordering[i] = parser.SortedExpressionAST{e, o.Ascending}
+			}
+			obj.Ordering = ordering
+		}
+		if obj.Filter != nil {
+			e, err := replaceRowValues(obj.Filter, f)
+			if err != nil {
+				return nil, err
+			}
+			obj.Filter = e
+		}
+		return obj, nil
+	case parser.ArrayAST:
+		es, err := replaceAll(obj.Expressions)
+		if err != nil {
+			return nil, err
+		}
+		return parser.ArrayAST{parser.ExpressionsAST{es}}, nil
+	case parser.LikePatternAST:
+		e, err := replaceRowValues(obj.Pattern, f)
+		if err != nil {
+			return nil, err
+		}
+		return parser.LikePatternAST{e, obj.Escape}, nil
+	case parser.MapAST:
+		entries := make([]parser.KeyValuePairAST, len(obj.Entries))
+		for i, pair := range obj.Entries {
+			e, err := replaceRowValues(pair.Value, f)
+			if err != nil {
+				return nil, err
+			}
+			entries[i] = parser.KeyValuePairAST{pair.Key, e, nil}
+			if pair.KeyExpr != nil {
+				k, err := replaceRowValues(pair.KeyExpr, f)
+				if err != nil {
+					return nil, err
+				}
+				entries[i].KeyExpr = k
+			}
+		}
+		return parser.MapAST{entries}, nil
+	case parser.ConditionCaseAST:
+		return replaceRowValuesInCase(obj, f)
+	case parser.ExpressionCaseAST:
+		e, err := replaceRowValues(obj.Expr, f)
+		if err != nil {
+			return nil, err
+		}
+		c, err := replaceRowValuesInCase(obj.ConditionCaseAST, f)
+		if err != nil {
+			return nil, err
+		}
+		return parser.ExpressionCaseAST{e, c}, nil
+	}
+	// literals, wildcards, and meta data don't have RowValues
+	return expr, nil
+}
+
+func replaceRowValuesInCase(c parser.ConditionCaseAST, f func(parser.RowValue) (parser.Expression, error)) (parser.ConditionCaseAST, error) {
+	checks := make([]parser.WhenThenPairAST, len(c.Checks))
+	for i, pair := range c.Checks {
+		when, err := replaceRowValues(pair.When, f)
+		if err != nil {
+			return parser.ConditionCaseAST{}, err
+		}
+		then, err := replaceRowValues(pair.Then, f)
+		if err != nil {
+			return parser.ConditionCaseAST{}, err
+		}
+		checks[i] = parser.WhenThenPairAST{when, then}
+	}
+	c.Checks = checks
+	if c.Else != nil {
+		e, err := replaceRowValues(c.Else, f)
+		if err != nil {
+			return parser.ConditionCaseAST{}, err
+		}
+		c.Else = e
+	}
+	return c, nil
+}
+
 // validateReferences checks if the references to input relations
-// in SELECT, WHERE, GROUP BY and HAVING clauses of the given
+// in SELECT, ON, WHERE, GROUP BY and HAVING clauses of the given
 // statement are matching the relations mentioned in the FROM
-// clause.
+// clause. The ORDER BY clause must not refer to input relations
+// because it's evaluated on the results of the statement.
 func validateReferences(s *parser.SelectStmt) error {
+	for _, sortExpr := range s.OrderBy {
+		for rel := range sortExpr.ReferencedRelations() {
+			if rel != "" {
+				return fmt.Errorf("cannot refer to relation '%s' in ORDER BY "+
+					"clause, refer to a column of the result instead", rel)
+			}
+		}
+	}
 
 	/* We want to check if we can access all relations properly.
 	   If there is just one input relation, we ask that none of the
@@ -368,6 +677,14 @@ func validateReferences(s *parser.SelectStmt) error {
 			refRels[rel] = true
 		}
 	}
+	for _, join := range s.Joins {
+		if join.On == nil {
+			continue
+		}
+		for rel := range join.On.ReferencedRelations() {
+			refRels[rel] = true
+		}
+	}
 	if s.Filter != nil {
 		for rel := range s.Filter.ReferencedRelations() {
 			refRels[rel] = true
@@ -496,13 +813,42 @@ func validateReferences(s *parser.SelectStmt) error {
 				return err
 			}
 		}
+
+		slide := rel.Slide
+		switch slide.Unit {
+		case parser.UnspecifiedIntervalUnit:
+			continue
+		case parser.Seconds:
+			if slide.Value > MaxRangeSec {
+				err := fmt.Errorf("SLIDE value %v is too large for SECONDS (must be at most %d)",
+					slide.Value, int64(MaxRangeSec))
+				return err
+			}
+		case parser.Milliseconds:
+			if slide.Value > MaxRangeMillisec {
+				err := fmt.Errorf("SLIDE value %v is too large for MILLISECONDS (must be at most %d)",
+					slide.Value, int64(MaxRangeMillisec))
+				return err
+			}
+		default:
+			err := fmt.Errorf("SLIDE must be given in SECONDS or MILLISECONDS, not %v",
+				slide.Unit)
+			return err
+		}
+		if slide.Value <= 0 {
+			err := fmt.Errorf("number in SLIDE clause must be positive, not %v", slide.Value)
+			return err
+		}
 	}
 
 	return nil
 }
 
-// LogicalOptimize does nothing at the moment. In the future, logical
-// optimizations (evaluation of foldable terms etc.) can be added here.
+// LogicalOptimize returns an optimized copy of the plan. At the moment,
+// it only removes duplicated conjuncts of the WHERE clause and reorders the
+// remaining ones so that cheap ones are evaluated first. In the future,
+// other logical optimizations (evaluation of foldable terms etc.) can be
+// added here.
 func (lp *LogicalPlan) LogicalOptimize() (*LogicalPlan, error) {
 	/*
 	   In Spark, this does the following:
@@ -511,7 +857,11 @@ func (lp *LogicalPlan) LogicalOptimize() (*LogicalPlan, error) {
 	   > pruning, null propagation, Boolean expression simplification,
 	   > and other rules.
 	*/
-	return lp, nil
+	optimized := *lp
+	if optimized.Filter != nil {
+		optimized.Filter = reorderConjuncts(removeDuplicateConjuncts(optimized.Filter))
+	}
+	return &optimized, nil
 }
 
 // MakePhysicalPlan creates a physical execution plan that is able to
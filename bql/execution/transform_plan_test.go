@@ -46,13 +46,13 @@ type analyzeTest struct {
 func TestRelationChecker(t *testing.T) {
 	r := parser.IntervalAST{parser.FloatLiteral{2}, parser.Tuples}
 	singleFrom := parser.WindowedFromAST{
-		[]parser.AliasedStreamWindowAST{
-			{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "t", nil}, r, 0, parser.Wait}, ""},
+		Relations: []parser.AliasedStreamWindowAST{
+			{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "t", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, ""},
 		},
 	}
 	singleFromAlias := parser.WindowedFromAST{
-		[]parser.AliasedStreamWindowAST{
-			{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "s", nil}, r, 0, parser.Wait}, "t"},
+		Relations: []parser.AliasedStreamWindowAST{
+			{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "s", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, "t"},
 		},
 	}
 	two := parser.NumericLiteral{2}
@@ -72,142 +72,142 @@ func TestRelationChecker(t *testing.T) {
 	testCases := []analyzeTest{
 		// SELECT a   -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{a}},
+			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{a}, false},
 		}, "need at least one relation to select from"},
 		// SELECT ts() -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{ts}},
+			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{ts}, false},
 		}, "need at least one relation to select from"},
 		// SELECT 2   -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{two}},
+			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{two}, false},
 		}, "need at least one relation to select from"},
 		// SELECT *   -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{wc}},
+			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{wc}, false},
 		}, "need at least one relation to select from"},
 		// SELECT t:a -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{tA}},
+			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{tA}, false},
 		}, "need at least one relation to select from"},
 		// SELECT t:ts() -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{tTs}},
+			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{tTs}, false},
 		}, "need at least one relation to select from"},
 		// SELECT t:*   -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{tWc}},
+			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{tWc}, false},
 		}, "need at least one relation to select from"},
 
 		////////// FROM (single input relation) //////////////
 
 		// SELECT a        FROM t -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 		// SELECT ts()     FROM t -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{ts}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{ts}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 		// SELECT a, ts()  FROM t -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a, ts}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a, ts}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 		// SELECT f(a ORDER BY b)  FROM t -> OK
 		{&parser.SelectStmt{
 			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{
 				parser.FuncAppAST{"f", parser.ExpressionsAST{[]parser.Expression{a}},
-					[]parser.SortedExpressionAST{{b, parser.UnspecifiedKeyword}}},
-			}},
+					[]parser.SortedExpressionAST{{b, parser.UnspecifiedKeyword}}, false, nil},
+			}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 		// SELECT 2        FROM t -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 		// SELECT *        FROM t -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{wc}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{wc}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 		// SELECT a, *  FROM t -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a, wc}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a, wc}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 		// SELECT t:a      FROM t -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 		// SELECT t:a, t:b FROM t -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA, tB}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA, tB}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 		// SELECT t:a, t:* FROM t -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA, tWc}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA, tWc}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 		// SELECT t:a, t:ts() FROM t -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA, tTs}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA, tTs}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 		// SELECT 2, t:a   FROM t -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two, tA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two, tA}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 		// SELECT t:*      FROM t -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tWc}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tWc}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 		// SELECT a, t:b   FROM t -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a, tA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a, tA}, false},
 			WindowedFromAST: singleFrom,
 		}, "cannot refer to relations"},
 		// SELECT f(a ORDER BY t:b)  FROM t -> NG
 		{&parser.SelectStmt{
 			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{
 				parser.FuncAppAST{"f", parser.ExpressionsAST{[]parser.Expression{a}},
-					[]parser.SortedExpressionAST{{tB, parser.UnspecifiedKeyword}}},
-			}},
+					[]parser.SortedExpressionAST{{tB, parser.UnspecifiedKeyword}}, false, nil},
+			}, false},
 			WindowedFromAST: singleFrom,
 		}, "cannot refer to relations"},
 		// SELECT f(t:a ORDER BY b)  FROM t -> NG
 		{&parser.SelectStmt{
 			ProjectionsAST: parser.ProjectionsAST{[]parser.Expression{
 				parser.FuncAppAST{"f", parser.ExpressionsAST{[]parser.Expression{tA}},
-					[]parser.SortedExpressionAST{{b, parser.UnspecifiedKeyword}}},
-			}},
+					[]parser.SortedExpressionAST{{b, parser.UnspecifiedKeyword}}, false, nil},
+			}, false},
 			WindowedFromAST: singleFrom,
 		}, "cannot refer to relations"},
 		// SELECT a, t:*   FROM t -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a, tWc}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a, tWc}, false},
 			WindowedFromAST: singleFrom,
 		}, "cannot refer to relations"},
 		// SELECT t:a, *   FROM t -> OK (this is special about the wildcard!!)
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA, wc}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA, wc}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 		// SELECT a, t:ts() FROM t -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a, tTs}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a, tTs}, false},
 			WindowedFromAST: singleFrom,
 		}, "cannot refer to relations"},
 		// SELECT x:a      FROM t -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{xA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{xA}, false},
 			WindowedFromAST: singleFrom,
 		}, "cannot refer to relation 'x' when using only 't'"},
 
@@ -215,79 +215,79 @@ func TestRelationChecker(t *testing.T) {
 
 		// SELECT a   FROM t WHERE 2   -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}, false},
 			WindowedFromAST: singleFrom,
 			FilterAST:       parser.FilterAST{two},
 		}, ""},
 		// SELECT 2   FROM t WHERE 2   -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}, false},
 			WindowedFromAST: singleFrom,
 			FilterAST:       parser.FilterAST{two},
 		}, ""},
 		// SELECT t:a FROM t WHERE 2   -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}, false},
 			WindowedFromAST: singleFrom,
 			FilterAST:       parser.FilterAST{two},
 		}, ""},
 		// SELECT a   FROM t WHERE b   -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}, false},
 			WindowedFromAST: singleFrom,
 			FilterAST:       parser.FilterAST{b},
 		}, ""},
 		// SELECT 2   FROM t WHERE b   -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}, false},
 			WindowedFromAST: singleFrom,
 			FilterAST:       parser.FilterAST{b},
 		}, ""},
 		// SELECT *   FROM t WHERE b   -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{wc}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{wc}, false},
 			WindowedFromAST: singleFrom,
 			FilterAST:       parser.FilterAST{b},
 		}, ""},
 		// SELECT t:a FROM t WHERE b   -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tWc}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tWc}, false},
 			WindowedFromAST: singleFrom,
 			FilterAST:       parser.FilterAST{b},
 		}, "cannot refer to relations"},
 		// SELECT t:* FROM t WHERE b   -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}, false},
 			WindowedFromAST: singleFrom,
 			FilterAST:       parser.FilterAST{b},
 		}, "cannot refer to relations"},
 		// SELECT a   FROM t WHERE t:b -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}, false},
 			WindowedFromAST: singleFrom,
 			FilterAST:       parser.FilterAST{tB},
 		}, "cannot refer to relations"},
 		// SELECT *   FROM t WHERE t:b -> OK (this is special about wildcard!)
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{wc}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{wc}, false},
 			WindowedFromAST: singleFrom,
 			FilterAST:       parser.FilterAST{tB},
 		}, ""},
 		// SELECT 2   FROM t WHERE t:b -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}, false},
 			WindowedFromAST: singleFrom,
 			FilterAST:       parser.FilterAST{tB},
 		}, ""},
 		// SELECT t:a FROM t WHERE t:b -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}, false},
 			WindowedFromAST: singleFrom,
 			FilterAST:       parser.FilterAST{tB},
 		}, ""},
 		// SELECT 2   FROM t WHERE x:b -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}, false},
 			WindowedFromAST: singleFrom,
 			FilterAST:       parser.FilterAST{xB},
 		}, "cannot refer to relation 'x' when using only 't'"},
@@ -296,79 +296,79 @@ func TestRelationChecker(t *testing.T) {
 
 		// SELECT a   FROM t GROUP BY 2        -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}, false},
 			WindowedFromAST: singleFrom,
 			GroupingAST:     parser.GroupingAST{[]parser.Expression{two}},
 		}, ""},
 		// SELECT 2   FROM t GROUP BY 2        -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}, false},
 			WindowedFromAST: singleFrom,
 			GroupingAST:     parser.GroupingAST{[]parser.Expression{two}},
 		}, ""},
 		// SELECT t:a FROM t GROUP BY 2        -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}, false},
 			WindowedFromAST: singleFrom,
 			GroupingAST:     parser.GroupingAST{[]parser.Expression{two}},
 		}, ""},
 		// SELECT a   FROM t GROUP BY b        -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}, false},
 			WindowedFromAST: singleFrom,
 			GroupingAST:     parser.GroupingAST{[]parser.Expression{b}},
 		}, ""},
 		// SELECT a   FROM t GROUP BY b, c     -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}, false},
 			WindowedFromAST: singleFrom,
 			GroupingAST:     parser.GroupingAST{[]parser.Expression{b, c}},
 		}, ""},
 		// SELECT 2   FROM t GROUP BY b        -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}, false},
 			WindowedFromAST: singleFrom,
 			GroupingAST:     parser.GroupingAST{[]parser.Expression{b}},
 		}, ""},
 		// SELECT t:a FROM t GROUP BY b        -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}, false},
 			WindowedFromAST: singleFrom,
 			GroupingAST:     parser.GroupingAST{[]parser.Expression{b}},
 		}, "cannot refer to relations"},
 		// SELECT a   FROM t GROUP BY t:b      -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}, false},
 			WindowedFromAST: singleFrom,
 			GroupingAST:     parser.GroupingAST{[]parser.Expression{tB}},
 		}, "cannot refer to relations"},
 		// SELECT 2   FROM t GROUP BY t:b      -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}, false},
 			WindowedFromAST: singleFrom,
 			GroupingAST:     parser.GroupingAST{[]parser.Expression{tB}},
 		}, ""},
 		// SELECT t:a FROM t GROUP BY t:b      -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}, false},
 			WindowedFromAST: singleFrom,
 			GroupingAST:     parser.GroupingAST{[]parser.Expression{tB}},
 		}, ""},
 		// SELECT t:a FROM t GROUP BY t:b, t:c -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}, false},
 			WindowedFromAST: singleFrom,
 			GroupingAST:     parser.GroupingAST{[]parser.Expression{tB, tC}},
 		}, ""},
 		// SELECT t:a FROM t GROUP BY b, t:b   -> NG (same table with multiple aliases)
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}, false},
 			WindowedFromAST: singleFrom,
 			GroupingAST:     parser.GroupingAST{[]parser.Expression{b, tB}},
 		}, "cannot refer to relations"},
 		// SELECT 2   FROM t GROUP BY x:b      -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}, false},
 			WindowedFromAST: singleFrom,
 			GroupingAST:     parser.GroupingAST{[]parser.Expression{xB}},
 		}, "cannot refer to relation 'x' when using only 't'"},
@@ -377,49 +377,49 @@ func TestRelationChecker(t *testing.T) {
 
 		// SELECT a   FROM t HAVING 2   -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}, false},
 			WindowedFromAST: singleFrom,
 			HavingAST:       parser.HavingAST{two},
 		}, ""},
 		// SELECT 2   FROM t HAVING 2   -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}, false},
 			WindowedFromAST: singleFrom,
 			HavingAST:       parser.HavingAST{two},
 		}, ""},
 		// SELECT t:a FROM t HAVING 2   -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}, false},
 			WindowedFromAST: singleFrom,
 			HavingAST:       parser.HavingAST{two},
 		}, ""},
 		// SELECT a   FROM t HAVING b   -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}, false},
 			WindowedFromAST: singleFrom,
 			HavingAST:       parser.HavingAST{b},
 		}, ""},
 		// SELECT 2   FROM t HAVING b   -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{two}, false},
 			WindowedFromAST: singleFrom,
 			HavingAST:       parser.HavingAST{b},
 		}, ""},
 		// SELECT t:a FROM t HAVING b   -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}, false},
 			WindowedFromAST: singleFrom,
 			HavingAST:       parser.HavingAST{b},
 		}, "cannot refer to relations"},
 		// SELECT t:a FROM t HAVING t:b   -> OK
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{tA}, false},
 			WindowedFromAST: singleFrom,
 			HavingAST:       parser.HavingAST{tB},
 		}, ""},
 		// SELECT a   FROM t HAVING t:b -> NG
 		{&parser.SelectStmt{
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}, false},
 			WindowedFromAST: singleFrom,
 			HavingAST:       parser.HavingAST{tB},
 		}, "cannot refer to relations"},
@@ -429,7 +429,7 @@ func TestRelationChecker(t *testing.T) {
 		// SELECT ISTREAM                                      a FROM t -> OK
 		{&parser.SelectStmt{
 			EmitterAST:      parser.EmitterAST{parser.Istream, nil},
-			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}},
+			ProjectionsAST:  parser.ProjectionsAST{[]parser.Expression{a}, false},
 			WindowedFromAST: singleFrom,
 		}, ""},
 	}
@@ -525,61 +525,89 @@ func TestRelationChecker(t *testing.T) {
 func TestRelationAliasing(t *testing.T) {
 	r := parser.IntervalAST{parser.FloatLiteral{2}, parser.Tuples}
 	two := parser.NumericLiteral{2}
-	proj := parser.ProjectionsAST{[]parser.Expression{two}}
+	proj := parser.ProjectionsAST{[]parser.Expression{two}, false}
 
 	testCases := []analyzeTest{
 		// SELECT 2 FROM a              -> OK
 		{&parser.SelectStmt{
 			ProjectionsAST: proj,
 			WindowedFromAST: parser.WindowedFromAST{
-				[]parser.AliasedStreamWindowAST{
-					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil}, r, 0, parser.Wait}, ""},
+				Relations: []parser.AliasedStreamWindowAST{
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, ""},
 				}},
 		}, ""},
 		// SELECT 2 FROM a AS b         -> OK
 		{&parser.SelectStmt{
 			ProjectionsAST: proj,
 			WindowedFromAST: parser.WindowedFromAST{
-				[]parser.AliasedStreamWindowAST{
-					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil}, r, 0, parser.Wait}, "b"},
+				Relations: []parser.AliasedStreamWindowAST{
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, "b"},
 				}},
 		}, ""},
 		// SELECT 2 FROM a AS b, a      -> OK
 		{&parser.SelectStmt{
 			ProjectionsAST: proj,
 			WindowedFromAST: parser.WindowedFromAST{
-				[]parser.AliasedStreamWindowAST{
-					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil}, r, 0, parser.Wait}, "b"},
-					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil}, r, 0, parser.Wait}, ""},
+				Relations: []parser.AliasedStreamWindowAST{
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, "b"},
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, ""},
+				}},
+		}, ""},
+		// SELECT 2 FROM a AS b, c AS d, a -> OK
+		{&parser.SelectStmt{
+			ProjectionsAST: proj,
+			WindowedFromAST: parser.WindowedFromAST{
+				Relations: []parser.AliasedStreamWindowAST{
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, "b"},
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "c", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, "d"},
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, ""},
 				}},
 		}, ""},
-		// SELECT 2 FROM a AS b, c AS a -> OK
+		// SELECT 2 FROM a AS a, b      -> OK
 		{&parser.SelectStmt{
 			ProjectionsAST: proj,
 			WindowedFromAST: parser.WindowedFromAST{
-				[]parser.AliasedStreamWindowAST{
-					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil}, r, 0, parser.Wait}, "b"},
-					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "c", nil}, r, 0, parser.Wait}, "a"},
+				Relations: []parser.AliasedStreamWindowAST{
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, "a"},
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "b", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, ""},
 				}},
 		}, ""},
+		// SELECT 2 FROM a AS b, c AS a -> NG
+		{&parser.SelectStmt{
+			ProjectionsAST: proj,
+			WindowedFromAST: parser.WindowedFromAST{
+				Relations: []parser.AliasedStreamWindowAST{
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, "b"},
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "c", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, "a"},
+				}},
+		}, "cannot use the alias 'a' for relation 'c' because it is the name of another relation"},
+		// SELECT 2 FROM a AS b, b AS c -> NG
+		{&parser.SelectStmt{
+			ProjectionsAST: proj,
+			WindowedFromAST: parser.WindowedFromAST{
+				Relations: []parser.AliasedStreamWindowAST{
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, "b"},
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "b", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, "c"},
+				}},
+		}, "cannot use the alias 'b' for relation 'a' because it is the name of another relation"},
 		// SELECT 2 FROM a, a           -> NG
 		{&parser.SelectStmt{
 			ProjectionsAST: proj,
 			WindowedFromAST: parser.WindowedFromAST{
-				[]parser.AliasedStreamWindowAST{
-					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil}, r, 0, parser.Wait}, ""},
-					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil}, r, 0, parser.Wait}, ""},
+				Relations: []parser.AliasedStreamWindowAST{
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, ""},
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, ""},
 				}},
 		}, "cannot use relations"},
 		// SELECT 2 FROM a, b AS a      -> NG
 		{&parser.SelectStmt{
 			ProjectionsAST: proj,
 			WindowedFromAST: parser.WindowedFromAST{
-				[]parser.AliasedStreamWindowAST{
-					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil}, r, 0, parser.Wait}, ""},
-					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "b", nil}, r, 0, parser.Wait}, "a"},
+				Relations: []parser.AliasedStreamWindowAST{
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "a", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, ""},
+					{parser.StreamWindowAST{parser.Stream{parser.ActualStream, "b", nil, nil}, r, 0, parser.Wait, parser.TupleCapacity, parser.IntervalAST{}}, "a"},
 				}},
-		}, "cannot use relations"},
+		}, "cannot use relations 'b' and 'a' with the same alias 'a'"},
 	}
 
 	reg := udf.CopyGlobalUDFRegistry(core.NewContext(nil))
@@ -742,11 +770,11 @@ func TestAggregateChecker(t *testing.T) {
 
 		{`{"udaf": udaf(a + 1), "3": 3, "g": g(count(a))} FROM x [RANGE 1 TUPLES]`, "",
 			mapAST{[]keyValuePair{
-				{"udaf", funcAppAST{"udaf", []FlatExpression{aggInputRef{"g_2d5e5764"}}}},
-				{"3", numericLiteral{3}},
+				{"udaf", funcAppAST{"udaf", []FlatExpression{aggInputRef{"g_2d5e5764"}}}, nil},
+				{"3", numericLiteral{3}, nil},
 				{"g", funcAppAST{"g", []FlatExpression{
 					funcAppAST{"count", []FlatExpression{aggInputRef{"g_f12cd6bc"}}},
-				}}},
+				}}, nil},
 			}},
 			map[string]FlatExpression{
 				"g_2d5e5764": binaryOpAST{parser.Plus,
@@ -775,6 +803,8 @@ func TestAggregateChecker(t *testing.T) {
 				funcAppAST{"count", []FlatExpression{aggInputRef{"g_f12cd6bc"}}},
 				[]sortExpression{sortExpression{aggInputRef{"g_f12cd6bc"}, true}},
 				"ccd0ef22",
+				false,
+				nil,
 			},
 			map[string]FlatExpression{
 				"g_f12cd6bc": rowValue{"x", "a"},
@@ -786,6 +816,8 @@ func TestAggregateChecker(t *testing.T) {
 				funcAppAST{"count", []FlatExpression{aggInputRef{"g_f12cd6bc"}}},
 				[]sortExpression{sortExpression{aggInputRef{"g_77d2dd39"}, false}},
 				"d7196f56",
+				false,
+				nil,
 			},
 			map[string]FlatExpression{
 				"g_f12cd6bc": rowValue{"x", "a"},
@@ -799,11 +831,15 @@ func TestAggregateChecker(t *testing.T) {
 					funcAppAST{"count", []FlatExpression{aggInputRef{"g_f12cd6bc"}}},
 					[]sortExpression{sortExpression{aggInputRef{"g_77d2dd39"}, false}},
 					"d7196f56",
+					false,
+					nil,
 				},
 				aggregateInputSorter{
 					funcAppAST{"count", []FlatExpression{aggInputRef{"g_f12cd6bc"}}},
 					[]sortExpression{sortExpression{aggInputRef{"g_77d2dd39"}, true}},
 					"cd35e18d",
+					false,
+					nil,
 				},
 			},
 			map[string]FlatExpression{
@@ -1036,6 +1072,8 @@ func TestVolatileAggregateChecker(t *testing.T) {
 					funcAppAST{"count", []FlatExpression{aggInputRef{"g_2523c3a2_0"}}},
 					[]sortExpression{sortExpression{aggInputRef{"g_2523c3a2_1"}, true}},
 					"cf2e24d7",
+					false,
+					nil,
 				},
 			},
 			[]map[string]FlatExpression{{
@@ -1106,8 +1144,8 @@ func TestVolatileAggregateChecker(t *testing.T) {
 				funcAppAST{"udaf", []FlatExpression{aggInputRef{"g_2523c3a2_0"},
 					rowValue{"x", "a"}, aggInputRef{"g_2523c3a2_1"}}},
 				mapAST{[]keyValuePair{
-					{"c", funcAppAST{"count", []FlatExpression{aggInputRef{"g_2523c3a2_2"}}}},
-					{"u", funcAppAST{"udaf", []FlatExpression{aggInputRef{"g_2523c3a2_3"}}}},
+					{"c", funcAppAST{"count", []FlatExpression{aggInputRef{"g_2523c3a2_2"}}}, nil},
+					{"u", funcAppAST{"udaf", []FlatExpression{aggInputRef{"g_2523c3a2_3"}}}, nil},
 				}},
 			},
 			[]map[string]FlatExpression{
@@ -1173,3 +1211,98 @@ func TestVolatileAggregateChecker(t *testing.T) {
 		})
 	}
 }
+
+func TestProjectionAliasResolver(t *testing.T) {
+	testCases := []struct {
+		bql           string
+		expectedError string
+		exprs         []FlatExpression
+	}{
+		// a back-reference is replaced by the aliased expression
+		{"a + 1 AS x, x * 2 AS y FROM s [RANGE 1 TUPLES]", "",
+			[]FlatExpression{
+				binaryOpAST{parser.Plus, rowValue{"s", "a"}, numericLiteral{1}},
+				binaryOpAST{parser.Multiply,
+					binaryOpAST{parser.Plus, rowValue{"s", "a"}, numericLiteral{1}},
+					numericLiteral{2}},
+			}},
+		// references are resolved transitively
+		{"a AS x, x AS y, [y, x] AS z FROM s [RANGE 1 TUPLES]", "",
+			[]FlatExpression{
+				rowValue{"s", "a"},
+				rowValue{"s", "a"},
+				arrayAST{[]FlatExpression{rowValue{"s", "a"}, rowValue{"s", "a"}}},
+			}},
+		// an alias can be used with multiple relations without a relation name
+		{"s:a AS x, x + t:a FROM s [RANGE 1 TUPLES], t [RANGE 1 TUPLES]", "",
+			[]FlatExpression{
+				rowValue{"s", "a"},
+				binaryOpAST{parser.Plus, rowValue{"s", "a"}, rowValue{"t", "a"}},
+			}},
+		// an alias isn't visible in its own projection
+		{"a + 1 AS a FROM s [RANGE 1 TUPLES]", "",
+			[]FlatExpression{
+				binaryOpAST{parser.Plus, rowValue{"s", "a"}, numericLiteral{1}},
+			}},
+		// an alias hides an input column with the same name, but not a
+		// reference with a relation name
+		{"b AS a, a FROM s [RANGE 1 TUPLES]", "",
+			[]FlatExpression{
+				rowValue{"s", "b"},
+				rowValue{"s", "b"},
+			}},
+		{"s:b AS a, a, t:a FROM s [RANGE 1 TUPLES], t [RANGE 1 TUPLES]", "",
+			[]FlatExpression{
+				rowValue{"s", "b"},
+				rowValue{"s", "b"},
+				rowValue{"t", "a"},
+			}},
+		// an aggregate can be referred to
+		{"count(a) AS c, c + 1 FROM x [RANGE 1 TUPLES]", "",
+			[]FlatExpression{
+				funcAppAST{"count", []FlatExpression{aggInputRef{"g_f12cd6bc"}}},
+				binaryOpAST{parser.Plus,
+					funcAppAST{"count", []FlatExpression{aggInputRef{"g_f12cd6bc"}}},
+					numericLiteral{1}},
+			}},
+		// forward and circular references are not allowed
+		{"x + 1 AS y, a AS x FROM s [RANGE 1 TUPLES]",
+			"cannot refer to 'x' before it is defined", nil},
+		{"b AS a, a AS b FROM s [RANGE 1 TUPLES]",
+			"cannot refer to 'b' before it is defined", nil},
+	}
+
+	reg := udf.CopyGlobalUDFRegistry(core.NewContext(nil))
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		Convey(fmt.Sprintf("Given the statement %s", testCase.bql), t, func() {
+			p := parser.New()
+			stmt := "CREATE STREAM x AS SELECT ISTREAM " + testCase.bql
+			astUnchecked, _, err := p.ParseStmt(stmt)
+			So(err, ShouldBeNil)
+			So(astUnchecked, ShouldHaveSameTypeAs, parser.CreateStreamAsSelectStmt{})
+			ast := astUnchecked.(parser.CreateStreamAsSelectStmt).Select
+
+			Convey("When we analyze it", func() {
+				logPlan, err := Analyze(ast, reg)
+				expectedError := testCase.expectedError
+				if expectedError == "" {
+					Convey("There is no error", func() {
+						So(err, ShouldBeNil)
+						So(len(logPlan.Projections), ShouldEqual, len(testCase.exprs))
+						for i, proj := range logPlan.Projections {
+							So(proj.expr, ShouldResemble, testCase.exprs[i])
+						}
+					})
+				} else {
+					Convey("There is an error", func() {
+						So(err, ShouldNotBeNil)
+						So(err.Error(), ShouldStartWith, expectedError)
+					})
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,563 @@
+package bql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// tailFingerprintSize is the maximum number of bytes at the beginning of
+	// a file used to identify the file in a checkpoint.
+	tailFingerprintSize = 256
+
+	tailReadBufferSize = 64 * 1024
+)
+
+// tailSource reads lines appended to files matching a glob pattern like
+// tail -F. It polls files periodically and detects rotation (i.e. the path
+// refers to a different file) and truncation (i.e. the file becomes smaller
+// than the offset). A rotated file is read until its end before it's closed.
+// A file renamed to another path matching the pattern continues to be read
+// from the same offset.
+//
+// When a checkpoint path is given, offsets of files are saved to the file so
+// that the source can resume reading from them after it's recreated. A file
+// is identified by its path and a fingerprint of its first bytes.
+//
+// tailSource implements core.RewindableSource by itself instead of being
+// wrapped by core.NewRewindableSource because it has to notice Rewind and
+// Stop while it's waiting for new lines without writing any tuple. Rewinding
+// the source makes it read all files from the beginning.
+type tailSource struct {
+	ioParams       *IOParams
+	emitter        *lineEmitter
+	pattern        string
+	startAtEnd     bool
+	pollInterval   time.Duration
+	checkpointPath string
+	stopCh         chan struct{}
+	doneCh         chan struct{}
+
+	// resumeCh is non-nil while the source is paused and closed when it's
+	// resumed. It's protected by pauseMutex.
+	pauseMutex sync.Mutex
+	resumeCh   chan struct{}
+
+	// rewinding is 1 when Rewind is called and GenerateStream hasn't handled
+	// it yet. rewindCh wakes up GenerateStream waiting for new lines.
+	rewinding int32
+	rewindCh  chan struct{}
+
+	// checkpoint has offsets loaded from the checkpoint file. Each entry is
+	// removed once the file is opened.
+	checkpoint map[string]*tailCheckpointEntry
+
+	// m protects files and offsets in them because Status can concurrently
+	// be called. Only GenerateStream modifies them, so it reads them without
+	// the lock.
+	m     sync.Mutex
+	files map[string]*tailedFile
+	dirty bool
+}
+
+type tailedFile struct {
+	path       string
+	f          *os.File
+	info       os.FileInfo
+	offset     int64 // the offset of the next line to be read
+	lineNumber int64
+}
+
+type tailCheckpoint struct {
+	Files []*tailCheckpointEntry `json:"files"`
+}
+
+type tailCheckpointEntry struct {
+	Path            string `json:"path"`
+	Offset          int64  `json:"offset"`
+	Fingerprint     string `json:"fingerprint"`
+	FingerprintSize int64  `json:"fingerprint_size"`
+}
+
+var _ core.RewindableSource = &tailSource{}
+
+func newTailSource(ioParams *IOParams, e *lineEmitter, pattern, startPosition string,
+	pollInterval time.Duration, checkpointPath string) (*tailSource, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("path parameter has an invalid pattern: %v", err)
+	}
+	s := &tailSource{
+		ioParams:       ioParams,
+		emitter:        e,
+		pattern:        pattern,
+		pollInterval:   pollInterval,
+		checkpointPath: checkpointPath,
+		stopCh:         make(chan struct{}),
+		doneCh:         make(chan struct{}),
+		rewindCh:       make(chan struct{}, 1),
+		files:          map[string]*tailedFile{},
+	}
+	switch startPosition {
+	case "end":
+		s.startAtEnd = true
+	case "beginning":
+	default:
+		return nil, fmt.Errorf("start_position parameter must be beginning or end: %v", startPosition)
+	}
+	if pollInterval <= 0 {
+		return nil, errors.New("poll_interval parameter must be positive")
+	}
+	return s, nil
+}
+
+// errTailRewound is returned from the writer of tailSource when the source is
+// rewound.
+var errTailRewound = errors.New("the source has been rewound")
+
+func (s *tailSource) GenerateStream(ctx *core.Context, w core.Writer) error {
+	defer close(s.doneCh)
+	s.loadCheckpoint(ctx)
+	defer func() {
+		s.saveCheckpoint(ctx)
+		s.closeFiles(ctx)
+	}()
+
+	writer := core.WriterFunc(func(ctx *core.Context, t *core.Tuple) error {
+		if err := s.waitForResume(); err != nil {
+			return err
+		}
+		return w.Write(ctx, t)
+	})
+	initial := true
+	for {
+		select {
+		case <-s.stopCh:
+			return nil
+		default:
+		}
+
+		if atomic.CompareAndSwapInt32(&s.rewinding, 1, 0) {
+			s.m.Lock()
+			for _, tf := range s.files {
+				tf.offset = 0
+				tf.lineNumber = 0
+			}
+			s.dirty = true
+			s.m.Unlock()
+		}
+
+		err := s.poll(ctx, writer, initial)
+		initial = false
+		switch err {
+		case nil:
+		case errTailRewound:
+			continue
+		case core.ErrSourceStopped:
+			// This is returned from the writer when the source is wrapped by
+			// core.ImplementSourceStop.
+			return nil
+		default:
+			return err
+		}
+		s.saveCheckpoint(ctx)
+
+		select {
+		case <-s.stopCh:
+			return nil
+		case <-s.rewindCh:
+		case <-time.After(s.pollInterval):
+		}
+	}
+}
+
+// waitForResume blocks while the source is paused. It returns an error when
+// the source is stopped or rewound.
+func (s *tailSource) waitForResume() error {
+	for {
+		if atomic.LoadInt32(&s.rewinding) != 0 {
+			return errTailRewound
+		}
+		s.pauseMutex.Lock()
+		ch := s.resumeCh
+		s.pauseMutex.Unlock()
+		if ch == nil {
+			return nil
+		}
+
+		select {
+		case <-ch:
+		case <-s.rewindCh:
+		case <-s.stopCh:
+			return core.ErrSourceStopped
+		}
+	}
+}
+
+func (s *tailSource) Pause(ctx *core.Context) error {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+	if s.resumeCh == nil {
+		s.resumeCh = make(chan struct{})
+	}
+	return nil
+}
+
+func (s *tailSource) Resume(ctx *core.Context) error {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+	if s.resumeCh != nil {
+		close(s.resumeCh)
+		s.resumeCh = nil
+	}
+	return nil
+}
+
+func (s *tailSource) Rewind(ctx *core.Context) error {
+	atomic.StoreInt32(&s.rewinding, 1)
+	select {
+	case s.rewindCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+type tailMatch struct {
+	path string
+	info os.FileInfo
+}
+
+// poll reads lines from all files matching the pattern. initial is true when
+// files are polled for the first time.
+func (s *tailSource) poll(ctx *core.Context, w core.Writer, initial bool) error {
+	paths, err := filepath.Glob(s.pattern)
+	if err != nil {
+		return err // this doesn't happen as the pattern is validated
+	}
+	var matches []tailMatch
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		matches = append(matches, tailMatch{p, info})
+	}
+
+	// Find files which are still tracked, possibly at a different path.
+	next := map[string]*tailedFile{}
+	assigned := map[*tailedFile]bool{}
+	for _, m := range matches {
+		if tf, ok := s.files[m.path]; ok && os.SameFile(tf.info, m.info) {
+			next[m.path] = tf
+			assigned[tf] = true
+		}
+	}
+	for _, m := range matches {
+		if _, ok := next[m.path]; ok {
+			continue
+		}
+		for _, tf := range s.files {
+			if !assigned[tf] && os.SameFile(tf.info, m.info) {
+				ctx.Log().WithField("node_name", s.ioParams.Name).WithField("path", tf.path).
+					WithField("new_path", m.path).
+					Info("The file has been renamed")
+				next[m.path] = tf
+				assigned[tf] = true
+				break
+			}
+		}
+	}
+
+	// Files which are no longer tracked have been rotated or removed. The
+	// rest of them is read before new files are opened.
+	var gone []*tailedFile
+	for _, tf := range s.files {
+		if !assigned[tf] {
+			gone = append(gone, tf)
+		}
+	}
+	sort.Slice(gone, func(i, j int) bool { return gone[i].path < gone[j].path })
+	for _, tf := range gone {
+		ctx.Log().WithField("node_name", s.ioParams.Name).WithField("path", tf.path).
+			Info("The file has been rotated or removed")
+		if err := s.read(ctx, w, tf, true); err != nil {
+			return err
+		}
+		s.closeFile(ctx, tf)
+	}
+
+	s.m.Lock()
+	s.files = next
+	for p, tf := range next {
+		tf.path = p
+	}
+	s.dirty = s.dirty || len(gone) > 0
+	s.m.Unlock()
+
+	for _, m := range matches {
+		tf, ok := s.files[m.path]
+		if !ok {
+			tf, err = s.open(ctx, m.path, m.info, initial)
+			if err != nil {
+				ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).WithField("path", m.path).
+					Warning("Cannot open the file")
+				continue
+			}
+			s.m.Lock()
+			s.files[m.path] = tf
+			s.dirty = true
+			s.m.Unlock()
+		} else {
+			if m.info.Size() < tf.offset {
+				ctx.Log().WithField("node_name", s.ioParams.Name).WithField("path", m.path).
+					Info("The file has been truncated")
+				s.m.Lock()
+				tf.offset = 0
+				tf.lineNumber = 0
+				s.dirty = true
+				s.m.Unlock()
+			}
+			tf.info = m.info
+		}
+
+		if err := s.read(ctx, w, tf, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *tailSource) open(ctx *core.Context, path string, info os.FileInfo, initial bool) (*tailedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	tf := &tailedFile{
+		path: path,
+		f:    f,
+		info: info,
+	}
+
+	if c, ok := s.checkpoint[path]; ok {
+		delete(s.checkpoint, path)
+		fp, err := fingerprint(f, c.FingerprintSize)
+		if err == nil && fp == c.Fingerprint && c.Offset <= info.Size() {
+			tf.offset = c.Offset
+			return tf, nil
+		}
+		ctx.Log().WithField("node_name", s.ioParams.Name).WithField("path", path).
+			Info("The file has been changed since the checkpoint was saved")
+	}
+	if initial && s.startAtEnd {
+		tf.offset = info.Size()
+	}
+	return tf, nil
+}
+
+// read reads lines from the offset of the file. A line not followed by a
+// newline isn't read unless final is true, because the rest of the line may
+// be written later.
+func (s *tailSource) read(ctx *core.Context, w core.Writer, tf *tailedFile, final bool) error {
+	buf := make([]byte, tailReadBufferSize)
+	var pending []byte
+	for {
+		n, err := tf.f.ReadAt(buf, tf.offset+int64(len(pending)))
+		pending = append(pending, buf[:n]...)
+		for {
+			i := bytes.IndexByte(pending, '\n')
+			if i < 0 {
+				break
+			}
+			if err := s.emit(ctx, w, tf, pending[:i], int64(i+1)); err != nil {
+				return err
+			}
+			pending = pending[i+1:]
+		}
+
+		if err == io.EOF || n == 0 {
+			break
+		} else if err != nil {
+			ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).WithField("path", tf.path).
+				Warning("Cannot read the file")
+			return nil
+		}
+	}
+
+	if final && len(pending) > 0 {
+		return s.emit(ctx, w, tf, pending, int64(len(pending)))
+	}
+	return nil
+}
+
+// emit writes a line and advances the offset of the file by size bytes.
+func (s *tailSource) emit(ctx *core.Context, w core.Writer, tf *tailedFile, line []byte, size int64) error {
+	if line = bytes.TrimSpace(line); len(line) > 0 {
+		if _, err := s.emitter.emit(ctx, w, tf.path, tf.lineNumber, line, time.Time{}); err != nil {
+			return err
+		}
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	tf.offset += size
+	tf.lineNumber++
+	s.dirty = true
+	return nil
+}
+
+func (s *tailSource) closeFile(ctx *core.Context, tf *tailedFile) {
+	if err := tf.f.Close(); err != nil {
+		ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).WithField("path", tf.path).
+			Warning("Cannot close the file")
+	}
+}
+
+func (s *tailSource) closeFiles(ctx *core.Context) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, tf := range s.files {
+		s.closeFile(ctx, tf)
+	}
+	s.files = map[string]*tailedFile{}
+}
+
+// fingerprint returns a hash of the first size bytes of the file.
+func fingerprint(f *os.File, size int64) (string, error) {
+	buf := make([]byte, size)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if int64(n) != size {
+		return "", errors.New("the file is shorter than the fingerprint")
+	}
+	h := fnv.New64a()
+	h.Write(buf)
+	return fmt.Sprintf("%016x", h.Sum64()), nil
+}
+
+func (s *tailSource) loadCheckpoint(ctx *core.Context) {
+	if s.checkpointPath == "" {
+		return
+	}
+	b, err := ioutil.ReadFile(s.checkpointPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
+				WithField("checkpoint_path", s.checkpointPath).
+				Warning("Cannot read the checkpoint")
+		}
+		return
+	}
+	c := &tailCheckpoint{}
+	if err := json.Unmarshal(b, c); err != nil {
+		ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
+			WithField("checkpoint_path", s.checkpointPath).
+			Warning("Ignoring the invalid checkpoint")
+		return
+	}
+	s.checkpoint = map[string]*tailCheckpointEntry{}
+	for _, e := range c.Files {
+		s.checkpoint[e.Path] = e
+	}
+}
+
+// saveCheckpoint writes offsets of files to the checkpoint file when they're
+// updated. The file is replaced atomically.
+func (s *tailSource) saveCheckpoint(ctx *core.Context) {
+	if s.checkpointPath == "" {
+		return
+	}
+	s.m.Lock()
+	if !s.dirty {
+		s.m.Unlock()
+		return
+	}
+	s.dirty = false
+	c := &tailCheckpoint{Files: []*tailCheckpointEntry{}}
+	for _, tf := range s.files {
+		e := &tailCheckpointEntry{
+			Path:            tf.path,
+			Offset:          tf.offset,
+			FingerprintSize: tailFingerprintSize,
+		}
+		if tf.offset < e.FingerprintSize {
+			e.FingerprintSize = tf.offset
+		}
+		fp, err := fingerprint(tf.f, e.FingerprintSize)
+		if err != nil {
+			continue
+		}
+		e.Fingerprint = fp
+		c.Files = append(c.Files, e)
+	}
+	s.m.Unlock()
+	sort.Slice(c.Files, func(i, j int) bool { return c.Files[i].Path < c.Files[j].Path })
+
+	if err := writeFileAtomically(s.checkpointPath, c); err != nil {
+		ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
+			WithField("checkpoint_path", s.checkpointPath).
+			Warning("Cannot save the checkpoint")
+	}
+}
+
+func writeFileAtomically(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+func (s *tailSource) Stop(ctx *core.Context) error {
+	close(s.stopCh)
+	<-s.doneCh
+	return nil
+}
+
+func (s *tailSource) Status() data.Map {
+	s.m.Lock()
+	defer s.m.Unlock()
+	files := data.Array{}
+	for _, tf := range s.files {
+		files = append(files, data.Map{
+			"path":   data.String(tf.path),
+			"offset": data.Int(tf.offset),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].(data.Map)["path"].(data.String) < files[j].(data.Map)["path"].(data.String)
+	})
+	return data.Map{
+		"pattern": data.String(s.pattern),
+		"files":   files,
+	}
+}
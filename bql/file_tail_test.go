@@ -0,0 +1,244 @@
+package bql
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// snapshot returns tuples written so far once the writer receives n tuples.
+func (w *testFileWriter) snapshot(n int) []data.Map {
+	w.wait(n)
+	w.m.Lock()
+	defer w.m.Unlock()
+	return append([]data.Map{}, w.ds...)
+}
+
+// tailStatus returns the status of tailSource which may be wrapped.
+func tailStatus(s core.Source) data.Map {
+	st := s.(core.Statuser).Status()
+	if m, ok := st["internal_source"]; ok {
+		return m.(data.Map)
+	}
+	return st
+}
+
+func appendToFile(path, s string) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	So(err, ShouldBeNil)
+	defer f.Close()
+	_, err = f.WriteString(s)
+	So(err, ShouldBeNil)
+}
+
+func TestFileTailSource(t *testing.T) {
+	Convey("Given a directory having log files", t, func() {
+		dir, err := ioutil.TempDir("", "sbtest_bql_file_tail")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		logA := filepath.Join(dir, "a.log")
+		appendToFile(logA, "{\"v\":1}\n{\"v\":2}\n")
+
+		ctx := core.NewContext(nil)
+		params := data.Map{
+			"path":           data.String(filepath.Join(dir, "*.log")),
+			"follow":         data.True,
+			"start_position": data.String("beginning"),
+			"poll_interval":  data.String("10ms"),
+		}
+		w := &testFileWriter{}
+		w.c = sync.NewCond(&w.m)
+
+		run := func() core.Source {
+			s, err := createFileSource(ctx, &IOParams{Name: "tail_test"}, params)
+			So(err, ShouldBeNil)
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, w)
+			}()
+			Reset(func() {
+				s.Stop(ctx)
+				<-ch
+			})
+			return s
+		}
+		values := func(ds []data.Map) []int64 {
+			vs := make([]int64, len(ds))
+			for i, d := range ds {
+				vs[i], _ = data.AsInt(d["v"])
+			}
+			return vs
+		}
+
+		Convey("When tailing the files", func() {
+			s := run()
+			So(values(w.snapshot(2)), ShouldResemble, []int64{1, 2})
+
+			Convey("Then it should read lines appended later", func() {
+				appendToFile(logA, "{\"v\":3}\n")
+				So(values(w.snapshot(3)), ShouldResemble, []int64{1, 2, 3})
+			})
+
+			Convey("Then it should wait for the rest of a partial line", func() {
+				appendToFile(logA, "{\"v\":")
+				time.Sleep(50 * time.Millisecond)
+				appendToFile(logA, "3}\n")
+				So(values(w.snapshot(3)), ShouldResemble, []int64{1, 2, 3})
+			})
+
+			Convey("Then it should read a file created later", func() {
+				appendToFile(filepath.Join(dir, "b.log"), "{\"v\":10}\n")
+				appendToFile(filepath.Join(dir, "b.txt"), "{\"v\":20}\n")
+				So(values(w.snapshot(3)), ShouldResemble, []int64{1, 2, 10})
+
+				st := tailStatus(s)
+				So(st["files"], ShouldHaveLength, 2)
+			})
+
+			Convey("Then it should follow rotation", func() {
+				appendToFile(logA, "{\"v\":3}\n")
+				So(os.Rename(logA, logA+".1"), ShouldBeNil)
+				appendToFile(logA+".1", "{\"v\":4}")
+				appendToFile(logA, "{\"v\":5}\n")
+				So(values(w.snapshot(5)), ShouldResemble, []int64{1, 2, 3, 4, 5})
+			})
+
+			Convey("Then it should keep reading a renamed file matching the pattern", func() {
+				So(os.Rename(logA, filepath.Join(dir, "c.log")), ShouldBeNil)
+				appendToFile(filepath.Join(dir, "c.log"), "{\"v\":3}\n")
+				So(values(w.snapshot(3)), ShouldResemble, []int64{1, 2, 3})
+				time.Sleep(50 * time.Millisecond)
+				So(values(w.snapshot(3)), ShouldHaveLength, 3)
+			})
+
+			Convey("Then it should read a truncated file from the beginning", func() {
+				So(os.Truncate(logA, 0), ShouldBeNil)
+				time.Sleep(50 * time.Millisecond)
+				appendToFile(logA, "{\"v\":3}\n")
+				So(values(w.snapshot(3)), ShouldResemble, []int64{1, 2, 3})
+			})
+		})
+
+		Convey("When tailing the files from the end", func() {
+			params["start_position"] = data.String("end")
+			s := run()
+			for {
+				st := tailStatus(s)
+				if len(st["files"].(data.Array)) > 0 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			appendToFile(logA, "{\"v\":3}\n")
+
+			Convey("Then it should only read appended lines", func() {
+				So(values(w.snapshot(1)), ShouldResemble, []int64{3})
+			})
+		})
+
+		Convey("When tailing the files with a checkpoint", func() {
+			params["checkpoint_path"] = data.String(filepath.Join(dir, "checkpoint.json"))
+			s, err := createFileSource(ctx, &IOParams{Name: "tail_test"}, params.Copy())
+			So(err, ShouldBeNil)
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, w)
+			}()
+			w.wait(2)
+			So(s.Stop(ctx), ShouldBeNil)
+			So(<-ch, ShouldBeNil)
+			appendToFile(logA, "{\"v\":3}\n")
+
+			Convey("Then a new source should resume from the checkpoint", func() {
+				run()
+				So(values(w.snapshot(3)), ShouldResemble, []int64{1, 2, 3})
+				time.Sleep(50 * time.Millisecond)
+				So(values(w.snapshot(3)), ShouldHaveLength, 3)
+			})
+
+			Convey("Then a new source should read a replaced file from the beginning", func() {
+				So(os.Remove(logA), ShouldBeNil)
+				appendToFile(logA, "{\"v\":4}\n{\"v\":5}\n{\"v\":6}\n")
+				run()
+				So(values(w.snapshot(5)), ShouldResemble, []int64{1, 2, 4, 5, 6})
+			})
+		})
+
+		Convey("When tailing the files with rewindable", func() {
+			params["rewindable"] = data.True
+			s := run()
+			So(values(w.snapshot(2)), ShouldResemble, []int64{1, 2})
+
+			Convey("Then it should be able to rewind", func() {
+				So(s.(core.RewindableSource).Rewind(ctx), ShouldBeNil)
+				So(values(w.snapshot(4)), ShouldResemble, []int64{1, 2, 1, 2})
+			})
+
+			Convey("Then it should be able to pause and resume", func() {
+				rs := s.(core.RewindableSource)
+				So(rs.Pause(ctx), ShouldBeNil)
+				appendToFile(logA, "{\"v\":3}\n")
+				time.Sleep(50 * time.Millisecond)
+				So(w.snapshot(2), ShouldHaveLength, 2)
+				So(rs.Resume(ctx), ShouldBeNil)
+				So(values(w.snapshot(3)), ShouldResemble, []int64{1, 2, 3})
+			})
+		})
+
+		Convey("When tailing CSV files with path_field", func() {
+			logCSV := filepath.Join(dir, "a.csv")
+			appendToFile(logCSV, "a,b\n1,2\n")
+			params["path"] = data.String(logCSV)
+			params["format"] = data.String("csv")
+			params["columns"] = data.Array{data.String("a"), data.String("b")}
+			params["skip_header"] = data.True
+			params["path_field"] = data.String("meta.path")
+			run()
+
+			Convey("Then it should emit parsed tuples with the path", func() {
+				So(w.snapshot(1), ShouldResemble, []data.Map{{
+					"a":    data.String("1"),
+					"b":    data.String("2"),
+					"meta": data.Map{"path": data.String(logCSV)},
+				}})
+			})
+		})
+
+		Convey("When creating a source with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"invalid pattern":        {"path": data.String("[")},
+				"invalid start_position": {"start_position": data.String("middle")},
+				"invalid poll_interval":  {"poll_interval": data.Int(0)},
+				"repeat":                 {"repeat": data.Int(1)},
+			}
+			for name, c := range cases {
+				c := c
+				Convey(fmt.Sprintf("Then %v should result in an error", name), func() {
+					ps := params.Copy()
+					for k, v := range c {
+						ps[k] = v
+					}
+					_, err := createFileSource(ctx, &IOParams{}, ps)
+					So(err, ShouldNotBeNil)
+				})
+			}
+
+			Convey("Then checkpoint_path without follow should result in an error", func() {
+				_, err := createFileSource(ctx, &IOParams{}, data.Map{
+					"path":            data.String(logA),
+					"checkpoint_path": data.String(filepath.Join(dir, "checkpoint.json")),
+				})
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,94 @@
+package bql
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"unsafe"
+)
+
+// EstimateWindowFootprint estimates the number of bytes used by the input
+// buffer of a window when the buffer is full of tuples having the same shape
+// as t. The estimate is the capacity of the buffer, i.e. BUFFER SIZE or the
+// default capacity when it's omitted, multiplied by the approximate size of
+// t. It only gives a rough idea of memory usage to size BUFFER SIZE because
+// values shared between tuples are counted more than once and the overhead
+// of the Go runtime isn't considered.
+func EstimateWindowFootprint(w *parser.StreamWindowAST, t *core.Tuple) int64 {
+	capacity := int64(core.DefaultCapacity)
+	if w.Capacity > 0 {
+		capacity = EstimateWindowCapacity(w, t)
+	}
+	return capacity * approxTupleSize(t)
+}
+
+// EstimateWindowCapacity returns the number of tuples having the same shape
+// as t which fit in the input buffer of a window whose BUFFER SIZE is given
+// in bytes, e.g. BUFFER SIZE 16 MB. The result is at least 1. When BUFFER
+// SIZE is the number of tuples or omitted, w.Capacity is returned as it is.
+func EstimateWindowCapacity(w *parser.StreamWindowAST, t *core.Tuple) int64 {
+	unit := w.CapacityUnit.Bytes()
+	if w.Capacity == parser.UnspecifiedCapacity || unit == 0 {
+		return w.Capacity
+	}
+	budget := int64(math.MaxInt64)
+	if w.Capacity <= math.MaxInt64/unit {
+		budget = w.Capacity * unit
+	}
+	capacity := budget / approxTupleSize(t)
+	if capacity < 1 {
+		capacity = 1
+	}
+	return capacity
+}
+
+// nominalTuple is used to derive the capacity of a window whose BUFFER SIZE
+// is given in bytes when the statement is built. Because the shape of input
+// tuples isn't known at that time, they're assumed to have a few scalar
+// values.
+var nominalTuple = core.NewTuple(data.Map{
+	"int":       data.Int(0),
+	"float":     data.Float(0),
+	"string":    data.String("0123456789abcdef"),
+	"timestamp": data.Timestamp{},
+})
+
+const (
+	// valueHeaderSize is the size of an interface value holding data.Value.
+	valueHeaderSize = int64(unsafe.Sizeof(data.Value(nil)))
+
+	// mapEntryOverhead is the approximate overhead of an entry in a map
+	// other than its key and value.
+	mapEntryOverhead = 8
+)
+
+func approxTupleSize(t *core.Tuple) int64 {
+	return int64(unsafe.Sizeof(*t)) + approxValueSize(t.Data) +
+		int64(len(t.InputName)) + int64(len(t.CorrelationID)) + int64(len(t.ID))
+}
+
+func approxValueSize(v data.Value) int64 {
+	size := valueHeaderSize
+	switch v := v.(type) {
+	case data.Int, data.Float:
+		size += 8
+	case data.String:
+		size += int64(unsafe.Sizeof("")) + int64(len(v))
+	case data.Blob:
+		size += int64(unsafe.Sizeof([]byte(nil))) + int64(len(v))
+	case data.Timestamp:
+		size += int64(unsafe.Sizeof(data.Timestamp{}))
+	case data.Array:
+		size += int64(unsafe.Sizeof(data.Array(nil)))
+		for _, e := range v {
+			size += approxValueSize(e)
+		}
+	case data.Map:
+		size += int64(unsafe.Sizeof(data.Map(nil)))
+		for k, e := range v {
+			size += mapEntryOverhead + int64(unsafe.Sizeof("")) + int64(len(k)) + approxValueSize(e)
+		}
+	}
+	return size
+}
@@ -0,0 +1,93 @@
+package bql
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestEstimateWindowFootprint(t *testing.T) {
+	Convey("Given a representative tuple", t, func() {
+		tuple := core.NewTuple(data.Map{
+			"int":    data.Int(1),
+			"string": data.String("abcdefgh"),
+			"array":  data.Array{data.Float(1), data.Float(2)},
+		})
+		size := approxTupleSize(tuple)
+		window := func(capacity int64) *parser.StreamWindowAST {
+			return &parser.StreamWindowAST{
+				Stream:      parser.Stream{parser.ActualStream, "s", nil, nil},
+				IntervalAST: parser.IntervalAST{parser.FloatLiteral{1}, parser.Tuples},
+				Capacity:    capacity,
+			}
+		}
+		memoryWindow := func(capacity int64, unit parser.CapacityUnit) *parser.StreamWindowAST {
+			w := window(capacity)
+			w.CapacityUnit = unit
+			return w
+		}
+
+		Convey("When estimating the footprint of a buffer having BUFFER SIZE", func() {
+			est := EstimateWindowFootprint(window(10), tuple)
+
+			Convey("Then it should be the capacity times the size of the tuple", func() {
+				So(size, ShouldBeGreaterThan, 0)
+				So(est, ShouldEqual, 10*size)
+			})
+
+			Convey("Then it should scale linearly with the capacity", func() {
+				So(EstimateWindowFootprint(window(20), tuple), ShouldEqual, 2*est)
+				So(EstimateWindowFootprint(window(1000), tuple), ShouldEqual, 100*est)
+			})
+		})
+
+		Convey("When estimating the footprint of a buffer without BUFFER SIZE", func() {
+			est := EstimateWindowFootprint(window(parser.UnspecifiedCapacity), tuple)
+
+			Convey("Then the default capacity should be used", func() {
+				So(est, ShouldEqual, int64(core.DefaultCapacity)*size)
+			})
+		})
+
+		Convey("When estimating the capacity of a buffer having a memory-based BUFFER SIZE", func() {
+			c := EstimateWindowCapacity(memoryWindow(16, parser.Kilobytes), tuple)
+
+			Convey("Then it should be the number of tuples fitting in the budget", func() {
+				So(c, ShouldEqual, 16*1024/size)
+				So(EstimateWindowCapacity(memoryWindow(16, parser.Megabytes), tuple), ShouldEqual, 16*1024*1024/size)
+			})
+
+			Convey("Then the footprint should be close to the budget", func() {
+				est := EstimateWindowFootprint(memoryWindow(16, parser.Kilobytes), tuple)
+				So(est, ShouldBeLessThanOrEqualTo, 16*1024)
+				So(est, ShouldBeGreaterThan, 16*1024-size)
+			})
+
+			Convey("Then it should be at least 1", func() {
+				So(EstimateWindowCapacity(memoryWindow(1, parser.Bytes), tuple), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When estimating the capacity of a buffer having a tuple-based BUFFER SIZE", func() {
+			Convey("Then it should be the capacity as it is", func() {
+				So(EstimateWindowCapacity(window(16), tuple), ShouldEqual, 16)
+				So(EstimateWindowCapacity(window(parser.UnspecifiedCapacity), tuple), ShouldEqual, parser.UnspecifiedCapacity)
+			})
+		})
+
+		Convey("When the tuple has larger values", func() {
+			large := core.NewTuple(data.Map{
+				"int":    data.Int(1),
+				"string": data.String("abcdefghabcdefgh"),
+				"array":  data.Array{data.Float(1), data.Float(2), data.Float(3)},
+			})
+
+			Convey("Then the estimate should be larger", func() {
+				So(EstimateWindowFootprint(window(10), large), ShouldBeGreaterThan,
+					EstimateWindowFootprint(window(10), tuple))
+			})
+		})
+	})
+}
@@ -0,0 +1,368 @@
+package bql
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// TupleEncoder converts Data of a tuple into bytes so that sinks writing
+// tuples to files, sockets, or other byte streams can share the same set of
+// output formats.
+type TupleEncoder interface {
+	// Encode encodes a map into bytes. The returned bytes contain a delimiter
+	// such as a newline at the end when the format needs it to separate
+	// records. Encode must be safe to call concurrently.
+	Encode(m data.Map) ([]byte, error)
+}
+
+// NewTupleEncoder creates a TupleEncoder of the format specified by "format"
+// parameter of a sink. Parameters used by the encoder are removed from the
+// given map so that the rest of them can be decoded by the sink. The
+// following formats are supported:
+//
+//  * jsonl (default): a JSON object followed by a newline
+//  * msgpack: a MessagePack map without any delimiter
+//  * csv: a line of comma separated values
+//
+// The csv format requires "columns" parameter which is an array of paths of
+// values to be written, e.g. columns=["a", "b.c"]. A missing value or NULL
+// results in an empty field, and an array or a map is embedded as JSON. The
+// delimiter can be changed by "delimiter" parameter.
+func NewTupleEncoder(params data.Map) (TupleEncoder, error) {
+	format := "jsonl"
+	if v, ok := params["format"]; ok {
+		f, err := data.AsString(v)
+		if err != nil {
+			return nil, fmt.Errorf("format parameter must be a string: %v", err)
+		}
+		format = strings.ToLower(f)
+		delete(params, "format")
+	}
+
+	switch format {
+	case "jsonl", "json":
+		return jsonEncoder{}, nil
+	case "msgpack":
+		return msgpackEncoder{}, nil
+	case "csv":
+		return newCSVEncoder(params)
+	default:
+		return nil, fmt.Errorf("unsupported format: %v", format)
+	}
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(m data.Map) ([]byte, error) {
+	return []byte(m.String() + "\n"), nil
+}
+
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) Encode(m data.Map) ([]byte, error) {
+	return data.MarshalMsgpack(m)
+}
+
+type csvEncoder struct {
+	columns   []data.Path
+	names     []string
+	delimiter rune
+}
+
+func newCSVEncoder(params data.Map) (*csvEncoder, error) {
+	columns, names, err := parseCSVColumns(params)
+	if err != nil {
+		return nil, err
+	}
+	delimiter, err := parseCSVDelimiter(params, ',')
+	if err != nil {
+		return nil, err
+	}
+	return &csvEncoder{
+		columns:   columns,
+		names:     names,
+		delimiter: delimiter,
+	}, nil
+}
+
+// parseCSVColumns parses "columns" parameter shared by csv encoders and
+// decoders. It returns compiled paths and their original strings.
+func parseCSVColumns(params data.Map) ([]data.Path, []string, error) {
+	v, ok := params["columns"]
+	if !ok {
+		return nil, nil, fmt.Errorf("csv format requires columns parameter")
+	}
+	delete(params, "columns")
+
+	a, err := data.AsArray(v)
+	if err != nil {
+		return nil, nil, fmt.Errorf("columns parameter must be an array: %v", err)
+	}
+	if len(a) == 0 {
+		return nil, nil, fmt.Errorf("columns parameter must have at least one column")
+	}
+	columns := make([]data.Path, len(a))
+	names := make([]string, len(a))
+	for i, c := range a {
+		s, err := data.AsString(c)
+		if err != nil {
+			return nil, nil, fmt.Errorf("columns[%v] must be a string: %v", i, err)
+		}
+		p, err := data.CompilePath(s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("columns[%v] is an invalid path: %v", i, err)
+		}
+		columns[i] = p
+		names[i] = s
+	}
+	return columns, names, nil
+}
+
+// parseCSVDelimiter parses "delimiter" parameter. It returns def when the
+// parameter isn't given.
+func parseCSVDelimiter(params data.Map, def rune) (rune, error) {
+	v, ok := params["delimiter"]
+	if !ok {
+		return def, nil
+	}
+	s, err := data.AsString(v)
+	if err != nil || utf8.RuneCountInString(s) != 1 {
+		return 0, fmt.Errorf("delimiter parameter must be a single character: %v", v)
+	}
+	delete(params, "delimiter")
+	r, _ := utf8.DecodeRuneInString(s)
+	return r, nil
+}
+
+func (e *csvEncoder) Encode(m data.Map) ([]byte, error) {
+	record := make([]string, len(e.columns))
+	for i, p := range e.columns {
+		v, err := m.Get(p)
+		if err != nil {
+			continue // a missing value is written as an empty field
+		}
+		s, err := data.ToString(v)
+		if err != nil {
+			return nil, err
+		}
+		record[i] = s
+	}
+
+	return e.encodeRecord(record)
+}
+
+// Header returns a line having the column names.
+func (e *csvEncoder) Header() ([]byte, error) {
+	return e.encodeRecord(e.names)
+}
+
+func (e *csvEncoder) encodeRecord(record []string) ([]byte, error) {
+	b := bytes.NewBuffer(nil)
+	w := csv.NewWriter(b)
+	w.Comma = e.delimiter
+	if err := w.Write(record); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// LineDecoder converts a line read by a source such as a file source into a
+// map. It's the counterpart of TupleEncoder.
+type LineDecoder interface {
+	// Decode decodes a line not having a trailing newline. It returns nil
+	// without an error when the line should be skipped (e.g. a header line).
+	// Decode must be safe to call concurrently.
+	Decode(line []byte) (data.Map, error)
+}
+
+// NewLineDecoder creates a LineDecoder of the format specified by "format"
+// parameter of a source. Parameters used by the decoder are removed from the
+// given map so that the rest of them can be decoded by the source. The
+// following formats are supported:
+//
+//   - jsonl (default): a JSON object. Numbers are converted according to
+//     "json_number" parameter, which is one of preserve (default), int, or
+//     float.
+//   - csv: a line of comma separated values
+//   - regex: a line matching the regular expression given as "pattern"
+//     parameter. Each named capturing group becomes a string field.
+//   - raw: a line as a string stored in "line" field
+//
+// The csv format requires "columns" parameter which is an array of paths
+// where values are stored as strings, e.g. columns=["a", "b.c"]. A line
+// having a different number of fields results in an error. The delimiter can
+// be changed by "delimiter" parameter. When "skip_header" parameter is true,
+// a line whose fields are the same as the columns is skipped.
+func NewLineDecoder(params data.Map) (LineDecoder, error) {
+	format := "jsonl"
+	if v, ok := params["format"]; ok {
+		f, err := data.AsString(v)
+		if err != nil {
+			return nil, fmt.Errorf("format parameter must be a string: %v", err)
+		}
+		format = strings.ToLower(f)
+		delete(params, "format")
+	}
+
+	switch format {
+	case "jsonl", "json":
+		return newJSONDecoder(params)
+	case "csv":
+		return newCSVDecoder(params)
+	case "regex":
+		return newRegexDecoder(params)
+	case "raw":
+		return rawDecoder{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format: %v", format)
+	}
+}
+
+type jsonDecoder struct {
+	numberPolicy data.JSONNumberPolicy
+}
+
+func newJSONDecoder(params data.Map) (*jsonDecoder, error) {
+	d := &jsonDecoder{}
+	if v, ok := params["json_number"]; ok {
+		s, err := data.AsString(v)
+		if err != nil {
+			return nil, fmt.Errorf("json_number parameter must be a string: %v", err)
+		}
+		if d.numberPolicy, err = data.ParseJSONNumberPolicy(s); err != nil {
+			return nil, fmt.Errorf("'json_number' parameter must be one of preserve, int, or float: %v", err)
+		}
+		delete(params, "json_number")
+	}
+	return d, nil
+}
+
+func (d *jsonDecoder) Decode(line []byte) (data.Map, error) {
+	return data.UnmarshalJSONMap(line, d.numberPolicy)
+}
+
+type csvDecoder struct {
+	columns    []data.Path
+	names      []string
+	delimiter  rune
+	skipHeader bool
+}
+
+func newCSVDecoder(params data.Map) (*csvDecoder, error) {
+	columns, names, err := parseCSVColumns(params)
+	if err != nil {
+		return nil, err
+	}
+	d := &csvDecoder{
+		columns: columns,
+		names:   names,
+	}
+	if d.delimiter, err = parseCSVDelimiter(params, ','); err != nil {
+		return nil, err
+	}
+	if v, ok := params["skip_header"]; ok {
+		if d.skipHeader, err = data.ToBool(v); err != nil {
+			return nil, fmt.Errorf("skip_header parameter must be a bool: %v", err)
+		}
+		delete(params, "skip_header")
+	}
+	return d, nil
+}
+
+func (d *csvDecoder) Decode(line []byte) (data.Map, error) {
+	r := csv.NewReader(bytes.NewReader(line))
+	r.Comma = d.delimiter
+	r.FieldsPerRecord = len(d.columns)
+	record, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	if d.skipHeader {
+		header := true
+		for i, f := range record {
+			if f != d.names[i] {
+				header = false
+				break
+			}
+		}
+		if header {
+			return nil, nil
+		}
+	}
+
+	m := data.Map{}
+	for i, p := range d.columns {
+		if err := m.Set(p, data.String(record[i])); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+type regexDecoder struct {
+	re    *regexp.Regexp
+	names []string
+}
+
+func newRegexDecoder(params data.Map) (*regexDecoder, error) {
+	v, ok := params["pattern"]
+	if !ok {
+		return nil, fmt.Errorf("regex format requires pattern parameter")
+	}
+	delete(params, "pattern")
+
+	s, err := data.AsString(v)
+	if err != nil {
+		return nil, fmt.Errorf("pattern parameter must be a string: %v", err)
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return nil, fmt.Errorf("pattern parameter is an invalid regular expression: %v", err)
+	}
+	d := &regexDecoder{
+		re:    re,
+		names: re.SubexpNames(),
+	}
+	named := false
+	for _, n := range d.names {
+		if n != "" {
+			named = true
+			break
+		}
+	}
+	if !named {
+		return nil, fmt.Errorf("pattern parameter must have at least one named group like (?P<name>...)")
+	}
+	return d, nil
+}
+
+func (d *regexDecoder) Decode(line []byte) (data.Map, error) {
+	match := d.re.FindSubmatch(line)
+	if match == nil {
+		return nil, fmt.Errorf("the line doesn't match the pattern")
+	}
+	m := data.Map{}
+	for i, n := range d.names {
+		if n == "" || match[i] == nil {
+			continue
+		}
+		m[n] = data.String(match[i])
+	}
+	return m, nil
+}
+
+type rawDecoder struct{}
+
+func (rawDecoder) Decode(line []byte) (data.Map, error) {
+	return data.Map{"line": data.String(line)}, nil
+}
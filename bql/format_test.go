@@ -0,0 +1,257 @@
+package bql
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestTupleEncoder(t *testing.T) {
+	m := data.Map{
+		"int":    data.Int(1),
+		"float":  data.Float(1.5),
+		"string": data.String(`a "b", c`),
+		"null":   data.Null{},
+		"nested": data.Map{
+			"array": data.Array{data.Int(1), data.String("x")},
+			"map":   data.Map{"k": data.True},
+		},
+	}
+
+	Convey("Given a map", t, func() {
+		Convey("When encoding it without a format parameter", func() {
+			params := data.Map{}
+			enc, err := NewTupleEncoder(params)
+			So(err, ShouldBeNil)
+			b, err := enc.Encode(m)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should be encoded as a line of JSON", func() {
+				So(string(b), ShouldEqual, m.String()+"\n")
+			})
+		})
+
+		Convey("When encoding it to JSON", func() {
+			params := data.Map{"format": data.String("jsonl")}
+			enc, err := NewTupleEncoder(params)
+			So(err, ShouldBeNil)
+			b, err := enc.Encode(data.Map{"a": data.Int(1), "b": data.Array{data.Null{}}})
+			So(err, ShouldBeNil)
+
+			Convey("Then the byte output should be correct", func() {
+				So(string(b), ShouldEqual, `{"a":1,"b":[null]}`+"\n")
+			})
+
+			Convey("Then the format parameter should be removed", func() {
+				So(params, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When encoding it to MessagePack", func() {
+			enc, err := NewTupleEncoder(data.Map{"format": data.String("msgpack")})
+			So(err, ShouldBeNil)
+			b, err := enc.Encode(m)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should be decoded to the same map", func() {
+				d, err := data.UnmarshalMsgpack(b)
+				So(err, ShouldBeNil)
+				So(d, ShouldResemble, m)
+			})
+		})
+
+		Convey("When encoding it to CSV", func() {
+			params := data.Map{
+				"format": data.String("CSV"),
+				"columns": data.Array{
+					data.String("int"), data.String("float"), data.String("string"),
+					data.String("null"), data.String("missing"), data.String("nested.map.k"),
+				},
+				"path": data.String("/tmp/out.csv"),
+			}
+			enc, err := NewTupleEncoder(params)
+			So(err, ShouldBeNil)
+			b, err := enc.Encode(m)
+			So(err, ShouldBeNil)
+
+			Convey("Then the byte output should be correct", func() {
+				So(string(b), ShouldEqual, `1,1.5,"a ""b"", c",,,true`+"\n")
+			})
+
+			Convey("Then only parameters for the encoder should be removed", func() {
+				So(params, ShouldResemble, data.Map{"path": data.String("/tmp/out.csv")})
+			})
+		})
+
+		Convey("When encoding nested values to CSV", func() {
+			enc, err := NewTupleEncoder(data.Map{
+				"format":  data.String("csv"),
+				"columns": data.Array{data.String("nested.array"), data.String("nested")},
+			})
+			So(err, ShouldBeNil)
+			b, err := enc.Encode(m)
+			So(err, ShouldBeNil)
+
+			Convey("Then they should be embedded as JSON", func() {
+				So(string(b), ShouldEqual, `"[1,""x""]","{""array"":[1,""x""],""map"":{""k"":true}}"`+"\n")
+			})
+		})
+
+		Convey("When encoding it to CSV with a delimiter", func() {
+			enc, err := NewTupleEncoder(data.Map{
+				"format":    data.String("csv"),
+				"columns":   data.Array{data.String("int"), data.String("string")},
+				"delimiter": data.String("\t"),
+			})
+			So(err, ShouldBeNil)
+			b, err := enc.Encode(m)
+			So(err, ShouldBeNil)
+
+			Convey("Then fields should be separated by the delimiter", func() {
+				So(string(b), ShouldStartWith, "1\t")
+			})
+		})
+
+		Convey("When creating an encoder with invalid parameters", func() {
+			cases := []data.Map{
+				{"format": data.Int(1)},
+				{"format": data.String("xml")},
+				{"format": data.String("csv")},
+				{"format": data.String("csv"), "columns": data.String("a")},
+				{"format": data.String("csv"), "columns": data.Array{}},
+				{"format": data.String("csv"), "columns": data.Array{data.Int(1)}},
+				{"format": data.String("csv"), "columns": data.Array{data.String("a[")}},
+				{"format": data.String("csv"), "columns": data.Array{data.String("a")}, "delimiter": data.String("ab")},
+			}
+
+			Convey("Then it should fail", func() {
+				for _, params := range cases {
+					_, err := NewTupleEncoder(params)
+					So(err, ShouldNotBeNil)
+				}
+			})
+		})
+	})
+}
+
+func TestLineDecoder(t *testing.T) {
+	Convey("Given lines", t, func() {
+		Convey("When decoding JSON without a format parameter", func() {
+			params := data.Map{"path": data.String("/tmp/in.jsonl")}
+			dec, err := NewLineDecoder(params)
+			So(err, ShouldBeNil)
+			m, err := dec.Decode([]byte(`{"a":1,"b":[1.5,"x"]}`))
+			So(err, ShouldBeNil)
+
+			Convey("Then it should be decoded as JSON", func() {
+				So(m, ShouldResemble, data.Map{
+					"a": data.Int(1),
+					"b": data.Array{data.Float(1.5), data.String("x")},
+				})
+			})
+
+			Convey("Then parameters other than the decoder's should remain", func() {
+				So(params, ShouldResemble, data.Map{"path": data.String("/tmp/in.jsonl")})
+			})
+		})
+
+		Convey("When decoding JSON with json_number", func() {
+			params := data.Map{"format": data.String("jsonl"), "json_number": data.String("float")}
+			dec, err := NewLineDecoder(params)
+			So(err, ShouldBeNil)
+			m, err := dec.Decode([]byte(`{"a":1}`))
+			So(err, ShouldBeNil)
+
+			Convey("Then numbers should be converted", func() {
+				So(m, ShouldResemble, data.Map{"a": data.Float(1)})
+				So(params, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When decoding CSV", func() {
+			params := data.Map{
+				"format":      data.String("csv"),
+				"columns":     data.Array{data.String("a"), data.String("b.c")},
+				"delimiter":   data.String("\t"),
+				"skip_header": data.True,
+			}
+			dec, err := NewLineDecoder(params)
+			So(err, ShouldBeNil)
+			So(params, ShouldBeEmpty)
+
+			Convey("Then values should be stored at the columns", func() {
+				m, err := dec.Decode([]byte("1\t\"x\ty\""))
+				So(err, ShouldBeNil)
+				So(m, ShouldResemble, data.Map{
+					"a": data.String("1"),
+					"b": data.Map{"c": data.String("x\ty")},
+				})
+			})
+
+			Convey("Then the header line should be skipped", func() {
+				m, err := dec.Decode([]byte("a\tb.c"))
+				So(err, ShouldBeNil)
+				So(m, ShouldBeNil)
+			})
+
+			Convey("Then a line having a wrong number of fields should fail", func() {
+				_, err := dec.Decode([]byte("1\t2\t3"))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When decoding lines with a regular expression", func() {
+			dec, err := NewLineDecoder(data.Map{
+				"format":  data.String("regex"),
+				"pattern": data.String(`^(?P<level>\w+) (\d+) (?P<msg>.*)$`),
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then named groups should become fields", func() {
+				m, err := dec.Decode([]byte("INFO 10 started"))
+				So(err, ShouldBeNil)
+				So(m, ShouldResemble, data.Map{
+					"level": data.String("INFO"),
+					"msg":   data.String("started"),
+				})
+			})
+
+			Convey("Then a line not matching the pattern should fail", func() {
+				_, err := dec.Decode([]byte("INFO"))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When decoding raw lines", func() {
+			dec, err := NewLineDecoder(data.Map{"format": data.String("RAW")})
+			So(err, ShouldBeNil)
+			m, err := dec.Decode([]byte("a line"))
+			So(err, ShouldBeNil)
+
+			Convey("Then the line should be stored as it is", func() {
+				So(m, ShouldResemble, data.Map{"line": data.String("a line")})
+			})
+		})
+
+		Convey("When creating a decoder with invalid parameters", func() {
+			cases := []data.Map{
+				{"format": data.String("msgpack")},
+				{"json_number": data.String("str")},
+				{"format": data.String("csv")},
+				{"format": data.String("csv"), "columns": data.Array{}},
+				{"format": data.String("csv"), "columns": data.Array{data.String("a")}, "delimiter": data.String(",,")},
+				{"format": data.String("csv"), "columns": data.Array{data.String("a")}, "skip_header": data.String("x")},
+				{"format": data.String("regex")},
+				{"format": data.String("regex"), "pattern": data.String("(")},
+				{"format": data.String("regex"), "pattern": data.String("(a)")},
+			}
+
+			Convey("Then it should fail", func() {
+				for _, params := range cases {
+					_, err := NewLineDecoder(params)
+					So(err, ShouldNotBeNil)
+				}
+			})
+		})
+	})
+}
@@ -0,0 +1,397 @@
+package bql
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+	"strings"
+)
+
+// GraphNode is a node of a dependency graph of a topology.
+type GraphNode struct {
+	// Name is the name of the node.
+	Name string
+
+	// Type is the type of the node.
+	Type core.NodeType
+
+	// Definition is the BQL statement which created the node. It's empty
+	// when the node wasn't created by a BQL statement.
+	Definition string
+}
+
+// GraphEdge is an edge of a dependency graph of a topology. Tuples flow from
+// the node named From to the node named To. Names are in lower case.
+type GraphEdge struct {
+	From string
+	To   string
+}
+
+// Graph is a dependency graph of sources, streams, and sinks. Temporary nodes
+// internally created by TopologyBuilder, e.g. boxes for UDSFs, aren't included
+// in the graph. Instead, nodes connected via temporary nodes are directly
+// connected by an edge.
+type Graph struct {
+	// Nodes has all nodes in the graph. Keys are lower case names of nodes.
+	Nodes map[string]*GraphNode
+
+	// Edges has all edges in the graph. It's sorted and doesn't have
+	// duplicated edges.
+	Edges []GraphEdge
+}
+
+func newGraph() *Graph {
+	return &Graph{
+		Nodes: map[string]*GraphNode{},
+	}
+}
+
+func (g *Graph) addNode(name string, t core.NodeType, def string) {
+	g.Nodes[strings.ToLower(name)] = &GraphNode{
+		Name:       name,
+		Type:       t,
+		Definition: def,
+	}
+}
+
+// removeNodeWithModifier removes the node as removeNode does. When the
+// modifier has CASCADE, nodes depending on the node are also removed.
+func (g *Graph) removeNodeWithModifier(name string, m parser.DropModifierAST) {
+	if m.Cascade == parser.Yes {
+		for _, n := range g.dependents(name) {
+			g.removeNode(n)
+		}
+	}
+	g.removeNode(name)
+}
+
+// removeNode removes the node and all edges connected to it.
+func (g *Graph) removeNode(name string) {
+	name = strings.ToLower(name)
+	delete(g.Nodes, name)
+	edges := g.Edges[:0]
+	for _, e := range g.Edges {
+		if e.From != name && e.To != name {
+			edges = append(edges, e)
+		}
+	}
+	g.Edges = edges
+}
+
+// dependents returns the lower case names of nodes which directly or
+// indirectly read from the node. A node comes before all nodes it reads from,
+// so that the nodes can be removed in the returned order. The node itself
+// isn't included.
+func (g *Graph) dependents(name string) []string {
+	outputs := map[string][]string{}
+	for _, e := range g.Edges {
+		outputs[e.From] = append(outputs[e.From], e.To)
+	}
+
+	name = strings.ToLower(name)
+	var res []string
+	visited := map[string]bool{name: true}
+	var visit func(n string)
+	visit = func(n string) {
+		for _, out := range outputs[n] {
+			if visited[out] {
+				continue
+			}
+			visited[out] = true
+			visit(out)
+			res = append(res, out)
+		}
+	}
+	visit(name)
+	return res
+}
+
+func (g *Graph) addEdge(from, to string) {
+	g.Edges = append(g.Edges, GraphEdge{
+		From: strings.ToLower(from),
+		To:   strings.ToLower(to),
+	})
+}
+
+// normalize sorts edges and removes duplicated ones.
+func (g *Graph) normalize() {
+	sort.Sort(graphEdges(g.Edges))
+	k := 0
+	for i, e := range g.Edges {
+		if i > 0 && e == g.Edges[k-1] {
+			continue
+		}
+		g.Edges[k] = e
+		k++
+	}
+	g.Edges = g.Edges[:k]
+}
+
+type graphEdges []GraphEdge
+
+func (e graphEdges) Len() int      { return len(e) }
+func (e graphEdges) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e graphEdges) Less(i, j int) bool {
+	if e[i].From != e[j].From {
+		return e[i].From < e[j].From
+	}
+	return e[i].To < e[j].To
+}
+
+func isTemporaryNodeName(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), "sensorbee_tmp_")
+}
+
+// Graph returns the dependency graph of the topology which the builder is
+// working on. Definitions of nodes are only available when they're created by
+// the builder.
+func (tb *TopologyBuilder) Graph() (*Graph, error) {
+	g := newGraph()
+	inputPath := data.MustCompilePath("input_stats.inputs")
+
+	// inputs has the names of all input nodes of each node
+	nodes := tb.topology.Nodes()
+	inputs := map[string][]string{}
+	for name, n := range nodes {
+		if n.Type() == core.NTSource {
+			continue
+		}
+		v, err := n.Status().Get(inputPath)
+		if err != nil {
+			return nil, fmt.Errorf("node '%v' doesn't have input_stats: %v", name, err)
+		}
+		m, err := data.AsMap(v)
+		if err != nil {
+			return nil, fmt.Errorf("input_stats.inputs of node '%v' isn't a map: %v", name, err)
+		}
+		name = strings.ToLower(name)
+		for in := range m {
+			inputs[name] = append(inputs[name], strings.ToLower(in))
+		}
+	}
+
+	// resolve inputs through temporary nodes
+	var addEdges func(to, from string, visited map[string]bool)
+	addEdges = func(to, from string, visited map[string]bool) {
+		if !isTemporaryNodeName(from) {
+			g.addEdge(from, to)
+			return
+		}
+		if visited[from] {
+			return
+		}
+		visited[from] = true
+		for _, in := range inputs[from] {
+			addEdges(to, in, visited)
+		}
+	}
+
+	for name, n := range nodes {
+		if isTemporaryNodeName(name) {
+			continue
+		}
+		g.addNode(n.Name(), n.Type(), tb.definition(name))
+		for _, in := range inputs[strings.ToLower(name)] {
+			addEdges(name, in, map[string]bool{})
+		}
+	}
+	g.normalize()
+	return g, nil
+}
+
+// StmtsGraph returns the dependency graph of a topology which would be built
+// from the given statements. Statements which don't create, remove, or
+// connect nodes are ignored. The statements aren't applied to the topology.
+//
+// Because a UDSF declares its inputs only when it's created, each UDSF used
+// in the statements is actually created with its UDSFCreator and then
+// terminated immediately to obtain its inputs. Therefore, side effects of
+// the UDSFCreator and UDSF.Terminate take place even though no stream is
+// created.
+func (tb *TopologyBuilder) StmtsGraph(stmts []interface{}) (*Graph, error) {
+	g := newGraph()
+	// relationInputs returns the names of nodes which the relations read
+	// from. Names in cteInputs refer to intermediate streams created for the
+	// WITH clause, which aren't in the graph, so their inputs are returned
+	// instead.
+	relationInputs := func(name string, rels []parser.AliasedStreamWindowAST,
+		cteInputs map[string][]string) ([]string, error) {
+		var inputs []string
+		for _, rel := range rels {
+			switch rel.Type {
+			case parser.ActualStream, parser.MatchRecognizeStream:
+				if ins, ok := cteInputs[rel.Name]; ok {
+					inputs = append(inputs, ins...)
+					continue
+				}
+				if rel.Type == parser.ActualStream && rel.Name == name {
+					// a recursive stream reads from itself without a connection
+					continue
+				}
+				inputs = append(inputs, rel.Name)
+
+			case parser.UDSFStream:
+				udsf, decl, err := tb.createUDSF(&rel)
+				if err != nil {
+					return nil, err
+				}
+				if err := udsf.Terminate(tb.topology.Context()); err != nil {
+					return nil, err
+				}
+				for in := range decl.ListInputs() {
+					inputs = append(inputs, in)
+				}
+
+			case parser.DroppedTuplesStream:
+				inputs = append(inputs, rel.Name)
+
+			default:
+				return nil, fmt.Errorf("input stream of type %s not implemented", rel.Type)
+			}
+		}
+		return inputs, nil
+	}
+
+	addSelectEdges := func(name string, stmt *parser.SelectStmt) error {
+		cteInputs := make(map[string][]string, len(stmt.With))
+		for _, named := range stmt.With {
+			// a named statement can only refer to the preceding ones
+			ins, err := relationInputs(name, named.Select.Relations, cteInputs)
+			if err != nil {
+				return err
+			}
+			cteInputs[string(named.Name)] = ins
+		}
+		ins, err := relationInputs(name, stmt.Relations, cteInputs)
+		if err != nil {
+			return err
+		}
+		for _, in := range ins {
+			g.addEdge(in, name)
+		}
+		return nil
+	}
+
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case parser.CreateSourceStmt:
+			g.addNode(string(stmt.Name), core.NTSource, stmt.String())
+
+		case parser.CreateStreamAsSelectStmt:
+			g.addNode(string(stmt.Name), core.NTBox, stmt.String())
+			if err := addSelectEdges(string(stmt.Name), &stmt.Select); err != nil {
+				return nil, err
+			}
+
+		case parser.CreateStreamAsSelectUnionStmt:
+			g.addNode(string(stmt.Name), core.NTBox, stmt.String())
+			for i := range stmt.Selects {
+				if err := addSelectEdges(string(stmt.Name), &stmt.Selects[i]); err != nil {
+					return nil, err
+				}
+			}
+
+		case parser.CreateSinkStmt:
+			g.addNode(string(stmt.Name), core.NTSink, stmt.String())
+
+		case parser.InsertIntoFromStmt:
+			g.addEdge(string(stmt.Input), string(stmt.Sink))
+
+		case parser.TeeStmt:
+			g.addEdge(string(stmt.Stream), string(stmt.Sink))
+
+		case parser.DropSourceStmt:
+			g.removeNodeWithModifier(string(stmt.Source), stmt.DropModifierAST)
+
+		case parser.DropStreamStmt:
+			g.removeNodeWithModifier(string(stmt.Stream), stmt.DropModifierAST)
+
+		case parser.DropSinkStmt:
+			g.removeNode(string(stmt.Sink))
+		}
+	}
+	g.normalize()
+	return g, nil
+}
+
+// GraphDiff is the difference between two dependency graphs.
+type GraphDiff struct {
+	// AddedNodes has nodes which only exist in the new graph.
+	AddedNodes []*GraphNode
+
+	// RemovedNodes has nodes which only exist in the old graph.
+	RemovedNodes []*GraphNode
+
+	// ChangedNodes has nodes which exist in both graphs but whose types or
+	// definitions are different. It has nodes of the new graph.
+	ChangedNodes []*GraphNode
+
+	// AddedEdges has edges which only exist in the new graph.
+	AddedEdges []GraphEdge
+
+	// RemovedEdges has edges which only exist in the old graph.
+	RemovedEdges []GraphEdge
+}
+
+// Empty returns true when there's no difference.
+func (d *GraphDiff) Empty() bool {
+	return len(d.AddedNodes) == 0 && len(d.RemovedNodes) == 0 &&
+		len(d.ChangedNodes) == 0 && len(d.AddedEdges) == 0 &&
+		len(d.RemovedEdges) == 0
+}
+
+// DiffGraphs compares two dependency graphs. Nodes are identified by their
+// names in a case-insensitive manner. Nodes in the result are sorted by
+// their names. A rewired edge is reported as a pair of a removed edge and an
+// added edge.
+func DiffGraphs(oldGraph, newGraph *Graph) *GraphDiff {
+	d := &GraphDiff{}
+	for name, n := range newGraph.Nodes {
+		o, ok := oldGraph.Nodes[name]
+		if !ok {
+			d.AddedNodes = append(d.AddedNodes, n)
+		} else if o.Type != n.Type || o.Definition != n.Definition {
+			d.ChangedNodes = append(d.ChangedNodes, n)
+		}
+	}
+	for name, o := range oldGraph.Nodes {
+		if _, ok := newGraph.Nodes[name]; !ok {
+			d.RemovedNodes = append(d.RemovedNodes, o)
+		}
+	}
+	sortGraphNodes(d.AddedNodes)
+	sortGraphNodes(d.RemovedNodes)
+	sortGraphNodes(d.ChangedNodes)
+
+	oldEdges := make(map[GraphEdge]bool, len(oldGraph.Edges))
+	for _, e := range oldGraph.Edges {
+		oldEdges[e] = true
+	}
+	newEdges := make(map[GraphEdge]bool, len(newGraph.Edges))
+	for _, e := range newGraph.Edges {
+		newEdges[e] = true
+		if !oldEdges[e] {
+			d.AddedEdges = append(d.AddedEdges, e)
+		}
+	}
+	for _, e := range oldGraph.Edges {
+		if !newEdges[e] {
+			d.RemovedEdges = append(d.RemovedEdges, e)
+		}
+	}
+	return d
+}
+
+type graphNodes []*GraphNode
+
+func (n graphNodes) Len() int      { return len(n) }
+func (n graphNodes) Swap(i, j int) { n[i], n[j] = n[j], n[i] }
+func (n graphNodes) Less(i, j int) bool {
+	return strings.ToLower(n[i].Name) < strings.ToLower(n[j].Name)
+}
+
+func sortGraphNodes(ns []*GraphNode) {
+	sort.Sort(graphNodes(ns))
+}
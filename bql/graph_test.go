@@ -0,0 +1,218 @@
+package bql
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"testing"
+)
+
+// countingUDSF counts how many times it's created and terminated.
+type countingUDSF struct {
+	duplicateUDSF
+}
+
+var (
+	countingUDSFCreated    int
+	countingUDSFTerminated int
+)
+
+func (c *countingUDSF) Terminate(ctx *core.Context) error {
+	countingUDSFTerminated++
+	return nil
+}
+
+func createCountingUDSF(decl udf.UDSFDeclarer, stream string) (udf.UDSF, error) {
+	if err := decl.Input(stream, nil); err != nil {
+		return nil, err
+	}
+	countingUDSFCreated++
+	return &countingUDSF{duplicateUDSF{dup: 1}}, nil
+}
+
+func init() {
+	udf.MustRegisterGlobalUDSFCreator("graph_test_counting", udf.MustConvertToUDSFCreator(createCountingUDSF))
+}
+
+func TestGraphDiff(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with a running topology", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		deployed := `CREATE PAUSED SOURCE s TYPE dummy;
+			CREATE PAUSED SOURCE s2 TYPE dummy;
+			CREATE STREAM t AS SELECT RSTREAM * FROM s [RANGE 1 TUPLES];
+			CREATE SINK snk TYPE collector;
+			CREATE SINK snk2 TYPE collector;
+			INSERT INTO snk FROM t;
+			INSERT INTO snk2 FROM s2;`
+		So(addBQLToTopology(tb, deployed), ShouldBeNil)
+
+		stmtsGraph := func(bql string) *Graph {
+			stmts, err := parser.New().ParseStmts(bql)
+			So(err, ShouldBeNil)
+			g, err := tb.StmtsGraph(stmts)
+			So(err, ShouldBeNil)
+			return g
+		}
+
+		Convey("When getting the graph of the topology", func() {
+			g, err := tb.Graph()
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have all nodes and edges", func() {
+				So(len(g.Nodes), ShouldEqual, 5)
+				So(g.Nodes["t"].Type, ShouldEqual, core.NTBox)
+				So(g.Nodes["t"].Definition, ShouldEqual,
+					"CREATE STREAM t AS SELECT RSTREAM * FROM s [RANGE 1 TUPLES]")
+				So(g.Edges, ShouldResemble, []GraphEdge{
+					{"s", "t"}, {"s2", "snk2"}, {"t", "snk"},
+				})
+			})
+
+			Convey("Then it should have no difference from the same statements", func() {
+				So(DiffGraphs(g, stmtsGraph(deployed)).Empty(), ShouldBeTrue)
+			})
+		})
+
+		Convey("When comparing statements adding a stream", func() {
+			g, err := tb.Graph()
+			So(err, ShouldBeNil)
+			d := DiffGraphs(g, stmtsGraph(deployed+`
+				CREATE STREAM u AS SELECT RSTREAM * FROM t [RANGE 1 TUPLES];
+				INSERT INTO snk FROM u;`))
+
+			Convey("Then the stream and its edges should be added", func() {
+				So(len(d.AddedNodes), ShouldEqual, 1)
+				So(d.AddedNodes[0].Name, ShouldEqual, "u")
+				So(d.AddedNodes[0].Type, ShouldEqual, core.NTBox)
+				So(d.RemovedNodes, ShouldBeEmpty)
+				So(d.ChangedNodes, ShouldBeEmpty)
+				So(d.AddedEdges, ShouldResemble, []GraphEdge{{"t", "u"}, {"u", "snk"}})
+				So(d.RemovedEdges, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When comparing statements removing a sink", func() {
+			g, err := tb.Graph()
+			So(err, ShouldBeNil)
+			d := DiffGraphs(g, stmtsGraph(deployed+`
+				DROP SINK snk2;`))
+
+			Convey("Then the sink and its edge should be removed", func() {
+				So(d.AddedNodes, ShouldBeEmpty)
+				So(len(d.RemovedNodes), ShouldEqual, 1)
+				So(d.RemovedNodes[0].Name, ShouldEqual, "snk2")
+				So(d.RemovedNodes[0].Type, ShouldEqual, core.NTSink)
+				So(d.AddedEdges, ShouldBeEmpty)
+				So(d.RemovedEdges, ShouldResemble, []GraphEdge{{"s2", "snk2"}})
+			})
+		})
+
+		Convey("When comparing statements dropping a source with CASCADE", func() {
+			g, err := tb.Graph()
+			So(err, ShouldBeNil)
+			d := DiffGraphs(g, stmtsGraph(deployed+`
+				DROP SOURCE s CASCADE;`))
+
+			Convey("Then the source and its dependents should be removed", func() {
+				So(d.AddedNodes, ShouldBeEmpty)
+				So(len(d.RemovedNodes), ShouldEqual, 3)
+				So(d.RemovedNodes[0].Name, ShouldEqual, "s")
+				So(d.RemovedNodes[1].Name, ShouldEqual, "snk")
+				So(d.RemovedNodes[2].Name, ShouldEqual, "t")
+				So(d.RemovedEdges, ShouldResemble, []GraphEdge{{"s", "t"}, {"t", "snk"}})
+			})
+		})
+
+		Convey("When comparing statements rewiring an edge", func() {
+			g, err := tb.Graph()
+			So(err, ShouldBeNil)
+			d := DiffGraphs(g, stmtsGraph(`CREATE PAUSED SOURCE s TYPE dummy;
+				CREATE PAUSED SOURCE s2 TYPE dummy;
+				CREATE STREAM t AS SELECT RSTREAM * FROM s2 [RANGE 1 TUPLES];
+				CREATE SINK snk TYPE collector;
+				CREATE SINK snk2 TYPE collector;
+				INSERT INTO snk FROM t;
+				INSERT INTO snk2 FROM s2;`))
+
+			Convey("Then the stream should be changed and its edge should be rewired", func() {
+				So(d.AddedNodes, ShouldBeEmpty)
+				So(d.RemovedNodes, ShouldBeEmpty)
+				So(len(d.ChangedNodes), ShouldEqual, 1)
+				So(d.ChangedNodes[0].Name, ShouldEqual, "t")
+				So(d.AddedEdges, ShouldResemble, []GraphEdge{{"s2", "t"}})
+				So(d.RemovedEdges, ShouldResemble, []GraphEdge{{"s", "t"}})
+			})
+		})
+
+		Convey("When comparing statements using a UDSF", func() {
+			countingUDSFCreated, countingUDSFTerminated = 0, 0
+			g, err := tb.Graph()
+			So(err, ShouldBeNil)
+			d := DiffGraphs(g, stmtsGraph(deployed+`
+				CREATE STREAM u AS SELECT ISTREAM * FROM graph_test_counting("t") [RANGE 1 TUPLES];`))
+
+			Convey("Then the inputs of the UDSF should be connected to the stream", func() {
+				So(d.AddedEdges, ShouldResemble, []GraphEdge{{"t", "u"}})
+			})
+
+			Convey("Then the UDSF should be created and terminated once", func() {
+				So(countingUDSFCreated, ShouldEqual, 1)
+				So(countingUDSFTerminated, ShouldEqual, 1)
+			})
+
+			Convey("Then the topology shouldn't have the stream", func() {
+				_, err := dt.Node("u")
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a stream having a WITH clause is deployed", func() {
+			withStmts := deployed + `
+				CREATE STREAM u AS WITH
+					a AS (SELECT RSTREAM * FROM s [RANGE 1 TUPLES]),
+					b AS (SELECT RSTREAM * FROM a [RANGE 1 TUPLES], s2 [RANGE 1 TUPLES])
+				SELECT RSTREAM * FROM b [RANGE 1 TUPLES], t [RANGE 1 TUPLES];`
+			So(addBQLToTopology(tb, withStmts[len(deployed):]), ShouldBeNil)
+			g, err := tb.Graph()
+			So(err, ShouldBeNil)
+
+			Convey("Then the graph should connect the inputs of the named statements", func() {
+				So(g.Edges, ShouldContain, GraphEdge{"s", "u"})
+				So(g.Edges, ShouldContain, GraphEdge{"s2", "u"})
+				So(g.Edges, ShouldContain, GraphEdge{"t", "u"})
+			})
+
+			Convey("Then it should have no difference from the same statements", func() {
+				d := DiffGraphs(g, stmtsGraph(withStmts))
+				So(d.AddedEdges, ShouldBeEmpty)
+				So(d.RemovedEdges, ShouldBeEmpty)
+				So(d.Empty(), ShouldBeTrue)
+			})
+		})
+
+		Convey("When a stream having a UNION is deployed", func() {
+			So(addBQLToTopology(tb, `CREATE STREAM u AS
+				SELECT RSTREAM * FROM s [RANGE 1 TUPLES] UNION ALL
+				SELECT RSTREAM * FROM t [RANGE 1 TUPLES];`), ShouldBeNil)
+			g, err := tb.Graph()
+			So(err, ShouldBeNil)
+
+			Convey("Then the graph shouldn't have temporary nodes", func() {
+				So(len(g.Nodes), ShouldEqual, 6)
+				So(g.Edges, ShouldContain, GraphEdge{"s", "u"})
+				So(g.Edges, ShouldContain, GraphEdge{"t", "u"})
+				for _, e := range g.Edges {
+					So(isTemporaryNodeName(e.From), ShouldBeFalse)
+					So(isTemporaryNodeName(e.To), ShouldBeFalse)
+				}
+			})
+		})
+	})
+}
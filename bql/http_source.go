@@ -0,0 +1,426 @@
+package bql
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPPushSource is a Source accepting tuples pushed over HTTP. The server
+// forwards requests to
+// POST /api/v1/topologies/:topologyName/sources/:sourceName/push to sources
+// implementing this interface.
+type HTTPPushSource interface {
+	core.Source
+
+	// PushHTTP converts the body of the request to tuples and writes them.
+	// It returns the number of tuples written. No tuple is written when the
+	// body has an invalid tuple. An error returned from this method can be
+	// *HTTPPushError to tell the status code to be returned to the client.
+	PushHTTP(r *http.Request) (int, error)
+}
+
+// HTTPPushError is an error returned from HTTPPushSource.PushHTTP with the
+// status code of the response.
+type HTTPPushError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *HTTPPushError) Error() string {
+	return e.Err.Error()
+}
+
+func newHTTPPushError(code int, format string, args ...interface{}) error {
+	return &HTTPPushError{
+		StatusCode: code,
+		Err:        fmt.Errorf(format, args...),
+	}
+}
+
+// httpSource is a source which emits tuples pushed by HTTP POST requests.
+// It accepts requests through the server's API and, when "listen" parameter
+// is given, through its own HTTP server as well.
+//
+// The format of the request body is determined by its Content-Type header
+// unless "format" parameter is specified:
+//
+//   - application/json: a JSON object or an array of JSON objects
+//   - application/x-ndjson, application/jsonl: a JSON object per line
+//   - application/x-www-form-urlencoded, multipart/form-data: a form, whose
+//     values become strings or arrays of strings when a key has multiple
+//     values
+type httpSource struct {
+	ioParams     *IOParams
+	format       string
+	numberPolicy data.JSONNumberPolicy
+	maxBodySize  int64
+	token        string
+
+	path     string
+	listener net.Listener
+	certFile string
+	keyFile  string
+
+	m       sync.Mutex
+	ctx     *core.Context
+	w       core.Writer
+	stopped bool
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+
+	numRequests int64
+	numTuples   int64
+	numErrors   int64
+}
+
+var _ HTTPPushSource = &httpSource{}
+
+func (s *httpSource) GenerateStream(ctx *core.Context, w core.Writer) error {
+	s.m.Lock()
+	if s.stopped {
+		s.m.Unlock()
+		return nil
+	}
+	s.ctx = ctx
+	s.w = w
+	s.m.Unlock()
+
+	if s.listener == nil {
+		<-s.stopCh
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(s.path, s)
+	server := &http.Server{
+		Handler:     mux,
+		ReadTimeout: time.Minute,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		if s.certFile != "" {
+			errCh <- server.ServeTLS(s.listener, s.certFile, s.keyFile)
+		} else {
+			errCh <- server.Serve(s.listener)
+		}
+	}()
+
+	select {
+	case <-s.stopCh:
+		// Handlers don't block on writing tuples after the source is
+		// stopped, so shutting down the server doesn't take long.
+		return server.Close()
+	case err := <-errCh:
+		return err
+	}
+}
+
+// ServeHTTP handles requests sent to the source's own HTTP server.
+func (s *httpSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	res := map[string]interface{}{}
+	code := http.StatusOK
+	if r.URL.Path != s.path {
+		code = http.StatusNotFound
+		res["error"] = "not found"
+	} else if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		code = http.StatusMethodNotAllowed
+		res["error"] = "only POST is allowed"
+	} else if n, err := s.PushHTTP(r); err != nil {
+		code = http.StatusBadRequest
+		if e, ok := err.(*HTTPPushError); ok {
+			code = e.StatusCode
+		}
+		res["error"] = err.Error()
+	} else {
+		res["count"] = n
+	}
+
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *httpSource) PushHTTP(r *http.Request) (int, error) {
+	atomic.AddInt64(&s.numRequests, 1)
+	n, err := s.push(r)
+	if err != nil {
+		atomic.AddInt64(&s.numErrors, 1)
+		return n, err
+	}
+	atomic.AddInt64(&s.numTuples, int64(n))
+	return n, nil
+}
+
+func (s *httpSource) push(r *http.Request) (int, error) {
+	if s.token != "" {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(s.token)) != 1 {
+			return 0, newHTTPPushError(http.StatusUnauthorized, "a valid bearer token is required")
+		}
+	}
+
+	s.m.Lock()
+	if s.stopped || s.w == nil {
+		s.m.Unlock()
+		return 0, newHTTPPushError(http.StatusServiceUnavailable, "the source isn't running")
+	}
+	ctx, w := s.ctx, s.w
+	s.wg.Add(1)
+	s.m.Unlock()
+	defer s.wg.Done()
+
+	ds, err := s.parse(r)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, d := range ds {
+		if err := w.Write(ctx, core.NewTuple(d)); err != nil {
+			if err == core.ErrSourceStopped {
+				return i, newHTTPPushError(http.StatusServiceUnavailable, "the source has been stopped")
+			}
+			return i, &HTTPPushError{StatusCode: http.StatusInternalServerError, Err: err}
+		}
+	}
+	return len(ds), nil
+}
+
+func (s *httpSource) parse(r *http.Request) ([]data.Map, error) {
+	format := s.format
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if format == "auto" {
+		if err != nil {
+			return nil, newHTTPPushError(http.StatusUnsupportedMediaType, "invalid Content-Type: %v", err)
+		}
+		switch mediaType {
+		case "application/json":
+			format = "json"
+		case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+			format = "ndjson"
+		case "application/x-www-form-urlencoded", "multipart/form-data":
+			format = "form"
+		default:
+			return nil, newHTTPPushError(http.StatusUnsupportedMediaType, "unsupported Content-Type: %v", mediaType)
+		}
+	}
+
+	r.Body = http.MaxBytesReader(nil, r.Body, s.maxBodySize)
+	if format == "form" {
+		return s.parseForm(r, mediaType)
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, bodyReadError(err)
+	}
+	if format == "json" {
+		return s.parseJSON(body)
+	}
+	return s.parseNDJSON(body)
+}
+
+func bodyReadError(err error) error {
+	var e *http.MaxBytesError
+	if errors.As(err, &e) {
+		return newHTTPPushError(http.StatusRequestEntityTooLarge, "the request body exceeds %v bytes", e.Limit)
+	}
+	return newHTTPPushError(http.StatusBadRequest, "cannot read the request body: %v", err)
+}
+
+func (s *httpSource) parseJSON(body []byte) ([]data.Map, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var arr []json.RawMessage
+		if err := json.Unmarshal(body, &arr); err != nil {
+			return nil, newHTTPPushError(http.StatusBadRequest, "invalid JSON: %v", err)
+		}
+		ds := make([]data.Map, len(arr))
+		for i, e := range arr {
+			m, err := data.UnmarshalJSONMap(e, s.numberPolicy)
+			if err != nil {
+				return nil, newHTTPPushError(http.StatusBadRequest, "invalid element at index %v: %v", i, err)
+			}
+			ds[i] = m
+		}
+		return ds, nil
+	}
+
+	m, err := data.UnmarshalJSONMap(body, s.numberPolicy)
+	if err != nil {
+		return nil, newHTTPPushError(http.StatusBadRequest, "invalid JSON: %v", err)
+	}
+	return []data.Map{m}, nil
+}
+
+func (s *httpSource) parseNDJSON(body []byte) ([]data.Map, error) {
+	var ds []data.Map
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	sc.Buffer(nil, len(body)+1)
+	for line := 1; sc.Scan(); line++ {
+		l := bytes.TrimSpace(sc.Bytes())
+		if len(l) == 0 {
+			continue
+		}
+		m, err := data.UnmarshalJSONMap(l, s.numberPolicy)
+		if err != nil {
+			return nil, newHTTPPushError(http.StatusBadRequest, "invalid JSON at line %v: %v", line, err)
+		}
+		ds = append(ds, m)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, newHTTPPushError(http.StatusBadRequest, "cannot read the request body: %v", err)
+	}
+	return ds, nil
+}
+
+func (s *httpSource) parseForm(r *http.Request, mediaType string) ([]data.Map, error) {
+	var err error
+	if mediaType == "multipart/form-data" {
+		err = r.ParseMultipartForm(s.maxBodySize)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		return nil, bodyReadError(err)
+	}
+
+	m := data.Map{}
+	values := r.PostForm
+	if r.MultipartForm != nil {
+		values = r.MultipartForm.Value
+	}
+	for k, vs := range values {
+		if len(vs) == 1 {
+			m[k] = data.String(vs[0])
+			continue
+		}
+		a := make(data.Array, len(vs))
+		for i, v := range vs {
+			a[i] = data.String(v)
+		}
+		m[k] = a
+	}
+	return []data.Map{m}, nil
+}
+
+func (s *httpSource) Stop(ctx *core.Context) error {
+	s.m.Lock()
+	if s.stopped {
+		s.m.Unlock()
+		return nil
+	}
+	s.stopped = true
+	close(s.stopCh)
+	s.m.Unlock()
+
+	// Wait for requests writing tuples so that Write won't be called after
+	// this method returns.
+	s.wg.Wait()
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	return nil
+}
+
+func (s *httpSource) Status() data.Map {
+	m := data.Map{
+		"num_requests": data.Int(atomic.LoadInt64(&s.numRequests)),
+		"num_tuples":   data.Int(atomic.LoadInt64(&s.numTuples)),
+		"num_errors":   data.Int(atomic.LoadInt64(&s.numErrors)),
+	}
+	if s.listener != nil {
+		m["listen"] = data.String(s.listener.Addr().String())
+		m["path"] = data.String(s.path)
+	}
+	return m
+}
+
+func createHTTPSource(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Source, error) {
+	v := &struct {
+		Listen      string
+		Path        string
+		Format      string
+		JSONNumber  string
+		MaxBodySize int64 `bql:",weaklytyped"`
+		Token       string
+		CertFile    string
+		KeyFile     string
+	}{
+		Path:        "/",
+		Format:      "auto",
+		JSONNumber:  "preserve",
+		MaxBodySize: 10 << 20,
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+
+	s := &httpSource{
+		ioParams:    ioParams,
+		format:      strings.ToLower(v.Format),
+		maxBodySize: v.MaxBodySize,
+		token:       v.Token,
+		path:        v.Path,
+		certFile:    v.CertFile,
+		keyFile:     v.KeyFile,
+		stopCh:      make(chan struct{}),
+	}
+	switch s.format {
+	case "auto", "json", "form":
+	case "ndjson", "jsonl":
+		s.format = "ndjson"
+	default:
+		return nil, fmt.Errorf("format must be one of auto, json, ndjson, or form: %v", v.Format)
+	}
+	policy, err := data.ParseJSONNumberPolicy(v.JSONNumber)
+	if err != nil {
+		return nil, fmt.Errorf("'json_number' parameter must be one of preserve, int, or float: %v", err)
+	}
+	s.numberPolicy = policy
+	if s.maxBodySize <= 0 {
+		return nil, errors.New("max_body_size must be positive")
+	}
+	if !strings.HasPrefix(s.path, "/") {
+		return nil, fmt.Errorf("path must start with '/': %v", s.path)
+	}
+	if (v.CertFile == "") != (v.KeyFile == "") {
+		return nil, errors.New("cert_file and key_file must be given together")
+	}
+	if v.Listen == "" {
+		if v.CertFile != "" {
+			return nil, errors.New("cert_file and key_file require listen parameter")
+		}
+		return s, nil
+	}
+
+	// The address is listened here so that an error like "address already
+	// in use" is reported by CREATE SOURCE statement.
+	l, err := net.Listen("tcp", v.Listen)
+	if err != nil {
+		return nil, err
+	}
+	s.listener = l
+	return s, nil
+}
+
+func init() {
+	MustRegisterGlobalSourceCreator("http", SourceCreatorFunc(createHTTPSource))
+}
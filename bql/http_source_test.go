@@ -0,0 +1,293 @@
+package bql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPSource(t *testing.T) {
+	Convey("Given a running http source", t, func() {
+		ctx := core.NewContext(nil)
+		params := data.Map{}
+		w := &testFileWriter{}
+		w.c = sync.NewCond(&w.m)
+
+		push := func(s HTTPPushSource, contentType, body string) (int, error) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+			r.Header.Set("Content-Type", contentType)
+			return s.PushHTTP(r)
+		}
+		run := func() HTTPPushSource {
+			s, err := createHTTPSource(ctx, &IOParams{Name: "http_test"}, params)
+			So(err, ShouldBeNil)
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, w)
+			}()
+			Reset(func() {
+				s.Stop(ctx)
+				<-ch
+			})
+			ps := s.(HTTPPushSource)
+			// wait until GenerateStream is called
+			for {
+				_, err := push(ps, "application/json", "[]")
+				if e, ok := err.(*HTTPPushError); !ok || e.StatusCode != http.StatusServiceUnavailable {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			return ps
+		}
+		statusOf := func(err error) int {
+			e, ok := err.(*HTTPPushError)
+			So(ok, ShouldBeTrue)
+			return e.StatusCode
+		}
+
+		Convey("When pushing a JSON object", func() {
+			s := run()
+			n, err := push(s, "application/json; charset=utf-8", `{"a":1,"b":"x"}`)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should emit a tuple", func() {
+				So(n, ShouldEqual, 1)
+				So(w.ds, ShouldResemble, []data.Map{{"a": data.Int(1), "b": data.String("x")}})
+			})
+		})
+
+		Convey("When pushing an array of JSON objects", func() {
+			s := run()
+			n, err := push(s, "application/json", `[{"a":1},{"a":2.5}]`)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should emit all tuples", func() {
+				So(n, ShouldEqual, 2)
+				So(w.ds, ShouldResemble, []data.Map{{"a": data.Int(1)}, {"a": data.Float(2.5)}})
+			})
+		})
+
+		Convey("When pushing NDJSON", func() {
+			s := run()
+			n, err := push(s, "application/x-ndjson", "{\"a\":1}\n\n{\"a\":2}\n")
+			So(err, ShouldBeNil)
+
+			Convey("Then it should emit a tuple for each line", func() {
+				So(n, ShouldEqual, 2)
+				So(w.ds, ShouldResemble, []data.Map{{"a": data.Int(1)}, {"a": data.Int(2)}})
+			})
+		})
+
+		Convey("When pushing a url-encoded form", func() {
+			s := run()
+			form := url.Values{"a": {"1"}, "b": {"x", "y"}}
+			n, err := push(s, "application/x-www-form-urlencoded", form.Encode())
+			So(err, ShouldBeNil)
+
+			Convey("Then it should emit a tuple having string values", func() {
+				So(n, ShouldEqual, 1)
+				So(w.ds, ShouldResemble, []data.Map{{
+					"a": data.String("1"),
+					"b": data.Array{data.String("x"), data.String("y")},
+				}})
+			})
+		})
+
+		Convey("When pushing a multipart form", func() {
+			s := run()
+			buf := bytes.NewBuffer(nil)
+			mw := multipart.NewWriter(buf)
+			So(mw.WriteField("a", "1"), ShouldBeNil)
+			So(mw.Close(), ShouldBeNil)
+			n, err := push(s, mw.FormDataContentType(), buf.String())
+			So(err, ShouldBeNil)
+
+			Convey("Then it should emit a tuple", func() {
+				So(n, ShouldEqual, 1)
+				So(w.ds, ShouldResemble, []data.Map{{"a": data.String("1")}})
+			})
+		})
+
+		Convey("When the format is fixed", func() {
+			params["format"] = data.String("ndjson")
+			s := run()
+			n, err := push(s, "text/plain", "{\"a\":1}\n{\"a\":2}")
+
+			Convey("Then Content-Type should be ignored", func() {
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When pushing invalid bodies", func() {
+			params["max_body_size"] = data.Int(100)
+			s := run()
+
+			Convey("Then it should fail without emitting tuples", func() {
+				numErrors := s.(core.Statuser).Status()["num_errors"].(data.Int)
+				_, err := push(s, "application/json", `{"a":`)
+				So(statusOf(err), ShouldEqual, http.StatusBadRequest)
+				_, err = push(s, "application/json", `[{"a":1}, 1]`)
+				So(statusOf(err), ShouldEqual, http.StatusBadRequest)
+				_, err = push(s, "application/x-ndjson", "{\"a\":1}\ninvalid")
+				So(statusOf(err), ShouldEqual, http.StatusBadRequest)
+				_, err = push(s, "text/plain", `{}`)
+				So(statusOf(err), ShouldEqual, http.StatusUnsupportedMediaType)
+				_, err = push(s, "application/json", fmt.Sprintf(`{"a":"%v"}`, strings.Repeat("x", 100)))
+				So(statusOf(err), ShouldEqual, http.StatusRequestEntityTooLarge)
+				So(w.ds, ShouldBeEmpty)
+
+				st := s.(core.Statuser).Status()
+				So(st["num_errors"], ShouldEqual, numErrors+5)
+			})
+		})
+
+		Convey("When the source requires a token", func() {
+			params["token"] = data.String("secret")
+			s, err := createHTTPSource(ctx, &IOParams{Name: "http_test"}, params)
+			So(err, ShouldBeNil)
+			go s.GenerateStream(ctx, w)
+			Reset(func() {
+				s.Stop(ctx)
+			})
+			ps := s.(HTTPPushSource)
+
+			Convey("Then a request without the token should fail", func() {
+				_, err := push(ps, "application/json", `{}`)
+				So(statusOf(err), ShouldEqual, http.StatusUnauthorized)
+			})
+
+			Convey("Then a request with the token should succeed", func() {
+				r := httptest.NewRequest("POST", "/", strings.NewReader(`{"a":1}`))
+				r.Header.Set("Content-Type", "application/json")
+				r.Header.Set("Authorization", "Bearer secret")
+				var err error
+				for i := 0; i < 100; i++ { // GenerateStream might not be called yet
+					if _, err = ps.PushHTTP(r); err == nil || statusOf(err) != http.StatusServiceUnavailable {
+						break
+					}
+					r.Body = ioutil.NopCloser(strings.NewReader(`{"a":1}`))
+					time.Sleep(10 * time.Millisecond)
+				}
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When the source is stopped", func() {
+			s := run()
+			So(s.Stop(ctx), ShouldBeNil)
+
+			Convey("Then pushing should fail", func() {
+				_, err := push(s, "application/json", `{}`)
+				So(statusOf(err), ShouldEqual, http.StatusServiceUnavailable)
+			})
+		})
+	})
+
+	Convey("Given an http source listening on its own port", t, func() {
+		ctx := core.NewContext(nil)
+		w := &testFileWriter{}
+		w.c = sync.NewCond(&w.m)
+		s, err := createHTTPSource(ctx, &IOParams{Name: "http_test"}, data.Map{
+			"listen": data.String("127.0.0.1:0"),
+			"path":   data.String("/events"),
+		})
+		So(err, ShouldBeNil)
+		ch := make(chan error, 1)
+		go func() {
+			ch <- s.GenerateStream(ctx, w)
+		}()
+		Reset(func() {
+			s.Stop(ctx)
+			<-ch
+		})
+		addr := string(s.(core.Statuser).Status()["listen"].(data.String))
+		u := fmt.Sprintf("http://%v/events", addr)
+
+		Convey("When posting tuples", func() {
+			var res *http.Response
+			for i := 0; i < 100; i++ { // GenerateStream might not be called yet
+				res, err = http.Post(u, "application/x-ndjson", strings.NewReader("{\"a\":1}\n{\"a\":2}"))
+				So(err, ShouldBeNil)
+				if res.StatusCode != http.StatusServiceUnavailable {
+					break
+				}
+				res.Body.Close()
+				time.Sleep(10 * time.Millisecond)
+			}
+			defer res.Body.Close()
+
+			Convey("Then it should respond with the number of tuples", func() {
+				So(res.StatusCode, ShouldEqual, http.StatusOK)
+				var js map[string]interface{}
+				So(json.NewDecoder(res.Body).Decode(&js), ShouldBeNil)
+				So(js["count"], ShouldEqual, 2)
+				w.wait(2)
+				So(w.ds[1], ShouldResemble, data.Map{"a": data.Int(2)})
+			})
+		})
+
+		Convey("When sending a GET request", func() {
+			res, err := http.Get(u)
+			So(err, ShouldBeNil)
+			res.Body.Close()
+
+			Convey("Then it should fail", func() {
+				So(res.StatusCode, ShouldEqual, http.StatusMethodNotAllowed)
+			})
+		})
+
+		Convey("When posting to a wrong path", func() {
+			res, err := http.Post(fmt.Sprintf("http://%v/other", addr), "application/json", strings.NewReader("{}"))
+			So(err, ShouldBeNil)
+			res.Body.Close()
+
+			Convey("Then it should fail", func() {
+				So(res.StatusCode, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When creating another source listening on the same address", func() {
+			_, err := createHTTPSource(ctx, &IOParams{}, data.Map{"listen": data.String(addr)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given invalid parameters", t, func() {
+		ctx := core.NewContext(nil)
+		cases := map[string]data.Map{
+			"unsupported format":       {"format": data.String("xml")},
+			"invalid json_number":      {"json_number": data.String("str")},
+			"non-positive body size":   {"max_body_size": data.Int(0)},
+			"relative path":            {"listen": data.String("127.0.0.1:0"), "path": data.String("events")},
+			"cert_file without key":    {"listen": data.String("127.0.0.1:0"), "cert_file": data.String("cert.pem")},
+			"cert_file without listen": {"cert_file": data.String("cert.pem"), "key_file": data.String("key.pem")},
+		}
+		for name, params := range cases {
+			params := params
+			Convey("When creating a source with "+name, func() {
+				_, err := createHTTPSource(ctx, &IOParams{}, params)
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
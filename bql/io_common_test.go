@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"strings"
 	"sync"
 	"time"
 )
@@ -157,9 +159,66 @@ func (s *tupleEmitterUpdatableSource) Update(ctx *core.Context, params data.Map)
 	return nil
 }
 
+// createDummyReloadableSource creates a source that reads its configuration
+// from the file given as the path parameter and can reload it.
+func createDummyReloadableSource(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Source, error) {
+	path := ""
+	for key, value := range params {
+		if key == "path" {
+			p, err := data.AsString(value)
+			if err != nil {
+				return nil, fmt.Errorf("path: cannot convert value %s into string", value)
+			}
+			path = p
+		} else {
+			return nil, fmt.Errorf("unknown source parameter: %s", key)
+		}
+	}
+
+	s := &tupleEmitterReloadableSource{
+		tupleEmitterSource: &tupleEmitterSource{Tuples: mkTuples(4)},
+		path:               path,
+	}
+	s.c = sync.NewCond(&s.m)
+	if err := s.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type tupleEmitterReloadableSource struct {
+	*tupleEmitterSource
+	path string
+
+	configM sync.Mutex
+	config  string
+}
+
+var (
+	_ core.Reloader = &tupleEmitterReloadableSource{}
+)
+
+func (s *tupleEmitterReloadableSource) Reload(ctx *core.Context) error {
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	s.configM.Lock()
+	defer s.configM.Unlock()
+	s.config = strings.TrimSpace(string(b))
+	return nil
+}
+
+func (s *tupleEmitterReloadableSource) currentConfig() string {
+	s.configM.Lock()
+	defer s.configM.Unlock()
+	return s.config
+}
+
 func init() {
 	MustRegisterGlobalSourceCreator("dummy", SourceCreatorFunc(createDummySource))
 	MustRegisterGlobalSourceCreator("dummy_updatable", SourceCreatorFunc(createDummyUpdatableSource))
+	MustRegisterGlobalSourceCreator("dummy_reloadable", SourceCreatorFunc(createDummyReloadableSource))
 }
 
 // createCollectorSink creates a sink that collects all received
@@ -0,0 +1,495 @@
+package bql
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mqttConnParams has parameters shared by the MQTT source and sink to connect
+// to a broker.
+type mqttConnParams struct {
+	// Broker is the address of the broker such as "tcp://localhost:1883" or
+	// "ssl://example.com:8883". The scheme can be tcp, mqtt, ssl, tls, or
+	// mqtts. When the scheme is omitted, tcp is used.
+	Broker string `bql:",required"`
+
+	ClientID        string
+	Username        string
+	Password        string
+	ProtocolVersion string `bql:",weaklytyped"`
+	CleanSession    bool
+	KeepAlive       time.Duration
+	ConnectTimeout  time.Duration
+
+	// TLS parameters. TLS is enabled by the scheme of Broker or by giving
+	// any of ca_file, cert_file, and key_file.
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+func defaultMQTTConnParams() mqttConnParams {
+	return mqttConnParams{
+		ProtocolVersion: "3.1.1",
+		CleanSession:    true,
+		KeepAlive:       30 * time.Second,
+		ConnectTimeout:  10 * time.Second,
+	}
+}
+
+func (p *mqttConnParams) options() (*mqttOptions, error) {
+	opts := &mqttOptions{
+		ClientID:     p.ClientID,
+		Username:     p.Username,
+		Password:     p.Password,
+		CleanSession: p.CleanSession,
+		KeepAlive:    p.KeepAlive,
+		Timeout:      p.ConnectTimeout,
+	}
+	switch p.ProtocolVersion {
+	case "3.1.1", "4":
+		opts.Version = 4
+	case "5", "5.0":
+		opts.Version = 5
+	default:
+		return nil, fmt.Errorf("protocol_version must be 3.1.1 or 5: %v", p.ProtocolVersion)
+	}
+	if p.KeepAlive < 0 || p.KeepAlive > 65535*time.Second {
+		return nil, errors.New("keep_alive must be between 0 and 65535 seconds")
+	}
+	if p.ConnectTimeout < 0 {
+		return nil, errors.New("connect_timeout must not be negative")
+	}
+	if !p.CleanSession && p.ClientID == "" {
+		return nil, errors.New("client_id is required when clean_session is false")
+	}
+
+	useTLS, host, err := parseMQTTBroker(p.Broker)
+	if err != nil {
+		return nil, err
+	}
+	opts.Address = host
+	if useTLS || p.CAFile != "" || p.CertFile != "" || p.KeyFile != "" {
+		c, err := p.tlsConfig(host)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLS = c
+	}
+	return opts, nil
+}
+
+// parseMQTTBroker returns whether TLS is used and the address in the form of
+// "host:port".
+func parseMQTTBroker(broker string) (bool, string, error) {
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	u, err := url.Parse(broker)
+	if err != nil {
+		return false, "", fmt.Errorf("broker must be a URL like tcp://localhost:1883: %v", err)
+	}
+	if u.Host == "" {
+		return false, "", fmt.Errorf("broker doesn't have a host: %v", broker)
+	}
+
+	var useTLS bool
+	port := "1883"
+	switch strings.ToLower(u.Scheme) {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		useTLS = true
+		port = "8883"
+	default:
+		return false, "", fmt.Errorf("unsupported scheme of broker: %v", u.Scheme)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return useTLS, net.JoinHostPort(u.Hostname(), port), nil
+}
+
+func (p *mqttConnParams) tlsConfig(addr string) (*tls.Config, error) {
+	c := &tls.Config{
+		ServerName:         p.ServerName,
+		InsecureSkipVerify: p.InsecureSkipVerify,
+	}
+	if c.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		c.ServerName = host
+	}
+	if p.CAFile != "" {
+		pem, err := ioutil.ReadFile(p.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read ca_file: %v", err)
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file doesn't have any certificate: %v", p.CAFile)
+		}
+	}
+	if p.CertFile != "" || p.KeyFile != "" {
+		if p.CertFile == "" || p.KeyFile == "" {
+			return nil, errors.New("cert_file and key_file must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(p.CertFile, p.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load the client certificate: %v", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// validateMQTTTopicName returns an error when name cannot be used as a
+// topic of a published message.
+func validateMQTTTopicName(name string) error {
+	if name == "" {
+		return errors.New("a topic name must not be empty")
+	}
+	if strings.ContainsAny(name, "+#\x00") {
+		return fmt.Errorf("a topic name cannot contain wildcards: %v", name)
+	}
+	return nil
+}
+
+// validateMQTTTopicFilter returns an error when filter isn't a valid topic
+// filter. A filter can contain a single-level wildcard "+" as a level and a
+// multi-level wildcard "#" as the last level.
+func validateMQTTTopicFilter(filter string) error {
+	if filter == "" {
+		return errors.New("a topic filter must not be empty")
+	}
+	if strings.Contains(filter, "\x00") {
+		return errors.New("a topic filter cannot contain a null character")
+	}
+	levels := strings.Split(filter, "/")
+	for i, l := range levels {
+		if strings.Contains(l, "#") && (l != "#" || i != len(levels)-1) {
+			return fmt.Errorf("'#' must be the last level of a topic filter: %v", filter)
+		}
+		if strings.Contains(l, "+") && l != "+" {
+			return fmt.Errorf("'+' must occupy an entire level of a topic filter: %v", filter)
+		}
+	}
+	return nil
+}
+
+func mqttQoS(qos int) (byte, error) {
+	if qos < 0 || qos > 2 {
+		return 0, fmt.Errorf("qos must be 0, 1, or 2: %v", qos)
+	}
+	return byte(qos), nil
+}
+
+// mqttSource subscribes to topics of an MQTT broker and emits a tuple for
+// each message. It reconnects to the broker with exponential backoff when
+// the connection is lost.
+type mqttSource struct {
+	ioParams     *IOParams
+	opts         mqttOptions
+	subs         []mqttSubscription
+	format       string
+	numberPolicy data.JSONNumberPolicy
+	topicField   string
+	*reconnector
+}
+
+func (s *mqttSource) GenerateStream(ctx *core.Context, w core.Writer) error {
+	return s.run(ctx, "Cannot receive messages from the MQTT broker", func() (bool, error) {
+		return s.connect(ctx, w)
+	})
+}
+
+func (s *mqttSource) connect(ctx *core.Context, w core.Writer) (bool, error) {
+	c, err := dialMQTT(&s.opts, func(m *mqttMessage) error {
+		t, err := s.toTuple(m)
+		if err != nil {
+			ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
+				WithField("topic", m.Topic).Warning("Ignoring the message due to a parse error")
+			return nil
+		}
+		return w.Write(ctx, t)
+	})
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+	if err := c.Subscribe(s.subs); err != nil {
+		return false, err
+	}
+
+	s.setConnected(true)
+	defer s.setConnected(false)
+	select {
+	case <-c.Done():
+		if err := c.Err(); err != nil {
+			return true, err
+		}
+		return true, errors.New("the connection was closed")
+	case <-s.stopCh:
+		return true, nil
+	}
+}
+
+func (s *mqttSource) toTuple(m *mqttMessage) (*core.Tuple, error) {
+	var d data.Map
+	switch s.format {
+	case "json":
+		var err error
+		if d, err = data.UnmarshalJSONMap(m.Payload, s.numberPolicy); err != nil {
+			return nil, err
+		}
+	case "msgpack":
+		var err error
+		if d, err = data.UnmarshalMsgpack(m.Payload); err != nil {
+			return nil, err
+		}
+	default: // raw
+		d = data.Map{"payload": data.Blob(m.Payload)}
+	}
+	if s.topicField != "" {
+		d[s.topicField] = data.String(m.Topic)
+	}
+	return core.NewTuple(d), nil
+}
+
+func (s *mqttSource) Stop(ctx *core.Context) error {
+	close(s.stopCh)
+	return nil
+}
+
+func (s *mqttSource) Status() data.Map {
+	return s.status()
+}
+
+func createMQTTSource(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Source, error) {
+	v := &struct {
+		mqttConnParams
+		Topics               data.Value `bql:",required"`
+		QoS                  int        `bql:"qos"`
+		Format               string
+		JSONNumber           string
+		TopicField           string
+		MinReconnectInterval time.Duration
+		MaxReconnectInterval time.Duration
+	}{
+		mqttConnParams:       defaultMQTTConnParams(),
+		Format:               "json",
+		JSONNumber:           "preserve",
+		MinReconnectInterval: time.Second,
+		MaxReconnectInterval: time.Minute,
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+
+	opts, err := v.options()
+	if err != nil {
+		return nil, err
+	}
+	qos, err := mqttQoS(v.QoS)
+	if err != nil {
+		return nil, err
+	}
+	var topics data.Array
+	if v.Topics.Type() == data.TypeString {
+		topics = data.Array{v.Topics}
+	} else if topics, err = data.AsArray(v.Topics); err != nil {
+		return nil, errors.New("topics must be a string or an array of strings")
+	}
+	if len(topics) == 0 {
+		return nil, errors.New("topics must have at least one topic filter")
+	}
+	subs := make([]mqttSubscription, len(topics))
+	for i, t := range topics {
+		f, err := data.AsString(t)
+		if err != nil {
+			return nil, errors.New("topics must be a string or an array of strings")
+		}
+		if err := validateMQTTTopicFilter(f); err != nil {
+			return nil, err
+		}
+		subs[i] = mqttSubscription{Filter: f, QoS: qos}
+	}
+
+	format := strings.ToLower(v.Format)
+	switch format {
+	case "json", "jsonl", "msgpack", "raw":
+		if format == "jsonl" {
+			format = "json"
+		}
+	default:
+		return nil, fmt.Errorf("format must be one of json, msgpack, or raw: %v", v.Format)
+	}
+	numberPolicy, err := data.ParseJSONNumberPolicy(v.JSONNumber)
+	if err != nil {
+		return nil, fmt.Errorf("'json_number' parameter must be one of preserve, int, or float: %v", err)
+	}
+	r, err := newReconnector(ioParams, v.MinReconnectInterval, v.MaxReconnectInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return core.ImplementSourceStop(&mqttSource{
+		ioParams:     ioParams,
+		opts:         *opts,
+		subs:         subs,
+		format:       format,
+		numberPolicy: numberPolicy,
+		topicField:   v.TopicField,
+		reconnector:  r,
+	}), nil
+}
+
+// mqttSink publishes a message for each tuple. It connects to the broker on
+// the first write and reconnects on the next write after the connection is
+// lost. A write fails while the broker is unavailable, so retry parameters of
+// the sink should be used to retry writes.
+type mqttSink struct {
+	opts       mqttOptions
+	enc        TupleEncoder
+	topic      string
+	topicField data.Path
+	qos        byte
+	retain     bool
+
+	m      sync.Mutex
+	c      mqttClient
+	closed bool
+}
+
+func (s *mqttSink) Write(ctx *core.Context, t *core.Tuple) error {
+	topic := s.topic
+	if s.topicField != nil {
+		if v, err := t.Data.Get(s.topicField); err == nil {
+			if topic, err = data.AsString(v); err != nil {
+				return fmt.Errorf("the topic in the tuple must be a string: %v", err)
+			}
+		}
+	}
+	if topic == "" {
+		return errors.New("the tuple doesn't have a topic")
+	}
+	b, err := s.enc.Encode(t.Data)
+	if err != nil {
+		return err
+	}
+	msg := &mqttMessage{
+		Topic:   topic,
+		Payload: bytes.TrimSuffix(b, []byte("\n")),
+		QoS:     s.qos,
+		Retain:  s.retain,
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return errors.New("the sink is already closed")
+	}
+	if s.c != nil {
+		select {
+		case <-s.c.Done():
+			s.c.Close()
+			s.c = nil
+		default:
+		}
+	}
+	if s.c == nil {
+		c, err := dialMQTT(&s.opts, nil)
+		if err != nil {
+			return err
+		}
+		s.c = c
+	}
+	if err := s.c.Publish(msg); err != nil {
+		s.c.Close()
+		s.c = nil
+		return err
+	}
+	return nil
+}
+
+func (s *mqttSink) Close(ctx *core.Context) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.closed = true
+	if s.c == nil {
+		return nil
+	}
+	err := s.c.Close()
+	s.c = nil
+	return err
+}
+
+func createMQTTSink(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Sink, error) {
+	// "format" and parameters related to it are handled by the encoder
+	enc, err := NewTupleEncoder(params)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &struct {
+		mqttConnParams
+		Topic      string
+		TopicField string
+		QoS        int `bql:"qos"`
+		Retain     bool
+	}{
+		mqttConnParams: defaultMQTTConnParams(),
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+
+	opts, err := v.options()
+	if err != nil {
+		return nil, err
+	}
+	qos, err := mqttQoS(v.QoS)
+	if err != nil {
+		return nil, err
+	}
+	s := &mqttSink{
+		opts:   *opts,
+		enc:    enc,
+		topic:  v.Topic,
+		qos:    qos,
+		retain: v.Retain,
+	}
+	if v.Topic == "" && v.TopicField == "" {
+		return nil, errors.New("topic or topic_field must be given")
+	}
+	if v.Topic != "" {
+		if err := validateMQTTTopicName(v.Topic); err != nil {
+			return nil, err
+		}
+	}
+	if v.TopicField != "" {
+		if s.topicField, err = data.CompilePath(v.TopicField); err != nil {
+			return nil, fmt.Errorf("'topic_field' parameter doesn't have a valid path: %v", err)
+		}
+	}
+	return s, nil
+}
+
+func init() {
+	MustRegisterGlobalSourceCreator("mqtt", SourceCreatorFunc(createMQTTSource))
+	MustRegisterGlobalSinkCreator("mqtt", SinkCreatorFunc(createMQTTSink))
+}
@@ -0,0 +1,343 @@
+package bql
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/eclipse/paho.golang/packets"
+	paho5 "github.com/eclipse/paho.golang/paho"
+	paho3 "github.com/eclipse/paho.mqtt.golang"
+	"net"
+	"sync"
+	"time"
+)
+
+// mqttMessage is an application message received from or published to a
+// broker.
+type mqttMessage struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+// mqttSubscription is a topic filter to subscribe with the maximum QoS.
+type mqttSubscription struct {
+	Filter string
+	QoS    byte
+}
+
+// mqttOptions has parameters to connect to a broker.
+type mqttOptions struct {
+	// Address is the address of the broker in the form of "host:port".
+	Address string
+
+	// TLS enables TLS when it isn't nil.
+	TLS *tls.Config
+
+	// Version is the protocol level, either 4 for MQTT 3.1.1 or 5 for
+	// MQTT 5.0.
+	Version byte
+
+	// ClientID identifies the client. The broker assigns an ID when it's
+	// empty.
+	ClientID string
+
+	// Username and Password are sent when they're not empty.
+	Username string
+	Password string
+
+	// CleanSession discards the session on the broker when the client
+	// connects. It's Clean Start in MQTT 5.0.
+	CleanSession bool
+
+	// KeepAlive is the interval of PINGREQ. Keep alive is disabled when it's
+	// 0.
+	KeepAlive time.Duration
+
+	// Timeout is the maximum duration to wait for connecting to the broker
+	// and for acknowledgements from the broker. There's no timeout when it's
+	// 0.
+	Timeout time.Duration
+}
+
+// mqttClient is a connection to a broker. It doesn't reconnect by itself.
+// MQTT 3.1.1 is implemented by paho.mqtt.golang and MQTT 5.0 is implemented
+// by paho.golang.
+type mqttClient interface {
+	// Subscribe subscribes to topics. Messages are passed to the function
+	// given to dialMQTT.
+	Subscribe(subs []mqttSubscription) error
+
+	// Publish publishes a message and waits for the acknowledgement when
+	// the QoS is 1 or 2.
+	Publish(m *mqttMessage) error
+
+	// Done returns a channel closed when the connection is lost or closed.
+	Done() <-chan struct{}
+
+	// Err returns the reason why the connection was lost. It returns nil
+	// when the connection was closed by Close. It must be called after Done
+	// is closed.
+	Err() error
+
+	// Close disconnects from the broker.
+	Close() error
+}
+
+// dialMQTT connects to the broker. onMessage is called for each message
+// received in the order of arrival, and no other message is processed until
+// it returns. A message having QoS 1 or 2 is acknowledged after onMessage
+// returns. When it returns an error, the connection is lost with the error.
+// onMessage can be nil when the client doesn't subscribe to any topic.
+func dialMQTT(opts *mqttOptions, onMessage func(m *mqttMessage) error) (mqttClient, error) {
+	if onMessage == nil {
+		onMessage = func(m *mqttMessage) error {
+			return nil
+		}
+	}
+	if opts.Version == 5 {
+		return dialMQTT5(opts, onMessage)
+	}
+	return dialMQTT3(opts, onMessage)
+}
+
+// mqttConnState closes done once with the reason why the connection was
+// lost. It's shared by the implementations of mqttClient.
+type mqttConnState struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func newMQTTConnState() mqttConnState {
+	return mqttConnState{done: make(chan struct{})}
+}
+
+func (s *mqttConnState) finish(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
+
+func (s *mqttConnState) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *mqttConnState) Err() error {
+	return s.err
+}
+
+type mqtt3Client struct {
+	mqttConnState
+	c       paho3.Client
+	timeout time.Duration
+	handler paho3.MessageHandler
+}
+
+func dialMQTT3(opts *mqttOptions, onMessage func(m *mqttMessage) error) (mqttClient, error) {
+	c := &mqtt3Client{
+		mqttConnState: newMQTTConnState(),
+		timeout:       opts.Timeout,
+	}
+	c.handler = func(_ paho3.Client, m paho3.Message) {
+		err := onMessage(&mqttMessage{
+			Topic:   m.Topic(),
+			Payload: m.Payload(),
+			QoS:     m.Qos(),
+			Retain:  m.Retained(),
+		})
+		if err != nil {
+			c.finish(err)
+		}
+	}
+
+	scheme := "tcp"
+	if opts.TLS != nil {
+		scheme = "ssl"
+	}
+	o := paho3.NewClientOptions().
+		AddBroker(scheme + "://" + opts.Address).
+		SetTLSConfig(opts.TLS).
+		SetProtocolVersion(4).
+		SetClientID(opts.ClientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetCleanSession(opts.CleanSession).
+		SetKeepAlive(opts.KeepAlive).
+		SetConnectTimeout(opts.Timeout).
+		SetWriteTimeout(opts.Timeout).
+		SetOrderMatters(true).
+		SetAutoReconnect(false).
+		SetConnectionLostHandler(func(_ paho3.Client, err error) {
+			c.finish(err)
+		})
+	c.c = paho3.NewClient(o)
+	if err := c.wait(c.c.Connect()); err != nil {
+		c.c.Disconnect(0)
+		return nil, err
+	}
+	return c, nil
+}
+
+// wait waits for the token to complete within the timeout.
+func (c *mqtt3Client) wait(t paho3.Token) error {
+	if c.timeout <= 0 {
+		t.Wait()
+	} else if !t.WaitTimeout(c.timeout) {
+		return errors.New("timed out waiting for the response from the MQTT broker")
+	}
+	return t.Error()
+}
+
+func (c *mqtt3Client) Subscribe(subs []mqttSubscription) error {
+	filters := make(map[string]byte, len(subs))
+	for _, s := range subs {
+		filters[s.Filter] = s.QoS
+	}
+	t := c.c.SubscribeMultiple(filters, c.handler)
+	if err := c.wait(t); err != nil {
+		return err
+	}
+	for f, code := range t.(*paho3.SubscribeToken).Result() {
+		if code >= 0x80 {
+			return fmt.Errorf("the MQTT broker rejected the subscription to %v", f)
+		}
+	}
+	return nil
+}
+
+func (c *mqtt3Client) Publish(m *mqttMessage) error {
+	return c.wait(c.c.Publish(m.Topic, m.QoS, m.Retain, m.Payload))
+}
+
+func (c *mqtt3Client) Close() error {
+	c.finish(nil)
+	c.c.Disconnect(0)
+	return nil
+}
+
+type mqtt5Client struct {
+	mqttConnState
+	c       *paho5.Client
+	timeout time.Duration
+}
+
+func dialMQTT5(opts *mqttOptions, onMessage func(m *mqttMessage) error) (mqttClient, error) {
+	d := &net.Dialer{Timeout: opts.Timeout}
+	var conn net.Conn
+	var err error
+	if opts.TLS != nil {
+		conn, err = tls.DialWithDialer(d, "tcp", opts.Address, opts.TLS)
+	} else {
+		conn, err = d.Dial("tcp", opts.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &mqtt5Client{
+		mqttConnState: newMQTTConnState(),
+		timeout:       opts.Timeout,
+	}
+	c.c = paho5.NewClient(paho5.ClientConfig{
+		Conn: packets.NewThreadSafeConn(conn),
+		OnPublishReceived: []func(paho5.PublishReceived) (bool, error){
+			func(r paho5.PublishReceived) (bool, error) {
+				err := onMessage(&mqttMessage{
+					Topic:   r.Packet.Topic,
+					Payload: r.Packet.Payload,
+					QoS:     r.Packet.QoS,
+					Retain:  r.Packet.Retain,
+				})
+				if err != nil {
+					c.finish(err)
+				}
+				return true, nil
+			},
+		},
+		OnClientError: func(err error) {
+			c.finish(err)
+		},
+		OnServerDisconnect: func(d *paho5.Disconnect) {
+			c.finish(fmt.Errorf("the MQTT broker closed the connection with reason code %v", d.ReasonCode))
+		},
+	})
+
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err = c.c.Connect(ctx, &paho5.Connect{
+		ClientID:     opts.ClientID,
+		CleanStart:   opts.CleanSession,
+		KeepAlive:    uint16(opts.KeepAlive / time.Second),
+		Username:     opts.Username,
+		UsernameFlag: opts.Username != "",
+		Password:     []byte(opts.Password),
+		PasswordFlag: opts.Password != "",
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go func() {
+		<-c.c.Done()
+		c.finish(errors.New("the connection to the MQTT broker was closed"))
+	}()
+	return c, nil
+}
+
+// context returns a context having the timeout of the client.
+func (c *mqtt5Client) context() (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), c.timeout)
+}
+
+func (c *mqtt5Client) Subscribe(subs []mqttSubscription) error {
+	s := &paho5.Subscribe{}
+	for _, sub := range subs {
+		s.Subscriptions = append(s.Subscriptions, paho5.SubscribeOptions{
+			Topic: sub.Filter,
+			QoS:   sub.QoS,
+		})
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	sa, err := c.c.Subscribe(ctx, s)
+	if err != nil {
+		return err
+	}
+	for i, code := range sa.Reasons {
+		if code >= 0x80 && i < len(subs) {
+			return fmt.Errorf("the MQTT broker rejected the subscription to %v with reason code %v",
+				subs[i].Filter, code)
+		}
+	}
+	return nil
+}
+
+func (c *mqtt5Client) Publish(m *mqttMessage) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.c.Publish(ctx, &paho5.Publish{
+		Topic:   m.Topic,
+		Payload: m.Payload,
+		QoS:     m.QoS,
+		Retain:  m.Retain,
+	})
+	return err
+}
+
+func (c *mqtt5Client) Close() error {
+	select {
+	case <-c.Done():
+		// the connection is already lost
+		return nil
+	default:
+	}
+	c.finish(nil)
+	return c.c.Disconnect(&paho5.Disconnect{ReasonCode: 0})
+}
@@ -0,0 +1,495 @@
+package bql
+
+import (
+	"bytes"
+	"errors"
+	mqttserver "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testMQTTBroker runs an embedded MQTT broker for tests. It records messages
+// published by clients and the number of connections. When Username is
+// given, clients have to connect with Username and Password.
+type testMQTTBroker struct {
+	mqttserver.HookBase
+	s    *mqttserver.Server
+	addr string
+
+	Username string
+	Password string
+
+	m         sync.Mutex
+	published []*mqttMessage
+	connects  int
+}
+
+func newTestMQTTBroker() (*testMQTTBroker, error) {
+	b := &testMQTTBroker{}
+	b.s = mqttserver.New(&mqttserver.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(ioutil.Discard, nil)),
+	})
+	if err := b.s.AddHook(b, nil); err != nil {
+		return nil, err
+	}
+	l := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	if err := b.s.AddListener(l); err != nil {
+		return nil, err
+	}
+	if err := b.s.Serve(); err != nil {
+		return nil, err
+	}
+	b.addr = l.Address()
+	return b, nil
+}
+
+func (b *testMQTTBroker) ID() string {
+	return "sensorbee_test"
+}
+
+func (b *testMQTTBroker) Provides(h byte) bool {
+	return bytes.Contains([]byte{
+		mqttserver.OnConnectAuthenticate,
+		mqttserver.OnACLCheck,
+		mqttserver.OnConnect,
+		mqttserver.OnPublished,
+	}, []byte{h})
+}
+
+func (b *testMQTTBroker) OnConnectAuthenticate(cl *mqttserver.Client, pk packets.Packet) bool {
+	if b.Username == "" {
+		return true
+	}
+	return string(pk.Connect.Username) == b.Username && string(pk.Connect.Password) == b.Password
+}
+
+func (b *testMQTTBroker) OnACLCheck(cl *mqttserver.Client, topic string, write bool) bool {
+	return true
+}
+
+func (b *testMQTTBroker) OnConnect(cl *mqttserver.Client, pk packets.Packet) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.connects++
+	return nil
+}
+
+func (b *testMQTTBroker) OnPublished(cl *mqttserver.Client, pk packets.Packet) {
+	if cl.Net.Inline {
+		return // published by the test
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.published = append(b.published, &mqttMessage{
+		Topic:   pk.TopicName,
+		Payload: append([]byte{}, pk.Payload...),
+		QoS:     pk.FixedHeader.Qos,
+		Retain:  pk.FixedHeader.Retain,
+	})
+}
+
+// Addr returns the address of the broker in the form of "host:port".
+func (b *testMQTTBroker) Addr() string {
+	return b.addr
+}
+
+// Publish publishes a message to subscribers.
+func (b *testMQTTBroker) Publish(m *mqttMessage) {
+	b.s.Publish(m.Topic, m.Payload, m.Retain, m.QoS)
+}
+
+// Published returns messages published by clients.
+func (b *testMQTTBroker) Published() []*mqttMessage {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return append([]*mqttMessage{}, b.published...)
+}
+
+// Connects returns the number of connections accepted so far.
+func (b *testMQTTBroker) Connects() int {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.connects
+}
+
+// DisconnectAll closes the connections of all clients.
+func (b *testMQTTBroker) DisconnectAll() {
+	for _, cl := range b.s.Clients.GetAll() {
+		if !cl.Net.Inline {
+			cl.Stop(errors.New("disconnected by the test"))
+		}
+	}
+}
+
+func (b *testMQTTBroker) Close() {
+	b.s.Close()
+}
+
+// publishUntil keeps publishing a message until the writer receives n tuples
+// because the source might not have subscribed to the topic yet. It returns
+// the received tuples or nil on timeout.
+func publishUntil(b *testMQTTBroker, m *mqttMessage, w *testFileWriter, n int) []data.Map {
+	for i := 0; i < 500; i++ {
+		w.m.Lock()
+		ds := append([]data.Map{}, w.ds...)
+		w.m.Unlock()
+		if len(ds) >= n {
+			return ds
+		}
+		b.Publish(m)
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestMQTTSource(t *testing.T) {
+	Convey("Given an MQTT broker", t, func() {
+		b, err := newTestMQTTBroker()
+		So(err, ShouldBeNil)
+		Reset(b.Close)
+
+		ctx := core.NewContext(nil)
+		params := data.Map{
+			"broker": data.String("tcp://" + b.Addr()),
+			"topics": data.String("sensors/+/temp"),
+		}
+		w := &testFileWriter{}
+		w.c = sync.NewCond(&w.m)
+
+		run := func() core.Source {
+			s, err := createMQTTSource(ctx, &IOParams{Name: "mqtt_test"}, params)
+			So(err, ShouldBeNil)
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, w)
+			}()
+			Reset(func() {
+				s.Stop(ctx)
+				<-ch
+			})
+			return s
+		}
+
+		for _, v := range []string{"3.1.1", "5"} {
+			v := v
+			Convey("When subscribing to topics with protocol version "+v, func() {
+				params["protocol_version"] = data.String(v)
+				params["topic_field"] = data.String("topic")
+				params["qos"] = data.Int(1)
+				run()
+
+				Convey("Then it should emit a tuple for each message", func() {
+					ds := publishUntil(b, &mqttMessage{
+						Topic:   "sensors/1/temp",
+						Payload: []byte(`{"v":1.5}`),
+						QoS:     1,
+					}, w, 1)
+					So(ds, ShouldNotBeEmpty)
+					So(ds[0]["v"], ShouldEqual, data.Float(1.5))
+					So(ds[0]["topic"], ShouldEqual, data.String("sensors/1/temp"))
+				})
+			})
+		}
+
+		Convey("When subscribing with raw format", func() {
+			params["format"] = data.String("raw")
+			run()
+
+			Convey("Then it should emit the payload as a blob", func() {
+				ds := publishUntil(b, &mqttMessage{Topic: "sensors/1/temp", Payload: []byte("abc")}, w, 1)
+				So(ds, ShouldNotBeEmpty)
+				So(ds[0], ShouldResemble, data.Map{"payload": data.Blob("abc")})
+			})
+		})
+
+		Convey("When subscribing with msgpack format", func() {
+			params["format"] = data.String("msgpack")
+			params["topics"] = data.Array{data.String("a"), data.String("sensors/#")}
+			run()
+
+			Convey("Then it should decode the payload", func() {
+				p, err := data.MarshalMsgpack(data.Map{"v": data.Int(1)})
+				So(err, ShouldBeNil)
+				ds := publishUntil(b, &mqttMessage{Topic: "sensors/1/temp", Payload: p}, w, 1)
+				So(ds, ShouldNotBeEmpty)
+				So(ds[0], ShouldResemble, data.Map{"v": data.Int(1)})
+			})
+		})
+
+		Convey("When receiving an invalid message", func() {
+			run()
+			So(publishUntil(b, &mqttMessage{Topic: "sensors/1/temp", Payload: []byte(`{"v":1}`)}, w, 1), ShouldNotBeEmpty)
+			b.Publish(&mqttMessage{Topic: "sensors/1/temp", Payload: []byte("invalid")})
+			b.Publish(&mqttMessage{Topic: "sensors/1/temp", Payload: []byte(`{"v":2}`)})
+
+			Convey("Then it should be skipped", func() {
+				ds := publishUntil(b, &mqttMessage{Topic: "sensors/1/temp", Payload: []byte(`{"v":2}`)}, w, 3)
+				So(ds, ShouldNotBeEmpty)
+				So(ds[len(ds)-1]["v"], ShouldEqual, data.Int(2))
+			})
+		})
+
+		Convey("When the broker closes the connection", func() {
+			params["min_reconnect_interval"] = data.String("10ms")
+			s := run()
+			So(publishUntil(b, &mqttMessage{Topic: "sensors/1/temp", Payload: []byte(`{}`)}, w, 1), ShouldNotBeEmpty)
+			b.DisconnectAll()
+
+			Convey("Then the source should reconnect", func() {
+				So(publishUntil(b, &mqttMessage{Topic: "sensors/1/temp", Payload: []byte(`{}`)}, w, 2), ShouldNotBeEmpty)
+				So(b.Connects(), ShouldBeGreaterThanOrEqualTo, 2)
+
+				st := s.(core.Statuser).Status()["internal_source"].(data.Map)
+				So(st["reconnects"], ShouldBeGreaterThanOrEqualTo, data.Int(1))
+			})
+		})
+	})
+
+	Convey("Given an address nobody listens", t, func() {
+		b, err := newTestMQTTBroker()
+		So(err, ShouldBeNil)
+		addr := b.Addr()
+		b.Close()
+
+		ctx := core.NewContext(nil)
+		params := data.Map{
+			"broker": data.String(addr),
+			"topics": data.String("a"),
+		}
+
+		Convey("When running the source", func() {
+			s, err := createMQTTSource(ctx, &IOParams{Name: "mqtt_test"}, params)
+			So(err, ShouldBeNil)
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, &testFileWriter{})
+			}()
+
+			Convey("Then it should keep retrying until stopped", func() {
+				select {
+				case <-ch:
+					So("returned", ShouldBeNil)
+				case <-time.After(100 * time.Millisecond):
+				}
+				So(s.Stop(ctx), ShouldBeNil)
+				So(<-ch, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given invalid parameters", t, func() {
+		ctx := core.NewContext(nil)
+		cases := map[string]data.Map{
+			"missing broker":   {"topics": data.String("a")},
+			"missing topics":   {"broker": data.String("localhost")},
+			"empty topics":     {"broker": data.String("localhost"), "topics": data.Array{}},
+			"invalid filter":   {"broker": data.String("localhost"), "topics": data.String("a/#/b")},
+			"invalid qos":      {"broker": data.String("localhost"), "topics": data.String("a"), "qos": data.Int(3)},
+			"invalid scheme":   {"broker": data.String("http://localhost"), "topics": data.String("a")},
+			"invalid version":  {"broker": data.String("localhost"), "topics": data.String("a"), "protocol_version": data.String("3")},
+			"invalid format":   {"broker": data.String("localhost"), "topics": data.String("a"), "format": data.String("csv")},
+			"missing ca_file":  {"broker": data.String("ssl://localhost"), "topics": data.String("a"), "ca_file": data.String("/no/such/file")},
+			"missing key_file": {"broker": data.String("localhost"), "topics": data.String("a"), "cert_file": data.String("cert.pem")},
+			"persistent session without client_id": {
+				"broker": data.String("localhost"), "topics": data.String("a"), "clean_session": data.False,
+			},
+		}
+		for name, params := range cases {
+			params := params
+			Convey("When creating a source with "+name, func() {
+				_, err := createMQTTSource(ctx, &IOParams{}, params)
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
+
+func TestParseMQTTBroker(t *testing.T) {
+	Convey("Given broker addresses", t, func() {
+		cases := []struct {
+			broker string
+			tls    bool
+			addr   string
+		}{
+			{"localhost", false, "localhost:1883"},
+			{"localhost:1884", false, "localhost:1884"},
+			{"tcp://localhost", false, "localhost:1883"},
+			{"mqtt://localhost:1000", false, "localhost:1000"},
+			{"ssl://example.com", true, "example.com:8883"},
+			{"mqtts://example.com:9000", true, "example.com:9000"},
+			{"tls://[::1]", true, "[::1]:8883"},
+		}
+		for _, c := range cases {
+			c := c
+			Convey("When parsing "+c.broker, func() {
+				useTLS, addr, err := parseMQTTBroker(c.broker)
+				So(err, ShouldBeNil)
+
+				Convey("Then it should return the right address", func() {
+					So(useTLS, ShouldEqual, c.tls)
+					So(addr, ShouldEqual, c.addr)
+				})
+			})
+		}
+	})
+}
+
+func TestMQTTSink(t *testing.T) {
+	Convey("Given an MQTT broker", t, func() {
+		b, err := newTestMQTTBroker()
+		So(err, ShouldBeNil)
+		b.Username, b.Password = "user", "pass"
+		Reset(b.Close)
+
+		ctx := core.NewContext(nil)
+		params := data.Map{
+			"broker":   data.String(b.Addr()),
+			"username": data.String("user"),
+			"password": data.String("pass"),
+		}
+
+		Convey("When writing tuples to a fixed topic", func() {
+			params["topic"] = data.String("out")
+			params["qos"] = data.Int(2)
+			params["retain"] = data.True
+			s, err := createMQTTSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+			So(s.Write(ctx, core.NewTuple(data.Map{"v": data.Int(1)})), ShouldBeNil)
+			So(s.Write(ctx, core.NewTuple(data.Map{"v": data.Int(2)})), ShouldBeNil)
+
+			Convey("Then the broker should receive them", func() {
+				ms := b.Published()
+				So(len(ms), ShouldEqual, 2)
+				So(ms[0].Topic, ShouldEqual, "out")
+				So(string(ms[0].Payload), ShouldEqual, `{"v":1}`)
+				So(ms[0].QoS, ShouldEqual, 2)
+				So(ms[0].Retain, ShouldBeTrue)
+				So(string(ms[1].Payload), ShouldEqual, `{"v":2}`)
+			})
+
+			Convey("Then it should reconnect after the connection is lost", func() {
+				b.DisconnectAll()
+				var err error
+				for i := 0; i < 100; i++ {
+					if err = s.Write(ctx, core.NewTuple(data.Map{"v": data.Int(3)})); err == nil {
+						break
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+				So(err, ShouldBeNil)
+				So(b.Connects(), ShouldEqual, 2)
+			})
+
+			Convey("Then it should fail to write after closed", func() {
+				So(s.Close(ctx), ShouldBeNil)
+				So(s.Write(ctx, core.NewTuple(data.Map{})), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When writing tuples with topic_field and msgpack format", func() {
+			params["topic_field"] = data.String("dest")
+			params["format"] = data.String("msgpack")
+			params["protocol_version"] = data.Int(5)
+			params["qos"] = data.Int(1)
+			s, err := createMQTTSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+
+			Convey("Then the topic should be taken from the tuple", func() {
+				d := data.Map{"dest": data.String("a/b"), "v": data.Int(1)}
+				So(s.Write(ctx, core.NewTuple(d)), ShouldBeNil)
+				ms := b.Published()
+				So(len(ms), ShouldEqual, 1)
+				So(ms[0].Topic, ShouldEqual, "a/b")
+				m, err := data.UnmarshalMsgpack(ms[0].Payload)
+				So(err, ShouldBeNil)
+				So(m, ShouldResemble, d)
+			})
+
+			Convey("Then a tuple without a topic should fail", func() {
+				So(s.Write(ctx, core.NewTuple(data.Map{"v": data.Int(1)})), ShouldNotBeNil)
+				So(s.Write(ctx, core.NewTuple(data.Map{"dest": data.Int(1)})), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When writing with a wrong password", func() {
+			params["topic"] = data.String("out")
+			params["password"] = data.String("wrong")
+			s, err := createMQTTSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+
+			Convey("Then it should fail", func() {
+				So(s.Write(ctx, core.NewTuple(data.Map{})), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When creating a sink without a topic", func() {
+			_, err := createMQTTSink(ctx, &IOParams{}, params)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When creating a sink with an invalid topic", func() {
+			params["topic"] = data.String("a/+")
+			_, err := createMQTTSink(ctx, &IOParams{}, params)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestValidateMQTTTopic(t *testing.T) {
+	Convey("Given valid topic filters", t, func() {
+		for _, f := range []string{"a/b", "a/+", "a/+/c", "+/+", "a/#", "#", "$SYS/#"} {
+			Convey("When validating "+f, func() {
+				Convey("Then it should succeed", func() {
+					So(validateMQTTTopicFilter(f), ShouldBeNil)
+				})
+			})
+		}
+	})
+
+	Convey("Given invalid topic filters", t, func() {
+		for _, f := range []string{"", "a/#/b", "a#", "a/b+", "a\x00"} {
+			Convey("When validating "+f, func() {
+				Convey("Then it should fail", func() {
+					So(validateMQTTTopicFilter(f), ShouldNotBeNil)
+				})
+			})
+		}
+	})
+
+	Convey("Given invalid topic names", t, func() {
+		for _, n := range []string{"", "a/+", "a/#"} {
+			Convey("When validating "+n, func() {
+				Convey("Then it should fail", func() {
+					So(validateMQTTTopicName(n), ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
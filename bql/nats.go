@@ -0,0 +1,687 @@
+package bql
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// natsConnParams has parameters shared by the NATS source and sink to connect
+// to a server.
+type natsConnParams struct {
+	// URL is the URL of the server such as "nats://localhost:4222". It can
+	// have multiple URLs separated by commas.
+	URL            string
+	Username       string
+	Password       string
+	Token          string
+	ConnectTimeout time.Duration
+	ReconnectWait  time.Duration
+}
+
+func defaultNATSConnParams() natsConnParams {
+	return natsConnParams{
+		URL:            nats.DefaultURL,
+		ConnectTimeout: 10 * time.Second,
+		ReconnectWait:  2 * time.Second,
+	}
+}
+
+func (p *natsConnParams) validate() error {
+	if p.URL == "" {
+		return errors.New("url must not be empty")
+	}
+	if p.ConnectTimeout <= 0 {
+		return errors.New("connect_timeout must be positive")
+	}
+	if p.ReconnectWait <= 0 {
+		return errors.New("reconnect_wait must be positive")
+	}
+	if p.Token != "" && p.Username != "" {
+		return errors.New("token and username cannot be given together")
+	}
+	return nil
+}
+
+// connect connects to the server. The connection automatically reconnects to
+// the server after it's established.
+func (p *natsConnParams) connect() (*nats.Conn, error) {
+	opts := []nats.Option{
+		nats.Timeout(p.ConnectTimeout),
+		nats.ReconnectWait(p.ReconnectWait),
+		nats.MaxReconnects(-1),
+	}
+	if p.Username != "" {
+		opts = append(opts, nats.UserInfo(p.Username, p.Password))
+	}
+	if p.Token != "" {
+		opts = append(opts, nats.Token(p.Token))
+	}
+	return nats.Connect(p.URL, opts...)
+}
+
+// errNATSRewound is returned from the writer of natsSource when the source is
+// rewound.
+var errNATSRewound = errors.New("the source has been rewound")
+
+// natsSource subscribes to a subject of NATS, or consumes a JetStream stream,
+// and emits a tuple for each message.
+//
+// When a durable consumer is used with JetStream, a message is acknowledged
+// after the tuple is successfully written to the destination. Otherwise, an
+// ordered consumer, which doesn't need acknowledgements, is used.
+//
+// natsSource implements core.RewindableSource by itself like tailSource when
+// it's rewindable. Rewinding the source replays the stream from the beginning.
+type natsSource struct {
+	ioParams      *IOParams
+	conn          natsConnParams
+	subject       string
+	queue         string
+	stream        string
+	durable       string
+	deliver       jetstream.DeliverPolicy
+	ackWait       time.Duration
+	maxAckPending int
+	format        string
+	numberPolicy  data.JSONNumberPolicy
+	subjectField  string
+	*reconnector
+
+	// resumeCh is non-nil while the source is paused and closed when it's
+	// resumed. It's protected by pauseMutex.
+	pauseMutex sync.Mutex
+	resumeCh   chan struct{}
+
+	// rewinding is 1 when Rewind is called and GenerateStream hasn't handled
+	// it yet. rewindCh wakes up GenerateStream waiting for new messages.
+	rewinding int32
+	rewindCh  chan struct{}
+
+	m       sync.Mutex
+	lastSeq uint64
+}
+
+var _ core.RewindableSource = &natsSource{}
+
+func (s *natsSource) GenerateStream(ctx *core.Context, w core.Writer) error {
+	writer := core.WriterFunc(func(ctx *core.Context, t *core.Tuple) error {
+		if err := s.waitForResume(); err != nil {
+			return err
+		}
+		return w.Write(ctx, t)
+	})
+
+	err := s.run(ctx, "Cannot receive messages from NATS", func() (bool, error) {
+		for {
+			connected, err := s.connect(ctx, writer)
+			if err != errNATSRewound {
+				return connected, err
+			}
+		}
+	})
+	if err == core.ErrSourceStopped {
+		// This is returned from the writer when the source is wrapped by
+		// core.ImplementSourceStop.
+		return nil
+	}
+	return err
+}
+
+// connect connects to the server and emits tuples until an error occurs or
+// the source is stopped. The connection reconnects to the server by itself
+// once it's established.
+func (s *natsSource) connect(ctx *core.Context, w core.Writer) (bool, error) {
+	nc, err := s.conn.connect()
+	if err != nil {
+		return false, err
+	}
+	defer nc.Close()
+
+	s.setConnected(true)
+	defer s.setConnected(false)
+	if s.stream == "" {
+		return true, s.subscribe(ctx, w, nc)
+	}
+	return true, s.consume(ctx, w, nc)
+}
+
+// subscribe emits messages published to the subject.
+func (s *natsSource) subscribe(ctx *core.Context, w core.Writer, nc *nats.Conn) error {
+	ch := make(chan *nats.Msg, 1024)
+	var (
+		sub *nats.Subscription
+		err error
+	)
+	if s.queue == "" {
+		sub, err = nc.ChanSubscribe(s.subject, ch)
+	} else {
+		sub, err = nc.ChanQueueSubscribe(s.subject, s.queue, ch)
+	}
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return nil
+		case m := <-ch:
+			t, err := s.toTuple(m.Data, m.Subject, time.Time{})
+			if err != nil {
+				s.logParseError(ctx, err, m.Subject)
+				continue
+			}
+			if err := w.Write(ctx, t); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// consume emits messages in the JetStream stream. It replays the stream from
+// the beginning when the source is rewound.
+func (s *natsSource) consume(ctx *core.Context, w core.Writer, nc *nats.Conn) error {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return err
+	}
+	replay := false
+	if atomic.CompareAndSwapInt32(&s.rewinding, 1, 0) {
+		replay = true
+	}
+	cons, err := s.consumer(js, replay)
+	if err != nil {
+		return err
+	}
+	it, err := cons.Messages()
+	if err != nil {
+		return err
+	}
+	defer it.Stop()
+
+	// Stopping the iterator interrupts Next.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-s.stopCh:
+				it.Stop()
+				return
+			case <-s.rewindCh:
+				// The signal can be the one already handled above.
+				if atomic.LoadInt32(&s.rewinding) != 0 {
+					it.Stop()
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		m, err := it.Next()
+		if err != nil {
+			select {
+			case <-s.stopCh:
+				return nil
+			default:
+			}
+			if atomic.LoadInt32(&s.rewinding) != 0 {
+				return errNATSRewound
+			}
+			return err
+		}
+
+		md, err := m.Metadata()
+		if err != nil {
+			return err
+		}
+		t, err := s.toTuple(m.Data(), m.Subject(), md.Timestamp)
+		if err != nil {
+			s.logParseError(ctx, err, m.Subject())
+			if s.durable != "" {
+				m.Term() // a broken message won't be redelivered
+			}
+			continue
+		}
+		if err := w.Write(ctx, t); err != nil {
+			if s.durable != "" {
+				m.Nak()
+			}
+			return err
+		}
+		if s.durable != "" {
+			if err := m.Ack(); err != nil {
+				return err
+			}
+		}
+		s.m.Lock()
+		s.lastSeq = md.Sequence.Stream
+		s.m.Unlock()
+	}
+}
+
+// consumer creates a consumer of the stream. When replay is true, the
+// consumer delivers all messages in the stream. A durable consumer is
+// recreated to replay the stream because the position of an existing
+// consumer cannot be changed.
+func (s *natsSource) consumer(js jetstream.JetStream, replay bool) (jetstream.Consumer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.conn.ConnectTimeout)
+	defer cancel()
+
+	s.m.Lock()
+	if replay {
+		s.lastSeq = 0
+	}
+	lastSeq := s.lastSeq
+	s.m.Unlock()
+
+	deliver := s.deliver
+	if replay {
+		deliver = jetstream.DeliverAllPolicy
+	}
+	if s.durable == "" {
+		// An ordered consumer doesn't have a position in the server, so it
+		// resumes from the last message after reconnection.
+		cfg := jetstream.OrderedConsumerConfig{
+			FilterSubjects: s.filterSubjects(),
+			DeliverPolicy:  deliver,
+		}
+		if lastSeq > 0 {
+			cfg.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+			cfg.OptStartSeq = lastSeq + 1
+		}
+		return js.OrderedConsumer(ctx, s.stream, cfg)
+	}
+
+	if replay {
+		if err := js.DeleteConsumer(ctx, s.stream, s.durable); err != nil && !errors.Is(err, jetstream.ErrConsumerNotFound) {
+			return nil, err
+		}
+	}
+	return js.CreateOrUpdateConsumer(ctx, s.stream, jetstream.ConsumerConfig{
+		Durable:       s.durable,
+		FilterSubject: s.subject,
+		DeliverPolicy: deliver,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       s.ackWait,
+		MaxAckPending: s.maxAckPending,
+	})
+}
+
+func (s *natsSource) filterSubjects() []string {
+	if s.subject == "" {
+		return nil
+	}
+	return []string{s.subject}
+}
+
+func (s *natsSource) logParseError(ctx *core.Context, err error, subject string) {
+	ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
+		WithField("subject", subject).Warning("Ignoring the message due to a parse error")
+}
+
+func (s *natsSource) toTuple(b []byte, subject string, ts time.Time) (*core.Tuple, error) {
+	var d data.Map
+	switch s.format {
+	case "json":
+		var err error
+		if d, err = data.UnmarshalJSONMap(b, s.numberPolicy); err != nil {
+			return nil, err
+		}
+	case "msgpack":
+		var err error
+		if d, err = data.UnmarshalMsgpack(b); err != nil {
+			return nil, err
+		}
+	default: // raw
+		d = data.Map{"payload": data.Blob(b)}
+	}
+	if s.subjectField != "" {
+		d[s.subjectField] = data.String(subject)
+	}
+	t := core.NewTuple(d)
+	if !ts.IsZero() {
+		t.Timestamp = ts
+	}
+	return t, nil
+}
+
+// waitForResume blocks while the source is paused. It returns an error when
+// the source is stopped or rewound.
+func (s *natsSource) waitForResume() error {
+	for {
+		if atomic.LoadInt32(&s.rewinding) != 0 {
+			return errNATSRewound
+		}
+		s.pauseMutex.Lock()
+		ch := s.resumeCh
+		s.pauseMutex.Unlock()
+		if ch == nil {
+			return nil
+		}
+
+		select {
+		case <-ch:
+		case <-s.rewindCh:
+		case <-s.stopCh:
+			return core.ErrSourceStopped
+		}
+	}
+}
+
+func (s *natsSource) Pause(ctx *core.Context) error {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+	if s.resumeCh == nil {
+		s.resumeCh = make(chan struct{})
+	}
+	return nil
+}
+
+func (s *natsSource) Resume(ctx *core.Context) error {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+	if s.resumeCh != nil {
+		close(s.resumeCh)
+		s.resumeCh = nil
+	}
+	return nil
+}
+
+func (s *natsSource) Rewind(ctx *core.Context) error {
+	atomic.StoreInt32(&s.rewinding, 1)
+	select {
+	case s.rewindCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *natsSource) Stop(ctx *core.Context) error {
+	close(s.stopCh)
+	return nil
+}
+
+func (s *natsSource) Status() data.Map {
+	st := s.status()
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.stream != "" {
+		st["last_sequence"] = data.Int(s.lastSeq)
+	}
+	return st
+}
+
+// createNATSSource creates a nats source. It accepts following parameters in
+// addition to natsConnParams:
+//
+//   - subject: the subject to subscribe to, which can have wildcards. It's
+//     required unless stream is given, in which case it filters messages
+//     in the stream.
+//   - queue: the name of the queue group. It can only be used without
+//     stream.
+//   - stream: the name of the JetStream stream to consume
+//   - durable: the name of the durable consumer of the stream. Messages are
+//     acknowledged after they're processed. An ordered consumer is used
+//     when it's omitted.
+//   - deliver: the position in the stream from which messages are delivered:
+//     all (default), new, or last. It's ignored when the durable consumer
+//     already exists.
+//   - ack_wait: the time the server waits for an acknowledgement before
+//     redelivering the message (default: 30s)
+//   - max_ack_pending: the maximum number of unacknowledged messages
+//     (default: 1000)
+//   - format: json (default), msgpack, or raw. A raw message is emitted as
+//     {"payload": blob}.
+//   - json_number: how numbers in JSON are decoded (default: preserve)
+//   - subject_field: the name of the field to which the subject of the
+//     message is added
+//   - rewindable: true to make the source rewindable. It requires stream.
+//   - min_reconnect_interval, max_reconnect_interval: the range of the
+//     interval of retries when the source cannot connect to the server
+//     (default: 1s, 1m)
+//
+// The timestamp of a tuple is the time when the message is stored in the
+// stream when stream is given.
+func createNATSSource(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Source, error) {
+	v := &struct {
+		natsConnParams
+		Subject              string
+		Queue                string
+		Stream               string
+		Durable              string
+		Deliver              string
+		AckWait              time.Duration
+		MaxAckPending        int
+		Format               string
+		JSONNumber           string
+		SubjectField         string
+		Rewindable           bool
+		MinReconnectInterval time.Duration
+		MaxReconnectInterval time.Duration
+	}{
+		natsConnParams:       defaultNATSConnParams(),
+		Deliver:              "all",
+		AckWait:              30 * time.Second,
+		MaxAckPending:        1000,
+		Format:               "json",
+		JSONNumber:           "preserve",
+		MinReconnectInterval: time.Second,
+		MaxReconnectInterval: time.Minute,
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+	if err := v.validate(); err != nil {
+		return nil, err
+	}
+
+	s := &natsSource{
+		ioParams:      ioParams,
+		conn:          v.natsConnParams,
+		subject:       v.Subject,
+		queue:         v.Queue,
+		stream:        v.Stream,
+		durable:       v.Durable,
+		ackWait:       v.AckWait,
+		maxAckPending: v.MaxAckPending,
+		subjectField:  v.SubjectField,
+		rewindCh:      make(chan struct{}, 1),
+	}
+	if v.Stream == "" {
+		if v.Subject == "" {
+			return nil, errors.New("subject or stream must be given")
+		}
+		if v.Durable != "" {
+			return nil, errors.New("durable requires stream")
+		}
+		if v.Rewindable {
+			return nil, errors.New("rewindable requires stream")
+		}
+	} else if v.Queue != "" {
+		return nil, errors.New("queue cannot be used with stream")
+	}
+
+	switch strings.ToLower(v.Deliver) {
+	case "all":
+		s.deliver = jetstream.DeliverAllPolicy
+	case "new":
+		s.deliver = jetstream.DeliverNewPolicy
+	case "last":
+		s.deliver = jetstream.DeliverLastPolicy
+	default:
+		return nil, fmt.Errorf("deliver must be one of all, new, or last: %v", v.Deliver)
+	}
+	if v.AckWait <= 0 {
+		return nil, fmt.Errorf("ack_wait must be positive: %v", v.AckWait)
+	}
+	if v.MaxAckPending <= 0 {
+		return nil, fmt.Errorf("max_ack_pending must be positive: %v", v.MaxAckPending)
+	}
+
+	s.format = strings.ToLower(v.Format)
+	switch s.format {
+	case "json", "msgpack", "raw":
+	default:
+		return nil, fmt.Errorf("format must be one of json, msgpack, or raw: %v", v.Format)
+	}
+	numberPolicy, err := data.ParseJSONNumberPolicy(v.JSONNumber)
+	if err != nil {
+		return nil, fmt.Errorf("'json_number' parameter must be one of preserve, int, or float: %v", err)
+	}
+	s.numberPolicy = numberPolicy
+	r, err := newReconnector(ioParams, v.MinReconnectInterval, v.MaxReconnectInterval)
+	if err != nil {
+		return nil, err
+	}
+	s.reconnector = r
+
+	if v.Rewindable {
+		return s, nil
+	}
+	return core.ImplementSourceStop(s), nil
+}
+
+// natsSink publishes a message for each tuple. It connects to the server on
+// the first write, and the connection reconnects to the server by itself.
+// With JetStream, a write waits for the server to store the message.
+type natsSink struct {
+	conn      natsConnParams
+	enc       TupleEncoder
+	subject   *tupleTemplate
+	jetStream bool
+	timeout   time.Duration
+
+	m      sync.Mutex
+	nc     *nats.Conn
+	js     jetstream.JetStream
+	closed bool
+}
+
+func (s *natsSink) Write(ctx *core.Context, t *core.Tuple) error {
+	subject, err := s.subject.render(t)
+	if err != nil {
+		return err
+	}
+	if subject == "" {
+		return errors.New("the subject of the tuple is empty")
+	}
+	b, err := s.enc.Encode(t.Data)
+	if err != nil {
+		return err
+	}
+	b = bytes.TrimSuffix(b, []byte("\n"))
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return errors.New("the sink is already closed")
+	}
+	if s.nc == nil || s.nc.IsClosed() {
+		nc, err := s.conn.connect()
+		if err != nil {
+			return err
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			nc.Close()
+			return err
+		}
+		s.nc = nc
+		s.js = js
+	}
+
+	if !s.jetStream {
+		return s.nc.Publish(subject, b)
+	}
+	pctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	_, err = s.js.Publish(pctx, subject, b)
+	return err
+}
+
+func (s *natsSink) Close(ctx *core.Context) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.closed = true
+	if s.nc == nil {
+		return nil
+	}
+	// Drain flushes messages buffered in the connection.
+	err := s.nc.Drain()
+	s.nc = nil
+	s.js = nil
+	return err
+}
+
+// createNATSSink creates a nats sink. It accepts following parameters in
+// addition to natsConnParams and parameters of the format:
+//
+//   - subject: the subject of messages (required). It can have "{path}",
+//     which is replaced with the value of the path in the tuple, and
+//     "{path:layout}", which is replaced with the value formatted as a
+//     timestamp with the layout of Go's time.Format, e.g. "sensors.{id}".
+//     "@timestamp" refers to the timestamp of the tuple.
+//   - jetstream: true to publish messages to JetStream and wait for them to
+//     be stored (default: false)
+//   - publish_timeout: the timeout of publishing a message to JetStream
+//     (default: 10s)
+func createNATSSink(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Sink, error) {
+	// "format" and parameters related to it are handled by the encoder
+	enc, err := NewTupleEncoder(params)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &struct {
+		natsConnParams
+		Subject        string `bql:",required"`
+		JetStream      bool   `bql:"jetstream"`
+		PublishTimeout time.Duration
+	}{
+		natsConnParams: defaultNATSConnParams(),
+		PublishTimeout: 10 * time.Second,
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+	if err := v.validate(); err != nil {
+		return nil, err
+	}
+	if v.PublishTimeout <= 0 {
+		return nil, fmt.Errorf("publish_timeout must be positive: %v", v.PublishTimeout)
+	}
+	if v.Subject == "" {
+		return nil, errors.New("subject must not be empty")
+	}
+	subject, err := parseTupleTemplate("subject", v.Subject)
+	if err != nil {
+		return nil, err
+	}
+	return &natsSink{
+		conn:      v.natsConnParams,
+		enc:       enc,
+		subject:   subject,
+		jetStream: v.JetStream,
+		timeout:   v.PublishTimeout,
+	}, nil
+}
+
+func init() {
+	MustRegisterGlobalSourceCreator("nats", SourceCreatorFunc(createNATSSource))
+	MustRegisterGlobalSinkCreator("nats", SinkCreatorFunc(createNATSSink))
+}
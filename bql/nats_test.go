@@ -0,0 +1,293 @@
+package bql
+
+import (
+	"context"
+	"fmt"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runTestNATSServer runs a NATS server having JetStream enabled and a stream
+// named EVENTS storing messages of "events.>".
+func runTestNATSServer() (*server.Server, jetstream.JetStream) {
+	dir, err := ioutil.TempDir("", "sbtest_bql_nats")
+	So(err, ShouldBeNil)
+	Reset(func() {
+		os.RemoveAll(dir)
+	})
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  dir,
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	So(err, ShouldBeNil)
+	srv.Start()
+	Reset(srv.Shutdown)
+	So(srv.ReadyForConnections(10*time.Second), ShouldBeTrue)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	So(err, ShouldBeNil)
+	Reset(nc.Close)
+	js, err := jetstream.New(nc)
+	So(err, ShouldBeNil)
+	_, err = js.CreateStream(context.Background(), jetstream.StreamConfig{
+		Name:     "EVENTS",
+		Subjects: []string{"events.>"},
+	})
+	So(err, ShouldBeNil)
+	return srv, js
+}
+
+func TestNATSSource(t *testing.T) {
+	Convey("Given a NATS server", t, func() {
+		srv, js := runTestNATSServer()
+		bctx := context.Background()
+		ctx := core.NewContext(nil)
+		params := data.Map{
+			"url": data.String(srv.ClientURL()),
+		}
+		w := &testFileWriter{}
+		w.c = sync.NewCond(&w.m)
+		run := func() core.Source {
+			s, err := createNATSSource(ctx, &IOParams{Name: "nats_test"}, params)
+			So(err, ShouldBeNil)
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, w)
+			}()
+			Reset(func() {
+				s.Stop(ctx)
+				<-ch
+			})
+			return s
+		}
+
+		Convey("When subscribing to a subject", func() {
+			params["subject"] = data.String("sensors.*")
+			params["subject_field"] = data.String("subject")
+			run()
+
+			Convey("Then it should emit a tuple for each message", func() {
+				nc, err := nats.Connect(srv.ClientURL())
+				So(err, ShouldBeNil)
+				defer nc.Close()
+
+				// The source might not have subscribed to the subject yet.
+				var ds []data.Map
+				for i := 0; i < 500 && len(ds) == 0; i++ {
+					So(nc.Publish("sensors.temp", []byte(`{"v":1.5}`)), ShouldBeNil)
+					time.Sleep(10 * time.Millisecond)
+					w.m.Lock()
+					ds = append([]data.Map{}, w.ds...)
+					w.m.Unlock()
+				}
+				So(ds, ShouldNotBeEmpty)
+				So(ds[0], ShouldResemble, data.Map{"v": data.Float(1.5), "subject": data.String("sensors.temp")})
+			})
+		})
+
+		Convey("When consuming a stream with an ordered consumer", func() {
+			for i := 1; i <= 2; i++ {
+				_, err := js.Publish(bctx, "events.a", []byte(fmt.Sprintf(`{"v":%v}`, i)))
+				So(err, ShouldBeNil)
+			}
+			params["stream"] = data.String("EVENTS")
+			params["rewindable"] = data.True
+			s := run()
+
+			Convey("Then it should emit messages in the stream", func() {
+				ds := w.snapshot(2)
+				So(ds[0]["v"], ShouldEqual, data.Int(1))
+				So(ds[1]["v"], ShouldEqual, data.Int(2))
+				w.m.Lock()
+				So(w.tss[0].IsZero(), ShouldBeFalse)
+				w.m.Unlock()
+				So(s.(core.Statuser).Status()["last_sequence"], ShouldEqual, 2)
+
+				Convey("And it should replay the stream after rewinding", func() {
+					So(s.(core.RewindableSource).Rewind(ctx), ShouldBeNil)
+					ds := w.snapshot(4)
+					So(ds[2]["v"], ShouldEqual, data.Int(1))
+					So(ds[3]["v"], ShouldEqual, data.Int(2))
+				})
+			})
+		})
+
+		Convey("When consuming a stream with a durable consumer", func() {
+			_, err := js.Publish(bctx, "events.a", []byte(`{"v":1}`))
+			So(err, ShouldBeNil)
+			_, err = js.Publish(bctx, "events.b", []byte(`broken`))
+			So(err, ShouldBeNil)
+			_, err = js.Publish(bctx, "events.a", []byte(`{"v":2}`))
+			So(err, ShouldBeNil)
+			params["stream"] = data.String("EVENTS")
+			params["durable"] = data.String("sb")
+			params["rewindable"] = data.True
+			s := run()
+
+			Convey("Then it should acknowledge emitted messages", func() {
+				ds := w.snapshot(2)
+				So(ds[1]["v"], ShouldEqual, data.Int(2))
+
+				// The broken message is terminated, which also acknowledges it.
+				c, err := js.Consumer(bctx, "EVENTS", "sb")
+				So(err, ShouldBeNil)
+				var info *jetstream.ConsumerInfo
+				for i := 0; i < 1000; i++ {
+					info, err = c.Info(bctx)
+					So(err, ShouldBeNil)
+					if info.AckFloor.Stream == 3 {
+						break
+					}
+					time.Sleep(time.Millisecond)
+				}
+				So(info.AckFloor.Stream, ShouldEqual, 3)
+				So(info.NumAckPending, ShouldEqual, 0)
+
+				Convey("And it should replay the stream after rewinding", func() {
+					So(s.(core.RewindableSource).Rewind(ctx), ShouldBeNil)
+					ds := w.snapshot(4)
+					So(ds[2]["v"], ShouldEqual, data.Int(1))
+				})
+			})
+		})
+
+		Convey("When creating a source with invalid parameters", func() {
+			params["subject"] = data.String("sensors.*")
+			cases := map[string]data.Map{
+				"missing subject":           {"subject": data.String("")},
+				"durable without stream":    {"durable": data.String("sb")},
+				"rewindable without stream": {"rewindable": data.True},
+				"queue with stream":         {"stream": data.String("EVENTS"), "queue": data.String("q")},
+				"unsupported deliver":       {"deliver": data.String("first")},
+				"zero ack_wait":             {"ack_wait": data.Int(0)},
+				"zero max_ack_pending":      {"max_ack_pending": data.Int(0)},
+				"unsupported format":        {"format": data.String("csv")},
+				"token with username":       {"token": data.String("t"), "username": data.String("u")},
+				"invalid reconnect range":   {"min_reconnect_interval": data.Int(2), "max_reconnect_interval": data.Int(1)},
+			}
+			for name, c := range cases {
+				c := c
+				Convey("Then "+name+" should result in an error", func() {
+					ps := params.Copy()
+					for k, v := range c {
+						ps[k] = v
+					}
+					_, err := createNATSSource(ctx, &IOParams{Name: "nats_test"}, ps)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestNATSSink(t *testing.T) {
+	Convey("Given a NATS server", t, func() {
+		srv, js := runTestNATSServer()
+		ctx := core.NewContext(nil)
+		params := data.Map{
+			"url":     data.String(srv.ClientURL()),
+			"subject": data.String("events.{type}"),
+		}
+		tuple := core.NewTuple(data.Map{"type": data.String("temp"), "v": data.Int(1)})
+
+		Convey("When publishing a tuple", func() {
+			nc, err := nats.Connect(srv.ClientURL())
+			So(err, ShouldBeNil)
+			defer nc.Close()
+			sub, err := nc.SubscribeSync("events.*")
+			So(err, ShouldBeNil)
+			So(nc.Flush(), ShouldBeNil)
+
+			s, err := createNATSSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			So(s.Write(ctx, tuple), ShouldBeNil)
+			So(s.Close(ctx), ShouldBeNil)
+
+			Convey("Then it should be published to the subject", func() {
+				m, err := sub.NextMsg(5 * time.Second)
+				So(err, ShouldBeNil)
+				So(m.Subject, ShouldEqual, "events.temp")
+				So(string(m.Data), ShouldEqual, `{"type":"temp","v":1}`)
+			})
+		})
+
+		Convey("When publishing a tuple to JetStream", func() {
+			params["jetstream"] = data.True
+			s, err := createNATSSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+			So(s.Write(ctx, tuple), ShouldBeNil)
+
+			Convey("Then it should be stored in the stream", func() {
+				st, err := js.Stream(context.Background(), "EVENTS")
+				So(err, ShouldBeNil)
+				m, err := st.GetLastMsgForSubject(context.Background(), "events.temp")
+				So(err, ShouldBeNil)
+				So(string(m.Data), ShouldEqual, `{"type":"temp","v":1}`)
+			})
+		})
+
+		Convey("When publishing a tuple to JetStream without a stream for the subject", func() {
+			params["jetstream"] = data.True
+			params["subject"] = data.String("other.{type}")
+			s, err := createNATSSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+
+			Convey("Then writing should fail", func() {
+				So(s.Write(ctx, tuple), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the server is unavailable", func() {
+			params["url"] = data.String("nats://127.0.0.1:1")
+			params["connect_timeout"] = data.String("100ms")
+			s, err := createNATSSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+
+			Convey("Then writing should fail", func() {
+				So(s.Write(ctx, tuple), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When creating a sink with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"empty subject":        {"subject": data.String("")},
+				"invalid subject":      {"subject": data.String("events.{type")},
+				"zero publish_timeout": {"publish_timeout": data.Int(0)},
+				"empty url":            {"url": data.String("")},
+			}
+			for name, c := range cases {
+				c := c
+				Convey("Then "+name+" should result in an error", func() {
+					ps := params.Copy()
+					for k, v := range c {
+						ps[k] = v
+					}
+					_, err := createNATSSink(ctx, &IOParams{}, ps)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
@@ -0,0 +1,323 @@
+package bql
+
+import (
+	"fmt"
+	"github.com/xitongsys/parquet-go/marshal"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+	"strings"
+)
+
+// parquetColumnType is the type of a column of Parquet files written by the
+// parquet sink.
+type parquetColumnType int
+
+const (
+	parquetBool parquetColumnType = iota
+	parquetInt
+	parquetFloat
+	parquetString
+	parquetBlob
+	parquetTimestamp
+
+	// parquetJSON is a string column having values encoded in JSON.
+	parquetJSON
+)
+
+var parquetColumnTypes = map[string]parquetColumnType{
+	"bool":      parquetBool,
+	"int":       parquetInt,
+	"float":     parquetFloat,
+	"string":    parquetString,
+	"blob":      parquetBlob,
+	"timestamp": parquetTimestamp,
+	"json":      parquetJSON,
+}
+
+func (t parquetColumnType) schemaElement(name string) *parquet.SchemaElement {
+	e := parquet.NewSchemaElement()
+	e.Name = name
+	e.RepetitionType = parquet.FieldRepetitionTypePtr(parquet.FieldRepetitionType_OPTIONAL)
+	switch t {
+	case parquetBool:
+		e.Type = parquet.TypePtr(parquet.Type_BOOLEAN)
+	case parquetInt:
+		e.Type = parquet.TypePtr(parquet.Type_INT64)
+	case parquetFloat:
+		e.Type = parquet.TypePtr(parquet.Type_DOUBLE)
+	case parquetString, parquetJSON:
+		e.Type = parquet.TypePtr(parquet.Type_BYTE_ARRAY)
+		e.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8)
+	case parquetBlob:
+		e.Type = parquet.TypePtr(parquet.Type_BYTE_ARRAY)
+	case parquetTimestamp:
+		e.Type = parquet.TypePtr(parquet.Type_INT64)
+		e.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_TIMESTAMP_MICROS)
+	}
+	return e
+}
+
+// convert converts a value to a Go value which the Parquet writer accepts.
+func (t parquetColumnType) convert(v data.Value) (interface{}, error) {
+	switch t {
+	case parquetBool:
+		return data.ToBool(v)
+	case parquetInt:
+		return data.ToInt(v)
+	case parquetFloat:
+		return data.ToFloat(v)
+	case parquetString:
+		return data.ToString(v)
+	case parquetBlob:
+		b, err := data.ToBlob(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case parquetTimestamp:
+		ts, err := data.ToTimestamp(v)
+		if err != nil {
+			return nil, err
+		}
+		return ts.UnixNano() / 1000, nil
+	case parquetJSON:
+		return v.String(), nil
+	default:
+		return nil, fmt.Errorf("unknown column type: %v", t)
+	}
+}
+
+type parquetColumn struct {
+	name string
+
+	// path is the path of the value. When it's nil, the value is looked up
+	// by the name as a key of the top-level map.
+	path data.Path
+	typ  parquetColumnType
+}
+
+func (c *parquetColumn) value(m data.Map) (interface{}, error) {
+	var v data.Value
+	if c.path == nil {
+		x, ok := m[c.name]
+		if !ok {
+			return nil, nil
+		}
+		v = x
+	} else {
+		x, err := m.Get(c.path)
+		if err != nil {
+			return nil, nil // a missing value is written as NULL
+		}
+		v = x
+	}
+	if v.Type() == data.TypeNull {
+		return nil, nil
+	}
+
+	x, err := c.typ.convert(v)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert the value of column %v: %v", c.name, err)
+	}
+	return x, nil
+}
+
+// parseParquetSchema parses "schema" parameter which is a map from paths of
+// values to their types, e.g. {"id": "int", "user.name": "string"}. Columns
+// are sorted by their names.
+func parseParquetSchema(v data.Value) ([]parquetColumn, error) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return nil, fmt.Errorf("schema parameter must be a map: %v", err)
+	}
+	if len(m) == 0 {
+		return nil, fmt.Errorf("schema parameter must have at least one column")
+	}
+
+	var cols []parquetColumn
+	for name, t := range m {
+		s, err := data.AsString(t)
+		if err != nil {
+			return nil, fmt.Errorf("the type of column %v must be a string: %v", name, err)
+		}
+		typ, ok := parquetColumnTypes[strings.ToLower(s)]
+		if !ok {
+			return nil, fmt.Errorf("the type of column %v is unsupported: %v", name, s)
+		}
+		p, err := data.CompilePath(name)
+		if err != nil {
+			return nil, fmt.Errorf("column %v is an invalid path: %v", name, err)
+		}
+		cols = append(cols, parquetColumn{
+			name: name,
+			path: p,
+			typ:  typ,
+		})
+	}
+	sort.Sort(parquetColumnsByName(cols))
+	return cols, nil
+}
+
+// inferParquetSchema creates columns from the top-level fields of a tuple.
+// Arrays and maps are stored as JSON, and a field having NULL becomes a
+// string column.
+func inferParquetSchema(m data.Map) ([]parquetColumn, error) {
+	if len(m) == 0 {
+		return nil, fmt.Errorf("cannot infer the schema from an empty tuple")
+	}
+
+	var cols []parquetColumn
+	for name, v := range m {
+		c := parquetColumn{name: name}
+		switch v.Type() {
+		case data.TypeBool:
+			c.typ = parquetBool
+		case data.TypeInt:
+			c.typ = parquetInt
+		case data.TypeFloat:
+			c.typ = parquetFloat
+		case data.TypeString, data.TypeNull:
+			c.typ = parquetString
+		case data.TypeBlob:
+			c.typ = parquetBlob
+		case data.TypeTimestamp:
+			c.typ = parquetTimestamp
+		default:
+			c.typ = parquetJSON
+		}
+		cols = append(cols, c)
+	}
+	sort.Sort(parquetColumnsByName(cols))
+	return cols, nil
+}
+
+type parquetColumnsByName []parquetColumn
+
+func (c parquetColumnsByName) Len() int           { return len(c) }
+func (c parquetColumnsByName) Less(i, j int) bool { return c[i].name < c[j].name }
+func (c parquetColumnsByName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+type parquetFile struct {
+	c       *countingWriter
+	pw      *writer.ParquetWriter
+	columns []parquetColumn
+}
+
+func newParquetFile(c *countingWriter, columns []parquetColumn,
+	compression parquet.CompressionCodec, rowGroupSize int64) (*parquetFile, error) {
+	root := parquet.NewSchemaElement()
+	root.Name = "schema"
+	root.RepetitionType = parquet.FieldRepetitionTypePtr(parquet.FieldRepetitionType_REQUIRED)
+	root.NumChildren = new(int32)
+	*root.NumChildren = int32(len(columns))
+	elems := []*parquet.SchemaElement{root}
+	for _, col := range columns {
+		elems = append(elems, col.typ.schemaElement(col.name))
+	}
+
+	pw, err := writer.NewParquetWriterFromWriter(c, elems, 1)
+	if err != nil {
+		return nil, err
+	}
+	pw.MarshalFunc = marshal.MarshalCSV
+	pw.CompressionType = compression
+	pw.RowGroupSize = rowGroupSize
+	return &parquetFile{
+		c:       c,
+		pw:      pw,
+		columns: columns,
+	}, nil
+}
+
+func (f *parquetFile) Write(m data.Map) error {
+	row := make([]interface{}, len(f.columns))
+	for i := range f.columns {
+		v, err := f.columns[i].value(m)
+		if err != nil {
+			return err
+		}
+		row[i] = v
+	}
+	return f.pw.Write(row)
+}
+
+func (f *parquetFile) Size() int64 {
+	return f.c.n + f.pw.Size + f.pw.ObjsSize
+}
+
+func (f *parquetFile) Close() error {
+	return f.pw.WriteStop()
+}
+
+// createParquetSink creates a sink writing tuples to rotating Parquet files.
+// It accepts following parameters in addition to archiveParams:
+//
+//   - schema: a map from paths of values to their types. A type is one of
+//     bool, int, float, string, blob, timestamp, or json. A value is
+//     converted to the type in the same way as CAST. When it's omitted, the
+//     schema is inferred from the top-level fields of the first tuple.
+//   - compression: "snappy" (default), "gzip", "zstd", or "none"
+//   - row_group_size: the size of a row group in bytes (default: 64MB)
+//
+// A file being written has ".part" suffix and it's renamed when the file is
+// completed. When rotation is disabled, an existing file is overwritten.
+func createParquetSink(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Sink, error) {
+	var columns []parquetColumn
+	if v, ok := params["schema"]; ok {
+		cs, err := parseParquetSchema(v)
+		if err != nil {
+			return nil, err
+		}
+		columns = cs
+		delete(params, "schema")
+	}
+
+	v := &struct {
+		archiveParams
+		Compression  string
+		RowGroupSize int64
+	}{
+		Compression:  "snappy",
+		RowGroupSize: 64 * 1024 * 1024,
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+	if v.RowGroupSize <= 0 {
+		return nil, fmt.Errorf("row_group_size must be positive: %v", v.RowGroupSize)
+	}
+
+	var compression parquet.CompressionCodec
+	switch strings.ToLower(v.Compression) {
+	case "snappy":
+		compression = parquet.CompressionCodec_SNAPPY
+	case "gzip":
+		compression = parquet.CompressionCodec_GZIP
+	case "zstd":
+		compression = parquet.CompressionCodec_ZSTD
+	case "none":
+		compression = parquet.CompressionCodec_UNCOMPRESSED
+	default:
+		return nil, fmt.Errorf("unsupported compression: %v", v.Compression)
+	}
+
+	// The schema is shared by all files written by the sink. newFile is
+	// called while archiveSink holds the lock.
+	return newArchiveSink(ctx, v.archiveParams, "", ".part", false, func(c *countingWriter, m data.Map) (archiveFile, error) {
+		if columns == nil {
+			cs, err := inferParquetSchema(m)
+			if err != nil {
+				return nil, err
+			}
+			columns = cs
+		}
+		return newParquetFile(c, columns, compression, v.RowGroupSize)
+	})
+}
+
+func init() {
+	MustRegisterGlobalSinkCreator("parquet", SinkCreatorFunc(createParquetSink))
+}
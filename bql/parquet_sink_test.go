@@ -0,0 +1,184 @@
+package bql
+
+import (
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readParquetFile returns the column names, the schema, and rows of a Parquet
+// file. Each row is converted to a map through JSON and its keys are
+// capitalized column names.
+func readParquetFile(path string) ([]string, []*parquet.SchemaElement, []map[string]interface{}) {
+	f, err := local.NewLocalFileReader(path)
+	So(err, ShouldBeNil)
+	defer f.Close()
+	pr, err := reader.NewParquetReader(f, nil, 1)
+	So(err, ShouldBeNil)
+	defer pr.ReadStop()
+
+	rows, err := pr.ReadByNumber(int(pr.GetNumRows()))
+	So(err, ShouldBeNil)
+	var res []map[string]interface{}
+	for _, r := range rows {
+		b, err := json.Marshal(r)
+		So(err, ShouldBeNil)
+		m := map[string]interface{}{}
+		So(json.Unmarshal(b, &m), ShouldBeNil)
+		res = append(res, m)
+	}
+	var names []string
+	for _, info := range pr.SchemaHandler.Infos[1:] {
+		names = append(names, info.ExName)
+	}
+	return names, pr.Footer.Schema, res
+}
+
+func TestParquetSink(t *testing.T) {
+	Convey("Given a directory", t, func() {
+		dir, err := ioutil.TempDir("", "sbtest_bql_parquet_sink")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		ctx := core.NewContext(nil)
+		path := filepath.Join(dir, "out.parquet")
+		params := data.Map{
+			"path": data.String(path),
+		}
+		now := time.Date(2016, 1, 2, 3, 4, 5, 6000, time.UTC)
+
+		Convey("When writing tuples with the inferred schema", func() {
+			s, err := createParquetSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			So(s.Write(ctx, core.NewTuple(data.Map{
+				"int":    data.Int(1),
+				"float":  data.Float(1.5),
+				"str":    data.String("a"),
+				"bool":   data.True,
+				"ts":     data.Timestamp(now),
+				"nested": data.Map{"a": data.Array{data.Int(1)}},
+				"null":   data.Null{},
+			})), ShouldBeNil)
+			So(s.Write(ctx, core.NewTuple(data.Map{
+				"int":   data.Float(2),
+				"other": data.Int(3),
+				"null":  data.String("b"),
+			})), ShouldBeNil)
+
+			Convey("Then no file should be completed before closing the sink", func() {
+				So(archivedFiles(dir), ShouldResemble, []string{"out.parquet.part"})
+				So(s.Close(ctx), ShouldBeNil)
+			})
+
+			Convey("Then the file should have columns of the first tuple", func() {
+				So(s.Close(ctx), ShouldBeNil)
+				So(archivedFiles(dir), ShouldResemble, []string{"out.parquet"})
+				names, schema, rows := readParquetFile(path)
+				So(names, ShouldResemble, []string{"bool", "float", "int", "nested", "null", "str", "ts"})
+				So(schema[7].GetConvertedType(), ShouldEqual, parquet.ConvertedType_TIMESTAMP_MICROS)
+
+				So(rows, ShouldHaveLength, 2)
+				So(rows[0], ShouldResemble, map[string]interface{}{
+					"Bool":   true,
+					"Float":  1.5,
+					"Int":    1.0,
+					"Nested": `{"a":[1]}`,
+					"Null":   nil,
+					"Str":    "a",
+					"Ts":     float64(now.UnixNano() / 1000),
+				})
+				So(rows[1], ShouldResemble, map[string]interface{}{
+					"Bool":   nil,
+					"Float":  nil,
+					"Int":    2.0,
+					"Nested": nil,
+					"Null":   "b",
+					"Str":    nil,
+					"Ts":     nil,
+				})
+			})
+		})
+
+		Convey("When writing tuples with a schema", func() {
+			params["schema"] = data.Map{
+				"a.b": data.String("int"),
+				"c":   data.String("json"),
+			}
+			params["compression"] = data.String("gzip")
+			s, err := createParquetSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			So(s.Write(ctx, core.NewTuple(data.Map{
+				"a": data.Map{"b": data.String("10")},
+				"c": data.String("x"),
+			})), ShouldBeNil)
+
+			Convey("Then values should be converted to the types", func() {
+				So(s.Close(ctx), ShouldBeNil)
+				_, _, rows := readParquetFile(path)
+				So(rows, ShouldResemble, []map[string]interface{}{
+					{"A46b": 10.0, "C": `"x"`},
+				})
+			})
+
+			Convey("Then a value which cannot be converted should result in an error", func() {
+				So(s.Write(ctx, core.NewTuple(data.Map{
+					"a": data.Map{"b": data.String("x")},
+				})), ShouldNotBeNil)
+				So(s.Close(ctx), ShouldBeNil)
+				_, _, rows := readParquetFile(path)
+				So(rows, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When writing tuples to a sink rotating files by size", func() {
+			params["rotate_size"] = data.Int(1)
+			s, err := createParquetSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			for i := 0; i < 3; i++ {
+				So(s.Write(ctx, core.NewTuple(data.Map{"i": data.Int(i)})), ShouldBeNil)
+			}
+			So(s.Close(ctx), ShouldBeNil)
+
+			Convey("Then each file should have a tuple", func() {
+				names := archivedFiles(dir)
+				So(names, ShouldHaveLength, 3)
+				for i, n := range names {
+					So(n, ShouldEndWith, ".parquet")
+					_, _, rows := readParquetFile(filepath.Join(dir, n))
+					So(rows, ShouldResemble, []map[string]interface{}{{"I": float64(i)}})
+				}
+			})
+		})
+
+		Convey("When creating a sink with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"empty schema":            {"schema": data.Map{}},
+				"unsupported type":        {"schema": data.Map{"a": data.String("decimal")}},
+				"invalid path":            {"schema": data.Map{"a[": data.String("int")}},
+				"unsupported compression": {"compression": data.String("brotli")},
+				"zero row_group_size":     {"row_group_size": data.Int(0)},
+			}
+			for name, c := range cases {
+				c := c
+				Convey("Then "+name+" should result in an error", func() {
+					ps := params.Copy()
+					for k, v := range c {
+						ps[k] = v
+					}
+					_, err := createParquetSink(ctx, &IOParams{}, ps)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
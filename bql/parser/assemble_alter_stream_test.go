@@ -0,0 +1,115 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAssembleAlterStream(t *testing.T) {
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+		Convey("When the stack contains the correct ALTER STREAM items", func() {
+			ps.PushComponent(2, 4, StreamIdentifier("a"))
+			ps.PushComponent(5, 6, NumericLiteral{10})
+			ps.EnsureCapacitySpec(5, 6)
+			ps.PushComponent(7, 8, DropOldest)
+			ps.EnsureSheddingSpec(7, 8)
+			ps.AssembleAlterStream()
+
+			Convey("Then AssembleAlterStream transforms them into one item", func() {
+				So(ps.Len(), ShouldEqual, 1)
+
+				Convey("And that item is an AlterStreamStmt", func() {
+					top := ps.Peek()
+					So(top, ShouldNotBeNil)
+					So(top.begin, ShouldEqual, 2)
+					So(top.end, ShouldEqual, 8)
+					So(top.comp, ShouldHaveSameTypeAs, AlterStreamStmt{})
+
+					Convey("And it contains the previously pushed data", func() {
+						comp := top.comp.(AlterStreamStmt)
+						So(comp.Stream, ShouldEqual, "a")
+						So(comp.Capacity, ShouldEqual, 10)
+						So(comp.Shedding, ShouldEqual, DropOldest)
+					})
+				})
+			})
+		})
+
+		Convey("When the stack does not contain enough items", func() {
+			ps.PushComponent(2, 4, StreamIdentifier("a"))
+			ps.PushComponent(7, 8, DropOldest)
+
+			Convey("Then AssembleAlterStream panics", func() {
+				So(ps.AssembleAlterStream, ShouldPanic)
+			})
+		})
+
+		Convey("When the stack contains a wrong item", func() {
+			ps.PushComponent(2, 4, Raw{"a"}) // must be StreamIdentifier
+			ps.PushComponent(5, 6, NumericLiteral{10})
+			ps.PushComponent(7, 8, DropOldest)
+
+			Convey("Then AssembleAlterStream panics", func() {
+				So(ps.AssembleAlterStream, ShouldPanic)
+			})
+		})
+	})
+
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		for _, c := range []struct {
+			stmt     string
+			capacity int64
+			shedding SheddingOption
+		}{
+			{"ALTER STREAM a_1 SET BUFFER SIZE 10, DROP OLDEST IF FULL", 10, DropOldest},
+			{"ALTER STREAM a_1 SET BUFFER SIZE 10", 10, UnspecifiedSheddingOption},
+			{"ALTER STREAM a_1 SET DROP NEWEST IF FULL", UnspecifiedCapacity, DropNewest},
+			{"ALTER STREAM a_1 SET WAIT IF FULL", UnspecifiedCapacity, Wait},
+		} {
+			c := c
+			Convey("When doing a full ALTER STREAM: "+c.stmt, func() {
+				p.Buffer = c.stmt
+				p.Init()
+
+				Convey("Then the statement should be parsed correctly", func() {
+					err := p.Parse()
+					So(err, ShouldEqual, nil)
+					p.Execute()
+
+					ps := p.parseStack
+					So(ps.Len(), ShouldEqual, 1)
+					top := ps.Peek().comp
+					So(top, ShouldHaveSameTypeAs, AlterStreamStmt{})
+					comp := top.(AlterStreamStmt)
+
+					So(comp.Stream, ShouldEqual, "a_1")
+					So(comp.Capacity, ShouldEqual, c.capacity)
+					So(comp.Shedding, ShouldEqual, c.shedding)
+
+					Convey("And String() should return the original statement", func() {
+						So(comp.String(), ShouldEqual, p.Buffer)
+					})
+				})
+			})
+		}
+
+		for _, stmt := range []string{
+			"ALTER STREAM a_1 SET",
+			"ALTER STREAM a_1 SET DROP OLDEST IF FULL, BUFFER SIZE 10",
+			"ALTER STREAM a_1 SET BUFFER SIZE -1",
+		} {
+			stmt := stmt
+			Convey("When doing an invalid ALTER STREAM: "+stmt, func() {
+				p.Buffer = stmt
+				p.Init()
+
+				Convey("Then parsing should fail", func() {
+					So(p.Parse(), ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
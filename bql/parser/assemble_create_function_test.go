@@ -0,0 +1,153 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAssembleCreateFunction(t *testing.T) {
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+		Convey("When the stack contains the correct CREATE FUNCTION items", func() {
+			ps.PushComponent(16, 19, FuncName("add"))
+			ps.PushComponent(19, 23, Identifier("a"))
+			ps.PushComponent(23, 24, Identifier("b"))
+			ps.AssembleFunctionParams(19, 25)
+			ps.PushComponent(35, 38, Identifier("lua"))
+			ps.PushComponent(42, 62, NewRaw(" return a + b "))
+			ps.AssembleCreateFunction()
+
+			Convey("Then AssembleCreateFunction transforms them into one item", func() {
+				So(ps.Len(), ShouldEqual, 1)
+
+				Convey("And that item is a CreateFunctionStmt", func() {
+					top := ps.Peek()
+					So(top, ShouldNotBeNil)
+					So(top.begin, ShouldEqual, 16)
+					So(top.end, ShouldEqual, 62)
+					So(top.comp, ShouldHaveSameTypeAs, CreateFunctionStmt{})
+
+					Convey("And it contains the previously pushed data", func() {
+						comp := top.comp.(CreateFunctionStmt)
+						So(comp.Name, ShouldEqual, "add")
+						So(comp.Params, ShouldResemble, []Identifier{"a", "b"})
+						So(comp.Variadic, ShouldBeFalse)
+						So(comp.Language, ShouldEqual, "lua")
+						So(comp.Body, ShouldEqual, " return a + b ")
+					})
+				})
+			})
+		})
+
+		Convey("When the stack doesn't contain parameters", func() {
+			ps.PushComponent(16, 19, FuncName("add"))
+			ps.AssembleFunctionParams(19, 19)
+			ps.PushComponent(29, 32, Identifier("lua"))
+			ps.PushComponent(36, 56, NewRaw(" return a + b "))
+			ps.AssembleCreateFunction()
+
+			Convey("Then the function should be variadic", func() {
+				So(ps.Len(), ShouldEqual, 1)
+				comp := ps.Peek().comp.(CreateFunctionStmt)
+				So(comp.Params, ShouldBeEmpty)
+				So(comp.Variadic, ShouldBeTrue)
+			})
+		})
+
+		Convey("When the stack contains a wrong item", func() {
+			ps.PushComponent(16, 19, StreamIdentifier("add")) // must be FuncName
+			ps.AssembleFunctionParams(19, 19)
+			ps.PushComponent(29, 32, Identifier("lua"))
+			ps.PushComponent(36, 56, NewRaw(" return a + b "))
+
+			Convey("Then AssembleCreateFunction panics", func() {
+				So(ps.AssembleCreateFunction, ShouldPanic)
+			})
+		})
+	})
+
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		Convey("When doing a full CREATE FUNCTION", func() {
+			p.Buffer = `CREATE FUNCTION add(a, b) LANGUAGE lua AS $$
+    -- "$" is allowed
+    return a + b
+$$`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, CreateFunctionStmt{})
+				comp := top.(CreateFunctionStmt)
+
+				So(comp.Name, ShouldEqual, "add")
+				So(comp.Params, ShouldResemble, []Identifier{"a", "b"})
+				So(comp.Variadic, ShouldBeFalse)
+				So(comp.Language, ShouldEqual, "lua")
+				So(comp.Body, ShouldEqual, `
+    -- "$" is allowed
+    return a + b
+`)
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When doing a CREATE FUNCTION without parameters", func() {
+			p.Buffer = `CREATE FUNCTION f() LANGUAGE lua AS $$return 1$$`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				comp := p.parseStack.Peek().comp.(CreateFunctionStmt)
+				So(comp.Params, ShouldBeEmpty)
+				So(comp.Variadic, ShouldBeFalse)
+				So(comp.Body, ShouldEqual, "return 1")
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When doing a CREATE FUNCTION without a parameter list", func() {
+			p.Buffer = `CREATE FUNCTION f LANGUAGE lua AS $$return select("#", ...)$$`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				comp := p.parseStack.Peek().comp.(CreateFunctionStmt)
+				So(comp.Params, ShouldBeEmpty)
+				So(comp.Variadic, ShouldBeTrue)
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When the body isn't closed", func() {
+			p.Buffer = `CREATE FUNCTION f LANGUAGE lua AS $$return 1`
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,112 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAssembleCreateRecursiveStream(t *testing.T) {
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		Convey("When doing a full CREATE RECURSIVE STREAM", func() {
+			p.Buffer = `CREATE RECURSIVE STREAM paths MAX ITERATIONS 5 AS SELECT RSTREAM src, dst FROM edges [RANGE 1 TUPLES] UNION ALL SELECT ISTREAM p:src, e:dst FROM paths [RANGE 10 TUPLES] AS p, edges [RANGE 10 TUPLES] AS e WHERE p:dst = e:src`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, CreateStreamAsSelectUnionStmt{})
+				cssComp := top.(CreateStreamAsSelectUnionStmt)
+
+				So(cssComp.Name, ShouldEqual, "paths")
+				So(cssComp.Recursive, ShouldBeTrue)
+				So(cssComp.MaxIterations, ShouldEqual, 5)
+				So(cssComp.Ordered, ShouldEqual, UnspecifiedKeyword)
+				So(len(cssComp.Selects), ShouldEqual, 2)
+
+				comp1 := cssComp.Selects[0]
+				So(comp1.EmitterType, ShouldEqual, Rstream)
+				So(len(comp1.Relations), ShouldEqual, 1)
+				So(comp1.Relations[0].Name, ShouldEqual, "edges")
+
+				comp2 := cssComp.Selects[1]
+				So(comp2.EmitterType, ShouldEqual, Istream)
+				So(len(comp2.Relations), ShouldEqual, 2)
+				So(comp2.Relations[0].Name, ShouldEqual, "paths")
+				So(comp2.Relations[0].Alias, ShouldEqual, "p")
+				So(comp2.Relations[1].Name, ShouldEqual, "edges")
+				So(comp2.Relations[1].Alias, ShouldEqual, "e")
+				So(comp2.Filter, ShouldResemble, BinaryOpAST{Equal, RowValue{"p", "dst"}, RowValue{"e", "src"}})
+
+				Convey("And String() should return the original statement", func() {
+					So(cssComp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When using lower case keywords", func() {
+			p.Buffer = `create recursive stream x max iterations 1 as select rstream a from y [range 1 tuples] union all select rstream a from x [range 1 tuples]`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				top := p.parseStack.Peek().comp
+				So(top, ShouldHaveSameTypeAs, CreateStreamAsSelectUnionStmt{})
+				cssComp := top.(CreateStreamAsSelectUnionStmt)
+				So(cssComp.Recursive, ShouldBeTrue)
+				So(cssComp.MaxIterations, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When doing a non-recursive CREATE STREAM with UNION ALL", func() {
+			p.Buffer = `CREATE STREAM x AS SELECT RSTREAM a FROM y [RANGE 1 TUPLES] UNION ALL SELECT RSTREAM a FROM z [RANGE 1 TUPLES]`
+			p.Init()
+
+			Convey("Then the statement shouldn't be recursive", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				cssComp := p.parseStack.Peek().comp.(CreateStreamAsSelectUnionStmt)
+				So(cssComp.Recursive, ShouldBeFalse)
+				So(cssComp.String(), ShouldEqual, p.Buffer)
+			})
+		})
+
+		Convey("When omitting MAX ITERATIONS", func() {
+			p.Buffer = `CREATE RECURSIVE STREAM x AS SELECT RSTREAM a FROM y [RANGE 1 TUPLES] UNION ALL SELECT RSTREAM a FROM x [RANGE 1 TUPLES]`
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When specifying a negative MAX ITERATIONS", func() {
+			p.Buffer = `CREATE RECURSIVE STREAM x MAX ITERATIONS -1 AS SELECT RSTREAM a FROM y [RANGE 1 TUPLES] UNION ALL SELECT RSTREAM a FROM x [RANGE 1 TUPLES]`
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When having only one SELECT statement", func() {
+			p.Buffer = `CREATE RECURSIVE STREAM x MAX ITERATIONS 1 AS SELECT RSTREAM a FROM x [RANGE 1 TUPLES]`
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,111 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestAssembleCreateRemoteFunction(t *testing.T) {
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+		Convey("When the stack contains the correct CREATE FUNCTION ... TYPE items", func() {
+			ps.PushComponent(16, 23, FuncName("predict"))
+			ps.PushComponent(29, 33, Identifier("grpc"))
+			ps.PushComponent(33, 60, SourceSinkSpecsAST{[]SourceSinkParamAST{
+				{"address", data.String("localhost:50051"), nil},
+			}})
+			ps.AssembleCreateRemoteFunction()
+
+			Convey("Then AssembleCreateRemoteFunction transforms them into one item", func() {
+				So(ps.Len(), ShouldEqual, 1)
+
+				Convey("And that item is a CreateRemoteFunctionStmt", func() {
+					top := ps.Peek()
+					So(top, ShouldNotBeNil)
+					So(top.begin, ShouldEqual, 16)
+					So(top.end, ShouldEqual, 60)
+					So(top.comp, ShouldHaveSameTypeAs, CreateRemoteFunctionStmt{})
+
+					Convey("And it contains the previously pushed data", func() {
+						comp := top.comp.(CreateRemoteFunctionStmt)
+						So(comp.Name, ShouldEqual, "predict")
+						So(comp.Type, ShouldEqual, "grpc")
+						So(comp.Params.Params, ShouldResemble, []SourceSinkParamAST{
+							{"address", data.String("localhost:50051"), nil},
+						})
+					})
+				})
+			})
+		})
+
+		Convey("When the stack contains a wrong item", func() {
+			ps.PushComponent(16, 23, FuncName("predict"))
+			ps.PushComponent(29, 33, SourceSinkType("grpc")) // must be Identifier
+			ps.PushComponent(33, 33, SourceSinkSpecsAST{})
+
+			Convey("Then AssembleCreateRemoteFunction panics", func() {
+				So(ps.AssembleCreateRemoteFunction, ShouldPanic)
+			})
+		})
+	})
+
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		Convey("When doing a full CREATE FUNCTION ... TYPE", func() {
+			p.Buffer = `CREATE FUNCTION predict TYPE grpc WITH address="localhost:50051", batch_size=16`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, CreateRemoteFunctionStmt{})
+				comp := top.(CreateRemoteFunctionStmt)
+
+				So(comp.Name, ShouldEqual, "predict")
+				So(comp.Type, ShouldEqual, "grpc")
+				So(comp.Params.Params, ShouldResemble, []SourceSinkParamAST{
+					{"address", data.String("localhost:50051"), nil},
+					{"batch_size", data.Int(16), nil},
+				})
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When doing a CREATE FUNCTION ... TYPE without parameters", func() {
+			p.Buffer = `CREATE FUNCTION predict TYPE grpc`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				comp := p.parseStack.Peek().comp.(CreateRemoteFunctionStmt)
+				So(comp.Params.Params, ShouldBeEmpty)
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When doing a CREATE FUNCTION having both a type and a body", func() {
+			p.Buffer = `CREATE FUNCTION f TYPE grpc AS $$return 1$$`
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+	})
+}
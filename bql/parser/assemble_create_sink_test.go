@@ -10,11 +10,14 @@ func TestAssembleCreateSink(t *testing.T) {
 	Convey("Given a parseStack", t, func() {
 		ps := parseStack{}
 		Convey("When the stack contains the correct CREATE SINK items", func() {
+			ps.EnsureKeywordPresent(2, 2)
+			ps.EnsureKeywordPresent(2, 2)
 			ps.PushComponent(2, 4, StreamIdentifier("a"))
 			ps.PushComponent(4, 6, SourceSinkType("b"))
-			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d")})
-			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f")})
+			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d"), nil})
+			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f"), nil})
 			ps.AssembleSourceSinkSpecs(6, 10)
+			ps.AssembleSchema(10, 10)
 			ps.AssembleCreateSink()
 
 			Convey("Then AssembleCreateSink transforms them into one item", func() {
@@ -36,6 +39,45 @@ func TestAssembleCreateSink(t *testing.T) {
 						So(comp.Params[0].Value, ShouldEqual, data.String("d"))
 						So(comp.Params[1].Key, ShouldEqual, "e")
 						So(comp.Params[1].Value, ShouldEqual, data.String("f"))
+						So(comp.Columns, ShouldBeEmpty)
+					})
+				})
+			})
+		})
+
+		Convey("When the stack contains the correct CREATE SINK items with a schema", func() {
+			ps.EnsureKeywordPresent(2, 2)
+			ps.EnsureKeywordPresent(2, 2)
+			ps.PushComponent(2, 4, StreamIdentifier("a"))
+			ps.PushComponent(4, 6, SourceSinkType("b"))
+			ps.AssembleSourceSinkSpecs(6, 6)
+			ps.PushComponent(7, 8, Identifier("c"))
+			ps.PushComponent(8, 9, Int)
+			ps.AssembleSchemaColumn()
+			ps.PushComponent(9, 10, Identifier("d"))
+			ps.PushComponent(10, 11, Map)
+			ps.AssembleSchemaColumn()
+			ps.AssembleSchema(6, 12)
+			ps.AssembleCreateSink()
+
+			Convey("Then AssembleCreateSink transforms them into one item", func() {
+				So(ps.Len(), ShouldEqual, 1)
+
+				Convey("And that item is a CreateSinkStmt", func() {
+					top := ps.Peek()
+					So(top, ShouldNotBeNil)
+					So(top.begin, ShouldEqual, 2)
+					So(top.end, ShouldEqual, 12)
+					So(top.comp, ShouldHaveSameTypeAs, CreateSinkStmt{})
+
+					Convey("And it contains the previously pushed data", func() {
+						comp := top.comp.(CreateSinkStmt)
+						So(comp.Name, ShouldEqual, "a")
+						So(comp.Params, ShouldBeEmpty)
+						So(comp.Columns, ShouldResemble, []SchemaColumnAST{
+							{"c", Int},
+							{"d", Map},
+						})
 					})
 				})
 			})
@@ -50,11 +92,14 @@ func TestAssembleCreateSink(t *testing.T) {
 		})
 
 		Convey("When the stack contains a wrong item", func() {
+			ps.EnsureKeywordPresent(2, 2)
+			ps.EnsureKeywordPresent(2, 2)
 			ps.PushComponent(2, 4, Raw{"a"}) // must be StreamIdentifier
 			ps.PushComponent(4, 6, SourceSinkType("b"))
-			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d")})
-			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f")})
+			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d"), nil})
+			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f"), nil})
 			ps.AssembleSourceSinkSpecs(6, 10)
+			ps.AssembleSchema(10, 10)
 
 			Convey("Then AssembleCreateSink panics", func() {
 				So(ps.AssembleCreateSink, ShouldPanic)
@@ -93,5 +138,79 @@ func TestAssembleCreateSink(t *testing.T) {
 				})
 			})
 		})
+
+		Convey("When doing a full CREATE SINK with a schema", func() {
+			p.Buffer = `CREATE SINK a_1 TYPE b WITH c=27 SCHEMA (x INT, y_1 STRING, z TIMESTAMP)`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, CreateSinkStmt{})
+				comp := top.(CreateSinkStmt)
+
+				So(comp.Name, ShouldEqual, "a_1")
+				So(len(comp.Params), ShouldEqual, 1)
+				So(comp.Columns, ShouldResemble, []SchemaColumnAST{
+					{"x", Int},
+					{"y_1", String},
+					{"z", Timestamp},
+				})
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When doing a CREATE SINK with a schema but without parameters", func() {
+			p.Buffer = `CREATE SINK a TYPE b SCHEMA(x float ,y array)`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				comp := p.parseStack.Peek().comp.(CreateSinkStmt)
+				So(comp.Params, ShouldBeEmpty)
+				So(comp.Columns, ShouldResemble, []SchemaColumnAST{
+					{"x", Float},
+					{"y", Array},
+				})
+				So(comp.String(), ShouldEqual, "CREATE SINK a TYPE b SCHEMA (x FLOAT, y ARRAY)")
+			})
+		})
+
+		Convey("When doing a CREATE SINK with modifiers", func() {
+			p.Buffer = `CREATE SINK IF NOT EXISTS a TYPE b WITH c=1`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				comp := p.parseStack.Peek().comp.(CreateSinkStmt)
+				So(comp.Name, ShouldEqual, "a")
+				So(comp.OrReplace, ShouldEqual, UnspecifiedKeyword)
+				So(comp.IfNotExists, ShouldEqual, Yes)
+				So(comp.String(), ShouldEqual, p.Buffer)
+			})
+		})
+
+		Convey("When doing a CREATE SINK with an empty schema", func() {
+			p.Buffer = `CREATE SINK a TYPE b SCHEMA ()`
+			p.Init()
+
+			Convey("Then it should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
 	})
 }
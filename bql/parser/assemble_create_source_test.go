@@ -10,12 +10,15 @@ func TestAssembleCreateSource(t *testing.T) {
 	Convey("Given a parseStack", t, func() {
 		ps := parseStack{}
 		Convey("When the stack contains the correct CREATE SOURCE items", func() {
+			ps.EnsureKeywordPresent(0, 0)
 			ps.PushComponent(0, 2, Yes)
+			ps.EnsureKeywordPresent(2, 2)
 			ps.PushComponent(2, 4, StreamIdentifier("a"))
 			ps.PushComponent(4, 6, SourceSinkType("b"))
-			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d")})
-			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f")})
+			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d"), nil})
+			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f"), nil})
 			ps.AssembleSourceSinkSpecs(6, 10)
+			ps.AssembleTimestampBy(10, 10)
 			ps.AssembleCreateSource()
 
 			Convey("Then AssembleCreateSource transforms them into one item", func() {
@@ -38,6 +41,7 @@ func TestAssembleCreateSource(t *testing.T) {
 						So(comp.Params[0].Value, ShouldEqual, data.String("d"))
 						So(comp.Params[1].Key, ShouldEqual, "e")
 						So(comp.Params[1].Value, ShouldEqual, data.String("f"))
+						So(comp.TimestampBy, ShouldBeNil)
 					})
 				})
 			})
@@ -52,12 +56,15 @@ func TestAssembleCreateSource(t *testing.T) {
 		})
 
 		Convey("When the stack contains a wrong item", func() {
+			ps.EnsureKeywordPresent(0, 0)
 			ps.PushComponent(0, 2, Yes)
+			ps.EnsureKeywordPresent(2, 2)
 			ps.PushComponent(2, 4, Raw{"a"}) // must be StreamIdentifier
 			ps.PushComponent(4, 6, SourceSinkType("b"))
-			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d")})
-			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f")})
+			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d"), nil})
+			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f"), nil})
 			ps.AssembleSourceSinkSpecs(6, 10)
+			ps.AssembleTimestampBy(10, 10)
 
 			Convey("Then AssembleCreateSource panics", func() {
 				So(ps.AssembleCreateSource, ShouldPanic)
@@ -97,5 +104,141 @@ func TestAssembleCreateSource(t *testing.T) {
 				})
 			})
 		})
+
+		Convey("When doing a CREATE SOURCE with modifiers", func() {
+			p.Buffer = `CREATE OR REPLACE PAUSED SOURCE IF NOT EXISTS a TYPE b`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, CreateSourceStmt{})
+				comp := top.(CreateSourceStmt)
+
+				So(comp.Paused, ShouldEqual, Yes)
+				So(comp.OrReplace, ShouldEqual, Yes)
+				So(comp.IfNotExists, ShouldEqual, Yes)
+				So(comp.Name, ShouldEqual, "a")
+				So(comp.Type, ShouldEqual, "b")
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When doing a CREATE SOURCE with a heartbeat", func() {
+			p.Buffer = `CREATE SOURCE a TYPE b WITH heartbeat="500ms", c=1`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, CreateSourceStmt{})
+				comp := top.(CreateSourceStmt)
+
+				So(len(comp.Params), ShouldEqual, 2)
+				So(comp.Params[0].Key, ShouldEqual, "heartbeat")
+				So(comp.Params[0].Value, ShouldEqual, data.String("500ms"))
+				So(comp.Params[1].Key, ShouldEqual, "c")
+				So(comp.Params[1].Value, ShouldEqual, data.Int(1))
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When doing a CREATE SOURCE with max_tuples", func() {
+			p.Buffer = `CREATE SOURCE a TYPE b WITH max_tuples=10, c=1`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, CreateSourceStmt{})
+				comp := top.(CreateSourceStmt)
+
+				So(len(comp.Params), ShouldEqual, 2)
+				So(comp.Params[0].Key, ShouldEqual, "max_tuples")
+				So(comp.Params[0].Value, ShouldEqual, data.Int(10))
+				So(comp.Params[1].Key, ShouldEqual, "c")
+				So(comp.Params[1].Value, ShouldEqual, data.Int(1))
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When doing a CREATE SOURCE with a WITH TIMESTAMP BY clause", func() {
+			p.Buffer = `CREATE SOURCE a TYPE b WITH allowed_lateness=2 WITH TIMESTAMP BY x:ts`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				comp := p.parseStack.Peek().comp.(CreateSourceStmt)
+				So(len(comp.Params), ShouldEqual, 1)
+				So(comp.Params[0].Key, ShouldEqual, "allowed_lateness")
+				So(comp.TimestampBy, ShouldResemble, RowValue{"x", "ts"})
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When doing a CREATE SOURCE with only a WITH TIMESTAMP BY clause", func() {
+			p.Buffer = `CREATE SOURCE a TYPE b WITH TIMESTAMP BY ts::timestamp`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				comp := p.parseStack.Peek().comp.(CreateSourceStmt)
+				So(comp.Params, ShouldBeEmpty)
+				So(comp.TimestampBy, ShouldResemble, TypeCastAST{RowValue{"", "ts"}, Timestamp})
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, `CREATE SOURCE a TYPE b WITH TIMESTAMP BY ts::TIMESTAMP`)
+				})
+			})
+		})
+
+		Convey("When doing a CREATE SOURCE with a numeric heartbeat", func() {
+			p.Buffer = `CREATE SOURCE a TYPE b WITH heartbeat=0.5`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				comp := p.parseStack.Peek().comp.(CreateSourceStmt)
+				So(len(comp.Params), ShouldEqual, 1)
+				So(comp.Params[0].Key, ShouldEqual, "heartbeat")
+				So(comp.Params[0].Value, ShouldEqual, data.Float(0.5))
+			})
+		})
 	})
 }
@@ -12,10 +12,12 @@ func TestAssembleCreateState(t *testing.T) {
 	Convey("Given a parseStack", t, func() {
 		ps := parseStack{}
 		Convey("When the stack contains the correct CREATE SINK items", func() {
+			ps.EnsureKeywordPresent(2, 2)
+			ps.EnsureKeywordPresent(2, 2)
 			ps.PushComponent(2, 4, StreamIdentifier("a"))
 			ps.PushComponent(4, 6, SourceSinkType("b"))
-			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d")})
-			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f")})
+			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d"), nil})
+			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f"), nil})
 			ps.AssembleSourceSinkSpecs(6, 10)
 			ps.AssembleCreateState()
 
@@ -52,10 +54,12 @@ func TestAssembleCreateState(t *testing.T) {
 		})
 
 		Convey("When the stack contains a wrong item", func() {
+			ps.EnsureKeywordPresent(2, 2)
+			ps.EnsureKeywordPresent(2, 2)
 			ps.PushComponent(2, 4, Raw{"a"}) // must be StreamIdentifier
 			ps.PushComponent(4, 6, SourceSinkType("b"))
-			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d")})
-			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f")})
+			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d"), nil})
+			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f"), nil})
 			ps.AssembleSourceSinkSpecs(6, 10)
 
 			Convey("Then AssembleCreateState panics", func() {
@@ -226,5 +230,22 @@ func TestAssembleCreateState(t *testing.T) {
 				})
 			})
 		})
+
+		Convey("When doing a CREATE STATE with modifiers", func() {
+			p.Buffer = "CREATE OR REPLACE STATE a TYPE b WITH c=1"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				comp := p.parseStack.Peek().comp.(CreateStateStmt)
+				So(comp.Name, ShouldEqual, "a")
+				So(comp.OrReplace, ShouldEqual, Yes)
+				So(comp.IfNotExists, ShouldEqual, UnspecifiedKeyword)
+				So(comp.String(), ShouldEqual, p.Buffer)
+			})
+		})
 	})
 }
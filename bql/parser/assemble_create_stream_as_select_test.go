@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"testing"
 )
 
@@ -9,7 +11,11 @@ func TestAssembleCreateStreamAsSelect(t *testing.T) {
 	Convey("Given a parseStack", t, func() {
 		ps := parseStack{}
 		Convey("When the stack contains the correct CREATE STREAM items", func() {
+			ps.EnsureKeywordPresent(2, 2)
+			ps.EnsureKeywordPresent(2, 2)
 			ps.PushComponent(2, 4, StreamIdentifier("x"))
+			ps.EnsureKeywordPresent(4, 4)
+			ps.AssembleSourceSinkSpecs(4, 4)
 			ps.PushComponent(4, 6, Istream)
 			ps.AssembleEmitterOptions(6, 6)
 			ps.AssembleEmitter()
@@ -18,19 +24,22 @@ func TestAssembleCreateStreamAsSelect(t *testing.T) {
 			ps.PushComponent(8, 9, Identifier("y"))
 			ps.AssembleAlias()
 			ps.AssembleProjections(6, 9)
-			ps.PushComponent(10, 11, Stream{ActualStream, "c", nil})
+			ps.PushComponent(10, 11, Stream{ActualStream, "c", nil, nil})
 			ps.PushComponent(11, 12, IntervalAST{FloatLiteral{3}, Tuples})
+			ps.EnsureSlideSpec(12, 12)
 			ps.PushComponent(12, 13, NumericLiteral{2})
-			ps.EnsureCapacitySpec(12, 13)
+			ps.EnsureCapacityUnit(13, 13)
+			ps.EnsureWindowCapacitySpec(12, 13)
 			ps.PushComponent(13, 14, DropOldest)
 			ps.EnsureSheddingSpec(13, 14)
 			ps.AssembleStreamWindow()
 			ps.EnsureAliasedStreamWindow()
-			ps.PushComponent(14, 15, Stream{ActualStream, "d", nil})
+			ps.PushComponent(14, 15, Stream{ActualStream, "d", nil, nil})
 			ps.PushComponent(16, 17, NumericLiteral{2})
 			ps.PushComponent(17, 18, Seconds)
 			ps.AssembleInterval()
-			ps.EnsureCapacitySpec(18, 18)
+			ps.EnsureSlideSpec(18, 18)
+			ps.EnsureWindowCapacitySpec(18, 18)
 			ps.EnsureSheddingSpec(18, 18)
 			ps.AssembleStreamWindow()
 			ps.PushComponent(18, 19, Identifier("x"))
@@ -44,6 +53,8 @@ func TestAssembleCreateStreamAsSelect(t *testing.T) {
 			ps.AssembleGrouping(21, 23)
 			ps.PushComponent(23, 24, RowValue{"", "h"})
 			ps.AssembleHaving(23, 24)
+			ps.AssembleOrderBy(24, 24)
+			ps.AssembleLimit(24, 24)
 			ps.AssembleSelect()
 			ps.AssembleCreateStreamAsSelect()
 
@@ -60,6 +71,7 @@ func TestAssembleCreateStreamAsSelect(t *testing.T) {
 					Convey("And it contains the previously pushed data", func() {
 						cssComp := top.comp.(CreateStreamAsSelectStmt)
 						So(cssComp.Name, ShouldEqual, "x")
+						So(cssComp.CaseInsensitive, ShouldEqual, UnspecifiedKeyword)
 						comp := cssComp.Select
 						So(comp.EmitterType, ShouldEqual, Istream)
 						So(len(comp.Projections), ShouldEqual, 2)
@@ -97,6 +109,8 @@ func TestAssembleCreateStreamAsSelect(t *testing.T) {
 		})
 
 		Convey("When the stack contains a wrong item", func() {
+			ps.EnsureKeywordPresent(2, 2)
+			ps.EnsureKeywordPresent(2, 2)
 			ps.PushComponent(2, 4, StreamIdentifier("x"))
 			ps.PushComponent(4, 6, Istream) // must be SELECT in correct stmt
 
@@ -125,6 +139,7 @@ func TestAssembleCreateStreamAsSelect(t *testing.T) {
 				cssComp := top.(CreateStreamAsSelectStmt)
 
 				So(cssComp.Name, ShouldEqual, "x_2")
+				So(cssComp.CaseInsensitive, ShouldEqual, UnspecifiedKeyword)
 				comp := cssComp.Select
 				So(comp.EmitterType, ShouldEqual, Istream)
 				So(len(comp.Projections), ShouldEqual, 3)
@@ -155,5 +170,123 @@ func TestAssembleCreateStreamAsSelect(t *testing.T) {
 				})
 			})
 		})
+
+		Convey("When specifying the case sensitivity", func() {
+			for _, c := range []struct {
+				option   string
+				expected BinaryKeyword
+			}{
+				{"CASE INSENSITIVE", Yes},
+				{"CASE SENSITIVE", No},
+			} {
+				c := c
+				Convey(fmt.Sprintf("with %v", c.option), func() {
+					p.Buffer = "CREATE STREAM x " + c.option + " AS SELECT ISTREAM temp FROM c [RANGE 1 TUPLES]"
+					p.Init()
+
+					Convey("Then the statement should be parsed correctly", func() {
+						err := p.Parse()
+						So(err, ShouldEqual, nil)
+						p.Execute()
+
+						ps := p.parseStack
+						So(ps.Len(), ShouldEqual, 1)
+						top := ps.Peek().comp
+						So(top, ShouldHaveSameTypeAs, CreateStreamAsSelectStmt{})
+						cssComp := top.(CreateStreamAsSelectStmt)
+						So(cssComp.Name, ShouldEqual, "x")
+						So(cssComp.CaseInsensitive, ShouldEqual, c.expected)
+						So(cssComp.Select.Projections[0], ShouldResemble, RowValue{"", "temp"})
+
+						Convey("And String() should return the original statement", func() {
+							So(cssComp.String(), ShouldEqual, p.Buffer)
+						})
+					})
+				})
+			}
+		})
+
+		Convey("When specifying modifiers", func() {
+			for _, c := range []struct {
+				stmt     string
+				expected CreateModifierAST
+			}{
+				{"CREATE OR REPLACE STREAM x AS SELECT ISTREAM a FROM c [RANGE 1 TUPLES]",
+					CreateModifierAST{Yes, UnspecifiedKeyword}},
+				{"CREATE STREAM IF NOT EXISTS x AS SELECT ISTREAM a FROM c [RANGE 1 TUPLES]",
+					CreateModifierAST{UnspecifiedKeyword, Yes}},
+				{"CREATE STREAM x AS SELECT ISTREAM a FROM c [RANGE 1 TUPLES] UNION ALL SELECT ISTREAM a FROM d [RANGE 1 TUPLES]",
+					CreateModifierAST{}},
+				{"CREATE OR REPLACE STREAM IF NOT EXISTS x AS SELECT ISTREAM a FROM c [RANGE 1 TUPLES] UNION ALL SELECT ISTREAM a FROM d [RANGE 1 TUPLES]",
+					CreateModifierAST{Yes, Yes}},
+			} {
+				c := c
+				Convey(fmt.Sprintf("with %v", c.stmt), func() {
+					p.Buffer = c.stmt
+					p.Init()
+
+					Convey("Then the statement should be parsed correctly", func() {
+						So(p.Parse(), ShouldBeNil)
+						p.Execute()
+
+						ps := p.parseStack
+						So(ps.Len(), ShouldEqual, 1)
+						var stmt fmt.Stringer
+						switch s := ps.Peek().comp.(type) {
+						case CreateStreamAsSelectStmt:
+							So(s.Name, ShouldEqual, "x")
+							So(s.CreateModifierAST, ShouldResemble, c.expected)
+							stmt = s
+						case CreateStreamAsSelectUnionStmt:
+							So(s.Name, ShouldEqual, "x")
+							So(s.CreateModifierAST, ShouldResemble, c.expected)
+							stmt = s
+						default:
+							So(s, ShouldHaveSameTypeAs, CreateStreamAsSelectStmt{})
+						}
+
+						Convey("And String() should return the original statement", func() {
+							So(stmt.String(), ShouldEqual, p.Buffer)
+						})
+					})
+				})
+			}
+		})
+
+		Convey("When specifying modifiers in a wrong order", func() {
+			p.Buffer = "CREATE STREAM OR REPLACE x AS SELECT ISTREAM a FROM c [RANGE 1 TUPLES]"
+			p.Init()
+
+			Convey("Then it should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When specifying options of the stream", func() {
+			p.Buffer = `CREATE STREAM x CASE INSENSITIVE WITH processing_timeout=0.5, foo="bar" AS SELECT ISTREAM a FROM c [RANGE 1 TUPLES]`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, CreateStreamAsSelectStmt{})
+				cssComp := top.(CreateStreamAsSelectStmt)
+				So(cssComp.Name, ShouldEqual, "x")
+				So(cssComp.CaseInsensitive, ShouldEqual, Yes)
+				So(cssComp.Params, ShouldResemble, []SourceSinkParamAST{
+					{"processing_timeout", data.Float(0.5), nil},
+					{"foo", data.String("bar"), nil},
+				})
+
+				Convey("And String() should return the original statement", func() {
+					So(cssComp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
 	})
 }
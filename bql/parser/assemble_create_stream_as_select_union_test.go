@@ -9,6 +9,8 @@ func TestAssembleCreateStreamAsSelectUnion(t *testing.T) {
 	Convey("Given a parseStack", t, func() {
 		ps := parseStack{}
 		Convey("When the stack contains the correct CREATE STREAM items", func() {
+			ps.EnsureKeywordPresent(2, 2)
+			ps.EnsureKeywordPresent(2, 2)
 			ps.PushComponent(2, 4, StreamIdentifier("x"))
 			ps.PushComponent(4, 6, Istream)
 			ps.AssembleEmitterOptions(6, 6)
@@ -18,19 +20,22 @@ func TestAssembleCreateStreamAsSelectUnion(t *testing.T) {
 			ps.PushComponent(8, 9, Identifier("y"))
 			ps.AssembleAlias()
 			ps.AssembleProjections(6, 9)
-			ps.PushComponent(10, 11, Stream{ActualStream, "c", nil})
+			ps.PushComponent(10, 11, Stream{ActualStream, "c", nil, nil})
 			ps.PushComponent(11, 12, IntervalAST{FloatLiteral{3}, Tuples})
+			ps.EnsureSlideSpec(12, 12)
 			ps.PushComponent(12, 13, NumericLiteral{2})
-			ps.EnsureCapacitySpec(12, 13)
+			ps.EnsureCapacityUnit(13, 13)
+			ps.EnsureWindowCapacitySpec(12, 13)
 			ps.PushComponent(13, 14, DropOldest)
 			ps.EnsureSheddingSpec(13, 14)
 			ps.AssembleStreamWindow()
 			ps.EnsureAliasedStreamWindow()
-			ps.PushComponent(14, 15, Stream{ActualStream, "d", nil})
+			ps.PushComponent(14, 15, Stream{ActualStream, "d", nil, nil})
 			ps.PushComponent(16, 17, NumericLiteral{2})
 			ps.PushComponent(17, 18, Seconds)
 			ps.AssembleInterval()
-			ps.EnsureCapacitySpec(18, 18)
+			ps.EnsureSlideSpec(18, 18)
+			ps.EnsureWindowCapacitySpec(18, 18)
 			ps.EnsureSheddingSpec(18, 18)
 			ps.AssembleStreamWindow()
 			ps.PushComponent(18, 19, Identifier("x"))
@@ -44,6 +49,8 @@ func TestAssembleCreateStreamAsSelectUnion(t *testing.T) {
 			ps.AssembleGrouping(21, 23)
 			ps.PushComponent(23, 24, RowValue{"", "h"})
 			ps.AssembleHaving(23, 24)
+			ps.AssembleOrderBy(24, 24)
+			ps.AssembleLimit(24, 24)
 			ps.AssembleSelect()
 			ps.AssembleSelectUnion(4, 24)
 			ps.AssembleCreateStreamAsSelectUnion()
@@ -99,6 +106,8 @@ func TestAssembleCreateStreamAsSelectUnion(t *testing.T) {
 		})
 
 		Convey("When the stack contains a wrong item", func() {
+			ps.EnsureKeywordPresent(2, 2)
+			ps.EnsureKeywordPresent(2, 2)
 			ps.PushComponent(2, 4, StreamIdentifier("x"))
 			ps.PushComponent(4, 6, Istream) // must be SELECT in correct stmt
 
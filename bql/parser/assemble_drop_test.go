@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
 )
@@ -10,6 +11,8 @@ func TestAssembleDropSource(t *testing.T) {
 		ps := parseStack{}
 		Convey("When the stack contains the correct DROP SOURCE items", func() {
 			ps.PushComponent(2, 4, StreamIdentifier("a"))
+			ps.EnsureKeywordPresent(4, 4)
+			ps.EnsureKeywordPresent(4, 4)
 			ps.AssembleDropSource()
 
 			Convey("Then AssembleDropSource transforms them into one item", func() {
@@ -32,6 +35,8 @@ func TestAssembleDropSource(t *testing.T) {
 
 		Convey("When the stack contains a wrong item", func() {
 			ps.PushComponent(2, 4, Raw{"a"}) // must be StreamIdentifier
+			ps.EnsureKeywordPresent(4, 4)
+			ps.EnsureKeywordPresent(4, 4)
 
 			Convey("Then AssembleDropSource panics", func() {
 				So(ps.AssembleDropSource, ShouldPanic)
@@ -72,6 +77,8 @@ func TestAssembleDropStream(t *testing.T) {
 		ps := parseStack{}
 		Convey("When the stack contains the correct DROP STREAM items", func() {
 			ps.PushComponent(2, 4, StreamIdentifier("a"))
+			ps.EnsureKeywordPresent(4, 4)
+			ps.EnsureKeywordPresent(4, 4)
 			ps.AssembleDropStream()
 
 			Convey("Then AssembleDropStream transforms them into one item", func() {
@@ -94,6 +101,8 @@ func TestAssembleDropStream(t *testing.T) {
 
 		Convey("When the stack contains a wrong item", func() {
 			ps.PushComponent(2, 4, Raw{"a"}) // must be StreamIdentifier
+			ps.EnsureKeywordPresent(4, 4)
+			ps.EnsureKeywordPresent(4, 4)
 
 			Convey("Then AssembleDropStream panics", func() {
 				So(ps.AssembleDropStream, ShouldPanic)
@@ -120,12 +129,53 @@ func TestAssembleDropStream(t *testing.T) {
 				comp := top.(DropStreamStmt)
 
 				So(comp.Stream, ShouldEqual, "a_1")
+				So(comp.IfExists, ShouldEqual, UnspecifiedKeyword)
+				So(comp.Cascade, ShouldEqual, UnspecifiedKeyword)
 
 				Convey("And String() should return the original statement", func() {
 					So(comp.String(), ShouldEqual, p.Buffer)
 				})
 			})
 		})
+
+		Convey("When doing a DROP STREAM with modifiers", func() {
+			for _, c := range []struct {
+				stmt     string
+				expected DropModifierAST
+			}{
+				{"DROP STREAM a_1 IF EXISTS", DropModifierAST{Yes, UnspecifiedKeyword}},
+				{"DROP STREAM a_1 CASCADE", DropModifierAST{UnspecifiedKeyword, Yes}},
+				{"DROP STREAM a_1 IF EXISTS CASCADE", DropModifierAST{Yes, Yes}},
+			} {
+				c := c
+				Convey(fmt.Sprintf("with %v", c.stmt), func() {
+					p.Buffer = c.stmt
+					p.Init()
+
+					Convey("Then the statement should be parsed correctly", func() {
+						So(p.Parse(), ShouldBeNil)
+						p.Execute()
+
+						comp := p.parseStack.Peek().comp.(DropStreamStmt)
+						So(comp.Stream, ShouldEqual, "a_1")
+						So(comp.DropModifierAST, ShouldResemble, c.expected)
+
+						Convey("And String() should return the original statement", func() {
+							So(comp.String(), ShouldEqual, p.Buffer)
+						})
+					})
+				})
+			}
+		})
+
+		Convey("When doing a DROP STREAM with modifiers in a wrong order", func() {
+			p.Buffer = "DROP STREAM a_1 CASCADE IF EXISTS"
+			p.Init()
+
+			Convey("Then it should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
 	})
 }
 
@@ -134,6 +184,7 @@ func TestAssembleDropSink(t *testing.T) {
 		ps := parseStack{}
 		Convey("When the stack contains the correct DROP SINK items", func() {
 			ps.PushComponent(2, 4, StreamIdentifier("a"))
+			ps.EnsureKeywordPresent(4, 4)
 			ps.AssembleDropSink()
 
 			Convey("Then AssembleDropSink transforms them into one item", func() {
@@ -156,6 +207,7 @@ func TestAssembleDropSink(t *testing.T) {
 
 		Convey("When the stack contains a wrong item", func() {
 			ps.PushComponent(2, 4, Raw{"a"}) // must be StreamIdentifier
+			ps.EnsureKeywordPresent(4, 4)
 
 			Convey("Then AssembleDropSink panics", func() {
 				So(ps.AssembleDropSink, ShouldPanic)
@@ -196,6 +248,7 @@ func TestAssembleDropState(t *testing.T) {
 		ps := parseStack{}
 		Convey("When the stack contains the correct DROP STATE items", func() {
 			ps.PushComponent(2, 4, StreamIdentifier("a"))
+			ps.EnsureKeywordPresent(4, 4)
 			ps.AssembleDropState()
 
 			Convey("Then AssembleDropState transforms them into one item", func() {
@@ -218,6 +271,7 @@ func TestAssembleDropState(t *testing.T) {
 
 		Convey("When the stack contains a wrong item", func() {
 			ps.PushComponent(2, 4, Raw{"a"}) // must be StreamIdentifier
+			ps.EnsureKeywordPresent(4, 4)
 
 			Convey("Then AssembleDropState panics", func() {
 				So(ps.AssembleDropState, ShouldPanic)
@@ -250,5 +304,29 @@ func TestAssembleDropState(t *testing.T) {
 				})
 			})
 		})
+
+		Convey("When doing a DROP STATE with IF EXISTS", func() {
+			p.Buffer = "DROP STATE a_1 IF EXISTS"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				So(p.Parse(), ShouldBeNil)
+				p.Execute()
+
+				comp := p.parseStack.Peek().comp.(DropStateStmt)
+				So(comp.State, ShouldEqual, "a_1")
+				So(comp.IfExists, ShouldEqual, Yes)
+				So(comp.String(), ShouldEqual, p.Buffer)
+			})
+		})
+
+		Convey("When doing a DROP STATE with CASCADE", func() {
+			p.Buffer = "DROP STATE a_1 CASCADE"
+			p.Init()
+
+			Convey("Then it should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
 	})
 }
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAssembleDroppedTuplesStream(t *testing.T) {
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+
+		Convey("When the stack contains an actual stream", func() {
+			ps.PushComponent(0, 3, NewStream("box"))
+			ps.AssembleDroppedTuplesStream()
+
+			Convey("Then AssembleDroppedTuplesStream replaces it with a new item", func() {
+				So(ps.Len(), ShouldEqual, 1)
+
+				Convey("And that item is a Stream of dropped tuples", func() {
+					top := ps.Peek()
+					So(top, ShouldNotBeNil)
+					So(top.begin, ShouldEqual, 0)
+					So(top.end, ShouldEqual, 3)
+					So(top.comp, ShouldResemble, Stream{DroppedTuplesStream, "box", nil, nil})
+				})
+			})
+		})
+
+		Convey("When the stack contains a UDSF", func() {
+			ps.PushComponent(2, 6, Stream{UDSFStream, "udsf", nil, nil})
+			ps.AssembleDroppedTuplesStream()
+
+			Convey("Then AssembleDroppedTuplesStream reports an error", func() {
+				So(ps.err, ShouldNotBeNil)
+				So(ps.err.pos, ShouldEqual, 2)
+				So(ps.err.err.Error(), ShouldEqual, "DROPPED TUPLES can only be used with the name of a node")
+			})
+		})
+	})
+
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		Convey("When parsing a SELECT statement reading dropped tuples", func() {
+			p.Buffer = "SELECT ISTREAM node_name, error FROM box DROPPED TUPLES [RANGE 1 TUPLES] AS d"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, SelectStmt{})
+				s := top.(SelectStmt)
+				So(len(s.Relations), ShouldEqual, 1)
+				comp := s.Relations[0]
+				So(comp.Type, ShouldEqual, DroppedTuplesStream)
+				So(comp.Name, ShouldEqual, "box")
+				So(comp.Alias, ShouldEqual, "d")
+
+				Convey("And String() should return the original statement", func() {
+					So(s.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When parsing DROPPED TUPLES applied to a UDSF", func() {
+			p.Buffer = "SELECT ISTREAM x FROM udsf(1) DROPPED TUPLES [RANGE 1 TUPLES]"
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+	})
+}
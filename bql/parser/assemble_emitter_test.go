@@ -80,7 +80,7 @@ func TestAssembleEmitter(t *testing.T) {
 					Convey("And it contains the previously pushed data", func() {
 						comp := top.comp.(EmitterAST)
 						So(comp.EmitterType, ShouldEqual, Istream)
-						So(comp.EmitterOptions, ShouldResemble, []interface{}{EmitterSampling{7, CountBasedSampling}})
+						So(comp.EmitterOptions, ShouldResemble, []interface{}{EmitterSampling{7, CountBasedSampling, UnspecifiedSeed}})
 					})
 				})
 			})
@@ -110,7 +110,7 @@ func TestAssembleEmitter(t *testing.T) {
 						comp := top.comp.(EmitterAST)
 						So(comp.EmitterType, ShouldEqual, Istream)
 						So(comp.EmitterOptions, ShouldResemble, []interface{}{
-							EmitterSampling{2, CountBasedSampling}, EmitterLimit{7}})
+							EmitterSampling{2, CountBasedSampling, UnspecifiedSeed}, EmitterLimit{7}})
 					})
 				})
 			})
@@ -198,7 +198,7 @@ func TestAssembleEmitter(t *testing.T) {
 				So(comp.Name, ShouldEqual, "x")
 				So(comp.Select.EmitterType, ShouldEqual, Istream)
 				So(comp.Select.EmitterOptions, ShouldResemble, []interface{}{
-					EmitterSampling{2, CountBasedSampling}})
+					EmitterSampling{2, CountBasedSampling, UnspecifiedSeed}})
 
 				Convey("And String() should return the original statement", func() {
 					So(comp.String(), ShouldEqual, p.Buffer)
@@ -224,7 +224,7 @@ func TestAssembleEmitter(t *testing.T) {
 				So(comp.Name, ShouldEqual, "x")
 				So(comp.Select.EmitterType, ShouldEqual, Istream)
 				So(comp.Select.EmitterOptions, ShouldResemble, []interface{}{
-					EmitterSampling{0.2, TimeBasedSampling}})
+					EmitterSampling{0.2, TimeBasedSampling, UnspecifiedSeed}})
 
 				Convey("And String() should return the original statement", func() {
 					So(comp.String(), ShouldEqual, p.Buffer)
@@ -250,7 +250,7 @@ func TestAssembleEmitter(t *testing.T) {
 				So(comp.Name, ShouldEqual, "x")
 				So(comp.Select.EmitterType, ShouldEqual, Istream)
 				So(comp.Select.EmitterOptions, ShouldResemble, []interface{}{
-					EmitterSampling{0.0025, TimeBasedSampling}})
+					EmitterSampling{0.0025, TimeBasedSampling, UnspecifiedSeed}})
 
 				Convey("And String() should almost return the original statement", func() {
 					So(comp.String(), ShouldEqual, p.Buffer)
@@ -276,7 +276,7 @@ func TestAssembleEmitter(t *testing.T) {
 				So(comp.Name, ShouldEqual, "x")
 				So(comp.Select.EmitterType, ShouldEqual, Istream)
 				So(comp.Select.EmitterOptions, ShouldResemble, []interface{}{
-					EmitterSampling{2, TimeBasedSampling}})
+					EmitterSampling{2, TimeBasedSampling, UnspecifiedSeed}})
 
 				Convey("And String() should return the original statement", func() {
 					So(comp.String(), ShouldEqual, p.Buffer)
@@ -302,7 +302,7 @@ func TestAssembleEmitter(t *testing.T) {
 				So(comp.Name, ShouldEqual, "x")
 				So(comp.Select.EmitterType, ShouldEqual, Istream)
 				So(comp.Select.EmitterOptions, ShouldResemble, []interface{}{
-					EmitterSampling{2.5, TimeBasedSampling}})
+					EmitterSampling{2.5, TimeBasedSampling, UnspecifiedSeed}})
 
 				Convey("And String() should return the original statement", func() {
 					So(comp.String(), ShouldEqual, p.Buffer)
@@ -328,7 +328,7 @@ func TestAssembleEmitter(t *testing.T) {
 				So(comp.Name, ShouldEqual, "x")
 				So(comp.Select.EmitterType, ShouldEqual, Istream)
 				So(comp.Select.EmitterOptions, ShouldResemble, []interface{}{
-					EmitterSampling{20, RandomizedSampling}})
+					EmitterSampling{20, RandomizedSampling, UnspecifiedSeed}})
 
 				Convey("And String() should return the original statement", func() {
 					So(comp.String(), ShouldEqual, p.Buffer)
@@ -354,7 +354,7 @@ func TestAssembleEmitter(t *testing.T) {
 				So(comp.Name, ShouldEqual, "x")
 				So(comp.Select.EmitterType, ShouldEqual, Istream)
 				So(comp.Select.EmitterOptions, ShouldResemble, []interface{}{
-					EmitterSampling{0.01, RandomizedSampling}})
+					EmitterSampling{0.01, RandomizedSampling, UnspecifiedSeed}})
 
 				Convey("And String() should return the original statement", func() {
 					So(comp.String(), ShouldEqual, p.Buffer)
@@ -362,6 +362,50 @@ func TestAssembleEmitter(t *testing.T) {
 			})
 		})
 
+		Convey("When using ISTREAM with a SAMPLE specifier with a seed", func() {
+			p.Buffer = "CREATE STREAM x AS SELECT ISTREAM [SAMPLE 20% SEED 42 LIMIT 7] 2 FROM a [RANGE 1 TUPLES]"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, CreateStreamAsSelectStmt{})
+				comp := top.(CreateStreamAsSelectStmt)
+
+				So(comp.Name, ShouldEqual, "x")
+				So(comp.Select.EmitterType, ShouldEqual, Istream)
+				So(comp.Select.EmitterOptions, ShouldResemble, []interface{}{
+					EmitterSampling{20, RandomizedSampling, 42}, EmitterLimit{7}})
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When using a seed with a non-randomized sampling", func() {
+			p.Buffer = "CREATE STREAM x AS SELECT ISTREAM [EVERY 4-TH TUPLE SEED 42] 2 FROM a [RANGE 1 TUPLES]"
+			p.Init()
+
+			Convey("Then the statement should not be parsed", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When using a negative seed", func() {
+			p.Buffer = "CREATE STREAM x AS SELECT ISTREAM [SAMPLE 20% SEED -1] 2 FROM a [RANGE 1 TUPLES]"
+			p.Init()
+
+			Convey("Then the statement should not be parsed", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+
 		Convey("When using ISTREAM with EVERY and LIMIT specifier", func() {
 			p.Buffer = "CREATE STREAM x AS SELECT ISTREAM [EVERY 4-TH TUPLE LIMIT 7] 2 FROM a [RANGE 1 TUPLES]"
 			p.Init()
@@ -380,12 +424,61 @@ func TestAssembleEmitter(t *testing.T) {
 				So(comp.Name, ShouldEqual, "x")
 				So(comp.Select.EmitterType, ShouldEqual, Istream)
 				So(comp.Select.EmitterOptions, ShouldResemble, []interface{}{
-					EmitterSampling{4, CountBasedSampling}, EmitterLimit{7}})
+					EmitterSampling{4, CountBasedSampling, UnspecifiedSeed}, EmitterLimit{7}})
 
 				Convey("And String() should return the original statement", func() {
 					So(comp.String(), ShouldEqual, p.Buffer)
 				})
 			})
 		})
+
+		Convey("When using an empty window specifier", func() {
+			cases := []struct {
+				opts     string
+				expected []interface{}
+			}{
+				{"SKIP EMPTY", []interface{}{EmitterEmptyWindow{true}}},
+				{"EMIT EMPTY", []interface{}{EmitterEmptyWindow{false}}},
+				{"SKIP EMPTY LIMIT 7", []interface{}{EmitterEmptyWindow{true}, EmitterLimit{7}}},
+				{"EMIT EMPTY EVERY 4-TH TUPLE LIMIT 7", []interface{}{
+					EmitterEmptyWindow{false}, EmitterSampling{4, CountBasedSampling, UnspecifiedSeed}, EmitterLimit{7}}},
+			}
+
+			for _, c := range cases {
+				c := c
+				Convey("And the option is "+c.opts, func() {
+					p.Buffer = "CREATE STREAM x AS SELECT RSTREAM [" + c.opts + "] count(1) FROM a [RANGE 1 TUPLES]"
+					p.Init()
+
+					Convey("Then the statement should be parsed correctly", func() {
+						err := p.Parse()
+						So(err, ShouldEqual, nil)
+						p.Execute()
+
+						ps := p.parseStack
+						So(ps.Len(), ShouldEqual, 1)
+						top := ps.Peek().comp
+						So(top, ShouldHaveSameTypeAs, CreateStreamAsSelectStmt{})
+						comp := top.(CreateStreamAsSelectStmt)
+
+						So(comp.Select.EmitterType, ShouldEqual, Rstream)
+						So(comp.Select.EmitterOptions, ShouldResemble, c.expected)
+
+						Convey("And String() should return the original statement", func() {
+							So(comp.String(), ShouldEqual, p.Buffer)
+						})
+					})
+				})
+			}
+		})
+
+		Convey("When using an empty window specifier after LIMIT", func() {
+			p.Buffer = "CREATE STREAM x AS SELECT RSTREAM [LIMIT 7 SKIP EMPTY] count(1) FROM a [RANGE 1 TUPLES]"
+			p.Init()
+
+			Convey("Then the statement should not be parsed", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
 	})
 }
@@ -35,7 +35,7 @@ func TestAssembleEval(t *testing.T) {
 		Convey("When the stack contains two expressions", func() {
 			ps.PushComponent(2, 4, Raw{"PRE"})
 			ps.PushComponent(4, 6, RowValue{"", "a"})
-			ps.PushComponent(6, 8, MapAST{[]KeyValuePairAST{{"a", NumericLiteral{2}}}})
+			ps.PushComponent(6, 8, MapAST{[]KeyValuePairAST{{"a", NumericLiteral{2}, nil}}})
 			ps.AssembleEval(6, 8)
 
 			Convey("Then AssembleEval transforms them into one item", func() {
@@ -51,7 +51,7 @@ func TestAssembleEval(t *testing.T) {
 					Convey("And it contains the previously pushed data", func() {
 						comp := top.comp.(EvalStmt)
 						So(comp.Expr, ShouldResemble, RowValue{"", "a"})
-						So(*comp.Input, ShouldResemble, MapAST{[]KeyValuePairAST{{"a", NumericLiteral{2}}}})
+						So(*comp.Input, ShouldResemble, MapAST{[]KeyValuePairAST{{"a", NumericLiteral{2}, nil}}})
 					})
 				})
 			})
@@ -119,7 +119,7 @@ func TestAssembleEval(t *testing.T) {
 				comp := top.(EvalStmt)
 
 				So(comp.Expr, ShouldResemble, RowValue{"", "a"})
-				So(*comp.Input, ShouldResemble, MapAST{[]KeyValuePairAST{{"a", NumericLiteral{2}}}})
+				So(*comp.Input, ShouldResemble, MapAST{[]KeyValuePairAST{{"a", NumericLiteral{2}, nil}}})
 
 				Convey("And String() should return the original statement", func() {
 					So(comp.String(), ShouldEqual, p.Buffer)
@@ -0,0 +1,83 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAssembleExplain(t *testing.T) {
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+		Convey("When the stack contains the correct EXPLAIN items", func() {
+			ps.PushComponent(8, 20, SelectStmt{ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "x"}}, false}})
+			ps.AssembleExplain(0, 20)
+
+			Convey("Then AssembleExplain transforms them into one item", func() {
+				So(ps.Len(), ShouldEqual, 1)
+
+				Convey("And that item is an ExplainStmt", func() {
+					top := ps.Peek()
+					So(top, ShouldNotBeNil)
+					So(top.begin, ShouldEqual, 0)
+					So(top.end, ShouldEqual, 20)
+					So(top.comp, ShouldHaveSameTypeAs, ExplainStmt{})
+
+					Convey("And it contains the previously pushed data", func() {
+						comp := top.comp.(ExplainStmt)
+						So(comp.Select.Projections, ShouldResemble, []Expression{RowValue{"", "x"}})
+					})
+				})
+			})
+		})
+
+		Convey("When the stack contains a wrong item", func() {
+			ps.PushComponent(8, 20, Raw{"SELECT"}) // must be SelectStmt
+
+			Convey("Then AssembleExplain panics", func() {
+				So(func() { ps.AssembleExplain(0, 20) }, ShouldPanic)
+			})
+		})
+	})
+
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		for _, stmt := range []string{
+			"EXPLAIN SELECT ISTREAM a, count(*) FROM s [RANGE 2 SECONDS] WHERE b > 1 GROUP BY a",
+			"EXPLAIN WITH a AS (SELECT ISTREAM x FROM s [RANGE 1 TUPLES]) SELECT ISTREAM x FROM a [RANGE 1 TUPLES]",
+		} {
+			stmt := stmt
+			Convey("When doing a full "+stmt, func() {
+				p.Buffer = stmt
+				p.Init()
+
+				Convey("Then the statement should be parsed correctly", func() {
+					err := p.Parse()
+					So(err, ShouldEqual, nil)
+					p.Execute()
+
+					ps := p.parseStack
+					So(ps.Len(), ShouldEqual, 1)
+					top := ps.Peek().comp
+					So(top, ShouldHaveSameTypeAs, ExplainStmt{})
+					comp := top.(ExplainStmt)
+
+					So(comp.Select.Relations[0].Name, ShouldNotBeBlank)
+
+					Convey("And String() should return the original statement", func() {
+						So(comp.String(), ShouldEqual, p.Buffer)
+					})
+				})
+			})
+		}
+
+		Convey("When explaining a statement other than SELECT", func() {
+			p.Buffer = "EXPLAIN CREATE STREAM s AS SELECT ISTREAM x FROM t [RANGE 1 TUPLES]"
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+	})
+}
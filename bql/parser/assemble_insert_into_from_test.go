@@ -11,6 +11,7 @@ func TestAssembleInsertIntoFrom(t *testing.T) {
 		Convey("When the stack contains the correct SELECT items with a Interval specification", func() {
 			ps.PushComponent(4, 5, StreamIdentifier("x"))
 			ps.PushComponent(5, 6, StreamIdentifier("y"))
+			ps.PushComponent(6, 6, UnspecifiedKeyword)
 			ps.AssembleInsertIntoFrom()
 
 			Convey("Then AssembleInsertIntoFrom transforms them into one item", func() {
@@ -27,6 +28,7 @@ func TestAssembleInsertIntoFrom(t *testing.T) {
 						comp := top.comp.(InsertIntoFromStmt)
 						So(comp.Sink, ShouldEqual, "x")
 						So(comp.Input, ShouldEqual, "y")
+						So(comp.DryRun, ShouldEqual, UnspecifiedKeyword)
 					})
 				})
 			})
@@ -34,6 +36,7 @@ func TestAssembleInsertIntoFrom(t *testing.T) {
 
 		Convey("When the stack does not contain enough items", func() {
 			ps.PushComponent(4, 5, StreamIdentifier("x"))
+			ps.PushComponent(5, 6, StreamIdentifier("y"))
 			Convey("Then AssembleInsertIntoFrom panics", func() {
 				So(ps.AssembleInsertIntoFrom, ShouldPanic)
 			})
@@ -42,6 +45,7 @@ func TestAssembleInsertIntoFrom(t *testing.T) {
 		Convey("When the stack contains a wrong item", func() {
 			ps.PushComponent(4, 5, StreamIdentifier("x"))
 			ps.PushComponent(5, 6, Istream) // must be StreamIdentifier
+			ps.PushComponent(6, 6, UnspecifiedKeyword)
 			Convey("Then AssembleInsertIntoFrom panics", func() {
 				So(ps.AssembleInsertIntoFrom, ShouldPanic)
 			})
@@ -70,6 +74,45 @@ func TestAssembleInsertIntoFrom(t *testing.T) {
 
 				So(comp.Sink, ShouldEqual, "x")
 				So(comp.Input, ShouldEqual, "y")
+				So(comp.DryRun, ShouldEqual, UnspecifiedKeyword)
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When doing an INSERT INTO FROM with DRY RUN", func() {
+			p.Buffer = "INSERT INTO x FROM y DRY RUN"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek()
+				So(top.end, ShouldEqual, len(p.Buffer))
+				comp := top.comp.(InsertIntoFromStmt)
+
+				So(comp.Sink, ShouldEqual, "x")
+				So(comp.Input, ShouldEqual, "y")
+				So(comp.DryRun, ShouldEqual, Yes)
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When doing an INSERT INTO FROM with an incomplete DRY RUN", func() {
+			p.Buffer = "INSERT INTO x FROM y DRY"
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
 			})
 		})
 	})
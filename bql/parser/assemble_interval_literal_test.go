@@ -0,0 +1,83 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAssembleIntervalLiteral(t *testing.T) {
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+
+		Convey("When the stack contains numbers and fields", func() {
+			ps.PushComponent(9, 10, NumericLiteral{1})
+			ps.PushComponent(11, 15, HourField)
+			ps.PushComponent(16, 19, FloatLiteral{2.5})
+			ps.PushComponent(20, 27, MinuteField)
+			ps.AssembleIntervalLiteral(0, 27)
+
+			Convey("Then AssembleIntervalLiteral replaces them with the sum", func() {
+				So(ps.err, ShouldBeNil)
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek()
+				So(top.begin, ShouldEqual, 0)
+				So(top.end, ShouldEqual, 27)
+				So(top.comp, ShouldResemble, IntervalLiteral{time.Hour + 150*time.Second})
+			})
+		})
+
+		Convey("When the stack contains a string and fields", func() {
+			ps.PushComponent(9, 16, StringLiteral{"1:2:3"})
+			ps.PushComponent(17, 21, HourField)
+			ps.PushComponent(25, 31, SecondField)
+			ps.AssembleIntervalLiteral(0, 31)
+
+			Convey("Then AssembleIntervalLiteral parses the string", func() {
+				So(ps.err, ShouldBeNil)
+				So(ps.Len(), ShouldEqual, 1)
+				So(ps.Peek().comp, ShouldResemble, IntervalLiteral{time.Hour + 2*time.Minute + 3*time.Second})
+			})
+		})
+
+		Convey("When the stack contains an invalid string", func() {
+			ps.PushComponent(9, 16, StringLiteral{"1:2:x"})
+			ps.PushComponent(17, 21, HourField)
+			ps.PushComponent(25, 31, SecondField)
+			ps.AssembleIntervalLiteral(0, 31)
+
+			Convey("Then AssembleIntervalLiteral reports an error", func() {
+				So(ps.err, ShouldNotBeNil)
+				So(ps.Len(), ShouldEqual, 1)
+				So(ps.Peek().comp, ShouldResemble, IntervalLiteral{})
+			})
+		})
+	})
+}
+
+func TestIntervalLiteralString(t *testing.T) {
+	Convey("Given interval literals", t, func() {
+		for _, d := range []time.Duration{
+			0,
+			time.Nanosecond,
+			-time.Nanosecond,
+			time.Second,
+			49*time.Hour + 59*time.Minute + 59*time.Second + 999999999,
+			-36 * time.Hour,
+			math.MaxInt64,
+			math.MinInt64,
+		} {
+			l := IntervalLiteral{d}
+
+			Convey("When parsing the string representation of "+d.String(), func() {
+				stmt, _, err := New().ParseStmt("EVAL " + l.String())
+
+				Convey("Then the same literal should be parsed", func() {
+					So(err, ShouldBeNil)
+					So(stmt.(EvalStmt).Expr, ShouldResemble, l)
+				})
+			})
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAssembleLoadPlugin(t *testing.T) {
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+		Convey("When the stack contains the correct LOAD PLUGIN items", func() {
+			ps.PushComponent(12, 25, StringLiteral{"/tmp/a.so"})
+			ps.AssembleLoadPlugin()
+
+			Convey("Then AssembleLoadPlugin transforms them into one item", func() {
+				So(ps.Len(), ShouldEqual, 1)
+
+				Convey("And that item is a LoadPluginStmt", func() {
+					top := ps.Peek()
+					So(top, ShouldNotBeNil)
+					So(top.begin, ShouldEqual, 12)
+					So(top.end, ShouldEqual, 25)
+					So(top.comp, ShouldHaveSameTypeAs, LoadPluginStmt{})
+
+					Convey("And it contains the previously pushed data", func() {
+						comp := top.comp.(LoadPluginStmt)
+						So(comp.Path, ShouldEqual, "/tmp/a.so")
+					})
+				})
+			})
+		})
+
+		Convey("When the stack contains a wrong item", func() {
+			ps.PushComponent(12, 13, Identifier("a")) // must be StringLiteral
+
+			Convey("Then AssembleLoadPlugin panics", func() {
+				So(ps.AssembleLoadPlugin, ShouldPanic)
+			})
+		})
+	})
+
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		Convey("When doing a full LOAD PLUGIN", func() {
+			p.Buffer = `LOAD PLUGIN "/usr/lib/sensorbee/my""plugin.so"`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, LoadPluginStmt{})
+				comp := top.(LoadPluginStmt)
+
+				So(comp.Path, ShouldEqual, `/usr/lib/sensorbee/my"plugin.so`)
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When the path isn't a string", func() {
+			p.Buffer = "LOAD PLUGIN plugin"
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -14,8 +14,8 @@ func TestAssembleLoadState(t *testing.T) {
 			ps.PushComponent(2, 4, StreamIdentifier("a"))
 			ps.PushComponent(4, 6, SourceSinkType("b"))
 			ps.EnsureIdentifier(6, 6)
-			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d")})
-			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f")})
+			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d"), nil})
+			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f"), nil})
 			ps.AssembleSourceSinkSpecs(6, 10)
 			ps.AssembleLoadState()
 
@@ -49,8 +49,8 @@ func TestAssembleLoadState(t *testing.T) {
 			ps.PushComponent(4, 5, SourceSinkType("b"))
 			ps.PushComponent(5, 6, Identifier("t"))
 			ps.EnsureIdentifier(5, 6)
-			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d")})
-			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f")})
+			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d"), nil})
+			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f"), nil})
 			ps.AssembleSourceSinkSpecs(6, 10)
 			ps.AssembleLoadState()
 
@@ -90,8 +90,8 @@ func TestAssembleLoadState(t *testing.T) {
 		Convey("When the stack contains a wrong item", func() {
 			ps.PushComponent(2, 4, Raw{"a"}) // must be StreamIdentifier
 			ps.PushComponent(4, 6, SourceSinkType("b"))
-			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d")})
-			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f")})
+			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d"), nil})
+			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f"), nil})
 			ps.AssembleSourceSinkSpecs(6, 10)
 
 			Convey("Then AssembleLoadState panics", func() {
@@ -32,8 +32,8 @@ func TestAssembleMap(t *testing.T) {
 					Convey("And it contains the previously pushed data", func() {
 						comp := top.comp.(MapAST)
 						So(len(comp.Entries), ShouldEqual, 2)
-						So(comp.Entries[0], ShouldResemble, KeyValuePairAST{"foo", RowValue{"", "a"}})
-						So(comp.Entries[1], ShouldResemble, KeyValuePairAST{"bar", RowValue{"", "b"}})
+						So(comp.Entries[0], ShouldResemble, KeyValuePairAST{"foo", RowValue{"", "a"}, nil})
+						So(comp.Entries[1], ShouldResemble, KeyValuePairAST{"bar", RowValue{"", "b"}, nil})
 					})
 				})
 			})
@@ -105,8 +105,8 @@ func TestAssembleMap(t *testing.T) {
 				So(s.Projections[0], ShouldHaveSameTypeAs, MapAST{})
 				m := s.Projections[0].(MapAST)
 				So(len(m.Entries), ShouldEqual, 2)
-				So(m.Entries[0], ShouldResemble, KeyValuePairAST{"foo", RowValue{"", "a"}})
-				So(m.Entries[1], ShouldResemble, KeyValuePairAST{"bar", RowValue{"", "b"}})
+				So(m.Entries[0], ShouldResemble, KeyValuePairAST{"foo", RowValue{"", "a"}, nil})
+				So(m.Entries[1], ShouldResemble, KeyValuePairAST{"bar", RowValue{"", "b"}, nil})
 			})
 		})
 	})
@@ -0,0 +1,189 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAssembleMatchRecognize(t *testing.T) {
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+
+		Convey("When the stack contains the correct MATCH_RECOGNIZE items", func() {
+			ps.PushComponent(0, 1, NewStream("s"))
+			ps.PushComponent(20, 30, ExpressionsAST{[]Expression{RowValue{"", "id"}}})
+			ps.PushComponent(31, 50, ExpressionsAST{[]Expression{AliasAST{RowValue{"a", "v"}, "first"}}})
+			ps.PushComponent(51, 70, []MatchPatternElemAST{{"a", 1, 1}, {"b", 1, -1}})
+			ps.PushComponent(71, 90, []MatchDefineAST{{"b", RowValue{"", "v"}}})
+			ps.AssembleMatchRecognize()
+
+			Convey("Then AssembleMatchRecognize transforms them into one item", func() {
+				So(ps.Len(), ShouldEqual, 1)
+
+				Convey("And that item is a Stream having the clause", func() {
+					top := ps.Peek()
+					So(top, ShouldNotBeNil)
+					So(top.begin, ShouldEqual, 0)
+					So(top.end, ShouldEqual, 90)
+					So(top.comp, ShouldResemble, Stream{MatchRecognizeStream, "s", nil, &MatchRecognizeAST{
+						PartitionBy: []Expression{RowValue{"", "id"}},
+						Measures:    []Expression{AliasAST{RowValue{"a", "v"}, "first"}},
+						Pattern:     []MatchPatternElemAST{{"a", 1, 1}, {"b", 1, -1}},
+						Define:      []MatchDefineAST{{"b", RowValue{"", "v"}}},
+					}})
+				})
+			})
+		})
+
+		Convey("When the stack contains definitions of pattern variables", func() {
+			ps.PushComponent(51, 70, []MatchPatternElemAST{{"a", 1, 1}, {"b", 1, -1}})
+			ps.PushComponent(72, 80, MatchDefineAST{"a", RowValue{"", "v"}})
+			ps.PushComponent(82, 90, MatchDefineAST{"b", RowValue{"", "w"}})
+			ps.AssembleMatchDefines(70, 90)
+
+			Convey("Then AssembleMatchDefines replaces them with a slice", func() {
+				So(ps.err, ShouldBeNil)
+				So(ps.Len(), ShouldEqual, 2)
+				So(ps.Peek().comp, ShouldResemble, []MatchDefineAST{{"a", RowValue{"", "v"}}, {"b", RowValue{"", "w"}}})
+			})
+		})
+
+		Convey("When a variable not in the pattern is defined", func() {
+			ps.PushComponent(51, 70, []MatchPatternElemAST{{"a", 1, 1}})
+			ps.PushComponent(72, 80, MatchDefineAST{"a", RowValue{"", "v"}})
+			ps.PushComponent(82, 90, MatchDefineAST{"b", RowValue{"", "v"}})
+			ps.AssembleMatchDefines(70, 90)
+
+			Convey("Then AssembleMatchDefines reports an error at the definition", func() {
+				So(ps.err, ShouldNotBeNil)
+				So(ps.err.pos, ShouldEqual, 82)
+				So(ps.err.err.Error(), ShouldEqual, "pattern variable 'b' is defined but not used in the pattern")
+			})
+		})
+
+		Convey("When a variable is defined more than once", func() {
+			ps.PushComponent(51, 70, []MatchPatternElemAST{{"a", 1, 1}})
+			ps.PushComponent(72, 80, MatchDefineAST{"a", RowValue{"", "v"}})
+			ps.PushComponent(82, 90, MatchDefineAST{"a", RowValue{"", "w"}})
+			ps.AssembleMatchDefines(70, 90)
+
+			Convey("Then AssembleMatchDefines reports an error at the second definition", func() {
+				So(ps.err, ShouldNotBeNil)
+				So(ps.err.pos, ShouldEqual, 82)
+				So(ps.err.err.Error(), ShouldEqual, "pattern variable 'a' is defined more than once")
+			})
+		})
+	})
+
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+
+		Convey("When assembling pattern variables with quantifiers", func() {
+			for q, elem := range map[string]MatchPatternElemAST{
+				"a":        {"a", 1, 1},
+				"a?":       {"a", 0, 1},
+				"a*":       {"a", 0, -1},
+				"a+":       {"a", 1, -1},
+				"a{3}":     {"a", 3, 3},
+				"a{2,}":    {"a", 2, -1},
+				"a{,4}":    {"a", 0, 4},
+				"a{ 2, 4}": {"a", 2, 4},
+			} {
+				ps.AssembleMatchPatternElem(0, len(q), q)
+				So(ps.Pop().comp, ShouldResemble, elem)
+			}
+		})
+
+		Convey("When assembling pattern variables with invalid quantifiers", func() {
+			Convey("Then AssembleMatchPatternElem reports an error", func() {
+				for _, q := range []string{"a{}", "a{0}", "a{3,2}", "a{,0}", "a{99999999999999999999}"} {
+					ps := parseStack{}
+					ps.AssembleMatchPatternElem(3, 3+len(q), q)
+					So(ps.err, ShouldNotBeNil)
+					So(ps.err.pos, ShouldEqual, 3)
+				}
+			})
+		})
+	})
+
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		Convey("When parsing a SELECT statement with MATCH_RECOGNIZE", func() {
+			p.Buffer = "SELECT ISTREAM m:first, m:last FROM s MATCH_RECOGNIZE (PARTITION BY id MEASURES a:v AS first, c:v AS last " +
+				"PATTERN (a b{2,} c?) DEFINE b AS v > a:v, c AS v < b:v) [RANGE 1 TUPLES] AS m"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, SelectStmt{})
+				s := top.(SelectStmt)
+				So(len(s.Relations), ShouldEqual, 1)
+				comp := s.Relations[0]
+				So(comp.Type, ShouldEqual, MatchRecognizeStream)
+				So(comp.Name, ShouldEqual, "s")
+				So(comp.Alias, ShouldEqual, "m")
+				So(comp.MatchRecognize, ShouldResemble, &MatchRecognizeAST{
+					PartitionBy: []Expression{RowValue{"", "id"}},
+					Measures: []Expression{
+						AliasAST{RowValue{"a", "v"}, "first"},
+						AliasAST{RowValue{"c", "v"}, "last"},
+					},
+					Pattern: []MatchPatternElemAST{{"a", 1, 1}, {"b", 2, -1}, {"c", 0, 1}},
+					Define: []MatchDefineAST{
+						{"b", BinaryOpAST{Greater, RowValue{"", "v"}, RowValue{"a", "v"}}},
+						{"c", BinaryOpAST{Less, RowValue{"", "v"}, RowValue{"b", "v"}}},
+					},
+				})
+
+				Convey("And String() should return the original statement", func() {
+					So(s.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When parsing MATCH_RECOGNIZE without PARTITION BY and DEFINE", func() {
+			p.Buffer = "SELECT ISTREAM first FROM s MATCH_RECOGNIZE (MEASURES a:v AS first PATTERN (a)) [RANGE 1 TUPLES]"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				s := p.parseStack.Peek().comp.(SelectStmt)
+				mr := s.Relations[0].MatchRecognize
+				So(mr.PartitionBy, ShouldBeEmpty)
+				So(mr.Define, ShouldBeEmpty)
+
+				Convey("And String() should return the original statement", func() {
+					So(s.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When parsing MATCH_RECOGNIZE without MEASURES", func() {
+			p.Buffer = "SELECT ISTREAM first FROM s MATCH_RECOGNIZE (PATTERN (a)) [RANGE 1 TUPLES]"
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When parsing MATCH_RECOGNIZE with an invalid quantifier", func() {
+			p.Buffer = "SELECT ISTREAM first FROM s MATCH_RECOGNIZE (MEASURES a:v AS first PATTERN (a{3,1})) [RANGE 1 TUPLES]"
+
+			Convey("Then parsing should fail", func() {
+				_, _, err := New().ParseStmt(p.Buffer)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
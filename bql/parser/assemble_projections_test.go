@@ -108,5 +108,40 @@ func TestAssembleProjections(t *testing.T) {
 				})
 			})
 		})
+
+		Convey("When selecting DISTINCT columns", func() {
+			p.Buffer = "SELECT ISTREAM DISTINCT a, b AS c"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				So(p.Parse(), ShouldBeNil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				s := ps.Peek().comp.(SelectStmt)
+				So(s.Distinct, ShouldBeTrue)
+				So(s.Projections, ShouldResemble, []Expression{
+					RowValue{"", "a"}, AliasAST{RowValue{"", "b"}, "c"}})
+
+				Convey("And String() should return the original statement", func() {
+					So(s.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When selecting a column whose name starts with distinct", func() {
+			p.Buffer = "SELECT ISTREAM distinct_a"
+			p.Init()
+
+			Convey("Then it shouldn't be regarded as DISTINCT", func() {
+				So(p.Parse(), ShouldBeNil)
+				p.Execute()
+
+				s := p.parseStack.Peek().comp.(SelectStmt)
+				So(s.Distinct, ShouldBeFalse)
+				So(s.Projections, ShouldResemble, []Expression{RowValue{"", "distinct_a"}})
+			})
+		})
 	})
 }
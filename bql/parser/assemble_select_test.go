@@ -15,19 +15,22 @@ func TestAssembleSelect(t *testing.T) {
 			ps.PushComponent(6, 7, RowValue{"", "a"})
 			ps.PushComponent(7, 8, RowValue{"", "b"})
 			ps.AssembleProjections(6, 8)
-			ps.PushComponent(10, 11, Stream{ActualStream, "c", nil})
+			ps.PushComponent(10, 11, Stream{ActualStream, "c", nil, nil})
 			ps.PushComponent(11, 12, IntervalAST{FloatLiteral{3}, Tuples})
+			ps.EnsureSlideSpec(12, 12)
 			ps.PushComponent(12, 13, NumericLiteral{2})
-			ps.EnsureCapacitySpec(12, 13)
+			ps.EnsureCapacityUnit(13, 13)
+			ps.EnsureWindowCapacitySpec(12, 13)
 			ps.PushComponent(13, 14, DropOldest)
 			ps.EnsureSheddingSpec(13, 14)
 			ps.AssembleStreamWindow()
 			ps.EnsureAliasedStreamWindow()
-			ps.PushComponent(14, 15, Stream{ActualStream, "d", nil})
+			ps.PushComponent(14, 15, Stream{ActualStream, "d", nil, nil})
 			ps.PushComponent(16, 17, NumericLiteral{2})
 			ps.PushComponent(17, 18, Seconds)
 			ps.AssembleInterval()
-			ps.EnsureCapacitySpec(18, 18)
+			ps.EnsureSlideSpec(18, 18)
+			ps.EnsureWindowCapacitySpec(18, 18)
 			ps.EnsureSheddingSpec(18, 18)
 			ps.AssembleStreamWindow()
 			ps.PushComponent(18, 19, Identifier("x"))
@@ -41,6 +44,12 @@ func TestAssembleSelect(t *testing.T) {
 			ps.AssembleGrouping(24, 28)
 			ps.PushComponent(28, 30, RowValue{"", "h"})
 			ps.AssembleHaving(28, 30)
+			ps.PushComponent(30, 32, SortedExpressionAST{RowValue{"", "i"}, No})
+			ps.PushComponent(32, 34, SortedExpressionAST{RowValue{"", "j"}, UnspecifiedKeyword})
+			ps.AssembleOrderBy(30, 34)
+			ps.PushComponent(34, 35, NumericLiteral{5})
+			ps.PushComponent(35, 36, NumericLiteral{2})
+			ps.AssembleLimit(34, 36)
 			ps.AssembleSelect()
 
 			Convey("Then AssembleSelect transforms them into one item", func() {
@@ -50,7 +59,7 @@ func TestAssembleSelect(t *testing.T) {
 					top := ps.Peek()
 					So(top, ShouldNotBeNil)
 					So(top.begin, ShouldEqual, 4)
-					So(top.end, ShouldEqual, 30)
+					So(top.end, ShouldEqual, 36)
 					So(top.comp, ShouldHaveSameTypeAs, SelectStmt{})
 
 					Convey("And it contains the previously pushed data", func() {
@@ -78,6 +87,11 @@ func TestAssembleSelect(t *testing.T) {
 						So(comp.GroupList[0], ShouldResemble, RowValue{"", "f"})
 						So(comp.GroupList[1], ShouldResemble, RowValue{"", "g"})
 						So(comp.Having, ShouldResemble, RowValue{"", "h"})
+						So(comp.OrderBy, ShouldResemble, []SortedExpressionAST{
+							{RowValue{"", "i"}, No},
+							{RowValue{"", "j"}, UnspecifiedKeyword},
+						})
+						So(comp.LimitAST, ShouldResemble, LimitAST{true, 5, 2})
 					})
 				})
 			})
@@ -98,19 +112,22 @@ func TestAssembleSelect(t *testing.T) {
 			ps.PushComponent(6, 7, RowValue{"", "a"})
 			ps.PushComponent(7, 8, RowValue{"", "b"})
 			ps.AssembleProjections(6, 8)
-			ps.PushComponent(10, 11, Stream{ActualStream, "c", nil})
+			ps.PushComponent(10, 11, Stream{ActualStream, "c", nil, nil})
 			ps.PushComponent(11, 12, IntervalAST{FloatLiteral{3}, Tuples})
+			ps.EnsureSlideSpec(12, 12)
 			ps.PushComponent(12, 13, NumericLiteral{2})
-			ps.EnsureCapacitySpec(12, 13)
+			ps.EnsureCapacityUnit(13, 13)
+			ps.EnsureWindowCapacitySpec(12, 13)
 			ps.PushComponent(13, 14, DropOldest)
 			ps.EnsureSheddingSpec(13, 14)
 			ps.AssembleStreamWindow()
 			ps.EnsureAliasedStreamWindow()
-			ps.PushComponent(14, 15, Stream{ActualStream, "d", nil})
+			ps.PushComponent(14, 15, Stream{ActualStream, "d", nil, nil})
 			ps.PushComponent(16, 17, NumericLiteral{2})
 			ps.PushComponent(17, 18, Seconds)
 			ps.AssembleInterval()
-			ps.EnsureCapacitySpec(18, 18)
+			ps.EnsureSlideSpec(18, 18)
+			ps.EnsureWindowCapacitySpec(18, 18)
 			ps.EnsureSheddingSpec(18, 18)
 			ps.AssembleStreamWindow()
 			ps.PushComponent(18, 19, Identifier("x"))
@@ -124,6 +141,8 @@ func TestAssembleSelect(t *testing.T) {
 			ps.AssembleGrouping(24, 28)
 			ps.PushComponent(28, 30, RowValue{"", "h"})
 			ps.AssembleFilter(28, 30) // must be HAVING in correct stmt
+			ps.AssembleOrderBy(30, 30)
+			ps.AssembleLimit(30, 30)
 			Convey("Then AssembleSelect panics", func() {
 				So(ps.AssembleSelect, ShouldPanic)
 			})
@@ -177,11 +196,68 @@ func TestAssembleSelect(t *testing.T) {
 				So(comp.GroupList[0], ShouldResemble, RowValue{"", "f"})
 				So(comp.GroupList[1], ShouldResemble, RowValue{"", "g"})
 				So(comp.Having, ShouldResemble, RowValue{"", "h"})
+				So(comp.OrderByAST, ShouldResemble, OrderByAST{})
+				So(comp.LimitAST, ShouldResemble, LimitAST{})
 
 				Convey("And String() should return the original statement", func() {
 					So(comp.String(), ShouldEqual, p.Buffer)
 				})
 			})
 		})
+
+		Convey("When doing a SELECT with ORDER BY and LIMIT", func() {
+			p.Buffer = `SELECT ISTREAM a, b FROM c [RANGE 3 TUPLES] WHERE e ORDER BY a DESC, b + 1 LIMIT 10 OFFSET 3`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, SelectStmt{})
+				comp := top.(SelectStmt)
+
+				So(comp.Filter, ShouldResemble, RowValue{"", "e"})
+				So(comp.OrderBy, ShouldResemble, []SortedExpressionAST{
+					{RowValue{"", "a"}, No},
+					{BinaryOpAST{Plus, RowValue{"", "b"}, NumericLiteral{1}}, UnspecifiedKeyword},
+				})
+				So(comp.LimitAST, ShouldResemble, LimitAST{true, 10, 3})
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When doing a SELECT with LIMIT 0", func() {
+			p.Buffer = `SELECT ISTREAM a FROM c [RANGE 3 TUPLES] LIMIT 0`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				comp := p.parseStack.Peek().comp.(SelectStmt)
+				So(comp.LimitAST, ShouldResemble, LimitAST{true, 0, 0})
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When doing a SELECT with a negative LIMIT", func() {
+			p.Buffer = `SELECT ISTREAM a FROM c [RANGE 3 TUPLES] LIMIT -1`
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
 	})
 }
@@ -11,9 +11,9 @@ func TestAssembleSelectUnion(t *testing.T) {
 
 		Convey("When the stack contains only RowValues in the given range", func() {
 			ps.PushComponent(0, 6, Raw{"PRE"})
-			ps.PushComponent(6, 7, SelectStmt{ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}})
+			ps.PushComponent(6, 7, SelectStmt{ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}})
 			ps.PushComponent(7, 8, SelectStmt{ProjectionsAST: ProjectionsAST{
-				[]Expression{RowValue{"", "b"}}}})
+				[]Expression{RowValue{"", "b"}}, false}})
 			ps.AssembleSelectUnion(6, 8)
 
 			Convey("Then AssembleSelectUnion transforms them into one item", func() {
@@ -81,6 +81,28 @@ func TestAssembleSelectUnion(t *testing.T) {
 		})
 	})
 
+	Convey("Given a parseStack with a SelectUnionStmt and an ordering option", t, func() {
+		ps := parseStack{}
+		ps.PushComponent(0, 6, Raw{"PRE"})
+		ps.PushComponent(6, 8, SelectUnionStmt{Selects: []SelectStmt{{}, {}}})
+		ps.PushComponent(9, 16, Yes)
+
+		Convey("When assembling them", func() {
+			ps.AssembleSelectUnionOrder()
+
+			Convey("Then they should be transformed into one SelectUnionStmt", func() {
+				So(ps.Len(), ShouldEqual, 2)
+				top := ps.Peek()
+				So(top.begin, ShouldEqual, 6)
+				So(top.end, ShouldEqual, 16)
+				So(top.comp, ShouldHaveSameTypeAs, SelectUnionStmt{})
+				s := top.comp.(SelectUnionStmt)
+				So(len(s.Selects), ShouldEqual, 2)
+				So(s.Ordered, ShouldEqual, Yes)
+			})
+		})
+	})
+
 	Convey("Given a parser", t, func() {
 		p := &bqlPeg{}
 
@@ -131,11 +153,48 @@ func TestAssembleSelectUnion(t *testing.T) {
 				So(s.Selects[1].Projections, ShouldResemble, []Expression{RowValue{"", "b"}})
 				So(s.Selects[2].EmitterType, ShouldEqual, Rstream)
 				So(s.Selects[2].Projections, ShouldResemble, []Expression{RowValue{"", "c"}})
+				So(s.Ordered, ShouldEqual, UnspecifiedKeyword)
 
 				Convey("And String() should return the original statement", func() {
 					So(s.String(), ShouldEqual, p.Buffer)
 				})
 			})
 		})
+
+		Convey("When working with an ordering option", func() {
+			for keyword, ordered := range map[string]BinaryKeyword{"ORDERED": Yes, "UNORDERED": No} {
+				Convey("And the option is "+keyword, func() {
+					p.Buffer = "SELECT ISTREAM a FROM s [RANGE 1 TUPLES] UNION ALL SELECT ISTREAM b FROM s [RANGE 1 TUPLES] " + keyword
+					p.Init()
+
+					Convey("Then the statement should be parsed correctly", func() {
+						err := p.Parse()
+						So(err, ShouldEqual, nil)
+						p.Execute()
+
+						ps := p.parseStack
+						So(ps.Len(), ShouldEqual, 1)
+						top := ps.Peek().comp
+						So(top, ShouldHaveSameTypeAs, SelectUnionStmt{})
+						s := top.(SelectUnionStmt)
+						So(len(s.Selects), ShouldEqual, 2)
+						So(s.Ordered, ShouldEqual, ordered)
+
+						Convey("And String() should return the original statement", func() {
+							So(s.String(), ShouldEqual, p.Buffer)
+						})
+					})
+				})
+			}
+		})
+
+		Convey("When working with an ordering option without UNION ALL", func() {
+			p.Buffer = "SELECT ISTREAM a FROM s [RANGE 1 TUPLES] ORDERED"
+			p.Init()
+
+			Convey("Then the statement should not be parsed", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
 	})
 }
@@ -0,0 +1,249 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAssembleShow(t *testing.T) {
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+		Convey("When the stack contains the correct SHOW items", func() {
+			ps.PushComponent(5, 12, StreamNodeType)
+			ps.AssembleShow()
+
+			Convey("Then AssembleShow transforms them into one item", func() {
+				So(ps.Len(), ShouldEqual, 1)
+
+				Convey("And that item is a ShowStmt", func() {
+					top := ps.Peek()
+					So(top, ShouldNotBeNil)
+					So(top.begin, ShouldEqual, 5)
+					So(top.end, ShouldEqual, 12)
+					So(top.comp, ShouldHaveSameTypeAs, ShowStmt{})
+
+					Convey("And it contains the previously pushed data", func() {
+						comp := top.comp.(ShowStmt)
+						So(comp.Type, ShouldEqual, StreamNodeType)
+					})
+				})
+			})
+		})
+
+		Convey("When the stack contains a wrong item", func() {
+			ps.PushComponent(5, 12, Raw{"STREAMS"}) // must be NodeTypeKeyword
+
+			Convey("Then AssembleShow panics", func() {
+				So(ps.AssembleShow, ShouldPanic)
+			})
+		})
+	})
+
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		for _, c := range []struct {
+			stmt     string
+			nodeType NodeTypeKeyword
+		}{
+			{"SHOW SOURCES", SourceNodeType},
+			{"SHOW STREAMS", StreamNodeType},
+			{"SHOW SINKS", SinkNodeType},
+			{"SHOW STATES", StateNodeType},
+		} {
+			c := c
+			Convey("When doing a full "+c.stmt, func() {
+				p.Buffer = c.stmt
+				p.Init()
+
+				Convey("Then the statement should be parsed correctly", func() {
+					err := p.Parse()
+					So(err, ShouldEqual, nil)
+					p.Execute()
+
+					ps := p.parseStack
+					So(ps.Len(), ShouldEqual, 1)
+					top := ps.Peek().comp
+					So(top, ShouldHaveSameTypeAs, ShowStmt{})
+					comp := top.(ShowStmt)
+
+					So(comp.Type, ShouldEqual, c.nodeType)
+
+					Convey("And String() should return the original statement", func() {
+						So(comp.String(), ShouldEqual, p.Buffer)
+					})
+				})
+			})
+		}
+
+		Convey("When specifying a singular node type", func() {
+			p.Buffer = "SHOW STREAM"
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestAssembleDescribe(t *testing.T) {
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+		Convey("When the stack contains the correct DESCRIBE items", func() {
+			ps.PushComponent(9, 10, StreamIdentifier("a"))
+			ps.AssembleDescribe()
+
+			Convey("Then AssembleDescribe transforms them into one item", func() {
+				So(ps.Len(), ShouldEqual, 1)
+
+				Convey("And that item is a DescribeStmt", func() {
+					top := ps.Peek()
+					So(top, ShouldNotBeNil)
+					So(top.begin, ShouldEqual, 9)
+					So(top.end, ShouldEqual, 10)
+					So(top.comp, ShouldHaveSameTypeAs, DescribeStmt{})
+
+					Convey("And it contains the previously pushed data", func() {
+						comp := top.comp.(DescribeStmt)
+						So(comp.Name, ShouldEqual, "a")
+					})
+				})
+			})
+		})
+
+		Convey("When the stack contains a wrong item", func() {
+			ps.PushComponent(9, 10, Raw{"a"}) // must be StreamIdentifier
+
+			Convey("Then AssembleDescribe panics", func() {
+				So(ps.AssembleDescribe, ShouldPanic)
+			})
+		})
+	})
+
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		Convey("When doing a full DESCRIBE", func() {
+			p.Buffer = "DESCRIBE a_1"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, DescribeStmt{})
+				comp := top.(DescribeStmt)
+
+				So(comp.Name, ShouldEqual, "a_1")
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+	})
+}
+
+func TestAssembleShowUDFs(t *testing.T) {
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		Convey("When doing a full SHOW UDFS", func() {
+			p.Buffer = "SHOW UDFS"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek()
+				So(top.begin, ShouldEqual, 0)
+				So(top.end, ShouldEqual, 9)
+				So(top.comp, ShouldHaveSameTypeAs, ShowUDFsStmt{})
+
+				Convey("And String() should return the original statement", func() {
+					So(top.comp.(ShowUDFsStmt).String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+	})
+}
+
+func TestAssembleDescribeFunction(t *testing.T) {
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+		Convey("When the stack contains the correct DESCRIBE FUNCTION items", func() {
+			ps.PushComponent(18, 21, FuncName("abs"))
+			ps.AssembleDescribeFunction()
+
+			Convey("Then AssembleDescribeFunction transforms them into one item", func() {
+				So(ps.Len(), ShouldEqual, 1)
+
+				Convey("And that item is a DescribeFunctionStmt", func() {
+					top := ps.Peek()
+					So(top, ShouldNotBeNil)
+					So(top.comp, ShouldHaveSameTypeAs, DescribeFunctionStmt{})
+
+					Convey("And it contains the previously pushed data", func() {
+						comp := top.comp.(DescribeFunctionStmt)
+						So(comp.Name, ShouldEqual, "abs")
+					})
+				})
+			})
+		})
+
+		Convey("When the stack contains a wrong item", func() {
+			ps.PushComponent(18, 21, StreamIdentifier("abs")) // must be FuncName
+
+			Convey("Then AssembleDescribeFunction panics", func() {
+				So(ps.AssembleDescribeFunction, ShouldPanic)
+			})
+		})
+	})
+
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		Convey("When doing a full DESCRIBE FUNCTION", func() {
+			p.Buffer = "DESCRIBE FUNCTION my_udf"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, DescribeFunctionStmt{})
+				comp := top.(DescribeFunctionStmt)
+
+				So(comp.Name, ShouldEqual, "my_udf")
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When describing a node named function", func() {
+			p.Buffer = "DESCRIBE function"
+			p.Init()
+
+			Convey("Then it should be parsed as a DESCRIBE statement", func() {
+				So(p.Parse(), ShouldBeNil)
+				p.Execute()
+				So(p.parseStack.Peek().comp, ShouldResemble, DescribeStmt{"function"})
+			})
+		})
+	})
+}
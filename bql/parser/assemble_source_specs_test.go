@@ -12,8 +12,8 @@ func TestAssembleSourceSinkSpecs(t *testing.T) {
 
 		Convey("When the stack contains only SourceSinkParams in the given range", func() {
 			ps.PushComponent(0, 6, Raw{"PRE"})
-			ps.PushComponent(6, 7, SourceSinkParamAST{"key", data.String("val")})
-			ps.PushComponent(7, 8, SourceSinkParamAST{"a", data.String("b")})
+			ps.PushComponent(6, 7, SourceSinkParamAST{"key", data.String("val"), nil})
+			ps.PushComponent(7, 8, SourceSinkParamAST{"a", data.String("b"), nil})
 			ps.AssembleSourceSinkSpecs(6, 8)
 
 			Convey("Then AssembleSourceSinkSpecs transforms them into one item", func() {
@@ -136,14 +136,77 @@ func TestAssembleSourceSinkSpecs(t *testing.T) {
 				So(s.Params, ShouldNotBeNil)
 				So(len(s.Params), ShouldEqual, 2)
 				So(s.Params[0], ShouldResemble,
-					SourceSinkParamAST{"port", data.Int(8080)})
+					SourceSinkParamAST{"port", data.Int(8080), nil})
 				So(s.Params[1], ShouldResemble,
-					SourceSinkParamAST{"proto", data.String("http")})
+					SourceSinkParamAST{"proto", data.String("http"), nil})
 
 				Convey("And String() should return the original statement", func() {
 					So(s.String(), ShouldEqual, p.Buffer)
 				})
 			})
 		})
+
+		Convey("When creating a source with env parameters", func() {
+			p.Buffer = `CREATE SOURCE a TYPE b WITH host=env("DB_HOST"), port=env("DB_PORT", 5432), user=env("DB_USER", "admin")`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, CreateSourceStmt{})
+				s := top.(CreateSourceStmt)
+				So(len(s.Params), ShouldEqual, 3)
+				So(s.Params[0], ShouldResemble,
+					SourceSinkParamAST{"host", nil, &EnvParamAST{"DB_HOST", nil}})
+				So(s.Params[1], ShouldResemble,
+					SourceSinkParamAST{"port", nil, &EnvParamAST{"DB_PORT", data.Int(5432)}})
+				So(s.Params[2], ShouldResemble,
+					SourceSinkParamAST{"user", nil, &EnvParamAST{"DB_USER", data.String("admin")}})
+
+				Convey("And String() should return the original statement", func() {
+					So(s.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When using env in lower and upper case with spaces", func() {
+			p.Buffer = `UPDATE SINK a SET x=ENV ( "X" , true )`
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				s := p.parseStack.Peek().comp.(UpdateSinkStmt)
+				So(s.Params, ShouldResemble, []SourceSinkParamAST{
+					{"x", nil, &EnvParamAST{"X", data.True}},
+				})
+				So(s.String(), ShouldEqual, `UPDATE SINK a SET x=env("X", true)`)
+			})
+		})
+
+		Convey("When giving a non-string name to env", func() {
+			p.Buffer = `CREATE SOURCE a TYPE b WITH host=env(1)`
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When giving an array as the default value of env", func() {
+			p.Buffer = `CREATE SOURCE a TYPE b WITH hosts=env("HOSTS", ["a"])`
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
 	})
 }
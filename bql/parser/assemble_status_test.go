@@ -0,0 +1,91 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAssembleStatus(t *testing.T) {
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+		Convey("When the stack contains the correct STATUS OF items", func() {
+			ps.PushComponent(10, 16, SourceNodeType)
+			ps.PushComponent(17, 18, StreamIdentifier("a"))
+			ps.AssembleStatus()
+
+			Convey("Then AssembleStatus transforms them into one item", func() {
+				So(ps.Len(), ShouldEqual, 1)
+
+				Convey("And that item is a StatusStmt", func() {
+					top := ps.Peek()
+					So(top, ShouldNotBeNil)
+					So(top.begin, ShouldEqual, 10)
+					So(top.end, ShouldEqual, 18)
+					So(top.comp, ShouldHaveSameTypeAs, StatusStmt{})
+
+					Convey("And it contains the previously pushed data", func() {
+						comp := top.comp.(StatusStmt)
+						So(comp.Type, ShouldEqual, SourceNodeType)
+						So(comp.Name, ShouldEqual, "a")
+					})
+				})
+			})
+		})
+
+		Convey("When the stack contains a wrong item", func() {
+			ps.PushComponent(10, 16, SourceNodeType)
+			ps.PushComponent(17, 18, Raw{"a"}) // must be StreamIdentifier
+
+			Convey("Then AssembleStatus panics", func() {
+				So(ps.AssembleStatus, ShouldPanic)
+			})
+		})
+	})
+
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		for _, c := range []struct {
+			stmt     string
+			nodeType NodeTypeKeyword
+		}{
+			{"STATUS OF SOURCE a_1", SourceNodeType},
+			{"STATUS OF STREAM a_1", StreamNodeType},
+			{"STATUS OF SINK a_1", SinkNodeType},
+		} {
+			c := c
+			Convey("When doing a full "+c.stmt, func() {
+				p.Buffer = c.stmt
+				p.Init()
+
+				Convey("Then the statement should be parsed correctly", func() {
+					err := p.Parse()
+					So(err, ShouldEqual, nil)
+					p.Execute()
+
+					ps := p.parseStack
+					So(ps.Len(), ShouldEqual, 1)
+					top := ps.Peek().comp
+					So(top, ShouldHaveSameTypeAs, StatusStmt{})
+					comp := top.(StatusStmt)
+
+					So(comp.Type, ShouldEqual, c.nodeType)
+					So(comp.Name, ShouldEqual, "a_1")
+
+					Convey("And String() should return the original statement", func() {
+						So(comp.String(), ShouldEqual, p.Buffer)
+					})
+				})
+			})
+		}
+
+		Convey("When specifying an unknown node type", func() {
+			p.Buffer = "STATUS OF STATE a_1"
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,100 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAssembleTee(t *testing.T) {
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+		Convey("When the stack contains the correct TEE items", func() {
+			ps.PushComponent(4, 5, StreamIdentifier("x"))
+			ps.PushComponent(9, 10, StreamIdentifier("y"))
+			ps.AssembleTee()
+
+			Convey("Then AssembleTee transforms them into one item", func() {
+				So(ps.Len(), ShouldEqual, 1)
+
+				Convey("And that item is a TeeStmt", func() {
+					top := ps.Peek()
+					So(top, ShouldNotBeNil)
+					So(top.begin, ShouldEqual, 4)
+					So(top.end, ShouldEqual, 10)
+					So(top.comp, ShouldHaveSameTypeAs, TeeStmt{})
+
+					Convey("And it contains the previously pushed data", func() {
+						comp := top.comp.(TeeStmt)
+						So(comp.Stream, ShouldEqual, "x")
+						So(comp.Sink, ShouldEqual, "y")
+					})
+				})
+			})
+		})
+
+		Convey("When the stack does not contain enough items", func() {
+			ps.PushComponent(4, 5, StreamIdentifier("x"))
+			Convey("Then AssembleTee panics", func() {
+				So(ps.AssembleTee, ShouldPanic)
+			})
+		})
+
+		Convey("When the stack contains a wrong item", func() {
+			ps.PushComponent(4, 5, StreamIdentifier("x"))
+			ps.PushComponent(5, 6, Istream) // must be StreamIdentifier
+			Convey("Then AssembleTee panics", func() {
+				So(ps.AssembleTee, ShouldPanic)
+			})
+		})
+	})
+
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		Convey("When doing a full TEE", func() {
+			p.Buffer = "TEE x TO y"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, TeeStmt{})
+				comp := top.(TeeStmt)
+
+				So(comp.Stream, ShouldEqual, "x")
+				So(comp.Sink, ShouldEqual, "y")
+
+				Convey("And String() should return the original statement", func() {
+					So(comp.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When using lower case keywords", func() {
+			p.Buffer = "tee x to y"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				So(p.parseStack.Peek().comp, ShouldResemble, TeeStmt{"x", "y"})
+			})
+		})
+
+		Convey("When omitting the sink", func() {
+			p.Buffer = "TEE x TO"
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -9,9 +9,10 @@ func TestAssembleUDSFFuncApp(t *testing.T) {
 	Convey("Given a parseStack", t, func() {
 		ps := parseStack{}
 
-		Convey("When the stack contains three correct items", func() {
+		Convey("When the stack contains four correct items", func() {
 			ps.PushComponent(0, 6, Raw{"PRE"})
 			ps.PushComponent(6, 7, FuncName("add"))
+			ps.PushComponent(7, 7, UnspecifiedKeyword)
 			ps.PushComponent(7, 8, ExpressionsAST{[]Expression{
 				NumericLiteral{2},
 				RowValue{"", "a"}}})
@@ -41,6 +42,50 @@ func TestAssembleUDSFFuncApp(t *testing.T) {
 			})
 		})
 
+		Convey("When the stack contains a positional argument after a named one", func() {
+			ps.PushComponent(6, 7, FuncName("add"))
+			ps.PushComponent(7, 7, UnspecifiedKeyword)
+			ps.PushComponent(7, 8, ExpressionsAST{[]Expression{
+				NamedArgAST{"x", NumericLiteral{2}},
+				RowValue{"", "a"}}})
+			ps.PushComponent(8, 8, ExpressionsAST{nil})
+			ps.AssembleFuncApp()
+			ps.AssembleUDSFFuncApp()
+
+			Convey("Then AssembleUDSFFuncApp reports an error", func() {
+				So(ps.err, ShouldNotBeNil)
+				So(ps.err.pos, ShouldEqual, 6)
+				So(ps.err.err.Error(), ShouldEqual, "a positional argument cannot follow named arguments")
+
+				Convey("And it still replaces them with a Stream", func() {
+					So(ps.Len(), ShouldEqual, 1)
+					So(ps.Peek().comp, ShouldHaveSameTypeAs, Stream{})
+				})
+			})
+		})
+
+		Convey("When the stack contains a duplicated named argument", func() {
+			ps.PushComponent(6, 7, FuncName("add"))
+			ps.PushComponent(7, 7, UnspecifiedKeyword)
+			ps.PushComponent(7, 8, ExpressionsAST{[]Expression{
+				NamedArgAST{"x", NumericLiteral{2}},
+				NamedArgAST{"x", NumericLiteral{3}}}})
+			ps.PushComponent(8, 8, ExpressionsAST{nil})
+			ps.AssembleFuncApp()
+			ps.AssembleUDSFFuncApp()
+
+			Convey("Then AssembleUDSFFuncApp reports an error", func() {
+				So(ps.err, ShouldNotBeNil)
+				So(ps.err.pos, ShouldEqual, 6)
+				So(ps.err.err.Error(), ShouldEqual, "argument 'x' is given more than once")
+
+				Convey("And it still replaces them with a Stream", func() {
+					So(ps.Len(), ShouldEqual, 1)
+					So(ps.Peek().comp, ShouldHaveSameTypeAs, Stream{})
+				})
+			})
+		})
+
 		Convey("When the stack contains a wrong item", func() {
 			ps.PushComponent(0, 6, Raw{"PRE"})
 
@@ -87,6 +132,42 @@ func TestAssembleUDSFFuncApp(t *testing.T) {
 			})
 		})
 
+		Convey("When parsing a SELECT statement with a UDSF having named arguments", func() {
+			p.Buffer = "SELECT ISTREAM x FROM add(2, y => a, z => \"b\") [RANGE 1 TUPLES]"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, SelectStmt{})
+				s := top.(SelectStmt)
+				comp := s.WindowedFromAST.Relations[0]
+				So(comp.Type, ShouldEqual, UDSFStream)
+				So(len(comp.Params), ShouldEqual, 3)
+				So(comp.Params[0], ShouldResemble, NumericLiteral{2})
+				So(comp.Params[1], ShouldResemble, NamedArgAST{"y", RowValue{"", "a"}})
+				So(comp.Params[2], ShouldResemble, NamedArgAST{"z", StringLiteral{"b"}})
+
+				Convey("And String() should return the original statement", func() {
+					So(s.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When parsing a SELECT statement with a UDSF having a positional argument after a named one", func() {
+			p.Buffer = "SELECT ISTREAM x FROM add(y => a, 2) [RANGE 1 TUPLES]"
+
+			Convey("Then the statement should fail to parse", func() {
+				_, _, err := New().ParseStmt(p.Buffer)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
 		Convey("When parsing a SELECT statement with a UDSF and ORDER BY clause", func() {
 			p.Buffer = "SELECT ISTREAM x FROM add(2, a ORDER BY b) [RANGE 1 TUPLES]"
 			p.Init()
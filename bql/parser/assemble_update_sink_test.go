@@ -11,8 +11,8 @@ func TestAssembleUpdateSink(t *testing.T) {
 		ps := parseStack{}
 		Convey("When the stack contains the correct UPDATE SINK items", func() {
 			ps.PushComponent(2, 4, StreamIdentifier("a"))
-			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d")})
-			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f")})
+			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d"), nil})
+			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f"), nil})
 			ps.AssembleSourceSinkSpecs(6, 10)
 			ps.AssembleUpdateSink()
 
@@ -49,8 +49,8 @@ func TestAssembleUpdateSink(t *testing.T) {
 
 		Convey("When the stack contains a wrong item", func() {
 			ps.PushComponent(2, 4, Raw{"a"}) // must be StreamIdentifier
-			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d")})
-			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f")})
+			ps.PushComponent(6, 8, SourceSinkParamAST{"c", data.String("d"), nil})
+			ps.PushComponent(8, 10, SourceSinkParamAST{"e", data.String("f"), nil})
 			ps.AssembleSourceSinkSpecs(6, 10)
 
 			Convey("Then AssembleUpdateSink panics", func() {
@@ -12,12 +12,12 @@ func TestAssembleWindowedFrom(t *testing.T) {
 		Convey("When the stack contains only AliasedStreamWindows in the given range", func() {
 			ps.PushComponent(0, 6, Raw{"PRE"})
 			ps.PushComponent(6, 8, AliasedStreamWindowAST{
-				StreamWindowAST{Stream{ActualStream, "a", nil}, IntervalAST{FloatLiteral{3}, Tuples},
-					2, UnspecifiedSheddingOption}, "",
+				StreamWindowAST{Stream{ActualStream, "a", nil, nil}, IntervalAST{FloatLiteral{3}, Tuples},
+					2, UnspecifiedSheddingOption, TupleCapacity, IntervalAST{}}, "",
 			})
 			ps.PushComponent(8, 10, AliasedStreamWindowAST{
-				StreamWindowAST{Stream{ActualStream, "b", nil}, IntervalAST{FloatLiteral{2}, Seconds},
-					UnspecifiedCapacity, Wait}, "",
+				StreamWindowAST{Stream{ActualStream, "b", nil, nil}, IntervalAST{FloatLiteral{2}, Seconds},
+					UnspecifiedCapacity, Wait, TupleCapacity, IntervalAST{}}, "",
 			})
 			ps.AssembleWindowedFrom(6, 10)
 
@@ -159,5 +159,50 @@ func TestAssembleWindowedFrom(t *testing.T) {
 				})
 			})
 		})
+
+		Convey("When selecting with outer joins", func() {
+			p.Buffer = "SELECT ISTREAM a:x, b:y FROM a [RANGE 3 TUPLES], c [RANGE 2 TUPLES] " +
+				"LEFT OUTER JOIN b [RANGE 3 TUPLES] ON a:id = b:id " +
+				"full join d [RANGE 1 SECONDS] ON b:id = d:id"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				err := p.Parse()
+				So(err, ShouldEqual, nil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, SelectStmt{})
+				comp := top.(SelectStmt)
+				So(len(comp.Relations), ShouldEqual, 4)
+				So(comp.Relations[0].Name, ShouldEqual, "a")
+				So(comp.Relations[1].Name, ShouldEqual, "c")
+				So(comp.Relations[2].Name, ShouldEqual, "b")
+				So(comp.Relations[3].Name, ShouldEqual, "d")
+				So(comp.Relations[3].Unit, ShouldEqual, Seconds)
+				So(comp.Joins, ShouldResemble, []JoinAST{
+					{CrossJoin, nil},
+					{LeftOuterJoin, BinaryOpAST{Equal, RowValue{"a", "id"}, RowValue{"b", "id"}}},
+					{FullOuterJoin, BinaryOpAST{Equal, RowValue{"b", "id"}, RowValue{"d", "id"}}},
+				})
+
+				Convey("And String() should return the normalized statement", func() {
+					So(comp.String(), ShouldEqual, "SELECT ISTREAM a:x, b:y FROM a [RANGE 3 TUPLES], "+
+						"c [RANGE 2 TUPLES] LEFT OUTER JOIN b [RANGE 3 TUPLES] ON a:id = b:id "+
+						"FULL OUTER JOIN d [RANGE 1 SECONDS] ON b:id = d:id")
+				})
+			})
+		})
+
+		Convey("When selecting with a join without ON", func() {
+			p.Buffer = "SELECT ISTREAM a:x FROM a [RANGE 3 TUPLES] RIGHT JOIN b [RANGE 3 TUPLES]"
+			p.Init()
+
+			Convey("Then parsing should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
 	})
 }
@@ -11,10 +11,12 @@ func TestAssembleStreamWindow(t *testing.T) {
 
 		Convey("When the stack contains two correct items", func() {
 			ps.PushComponent(0, 6, Raw{"PRE"})
-			ps.PushComponent(6, 8, Stream{ActualStream, "a", nil})
+			ps.PushComponent(6, 8, Stream{ActualStream, "a", nil, nil})
 			ps.PushComponent(8, 10, IntervalAST{FloatLiteral{2}, Seconds})
+			ps.EnsureSlideSpec(10, 10)
 			ps.PushComponent(10, 12, NumericLiteral{2})
-			ps.EnsureCapacitySpec(10, 12)
+			ps.EnsureCapacityUnit(12, 12)
+			ps.EnsureWindowCapacitySpec(10, 12)
 			ps.PushComponent(12, 14, DropOldest)
 			ps.EnsureSheddingSpec(12, 14)
 			ps.AssembleStreamWindow()
@@ -43,10 +45,12 @@ func TestAssembleStreamWindow(t *testing.T) {
 
 		Convey("When the stack contains two correct items (float)", func() {
 			ps.PushComponent(0, 6, Raw{"PRE"})
-			ps.PushComponent(6, 8, Stream{ActualStream, "a", nil})
+			ps.PushComponent(6, 8, Stream{ActualStream, "a", nil, nil})
 			ps.PushComponent(8, 10, IntervalAST{FloatLiteral{0.2}, Seconds})
+			ps.EnsureSlideSpec(10, 10)
 			ps.PushComponent(10, 12, NumericLiteral{2})
-			ps.EnsureCapacitySpec(10, 12)
+			ps.EnsureCapacityUnit(12, 12)
+			ps.EnsureWindowCapacitySpec(10, 12)
 			ps.PushComponent(12, 14, DropNewest)
 			ps.EnsureSheddingSpec(12, 14)
 			ps.AssembleStreamWindow()
@@ -75,7 +79,7 @@ func TestAssembleStreamWindow(t *testing.T) {
 
 		Convey("When the stack contains a wrong item", func() {
 			ps.PushComponent(0, 6, Raw{"PRE"})
-			ps.PushComponent(6, 8, Stream{ActualStream, "a", nil})
+			ps.PushComponent(6, 8, Stream{ActualStream, "a", nil, nil})
 
 			Convey("Then AssembleStreamWindow panics", func() {
 				So(ps.AssembleStreamWindow, ShouldPanic)
@@ -120,6 +124,85 @@ func TestAssembleStreamWindow(t *testing.T) {
 			})
 		})
 
+		Convey("When selecting with a FROM having a memory-based BUFFER SIZE", func() {
+			for unit, expected := range map[string]CapacityUnit{
+				"B": Bytes, "KB": Kilobytes, "MB": Megabytes, "GB": Gigabytes,
+			} {
+				stmt := "CREATE STREAM x AS SELECT ISTREAM a, b FROM c [RANGE 3 TUPLES, BUFFER SIZE 16 " + unit + ", DROP OLDEST IF FULL]"
+
+				Convey("Then the statement should be parsed correctly with "+unit, func() {
+					p.Buffer = stmt
+					p.Init()
+					err := p.Parse()
+					So(err, ShouldEqual, nil)
+					p.Execute()
+
+					ps := p.parseStack
+					So(ps.Len(), ShouldEqual, 1)
+					top := ps.Peek().comp
+					comp := top.(CreateStreamAsSelectStmt).Select
+					So(comp.Relations[0].Capacity, ShouldEqual, 16)
+					So(comp.Relations[0].CapacityUnit, ShouldEqual, expected)
+					So(comp.Relations[0].Shedding, ShouldEqual, DropOldest)
+
+					Convey("And String() should return the original statement", func() {
+						So(top.(CreateStreamAsSelectStmt).String(), ShouldEqual, stmt)
+					})
+				})
+			}
+		})
+
+		Convey("When selecting with a FROM having a BUFFER SIZE without a unit", func() {
+			p.Buffer = "CREATE STREAM x AS SELECT ISTREAM a FROM c [RANGE 3 TUPLES, BUFFER SIZE 16]"
+			p.Init()
+
+			Convey("Then the capacity should be the number of tuples", func() {
+				So(p.Parse(), ShouldBeNil)
+				p.Execute()
+				comp := p.parseStack.Peek().comp.(CreateStreamAsSelectStmt).Select
+				So(comp.Relations[0].Capacity, ShouldEqual, 16)
+				So(comp.Relations[0].CapacityUnit, ShouldEqual, TupleCapacity)
+			})
+		})
+
+		Convey("When selecting with a FROM having an invalid memory unit", func() {
+			p.Buffer = "CREATE STREAM x AS SELECT ISTREAM a FROM c [RANGE 3 TUPLES, BUFFER SIZE 16 TB]"
+			p.Init()
+
+			Convey("Then parsing the statement should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When selecting with a FROM having a memory unit without BUFFER SIZE", func() {
+			p.Buffer = "CREATE STREAM x AS SELECT ISTREAM a FROM c [RANGE 3 TUPLES MB]"
+			p.Init()
+
+			Convey("Then parsing the statement should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When selecting with a FROM having a SLIDE", func() {
+			p.Buffer = "CREATE STREAM x AS SELECT ISTREAM a FROM c [RANGE 10 SECONDS, SLIDE 2 SECONDS, BUFFER SIZE 16]"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				So(p.Parse(), ShouldBeNil)
+				p.Execute()
+				top := p.parseStack.Peek().comp
+				comp := top.(CreateStreamAsSelectStmt).Select
+				So(comp.Relations[0].Value, ShouldEqual, 10)
+				So(comp.Relations[0].Unit, ShouldEqual, Seconds)
+				So(comp.Relations[0].Slide, ShouldResemble, IntervalAST{FloatLiteral{2}, Seconds})
+				So(comp.Relations[0].Capacity, ShouldEqual, 16)
+
+				Convey("And String() should return the original statement", func() {
+					So(top.(CreateStreamAsSelectStmt).String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
 		Convey("When selecting with a FROM (TUPLES/float)", func() {
 			p.Buffer = "CREATE STREAM x AS SELECT ISTREAM a, b FROM c [RANGE 3.0 TUPLES]"
 			p.Init()
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAssembleWithSelect(t *testing.T) {
+	Convey("Given a parseStack", t, func() {
+		ps := parseStack{}
+
+		Convey("When the stack contains named SELECT statements and a SelectStmt", func() {
+			ps.PushComponent(0, 6, Raw{"PRE"})
+			ps.PushComponent(11, 12, StreamIdentifier("a"))
+			ps.PushComponent(17, 20, SelectStmt{ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "x"}}, false}})
+			ps.AssembleNamedSelect()
+			ps.PushComponent(22, 25, SelectStmt{ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "y"}}, false}})
+			ps.AssembleWithSelect(6, 25)
+
+			Convey("Then AssembleWithSelect transforms them into one item", func() {
+				So(ps.Len(), ShouldEqual, 2)
+
+				Convey("And that item is a SelectStmt", func() {
+					top := ps.Peek()
+					So(top, ShouldNotBeNil)
+					So(top.begin, ShouldEqual, 6)
+					So(top.end, ShouldEqual, 25)
+					So(top.comp, ShouldHaveSameTypeAs, SelectStmt{})
+
+					Convey("And it contains the previously pushed data", func() {
+						comp := top.comp.(SelectStmt)
+						So(comp.Projections, ShouldResemble, []Expression{RowValue{"", "y"}})
+						So(len(comp.With), ShouldEqual, 1)
+						So(comp.With[0].Name, ShouldEqual, "a")
+						So(comp.With[0].Select.Projections, ShouldResemble, []Expression{RowValue{"", "x"}})
+					})
+				})
+			})
+		})
+
+		Convey("When the stack doesn't contain a SelectStmt", func() {
+			ps.PushComponent(6, 7, StreamIdentifier("a"))
+
+			Convey("Then AssembleWithSelect panics", func() {
+				So(func() { ps.AssembleWithSelect(6, 7) }, ShouldPanic)
+			})
+		})
+	})
+
+	Convey("Given a parser", t, func() {
+		p := &bqlPeg{}
+
+		Convey("When selecting with a WITH clause", func() {
+			p.Buffer = "WITH a AS (SELECT ISTREAM x FROM s [RANGE 1 TUPLES]), " +
+				"b AS (SELECT ISTREAM x FROM a [RANGE 1 TUPLES] WHERE x > 1) " +
+				"SELECT ISTREAM a:x, b:x AS y FROM a [RANGE 1 TUPLES], b [RANGE 1 TUPLES]"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				So(p.Parse(), ShouldBeNil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, SelectStmt{})
+				s := top.(SelectStmt)
+				So(len(s.With), ShouldEqual, 2)
+				So(s.With[0].Name, ShouldEqual, "a")
+				So(s.With[0].Select.Relations[0].Name, ShouldEqual, "s")
+				So(s.With[1].Name, ShouldEqual, "b")
+				So(s.With[1].Select.Filter, ShouldNotBeNil)
+				So(len(s.Relations), ShouldEqual, 2)
+
+				Convey("And String() should return the original statement", func() {
+					So(s.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When creating a stream with a WITH clause", func() {
+			p.Buffer = "CREATE STREAM t AS WITH a AS (SELECT ISTREAM x FROM s [RANGE 1 TUPLES]) " +
+				"SELECT ISTREAM x FROM a [RANGE 1 TUPLES]"
+			p.Init()
+
+			Convey("Then the statement should be parsed correctly", func() {
+				So(p.Parse(), ShouldBeNil)
+				p.Execute()
+
+				ps := p.parseStack
+				So(ps.Len(), ShouldEqual, 1)
+				top := ps.Peek().comp
+				So(top, ShouldHaveSameTypeAs, CreateStreamAsSelectStmt{})
+				s := top.(CreateStreamAsSelectStmt)
+				So(s.Name, ShouldEqual, "t")
+				So(len(s.Select.With), ShouldEqual, 1)
+				So(s.Select.With[0].Name, ShouldEqual, "a")
+
+				Convey("And String() should return the original statement", func() {
+					So(s.String(), ShouldEqual, p.Buffer)
+				})
+			})
+		})
+
+		Convey("When a named SELECT statement isn't parenthesized", func() {
+			p.Buffer = "WITH a AS SELECT ISTREAM x FROM s [RANGE 1 TUPLES] " +
+				"SELECT ISTREAM x FROM a [RANGE 1 TUPLES]"
+			p.Init()
+
+			Convey("Then parsing the statement should fail", func() {
+				So(p.Parse(), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -3,8 +3,10 @@ package parser
 import (
 	"fmt"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Expression interface {
@@ -22,21 +24,26 @@ type Expression interface {
 // Combined Structures (all with *AST)
 
 type SelectStmt struct {
+	WithAST
 	EmitterAST
 	ProjectionsAST
 	WindowedFromAST
 	FilterAST
 	GroupingAST
 	HavingAST
+	OrderByAST
+	LimitAST
 }
 
 func (s SelectStmt) String() string {
-	str := []string{"SELECT", s.EmitterAST.string()}
+	str := []string{s.WithAST.string(), "SELECT", s.EmitterAST.string()}
 	str = append(str, s.ProjectionsAST.string())
 	str = append(str, s.WindowedFromAST.string())
 	str = append(str, s.FilterAST.string())
 	str = append(str, s.GroupingAST.string())
 	str = append(str, s.HavingAST.string())
+	str = append(str, s.OrderByAST.string())
+	str = append(str, s.LimitAST.string())
 
 	st := []string{}
 	for _, s := range str {
@@ -47,8 +54,40 @@ func (s SelectStmt) String() string {
 	return strings.Join(st, " ")
 }
 
+// WithAST holds the named SELECT statements of a WITH clause. Each of
+// them is computed in an intermediate stream that can be referred to
+// by its name in the FROM clause of the main statement and of the
+// statements following it.
+type WithAST struct {
+	With []NamedSelectAST
+}
+
+func (a WithAST) string() string {
+	if len(a.With) == 0 {
+		return ""
+	}
+	ns := make([]string, len(a.With))
+	for i, n := range a.With {
+		ns[i] = n.string()
+	}
+	return "WITH " + strings.Join(ns, ", ")
+}
+
+type NamedSelectAST struct {
+	Name   StreamIdentifier
+	Select SelectStmt
+}
+
+func (a NamedSelectAST) string() string {
+	return fmt.Sprintf("%s AS (%s)", a.Name, a.Select.String())
+}
+
 type SelectUnionStmt struct {
 	Selects []SelectStmt
+	// Ordered is Yes when results of the SELECT statements computed from
+	// an input tuple should be emitted in the order of declaration. By
+	// default, they're interleaved nondeterministically.
+	Ordered BinaryKeyword
 }
 
 func (s SelectUnionStmt) String() string {
@@ -56,27 +95,59 @@ func (s SelectUnionStmt) String() string {
 	for i, s := range s.Selects {
 		str[i] = s.String()
 	}
-	return strings.Join(str, " UNION ALL ")
+	union := strings.Join(str, " UNION ALL ")
+	ordered := s.Ordered.string("ORDERED", "UNORDERED")
+	if ordered != "" {
+		union += " " + ordered
+	}
+	return union
 }
 
 type CreateStreamAsSelectStmt struct {
 	Name   StreamIdentifier
 	Select SelectStmt
+	// CaseInsensitive is Yes when column references in Select should
+	// match keys of input tuples case-insensitively.
+	CaseInsensitive BinaryKeyword
+	// SourceSinkSpecsAST has options of the stream given in the WITH
+	// clause, e.g. processing_timeout.
+	SourceSinkSpecsAST
+	CreateModifierAST
 }
 
 func (s CreateStreamAsSelectStmt) String() string {
-	str := []string{"CREATE", "STREAM", string(s.Name), "AS", s.Select.String()}
+	str := s.CreateModifierAST.insertInto([]string{"CREATE", "STREAM", string(s.Name)}, 2)
+	caseSensitivity := s.CaseInsensitive.string("CASE INSENSITIVE", "CASE SENSITIVE")
+	if caseSensitivity != "" {
+		str = append(str, caseSensitivity)
+	}
+	specs := s.SourceSinkSpecsAST.string("WITH")
+	if specs != "" {
+		str = append(str, specs)
+	}
+	str = append(str, "AS", s.Select.String())
 	return strings.Join(str, " ")
 }
 
 type CreateStreamAsSelectUnionStmt struct {
 	Name StreamIdentifier
 	SelectUnionStmt
+	// Recursive is true when the statement is CREATE RECURSIVE STREAM and
+	// its SELECT statements can refer to the stream itself. Results are fed
+	// back to the stream at most MaxIterations times.
+	Recursive     bool
+	MaxIterations int64
+	CreateModifierAST
 }
 
 func (s CreateStreamAsSelectUnionStmt) String() string {
+	if s.Recursive {
+		str := []string{"CREATE", "RECURSIVE", "STREAM", string(s.Name),
+			"MAX", "ITERATIONS", fmt.Sprint(s.MaxIterations), "AS", s.SelectUnionStmt.String()}
+		return strings.Join(str, " ")
+	}
 	str := []string{"CREATE", "STREAM", string(s.Name), "AS", s.SelectUnionStmt.String()}
-	return strings.Join(str, " ")
+	return strings.Join(s.CreateModifierAST.insertInto(str, 2), " ")
 }
 
 type CreateSourceStmt struct {
@@ -84,25 +155,35 @@ type CreateSourceStmt struct {
 	Name   StreamIdentifier
 	Type   SourceSinkType
 	SourceSinkSpecsAST
+	TimestampByAST
+	CreateModifierAST
 }
 
 func (s CreateSourceStmt) String() string {
 	str := []string{"CREATE", "SOURCE", string(s.Name), "TYPE", string(s.Type)}
 	paused := s.Paused.string("PAUSED", "UNPAUSED")
+	nameIdx := 2
 	if paused != "" {
 		str = append(str[:1], append([]string{paused}, str[1:]...)...)
+		nameIdx++
 	}
 	specs := s.SourceSinkSpecsAST.string("WITH")
 	if specs != "" {
 		str = append(str, specs)
 	}
-	return strings.Join(str, " ")
+	timestampBy := s.TimestampByAST.string()
+	if timestampBy != "" {
+		str = append(str, timestampBy)
+	}
+	return strings.Join(s.CreateModifierAST.insertInto(str, nameIdx), " ")
 }
 
 type CreateSinkStmt struct {
 	Name StreamIdentifier
 	Type SourceSinkType
 	SourceSinkSpecsAST
+	SchemaAST
+	CreateModifierAST
 }
 
 func (s CreateSinkStmt) String() string {
@@ -111,13 +192,18 @@ func (s CreateSinkStmt) String() string {
 	if specs != "" {
 		str = append(str, specs)
 	}
-	return strings.Join(str, " ")
+	schema := s.SchemaAST.string()
+	if schema != "" {
+		str = append(str, schema)
+	}
+	return strings.Join(s.CreateModifierAST.insertInto(str, 2), " ")
 }
 
 type CreateStateStmt struct {
 	Name StreamIdentifier
 	Type SourceSinkType
 	SourceSinkSpecsAST
+	CreateModifierAST
 }
 
 func (s CreateStateStmt) String() string {
@@ -126,7 +212,32 @@ func (s CreateStateStmt) String() string {
 	if specs != "" {
 		str = append(str, specs)
 	}
-	return strings.Join(str, " ")
+	return strings.Join(s.CreateModifierAST.insertInto(str, 2), " ")
+}
+
+// CreateModifierAST has modifiers of a CREATE statement which control
+// what happens when a node or a state having the same name already exists.
+type CreateModifierAST struct {
+	// OrReplace is Yes when the existing one should be replaced.
+	OrReplace BinaryKeyword
+	// IfNotExists is Yes when the statement should do nothing if one
+	// already exists.
+	IfNotExists BinaryKeyword
+}
+
+// insertInto adds the modifiers to the words of a CREATE statement. The
+// name of the node or the state has to be at str[nameIdx].
+func (m CreateModifierAST) insertInto(str []string, nameIdx int) []string {
+	res := make([]string, 0, len(str)+2)
+	res = append(res, str[0])
+	if m.OrReplace == Yes {
+		res = append(res, "OR REPLACE")
+	}
+	res = append(res, str[1:nameIdx]...)
+	if m.IfNotExists == Yes {
+		res = append(res, "IF NOT EXISTS")
+	}
+	return append(res, str[nameIdx:]...)
 }
 
 type UpdateStateStmt struct {
@@ -174,10 +285,28 @@ func (s UpdateSinkStmt) String() string {
 type InsertIntoFromStmt struct {
 	Sink  StreamIdentifier
 	Input StreamIdentifier
+	// DryRun is Yes when tuples from Input should only be counted by the
+	// sink node without being written to the sink.
+	DryRun BinaryKeyword
 }
 
 func (s InsertIntoFromStmt) String() string {
 	str := []string{"INSERT", "INTO", string(s.Sink), "FROM", string(s.Input)}
+	if dryRun := s.DryRun.string("DRY RUN", ""); dryRun != "" {
+		str = append(str, dryRun)
+	}
+	return strings.Join(str, " ")
+}
+
+// TeeStmt copies tuples of a stream to a sink without changing existing
+// destinations of the stream.
+type TeeStmt struct {
+	Stream StreamIdentifier
+	Sink   StreamIdentifier
+}
+
+func (s TeeStmt) String() string {
+	str := []string{"TEE", string(s.Stream), "TO", string(s.Sink)}
 	return strings.Join(str, " ")
 }
 
@@ -208,40 +337,95 @@ func (s RewindSourceStmt) String() string {
 	return strings.Join(str, " ")
 }
 
+// ReloadSourceStmt makes a source re-read its external configuration, such
+// as files or credentials, without recreating it. Unlike UpdateSourceStmt,
+// it doesn't change any parameter given in BQL.
+type ReloadSourceStmt struct {
+	Source StreamIdentifier
+}
+
+func (s ReloadSourceStmt) String() string {
+	str := []string{"RELOAD", "SOURCE", string(s.Source)}
+	return strings.Join(str, " ")
+}
+
 type DropSourceStmt struct {
 	Source StreamIdentifier
+	DropModifierAST
 }
 
 func (s DropSourceStmt) String() string {
 	str := []string{"DROP", "SOURCE", string(s.Source)}
-	return strings.Join(str, " ")
+	return strings.Join(s.DropModifierAST.appendTo(str), " ")
 }
 
 type DropStreamStmt struct {
 	Stream StreamIdentifier
+	DropModifierAST
 }
 
 func (s DropStreamStmt) String() string {
 	str := []string{"DROP", "STREAM", string(s.Stream)}
+	return strings.Join(s.DropModifierAST.appendTo(str), " ")
+}
+
+// DropModifierAST has modifiers of a DROP statement. DROP SINK and DROP
+// STATE statements only support IF EXISTS.
+type DropModifierAST struct {
+	// IfExists is Yes when the statement should do nothing if the target
+	// doesn't exist.
+	IfExists BinaryKeyword
+	// Cascade is Yes when nodes depending on the target should also be
+	// dropped.
+	Cascade BinaryKeyword
+}
+
+func (m DropModifierAST) appendTo(str []string) []string {
+	if m.IfExists == Yes {
+		str = append(str, "IF EXISTS")
+	}
+	if m.Cascade == Yes {
+		str = append(str, "CASCADE")
+	}
+	return str
+}
+
+type AlterStreamStmt struct {
+	Stream   StreamIdentifier
+	Capacity int64
+	Shedding SheddingOption
+}
+
+func (s AlterStreamStmt) String() string {
+	specs := []string{}
+	if s.Capacity != UnspecifiedCapacity {
+		specs = append(specs, fmt.Sprintf("BUFFER SIZE %d", s.Capacity))
+	}
+	if s.Shedding != UnspecifiedSheddingOption {
+		specs = append(specs, fmt.Sprintf("%s IF FULL", s.Shedding.String()))
+	}
+	str := []string{"ALTER", "STREAM", string(s.Stream), "SET", strings.Join(specs, ", ")}
 	return strings.Join(str, " ")
 }
 
 type DropSinkStmt struct {
-	Sink StreamIdentifier
+	Sink     StreamIdentifier
+	IfExists BinaryKeyword
 }
 
 func (s DropSinkStmt) String() string {
 	str := []string{"DROP", "SINK", string(s.Sink)}
-	return strings.Join(str, " ")
+	return strings.Join(DropModifierAST{IfExists: s.IfExists}.appendTo(str), " ")
 }
 
 type DropStateStmt struct {
-	State StreamIdentifier
+	State    StreamIdentifier
+	IfExists BinaryKeyword
 }
 
 func (s DropStateStmt) String() string {
 	str := []string{"DROP", "STATE", string(s.State)}
-	return strings.Join(str, " ")
+	return strings.Join(DropModifierAST{IfExists: s.IfExists}.appendTo(str), " ")
 }
 
 type LoadStateStmt struct {
@@ -303,6 +487,67 @@ func (s SaveStateStmt) String() string {
 	return strings.Join(str, " ")
 }
 
+// LoadPluginStmt loads a Go plugin which registers UDFs, UDSFs, UDSs, or
+// types of sources or sinks.
+type LoadPluginStmt struct {
+	Path string
+}
+
+func (s LoadPluginStmt) String() string {
+	str := []string{"LOAD", "PLUGIN", StringLiteral{s.Path}.String()}
+	return strings.Join(str, " ")
+}
+
+// CreateFunctionStmt defines a UDF written in a script language.
+type CreateFunctionStmt struct {
+	Name FuncName
+	FunctionParamsAST
+	Language Identifier
+	Body     string
+}
+
+func (s CreateFunctionStmt) String() string {
+	str := []string{"CREATE", "FUNCTION", string(s.Name) + s.FunctionParamsAST.string(),
+		"LANGUAGE", string(s.Language), "AS", "$$" + s.Body + "$$"}
+	return strings.Join(str, " ")
+}
+
+// CreateRemoteFunctionStmt defines a UDF calling a function running outside
+// of SensorBee, e.g. on a gRPC server. The function accepts any number of
+// arguments.
+type CreateRemoteFunctionStmt struct {
+	Name   FuncName
+	Type   Identifier
+	Params SourceSinkSpecsAST
+}
+
+func (s CreateRemoteFunctionStmt) String() string {
+	str := []string{"CREATE", "FUNCTION", string(s.Name), "TYPE", string(s.Type)}
+	if specs := s.Params.string("WITH"); specs != "" {
+		str = append(str, specs)
+	}
+	return strings.Join(str, " ")
+}
+
+// FunctionParamsAST has the names of the parameters of a function defined by
+// CREATE FUNCTION statement. A function without the parameter list accepts
+// any number of arguments and Variadic is true.
+type FunctionParamsAST struct {
+	Params   []Identifier
+	Variadic bool
+}
+
+func (a FunctionParamsAST) string() string {
+	if a.Variadic {
+		return ""
+	}
+	params := make([]string, len(a.Params))
+	for i, p := range a.Params {
+		params[i] = string(p)
+	}
+	return "(" + strings.Join(params, ", ") + ")"
+}
+
 type EvalStmt struct {
 	Expr  Expression
 	Input *MapAST
@@ -316,6 +561,65 @@ func (s EvalStmt) String() string {
 	return strings.Join(str, " ")
 }
 
+type StatusStmt struct {
+	Type NodeTypeKeyword
+	Name StreamIdentifier
+}
+
+func (s StatusStmt) String() string {
+	str := []string{"STATUS", "OF", s.Type.String(), string(s.Name)}
+	return strings.Join(str, " ")
+}
+
+// ShowStmt lists nodes or states of the given type, e.g. SHOW STREAMS.
+type ShowStmt struct {
+	Type NodeTypeKeyword
+}
+
+func (s ShowStmt) String() string {
+	str := []string{"SHOW", s.Type.String() + "S"}
+	return strings.Join(str, " ")
+}
+
+// DescribeStmt shows the detail of a node or a state.
+type DescribeStmt struct {
+	Name StreamIdentifier
+}
+
+func (s DescribeStmt) String() string {
+	str := []string{"DESCRIBE", string(s.Name)}
+	return strings.Join(str, " ")
+}
+
+// ShowUDFsStmt lists UDFs registered to the topology.
+type ShowUDFsStmt struct {
+}
+
+func (s ShowUDFsStmt) String() string {
+	return "SHOW UDFS"
+}
+
+// DescribeFunctionStmt shows the metadata of a UDF.
+type DescribeFunctionStmt struct {
+	Name FuncName
+}
+
+func (s DescribeFunctionStmt) String() string {
+	str := []string{"DESCRIBE", "FUNCTION", string(s.Name)}
+	return strings.Join(str, " ")
+}
+
+// ExplainStmt describes how the given SELECT statement would be executed
+// without running it.
+type ExplainStmt struct {
+	Select SelectStmt
+}
+
+func (s ExplainStmt) String() string {
+	str := []string{"EXPLAIN", s.Select.String()}
+	return strings.Join(str, " ")
+}
+
 type EmitterAST struct {
 	EmitterType    Emitter
 	EmitterOptions []interface{}
@@ -331,6 +635,8 @@ func (a EmitterAST) string() string {
 				optStrings[i] = fmt.Sprintf("LIMIT %d", obj.Limit)
 			case EmitterSampling:
 				optStrings[i] = obj.string()
+			case EmitterEmptyWindow:
+				optStrings[i] = obj.string()
 			}
 		}
 		s += " [" + strings.Join(optStrings, " ") + "]"
@@ -342,9 +648,31 @@ type EmitterLimit struct {
 	Limit int64
 }
 
+// EmitterEmptyWindow controls whether a statement having aggregate
+// functions without GROUP BY emits a row when no row in the window matches
+// the statement. By default, such a row is emitted and aggregate functions
+// compute their results from empty input, e.g. count returns 0.
+type EmitterEmptyWindow struct {
+	Skip bool
+}
+
+func (e EmitterEmptyWindow) string() string {
+	if e.Skip {
+		return "SKIP EMPTY"
+	}
+	return "EMIT EMPTY"
+}
+
+// UnspecifiedSeed is the value of EmitterSampling.Seed when the seed of
+// randomized sampling isn't specified.
+const UnspecifiedSeed int64 = -1
+
 type EmitterSampling struct {
 	Value float64
 	Type  EmitterSamplingType
+	// Seed is the seed of the random number generator used by
+	// RandomizedSampling. It's UnspecifiedSeed for other types.
+	Seed int64
 }
 
 func (e EmitterSampling) string() string {
@@ -360,6 +688,9 @@ func (e EmitterSampling) string() string {
 		}
 		return fmt.Sprintf("EVERY %d-%s TUPLE", int64(e.Value), countWord)
 	} else if e.Type == RandomizedSampling {
+		if e.Seed != UnspecifiedSeed {
+			return fmt.Sprintf("SAMPLE %v%% SEED %d", e.Value, e.Seed)
+		}
 		return fmt.Sprintf("SAMPLE %v%%", e.Value)
 	} else if e.Type == TimeBasedSampling {
 		if e.Value < 1 {
@@ -372,6 +703,9 @@ func (e EmitterSampling) string() string {
 
 type ProjectionsAST struct {
 	Projections []Expression
+	// Distinct is true when duplicate rows are removed from the results
+	// of each evaluation (SELECT DISTINCT).
+	Distinct bool
 }
 
 func (a ProjectionsAST) string() string {
@@ -379,7 +713,11 @@ func (a ProjectionsAST) string() string {
 	for _, e := range a.Projections {
 		prj = append(prj, e.String())
 	}
-	return strings.Join(prj, ", ")
+	s := strings.Join(prj, ", ")
+	if a.Distinct {
+		s = "DISTINCT " + s
+	}
+	return s
 }
 
 type AliasAST struct {
@@ -405,6 +743,12 @@ func (a AliasAST) String() string {
 
 type WindowedFromAST struct {
 	Relations []AliasedStreamWindowAST
+	// Joins has the explicit joins of relations given with JOIN ... ON.
+	// Joins[i] joins Relations[i+1] with the result of joining the
+	// preceding relations, and its Type is CrossJoin when the relation is
+	// separated by a comma. Joins is nil when there's no explicit join, i.e.
+	// all relations are joined by commas.
+	Joins []JoinAST
 }
 
 func (a WindowedFromAST) string() string {
@@ -412,11 +756,117 @@ func (a WindowedFromAST) string() string {
 		return ""
 	}
 
-	str := []string{}
-	for _, r := range a.Relations {
-		str = append(str, r.string())
+	if len(a.Joins) == 0 {
+		str := []string{}
+		for _, r := range a.Relations {
+			str = append(str, r.string())
+		}
+		return "FROM " + strings.Join(str, ", ")
+	}
+
+	str := "FROM " + a.Relations[0].string()
+	for i, j := range a.Joins {
+		if j.Type == CrossJoin {
+			str += ", " + a.Relations[i+1].string()
+			continue
+		}
+		str += fmt.Sprintf(" %s %s ON %s", j.Type, a.Relations[i+1].string(), j.On.String())
+	}
+	return str
+}
+
+// JoinAST is a join of a relation in the FROM clause.
+// MatchRecognizeAST is a MATCH_RECOGNIZE clause detecting sequences of
+// tuples matching a pattern in a stream, as in
+//
+//	s MATCH_RECOGNIZE (PARTITION BY id MEASURES a:v AS first, c:v AS last
+//	    PATTERN (a b+ c) DEFINE b AS v > a:v, c AS v < b:v)
+//
+// Each match is emitted as a tuple having the measures.
+type MatchRecognizeAST struct {
+	PartitionBy []Expression
+	// Measures are AliasAST expressions computed from the tuples bound to
+	// pattern variables.
+	Measures []Expression
+	Pattern  []MatchPatternElemAST
+	Define   []MatchDefineAST
+}
+
+func (a MatchRecognizeAST) string() string {
+	str := "MATCH_RECOGNIZE ("
+	if len(a.PartitionBy) > 0 {
+		str += "PARTITION BY " + ExpressionsAST{a.PartitionBy}.string() + " "
+	}
+	str += "MEASURES " + ExpressionsAST{a.Measures}.string()
+
+	ps := make([]string, len(a.Pattern))
+	for i, p := range a.Pattern {
+		ps[i] = p.string()
 	}
-	return "FROM " + strings.Join(str, ", ")
+	str += " PATTERN (" + strings.Join(ps, " ") + ")"
+
+	if len(a.Define) > 0 {
+		ds := make([]string, len(a.Define))
+		for i, d := range a.Define {
+			ds[i] = d.string()
+		}
+		str += " DEFINE " + strings.Join(ds, ", ")
+	}
+	return str + ")"
+}
+
+// MatchPatternElemAST is a pattern variable with its quantifier. The
+// variable has to match at least Min and at most Max consecutive tuples.
+// Max is -1 when there's no upper bound.
+type MatchPatternElemAST struct {
+	Var string
+	Min int64
+	Max int64
+}
+
+func (a MatchPatternElemAST) string() string {
+	q := ""
+	switch {
+	case a.Min == 1 && a.Max == 1:
+	case a.Min == 0 && a.Max == 1:
+		q = "?"
+	case a.Min == 0 && a.Max < 0:
+		q = "*"
+	case a.Min == 1 && a.Max < 0:
+		q = "+"
+	case a.Min == a.Max:
+		q = fmt.Sprintf("{%v}", a.Min)
+	case a.Max < 0:
+		q = fmt.Sprintf("{%v,}", a.Min)
+	default:
+		q = fmt.Sprintf("{%v,%v}", a.Min, a.Max)
+	}
+	return a.Var + q
+}
+
+// MatchDefineAST is the condition a tuple has to satisfy to be bound to
+// the pattern variable Var. A variable without a condition matches any
+// tuple.
+type MatchDefineAST struct {
+	Var  string
+	Cond Expression
+}
+
+func (a MatchDefineAST) string() string {
+	return a.Var + " AS " + a.Cond.String()
+}
+
+type JoinAST struct {
+	Type JoinType
+	// On is the join condition. It's nil when Type is CrossJoin.
+	On Expression
+}
+
+// joinedRelationAST is a relation given with JOIN ... ON. It only exists on
+// the parse stack until the FROM clause is assembled.
+type joinedRelationAST struct {
+	AliasedStreamWindowAST
+	JoinAST
 }
 
 type AliasedStreamWindowAST struct {
@@ -439,13 +889,27 @@ type StreamWindowAST struct {
 	IntervalAST
 	Capacity int64
 	Shedding SheddingOption
+	// CapacityUnit is the unit of Capacity. When it's a unit of bytes, the
+	// capacity in tuples is derived from the memory budget when the
+	// statement is built.
+	CapacityUnit CapacityUnit
+	// Slide is the interval at which the statement is evaluated. Its Unit
+	// is UnspecifiedIntervalUnit when the statement is evaluated on every
+	// tuple.
+	Slide IntervalAST
 }
 
 func (a StreamWindowAST) string() string {
 	interval := a.IntervalAST.string()
+	if a.Slide.Unit != UnspecifiedIntervalUnit {
+		interval += ", SLIDE " + a.Slide.FloatLiteral.String() + " " + a.Slide.Unit.String()
+	}
 	capacity := ""
 	if a.Capacity != UnspecifiedCapacity {
 		capacity = fmt.Sprintf(", BUFFER SIZE %d", a.Capacity)
+		if a.CapacityUnit != TupleCapacity {
+			capacity += " " + a.CapacityUnit.String()
+		}
 	}
 	shedding := ""
 	if a.Shedding != UnspecifiedSheddingOption {
@@ -463,6 +927,12 @@ func (a StreamWindowAST) string() string {
 			ps = append(ps, p.String())
 		}
 		return a.Stream.Name + "(" + strings.Join(ps, ", ") + ") " + suffix
+
+	case DroppedTuplesStream:
+		return a.Stream.Name + " DROPPED TUPLES " + suffix
+
+	case MatchRecognizeStream:
+		return a.Stream.Name + " " + a.Stream.MatchRecognize.string() + " " + suffix
 	}
 
 	return "UnknownStreamType"
@@ -515,6 +985,45 @@ func (a HavingAST) string() string {
 	return "HAVING " + a.Having.String()
 }
 
+// OrderByAST is the ORDER BY clause of a SELECT statement. Results computed
+// from an input tuple are sorted by OrderBy before they're emitted.
+type OrderByAST struct {
+	OrderBy []SortedExpressionAST
+}
+
+func (a OrderByAST) string() string {
+	if len(a.OrderBy) == 0 {
+		return ""
+	}
+
+	str := make([]string, len(a.OrderBy))
+	for i, e := range a.OrderBy {
+		str[i] = e.String()
+	}
+	return "ORDER BY " + strings.Join(str, ", ")
+}
+
+// LimitAST is the LIMIT clause of a SELECT statement. At most Limit results
+// computed from an input tuple are emitted after skipping the first Offset
+// results. Unlike the LIMIT option of the emitter, it doesn't limit the
+// total number of results emitted by the statement.
+type LimitAST struct {
+	// HasLimit is true when the statement has a LIMIT clause.
+	HasLimit bool
+	Limit    int64
+	Offset   int64
+}
+
+func (a LimitAST) string() string {
+	if !a.HasLimit {
+		return ""
+	}
+	if a.Offset == 0 {
+		return fmt.Sprintf("LIMIT %d", a.Limit)
+	}
+	return fmt.Sprintf("LIMIT %d OFFSET %d", a.Limit, a.Offset)
+}
+
 type SourceSinkSpecsAST struct {
 	Params []SourceSinkParamAST
 }
@@ -530,9 +1039,53 @@ func (a SourceSinkSpecsAST) string(keyword string) string {
 	return keyword + " " + strings.Join(ps, ", ")
 }
 
+// SchemaAST is a SCHEMA clause declaring columns of tuples and their types.
+// Columns is empty when the clause isn't given.
+type SchemaAST struct {
+	Columns []SchemaColumnAST
+}
+
+func (a SchemaAST) string() string {
+	if len(a.Columns) == 0 {
+		return ""
+	}
+	cs := make([]string, len(a.Columns))
+	for i, c := range a.Columns {
+		cs[i] = c.string()
+	}
+	return "SCHEMA (" + strings.Join(cs, ", ") + ")"
+}
+
+// TimestampByAST is a WITH TIMESTAMP BY clause giving the expression which
+// computes the event time of a tuple emitted by a source. TimestampBy is nil
+// when the clause isn't given.
+type TimestampByAST struct {
+	TimestampBy Expression
+}
+
+func (a TimestampByAST) string() string {
+	if a.TimestampBy == nil {
+		return ""
+	}
+	return "WITH TIMESTAMP BY " + a.TimestampBy.String()
+}
+
+// SchemaColumnAST is a column declared in a SCHEMA clause.
+type SchemaColumnAST struct {
+	Name Identifier
+	Type Type
+}
+
+func (a SchemaColumnAST) string() string {
+	return string(a.Name) + " " + a.Type.String()
+}
+
 type SourceSinkParamAST struct {
 	Key   SourceSinkParamKey
 	Value data.Value
+	// Env is set when the value is given by env('NAME'). Value is nil in
+	// that case because it's resolved when the statement is executed.
+	Env *EnvParamAST
 }
 
 func (a SourceSinkParamAST) string() string {
@@ -546,7 +1099,9 @@ func (a SourceSinkParamAST) string() string {
 		return s
 	}
 	var valRepr string
-	if a.Value.Type() == data.TypeArray {
+	if a.Env != nil {
+		valRepr = a.Env.string(mkString)
+	} else if a.Value.Type() == data.TypeArray {
 		// convert arrays to string elementwise and
 		// add brackets
 		arr, _ := data.AsArray(a.Value)
@@ -570,6 +1125,21 @@ func (a SourceSinkParamAST) string() string {
 	return string(a.Key) + "=" + valRepr
 }
 
+// EnvParamAST is a parameter value read from an environment variable. Default
+// is nil when it isn't given.
+type EnvParamAST struct {
+	Name    string
+	Default data.Value
+}
+
+func (a EnvParamAST) string(mkString func(v data.Value) string) string {
+	args := []string{StringLiteral{Value: a.Name}.String()}
+	if a.Default != nil {
+		args = append(args, mkString(a.Default))
+	}
+	return "env(" + strings.Join(args, ", ") + ")"
+}
+
 type BinaryOpAST struct {
 	Op    Operator
 	Left  Expression
@@ -634,9 +1204,58 @@ func (b BinaryOpAST) String() string {
 		str[2] = "(" + str[2] + ")"
 	}
 
+	// IN and BETWEEN hold their right operand in an array, which is
+	// written as a parenthesized list and "lower AND upper", respectively
+	if arr, ok := b.Right.(ArrayAST); ok {
+		switch {
+		case b.Op == In:
+			str[2] = "(" + arr.ExpressionsAST.string() + ")"
+		case b.Op == Between && len(arr.Expressions) == 2:
+			bounds := make([]string, 2)
+			for i, e := range arr.Expressions {
+				bounds[i] = e.String()
+				if bo, ok := e.(BinaryOpAST); ok && !bo.Op.hasHigherPrecedenceThan(b.Op) {
+					bounds[i] = "(" + bounds[i] + ")"
+				}
+			}
+			str[2] = bounds[0] + " AND " + bounds[1]
+		}
+	}
+	if lp, ok := b.Right.(LikePatternAST); ok {
+		pattern := lp.Pattern.String()
+		if bo, ok := lp.Pattern.(BinaryOpAST); ok && !bo.Op.hasHigherPrecedenceThan(b.Op) {
+			pattern = "(" + pattern + ")"
+		}
+		str[2] = pattern + " ESCAPE " + lp.Escape.String()
+	}
+
 	return strings.Join(str, " ")
 }
 
+// LikePatternAST is the right operand of LIKE having an ESCAPE clause. Escape
+// is a string literal having a single character, which is used instead of a
+// backslash to escape '%' and '_' in Pattern.
+type LikePatternAST struct {
+	Pattern Expression
+	Escape  StringLiteral
+}
+
+func (l LikePatternAST) ReferencedRelations() map[string]bool {
+	return l.Pattern.ReferencedRelations()
+}
+
+func (l LikePatternAST) RenameReferencedRelation(from, to string) Expression {
+	return LikePatternAST{l.Pattern.RenameReferencedRelation(from, to), l.Escape}
+}
+
+func (l LikePatternAST) Foldable() bool {
+	return l.Pattern.Foldable()
+}
+
+func (l LikePatternAST) String() string {
+	return l.Pattern.String() + " ESCAPE " + l.Escape.String()
+}
+
 type UnaryOpAST struct {
 	Op   Operator
 	Expr Expression
@@ -706,6 +1325,10 @@ type FuncAppAST struct {
 	Function FuncName
 	ExpressionsAST
 	Ordering []SortedExpressionAST
+	Distinct bool
+	// Filter is the condition of a FILTER clause, which restricts the rows
+	// aggregated by the function. It's nil when there's no FILTER clause.
+	Filter Expression
 }
 
 func (f FuncAppAST) ReferencedRelations() map[string]bool {
@@ -720,6 +1343,11 @@ func (f FuncAppAST) ReferencedRelations() map[string]bool {
 			rels[rel] = true
 		}
 	}
+	if f.Filter != nil {
+		for rel := range f.Filter.ReferencedRelations() {
+			rels[rel] = true
+		}
+	}
 	return rels
 }
 
@@ -732,7 +1360,11 @@ func (f FuncAppAST) RenameReferencedRelation(from, to string) Expression {
 	for i, expr := range f.Ordering {
 		newOrderExprs[i] = expr.RenameReferencedRelation(from, to).(SortedExpressionAST)
 	}
-	return FuncAppAST{f.Function, ExpressionsAST{newExprs}, newOrderExprs}
+	var filter Expression
+	if f.Filter != nil {
+		filter = f.Filter.RenameReferencedRelation(from, to)
+	}
+	return FuncAppAST{f.Function, ExpressionsAST{newExprs}, newOrderExprs, f.Distinct, filter}
 }
 
 func (f FuncAppAST) Foldable() bool {
@@ -741,9 +1373,9 @@ func (f FuncAppAST) Foldable() bool {
 	if string(f.Function) == "now" && len(f.Expressions) == 0 {
 		return false
 	}
-	// if there is a ORDER BY clause, then this is definitely an
-	// aggregate function and therefore not foldable
-	if len(f.Ordering) > 0 {
+	// if there is a ORDER BY, DISTINCT, or FILTER clause, then this is
+	// definitely an aggregate function and therefore not foldable
+	if len(f.Ordering) > 0 || f.Distinct || f.Filter != nil {
 		return false
 	}
 	for _, expr := range f.Expressions {
@@ -756,7 +1388,11 @@ func (f FuncAppAST) Foldable() bool {
 }
 
 func (f FuncAppAST) String() string {
-	s := string(f.Function) + "(" + f.ExpressionsAST.string()
+	s := string(f.Function) + "("
+	if f.Distinct {
+		s += "DISTINCT "
+	}
+	s += f.ExpressionsAST.string()
 	if len(f.Ordering) > 0 {
 		orderStrings := make([]string, len(f.Ordering))
 		for i, expr := range f.Ordering {
@@ -764,7 +1400,34 @@ func (f FuncAppAST) String() string {
 		}
 		s += " ORDER BY " + strings.Join(orderStrings, ", ")
 	}
-	return s + ")"
+	s += ")"
+	if f.Filter != nil {
+		s += " FILTER (WHERE " + f.Filter.String() + ")"
+	}
+	return s
+}
+
+// NamedArgAST is an argument of a function application given with the name
+// of the parameter, e.g. `times => 3`. It's only accepted by UDSFs.
+type NamedArgAST struct {
+	Name string
+	Expr Expression
+}
+
+func (n NamedArgAST) ReferencedRelations() map[string]bool {
+	return n.Expr.ReferencedRelations()
+}
+
+func (n NamedArgAST) RenameReferencedRelation(from, to string) Expression {
+	return NamedArgAST{n.Name, n.Expr.RenameReferencedRelation(from, to)}
+}
+
+func (n NamedArgAST) Foldable() bool {
+	return n.Expr.Foldable()
+}
+
+func (n NamedArgAST) String() string {
+	return n.Name + " => " + n.Expr.String()
 }
 
 type SortedExpressionAST struct {
@@ -854,6 +1517,11 @@ func (m MapAST) ReferencedRelations() map[string]bool {
 		for rel := range pair.Value.ReferencedRelations() {
 			rels[rel] = true
 		}
+		if pair.KeyExpr != nil {
+			for rel := range pair.KeyExpr.ReferencedRelations() {
+				rels[rel] = true
+			}
+		}
 	}
 	return rels
 }
@@ -864,6 +1532,10 @@ func (m MapAST) RenameReferencedRelation(from, to string) Expression {
 		newEntries[i] = KeyValuePairAST{
 			pair.Key,
 			pair.Value.RenameReferencedRelation(from, to),
+			nil,
+		}
+		if pair.KeyExpr != nil {
+			newEntries[i].KeyExpr = pair.KeyExpr.RenameReferencedRelation(from, to)
 		}
 	}
 	return MapAST{newEntries}
@@ -876,6 +1548,10 @@ func (m MapAST) Foldable() bool {
 			foldable = false
 			break
 		}
+		if pair.KeyExpr != nil && !pair.KeyExpr.Foldable() {
+			foldable = false
+			break
+		}
 	}
 	return foldable
 }
@@ -888,12 +1564,21 @@ func (m MapAST) String() string {
 	return "{" + strings.Join(entries, ", ") + "}"
 }
 
+// KeyValuePairAST is an entry of a map expression. The key is usually the
+// static string Key, e.g. {"a": x}. When KeyExpr isn't nil, the key is
+// computed from it for each input row instead, e.g. {(a || "_x"): x}, and
+// Key is empty. A computed key must be evaluated to a string, otherwise
+// evaluating the map fails.
 type KeyValuePairAST struct {
-	Key   string
-	Value Expression
+	Key     string
+	Value   Expression
+	KeyExpr Expression
 }
 
 func (k KeyValuePairAST) string() string {
+	if k.KeyExpr != nil {
+		return "(" + k.KeyExpr.String() + "):" + k.Value.String()
+	}
 	return `"` + k.Key + `":` + k.Value.String()
 }
 
@@ -911,10 +1596,13 @@ type Stream struct {
 	Type   StreamType
 	Name   string
 	Params []Expression
+	// MatchRecognize is the MATCH_RECOGNIZE clause applied to the stream.
+	// It's nil unless Type is MatchRecognizeStream.
+	MatchRecognize *MatchRecognizeAST
 }
 
 func NewStream(s string) Stream {
-	return Stream{ActualStream, s, nil}
+	return Stream{ActualStream, s, nil, nil}
 }
 
 type Wildcard struct {
@@ -997,6 +1685,33 @@ func NewRowValue(s string) RowValue {
 	return RowValue{components[0], components[1]}
 }
 
+// Placeholder is a named parameter such as `$name` in a prepared
+// statement. It must be replaced by a literal with PreparedStmt.Bind
+// before the statement is executed.
+type Placeholder struct {
+	Name string
+}
+
+func (p Placeholder) ReferencedRelations() map[string]bool {
+	return nil
+}
+
+func (p Placeholder) RenameReferencedRelation(from, to string) Expression {
+	return p
+}
+
+func (p Placeholder) Foldable() bool {
+	return false
+}
+
+func (p Placeholder) String() string {
+	return "$" + p.Name
+}
+
+func NewPlaceholder(s string) Placeholder {
+	return Placeholder{strings.TrimPrefix(s, "$")}
+}
+
 type WhenThenPairAST struct {
 	When Expression
 	Then Expression
@@ -1177,11 +1892,25 @@ func (l NumericLiteral) String() string {
 }
 
 func NewNumericLiteral(s string) NumericLiteral {
-	val, err := strconv.ParseInt(s, 10, 64)
+	l, err := ParseNumericLiteral(s)
 	if err != nil {
 		panic(err)
 	}
-	return NumericLiteral{val}
+	return l
+}
+
+// ParseNumericLiteral creates a NumericLiteral from a string. Unlike
+// NewNumericLiteral, it returns an error when the string doesn't represent
+// an integer or the integer overflows int64.
+func ParseNumericLiteral(s string) (NumericLiteral, error) {
+	val, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		if nErr, ok := err.(*strconv.NumError); ok && nErr.Err == strconv.ErrRange {
+			return NumericLiteral{}, fmt.Errorf("numeric literal %v is out of the range of int64", s)
+		}
+		return NumericLiteral{}, fmt.Errorf("invalid numeric literal %v", s)
+	}
+	return NumericLiteral{val}, nil
 }
 
 type FloatLiteral struct {
@@ -1212,6 +1941,193 @@ func NewFloatLiteral(s string) FloatLiteral {
 	return FloatLiteral{val}
 }
 
+// IntervalLiteral is a length of time written like `INTERVAL 90 MINUTES` or
+// `INTERVAL "1 02:03:04" DAY TO SECOND`. It isn't a value by itself, but
+// it can be added to or subtracted from a timestamp.
+type IntervalLiteral struct {
+	Value time.Duration
+}
+
+func (l IntervalLiteral) ReferencedRelations() map[string]bool {
+	return nil
+}
+
+func (l IntervalLiteral) RenameReferencedRelation(from, to string) Expression {
+	return l
+}
+
+func (l IntervalLiteral) Foldable() bool {
+	return true
+}
+
+// String returns the interval as components of days, hours, minutes, and
+// seconds, e.g. INTERVAL 1 DAY 2 HOURS 3.5 SECONDS, regardless of how it was
+// written. All components are negative when the interval is negative.
+func (l IntervalLiteral) String() string {
+	sign := ""
+	u := uint64(l.Value)
+	if l.Value < 0 {
+		sign = "-"
+		u = uint64(-l.Value) // also correct for math.MinInt64
+	}
+
+	comps := []string{"INTERVAL"}
+	for _, f := range []IntervalField{DayField, HourField, MinuteField} {
+		unit := uint64(f.duration())
+		if n := u / unit; n > 0 {
+			comps = append(comps, fmt.Sprintf("%v%v %v", sign, n, f.unitName(n == 1)))
+			u %= unit
+		}
+	}
+	if u > 0 || len(comps) == 1 {
+		sec, nsec := u/uint64(time.Second), u%uint64(time.Second)
+		n := strconv.FormatUint(sec, 10)
+		if nsec > 0 {
+			n += strings.TrimRight(fmt.Sprintf(".%09d", nsec), "0")
+		}
+		if u == 0 {
+			sign = ""
+		}
+		comps = append(comps, fmt.Sprintf("%v%v %v", sign, n, SecondField.unitName(n == "1")))
+	}
+	return strings.Join(comps, " ")
+}
+
+// ParseIntervalString creates an IntervalLiteral from a string having the
+// fields from `from` to `to`, e.g. "1 02:03:04.5" for DAY TO SECOND or
+// "02:03" for HOUR TO MINUTE. The string has a number when the interval has
+// only one field, in which case to can be UnspecifiedIntervalField. Only the
+// last field can have a fraction and the fields except the first one must
+// be less than their upper limits, e.g. 24 for HOUR. The whole interval is
+// negative when the string starts with "-".
+func ParseIntervalString(s string, from, to IntervalField) (IntervalLiteral, error) {
+	if to == UnspecifiedIntervalField {
+		to = from
+	}
+	if from == UnspecifiedIntervalField || from > to ||
+		(from != to && to == MillisecondField) {
+		return IntervalLiteral{}, fmt.Errorf("invalid interval fields: %v TO %v", from, to)
+	}
+
+	str := strings.TrimSpace(s)
+	neg := strings.HasPrefix(str, "-")
+	if neg {
+		str = str[1:]
+	}
+	var parts []string
+	if from == DayField && to != DayField {
+		i := strings.IndexByte(str, ' ')
+		if i < 0 {
+			return IntervalLiteral{}, fmt.Errorf(`interval "%v" doesn't match %v TO %v`, s, from, to)
+		}
+		parts = append([]string{str[:i]}, strings.Split(strings.TrimSpace(str[i+1:]), ":")...)
+	} else {
+		parts = strings.Split(str, ":")
+	}
+	if len(parts) != int(to-from)+1 {
+		return IntervalLiteral{}, fmt.Errorf(`interval "%v" doesn't match %v TO %v`, s, from, to)
+	}
+
+	limits := map[IntervalField]float64{HourField: 24, MinuteField: 60, SecondField: 60}
+	var d time.Duration
+	for i, p := range parts {
+		f := from + IntervalField(i)
+		last := i == len(parts)-1
+		if !isIntervalNumber(p, last) {
+			return IntervalLiteral{}, fmt.Errorf(`invalid %v in interval "%v"`, f, s)
+		}
+		v, _ := strconv.ParseFloat(p, 64)
+		if l, ok := limits[f]; ok && i > 0 && v >= l {
+			return IntervalLiteral{}, fmt.Errorf(`%v in interval "%v" must be less than %v`, f, s, l)
+		}
+		if neg {
+			v = -v
+		}
+
+		var c time.Duration
+		var err error
+		if last {
+			c, err = floatIntervalComponent(v, f)
+		} else {
+			c, err = intIntervalComponent(int64(v), f)
+		}
+		if err == nil {
+			d, err = addIntervalComponent(d, c)
+		}
+		if err != nil {
+			return IntervalLiteral{}, fmt.Errorf(`interval "%v" is out of range`, s)
+		}
+	}
+	return IntervalLiteral{d}, nil
+}
+
+// isIntervalNumber returns true when s only has digits, and a decimal point
+// if fraction is true.
+func isIntervalNumber(s string, fraction bool) bool {
+	if s == "" || s == "." {
+		return false
+	}
+	point := false
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+		case c == '.' && fraction && !point:
+			point = true
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// intervalFromComponents creates an IntervalLiteral from pairs of a
+// NumericLiteral or FloatLiteral and an IntervalField such as 1 HOUR.
+func intervalFromComponents(elems []interface{}) (IntervalLiteral, error) {
+	var d time.Duration
+	for i := 0; i+1 < len(elems); i += 2 {
+		f := elems[i+1].(IntervalField)
+		var c time.Duration
+		var err error
+		if n, ok := elems[i].(NumericLiteral); ok {
+			c, err = intIntervalComponent(n.Value, f)
+		} else {
+			c, err = floatIntervalComponent(elems[i].(FloatLiteral).Value, f)
+		}
+		if err == nil {
+			d, err = addIntervalComponent(d, c)
+		}
+		if err != nil {
+			return IntervalLiteral{}, err
+		}
+	}
+	return IntervalLiteral{d}, nil
+}
+
+var errIntervalOutOfRange = fmt.Errorf("interval is out of range")
+
+func intIntervalComponent(n int64, f IntervalField) (time.Duration, error) {
+	unit := int64(f.duration())
+	if n > math.MaxInt64/unit || n < math.MinInt64/unit {
+		return 0, errIntervalOutOfRange
+	}
+	return time.Duration(n * unit), nil
+}
+
+func floatIntervalComponent(v float64, f IntervalField) (time.Duration, error) {
+	x := math.Floor(v*float64(f.duration()) + 0.5)
+	if math.IsNaN(x) || x >= math.MaxInt64 || x < math.MinInt64 {
+		return 0, errIntervalOutOfRange
+	}
+	return time.Duration(x), nil
+}
+
+func addIntervalComponent(d, c time.Duration) (time.Duration, error) {
+	if (c > 0 && d > math.MaxInt64-c) || (c < 0 && d < math.MinInt64-c) {
+		return 0, errIntervalOutOfRange
+	}
+	return d + c, nil
+}
+
 type NullLiteral struct {
 }
 
@@ -1342,6 +2258,31 @@ func (e Emitter) String() string {
 	return s
 }
 
+type NodeTypeKeyword int
+
+const (
+	UnspecifiedNodeType NodeTypeKeyword = iota
+	SourceNodeType
+	StreamNodeType
+	SinkNodeType
+	StateNodeType
+)
+
+func (k NodeTypeKeyword) String() string {
+	s := "UNSPECIFIED"
+	switch k {
+	case SourceNodeType:
+		s = "SOURCE"
+	case StreamNodeType:
+		s = "STREAM"
+	case SinkNodeType:
+		s = "SINK"
+	case StateNodeType:
+		s = "STATE"
+	}
+	return s
+}
+
 type EmitterSamplingType int
 
 const (
@@ -1370,6 +2311,12 @@ const (
 	UnknownStreamType StreamType = iota
 	ActualStream
 	UDSFStream
+	// DroppedTuplesStream is a stream of tuples dropped by the node having
+	// the name of the stream.
+	DroppedTuplesStream
+	// MatchRecognizeStream is a stream of matches of a MATCH_RECOGNIZE
+	// clause applied to the stream having the name.
+	MatchRecognizeStream
 )
 
 func (st StreamType) String() string {
@@ -1379,6 +2326,10 @@ func (st StreamType) String() string {
 		s = "ActualStream"
 	case UDSFStream:
 		s = "UDSFStream"
+	case DroppedTuplesStream:
+		s = "DroppedTuplesStream"
+	case MatchRecognizeStream:
+		s = "MatchRecognizeStream"
 	}
 	return s
 }
@@ -1405,12 +2356,67 @@ func (i IntervalUnit) String() string {
 	return s
 }
 
+// IntervalField is a unit of a component of an IntervalLiteral.
+type IntervalField int
+
+const (
+	UnspecifiedIntervalField IntervalField = iota
+	DayField
+	HourField
+	MinuteField
+	SecondField
+	MillisecondField
+)
+
+func (f IntervalField) String() string {
+	s := "UNSPECIFIED"
+	switch f {
+	case DayField:
+		s = "DAY"
+	case HourField:
+		s = "HOUR"
+	case MinuteField:
+		s = "MINUTE"
+	case SecondField:
+		s = "SECOND"
+	case MillisecondField:
+		s = "MILLISECOND"
+	}
+	return s
+}
+
+// unitName returns the name of the field used after a number.
+func (f IntervalField) unitName(singular bool) string {
+	if singular {
+		return f.String()
+	}
+	return f.String() + "S"
+}
+
+// duration returns the length of one unit of the field.
+func (f IntervalField) duration() time.Duration {
+	switch f {
+	case DayField:
+		return 24 * time.Hour
+	case HourField:
+		return time.Hour
+	case MinuteField:
+		return time.Minute
+	case SecondField:
+		return time.Second
+	case MillisecondField:
+		return time.Millisecond
+	}
+	return 0
+}
+
 type MetaInformation int
 
 const (
 	UnknownMeta MetaInformation = iota
 	TimestampMeta
 	NowMeta
+	CorrelationIDMeta
 )
 
 func (m MetaInformation) String() string {
@@ -1420,6 +2426,8 @@ func (m MetaInformation) String() string {
 		s = "TS"
 	case NowMeta:
 		s = "NOW"
+	case CorrelationIDMeta:
+		s = "CORRELATION_ID"
 	}
 	return s
 }
@@ -1431,6 +2439,8 @@ func (m MetaInformation) string() string {
 		s = "ts()"
 	case NowMeta:
 		s = "now()"
+	case CorrelationIDMeta:
+		s = "correlation_id()"
 	}
 	return s
 }
@@ -1464,6 +2474,51 @@ func (k BinaryKeyword) string(yes, no string) string {
 	return ""
 }
 
+// CapacityUnit is the unit of BUFFER SIZE.
+type CapacityUnit int
+
+const (
+	// TupleCapacity means that BUFFER SIZE is the number of tuples.
+	TupleCapacity CapacityUnit = iota
+	// Bytes, Kilobytes, Megabytes, and Gigabytes mean that BUFFER SIZE is
+	// the amount of memory. A kilobyte is 1024 bytes.
+	Bytes
+	Kilobytes
+	Megabytes
+	Gigabytes
+)
+
+func (u CapacityUnit) String() string {
+	s := "TUPLES"
+	switch u {
+	case Bytes:
+		s = "B"
+	case Kilobytes:
+		s = "KB"
+	case Megabytes:
+		s = "MB"
+	case Gigabytes:
+		s = "GB"
+	}
+	return s
+}
+
+// Bytes returns the number of bytes in the unit. It returns 0 for
+// TupleCapacity.
+func (u CapacityUnit) Bytes() int64 {
+	switch u {
+	case Bytes:
+		return 1
+	case Kilobytes:
+		return 1 << 10
+	case Megabytes:
+		return 1 << 20
+	case Gigabytes:
+		return 1 << 30
+	}
+	return 0
+}
+
 type SheddingOption int
 
 const (
@@ -1486,6 +2541,39 @@ func (t SheddingOption) String() string {
 	return s
 }
 
+// JoinType is the type of a join of a relation in the FROM clause.
+type JoinType int
+
+const (
+	UnspecifiedJoinType JoinType = iota
+	// CrossJoin is the cartesian product with the relation, i.e. a join
+	// with a comma.
+	CrossJoin
+	// LeftOuterJoin emits rows of the left side having no matching row on
+	// the right side with the columns of the right side being NULL.
+	LeftOuterJoin
+	// RightOuterJoin emits rows of the right side having no matching row on
+	// the left side with the columns of the left side being NULL.
+	RightOuterJoin
+	// FullOuterJoin is the combination of LeftOuterJoin and RightOuterJoin.
+	FullOuterJoin
+)
+
+func (t JoinType) String() string {
+	s := "UnspecifiedJoinType"
+	switch t {
+	case CrossJoin:
+		s = "CROSS JOIN"
+	case LeftOuterJoin:
+		s = "LEFT OUTER JOIN"
+	case RightOuterJoin:
+		s = "RIGHT OUTER JOIN"
+	case FullOuterJoin:
+		s = "FULL OUTER JOIN"
+	}
+	return s
+}
+
 type Type int
 
 const (
@@ -1538,6 +2626,12 @@ const (
 	Greater
 	GreaterOrEqual
 	NotEqual
+	Contains
+	HasKey
+	In
+	Between
+	Like
+	RegexpMatch
 	Concat
 	Is
 	IsNot
@@ -1557,6 +2651,9 @@ func (op Operator) hasSamePrecedenceAs(rhs Operator) bool {
 	if Less <= op && op <= GreaterOrEqual && Less <= rhs && rhs <= GreaterOrEqual {
 		return true
 	}
+	if Contains <= op && op <= RegexpMatch && Contains <= rhs && rhs <= RegexpMatch {
+		return true
+	}
 	if Is <= op && op <= IsNot && Is <= rhs && rhs <= IsNot {
 		return true
 	}
@@ -1599,6 +2696,18 @@ func (o Operator) String() string {
 		s = ">="
 	case NotEqual:
 		s = "!="
+	case Contains:
+		s = "CONTAINS"
+	case HasKey:
+		s = "HAS KEY"
+	case In:
+		s = "IN"
+	case Between:
+		s = "BETWEEN"
+	case Like:
+		s = "LIKE"
+	case RegexpMatch:
+		s = "=~"
 	case Concat:
 		s = "||"
 	case Is:
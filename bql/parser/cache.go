@@ -0,0 +1,225 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"reflect"
+)
+
+// ASTCacheVersion is the version tag of the binary AST cache format written
+// by EncodeStmts. It has to be incremented whenever a struct in ast.go is
+// changed so that caches written by older versions are rejected.
+const ASTCacheVersion = 1
+
+// ErrStaleASTCache is returned by DecodeStmts when a cache was written by a
+// different version of the format or from a different BQL text. The text
+// should be parsed again in that case.
+var ErrStaleASTCache = errors.New("the AST cache is stale")
+
+// astCacheHeader is written at the beginning of a cache and validated
+// before any statement is decoded.
+type astCacheHeader struct {
+	Version int
+	Digest  [sha256.Size]byte
+}
+
+func init() {
+	// statements
+	gob.Register(SelectStmt{})
+	gob.Register(SelectUnionStmt{})
+	gob.Register(CreateStreamAsSelectStmt{})
+	gob.Register(CreateStreamAsSelectUnionStmt{})
+	gob.Register(CreateSourceStmt{})
+	gob.Register(CreateSinkStmt{})
+	gob.Register(CreateStateStmt{})
+	gob.Register(UpdateStateStmt{})
+	gob.Register(UpdateSourceStmt{})
+	gob.Register(UpdateSinkStmt{})
+	gob.Register(InsertIntoFromStmt{})
+	gob.Register(TeeStmt{})
+	gob.Register(PauseSourceStmt{})
+	gob.Register(ResumeSourceStmt{})
+	gob.Register(RewindSourceStmt{})
+	gob.Register(ReloadSourceStmt{})
+	gob.Register(DropSourceStmt{})
+	gob.Register(DropStreamStmt{})
+	gob.Register(AlterStreamStmt{})
+	gob.Register(DropSinkStmt{})
+	gob.Register(DropStateStmt{})
+	gob.Register(LoadStateStmt{})
+	gob.Register(LoadStateOrCreateStmt{})
+	gob.Register(SaveStateStmt{})
+	gob.Register(LoadPluginStmt{})
+	gob.Register(CreateFunctionStmt{})
+	gob.Register(CreateRemoteFunctionStmt{})
+	gob.Register(EvalStmt{})
+	gob.Register(StatusStmt{})
+	gob.Register(ShowStmt{})
+	gob.Register(DescribeStmt{})
+	gob.Register(ShowUDFsStmt{})
+	gob.Register(DescribeFunctionStmt{})
+	gob.Register(ExplainStmt{})
+
+	// emitter options
+	gob.Register(EmitterLimit{})
+	gob.Register(EmitterEmptyWindow{})
+	gob.Register(EmitterSampling{})
+
+	// expressions
+	gob.Register(AliasAST{})
+	gob.Register(BinaryOpAST{})
+	gob.Register(UnaryOpAST{})
+	gob.Register(TypeCastAST{})
+	gob.Register(FuncAppAST{})
+	gob.Register(NamedArgAST{})
+	gob.Register(SortedExpressionAST{})
+	gob.Register(ArrayAST{})
+	gob.Register(MapAST{})
+	gob.Register(Wildcard{})
+	gob.Register(RowValue{})
+	gob.Register(Placeholder{})
+	gob.Register(ConditionCaseAST{})
+	gob.Register(ExpressionCaseAST{})
+	gob.Register(RowMeta{})
+	gob.Register(NumericLiteral{})
+	gob.Register(FloatLiteral{})
+	gob.Register(IntervalLiteral{})
+	gob.Register(NullLiteral{})
+	gob.Register(Missing{})
+	gob.Register(BoolLiteral{})
+	gob.Register(StringLiteral{})
+
+	// values of WITH and SET parameters
+	gob.Register(data.Bool(false))
+	gob.Register(data.Int(0))
+	gob.Register(data.Float(0))
+	gob.Register(data.String(""))
+	gob.Register(data.Array{})
+	gob.Register(data.Map{})
+}
+
+// GobEncode implements gob.GobEncoder. It's required because gob cannot
+// encode structs without exported fields.
+func (l NullLiteral) GobEncode() ([]byte, error) {
+	return []byte{}, nil
+}
+
+// GobDecode implements gob.GobDecoder.
+func (l *NullLiteral) GobDecode([]byte) error {
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder. It's required because gob cannot
+// encode structs without exported fields.
+func (l Missing) GobEncode() ([]byte, error) {
+	return []byte{}, nil
+}
+
+// GobDecode implements gob.GobDecoder.
+func (l *Missing) GobDecode([]byte) error {
+	return nil
+}
+
+// EncodeStmts writes statements parsed from src to w in a compact binary
+// format so that they can be reloaded by DecodeStmts without parsing src
+// again. The binary is only a cache: the digest of src is stored with the
+// statements and the cache is only accepted for the very same text.
+func EncodeStmts(w io.Writer, src string, stmts []interface{}) error {
+	enc := gob.NewEncoder(w)
+	h := astCacheHeader{
+		Version: ASTCacheVersion,
+		Digest:  sha256.Sum256([]byte(src)),
+	}
+	if err := enc.Encode(&h); err != nil {
+		return fmt.Errorf("cannot write the header of the AST cache: %v", err)
+	}
+	if err := enc.Encode(&stmts); err != nil {
+		return fmt.Errorf("cannot write statements to the AST cache: %v", err)
+	}
+	return nil
+}
+
+// DecodeStmts reads statements written by EncodeStmts from r. It returns
+// ErrStaleASTCache when the cache has a different version tag or wasn't
+// written for src. In that case, src has to be parsed by ParseStmts.
+func DecodeStmts(r io.Reader, src string) ([]interface{}, error) {
+	dec := gob.NewDecoder(r)
+	h := astCacheHeader{}
+	if err := dec.Decode(&h); err != nil {
+		return nil, fmt.Errorf("cannot read the header of the AST cache: %v", err)
+	}
+	if h.Version != ASTCacheVersion || h.Digest != sha256.Sum256([]byte(src)) {
+		return nil, ErrStaleASTCache
+	}
+	var stmts []interface{}
+	if err := dec.Decode(&stmts); err != nil {
+		return nil, fmt.Errorf("cannot read statements from the AST cache: %v", err)
+	}
+	return stmts, nil
+}
+
+// EqualAST returns true when two ASTs are equal. Unlike reflect.DeepEqual, it
+// doesn't distinguish nil slices and maps from empty ones because the
+// difference is lost when a statement is written to the AST cache.
+func EqualAST(a, b interface{}) bool {
+	return equalValue(reflect.ValueOf(a), reflect.ValueOf(b))
+}
+
+func equalValue(a, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return equalValue(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !equalValue(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equalValue(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for _, k := range a.MapKeys() {
+			v := b.MapIndex(k)
+			if !v.IsValid() || !equalValue(a.MapIndex(k), v) {
+				return false
+			}
+		}
+		return true
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	case reflect.String:
+		return a.String() == b.String()
+	default:
+		return reflect.DeepEqual(a.Interface(), b.Interface())
+	}
+}
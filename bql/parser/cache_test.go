@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestASTCache(t *testing.T) {
+	Convey("Given statements parsed from a multi-statement program", t, func() {
+		src := `
+CREATE SOURCE s TYPE dummy WITH num=4, path=env("SOURCE_PATH", "/tmp/x"), opts={"a": [1, 2.5, true]};
+CREATE STATE st TYPE counter;
+CREATE STREAM x AS SELECT ISTREAM a, b:c AS d, count(*), -e::float, now()
+  FROM s [RANGE 2 SECONDS, BUFFER SIZE 10] AS b
+  WHERE a IS NOT NULL AND b:c < 2 GROUP BY a HAVING count(*) > 1;
+CREATE STREAM y AS SELECT RSTREAM [EVERY 2-ND TUPLE LIMIT 5] CASE a WHEN 1 THEN "x" ELSE NULL END, {"k": [1, 2]}
+  FROM x [RANGE 1 TUPLES], udsf("s", 3) [RANGE 1 TUPLES];
+CREATE SINK k TYPE stdout;
+INSERT INTO k FROM y;
+TEE x TO k;
+PAUSE SOURCE s;
+EVAL 1 + 2 ON {"a": 1};
+DROP STREAM y;
+`
+		stmts, err := New().ParseStmts(src)
+		So(err, ShouldBeNil)
+		So(len(stmts), ShouldEqual, 10)
+
+		Convey("When writing them to an AST cache", func() {
+			buf := bytes.NewBuffer(nil)
+			So(EncodeStmts(buf, src, stmts), ShouldBeNil)
+			cache := buf.Bytes()
+
+			Convey("Then the statements should be restored from the cache", func() {
+				loaded, err := DecodeStmts(bytes.NewReader(cache), src)
+				So(err, ShouldBeNil)
+				So(len(loaded), ShouldEqual, len(stmts))
+				for i := range stmts {
+					So(loaded[i], ShouldHaveSameTypeAs, stmts[i])
+					So(EqualAST(loaded[i], stmts[i]), ShouldBeTrue)
+				}
+				So(EqualAST(loaded, stmts), ShouldBeTrue)
+			})
+
+			Convey("Then the cache should be rejected for a different text", func() {
+				_, err := DecodeStmts(bytes.NewReader(cache), src+"DROP STREAM x;")
+				So(err, ShouldEqual, ErrStaleASTCache)
+			})
+
+			Convey("Then a truncated cache should be rejected", func() {
+				_, err := DecodeStmts(bytes.NewReader(cache[:len(cache)/2]), src)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a cache has a different version tag", func() {
+			buf := bytes.NewBuffer(nil)
+			enc := gob.NewEncoder(buf)
+			So(enc.Encode(&astCacheHeader{
+				Version: ASTCacheVersion + 1,
+				Digest:  sha256.Sum256([]byte(src)),
+			}), ShouldBeNil)
+			So(enc.Encode(&stmts), ShouldBeNil)
+
+			Convey("Then the cache should be rejected", func() {
+				_, err := DecodeStmts(buf, src)
+				So(err, ShouldEqual, ErrStaleASTCache)
+			})
+		})
+	})
+
+	Convey("Given two ASTs", t, func() {
+		Convey("When they only differ in nil and empty slices", func() {
+			a := ArrayAST{ExpressionsAST{nil}}
+			b := ArrayAST{ExpressionsAST{[]Expression{}}}
+
+			Convey("Then they should be equal", func() {
+				So(EqualAST(a, b), ShouldBeTrue)
+			})
+		})
+
+		Convey("When they have different values", func() {
+			a := BinaryOpAST{Plus, NumericLiteral{1}, NumericLiteral{2}}
+			b := BinaryOpAST{Plus, NumericLiteral{1}, FloatLiteral{2}}
+
+			Convey("Then they shouldn't be equal", func() {
+				So(EqualAST(a, b), ShouldBeFalse)
+				So(EqualAST(a, a), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
+	"time"
 )
 
 func TestExpressionParser(t *testing.T) {
@@ -20,27 +21,41 @@ func TestExpressionParser(t *testing.T) {
 		"NULL": {[]Expression{NullLiteral{}}, "NULL"},
 		// Function Application
 		"f()": {[]Expression{FuncAppAST{FuncName("f"),
-			ExpressionsAST{[]Expression{}}, nil}}, "f()"},
+			ExpressionsAST{[]Expression{}}, nil, false, nil}}, "f()"},
 		"now()": {[]Expression{FuncAppAST{FuncName("now"),
-			ExpressionsAST{[]Expression{}}, nil}}, "now()"},
+			ExpressionsAST{[]Expression{}}, nil, false, nil}}, "now()"},
 		"f(a)": {[]Expression{FuncAppAST{FuncName("f"),
-			ExpressionsAST{[]Expression{RowValue{"", "a"}}}, nil}}, "f(a)"},
+			ExpressionsAST{[]Expression{RowValue{"", "a"}}}, nil, false, nil}}, "f(a)"},
 		"f(*)": {[]Expression{FuncAppAST{FuncName("f"),
-			ExpressionsAST{[]Expression{Wildcard{}}}, nil}}, "f(*)"},
+			ExpressionsAST{[]Expression{Wildcard{}}}, nil, false, nil}}, "f(*)"},
 		"f(x:*)": {[]Expression{FuncAppAST{FuncName("f"),
-			ExpressionsAST{[]Expression{Wildcard{"x"}}}, nil}}, "f(x:*)"},
+			ExpressionsAST{[]Expression{Wildcard{"x"}}}, nil, false, nil}}, "f(x:*)"},
 		"f(x:* ORDER BY a)": {[]Expression{FuncAppAST{FuncName("f"),
 			ExpressionsAST{[]Expression{Wildcard{"x"}}},
-			[]SortedExpressionAST{{RowValue{"", "a"}, UnspecifiedKeyword}}}}, "f(x:* ORDER BY a)"},
+			[]SortedExpressionAST{{RowValue{"", "a"}, UnspecifiedKeyword}}, false, nil}}, "f(x:* ORDER BY a)"},
 		"f(a ORDER BY a DESC, b, c ASC)": {[]Expression{FuncAppAST{FuncName("f"),
 			ExpressionsAST{[]Expression{RowValue{"", "a"}}},
-			[]SortedExpressionAST{{RowValue{"", "a"}, No}, {RowValue{"", "b"}, UnspecifiedKeyword}, {RowValue{"", "c"}, Yes}}}}, "f(a ORDER BY a DESC, b, c ASC)"},
+			[]SortedExpressionAST{{RowValue{"", "a"}, No}, {RowValue{"", "b"}, UnspecifiedKeyword}, {RowValue{"", "c"}, Yes}}, false, nil}}, "f(a ORDER BY a DESC, b, c ASC)"},
 		"count(a ORDER BY count(b))": {[]Expression{FuncAppAST{FuncName("count"),
 			ExpressionsAST{[]Expression{RowValue{"", "a"}}},
 			[]SortedExpressionAST{{FuncAppAST{FuncName("count"),
-				ExpressionsAST{[]Expression{RowValue{"", "b"}}}, nil}, UnspecifiedKeyword}}}}, "count(a ORDER BY count(b))"},
+				ExpressionsAST{[]Expression{RowValue{"", "b"}}}, nil, false, nil}, UnspecifiedKeyword}}, false, nil}}, "count(a ORDER BY count(b))"},
+		"count(DISTINCT a)": {[]Expression{FuncAppAST{FuncName("count"),
+			ExpressionsAST{[]Expression{RowValue{"", "a"}}}, nil, true, nil}}, "count(DISTINCT a)"},
+		"array_agg(distinct a ORDER BY b)": {[]Expression{FuncAppAST{FuncName("array_agg"),
+			ExpressionsAST{[]Expression{RowValue{"", "a"}}},
+			[]SortedExpressionAST{{RowValue{"", "b"}, UnspecifiedKeyword}}, true, nil}}, "array_agg(DISTINCT a ORDER BY b)"},
+		"count(*) FILTER (WHERE a > 1)": {[]Expression{FuncAppAST{FuncName("count"),
+			ExpressionsAST{[]Expression{Wildcard{}}}, nil, false,
+			BinaryOpAST{Greater, RowValue{"", "a"}, NumericLiteral{1}}}}, "count(*) FILTER (WHERE a > 1)"},
+		"array_agg(a ORDER BY b) filter(where c)": {[]Expression{FuncAppAST{FuncName("array_agg"),
+			ExpressionsAST{[]Expression{RowValue{"", "a"}}},
+			[]SortedExpressionAST{{RowValue{"", "b"}, UnspecifiedKeyword}}, false,
+			RowValue{"", "c"}}}, "array_agg(a ORDER BY b) FILTER (WHERE c)"},
+		"f(distinct_a)": {[]Expression{FuncAppAST{FuncName("f"),
+			ExpressionsAST{[]Expression{RowValue{"", "distinct_a"}}}, nil, false, nil}}, "f(distinct_a)"},
 		`f(2.1, "a")`: {[]Expression{FuncAppAST{FuncName("f"),
-			ExpressionsAST{[]Expression{FloatLiteral{2.1}, StringLiteral{"a"}}}, nil}}, `f(2.1, "a")`},
+			ExpressionsAST{[]Expression{FloatLiteral{2.1}, StringLiteral{"a"}}}, nil, false, nil}}, `f(2.1, "a")`},
 		// Type Cast
 		"CAST(2.1 AS BOOL)":    {[]Expression{TypeCastAST{FloatLiteral{2.1}, Bool}}, "CAST(2.1 AS BOOL)"},
 		"CAST(2.1 AS INT)":     {[]Expression{TypeCastAST{FloatLiteral{2.1}, Int}}, "CAST(2.1 AS INT)"},
@@ -56,14 +71,16 @@ func TestExpressionParser(t *testing.T) {
 		"ts()::STRING":         {[]Expression{TypeCastAST{RowMeta{"", TimestampMeta}, String}}, "ts()::STRING"},
 		"tab:ts()::STRING":     {[]Expression{TypeCastAST{RowMeta{"tab", TimestampMeta}, String}}, "tab:ts()::STRING"},
 		// RowValue
-		"a":         {[]Expression{RowValue{"", "a"}}, "a"},
-		"-a":        {[]Expression{UnaryOpAST{UnaryMinus, RowValue{"", "a"}}}, "-a"},
-		"tab:a":     {[]Expression{RowValue{"tab", "a"}}, "tab:a"},
-		"ts()":      {[]Expression{RowMeta{"", TimestampMeta}}, "ts()"},
-		"tab:ts()":  {[]Expression{RowMeta{"tab", TimestampMeta}}, "tab:ts()"},
-		"a, b":      {[]Expression{RowValue{"", "a"}, RowValue{"", "b"}}, "a, b"},
-		"A":         {[]Expression{RowValue{"", "A"}}, "A"},
-		"my_mem_27": {[]Expression{RowValue{"", "my_mem_27"}}, "my_mem_27"},
+		"a":                    {[]Expression{RowValue{"", "a"}}, "a"},
+		"-a":                   {[]Expression{UnaryOpAST{UnaryMinus, RowValue{"", "a"}}}, "-a"},
+		"tab:a":                {[]Expression{RowValue{"tab", "a"}}, "tab:a"},
+		"ts()":                 {[]Expression{RowMeta{"", TimestampMeta}}, "ts()"},
+		"tab:ts()":             {[]Expression{RowMeta{"tab", TimestampMeta}}, "tab:ts()"},
+		"correlation_id()":     {[]Expression{RowMeta{"", CorrelationIDMeta}}, "correlation_id()"},
+		"tab:correlation_id()": {[]Expression{RowMeta{"tab", CorrelationIDMeta}}, "tab:correlation_id()"},
+		"a, b":                 {[]Expression{RowValue{"", "a"}, RowValue{"", "b"}}, "a, b"},
+		"A":                    {[]Expression{RowValue{"", "A"}}, "A"},
+		"my_mem_27":            {[]Expression{RowValue{"", "my_mem_27"}}, "my_mem_27"},
 		/// JSON Path
 		`["hoge"]`:       {[]Expression{RowValue{"", `["hoge"]`}}, `["hoge"]`},
 		`["hoge"][0]..y`: {[]Expression{RowValue{"", `["hoge"][0]..y`}}, `["hoge"][0]..y`},
@@ -96,19 +113,29 @@ func TestExpressionParser(t *testing.T) {
 		`[["hoge"], hoge.x[0], a]`: {[]Expression{ArrayAST{ExpressionsAST{[]Expression{RowValue{"", `["hoge"]`},
 			RowValue{"", "hoge.x[0]"}, RowValue{"", "a"}}}}}, `[["hoge"], hoge.x[0], a]`},
 		`[{"key":hoge:image}]`: {[]Expression{ArrayAST{ExpressionsAST{[]Expression{
-			MapAST{[]KeyValuePairAST{{"key", RowValue{"hoge", "image"}}}}}}}}, `[{"key":hoge:image}]`},
+			MapAST{[]KeyValuePairAST{{"key", RowValue{"hoge", "image"}, nil}}}}}}}, `[{"key":hoge:image}]`},
 		// Map
 		"{}":                 {[]Expression{MapAST{[]KeyValuePairAST{}}}, "{}"},
-		`{"hoge":2}`:         {[]Expression{MapAST{[]KeyValuePairAST{{"hoge", NumericLiteral{2}}}}}, `{"hoge":2}`},
-		`{"key":hoge:image}`: {[]Expression{MapAST{[]KeyValuePairAST{{"key", RowValue{"hoge", "image"}}}}}, `{"key":hoge:image}`},
+		`{"hoge":2}`:         {[]Expression{MapAST{[]KeyValuePairAST{{"hoge", NumericLiteral{2}, nil}}}}, `{"hoge":2}`},
+		`{"key":hoge:image}`: {[]Expression{MapAST{[]KeyValuePairAST{{"key", RowValue{"hoge", "image"}, nil}}}}, `{"key":hoge:image}`},
 		`{"foo":x:a, "bar":{"a":[2]}}`: {[]Expression{MapAST{[]KeyValuePairAST{
-			{"foo", RowValue{"x", "a"}},
+			{"foo", RowValue{"x", "a"}, nil},
 			{"bar", MapAST{[]KeyValuePairAST{
-				{"a", ArrayAST{ExpressionsAST{[]Expression{NumericLiteral{2}}}}},
-			}}},
+				{"a", ArrayAST{ExpressionsAST{[]Expression{NumericLiteral{2}}}}, nil},
+			}}, nil},
 		}}}, `{"foo":x:a, "bar":{"a":[2]}}`},
 		`{"a": a:*, "b": b:*}`: {[]Expression{MapAST{[]KeyValuePairAST{
-			{"a", Wildcard{"a"}}, {"b", Wildcard{"b"}}}}}, `{"a":a:*, "b":b:*}`},
+			{"a", Wildcard{"a"}, nil}, {"b", Wildcard{"b"}, nil}}}}, `{"a":a:*, "b":b:*}`},
+		`{(a):2}`: {[]Expression{MapAST{[]KeyValuePairAST{
+			{"", NumericLiteral{2}, RowValue{"", "a"}}}}}, `{(a):2}`},
+		`{( "k" || x:a ) : b, "c":1}`: {[]Expression{MapAST{[]KeyValuePairAST{
+			{"", RowValue{"", "b"}, BinaryOpAST{Concat, StringLiteral{"k"}, RowValue{"x", "a"}}},
+			{"c", NumericLiteral{1}, nil}}}}, `{("k" || x:a):b, "c":1}`},
+		`{("k"):b}`: {[]Expression{MapAST{[]KeyValuePairAST{{"k", RowValue{"", "b"}, nil}}}}, `{"k":b}`},
+		`{():b}`:    {nil, ""}, // a computed key must have an expression
+		`{(*):b}`:   {nil, ""}, // a computed key cannot be a wildcard
+		`{(a:*):b}`: {nil, ""},
+		`{a:b}`:     {nil, ""}, // a key must be a string or parenthesized
 		// CASE
 		"CASE a END":                         {nil, ""}, // WHEN-THEN is mandatory
 		"CASE a WHEN 2 THEN 3 END":           {[]Expression{ExpressionCaseAST{RowValue{"", "a"}, ConditionCaseAST{[]WhenThenPairAST{{NumericLiteral{2}, NumericLiteral{3}}}, nil}}}, "CASE a WHEN 2 THEN 3 END"},
@@ -130,6 +157,25 @@ func TestExpressionParser(t *testing.T) {
 		`"Peter""s"`: {[]Expression{StringLiteral{`Peter"s`}}, `"Peter""s"`},
 		`"Peter's"`:  {[]Expression{StringLiteral{`Peter's`}}, `"Peter's"`},
 		`"日本語"`:      {[]Expression{StringLiteral{"日本語"}}, `"日本語"`},
+		// IntervalLiteral
+		"INTERVAL 90 MINUTES":                {[]Expression{IntervalLiteral{90 * time.Minute}}, "INTERVAL 1 HOUR 30 MINUTES"},
+		"interval 1 day":                     {[]Expression{IntervalLiteral{24 * time.Hour}}, "INTERVAL 1 DAY"},
+		"INTERVAL 1 DAY 2 HOURS 3.5 SECONDS": {[]Expression{IntervalLiteral{26*time.Hour + 3500*time.Millisecond}}, "INTERVAL 1 DAY 2 HOURS 3.5 SECONDS"},
+		"INTERVAL 1.5 MINUTES":               {[]Expression{IntervalLiteral{90 * time.Second}}, "INTERVAL 1 MINUTE 30 SECONDS"},
+		"INTERVAL 250 MILLISECONDS":          {[]Expression{IntervalLiteral{250 * time.Millisecond}}, "INTERVAL 0.25 SECONDS"},
+		"INTERVAL -1 HOUR":                   {[]Expression{IntervalLiteral{-time.Hour}}, "INTERVAL -1 HOUR"},
+		"INTERVAL 0 SECONDS":                 {[]Expression{IntervalLiteral{0}}, "INTERVAL 0 SECONDS"},
+		`INTERVAL "1 02:03:04.5" DAY TO SECOND`: {[]Expression{IntervalLiteral{26*time.Hour + 3*time.Minute + 4500*time.Millisecond}},
+			"INTERVAL 1 DAY 2 HOURS 3 MINUTES 4.5 SECONDS"},
+		`INTERVAL "02:30" HOUR TO MINUTE`:  {[]Expression{IntervalLiteral{150 * time.Minute}}, "INTERVAL 2 HOURS 30 MINUTES"},
+		`INTERVAL "-5" DAY`:                {[]Expression{IntervalLiteral{-120 * time.Hour}}, "INTERVAL -5 DAYS"},
+		`INTERVAL "1 25:00" DAY TO MINUTE`: {nil, ""}, // hour out of range
+		`INTERVAL "1:2" DAY TO HOUR`:       {nil, ""},
+		`INTERVAL "1" SECOND TO MINUTE`:    {nil, ""},
+		"INTERVAL 999999999 DAYS":          {nil, ""}, // int64 overflow
+		"INTERVAL 1 HOUR + a": {[]Expression{BinaryOpAST{Plus, IntervalLiteral{time.Hour}, RowValue{"", "a"}}},
+			"INTERVAL 1 HOUR + a"},
+		"interval + 1": {[]Expression{BinaryOpAST{Plus, RowValue{"", "interval"}, NumericLiteral{1}}}, "interval + 1"},
 		// Alias
 		"1.2 AS x": {[]Expression{AliasAST{FloatLiteral{1.2}, "x"}}, "1.2 AS x"},
 		"b AS *":   {[]Expression{AliasAST{RowValue{"", "b"}, "*"}}, "b AS *"},
@@ -141,13 +187,52 @@ func TestExpressionParser(t *testing.T) {
 		// NOT
 		"NOT a": {[]Expression{UnaryOpAST{Not, RowValue{"", "a"}}}, "NOT a"},
 		// Comparisons
-		"a = 2":  {[]Expression{BinaryOpAST{Equal, RowValue{"", "a"}, NumericLiteral{2}}}, "a = 2"},
-		"a < 2":  {[]Expression{BinaryOpAST{Less, RowValue{"", "a"}, NumericLiteral{2}}}, "a < 2"},
-		"a <= 2": {[]Expression{BinaryOpAST{LessOrEqual, RowValue{"", "a"}, NumericLiteral{2}}}, "a <= 2"},
-		"a > 2":  {[]Expression{BinaryOpAST{Greater, RowValue{"", "a"}, NumericLiteral{2}}}, "a > 2"},
-		"a >= 2": {[]Expression{BinaryOpAST{GreaterOrEqual, RowValue{"", "a"}, NumericLiteral{2}}}, "a >= 2"},
-		"a != 2": {[]Expression{BinaryOpAST{NotEqual, RowValue{"", "a"}, NumericLiteral{2}}}, "a != 2"},
-		"a <> 2": {[]Expression{BinaryOpAST{NotEqual, RowValue{"", "a"}, NumericLiteral{2}}}, "a != 2"},
+		"a = 2":             {[]Expression{BinaryOpAST{Equal, RowValue{"", "a"}, NumericLiteral{2}}}, "a = 2"},
+		"a < 2":             {[]Expression{BinaryOpAST{Less, RowValue{"", "a"}, NumericLiteral{2}}}, "a < 2"},
+		"a <= 2":            {[]Expression{BinaryOpAST{LessOrEqual, RowValue{"", "a"}, NumericLiteral{2}}}, "a <= 2"},
+		"a > 2":             {[]Expression{BinaryOpAST{Greater, RowValue{"", "a"}, NumericLiteral{2}}}, "a > 2"},
+		"a >= 2":            {[]Expression{BinaryOpAST{GreaterOrEqual, RowValue{"", "a"}, NumericLiteral{2}}}, "a >= 2"},
+		"a != 2":            {[]Expression{BinaryOpAST{NotEqual, RowValue{"", "a"}, NumericLiteral{2}}}, "a != 2"},
+		"a <> 2":            {[]Expression{BinaryOpAST{NotEqual, RowValue{"", "a"}, NumericLiteral{2}}}, "a != 2"},
+		"a CONTAINS 2":      {[]Expression{BinaryOpAST{Contains, RowValue{"", "a"}, NumericLiteral{2}}}, "a CONTAINS 2"},
+		"a contains [1]":    {[]Expression{BinaryOpAST{Contains, RowValue{"", "a"}, ArrayAST{ExpressionsAST{[]Expression{NumericLiteral{1}}}}}}, "a CONTAINS [1]"},
+		`a HAS KEY "k"`:     {[]Expression{BinaryOpAST{HasKey, RowValue{"", "a"}, StringLiteral{"k"}}}, `a HAS KEY "k"`},
+		`a has  key "k"`:    {[]Expression{BinaryOpAST{HasKey, RowValue{"", "a"}, StringLiteral{"k"}}}, `a HAS KEY "k"`},
+		`{"k":1} HAS KEY b`: {[]Expression{BinaryOpAST{HasKey, MapAST{[]KeyValuePairAST{{"k", NumericLiteral{1}, nil}}}, RowValue{"", "b"}}}, `{"k":1} HAS KEY b`},
+		"a CONTAINS 2 = b":  {nil, ""}, // comparisons cannot be chained
+		`a HASKEY "k"`:      {nil, ""},
+		// IN and BETWEEN
+		"a IN (1, 2)":             {[]Expression{BinaryOpAST{In, RowValue{"", "a"}, ArrayAST{ExpressionsAST{[]Expression{NumericLiteral{1}, NumericLiteral{2}}}}}}, "a IN (1, 2)"},
+		"a in(b)":                 {[]Expression{BinaryOpAST{In, RowValue{"", "a"}, ArrayAST{ExpressionsAST{[]Expression{RowValue{"", "b"}}}}}}, "a IN (b)"},
+		"a IN [1, 2]":             {[]Expression{BinaryOpAST{In, RowValue{"", "a"}, ArrayAST{ExpressionsAST{[]Expression{NumericLiteral{1}, NumericLiteral{2}}}}}}, "a IN (1, 2)"},
+		"a IN b":                  {[]Expression{BinaryOpAST{In, RowValue{"", "a"}, RowValue{"", "b"}}}, "a IN b"},
+		"a BETWEEN 1 AND 2":       {[]Expression{BinaryOpAST{Between, RowValue{"", "a"}, ArrayAST{ExpressionsAST{[]Expression{NumericLiteral{1}, NumericLiteral{2}}}}}}, "a BETWEEN 1 AND 2"},
+		"a between b+1 and c":     {[]Expression{BinaryOpAST{Between, RowValue{"", "a"}, ArrayAST{ExpressionsAST{[]Expression{BinaryOpAST{Plus, RowValue{"", "b"}, NumericLiteral{1}}, RowValue{"", "c"}}}}}}, "a BETWEEN b + 1 AND c"},
+		"a BETWEEN 1 AND 2 AND b": {[]Expression{BinaryOpAST{And, BinaryOpAST{Between, RowValue{"", "a"}, ArrayAST{ExpressionsAST{[]Expression{NumericLiteral{1}, NumericLiteral{2}}}}}, RowValue{"", "b"}}}, "a BETWEEN 1 AND 2 AND b"},
+		"a IN ()":                 {nil, ""},
+		"a BETWEEN 1":             {nil, ""},
+		// Pattern matching
+		`a LIKE "h%"`:  {[]Expression{BinaryOpAST{Like, RowValue{"", "a"}, StringLiteral{"h%"}}}, `a LIKE "h%"`},
+		`a like  b`:    {[]Expression{BinaryOpAST{Like, RowValue{"", "a"}, RowValue{"", "b"}}}, `a LIKE b`},
+		`a =~ "^h"`:    {[]Expression{BinaryOpAST{RegexpMatch, RowValue{"", "a"}, StringLiteral{"^h"}}}, `a =~ "^h"`},
+		`a=~b`:         {[]Expression{BinaryOpAST{RegexpMatch, RowValue{"", "a"}, RowValue{"", "b"}}}, `a =~ b`},
+		`a LIKE b = c`: {nil, ""},
+		`a LIKE"h%"`:   {nil, ""},
+		`a LIKE "a\_b" ESCAPE "\"`: {[]Expression{BinaryOpAST{Like, RowValue{"", "a"},
+			LikePatternAST{StringLiteral{`a\_b`}, StringLiteral{`\`}}}}, `a LIKE "a\_b" ESCAPE "\"`},
+		`a like b || "|%" escape "|"`: {[]Expression{BinaryOpAST{Like, RowValue{"", "a"},
+			LikePatternAST{BinaryOpAST{Concat, RowValue{"", "b"}, StringLiteral{"|%"}}, StringLiteral{"|"}}}}, `a LIKE b || "|%" ESCAPE "|"`},
+		`a LIKE """%" ESCAPE """"`: {[]Expression{BinaryOpAST{Like, RowValue{"", "a"},
+			LikePatternAST{StringLiteral{`"%`}, StringLiteral{`"`}}}}, `a LIKE """%" ESCAPE """"`},
+		`a LIKE "x" ESCAPE "ab"`: {nil, ""},
+		`a LIKE "x" ESCAPE ""`:   {nil, ""},
+		`a LIKE "x" ESCAPE b`:    {nil, ""},
+		`a =~ "x" ESCAPE "|"`:    {nil, ""},
+		// Placeholders
+		"$a":       {[]Expression{Placeholder{"a"}}, "$a"},
+		"$a_1 + 2": {[]Expression{BinaryOpAST{Plus, Placeholder{"a_1"}, NumericLiteral{2}}}, "$a_1 + 2"},
+		"$":        {nil, ""},
+		"$1":       {nil, ""},
 		// Other operators
 		"a || 2": {[]Expression{BinaryOpAST{Concat, RowValue{"", "a"}, NumericLiteral{2}}}, "a || 2"},
 		// IS Expressions
@@ -199,6 +284,18 @@ func TestExpressionParser(t *testing.T) {
 		"2 || a = 4": {[]Expression{BinaryOpAST{Equal,
 			BinaryOpAST{Concat, NumericLiteral{2}, RowValue{"", "a"}},
 			NumericLiteral{4}}}, "2 || a = 4"},
+		"a || b CONTAINS c || d": {[]Expression{BinaryOpAST{Contains,
+			BinaryOpAST{Concat, RowValue{"", "a"}, RowValue{"", "b"}},
+			BinaryOpAST{Concat, RowValue{"", "c"}, RowValue{"", "d"}}}}, "a || b CONTAINS c || d"},
+		"a CONTAINS b + 1 AND NOT c CONTAINS 2": {[]Expression{BinaryOpAST{And,
+			BinaryOpAST{Contains, RowValue{"", "a"}, BinaryOpAST{Plus, RowValue{"", "b"}, NumericLiteral{1}}},
+			UnaryOpAST{Not, BinaryOpAST{Contains, RowValue{"", "c"}, NumericLiteral{2}}}}}, "a CONTAINS b + 1 AND NOT (c CONTAINS 2)"},
+		`a HAS KEY "k" OR b HAS KEY c IS NULL`: {[]Expression{BinaryOpAST{Or,
+			BinaryOpAST{HasKey, RowValue{"", "a"}, StringLiteral{"k"}},
+			BinaryOpAST{HasKey, RowValue{"", "b"}, BinaryOpAST{Is, RowValue{"", "c"}, NullLiteral{}}}}}, `a HAS KEY "k" OR b HAS KEY c IS NULL`},
+		"(a = b) CONTAINS c": {[]Expression{BinaryOpAST{Contains,
+			BinaryOpAST{Equal, RowValue{"", "a"}, RowValue{"", "b"}},
+			RowValue{"", "c"}}}, "(a = b) CONTAINS c"},
 		"-2.1::INT": {[]Expression{UnaryOpAST{UnaryMinus,
 			TypeCastAST{FloatLiteral{2.1}, Int}}}, "-CAST(2.1 AS INT)"},
 		/// Left-Associativity
@@ -277,7 +374,7 @@ func TestExpressionParser(t *testing.T) {
 		"a, 3.1, false,-2": {[]Expression{RowValue{"", "a"}, FloatLiteral{3.1}, BoolLiteral{false}, UnaryOpAST{UnaryMinus, NumericLiteral{2}}}, "a, 3.1, FALSE, -2"},
 		`"日本語", 13`:        {[]Expression{StringLiteral{"日本語"}, NumericLiteral{13}}, `"日本語", 13`},
 		`concat(a, "Pi", 3.1), b`: {[]Expression{FuncAppAST{FuncName("concat"), ExpressionsAST{
-			[]Expression{RowValue{"", "a"}, StringLiteral{"Pi"}, FloatLiteral{3.1}}}, nil},
+			[]Expression{RowValue{"", "a"}, StringLiteral{"Pi"}, FloatLiteral{3.1}}}, nil, false, nil},
 			RowValue{"", "b"}}, `concat(a, "Pi", 3.1), b`},
 	}
 
@@ -319,3 +416,30 @@ func TestExpressionParser(t *testing.T) {
 	})
 
 }
+
+func TestLikeEscapeRoundTrip(t *testing.T) {
+	Convey("Given a BQL parser", t, func() {
+		p := New()
+
+		for _, input := range []string{
+			`a LIKE "a\_b" ESCAPE "\"`,
+			`a LIKE "a|_b" ESCAPE "|"`,
+			`a LIKE "a""%" ESCAPE """"`,
+			`NOT a LIKE (b || "%") ESCAPE "|" AND c`,
+		} {
+			input := input
+
+			Convey(fmt.Sprintf("When parsing %s and its string representation", input), func() {
+				result, _, err := p.ParseStmt("SELECT ISTREAM " + input)
+				So(err, ShouldBeNil)
+				projs := result.(SelectStmt).ProjectionsAST
+				reparsed, _, err := p.ParseStmt("SELECT ISTREAM " + projs.string())
+				So(err, ShouldBeNil)
+
+				Convey("Then both ASTs should be the same", func() {
+					So(reparsed.(SelectStmt).ProjectionsAST, ShouldResemble, projs)
+				})
+			})
+		}
+	})
+}
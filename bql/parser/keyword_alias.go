@@ -0,0 +1,220 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// keywordAlias is an alternative spelling of a sequence of keywords.
+type keywordAlias struct {
+	// words are the upper-cased words of the alias.
+	words []string
+
+	// canonical is the BQL text replacing the alias.
+	canonical string
+}
+
+// AddKeywordAlias registers an alias of a sequence of keywords so that
+// statements written in other streaming SQL dialects can be parsed. alias is
+// a sequence of words separated by whitespace, e.g. "SELECT STREAM", and
+// canonical is the BQL text replacing it, e.g. "SELECT ISTREAM". Before a
+// statement is parsed, every occurrence of alias outside string literals and
+// comments is replaced with canonical. Words are matched case-insensitively
+// and may be separated by any whitespace. When aliases overlap, the one
+// having the most words is used.
+//
+// The parser doesn't have any alias by default. Replaced text isn't looked
+// up again, so an alias can't expand to another alias. Note that positions
+// in error messages refer to the statement after the replacement.
+func (p *bqlParser) AddKeywordAlias(alias, canonical string) error {
+	words := strings.Fields(alias)
+	if len(words) == 0 {
+		return fmt.Errorf("a keyword alias must not be empty")
+	}
+	for i, w := range words {
+		for _, r := range w {
+			if !isAliasWordRune(r) {
+				return fmt.Errorf("a keyword alias can only contain words: %v", alias)
+			}
+		}
+		words[i] = strings.ToUpper(w)
+	}
+	if strings.TrimSpace(canonical) == "" {
+		return fmt.Errorf("the canonical form of the keyword alias '%v' must not be empty", alias)
+	}
+
+	key := strings.Join(words, " ")
+	for _, a := range p.aliases {
+		if strings.Join(a.words, " ") == key {
+			return fmt.Errorf("the keyword alias '%v' is already registered", alias)
+		}
+	}
+
+	// longer aliases take precedence over shorter ones, so aliases are
+	// kept sorted by the number of words in descending order
+	i := 0
+	for i < len(p.aliases) && len(p.aliases[i].words) >= len(words) {
+		i++
+	}
+	p.aliases = append(p.aliases, keywordAlias{})
+	copy(p.aliases[i+1:], p.aliases[i:])
+	p.aliases[i] = keywordAlias{
+		words:     words,
+		canonical: canonical,
+	}
+	return nil
+}
+
+// isAliasWordRune returns true when r can be a part of a word. ':' and '.'
+// are included so that a part of a path like a:stream or a.stream isn't
+// regarded as a keyword.
+func isAliasWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == ':' || r == '.'
+}
+
+// aliasReplacement is a range of the original statement replaced with the
+// canonical form of an alias. Offsets are in runes.
+type aliasReplacement struct {
+	begin, end         int // the range in the original statement
+	normBegin, normEnd int // the range in the normalized statement
+}
+
+// normalizedStmt is a statement whose keyword aliases are replaced.
+type normalizedStmt struct {
+	text         string
+	replacements []aliasReplacement
+}
+
+// originalOffset converts an offset in the normalized statement to the one
+// in the original statement.
+func (n *normalizedStmt) originalOffset(pos int) int {
+	delta := 0
+	for _, r := range n.replacements {
+		if pos <= r.normBegin {
+			break
+		}
+		if pos < r.normEnd {
+			// an offset in the middle of a replaced text
+			return r.end
+		}
+		delta = r.end - r.normEnd
+	}
+	return pos + delta
+}
+
+// normalize replaces keyword aliases in s with their canonical forms.
+func (p *bqlParser) normalize(s string) *normalizedStmt {
+	if len(p.aliases) == 0 {
+		return &normalizedStmt{text: s}
+	}
+
+	rs := []rune(s)
+	tokens := aliasTokens(rs)
+	n := &normalizedStmt{}
+	buf := make([]rune, 0, len(rs))
+	for i := 0; i < len(tokens); {
+		t := tokens[i]
+		if t.word {
+			if a, j, ok := p.matchAlias(rs, tokens, i); ok {
+				end := tokens[j-1].end
+				canonical := []rune(a.canonical)
+				n.replacements = append(n.replacements, aliasReplacement{
+					begin:     t.begin,
+					end:       end,
+					normBegin: len(buf),
+					normEnd:   len(buf) + len(canonical),
+				})
+				buf = append(buf, canonical...)
+				i = j
+				continue
+			}
+		}
+		buf = append(buf, rs[t.begin:t.end]...)
+		i++
+	}
+	n.text = string(buf)
+	return n
+}
+
+// matchAlias finds the alias starting at tokens[i]. It returns the alias and
+// the index of the token following it.
+func (p *bqlParser) matchAlias(rs []rune, tokens []aliasToken, i int) (*keywordAlias, int, bool) {
+	for k := range p.aliases {
+		a := &p.aliases[k]
+		j := i
+		matched := true
+		for n, w := range a.words {
+			if n > 0 {
+				// words must be separated by whitespace
+				if j >= len(tokens) || !tokens[j].space {
+					matched = false
+					break
+				}
+				j++
+			}
+			if j >= len(tokens) || !tokens[j].word ||
+				strings.ToUpper(string(rs[tokens[j].begin:tokens[j].end])) != w {
+				matched = false
+				break
+			}
+			j++
+		}
+		if matched {
+			return a, j, true
+		}
+	}
+	return nil, 0, false
+}
+
+// aliasToken is a lexical unit of a statement used to look up aliases.
+// Offsets are in runes.
+type aliasToken struct {
+	begin, end int
+	word       bool
+	space      bool
+}
+
+// aliasTokens splits a statement into words, whitespace, and other tokens.
+// String literals and comments are returned as single tokens so that their
+// content is never replaced.
+func aliasTokens(rs []rune) []aliasToken {
+	var tokens []aliasToken
+	for i := 0; i < len(rs); {
+		j := i + 1
+		t := aliasToken{begin: i}
+		switch c := rs[i]; {
+		case unicode.IsSpace(c):
+			for j < len(rs) && unicode.IsSpace(rs[j]) {
+				j++
+			}
+			t.space = true
+
+		case c == '-' && j < len(rs) && rs[j] == '-':
+			// a comment lasts until the end of the line
+			for j < len(rs) && rs[j] != '\n' && rs[j] != '\r' {
+				j++
+			}
+
+		case c == '"' || c == '\'':
+			// a quote in a string literal is escaped by doubling it,
+			// which is handled as two consecutive tokens here
+			for j < len(rs) && rs[j] != c {
+				j++
+			}
+			if j < len(rs) {
+				j++ // the closing quote
+			}
+
+		case isAliasWordRune(c):
+			for j < len(rs) && isAliasWordRune(rs[j]) {
+				j++
+			}
+			t.word = true
+		}
+		t.end = j
+		tokens = append(tokens, t)
+		i = j
+	}
+	return tokens
+}
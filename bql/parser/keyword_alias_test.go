@@ -0,0 +1,89 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestKeywordAlias(t *testing.T) {
+	Convey("Given a parser having keyword aliases", t, func() {
+		p := New()
+		So(p.AddKeywordAlias("SELECT STREAM", "SELECT ISTREAM"), ShouldBeNil)
+		So(p.AddKeywordAlias("ROWS", "TUPLES"), ShouldBeNil)
+		So(p.AddKeywordAlias("select stream relation", "SELECT RSTREAM"), ShouldBeNil)
+
+		canonical := New()
+		parseSame := func(aliased, expected string) {
+			actual, _, err := p.ParseStmt(aliased)
+			So(err, ShouldBeNil)
+			stmt, _, err := canonical.ParseStmt(expected)
+			So(err, ShouldBeNil)
+			So(EqualAST(actual, stmt), ShouldBeTrue)
+		}
+
+		Convey("When parsing a statement using aliases", func() {
+			Convey("Then it should be parsed as the canonical statement", func() {
+				parseSame("SELECT STREAM a FROM s [RANGE 2 ROWS] WHERE a > 1",
+					"SELECT ISTREAM a FROM s [RANGE 2 TUPLES] WHERE a > 1")
+			})
+
+			Convey("Then words should be matched case-insensitively", func() {
+				parseSame("select\n  Stream a from s [range 2 rows]",
+					"SELECT ISTREAM a FROM s [RANGE 2 TUPLES]")
+			})
+
+			Convey("Then the longest alias should be used", func() {
+				parseSame("SELECT STREAM RELATION a FROM s [RANGE 2 ROWS]",
+					"SELECT RSTREAM a FROM s [RANGE 2 TUPLES]")
+			})
+		})
+
+		Convey("When parsing a statement containing aliases in literals", func() {
+			Convey("Then string literals, comments, and paths should be kept", func() {
+				parseSame("SELECT ISTREAM \"rows\", x:rows, rows_ FROM s [RANGE 2 ROWS] -- ROWS\n",
+					"SELECT ISTREAM \"rows\", x:rows, rows_ FROM s [RANGE 2 TUPLES] -- ROWS\n")
+			})
+		})
+
+		Convey("When parsing multiple statements using aliases", func() {
+			stmts, err := p.ParseStmts("SELECT STREAM a FROM s [RANGE 1 ROWS]; SELECT STREAM b FROM s [RANGE 3 ROWS]")
+			So(err, ShouldBeNil)
+
+			Convey("Then they should be parsed as the canonical statements", func() {
+				expected, err := canonical.ParseStmts("SELECT ISTREAM a FROM s [RANGE 1 TUPLES]; SELECT ISTREAM b FROM s [RANGE 3 TUPLES]")
+				So(err, ShouldBeNil)
+				So(EqualAST(stmts, expected), ShouldBeTrue)
+			})
+		})
+
+		Convey("When parsing a single statement followed by another one", func() {
+			_, rest, err := p.ParseStmt("SELECT STREAM a FROM s [RANGE 1 ROWS]; SELECT STREAM b")
+
+			Convey("Then the rest should be the original text", func() {
+				So(err, ShouldBeNil)
+				So(rest, ShouldEqual, "SELECT STREAM b")
+			})
+		})
+
+		Convey("When registering invalid aliases", func() {
+			Convey("Then they should be rejected", func() {
+				So(p.AddKeywordAlias("", "SELECT"), ShouldNotBeNil)
+				So(p.AddKeywordAlias("RANGE(", "RANGE"), ShouldNotBeNil)
+				So(p.AddKeywordAlias("WINDOW", " "), ShouldNotBeNil)
+				So(p.AddKeywordAlias("rows", "SECONDS"), ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a parser without keyword aliases", t, func() {
+		p := New()
+
+		Convey("When parsing a statement using an alias", func() {
+			_, _, err := p.ParseStmt("SELECT STREAM a FROM s [RANGE 2 ROWS]")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
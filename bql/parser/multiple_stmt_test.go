@@ -14,75 +14,75 @@ func TestMultipleStmtParser(t *testing.T) {
 		// single statement
 		"SELECT ISTREAM a": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// single statement, terminated with semicolon
 		"SELECT ISTREAM a;": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// single statement, terminated with semicolon and some spaces
 		"SELECT ISTREAM a ; ": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// single statement starting with a space
 		"  SELECT ISTREAM a ;": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// two statements with various space separations
 		"SELECT ISTREAM a;SELECT ISTREAM b": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}, false}},
 		},
 		"SELECT ISTREAM a ;SELECT ISTREAM b": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}, false}},
 		},
 		"SELECT ISTREAM a; SELECT ISTREAM b": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}, false}},
 		},
 		"SELECT ISTREAM a ; SELECT ISTREAM b": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}, false}},
 		},
 		// three statements
 		"SELECT ISTREAM a ; SELECT ISTREAM b; SELECT ISTREAM c": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}, false}},
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "c"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "c"}}, false}},
 		},
 		// using semi-colons within the statements
 		`SELECT ISTREAM a ; SELECT ISTREAM b; SELECT ISTREAM c, ";"`: []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}, false}},
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
 				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "c"},
-					StringLiteral{";"}}}},
+					StringLiteral{";"}}, false}},
 		},
 		`SELECT ISTREAM a;SELECT ISTREAM c, ";";SELECT ISTREAM b;`: []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
 				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "c"},
-					StringLiteral{";"}}}},
+					StringLiteral{";"}}, false}},
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}, false}},
 		},
 	}
 
@@ -118,72 +118,72 @@ func TestComment(t *testing.T) {
 		// single statement
 		"SELECT ISTREAM a": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// single statement on two lines
 		"SELECT ISTREAM \na": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// single statement with a blank line following
 		"SELECT ISTREAM a\n": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// single statement with a comment following on a new line
 		"SELECT DSTREAM a\n--comment": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Dstream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// single semi-colon terminated statement with a comment following on a new line
 		"SELECT DSTREAM a;\n--comment": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Dstream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// single statement with a comment following on a new line and more newlines
 		"SELECT DSTREAM a\n--comment\n\n": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Dstream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// single statement with an empty comment on two lines
 		"SELECT ISTREAM --\na": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// single statement with a space-only comment on two lines
 		"SELECT ISTREAM --   \na": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// single statement with a normal comment on two lines
 		"SELECT ISTREAM -- comment here\na": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// single statement with multiple comments
 		"SELECT ISTREAM -- comment\n  -- continues\n--even longer\na": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// single statement introduced by comment
 		" -- comment\nSELECT ISTREAM a": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 		},
 		// multiple statements separated by comment
 		"SELECT ISTREAM a;\n--comment\nSELECT ISTREAM b": []interface{}{
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}}, false}},
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}}},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "b"}}, false}},
 		},
 		// non-select statements as well
 		("-- do some setup\nCREATE STATE hoge TYPE test;\nSELECT ISTREAM\n  --cols\n" +
 			"  a,b;\nDROP STATE hoge;\n--done"): []interface{}{
-			CreateStateStmt{StreamIdentifier("hoge"), SourceSinkType("test"), SourceSinkSpecsAST{nil}},
+			CreateStateStmt{StreamIdentifier("hoge"), SourceSinkType("test"), SourceSinkSpecsAST{nil}, CreateModifierAST{}},
 			SelectStmt{EmitterAST: EmitterAST{Istream, nil},
-				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}, RowValue{"", "b"}}}},
-			DropStateStmt{StreamIdentifier("hoge")},
+				ProjectionsAST: ProjectionsAST{[]Expression{RowValue{"", "a"}, RowValue{"", "b"}}, false}},
+			DropStateStmt{StreamIdentifier("hoge"), UnspecifiedKeyword},
 		},
 	}
 
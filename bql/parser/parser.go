@@ -11,7 +11,8 @@ import (
 )
 
 type bqlParser struct {
-	b bqlPeg
+	b       bqlPeg
+	aliases []keywordAlias
 }
 
 func New() *bqlParser {
@@ -25,14 +26,20 @@ func (p *bqlParser) ParseStmt(s string) (result interface{}, rest string, err er
 			err = fmt.Errorf("Error in BQL parser: %v", r)
 		}
 	}()
-	// parse the statement
+	// replace keyword aliases, if any, and parse the statement
+	n := p.normalize(s)
 	b := p.b
-	b.Buffer = s
+	b.Buffer = n.text
 	b.Init()
 	if err := b.Parse(); err != nil {
 		return nil, "", err
 	}
 	b.Execute()
+	if cErr := b.parseStack.err; cErr != nil {
+		// discard components of the broken statement
+		b.parseStack = parseStack{}
+		return nil, "", &bqlComponentError{[]rune(n.text), cErr}
+	}
 	if b.parseStack.Peek() == nil {
 		// the statement was parsed ok, but not put on the stack?
 		// this should never occur.
@@ -47,7 +54,8 @@ func (p *bqlParser) ParseStmt(s string) (result interface{}, rest string, err er
 	isSpaceOrSemicolon := func(r rune) bool {
 		return unicode.IsSpace(r) || r == rune(';')
 	}
-	rest = strings.TrimLeftFunc(string([]rune(s)[stackElem.end:]), isSpaceOrSemicolon)
+	end := n.originalOffset(stackElem.end)
+	rest = strings.TrimLeftFunc(string([]rune(s)[end:]), isSpaceOrSemicolon)
 	// pop it from the parse stack
 	return stackElem.comp, rest, nil
 }
@@ -68,6 +76,19 @@ func (p *bqlParser) ParseStmts(s string) ([]interface{}, error) {
 	return results, nil
 }
 
+// ErrorOffset returns the offset, in runes, of the position in a statement
+// at which the given error returned by ParseStmt or ParseStmts was found. It
+// returns false when the error doesn't have a position.
+func ErrorOffset(err error) (int, bool) {
+	switch e := err.(type) {
+	case *bqlParseError:
+		return int(e.max.end), true
+	case *bqlComponentError:
+		return e.pos, true
+	}
+	return 0, false
+}
+
 type bqlPeg struct {
 	bqlPegBackend
 }
@@ -116,33 +137,7 @@ func (e *bqlParseError) Error() string {
 			translations := translatePositions(e.p.buffer, positions)
 			error += fmt.Sprintf("statement has a syntax error near line %v, symbol %v:\n",
 				translations[end].line, translations[end].symbol)
-			// we want some output like:
-			//
-			//   ... FROM x [RANGE 7 UPLES] WHERE ...
-			//                       ^
-			//
-			snipStartIdx := end - 20
-			snipStart := "..."
-			if snipStartIdx < 0 {
-				snipStartIdx = 0
-				snipStart = ""
-			}
-			snipEndIdx := end + 30
-			snipEnd := "..."
-			if snipEndIdx > len(stmt) {
-				snipEndIdx = len(stmt)
-				snipEnd = ""
-			}
-			// first line: an excerpt from the statement
-			error += "  " + snipStart
-			snipBeforeErr := strings.Replace(string(stmt[snipStartIdx:end]), "\n", " ", -1)
-			snipAfterInclErr := strings.Replace(string(stmt[end:snipEndIdx]), "\n", " ", -1)
-			error += snipBeforeErr + snipAfterInclErr
-			error += snipEnd + "\n"
-			// second line: a ^ marker at the correct position
-			error += strings.Repeat(" ", len(snipStart)+2)
-			error += strings.Repeat(" ", runewidth.StringWidth(snipBeforeErr))
-			error += "^"
+			error += errorSnippet(stmt, end)
 			foundError = true
 		}
 	}
@@ -152,3 +147,50 @@ func (e *bqlParseError) Error() string {
 
 	return error
 }
+
+// errorSnippet returns an excerpt from the statement around the position
+// pos and a ^ marker pointing at it.
+func errorSnippet(stmt []rune, pos int) string {
+	// we want some output like:
+	//
+	//   ... FROM x [RANGE 7 UPLES] WHERE ...
+	//                       ^
+	//
+	snipStartIdx := pos - 20
+	snipStart := "..."
+	if snipStartIdx < 0 {
+		snipStartIdx = 0
+		snipStart = ""
+	}
+	snipEndIdx := pos + 30
+	snipEnd := "..."
+	if snipEndIdx > len(stmt) {
+		snipEndIdx = len(stmt)
+		snipEnd = ""
+	}
+	// first line: an excerpt from the statement
+	snippet := "  " + snipStart
+	snipBeforeErr := strings.Replace(string(stmt[snipStartIdx:pos]), "\n", " ", -1)
+	snipAfterInclErr := strings.Replace(string(stmt[pos:snipEndIdx]), "\n", " ", -1)
+	snippet += snipBeforeErr + snipAfterInclErr
+	snippet += snipEnd + "\n"
+	// second line: a ^ marker at the correct position
+	snippet += strings.Repeat(" ", len(snipStart)+2)
+	snippet += strings.Repeat(" ", runewidth.StringWidth(snipBeforeErr))
+	snippet += "^"
+	return snippet
+}
+
+// bqlComponentError is an error found while assembling components of a
+// syntactically valid statement, e.g. a numeric literal which overflows.
+type bqlComponentError struct {
+	stmt []rune
+	*componentError
+}
+
+func (e *bqlComponentError) Error() string {
+	translations := translatePositions(e.stmt, []int{e.pos})
+	return fmt.Sprintf("failed to parse string as BQL statement\n"+
+		"%v near line %v, symbol %v:\n%v", e.err,
+		translations[e.pos].line, translations[e.pos].symbol, errorSnippet(e.stmt, e.pos))
+}
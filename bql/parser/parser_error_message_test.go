@@ -68,3 +68,144 @@ consider to look up the documentation for CreateStreamAsSelectStmt`,
 	})
 
 }
+
+func TestNumericLiteralOverflow(t *testing.T) {
+	Convey("Given a BQL parser", t, func() {
+		p := New()
+
+		Convey("When parsing a numeric literal overflowing int64", func() {
+			_, _, err := p.ParseStmt(`EVAL 1 + 99999999999999999999`)
+
+			Convey("Then parsing should fail with a located error", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, `failed to parse string as BQL statement
+numeric literal 99999999999999999999 is out of the range of int64 near line 1, symbol 10:
+  EVAL 1 + 99999999999999999999
+           ^`)
+			})
+
+			Convey("And parsing the next statement should succeed", func() {
+				stmt, _, err := p.ParseStmt(`EVAL 1`)
+				So(err, ShouldBeNil)
+				So(stmt, ShouldResemble, EvalStmt{NumericLiteral{1}, nil})
+			})
+		})
+
+		Convey("When parsing a non-negative numeric literal overflowing int64", func() {
+			_, _, err := p.ParseStmt("SELECT ISTREAM a FROM s\n  [RANGE 99999999999999999999 TUPLES]")
+
+			Convey("Then parsing should fail with a located error", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldNotContainSubstring, "Error in BQL parser")
+				So(err.Error(), ShouldContainSubstring, "out of the range of int64 near line 2, symbol 10:")
+			})
+		})
+
+		Convey("When parsing the largest int64", func() {
+			stmt, _, err := p.ParseStmt(`EVAL 9223372036854775807`)
+
+			Convey("Then parsing should succeed", func() {
+				So(err, ShouldBeNil)
+				So(stmt.(EvalStmt).Expr, ShouldResemble, NumericLiteral{9223372036854775807})
+			})
+		})
+	})
+}
+
+func TestComponentErrorMessage(t *testing.T) {
+	// statements which are syntactically valid but have an invalid component
+	testCases := []struct {
+		stmt     string
+		expected string
+	}{
+		{
+			`SELECT ISTREAM x FROM add(DISTINCT 2) [RANGE 1 TUPLES]`,
+			`DISTINCT cannot be used in a UDSF near line 1, symbol 23:`,
+		},
+		{
+			`SELECT ISTREAM x FROM add(y => a, 2) [RANGE 1 TUPLES]`,
+			`a positional argument cannot follow named arguments near line 1, symbol 23:`,
+		},
+		{
+			`SELECT ISTREAM x FROM add(y => a, y => 2) [RANGE 1 TUPLES]`,
+			`argument 'y' is given more than once near line 1, symbol 23:`,
+		},
+		{
+			`SELECT ISTREAM f FROM s MATCH_RECOGNIZE (MEASURES a:v AS f PATTERN (a) DEFINE b AS b:v > 0) [RANGE 1 TUPLES]`,
+			`pattern variable 'b' is defined but not used in the pattern near line 1, symbol 79:`,
+		},
+		{
+			`SELECT ISTREAM f FROM s MATCH_RECOGNIZE (MEASURES a:v AS f PATTERN (a) DEFINE a AS a:v > 0, a AS a:v < 9) [RANGE 1 TUPLES]`,
+			`pattern variable 'a' is defined more than once near line 1, symbol 93:`,
+		},
+		{
+			`SELECT ISTREAM f FROM s MATCH_RECOGNIZE (MEASURES a:v AS f PATTERN (b a{0})) [RANGE 1 TUPLES]`,
+			`invalid quantifier of pattern variable 'a' near line 1, symbol 71:`,
+		},
+		{
+			`SELECT ISTREAM f FROM s MATCH_RECOGNIZE (MEASURES a:v AS f PATTERN (b a{3,1})) [RANGE 1 TUPLES]`,
+			`invalid quantifier of pattern variable 'a' near line 1, symbol 71:`,
+		},
+		{
+			`SELECT ISTREAM f FROM s MATCH_RECOGNIZE (MEASURES a:v AS f PATTERN (b a{99999999999999999999})) [RANGE 1 TUPLES]`,
+			`value out of range near line 1, symbol 71:`,
+		},
+		{
+			`SELECT ISTREAM f FROM s MATCH_RECOGNIZE (MEASURES a:v AS f PATTERN (b a{})) [RANGE 1 TUPLES]`,
+			`a quantifier must have a bound near line 1, symbol 71:`,
+		},
+	}
+
+	Convey("Given a BQL parser", t, func() {
+		p := New()
+
+		for _, tc := range testCases {
+			// avoid closure over loop variables
+			stmt, expected := tc.stmt, tc.expected
+
+			Convey(fmt.Sprintf("When parsing %s", stmt), func() {
+				_, _, err := p.ParseStmt(stmt)
+
+				Convey("Then parsing should fail with a located error", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldNotContainSubstring, "Error in BQL parser")
+					So(err.Error(), ShouldContainSubstring, expected)
+				})
+			})
+		}
+	})
+}
+
+func TestErrorOffset(t *testing.T) {
+	Convey("Given a BQL parser", t, func() {
+		p := New()
+
+		Convey("When parsing a statement having a syntax error", func() {
+			_, _, err := p.ParseStmt(`REWIND SSOURCE ab`)
+
+			Convey("Then the error should have the offset of the error", func() {
+				offset, ok := ErrorOffset(err)
+				So(ok, ShouldBeTrue)
+				So(offset, ShouldEqual, 7)
+			})
+		})
+
+		Convey("When parsing a numeric literal overflowing int64", func() {
+			_, _, err := p.ParseStmt(`EVAL 1 + 99999999999999999999`)
+
+			Convey("Then the error should have the offset of the literal", func() {
+				offset, ok := ErrorOffset(err)
+				So(ok, ShouldBeTrue)
+				So(offset, ShouldEqual, 9)
+			})
+		})
+
+		Convey("When getting the offset of an error not returned by the parser", func() {
+			_, ok := ErrorOffset(fmt.Errorf("error"))
+
+			Convey("Then it shouldn't have an offset", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
@@ -0,0 +1,209 @@
+package parser
+
+import (
+	"encoding/base64"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// PreparedStmt is a parsed BQL statement which can have placeholders such
+// as `$name` in place of expressions. Values are bound to the placeholders
+// by Bind, which returns a statement without placeholders. Because values
+// are inserted as literals into the parsed statement, they never have to be
+// escaped and the statement doesn't have to be parsed again.
+type PreparedStmt struct {
+	stmt   interface{}
+	params []string
+}
+
+// Prepare parses a single statement which may contain placeholders.
+func (p *bqlParser) Prepare(s string) (*PreparedStmt, error) {
+	stmt, rest, err := p.ParseStmt(s)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("a prepared statement must be a single statement")
+	}
+
+	names := map[string]bool{}
+	if _, err := replacePlaceholders(reflect.ValueOf(stmt), func(p Placeholder) (Expression, error) {
+		names[p.Name] = true
+		return p, nil
+	}); err != nil {
+		return nil, err
+	}
+	params := make([]string, 0, len(names))
+	for n := range names {
+		params = append(params, n)
+	}
+	sort.Strings(params)
+	return &PreparedStmt{
+		stmt:   stmt,
+		params: params,
+	}, nil
+}
+
+// Params returns the sorted names of placeholders in the statement.
+func (ps *PreparedStmt) Params() []string {
+	params := make([]string, len(ps.params))
+	copy(params, ps.params)
+	return params
+}
+
+// String returns the statement including placeholders.
+func (ps *PreparedStmt) String() string {
+	if s, ok := ps.stmt.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprint(ps.stmt)
+}
+
+// Bind returns a copy of the statement whose placeholders are replaced by
+// the values in params. It fails when a placeholder doesn't have a value or
+// params has a value for a placeholder which isn't in the statement. The
+// prepared statement isn't modified and can be bound again.
+func (ps *PreparedStmt) Bind(params data.Map) (interface{}, error) {
+	for name := range params {
+		i := sort.SearchStrings(ps.params, name)
+		if i == len(ps.params) || ps.params[i] != name {
+			return nil, fmt.Errorf("the statement doesn't have parameter $%v", name)
+		}
+	}
+
+	v, err := replacePlaceholders(reflect.ValueOf(ps.stmt), func(p Placeholder) (Expression, error) {
+		v, ok := params[p.Name]
+		if !ok {
+			return nil, fmt.Errorf("parameter $%v is not bound", p.Name)
+		}
+		return ValueToLiteral(v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// ValueToLiteral converts a data.Value to an expression which evaluates to
+// the same value.
+func ValueToLiteral(v data.Value) (Expression, error) {
+	switch v.Type() {
+	case data.TypeNull:
+		return NullLiteral{}, nil
+	case data.TypeBool:
+		b, _ := data.AsBool(v)
+		return BoolLiteral{b}, nil
+	case data.TypeInt:
+		i, _ := data.AsInt(v)
+		return NumericLiteral{i}, nil
+	case data.TypeFloat:
+		f, _ := data.AsFloat(v)
+		return FloatLiteral{f}, nil
+	case data.TypeString:
+		s, _ := data.AsString(v)
+		return StringLiteral{s}, nil
+	case data.TypeBlob:
+		b, _ := data.AsBlob(v)
+		return TypeCastAST{StringLiteral{base64.StdEncoding.EncodeToString(b)}, Blob}, nil
+	case data.TypeTimestamp:
+		t, _ := data.AsTimestamp(v)
+		return TypeCastAST{StringLiteral{t.Format(time.RFC3339Nano)}, Timestamp}, nil
+	case data.TypeArray:
+		a, _ := data.AsArray(v)
+		exprs := make([]Expression, len(a))
+		for i, e := range a {
+			expr, err := ValueToLiteral(e)
+			if err != nil {
+				return nil, err
+			}
+			exprs[i] = expr
+		}
+		return ArrayAST{ExpressionsAST{exprs}}, nil
+	case data.TypeMap:
+		m, _ := data.AsMap(v)
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		entries := make([]KeyValuePairAST, len(keys))
+		for i, k := range keys {
+			expr, err := ValueToLiteral(m[k])
+			if err != nil {
+				return nil, err
+			}
+			entries[i] = KeyValuePairAST{k, expr, nil}
+		}
+		return MapAST{entries}, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to a literal", v)
+}
+
+var placeholderType = reflect.TypeOf(Placeholder{})
+
+// replacePlaceholders returns a copy of v in which every Placeholder stored
+// in an interface is replaced by the result of f. Structs and slices are
+// copied so that v itself isn't modified.
+func replacePlaceholders(v reflect.Value, f func(Placeholder) (Expression, error)) (reflect.Value, error) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, nil
+		}
+		var e reflect.Value
+		if v.Elem().Type() == placeholderType {
+			expr, err := f(v.Elem().Interface().(Placeholder))
+			if err != nil {
+				return v, err
+			}
+			e = reflect.ValueOf(expr)
+		} else {
+			var err error
+			if e, err = replacePlaceholders(v.Elem(), f); err != nil {
+				return v, err
+			}
+		}
+		r := reflect.New(v.Type()).Elem()
+		r.Set(e)
+		return r, nil
+
+	case reflect.Struct:
+		if v.Type() == placeholderType {
+			// a placeholder not stored in an interface, e.g. the
+			// statement itself, cannot be replaced
+			return v, nil
+		}
+		r := reflect.New(v.Type()).Elem()
+		r.Set(v)
+		for i := 0; i < r.NumField(); i++ {
+			field := r.Field(i)
+			if !field.CanSet() {
+				continue
+			}
+			e, err := replacePlaceholders(field, f)
+			if err != nil {
+				return v, err
+			}
+			field.Set(e)
+		}
+		return r, nil
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v, nil
+		}
+		r := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e, err := replacePlaceholders(v.Index(i), f)
+			if err != nil {
+				return v, err
+			}
+			r.Index(i).Set(e)
+		}
+		return r, nil
+	}
+	return v, nil
+}
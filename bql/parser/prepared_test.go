@@ -0,0 +1,127 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestPreparedStmt(t *testing.T) {
+	Convey("Given a statement having placeholders", t, func() {
+		p := New()
+		ps, err := p.Prepare("SELECT ISTREAM a, $x AS x FROM s [RANGE 1 TUPLES] WHERE a = $y AND b IN ($x, $z)")
+		So(err, ShouldBeNil)
+
+		Convey("When getting its parameters", func() {
+			params := ps.Params()
+
+			Convey("Then they should be sorted and unique", func() {
+				So(params, ShouldResemble, []string{"x", "y", "z"})
+			})
+		})
+
+		Convey("When binding values to all parameters", func() {
+			stmt, err := ps.Bind(data.Map{
+				"x": data.String(`"quoted" OR 1 = 1`),
+				"y": data.Int(3),
+				"z": data.Null{},
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then the placeholders should be replaced by literals", func() {
+				So(stmt, ShouldHaveSameTypeAs, SelectStmt{})
+				s := stmt.(SelectStmt)
+				So(s.Projections[1], ShouldResemble, AliasAST{StringLiteral{`"quoted" OR 1 = 1`}, "x"})
+				So(s.String(), ShouldEqual, `SELECT ISTREAM a, """quoted"" OR 1 = 1" AS x FROM s [RANGE 1 TUPLES] `+
+					`WHERE a = 3 AND b IN ("""quoted"" OR 1 = 1", NULL)`)
+			})
+
+			Convey("Then the prepared statement shouldn't be modified", func() {
+				So(ps.String(), ShouldEqual, "SELECT ISTREAM a, $x AS x FROM s [RANGE 1 TUPLES] WHERE a = $y AND b IN ($x, $z)")
+			})
+		})
+
+		Convey("When a parameter isn't bound", func() {
+			_, err := ps.Bind(data.Map{"x": data.Int(1), "y": data.Int(2)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "$z")
+			})
+		})
+
+		Convey("When binding a value to an unknown parameter", func() {
+			_, err := ps.Bind(data.Map{"x": data.Int(1), "y": data.Int(2), "z": data.Int(3), "w": data.Int(4)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "$w")
+			})
+		})
+	})
+
+	Convey("Given a parser", t, func() {
+		p := New()
+
+		Convey("When preparing multiple statements", func() {
+			_, err := p.Prepare("SELECT ISTREAM $a FROM s [RANGE 1 TUPLES]; SELECT ISTREAM $b FROM s [RANGE 1 TUPLES]")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When preparing a statement without placeholders", func() {
+			ps, err := p.Prepare("EVAL 1 + 2")
+			So(err, ShouldBeNil)
+
+			Convey("Then it can be bound without parameters", func() {
+				So(ps.Params(), ShouldBeEmpty)
+				stmt, err := ps.Bind(nil)
+				So(err, ShouldBeNil)
+				So(stmt, ShouldResemble, EvalStmt{BinaryOpAST{Plus, NumericLiteral{1}, NumericLiteral{2}}, nil})
+			})
+		})
+	})
+}
+
+func TestValueToLiteral(t *testing.T) {
+	Convey("Given values of each type", t, func() {
+		now := time.Date(2015, time.May, 1, 14, 27, 0, 123000000, time.UTC)
+		values := []data.Value{
+			data.Null{},
+			data.Bool(true),
+			data.Int(-3),
+			data.Float(2.5),
+			data.String("hoge"),
+			data.Blob("blob"),
+			data.Timestamp(now),
+			data.Array{data.Int(1), data.String("a")},
+			data.Map{"b": data.Int(1), "a": data.Array{data.Bool(false)}},
+		}
+
+		Convey("When converting them to literals", func() {
+			exprs := make([]string, len(values))
+			for i, v := range values {
+				e, err := ValueToLiteral(v)
+				So(err, ShouldBeNil)
+				exprs[i] = e.String()
+			}
+
+			Convey("Then they should be written as BQL expressions", func() {
+				So(exprs, ShouldResemble, []string{
+					"NULL",
+					"TRUE",
+					"-3",
+					"2.5",
+					`"hoge"`,
+					`CAST("YmxvYg==" AS BLOB)`,
+					`CAST("2015-05-01T14:27:00.123Z" AS TIMESTAMP)`,
+					`[1, "a"]`,
+					`{"a":[FALSE], "b":1}`,
+				})
+			})
+		})
+	})
+}
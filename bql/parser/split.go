@@ -0,0 +1,113 @@
+package parser
+
+// StatementRange represents the position of a statement in a BQL string.
+// Begin and End are byte offsets and s[Begin:End] is the statement without
+// the terminating semicolon and without leading or trailing whitespace and
+// comments.
+type StatementRange struct {
+	Begin int
+	End   int
+}
+
+// SplitStatements finds boundaries of statements in the given BQL string
+// without parsing them. Statements are separated by semicolons. Semicolons in
+// string literals, comments, brackets, and bodies of functions enclosed by
+// "$$" don't split statements. Because this function doesn't check the
+// syntax, each returned range isn't guaranteed to be a valid statement.
+// Ranges only containing whitespace or comments aren't returned.
+func SplitStatements(s string) []StatementRange {
+	var (
+		ranges []StatementRange
+		depth  int
+		begin  = -1 // the beginning of the current statement
+		end    int  // the end of the last significant token
+	)
+
+	// markSignificant extends the current statement to s[i:j].
+	markSignificant := func(i, j int) {
+		if begin < 0 {
+			begin = i
+		}
+		end = j
+	}
+
+	for i := 0; i < len(s); {
+		switch c := s[i]; c {
+		case ' ', '\t', '\n', '\r':
+			i++
+
+		case '-':
+			if i+1 < len(s) && s[i+1] == '-' {
+				// a comment lasts until the end of the line
+				for i < len(s) && s[i] != '\n' && s[i] != '\r' {
+					i++
+				}
+				continue
+			}
+			markSignificant(i, i+1)
+			i++
+
+		case '"', '\'':
+			// a quote in a string literal is escaped by doubling it,
+			// which is handled as two consecutive string literals here
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				j++
+			}
+			if j < len(s) {
+				j++ // the closing quote
+			}
+			markSignificant(i, j)
+			i = j
+
+		case '$':
+			if i+1 < len(s) && s[i+1] == '$' {
+				// the body of a function lasts until the next "$$"
+				j := i + 2
+				for j < len(s) && !(s[j] == '$' && j+1 < len(s) && s[j+1] == '$') {
+					j++
+				}
+				if j < len(s) {
+					j += 2 // the closing "$$"
+				}
+				markSignificant(i, j)
+				i = j
+				continue
+			}
+			markSignificant(i, i+1)
+			i++
+
+		case '(', '[', '{':
+			depth++
+			markSignificant(i, i+1)
+			i++
+
+		case ')', ']', '}':
+			if depth > 0 {
+				depth--
+			}
+			markSignificant(i, i+1)
+			i++
+
+		case ';':
+			if depth > 0 {
+				markSignificant(i, i+1)
+				i++
+				continue
+			}
+			if begin >= 0 {
+				ranges = append(ranges, StatementRange{begin, end})
+			}
+			begin = -1
+			i++
+
+		default:
+			markSignificant(i, i+1)
+			i++
+		}
+	}
+	if begin >= 0 {
+		ranges = append(ranges, StatementRange{begin, end})
+	}
+	return ranges
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	Convey("Given BQL strings", t, func() {
+		cases := []struct {
+			title    string
+			input    string
+			expected []string
+		}{
+			{"an empty string", "", nil},
+			{"only whitespace and comments", " \n-- hoge;\n  ;; ", nil},
+			{"a single statement without a semicolon", "DROP SOURCE a",
+				[]string{"DROP SOURCE a"}},
+			{"a single statement with a semicolon", "  DROP SOURCE a ;  ",
+				[]string{"DROP SOURCE a"}},
+			{"multiple statements", "DROP SOURCE a;DROP SINK b;\n\nDROP STREAM c",
+				[]string{"DROP SOURCE a", "DROP SINK b", "DROP STREAM c"}},
+			{"a semicolon in a string literal",
+				`EVAL "a;b"; EVAL "c"`,
+				[]string{`EVAL "a;b"`, `EVAL "c"`}},
+			{"a semicolon in a string literal having escaped quotes",
+				`EVAL "a"";""b"; EVAL "c"`,
+				[]string{`EVAL "a"";""b"`, `EVAL "c"`}},
+			{"a semicolon in a single-quoted string",
+				`EVAL x['a;b']; EVAL y`,
+				[]string{`EVAL x['a;b']`, `EVAL y`}},
+			{"a semicolon in a comment",
+				"-- first; statement\nEVAL 1 -- ;comment\n; EVAL 2",
+				[]string{"EVAL 1", "EVAL 2"}},
+			{"a semicolon in brackets",
+				"EVAL {\"a\": [1; 2]}; EVAL (3;)",
+				[]string{"EVAL {\"a\": [1; 2]}", "EVAL (3;)"}},
+			{"a minus operator",
+				"EVAL 1 - 2; EVAL -3",
+				[]string{"EVAL 1 - 2", "EVAL -3"}},
+			{"an unterminated string literal",
+				`EVAL "a; EVAL b`,
+				[]string{`EVAL "a; EVAL b`}},
+			{"a semicolon in the body of a function",
+				"CREATE FUNCTION f LANGUAGE lua AS $$ local a = 1; return a $$; EVAL $1",
+				[]string{"CREATE FUNCTION f LANGUAGE lua AS $$ local a = 1; return a $$", "EVAL $1"}},
+			{"an unterminated body of a function",
+				"CREATE FUNCTION f LANGUAGE lua AS $$ return 1; $",
+				[]string{"CREATE FUNCTION f LANGUAGE lua AS $$ return 1; $"}},
+			{"multibyte characters",
+				`EVAL "日本語;"; EVAL "ü"`,
+				[]string{`EVAL "日本語;"`, `EVAL "ü"`}},
+		}
+
+		for _, c := range cases {
+			c := c
+			Convey("When splitting "+c.title, func() {
+				ranges := SplitStatements(c.input)
+
+				Convey("Then it should return correct ranges", func() {
+					So(len(ranges), ShouldEqual, len(c.expected))
+					for i, r := range ranges {
+						So(c.input[r.Begin:r.End], ShouldEqual, c.expected[i])
+					}
+				})
+			})
+		}
+	})
+
+	Convey("Given BQL statements", t, func() {
+		s := `CREATE SOURCE s TYPE dummy WITH v = "a;b";
+			-- a comment;
+			CREATE STREAM t AS SELECT ISTREAM * FROM s [RANGE 1 TUPLES] WHERE x = ";";`
+
+		Convey("When splitting them", func() {
+			ranges := SplitStatements(s)
+
+			Convey("Then each range should be parsed as a statement", func() {
+				So(len(ranges), ShouldEqual, 2)
+				p := New()
+				for _, r := range ranges {
+					_, rest, err := p.ParseStmt(s[r.Begin:r.End])
+					So(err, ShouldBeNil)
+					So(rest, ShouldBeEmpty)
+				}
+			})
+		})
+	})
+}
@@ -1,8 +1,12 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // parseStack is a standard stack implementation, but also holds
@@ -10,6 +14,15 @@ import (
 type parseStack struct {
 	top  *stackElement
 	size int
+	// err is the first error found while assembling components
+	err *componentError
+}
+
+// componentError is an error found at the position pos of the input
+// string while assembling components.
+type componentError struct {
+	pos int
+	err error
 }
 
 // stackElement is a stack-internal data structure that is used
@@ -54,6 +67,26 @@ func (ps *parseStack) Pop() (value *ParsedComponent) {
 	return nil
 }
 
+// reportError records an error found at the position pos of the input
+// string. Only the first error is kept.
+func (ps *parseStack) reportError(pos int, err error) {
+	if ps.err == nil {
+		ps.err = &componentError{pos, err}
+	}
+}
+
+// PushNumericLiteral pushes a NumericLiteral parsed from the given string.
+// When the string cannot be converted to a NumericLiteral, e.g. because it
+// overflows int64, an error is reported and a zero value is pushed instead
+// so that the remaining components can still be assembled.
+func (ps *parseStack) PushNumericLiteral(begin int, end int, s string) {
+	l, err := ParseNumericLiteral(s)
+	if err != nil {
+		ps.reportError(begin, err)
+	}
+	ps.PushComponent(begin, end, l)
+}
+
 // Peek returns the top element from the stack but doesn't remove it.
 // If the stack is empty, returns nil.
 func (ps *parseStack) Peek() (value *ParsedComponent) {
@@ -67,20 +100,25 @@ func (ps *parseStack) Peek() (value *ParsedComponent) {
 // they are components of a SELECT statement, and replaces them by
 // a single SelectStmt element.
 //
-//  EmitterAST
+//  LimitAST
+//  OrderByAST
 //  HavingAST
 //  GroupingAST
 //  FilterAST
 //  WindowedFromAST
 //  ProjectionsAST
+//  EmitterAST
 //   =>
-//  SelectStmt{EmitterAST, ProjectionsAST, WindowedFromAST, FilterAST, GroupingAST, HavingAST}
+//  SelectStmt{WithAST, EmitterAST, ProjectionsAST, WindowedFromAST, FilterAST, GroupingAST,
+//    HavingAST, OrderByAST, LimitAST}
 func (ps *parseStack) AssembleSelect() {
 	// pop the components from the stack in reverse order
-	_having, _grouping, _filter, _from, _projections, _emitter := ps.pop6()
+	_limit, _orderBy, _having, _grouping, _filter, _from, _projections, _emitter := ps.pop8()
 
 	// extract and convert the contained structure
 	// (if this fails, this is a fundamental parser bug => panic ok)
+	limit := _limit.comp.(LimitAST)
+	orderBy := _orderBy.comp.(OrderByAST)
 	having := _having.comp.(HavingAST)
 	grouping := _grouping.comp.(GroupingAST)
 	filter := _filter.comp.(FilterAST)
@@ -89,11 +127,51 @@ func (ps *parseStack) AssembleSelect() {
 	emitter := _emitter.comp.(EmitterAST)
 
 	// assemble the SelectStmt and push it back
-	s := SelectStmt{emitter, projections, from, filter, grouping, having}
-	se := ParsedComponent{_emitter.begin, _having.end, s}
+	s := SelectStmt{WithAST{}, emitter, projections, from, filter, grouping, having, orderBy, limit}
+	se := ParsedComponent{_emitter.begin, _limit.end, s}
 	ps.Push(&se)
 }
 
+// AssembleWithSelect takes the elements from the stack that correspond
+// to the input[begin:end] string, i.e., the named SELECT statements of a
+// WITH clause and the SelectStmt following them, and sets the WITH clause
+// of the SelectStmt.
+//
+//  SelectStmt
+//  NamedSelectAST
+//  NamedSelectAST
+//   =>
+//  SelectStmt{WithAST{[NamedSelectAST, NamedSelectAST]}, ...}
+func (ps *parseStack) AssembleWithSelect(begin int, end int) {
+	_select := ps.Pop()
+	s := _select.comp.(SelectStmt)
+
+	elems := ps.collectElements(begin, end)
+	named := make([]NamedSelectAST, len(elems))
+	for i, elem := range elems {
+		named[i] = elem.(NamedSelectAST)
+	}
+	s.With = named
+	ps.PushComponent(begin, end, s)
+}
+
+// AssembleNamedSelect takes the topmost elements from the stack, assuming
+// they are components of a named SELECT statement in a WITH clause, and
+// replaces them by a single NamedSelectAST element.
+//
+//  SelectStmt
+//  StreamIdentifier
+//   =>
+//  NamedSelectAST{StreamIdentifier, SelectStmt}
+func (ps *parseStack) AssembleNamedSelect() {
+	_select, _name := ps.pop2()
+
+	s := _select.comp.(SelectStmt)
+	name := _name.comp.(StreamIdentifier)
+
+	ps.PushComponent(_name.begin, _select.end, NamedSelectAST{name, s})
+}
+
 // AssembleSelectUnion takes the elements from the stack that
 // correspond to the input[begin:end] string and wraps a
 // SelectUnionStmt struct around them.
@@ -110,7 +188,24 @@ func (ps *parseStack) AssembleSelectUnion(begin int, end int) {
 		selects[i] = elems[i].(SelectStmt)
 	}
 	// push the grouped list back
-	ps.PushComponent(begin, end, SelectUnionStmt{selects})
+	ps.PushComponent(begin, end, SelectUnionStmt{Selects: selects})
+}
+
+// AssembleSelectUnionOrder takes the topmost elements from the stack,
+// assuming they are components of a SELECT ... UNION ALL statement
+// followed by an ordering option, and sets the option to the statement.
+//
+//  BinaryKeyword
+//  SelectUnionStmt
+//   =>
+//  SelectUnionStmt{Selects, BinaryKeyword}
+func (ps *parseStack) AssembleSelectUnionOrder() {
+	_ordered, _union := ps.pop2()
+
+	s := _union.comp.(SelectUnionStmt)
+	s.Ordered = _ordered.comp.(BinaryKeyword)
+
+	ps.PushComponent(_union.begin, _ordered.end, s)
 }
 
 // AssembleCreateStreamAsSelect takes the topmost elements from the stack,
@@ -118,20 +213,28 @@ func (ps *parseStack) AssembleSelectUnion(begin int, end int) {
 // replaces them by a single CreateStreamAsSelectStmt element.
 //
 //  SelectStmt
+//  SourceSinkSpecsAST
+//  BinaryKeyword
 //  StreamIdentifier
+//  BinaryKeyword
+//  BinaryKeyword
 //   =>
-//  CreateStreamAsSelectStmt{StreamIdentifier, SelectStmt}
+//  CreateStreamAsSelectStmt{StreamIdentifier, SelectStmt, BinaryKeyword, SourceSinkSpecsAST,
+//    CreateModifierAST{BinaryKeyword, BinaryKeyword}}
 func (ps *parseStack) AssembleCreateStreamAsSelect() {
 	// now pop the components from the stack in reverse order
-	_select, _name := ps.pop2()
+	_select, _specs, _caseInsensitive, _name, _ifNotExists, _orReplace := ps.pop6()
 
 	// extract and convert the contained structure
 	// (if this fails, this is a fundamental parser bug => panic ok)
 	s := _select.comp.(SelectStmt)
+	specs := _specs.comp.(SourceSinkSpecsAST)
+	caseInsensitive := _caseInsensitive.comp.(BinaryKeyword)
 	name := _name.comp.(StreamIdentifier)
+	modifier := assembleCreateModifier(_orReplace, _ifNotExists)
 
 	// assemble the SelectStmt and push it back
-	css := CreateStreamAsSelectStmt{name, s}
+	css := CreateStreamAsSelectStmt{name, s, caseInsensitive, specs, modifier}
 	se := ParsedComponent{_name.begin, _select.end, css}
 	ps.Push(&se)
 }
@@ -142,11 +245,14 @@ func (ps *parseStack) AssembleCreateStreamAsSelect() {
 //
 //  SelectUnionStmt
 //  StreamIdentifier
+//  BinaryKeyword
+//  BinaryKeyword
 //   =>
-//  CreateStreamAsSelectUnionStmt{StreamIdentifier, SelectUnionStmt}
+//  CreateStreamAsSelectUnionStmt{StreamIdentifier, SelectUnionStmt,
+//    CreateModifierAST{BinaryKeyword, BinaryKeyword}}
 func (ps *parseStack) AssembleCreateStreamAsSelectUnion() {
 	// now pop the components from the stack in reverse order
-	_selectUnion, _name := ps.pop2()
+	_selectUnion, _name, _ifNotExists, _orReplace := ps.pop4()
 
 	// extract and convert the contained structure
 	// (if this fails, this is a fundamental parser bug => panic ok)
@@ -154,7 +260,34 @@ func (ps *parseStack) AssembleCreateStreamAsSelectUnion() {
 	name := _name.comp.(StreamIdentifier)
 
 	// assemble the SelectUnionStmt and push it back
-	css := CreateStreamAsSelectUnionStmt{name, selectUnion}
+	css := CreateStreamAsSelectUnionStmt{Name: name, SelectUnionStmt: selectUnion,
+		CreateModifierAST: assembleCreateModifier(_orReplace, _ifNotExists)}
+	se := ParsedComponent{_name.begin, _selectUnion.end, css}
+	ps.Push(&se)
+}
+
+// AssembleCreateRecursiveStream takes the topmost elements from the
+// stack, assuming they are components of a CREATE RECURSIVE STREAM
+// statement, and replaces them by a single CreateStreamAsSelectUnionStmt
+// element.
+//
+//  SelectUnionStmt
+//  NumericLiteral
+//  StreamIdentifier
+//   =>
+//  CreateStreamAsSelectUnionStmt{StreamIdentifier, SelectUnionStmt, true, NumericLiteral}
+func (ps *parseStack) AssembleCreateRecursiveStream() {
+	// now pop the components from the stack in reverse order
+	_selectUnion, _maxIter, _name := ps.pop3()
+
+	// extract and convert the contained structure
+	// (if this fails, this is a fundamental parser bug => panic ok)
+	selectUnion := _selectUnion.comp.(SelectUnionStmt)
+	maxIter := _maxIter.comp.(NumericLiteral)
+	name := _name.comp.(StreamIdentifier)
+
+	// assemble the CreateStreamAsSelectUnionStmt and push it back
+	css := CreateStreamAsSelectUnionStmt{name, selectUnion, true, maxIter.Value, CreateModifierAST{}}
 	se := ParsedComponent{_name.begin, _selectUnion.end, css}
 	ps.Push(&se)
 }
@@ -163,27 +296,33 @@ func (ps *parseStack) AssembleCreateStreamAsSelectUnion() {
 // assuming they are components of a CREATE SOURCE statement, and
 // replaces them by a single CreateSourceStmt element.
 //
-//  BinaryKeyword
+//  TimestampByAST
 //  SourceSinkSpecsAST
 //  SourceSinkType
 //  StreamIdentifier
+//  BinaryKeyword
+//  BinaryKeyword
+//  BinaryKeyword
 //   =>
 //  CreateSourceStmt{BinaryKeyword, StreamIdentifier, SourceSinkType,
-//    SourceSinkSpecsAST}
+//    SourceSinkSpecsAST, TimestampByAST,
+//    CreateModifierAST{BinaryKeyword, BinaryKeyword}}
 func (ps *parseStack) AssembleCreateSource() {
 	// pop the components from the stack in reverse order
-	_specs, _sourceType, _name, _paused := ps.pop4()
+	_timestampBy, _specs, _sourceType, _name, _ifNotExists, _paused, _orReplace := ps.pop7()
 
 	// extract and convert the contained structure
 	// (if this fails, this is a fundamental parser bug => panic ok)
+	timestampBy := _timestampBy.comp.(TimestampByAST)
 	specs := _specs.comp.(SourceSinkSpecsAST)
 	sourceType := _sourceType.comp.(SourceSinkType)
 	name := _name.comp.(StreamIdentifier)
 	paused := _paused.comp.(BinaryKeyword)
+	modifier := assembleCreateModifier(_orReplace, _ifNotExists)
 
 	// assemble the CreateSourceStmt and push it back
-	s := CreateSourceStmt{paused, name, sourceType, specs}
-	se := ParsedComponent{_paused.begin, _specs.end, s}
+	s := CreateSourceStmt{paused, name, sourceType, specs, timestampBy, modifier}
+	se := ParsedComponent{_orReplace.begin, _timestampBy.end, s}
 	ps.Push(&se)
 }
 
@@ -191,20 +330,27 @@ func (ps *parseStack) AssembleCreateSource() {
 // assuming they are components of a CREATE SINK statement, and
 // replaces them by a single CreateSinkStmt element.
 //
+//  SchemaAST
 //  SourceSinkSpecsAST
 //  SourceSinkType
 //  StreamIdentifier
+//  BinaryKeyword
+//  BinaryKeyword
 //   =>
-//  CreateSinkStmt{StreamIdentifier, SourceSinkType, SourceSinkSpecsAST}
+//  CreateSinkStmt{StreamIdentifier, SourceSinkType, SourceSinkSpecsAST, SchemaAST,
+//    CreateModifierAST{BinaryKeyword, BinaryKeyword}}
 func (ps *parseStack) AssembleCreateSink() {
-	_specs, _sinkType, _name := ps.pop3()
+	_schema, _specs, _sinkType, _name, _ifNotExists, _orReplace := ps.pop6()
 
+	schema := _schema.comp.(SchemaAST)
 	specs := _specs.comp.(SourceSinkSpecsAST)
 	sinkType := _sinkType.comp.(SourceSinkType)
 	name := _name.comp.(StreamIdentifier)
 
-	s := CreateSinkStmt{name, sinkType, specs}
-	se := ParsedComponent{_name.begin, _specs.end, s}
+	modifier := assembleCreateModifier(_orReplace, _ifNotExists)
+
+	s := CreateSinkStmt{name, sinkType, specs, schema, modifier}
+	se := ParsedComponent{_name.begin, _schema.end, s}
 	ps.Push(&se)
 }
 
@@ -215,20 +361,34 @@ func (ps *parseStack) AssembleCreateSink() {
 //  SourceSinkSpecsAST
 //  SourceSinkType
 //  StreamIdentifier
+//  BinaryKeyword
+//  BinaryKeyword
 //   =>
-//  CreateStateStmt{StreamIdentifier, SourceSinkType, SourceSinkSpecsAST}
+//  CreateStateStmt{StreamIdentifier, SourceSinkType, SourceSinkSpecsAST,
+//    CreateModifierAST{BinaryKeyword, BinaryKeyword}}
 func (ps *parseStack) AssembleCreateState() {
-	_specs, _sinkType, _name := ps.pop3()
+	_specs, _sinkType, _name, _ifNotExists, _orReplace := ps.pop5()
 
 	specs := _specs.comp.(SourceSinkSpecsAST)
 	sinkType := _sinkType.comp.(SourceSinkType)
 	name := _name.comp.(StreamIdentifier)
 
-	s := CreateStateStmt{name, sinkType, specs}
+	modifier := assembleCreateModifier(_orReplace, _ifNotExists)
+
+	s := CreateStateStmt{name, sinkType, specs, modifier}
 	se := ParsedComponent{_name.begin, _specs.end, s}
 	ps.Push(&se)
 }
 
+// assembleCreateModifier converts the components pushed by OrReplaceOpt
+// and IfNotExistsOpt into a CreateModifierAST.
+func assembleCreateModifier(orReplace, ifNotExists *ParsedComponent) CreateModifierAST {
+	return CreateModifierAST{
+		OrReplace:   orReplace.comp.(BinaryKeyword),
+		IfNotExists: ifNotExists.comp.(BinaryKeyword),
+	}
+}
+
 // AssembleUpdateState takes the topmost elements from the stack,
 // assuming they are components of a UPDATE STATE statement, and
 // replaces them by a single UpdateStateStmt element.
@@ -290,18 +450,39 @@ func (ps *parseStack) AssembleUpdateSink() {
 // assuming they are components of a INSERT ... FROM ... statement, and
 // replaces them by a single InsertIntoFromStmt element.
 //
+//  BinaryKeyword
 //  StreamIdentifier
 //  StreamIdentifier
 //   =>
-//  InsertIntoFromStmt{StreamIdentifier, StreamIdentifier}
+//  InsertIntoFromStmt{StreamIdentifier, StreamIdentifier, BinaryKeyword}
 func (ps *parseStack) AssembleInsertIntoFrom() {
-	_input, _sink := ps.pop2()
+	_dryRun, _input, _sink := ps.pop3()
 
+	dryRun := _dryRun.comp.(BinaryKeyword)
 	input := _input.comp.(StreamIdentifier)
 	sink := _sink.comp.(StreamIdentifier)
 
-	s := InsertIntoFromStmt{sink, input}
-	se := ParsedComponent{_sink.begin, _input.end, s}
+	s := InsertIntoFromStmt{sink, input, dryRun}
+	se := ParsedComponent{_sink.begin, _dryRun.end, s}
+	ps.Push(&se)
+}
+
+// AssembleTee takes the topmost elements from the stack, assuming they
+// are components of a TEE ... TO ... statement, and replaces them by a
+// single TeeStmt element.
+//
+//  StreamIdentifier
+//  StreamIdentifier
+//   =>
+//  TeeStmt{StreamIdentifier, StreamIdentifier}
+func (ps *parseStack) AssembleTee() {
+	_sink, _stream := ps.pop2()
+
+	sink := _sink.comp.(StreamIdentifier)
+	stream := _stream.comp.(StreamIdentifier)
+
+	s := TeeStmt{stream, sink}
+	se := ParsedComponent{_stream.begin, _sink.end, s}
 	ps.Push(&se)
 }
 
@@ -356,20 +537,43 @@ func (ps *parseStack) AssembleRewindSource() {
 	ps.Push(&se)
 }
 
+// AssembleReloadSource takes the topmost elements from the stack,
+// assuming they are components of a RELOAD SOURCE statement, and
+// replaces them by a single ReloadSourceStmt element.
+//
+//  StreamIdentifier
+//   =>
+//  ReloadSourceStmt{StreamIdentifier}
+func (ps *parseStack) AssembleReloadSource() {
+	// pop the components from the stack in reverse order
+	_name := ps.Pop()
+
+	name := _name.comp.(StreamIdentifier)
+
+	se := ParsedComponent{_name.begin, _name.end, ReloadSourceStmt{name}}
+	ps.Push(&se)
+}
+
 // AssembleDropSource takes the topmost elements from the stack,
 // assuming they are components of a DROP SOURCE statement, and
 // replaces them by a single DropSourceStmt element.
 //
+//  BinaryKeyword
+//  BinaryKeyword
 //  StreamIdentifier
 //   =>
-//  DropSourceStmt{StreamIdentifier}
+//  DropSourceStmt{StreamIdentifier, DropModifierAST{BinaryKeyword, BinaryKeyword}}
 func (ps *parseStack) AssembleDropSource() {
 	// pop the components from the stack in reverse order
-	_name := ps.Pop()
+	_cascade, _ifExists, _name := ps.pop3()
 
 	name := _name.comp.(StreamIdentifier)
+	modifier := DropModifierAST{
+		IfExists: _ifExists.comp.(BinaryKeyword),
+		Cascade:  _cascade.comp.(BinaryKeyword),
+	}
 
-	se := ParsedComponent{_name.begin, _name.end, DropSourceStmt{name}}
+	se := ParsedComponent{_name.begin, _cascade.end, DropSourceStmt{name, modifier}}
 	ps.Push(&se)
 }
 
@@ -377,16 +581,47 @@ func (ps *parseStack) AssembleDropSource() {
 // assuming they are components of a DROP STREAM statement, and
 // replaces them by a single DropStreamStmt element.
 //
+//  BinaryKeyword
+//  BinaryKeyword
 //  StreamIdentifier
 //   =>
-//  DropStreamStmt{StreamIdentifier}
+//  DropStreamStmt{StreamIdentifier, DropModifierAST{BinaryKeyword, BinaryKeyword}}
 func (ps *parseStack) AssembleDropStream() {
 	// pop the components from the stack in reverse order
-	_name := ps.Pop()
+	_cascade, _ifExists, _name := ps.pop3()
+
+	name := _name.comp.(StreamIdentifier)
+	modifier := DropModifierAST{
+		IfExists: _ifExists.comp.(BinaryKeyword),
+		Cascade:  _cascade.comp.(BinaryKeyword),
+	}
+
+	se := ParsedComponent{_name.begin, _cascade.end, DropStreamStmt{name, modifier}}
+	ps.Push(&se)
+}
 
+// AssembleAlterStream takes the topmost elements from the stack,
+// assuming they are components of an ALTER STREAM statement, and
+// replaces them by a single AlterStreamStmt element.
+//
+//  SheddingOption
+//  NumericLiteral
+//  StreamIdentifier
+//   =>
+//  AlterStreamStmt{StreamIdentifier, NumericLiteral.Value, SheddingOption}
+func (ps *parseStack) AssembleAlterStream() {
+	// pop the components from the stack in reverse order
+	_shedding, _capacity, _name := ps.pop3()
+
+	// extract and convert the contained structure
+	// (if this fails, this is a fundamental parser bug => panic ok)
+	shedding := _shedding.comp.(SheddingOption)
+	capacity := _capacity.comp.(NumericLiteral)
 	name := _name.comp.(StreamIdentifier)
 
-	se := ParsedComponent{_name.begin, _name.end, DropStreamStmt{name}}
+	// assemble the AlterStreamStmt and push it back
+	s := AlterStreamStmt{name, capacity.Value, shedding}
+	se := ParsedComponent{_name.begin, _shedding.end, s}
 	ps.Push(&se)
 }
 
@@ -394,16 +629,18 @@ func (ps *parseStack) AssembleDropStream() {
 // assuming they are components of a DROP SINK statement, and
 // replaces them by a single DropSinkStmt element.
 //
+//  BinaryKeyword
 //  StreamIdentifier
 //   =>
-//  DropSinkStmt{StreamIdentifier}
+//  DropSinkStmt{StreamIdentifier, BinaryKeyword}
 func (ps *parseStack) AssembleDropSink() {
 	// pop the components from the stack in reverse order
-	_name := ps.Pop()
+	_ifExists, _name := ps.pop2()
 
 	name := _name.comp.(StreamIdentifier)
+	ifExists := _ifExists.comp.(BinaryKeyword)
 
-	se := ParsedComponent{_name.begin, _name.end, DropSinkStmt{name}}
+	se := ParsedComponent{_name.begin, _ifExists.end, DropSinkStmt{name, ifExists}}
 	ps.Push(&se)
 }
 
@@ -411,16 +648,18 @@ func (ps *parseStack) AssembleDropSink() {
 // assuming they are components of a DROP STATE statement, and
 // replaces them by a single DropStateStmt element.
 //
+//  BinaryKeyword
 //  StreamIdentifier
 //   =>
-//  DropStateStmt{StreamIdentifier}
+//  DropStateStmt{StreamIdentifier, BinaryKeyword}
 func (ps *parseStack) AssembleDropState() {
 	// pop the components from the stack in reverse order
-	_name := ps.Pop()
+	_ifExists, _name := ps.pop2()
 
 	name := _name.comp.(StreamIdentifier)
+	ifExists := _ifExists.comp.(BinaryKeyword)
 
-	se := ParsedComponent{_name.begin, _name.end, DropStateStmt{name}}
+	se := ParsedComponent{_name.begin, _ifExists.end, DropStateStmt{name, ifExists}}
 	ps.Push(&se)
 }
 
@@ -493,6 +732,87 @@ func (ps *parseStack) AssembleSaveState() {
 	ps.Push(&se)
 }
 
+// AssembleLoadPlugin takes the topmost element from the stack,
+// assuming it is a component of a LOAD PLUGIN statement, and
+// replaces it by a single LoadPluginStmt element.
+//
+//  StringLiteral
+//   =>
+//  LoadPluginStmt{string}
+func (ps *parseStack) AssembleLoadPlugin() {
+	_path := ps.Pop()
+
+	path := _path.comp.(StringLiteral)
+
+	se := ParsedComponent{_path.begin, _path.end, LoadPluginStmt{path.Value}}
+	ps.Push(&se)
+}
+
+// AssembleCreateFunction takes the topmost elements from the stack,
+// assuming they are components of a CREATE FUNCTION statement, and
+// replaces them by a single CreateFunctionStmt element.
+//
+//  Raw
+//  Identifier
+//  FunctionParamsAST
+//  FuncName
+//   =>
+//  CreateFunctionStmt{FuncName, FunctionParamsAST, Identifier, string}
+func (ps *parseStack) AssembleCreateFunction() {
+	// pop the components from the stack in reverse order
+	_body, _lang, _params, _name := ps.Pop(), ps.Pop(), ps.Pop(), ps.Pop()
+
+	body := _body.comp.(Raw)
+	lang := _lang.comp.(Identifier)
+	params := _params.comp.(FunctionParamsAST)
+	name := _name.comp.(FuncName)
+
+	s := CreateFunctionStmt{name, params, lang, body.Expr}
+	se := ParsedComponent{_name.begin, _body.end, s}
+	ps.Push(&se)
+}
+
+// AssembleCreateRemoteFunction takes the topmost elements from the
+// stack, assuming they are components of a CREATE FUNCTION ... TYPE
+// statement, and replaces them by a single CreateRemoteFunctionStmt
+// element.
+//
+//  SourceSinkSpecsAST
+//  Identifier
+//  FuncName
+//   =>
+//  CreateRemoteFunctionStmt{FuncName, Identifier, SourceSinkSpecsAST}
+func (ps *parseStack) AssembleCreateRemoteFunction() {
+	_specs, _type, _name := ps.Pop(), ps.Pop(), ps.Pop()
+
+	specs := _specs.comp.(SourceSinkSpecsAST)
+	typ := _type.comp.(Identifier)
+	name := _name.comp.(FuncName)
+
+	s := CreateRemoteFunctionStmt{name, typ, specs}
+	se := ParsedComponent{_name.begin, _specs.end, s}
+	ps.Push(&se)
+}
+
+// AssembleFunctionParams takes the elements from the stack that
+// correspond to the input[begin:end] string and wraps a new
+// FunctionParamsAST component around them. When the range is empty,
+// i.e. the parameter list is omitted, the function is variadic.
+//
+//  Identifier
+//  Identifier
+//  ...
+//   =>
+//  FunctionParamsAST{[Identifier, Identifier, ...], false}
+func (ps *parseStack) AssembleFunctionParams(begin int, end int) {
+	elems := ps.collectElements(begin, end)
+	params := make([]Identifier, len(elems))
+	for i, elem := range elems {
+		params[i] = elem.(Identifier)
+	}
+	ps.PushComponent(begin, end, FunctionParamsAST{params, begin == end})
+}
+
 // AssembleEval takes the topmost one or two elements from the
 // stack, assuming they are components of an EVAL statement, and
 // replaces them by a single EvalStmt element.
@@ -529,6 +849,97 @@ func (ps *parseStack) AssembleEval(begin, end int) {
 	ps.Push(&se)
 }
 
+// AssembleStatus takes the topmost elements from the stack, assuming
+// they are components of a STATUS OF statement, and replaces them by
+// a single StatusStmt element.
+//
+//  NodeTypeKeyword
+//  StreamIdentifier
+//   =>
+//  StatusStmt{NodeTypeKeyword, StreamIdentifier}
+func (ps *parseStack) AssembleStatus() {
+	_name, _type := ps.pop2()
+
+	nodeType := _type.comp.(NodeTypeKeyword)
+	name := _name.comp.(StreamIdentifier)
+
+	se := ParsedComponent{_type.begin, _name.end, StatusStmt{nodeType, name}}
+	ps.Push(&se)
+}
+
+// AssembleShow takes the topmost element from the stack, assuming
+// it is a component of a SHOW statement, and replaces it by
+// a single ShowStmt element.
+//
+//  NodeTypeKeyword
+//   =>
+//  ShowStmt{NodeTypeKeyword}
+func (ps *parseStack) AssembleShow() {
+	_type := ps.Pop()
+
+	nodeType := _type.comp.(NodeTypeKeyword)
+
+	se := ParsedComponent{_type.begin, _type.end, ShowStmt{nodeType}}
+	ps.Push(&se)
+}
+
+// AssembleDescribe takes the topmost element from the stack, assuming
+// it is a component of a DESCRIBE statement, and replaces it by
+// a single DescribeStmt element.
+//
+//  StreamIdentifier
+//   =>
+//  DescribeStmt{StreamIdentifier}
+func (ps *parseStack) AssembleDescribe() {
+	_name := ps.Pop()
+
+	name := _name.comp.(StreamIdentifier)
+
+	se := ParsedComponent{_name.begin, _name.end, DescribeStmt{name}}
+	ps.Push(&se)
+}
+
+// AssembleShowUDFs pushes a ShowUDFsStmt element to the stack.
+//
+//   =>
+//  ShowUDFsStmt{}
+func (ps *parseStack) AssembleShowUDFs(begin int, end int) {
+	se := ParsedComponent{begin, end, ShowUDFsStmt{}}
+	ps.Push(&se)
+}
+
+// AssembleDescribeFunction takes the topmost element from the stack,
+// assuming it is a component of a DESCRIBE FUNCTION statement, and
+// replaces it by a single DescribeFunctionStmt element.
+//
+//  FuncName
+//   =>
+//  DescribeFunctionStmt{FuncName}
+func (ps *parseStack) AssembleDescribeFunction() {
+	_name := ps.Pop()
+
+	name := _name.comp.(FuncName)
+
+	se := ParsedComponent{_name.begin, _name.end, DescribeFunctionStmt{name}}
+	ps.Push(&se)
+}
+
+// AssembleExplain takes the topmost element from the stack, assuming
+// it is a component of an EXPLAIN statement, and replaces it by
+// a single ExplainStmt element.
+//
+//  SelectStmt
+//   =>
+//  ExplainStmt{SelectStmt}
+func (ps *parseStack) AssembleExplain(begin int, end int) {
+	_select := ps.Pop()
+
+	s := _select.comp.(SelectStmt)
+
+	se := ParsedComponent{begin, end, ExplainStmt{s}}
+	ps.Push(&se)
+}
+
 /* Projections/Columns */
 
 // AssembleEmitter takes the topmost elements from the stack, assuming
@@ -602,7 +1013,28 @@ func (ps *parseStack) AssembleEmitterSampling(samplingType EmitterSamplingType,
 		value = num.Value
 	}
 
-	ps.PushComponent(_value.begin, _value.end, EmitterSampling{value * factor, samplingType})
+	ps.PushComponent(_value.begin, _value.end, EmitterSampling{value * factor, samplingType, UnspecifiedSeed})
+}
+
+// AssembleRandomizedSampling takes the topmost elements from the stack,
+// assuming they are components of a emitter SAMPLE option, and replaces
+// them by a single EmitterSampling element.
+//
+//  NumericLiteral
+//  NumericLiteral or FloatLiteral
+//  ...
+//   =>
+//  EmitterSampling{NumericLiteral or FloatLiteral, RandomizedSampling, NumericLiteral}
+func (ps *parseStack) AssembleRandomizedSampling() {
+	_seed := ps.Pop()
+	seed := _seed.comp.(NumericLiteral)
+
+	ps.AssembleEmitterSampling(RandomizedSampling, 1)
+	_sampling := ps.Pop()
+	sampling := _sampling.comp.(EmitterSampling)
+	sampling.Seed = seed.Value
+
+	ps.PushComponent(_sampling.begin, _sampling.end, sampling)
 }
 
 // AssembleProjections takes the elements from the stack that
@@ -621,7 +1053,25 @@ func (ps *parseStack) AssembleProjections(begin int, end int) {
 		exprs[i] = elems[i].(Expression)
 	}
 	// push the grouped list back
-	ps.PushComponent(begin, end, ProjectionsAST{exprs})
+	ps.PushComponent(begin, end, ProjectionsAST{exprs, false})
+}
+
+// AssembleProjectionsDistinct takes the topmost elements from the stack,
+// assuming they are the components of the projections of a SELECT
+// statement, and sets the Distinct flag of the ProjectionsAST.
+//
+//  ProjectionsAST
+//  BinaryKeyword
+//   =>
+//  ProjectionsAST{Projections, Distinct}
+func (ps *parseStack) AssembleProjectionsDistinct() {
+	_projections, _distinct := ps.pop2()
+
+	projections := _projections.comp.(ProjectionsAST)
+	distinct := _distinct.comp.(BinaryKeyword)
+
+	projections.Distinct = distinct == Yes
+	ps.PushComponent(_distinct.begin, _projections.end, projections)
 }
 
 // AssembleAlias takes the topmost elements from the stack, assuming
@@ -646,14 +1096,18 @@ func (ps *parseStack) AssembleAlias() {
 
 // AssembleWindowedFrom takes the elements from the stack that
 // correspond to the input[begin:end] string, makes sure they are all
-// AliasedStreamWindowAST elements and wraps a WindowedFromAST struct
-// around them. If there are no such elements, adds an
+// AliasedStreamWindowAST or joinedRelationAST elements and wraps a
+// WindowedFromAST struct around them. If there are no such elements, adds an
 // empty WindowedFromAST struct to the stack.
 //
+//  joinedRelationAST
 //  AliasedStreamWindowAST
 //  AliasedStreamWindowAST
 //   =>
-//  WindowedFromAST{[AliasedStreamWindowAST, AliasedStreamWindowAST]}
+//  WindowedFromAST{[AliasedStreamWindowAST, AliasedStreamWindowAST, AliasedStreamWindowAST],
+//    [JoinAST{CrossJoin, nil}, JoinAST]}
+//
+// Joins of WindowedFromAST is nil when there's no joinedRelationAST.
 func (ps *parseStack) AssembleWindowedFrom(begin int, end int) {
 	if begin == end {
 		// push an empty FROM clause
@@ -661,16 +1115,52 @@ func (ps *parseStack) AssembleWindowedFrom(begin int, end int) {
 	} else {
 		elems := ps.collectElements(begin, end)
 		rels := make([]AliasedStreamWindowAST, len(elems), len(elems))
+		joins := make([]JoinAST, 0, len(elems))
+		explicitJoin := false
 		for i, elem := range elems {
 			// (if this conversion fails, this is a fundamental parser bug)
+			if j, ok := elem.(joinedRelationAST); ok {
+				rels[i] = j.AliasedStreamWindowAST
+				joins = append(joins, j.JoinAST)
+				explicitJoin = true
+				continue
+			}
 			e := elem.(AliasedStreamWindowAST)
 			rels[i] = e
+			if i > 0 {
+				joins = append(joins, JoinAST{CrossJoin, nil})
+			}
+		}
+		if !explicitJoin {
+			joins = nil
 		}
 		// push the grouped list back
-		ps.PushComponent(begin, end, WindowedFromAST{rels})
+		ps.PushComponent(begin, end, WindowedFromAST{rels, joins})
 	}
 }
 
+// AssembleJoinedRelation takes the topmost elements from the stack, assuming
+// they are components of a JOIN ... ON clause, and replaces them by a single
+// joinedRelationAST element.
+//
+//  Expression
+//  AliasedStreamWindowAST
+//  JoinType
+//   =>
+//  joinedRelationAST{AliasedStreamWindowAST, JoinAST{JoinType, Expression}}
+func (ps *parseStack) AssembleJoinedRelation() {
+	// pop the components from the stack in reverse order
+	_on, _rel, _type := ps.pop3()
+
+	// extract and convert the contained structure
+	// (if this fails, this is a fundamental parser bug => panic ok)
+	on := _on.comp.(Expression)
+	rel := _rel.comp.(AliasedStreamWindowAST)
+	joinType := _type.comp.(JoinType)
+
+	ps.PushComponent(_type.begin, _on.end, joinedRelationAST{rel, JoinAST{joinType, on}})
+}
+
 // AssembleInterval takes the topmost elements from the stack, assuming
 // they are components of a RANGE clause, and replaces them by
 // a single IntervalAST element.
@@ -703,6 +1193,44 @@ func (ps *parseStack) AssembleInterval() {
 	ps.PushComponent(_num.begin, _unit.end, IntervalAST{FloatLiteral{val}, unit})
 }
 
+// AssembleIntervalLiteral takes the topmost elements from the stack,
+// assuming they are components of an INTERVAL literal, and replaces them by
+// a single IntervalLiteral element. When the interval is invalid or out of
+// range, an error is reported and a zero interval is pushed instead.
+//
+//  IntervalField
+//  NumericLiteral or FloatLiteral
+//  ...
+//  IntervalField
+//  NumericLiteral or FloatLiteral
+//   =>
+//  IntervalLiteral
+// or
+//  IntervalField (optional)
+//  IntervalField
+//  StringLiteral
+//   =>
+//  IntervalLiteral
+func (ps *parseStack) AssembleIntervalLiteral(begin int, end int) {
+	elems := ps.collectElements(begin, end)
+
+	var l IntervalLiteral
+	var err error
+	if str, ok := elems[0].(StringLiteral); ok {
+		to := UnspecifiedIntervalField
+		if len(elems) == 3 {
+			to = elems[2].(IntervalField)
+		}
+		l, err = ParseIntervalString(str.Value, elems[1].(IntervalField), to)
+	} else {
+		l, err = intervalFromComponents(elems)
+	}
+	if err != nil {
+		ps.reportError(begin, err)
+	}
+	ps.PushComponent(begin, end, l)
+}
+
 /* WHERE clause */
 
 // AssembleFilter takes the expression on top of the stack
@@ -778,6 +1306,60 @@ func (ps *parseStack) AssembleHaving(begin int, end int) {
 	}
 }
 
+/* ORDER BY clause */
+
+// AssembleOrderBy takes the elements from the stack that correspond
+// to the input[begin:end] string, makes sure they are all
+// SortedExpressionAST elements and wraps an OrderByAST struct around
+// them. If there are no such elements, adds an empty OrderByAST struct
+// to the stack.
+//
+//  SortedExpressionAST
+//  SortedExpressionAST
+//   =>
+//  OrderByAST{[SortedExpressionAST, SortedExpressionAST]}
+func (ps *parseStack) AssembleOrderBy(begin int, end int) {
+	if begin == end {
+		// push an empty ORDER BY clause
+		ps.PushComponent(begin, end, OrderByAST{})
+		return
+	}
+	elems := ps.collectElements(begin, end)
+	exprs := make([]SortedExpressionAST, len(elems), len(elems))
+	for i := range elems {
+		// (if this conversion fails, this is a fundamental parser bug)
+		exprs[i] = elems[i].(SortedExpressionAST)
+	}
+	// push the grouped list back
+	ps.PushComponent(begin, end, OrderByAST{exprs})
+}
+
+/* LIMIT clause */
+
+// AssembleLimit takes the elements from the stack that correspond
+// to the input[begin:end] string, i.e. the values of LIMIT and
+// OFFSET (if there is a LIMIT clause), and wraps a LimitAST struct
+// around them. If there is no LIMIT clause, an empty LimitAST
+// struct is used.
+//
+//  NumericLiteral (OFFSET, optional)
+//  NumericLiteral (LIMIT)
+//   =>
+//  LimitAST{true, NumericLiteral, NumericLiteral}
+func (ps *parseStack) AssembleLimit(begin int, end int) {
+	elems := ps.collectElements(begin, end)
+	l := LimitAST{}
+	if len(elems) > 0 {
+		// (if this conversion fails, this is a fundamental parser bug)
+		l.HasLimit = true
+		l.Limit = elems[0].(NumericLiteral).Value
+		if len(elems) > 1 {
+			l.Offset = elems[1].(NumericLiteral).Value
+		}
+	}
+	ps.PushComponent(begin, end, l)
+}
+
 // AssembleAliasedStreamWindow takes the topmost elements from the stack, assuming
 // they are components of an AS clause, and replaces them by
 // a single AliasedStreamWindowAST element.
@@ -819,21 +1401,27 @@ func (ps *parseStack) EnsureAliasedStreamWindow() {
 // they are components of an AS clause, and replaces them by
 // a single StreamWindowAST element.
 //
-//  IntervalAST
+//  SheddingOption
+//  CapacityUnit
+//  NumericLiteral
+//  IntervalAST (SLIDE)
+//  IntervalAST (RANGE)
 //  Stream
 //   =>
-//  StreamWindowAST{Stream, IntervalAST}
+//  StreamWindowAST{Stream, IntervalAST, NumericLiteral, SheddingOption, CapacityUnit, IntervalAST}
 func (ps *parseStack) AssembleStreamWindow() {
 	// pop the components from the stack in reverse order
-	_shedding, _capacity, _range, _rel := ps.pop4()
+	_shedding, _unit, _capacity, _slide, _range, _rel := ps.pop6()
 
 	rel := _rel.comp.(Stream)
 	rangeAst := _range.comp.(IntervalAST)
+	slide := _slide.comp.(IntervalAST)
 	capacity := _capacity.comp.(NumericLiteral)
+	unit := _unit.comp.(CapacityUnit)
 	shedding := _shedding.comp.(SheddingOption)
 
 	ps.PushComponent(_rel.begin, _shedding.end, StreamWindowAST{rel, rangeAst,
-		capacity.Value, shedding})
+		capacity.Value, shedding, unit, slide})
 }
 
 // AssembleUDSFFuncApp takes the topmost elements from the stack,
@@ -843,16 +1431,218 @@ func (ps *parseStack) AssembleStreamWindow() {
 //  FuncAppAST{Function, ExpressionsAST}
 //   =>
 //  Stream{UDSFStream, Function, ExpressionAST.Expressions}
+//
+// Named arguments are kept in Params as NamedArgAST elements. They must
+// follow all positional arguments and have distinct names.
 func (ps *parseStack) AssembleUDSFFuncApp() {
 	_fun := ps.Pop()
 
 	fun := _fun.comp.(FuncAppAST)
+	if fun.Distinct {
+		ps.reportError(_fun.begin, errors.New("DISTINCT cannot be used in a UDSF"))
+	}
+	named := map[string]bool{}
+	for _, expr := range fun.Expressions {
+		arg, ok := expr.(NamedArgAST)
+		if !ok {
+			if len(named) > 0 {
+				ps.reportError(_fun.begin, errors.New("a positional argument cannot follow named arguments"))
+				break
+			}
+			continue
+		}
+		if named[arg.Name] {
+			ps.reportError(_fun.begin, fmt.Errorf("argument '%v' is given more than once", arg.Name))
+			break
+		}
+		named[arg.Name] = true
+	}
 
 	se := ParsedComponent{_fun.begin, _fun.end,
-		Stream{UDSFStream, string(fun.Function), fun.Expressions}}
+		Stream{UDSFStream, string(fun.Function), fun.Expressions, nil}}
 	ps.Push(&se)
 }
 
+// AssembleDroppedTuplesStream takes the topmost element from the stack,
+// assuming it is the stream of a DROPPED TUPLES clause, and replaces it by
+// a Stream element of tuples dropped by the stream.
+//
+//  Stream{ActualStream, Name, nil}
+//   =>
+//  Stream{DroppedTuplesStream, Name, nil}
+func (ps *parseStack) AssembleDroppedTuplesStream() {
+	_stream := ps.Pop()
+
+	stream := _stream.comp.(Stream)
+	if stream.Type != ActualStream {
+		ps.reportError(_stream.begin, errors.New("DROPPED TUPLES can only be used with the name of a node"))
+	}
+
+	se := ParsedComponent{_stream.begin, _stream.end,
+		Stream{DroppedTuplesStream, stream.Name, nil, nil}}
+	ps.Push(&se)
+}
+
+// AssembleMatchRecognize takes the topmost elements from the stack,
+// assuming they are components of a MATCH_RECOGNIZE clause, and replaces
+// them by a single Stream element.
+//
+//  []MatchDefineAST
+//  []MatchPatternElemAST
+//  ExpressionsAST
+//  ExpressionsAST
+//  Stream{ActualStream, Name, nil, nil}
+//   =>
+//  Stream{MatchRecognizeStream, Name, nil, &MatchRecognizeAST{...}}
+func (ps *parseStack) AssembleMatchRecognize() {
+	_define, _pattern, _measures, _partition, _stream := ps.pop5()
+
+	stream := _stream.comp.(Stream)
+	if stream.Type != ActualStream {
+		ps.reportError(_stream.begin, errors.New("MATCH_RECOGNIZE can only be used with the name of a stream"))
+	}
+	partition := _partition.comp.(ExpressionsAST)
+	measures := _measures.comp.(ExpressionsAST)
+	pattern := _pattern.comp.([]MatchPatternElemAST)
+	define := _define.comp.([]MatchDefineAST)
+
+	mr := &MatchRecognizeAST{
+		PartitionBy: partition.Expressions,
+		Measures:    measures.Expressions,
+		Pattern:     pattern,
+		Define:      define,
+	}
+	ps.PushComponent(_stream.begin, _define.end,
+		Stream{MatchRecognizeStream, stream.Name, nil, mr})
+}
+
+// AssembleMatchPatternElem pushes a pattern variable of a PATTERN clause
+// with its quantifier given as s, e.g. `b+` or `c{2,3}`, to the stack.
+//
+//   =>
+//  MatchPatternElemAST
+func (ps *parseStack) AssembleMatchPatternElem(begin int, end int, s string) {
+	i := strings.IndexAny(s, "?*+{")
+	if i < 0 {
+		ps.PushComponent(begin, end, MatchPatternElemAST{s, 1, 1})
+		return
+	}
+
+	elem := MatchPatternElemAST{Var: s[:i]}
+	switch q := s[i:]; q {
+	case "?":
+		elem.Min, elem.Max = 0, 1
+	case "*":
+		elem.Min, elem.Max = 0, -1
+	case "+":
+		elem.Min, elem.Max = 1, -1
+	default:
+		bound := func(b string, def int64) int64 {
+			b = strings.TrimSpace(b)
+			if b == "" {
+				return def
+			}
+			n, err := strconv.ParseInt(b, 10, 64)
+			if err != nil {
+				ps.reportError(begin, fmt.Errorf("invalid quantifier %v: %v", q, err))
+				return def
+			}
+			return n
+		}
+		bounds := strings.Split(strings.Trim(q, "{}"), ",")
+		if len(bounds) == 1 {
+			if strings.TrimSpace(bounds[0]) == "" {
+				ps.reportError(begin, errors.New("a quantifier must have a bound"))
+			}
+			elem.Min = bound(bounds[0], 0)
+			elem.Max = elem.Min
+		} else {
+			elem.Min = bound(bounds[0], 0)
+			elem.Max = bound(bounds[1], -1)
+		}
+	}
+	if elem.Max == 0 || (elem.Max > 0 && elem.Max < elem.Min) {
+		ps.reportError(begin, fmt.Errorf("invalid quantifier of pattern variable '%v'", elem.Var))
+	}
+	ps.PushComponent(begin, end, elem)
+}
+
+// AssembleMatchPattern takes the MatchPatternElemAST elements from the stack
+// that correspond to the input[begin:end] string and replaces them by a
+// slice of them.
+//
+//  MatchPatternElemAST
+//  MatchPatternElemAST
+//   =>
+//  []MatchPatternElemAST
+func (ps *parseStack) AssembleMatchPattern(begin int, end int) {
+	elems := ps.collectElements(begin, end)
+	pattern := make([]MatchPatternElemAST, len(elems))
+	for i := range elems {
+		pattern[i] = elems[i].(MatchPatternElemAST)
+	}
+	ps.PushComponent(begin, end, pattern)
+}
+
+// AssembleMatchDefine takes the topmost elements from the stack, assuming
+// they are components of a definition in a DEFINE clause, and replaces
+// them by a single MatchDefineAST element.
+//
+//  Expression
+//  Identifier
+//   =>
+//  MatchDefineAST{Identifier, Expression}
+func (ps *parseStack) AssembleMatchDefine() {
+	_cond, _name := ps.pop2()
+
+	name := _name.comp.(Identifier)
+	cond := _cond.comp.(Expression)
+
+	ps.PushComponent(_name.begin, _cond.end, MatchDefineAST{string(name), cond})
+}
+
+// AssembleMatchDefines takes the MatchDefineAST elements from the stack
+// that correspond to the input[begin:end] string and replaces them by a
+// slice of them. If there's no DEFINE clause, it pushes a nil slice.
+//
+//  []MatchPatternElemAST
+//  MatchDefineAST
+//  MatchDefineAST
+//   =>
+//  []MatchPatternElemAST
+//  []MatchDefineAST
+//
+// A pattern variable cannot be defined more than once or be defined
+// without appearing in the pattern, which is the element below the
+// definitions.
+func (ps *parseStack) AssembleMatchDefines(begin int, end int) {
+	var elems []*ParsedComponent
+	for ps.Peek() != nil && ps.Peek().end > begin {
+		elems = append([]*ParsedComponent{ps.Pop()}, elems...)
+	}
+
+	vars := map[string]bool{}
+	if top := ps.Peek(); top != nil {
+		for _, p := range top.comp.([]MatchPatternElemAST) {
+			vars[p.Var] = true
+		}
+	}
+	var defines []MatchDefineAST
+	defined := map[string]bool{}
+	for _, e := range elems {
+		d := e.comp.(MatchDefineAST)
+		if !vars[d.Var] {
+			ps.reportError(e.begin, fmt.Errorf("pattern variable '%v' is defined but not used in the pattern", d.Var))
+		}
+		if defined[d.Var] {
+			ps.reportError(e.begin, fmt.Errorf("pattern variable '%v' is defined more than once", d.Var))
+		}
+		defined[d.Var] = true
+		defines = append(defines, d)
+	}
+	ps.PushComponent(begin, end, defines)
+}
+
 // EnsureCapacitySpec makes sure that the top element of the stack
 // is a NumericLiteral element.
 func (ps *parseStack) EnsureCapacitySpec(begin int, end int) {
@@ -870,6 +1660,77 @@ func (ps *parseStack) EnsureCapacitySpec(begin int, end int) {
 	}
 }
 
+// EnsureWindowCapacitySpec makes sure that the top elements of the stack
+// are a NumericLiteral and a CapacityUnit element.
+func (ps *parseStack) EnsureWindowCapacitySpec(begin int, end int) {
+	top := ps.Peek()
+	if top == nil || top.end <= begin {
+		// there is no item in the given range
+		ps.PushComponent(begin, end, NumericLiteral{UnspecifiedCapacity})
+		ps.PushComponent(begin, end, TupleCapacity)
+	} else {
+		// there is an item in the given range
+		_, ok := top.comp.(CapacityUnit)
+		if !ok {
+			panic(fmt.Sprintf("begin (%d) != end (%d), but there "+
+				"was a %T on the stack", begin, end, top.comp))
+		}
+	}
+}
+
+// EnsureCapacityUnit makes sure that the top element of the stack
+// is a CapacityUnit element.
+func (ps *parseStack) EnsureCapacityUnit(begin int, end int) {
+	top := ps.Peek()
+	if top == nil || top.end <= begin {
+		// there is no item in the given range
+		ps.PushComponent(begin, end, TupleCapacity)
+	} else {
+		// there is an item in the given range
+		_, ok := top.comp.(CapacityUnit)
+		if !ok {
+			panic(fmt.Sprintf("begin (%d) != end (%d), but there "+
+				"was a %T on the stack", begin, end, top.comp))
+		}
+	}
+}
+
+// EnsureSamplingSeed makes sure that the top element of the stack
+// is a NumericLiteral element.
+func (ps *parseStack) EnsureSamplingSeed(begin int, end int) {
+	top := ps.Peek()
+	if top == nil || top.end <= begin {
+		// there is no item in the given range
+		ps.PushComponent(begin, end, NumericLiteral{UnspecifiedSeed})
+	} else {
+		// there is an item in the given range
+		_, ok := top.comp.(NumericLiteral)
+		if !ok {
+			panic(fmt.Sprintf("begin (%d) != end (%d), but there "+
+				"was a %T on the stack", begin, end, top.comp))
+		}
+	}
+}
+
+// EnsureSlideSpec makes sure that the top element of the stack
+// is an IntervalAST element of the SLIDE interval. An IntervalAST
+// having UnspecifiedIntervalUnit is pushed when there's no SLIDE
+// interval.
+func (ps *parseStack) EnsureSlideSpec(begin int, end int) {
+	top := ps.Peek()
+	if top == nil || top.end <= begin {
+		// there is no item in the given range
+		ps.PushComponent(begin, end, IntervalAST{})
+	} else {
+		// there is an item in the given range
+		_, ok := top.comp.(IntervalAST)
+		if !ok {
+			panic(fmt.Sprintf("begin (%d) != end (%d), but there "+
+				"was a %T on the stack", begin, end, top.comp))
+		}
+	}
+}
+
 // EnsureSheddingSpec makes sure that the top element of the stack
 // is a SheddingOption element.
 func (ps *parseStack) EnsureSheddingSpec(begin int, end int) {
@@ -915,6 +1776,65 @@ func (ps *parseStack) AssembleSourceSinkSpecs(begin int, end int) {
 	}
 }
 
+// AssembleSchema takes the elements from the stack that correspond
+// to the input[begin:end] string and replaces them by a single
+// SchemaAST element. If begin == end, i.e., no SCHEMA clause was
+// given, an empty SchemaAST is pushed.
+//
+//  SchemaColumnAST
+//  SchemaColumnAST
+//  ...
+//   =>
+//  SchemaAST{[SchemaColumnAST, SchemaColumnAST, ...]}
+func (ps *parseStack) AssembleSchema(begin int, end int) {
+	if begin == end {
+		ps.PushComponent(begin, end, SchemaAST{})
+		return
+	}
+	elems := ps.collectElements(begin, end)
+	columns := make([]SchemaColumnAST, len(elems))
+	for i, elem := range elems {
+		// (if this conversion fails, this is a fundamental parser bug)
+		columns[i] = elem.(SchemaColumnAST)
+	}
+	ps.PushComponent(begin, end, SchemaAST{columns})
+}
+
+// AssembleTimestampBy takes the topmost element from the stack that
+// corresponds to the input[begin:end] string and replaces it by a
+// TimestampByAST element. If begin == end, i.e., no WITH TIMESTAMP BY
+// clause was given, an empty TimestampByAST is pushed.
+//
+//  Expression
+//   =>
+//  TimestampByAST{Expression}
+func (ps *parseStack) AssembleTimestampBy(begin int, end int) {
+	if begin == end {
+		ps.PushComponent(begin, end, TimestampByAST{})
+		return
+	}
+	_expr := ps.Pop()
+	expr := _expr.comp.(Expression)
+	ps.PushComponent(begin, end, TimestampByAST{expr})
+}
+
+// AssembleSchemaColumn takes the topmost elements from the stack,
+// assuming they are part of a SCHEMA clause and replaces them by a
+// single SchemaColumnAST element.
+//
+//  Type
+//  Identifier
+//   =>
+//  SchemaColumnAST{Identifier, Type}
+func (ps *parseStack) AssembleSchemaColumn() {
+	_type, _name := ps.pop2()
+
+	typ := _type.comp.(Type)
+	name := _name.comp.(Identifier)
+
+	ps.PushComponent(_name.begin, _type.end, SchemaColumnAST{name, typ})
+}
+
 // AssembleSourceSinkParam takes the topmost elements from the
 // stack, assuming they are part of a WITH clause in a CREATE SOURCE
 // statement and replaces them by a single SourceSinkParamAST element.
@@ -922,45 +1842,68 @@ func (ps *parseStack) AssembleSourceSinkSpecs(begin int, end int) {
 //  Any
 //  SourceSinkParamKey
 //   =>
-//  SourceSinkParamAST{SourceSinkParamKey, data.Value}
+//  SourceSinkParamAST{SourceSinkParamKey, data.Value, nil}
+//
+// When the value is an EnvParamAST, it's stored in Env instead of Value.
 func (ps *parseStack) AssembleSourceSinkParam() {
 	_value, _key := ps.pop2()
 
-	var toValue func(obj interface{}) data.Value
-	toValue = func(obj interface{}) data.Value {
-		var value data.Value
-		switch lit := obj.(type) {
-		default:
-			panic(fmt.Sprintf("cannot deal with a %T here", lit))
-		case StringLiteral:
-			value = data.String(lit.Value)
-		case BoolLiteral:
-			value = data.Bool(lit.Value)
-		case NumericLiteral:
-			value = data.Int(lit.Value)
-		case FloatLiteral:
-			value = data.Float(lit.Value)
-		case ArrayAST:
-			arr := make(data.Array, len(lit.Expressions))
-			for i, item := range lit.Expressions {
-				arr[i] = toValue(item)
-			}
-			value = arr
-		case MapAST:
-			m := data.Map{}
-			for _, item := range lit.Entries {
-				m[item.Key] = toValue(item.Value)
-			}
-			value = m
-		}
-		return value
+	key := _key.comp.(SourceSinkParamKey)
+	var ss SourceSinkParamAST
+	if env, ok := _value.comp.(EnvParamAST); ok {
+		ss = SourceSinkParamAST{key, nil, &env}
+	} else {
+		ss = SourceSinkParamAST{key, paramLiteralToValue(_value.comp), nil}
 	}
+	ps.PushComponent(_key.begin, _value.end, ss)
+}
 
-	value := toValue(_value.comp)
-	key := _key.comp.(SourceSinkParamKey)
+// paramLiteralToValue converts a literal used as a parameter value into
+// a data.Value.
+func paramLiteralToValue(obj interface{}) data.Value {
+	var value data.Value
+	switch lit := obj.(type) {
+	default:
+		panic(fmt.Sprintf("cannot deal with a %T here", lit))
+	case StringLiteral:
+		value = data.String(lit.Value)
+	case BoolLiteral:
+		value = data.Bool(lit.Value)
+	case NumericLiteral:
+		value = data.Int(lit.Value)
+	case FloatLiteral:
+		value = data.Float(lit.Value)
+	case ArrayAST:
+		arr := make(data.Array, len(lit.Expressions))
+		for i, item := range lit.Expressions {
+			arr[i] = paramLiteralToValue(item)
+		}
+		value = arr
+	case MapAST:
+		m := data.Map{}
+		for _, item := range lit.Entries {
+			m[item.Key] = paramLiteralToValue(item.Value)
+		}
+		value = m
+	}
+	return value
+}
 
-	ss := SourceSinkParamAST{key, value}
-	ps.PushComponent(_key.begin, _value.end, ss)
+// AssembleEnvParam takes the topmost elements from the stack, assuming
+// they are the arguments of env(...) in a WITH clause, and replaces them
+// by a single EnvParamAST element.
+//
+//  Any (optional)
+//  StringLiteral
+//   =>
+//  EnvParamAST{string, data.Value}
+func (ps *parseStack) AssembleEnvParam(begin int, end int) {
+	elems := ps.collectElements(begin, end)
+	env := EnvParamAST{Name: elems[0].(StringLiteral).Value}
+	if len(elems) == 2 {
+		env.Default = paramLiteralToValue(elems[1])
+	}
+	ps.PushComponent(begin, end, env)
 }
 
 // EnsureIdentifier makes sure that the top element of the stack
@@ -1048,6 +1991,27 @@ func (ps *parseStack) AssembleBinaryOperation(begin int, end int) {
 	}
 }
 
+// AssembleLikePattern takes the two elements from the stack that
+// correspond to the input[begin:end] string and replaces them by
+// a single LikePatternAST element. An error is reported when the
+// escape character isn't a single character.
+//
+//  Any
+//  StringLiteral
+//   =>
+//  LikePatternAST{Any, StringLiteral}
+func (ps *parseStack) AssembleLikePattern(begin int, end int) {
+	elems := ps.collectElements(begin, end)
+	if len(elems) != 2 {
+		panic(fmt.Sprintf("cannot turn %+v into a LIKE pattern", elems))
+	}
+	escape := elems[1].(StringLiteral)
+	if utf8.RuneCountInString(escape.Value) != 1 {
+		ps.reportError(begin, fmt.Errorf("the escape character of LIKE must be a single character: %v", escape))
+	}
+	ps.PushComponent(begin, end, LikePatternAST{elems[0].(Expression), escape})
+}
+
 // AssembleUnaryPrefixOperation takes the two elements from the stack that
 // correspond to the input[begin:end] string and adds the given
 // unary operator. If there is just one element, push it back unmodified.
@@ -1108,16 +2072,18 @@ func (ps *parseStack) AssembleTypeCast(begin int, end int) {
 //
 //  ExpressionsAST
 //  ExpressionsAST
+//  BinaryKeyword
 //  FuncName
 //   =>
-//  FuncAppAST{FuncName, ExpressionsAST}
+//  FuncAppAST{FuncName, ExpressionsAST, Ordering, Distinct}
 func (ps *parseStack) AssembleFuncApp() {
-	_ordering, _exprs, _funcName := ps.pop3()
+	_ordering, _exprs, _distinct, _funcName := ps.pop4()
 
 	// extract and convert the contained structure
 	// (if this fails, this is a fundamental parser bug => panic ok)
 	ordering := _ordering.comp.(ExpressionsAST)
 	exprs := _exprs.comp.(ExpressionsAST)
+	distinct := _distinct.comp.(BinaryKeyword)
 	funcName := _funcName.comp.(FuncName)
 
 	orderExprs := make([]SortedExpressionAST, len(ordering.Expressions))
@@ -1129,7 +2095,43 @@ func (ps *parseStack) AssembleFuncApp() {
 	}
 
 	// assemble the FuncAppAST and push it back
-	ps.PushComponent(_funcName.begin, _exprs.end, FuncAppAST{funcName, exprs, orderExprs})
+	ps.PushComponent(_funcName.begin, _exprs.end, FuncAppAST{funcName, exprs, orderExprs,
+		distinct == Yes, nil})
+}
+
+// AssembleFuncFilter takes the topmost elements from the stack, assuming
+// they are components of a function application followed by a FILTER
+// clause, and replaces them by a single FuncAppAST element.
+//
+//  Expression
+//  FuncAppAST{FuncName, ExpressionsAST, Ordering, Distinct, nil}
+//   =>
+//  FuncAppAST{FuncName, ExpressionsAST, Ordering, Distinct, Expression}
+func (ps *parseStack) AssembleFuncFilter() {
+	_cond, _fun := ps.pop2()
+
+	cond := _cond.comp.(Expression)
+	fun := _fun.comp.(FuncAppAST)
+	fun.Filter = cond
+
+	ps.PushComponent(_fun.begin, _cond.end, fun)
+}
+
+// AssembleNamedArg takes the topmost elements from the stack, assuming
+// they are components of a named argument of a function application,
+// and replaces them by a single NamedArgAST element.
+//
+//  Expression
+//  Identifier
+//   =>
+//  NamedArgAST{Identifier, Expression}
+func (ps *parseStack) AssembleNamedArg() {
+	_expr, _name := ps.pop2()
+
+	expr := _expr.comp.(Expression)
+	name := _name.comp.(Identifier)
+
+	ps.PushComponent(_name.begin, _expr.end, NamedArgAST{string(name), expr})
 }
 
 // AssembleSortedExpression takes the topmost elements from the stack,
@@ -1192,14 +2194,25 @@ func (ps *parseStack) AssembleMap(begin int, end int) {
 //  Expression
 //  StringLiteral
 //   =>
-//  KeyValuePairAST{string, Expression}
+//  KeyValuePairAST{string, Expression, nil}
+// or
+//  Expression
+//  Expression
+//   =>
+//  KeyValuePairAST{"", Expression, Expression}
 func (ps *parseStack) AssembleKeyValuePair() {
 	_expr, _key := ps.pop2()
 
 	expr := _expr.comp.(Expression)
-	key := _key.comp.(StringLiteral).Value
+	pair := KeyValuePairAST{Value: expr}
+	if key, ok := _key.comp.(StringLiteral); ok {
+		pair.Key = key.Value
+	} else {
+		// a computed key
+		pair.KeyExpr = _key.comp.(Expression)
+	}
 
-	ps.PushComponent(_key.begin, _expr.end, KeyValuePairAST{key, expr})
+	ps.PushComponent(_key.begin, _expr.end, pair)
 }
 
 // AssembleConditionCase takes the elements from the stack that
@@ -0,0 +1,171 @@
+package bql
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"plugin"
+)
+
+// openPlugin opens a Go plugin. Its init functions are expected to register
+// UDFs, UDSFs, UDSs, sources, or sinks to the global registries. It's a
+// variable so that tests can replace it.
+var openPlugin = func(path string) error {
+	_, err := plugin.Open(path)
+	return err
+}
+
+// LoadPlugin loads a Go plugin built with "go build -buildmode=plugin".
+// A plugin registers its components from its init functions in the same way
+// as a plugin linked to the sensorbee command does:
+//
+//	func init() {
+//		udf.MustRegisterGlobalUDF("my_func", udf.MustConvertGeneric(myFunc))
+//		bql.MustRegisterGlobalSourceCreator("my_source", &MySourceCreator{})
+//	}
+//
+// Components registered by the plugin are only visible to topologies created
+// after the plugin was loaded. Use TopologyBuilder.LoadPlugin to make them
+// visible to an existing topology. Loading the same plugin more than once
+// has no effect.
+//
+// Go plugins are only supported on some platforms and require cgo. Because
+// a plugin cannot be unloaded, LoadPlugin should only be given a path to a
+// trusted file.
+func LoadPlugin(path string) error {
+	if path == "" {
+		return fmt.Errorf("the path to a plugin must not be empty")
+	}
+	if err := openPlugin(path); err != nil {
+		return fmt.Errorf("cannot load the plugin '%v': %v", path, err)
+	}
+	return nil
+}
+
+// LoadPlugin loads a Go plugin by the package level LoadPlugin and imports
+// components registered to the global registries by the plugin into the
+// registries of the TopologyBuilder. Components which have the same name as
+// ones already in the TopologyBuilder's registries aren't imported.
+func (tb *TopologyBuilder) LoadPlugin(path string) error {
+	if err := LoadPlugin(path); err != nil {
+		return err
+	}
+	return tb.importGlobalComponents()
+}
+
+// importGlobalComponents imports components in the global registries which
+// the registries of the TopologyBuilder don't have.
+func (tb *TopologyBuilder) importGlobalComponents() error {
+	if _, err := udf.ImportGlobalUDFs(tb.Reg); err != nil {
+		return err
+	}
+
+	udsfs, err := udf.CopyGlobalUDSFCreatorRegistry()
+	if err != nil {
+		return err
+	}
+	if err := importUDSFCreators(tb.UDSFCreators, udsfs); err != nil {
+		return err
+	}
+
+	udss, err := udf.CopyGlobalUDSCreatorRegistry()
+	if err != nil {
+		return err
+	}
+	if err := importUDSCreators(tb.UDSCreators, udss); err != nil {
+		return err
+	}
+
+	srcs, err := CopyGlobalSourceCreatorRegistry()
+	if err != nil {
+		return err
+	}
+	if err := importSourceCreators(tb.SourceCreators, srcs); err != nil {
+		return err
+	}
+
+	sinks, err := CopyGlobalSinkCreatorRegistry()
+	if err != nil {
+		return err
+	}
+	return importSinkCreators(tb.SinkCreators, sinks)
+}
+
+func importUDSFCreators(dst, src udf.UDSFCreatorRegistry) error {
+	existing, err := dst.List()
+	if err != nil {
+		return err
+	}
+	m, err := src.List()
+	if err != nil {
+		return err
+	}
+	for t, c := range m {
+		if _, ok := existing[t]; ok {
+			continue
+		}
+		if err := dst.Register(t, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func importUDSCreators(dst, src udf.UDSCreatorRegistry) error {
+	existing, err := dst.List()
+	if err != nil {
+		return err
+	}
+	m, err := src.List()
+	if err != nil {
+		return err
+	}
+	for t, c := range m {
+		if _, ok := existing[t]; ok {
+			continue
+		}
+		if err := dst.Register(t, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func importSourceCreators(dst, src SourceCreatorRegistry) error {
+	existing, err := dst.List()
+	if err != nil {
+		return err
+	}
+	m, err := src.List()
+	if err != nil {
+		return err
+	}
+	for t, c := range m {
+		if _, ok := existing[t]; ok {
+			continue
+		}
+		if err := dst.Register(t, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func importSinkCreators(dst, src SinkCreatorRegistry) error {
+	existing, err := dst.List()
+	if err != nil {
+		return err
+	}
+	m, err := src.List()
+	if err != nil {
+		return err
+	}
+	for t, c := range m {
+		if _, ok := existing[t]; ok {
+			continue
+		}
+		if err := dst.Register(t, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package bql
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"testing"
+)
+
+func TestLoadPluginStmt(t *testing.T) {
+	open := openPlugin
+	defer func() {
+		openPlugin = open
+	}()
+
+	// the global UDF registry doesn't support unregistration
+	var registerUDF sync.Once
+	openPlugin = func(path string) error {
+		if path != "test_plugin.so" {
+			return errors.New("no such file")
+		}
+		registerUDF.Do(func() {
+			udf.MustRegisterGlobalUDF("plugin_test_func", udf.MustConvertGeneric(func() int {
+				return 1
+			}))
+		})
+		return RegisterGlobalSourceCreator("plugin_test_source", SourceCreatorFunc(createDummySource))
+	}
+
+	Convey("Given a BQL TopologyBuilder", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+			globalSourceCreatorRegistry.Unregister("plugin_test_source")
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		Convey("When loading a plugin", func() {
+			err := addBQLToTopology(tb, `LOAD PLUGIN "test_plugin.so"`)
+			So(err, ShouldBeNil)
+
+			Convey("Then the UDF registered by the plugin should be available", func() {
+				f, err := tb.Reg.Lookup("plugin_test_func", 0)
+				So(err, ShouldBeNil)
+				v, err := f.Call(nil)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(1))
+			})
+
+			Convey("Then the source type registered by the plugin should be available", func() {
+				So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE plugin_test_source`), ShouldBeNil)
+			})
+
+			Convey("Then another topology should see the components", func() {
+				dt2 := newTestTopology()
+				defer dt2.Stop()
+				tb2, err := NewTopologyBuilder(dt2)
+				So(err, ShouldBeNil)
+				_, err = tb2.SourceCreators.Lookup("plugin_test_source")
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When a plugin has a component already in the topology", func() {
+			So(tb.SourceCreators.Register("plugin_test_source", SourceCreatorFunc(createDummySource)), ShouldBeNil)
+			err := addBQLToTopology(tb, `LOAD PLUGIN "test_plugin.so"`)
+
+			Convey("Then it should succeed", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When loading a nonexistent plugin", func() {
+			err := addBQLToTopology(tb, `LOAD PLUGIN "no_such_plugin.so"`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "no_such_plugin.so")
+			})
+		})
+
+		Convey("When loading a plugin with an empty path", func() {
+			err := addBQLToTopology(tb, `LOAD PLUGIN ""`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a registry which already has UDFs", t, func() {
+		reg := udf.CopyGlobalUDFRegistry(core.NewContext(nil))
+
+		Convey("When importing global UDFs", func() {
+			imported, err := udf.ImportGlobalUDFs(reg)
+
+			Convey("Then nothing should be imported", func() {
+				So(err, ShouldBeNil)
+				So(imported, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package bql
+
+import (
+	"errors"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"time"
+)
+
+// reconnector keeps a source receiving messages from a server. It calls a
+// function connecting to the server again with exponential backoff when the
+// connection is lost. Sources receiving messages over a connection embed it
+// and close stopCh to stop.
+type reconnector struct {
+	nodeName    string
+	minInterval time.Duration
+	maxInterval time.Duration
+	stopCh      chan struct{}
+
+	rm         sync.Mutex
+	connected  bool
+	reconnects int64
+}
+
+func newReconnector(ioParams *IOParams, minInterval, maxInterval time.Duration) (*reconnector, error) {
+	if minInterval <= 0 || maxInterval < minInterval {
+		return nil, errors.New("reconnect intervals must satisfy 0 < min_reconnect_interval <= max_reconnect_interval")
+	}
+	return &reconnector{
+		nodeName:    ioParams.Name,
+		minInterval: minInterval,
+		maxInterval: maxInterval,
+		stopCh:      make(chan struct{}),
+	}, nil
+}
+
+// run calls connect until it returns nil or core.ErrSourceStopped, or until
+// stopCh is closed. connect emits tuples until the connection is lost and
+// returns whether it has connected to the server so that the interval is
+// reset. It should return nil when stopCh is closed. msg is logged with the
+// error every time connect fails.
+func (r *reconnector) run(ctx *core.Context, msg string, connect func() (bool, error)) error {
+	interval := r.minInterval
+	for first := true; ; first = false {
+		if !first {
+			r.rm.Lock()
+			r.reconnects++
+			r.rm.Unlock()
+		}
+		connected, err := connect()
+		if err == nil || err == core.ErrSourceStopped {
+			return err
+		}
+		if connected {
+			interval = r.minInterval
+		}
+		ctx.ErrLog(err).WithField("node_name", r.nodeName).
+			WithField("retry_after", interval.String()).
+			Warning(msg)
+
+		select {
+		case <-r.stopCh:
+			return nil
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > r.maxInterval {
+			interval = r.maxInterval
+		}
+	}
+}
+
+func (r *reconnector) setConnected(b bool) {
+	r.rm.Lock()
+	defer r.rm.Unlock()
+	r.connected = b
+}
+
+// status returns "connected" and "reconnects" fields. A source adds its own
+// fields to the map.
+func (r *reconnector) status() data.Map {
+	r.rm.Lock()
+	defer r.rm.Unlock()
+	return data.Map{
+		"connected":  data.Bool(r.connected),
+		"reconnects": data.Int(r.reconnects),
+	}
+}
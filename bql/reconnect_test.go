@@ -0,0 +1,63 @@
+package bql
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"testing"
+	"time"
+)
+
+func TestReconnector(t *testing.T) {
+	Convey("Given a reconnector", t, func() {
+		ctx := core.NewContext(nil)
+		r, err := newReconnector(&IOParams{Name: "reconnect_test"}, time.Millisecond, 2*time.Millisecond)
+		So(err, ShouldBeNil)
+
+		Convey("When connect fails temporarily", func() {
+			n := 0
+			err := r.run(ctx, "test", func() (bool, error) {
+				if n++; n < 3 {
+					return n == 2, errors.New("connection lost")
+				}
+				return true, nil
+			})
+
+			Convey("Then it should reconnect until connect succeeds", func() {
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 3)
+				So(r.status()["reconnects"], ShouldEqual, 2)
+			})
+		})
+
+		Convey("When connect returns core.ErrSourceStopped", func() {
+			err := r.run(ctx, "test", func() (bool, error) {
+				return true, core.ErrSourceStopped
+			})
+
+			Convey("Then it should return the error without reconnecting", func() {
+				So(err, ShouldEqual, core.ErrSourceStopped)
+				So(r.status()["reconnects"], ShouldEqual, 0)
+			})
+		})
+
+		Convey("When it's stopped while waiting to reconnect", func() {
+			close(r.stopCh)
+			err := r.run(ctx, "test", func() (bool, error) {
+				return false, errors.New("cannot connect")
+			})
+
+			Convey("Then it should return nil", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When creating it with invalid intervals", func() {
+			_, err := newReconnector(&IOParams{Name: "reconnect_test"}, 2*time.Second, time.Second)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
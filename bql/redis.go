@@ -0,0 +1,518 @@
+package bql
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisConnParams has parameters shared by Redis sources, sinks, and states
+// to connect to a server.
+type redisConnParams struct {
+	Address        string
+	Password       string
+	DB             int
+	ConnectTimeout time.Duration
+
+	// Timeout is the timeout of reading a reply or writing a command.
+	Timeout time.Duration
+}
+
+func defaultRedisConnParams() redisConnParams {
+	return redisConnParams{
+		Address:        "localhost:6379",
+		ConnectTimeout: 10 * time.Second,
+		Timeout:        10 * time.Second,
+	}
+}
+
+func (p *redisConnParams) validate() error {
+	if p.Address == "" {
+		return errors.New("address must not be empty")
+	}
+	if p.DB < 0 {
+		return fmt.Errorf("db must not be negative: %v", p.DB)
+	}
+	if p.ConnectTimeout < 0 || p.Timeout < 0 {
+		return errors.New("connect_timeout and timeout must not be negative")
+	}
+	return nil
+}
+
+// dial connects to the server. extraTimeout is added to the read timeout for
+// blocking commands.
+func (p *redisConnParams) dial(extraTimeout time.Duration) (redis.Conn, error) {
+	opts := []redis.DialOption{
+		redis.DialConnectTimeout(p.ConnectTimeout),
+		redis.DialDatabase(p.DB),
+	}
+	if p.Timeout > 0 {
+		opts = append(opts,
+			redis.DialReadTimeout(p.Timeout+extraTimeout),
+			redis.DialWriteTimeout(p.Timeout))
+	}
+	if p.Password != "" {
+		opts = append(opts, redis.DialPassword(p.Password))
+	}
+	return redis.Dial("tcp", p.Address, opts...)
+}
+
+// pool returns a connection pool. A broken connection is discarded by the
+// pool, so the next command is sent over a new connection.
+func (p *redisConnParams) pool() *redis.Pool {
+	return &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return p.dial(0)
+		},
+		MaxIdle:     4,
+		IdleTimeout: 5 * time.Minute,
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < time.Minute {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+}
+
+// redisString converts a value to a string used as a key or a field of Redis.
+// Strings are used as they are and other values are encoded in JSON.
+func redisString(v data.Value) string {
+	if s, err := data.AsString(v); err == nil {
+		return s
+	}
+	return v.String()
+}
+
+// parseRedisJSONValue parses a string written by Redis sinks or states. It
+// returns the string itself when it isn't a valid JSON.
+func parseRedisJSONValue(s string) data.Value {
+	m, err := data.UnmarshalJSONMap([]byte(`{"v":`+s+`}`), data.JSONNumberPreserve)
+	if err != nil {
+		return data.String(s)
+	}
+	return m["v"]
+}
+
+// redisSink writes tuples to a list, a stream, or a pub/sub channel of Redis.
+type redisSink struct {
+	pool     *redis.Pool
+	mode     string
+	enc      TupleEncoder
+	key      string
+	keyField data.Path
+	maxLen   int
+}
+
+func (s *redisSink) Write(ctx *core.Context, t *core.Tuple) error {
+	key := s.key
+	if s.keyField != nil {
+		v, err := t.Data.Get(s.keyField)
+		if err != nil {
+			return fmt.Errorf("the tuple doesn't have the key: %v", err)
+		}
+		key = redisString(v)
+	}
+
+	var args redis.Args
+	switch s.mode {
+	case "stream":
+		if len(t.Data) == 0 {
+			return errors.New("an empty tuple cannot be added to a stream")
+		}
+		args = args.Add(key)
+		if s.maxLen > 0 {
+			args = args.Add("MAXLEN", "~", s.maxLen)
+		}
+		args = args.Add("*")
+		keys := make([]string, 0, len(t.Data))
+		for k := range t.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			args = args.Add(k, redisString(t.Data[k]))
+		}
+
+	default:
+		b, err := s.enc.Encode(t.Data)
+		if err != nil {
+			return err
+		}
+		if len(b) > 0 && b[len(b)-1] == '\n' {
+			b = b[:len(b)-1]
+		}
+		args = args.Add(key, b)
+	}
+
+	c := s.pool.Get()
+	defer c.Close()
+	_, err := c.Do(redisSinkCommands[s.mode], args...)
+	return err
+}
+
+func (s *redisSink) Close(ctx *core.Context) error {
+	return s.pool.Close()
+}
+
+var redisSinkCommands = map[string]string{
+	"list":   "RPUSH",
+	"stream": "XADD",
+	"pubsub": "PUBLISH",
+}
+
+// createRedisSink creates a sink writing tuples to Redis. It accepts
+// following parameters in addition to redisConnParams:
+//
+//   - mode: "list" (default) appending tuples to a list by RPUSH, "stream"
+//     adding them to a stream by XADD, or "pubsub" publishing them to a
+//     channel by PUBLISH
+//   - key: the name of the list, the stream, or the channel
+//   - key_field: the path of a value used as the key instead of "key"
+//   - format: the format of tuples written to a list or a channel. See
+//     NewTupleEncoder for details. A trailing newline is removed.
+//   - max_len: the approximate maximum length of a stream
+//
+// Each top-level field of a tuple becomes a field of an entry of a stream.
+// A string value is written as it is and other values are written in JSON.
+func createRedisSink(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Sink, error) {
+	// "format" and parameters related to it are handled by the encoder
+	enc, err := NewTupleEncoder(params)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &struct {
+		redisConnParams
+		Mode     string
+		Key      string
+		KeyField string
+		MaxLen   int
+	}{
+		redisConnParams: defaultRedisConnParams(),
+		Mode:            "list",
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+	if err := v.validate(); err != nil {
+		return nil, err
+	}
+
+	s := &redisSink{
+		mode:   strings.ToLower(v.Mode),
+		enc:    enc,
+		key:    v.Key,
+		maxLen: v.MaxLen,
+	}
+	if _, ok := redisSinkCommands[s.mode]; !ok {
+		return nil, fmt.Errorf("mode must be one of list, stream, or pubsub: %v", v.Mode)
+	}
+	if v.Key == "" && v.KeyField == "" {
+		return nil, errors.New("key or key_field must be given")
+	}
+	if v.KeyField != "" {
+		if s.keyField, err = data.CompilePath(v.KeyField); err != nil {
+			return nil, fmt.Errorf("'key_field' parameter doesn't have a valid path: %v", err)
+		}
+	}
+	if v.MaxLen < 0 {
+		return nil, fmt.Errorf("max_len must not be negative: %v", v.MaxLen)
+	}
+	s.pool = v.pool()
+	return s, nil
+}
+
+// redisStreamSource reads entries of a Redis stream and emits a tuple for
+// each entry. When a consumer group is given, entries are acknowledged after
+// they're written to the writer and pending entries of the consumer are
+// read first so that no entry is lost by a restart. It reconnects to the
+// server with exponential backoff when the connection is lost.
+type redisStreamSource struct {
+	ioParams   *IOParams
+	conn       redisConnParams
+	key        string
+	group      string
+	consumer   string
+	startID    string
+	count      int
+	block      time.Duration
+	jsonValues bool
+	idField    string
+	*reconnector
+
+	m      sync.Mutex
+	lastID string
+}
+
+type redisStreamEntry struct {
+	id     string
+	fields []string
+}
+
+func (s *redisStreamSource) GenerateStream(ctx *core.Context, w core.Writer) error {
+	return s.run(ctx, "Cannot read entries from the Redis stream", func() (bool, error) {
+		return s.connect(ctx, w)
+	})
+}
+
+func (s *redisStreamSource) connect(ctx *core.Context, w core.Writer) (bool, error) {
+	c, err := s.conn.dial(s.block)
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+
+	// Closing the connection interrupts a blocking command.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.stopCh:
+			c.Close()
+		case <-done:
+		}
+	}()
+	stopped := func() bool {
+		select {
+		case <-s.stopCh:
+			return true
+		default:
+			return false
+		}
+	}
+
+	if s.group != "" {
+		_, err := c.Do("XGROUP", "CREATE", s.key, s.group, s.startID, "MKSTREAM")
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			if stopped() {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+	s.setConnected(true)
+	defer s.setConnected(false)
+
+	// pending is true while reading entries delivered to the consumer but
+	// not acknowledged yet.
+	pending := s.group != ""
+	for {
+		var reply interface{}
+		var err error
+		if s.group == "" {
+			reply, err = c.Do("XREAD", "COUNT", s.count, "BLOCK", int64(s.block/time.Millisecond),
+				"STREAMS", s.key, s.currentID())
+		} else {
+			id := ">"
+			if pending {
+				id = s.currentID()
+			}
+			reply, err = c.Do("XREADGROUP", "GROUP", s.group, s.consumer, "COUNT", s.count,
+				"BLOCK", int64(s.block/time.Millisecond), "STREAMS", s.key, id)
+		}
+		if stopped() {
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+
+		es, err := parseRedisStreamReply(reply)
+		if err != nil {
+			return true, err
+		}
+		if pending && len(es) == 0 {
+			pending = false
+			continue
+		}
+		for _, e := range es {
+			if err := w.Write(ctx, s.toTuple(e)); err != nil {
+				return true, err
+			}
+			if s.group != "" {
+				if _, err := c.Do("XACK", s.key, s.group, e.id); err != nil {
+					return true, err
+				}
+			}
+			s.m.Lock()
+			s.lastID = e.id
+			s.m.Unlock()
+		}
+	}
+}
+
+// currentID returns the ID after which entries are read.
+func (s *redisStreamSource) currentID() string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.lastID != "" {
+		return s.lastID
+	}
+	if s.group != "" {
+		return "0" // for pending entries
+	}
+	return s.startID
+}
+
+func (s *redisStreamSource) toTuple(e *redisStreamEntry) *core.Tuple {
+	d := data.Map{}
+	for i := 0; i+1 < len(e.fields); i += 2 {
+		if s.jsonValues {
+			d[e.fields[i]] = parseRedisJSONValue(e.fields[i+1])
+		} else {
+			d[e.fields[i]] = data.String(e.fields[i+1])
+		}
+	}
+	if s.idField != "" {
+		d[s.idField] = data.String(e.id)
+	}
+	return core.NewTuple(d)
+}
+
+// parseRedisStreamReply parses a reply of XREAD or XREADGROUP reading a
+// single stream.
+func parseRedisStreamReply(reply interface{}) ([]*redisStreamEntry, error) {
+	if reply == nil {
+		return nil, nil // timeout
+	}
+	streams, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	var res []*redisStreamEntry
+	for _, st := range streams {
+		kv, err := redis.Values(st, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(kv) != 2 {
+			return nil, errors.New("unexpected reply of reading a stream")
+		}
+		entries, err := redis.Values(kv[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			idFields, err := redis.Values(e, nil)
+			if err != nil {
+				return nil, err
+			}
+			if len(idFields) != 2 {
+				return nil, errors.New("unexpected entry of a stream")
+			}
+			id, err := redis.String(idFields[0], nil)
+			if err != nil {
+				return nil, err
+			}
+			var fields []string
+			if idFields[1] != nil { // a deleted entry doesn't have fields
+				if fields, err = redis.Strings(idFields[1], nil); err != nil {
+					return nil, err
+				}
+			}
+			res = append(res, &redisStreamEntry{id: id, fields: fields})
+		}
+	}
+	return res, nil
+}
+
+func (s *redisStreamSource) Stop(ctx *core.Context) error {
+	close(s.stopCh)
+	return nil
+}
+
+func (s *redisStreamSource) Status() data.Map {
+	st := s.status()
+	s.m.Lock()
+	defer s.m.Unlock()
+	st["last_id"] = data.String(s.lastID)
+	return st
+}
+
+// createRedisStreamSource creates a source reading a Redis stream. It
+// accepts following parameters in addition to redisConnParams:
+//
+//   - key: the name of the stream (required)
+//   - group: the name of a consumer group. The group is created when it
+//     doesn't exist.
+//   - consumer: the name of the consumer in the group (default: the name of
+//     the source)
+//   - start_id: the ID after which entries are read when there's no read
+//     entry, or the ID from which the group reads when it's created. "$"
+//     (default) means new entries and "0" means all entries.
+//   - count: the maximum number of entries read at once (default: 100)
+//   - block: the duration for which a read blocks (default: 1s)
+//   - json_values: true to parse values of fields as JSON. A value which
+//     isn't a valid JSON remains a string. (default: false)
+//   - id_field: the name of the field where the ID of an entry is stored
+//
+// Fields of an entry become top-level fields of a tuple.
+func createRedisStreamSource(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Source, error) {
+	v := &struct {
+		redisConnParams
+		Key                  string `bql:",required"`
+		Group                string
+		Consumer             string
+		StartID              string
+		Count                int
+		Block                time.Duration
+		JSONValues           bool
+		IDField              string
+		MinReconnectInterval time.Duration
+		MaxReconnectInterval time.Duration
+	}{
+		redisConnParams:      defaultRedisConnParams(),
+		Consumer:             ioParams.Name,
+		StartID:              "$",
+		Count:                100,
+		Block:                time.Second,
+		MinReconnectInterval: time.Second,
+		MaxReconnectInterval: time.Minute,
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+	if err := v.validate(); err != nil {
+		return nil, err
+	}
+	if v.Group != "" && v.Consumer == "" {
+		return nil, errors.New("consumer must be given with group")
+	}
+	if v.Count <= 0 {
+		return nil, fmt.Errorf("count must be positive: %v", v.Count)
+	}
+	if v.Block <= 0 {
+		return nil, fmt.Errorf("block must be positive: %v", v.Block)
+	}
+	r, err := newReconnector(ioParams, v.MinReconnectInterval, v.MaxReconnectInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return core.ImplementSourceStop(&redisStreamSource{
+		ioParams:    ioParams,
+		conn:        v.redisConnParams,
+		key:         v.Key,
+		group:       v.Group,
+		consumer:    v.Consumer,
+		startID:     v.StartID,
+		count:       v.Count,
+		block:       v.Block,
+		jsonValues:  v.JSONValues,
+		idField:     v.IDField,
+		reconnector: r,
+	}), nil
+}
+
+func init() {
+	MustRegisterGlobalSourceCreator("redis", SourceCreatorFunc(createRedisStreamSource))
+	MustRegisterGlobalSinkCreator("redis", SinkCreatorFunc(createRedisSink))
+}
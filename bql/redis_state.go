@@ -0,0 +1,171 @@
+package bql
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+)
+
+// redisHashState is a UDS backed by a Redis hash. Because values are stored
+// in Redis, multiple instances of SensorBee can share the same state. It can
+// be looked up by builtin functions such as lookup, and it can be updated by
+// the uds sink.
+type redisHashState struct {
+	pool       *redis.Pool
+	key        string
+	keyField   data.Path
+	valueField data.Path
+
+	m          sync.RWMutex
+	terminated bool
+}
+
+var (
+	_ core.LookupableSharedState = &redisHashState{}
+	_ core.Writer                = &redisHashState{}
+	_ SourceCheckpointState      = &redisHashState{}
+)
+
+// Lookup returns the value associated with the key. A string key is used as
+// it is and other keys are encoded in JSON.
+func (s *redisHashState) Lookup(ctx *core.Context, key data.Value) (data.Value, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	if s.terminated {
+		return nil, errors.New("the state is already terminated")
+	}
+
+	c := s.pool.Get()
+	defer c.Close()
+	v, err := redis.String(c.Do("HGET", s.key, redisString(key)))
+	if err != nil {
+		if err == redis.ErrNil {
+			return nil, core.NotExistError(fmt.Errorf("the key doesn't exist: %v", key))
+		}
+		return nil, err
+	}
+	return parseRedisJSONValue(v), nil
+}
+
+// Write stores a value of the tuple in the hash. When value_field isn't
+// given, the whole tuple is stored.
+func (s *redisHashState) Write(ctx *core.Context, t *core.Tuple) error {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	if s.terminated {
+		return errors.New("the state is already terminated")
+	}
+	if s.keyField == nil {
+		return errors.New("key_field must be given to write tuples to the state")
+	}
+
+	k, err := t.Data.Get(s.keyField)
+	if err != nil {
+		return fmt.Errorf("the tuple doesn't have the key: %v", err)
+	}
+	var v data.Value = t.Data
+	if s.valueField != nil {
+		if v, err = t.Data.Get(s.valueField); err != nil {
+			return fmt.Errorf("the tuple doesn't have the value: %v", err)
+		}
+	}
+
+	c := s.pool.Get()
+	defer c.Close()
+	_, err = c.Do("HSET", s.key, redisString(k), v.String())
+	return err
+}
+
+// LoadCheckpoint returns the offset of a source stored in the field of the
+// hash.
+func (s *redisHashState) LoadCheckpoint(ctx *core.Context, key string) (data.Value, error) {
+	v, err := s.Lookup(ctx, data.String(key))
+	if err != nil {
+		if core.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// SaveCheckpoint stores the offset of a source in the field of the hash so
+// that the source can resume from the offset after SensorBee restarts.
+func (s *redisHashState) SaveCheckpoint(ctx *core.Context, key string, offset data.Value) error {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	if s.terminated {
+		return errors.New("the state is already terminated")
+	}
+
+	c := s.pool.Get()
+	defer c.Close()
+	_, err := c.Do("HSET", s.key, key, offset.String())
+	return err
+}
+
+func (s *redisHashState) Terminate(ctx *core.Context) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.terminated {
+		return nil
+	}
+	s.terminated = true
+	return s.pool.Close()
+}
+
+// createRedisHashState creates a state backed by a Redis hash. It accepts
+// following parameters in addition to redisConnParams:
+//
+//   - key: the name of the hash (required)
+//   - key_field: the path of a value of a tuple used as a field of the hash
+//     when the tuple is written to the state
+//   - value_field: the path of a value of a tuple stored in the hash. The
+//     whole tuple is stored when it's omitted.
+//
+// Values are stored in JSON. A value which isn't a valid JSON, e.g. a value
+// stored by other applications, is looked up as a string.
+func createRedisHashState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	v := &struct {
+		redisConnParams
+		Key        string `bql:",required"`
+		KeyField   string
+		ValueField string
+	}{
+		redisConnParams: defaultRedisConnParams(),
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+	if err := v.validate(); err != nil {
+		return nil, err
+	}
+
+	s := &redisHashState{
+		key: v.Key,
+	}
+	if v.KeyField != "" {
+		p, err := data.CompilePath(v.KeyField)
+		if err != nil {
+			return nil, fmt.Errorf("'key_field' parameter doesn't have a valid path: %v", err)
+		}
+		s.keyField = p
+	}
+	if v.ValueField != "" {
+		p, err := data.CompilePath(v.ValueField)
+		if err != nil {
+			return nil, fmt.Errorf("'value_field' parameter doesn't have a valid path: %v", err)
+		}
+		s.valueField = p
+	}
+	s.pool = v.pool()
+	return s, nil
+}
+
+func init() {
+	udf.MustRegisterGlobalUDSCreator("redis_hash", udf.UDSCreatorFunc(createRedisHashState))
+}
@@ -0,0 +1,337 @@
+package bql
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedisSink(t *testing.T) {
+	Convey("Given a Redis server", t, func() {
+		r, err := miniredis.Run()
+		So(err, ShouldBeNil)
+		Reset(r.Close)
+		ctx := core.NewContext(nil)
+		params := data.Map{
+			"address": data.String(r.Addr()),
+			"key":     data.String("events"),
+		}
+		tuple := core.NewTuple(data.Map{
+			"name": data.String("a"),
+			"v":    data.Int(1),
+			"m":    data.Map{"x": data.True},
+		})
+
+		Convey("When writing a tuple to a list", func() {
+			s, err := createRedisSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+			So(s.Write(ctx, tuple), ShouldBeNil)
+
+			Convey("Then the list should have the tuple in JSON", func() {
+				l, err := r.List("events")
+				So(err, ShouldBeNil)
+				So(l, ShouldResemble, []string{tuple.Data.String()})
+			})
+		})
+
+		Convey("When writing a tuple to a stream", func() {
+			params["mode"] = data.String("stream")
+			params["max_len"] = data.Int(10)
+			s, err := createRedisSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+			So(s.Write(ctx, tuple), ShouldBeNil)
+
+			Convey("Then the stream should have an entry having the fields", func() {
+				es, err := r.Stream("events")
+				So(err, ShouldBeNil)
+				So(es, ShouldHaveLength, 1)
+				So(es[0].Values, ShouldResemble, []string{"m", `{"x":true}`, "name", "a", "v", "1"})
+			})
+		})
+
+		Convey("When publishing a tuple to a channel given by a field", func() {
+			delete(params, "key")
+			params["mode"] = data.String("pubsub")
+			params["key_field"] = data.String("name")
+			s, err := createRedisSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+			// miniredis blocks publishing until the subscriber receives the
+			// message, so it has to be received concurrently.
+			sub := r.NewSubscriber()
+			sub.Subscribe("a")
+			ch := make(chan string, 1)
+			go func() {
+				ch <- (<-sub.Messages()).Message
+			}()
+			So(s.Write(ctx, tuple), ShouldBeNil)
+
+			Convey("Then the subscriber should receive the tuple", func() {
+				select {
+				case m := <-ch:
+					So(m, ShouldEqual, tuple.Data.String())
+				case <-time.After(5 * time.Second):
+					So("timeout", ShouldBeEmpty)
+				}
+			})
+		})
+
+		Convey("When the server is down", func() {
+			s, err := createRedisSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+			r.Close()
+
+			Convey("Then writing should fail", func() {
+				So(s.Write(ctx, tuple), ShouldNotBeNil)
+
+				Convey("And it should succeed after the server restarts", func() {
+					So(r.Restart(), ShouldBeNil)
+					So(s.Write(ctx, tuple), ShouldBeNil)
+				})
+			})
+		})
+
+		Convey("When creating a sink with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"unsupported mode":  {"mode": data.String("set")},
+				"invalid key_field": {"key_field": data.String("a[")},
+				"negative max_len":  {"max_len": data.Int(-1)},
+				"negative db":       {"db": data.Int(-1)},
+			}
+			for name, c := range cases {
+				c := c
+				Convey("Then "+name+" should result in an error", func() {
+					ps := params.Copy()
+					for k, v := range c {
+						ps[k] = v
+					}
+					_, err := createRedisSink(ctx, &IOParams{}, ps)
+					So(err, ShouldNotBeNil)
+				})
+			}
+
+			Convey("Then missing key should result in an error", func() {
+				_, err := createRedisSink(ctx, &IOParams{}, data.Map{"address": data.String(r.Addr())})
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRedisStreamSource(t *testing.T) {
+	Convey("Given a Redis stream", t, func() {
+		r, err := miniredis.Run()
+		So(err, ShouldBeNil)
+		Reset(r.Close)
+		_, err = r.XAdd("events", "1-0", []string{"a", "1", "b", "x"})
+		So(err, ShouldBeNil)
+
+		ctx := core.NewContext(nil)
+		params := data.Map{
+			"address":  data.String(r.Addr()),
+			"key":      data.String("events"),
+			"start_id": data.String("0"),
+			"block":    data.String("10ms"),
+		}
+		w := &testFileWriter{}
+		w.c = sync.NewCond(&w.m)
+		run := func() core.Source {
+			s, err := createRedisStreamSource(ctx, &IOParams{Name: "redis_test"}, params)
+			So(err, ShouldBeNil)
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, w)
+			}()
+			Reset(func() {
+				s.Stop(ctx)
+				<-ch
+			})
+			return s
+		}
+
+		Convey("When reading the stream", func() {
+			params["json_values"] = data.True
+			params["id_field"] = data.String("id")
+			run()
+
+			Convey("Then it should emit existing and new entries", func() {
+				ds := w.snapshot(1)
+				So(ds[0]["id"], ShouldNotBeNil)
+				delete(ds[0], "id")
+				So(ds[0], ShouldResemble, data.Map{"a": data.Int(1), "b": data.String("x")})
+
+				_, err := r.XAdd("events", "*", []string{"a", "2"})
+				So(err, ShouldBeNil)
+				ds = w.snapshot(2)
+				So(ds[1]["a"], ShouldEqual, data.Int(2))
+			})
+		})
+
+		Convey("When reading the stream with a consumer group", func() {
+			params["group"] = data.String("g")
+			s := run()
+			ds := w.snapshot(1)
+
+			Convey("Then it should emit entries as strings and acknowledge them", func() {
+				So(ds[0], ShouldResemble, data.Map{"a": data.String("1"), "b": data.String("x")})
+				for i := 0; ; i++ {
+					if s.(core.Statuser).Status()["internal_source"].(data.Map)["last_id"] != data.String("") {
+						break
+					}
+					So(i, ShouldBeLessThan, 1000)
+					time.Sleep(time.Millisecond)
+				}
+				c, err := redis.Dial("tcp", r.Addr())
+				So(err, ShouldBeNil)
+				defer c.Close()
+				p, err := redis.Values(c.Do("XPENDING", "events", "g"))
+				So(err, ShouldBeNil)
+				So(p[0], ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the server restarts", func() {
+			s := run()
+			w.snapshot(1)
+			// Blocking commands of a restarted miniredis never return, so
+			// another server is started on the same address instead.
+			addr := r.Addr()
+			r.Close()
+			r2 := miniredis.NewMiniRedis()
+			So(r2.StartAddr(addr), ShouldBeNil)
+			Reset(r2.Close)
+			_, err := r2.XAdd("events", "2-0", []string{"a", "2"})
+			So(err, ShouldBeNil)
+
+			Convey("Then the source should reconnect and continue", func() {
+				ds := w.snapshot(2)
+				So(ds[1], ShouldResemble, data.Map{"a": data.String("2")})
+				So(s.(core.Statuser).Status()["internal_source"].(data.Map)["reconnects"], ShouldBeGreaterThan, 0)
+			})
+		})
+
+		Convey("When creating a source with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"zero count":              {"count": data.Int(0)},
+				"zero block":              {"block": data.Int(0)},
+				"empty consumer":          {"group": data.String("g"), "consumer": data.String("")},
+				"invalid reconnect range": {"min_reconnect_interval": data.Int(2), "max_reconnect_interval": data.Int(1)},
+			}
+			for name, c := range cases {
+				c := c
+				Convey("Then "+name+" should result in an error", func() {
+					ps := params.Copy()
+					for k, v := range c {
+						ps[k] = v
+					}
+					_, err := createRedisStreamSource(ctx, &IOParams{Name: "redis_test"}, ps)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestRedisHashState(t *testing.T) {
+	Convey("Given a redis_hash state", t, func() {
+		r, err := miniredis.Run()
+		So(err, ShouldBeNil)
+		Reset(r.Close)
+		ctx := core.NewContext(nil)
+		st, err := createRedisHashState(ctx, data.Map{
+			"address":   data.String(r.Addr()),
+			"key":       data.String("users"),
+			"key_field": data.String("id"),
+		})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			st.Terminate(ctx)
+		})
+		s := st.(*redisHashState)
+
+		Convey("When writing a tuple to the state", func() {
+			d := data.Map{"id": data.Int(1), "name": data.String("a")}
+			So(s.Write(ctx, core.NewTuple(d)), ShouldBeNil)
+
+			Convey("Then it should be looked up by the key", func() {
+				v, err := s.Lookup(ctx, data.Int(1))
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, d)
+			})
+
+			Convey("Then another state on the same hash should see it", func() {
+				st2, err := createRedisHashState(ctx, data.Map{
+					"address": data.String(r.Addr()),
+					"key":     data.String("users"),
+				})
+				So(err, ShouldBeNil)
+				defer st2.Terminate(ctx)
+				v, err := st2.(core.LookupableSharedState).Lookup(ctx, data.String("1"))
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, d)
+			})
+		})
+
+		Convey("When a value is stored by another application", func() {
+			r.HSet("users", "2", "plain text")
+
+			Convey("Then it should be looked up as a string", func() {
+				v, err := s.Lookup(ctx, data.Int(2))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.String("plain text"))
+			})
+		})
+
+		Convey("When looking up a missing key", func() {
+			_, err := s.Lookup(ctx, data.String("x"))
+
+			Convey("Then it should return NotExistError", func() {
+				So(core.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+
+		Convey("When saving a checkpoint of a source", func() {
+			offset := data.Map{"partition": data.Int(1), "seq": data.Int(42)}
+			So(s.SaveCheckpoint(ctx, "src", offset), ShouldBeNil)
+
+			Convey("Then it should be loaded", func() {
+				v, err := s.LoadCheckpoint(ctx, "src")
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, offset)
+			})
+
+			Convey("Then loading a missing checkpoint should return nil", func() {
+				v, err := s.LoadCheckpoint(ctx, "other")
+				So(err, ShouldBeNil)
+				So(v, ShouldBeNil)
+			})
+		})
+
+		Convey("When the state is terminated", func() {
+			So(s.Terminate(ctx), ShouldBeNil)
+
+			Convey("Then it cannot be used", func() {
+				So(s.SaveCheckpoint(ctx, "src", data.Int(1)), ShouldNotBeNil)
+				_, err := s.Lookup(ctx, data.Int(1))
+				So(err, ShouldNotBeNil)
+				So(s.Write(ctx, core.NewTuple(data.Map{"id": data.Int(1)})), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,642 @@
+package bql
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// s3ObjectTimeLayout is the layout of the timestamp at the beginning of the
+// name of each object written by s3Sink. Names having timestamps in this
+// layout are sorted in the order of the timestamps.
+const s3ObjectTimeLayout = "20060102T150405.000000000Z"
+
+// s3ConnParams has parameters shared by the source and the sink to connect
+// to S3 or S3-compatible storage.
+type s3ConnParams struct {
+	// Endpoint is the host and the optional port of the storage.
+	Endpoint string
+
+	// Region is the region of the bucket. It's detected automatically when
+	// it's omitted.
+	Region string
+
+	// AccessKeyID, SecretAccessKey, and SessionToken are credentials. When
+	// AccessKeyID is omitted, credentials are obtained from AWS_*
+	// environment variables, ~/.aws/credentials, or the IAM role of the
+	// instance.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Secure is true when the storage is accessed with HTTPS.
+	Secure bool
+
+	Bucket string `bql:",required"`
+}
+
+func defaultS3ConnParams() s3ConnParams {
+	return s3ConnParams{
+		Endpoint: "s3.amazonaws.com",
+		Secure:   true,
+	}
+}
+
+func (p *s3ConnParams) validate() error {
+	if p.Endpoint == "" {
+		return errors.New("endpoint must not be empty")
+	}
+	if p.Bucket == "" {
+		return errors.New("bucket must not be empty")
+	}
+	if (p.AccessKeyID == "") != (p.SecretAccessKey == "") {
+		return errors.New("access_key_id and secret_access_key must be given together")
+	}
+	return nil
+}
+
+func (p *s3ConnParams) newClient() (*minio.Client, error) {
+	creds := credentials.NewStaticV4(p.AccessKeyID, p.SecretAccessKey, p.SessionToken)
+	if p.AccessKeyID == "" {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		})
+	}
+	return minio.New(p.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: p.Secure,
+		Region: p.Region,
+	})
+}
+
+// s3Batch is an object being built by s3Sink.
+type s3Batch struct {
+	buf     bytes.Buffer
+	w       io.Writer
+	gz      *gzip.Writer
+	n       int
+	first   time.Time
+	created time.Time
+}
+
+// s3Sink writes tuples as NDJSON objects. Tuples are grouped by the prefix
+// rendered from the key template, and each group is uploaded as an object
+// when it has batch_size tuples or becomes older than flush_interval.
+type s3Sink struct {
+	client         *minio.Client
+	bucket         string
+	key            *tupleTemplate
+	compression    string
+	timestampField string
+
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	retryInterval time.Duration
+	timeout       time.Duration
+
+	m          sync.Mutex
+	batches    map[string]*s3Batch
+	numWritten int64
+	numObjects int64
+	numFailed  int64
+	lastError  error
+	closed     bool
+	stopOnce   sync.Once
+	stopCh     chan struct{}
+	doneCh     chan struct{}
+}
+
+func (s *s3Sink) Write(ctx *core.Context, t *core.Tuple) error {
+	prefix, err := s.key.render(t)
+	if err != nil {
+		return err
+	}
+	doc := t.Data
+	if s.timestampField != "" {
+		doc = doc.Copy()
+		doc[s.timestampField] = data.Timestamp(t.Timestamp)
+	}
+	line := doc.String()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return errors.New("the sink is already closed")
+	}
+	b, ok := s.batches[prefix]
+	if !ok {
+		b = &s3Batch{
+			first:   t.Timestamp,
+			created: time.Now(),
+		}
+		b.w = &b.buf
+		if s.compression == "gzip" {
+			b.gz = gzip.NewWriter(&b.buf)
+			b.w = b.gz
+		}
+		s.batches[prefix] = b
+	}
+	if _, err := io.WriteString(b.w, line+"\n"); err != nil {
+		return err
+	}
+	b.n++
+	if t.Timestamp.Before(b.first) {
+		b.first = t.Timestamp
+	}
+	if b.n < s.batchSize {
+		return nil
+	}
+	delete(s.batches, prefix)
+	return s.upload(prefix, b)
+}
+
+// upload uploads a batch as an object. It retries with backoff when the
+// upload fails, and the batch is dropped after all retries fail. The caller
+// must hold the lock.
+func (s *s3Sink) upload(prefix string, b *s3Batch) error {
+	ext, contentType := ".ndjson", "application/x-ndjson"
+	if b.gz != nil {
+		if err := b.gz.Close(); err != nil {
+			return err
+		}
+		ext, contentType = ".ndjson.gz", "application/gzip"
+	}
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	key := prefix + b.first.UTC().Format(s3ObjectTimeLayout) + "-" + hex.EncodeToString(nonce) + ext
+
+	var err error
+	wait := s.retryInterval
+	for i := 0; ; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		_, err = s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(b.buf.Bytes()), int64(b.buf.Len()),
+			minio.PutObjectOptions{ContentType: contentType})
+		cancel()
+		if err == nil {
+			s.numWritten += int64(b.n)
+			s.numObjects++
+			return nil
+		}
+		if i >= s.maxRetries {
+			break
+		}
+
+		select {
+		case <-s.stopCh:
+			// retry immediately while closing
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+	s.numFailed += int64(b.n)
+	s.lastError = err
+	return fmt.Errorf("cannot upload %v tuples to %v: %v", b.n, key, err)
+}
+
+// flush uploads batches older than flush_interval, or all batches when all
+// is true. The caller must hold the lock.
+func (s *s3Sink) flush(all bool) error {
+	var lastErr error
+	now := time.Now()
+	for prefix, b := range s.batches {
+		if !all && now.Sub(b.created) < s.flushInterval {
+			continue
+		}
+		delete(s.batches, prefix)
+		if err := s.upload(prefix, b); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// flushPeriodically uploads batches which become older than flush_interval.
+func (s *s3Sink) flushPeriodically(ctx *core.Context) {
+	defer close(s.doneCh)
+	check := s.flushInterval / 10
+	if check < 10*time.Millisecond {
+		check = 10 * time.Millisecond
+	}
+	t := time.NewTicker(check)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-t.C:
+		}
+
+		s.m.Lock()
+		if err := s.flush(false); err != nil {
+			ctx.ErrLog(err).WithField("bucket", s.bucket).Error("Cannot upload tuples to S3")
+		}
+		s.m.Unlock()
+	}
+}
+
+func (s *s3Sink) Close(ctx *core.Context) error {
+	// stopCh is closed without the lock so that retries in upload can be
+	// interrupted.
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+	<-s.doneCh
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.flush(true)
+}
+
+// Status returns the status of the sink.
+func (s *s3Sink) Status() data.Map {
+	s.m.Lock()
+	defer s.m.Unlock()
+	pending := 0
+	for _, b := range s.batches {
+		pending += b.n
+	}
+	st := data.Map{
+		"bucket":      data.String(s.bucket),
+		"num_written": data.Int(s.numWritten),
+		"num_objects": data.Int(s.numObjects),
+		"num_failed":  data.Int(s.numFailed),
+		"num_pending": data.Int(pending),
+	}
+	if s.lastError != nil {
+		st["last_error"] = data.String(s.lastError.Error())
+	}
+	return st
+}
+
+// createS3Sink creates an s3 sink writing tuples to S3 or S3-compatible
+// storage as NDJSON objects. It accepts following parameters:
+//
+//   - endpoint: the host of the storage (default: "s3.amazonaws.com")
+//   - region: the region of the bucket
+//   - access_key_id, secret_access_key, session_token: credentials. They're
+//     obtained from the environment when omitted.
+//   - secure: false to use HTTP instead of HTTPS (default: true)
+//   - bucket: the name of the bucket (required)
+//   - key: the prefix of objects (default: ""). It can have "{path}" and
+//     "{path:layout}" like the index of the elasticsearch sink, e.g.
+//     "logs/{@timestamp:2006/01/02}/{type}/". The name of each object,
+//     which consists of the earliest timestamp of tuples in the object and
+//     a random string, is appended to the prefix.
+//   - compression: "gzip" (default) or "none"
+//   - timestamp_field: the name of the field to which the timestamp of the
+//     tuple is added (default: "@timestamp"). An empty string disables it.
+//   - batch_size: the maximum number of tuples in an object
+//     (default: 10000)
+//   - flush_interval: the maximum duration for which tuples are buffered
+//     before they're uploaded (default: 1m)
+//   - max_retries: the number of retries of a failed upload (default: 3)
+//   - retry_interval: the initial interval of retries, which doubles on
+//     each retry (default: 1s)
+//   - timeout: the timeout of an upload (default: 1m)
+func createS3Sink(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Sink, error) {
+	v := &struct {
+		s3ConnParams
+		Key            string
+		Compression    string
+		TimestampField string
+		BatchSize      int
+		FlushInterval  time.Duration
+		MaxRetries     int
+		RetryInterval  time.Duration
+		Timeout        time.Duration
+	}{
+		s3ConnParams:   defaultS3ConnParams(),
+		Compression:    "gzip",
+		TimestampField: "@timestamp",
+		BatchSize:      10000,
+		FlushInterval:  time.Minute,
+		MaxRetries:     3,
+		RetryInterval:  time.Second,
+		Timeout:        time.Minute,
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+	if err := v.s3ConnParams.validate(); err != nil {
+		return nil, err
+	}
+
+	key, err := parseTupleTemplate("key", v.Key)
+	if err != nil {
+		return nil, err
+	}
+	if v.Compression != "gzip" && v.Compression != "none" {
+		return nil, fmt.Errorf("unsupported compression: %v", v.Compression)
+	}
+	if v.BatchSize <= 0 {
+		return nil, fmt.Errorf("batch_size must be positive: %v", v.BatchSize)
+	}
+	if v.FlushInterval <= 0 {
+		return nil, fmt.Errorf("flush_interval must be positive: %v", v.FlushInterval)
+	}
+	if v.MaxRetries < 0 {
+		return nil, fmt.Errorf("max_retries must not be negative: %v", v.MaxRetries)
+	}
+	if v.RetryInterval < 0 {
+		return nil, fmt.Errorf("retry_interval must not be negative: %v", v.RetryInterval)
+	}
+	if v.Timeout <= 0 {
+		return nil, fmt.Errorf("timeout must be positive: %v", v.Timeout)
+	}
+	client, err := v.s3ConnParams.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &s3Sink{
+		client:         client,
+		bucket:         v.Bucket,
+		key:            key,
+		compression:    v.Compression,
+		timestampField: v.TimestampField,
+		batchSize:      v.BatchSize,
+		flushInterval:  v.FlushInterval,
+		maxRetries:     v.MaxRetries,
+		retryInterval:  v.RetryInterval,
+		timeout:        v.Timeout,
+		batches:        map[string]*s3Batch{},
+		stopCh:         make(chan struct{}),
+		doneCh:         make(chan struct{}),
+	}
+	go s.flushPeriodically(ctx)
+	return s, nil
+}
+
+// s3Object is an object to be read by s3Source.
+type s3Object struct {
+	key string
+	ts  time.Time
+}
+
+// s3Source emits tuples in NDJSON objects under a prefix of a bucket. The
+// objects are read in the order of the timestamps at the beginning of their
+// names, which is the earliest timestamp of tuples in each object written
+// by s3Sink. Objects without timestamps in their names are ordered by their
+// last modified times. Tuples in an object are emitted in the order in which
+// they were written. Objects whose names end with ".gz" are decompressed.
+type s3Source struct {
+	ioParams       *IOParams
+	client         *minio.Client
+	bucket         string
+	prefix         string
+	timestampField string
+	keyField       data.Path
+	numberPolicy   data.JSONNumberPolicy
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+
+	m          sync.Mutex
+	numObjects int64
+	numTuples  int64
+	current    string
+}
+
+func (s *s3Source) GenerateStream(ctx *core.Context, w core.Writer) error {
+	bctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stopCh:
+			cancel()
+		case <-bctx.Done():
+		}
+	}()
+
+	objs, err := s.list(bctx)
+	if err != nil {
+		return err
+	}
+	for _, o := range objs {
+		if err := s.read(ctx, bctx, w, o.key); err != nil {
+			if bctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// list returns objects under the prefix sorted in the order of timestamps.
+func (s *s3Source) list(ctx context.Context) ([]s3Object, error) {
+	var objs []s3Object
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.prefix,
+		Recursive: true,
+	}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		if strings.HasSuffix(info.Key, "/") {
+			continue
+		}
+		o := s3Object{key: info.Key, ts: info.LastModified}
+		if base := path.Base(info.Key); len(base) >= len(s3ObjectTimeLayout) {
+			if ts, err := time.Parse(s3ObjectTimeLayout, base[:len(s3ObjectTimeLayout)]); err == nil {
+				o.ts = ts
+			}
+		}
+		objs = append(objs, o)
+	}
+	sort.SliceStable(objs, func(i, j int) bool {
+		if !objs[i].ts.Equal(objs[j].ts) {
+			return objs[i].ts.Before(objs[j].ts)
+		}
+		return objs[i].key < objs[j].key
+	})
+	return objs, nil
+}
+
+func (s *s3Source) read(ctx *core.Context, bctx context.Context, w core.Writer, key string) error {
+	obj, err := s.client.GetObject(bctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	s.m.Lock()
+	s.current = key
+	s.m.Unlock()
+
+	var r io.Reader = obj
+	if strings.HasSuffix(key, ".gz") {
+		gz, err := gzip.NewReader(obj)
+		if err != nil {
+			return fmt.Errorf("cannot decompress %v: %v", key, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	br := bufio.NewReader(r)
+	for lineNumber := int64(1); ; lineNumber++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("cannot read %v: %v", key, err)
+		}
+		if l := bytes.TrimSpace(line); len(l) > 0 {
+			if werr := s.emit(ctx, w, key, lineNumber, l); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	s.m.Lock()
+	s.numObjects++
+	s.m.Unlock()
+	return nil
+}
+
+func (s *s3Source) emit(ctx *core.Context, w core.Writer, key string, lineNumber int64, line []byte) error {
+	m, err := data.UnmarshalJSONMap(line, s.numberPolicy)
+	if err != nil {
+		ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
+			WithField("key", key).
+			WithField("line_number", lineNumber).
+			Warning("Ignoring the line due to a parse error")
+		return nil
+	}
+
+	t := core.NewTuple(m)
+	if s.timestampField != "" {
+		if v, ok := t.Data[s.timestampField]; ok {
+			if ts, err := data.ToTimestamp(v); err != nil {
+				ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
+					WithField("key", key).
+					WithField("line_number", lineNumber).
+					Warning("Cannot convert a value in timestamp_field to a timestamp")
+			} else {
+				t.Timestamp = ts
+				delete(t.Data, s.timestampField)
+			}
+		}
+	}
+	if s.keyField != nil {
+		if err := t.Data.Set(s.keyField, data.String(key)); err != nil {
+			ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
+				WithField("key", key).
+				Warning("Cannot set the key to key_field")
+		}
+	}
+	if err := w.Write(ctx, t); err != nil {
+		return err
+	}
+	s.m.Lock()
+	s.numTuples++
+	s.m.Unlock()
+	return nil
+}
+
+func (s *s3Source) Stop(ctx *core.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+	return nil
+}
+
+func (s *s3Source) Status() data.Map {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return data.Map{
+		"bucket":      data.String(s.bucket),
+		"prefix":      data.String(s.prefix),
+		"num_objects": data.Int(s.numObjects),
+		"num_tuples":  data.Int(s.numTuples),
+		"current_key": data.String(s.current),
+	}
+}
+
+// createS3Source creates an s3 source replaying NDJSON objects under a
+// prefix of a bucket, e.g. objects written by the s3 sink. It accepts the
+// connection parameters of the s3 sink and following parameters:
+//
+//   - prefix: the prefix of objects to be read (default: "")
+//   - timestamp_field: the name of the field having the timestamp of the
+//     tuple (default: "@timestamp"). The field is removed from the tuple.
+//   - key_field: the path to which the key of the object is set
+//   - json_number: "preserve" (default), "int", or "float"
+//   - rewindable: true to support REWIND SOURCE (default: false)
+func createS3Source(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Source, error) {
+	v := &struct {
+		s3ConnParams
+		Prefix         string
+		TimestampField string
+		KeyField       string
+		JSONNumber     string
+		Rewindable     bool
+	}{
+		s3ConnParams:   defaultS3ConnParams(),
+		TimestampField: "@timestamp",
+		JSONNumber:     "preserve",
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+	if err := v.s3ConnParams.validate(); err != nil {
+		return nil, err
+	}
+	policy, err := data.ParseJSONNumberPolicy(v.JSONNumber)
+	if err != nil {
+		return nil, fmt.Errorf("'json_number' parameter must be one of preserve, int, or float: %v", err)
+	}
+	client, err := v.s3ConnParams.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &s3Source{
+		ioParams:       ioParams,
+		client:         client,
+		bucket:         v.Bucket,
+		prefix:         v.Prefix,
+		timestampField: v.TimestampField,
+		numberPolicy:   policy,
+		stopCh:         make(chan struct{}),
+	}
+	if v.KeyField != "" {
+		if s.keyField, err = data.CompilePath(v.KeyField); err != nil {
+			return nil, fmt.Errorf("'key_field' parameter doesn't have a valid path: %v", err)
+		}
+	}
+	if v.Rewindable {
+		return core.NewRewindableSource(s), nil
+	}
+	return core.ImplementSourceStop(s), nil
+}
+
+func init() {
+	MustRegisterGlobalSourceCreator("s3", SourceCreatorFunc(createS3Source))
+	MustRegisterGlobalSinkCreator("s3", SinkCreatorFunc(createS3Sink))
+}
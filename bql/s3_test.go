@@ -0,0 +1,290 @@
+package bql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runTestS3Server runs a fake S3 server having a bucket named "archive". It
+// returns parameters to connect to the server and a client to inspect the
+// bucket.
+func runTestS3Server() (data.Map, *minio.Client) {
+	backend := s3mem.New()
+	So(backend.CreateBucket("archive"), ShouldBeNil)
+	srv := httptest.NewServer(gofakes3.New(backend, gofakes3.WithLogger(gofakes3.DiscardLog())).Server())
+	Reset(srv.Close)
+
+	endpoint := strings.TrimPrefix(srv.URL, "http://")
+	c, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4("key", "secret", ""),
+		Region: "us-east-1",
+	})
+	So(err, ShouldBeNil)
+	return data.Map{
+		"endpoint":          data.String(endpoint),
+		"region":            data.String("us-east-1"),
+		"secure":            data.False,
+		"access_key_id":     data.String("key"),
+		"secret_access_key": data.String("secret"),
+		"bucket":            data.String("archive"),
+	}, c
+}
+
+// listTestS3Objects returns the keys and the contents of objects in the
+// bucket. Gzipped objects are decompressed.
+func listTestS3Objects(c *minio.Client) ([]string, []string) {
+	var keys, contents []string
+	for info := range c.ListObjects(context.Background(), "archive", minio.ListObjectsOptions{Recursive: true}) {
+		So(info.Err, ShouldBeNil)
+		obj, err := c.GetObject(context.Background(), "archive", info.Key, minio.GetObjectOptions{})
+		So(err, ShouldBeNil)
+		b, err := ioutil.ReadAll(obj)
+		So(err, ShouldBeNil)
+		obj.Close()
+		if strings.HasSuffix(info.Key, ".gz") {
+			r, err := gzip.NewReader(bytes.NewReader(b))
+			So(err, ShouldBeNil)
+			b, err = ioutil.ReadAll(r)
+			So(err, ShouldBeNil)
+		}
+		keys = append(keys, info.Key)
+		contents = append(contents, string(b))
+	}
+	return keys, contents
+}
+
+func TestS3Sink(t *testing.T) {
+	Convey("Given an S3 server", t, func() {
+		params, c := runTestS3Server()
+		ctx := core.NewContext(nil)
+		ts := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+		newTuple := func(typ string, v int, sec int) *core.Tuple {
+			t := core.NewTuple(data.Map{"type": data.String(typ), "v": data.Int(v)})
+			t.Timestamp = ts.Add(time.Duration(sec) * time.Second)
+			return t
+		}
+
+		Convey("When writing tuples", func() {
+			params["key"] = data.String("logs/{type}/")
+			params["batch_size"] = data.Int(2)
+			s, err := createS3Sink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+			So(s.Write(ctx, newTuple("a", 1, 1)), ShouldBeNil)
+			So(s.Write(ctx, newTuple("a", 2, 0)), ShouldBeNil)
+			So(s.Write(ctx, newTuple("a", 3, 2)), ShouldBeNil)
+			So(s.Write(ctx, newTuple("b", 4, 3)), ShouldBeNil)
+
+			Convey("Then a full batch should be uploaded", func() {
+				st := s.(core.Statuser).Status()
+				So(st["num_written"], ShouldEqual, 2)
+				So(st["num_objects"], ShouldEqual, 1)
+				So(st["num_pending"], ShouldEqual, 2)
+
+				keys, contents := listTestS3Objects(c)
+				So(keys, ShouldHaveLength, 1)
+				So(keys[0], ShouldStartWith, "logs/a/20160102T030405.000000000Z-")
+				So(keys[0], ShouldEndWith, ".ndjson.gz")
+				So(contents[0], ShouldEqual, `{"@timestamp":"2016-01-02T03:04:06Z","type":"a","v":1}`+"\n"+
+					`{"@timestamp":"2016-01-02T03:04:05Z","type":"a","v":2}`+"\n")
+
+				Convey("And closing the sink should upload the rest", func() {
+					So(s.Close(ctx), ShouldBeNil)
+					keys, _ := listTestS3Objects(c)
+					So(keys, ShouldHaveLength, 3)
+					So(keys[1], ShouldStartWith, "logs/a/20160102T030407.000000000Z-")
+					So(keys[2], ShouldStartWith, "logs/b/20160102T030408.000000000Z-")
+					So(s.Write(ctx, newTuple("a", 5, 0)), ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("When writing tuples without compression", func() {
+			params["compression"] = data.String("none")
+			params["timestamp_field"] = data.String("")
+			params["flush_interval"] = data.String("50ms")
+			s, err := createS3Sink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+			So(s.Write(ctx, newTuple("a", 1, 0)), ShouldBeNil)
+
+			Convey("Then the batch should be uploaded after flush_interval", func() {
+				for i := 0; s.(core.Statuser).Status()["num_objects"] != data.Int(1); i++ {
+					So(i, ShouldBeLessThan, 1000)
+					time.Sleep(5 * time.Millisecond)
+				}
+				keys, contents := listTestS3Objects(c)
+				So(keys, ShouldHaveLength, 1)
+				So(keys[0], ShouldEndWith, ".ndjson")
+				So(contents[0], ShouldEqual, `{"type":"a","v":1}`+"\n")
+			})
+		})
+
+		Convey("When the bucket doesn't exist", func() {
+			params["bucket"] = data.String("missing")
+			params["batch_size"] = data.Int(1)
+			params["max_retries"] = data.Int(1)
+			params["retry_interval"] = data.String("1ms")
+			s, err := createS3Sink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+
+			Convey("Then writing should fail", func() {
+				So(s.Write(ctx, newTuple("a", 1, 0)), ShouldNotBeNil)
+				st := s.(core.Statuser).Status()
+				So(st["num_failed"], ShouldEqual, 1)
+				So(st["last_error"], ShouldNotBeNil)
+			})
+		})
+
+		Convey("When creating a sink with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"empty bucket":              {"bucket": data.String("")},
+				"empty endpoint":            {"endpoint": data.String("")},
+				"access key without secret": {"secret_access_key": data.String("")},
+				"invalid key":               {"key": data.String("{type")},
+				"unsupported compression":   {"compression": data.String("zstd")},
+				"zero batch_size":           {"batch_size": data.Int(0)},
+				"zero flush_interval":       {"flush_interval": data.Int(0)},
+				"negative max_retries":      {"max_retries": data.Int(-1)},
+				"zero timeout":              {"timeout": data.Int(0)},
+			}
+			for name, c := range cases {
+				c := c
+				Convey("Then "+name+" should result in an error", func() {
+					ps := params.Copy()
+					for k, v := range c {
+						ps[k] = v
+					}
+					_, err := createS3Sink(ctx, &IOParams{}, ps)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestS3Source(t *testing.T) {
+	Convey("Given an S3 bucket having objects", t, func() {
+		params, c := runTestS3Server()
+		ctx := core.NewContext(nil)
+
+		// The object under b/ has older tuples than the one under a/.
+		sinkParams := params.Copy()
+		sinkParams["key"] = data.String("logs/{type}/")
+		sink, err := createS3Sink(ctx, &IOParams{}, sinkParams)
+		So(err, ShouldBeNil)
+		ts := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+		for i, typ := range []string{"a", "b", "a", "b"} {
+			t := core.NewTuple(data.Map{"type": data.String(typ), "v": data.Int(i)})
+			t.Timestamp = ts.Add(time.Duration(i) * time.Second)
+			if typ == "a" {
+				t.Timestamp = t.Timestamp.Add(time.Hour)
+			}
+			So(sink.Write(ctx, t), ShouldBeNil)
+		}
+		So(sink.Close(ctx), ShouldBeNil)
+		body := "{\"v\":10}\nbroken\n{\"v\":11}"
+		_, err = c.PutObject(context.Background(), "archive", "logs/other.ndjson",
+			strings.NewReader(body), int64(len(body)), minio.PutObjectOptions{})
+		So(err, ShouldBeNil)
+
+		params["prefix"] = data.String("logs/")
+		params["key_field"] = data.String("key")
+		w := &testFileWriter{}
+		w.c = sync.NewCond(&w.m)
+		run := func() core.Source {
+			s, err := createS3Source(ctx, &IOParams{Name: "s3_test"}, params)
+			So(err, ShouldBeNil)
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, w)
+			}()
+			Reset(func() {
+				s.Stop(ctx)
+				<-ch
+			})
+			return s
+		}
+
+		Convey("When replaying the prefix", func() {
+			params["rewindable"] = data.True
+			s := run()
+
+			Convey("Then it should emit tuples in the order of timestamps", func() {
+				ds := w.snapshot(6)
+				vs := make([]data.Value, len(ds))
+				for i, d := range ds {
+					vs[i] = d["v"]
+				}
+				So(vs, ShouldResemble, []data.Value{data.Int(1), data.Int(3), data.Int(0), data.Int(2),
+					data.Int(10), data.Int(11)})
+				So(ds[0]["type"], ShouldEqual, "b")
+				So(ds[0], ShouldNotContainKey, "@timestamp")
+				key, _ := data.AsString(ds[0]["key"])
+				So(key, ShouldStartWith, "logs/b/")
+				So(ds[4]["key"], ShouldEqual, "logs/other.ndjson")
+				w.m.Lock()
+				So(w.tss[0], ShouldResemble, ts.Add(time.Second))
+				So(w.tss[2], ShouldResemble, ts.Add(time.Hour))
+				w.m.Unlock()
+
+				Convey("And it should replay them again after rewinding", func() {
+					So(s.(core.RewindableSource).Rewind(ctx), ShouldBeNil)
+					ds := w.snapshot(12)
+					So(ds[6]["v"], ShouldEqual, data.Int(1))
+				})
+			})
+		})
+
+		Convey("When replaying a prefix without objects", func() {
+			params["prefix"] = data.String("nothing/")
+			s, err := createS3Source(ctx, &IOParams{Name: "s3_test"}, params)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should emit no tuple", func() {
+				So(s.GenerateStream(ctx, w), ShouldBeNil)
+				So(w.ds, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When creating a source with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"empty bucket":        {"bucket": data.String("")},
+				"invalid key_field":   {"key_field": data.String("a[")},
+				"invalid json_number": {"json_number": data.String("decimal")},
+			}
+			for name, c := range cases {
+				c := c
+				Convey("Then "+name+" should result in an error", func() {
+					ps := params.Copy()
+					for k, v := range c {
+						ps[k] = v
+					}
+					_, err := createS3Source(ctx, &IOParams{Name: "s3_test"}, ps)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
@@ -0,0 +1,540 @@
+package bql
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// SourceRecord is a record fetched by a SourceIterator.
+type SourceRecord struct {
+	// Data is the data of the tuple emitted for the record.
+	Data data.Map
+
+	// Timestamp is the timestamp of the tuple. The time at which the tuple
+	// is emitted is used when it's zero.
+	Timestamp time.Time
+
+	// Offset is the position of the record in the stream. It's passed to
+	// Fetch to fetch records following this record, and it's saved as a
+	// checkpoint. It must be a value which can be saved in a UDS, e.g. an
+	// integer, a string, or a map.
+	Offset data.Value
+}
+
+// SourceIterator fetches records from an external system. A source created
+// from it by NewSourceFromIterator or NewRewindableSourceFromIterator calls
+// Fetch repeatedly from a single goroutine and emits the records as tuples.
+// The source handles pause and resume, rewind, checkpoints of offsets,
+// retries of failed calls with exponential backoff, and its status, so that
+// a SourceIterator only has to fetch and acknowledge records.
+type SourceIterator interface {
+	// Fetch returns records following the offset. The offset is nil when
+	// records should be fetched from the beginning of the stream, or from
+	// the default position such as the latest record when the stream
+	// doesn't have the beginning.
+	//
+	// Fetch should return an empty slice instead of blocking when no record
+	// is available, and it's called again after poll_interval. It returns
+	// io.EOF when the stream has ended. Other errors are retried.
+	Fetch(ctx *core.Context, offset data.Value) ([]*SourceRecord, error)
+
+	// Ack acknowledges all records up to the offset after they've been
+	// emitted. A record which has been emitted but not acknowledged can be
+	// fetched again after the source is restarted or an error occurs, so
+	// the source provides at-least-once delivery.
+	Ack(ctx *core.Context, offset data.Value) error
+}
+
+// ClosableSourceIterator is a SourceIterator which has resources released
+// when the source is stopped or, unless the source is rewindable, when the
+// stream has ended. Close is called only once after Fetch and Ack return.
+type ClosableSourceIterator interface {
+	SourceIterator
+
+	Close(ctx *core.Context) error
+}
+
+// SourceIteratorConfig has parameters of a source created from a
+// SourceIterator. DefaultSourceIteratorConfig or NewSourceIteratorConfig
+// should be used to create it.
+type SourceIteratorConfig struct {
+	// CheckpointState is the name of a UDS implementing
+	// SourceCheckpointState. The offset of the last acknowledged record is
+	// saved to the UDS, and the source resumes from the offset when it
+	// starts. Offsets aren't saved when it's empty.
+	CheckpointState string
+
+	// CheckpointKey is the key of the offset saved in the UDS. The name of
+	// the source is used when it's empty.
+	CheckpointKey string
+
+	// PollInterval is the duration for which the source waits when Fetch
+	// returns no record.
+	PollInterval time.Duration
+
+	// MinRetryInterval is the initial interval of retries after Fetch or
+	// Ack fails. The interval doubles on each retry up to MaxRetryInterval.
+	MinRetryInterval time.Duration
+	MaxRetryInterval time.Duration
+
+	// MaxRetries is the number of consecutive retries after which the
+	// source stops with the error. The source retries forever when it's
+	// negative.
+	MaxRetries int
+}
+
+// DefaultSourceIteratorConfig returns the default config.
+func DefaultSourceIteratorConfig() *SourceIteratorConfig {
+	return &SourceIteratorConfig{
+		PollInterval:     time.Second,
+		MinRetryInterval: time.Second,
+		MaxRetryInterval: time.Minute,
+		MaxRetries:       -1,
+	}
+}
+
+// NewSourceIteratorConfig creates a config from parameters given to a source
+// creator. It accepts following parameters and removes them from params so
+// that the creator can decode the rest:
+//
+//   - checkpoint_state: the name of the UDS to which offsets are saved
+//   - checkpoint_key: the key of the offset in the UDS (default: the name
+//     of the source)
+//   - poll_interval: the interval of polling when no record is available
+//     (default: 1s)
+//   - min_retry_interval, max_retry_interval: the range of the interval of
+//     retries (default: 1s and 1m)
+//   - max_retries: the number of retries before the source stops
+//     (default: -1, retrying forever)
+func NewSourceIteratorConfig(params data.Map) (*SourceIteratorConfig, error) {
+	keys := []string{"checkpoint_state", "checkpoint_key", "poll_interval",
+		"min_retry_interval", "max_retry_interval", "max_retries"}
+	ps := data.Map{}
+	for _, k := range keys {
+		if v, ok := params[k]; ok {
+			ps[k] = v
+		}
+	}
+	c := DefaultSourceIteratorConfig()
+	if err := data.Decode(ps, c); err != nil {
+		return nil, err
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		delete(params, k)
+	}
+	return c, nil
+}
+
+func (c *SourceIteratorConfig) validate() error {
+	if c.PollInterval <= 0 {
+		return fmt.Errorf("poll_interval must be positive: %v", c.PollInterval)
+	}
+	if c.MinRetryInterval <= 0 {
+		return fmt.Errorf("min_retry_interval must be positive: %v", c.MinRetryInterval)
+	}
+	if c.MaxRetryInterval < c.MinRetryInterval {
+		return fmt.Errorf("max_retry_interval must be greater than or equal to min_retry_interval: %v", c.MaxRetryInterval)
+	}
+	return nil
+}
+
+// NewSourceFromIterator creates a source emitting records fetched by the
+// iterator. The source can be paused and resumed.
+func NewSourceFromIterator(ioParams *IOParams, it SourceIterator, c *SourceIteratorConfig) (core.Source, error) {
+	s, err := newIteratorSource(ioParams, it, c, false)
+	if err != nil {
+		return nil, err
+	}
+	return core.ImplementSourceStop(s), nil
+}
+
+// NewRewindableSourceFromIterator creates a rewindable source emitting
+// records fetched by the iterator. When it's rewound, it fetches records
+// from the beginning by passing nil to SourceIterator.Fetch.
+func NewRewindableSourceFromIterator(ioParams *IOParams, it SourceIterator, c *SourceIteratorConfig) (core.RewindableSource, error) {
+	s, err := newIteratorSource(ioParams, it, c, true)
+	if err != nil {
+		return nil, err
+	}
+	return core.NewRewindableSource(s), nil
+}
+
+// iteratorSource emits records fetched by a SourceIterator. It's wrapped by
+// core.NewRewindableSource or core.ImplementSourceStop, which handle pause,
+// resume, and rewind.
+type iteratorSource struct {
+	ioParams   *IOParams
+	it         SourceIterator
+	config     SourceIteratorConfig
+	rewindable bool
+
+	stopOnce  sync.Once
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+
+	m          sync.Mutex
+	started    bool
+	stopped    bool
+	offset     data.Value
+	numEmitted int64
+	numFetches int64
+	numRetries int64
+	lastError  error
+}
+
+func newIteratorSource(ioParams *IOParams, it SourceIterator, c *SourceIteratorConfig, rewindable bool) (*iteratorSource, error) {
+	if c == nil {
+		c = DefaultSourceIteratorConfig()
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	s := &iteratorSource{
+		ioParams:   ioParams,
+		it:         it,
+		config:     *c,
+		rewindable: rewindable,
+		stopCh:     make(chan struct{}),
+	}
+	if s.config.CheckpointKey == "" {
+		s.config.CheckpointKey = ioParams.Name
+	}
+	return s, nil
+}
+
+func (s *iteratorSource) GenerateStream(ctx *core.Context, w core.Writer) error {
+	s.m.Lock()
+	if s.stopped {
+		s.m.Unlock()
+		return nil
+	}
+	s.wg.Add(1)
+	rewound := s.started
+	s.started = true
+	s.m.Unlock()
+	defer s.wg.Done()
+	if !s.rewindable {
+		// Stop of the wrapper isn't called after the stream has ended, so
+		// the iterator is closed here.
+		defer func() {
+			if err := s.close(ctx); err != nil {
+				ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
+					Warning("Cannot close the iterator")
+			}
+		}()
+	}
+
+	cp, err := s.checkpointState(ctx)
+	if err != nil {
+		return err
+	}
+	var offset data.Value
+	if cp != nil && !rewound {
+		// The source starts from the beginning after it's rewound.
+		if offset, err = cp.LoadCheckpoint(ctx, s.config.CheckpointKey); err != nil {
+			return fmt.Errorf("cannot load the checkpoint: %v", err)
+		}
+	}
+	s.m.Lock()
+	s.offset = offset
+	s.m.Unlock()
+
+	retries := 0
+	interval := s.config.MinRetryInterval
+	for {
+		s.m.Lock()
+		s.numFetches++
+		s.m.Unlock()
+		recs, err := s.it.Fetch(ctx, offset)
+		if err == io.EOF {
+			return nil
+		}
+		if err == nil {
+			n, werr := s.emit(ctx, w, recs)
+			if n > 0 {
+				offset = recs[n-1].Offset
+				err = s.ack(ctx, cp, offset)
+			}
+			if werr == core.ErrSourceRewound || werr == core.ErrSourceStopped {
+				return werr
+			}
+			if werr != nil {
+				err = werr
+			}
+		}
+
+		if err != nil {
+			s.m.Lock()
+			s.lastError = err
+			s.m.Unlock()
+			if s.config.MaxRetries >= 0 && retries >= s.config.MaxRetries {
+				return err
+			}
+			ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
+				WithField("retry_after", interval.String()).
+				Warning("Cannot fetch records")
+			if !s.wait(interval) {
+				return nil
+			}
+			retries++
+			s.m.Lock()
+			s.numRetries++
+			s.m.Unlock()
+			if interval *= 2; interval > s.config.MaxRetryInterval {
+				interval = s.config.MaxRetryInterval
+			}
+			continue
+		}
+
+		retries = 0
+		interval = s.config.MinRetryInterval
+		if len(recs) == 0 && !s.wait(s.config.PollInterval) {
+			return nil
+		}
+		select {
+		case <-s.stopCh:
+			return nil
+		default:
+		}
+	}
+}
+
+// wait waits for the duration. It returns false when the source is stopped
+// while waiting.
+func (s *iteratorSource) wait(d time.Duration) bool {
+	select {
+	case <-s.stopCh:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// emit writes records as tuples and returns the number of records written.
+func (s *iteratorSource) emit(ctx *core.Context, w core.Writer, recs []*SourceRecord) (int, error) {
+	for i, r := range recs {
+		t := core.NewTuple(r.Data)
+		if !r.Timestamp.IsZero() {
+			t.Timestamp = r.Timestamp
+		}
+		if err := w.Write(ctx, t); err != nil {
+			return i, err
+		}
+		s.m.Lock()
+		s.numEmitted++
+		s.m.Unlock()
+	}
+	return len(recs), nil
+}
+
+// ack acknowledges records up to the offset and saves the offset to the
+// checkpoint. A failure of saving the checkpoint is only logged because the
+// records have already been acknowledged.
+func (s *iteratorSource) ack(ctx *core.Context, cp SourceCheckpointState, offset data.Value) error {
+	s.m.Lock()
+	s.offset = offset
+	s.m.Unlock()
+	if err := s.it.Ack(ctx, offset); err != nil {
+		return err
+	}
+	if cp == nil {
+		return nil
+	}
+	if err := cp.SaveCheckpoint(ctx, s.config.CheckpointKey, offset); err != nil {
+		ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
+			WithField("checkpoint_state", s.config.CheckpointState).
+			Warning("Cannot save the checkpoint")
+	}
+	return nil
+}
+
+func (s *iteratorSource) checkpointState(ctx *core.Context) (SourceCheckpointState, error) {
+	if s.config.CheckpointState == "" {
+		return nil, nil
+	}
+	st, err := ctx.SharedStates.Get(s.config.CheckpointState)
+	if err != nil {
+		return nil, err
+	}
+	cp, ok := st.(SourceCheckpointState)
+	if !ok {
+		return nil, fmt.Errorf("the state '%v' cannot store checkpoints", s.config.CheckpointState)
+	}
+	return cp, nil
+}
+
+func (s *iteratorSource) Stop(ctx *core.Context) error {
+	s.m.Lock()
+	s.stopped = true
+	s.m.Unlock()
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+
+	// The iterator is closed after GenerateStream returns so that Close
+	// isn't called while Fetch or Ack is running.
+	s.wg.Wait()
+	return s.close(ctx)
+}
+
+// close closes the iterator if it implements ClosableSourceIterator. The
+// iterator is closed only once.
+func (s *iteratorSource) close(ctx *core.Context) error {
+	s.closeOnce.Do(func() {
+		if c, ok := s.it.(ClosableSourceIterator); ok {
+			s.closeErr = c.Close(ctx)
+		}
+	})
+	return s.closeErr
+}
+
+func (s *iteratorSource) Status() data.Map {
+	s.m.Lock()
+	defer s.m.Unlock()
+	st := data.Map{
+		"num_emitted": data.Int(s.numEmitted),
+		"num_fetches": data.Int(s.numFetches),
+		"num_retries": data.Int(s.numRetries),
+		"offset":      data.Null{},
+	}
+	if s.offset != nil {
+		st["offset"] = s.offset
+	}
+	if s.config.CheckpointState != "" {
+		st["checkpoint_state"] = data.String(s.config.CheckpointState)
+	}
+	if s.lastError != nil {
+		st["last_error"] = data.String(s.lastError.Error())
+	}
+	return st
+}
+
+// SourceCheckpointState is a UDS to which sources created from
+// SourceIterators save offsets.
+type SourceCheckpointState interface {
+	core.SharedState
+
+	// LoadCheckpoint returns the offset saved with the key. It returns nil
+	// when no offset has been saved.
+	LoadCheckpoint(ctx *core.Context, key string) (data.Value, error)
+
+	// SaveCheckpoint saves the offset with the key.
+	SaveCheckpoint(ctx *core.Context, key string, offset data.Value) error
+}
+
+// sourceCheckpointState is a SourceCheckpointState keeping offsets in
+// memory. Offsets can be persisted by SAVE STATE and restored by LOAD STATE,
+// and they can be looked up by the lookup function for debugging.
+type sourceCheckpointState struct {
+	m       sync.RWMutex
+	offsets data.Map
+}
+
+var (
+	_ SourceCheckpointState      = &sourceCheckpointState{}
+	_ core.LookupableSharedState = &sourceCheckpointState{}
+	_ core.SavableSharedState    = &sourceCheckpointState{}
+	_ core.LoadableSharedState   = &sourceCheckpointState{}
+)
+
+func (s *sourceCheckpointState) LoadCheckpoint(ctx *core.Context, key string) (data.Value, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.offsets[key], nil
+}
+
+func (s *sourceCheckpointState) SaveCheckpoint(ctx *core.Context, key string, offset data.Value) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.offsets[key] = offset
+	return nil
+}
+
+func (s *sourceCheckpointState) Lookup(ctx *core.Context, key data.Value) (data.Value, error) {
+	k, err := data.AsString(key)
+	if err != nil {
+		return nil, err
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	v, ok := s.offsets[k]
+	if !ok {
+		return nil, core.NotExistError(fmt.Errorf("the checkpoint doesn't exist: %v", k))
+	}
+	return v, nil
+}
+
+func (s *sourceCheckpointState) Save(ctx *core.Context, w io.Writer, params data.Map) error {
+	s.m.RLock()
+	b, err := data.MarshalMsgpack(s.offsets)
+	s.m.RUnlock()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (s *sourceCheckpointState) Load(ctx *core.Context, r io.Reader, params data.Map) error {
+	offsets, err := loadSourceCheckpoints(r)
+	if err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.offsets = offsets
+	return nil
+}
+
+func (s *sourceCheckpointState) Terminate(ctx *core.Context) error {
+	return nil
+}
+
+func loadSourceCheckpoints(r io.Reader) (data.Map, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return data.UnmarshalMsgpack(b)
+}
+
+type sourceCheckpointStateCreator struct{}
+
+var _ udf.UDSLoader = &sourceCheckpointStateCreator{}
+
+// CreateState creates a source_checkpoint state. It doesn't accept any
+// parameter.
+func (c *sourceCheckpointStateCreator) CreateState(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	if len(params) != 0 {
+		return nil, errors.New("source_checkpoint doesn't accept parameters")
+	}
+	return &sourceCheckpointState{
+		offsets: data.Map{},
+	}, nil
+}
+
+func (c *sourceCheckpointStateCreator) LoadState(ctx *core.Context, r io.Reader, params data.Map) (core.SharedState, error) {
+	offsets, err := loadSourceCheckpoints(r)
+	if err != nil {
+		return nil, err
+	}
+	return &sourceCheckpointState{
+		offsets: offsets,
+	}, nil
+}
+
+func init() {
+	udf.MustRegisterGlobalUDSCreator("source_checkpoint", &sourceCheckpointStateCreator{})
+}
@@ -0,0 +1,324 @@
+package bql
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSourceIterator iterates over records. The offset of a record is its
+// index plus one.
+type testSourceIterator struct {
+	m         sync.Mutex
+	records   []data.Map
+	batchSize int
+	eof       bool
+	fetchErrs int
+	acks      []data.Value
+	closed    bool
+}
+
+func newTestSourceIterator(n int) *testSourceIterator {
+	it := &testSourceIterator{batchSize: 2}
+	it.add(n)
+	return it
+}
+
+func (it *testSourceIterator) add(n int) {
+	it.m.Lock()
+	defer it.m.Unlock()
+	for i := 0; i < n; i++ {
+		it.records = append(it.records, data.Map{"v": data.Int(len(it.records))})
+	}
+}
+
+func (it *testSourceIterator) Fetch(ctx *core.Context, offset data.Value) ([]*SourceRecord, error) {
+	it.m.Lock()
+	defer it.m.Unlock()
+	if it.fetchErrs > 0 {
+		it.fetchErrs--
+		return nil, errors.New("temporary failure")
+	}
+
+	start := 0
+	if offset != nil {
+		i, err := data.AsInt(offset)
+		if err != nil {
+			return nil, err
+		}
+		start = int(i)
+	}
+	if start >= len(it.records) {
+		if it.eof {
+			return nil, io.EOF
+		}
+		return nil, nil
+	}
+	var recs []*SourceRecord
+	for i := start; i < len(it.records) && i < start+it.batchSize; i++ {
+		recs = append(recs, &SourceRecord{
+			Data:      it.records[i],
+			Timestamp: time.Date(2016, 1, 2, 3, 4, i, 0, time.UTC),
+			Offset:    data.Int(i + 1),
+		})
+	}
+	return recs, nil
+}
+
+func (it *testSourceIterator) Ack(ctx *core.Context, offset data.Value) error {
+	it.m.Lock()
+	defer it.m.Unlock()
+	it.acks = append(it.acks, offset)
+	return nil
+}
+
+func (it *testSourceIterator) Close(ctx *core.Context) error {
+	it.m.Lock()
+	defer it.m.Unlock()
+	it.closed = true
+	return nil
+}
+
+func TestSourceFromIterator(t *testing.T) {
+	Convey("Given a source iterator", t, func() {
+		ctx := core.NewContext(nil)
+		it := newTestSourceIterator(3)
+		c := DefaultSourceIteratorConfig()
+		c.PollInterval = 10 * time.Millisecond
+		c.MinRetryInterval = time.Millisecond
+		c.MaxRetryInterval = 2 * time.Millisecond
+		w := &testFileWriter{}
+		w.c = sync.NewCond(&w.m)
+		run := func(s core.Source) {
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, w)
+			}()
+			Reset(func() {
+				s.Stop(ctx)
+				<-ch
+			})
+		}
+
+		Convey("When the stream ends", func() {
+			it.eof = true
+			s, err := NewSourceFromIterator(&IOParams{Name: "iter_test"}, it, c)
+			So(err, ShouldBeNil)
+			So(s.GenerateStream(ctx, w), ShouldBeNil)
+
+			Convey("Then it should emit and acknowledge all records", func() {
+				So(w.ds, ShouldResemble, []data.Map{{"v": data.Int(0)}, {"v": data.Int(1)}, {"v": data.Int(2)}})
+				So(w.tss[2], ShouldResemble, time.Date(2016, 1, 2, 3, 4, 2, 0, time.UTC))
+				So(it.acks, ShouldResemble, []data.Value{data.Int(2), data.Int(3)})
+
+				st := s.(core.Statuser).Status()["internal_source"].(data.Map)
+				So(st["num_emitted"], ShouldEqual, 3)
+				So(st["offset"], ShouldEqual, 3)
+			})
+
+			Convey("Then the iterator should be closed", func() {
+				So(it.closed, ShouldBeTrue)
+				So(s.Stop(ctx), ShouldBeNil)
+			})
+		})
+
+		Convey("When Fetch fails temporarily", func() {
+			it.eof = true
+			it.fetchErrs = 2
+			s, err := NewSourceFromIterator(&IOParams{Name: "iter_test"}, it, c)
+			So(err, ShouldBeNil)
+			So(s.GenerateStream(ctx, w), ShouldBeNil)
+
+			Convey("Then it should retry and emit all records", func() {
+				So(w.ds, ShouldHaveLength, 3)
+				st := s.(core.Statuser).Status()["internal_source"].(data.Map)
+				So(st["num_retries"], ShouldEqual, 2)
+				So(st["last_error"], ShouldEqual, "temporary failure")
+			})
+		})
+
+		Convey("When Fetch fails more than max_retries", func() {
+			it.fetchErrs = 3
+			c.MaxRetries = 2
+			s, err := NewSourceFromIterator(&IOParams{Name: "iter_test"}, it, c)
+			So(err, ShouldBeNil)
+
+			Convey("Then the source should stop with the error", func() {
+				So(s.GenerateStream(ctx, w), ShouldNotBeNil)
+				So(w.ds, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When writing tuples fails", func() {
+			c.MaxRetries = 1
+			s, err := NewSourceFromIterator(&IOParams{Name: "iter_test"}, it, c)
+			So(err, ShouldBeNil)
+
+			Convey("Then records shouldn't be acknowledged", func() {
+				So(s.GenerateStream(ctx, testFailingWriter{}), ShouldNotBeNil)
+				So(it.acks, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When saving checkpoints", func() {
+			cp, err := (&sourceCheckpointStateCreator{}).CreateState(ctx, data.Map{})
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add("cp", "source_checkpoint", cp), ShouldBeNil)
+			c.CheckpointState = "cp"
+			s, err := NewSourceFromIterator(&IOParams{Name: "iter_test"}, it, c)
+			So(err, ShouldBeNil)
+			run(s)
+			w.snapshot(3)
+			So(s.Stop(ctx), ShouldBeNil)
+			So(it.closed, ShouldBeTrue)
+
+			Convey("Then the offset should be saved", func() {
+				v, err := cp.(SourceCheckpointState).LoadCheckpoint(ctx, "iter_test")
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(3))
+
+				Convey("And a new source should resume from the offset", func() {
+					it.add(2)
+					s, err := NewSourceFromIterator(&IOParams{Name: "iter_test"}, it, c)
+					So(err, ShouldBeNil)
+					run(s)
+					ds := w.snapshot(5)
+					So(ds[3], ShouldResemble, data.Map{"v": data.Int(3)})
+					So(ds[4], ShouldResemble, data.Map{"v": data.Int(4)})
+				})
+			})
+		})
+
+		Convey("When the checkpoint state doesn't exist", func() {
+			c.CheckpointState = "missing"
+			s, err := NewSourceFromIterator(&IOParams{Name: "iter_test"}, it, c)
+			So(err, ShouldBeNil)
+
+			Convey("Then the source should fail", func() {
+				So(s.GenerateStream(ctx, w), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When rewinding a rewindable source", func() {
+			it.eof = true
+			s, err := NewRewindableSourceFromIterator(&IOParams{Name: "iter_test"}, it, c)
+			So(err, ShouldBeNil)
+			run(s)
+			w.snapshot(3)
+			So(s.Rewind(ctx), ShouldBeNil)
+
+			Convey("Then it should emit records from the beginning", func() {
+				ds := w.snapshot(6)
+				So(ds[3], ShouldResemble, data.Map{"v": data.Int(0)})
+			})
+		})
+
+		Convey("When creating a source with an invalid config", func() {
+			c.MaxRetryInterval = 0
+
+			Convey("Then it should fail", func() {
+				_, err := NewSourceFromIterator(&IOParams{Name: "iter_test"}, it, c)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestNewSourceIteratorConfig(t *testing.T) {
+	Convey("Given parameters of a source", t, func() {
+		params := data.Map{
+			"checkpoint_state": data.String("cp"),
+			"poll_interval":    data.String("5s"),
+			"max_retries":      data.Int(3),
+			"topic":            data.String("t"),
+		}
+
+		Convey("When creating a config", func() {
+			c, err := NewSourceIteratorConfig(params)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have the parameters and defaults", func() {
+				So(c.CheckpointState, ShouldEqual, "cp")
+				So(c.PollInterval, ShouldEqual, 5*time.Second)
+				So(c.MaxRetries, ShouldEqual, 3)
+				So(c.MinRetryInterval, ShouldEqual, time.Second)
+			})
+
+			Convey("Then only parameters of the source should remain", func() {
+				So(params, ShouldResemble, data.Map{"topic": data.String("t")})
+			})
+		})
+
+		Convey("When creating a config with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"zero poll_interval":      {"poll_interval": data.Int(0)},
+				"zero min_retry_interval": {"min_retry_interval": data.Int(0)},
+				"invalid retry range":     {"min_retry_interval": data.Int(2), "max_retry_interval": data.Int(1)},
+			}
+			for name, c := range cases {
+				c := c
+				Convey(fmt.Sprintf("Then %v should result in an error", name), func() {
+					_, err := NewSourceIteratorConfig(c)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestSourceCheckpointState(t *testing.T) {
+	Convey("Given a source_checkpoint state", t, func() {
+		ctx := core.NewContext(nil)
+		c := &sourceCheckpointStateCreator{}
+		st, err := c.CreateState(ctx, data.Map{})
+		So(err, ShouldBeNil)
+		s := st.(*sourceCheckpointState)
+		offset := data.Map{"seq": data.Int(42)}
+		So(s.SaveCheckpoint(ctx, "src", offset), ShouldBeNil)
+
+		Convey("When looking up the checkpoint", func() {
+			v, err := s.Lookup(ctx, data.String("src"))
+			So(err, ShouldBeNil)
+
+			Convey("Then it should return the offset", func() {
+				So(v, ShouldResemble, offset)
+				_, err := s.Lookup(ctx, data.String("other"))
+				So(core.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+
+		Convey("When saving and loading the state", func() {
+			buf := bytes.NewBuffer(nil)
+			So(s.Save(ctx, buf, data.Map{}), ShouldBeNil)
+			b := buf.Bytes()
+			loaded, err := c.LoadState(ctx, bytes.NewReader(b), data.Map{})
+			So(err, ShouldBeNil)
+			So(s.SaveCheckpoint(ctx, "src", data.Int(1)), ShouldBeNil)
+			So(s.Load(ctx, bytes.NewReader(b), data.Map{}), ShouldBeNil)
+
+			Convey("Then the checkpoints should be restored", func() {
+				v, err := loaded.(SourceCheckpointState).LoadCheckpoint(ctx, "src")
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, offset)
+				v, err = s.LoadCheckpoint(ctx, "src")
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, offset)
+			})
+		})
+
+		Convey("When creating a state with parameters", func() {
+			_, err := c.CreateState(ctx, data.Map{"a": data.Int(1)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,550 @@
+package bql
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	// drivers used by the sql sink
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// sqlDialect has differences of SQL among database products.
+type sqlDialect struct {
+	// quote quotes an identifier such as a table name or a column name.
+	quote func(name string) string
+
+	// placeholder returns the i-th (0-origin) placeholder of a statement.
+	placeholder func(i int) string
+
+	// upsert returns the clause appended to INSERT to update existing rows.
+	// keys are quoted names of columns having a unique constraint and
+	// updates are quoted names of the other columns.
+	upsert func(keys, updates []string) string
+
+	// maxPlaceholders is the maximum number of placeholders in a statement.
+	maxPlaceholders int
+}
+
+var postgresDialect = &sqlDialect{
+	quote: func(name string) string {
+		return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+	},
+	placeholder: func(i int) string {
+		return fmt.Sprint("$", i+1)
+	},
+	upsert: func(keys, updates []string) string {
+		if len(updates) == 0 {
+			return fmt.Sprintf(" ON CONFLICT (%v) DO NOTHING", strings.Join(keys, ", "))
+		}
+		sets := make([]string, len(updates))
+		for i, c := range updates {
+			sets[i] = fmt.Sprintf("%v = EXCLUDED.%v", c, c)
+		}
+		return fmt.Sprintf(" ON CONFLICT (%v) DO UPDATE SET %v", strings.Join(keys, ", "), strings.Join(sets, ", "))
+	},
+	maxPlaceholders: 65535,
+}
+
+var mysqlDialect = &sqlDialect{
+	quote: func(name string) string {
+		return "`" + strings.Replace(name, "`", "``", -1) + "`"
+	},
+	placeholder: func(i int) string {
+		return "?"
+	},
+	upsert: func(keys, updates []string) string {
+		if len(updates) == 0 {
+			// updating a key with itself doesn't change anything
+			updates = keys[:1]
+		}
+		sets := make([]string, len(updates))
+		for i, c := range updates {
+			sets[i] = fmt.Sprintf("%v = VALUES(%v)", c, c)
+		}
+		return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+	},
+	maxPlaceholders: 65535,
+}
+
+// sqlDialects has dialects of supported drivers.
+var sqlDialects = map[string]*sqlDialect{
+	"postgres": postgresDialect,
+	"mysql":    mysqlDialect,
+}
+
+type sqlColumn struct {
+	name string
+
+	// path is the path of the value. When it's nil, the value is looked up
+	// by the name as a key of the top-level map.
+	path data.Path
+}
+
+// sqlValue converts a value to a value which database/sql accepts. Arrays and
+// maps are stored as JSON.
+func sqlValue(v data.Value) interface{} {
+	switch v.Type() {
+	case data.TypeNull:
+		return nil
+	case data.TypeBool:
+		b, _ := data.AsBool(v)
+		return b
+	case data.TypeInt:
+		i, _ := data.AsInt(v)
+		return i
+	case data.TypeFloat:
+		f, _ := data.AsFloat(v)
+		return f
+	case data.TypeString:
+		s, _ := data.AsString(v)
+		return s
+	case data.TypeBlob:
+		b, _ := data.AsBlob(v)
+		return b
+	case data.TypeTimestamp:
+		t, _ := data.AsTimestamp(v)
+		return t
+	default:
+		return v.String()
+	}
+}
+
+type sqlSink struct {
+	db      *sql.DB
+	dialect *sqlDialect
+	table   string
+
+	// columns are nil until the first tuple arrives when they're inferred.
+	columns    []sqlColumn
+	upsertKeys []string
+
+	batchSize     int
+	maxRetries    int
+	retryInterval time.Duration
+
+	m          sync.Mutex
+	rows       [][]interface{}
+	numWritten int64
+	numFailed  int64
+	lastError  error
+	closed     bool
+	stopOnce   sync.Once
+	stopCh     chan struct{}
+	doneCh     chan struct{}
+}
+
+func (s *sqlSink) Write(ctx *core.Context, t *core.Tuple) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return errors.New("the sink is already closed")
+	}
+
+	if s.columns == nil {
+		cs, err := s.inferColumns(t.Data)
+		if err != nil {
+			return err
+		}
+		s.columns = cs
+	}
+
+	row := make([]interface{}, len(s.columns))
+	for i, c := range s.columns {
+		var v data.Value
+		if c.path == nil {
+			v = t.Data[c.name]
+		} else {
+			v, _ = t.Data.Get(c.path) // a missing value is written as NULL
+		}
+		if v != nil {
+			row[i] = sqlValue(v)
+		}
+	}
+	s.rows = append(s.rows, row)
+	if len(s.rows) < s.batchSize {
+		return nil
+	}
+	return s.flush()
+}
+
+// inferColumns creates columns from the top-level fields of a tuple.
+func (s *sqlSink) inferColumns(m data.Map) ([]sqlColumn, error) {
+	if len(m) == 0 {
+		return nil, errors.New("cannot infer columns from an empty tuple")
+	}
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	if err := s.validateColumns(names); err != nil {
+		return nil, err
+	}
+	cs := make([]sqlColumn, len(names))
+	for i, n := range names {
+		cs[i] = sqlColumn{name: n}
+	}
+	return cs, nil
+}
+
+func (s *sqlSink) validateColumns(names []string) error {
+	if s.batchSize*len(names) > s.dialect.maxPlaceholders {
+		return fmt.Errorf("batch_size * the number of columns must be at most %v", s.dialect.maxPlaceholders)
+	}
+	for _, k := range s.upsertKeys {
+		found := false
+		for _, n := range names {
+			if k == n {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("upsert key %v isn't a column", k)
+		}
+	}
+	return nil
+}
+
+// flush writes buffered rows to the database. It retries writing them when
+// it fails, and drops them after all retries fail. The caller must hold the
+// lock.
+func (s *sqlSink) flush() error {
+	if len(s.rows) == 0 {
+		return nil
+	}
+	rows := s.dedupRows(s.rows)
+	s.rows = nil
+
+	var err error
+	wait := s.retryInterval
+	for i := 0; ; i++ {
+		if _, err = s.db.Exec(s.insertStatement(len(rows)), flattenRows(rows)...); err == nil {
+			s.numWritten += int64(len(rows))
+			return nil
+		}
+		if i >= s.maxRetries {
+			break
+		}
+
+		// database/sql reconnects to the database when a connection is
+		// broken, so retrying the same statement is sufficient.
+		select {
+		case <-s.stopCh:
+			// retry immediately while closing
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+	s.numFailed += int64(len(rows))
+	s.lastError = err
+	return fmt.Errorf("cannot write %v tuples to %v: %v", len(rows), s.table, err)
+}
+
+// dedupRows removes rows having the same upsert keys as later rows because
+// some databases don't allow a statement to update the same row twice.
+func (s *sqlSink) dedupRows(rows [][]interface{}) [][]interface{} {
+	if len(s.upsertKeys) == 0 {
+		return rows
+	}
+	var idx []int
+	for _, k := range s.upsertKeys {
+		for i, c := range s.columns {
+			if c.name == k {
+				idx = append(idx, i)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	res := make([][]interface{}, 0, len(rows))
+	for i := len(rows) - 1; i >= 0; i-- {
+		b := bytes.NewBuffer(nil)
+		for _, j := range idx {
+			fmt.Fprintf(b, "%T:%v\x00", rows[i][j], rows[i][j])
+		}
+		if seen[b.String()] {
+			continue
+		}
+		seen[b.String()] = true
+		res = append(res, rows[i])
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
+func (s *sqlSink) insertStatement(n int) string {
+	q := s.dialect.quote
+	cols := make([]string, len(s.columns))
+	for i, c := range s.columns {
+		cols[i] = q(c.name)
+	}
+
+	b := bytes.NewBuffer(nil)
+	fmt.Fprintf(b, "INSERT INTO %v (%v) VALUES ", s.quoteTable(), strings.Join(cols, ", "))
+	p := 0
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for j := range s.columns {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(s.dialect.placeholder(p))
+			p++
+		}
+		b.WriteString(")")
+	}
+
+	if len(s.upsertKeys) > 0 {
+		isKey := map[string]bool{}
+		keys := make([]string, len(s.upsertKeys))
+		for i, k := range s.upsertKeys {
+			isKey[k] = true
+			keys[i] = q(k)
+		}
+		var updates []string
+		for _, c := range s.columns {
+			if !isKey[c.name] {
+				updates = append(updates, q(c.name))
+			}
+		}
+		b.WriteString(s.dialect.upsert(keys, updates))
+	}
+	return b.String()
+}
+
+// quoteTable quotes the table name which can be qualified with a schema or a
+// database name, e.g. "public.events".
+func (s *sqlSink) quoteTable() string {
+	parts := strings.Split(s.table, ".")
+	for i, p := range parts {
+		parts[i] = s.dialect.quote(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+func flattenRows(rows [][]interface{}) []interface{} {
+	var args []interface{}
+	for _, r := range rows {
+		args = append(args, r...)
+	}
+	return args
+}
+
+// flushPeriodically writes buffered rows every flush_interval.
+func (s *sqlSink) flushPeriodically(ctx *core.Context, interval time.Duration) {
+	defer close(s.doneCh)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-t.C:
+		}
+
+		s.m.Lock()
+		if err := s.flush(); err != nil {
+			ctx.ErrLog(err).WithField("table", s.table).Error("Cannot write tuples to the database")
+		}
+		s.m.Unlock()
+	}
+}
+
+func (s *sqlSink) Close(ctx *core.Context) error {
+	// stopCh is closed without the lock so that retries in flush can be
+	// interrupted.
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+	<-s.doneCh
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	err := s.flush()
+	if e := s.db.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Status returns the status of the sink.
+func (s *sqlSink) Status() data.Map {
+	s.m.Lock()
+	defer s.m.Unlock()
+	st := data.Map{
+		"table":       data.String(s.table),
+		"num_written": data.Int(s.numWritten),
+		"num_failed":  data.Int(s.numFailed),
+		"num_pending": data.Int(len(s.rows)),
+	}
+	if s.lastError != nil {
+		st["last_error"] = data.String(s.lastError.Error())
+	}
+	return st
+}
+
+// createSQLSink creates an rdbms sink inserting tuples into a table of a
+// relational database. It accepts following parameters:
+//
+//   - driver: "postgres" or "mysql" (required)
+//   - dsn: the data source name passed to the driver (required)
+//   - table: the name of the table, which can be qualified (required)
+//   - columns: an array of column names or a map from column names to paths
+//     of values. When it's an array, each name is also used as a path. When
+//     it's omitted, the top-level fields of the first tuple become columns.
+//   - upsert_keys: an array of columns having a unique constraint. When it's
+//     given, an existing row having the same keys is updated.
+//   - batch_size: the maximum number of tuples inserted by a statement
+//     (default: 100)
+//   - flush_interval: the interval at which buffered tuples are inserted
+//     even if the batch isn't full (default: 1s)
+//   - max_retries: the number of retries of a failed statement. Tuples are
+//     dropped when all retries fail. (default: 3)
+//   - retry_interval: the initial interval of retries, which doubles on each
+//     retry (default: 1s)
+//
+// A missing value or NULL is inserted as NULL, and an array or a map is
+// inserted as JSON.
+func createSQLSink(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Sink, error) {
+	v := &struct {
+		Driver        string `bql:",required"`
+		DSN           string `bql:",required"`
+		Table         string `bql:",required"`
+		Columns       data.Value
+		UpsertKeys    []string
+		BatchSize     int
+		FlushInterval time.Duration
+		MaxRetries    int
+		RetryInterval time.Duration
+	}{
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		MaxRetries:    3,
+		RetryInterval: time.Second,
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+
+	dialect, ok := sqlDialects[v.Driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported driver: %v", v.Driver)
+	}
+	if v.BatchSize <= 0 {
+		return nil, fmt.Errorf("batch_size must be positive: %v", v.BatchSize)
+	}
+	if v.FlushInterval <= 0 {
+		return nil, fmt.Errorf("flush_interval must be positive: %v", v.FlushInterval)
+	}
+	if v.MaxRetries < 0 {
+		return nil, fmt.Errorf("max_retries must not be negative: %v", v.MaxRetries)
+	}
+	if v.RetryInterval < 0 {
+		return nil, fmt.Errorf("retry_interval must not be negative: %v", v.RetryInterval)
+	}
+
+	s := &sqlSink{
+		dialect:       dialect,
+		table:         v.Table,
+		upsertKeys:    v.UpsertKeys,
+		batchSize:     v.BatchSize,
+		maxRetries:    v.MaxRetries,
+		retryInterval: v.RetryInterval,
+		stopCh:        make(chan struct{}),
+		doneCh:        make(chan struct{}),
+	}
+	if v.Columns != nil {
+		cs, err := parseSQLColumns(v.Columns)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, len(cs))
+		for i, c := range cs {
+			names[i] = c.name
+		}
+		if err := s.validateColumns(names); err != nil {
+			return nil, err
+		}
+		s.columns = cs
+	}
+
+	// sql.Open doesn't connect to the database, so the sink can be created
+	// even if the database isn't available yet.
+	db, err := sql.Open(v.Driver, v.DSN)
+	if err != nil {
+		return nil, err
+	}
+	s.db = db
+	go s.flushPeriodically(ctx, v.FlushInterval)
+	return s, nil
+}
+
+func parseSQLColumns(v data.Value) ([]sqlColumn, error) {
+	var cs []sqlColumn
+	switch v.Type() {
+	case data.TypeArray:
+		a, _ := data.AsArray(v)
+		for i, e := range a {
+			s, err := data.AsString(e)
+			if err != nil {
+				return nil, fmt.Errorf("columns[%v] must be a string: %v", i, err)
+			}
+			p, err := data.CompilePath(s)
+			if err != nil {
+				return nil, fmt.Errorf("columns[%v] is an invalid path: %v", i, err)
+			}
+			cs = append(cs, sqlColumn{name: s, path: p})
+		}
+
+	case data.TypeMap:
+		m, _ := data.AsMap(v)
+		for name, e := range m {
+			s, err := data.AsString(e)
+			if err != nil {
+				return nil, fmt.Errorf("the path of column %v must be a string: %v", name, err)
+			}
+			p, err := data.CompilePath(s)
+			if err != nil {
+				return nil, fmt.Errorf("the path of column %v is invalid: %v", name, err)
+			}
+			cs = append(cs, sqlColumn{name: name, path: p})
+		}
+		sort.Sort(sqlColumnsByName(cs))
+
+	default:
+		return nil, fmt.Errorf("columns parameter must be an array or a map: %v", v)
+	}
+	if len(cs) == 0 {
+		return nil, errors.New("columns parameter must have at least one column")
+	}
+	return cs, nil
+}
+
+type sqlColumnsByName []sqlColumn
+
+func (c sqlColumnsByName) Len() int           { return len(c) }
+func (c sqlColumnsByName) Less(i, j int) bool { return c[i].name < c[j].name }
+func (c sqlColumnsByName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+func init() {
+	MustRegisterGlobalSinkCreator("rdbms", SinkCreatorFunc(createSQLSink))
+}
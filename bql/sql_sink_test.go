@@ -0,0 +1,267 @@
+package bql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSQLDriver records statements executed through it. It fails the given
+// number of executions before succeeding.
+type testSQLDriver struct {
+	m        sync.Mutex
+	stmts    []string
+	args     [][]driver.Value
+	failures int
+}
+
+var testSQL = &testSQLDriver{}
+
+func init() {
+	sql.Register("sbtest_sql", testSQL)
+	sqlDialects["sbtest_sql"] = postgresDialect
+}
+
+func (d *testSQLDriver) reset(failures int) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.stmts = nil
+	d.args = nil
+	d.failures = failures
+}
+
+func (d *testSQLDriver) executed() ([]string, [][]driver.Value) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	return append([]string{}, d.stmts...), append([][]driver.Value{}, d.args...)
+}
+
+func (d *testSQLDriver) Open(name string) (driver.Conn, error) {
+	return &testSQLConn{d: d}, nil
+}
+
+type testSQLConn struct {
+	d *testSQLDriver
+}
+
+func (c *testSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &testSQLStmt{d: c.d, query: query}, nil
+}
+
+func (c *testSQLConn) Close() error {
+	return nil
+}
+
+func (c *testSQLConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type testSQLStmt struct {
+	d     *testSQLDriver
+	query string
+}
+
+func (s *testSQLStmt) Close() error {
+	return nil
+}
+
+func (s *testSQLStmt) NumInput() int {
+	return -1
+}
+
+func (s *testSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.m.Lock()
+	defer s.d.m.Unlock()
+	if s.d.failures > 0 {
+		s.d.failures--
+		return nil, errors.New("connection refused")
+	}
+	s.d.stmts = append(s.d.stmts, s.query)
+	s.d.args = append(s.d.args, args)
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (s *testSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("queries are not supported")
+}
+
+func TestSQLSink(t *testing.T) {
+	Convey("Given a sql sink", t, func() {
+		testSQL.reset(0)
+		ctx := core.NewContext(nil)
+		params := data.Map{
+			"driver":         data.String("sbtest_sql"),
+			"dsn":            data.String("test"),
+			"table":          data.String("public.events"),
+			"batch_size":     data.Int(2),
+			"flush_interval": data.String("1h"),
+			"retry_interval": data.Int(0),
+		}
+		ts := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+		tuple := func(i int) *core.Tuple {
+			return core.NewTuple(data.Map{
+				"id":   data.Int(i),
+				"name": data.String("x"),
+				"user": data.Map{"ts": data.Timestamp(ts)},
+			})
+		}
+
+		Convey("When writing tuples without columns", func() {
+			s, err := createSQLSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			for i := 0; i < 3; i++ {
+				So(s.Write(ctx, tuple(i)), ShouldBeNil)
+			}
+
+			Convey("Then a full batch should be inserted by a statement", func() {
+				stmts, args := testSQL.executed()
+				So(stmts, ShouldResemble, []string{
+					`INSERT INTO "public"."events" ("id", "name", "user") VALUES ($1, $2, $3), ($4, $5, $6)`,
+				})
+				So(args[0], ShouldResemble, []driver.Value{
+					int64(0), "x", `{"ts":"2016-01-02T03:04:05Z"}`,
+					int64(1), "x", `{"ts":"2016-01-02T03:04:05Z"}`,
+				})
+				So(s.(core.Statuser).Status()["num_pending"], ShouldEqual, 1)
+			})
+
+			Convey("Then closing the sink should insert the rest", func() {
+				So(s.Close(ctx), ShouldBeNil)
+				stmts, _ := testSQL.executed()
+				So(stmts, ShouldHaveLength, 2)
+				So(s.(core.Statuser).Status()["num_written"], ShouldEqual, 3)
+			})
+		})
+
+		Convey("When writing tuples with a column mapping and upsert keys", func() {
+			params["columns"] = data.Map{
+				"event_id": data.String("id"),
+				"ts":       data.String("user.ts"),
+				"missing":  data.String("a.b"),
+			}
+			params["upsert_keys"] = data.Array{data.String("event_id")}
+			s, err := createSQLSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			So(s.Write(ctx, tuple(1)), ShouldBeNil)
+			So(s.Write(ctx, tuple(1)), ShouldBeNil)
+			So(s.Close(ctx), ShouldBeNil)
+
+			Convey("Then rows having the same keys should be upserted once", func() {
+				stmts, args := testSQL.executed()
+				So(stmts, ShouldResemble, []string{
+					`INSERT INTO "public"."events" ("event_id", "missing", "ts") VALUES ($1, $2, $3) ` +
+						`ON CONFLICT ("event_id") DO UPDATE SET "missing" = EXCLUDED."missing", "ts" = EXCLUDED."ts"`,
+				})
+				So(args[0], ShouldResemble, []driver.Value{int64(1), nil, ts})
+			})
+		})
+
+		Convey("When tuples aren't enough to fill a batch", func() {
+			params["flush_interval"] = data.String("10ms")
+			params["batch_size"] = data.Int(100)
+			s, err := createSQLSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+			So(s.Write(ctx, tuple(1)), ShouldBeNil)
+
+			Convey("Then they should be inserted after the flush interval", func() {
+				var stmts []string
+				for i := 0; i < 100 && len(stmts) == 0; i++ {
+					time.Sleep(10 * time.Millisecond)
+					stmts, _ = testSQL.executed()
+				}
+				So(stmts, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When the database fails temporarily", func() {
+			testSQL.reset(2)
+			s, err := createSQLSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			So(s.Write(ctx, tuple(1)), ShouldBeNil)
+			So(s.Write(ctx, tuple(2)), ShouldBeNil)
+
+			Convey("Then the sink should retry inserting tuples", func() {
+				stmts, _ := testSQL.executed()
+				So(stmts, ShouldHaveLength, 1)
+				So(s.Close(ctx), ShouldBeNil)
+			})
+		})
+
+		Convey("When the database keeps failing", func() {
+			testSQL.reset(100)
+			params["max_retries"] = data.Int(1)
+			s, err := createSQLSink(ctx, &IOParams{}, params)
+			So(err, ShouldBeNil)
+			So(s.Write(ctx, tuple(1)), ShouldBeNil)
+			err = s.Write(ctx, tuple(2))
+
+			Convey("Then tuples should be dropped", func() {
+				So(err, ShouldNotBeNil)
+				st := s.(core.Statuser).Status()
+				So(st["num_failed"], ShouldEqual, 2)
+				So(st["num_pending"], ShouldEqual, 0)
+				So(st["last_error"], ShouldEqual, "connection refused")
+				So(s.Close(ctx), ShouldBeNil)
+			})
+		})
+
+		Convey("When creating a sink with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"unsupported driver":    {"driver": data.String("oracle")},
+				"zero batch_size":       {"batch_size": data.Int(0)},
+				"zero flush_interval":   {"flush_interval": data.Int(0)},
+				"negative max_retries":  {"max_retries": data.Int(-1)},
+				"invalid columns":       {"columns": data.String("a")},
+				"empty columns":         {"columns": data.Array{}},
+				"invalid column path":   {"columns": data.Array{data.String("a[")}},
+				"unknown upsert key":    {"columns": data.Array{data.String("a")}, "upsert_keys": data.Array{data.String("b")}},
+				"too many placeholders": {"columns": data.Array{data.String("a")}, "batch_size": data.Int(100000)},
+			}
+			for name, c := range cases {
+				c := c
+				Convey("Then "+name+" should result in an error", func() {
+					ps := params.Copy()
+					for k, v := range c {
+						ps[k] = v
+					}
+					_, err := createSQLSink(ctx, &IOParams{}, ps)
+					So(err, ShouldNotBeNil)
+				})
+			}
+
+			Convey("Then a missing table should result in an error", func() {
+				ps := params.Copy()
+				delete(ps, "table")
+				_, err := createSQLSink(ctx, &IOParams{}, ps)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a sql sink for MySQL", t, func() {
+		s := &sqlSink{
+			dialect:    mysqlDialect,
+			table:      "events",
+			columns:    []sqlColumn{{name: "id"}, {name: "v"}},
+			upsertKeys: []string{"id"},
+		}
+
+		Convey("When creating an INSERT statement", func() {
+			stmt := s.insertStatement(2)
+
+			Convey("Then it should use MySQL's syntax", func() {
+				So(stmt, ShouldEqual, "INSERT INTO `events` (`id`, `v`) VALUES (?, ?), (?, ?) "+
+					"ON DUPLICATE KEY UPDATE `v` = VALUES(`v`)")
+			})
+		})
+	})
+}
@@ -0,0 +1,194 @@
+package bql
+
+import (
+	"archive/tar"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// StateImportConflictPolicy defines how ImportStates handles a state in a
+// bundle when a state having the same name and tag is already saved in the
+// storage.
+type StateImportConflictPolicy int
+
+const (
+	// StateImportFail makes ImportStates fail without importing any state
+	// when one of the states in a bundle conflicts.
+	StateImportFail StateImportConflictPolicy = iota
+
+	// StateImportSkip keeps the state saved in the storage and skips the
+	// one in the bundle.
+	StateImportSkip
+
+	// StateImportOverwrite overwrites the state saved in the storage with
+	// the one in the bundle.
+	StateImportOverwrite
+)
+
+func (p StateImportConflictPolicy) String() string {
+	switch p {
+	case StateImportFail:
+		return "fail"
+	case StateImportSkip:
+		return "skip"
+	case StateImportOverwrite:
+		return "overwrite"
+	default:
+		return "unknown"
+	}
+}
+
+// ExportStates writes all states saved in UDSStorage for the topology, i.e.
+// states saved by SAVE STATE with any tag, to w as a single bundle. The
+// bundle is a tar archive having an entry named "<state>/<tag>" for each
+// saved state, and it can be imported into another topology by ImportStates.
+//
+// Only saved states are exported. A state which hasn't been saved must be
+// saved by SAVE STATE before calling this method.
+func (tb *TopologyBuilder) ExportStates(w io.Writer) error {
+	topology := tb.topology.Name()
+	states, err := tb.UDSStorage.List(topology)
+	if err != nil && !core.IsNotExist(err) {
+		return err
+	}
+
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		tags := append([]string{}, states[name]...)
+		sort.Strings(tags)
+		for _, tag := range tags {
+			if err := tb.exportState(tw, topology, name, tag); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+func (tb *TopologyBuilder) exportState(tw *tar.Writer, topology, name, tag string) error {
+	r, err := tb.UDSStorage.Load(topology, name, tag)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// The size of an entry has to be written before its content.
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("cannot read the state '%v-%v': %v", name, tag, err)
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name: name + "/" + tag,
+		Mode: 0600,
+		Size: int64(len(b)),
+	}); err != nil {
+		return err
+	}
+	_, err = tw.Write(b)
+	return err
+}
+
+// ImportStates reads a bundle written by ExportStates and saves the states
+// in it to UDSStorage for the topology as if they were saved by SAVE STATE
+// with the same tags. The states can then be loaded by LOAD STATE. It returns
+// the number of imported states.
+//
+// policy defines how a state already saved with the same name and tag is
+// handled. With StateImportFail, conflicts are checked before importing any
+// state, so nothing is imported when ImportStates fails due to a conflict.
+// The whole bundle is read into memory before saving states.
+func (tb *TopologyBuilder) ImportStates(r io.Reader, policy StateImportConflictPolicy) (int, error) {
+	type entry struct {
+		name string
+		tag  string
+		data []byte
+	}
+	var entries []*entry
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, fmt.Errorf("cannot read the bundle: %v", err)
+		}
+
+		names := strings.Split(h.Name, "/")
+		if len(names) != 2 {
+			return 0, fmt.Errorf("the bundle has an invalid entry: %v", h.Name)
+		}
+		if err := core.ValidateSymbol(names[0]); err != nil {
+			return 0, fmt.Errorf("the bundle has an invalid state name: %v", err)
+		}
+		// "default" is a reserved word but used by storages as the tag of
+		// states saved without a tag
+		if strings.ToLower(names[1]) != "default" {
+			if err := core.ValidateSymbol(names[1]); err != nil {
+				return 0, fmt.Errorf("the bundle has an invalid tag: %v", err)
+			}
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return 0, fmt.Errorf("cannot read the bundle: %v", err)
+		}
+		entries = append(entries, &entry{names[0], names[1], b})
+	}
+
+	topology := tb.topology.Name()
+	saved, err := tb.UDSStorage.List(topology)
+	if err != nil && !core.IsNotExist(err) {
+		return 0, err
+	}
+	exists := func(e *entry) bool {
+		for _, t := range saved[e.name] {
+			if t == e.tag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if policy == StateImportFail {
+		for _, e := range entries {
+			if exists(e) {
+				return 0, fmt.Errorf("the state '%v-%v' is already saved", e.name, e.tag)
+			}
+		}
+	}
+
+	n := 0
+	for _, e := range entries {
+		if policy == StateImportSkip && exists(e) {
+			continue
+		}
+
+		w, err := tb.UDSStorage.Save(topology, e.name, e.tag)
+		if err != nil {
+			return n, err
+		}
+		if _, err := w.Write(e.data); err != nil {
+			if err := w.Abort(); err != nil {
+				tb.topology.Context().ErrLog(err).WithField("state_name", e.name).
+					WithField("state_tag", e.tag).
+					Error("Cannot abort importing the state")
+			}
+			return n, err
+		}
+		if err := w.Commit(); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
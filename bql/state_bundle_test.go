@@ -0,0 +1,113 @@
+package bql
+
+import (
+	"archive/tar"
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestStateBundle(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder having saved states", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `
+			CREATE STATE s1 TYPE dummy_updatable_uds WITH num=1;
+			CREATE STATE s2 TYPE dummy_self_loadable_uds WITH num=2;
+			SAVE STATE s1;
+			SAVE STATE s2 TAG v1;
+		`), ShouldBeNil)
+
+		Convey("When exporting the states", func() {
+			buf := bytes.NewBuffer(nil)
+			So(tb.ExportStates(buf), ShouldBeNil)
+			bundle := buf.Bytes()
+
+			Convey("Then the bundle should have all states with their tags", func() {
+				tr := tar.NewReader(bytes.NewReader(bundle))
+				names := []string{}
+				for {
+					h, err := tr.Next()
+					if err != nil {
+						break
+					}
+					names = append(names, h.Name)
+				}
+				So(names, ShouldResemble, []string{"s1/default", "s2/v1"})
+			})
+
+			Convey("And importing them into a fresh topology", func() {
+				dt2 := newTestTopology()
+				Reset(func() {
+					dt2.Stop()
+				})
+				tb2, err := NewTopologyBuilder(dt2)
+				So(err, ShouldBeNil)
+				n, err := tb2.ImportStates(bytes.NewReader(bundle), StateImportFail)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+
+				Convey("Then the states should be loaded with the same contents", func() {
+					So(addBQLToTopology(tb2, `
+						LOAD STATE s1 TYPE dummy_updatable_uds;
+						LOAD STATE s2 TYPE dummy_self_loadable_uds TAG v1;
+					`), ShouldBeNil)
+
+					s1, err := dt2.Context().SharedStates.Get("s1")
+					So(err, ShouldBeNil)
+					So(s1.(*dummyUpdatableUDS).num, ShouldEqual, 1)
+					s2, err := dt2.Context().SharedStates.Get("s2")
+					So(err, ShouldBeNil)
+					So(s2.(*dummySelfLoadableUDS).num, ShouldEqual, 2)
+				})
+			})
+
+			Convey("And updating and saving a state again", func() {
+				So(addBQLToTopology(tb, `UPDATE STATE s1 SET num=10; SAVE STATE s1;`), ShouldBeNil)
+				load := func() int64 {
+					So(addBQLToTopology(tb, `LOAD STATE s1 TYPE dummy_updatable_uds;`), ShouldBeNil)
+					s, err := dt.Context().SharedStates.Get("s1")
+					So(err, ShouldBeNil)
+					return s.(*dummyUpdatableUDS).num
+				}
+
+				Convey("Then importing the bundle should fail by default", func() {
+					n, err := tb.ImportStates(bytes.NewReader(bundle), StateImportFail)
+					So(err, ShouldNotBeNil)
+					So(n, ShouldEqual, 0)
+					So(load(), ShouldEqual, 10)
+				})
+
+				Convey("Then importing the bundle should skip conflicting states", func() {
+					n, err := tb.ImportStates(bytes.NewReader(bundle), StateImportSkip)
+					So(err, ShouldBeNil)
+					So(n, ShouldEqual, 0)
+					So(load(), ShouldEqual, 10)
+				})
+
+				Convey("Then importing the bundle should overwrite conflicting states", func() {
+					n, err := tb.ImportStates(bytes.NewReader(bundle), StateImportOverwrite)
+					So(err, ShouldBeNil)
+					So(n, ShouldEqual, 2)
+					So(load(), ShouldEqual, 1)
+				})
+			})
+		})
+
+		Convey("When importing an invalid bundle", func() {
+			buf := bytes.NewBuffer(nil)
+			tw := tar.NewWriter(buf)
+			So(tw.WriteHeader(&tar.Header{Name: "s1", Mode: 0600}), ShouldBeNil)
+			So(tw.Close(), ShouldBeNil)
+			_, err := tb.ImportStates(buf, StateImportOverwrite)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
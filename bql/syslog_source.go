@@ -0,0 +1,699 @@
+package bql
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// syslogSource is a source which emits syslog records received over UDP or
+// TCP, or read from the systemd journal. Each record becomes a tuple having
+// the following fields:
+//
+//   - format: "rfc3164", "rfc5424", or "journal"
+//   - facility, severity: integers, or null when unknown
+//   - version: the version of RFC5424, or null
+//   - hostname, app_name, proc_id, msg_id: strings, or null
+//   - structured_data: a map from SD-IDs to maps of SD-PARAMs, or null
+//   - message: the message
+//
+// The timestamp of a tuple is the timestamp of the record. Tuples emitted
+// from the journal additionally have "journal" field containing all fields
+// of the journal entry.
+//
+// TCP connections can use both octet counting and LF-terminated framing
+// defined in RFC6587.
+type syslogSource struct {
+	ioParams       *IOParams
+	format         string
+	location       *time.Location
+	maxMessageSize int
+	addressField   string
+
+	packetConn net.PacketConn
+	listener   net.Listener
+
+	journalctl   string
+	journalUnits []string
+
+	m       sync.Mutex
+	conns   map[net.Conn]struct{}
+	cmd     *exec.Cmd // non-nil while journalctl is running
+	stopped bool
+	wg      sync.WaitGroup
+
+	numMessages int64
+	numErrors   int64
+}
+
+func (s *syslogSource) GenerateStream(ctx *core.Context, w core.Writer) error {
+	s.m.Lock()
+	if s.stopped {
+		s.m.Unlock()
+		return nil
+	}
+	s.wg.Add(1)
+	s.m.Unlock()
+	defer s.wg.Done()
+
+	var err error
+	switch {
+	case s.packetConn != nil:
+		err = s.serveUDP(ctx, w)
+	case s.listener != nil:
+		err = s.serveTCP(ctx, w)
+	default:
+		err = s.readJournal(ctx, w)
+	}
+	if s.isStopped() || err == core.ErrSourceStopped {
+		return nil
+	}
+	return err
+}
+
+func (s *syslogSource) isStopped() bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.stopped
+}
+
+func (s *syslogSource) serveUDP(ctx *core.Context, w core.Writer) error {
+	buf := make([]byte, s.maxMessageSize)
+	for {
+		n, addr, err := s.packetConn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		if err := s.emit(ctx, w, buf[:n], addr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *syslogSource) serveTCP(ctx *core.Context, w core.Writer) error {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		s.m.Lock()
+		if s.stopped {
+			s.m.Unlock()
+			c.Close()
+			return nil
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.m.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.m.Lock()
+				delete(s.conns, c)
+				s.m.Unlock()
+				c.Close()
+			}()
+			if err := s.serveConn(ctx, w, c); err != nil && err != io.EOF && !s.isStopped() {
+				ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
+					WithField("remote_addr", c.RemoteAddr().String()).
+					Warning("Closing the syslog connection")
+			}
+		}()
+	}
+}
+
+// serveConn reads messages from a TCP connection. A message framed with
+// octet counting starts with its length followed by a space. Other messages
+// are terminated by LF.
+func (s *syslogSource) serveConn(ctx *core.Context, w core.Writer, c net.Conn) error {
+	r := bufio.NewReaderSize(c, s.maxMessageSize)
+	buf := make([]byte, s.maxMessageSize)
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return err
+		}
+
+		var msg []byte
+		if b[0] >= '0' && b[0] <= '9' {
+			l, err := r.ReadString(' ')
+			if err != nil {
+				return err
+			}
+			n, err := strconv.Atoi(l[:len(l)-1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid message length: %q", l)
+			}
+			if n > s.maxMessageSize {
+				return fmt.Errorf("the message length exceeds max_message_size: %v", n)
+			}
+			if _, err := io.ReadFull(r, buf[:n]); err != nil {
+				return err
+			}
+			msg = buf[:n]
+		} else {
+			l, err := r.ReadSlice('\n')
+			if err == bufio.ErrBufferFull {
+				return fmt.Errorf("the message exceeds max_message_size: %v", s.maxMessageSize)
+			} else if err != nil && (err != io.EOF || len(l) == 0) {
+				return err
+			}
+			msg = bytes.TrimRight(l, "\r\n")
+			if len(msg) == 0 {
+				continue
+			}
+		}
+		if err := s.emit(ctx, w, msg, c.RemoteAddr()); err != nil {
+			return err
+		}
+	}
+}
+
+// emit parses a message and writes it as a tuple. It only returns an error
+// when writing the tuple failed.
+func (s *syslogSource) emit(ctx *core.Context, w core.Writer, msg []byte, addr net.Addr) error {
+	atomic.AddInt64(&s.numMessages, 1)
+	m, ts, err := parseSyslogMessage(msg, s.format, s.location, time.Now())
+	if err != nil {
+		atomic.AddInt64(&s.numErrors, 1)
+		ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
+			WithField("remote_addr", addr.String()).
+			Warning("Ignoring the syslog message due to a parse error")
+		return nil
+	}
+	if s.addressField != "" {
+		m[s.addressField] = data.String(addr.String())
+	}
+	return s.write(ctx, w, m, ts)
+}
+
+func (s *syslogSource) write(ctx *core.Context, w core.Writer, m data.Map, ts time.Time) error {
+	t := core.NewTuple(m)
+	if !ts.IsZero() {
+		t.Timestamp = ts
+	}
+	if err := w.Write(ctx, t); err != nil {
+		if err == core.ErrSourceStopped {
+			return err
+		}
+		ctx.ErrLog(err).WithField("node_name", s.ioParams.Name).
+			Error("Cannot write a syslog record")
+	}
+	return nil
+}
+
+func (s *syslogSource) readJournal(ctx *core.Context, w core.Writer) error {
+	args := []string{"--follow", "--lines=0", "--output=json"}
+	for _, u := range s.journalUnits {
+		args = append(args, "--unit="+u)
+	}
+	cmd := exec.Command(s.journalctl, args...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	if s.stopped {
+		s.m.Unlock()
+		return nil
+	}
+	if err := cmd.Start(); err != nil {
+		s.m.Unlock()
+		return err
+	}
+	s.cmd = cmd
+	s.m.Unlock()
+	defer func() {
+		s.m.Lock()
+		defer s.m.Unlock()
+		s.cmd = nil
+	}()
+
+	r := bufio.NewReader(out)
+	for {
+		l, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(l)) > 0 {
+			atomic.AddInt64(&s.numMessages, 1)
+			m, ts, perr := parseJournalEntry(l)
+			if perr != nil {
+				atomic.AddInt64(&s.numErrors, 1)
+				ctx.ErrLog(perr).WithField("node_name", s.ioParams.Name).
+					Warning("Ignoring the journal entry due to a parse error")
+			} else if err := s.write(ctx, w, m, ts); err != nil {
+				cmd.Process.Kill()
+				cmd.Wait()
+				return err
+			}
+		}
+		if err != nil {
+			if werr := cmd.Wait(); werr != nil {
+				return fmt.Errorf("journalctl failed: %v", werr)
+			}
+			return errors.New("journalctl exited unexpectedly")
+		}
+	}
+}
+
+func (s *syslogSource) Stop(ctx *core.Context) error {
+	s.m.Lock()
+	if s.stopped {
+		s.m.Unlock()
+		return nil
+	}
+	s.stopped = true
+	if s.packetConn != nil {
+		s.packetConn.Close()
+	}
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	if s.cmd != nil {
+		s.cmd.Process.Kill()
+	}
+	s.m.Unlock()
+
+	// Wait for goroutines writing tuples so that Write won't be called
+	// after this method returns.
+	s.wg.Wait()
+	return nil
+}
+
+func (s *syslogSource) Status() data.Map {
+	m := data.Map{
+		"num_messages": data.Int(atomic.LoadInt64(&s.numMessages)),
+		"num_errors":   data.Int(atomic.LoadInt64(&s.numErrors)),
+	}
+	switch {
+	case s.packetConn != nil:
+		m["protocol"] = data.String("udp")
+		m["listen"] = data.String(s.packetConn.LocalAddr().String())
+	case s.listener != nil:
+		s.m.Lock()
+		m["num_connections"] = data.Int(len(s.conns))
+		s.m.Unlock()
+		m["protocol"] = data.String("tcp")
+		m["listen"] = data.String(s.listener.Addr().String())
+	default:
+		units := make(data.Array, len(s.journalUnits))
+		for i, u := range s.journalUnits {
+			units[i] = data.String(u)
+		}
+		s.m.Lock()
+		m["running"] = data.Bool(s.cmd != nil)
+		s.m.Unlock()
+		m["protocol"] = data.String("journal")
+		m["journalctl_path"] = data.String(s.journalctl)
+		m["journal_units"] = units
+	}
+	return m
+}
+
+// parseSyslogMessage parses a message in the format of RFC3164 or RFC5424.
+// When format is "auto", the format is detected from the version following
+// PRI. It returns the zero time when the message doesn't have a timestamp.
+func parseSyslogMessage(msg []byte, format string, loc *time.Location, now time.Time) (data.Map, time.Time, error) {
+	s := strings.TrimRight(string(msg), "\x00\r\n")
+	if len(s) == 0 || s[0] != '<' {
+		return nil, time.Time{}, errors.New("the message doesn't start with PRI")
+	}
+	i := strings.IndexByte(s, '>')
+	if i < 2 || i > 4 {
+		return nil, time.Time{}, errors.New("the message has an invalid PRI")
+	}
+	pri, err := strconv.Atoi(s[1:i])
+	if err != nil || pri < 0 || pri > 191 {
+		return nil, time.Time{}, fmt.Errorf("the message has an invalid PRI: %v", s[1:i])
+	}
+	s = s[i+1:]
+
+	m := data.Map{
+		"facility":        data.Int(pri / 8),
+		"severity":        data.Int(pri % 8),
+		"version":         data.Null{},
+		"hostname":        data.Null{},
+		"app_name":        data.Null{},
+		"proc_id":         data.Null{},
+		"msg_id":          data.Null{},
+		"structured_data": data.Null{},
+	}
+	if format == "auto" {
+		format = "rfc3164"
+		if len(s) >= 2 && s[0] >= '1' && s[0] <= '9' && s[1] == ' ' {
+			format = "rfc5424"
+		}
+	}
+	m["format"] = data.String(format)
+	if format == "rfc5424" {
+		ts, err := parseRFC5424(s, m)
+		return m, ts, err
+	}
+	return m, parseRFC3164(s, m, loc, now), nil
+}
+
+// parseRFC5424 parses the part of a message following PRI.
+func parseRFC5424(s string, m data.Map) (time.Time, error) {
+	var fields [6]string
+	for i := range fields {
+		j := strings.IndexByte(s, ' ')
+		if j < 0 {
+			return time.Time{}, errors.New("the RFC5424 header is too short")
+		}
+		fields[i], s = s[:j], s[j+1:]
+	}
+
+	v, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid version: %v", fields[0])
+	}
+	m["version"] = data.Int(v)
+	var ts time.Time
+	if fields[1] != "-" {
+		ts, err = time.Parse(time.RFC3339Nano, fields[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp: %v", fields[1])
+		}
+	}
+	for i, k := range []string{"hostname", "app_name", "proc_id", "msg_id"} {
+		if f := fields[i+2]; f != "-" {
+			m[k] = data.String(f)
+		}
+	}
+
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	} else {
+		sd, rest, err := parseStructuredData(s)
+		if err != nil {
+			return time.Time{}, err
+		}
+		m["structured_data"] = sd
+		s = rest
+	}
+	if len(s) > 0 && s[0] != ' ' {
+		return time.Time{}, errors.New("STRUCTURED-DATA must be followed by a space")
+	}
+	if len(s) > 0 {
+		s = s[1:]
+	}
+	m["message"] = data.String(strings.TrimPrefix(s, "\xef\xbb\xbf"))
+	return ts, nil
+}
+
+// parseStructuredData parses SD-ELEMENTs at the beginning of s and returns
+// the rest of s.
+func parseStructuredData(s string) (data.Map, string, error) {
+	sd := data.Map{}
+	for len(s) > 0 && s[0] == '[' {
+		s = s[1:]
+		i := strings.IndexAny(s, " ]")
+		if i <= 0 {
+			return nil, "", errors.New("invalid SD-ELEMENT")
+		}
+		params := data.Map{}
+		sd[s[:i]] = params
+		s = s[i:]
+
+		for len(s) > 0 && s[0] == ' ' {
+			s = s[1:]
+			i := strings.Index(s, `="`)
+			if i <= 0 {
+				return nil, "", errors.New("invalid SD-PARAM")
+			}
+			name := s[:i]
+			s = s[i+2:]
+
+			b := bytes.NewBuffer(nil)
+			closed := false
+			for len(s) > 0 && !closed {
+				switch c := s[0]; {
+				case c == '\\' && len(s) > 1 && (s[1] == '"' || s[1] == '\\' || s[1] == ']'):
+					b.WriteByte(s[1])
+					s = s[2:]
+				case c == '"':
+					closed = true
+					s = s[1:]
+				default:
+					b.WriteByte(c)
+					s = s[1:]
+				}
+			}
+			if !closed {
+				return nil, "", errors.New("PARAM-VALUE isn't closed")
+			}
+			params[name] = data.String(b.String())
+		}
+		if len(s) == 0 || s[0] != ']' {
+			return nil, "", errors.New("SD-ELEMENT isn't closed")
+		}
+		s = s[1:]
+	}
+	return sd, s, nil
+}
+
+// parseRFC3164 parses the part of a message following PRI. Because RFC3164
+// only recommends its format, the whole part becomes the message when it
+// doesn't have a valid timestamp. The timestamp doesn't have a year, so it's
+// assumed to be within a year before now, allowing a month of clock skew.
+// The hostname can be omitted as some local daemons do.
+func parseRFC3164(s string, m data.Map, loc *time.Location, now time.Time) time.Time {
+	var ts time.Time
+	if len(s) >= 16 && s[15] == ' ' {
+		t, err := time.ParseInLocation(time.Stamp, s[:15], loc)
+		if err == nil {
+			n := now.In(loc)
+			ts = t.AddDate(n.Year(), 0, 0)
+			if ts.After(n.AddDate(0, 1, 0)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			s = s[16:]
+		}
+	}
+	if ts.IsZero() {
+		// Some senders use RFC3339 timestamps in RFC3164 messages.
+		if i := strings.IndexByte(s, ' '); i > 0 {
+			if t, err := time.Parse(time.RFC3339Nano, s[:i]); err == nil {
+				ts = t
+				s = s[i+1:]
+			}
+		}
+	}
+	if ts.IsZero() {
+		m["message"] = data.String(s)
+		return ts
+	}
+
+	if i := strings.IndexByte(s, ' '); i > 0 && !isRFC3164Tag(s[:i]) {
+		m["hostname"] = data.String(s[:i])
+		s = s[i+1:]
+	}
+	if i := strings.IndexAny(s, "[: "); i > 0 && i <= 32 {
+		tag, rest := s[:i], s[i:]
+		var pid data.Value = data.Null{}
+		if rest[0] == '[' {
+			if j := strings.IndexByte(rest, ']'); j > 0 {
+				pid = data.String(rest[1:j])
+				rest = rest[j+1:]
+			}
+		}
+		if strings.HasPrefix(rest, ":") {
+			m["app_name"] = data.String(tag)
+			m["proc_id"] = pid
+			s = strings.TrimPrefix(rest[1:], " ")
+		}
+	}
+	m["message"] = data.String(s)
+	return ts
+}
+
+// isRFC3164Tag returns true when the token looks like a TAG followed by
+// CONTENT rather than a hostname.
+func isRFC3164Tag(s string) bool {
+	return strings.HasSuffix(s, ":") || strings.ContainsRune(s, '[')
+}
+
+// parseJournalEntry converts an entry written by journalctl --output=json.
+func parseJournalEntry(l []byte) (data.Map, time.Time, error) {
+	var e map[string]interface{}
+	if err := json.Unmarshal(l, &e); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	fields := data.Map{}
+	for k, v := range e {
+		s, ok := journalFieldString(v)
+		if !ok {
+			continue
+		}
+		fields[k] = data.String(s)
+	}
+	str := func(keys ...string) data.Value {
+		for _, k := range keys {
+			if v, ok := fields[k]; ok {
+				return v
+			}
+		}
+		return data.Null{}
+	}
+	num := func(k string) data.Value {
+		if v, ok := fields[k]; ok {
+			if i, err := strconv.Atoi(string(v.(data.String))); err == nil {
+				return data.Int(i)
+			}
+		}
+		return data.Null{}
+	}
+
+	m := data.Map{
+		"format":          data.String("journal"),
+		"facility":        num("SYSLOG_FACILITY"),
+		"severity":        num("PRIORITY"),
+		"version":         data.Null{},
+		"hostname":        str("_HOSTNAME"),
+		"app_name":        str("SYSLOG_IDENTIFIER", "_COMM"),
+		"proc_id":         str("_PID", "SYSLOG_PID"),
+		"msg_id":          data.Null{},
+		"structured_data": data.Null{},
+		"message":         str("MESSAGE"),
+		"journal":         fields,
+	}
+	var ts time.Time
+	if v, ok := fields["__REALTIME_TIMESTAMP"]; ok {
+		us, err := strconv.ParseInt(string(v.(data.String)), 10, 64)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("invalid __REALTIME_TIMESTAMP: %v", v)
+		}
+		ts = time.Unix(0, us*int64(time.Microsecond))
+	}
+	return m, ts, nil
+}
+
+// journalFieldString converts a value of a journal field to a string.
+// journalctl writes a field having a non-printable value as an array of
+// bytes.
+func journalFieldString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []interface{}:
+		b := make([]byte, 0, len(v))
+		for _, e := range v {
+			n, ok := e.(float64)
+			if !ok {
+				// A field having multiple values is written as an array
+				// of strings. Only the first value is used.
+				return journalFieldString(e)
+			}
+			b = append(b, byte(n))
+		}
+		return string(b), true
+	}
+	return "", false
+}
+
+func createSyslogSource(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Source, error) {
+	v := &struct {
+		Listen         string
+		Protocol       string
+		Format         string
+		TimeZone       string
+		MaxMessageSize int `bql:",weaklytyped"`
+		AddressField   string
+		Journal        bool
+		JournalUnits   []string
+		JournalctlPath string
+	}{
+		Protocol:       "udp",
+		Format:         "auto",
+		TimeZone:       "Local",
+		MaxMessageSize: 64 << 10,
+		JournalctlPath: "journalctl",
+	}
+	if err := data.Decode(params, v); err != nil {
+		return nil, err
+	}
+
+	s := &syslogSource{
+		ioParams:       ioParams,
+		format:         strings.ToLower(v.Format),
+		maxMessageSize: v.MaxMessageSize,
+		addressField:   v.AddressField,
+		journalUnits:   v.JournalUnits,
+		conns:          map[net.Conn]struct{}{},
+	}
+	switch s.format {
+	case "auto", "rfc3164", "rfc5424":
+	default:
+		return nil, fmt.Errorf("format must be one of auto, rfc3164, or rfc5424: %v", v.Format)
+	}
+	loc, err := time.LoadLocation(v.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time_zone: %v", err)
+	}
+	s.location = loc
+	if s.maxMessageSize <= 0 {
+		return nil, errors.New("max_message_size must be positive")
+	}
+
+	if v.Journal {
+		if v.Listen != "" {
+			return nil, errors.New("listen and journal cannot be given together")
+		}
+		if v.AddressField != "" {
+			return nil, errors.New("address_field cannot be used with journal")
+		}
+		path, err := exec.LookPath(v.JournalctlPath)
+		if err != nil {
+			return nil, err
+		}
+		s.journalctl = path
+		return s, nil
+	}
+	if len(v.JournalUnits) > 0 {
+		return nil, errors.New("journal_units requires journal parameter")
+	}
+	if v.Listen == "" {
+		return nil, errors.New("listen parameter is missing")
+	}
+
+	// The address is listened here so that an error like "address already
+	// in use" is reported by CREATE SOURCE statement.
+	switch strings.ToLower(v.Protocol) {
+	case "udp":
+		c, err := net.ListenPacket("udp", v.Listen)
+		if err != nil {
+			return nil, err
+		}
+		s.packetConn = c
+	case "tcp":
+		l, err := net.Listen("tcp", v.Listen)
+		if err != nil {
+			return nil, err
+		}
+		s.listener = l
+	default:
+		return nil, fmt.Errorf("protocol must be udp or tcp: %v", v.Protocol)
+	}
+	return s, nil
+}
+
+func init() {
+	MustRegisterGlobalSourceCreator("syslog", SourceCreatorFunc(createSyslogSource))
+}
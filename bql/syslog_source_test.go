@@ -0,0 +1,338 @@
+package bql
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseSyslogMessage(t *testing.T) {
+	now := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	Convey("Given RFC5424 messages", t, func() {
+		Convey("When parsing a message having all fields", func() {
+			m, ts, err := parseSyslogMessage([]byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high"] `+"\xef\xbb\xbf"+`An application event log entry...`), "auto", time.UTC, now)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have all fields", func() {
+				So(ts, ShouldResemble, time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC))
+				So(m, ShouldResemble, data.Map{
+					"format":   data.String("rfc5424"),
+					"facility": data.Int(20),
+					"severity": data.Int(5),
+					"version":  data.Int(1),
+					"hostname": data.String("mymachine.example.com"),
+					"app_name": data.String("evntslog"),
+					"proc_id":  data.Null{},
+					"msg_id":   data.String("ID47"),
+					"structured_data": data.Map{
+						"exampleSDID@32473": data.Map{
+							"iut":         data.String("3"),
+							"eventSource": data.String("Application"),
+							"eventID":     data.String("1011"),
+						},
+						"examplePriority@32473": data.Map{
+							"class": data.String("high"),
+						},
+					},
+					"message": data.String("An application event log entry..."),
+				})
+			})
+		})
+
+		Convey("When parsing a message having nil values and escaped characters", func() {
+			m, ts, err := parseSyslogMessage([]byte(`<34>1 - - - - - [a x="q\"b\]\\"]`), "rfc5424", time.UTC, now)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have nulls and unescaped values", func() {
+				So(ts.IsZero(), ShouldBeTrue)
+				So(m["hostname"], ShouldResemble, data.Null{})
+				So(m["structured_data"], ShouldResemble, data.Map{"a": data.Map{"x": data.String(`q"b]\`)}})
+				So(m["message"], ShouldEqual, "")
+			})
+		})
+
+		Convey("When parsing invalid messages", func() {
+			for _, msg := range []string{
+				`<34>1 2003-10-11T22:14:15Z host`,
+				`<34>1 yesterday host app - - - msg`,
+				`<34>1 - host app - - [a x="1" msg`,
+				`<34>1 - host app - - [a x="1"]msg`,
+			} {
+				_, _, err := parseSyslogMessage([]byte(msg), "auto", time.UTC, now)
+
+				Convey("Then it should fail: "+msg, func() {
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+
+	Convey("Given RFC3164 messages", t, func() {
+		Convey("When parsing a message having all fields", func() {
+			m, ts, err := parseSyslogMessage([]byte("<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed\n"), "auto", time.UTC, now)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have all fields", func() {
+				So(ts, ShouldResemble, time.Date(2015, 10, 11, 22, 14, 15, 0, time.UTC))
+				So(m, ShouldResemble, data.Map{
+					"format":          data.String("rfc3164"),
+					"facility":        data.Int(4),
+					"severity":        data.Int(2),
+					"version":         data.Null{},
+					"hostname":        data.String("mymachine"),
+					"app_name":        data.String("su"),
+					"proc_id":         data.String("123"),
+					"msg_id":          data.Null{},
+					"structured_data": data.Null{},
+					"message":         data.String("'su root' failed"),
+				})
+			})
+		})
+
+		Convey("When parsing a message without the hostname", func() {
+			m, ts, err := parseSyslogMessage([]byte("<13>Jan  1 23:00:00 cron: job done"), "auto", time.UTC, now)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have the tag and the message", func() {
+				So(ts, ShouldResemble, time.Date(2016, 1, 1, 23, 0, 0, 0, time.UTC))
+				So(m["hostname"], ShouldResemble, data.Null{})
+				So(m["app_name"], ShouldEqual, "cron")
+				So(m["proc_id"], ShouldResemble, data.Null{})
+				So(m["message"], ShouldEqual, "job done")
+			})
+		})
+
+		Convey("When parsing a message having an RFC3339 timestamp", func() {
+			m, ts, err := parseSyslogMessage([]byte("<13>2016-01-02T03:04:05+09:00 gw app: hello"), "auto", time.UTC, now)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have the timestamp", func() {
+				So(ts.Equal(time.Date(2016, 1, 1, 18, 4, 5, 0, time.UTC)), ShouldBeTrue)
+				So(m["hostname"], ShouldEqual, "gw")
+				So(m["message"], ShouldEqual, "hello")
+			})
+		})
+
+		Convey("When parsing a message without a timestamp", func() {
+			m, ts, err := parseSyslogMessage([]byte("<13>just a message"), "auto", time.UTC, now)
+			So(err, ShouldBeNil)
+
+			Convey("Then the whole content should be the message", func() {
+				So(ts.IsZero(), ShouldBeTrue)
+				So(m["message"], ShouldEqual, "just a message")
+			})
+		})
+
+		Convey("When parsing messages having invalid PRI", func() {
+			for _, msg := range []string{"", "no pri", "<>x", "<192>x", "<1a>x", "<12345>x"} {
+				_, _, err := parseSyslogMessage([]byte(msg), "auto", time.UTC, now)
+
+				Convey("Then it should fail: "+msg, func() {
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestParseJournalEntry(t *testing.T) {
+	Convey("Given a journal entry", t, func() {
+		l := `{"__REALTIME_TIMESTAMP":"1451703845000001","PRIORITY":"6","SYSLOG_FACILITY":"3","_HOSTNAME":"gw","SYSLOG_IDENTIFIER":"sshd","_PID":"42","MESSAGE":[104,105,10],"_BOOT_ID":"abc"}`
+
+		Convey("When parsing it", func() {
+			m, ts, err := parseJournalEntry([]byte(l))
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have syslog fields", func() {
+				So(ts.Equal(time.Date(2016, 1, 2, 3, 4, 5, 1000, time.UTC)), ShouldBeTrue)
+				So(m["format"], ShouldEqual, "journal")
+				So(m["facility"], ShouldEqual, 3)
+				So(m["severity"], ShouldEqual, 6)
+				So(m["hostname"], ShouldEqual, "gw")
+				So(m["app_name"], ShouldEqual, "sshd")
+				So(m["proc_id"], ShouldEqual, "42")
+				So(m["message"], ShouldEqual, "hi\n")
+				So(m["journal"].(data.Map)["_BOOT_ID"], ShouldEqual, "abc")
+			})
+		})
+	})
+}
+
+func TestSyslogSource(t *testing.T) {
+	Convey("Given a syslog source", t, func() {
+		ctx := core.NewContext(nil)
+		params := data.Map{
+			"listen":        data.String("127.0.0.1:0"),
+			"time_zone":     data.String("UTC"),
+			"address_field": data.String("addr"),
+		}
+		w := &testFileWriter{}
+		w.c = sync.NewCond(&w.m)
+		run := func() *syslogSource {
+			s, err := createSyslogSource(ctx, &IOParams{Name: "syslog_test"}, params)
+			So(err, ShouldBeNil)
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, w)
+			}()
+			Reset(func() {
+				s.Stop(ctx)
+				So(<-ch, ShouldBeNil)
+			})
+			return s.(*syslogSource)
+		}
+
+		Convey("When receiving messages over UDP", func() {
+			s := run()
+			c, err := net.Dial("udp", s.packetConn.LocalAddr().String())
+			So(err, ShouldBeNil)
+			defer c.Close()
+			_, err = c.Write([]byte("<34>1 2016-01-02T03:04:05Z gw app - - - hello"))
+			So(err, ShouldBeNil)
+			_, err = c.Write([]byte("invalid"))
+			So(err, ShouldBeNil)
+			_, err = c.Write([]byte("<13>Jan  2 03:04:05 gw app: world"))
+			So(err, ShouldBeNil)
+
+			Convey("Then it should emit a tuple for each valid message", func() {
+				ds := w.snapshot(2)
+				So(ds[0]["message"], ShouldEqual, "hello")
+				So(ds[0]["addr"], ShouldEqual, c.LocalAddr().String())
+				So(ds[1]["message"], ShouldEqual, "world")
+				w.m.Lock()
+				So(w.tss[0], ShouldResemble, time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC))
+				w.m.Unlock()
+
+				st := s.Status()
+				So(st["num_messages"], ShouldEqual, 3)
+				So(st["num_errors"], ShouldEqual, 1)
+				So(st["protocol"], ShouldEqual, "udp")
+			})
+		})
+
+		Convey("When receiving messages over TCP", func() {
+			params["protocol"] = data.String("tcp")
+			s := run()
+			c, err := net.Dial("tcp", s.listener.Addr().String())
+			So(err, ShouldBeNil)
+			defer c.Close()
+			msg := "<34>1 - gw app - - - octet\ncounting"
+			_, err = fmt.Fprintf(c, "%v %v<13>Jan  2 03:04:05 gw app: lf\r\n\n<13>Jan  2 03:04:05 gw app: last\n", len(msg), msg)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should support both framings", func() {
+				ds := w.snapshot(3)
+				So(ds[0]["message"], ShouldEqual, "octet\ncounting")
+				So(ds[1]["message"], ShouldEqual, "lf")
+				So(ds[2]["message"], ShouldEqual, "last")
+				So(s.Status()["num_connections"], ShouldEqual, 1)
+			})
+		})
+
+		Convey("When a TCP message exceeds max_message_size", func() {
+			params["protocol"] = data.String("tcp")
+			params["max_message_size"] = data.Int(64)
+			s := run()
+			c, err := net.Dial("tcp", s.listener.Addr().String())
+			So(err, ShouldBeNil)
+			defer c.Close()
+			_, err = fmt.Fprintf(c, "1000 <13>")
+			So(err, ShouldBeNil)
+
+			Convey("Then the connection should be closed", func() {
+				c.SetReadDeadline(time.Now().Add(5 * time.Second))
+				_, err := c.Read(make([]byte, 1))
+				So(err, ShouldNotBeNil)
+				So(w.ds, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When reading the journal", func() {
+			dir, err := ioutil.TempDir("", "sbtest_bql_syslog")
+			So(err, ShouldBeNil)
+			Reset(func() {
+				os.RemoveAll(dir)
+			})
+			path := filepath.Join(dir, "journalctl")
+			script := `#!/bin/sh
+echo "$@" > "` + filepath.Join(dir, "args") + `"
+echo '{"__REALTIME_TIMESTAMP":"1451703845000000","PRIORITY":"3","MESSAGE":"disk full"}'
+echo 'broken'
+exec sleep 60
+`
+			So(ioutil.WriteFile(path, []byte(script), 0755), ShouldBeNil)
+			delete(params, "listen")
+			delete(params, "address_field")
+			params["journal"] = data.True
+			params["journal_units"] = data.Array{data.String("sshd.service")}
+			params["journalctl_path"] = data.String(path)
+			s := run()
+
+			Convey("Then it should emit a tuple for each entry", func() {
+				ds := w.snapshot(1)
+				So(ds[0]["message"], ShouldEqual, "disk full")
+				So(ds[0]["severity"], ShouldEqual, 3)
+				args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+				So(err, ShouldBeNil)
+				So(string(args), ShouldEqual, "--follow --lines=0 --output=json --unit=sshd.service\n")
+				for i := 0; s.Status()["num_errors"] != data.Int(1); i++ {
+					So(i, ShouldBeLessThan, 1000)
+					time.Sleep(time.Millisecond)
+				}
+			})
+
+			Convey("Then the status should have the state of journalctl", func() {
+				w.snapshot(1)
+				st := s.Status()
+				So(st["protocol"], ShouldEqual, "journal")
+				So(st["journalctl_path"], ShouldEqual, path)
+				So(st["journal_units"], ShouldResemble, data.Array{data.String("sshd.service")})
+				So(st["running"], ShouldEqual, data.True)
+				So(st, ShouldNotContainKey, "journal")
+
+				Convey("And it shouldn't be running after the source stops", func() {
+					So(s.Stop(ctx), ShouldBeNil)
+					So(s.Status()["running"], ShouldEqual, data.False)
+				})
+			})
+		})
+
+		Convey("When creating a source with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"missing listen":                {"listen": data.String("")},
+				"unsupported protocol":          {"protocol": data.String("sctp")},
+				"unsupported format":            {"format": data.String("json")},
+				"invalid time_zone":             {"time_zone": data.String("Mars/Olympus")},
+				"zero max_message_size":         {"max_message_size": data.Int(0)},
+				"listen with journal":           {"journal": data.True},
+				"journal_units without journal": {"journal_units": data.Array{data.String("a")}},
+				"missing journalctl": {
+					"listen":          data.String(""),
+					"address_field":   data.String(""),
+					"journal":         data.True,
+					"journalctl_path": data.String("/nonexistent/journalctl"),
+				},
+			}
+			for name, c := range cases {
+				c := c
+				Convey("Then "+name+" should result in an error", func() {
+					ps := params.Copy()
+					for k, v := range c {
+						ps[k] = v
+					}
+					_, err := createSyslogSource(ctx, &IOParams{Name: "syslog_test"}, ps)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
@@ -9,8 +9,12 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"math"
+	"os"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type TopologyBuilder struct {
@@ -21,10 +25,12 @@ type TopologyBuilder struct {
 	SourceCreators SourceCreatorRegistry
 	SinkCreators   SinkCreatorRegistry
 	UDSStorage     udf.UDSStorage
-}
 
-// TODO: Provide AtomicTopologyBuilder which support building multiple nodes
-// in an atomic manner (kind of transactionally)
+	// definitions has BQL statements which created nodes. Keys are lower
+	// case names of the nodes.
+	defMutex    sync.RWMutex
+	definitions map[string]string
+}
 
 // NewTopologyBuilder creates a new TopologyBuilder which dynamically creates
 // nodes from BQL statements. The target Topology can be shared by
@@ -33,7 +39,8 @@ type TopologyBuilder struct {
 // TopologyBuilder doesn't support atomic topology building. For example,
 // when a user wants to add three statement and the second statement fails,
 // only the node created from the first statement is registered to the topology
-// and it starts to generate tuples. Others won't be registered.
+// and it starts to generate tuples. Others won't be registered. Use
+// AddStmtsAtomically to add a group of statements as a single unit.
 func NewTopologyBuilder(t core.Topology) (*TopologyBuilder, error) {
 	udsfs, err := udf.CopyGlobalUDSFCreatorRegistry()
 	if err != nil {
@@ -71,6 +78,7 @@ func NewTopologyBuilder(t core.Topology) (*TopologyBuilder, error) {
 		SourceCreators: srcs,
 		SinkCreators:   sinks,
 		UDSStorage:     udf.NewInMemoryUDSStorage(),
+		definitions:    map[string]string{},
 	}
 	return tb, nil
 }
@@ -93,14 +101,381 @@ func (tb *TopologyBuilder) Topology() core.Topology {
 
 // AddStmt add a node created from a statement to the topology. It returns
 // a created node. It returns a nil node when the statement is CREATE STATE.
+//
+// When a CREATE statement has IF NOT EXISTS and a node of the same kind
+// already exists, AddStmt does nothing and returns the existing node. When
+// it has OR REPLACE, the existing node is removed before the new one is
+// created. Because the removed node is stopped, nodes connected to it are
+// disconnected and have to be connected to the new node again. A state
+// replaced by OR REPLACE is terminated after the new one is registered.
 func (tb *TopologyBuilder) AddStmt(stmt interface{}) (core.Node, error) {
+	if node, done, err := tb.applyCreateModifier(stmt); err != nil {
+		return nil, err
+	} else if done {
+		return node, nil
+	}
+	node, err := tb.addStmt(stmt)
+	if err != nil {
+		return nil, err
+	}
+	tb.recordDefinition(stmt)
+	return node, nil
+}
+
+// AddPreparedStmt binds params to the placeholders of a prepared statement
+// and adds the resulting statement to the topology as AddStmt does.
+func (tb *TopologyBuilder) AddPreparedStmt(stmt *parser.PreparedStmt, params data.Map) (core.Node, error) {
+	s, err := stmt.Bind(params)
+	if err != nil {
+		return nil, err
+	}
+	return tb.AddStmt(s)
+}
+
+// AddStmtsAtomically adds a group of statements to the topology as a single
+// unit. When one of the statements fails, nodes and states created by the
+// preceding statements are removed again so that the topology is never left
+// half-built. It returns nodes created by the statements in the same order
+// as stmts.
+//
+// Only CREATE SOURCE, CREATE STREAM, CREATE SINK, CREATE STATE, INSERT INTO,
+// TEE, and DROP statements can be used. A dropped node or state cannot be
+// restored, and an input of a sink cannot be disconnected without removing
+// the sink. Therefore, DROP statements and INSERT INTO or TEE statements
+// writing to sinks which aren't created in the group are applied after all
+// other statements succeeded and their targets were verified. As a result,
+// a node or a state cannot be dropped and created again in the same group.
+// CREATE statements with OR REPLACE cannot be used for the same reason.
+func (tb *TopologyBuilder) AddStmtsAtomically(stmts []interface{}) ([]core.Node, error) {
+	nodes := make([]core.Node, len(stmts))
+	created := map[string]bool{}
+	var deferred []int
+	var rollbacks []func()
+	rollback := func() {
+		for i := len(rollbacks) - 1; i >= 0; i-- {
+			rollbacks[i]()
+		}
+	}
+
+	for i, stmt := range stmts {
+		var (
+			name string
+			m    parser.CreateModifierAST
+		)
+		switch stmt := stmt.(type) {
+		case parser.CreateSourceStmt:
+			name, m = string(stmt.Name), stmt.CreateModifierAST
+		case parser.CreateStreamAsSelectStmt:
+			name, m = string(stmt.Name), stmt.CreateModifierAST
+		case parser.CreateStreamAsSelectUnionStmt:
+			name, m = string(stmt.Name), stmt.CreateModifierAST
+		case parser.CreateSinkStmt:
+			name, m = string(stmt.Name), stmt.CreateModifierAST
+		case parser.CreateStateStmt:
+			m = stmt.CreateModifierAST
+		case parser.InsertIntoFromStmt:
+			if !created[strings.ToLower(string(stmt.Sink))] {
+				deferred = append(deferred, i)
+				continue
+			}
+		case parser.TeeStmt:
+			if !created[strings.ToLower(string(stmt.Sink))] {
+				deferred = append(deferred, i)
+				continue
+			}
+		case parser.DropSourceStmt, parser.DropStreamStmt, parser.DropSinkStmt, parser.DropStateStmt:
+			deferred = append(deferred, i)
+			continue
+		default:
+			rollback()
+			return nil, fmt.Errorf("statement of type %T cannot be added atomically", stmt)
+		}
+
+		// a replaced node or state cannot be restored, and one which
+		// already existed must not be removed on rollback
+		if m.OrReplace == parser.Yes {
+			rollback()
+			return nil, fmt.Errorf("OR REPLACE cannot be used in statements added atomically")
+		}
+		existed := false
+		if m.IfNotExists == parser.Yes {
+			if s, ok := stmt.(parser.CreateStateStmt); ok {
+				_, err := tb.topology.Context().SharedStates.Get(string(s.Name))
+				existed = err == nil
+			} else {
+				_, err := tb.topology.Node(name)
+				existed = err == nil
+			}
+		}
+
+		node, err := tb.AddStmt(stmt)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		nodes[i] = node
+		if existed {
+			continue
+		}
+		if name != "" {
+			created[strings.ToLower(name)] = true
+			rollbacks = append(rollbacks, func() {
+				tb.topology.Remove(name)
+			})
+		} else if s, ok := stmt.(parser.CreateStateStmt); ok {
+			rollbacks = append(rollbacks, func() {
+				tb.topology.Context().SharedStates.Remove(string(s.Name))
+			})
+		}
+	}
+
+	// verify targets of the deferred statements before applying any of them
+	for _, i := range deferred {
+		if err := tb.verifyDeferredStmt(stmts[i]); err != nil {
+			rollback()
+			return nil, err
+		}
+	}
+	for _, i := range deferred {
+		node, err := tb.AddStmt(stmts[i])
+		if err != nil {
+			return nil, fmt.Errorf("statements were partially applied: %v", err)
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+// verifyDeferredStmt checks that the nodes or the state which a deferred
+// statement of AddStmtsAtomically refers to exist.
+func (tb *TopologyBuilder) verifyDeferredStmt(stmt interface{}) error {
+	var err error
+	switch stmt := stmt.(type) {
+	case parser.InsertIntoFromStmt:
+		if _, err = tb.topology.Sink(string(stmt.Sink)); err == nil {
+			_, err = tb.topology.Node(string(stmt.Input))
+		}
+	case parser.TeeStmt:
+		if _, err = tb.topology.Sink(string(stmt.Sink)); err == nil {
+			_, err = tb.topology.Node(string(stmt.Stream))
+		}
+	case parser.DropSourceStmt:
+		if _, err = tb.topology.Source(string(stmt.Source)); stmt.IfExists == parser.Yes && core.IsNotExist(err) {
+			err = nil
+		}
+	case parser.DropStreamStmt:
+		if _, err = tb.topology.Box(string(stmt.Stream)); stmt.IfExists == parser.Yes && core.IsNotExist(err) {
+			err = nil
+		}
+	case parser.DropSinkStmt:
+		if _, err = tb.topology.Sink(string(stmt.Sink)); stmt.IfExists == parser.Yes && core.IsNotExist(err) {
+			err = nil
+		}
+	case parser.DropStateStmt:
+		if _, err = tb.topology.Context().SharedStates.Get(string(stmt.State)); stmt.IfExists == parser.Yes && core.IsNotExist(err) {
+			err = nil
+		}
+	}
+	return err
+}
+
+// dropNode removes a node from the topology. When cascade is true, nodes
+// which directly or indirectly read from the node are removed beforehand in
+// dependency order so that no node is left without its input.
+func (tb *TopologyBuilder) dropNode(name string, cascade bool) error {
+	if cascade {
+		g, err := tb.Graph()
+		if err != nil {
+			return err
+		}
+		for _, n := range g.dependents(name) {
+			// a node might already have been removed because it stops
+			// when its inputs are disconnected
+			if err := tb.topology.Remove(n); err != nil && !core.IsNotExist(err) {
+				return fmt.Errorf("cannot drop '%v' depending on '%v': %v", n, name, err)
+			}
+		}
+	}
+	return tb.topology.Remove(name)
+}
+
+// applyCreateModifier handles IF NOT EXISTS and OR REPLACE of a CREATE
+// statement before the statement is processed. It returns true when the
+// statement doesn't have to be processed anymore. OR REPLACE of CREATE STATE
+// is handled by addStmt so that the previous state remains when the new one
+// cannot be created.
+func (tb *TopologyBuilder) applyCreateModifier(stmt interface{}) (core.Node, bool, error) {
+	var (
+		name     string
+		nodeType core.NodeType
+		m        parser.CreateModifierAST
+	)
+	switch stmt := stmt.(type) {
+	case parser.CreateSourceStmt:
+		name, nodeType, m = string(stmt.Name), core.NTSource, stmt.CreateModifierAST
+	case parser.CreateStreamAsSelectStmt:
+		name, nodeType, m = string(stmt.Name), core.NTBox, stmt.CreateModifierAST
+	case parser.CreateStreamAsSelectUnionStmt:
+		name, nodeType, m = string(stmt.Name), core.NTBox, stmt.CreateModifierAST
+	case parser.CreateSinkStmt:
+		name, nodeType, m = string(stmt.Name), core.NTSink, stmt.CreateModifierAST
+	case parser.CreateStateStmt:
+		if stmt.OrReplace == parser.Yes && stmt.IfNotExists == parser.Yes {
+			return nil, false, fmt.Errorf("OR REPLACE and IF NOT EXISTS cannot be used together")
+		}
+		if stmt.IfNotExists != parser.Yes {
+			return nil, false, nil
+		}
+		if _, err := tb.topology.Context().SharedStates.Get(string(stmt.Name)); err != nil {
+			if core.IsNotExist(err) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		return nil, true, nil
+	default:
+		return nil, false, nil
+	}
+
+	if m.OrReplace == parser.Yes && m.IfNotExists == parser.Yes {
+		return nil, false, fmt.Errorf("OR REPLACE and IF NOT EXISTS cannot be used together")
+	}
+	if m.OrReplace != parser.Yes && m.IfNotExists != parser.Yes {
+		return nil, false, nil
+	}
+
+	node, err := tb.topology.Node(name)
+	if err != nil {
+		if core.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	if node.Type() != nodeType {
+		return nil, false, fmt.Errorf("a %v having the name '%v' already exists", node.Type(), name)
+	}
+	if m.IfNotExists == parser.Yes {
+		return node, true, nil
+	}
+	if err := tb.topology.Remove(name); err != nil {
+		return nil, false, err
+	}
+	return nil, false, nil
+}
+
+// createFunction compiles a UDF written in a script language and registers it
+// to the topology.
+func (tb *TopologyBuilder) createFunction(stmt *parser.CreateFunctionStmt) error {
+	e, err := udf.LookupGlobalScriptEngine(string(stmt.Language))
+	if err != nil {
+		return err
+	}
+
+	params := make([]string, len(stmt.Params))
+	meta := &udf.FunctionMetadata{
+		Description: fmt.Sprintf("A function written in %v.", strings.ToLower(string(stmt.Language))),
+		Arguments:   make([]udf.ArgumentMetadata, len(stmt.Params)),
+		ReturnType:  "any",
+	}
+	for i, p := range stmt.Params {
+		params[i] = string(p)
+		meta.Arguments[i] = udf.ArgumentMetadata{Name: string(p), Type: "any"}
+	}
+	f, err := e.CreateFunction(params, stmt.Variadic, stmt.Body)
+	if err != nil {
+		return fmt.Errorf("cannot create function '%v': %v", stmt.Name, err)
+	}
+	return tb.Reg.RegisterWithMetadata(string(stmt.Name), f, meta)
+}
+
+// createRemoteFunction creates a UDF calling a function running outside of
+// SensorBee and registers it to the function registry of the topology.
+func (tb *TopologyBuilder) createRemoteFunction(stmt *parser.CreateRemoteFunctionStmt) error {
+	c, err := udf.LookupGlobalUDFCreator(string(stmt.Type))
+	if err != nil {
+		return err
+	}
+	params, err := tb.mkParamsMap(stmt.Params.Params)
+	if err != nil {
+		return err
+	}
+	f, err := c.CreateUDF(tb.topology.Context(), params)
+	if err != nil {
+		return fmt.Errorf("cannot create function '%v': %v", stmt.Name, err)
+	}
+	meta := &udf.FunctionMetadata{
+		Description: fmt.Sprintf("A function of type %v.", strings.ToLower(string(stmt.Type))),
+		ReturnType:  "any",
+	}
+	return tb.Reg.RegisterWithMetadata(string(stmt.Name), f, meta)
+}
+
+// recordDefinition records the statement which created a node so that it can
+// be shown in the graph of the topology.
+func (tb *TopologyBuilder) recordDefinition(stmt interface{}) {
+	var name string
+	switch stmt := stmt.(type) {
+	case parser.CreateSourceStmt:
+		name = string(stmt.Name)
+	case parser.CreateStreamAsSelectStmt:
+		name = string(stmt.Name)
+	case parser.CreateStreamAsSelectUnionStmt:
+		name = string(stmt.Name)
+	case parser.CreateSinkStmt:
+		name = string(stmt.Name)
+	default:
+		return
+	}
+
+	tb.defMutex.Lock()
+	defer tb.defMutex.Unlock()
+	tb.definitions[strings.ToLower(name)] = fmt.Sprint(stmt)
+}
+
+func (tb *TopologyBuilder) definition(name string) string {
+	tb.defMutex.RLock()
+	defer tb.defMutex.RUnlock()
+	return tb.definitions[strings.ToLower(name)]
+}
+
+func (tb *TopologyBuilder) addStmt(stmt interface{}) (core.Node, error) {
 	// TODO: Enable StopOnDisconnect properly
 
 	// check the type of statement
 	switch stmt := stmt.(type) {
 	case parser.CreateSourceStmt:
 		// load params into map for faster access
-		paramsMap := tb.mkParamsMap(stmt.Params)
+		paramsMap, err := tb.mkParamsMap(stmt.Params)
+		if err != nil {
+			return nil, err
+		}
+
+		// "heartbeat" is handled by the topology and isn't passed to
+		// the source
+		heartbeat, err := tb.heartbeatParam(paramsMap)
+		if err != nil {
+			return nil, err
+		}
+		pauseThreshold, resumeThreshold, err := tb.backpressureParams(paramsMap)
+		if err != nil {
+			return nil, err
+		}
+		correlationIDPath, err := tb.correlationIDParam(paramsMap)
+		if err != nil {
+			return nil, err
+		}
+		pausedMode, pausedBufferSize, err := tb.pausedWriteParams(paramsMap)
+		if err != nil {
+			return nil, err
+		}
+		maxTuples, err := tb.maxTuplesParam(paramsMap)
+		if err != nil {
+			return nil, err
+		}
+		eventTime, err := tb.eventTimeParams(stmt.TimestampBy, paramsMap)
+		if err != nil {
+			return nil, err
+		}
 
 		// check if we know this type of source
 		creator, err := tb.SourceCreators.Lookup(string(stmt.Type))
@@ -117,13 +492,28 @@ func (tb *TopologyBuilder) AddStmt(stmt interface{}) (core.Node, error) {
 			return nil, err
 		}
 		return tb.topology.AddSource(string(stmt.Name), source, &core.SourceConfig{
-			PausedOnStartup: stmt.Paused == parser.Yes,
+			PausedOnStartup:   stmt.Paused == parser.Yes,
+			Heartbeat:         heartbeat,
+			PauseThreshold:    pauseThreshold,
+			ResumeThreshold:   resumeThreshold,
+			PausedWriteMode:   pausedMode,
+			PausedBufferSize:  pausedBufferSize,
+			MaxTuples:         maxTuples,
+			CorrelationIDPath: correlationIDPath,
+			EventTime:         eventTime,
 		})
 
 	case parser.CreateStreamAsSelectStmt:
 		return tb.createStreamAsSelectStmt(&stmt)
 
 	case parser.CreateStreamAsSelectUnionStmt:
+		if stmt.Recursive {
+			return tb.createRecursiveStream(&stmt)
+		}
+		if stmt.Ordered == parser.Yes {
+			return tb.createOrderedUnionStream(&stmt)
+		}
+
 		// idea: create an intermediate box for each SELECT substatement,
 		// then connect them with a simple forwarder box
 		names := make([]string, 0, len(stmt.Selects))
@@ -137,10 +527,10 @@ func (tb *TopologyBuilder) AddStmt(stmt interface{}) (core.Node, error) {
 			// create a stream with a generated name and recurse
 			tmpName := fmt.Sprintf("sensorbee_tmp_%v", topologyBuilderNextTemporaryID())
 			tmpStmt := parser.CreateStreamAsSelectStmt{
-				parser.StreamIdentifier(tmpName),
-				selStmt,
+				Name:   parser.StreamIdentifier(tmpName),
+				Select: selStmt,
 			}
-			box, err := tb.AddStmt(tmpStmt)
+			box, err := tb.addStmt(tmpStmt)
 			if err != nil {
 				removeTmpNodes()
 				return nil, err
@@ -174,7 +564,35 @@ func (tb *TopologyBuilder) AddStmt(stmt interface{}) (core.Node, error) {
 
 	case parser.CreateSinkStmt:
 		// load params into map for faster access
-		paramsMap := tb.mkParamsMap(stmt.Params)
+		paramsMap, err := tb.mkParamsMap(stmt.Params)
+		if err != nil {
+			return nil, err
+		}
+
+		// "id_columns" is handled by the topology and isn't passed to
+		// the sink
+		idGenerator, err := tb.idColumnsParam(paramsMap)
+		if err != nil {
+			return nil, err
+		}
+
+		// so are parameters of retries and the dead-letter sink
+		retry, err := tb.retryParams(paramsMap)
+		if err != nil {
+			return nil, err
+		}
+		deadLetter, err := tb.deadLetterParam(paramsMap)
+		if err != nil {
+			return nil, err
+		}
+		batch, err := tb.batchParams(paramsMap)
+		if err != nil {
+			return nil, err
+		}
+		validator, err := schemaValidator(stmt.SchemaAST)
+		if err != nil {
+			return nil, err
+		}
 
 		// check if we know this type of sink
 		creator, err := tb.SinkCreators.Lookup(string(stmt.Type))
@@ -193,7 +611,13 @@ func (tb *TopologyBuilder) AddStmt(stmt interface{}) (core.Node, error) {
 		// we insert a sink, but cannot connect it to
 		// any streams yet, therefore we have to keep track
 		// of the SinkDeclarer
-		return tb.topology.AddSink(string(stmt.Name), sink, nil)
+		return tb.topology.AddSink(string(stmt.Name), sink, &core.SinkConfig{
+			IDGenerator: idGenerator,
+			Validator:   validator,
+			Retry:       retry,
+			DeadLetter:  deadLetter,
+			Batch:       batch,
+		})
 
 	case parser.CreateStateStmt:
 		c, err := tb.UDSCreators.Lookup(string(stmt.Type))
@@ -202,10 +626,17 @@ func (tb *TopologyBuilder) AddStmt(stmt interface{}) (core.Node, error) {
 		}
 
 		ctx := tb.topology.Context()
-		s, err := c.CreateState(ctx, tb.mkParamsMap(stmt.Params))
+		params, err := tb.mkParamsMap(stmt.Params)
+		if err != nil {
+			return nil, err
+		}
+		s, err := c.CreateState(ctx, params)
 		if err != nil {
 			return nil, err
 		}
+		if stmt.OrReplace == parser.Yes {
+			return nil, tb.replaceState(string(stmt.Name), string(stmt.Type), s)
+		}
 		if err := ctx.SharedStates.Add(string(stmt.Name), string(stmt.Type), s); err != nil {
 			return nil, err
 		}
@@ -222,17 +653,38 @@ func (tb *TopologyBuilder) AddStmt(stmt interface{}) (core.Node, error) {
 		if !ok {
 			return nil, fmt.Errorf("%s cannot be updated", string(stmt.Name))
 		}
-		return nil, u.Update(ctx, tb.mkParamsMap(stmt.Params))
+		params, err := tb.mkParamsMap(stmt.Params)
+		if err != nil {
+			return nil, err
+		}
+		return nil, u.Update(ctx, params)
 
 	case parser.SaveStateStmt:
 		return nil, tb.saveState(string(stmt.Name), stmt.Tag)
 
+	case parser.LoadPluginStmt:
+		return nil, tb.LoadPlugin(stmt.Path)
+
+	case parser.CreateFunctionStmt:
+		return nil, tb.createFunction(&stmt)
+
+	case parser.CreateRemoteFunctionStmt:
+		return nil, tb.createRemoteFunction(&stmt)
+
 	case parser.LoadStateStmt:
-		_, err := tb.loadState(string(stmt.Type), string(stmt.Name), stmt.Tag, tb.mkParamsMap(stmt.Params))
+		params, err := tb.mkParamsMap(stmt.Params)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tb.loadState(string(stmt.Type), string(stmt.Name), stmt.Tag, params)
 		return nil, err
 
 	case parser.LoadStateOrCreateStmt:
-		shouldCreate, err := tb.loadState(string(stmt.Type), string(stmt.Name), stmt.Tag, tb.mkParamsMap(stmt.LoadSpecs.Params))
+		params, err := tb.mkParamsMap(stmt.LoadSpecs.Params)
+		if err != nil {
+			return nil, err
+		}
+		shouldCreate, err := tb.loadState(string(stmt.Type), string(stmt.Name), stmt.Tag, params)
 		if shouldCreate {
 			c := parser.CreateStateStmt{}
 			c.Type = stmt.Type
@@ -252,7 +704,11 @@ func (tb *TopologyBuilder) AddStmt(stmt interface{}) (core.Node, error) {
 		if !ok {
 			return nil, fmt.Errorf("%s cannot be updated", string(stmt.Name))
 		}
-		return nil, u.Update(tb.topology.Context(), tb.mkParamsMap(stmt.Params))
+		params, err := tb.mkParamsMap(stmt.Params)
+		if err != nil {
+			return nil, err
+		}
+		return nil, u.Update(tb.topology.Context(), params)
 
 	case parser.UpdateSinkStmt:
 		sink, err := tb.topology.Sink(string(stmt.Name))
@@ -264,27 +720,43 @@ func (tb *TopologyBuilder) AddStmt(stmt interface{}) (core.Node, error) {
 		if !ok {
 			return nil, fmt.Errorf("%s cannot be updated", string(stmt.Name))
 		}
-		return nil, u.Update(tb.topology.Context(), tb.mkParamsMap(stmt.Params))
+		params, err := tb.mkParamsMap(stmt.Params)
+		if err != nil {
+			return nil, err
+		}
+		return nil, u.Update(tb.topology.Context(), params)
 
 	case parser.DropSourceStmt:
 		_, err := tb.topology.Source(string(stmt.Source))
 		if err != nil {
+			if stmt.IfExists == parser.Yes && core.IsNotExist(err) {
+				return nil, nil
+			}
 			return nil, err
 		}
 
-		return nil, tb.topology.Remove(string(stmt.Source))
+		return nil, tb.dropNode(string(stmt.Source), stmt.Cascade == parser.Yes)
 
 	case parser.DropStreamStmt:
 		_, err := tb.topology.Box(string(stmt.Stream))
 		if err != nil {
+			if stmt.IfExists == parser.Yes && core.IsNotExist(err) {
+				return nil, nil
+			}
 			return nil, err
 		}
 
-		return nil, tb.topology.Remove(string(stmt.Stream))
+		return nil, tb.dropNode(string(stmt.Stream), stmt.Cascade == parser.Yes)
+
+	case parser.AlterStreamStmt:
+		return tb.alterStream(&stmt)
 
 	case parser.DropSinkStmt:
 		_, err := tb.topology.Sink(string(stmt.Sink))
 		if err != nil {
+			if stmt.IfExists == parser.Yes && core.IsNotExist(err) {
+				return nil, nil
+			}
 			return nil, err
 		}
 
@@ -294,6 +766,9 @@ func (tb *TopologyBuilder) AddStmt(stmt interface{}) (core.Node, error) {
 		ctx := tb.topology.Context()
 		_, err := ctx.SharedStates.Get(string(stmt.State))
 		if err != nil {
+			if stmt.IfExists == parser.Yes && core.IsNotExist(err) {
+				return nil, nil
+			}
 			return nil, err
 		}
 
@@ -306,8 +781,25 @@ func (tb *TopologyBuilder) AddStmt(stmt interface{}) (core.Node, error) {
 		if err != nil {
 			return nil, err
 		}
-		// now connect the sink to the specified box
-		if err := sink.Input(string(stmt.Input), nil); err != nil {
+		// now connect the sink to the specified box. with DRY RUN, the sink
+		// node only counts tuples from the input and discards them.
+		var config *core.SinkInputConfig
+		if stmt.DryRun == parser.Yes {
+			config = &core.SinkInputConfig{DryRun: true}
+		}
+		if err := sink.Input(string(stmt.Input), config); err != nil {
+			return nil, err
+		}
+		return sink, nil
+
+	case parser.TeeStmt:
+		sink, err := tb.topology.Sink(string(stmt.Sink))
+		if err != nil {
+			return nil, err
+		}
+		// the stream broadcasts tuples to all destinations, so adding the
+		// sink as a new destination doesn't affect the others
+		if err := sink.Input(string(stmt.Stream), nil); err != nil {
 			return nil, err
 		}
 		return sink, nil
@@ -341,6 +833,21 @@ func (tb *TopologyBuilder) AddStmt(stmt interface{}) (core.Node, error) {
 			return nil, err
 		}
 		return src, nil
+
+	case parser.ReloadSourceStmt:
+		src, err := tb.topology.Source(string(stmt.Source))
+		if err != nil {
+			return nil, err
+		}
+
+		r, ok := src.Source().(core.Reloader)
+		if !ok {
+			return nil, fmt.Errorf("%s cannot be reloaded", string(stmt.Source))
+		}
+		if err := r.Reload(tb.topology.Context()); err != nil {
+			return nil, err
+		}
+		return src, nil
 	}
 
 	return nil, fmt.Errorf("statement of type %T is unimplemented", stmt)
@@ -366,6 +873,11 @@ func (b *udsfBox) Init(ctx *core.Context) error {
 }
 
 func (b *udsfBox) Process(ctx *core.Context, t *core.Tuple, w core.Writer) error {
+	if t.CorrelationID != "" {
+		// propagate the correlation ID to tuples which the UDSF newly
+		// creates from the input tuple
+		w = &correlationIDWriter{w: w, id: t.CorrelationID}
+	}
 	return b.f.Process(ctx, t, w)
 }
 
@@ -373,6 +885,23 @@ func (b *udsfBox) Terminate(ctx *core.Context) error {
 	return b.f.Terminate(ctx)
 }
 
+// correlationIDWriter is a core.Writer which assigns a correlation ID to
+// tuples not having one.
+type correlationIDWriter struct {
+	w  core.Writer
+	id string
+}
+
+func (cw *correlationIDWriter) Write(ctx *core.Context, t *core.Tuple) error {
+	if t.CorrelationID == "" {
+		if t.Flags.IsSet(core.TFShared) {
+			t = t.ShallowCopy()
+		}
+		t.CorrelationID = cw.id
+	}
+	return cw.w.Write(ctx, t)
+}
+
 // udsfSource is a core.Source which runs a UDSF in the source mode.
 type udsfSource struct {
 	f       udf.UDSF
@@ -407,9 +936,23 @@ func (s *udsfSource) Stop(ctx *core.Context) error {
 }
 
 func (tb *TopologyBuilder) createStreamAsSelectStmt(stmt *parser.CreateStreamAsSelectStmt) (core.Node, error) {
+	if len(stmt.Select.With) > 0 {
+		return tb.createStreamWithNamedSelects(stmt)
+	}
+
 	// insert a bqlBox that executes the SELECT statement
 	outName := string(stmt.Name)
+	params, err := tb.mkParamsMap(stmt.Params)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := tb.streamParams(params)
+	if err != nil {
+		return nil, err
+	}
 	box := NewBQLBox(&stmt.Select, tb.Reg)
+	box.caseInsensitive = stmt.CaseInsensitive == parser.Yes
+	box.processingTimeout = timeout
 	// add all the referenced relations as named inputs
 	dbox, err := tb.topology.AddBox(outName, box, nil)
 	if err != nil {
@@ -441,35 +984,9 @@ func (tb *TopologyBuilder) createStreamAsSelectStmt(stmt *parser.CreateStreamAsS
 				// and we already have connected x to this box before
 				continue
 			}
-			conf := &core.BoxInputConfig{
-				// For self-join statements like
-				//   ... FROM x AS a [RANGE 2 TUPLES],
-				//            x AS b [RANGE 3 TUPLES],
-				//            y AS c [RANGE 4 TUPLES] ...
-				// the bqlBox will have only *two* inputs:
-				//  - one is `x` with `InputName: x`,
-				//  - one is `y` with `InputName: y`.
-				//
-				// When a tuple arrives with `InputName: x`, it will be added
-				// to the input buffer for `a` and to the input buffer for `b`
-				// in the execution plan. When a tuple arrives with `InputName: y`,
-				// it will be added to the input buffer for `c`.
-				//
-				// If we used the rel.Alias here, then we would have to make multiple
-				// input connections to the same box, which is not possible.
-				InputName: rel.Name,
-			}
-			// set capacity of input pipe
-			if rel.Capacity != parser.UnspecifiedCapacity {
-				conf.Capacity = int(rel.Capacity)
-			}
-			// set drop mode for box
-			if rel.Shedding == parser.DropOldest {
-				conf.DropMode = core.DropOldest
-			} else if rel.Shedding == parser.DropNewest {
-				conf.DropMode = core.DropLatest
-			} else if rel.Shedding == parser.Wait {
-				conf.DropMode = core.DropNone
+			conf, err := actualStreamInputConfig(&rel)
+			if err != nil {
+				return nil, err
 			}
 			if err := dbox.Input(rel.Name, conf); err != nil {
 				return nil, err
@@ -486,6 +1003,21 @@ func (tb *TopologyBuilder) createStreamAsSelectStmt(stmt *parser.CreateStreamAsS
 				pausedSources = append(pausedSources, sn)
 			}
 
+		case parser.DroppedTuplesStream:
+			sn, name, err := tb.setUpDroppedTuplesStream(dbox, &rel)
+			if err != nil {
+				return nil, err
+			}
+			temporaryNodes = append(temporaryNodes, name)
+			pausedSources = append(pausedSources, sn)
+
+		case parser.MatchRecognizeStream:
+			name, err := tb.setUpMatchRecognizeStream(dbox, &rel)
+			if err != nil {
+				return nil, err
+			}
+			temporaryNodes = append(temporaryNodes, name)
+
 		default:
 			return nil, fmt.Errorf("input stream of type %s not implemented",
 				rel.Type)
@@ -503,45 +1035,430 @@ func (tb *TopologyBuilder) createStreamAsSelectStmt(stmt *parser.CreateStreamAsS
 	return dbox, nil
 }
 
-// setUpUDSFStream creates a Source or a Box from a UDSF. When it creates a
-// Source, it will return the corresponding core.SourceNode of it. Otherwise,
-// it returns nil for core.SourceNode. It also returns the temporary name of
-// the UDSF node.
-func (tb *TopologyBuilder) setUpUDSFStream(subsequentBox core.BoxNode, rel *parser.AliasedStreamWindowAST) (core.SourceNode, string, error) {
-	// Compute the values of the UDSF parameters (if there was
-	// an unusable parameter, as in `udsf(7, col)` this will fail).
-	// Note: it doesn't feel exactly right to do this kind of
-	// validation here after parsing has been done "successfully",
-	// on the other hand the parser should not evaluate expressions
-	// (and cannot import the execution package) or make too many
-	// semantical checks, so we leave this here for the moment.
-	params := make([]data.Value, len(rel.Params))
-	for i, expr := range rel.Params {
-		p, err := execution.EvaluateFoldable(expr, tb.Reg)
+// createStreamWithNamedSelects creates a stream from a SELECT statement
+// having a WITH clause. Each named SELECT statement of the WITH clause is
+// computed in an intermediate stream with a generated name, and references
+// to its name in the FROM clause of the following statements are replaced
+// by the generated name. The intermediate streams are removed when the
+// stream is stopped.
+func (tb *TopologyBuilder) createStreamWithNamedSelects(stmt *parser.CreateStreamAsSelectStmt) (core.Node, error) {
+	renames := make(map[string]string, len(stmt.Select.With))
+	names := make([]string, 0, len(stmt.Select.With))
+	nodes := make([]core.BoxNode, 0, len(stmt.Select.With))
+	removeTmpNodes := func() {
+		for _, name := range names {
+			tb.topology.Remove(name)
+		}
+	}
+	for _, named := range stmt.Select.With {
+		name := string(named.Name)
+		if _, ok := renames[name]; ok {
+			removeTmpNodes()
+			return nil, fmt.Errorf("stream '%s' is defined more than once in the WITH clause", name)
+		}
+
+		// create a stream with a generated name and recurse
+		tmpName := fmt.Sprintf("sensorbee_tmp_%v", topologyBuilderNextTemporaryID())
+		tmpStmt := parser.CreateStreamAsSelectStmt{
+			Name:            parser.StreamIdentifier(tmpName),
+			Select:          named.Select,
+			CaseInsensitive: stmt.CaseInsensitive,
+		}
+		tmpStmt.Select.Relations = renameRelations(named.Select.Relations, renames)
+		box, err := tb.addStmt(tmpStmt)
 		if err != nil {
-			return nil, "", err
+			removeTmpNodes()
+			return nil, err
 		}
-		params[i] = p
+		names = append(names, tmpName)
+		nodes = append(nodes, box.(core.BoxNode))
+		// a named statement can only be referred to by the following ones
+		renames[name] = tmpName
 	}
 
-	udsfc, err := tb.UDSFCreators.Lookup(rel.Name, len(params))
+	mainStmt := *stmt
+	mainStmt.Select.With = nil
+	mainStmt.Select.Relations = renameRelations(stmt.Select.Relations, renames)
+	node, err := tb.createStreamAsSelectStmt(&mainStmt)
 	if err != nil {
-		return nil, "", err
+		removeTmpNodes()
+		return nil, err
 	}
+	// call StopOnDisconnect only after the outbound connections
+	// have been made
+	for _, node := range nodes {
+		node.StopOnDisconnect(core.Inbound | core.Outbound)
+		node.RemoveOnStop()
+	}
+	return node, nil
+}
 
-	decl := udf.NewUDSFDeclarer()
-	udsf, err := func() (f udf.UDSF, err error) {
-		defer func() {
-			if e := recover(); e != nil {
-				if er, ok := e.(error); ok {
-					err = er
-				} else {
-					err = fmt.Errorf("cannot create a UDSF: %v", e)
-				}
+// renameRelations returns a copy of rels in which the names of actual
+// streams, including ones MATCH_RECOGNIZE is applied to, are replaced
+// according to renames. A renamed relation keeps
+// its original name as the alias so that it can still be referred to
+// by that name in the statement.
+func renameRelations(rels []parser.AliasedStreamWindowAST, renames map[string]string) []parser.AliasedStreamWindowAST {
+	renamed := make([]parser.AliasedStreamWindowAST, len(rels))
+	for i, rel := range rels {
+		if newName, ok := renames[rel.Name]; ok && (rel.Type == parser.ActualStream || rel.Type == parser.MatchRecognizeStream) {
+			if rel.Alias == "" {
+				rel.Alias = rel.Name
 			}
-		}()
-		return udsfc.CreateUDSF(tb.topology.Context(), decl, params...)
-	}()
+			rel.Name = newName
+		}
+		renamed[i] = rel
+	}
+	return renamed
+}
+
+// actualStreamInputConfig returns the configuration of the input pipe of a
+// box reading from an actual stream.
+func actualStreamInputConfig(rel *parser.AliasedStreamWindowAST) (*core.BoxInputConfig, error) {
+	conf := &core.BoxInputConfig{
+		// For self-join statements like
+		//   ... FROM x AS a [RANGE 2 TUPLES],
+		//            x AS b [RANGE 3 TUPLES],
+		//            y AS c [RANGE 4 TUPLES] ...
+		// the bqlBox will have only *two* inputs:
+		//  - one is `x` with `InputName: x`,
+		//  - one is `y` with `InputName: y`.
+		//
+		// When a tuple arrives with `InputName: x`, it will be added
+		// to the input buffer for `a` and to the input buffer for `b`
+		// in the execution plan. When a tuple arrives with `InputName: y`,
+		// it will be added to the input buffer for `c`.
+		//
+		// If we used the rel.Alias here, then we would have to make multiple
+		// input connections to the same box, which is not possible.
+		InputName: rel.Name,
+	}
+	// set capacity of input pipe
+	capacity, err := windowCapacity(&rel.StreamWindowAST)
+	if err != nil {
+		return nil, err
+	}
+	conf.Capacity = capacity
+	// set drop mode for box
+	if rel.Shedding == parser.DropOldest {
+		conf.DropMode = core.DropOldest
+	} else if rel.Shedding == parser.DropNewest {
+		conf.DropMode = core.DropLatest
+	} else if rel.Shedding == parser.Wait {
+		conf.DropMode = core.DropNone
+	}
+	return conf, nil
+}
+
+// windowCapacity returns the capacity of the input pipe of a window in
+// tuples, or 0 when BUFFER SIZE is omitted. When BUFFER SIZE is given in
+// bytes, the capacity is derived from the estimated size of nominalTuple.
+func windowCapacity(w *parser.StreamWindowAST) (int, error) {
+	if w.Capacity == parser.UnspecifiedCapacity {
+		return 0, nil
+	}
+	capacity := EstimateWindowCapacity(w, nominalTuple)
+	if capacity > math.MaxInt32 {
+		return 0, fmt.Errorf("specified buffer capacity %d is too large", capacity)
+	} else if capacity < 0 {
+		// the parser should not allow this to happen, actually
+		return 0, fmt.Errorf("specified buffer capacity %d must not be negative", capacity)
+	}
+	return int(capacity), nil
+}
+
+// createOrderedUnionStream creates a box executing all SELECT statements of
+// CREATE STREAM ... UNION ALL ORDERED. Unlike the unordered version, which
+// creates an intermediate box for each SELECT statement, this box processes
+// each input tuple with the statements one by one so that results are
+// emitted in the order of declaration. An input stream referred from
+// multiple statements is connected to the box only once, and the buffer
+// options of its first occurrence are used.
+func (tb *TopologyBuilder) createOrderedUnionStream(stmt *parser.CreateStreamAsSelectUnionStmt) (core.Node, error) {
+	for _, sel := range stmt.Selects {
+		for _, rel := range sel.Relations {
+			if rel.Type != parser.ActualStream {
+				return nil, fmt.Errorf("input stream of type %s cannot be used in UNION ALL ORDERED",
+					rel.Type)
+			}
+		}
+	}
+
+	outName := string(stmt.Name)
+	dbox, err := tb.topology.AddBox(outName, newOrderedUnionBox(&stmt.SelectUnionStmt, tb.Reg), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	connected := map[string]bool{}
+	for _, sel := range stmt.Selects {
+		for _, rel := range sel.Relations {
+			if connected[rel.Name] {
+				continue
+			}
+			conf, err := actualStreamInputConfig(&rel)
+			if err != nil {
+				tb.topology.Remove(outName)
+				return nil, err
+			}
+			if err := dbox.Input(rel.Name, conf); err != nil {
+				tb.topology.Remove(outName)
+				return nil, err
+			}
+			connected[rel.Name] = true
+		}
+	}
+	dbox.StopOnDisconnect(core.Inbound)
+	dbox.RemoveOnStop()
+	return dbox, nil
+}
+
+// createRecursiveStream creates a box executing SELECT statements of
+// CREATE RECURSIVE STREAM. Statements referring to the stream itself aren't
+// connected to the box but receive results of the box directly from it, so
+// that the topology doesn't have a cycle. The box feeds results back at most
+// MaxIterations times per input tuple.
+func (tb *TopologyBuilder) createRecursiveStream(stmt *parser.CreateStreamAsSelectUnionStmt) (core.Node, error) {
+	outName := string(stmt.Name)
+	if stmt.MaxIterations <= 0 {
+		return nil, fmt.Errorf("MAX ITERATIONS of a recursive stream must be greater than 0")
+	}
+	if stmt.Ordered == parser.Yes {
+		return nil, fmt.Errorf("a recursive stream cannot have ORDERED option")
+	}
+
+	hasBase, hasRecursive := false, false
+	for _, sel := range stmt.Selects {
+		recursive := false
+		for _, rel := range sel.Relations {
+			if rel.Type != parser.ActualStream {
+				return nil, fmt.Errorf("input stream of type %s cannot be used in a recursive stream",
+					rel.Type)
+			}
+			if rel.Name == outName {
+				recursive = true
+			}
+		}
+		for _, opt := range sel.EmitterOptions {
+			if s, ok := opt.(parser.EmitterSampling); ok && s.Type == parser.TimeBasedSampling {
+				return nil, fmt.Errorf("time-based sampling cannot be used in a recursive stream")
+			}
+		}
+		if recursive {
+			hasRecursive = true
+		} else {
+			hasBase = true
+		}
+	}
+	if !hasBase {
+		return nil, fmt.Errorf("a recursive stream needs a SELECT statement not referring to '%v'", outName)
+	}
+	if !hasRecursive {
+		return nil, fmt.Errorf("a recursive stream needs a SELECT statement referring to '%v'", outName)
+	}
+
+	box := newRecursiveUnionBox(outName, stmt, tb.Reg)
+	dbox, err := tb.topology.AddBox(outName, box, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	connected := map[string]bool{outName: true}
+	for _, sel := range stmt.Selects {
+		for _, rel := range sel.Relations {
+			if connected[rel.Name] {
+				continue
+			}
+			conf, err := actualStreamInputConfig(&rel)
+			if err != nil {
+				tb.topology.Remove(outName)
+				return nil, err
+			}
+			if err := dbox.Input(rel.Name, conf); err != nil {
+				tb.topology.Remove(outName)
+				return nil, err
+			}
+			connected[rel.Name] = true
+		}
+	}
+	dbox.StopOnDisconnect(core.Inbound)
+	dbox.RemoveOnStop()
+	return dbox, nil
+}
+
+// alterStream changes the buffer size and the shedding option of all input
+// streams of a stream created by CREATE STREAM AS SELECT. Inputs from UDSFs
+// are not affected.
+func (tb *TopologyBuilder) alterStream(stmt *parser.AlterStreamStmt) (core.Node, error) {
+	bn, err := tb.topology.Box(string(stmt.Stream))
+	if err != nil {
+		return nil, err
+	}
+	box, ok := bn.Box().(*bqlBox)
+	if !ok {
+		return nil, fmt.Errorf("stream '%v' cannot be altered", stmt.Stream)
+	}
+
+	if stmt.Capacity != parser.UnspecifiedCapacity && stmt.Capacity > math.MaxInt32 {
+		return nil, fmt.Errorf("specified buffer capacity %d is too large", stmt.Capacity)
+	}
+	var dropMode core.QueueDropMode
+	switch stmt.Shedding {
+	case parser.DropOldest:
+		dropMode = core.DropOldest
+	case parser.DropNewest:
+		dropMode = core.DropLatest
+	case parser.Wait:
+		dropMode = core.DropNone
+	}
+
+	altered := map[string]bool{}
+	for _, rel := range box.stmt.Relations {
+		if rel.Type != parser.ActualStream || altered[rel.Name] {
+			continue
+		}
+		if stmt.Shedding != parser.UnspecifiedSheddingOption {
+			if err := bn.SetInputDropMode(rel.Name, dropMode); err != nil {
+				return nil, err
+			}
+		}
+		if stmt.Capacity != parser.UnspecifiedCapacity {
+			if err := bn.SetInputCapacity(rel.Name, int(stmt.Capacity)); err != nil {
+				return nil, err
+			}
+		}
+		altered[rel.Name] = true
+	}
+	return bn, nil
+}
+
+// matchRecognizeBox is a core.Box which emits a tuple having the measures
+// of each match of a MATCH_RECOGNIZE clause found in its input.
+type matchRecognizeBox struct {
+	m  sync.Mutex
+	mr *execution.MatchRecognizer
+}
+
+func (b *matchRecognizeBox) Process(ctx *core.Context, t *core.Tuple, w core.Writer) error {
+	if t.Flags.IsSet(core.TFHeartbeat) {
+		// forward the heartbeat so that windows of the subsequent box can
+		// be closed
+		return w.Write(ctx, t)
+	}
+
+	b.m.Lock()
+	res, err := b.mr.Process(t.Data)
+	b.m.Unlock()
+	if err != nil {
+		return err
+	}
+	if res == nil {
+		return nil
+	}
+	out := t.ShallowCopy()
+	out.Data = res
+	return w.Write(ctx, out)
+}
+
+// setUpMatchRecognizeStream creates a box finding matches of the
+// MATCH_RECOGNIZE clause of the relation in the stream and connects it to
+// the subsequent box. It returns the temporary name of the box, which is
+// removed when it's disconnected from the stream or the subsequent box.
+func (tb *TopologyBuilder) setUpMatchRecognizeStream(subsequentBox core.BoxNode, rel *parser.AliasedStreamWindowAST) (string, error) {
+	mr, err := execution.NewMatchRecognizer(rel.MatchRecognize, tb.Reg)
+	if err != nil {
+		return "", err
+	}
+
+	conf, err := actualStreamInputConfig(rel)
+	if err != nil {
+		return "", err
+	}
+	// the input name must be distinguished from the stream itself in the
+	// same way as DROPPED TUPLES
+	alias := rel.Alias
+	if alias == "" {
+		alias = rel.Name
+	}
+	conf.InputName = fmt.Sprintf("%s/%s", rel.Name, alias)
+
+	temporaryName := fmt.Sprintf("sensorbee_tmp_match_%v", topologyBuilderNextTemporaryID())
+	bn, err := tb.topology.AddBox(temporaryName, &matchRecognizeBox{mr: mr}, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := bn.Input(rel.Name, nil); err != nil {
+		tb.topology.Remove(temporaryName)
+		return "", err
+	}
+	if err := subsequentBox.Input(temporaryName, conf); err != nil {
+		tb.topology.Remove(temporaryName)
+		return "", err
+	}
+	bn.StopOnDisconnect(core.Inbound | core.Outbound)
+	bn.RemoveOnStop()
+	return temporaryName, nil
+}
+
+// setUpDroppedTuplesStream creates a paused Source generating tuples dropped
+// by the node referred to by the relation and connects it to the subsequent
+// box. It returns the SourceNode and the temporary name of the source. The
+// source is removed when the box is disconnected from it.
+func (tb *TopologyBuilder) setUpDroppedTuplesStream(subsequentBox core.BoxNode, rel *parser.AliasedStreamWindowAST) (core.SourceNode, string, error) {
+	if _, err := tb.topology.Node(rel.Name); err != nil {
+		return nil, "", err
+	}
+
+	conf, err := actualStreamInputConfig(rel)
+	if err != nil {
+		return nil, "", err
+	}
+	// the input name must be distinguished from the node itself in the same
+	// way as a UDSF, as in `FROM x [RANGE 1 TUPLES], x DROPPED TUPLES [RANGE
+	// 1 TUPLES] AS d`
+	alias := rel.Alias
+	if alias == "" {
+		alias = rel.Name
+	}
+	conf.InputName = fmt.Sprintf("%s/%s", rel.Name, alias)
+
+	temporaryName := fmt.Sprintf("sensorbee_tmp_dropped_%v", topologyBuilderNextTemporaryID())
+	sn, err := tb.topology.AddSource(temporaryName, core.NewNodeDroppedTupleCollectorSource(rel.Name), &core.SourceConfig{
+		PausedOnStartup: true,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if err := subsequentBox.Input(temporaryName, conf); err != nil {
+		tb.topology.Remove(temporaryName)
+		return nil, "", err
+	}
+	sn.StopOnDisconnect()
+	sn.RemoveOnStop()
+	// The source will be resumed by the caller.
+	return sn, temporaryName, nil
+}
+
+// setUpUDSFStream creates a Source or a Box from a UDSF. When it creates a
+// Source, it will return the corresponding core.SourceNode of it. Otherwise,
+// it returns nil for core.SourceNode. It also returns the temporary name of
+// the UDSF node.
+func (tb *TopologyBuilder) setUpUDSFStream(subsequentBox core.BoxNode, rel *parser.AliasedStreamWindowAST) (core.SourceNode, string, error) {
+	// Each UDSF runs as a node having its own goroutine, so the number of
+	// them is limited by core.ContextConfig.MaxUDSFInstances. The limit is
+	// counted over all UDSFs in the topology including ones created by other
+	// TopologyBuilders, which share the lock through the Context.
+	max, lock := tb.topology.Context().UDSFInstanceLimit()
+	lock.Lock()
+	defer lock.Unlock()
+	if max > 0 {
+		if n := tb.numUDSFInstances(); n >= max {
+			return nil, "", fmt.Errorf("cannot create UDSF '%v' because the topology already has %v UDSF instances, "+
+				"which is the limit", rel.Name, n)
+		}
+	}
+
+	udsf, decl, err := tb.createUDSF(rel)
 	if err != nil {
 		return nil, "", err
 	}
@@ -566,15 +1483,11 @@ func (tb *TopologyBuilder) setUpUDSFStream(subsequentBox core.BoxNode, rel *pars
 			InputName: fmt.Sprintf("%s/%s", rel.Name, alias),
 		}
 		// set capacity of input pipe
-		if rel.Capacity != parser.UnspecifiedCapacity {
-			if rel.Capacity > math.MaxInt32 {
-				return fmt.Errorf("specified buffer capacity %d is too large", rel.Capacity)
-			} else if rel.Capacity < 0 {
-				// the parser should not allow this to happen, actually
-				return fmt.Errorf("specified buffer capacity %d must not be negative", rel.Capacity)
-			}
-			conf.Capacity = int(rel.Capacity)
+		capacity, err := windowCapacity(&rel.StreamWindowAST)
+		if err != nil {
+			return err
 		}
+		conf.Capacity = capacity
 		// set drop mode for box
 		if rel.Shedding == parser.DropOldest {
 			conf.DropMode = core.DropOldest
@@ -623,12 +1536,506 @@ func (tb *TopologyBuilder) setUpUDSFStream(subsequentBox core.BoxNode, rel *pars
 	return nil, temporaryName, nil
 }
 
-func (tb *TopologyBuilder) mkParamsMap(params []parser.SourceSinkParamAST) data.Map {
+// numUDSFInstances returns the number of UDSFs running in the topology.
+func (tb *TopologyBuilder) numUDSFInstances() int {
+	n := 0
+	for _, b := range tb.topology.Boxes() {
+		if _, ok := b.Box().(*udsfBox); ok {
+			n++
+		}
+	}
+	for _, s := range tb.topology.Sources() {
+		if _, ok := s.Source().(*udsfSource); ok {
+			n++
+		}
+	}
+	return n
+}
+
+// createUDSF creates a UDSF referred by the relation. It returns the UDSF and
+// the declarer having inputs of the UDSF.
+func (tb *TopologyBuilder) createUDSF(rel *parser.AliasedStreamWindowAST) (udf.UDSF, udf.UDSFDeclarer, error) {
+	// Compute the values of the UDSF parameters (if there was
+	// an unusable parameter, as in `udsf(7, col)` this will fail).
+	// Note: it doesn't feel exactly right to do this kind of
+	// validation here after parsing has been done "successfully",
+	// on the other hand the parser should not evaluate expressions
+	// (and cannot import the execution package) or make too many
+	// semantical checks, so we leave this here for the moment.
+	args, named, err := execution.EvaluateUDSFArgs(rel, tb.Reg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	udsfc, err := tb.UDSFCreators.Lookup(rel.Name, len(args)+len(named))
+	if err != nil {
+		return nil, nil, err
+	}
+	params, err := udf.ArrangeUDSFArgs(udsfc, args, named)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot call UDSF '%v': %v", rel.Name, err)
+	}
+
+	decl := udf.NewUDSFDeclarer()
+	udsf, err := func() (f udf.UDSF, err error) {
+		defer func() {
+			if e := recover(); e != nil {
+				if er, ok := e.(error); ok {
+					err = er
+				} else {
+					err = fmt.Errorf("cannot create a UDSF: %v", e)
+				}
+			}
+		}()
+		return udsfc.CreateUDSF(tb.topology.Context(), decl, params...)
+	}()
+	if err != nil {
+		return nil, nil, err
+	}
+	return udsf, decl, nil
+}
+
+// heartbeatParam removes "heartbeat" parameter from the given map and returns
+// its value as a duration. An integer or a float is regarded as seconds and a
+// string is parsed by time.ParseDuration. It returns 0 when the parameter
+// isn't given.
+func (tb *TopologyBuilder) heartbeatParam(params data.Map) (time.Duration, error) {
+	v, ok := params["heartbeat"]
+	if !ok {
+		return 0, nil
+	}
+	delete(params, "heartbeat")
+	d, err := data.ToDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid heartbeat interval: %v", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("heartbeat interval must be positive: %v", v)
+	}
+	return d, nil
+}
+
+// streamParams validates the options of a stream given in the WITH clause
+// of CREATE STREAM and returns the processing timeout, which is 0 when
+// "processing_timeout" isn't given. The timeout is a duration and a tuple
+// whose processing takes longer than it is dropped.
+func (tb *TopologyBuilder) streamParams(params data.Map) (time.Duration, error) {
+	var timeout time.Duration
+	if v, ok := params["processing_timeout"]; ok {
+		delete(params, "processing_timeout")
+		d, err := data.ToDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid processing_timeout: %v", err)
+		}
+		if d <= 0 {
+			return 0, fmt.Errorf("processing_timeout must be positive: %v", v)
+		}
+		timeout = d
+	}
+	for key := range params {
+		return 0, fmt.Errorf("unknown stream parameter: %s", key)
+	}
+	return timeout, nil
+}
+
+// maxTuplesParam removes "max_tuples" parameter from the given map and
+// returns its value. It returns 0, which means the number of tuples emitted
+// by the source isn't limited, when the parameter isn't given.
+func (tb *TopologyBuilder) maxTuplesParam(params data.Map) (int64, error) {
+	v, ok := params["max_tuples"]
+	if !ok {
+		return 0, nil
+	}
+	delete(params, "max_tuples")
+	n, err := data.AsInt(v)
+	if err != nil {
+		return 0, fmt.Errorf("max_tuples must be an integer: %v", err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("max_tuples must be positive: %v", n)
+	}
+	return n, nil
+}
+
+// correlationIDParam removes "correlation_id" parameter from the given map
+// and returns its value compiled as a path to the field having correlation IDs
+// of tuples. It returns nil when the parameter isn't given.
+func (tb *TopologyBuilder) correlationIDParam(params data.Map) (data.Path, error) {
+	v, ok := params["correlation_id"]
+	if !ok {
+		return nil, nil
+	}
+	delete(params, "correlation_id")
+	s, err := data.AsString(v)
+	if err != nil {
+		return nil, fmt.Errorf("correlation_id must be a string path: %v", err)
+	}
+	p, err := data.CompilePath(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid correlation_id path: %v", err)
+	}
+	return p, nil
+}
+
+// eventTimeParams returns the event-time policy of a source created with the
+// given WITH TIMESTAMP BY expression, which can be nil. "allowed_lateness" and
+// "late_sink" parameters are removed from the given map. The lateness is a
+// duration like "heartbeat" and late tuples are written to the sink given by
+// "late_sink" instead of being dropped. The expression is evaluated on Data
+// of each tuple and the timestamp assigned by the source is used when it
+// isn't given. It returns nil when neither the expression nor the parameters
+// are given.
+func (tb *TopologyBuilder) eventTimeParams(expr parser.Expression, params data.Map) (*core.EventTimePolicy, error) {
+	policy := &core.EventTimePolicy{}
+	enabled := expr != nil
+	if v, ok := params["allowed_lateness"]; ok {
+		delete(params, "allowed_lateness")
+		d, err := data.ToDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed_lateness: %v", err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("allowed_lateness must not be negative: %v", v)
+		}
+		policy.AllowedLateness = d
+		enabled = true
+	}
+	if v, ok := params["late_sink"]; ok {
+		delete(params, "late_sink")
+		s, err := data.AsString(v)
+		if err != nil {
+			return nil, fmt.Errorf("late_sink must be a string: %v", err)
+		}
+		policy.Late = core.LateSideOutput
+		policy.SideOutput = s
+		enabled = true
+	}
+	if !enabled {
+		return nil, nil
+	}
+	if expr == nil {
+		return policy, nil
+	}
+
+	// the expression is evaluated in the same way as EVAL ... ON
+	usedRelations := expr.ReferencedRelations()
+	if len(usedRelations) > 1 || (len(usedRelations) == 1 && !usedRelations[""]) {
+		return nil, fmt.Errorf("stream prefixes cannot be used in WITH TIMESTAMP BY")
+	}
+	flatExpr, err := execution.ParserExprToFlatExpr(expr.RenameReferencedRelation("", "input"), tb.Reg)
+	if err != nil {
+		return nil, err
+	}
+	eval, err := execution.ExpressionToEvaluator(flatExpr, tb.Reg)
+	if err != nil {
+		return nil, err
+	}
+	policy.Timestamp = func(t *core.Tuple) (time.Time, error) {
+		v, err := eval.Eval(data.Map{"input": t.Data})
+		if err != nil {
+			return time.Time{}, err
+		}
+		if v.Type() == data.TypeNull {
+			return time.Time{}, fmt.Errorf("the event time is null")
+		}
+		return data.ToTimestamp(v)
+	}
+	return policy, nil
+}
+
+// idColumnsParam removes "id_columns" parameter from the given map and
+// returns a core.TupleIDGenerator computing IDs of tuples from the columns
+// given as an array of paths. It returns nil when the parameter isn't given.
+func (tb *TopologyBuilder) idColumnsParam(params data.Map) (core.TupleIDGenerator, error) {
+	v, ok := params["id_columns"]
+	if !ok {
+		return nil, nil
+	}
+	delete(params, "id_columns")
+	a, err := data.AsArray(v)
+	if err != nil {
+		return nil, fmt.Errorf("id_columns must be an array of string paths: %v", err)
+	}
+	if len(a) == 0 {
+		return nil, fmt.Errorf("id_columns must have at least one column")
+	}
+	paths := make([]data.Path, len(a))
+	for i, c := range a {
+		s, err := data.AsString(c)
+		if err != nil {
+			return nil, fmt.Errorf("id_columns[%v] must be a string path: %v", i, err)
+		}
+		p, err := data.CompilePath(s)
+		if err != nil {
+			return nil, fmt.Errorf("id_columns[%v] is an invalid path: %v", i, err)
+		}
+		paths[i] = p
+	}
+	return core.NewColumnHashIDGenerator(paths...), nil
+}
+
+// schemaValidator returns a core.TupleValidator checking tuples against the
+// columns declared in a SCHEMA clause. It returns nil when the clause isn't
+// given.
+func schemaValidator(schema parser.SchemaAST) (core.TupleValidator, error) {
+	if len(schema.Columns) == 0 {
+		return nil, nil
+	}
+	columns := make([]core.SchemaColumn, len(schema.Columns))
+	names := map[string]bool{}
+	for i, c := range schema.Columns {
+		name := string(c.Name)
+		if names[name] {
+			return nil, fmt.Errorf("the column '%v' is declared more than once in the schema", name)
+		}
+		names[name] = true
+
+		var typ data.TypeID
+		switch c.Type {
+		case parser.Bool:
+			typ = data.TypeBool
+		case parser.Int:
+			typ = data.TypeInt
+		case parser.Float:
+			typ = data.TypeFloat
+		case parser.String:
+			typ = data.TypeString
+		case parser.Blob:
+			typ = data.TypeBlob
+		case parser.Timestamp:
+			typ = data.TypeTimestamp
+		case parser.Array:
+			typ = data.TypeArray
+		case parser.Map:
+			typ = data.TypeMap
+		default:
+			return nil, fmt.Errorf("the column '%v' has an unknown type: %v", name, c.Type)
+		}
+		columns[i] = core.SchemaColumn{
+			Name: name,
+			Type: typ,
+		}
+	}
+	return core.NewSchemaValidator(columns...), nil
+}
+
+// defaultSinkRetryInterval is the interval before the first retry of a write
+// to a sink when "retry_interval" parameter isn't given.
+const defaultSinkRetryInterval = 100 * time.Millisecond
+
+// retryParams removes "retry", "retry_interval", and "retry_max_interval"
+// parameters from the given map and returns a retry policy of a sink. "retry"
+// is the maximum number of retries and the others are durations. It returns
+// nil when "retry" isn't given.
+func (tb *TopologyBuilder) retryParams(params data.Map) (*core.SinkRetryPolicy, error) {
+	v, hasRetry := params["retry"]
+	iv, hasInterval := params["retry_interval"]
+	mv, hasMax := params["retry_max_interval"]
+	delete(params, "retry")
+	delete(params, "retry_interval")
+	delete(params, "retry_max_interval")
+	if !hasRetry {
+		if hasInterval || hasMax {
+			return nil, fmt.Errorf("retry_interval and retry_max_interval require retry parameter")
+		}
+		return nil, nil
+	}
+
+	n, err := data.AsInt(v)
+	if err != nil {
+		return nil, fmt.Errorf("retry must be an integer: %v", err)
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("retry must be positive: %v", n)
+	}
+	p := &core.SinkRetryPolicy{
+		MaxRetries: int(n),
+		Interval:   defaultSinkRetryInterval,
+	}
+	if hasInterval {
+		d, err := data.ToDuration(iv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry_interval: %v", err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("retry_interval must not be negative: %v", iv)
+		}
+		p.Interval = d
+	}
+	if hasMax {
+		d, err := data.ToDuration(mv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry_max_interval: %v", err)
+		}
+		if d < p.Interval {
+			return nil, fmt.Errorf("retry_max_interval must not be less than retry_interval: %v", mv)
+		}
+		p.MaxInterval = d
+	}
+	return p, nil
+}
+
+// deadLetterParam removes "dead_letter" parameter from the given map and
+// returns the name of the dead-letter sink. It returns an empty string when
+// the parameter isn't given.
+func (tb *TopologyBuilder) deadLetterParam(params data.Map) (string, error) {
+	v, ok := params["dead_letter"]
+	if !ok {
+		return "", nil
+	}
+	delete(params, "dead_letter")
+	s, err := data.AsString(v)
+	if err != nil {
+		return "", fmt.Errorf("dead_letter must be the name of a sink: %v", err)
+	}
+	if err := core.ValidateSymbol(s); err != nil {
+		return "", fmt.Errorf("invalid dead_letter: %v", err)
+	}
+	return s, nil
+}
+
+// batchParams removes "batch_size" and "batch_timeout" parameters from the
+// given map and returns a micro-batch policy of a sink. "batch_timeout" is a
+// duration and a batch is only written when it's full if it isn't given. It
+// returns nil when "batch_size" isn't given.
+func (tb *TopologyBuilder) batchParams(params data.Map) (*core.SinkBatchPolicy, error) {
+	v, hasSize := params["batch_size"]
+	tv, hasTimeout := params["batch_timeout"]
+	delete(params, "batch_size")
+	delete(params, "batch_timeout")
+	if !hasSize {
+		if hasTimeout {
+			return nil, fmt.Errorf("batch_timeout requires batch_size parameter")
+		}
+		return nil, nil
+	}
+
+	n, err := data.AsInt(v)
+	if err != nil {
+		return nil, fmt.Errorf("batch_size must be an integer: %v", err)
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("batch_size must be positive: %v", n)
+	}
+	p := &core.SinkBatchPolicy{
+		Size: int(n),
+	}
+	if hasTimeout {
+		d, err := data.ToDuration(tv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch_timeout: %v", err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("batch_timeout must not be negative: %v", tv)
+		}
+		p.Timeout = d
+	}
+	return p, nil
+}
+
+// backpressureParams removes "pause_threshold" and "resume_threshold"
+// parameters from the given map and returns their values. The pause threshold
+// is 0, which disables automatic pausing, when it isn't given. The resume
+// threshold is a half of the pause threshold by default.
+func (tb *TopologyBuilder) backpressureParams(params data.Map) (float64, float64, error) {
+	pv, hasPause := params["pause_threshold"]
+	rv, hasResume := params["resume_threshold"]
+	delete(params, "pause_threshold")
+	delete(params, "resume_threshold")
+	if !hasPause {
+		if hasResume {
+			return 0, 0, fmt.Errorf("resume_threshold requires pause_threshold")
+		}
+		return 0, 0, nil
+	}
+
+	pause, err := data.ToFloat(pv)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid pause_threshold: %v", err)
+	}
+	if pause <= 0 || pause > 1 {
+		return 0, 0, fmt.Errorf("pause_threshold must be in (0, 1]: %v", pv)
+	}
+	resume := pause / 2
+	if hasResume {
+		resume, err = data.ToFloat(rv)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid resume_threshold: %v", err)
+		}
+		if resume < 0 || resume >= pause {
+			return 0, 0, fmt.Errorf("resume_threshold must be in [0, pause_threshold): %v", rv)
+		}
+	}
+	return pause, resume, nil
+}
+
+// pausedWriteParams removes "paused_write_mode" and "paused_buffer_size"
+// parameters from the given map and returns their values. The mode is one of
+// "block" (default), "drop", and "buffer". The buffer size is required by and
+// only allowed for the "buffer" mode.
+func (tb *TopologyBuilder) pausedWriteParams(params data.Map) (core.PausedWriteMode, int, error) {
+	mv, hasMode := params["paused_write_mode"]
+	sv, hasSize := params["paused_buffer_size"]
+	delete(params, "paused_write_mode")
+	delete(params, "paused_buffer_size")
+
+	mode := core.PausedBlock
+	if hasMode {
+		s, err := data.AsString(mv)
+		if err != nil {
+			return 0, 0, fmt.Errorf("paused_write_mode must be a string: %v", err)
+		}
+		switch strings.ToLower(s) {
+		case "block":
+			mode = core.PausedBlock
+		case "drop":
+			mode = core.PausedDrop
+		case "buffer":
+			mode = core.PausedBuffer
+		default:
+			return 0, 0, fmt.Errorf("paused_write_mode must be block, drop, or buffer: %v", s)
+		}
+	}
+
+	if mode != core.PausedBuffer {
+		if hasSize {
+			return 0, 0, fmt.Errorf("paused_buffer_size requires paused_write_mode of buffer")
+		}
+		return mode, 0, nil
+	}
+	if !hasSize {
+		return 0, 0, fmt.Errorf("paused_write_mode of buffer requires paused_buffer_size")
+	}
+	size, err := data.ToInt(sv)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid paused_buffer_size: %v", err)
+	}
+	if size <= 0 || size > math.MaxInt32 {
+		return 0, 0, fmt.Errorf("paused_buffer_size must be in [1, %v]: %v", math.MaxInt32, sv)
+	}
+	return mode, int(size), nil
+}
+
+// mkParamsMap converts parameters in a WITH or SET clause into a map.
+// Parameters given by env('NAME') are resolved from the environment variables
+// of the process here so that the statement itself keeps the reference.
+func (tb *TopologyBuilder) mkParamsMap(params []parser.SourceSinkParamAST) (data.Map, error) {
 	paramsMap := make(data.Map, len(params))
 	for _, kv := range params {
-		paramsMap[string(kv.Key)] = kv.Value
+		if kv.Env == nil {
+			paramsMap[string(kv.Key)] = kv.Value
+			continue
+		}
+		if v, ok := os.LookupEnv(kv.Env.Name); ok {
+			paramsMap[string(kv.Key)] = data.String(v)
+		} else if kv.Env.Default != nil {
+			paramsMap[string(kv.Key)] = kv.Env.Default
+		} else {
+			return nil, fmt.Errorf("environment variable %v of parameter %v is not set",
+				kv.Env.Name, kv.Key)
+		}
 	}
-	return paramsMap
+	return paramsMap, nil
 }
 
 type chanSink struct {
@@ -679,7 +2086,7 @@ func (s *chanSink) Close(ctx *core.Context) error {
 // Sink node once it get unnecessary.
 func (tb *TopologyBuilder) AddSelectStmt(stmt *parser.SelectStmt) (core.SinkNode, <-chan *core.Tuple, error) {
 	// wrap this in a UNION statement
-	tmpStmt := parser.SelectUnionStmt{[]parser.SelectStmt{*stmt}}
+	tmpStmt := parser.SelectUnionStmt{Selects: []parser.SelectStmt{*stmt}}
 	return tb.AddSelectUnionStmt(&tmpStmt)
 }
 
@@ -696,8 +2103,19 @@ func (tb *TopologyBuilder) AddSelectUnionStmt(stmts *parser.SelectUnionStmt) (co
 		return nil, nil, err
 	}
 
-	names := make([]string, 0, len(stmts.Selects))
-	for _, stmt := range stmts.Selects {
+	// Each SELECT statement is executed in its own intermediate box unless
+	// results have to be ordered, in which case all of them are executed in
+	// one box.
+	branches := []parser.SelectUnionStmt{*stmts}
+	if stmts.Ordered != parser.Yes {
+		branches = make([]parser.SelectUnionStmt, len(stmts.Selects))
+		for i, stmt := range stmts.Selects {
+			branches[i] = parser.SelectUnionStmt{Selects: []parser.SelectStmt{stmt}}
+		}
+	}
+
+	names := make([]string, 0, len(branches))
+	for _, stmt := range branches {
 		// In an earlier version of the code, we used to process
 		// this as an InsertIntoSelectStmt and insert into the
 		// temporary node created above. InsertIntoSelectStmt
@@ -706,7 +2124,7 @@ func (tb *TopologyBuilder) AddSelectUnionStmt(stmts *parser.SelectUnionStmt) (co
 		// quite a bit of cleanup, we wrap this functionality
 		// into an inline function.
 
-		createTmpBox := func(outputName string, stmt parser.SelectStmt) (core.Node, error) {
+		createTmpBox := func(outputName string, stmt parser.SelectUnionStmt) (core.Node, error) {
 			// get the sink to add an input to
 			sink, err := tb.topology.Sink(outputName)
 			if err != nil {
@@ -717,18 +2135,30 @@ func (tb *TopologyBuilder) AddSelectUnionStmt(stmts *parser.SelectUnionStmt) (co
 			//   FROM c [RANGE ...] WHERE d
 			//  + a connection (random_string -> sink)
 			tmpName := fmt.Sprintf("sensorbee_tmp_%v", topologyBuilderNextTemporaryID())
-			tmpStmt := parser.CreateStreamAsSelectStmt{
-				parser.StreamIdentifier(tmpName),
-				parser.SelectStmt{
-					stmt.EmitterAST,
-					stmt.ProjectionsAST,
-					stmt.WindowedFromAST,
-					stmt.FilterAST,
-					stmt.GroupingAST,
-					stmt.HavingAST,
-				},
-			}
-			box, err := tb.AddStmt(tmpStmt)
+			var tmpStmt interface{}
+			if stmt.Ordered == parser.Yes {
+				tmpStmt = parser.CreateStreamAsSelectUnionStmt{
+					Name:            parser.StreamIdentifier(tmpName),
+					SelectUnionStmt: stmt,
+				}
+			} else {
+				sel := stmt.Selects[0]
+				tmpStmt = parser.CreateStreamAsSelectStmt{
+					Name: parser.StreamIdentifier(tmpName),
+					Select: parser.SelectStmt{
+						sel.WithAST,
+						sel.EmitterAST,
+						sel.ProjectionsAST,
+						sel.WindowedFromAST,
+						sel.FilterAST,
+						sel.GroupingAST,
+						sel.HavingAST,
+						sel.OrderByAST,
+						sel.LimitAST,
+					},
+				}
+			}
+			box, err := tb.addStmt(tmpStmt)
 			if err != nil {
 				return nil, err
 			}
@@ -793,10 +2223,16 @@ func (tb *TopologyBuilder) RunEvalStmt(stmt *parser.EvalStmt) (data.Value, error
 	if stmt.Input == nil {
 		// there is no ON clause, therefore our expression must
 		// be foldable
+		if err := execution.ValidateConstant("an expression of EVAL without ON", stmt.Expr); err != nil {
+			return nil, err
+		}
 		return execution.EvaluateFoldable(stmt.Expr, tb.Reg)
 	}
 	// if we arrive here, there was an ON clause given. first of all, we
 	// must evaluate that ON expression
+	if err := execution.ValidateConstant("the input of EVAL", *stmt.Input); err != nil {
+		return nil, err
+	}
 	inputData, err := execution.EvaluateFoldable(*stmt.Input, tb.Reg)
 	if err != nil {
 		return nil, err
@@ -812,6 +2248,288 @@ func (tb *TopologyBuilder) RunEvalStmt(stmt *parser.EvalStmt) (data.Value, error
 	return execution.EvaluateOnInput(expr, inputRow, tb.Reg)
 }
 
+// RunStatusStmt returns the status of the node specified by the given
+// StatusStmt. The status is the one returned from Status method of the node.
+func (tb *TopologyBuilder) RunStatusStmt(stmt *parser.StatusStmt) (data.Map, error) {
+	var (
+		n   core.Node
+		err error
+	)
+	name := string(stmt.Name)
+	switch stmt.Type {
+	case parser.SourceNodeType:
+		n, err = tb.topology.Source(name)
+	case parser.StreamNodeType:
+		n, err = tb.topology.Box(name)
+	case parser.SinkNodeType:
+		n, err = tb.topology.Sink(name)
+	default:
+		return nil, fmt.Errorf("unsupported node type: %v", stmt.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return n.Status(), nil
+}
+
+// RunShowStmt returns rows describing nodes or states of the type specified
+// by the given ShowStmt. Rows are sorted by names and each of them has "name"
+// and "type" fields. A row of a node also has following fields:
+//
+//	* state: the current state of the node
+//	* definition: the statement which created the node if any
+//	* num_queued: the total number of tuples buffered in the node's input queues
+//	* queue_size: the total size of the node's input queues
+//
+// A row of a state has "state_type" field instead. Temporary nodes internally
+// created by TopologyBuilder aren't included.
+func (tb *TopologyBuilder) RunShowStmt(stmt *parser.ShowStmt) ([]data.Map, error) {
+	nodes := map[string]core.Node{}
+	switch stmt.Type {
+	case parser.SourceNodeType:
+		for name, n := range tb.topology.Sources() {
+			nodes[name] = n
+		}
+	case parser.StreamNodeType:
+		for name, n := range tb.topology.Boxes() {
+			nodes[name] = n
+		}
+	case parser.SinkNodeType:
+		for name, n := range tb.topology.Sinks() {
+			nodes[name] = n
+		}
+	case parser.StateNodeType:
+		return tb.showStates()
+	default:
+		return nil, fmt.Errorf("unsupported node type: %v", stmt.Type)
+	}
+
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		if !isTemporaryNodeName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	rows := make([]data.Map, len(names))
+	for i, name := range names {
+		rows[i] = tb.nodeInfo(nodes[name])
+	}
+	return rows, nil
+}
+
+func (tb *TopologyBuilder) showStates() ([]data.Map, error) {
+	reg := tb.topology.Context().SharedStates
+	states, err := reg.List()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rows := make([]data.Map, 0, len(names))
+	for _, name := range names {
+		typeName, err := reg.Type(name)
+		if err != nil {
+			if core.IsNotExist(err) {
+				continue // removed concurrently
+			}
+			return nil, err
+		}
+		rows = append(rows, stateInfo(name, typeName))
+	}
+	return rows, nil
+}
+
+// RunDescribeStmt returns the detail of the node or the state specified by
+// the given DescribeStmt. The result of a node has the same fields as a row
+// returned from RunShowStmt and also has "status" field containing the whole
+// status of the node. The result of a state is same as a row returned from
+// RunShowStmt.
+func (tb *TopologyBuilder) RunDescribeStmt(stmt *parser.DescribeStmt) (data.Map, error) {
+	name := string(stmt.Name)
+	n, err := tb.topology.Node(name)
+	if err == nil {
+		info := tb.nodeInfo(n)
+		info["status"] = n.Status()
+		return info, nil
+	} else if !core.IsNotExist(err) {
+		return nil, err
+	}
+
+	typeName, err := tb.topology.Context().SharedStates.Type(name)
+	if err != nil {
+		if core.IsNotExist(err) {
+			return nil, core.NotExistError(fmt.Errorf("node or state '%v' was not found", name))
+		}
+		return nil, err
+	}
+	return stateInfo(name, typeName), nil
+}
+
+// RunShowUDFsStmt returns rows describing UDFs registered to the topology.
+// Rows are sorted by names and each of them has following fields:
+//
+//	* name: the name of the UDF
+//	* description: the description of the UDF
+//	* arguments: an array of maps having "name" and "type" of each parameter
+//	* return_type: the name of the type of the return value
+//
+// Fields other than "name" are empty when the UDF was registered without
+// metadata.
+func (tb *TopologyBuilder) RunShowUDFsStmt(stmt *parser.ShowUDFsStmt) ([]data.Map, error) {
+	d, ok := tb.Reg.(udf.FunctionDescriber)
+	if !ok {
+		return nil, errors.New("the function registry doesn't support metadata")
+	}
+	names := d.Functions()
+	rows := make([]data.Map, 0, len(names))
+	for _, name := range names {
+		m, err := d.Metadata(name)
+		if err != nil {
+			if core.IsNotExist(err) {
+				continue // removed concurrently
+			}
+			return nil, err
+		}
+		rows = append(rows, udfInfo(name, m))
+	}
+	return rows, nil
+}
+
+// RunDescribeFunctionStmt returns the metadata of the UDF specified by the
+// given DescribeFunctionStmt. The result is same as a row returned from
+// RunShowUDFsStmt.
+func (tb *TopologyBuilder) RunDescribeFunctionStmt(stmt *parser.DescribeFunctionStmt) (data.Map, error) {
+	d, ok := tb.Reg.(udf.FunctionDescriber)
+	if !ok {
+		return nil, errors.New("the function registry doesn't support metadata")
+	}
+	name := strings.ToLower(string(stmt.Name))
+	m, err := d.Metadata(name)
+	if err != nil {
+		return nil, err
+	}
+	return udfInfo(name, m), nil
+}
+
+// RunExplainStmt describes the execution plan of the SELECT statement given
+// in the ExplainStmt without running it. See execution.LogicalPlan.Explain
+// for the fields of the result. When the statement has a WITH clause, the
+// result also has "with" field containing the plans of the named SELECT
+// statements in the order of the clause.
+func (tb *TopologyBuilder) RunExplainStmt(stmt *parser.ExplainStmt) (data.Map, error) {
+	res, err := tb.explainSelect(stmt.Select)
+	if err != nil {
+		return nil, err
+	}
+	if len(stmt.Select.With) > 0 {
+		with := make(data.Array, len(stmt.Select.With))
+		for i, named := range stmt.Select.With {
+			plan, err := tb.explainSelect(named.Select)
+			if err != nil {
+				return nil, err
+			}
+			with[i] = data.Map{
+				"name": data.String(named.Name),
+				"plan": plan,
+			}
+		}
+		res["with"] = with
+	}
+	return res, nil
+}
+
+// explainSelect creates the execution plan of the statement in the same way
+// as a bqlBox does and describes it.
+func (tb *TopologyBuilder) explainSelect(stmt parser.SelectStmt) (data.Map, error) {
+	analyzedPlan, err := execution.Analyze(stmt, tb.Reg)
+	if err != nil {
+		return nil, err
+	}
+	optimizedPlan, err := analyzedPlan.LogicalOptimize()
+	if err != nil {
+		return nil, err
+	}
+	return optimizedPlan.Explain(tb.Reg)
+}
+
+var inputStatsPath = data.MustCompilePath("input_stats.inputs")
+
+// nodeInfo returns a row of RunShowStmt describing the node.
+func (tb *TopologyBuilder) nodeInfo(n core.Node) data.Map {
+	typeName := ""
+	switch n.Type() {
+	case core.NTSource:
+		typeName = "source"
+	case core.NTBox:
+		typeName = "stream"
+	case core.NTSink:
+		typeName = "sink"
+	}
+
+	st := n.Status()
+	var numQueued, queueSize int64
+	if v, err := st.Get(inputStatsPath); err == nil {
+		if inputs, err := data.AsMap(v); err == nil {
+			for _, in := range inputs {
+				m, err := data.AsMap(in)
+				if err != nil {
+					continue
+				}
+				if q, err := data.ToInt(m["num_queued"]); err == nil {
+					numQueued += q
+				}
+				if s, err := data.ToInt(m["queue_size"]); err == nil {
+					queueSize += s
+				}
+			}
+		}
+	}
+
+	state := st["state"]
+	if state == nil {
+		state = data.String(n.State().Get().String())
+	}
+	return data.Map{
+		"name":       data.String(n.Name()),
+		"type":       data.String(typeName),
+		"state":      state,
+		"definition": data.String(tb.definition(n.Name())),
+		"num_queued": data.Int(numQueued),
+		"queue_size": data.Int(queueSize),
+	}
+}
+
+// stateInfo returns a row of RunShowStmt describing the state.
+func stateInfo(name, typeName string) data.Map {
+	return data.Map{
+		"name":       data.String(name),
+		"type":       data.String("state"),
+		"state_type": data.String(typeName),
+	}
+}
+
+// udfInfo returns a row of RunShowUDFsStmt describing the UDF.
+func udfInfo(name string, m *udf.FunctionMetadata) data.Map {
+	args := make(data.Array, len(m.Arguments))
+	for i, a := range m.Arguments {
+		args[i] = data.Map{
+			"name": data.String(a.Name),
+			"type": data.String(a.Type),
+		}
+	}
+	return data.Map{
+		"name":        data.String(name),
+		"description": data.String(m.Description),
+		"arguments":   args,
+		"return_type": data.String(m.ReturnType),
+	}
+}
+
 func (tb *TopologyBuilder) saveState(name, tag string) error {
 	st, err := tb.topology.Context().SharedStates.Get(name)
 	if err != nil {
@@ -845,6 +2563,39 @@ func (tb *TopologyBuilder) saveState(name, tag string) error {
 	return w.Commit()
 }
 
+// replaceState registers a state created by CREATE OR REPLACE STATE. The
+// previous state is terminated if it exists.
+func (tb *TopologyBuilder) replaceState(name, typeName string, s core.SharedState) error {
+	ctx := tb.topology.Context()
+	reg := ctx.SharedStates
+	t, err := reg.Type(name)
+	if err != nil && !core.IsNotExist(err) {
+		return err
+	}
+	if err != nil || t != typeName {
+		// Replace cannot change the type of the state
+		if err == nil {
+			if _, err := reg.Remove(name); err != nil && !core.IsNotExist(err) {
+				ctx.ErrLog(err).WithField("state_name", name).
+					Error("Cannot terminate the previous instance of the replaced state")
+			}
+		}
+		return reg.Add(name, typeName, s)
+	}
+
+	prev, err := reg.Replace(name, typeName, s)
+	if err != nil {
+		return err
+	}
+	if prev != nil {
+		if err := prev.Terminate(ctx); err != nil {
+			ctx.ErrLog(err).WithField("state_name", name).
+				Error("Cannot terminate the previous instance of the replaced state")
+		}
+	}
+	return nil
+}
+
 // loadState loads a state from the storage. It returns true when the state was
 // not saved and LOAD STATE OR CREATE IF NOT SAVED should fall back to CREATE STATE.
 func (tb *TopologyBuilder) loadState(typeName, name, tag string, params data.Map) (bool, error) {
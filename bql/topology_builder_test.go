@@ -1,10 +1,17 @@
 package bql
 
 import (
+	"errors"
+	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -69,272 +76,163 @@ func TestCreateSourceStmt(t *testing.T) {
 			})
 		})
 
-		Convey("When running CREATE SOURCE with an unknown source type", func() {
-			err := addBQLToTopology(tb, `CREATE SOURCE hoge TYPE foo`)
-
-			Convey("Then an error should be returned", func() {
-				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldContainSubstring, "not registered")
-			})
-		})
-	})
-}
-
-func TestCreateStreamAsSelectStmt(t *testing.T) {
-	Convey("Given a BQL TopologyBuilder with source and stream", t, func() {
-		dt := newTestTopology()
-		Reset(func() {
-			dt.Stop()
-		})
-		tb, err := NewTopologyBuilder(dt)
-		So(err, ShouldBeNil)
-		err = addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy`)
-		So(err, ShouldBeNil)
-
-		Convey("When running CREATE STREAM AS SELECT on an existing stream", func() {
-			err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
-                s [RANGE 2 SECONDS, BUFFER SIZE 2, WAIT IF FULL] WHERE int=2`)
+		Convey("When running CREATE SOURCE with a heartbeat", func() {
+			err := addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy WITH heartbeat="100ms"`)
 
 			Convey("Then there should be no error", func() {
 				So(err, ShouldBeNil)
 			})
+		})
 
-			Convey("And when joining source and stream", func() {
-				err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM s:int FROM
-                s [RANGE 2 SECONDS], t [RANGE 3 TUPLES]`)
-
-				Convey("Then there should be no error", func() {
-					So(err, ShouldBeNil)
-				})
-			})
-
-			Convey("And when self-joining the stream", func() {
-				err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM s:int FROM
-                t [RANGE 2 SECONDS] AS s, t [RANGE 3 TUPLES]`)
-
-				Convey("Then there should be no error", func() {
-					So(err, ShouldBeNil)
-				})
-			})
-
-			Convey("And when running another CREATE STREAM AS SELECT with the same name", func() {
-				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
-                s [RANGE 1 TUPLES] WHERE int=1`)
-
-				Convey("Then an error should be returned the second time", func() {
-					So(err, ShouldNotBeNil)
-					So(err.Error(), ShouldContainSubstring, "already")
-				})
-			})
-
-			Convey("And when running another CREATE STREAM AS SELECT with a different name", func() {
-				err := addBQLToTopology(tb, `CREATE STREAM u AS SELECT ISTREAM int FROM
-                s [RANGE 1 TUPLES] WHERE int=1`)
+		Convey("When running CREATE SOURCE with an invalid heartbeat", func() {
+			err := addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy WITH heartbeat="foo"`)
 
-				Convey("Then there should be no error", func() {
-					So(err, ShouldBeNil)
-				})
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "heartbeat")
 			})
 		})
 
-		Convey("When running CREATE STREAM AS SELECT with a tool arge buffer size", func() {
-			err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
-                s [RANGE 2 SECONDS, BUFFER SIZE 131072] WHERE int=2`)
+		Convey("When running CREATE SOURCE with a negative heartbeat", func() {
+			err := addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy WITH heartbeat=-1`)
 
-			Convey("Then there should be no error", func() {
+			Convey("Then an error should be returned", func() {
 				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldEqual, "specified buffer capacity 131072 is too large "+
-					"(must be <= 131071)")
+				So(err.Error(), ShouldContainSubstring, "heartbeat")
 			})
 		})
 
-		Convey("When running CREATE STREAM AS SELECT with a UDSF", func() {
-			Convey("If all parameters are foldable", func() {
-				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
-                duplicate("s", 2) [RANGE 2 SECONDS] WHERE int=2`)
-
-				Convey("Then there should be no error", func() {
-					So(err, ShouldBeNil)
-				})
-
-				Convey("And when joining source and UDSF", func() {
-					err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM s:int FROM
-                s [RANGE 2 SECONDS], duplicate("s", 2) [RANGE 3 TUPLES]`)
-
-					Convey("Then there should be no error", func() {
-						So(err, ShouldBeNil)
-					})
-				})
-
-				Convey("And when self-joining the UDSF", func() {
-					err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM s:int FROM
-                    duplicate("s", 2) [RANGE 2 SECONDS] AS s, duplicate("s", 4) [RANGE 3 TUPLES] AS t`)
+		Convey("When running CREATE SOURCE with backpressure thresholds", func() {
+			err := addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy WITH pause_threshold=0.8, resume_threshold=0.2`)
 
-					Convey("Then there should be no error", func() {
-						So(err, ShouldBeNil)
-					})
-				})
+			Convey("Then there should be no error", func() {
+				So(err, ShouldBeNil)
 			})
 
-			Convey("If the UDSF doesn't depend on an input", func() {
-				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
-                test_sequence(4) [RANGE 2 SECONDS] WHERE int=2`)
-
-				Convey("Then there should be no error", func() {
-					So(err, ShouldBeNil)
-				})
-
-				Convey("And when joining source and UDSF", func() {
-					err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM s:int FROM
-                    s [RANGE 2 SECONDS], test_sequence(4) [RANGE 3 TUPLES]`)
-
-					Convey("Then there should be no error", func() {
-						So(err, ShouldBeNil)
-					})
+			Convey("Then the source should have the thresholds", func() {
+				sn, err := tb.topology.Source("hoge")
+				So(err, ShouldBeNil)
+				bp, err := sn.Status().Get(data.MustCompilePath("backpressure"))
+				So(err, ShouldBeNil)
+				So(bp, ShouldResemble, data.Map{
+					"pause_threshold":  data.Float(0.8),
+					"resume_threshold": data.Float(0.2),
+					"auto_paused":      data.False,
+					"num_auto_pauses":  data.Int(0),
 				})
 			})
+		})
 
-			Convey("If not all parameters are foldable", func() {
-				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
-                duplicate("s", int) [RANGE 2 SECONDS] WHERE int=2`)
+		Convey("When running CREATE SOURCE with invalid backpressure thresholds", func() {
+			for _, params := range []string{
+				`pause_threshold=0`, `pause_threshold=1.5`, `pause_threshold="foo"`,
+				`resume_threshold=0.2`, `pause_threshold=0.5, resume_threshold=0.5`,
+				`pause_threshold=0.5, resume_threshold=-0.1`,
+			} {
+				err := addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy WITH `+params)
 
-				Convey("Then there should be an error", func() {
+				Convey("Then an error should be returned with "+params, func() {
 					So(err, ShouldNotBeNil)
-					So(err.Error(), ShouldContainSubstring, "not foldable")
+					So(err.Error(), ShouldContainSubstring, "threshold")
 				})
-			})
+			}
+		})
 
-			Convey("If the UDSF is called with the wrong number of arguments", func() {
-				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
-                duplicate("s", 1, 2) [RANGE 2 SECONDS] WHERE int=2`)
+		Convey("When running CREATE SOURCE with a paused write mode", func() {
+			err := addBQLToTopology(tb, `CREATE PAUSED SOURCE hoge TYPE dummy WITH paused_write_mode="buffer", paused_buffer_size=10`)
 
-				Convey("Then there should be an error", func() {
-					So(err, ShouldNotBeNil)
-					So(err.Error(), ShouldContainSubstring, "arity")
-				})
+			Convey("Then there should be no error", func() {
+				So(err, ShouldBeNil)
 			})
 
-			Convey("If creating the UDSF fails", func() {
-				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
-                failing_duplicate("s", 2) [RANGE 2 SECONDS] WHERE int=2`)
-
-				Convey("Then there should be an error", func() {
-					So(err, ShouldNotBeNil)
-					So(err.Error(), ShouldContainSubstring, "test UDSF creation failed")
-				})
+			Convey("Then the source should have the mode", func() {
+				sn, err := tb.topology.Source("hoge")
+				So(err, ShouldBeNil)
+				m, err := sn.Status().Get(data.MustCompilePath("behaviors.paused_write_mode"))
+				So(err, ShouldBeNil)
+				So(m, ShouldEqual, data.String("buffer"))
 			})
+		})
 
-			Convey("If the UDSF isn't registered", func() {
-				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
-                serial(1, 5) [RANGE 2 SECONDS] WHERE int=2`)
+		Convey("When running CREATE SOURCE with invalid paused write parameters", func() {
+			for _, params := range []string{
+				`paused_write_mode=1`, `paused_write_mode="foo"`,
+				`paused_write_mode="buffer"`, `paused_buffer_size=10`,
+				`paused_write_mode="drop", paused_buffer_size=10`,
+				`paused_write_mode="buffer", paused_buffer_size=0`,
+			} {
+				err := addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy WITH `+params)
 
-				Convey("Then there should be an error", func() {
+				Convey("Then an error should be returned with "+params, func() {
 					So(err, ShouldNotBeNil)
-					So(err.Error(), ShouldContainSubstring, "not registered")
+					So(err.Error(), ShouldContainSubstring, "paused_")
 				})
-			})
+			}
 		})
 
-		Convey("When running CREATE STREAM AS SELECT on a non-existing stream", func() {
-			err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
-                bar [RANGE 2 SECONDS] WHERE int=2`)
+		Convey("When running CREATE SOURCE with invalid max_tuples", func() {
+			for _, params := range []string{
+				`max_tuples=0`, `max_tuples=-1`, `max_tuples="foo"`,
+			} {
+				err := addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy WITH `+params)
 
-			Convey("Then an error should be returned", func() {
-				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldContainSubstring, "was not found")
-			})
+				Convey("Then an error should be returned with "+params, func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "max_tuples")
+				})
+			}
 		})
 
-		Convey("When running CREATE STREAM AS SELECT with input and output name the same", func() {
-			err := addBQLToTopology(tb, `CREATE STREAM s AS SELECT ISTREAM int FROM
-                s [RANGE 2 SECONDS] WHERE int=2`)
+		Convey("When running CREATE SOURCE with an unknown source type", func() {
+			err := addBQLToTopology(tb, `CREATE SOURCE hoge TYPE foo`)
 
 			Convey("Then an error should be returned", func() {
 				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldContainSubstring, "already")
+				So(err.Error(), ShouldContainSubstring, "not registered")
 			})
 		})
 	})
 }
 
-func TestCreateStreamAsSelectUnionStmt(t *testing.T) {
-	Convey("Given a BQL TopologyBuilder with source and stream", t, func() {
+func TestSourceMaxTuples(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder", t, func() {
 		dt := newTestTopology()
 		Reset(func() {
 			dt.Stop()
 		})
 		tb, err := NewTopologyBuilder(dt)
 		So(err, ShouldBeNil)
-		err = addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy`)
-		So(err, ShouldBeNil)
-
-		Convey("When running CREATE STREAM AS SELECT on an existing stream", func() {
-			err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 2 SECONDS]
-				UNION ALL SELECT ISTREAM int+1 FROM s [RANGE 2 SECONDS]`)
-
-			Convey("Then there should be no error", func() {
-				So(err, ShouldBeNil)
-			})
-
-			Convey("And when unioning source and stream", func() {
-				err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM int FROM s [RANGE 2 SECONDS]
-				UNION ALL SELECT DSTREAM int+1 FROM t [RANGE 2 SECONDS]`)
-
-				Convey("Then there should be no error", func() {
-					So(err, ShouldBeNil)
-				})
-
-				Convey("And when unioning with yet another stream", func() {
-					err := addBQLToTopology(tb, `CREATE STREAM u AS SELECT ISTREAM int FROM s [RANGE 2 SECONDS]
-						UNION ALL SELECT DSTREAM int+1 FROM t [RANGE 2 SECONDS]
-						UNION ALL SELECT DSTREAM int+2 FROM x [RANGE 2 SECONDS]`)
-
-					Convey("Then there should be no error", func() {
-						So(err, ShouldBeNil)
-					})
-				})
-			})
-
-			Convey("And when running another CREATE STREAM AS SELECT with the same name", func() {
-				prevNodes := len(tb.topology.Nodes())
-				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 2 SECONDS]
-				UNION ALL SELECT DSTREAM int+1 FROM t [RANGE 2 SECONDS]`)
-
-				Convey("Then an error should be returned the second time", func() {
-					So(err, ShouldNotBeNil)
-					So(err.Error(), ShouldContainSubstring, "already")
-					So(len(tb.topology.Nodes()), ShouldEqual, prevNodes)
-				})
-			})
-		})
-
-		Convey("When running CREATE STREAM AS SELECT on a non-existing stream (1)", func() {
-			prevNodes := len(tb.topology.Nodes())
-			err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM int FROM bar [RANGE 2 SECONDS]
-				UNION ALL SELECT DSTREAM int+1 FROM t [RANGE 2 SECONDS]`)
 
-			Convey("Then an error should be returned", func() {
-				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldContainSubstring, "was not found")
-				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes)
+		Convey("When a source emitting 10 tuples has max_tuples=4", func() {
+			So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy WITH num=10, max_tuples=4;
+				CREATE SINK snk TYPE collector;
+				INSERT INTO snk FROM s;
+				RESUME SOURCE s;`), ShouldBeNil)
+			sn, err := dt.Source("s")
+			So(err, ShouldBeNil)
+			sin, err := dt.Sink("snk")
+			So(err, ShouldBeNil)
+			si := sin.Sink().(*tupleCollectorSink)
+			sn.State().Wait(core.TSStopped)
+
+			Convey("Then the sink should receive exactly 4 tuples", func() {
+				si.Wait(4)
+				So(si.len(), ShouldEqual, 4)
+				for i := 0; i < 4; i++ {
+					So(si.get(i).Data["int"], ShouldEqual, data.Int(i+1))
+				}
 			})
-		})
-
-		Convey("When running CREATE STREAM AS SELECT on a non-existing stream (2)", func() {
-			prevNodes := len(tb.topology.Nodes())
-			err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM int FROM s [RANGE 2 SECONDS]
-				UNION ALL SELECT DSTREAM int+1 FROM bar [RANGE 2 SECONDS]`)
 
-			Convey("Then an error should be returned", func() {
-				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldContainSubstring, "was not found")
-				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes)
+			Convey("Then the source should be stopped cleanly", func() {
+				st := sn.Status()
+				So(st["state"], ShouldEqual, data.String("stopped"))
+				So(st, ShouldNotContainKey, "error")
 			})
 		})
 	})
 }
 
-func TestCreateSinkStmt(t *testing.T) {
+func TestSourceEventTime(t *testing.T) {
 	Convey("Given a BQL TopologyBuilder", t, func() {
 		dt := newTestTopology()
 		Reset(func() {
@@ -343,589 +241,2581 @@ func TestCreateSinkStmt(t *testing.T) {
 		tb, err := NewTopologyBuilder(dt)
 		So(err, ShouldBeNil)
 
-		Convey("When running CREATE SINK with a collector source", func() {
-			err := addBQLToTopology(tb, `CREATE SINK hoge TYPE collector`)
+		// event times of the tuples are 10, 20, 30, 5, 15, and 25 seconds
+		// and the 4th and 5th tuples are late
+		Convey("When a source has WITH TIMESTAMP BY and late_sink", func() {
+			So(addBQLToTopology(tb, `CREATE SINK snk TYPE collector;
+				CREATE SINK late TYPE collector;
+				CREATE PAUSED SOURCE s TYPE dummy WITH num=6, allowed_lateness=5, late_sink="late"
+					WITH TIMESTAMP BY int * 10 % 35;
+				INSERT INTO snk FROM s;
+				RESUME SOURCE s;`), ShouldBeNil)
+			sn, err := dt.Source("s")
+			So(err, ShouldBeNil)
+			sin, err := dt.Sink("snk")
+			So(err, ShouldBeNil)
+			si := sin.Sink().(*tupleCollectorSink)
+			lsin, err := dt.Sink("late")
+			So(err, ShouldBeNil)
+			lsi := lsin.Sink().(*tupleCollectorSink)
+
+			Convey("Then the sink should receive tuples within the allowed lateness", func() {
+				si.Wait(4)
+				So(si.len(), ShouldEqual, 4)
+				for i, n := range []int{1, 2, 3, 6} {
+					t := si.get(i)
+					So(t.Data["int"], ShouldEqual, data.Int(n))
+					So(t.Timestamp.Equal(time.Unix(int64(n*10%35), 0)), ShouldBeTrue)
+				}
+			})
 
-			Convey("Then there should be no error", func() {
+			Convey("Then the late sink should receive the late tuples", func() {
+				lsi.Wait(2)
+				So(lsi.len(), ShouldEqual, 2)
+				So(lsi.get(0).Data["int"], ShouldEqual, data.Int(4))
+				So(lsi.get(1).Data["int"], ShouldEqual, data.Int(5))
+			})
+
+			Convey("Then the source status should have the event time", func() {
+				si.Wait(4)
+				lsi.Wait(2)
+				v, err := sn.Status().Get(data.MustCompilePath("event_time.num_late"))
 				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(2))
 			})
+		})
 
-			Convey("And when running another CREATE SINK using the same name", func() {
-				err := addBQLToTopology(tb, `CREATE SINK hoge TYPE collector`)
+		Convey("When running CREATE SOURCE with invalid event time parameters", func() {
+			for _, params := range []string{
+				`allowed_lateness="foo"`, `allowed_lateness=-1`, `late_sink=1`,
+			} {
+				err := addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy WITH `+params)
 
-				Convey("Then an error should be returned", func() {
+				Convey("Then an error should be returned with "+params, func() {
 					So(err, ShouldNotBeNil)
-					So(err.Error(), ShouldContainSubstring, "already")
+					So(err.Error(), ShouldContainSubstring, params[:strings.Index(params, "=")])
 				})
-			})
+			}
 		})
-		Convey("When running CREATE SINK with invalid parameters", func() {
-			err := addBQLToTopology(tb, `CREATE SINK hoge TYPE collector WITH foo="bar"`)
+
+		Convey("When running CREATE SOURCE with a nonexistent late_sink", func() {
+			err := addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy WITH late_sink="foo"`)
 
 			Convey("Then an error should be returned", func() {
 				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldEqual, "unknown sink parameter: foo")
 			})
 		})
-		Convey("When running CREATE SINK with an unknown sink type", func() {
-			err := addBQLToTopology(tb, `CREATE SINK hoge TYPE foo`)
+
+		Convey("When running CREATE SOURCE with a stream prefix in WITH TIMESTAMP BY", func() {
+			err := addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy WITH TIMESTAMP BY s:int`)
 
 			Convey("Then an error should be returned", func() {
 				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldContainSubstring, "not registered")
+				So(err.Error(), ShouldContainSubstring, "prefix")
 			})
 		})
 	})
 }
 
-func TestInsertIntoFromStmt(t *testing.T) {
-	Convey("Given a BQL TopologyBuilder with source, stream, and sink", t, func() {
+func TestDroppedTuplesStream(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with a stream failing on some tuples", t, func() {
 		dt := newTestTopology()
 		Reset(func() {
 			dt.Stop()
 		})
 		tb, err := NewTopologyBuilder(dt)
 		So(err, ShouldBeNil)
-		err = addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy`)
-		So(err, ShouldBeNil)
-		err = addBQLToTopology(tb, `CREATE STREAM t AS SELECT RSTREAM * FROM s [RANGE 1 TUPLES]`)
-		So(err, ShouldBeNil)
-		err = addBQLToTopology(tb, `CREATE SINK foo TYPE collector`)
-		So(err, ShouldBeNil)
-
-		Convey("When running INSERT INTO on an existing source and sink", func() {
-			err := addBQLToTopology(tb, `INSERT INTO foo FROM s`)
-
-			Convey("Then there should be no error", func() {
-				So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy WITH num=4;
+			CREATE STREAM box AS SELECT RSTREAM int / (int - 2) AS x FROM s [RANGE 1 TUPLES];`), ShouldBeNil)
+
+		Convey("When creating a stream from tuples dropped by the stream", func() {
+			So(addBQLToTopology(tb, `CREATE STREAM errs AS SELECT RSTREAM d:node_name, d:data.int AS int
+					FROM box DROPPED TUPLES [RANGE 1 TUPLES] AS d;
+				CREATE SINK snk TYPE collector;
+				INSERT INTO snk FROM errs;
+				RESUME SOURCE s;`), ShouldBeNil)
+			sin, err := dt.Sink("snk")
+			So(err, ShouldBeNil)
+			si := sin.Sink().(*tupleCollectorSink)
+
+			Convey("Then the sink should receive the dropped tuple", func() {
+				si.Wait(1)
+				So(si.len(), ShouldEqual, 1)
+				So(si.get(0).Data, ShouldResemble, data.Map{
+					"node_name": data.String("box"),
+					"int":       data.Int(2),
+				})
 			})
 
-			Convey("And when running another INSERT INTO", func() {
-				err := addBQLToTopology(tb, `INSERT INTO foo FROM t`)
-
-				Convey("Then there should be no error", func() {
-					So(err, ShouldBeNil)
-				})
+			Convey("Then the temporary source should be removed with the stream", func() {
+				si.Wait(1)
+				So(addBQLToTopology(tb, `DROP STREAM errs;`), ShouldBeNil)
+				So(func() bool {
+					for i := 0; i < 100; i++ {
+						found := false
+						for name := range dt.Sources() {
+							if strings.HasPrefix(name, "sensorbee_tmp_dropped_") {
+								found = true
+							}
+						}
+						if !found {
+							return true
+						}
+						time.Sleep(10 * time.Millisecond)
+					}
+					return false
+				}(), ShouldBeTrue)
 			})
 		})
 
-		Convey("When running INSERT INTO on a non-existing stream", func() {
-			err := addBQLToTopology(tb, `INSERT INTO foo FROM foo`)
+		Convey("When creating a stream from tuples dropped by a nonexistent node", func() {
+			err := addBQLToTopology(tb, `CREATE STREAM errs AS SELECT RSTREAM *
+				FROM foo DROPPED TUPLES [RANGE 1 TUPLES];`)
 
-			Convey("Then an error should be returned", func() {
+			Convey("Then it should fail", func() {
 				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldContainSubstring, "was not found")
 			})
 		})
+	})
+}
 
-		Convey("When running INSERT INTO on a non-existing sink", func() {
-			err := addBQLToTopology(tb, `INSERT INTO bar FROM s`)
+func TestMatchRecognizeStream(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with a source", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy WITH num=4;`), ShouldBeNil)
+
+		Convey("When creating a stream of matches of a pattern in the source", func() {
+			So(addBQLToTopology(tb, `CREATE STREAM pairs AS SELECT RSTREAM m:first, m:second
+					FROM s MATCH_RECOGNIZE (MEASURES a:int AS first, b:int AS second
+						PATTERN (a b) DEFINE b AS int = prev:int + 1) [RANGE 1 TUPLES] AS m;
+				CREATE SINK snk TYPE collector;
+				INSERT INTO snk FROM pairs;
+				RESUME SOURCE s;`), ShouldBeNil)
+			sin, err := dt.Sink("snk")
+			So(err, ShouldBeNil)
+			si := sin.Sink().(*tupleCollectorSink)
+
+			Convey("Then the sink should receive the matches", func() {
+				si.Wait(2)
+				So(si.len(), ShouldEqual, 2)
+				So(si.get(0).Data, ShouldResemble, data.Map{"first": data.Int(1), "second": data.Int(2)})
+				So(si.get(1).Data, ShouldResemble, data.Map{"first": data.Int(3), "second": data.Int(4)})
+			})
+
+			Convey("Then the temporary box should be removed with the stream", func() {
+				si.Wait(2)
+				So(addBQLToTopology(tb, `DROP STREAM pairs;`), ShouldBeNil)
+				So(func() bool {
+					for i := 0; i < 100; i++ {
+						found := false
+						for name := range dt.Boxes() {
+							if strings.HasPrefix(name, "sensorbee_tmp_match_") {
+								found = true
+							}
+						}
+						if !found {
+							return true
+						}
+						time.Sleep(10 * time.Millisecond)
+					}
+					return false
+				}(), ShouldBeTrue)
+			})
+		})
+
+		Convey("When creating a stream with an invalid MATCH_RECOGNIZE clause", func() {
+			err := addBQLToTopology(tb, `CREATE STREAM pairs AS SELECT RSTREAM *
+				FROM s MATCH_RECOGNIZE (MEASURES int AS first PATTERN (a)) [RANGE 1 TUPLES];`)
 
-			Convey("Then an error should be returned", func() {
+			Convey("Then it should fail", func() {
 				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldContainSubstring, "was not found")
 			})
 		})
 	})
 }
 
-func TestMultipleStatements(t *testing.T) {
-	Convey("Given an empty BQL TopologyBuilder", t, func() {
+// flakySink fails to write each tuple with a temporary error the given
+// number of times. It always fails when failures is negative.
+type flakySink struct {
+	m          sync.Mutex
+	c          *sync.Cond
+	failures   int
+	attempts   map[*core.Tuple]int
+	numWritten int
+}
+
+func (s *flakySink) Write(ctx *core.Context, t *core.Tuple) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.attempts[t]++
+	if s.failures < 0 || s.attempts[t] <= s.failures {
+		return core.TemporaryError(errors.New("flaky sink failed"))
+	}
+	s.numWritten++
+	s.c.Broadcast()
+	return nil
+}
+
+// wait waits until the sink writes n tuples.
+func (s *flakySink) wait(n int) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for s.numWritten < n {
+		s.c.Wait()
+	}
+}
+
+func (s *flakySink) Close(ctx *core.Context) error {
+	return nil
+}
+
+func createFlakySink(ctx *core.Context, ioParams *IOParams, params data.Map) (core.Sink, error) {
+	n, err := data.AsInt(params["failures"])
+	if err != nil {
+		return nil, err
+	}
+	s := &flakySink{
+		failures: int(n),
+		attempts: map[*core.Tuple]int{},
+	}
+	s.c = sync.NewCond(&s.m)
+	return s, nil
+}
+
+func TestSinkRetryAndDeadLetter(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with a dead-letter sink", t, func() {
 		dt := newTestTopology()
 		Reset(func() {
 			dt.Stop()
 		})
 		tb, err := NewTopologyBuilder(dt)
 		So(err, ShouldBeNil)
+		So(tb.SinkCreators.Register("flaky", SinkCreatorFunc(createFlakySink)), ShouldBeNil)
+		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy WITH num=4;
+			CREATE SINK dlq TYPE collector;`), ShouldBeNil)
+		sin, err := dt.Sink("dlq")
+		So(err, ShouldBeNil)
+		dlq := sin.Sink().(*tupleCollectorSink)
+
+		Convey("When the sink fails temporarily less times than retries", func() {
+			So(addBQLToTopology(tb, `CREATE SINK snk TYPE flaky WITH failures=2,
+					retry=2, retry_interval="1ms", retry_max_interval=0.002, dead_letter="dlq";
+				INSERT INTO snk FROM s;
+				RESUME SOURCE s;`), ShouldBeNil)
+			sin, err := dt.Sink("snk")
+			So(err, ShouldBeNil)
+			si := sin.Sink().(*flakySink)
+			si.wait(4)
 
-		Convey("When issuing multiple commands in a good order", func() {
-			stmts := `
-			CREATE PAUSED SOURCE source TYPE dummy WITH num=4;
-			CREATE STREAM box AS SELECT
-			  ISTREAM int, str((int+1) % 3) AS x FROM source
-			  [RANGE 2 SECONDS] WHERE int % 2 = 0;
-			CREATE SINK snk TYPE collector;
-			INSERT INTO snk FROM box;
-			RESUME SOURCE source;
-			`
-			err := addBQLToTopology(tb, stmts)
-
-			Convey("Then setup should succeed", func() {
+			Convey("Then all tuples should be delivered via retries", func() {
+				So(dlq.len(), ShouldEqual, 0)
+				v, err := sin.Status().Get(data.MustCompilePath("retry.num_retries"))
 				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(8))
 			})
 		})
 
-		Convey("When issuing multiple commands in a bad order", func() {
-			stmts := `
-			CREATE PAUSED SOURCE source TYPE dummy WITH num=4;
-			CREATE STREAM box AS SELECT
-			  ISTREAM int, str((int+1) % 3) AS x FROM source
-			  [RANGE 2 SECONDS] WHERE int % 2 = 0;
-			INSERT INTO snk FROM box;
-			CREATE SINK snk TYPE collector;
-			RESUME SOURCE source;
-			`
-			err := addBQLToTopology(tb, stmts)
+		Convey("When the sink always fails", func() {
+			So(addBQLToTopology(tb, `CREATE SINK snk TYPE flaky WITH failures=-1,
+					retry=2, retry_interval="1ms", dead_letter="dlq";
+				INSERT INTO snk FROM s;
+				RESUME SOURCE s;`), ShouldBeNil)
+			sin, err := dt.Sink("snk")
+			So(err, ShouldBeNil)
+			si := sin.Sink().(*flakySink)
 
-			Convey("Then setup should fail", func() {
-				So(err, ShouldNotBeNil)
+			Convey("Then all tuples should end up in the dead-letter sink after retries", func() {
+				dlq.Wait(4)
+				So(dlq.len(), ShouldEqual, 4)
+				for i := 0; i < 4; i++ {
+					So(dlq.get(i).Data["int"], ShouldEqual, data.Int(i+1))
+				}
+				si.m.Lock()
+				defer si.m.Unlock()
+				for _, n := range si.attempts {
+					So(n, ShouldEqual, 3)
+				}
 			})
 		})
+
+		Convey("When creating a sink with invalid retry parameters", func() {
+			for _, params := range []string{
+				"retry=0",
+				`retry="a"`,
+				`retry=1, retry_interval="x"`,
+				"retry=1, retry_interval=-1",
+				`retry=1, retry_interval="1s", retry_max_interval="10ms"`,
+				`retry_interval="1s"`,
+				"dead_letter=1",
+				`dead_letter="no_such_sink"`,
+			} {
+				err := addBQLToTopology(tb, "CREATE SINK snk TYPE flaky WITH failures=0, "+params)
+
+				Convey("Then it should fail with "+params, func() {
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
 	})
 }
 
-func TestCreateStateStmt(t *testing.T) {
-	Convey("Given a BQL TopologyBuilder", t, func() {
+// batchCollectorSink is a core.BatchSink recording sizes of batches.
+type batchCollectorSink struct {
+	m          sync.Mutex
+	c          *sync.Cond
+	batchSizes []int
+	numWritten int
+}
+
+func (s *batchCollectorSink) Write(ctx *core.Context, t *core.Tuple) error {
+	return s.WriteBatch(ctx, []*core.Tuple{t})
+}
+
+func (s *batchCollectorSink) WriteBatch(ctx *core.Context, ts []*core.Tuple) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.batchSizes = append(s.batchSizes, len(ts))
+	s.numWritten += len(ts)
+	s.c.Broadcast()
+	return nil
+}
+
+// wait waits until the sink writes n tuples and returns sizes of batches.
+func (s *batchCollectorSink) wait(n int) []int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for s.numWritten < n {
+		s.c.Wait()
+	}
+	return append([]int{}, s.batchSizes...)
+}
+
+func (s *batchCollectorSink) Close(ctx *core.Context) error {
+	return nil
+}
+
+func TestSinkBatch(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with a batch sink", t, func() {
 		dt := newTestTopology()
 		Reset(func() {
 			dt.Stop()
 		})
 		tb, err := NewTopologyBuilder(dt)
 		So(err, ShouldBeNil)
+		So(tb.SinkCreators.Register("batch", SinkCreatorFunc(func(ctx *core.Context,
+			ioParams *IOParams, params data.Map) (core.Sink, error) {
+			s := &batchCollectorSink{}
+			s.c = sync.NewCond(&s.m)
+			return s, nil
+		})), ShouldBeNil)
+		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy WITH num=5;`), ShouldBeNil)
+
+		Convey("When creating a sink with batch parameters", func() {
+			So(addBQLToTopology(tb, `CREATE SINK snk TYPE batch WITH batch_size=2, batch_timeout="10ms";
+				INSERT INTO snk FROM s;
+				RESUME SOURCE s;`), ShouldBeNil)
+			sin, err := dt.Sink("snk")
+			So(err, ShouldBeNil)
+			si := sin.Sink().(*batchCollectorSink)
 
-		Convey("When creating a dummy UDS", func() {
-			So(addBQLToTopology(tb, `CREATE STATE hoge TYPE dummy_uds WITH num=5;`), ShouldBeNil)
-
-			Convey("Then the topology should have the state", func() {
-				s, err := dt.Context().SharedStates.Get("hoge")
+			Convey("Then tuples should be written in batches of the size", func() {
+				// the last tuple is written by the timeout
+				So(si.wait(5), ShouldResemble, []int{2, 2, 1})
+				v, err := sin.Status().Get(data.MustCompilePath("batch.size"))
 				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(2))
+			})
+		})
 
-				Convey("And it should be a dummy UDS having right parameters", func() {
-					ds, ok := s.(*dummyUDS)
-					So(ok, ShouldBeTrue)
-					So(ds.num, ShouldEqual, 5)
+		Convey("When creating a sink with invalid batch parameters", func() {
+			for _, params := range []string{
+				"batch_size=0",
+				`batch_size="a"`,
+				`batch_size=1, batch_timeout="x"`,
+				"batch_size=1, batch_timeout=-1",
+				`batch_timeout="1s"`,
+			} {
+				err := addBQLToTopology(tb, "CREATE SINK snk TYPE batch WITH "+params)
+
+				Convey("Then it should fail with "+params, func() {
+					So(err, ShouldNotBeNil)
 				})
-			})
+			}
 		})
 	})
 }
 
-func TestUpdateStateStmt(t *testing.T) {
-	Convey("Given a BQL TopologyBuilder", t, func() {
+func TestSinkSchema(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with a stream emitting tuples of different types", t, func() {
 		dt := newTestTopology()
 		Reset(func() {
 			dt.Stop()
 		})
 		tb, err := NewTopologyBuilder(dt)
 		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy WITH num=4;
+			CREATE STREAM st AS SELECT RSTREAM int AS a,
+				CASE WHEN int % 2 = 0 THEN int ELSE "x" END AS b
+				FROM s [RANGE 1 TUPLES];
+			CREATE SOURCE dropped TYPE dropped_tuples;
+			CREATE SINK dsnk TYPE collector;
+			INSERT INTO dsnk FROM dropped;`), ShouldBeNil)
+
+		Convey("When creating a sink with a schema", func() {
+			So(addBQLToTopology(tb, `CREATE SINK snk TYPE collector SCHEMA (a INT, b INT);
+				INSERT INTO snk FROM st;
+				RESUME SOURCE s;`), ShouldBeNil)
+			sin, err := dt.Sink("snk")
+			So(err, ShouldBeNil)
+			si := sin.Sink().(*tupleCollectorSink)
+			dsin, err := dt.Sink("dsnk")
+			So(err, ShouldBeNil)
+			dsi := dsin.Sink().(*tupleCollectorSink)
 
-		Convey("When there is no UDS", func() {
-			Convey("Then updating should fail", func() {
-				So(addBQLToTopology(tb, `UPDATE STATE hoge SET num=5;`), ShouldNotBeNil)
+			Convey("Then tuples matching the schema should be written", func() {
+				si.Wait(2)
+				So(si.Tuples[0].Data, ShouldResemble, data.Map{"a": data.Int(2), "b": data.Int(2)})
+				So(si.Tuples[1].Data, ShouldResemble, data.Map{"a": data.Int(4), "b": data.Int(4)})
 			})
-		})
 
-		Convey("Given a non-Updater UDS", func() {
-			So(addBQLToTopology(tb, `CREATE STATE hoge TYPE dummy_uds WITH num=5;`), ShouldBeNil)
+			Convey("Then tuples violating the schema should be reported as dropped tuples", func() {
+				dsi.Wait(2)
+				for i, a := range []int{1, 3} {
+					t := dsi.Tuples[i]
+					So(t.Data["node_name"], ShouldEqual, data.String("snk"))
+					So(t.Data["data"], ShouldResemble, data.Map{"a": data.Int(a), "b": data.String("x")})
+					So(t.Data["error"], ShouldNotBeNil)
+				}
+			})
+		})
 
-			Convey("When updating it", func() {
-				err := addBQLToTopology(tb, `UPDATE STATE hoge SET num=5;`)
+		Convey("When creating a sink with a schema having a duplicated column", func() {
+			err := addBQLToTopology(tb, `CREATE SINK snk TYPE collector SCHEMA (a INT, a STRING);`)
 
-				Convey("There should be an error", func() {
-					So(err, ShouldNotBeNil)
-				})
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "more than once")
 			})
 		})
+	})
+}
 
-		Convey("Given an Updater UDS", func() {
-			So(addBQLToTopology(tb, `CREATE STATE hoge TYPE dummy_updatable_uds WITH num=5;`), ShouldBeNil)
+func TestSourceHeartbeat(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with a time-based window", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
 
-			Convey("When updating it", func() {
-				err := addBQLToTopology(tb, `UPDATE STATE hoge SET num=5;`)
+		// tuples emitted by the dummy source have timestamps in 2015, so
+		// a heartbeat having the current time closes the whole window
+		create := func(params string) *tupleCollectorSink {
+			So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy WITH `+params+`;
+				CREATE STREAM t AS SELECT RSTREAM count(*) AS c FROM s [RANGE 2 SECONDS];
+				CREATE SINK snk TYPE collector;
+				INSERT INTO snk FROM t;
+				RESUME SOURCE s;`), ShouldBeNil)
+			sin, err := dt.Sink("snk")
+			So(err, ShouldBeNil)
+			return sin.Sink().(*tupleCollectorSink)
+		}
+
+		Convey("When the source has a heartbeat and becomes idle", func() {
+			si := create(`num=4, heartbeat="20ms"`)
+			si.Wait(5)
+			time.Sleep(100 * time.Millisecond)
+
+			Convey("Then the window should be closed by the heartbeat", func() {
+				So(si.len(), ShouldEqual, 5)
+				for i, c := range []int64{1, 2, 3, 3, 0} {
+					So(si.get(i).Data["c"], ShouldEqual, data.Int(c))
+				}
+			})
 
-				Convey("There should be no error", func() {
-					So(err, ShouldBeNil)
-				})
+			Convey("Then the result of the heartbeat should be a regular tuple", func() {
+				So(si.get(4).Flags.IsSet(core.TFHeartbeat), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the source doesn't have a heartbeat and becomes idle", func() {
+			si := create(`num=4`)
+			si.Wait(4)
+			time.Sleep(100 * time.Millisecond)
+
+			Convey("Then the window should remain open", func() {
+				So(si.len(), ShouldEqual, 4)
+				So(si.get(3).Data["c"], ShouldEqual, data.Int(3))
 			})
 		})
 	})
 }
 
-func TestSaveLoadStateStmt(t *testing.T) {
-	Convey("Given a BQL TopologyBuilder with some UDSs", t, func() {
+func TestCreateStreamAsSelectStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with source and stream", t, func() {
 		dt := newTestTopology()
 		Reset(func() {
 			dt.Stop()
 		})
 		tb, err := NewTopologyBuilder(dt)
 		So(err, ShouldBeNil)
-		So(addBQLToTopology(tb, `
-			CREATE STATE s1 TYPE dummy_uds WITH num=1;
-			CREATE STATE s2 TYPE dummy_updatable_uds WITH num=2;
-			CREATE STATE s3 TYPE dummy_self_loadable_uds WITH num=3;
-		`), ShouldBeNil)
+		err = addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy`)
+		So(err, ShouldBeNil)
 
-		Convey("When saving a unsavable state", func() {
-			err := addBQLToTopology(tb, `SAVE STATE s1;`)
+		Convey("When running CREATE STREAM AS SELECT with a processing timeout", func() {
+			err := addBQLToTopology(tb, `CREATE STREAM t WITH processing_timeout="50ms" AS
+                SELECT ISTREAM int FROM s [RANGE 1 TUPLES]`)
+			So(err, ShouldBeNil)
 
-			Convey("Then it should fail", func() {
-				So(err, ShouldNotBeNil)
+			Convey("Then the status of the box should have the timeout", func() {
+				b, err := dt.Box("t")
+				So(err, ShouldBeNil)
+				v, err := b.Status().Get(data.MustCompilePath("box.processing_timeout"))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Float(0.05))
 			})
 		})
 
-		Convey("When saving a savable state", func() {
-			So(addBQLToTopology(tb, `SAVE STATE s2;`), ShouldBeNil)
-
-			Convey("Then it should be able to be loaded", func() {
-				So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds;`), ShouldBeNil)
+		Convey("When running CREATE STREAM AS SELECT with invalid options", func() {
+			Convey("Then a non-positive timeout should be rejected", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t WITH processing_timeout=0 AS
+                    SELECT ISTREAM int FROM s [RANGE 1 TUPLES]`)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "processing_timeout")
+			})
 
-				Convey("And the state should have the correct data", func() {
-					s, err := dt.Context().SharedStates.Get("s2")
-					So(err, ShouldBeNil)
-					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
-				})
+			Convey("Then an unknown option should be rejected", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t WITH hoge=1 AS
+                    SELECT ISTREAM int FROM s [RANGE 1 TUPLES]`)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "unknown stream parameter")
 			})
+		})
 
-			Convey("Then it shouldn't be loaded with an unloadable type", func() {
-				So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_uds;`), ShouldNotBeNil)
+		Convey("When running CREATE STREAM AS SELECT with a memory-based BUFFER SIZE", func() {
+			err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                s [RANGE 2 SECONDS, BUFFER SIZE 1 MB]`)
+			So(err, ShouldBeNil)
+
+			Convey("Then the capacity of the input should be derived from the estimate", func() {
+				b, err := dt.Box("t")
+				So(err, ShouldBeNil)
+				size, err := b.Status().Get(data.MustCompilePath(`input_stats.inputs.s.queue_size`))
+				So(err, ShouldBeNil)
+				So(size, ShouldEqual, data.Int(1024*1024/approxTupleSize(nominalTuple)))
 			})
+		})
 
-			Convey("Then it shouldn't be loaded with a wrong type", func() {
-				So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_self_loadable_uds;`), ShouldNotBeNil)
+		Convey("When running CREATE STREAM AS SELECT with a too large memory-based BUFFER SIZE", func() {
+			err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                s [RANGE 2 SECONDS, BUFFER SIZE 1 GB]`)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "too large")
 			})
+		})
 
-			Convey("And updating the state", func() {
-				So(addBQLToTopology(tb, `UPDATE STATE s2 SET num=20;`), ShouldBeNil)
-				s, err := dt.Context().SharedStates.Get("s2")
+		Convey("When running CREATE STREAM AS SELECT on an existing stream", func() {
+			err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                s [RANGE 2 SECONDS, BUFFER SIZE 2, WAIT IF FULL] WHERE int=2`)
+
+			Convey("Then there should be no error", func() {
 				So(err, ShouldBeNil)
-				So(s.(*dummyUpdatableUDS).num, ShouldEqual, 20)
+			})
 
-				Convey("Then loading it should revert the state", func() {
-					So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds;`), ShouldBeNil)
-					s, err := dt.Context().SharedStates.Get("s2")
+			Convey("And when joining source and stream", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM s:int FROM
+                s [RANGE 2 SECONDS], t [RANGE 3 TUPLES]`)
+
+				Convey("Then there should be no error", func() {
 					So(err, ShouldBeNil)
-					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
 				})
 			})
 
-			Convey("And dropping the state", func() {
-				So(addBQLToTopology(tb, `DROP STATE s2;`), ShouldBeNil)
+			Convey("And when self-joining the stream", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM s:int FROM
+                t [RANGE 2 SECONDS] AS s, t [RANGE 3 TUPLES]`)
 
-				Convey("Then it should be able to be loaded again", func() {
-					So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds;`), ShouldBeNil)
-					s, err := dt.Context().SharedStates.Get("s2")
+				Convey("Then there should be no error", func() {
 					So(err, ShouldBeNil)
-					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
 				})
+			})
 
-				Convey("Then it should be able to be created", func() {
-					So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds OR CREATE IF NOT SAVED;`), ShouldBeNil)
-					s, err := dt.Context().SharedStates.Get("s2")
-					So(err, ShouldBeNil)
-					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
+			Convey("And when running another CREATE STREAM AS SELECT with the same name", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                s [RANGE 1 TUPLES] WHERE int=1`)
+
+				Convey("Then an error should be returned the second time", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "already")
 				})
 			})
+
+			Convey("And when running another CREATE STREAM AS SELECT with a different name", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM u AS SELECT ISTREAM int FROM
+                s [RANGE 1 TUPLES] WHERE int=1`)
+
+				Convey("Then there should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+
+		Convey("When running CREATE STREAM AS SELECT with a tool arge buffer size", func() {
+			err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                s [RANGE 2 SECONDS, BUFFER SIZE 131072] WHERE int=2`)
+
+			Convey("Then there should be no error", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "specified buffer capacity 131072 is too large "+
+					"(must be <= 131071)")
+			})
+		})
+
+		Convey("When running CREATE STREAM AS SELECT with a UDSF", func() {
+			Convey("If all parameters are foldable", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                duplicate("s", 2) [RANGE 2 SECONDS] WHERE int=2`)
+
+				Convey("Then there should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("And when joining source and UDSF", func() {
+					err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM s:int FROM
+                s [RANGE 2 SECONDS], duplicate("s", 2) [RANGE 3 TUPLES]`)
+
+					Convey("Then there should be no error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+
+				Convey("And when self-joining the UDSF", func() {
+					err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM s:int FROM
+                    duplicate("s", 2) [RANGE 2 SECONDS] AS s, duplicate("s", 4) [RANGE 3 TUPLES] AS t`)
+
+					Convey("Then there should be no error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+			})
+
+			Convey("If the UDSF doesn't depend on an input", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                test_sequence(4) [RANGE 2 SECONDS] WHERE int=2`)
+
+				Convey("Then there should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("And when joining source and UDSF", func() {
+					err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM s:int FROM
+                    s [RANGE 2 SECONDS], test_sequence(4) [RANGE 3 TUPLES]`)
+
+					Convey("Then there should be no error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+			})
+
+			Convey("If not all parameters are foldable", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                duplicate("s", int) [RANGE 2 SECONDS] WHERE int=2`)
+
+				Convey("Then there should be an error", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldEqual, "parameter 2 of UDSF 'duplicate' must be a constant, but int isn't")
+				})
+			})
+
+			Convey("If a parameter is a constant expression", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                duplicate("s", 1 + abs(-2)) [RANGE 2 SECONDS] WHERE int=2`)
+
+				Convey("Then there should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("If a parameter has a column reference in a subexpression", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                duplicate("s", 1 + abs(s:int)) [RANGE 2 SECONDS] WHERE int=2`)
+
+				Convey("Then there should be an error naming the column", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldEqual, "parameter 2 of UDSF 'duplicate' must be a constant, but s:int isn't")
+				})
+
+				Convey("Then no node should be created", func() {
+					_, err := tb.topology.Box("t")
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("If the UDSF is called with the wrong number of arguments", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                duplicate("s", 1, 2) [RANGE 2 SECONDS] WHERE int=2`)
+
+				Convey("Then there should be an error", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "arity")
+				})
+			})
+
+			Convey("If creating the UDSF fails", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                failing_duplicate("s", 2) [RANGE 2 SECONDS] WHERE int=2`)
+
+				Convey("Then there should be an error", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "test UDSF creation failed")
+				})
+			})
+
+			Convey("If the UDSF isn't registered", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                serial(1, 5) [RANGE 2 SECONDS] WHERE int=2`)
+
+				Convey("Then there should be an error", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "not registered")
+				})
+			})
+
+			Convey("If the UDSF is called with named arguments", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                duplicate(times => 2, stream => "s") [RANGE 2 SECONDS] WHERE int=2`)
+
+				Convey("Then there should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("If the UDSF is called with positional and named arguments", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                duplicate("s", times => 2) [RANGE 2 SECONDS] WHERE int=2`)
+
+				Convey("Then there should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("If a named argument isn't a constant", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                duplicate("s", times => int) [RANGE 2 SECONDS] WHERE int=2`)
+
+				Convey("Then there should be an error naming the parameter", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldEqual, "parameter 'times' of UDSF 'duplicate' must be a constant, but int isn't")
+				})
+			})
+
+			Convey("If a named argument is given to a parameter having a positional one", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                duplicate("s", stream => "s") [RANGE 2 SECONDS] WHERE int=2`)
+
+				Convey("Then there should be an error", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "given more than once")
+				})
+			})
+
+			Convey("If a named argument doesn't match any parameter", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                duplicate("s", count => 2) [RANGE 2 SECONDS] WHERE int=2`)
+
+				Convey("Then there should be an error", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "doesn't have parameter 'count'")
+				})
+			})
+
+			Convey("If the UDSF doesn't have names of its parameters", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                failing_duplicate(stream => "s", times => 2) [RANGE 2 SECONDS] WHERE int=2`)
+
+				Convey("Then there should be an error", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "doesn't accept named arguments")
+				})
+			})
+		})
+
+		Convey("When running CREATE STREAM AS SELECT on a non-existing stream", func() {
+			err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM
+                bar [RANGE 2 SECONDS] WHERE int=2`)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "was not found")
+			})
+		})
+
+		Convey("When running CREATE STREAM AS SELECT with input and output name the same", func() {
+			err := addBQLToTopology(tb, `CREATE STREAM s AS SELECT ISTREAM int FROM
+                s [RANGE 2 SECONDS] WHERE int=2`)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "already")
+			})
+		})
+	})
+}
+
+func TestMaxUDSFInstances(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder limiting the number of UDSFs", t, func() {
+		dt, err := core.NewDefaultTopology(core.NewContext(&core.ContextConfig{MaxUDSFInstances: 2}), "testTopology")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy`), ShouldBeNil)
+
+		Convey("When creating streams using UDSFs up to the limit", func() {
+			So(addBQLToTopology(tb, `CREATE STREAM t1 AS SELECT ISTREAM int FROM
+                duplicate("s", 2) [RANGE 1 TUPLES]`), ShouldBeNil)
+			So(addBQLToTopology(tb, `CREATE STREAM t2 AS SELECT ISTREAM int FROM
+                duplicate("s", 3) [RANGE 1 TUPLES]`), ShouldBeNil)
+
+			Convey("Then the topology should have as many UDSFs as the limit", func() {
+				So(tb.numUDSFInstances(), ShouldEqual, 2)
+			})
+
+			Convey("And when creating another stream using a UDSF", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t3 AS SELECT ISTREAM int FROM
+                    duplicate("s", 2) [RANGE 1 TUPLES]`)
+
+				Convey("Then it should fail with a descriptive error", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldEqual, "cannot create UDSF 'duplicate' because the topology "+
+						"already has 2 UDSF instances, which is the limit")
+				})
+
+				Convey("Then the stream shouldn't be created", func() {
+					_, err := dt.Box("t3")
+					So(err, ShouldNotBeNil)
+					So(tb.numUDSFInstances(), ShouldEqual, 2)
+				})
+			})
+
+			Convey("And when creating a stream without UDSFs", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM t3 AS SELECT ISTREAM int FROM
+                    s [RANGE 1 TUPLES]`)
+
+				Convey("Then it should succeed", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+
+		Convey("When creating a stream using more UDSFs than the limit", func() {
+			So(addBQLToTopology(tb, `CREATE STREAM t1 AS SELECT ISTREAM int FROM
+                duplicate("s", 2) [RANGE 1 TUPLES]`), ShouldBeNil)
+			err := addBQLToTopology(tb, `CREATE STREAM t2 AS SELECT ISTREAM a:int FROM
+                duplicate("s", 2) [RANGE 1 TUPLES] AS a, duplicate("s", 3) [RANGE 1 TUPLES] AS b`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "which is the limit")
+			})
+
+			Convey("Then UDSFs created by the statement should be removed", func() {
+				So(tb.numUDSFInstances(), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When creating streams using UDSFs concurrently from multiple builders", func() {
+			tb2, err := NewTopologyBuilder(dt)
+			So(err, ShouldBeNil)
+			builders := []*TopologyBuilder{tb, tb2}
+
+			const n = 10
+			errs := make(chan error, n)
+			wg := sync.WaitGroup{}
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					errs <- addBQLToTopology(builders[i%2], fmt.Sprintf(`CREATE STREAM t%v AS
+                        SELECT ISTREAM int FROM duplicate("s", 2) [RANGE 1 TUPLES]`, i))
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+
+			Convey("Then only as many statements as the limit should succeed", func() {
+				succeeded := 0
+				for err := range errs {
+					if err == nil {
+						succeeded++
+					} else {
+						So(err.Error(), ShouldContainSubstring, "which is the limit")
+					}
+				}
+				So(succeeded, ShouldEqual, 2)
+				So(tb.numUDSFInstances(), ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestCreateStreamAsSelectUnionStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with source and stream", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		err = addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy`)
+		So(err, ShouldBeNil)
+
+		Convey("When running CREATE STREAM AS SELECT on an existing stream", func() {
+			err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 2 SECONDS]
+				UNION ALL SELECT ISTREAM int+1 FROM s [RANGE 2 SECONDS]`)
+
+			Convey("Then there should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("And when unioning source and stream", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM int FROM s [RANGE 2 SECONDS]
+				UNION ALL SELECT DSTREAM int+1 FROM t [RANGE 2 SECONDS]`)
+
+				Convey("Then there should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("And when unioning with yet another stream", func() {
+					err := addBQLToTopology(tb, `CREATE STREAM u AS SELECT ISTREAM int FROM s [RANGE 2 SECONDS]
+						UNION ALL SELECT DSTREAM int+1 FROM t [RANGE 2 SECONDS]
+						UNION ALL SELECT DSTREAM int+2 FROM x [RANGE 2 SECONDS]`)
+
+					Convey("Then there should be no error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+			})
+
+			Convey("And when running another CREATE STREAM AS SELECT with the same name", func() {
+				prevNodes := len(tb.topology.Nodes())
+				err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 2 SECONDS]
+				UNION ALL SELECT DSTREAM int+1 FROM t [RANGE 2 SECONDS]`)
+
+				Convey("Then an error should be returned the second time", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "already")
+					So(len(tb.topology.Nodes()), ShouldEqual, prevNodes)
+				})
+			})
+		})
+
+		Convey("When running CREATE STREAM AS SELECT with an ordered UNION ALL", func() {
+			prevNodes := len(tb.topology.Nodes())
+			err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 2 SECONDS]
+				UNION ALL SELECT ISTREAM int+1 FROM s [RANGE 2 SECONDS] ORDERED`)
+
+			Convey("Then there should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then only one node should be added to the topology", func() {
+				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes+1)
+			})
+		})
+
+		Convey("When running CREATE STREAM AS SELECT with an ordered UNION ALL using a UDSF", func() {
+			prevNodes := len(tb.topology.Nodes())
+			err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 2 SECONDS]
+				UNION ALL SELECT ISTREAM int FROM duplicate("s", 2) [RANGE 2 SECONDS] ORDERED`)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "UNION ALL ORDERED")
+				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes)
+			})
+		})
+
+		Convey("When running CREATE STREAM AS SELECT on a non-existing stream (1)", func() {
+			prevNodes := len(tb.topology.Nodes())
+			err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM int FROM bar [RANGE 2 SECONDS]
+				UNION ALL SELECT DSTREAM int+1 FROM t [RANGE 2 SECONDS]`)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "was not found")
+				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes)
+			})
+		})
+
+		Convey("When running CREATE STREAM AS SELECT on a non-existing stream (2)", func() {
+			prevNodes := len(tb.topology.Nodes())
+			err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM int FROM s [RANGE 2 SECONDS]
+				UNION ALL SELECT DSTREAM int+1 FROM bar [RANGE 2 SECONDS]`)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "was not found")
+				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes)
+			})
+		})
+	})
+}
+
+func TestCreateStreamWithNamedSelects(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with source", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		err = addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy`)
+		So(err, ShouldBeNil)
+
+		Convey("When running CREATE STREAM AS WITH ... SELECT", func() {
+			prevNodes := len(tb.topology.Nodes())
+			err := addBQLToTopology(tb, `CREATE STREAM t AS
+				WITH a AS (SELECT ISTREAM int FROM s [RANGE 2 SECONDS]),
+				b AS (SELECT ISTREAM int + 1 AS int FROM a [RANGE 2 SECONDS])
+				SELECT ISTREAM a:int, b:int AS c FROM a [RANGE 2 SECONDS], b [RANGE 2 SECONDS]`)
+
+			Convey("Then there should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then an intermediate stream should be added for each named statement", func() {
+				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes+3)
+				_, err := tb.topology.Box("t")
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the names of the WITH clause shouldn't be visible from other statements", func() {
+				err := addBQLToTopology(tb, `CREATE STREAM x AS SELECT ISTREAM int FROM a [RANGE 2 SECONDS]`)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "was not found")
+			})
+		})
+
+		Convey("When a named statement refers to a following one", func() {
+			prevNodes := len(tb.topology.Nodes())
+			err := addBQLToTopology(tb, `CREATE STREAM t AS
+				WITH a AS (SELECT ISTREAM int FROM b [RANGE 2 SECONDS]),
+				b AS (SELECT ISTREAM int FROM s [RANGE 2 SECONDS])
+				SELECT ISTREAM int FROM a [RANGE 2 SECONDS]`)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "was not found")
+				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes)
+			})
+		})
+
+		Convey("When a name is defined more than once in the WITH clause", func() {
+			prevNodes := len(tb.topology.Nodes())
+			err := addBQLToTopology(tb, `CREATE STREAM t AS
+				WITH a AS (SELECT ISTREAM int FROM s [RANGE 2 SECONDS]),
+				a AS (SELECT ISTREAM int FROM s [RANGE 2 SECONDS])
+				SELECT ISTREAM int FROM a [RANGE 2 SECONDS]`)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "more than once")
+				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes)
+			})
+		})
+
+		Convey("When the main statement fails", func() {
+			prevNodes := len(tb.topology.Nodes())
+			err := addBQLToTopology(tb, `CREATE STREAM t AS
+				WITH a AS (SELECT ISTREAM int FROM s [RANGE 2 SECONDS])
+				SELECT ISTREAM int FROM bar [RANGE 2 SECONDS]`)
+
+			Convey("Then the intermediate streams should be removed", func() {
+				So(err, ShouldNotBeNil)
+				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes)
+			})
+		})
+	})
+}
+
+func TestCreateSinkStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		Convey("When running CREATE SINK with a collector source", func() {
+			err := addBQLToTopology(tb, `CREATE SINK hoge TYPE collector`)
+
+			Convey("Then there should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("And when running another CREATE SINK using the same name", func() {
+				err := addBQLToTopology(tb, `CREATE SINK hoge TYPE collector`)
+
+				Convey("Then an error should be returned", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "already")
+				})
+			})
+		})
+		Convey("When running CREATE SINK with invalid parameters", func() {
+			err := addBQLToTopology(tb, `CREATE SINK hoge TYPE collector WITH foo="bar"`)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unknown sink parameter: foo")
+			})
+		})
+		Convey("When running CREATE SINK with an unknown sink type", func() {
+			err := addBQLToTopology(tb, `CREATE SINK hoge TYPE foo`)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "not registered")
+			})
+		})
+	})
+}
+
+func TestInsertIntoFromStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with source, stream, and sink", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		err = addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy`)
+		So(err, ShouldBeNil)
+		err = addBQLToTopology(tb, `CREATE STREAM t AS SELECT RSTREAM * FROM s [RANGE 1 TUPLES]`)
+		So(err, ShouldBeNil)
+		err = addBQLToTopology(tb, `CREATE SINK foo TYPE collector`)
+		So(err, ShouldBeNil)
+
+		Convey("When running INSERT INTO on an existing source and sink", func() {
+			err := addBQLToTopology(tb, `INSERT INTO foo FROM s`)
+
+			Convey("Then there should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("And when running another INSERT INTO", func() {
+				err := addBQLToTopology(tb, `INSERT INTO foo FROM t`)
+
+				Convey("Then there should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+
+		Convey("When running INSERT INTO with DRY RUN", func() {
+			err := addBQLToTopology(tb, `INSERT INTO foo FROM t DRY RUN`)
+			So(err, ShouldBeNil)
+			So(addBQLToTopology(tb, `RESUME SOURCE s`), ShouldBeNil)
+
+			Convey("Then the sink node should count tuples", func() {
+				sink, err := dt.Sink("foo")
+				So(err, ShouldBeNil)
+				numDiscarded := func() int64 {
+					st, err := sink.Status().Get(data.MustCompilePath("dry_run.num_discarded"))
+					So(err, ShouldBeNil)
+					n, err := data.AsInt(st)
+					So(err, ShouldBeNil)
+					return n
+				}
+				for numDiscarded() < 4 {
+					time.Sleep(time.Millisecond)
+				}
+				So(numDiscarded(), ShouldEqual, 4)
+
+				Convey("And no tuple should reach the sink", func() {
+					So(sink.Sink().(*tupleCollectorSink).len(), ShouldEqual, 0)
+				})
+			})
+		})
+
+		Convey("When running INSERT INTO on a non-existing stream", func() {
+			err := addBQLToTopology(tb, `INSERT INTO foo FROM foo`)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "was not found")
+			})
+		})
+
+		Convey("When running INSERT INTO on a non-existing sink", func() {
+			err := addBQLToTopology(tb, `INSERT INTO bar FROM s`)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "was not found")
+			})
+		})
+	})
+}
+
+func TestTeeStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with a stream inserted into a sink", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		err = addBQLToTopology(tb, `
+			CREATE PAUSED SOURCE s TYPE dummy WITH num=4;
+			CREATE STREAM t AS SELECT RSTREAM int * 2 AS x FROM s [RANGE 1 TUPLES];
+			CREATE SINK foo TYPE collector;
+			CREATE SINK debug TYPE collector;
+			INSERT INTO foo FROM t;`)
+		So(err, ShouldBeNil)
+
+		Convey("When running TEE on the stream", func() {
+			err := addBQLToTopology(tb, `TEE t TO debug`)
+			So(err, ShouldBeNil)
+			So(addBQLToTopology(tb, `RESUME SOURCE s`), ShouldBeNil)
+
+			Convey("Then both sinks should receive identical tuples", func() {
+				foo, err := dt.Sink("foo")
+				So(err, ShouldBeNil)
+				fooSink := foo.Sink().(*tupleCollectorSink)
+				debug, err := dt.Sink("debug")
+				So(err, ShouldBeNil)
+				debugSink := debug.Sink().(*tupleCollectorSink)
+
+				fooSink.Wait(4)
+				debugSink.Wait(4)
+				So(fooSink.len(), ShouldEqual, 4)
+				So(debugSink.len(), ShouldEqual, 4)
+				for i := 0; i < 4; i++ {
+					So(debugSink.get(i).Data, ShouldResemble, fooSink.get(i).Data)
+					So(debugSink.get(i).Data, ShouldResemble, data.Map{"x": data.Int((i + 1) * 2)})
+				}
+			})
+		})
+
+		Convey("When running TEE on a non-existing stream", func() {
+			err := addBQLToTopology(tb, `TEE u TO debug`)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "was not found")
+			})
+		})
+
+		Convey("When running TEE to a non-existing sink", func() {
+			err := addBQLToTopology(tb, `TEE t TO bar`)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "was not found")
+			})
+		})
+	})
+}
+
+func TestMultipleStatements(t *testing.T) {
+	Convey("Given an empty BQL TopologyBuilder", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		Convey("When issuing multiple commands in a good order", func() {
+			stmts := `
+			CREATE PAUSED SOURCE source TYPE dummy WITH num=4;
+			CREATE STREAM box AS SELECT
+			  ISTREAM int, str((int+1) % 3) AS x FROM source
+			  [RANGE 2 SECONDS] WHERE int % 2 = 0;
+			CREATE SINK snk TYPE collector;
+			INSERT INTO snk FROM box;
+			RESUME SOURCE source;
+			`
+			err := addBQLToTopology(tb, stmts)
+
+			Convey("Then setup should succeed", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When issuing multiple commands in a bad order", func() {
+			stmts := `
+			CREATE PAUSED SOURCE source TYPE dummy WITH num=4;
+			CREATE STREAM box AS SELECT
+			  ISTREAM int, str((int+1) % 3) AS x FROM source
+			  [RANGE 2 SECONDS] WHERE int % 2 = 0;
+			INSERT INTO snk FROM box;
+			CREATE SINK snk TYPE collector;
+			RESUME SOURCE source;
+			`
+			err := addBQLToTopology(tb, stmts)
+
+			Convey("Then setup should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestCreateStateStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		Convey("When creating a dummy UDS", func() {
+			So(addBQLToTopology(tb, `CREATE STATE hoge TYPE dummy_uds WITH num=5;`), ShouldBeNil)
+
+			Convey("Then the topology should have the state", func() {
+				s, err := dt.Context().SharedStates.Get("hoge")
+				So(err, ShouldBeNil)
+
+				Convey("And it should be a dummy UDS having right parameters", func() {
+					ds, ok := s.(*dummyUDS)
+					So(ok, ShouldBeTrue)
+					So(ds.num, ShouldEqual, 5)
+				})
+			})
+		})
+	})
+}
+
+func TestCreateStmtModifiers(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with source, stream, sink, and state", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy;
+			CREATE STREAM x AS SELECT ISTREAM int FROM s [RANGE 1 TUPLES];
+			CREATE SINK k TYPE collector;
+			CREATE STATE st TYPE dummy_uds WITH num=5;`), ShouldBeNil)
+		prevNodes := len(tb.topology.Nodes())
+		ctx := tb.topology.Context()
+
+		addStmt := func(bql string) (core.Node, error) {
+			stmt, _, err := parser.New().ParseStmt(bql)
+			So(err, ShouldBeNil)
+			return tb.AddStmt(stmt)
+		}
+		stateNum := func() int64 {
+			s, err := ctx.SharedStates.Get("st")
+			So(err, ShouldBeNil)
+			return s.(*dummyUDS).num
+		}
+
+		Convey("When creating an existing source with IF NOT EXISTS", func() {
+			prev, err := tb.topology.Source("s")
+			So(err, ShouldBeNil)
+			node, err := addStmt(`CREATE SOURCE IF NOT EXISTS s TYPE dummy`)
+
+			Convey("Then it should return the existing source", func() {
+				So(err, ShouldBeNil)
+				So(node, ShouldEqual, prev)
+				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes)
+			})
+		})
+
+		Convey("When creating a new stream with IF NOT EXISTS", func() {
+			node, err := addStmt(`CREATE STREAM IF NOT EXISTS y AS SELECT ISTREAM int FROM s [RANGE 1 TUPLES]`)
+
+			Convey("Then the stream should be created", func() {
+				So(err, ShouldBeNil)
+				So(node.Name(), ShouldEqual, "y")
+				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes+1)
+			})
+		})
+
+		Convey("When creating a sink with IF NOT EXISTS having the name of a source", func() {
+			_, err := addStmt(`CREATE SINK IF NOT EXISTS s TYPE collector`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When replacing an existing stream", func() {
+			prev, err := tb.topology.Box("x")
+			So(err, ShouldBeNil)
+			node, err := addStmt(`CREATE OR REPLACE STREAM x AS SELECT ISTREAM int + 1 AS int FROM s [RANGE 1 TUPLES]`)
+
+			Convey("Then the stream should be replaced", func() {
+				So(err, ShouldBeNil)
+				So(node, ShouldNotEqual, prev)
+				b, err := tb.topology.Box("x")
+				So(err, ShouldBeNil)
+				So(b, ShouldEqual, node)
+				So(prev.State().Get(), ShouldEqual, core.TSStopped)
+				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes)
+			})
+		})
+
+		Convey("When using OR REPLACE and IF NOT EXISTS together", func() {
+			_, err := addStmt(`CREATE OR REPLACE STREAM IF NOT EXISTS x AS SELECT ISTREAM int FROM s [RANGE 1 TUPLES]`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When creating an existing state with IF NOT EXISTS", func() {
+			_, err := addStmt(`CREATE STATE IF NOT EXISTS st TYPE dummy_uds WITH num=7`)
+
+			Convey("Then the state shouldn't be changed", func() {
+				So(err, ShouldBeNil)
+				So(stateNum(), ShouldEqual, 5)
+			})
+		})
+
+		Convey("When replacing an existing state", func() {
+			_, err := addStmt(`CREATE OR REPLACE STATE st TYPE dummy_uds WITH num=7`)
+
+			Convey("Then the state should be replaced", func() {
+				So(err, ShouldBeNil)
+				So(stateNum(), ShouldEqual, 7)
+			})
+		})
+
+		Convey("When replacing a state with an invalid one", func() {
+			_, err := addStmt(`CREATE OR REPLACE STATE st TYPE dummy_uds WITH num="a"`)
+
+			Convey("Then the previous state should remain", func() {
+				So(err, ShouldNotBeNil)
+				So(stateNum(), ShouldEqual, 5)
+			})
+		})
+
+		Convey("When adding statements with modifiers atomically", func() {
+			Convey("with IF NOT EXISTS and a failing statement", func() {
+				_, err := tb.AddStmtsAtomically(mustParseStmts(`CREATE STREAM IF NOT EXISTS x AS SELECT ISTREAM int FROM s [RANGE 1 TUPLES];
+					CREATE STATE IF NOT EXISTS st TYPE dummy_uds;
+					CREATE STREAM u AS SELECT ISTREAM int FROM no_such_stream [RANGE 1 TUPLES];`))
+
+				Convey("Then the existing ones shouldn't be removed", func() {
+					So(err, ShouldNotBeNil)
+					_, err := tb.topology.Box("x")
+					So(err, ShouldBeNil)
+					So(stateNum(), ShouldEqual, 5)
+				})
+			})
+
+			Convey("with OR REPLACE", func() {
+				_, err := tb.AddStmtsAtomically(mustParseStmts(`CREATE OR REPLACE STATE st TYPE dummy_uds WITH num=7;`))
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+					So(stateNum(), ShouldEqual, 5)
+				})
+			})
+		})
+	})
+}
+
+func mustParseStmts(bql string) []interface{} {
+	stmts, err := parser.New().ParseStmts(bql)
+	So(err, ShouldBeNil)
+	return stmts
+}
+
+func TestEnvParams(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder and an environment variable", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		So(os.Setenv("SENSORBEE_TEST_ENV_NUM", "7"), ShouldBeNil)
+		So(os.Unsetenv("SENSORBEE_TEST_ENV_UNSET"), ShouldBeNil)
+		Reset(func() {
+			os.Unsetenv("SENSORBEE_TEST_ENV_NUM")
+		})
+
+		numOf := func(name string) int64 {
+			s, err := dt.Context().SharedStates.Get(name)
+			So(err, ShouldBeNil)
+			return s.(*dummyUDS).num
+		}
+
+		Convey("When creating a state with a parameter from the set variable", func() {
+			So(addBQLToTopology(tb, `CREATE STATE hoge TYPE dummy_uds WITH num=env("SENSORBEE_TEST_ENV_NUM", 3);`), ShouldBeNil)
+
+			Convey("Then the parameter should have the value of the variable", func() {
+				So(numOf("hoge"), ShouldEqual, 7)
+			})
+		})
+
+		Convey("When creating a state with a parameter from the unset variable with a default", func() {
+			So(addBQLToTopology(tb, `CREATE STATE hoge TYPE dummy_uds WITH num=env("SENSORBEE_TEST_ENV_UNSET", 3);`), ShouldBeNil)
+
+			Convey("Then the parameter should have the default value", func() {
+				So(numOf("hoge"), ShouldEqual, 3)
+			})
+		})
+
+		Convey("When creating a state with a parameter from the unset variable without a default", func() {
+			err := addBQLToTopology(tb, `CREATE STATE hoge TYPE dummy_uds WITH num=env("SENSORBEE_TEST_ENV_UNSET");`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "SENSORBEE_TEST_ENV_UNSET")
+			})
+		})
+	})
+}
+
+func TestUpdateStateStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		Convey("When there is no UDS", func() {
+			Convey("Then updating should fail", func() {
+				So(addBQLToTopology(tb, `UPDATE STATE hoge SET num=5;`), ShouldNotBeNil)
+			})
+		})
+
+		Convey("Given a non-Updater UDS", func() {
+			So(addBQLToTopology(tb, `CREATE STATE hoge TYPE dummy_uds WITH num=5;`), ShouldBeNil)
+
+			Convey("When updating it", func() {
+				err := addBQLToTopology(tb, `UPDATE STATE hoge SET num=5;`)
+
+				Convey("There should be an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("Given an Updater UDS", func() {
+			So(addBQLToTopology(tb, `CREATE STATE hoge TYPE dummy_updatable_uds WITH num=5;`), ShouldBeNil)
+
+			Convey("When updating it", func() {
+				err := addBQLToTopology(tb, `UPDATE STATE hoge SET num=5;`)
+
+				Convey("There should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+	})
+}
+
+func TestSaveLoadStateStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with some UDSs", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `
+			CREATE STATE s1 TYPE dummy_uds WITH num=1;
+			CREATE STATE s2 TYPE dummy_updatable_uds WITH num=2;
+			CREATE STATE s3 TYPE dummy_self_loadable_uds WITH num=3;
+		`), ShouldBeNil)
+
+		Convey("When saving a unsavable state", func() {
+			err := addBQLToTopology(tb, `SAVE STATE s1;`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When saving a savable state", func() {
+			So(addBQLToTopology(tb, `SAVE STATE s2;`), ShouldBeNil)
+
+			Convey("Then it should be able to be loaded", func() {
+				So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds;`), ShouldBeNil)
+
+				Convey("And the state should have the correct data", func() {
+					s, err := dt.Context().SharedStates.Get("s2")
+					So(err, ShouldBeNil)
+					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
+				})
+			})
+
+			Convey("Then it shouldn't be loaded with an unloadable type", func() {
+				So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_uds;`), ShouldNotBeNil)
+			})
+
+			Convey("Then it shouldn't be loaded with a wrong type", func() {
+				So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_self_loadable_uds;`), ShouldNotBeNil)
+			})
+
+			Convey("And updating the state", func() {
+				So(addBQLToTopology(tb, `UPDATE STATE s2 SET num=20;`), ShouldBeNil)
+				s, err := dt.Context().SharedStates.Get("s2")
+				So(err, ShouldBeNil)
+				So(s.(*dummyUpdatableUDS).num, ShouldEqual, 20)
+
+				Convey("Then loading it should revert the state", func() {
+					So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds;`), ShouldBeNil)
+					s, err := dt.Context().SharedStates.Get("s2")
+					So(err, ShouldBeNil)
+					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
+				})
+			})
+
+			Convey("And dropping the state", func() {
+				So(addBQLToTopology(tb, `DROP STATE s2;`), ShouldBeNil)
+
+				Convey("Then it should be able to be loaded again", func() {
+					So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds;`), ShouldBeNil)
+					s, err := dt.Context().SharedStates.Get("s2")
+					So(err, ShouldBeNil)
+					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
+				})
+
+				Convey("Then it should be able to be created", func() {
+					So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds OR CREATE IF NOT SAVED;`), ShouldBeNil)
+					s, err := dt.Context().SharedStates.Get("s2")
+					So(err, ShouldBeNil)
+					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
+				})
+			})
+		})
+
+		Convey("When saving a savable state with a tag", func() {
+			So(addBQLToTopology(tb, `SAVE STATE s2 TAG mytag;`), ShouldBeNil)
+
+			Convey("Then it should be able to be loaded with that tag", func() {
+				So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds TAG mytag;`), ShouldBeNil)
+
+				Convey("And the state should have the correct data", func() {
+					s, err := dt.Context().SharedStates.Get("s2")
+					So(err, ShouldBeNil)
+					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
+				})
+			})
+
+			Convey("Then it should not be able to be loaded without a tag", func() {
+				So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds;`), ShouldNotBeNil)
+			})
+
+			Convey("And updating the state", func() {
+				So(addBQLToTopology(tb, `UPDATE STATE s2 SET num=20;`), ShouldBeNil)
+				s, err := dt.Context().SharedStates.Get("s2")
+				So(err, ShouldBeNil)
+				So(s.(*dummyUpdatableUDS).num, ShouldEqual, 20)
+
+				Convey("Then loading it should revert the state", func() {
+					So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds TAG mytag;`), ShouldBeNil)
+					s, err := dt.Context().SharedStates.Get("s2")
+					So(err, ShouldBeNil)
+					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
+				})
+			})
+
+			Convey("And dropping the state", func() {
+				So(addBQLToTopology(tb, `DROP STATE s2;`), ShouldBeNil)
+
+				Convey("Then it should be able to be loaded again", func() {
+					So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds TAG mytag;`), ShouldBeNil)
+					s, err := dt.Context().SharedStates.Get("s2")
+					So(err, ShouldBeNil)
+					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
+				})
+
+				Convey("Then it should be able to be created", func() {
+					So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds TAG mytag OR CREATE IF NOT SAVED;`), ShouldBeNil)
+					s, err := dt.Context().SharedStates.Get("s2")
+					So(err, ShouldBeNil)
+					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
+				})
+			})
+		})
+
+		Convey("When saving a self loadable state", func() {
+			So(addBQLToTopology(tb, `SAVE STATE s3;`), ShouldBeNil)
+
+			Convey("Then it should be able to be loaded", func() {
+				So(addBQLToTopology(tb, `LOAD STATE s3 TYPE dummy_self_loadable_uds;`), ShouldBeNil)
+
+				Convey("And the state should have the correct data", func() {
+					s, err := dt.Context().SharedStates.Get("s3")
+					So(err, ShouldBeNil)
+					So(s.(*dummySelfLoadableUDS).num, ShouldEqual, 3)
+				})
+			})
+		})
+
+		Convey("When saving a nonexistent state", func() {
+			err := addBQLToTopology(tb, `SAVE STATE s4;`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When loading a state which has not been saved", func() {
+			err := addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds;`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When loading a state which has not been created nor saved", func() {
+			err := addBQLToTopology(tb, `LOAD STATE s4 TYPE dummy_updatable_uds;`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When loading a state which has not been created nor saved with LOAD OR CREATE IF NOT SAVED", func() {
+			err := addBQLToTopology(tb, `LOAD STATE s4 TYPE dummy_updatable_uds OR CREATE IF NOT SAVED WITH num=4;`)
+
+			Convey("Then it should succeed", func() {
+				So(err, ShouldBeNil)
+				s, err := dt.Context().SharedStates.Get("s4")
+				So(err, ShouldBeNil)
+				So(s.(*dummyUpdatableUDS).num, ShouldEqual, 4)
+			})
+		})
+	})
+}
+
+func TestUpdateSourceStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		Convey("When there is no updatable source", func() {
+			Convey("Then updating should fail", func() {
+				So(addBQLToTopology(tb, `UPDATE SOURCE hoge SET num=5;`), ShouldNotBeNil)
+			})
+		})
+
+		Convey("Given a non-Updater source", func() {
+			So(addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy WITH num=4`), ShouldBeNil)
+
+			Convey("When updating the source", func() {
+				err := addBQLToTopology(tb, `UPDATE SOURCE hoge SET num=5;`)
+
+				Convey("There should be an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("Given an Updater source", func() {
+			So(addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy_updatable WITH num=5;`), ShouldBeNil)
+
+			Convey("When updating the updatable source", func() {
+				err := addBQLToTopology(tb, `UPDATE SOURCE hoge SET num=5;`)
+
+				Convey("There should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+	})
+}
+
+func TestReloadSourceStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		Convey("When there is no source", func() {
+			Convey("Then reloading should fail", func() {
+				So(addBQLToTopology(tb, `RELOAD SOURCE hoge;`), ShouldNotBeNil)
+			})
+		})
+
+		Convey("Given a non-Reloader source", func() {
+			So(addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy WITH num=4`), ShouldBeNil)
+
+			Convey("When reloading the source", func() {
+				err := addBQLToTopology(tb, `RELOAD SOURCE hoge;`)
+
+				Convey("Then there should be an error", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "cannot be reloaded")
+				})
+			})
+		})
+
+		Convey("Given a Reloader source", func() {
+			f, err := ioutil.TempFile("", "sensorbee_reload_source_test")
+			So(err, ShouldBeNil)
+			path := f.Name()
+			Reset(func() {
+				os.Remove(path)
+			})
+			_, err = f.WriteString("v1")
+			So(err, ShouldBeNil)
+			So(f.Close(), ShouldBeNil)
+
+			So(addBQLToTopology(tb, fmt.Sprintf(`CREATE PAUSED SOURCE hoge TYPE dummy_reloadable WITH path=%q;`, path)), ShouldBeNil)
+			sn, err := dt.Source("hoge")
+			So(err, ShouldBeNil)
+			src := sn.Source().(*tupleEmitterReloadableSource)
+			So(src.currentConfig(), ShouldEqual, "v1")
+
+			Convey("When reloading it after changing the configuration", func() {
+				So(ioutil.WriteFile(path, []byte("v2"), 0644), ShouldBeNil)
+				err := addBQLToTopology(tb, `RELOAD SOURCE hoge;`)
+				So(err, ShouldBeNil)
+
+				Convey("Then the new configuration should take effect", func() {
+					So(src.currentConfig(), ShouldEqual, "v2")
+				})
+
+				Convey("Then the node should be kept", func() {
+					sn2, err := dt.Source("hoge")
+					So(err, ShouldBeNil)
+					So(sn2, ShouldEqual, sn)
+					So(sn2.State().Get(), ShouldEqual, core.TSPaused)
+				})
+			})
+
+			Convey("When reloading it after the configuration is removed", func() {
+				So(os.Remove(path), ShouldBeNil)
+				err := addBQLToTopology(tb, `RELOAD SOURCE hoge;`)
+
+				Convey("Then it should fail and keep the previous configuration", func() {
+					So(err, ShouldNotBeNil)
+					So(src.currentConfig(), ShouldEqual, "v1")
+				})
+			})
+		})
+	})
+}
+
+func TestUpdateSinkStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		Convey("When there is no updatable sink", func() {
+			Convey("Then updating should fail", func() {
+				So(addBQLToTopology(tb, `UPDATE SINK hoge SET num=5;`), ShouldNotBeNil)
+			})
+		})
+
+		Convey("Given a non-Updater sink", func() {
+			So(addBQLToTopology(tb, `CREATE SINK hoge TYPE collector;`), ShouldBeNil)
+
+			Convey("When updating it", func() {
+				err := addBQLToTopology(tb, `UPDATE SINK hoge SET num=5;`)
+
+				Convey("There should be an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("Given an Updater sink", func() {
+			So(addBQLToTopology(tb, `CREATE SINK hoge TYPE collector_updatable;`), ShouldBeNil)
+
+			Convey("When updating it", func() {
+				err := addBQLToTopology(tb, `UPDATE SINK hoge SET num=5;`)
+
+				Convey("There should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+	})
+}
+
+func TestSelectStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with a source", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy WITH num=4, resumable=false;`), ShouldBeNil)
+
+		Convey("When issuing a SELECT stmt", func() {
+			bp := parser.New()
+			istmt, _, err := bp.ParseStmt(`SELECT ISTREAM * FROM s [RANGE 1 TUPLES];`)
+			So(err, ShouldBeNil)
+			stmt := istmt.(parser.SelectStmt)
+			sn, ch, err := tb.AddSelectStmt(&stmt)
+			So(err, ShouldBeNil)
+			So(addBQLToTopology(tb, `RESUME SOURCE s;`), ShouldBeNil)
+
+			Convey("Then the chan should receive all tuples", func() {
+				cnt := 0
+				for _ = range ch {
+					cnt++
+				}
+				So(cnt, ShouldEqual, 4)
+
+				Convey("And the Sink should be stopped", func() {
+					So(sn.State().Wait(core.TSStopped), ShouldEqual, core.TSStopped)
+				})
+
+				Convey("And the Sink should eventually be removed from the topology", func() {
+					waitForExpectedCondition(func() bool {
+						_, err := dt.Sink(sn.Name())
+						return err != nil
+					})
+					_, err := dt.Sink(sn.Name())
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("When issuing a SELECT stmt referencing an unknown source", func() {
+			bp := parser.New()
+			numNodes := len(tb.topology.Nodes())
+			istmt, _, err := bp.ParseStmt(`SELECT ISTREAM * FROM hoge [RANGE 1 TUPLES];`)
+			So(err, ShouldBeNil)
+			stmt := istmt.(parser.SelectStmt)
+			_, _, err = tb.AddSelectStmt(&stmt)
+			So(err, ShouldNotBeNil) // unknown data source
+			waitForExpectedCondition(func() bool {
+				return len(tb.topology.Sinks()) == 0
+			})
+			So(len(tb.topology.Nodes()), ShouldEqual, numNodes)
+		})
+	})
+}
+
+func TestSelectUnionStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with a source", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy WITH num=4, resumable=false;`), ShouldBeNil)
+
+		Convey("When issuing a SELECT stmt", func() {
+			bp := parser.New()
+			istmt, _, err := bp.ParseStmt(`SELECT ISTREAM * FROM s [RANGE 1 TUPLES] WHERE int%2=0
+				UNION ALL SELECT ISTREAM * FROM s [RANGE 1 TUPLES] WHERE int%2=1`)
+			So(err, ShouldBeNil)
+			stmt := istmt.(parser.SelectUnionStmt)
+			sn, ch, err := tb.AddSelectUnionStmt(&stmt)
+			So(err, ShouldBeNil)
+			So(addBQLToTopology(tb, `RESUME SOURCE s;`), ShouldBeNil)
+
+			Convey("Then the chan should receive all tuples", func() {
+				cnt := 0
+				for _ = range ch {
+					cnt++
+				}
+				So(cnt, ShouldEqual, 4)
+
+				Convey("And the Sink should be stopped", func() {
+					So(sn.State().Wait(core.TSStopped), ShouldEqual, core.TSStopped)
+				})
+
+				Convey("And the Sink should be removed from the topology", func() {
+					waitForExpectedCondition(func() bool {
+						_, err := dt.Sink(sn.Name())
+						return err != nil
+					})
+					_, err := dt.Sink(sn.Name())
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		unionStmt := `SELECT RSTREAM int, 1 AS b FROM s [RANGE 1 TUPLES]
+			UNION ALL SELECT RSTREAM int, 2 AS b FROM s [RANGE 1 TUPLES]
+			UNION ALL SELECT RSTREAM int, 3 AS b FROM s [RANGE 1 TUPLES] WHERE int%2=0`
+		runUnion := func(stmt string) []data.Map {
+			istmt, _, err := parser.New().ParseStmt(stmt)
+			So(err, ShouldBeNil)
+			s := istmt.(parser.SelectUnionStmt)
+			_, ch, err := tb.AddSelectUnionStmt(&s)
+			So(err, ShouldBeNil)
+			So(addBQLToTopology(tb, `RESUME SOURCE s;`), ShouldBeNil)
+
+			var res []data.Map
+			for t := range ch {
+				res = append(res, t.Data)
+			}
+			return res
+		}
+
+		Convey("When issuing an ordered SELECT ... UNION ALL stmt", func() {
+			res := runUnion(unionStmt + " ORDERED")
+
+			Convey("Then results of each input tuple should be in the order of declaration", func() {
+				var expected []data.Map
+				for i := 1; i <= 4; i++ {
+					for b := 1; b <= 3; b++ {
+						if b == 3 && i%2 != 0 {
+							continue
+						}
+						expected = append(expected, data.Map{"int": data.Int(i), "b": data.Int(b)})
+					}
+				}
+				So(res, ShouldResemble, expected)
+			})
+		})
+
+		Convey("When issuing an unordered SELECT ... UNION ALL stmt", func() {
+			res := runUnion(unionStmt + " UNORDERED")
+
+			Convey("Then the chan should receive results of all branches", func() {
+				So(len(res), ShouldEqual, 10)
+
+				Convey("And results of each branch should be in the order of inputs", func() {
+					last := map[int64]int64{}
+					for _, m := range res {
+						b, i := int64(m["b"].(data.Int)), int64(m["int"].(data.Int))
+						So(i, ShouldBeGreaterThan, last[b])
+						last[b] = i
+					}
+					So(last, ShouldResemble, map[int64]int64{1: 4, 2: 4, 3: 4})
+				})
+			})
+		})
+
+		Convey("When issuing a SELECT stmt referencing an unknown source (1)", func() {
+			bp := parser.New()
+			numNodes := len(tb.topology.Nodes())
+			istmt, _, err := bp.ParseStmt(`SELECT ISTREAM * FROM hoge [RANGE 1 TUPLES] WHERE int%2=0
+				UNION ALL SELECT ISTREAM * FROM s [RANGE 1 TUPLES] WHERE int%2=1`)
+			So(err, ShouldBeNil)
+			stmt := istmt.(parser.SelectUnionStmt)
+			_, _, err = tb.AddSelectUnionStmt(&stmt)
+			So(err, ShouldNotBeNil) // unknown data source
+			So(len(tb.topology.Nodes()), ShouldEqual, numNodes)
+		})
+
+		Convey("When issuing a SELECT stmt referencing an unknown source (2)", func() {
+			bp := parser.New()
+			numNodes := len(tb.topology.Nodes())
+			istmt, _, err := bp.ParseStmt(`SELECT ISTREAM * FROM s [RANGE 1 TUPLES] WHERE int%2=0
+				UNION ALL SELECT ISTREAM * FROM hoge [RANGE 1 TUPLES] WHERE int%2=1`)
+			So(err, ShouldBeNil)
+			stmt := istmt.(parser.SelectUnionStmt)
+			_, _, err = tb.AddSelectUnionStmt(&stmt)
+			So(err, ShouldNotBeNil) // unknown data source
+			So(len(tb.topology.Nodes()), ShouldEqual, numNodes)
+		})
+	})
+}
+
+func TestEvalStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		// foldable
+
+		Convey("When issuing an EVAL stmt with a foldable expression without ON", func() {
+			bp := parser.New()
+			istmt, _, err := bp.ParseStmt(`EVAL "日本" || (2+3)::string`)
+			So(err, ShouldBeNil)
+			stmt := istmt.(parser.EvalStmt)
+			val, err := tb.RunEvalStmt(&stmt)
+
+			Convey("Then the correct result is returned", func() {
+				So(err, ShouldBeNil)
+				So(val, ShouldResemble, data.String("日本5"))
+			})
+		})
+
+		Convey("When issuing an EVAL stmt with a foldable expression and a foldable ON expression", func() {
+			bp := parser.New()
+			istmt, _, err := bp.ParseStmt(`EVAL "日本" || (2+3)::string ON {"key": 5}`)
+			So(err, ShouldBeNil)
+			stmt := istmt.(parser.EvalStmt)
+			val, err := tb.RunEvalStmt(&stmt)
+
+			Convey("Then the correct result is returned", func() {
+				So(err, ShouldBeNil)
+				So(val, ShouldResemble, data.String("日本5"))
+			})
+		})
+
+		Convey("When issuing an EVAL stmt with a foldable expression and a non-foldable ON expression", func() {
+			bp := parser.New()
+			istmt, _, err := bp.ParseStmt(`EVAL "日本" || (2+3)::string ON {"key": a}`)
+			So(err, ShouldBeNil)
+			stmt := istmt.(parser.EvalStmt)
+			_, err = tb.RunEvalStmt(&stmt)
+
+			Convey("Then an error is returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, `the input of EVAL must be a constant, but a isn't`)
+			})
 		})
 
-		Convey("When saving a savable state with a tag", func() {
-			So(addBQLToTopology(tb, `SAVE STATE s2 TAG mytag;`), ShouldBeNil)
+		// non-foldable
 
-			Convey("Then it should be able to be loaded with that tag", func() {
-				So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds TAG mytag;`), ShouldBeNil)
+		Convey("When issuing an EVAL stmt with a non-foldable expression without ON", func() {
+			bp := parser.New()
+			istmt, _, err := bp.ParseStmt(`EVAL "日本" || key`)
+			So(err, ShouldBeNil)
+			stmt := istmt.(parser.EvalStmt)
+			_, err = tb.RunEvalStmt(&stmt)
 
-				Convey("And the state should have the correct data", func() {
-					s, err := dt.Context().SharedStates.Get("s2")
-					So(err, ShouldBeNil)
-					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
-				})
+			Convey("Then an error is returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, `an expression of EVAL without ON must be a constant, but key isn't`)
 			})
+		})
 
-			Convey("Then it should not be able to be loaded without a tag", func() {
-				So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds;`), ShouldNotBeNil)
-			})
+		Convey("When issuing an EVAL stmt with a non-foldable expression and a foldable ON expression", func() {
+			bp := parser.New()
+			istmt, _, err := bp.ParseStmt(`EVAL "日本" || key ON {"key": "5"}`)
+			So(err, ShouldBeNil)
+			stmt := istmt.(parser.EvalStmt)
+			val, err := tb.RunEvalStmt(&stmt)
 
-			Convey("And updating the state", func() {
-				So(addBQLToTopology(tb, `UPDATE STATE s2 SET num=20;`), ShouldBeNil)
-				s, err := dt.Context().SharedStates.Get("s2")
+			Convey("Then the correct result is returned", func() {
 				So(err, ShouldBeNil)
-				So(s.(*dummyUpdatableUDS).num, ShouldEqual, 20)
+				So(val, ShouldResemble, data.String("日本5"))
+			})
+		})
 
-				Convey("Then loading it should revert the state", func() {
-					So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds TAG mytag;`), ShouldBeNil)
-					s, err := dt.Context().SharedStates.Get("s2")
-					So(err, ShouldBeNil)
-					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
-				})
+		Convey("When issuing an EVAL stmt with a non-foldable expression and a non-foldable ON expression", func() {
+			bp := parser.New()
+			istmt, _, err := bp.ParseStmt(`EVAL "日本" || key ON {"key": a}`)
+			So(err, ShouldBeNil)
+			stmt := istmt.(parser.EvalStmt)
+			_, err = tb.RunEvalStmt(&stmt)
+
+			Convey("Then an error is returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, `the input of EVAL must be a constant, but a isn't`)
 			})
+		})
 
-			Convey("And dropping the state", func() {
-				So(addBQLToTopology(tb, `DROP STATE s2;`), ShouldBeNil)
+		// stream prefixes
 
-				Convey("Then it should be able to be loaded again", func() {
-					So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds TAG mytag;`), ShouldBeNil)
-					s, err := dt.Context().SharedStates.Get("s2")
-					So(err, ShouldBeNil)
-					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
-				})
+		Convey("When issuing an EVAL stmt with an expression using a stream prefix", func() {
+			bp := parser.New()
+			istmt, _, err := bp.ParseStmt(`EVAL "日本" || s:key ON {"key": "5"}`)
+			So(err, ShouldBeNil)
+			stmt := istmt.(parser.EvalStmt)
+			_, err = tb.RunEvalStmt(&stmt)
 
-				Convey("Then it should be able to be created", func() {
-					So(addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds TAG mytag OR CREATE IF NOT SAVED;`), ShouldBeNil)
-					s, err := dt.Context().SharedStates.Get("s2")
-					So(err, ShouldBeNil)
-					So(s.(*dummyUpdatableUDS).num, ShouldEqual, 2)
-				})
+			Convey("Then an error is returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "stream prefixes cannot be used inside EVAL")
 			})
 		})
+	})
+}
 
-		Convey("When saving a self loadable state", func() {
-			So(addBQLToTopology(tb, `SAVE STATE s3;`), ShouldBeNil)
+func TestStatusStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with a source, a stream, and a sink", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy;
+			CREATE STREAM t AS SELECT ISTREAM * FROM s [RANGE 1 TUPLES];
+			CREATE SINK k TYPE collector;
+			INSERT INTO k FROM t;`), ShouldBeNil)
 
-			Convey("Then it should be able to be loaded", func() {
-				So(addBQLToTopology(tb, `LOAD STATE s3 TYPE dummy_self_loadable_uds;`), ShouldBeNil)
+		runStatus := func(stmt string) (data.Map, error) {
+			istmt, _, err := parser.New().ParseStmt(stmt)
+			So(err, ShouldBeNil)
+			s := istmt.(parser.StatusStmt)
+			return tb.RunStatusStmt(&s)
+		}
 
-				Convey("And the state should have the correct data", func() {
-					s, err := dt.Context().SharedStates.Get("s3")
-					So(err, ShouldBeNil)
-					So(s.(*dummySelfLoadableUDS).num, ShouldEqual, 3)
-				})
+		Convey("When issuing STATUS OF SOURCE", func() {
+			st, err := runStatus(`STATUS OF SOURCE s`)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should return the status of the source", func() {
+				So(st["state"], ShouldEqual, data.String("paused"))
+				So(st, ShouldContainKey, "output_stats")
+				So(st, ShouldNotContainKey, "input_stats")
 			})
 		})
 
-		Convey("When saving a nonexistent state", func() {
-			err := addBQLToTopology(tb, `SAVE STATE s4;`)
+		Convey("When issuing STATUS OF STREAM", func() {
+			st, err := runStatus(`STATUS OF STREAM t`)
+			So(err, ShouldBeNil)
 
-			Convey("Then it should fail", func() {
-				So(err, ShouldNotBeNil)
+			Convey("Then it should return the status of the stream", func() {
+				So(st["state"], ShouldEqual, data.String("running"))
+				So(st, ShouldContainKey, "input_stats")
+				So(st, ShouldContainKey, "output_stats")
 			})
 		})
 
-		Convey("When loading a state which has not been saved", func() {
-			err := addBQLToTopology(tb, `LOAD STATE s2 TYPE dummy_updatable_uds;`)
+		Convey("When issuing STATUS OF SINK", func() {
+			st, err := runStatus(`STATUS OF SINK k`)
+			So(err, ShouldBeNil)
 
-			Convey("Then it should fail", func() {
-				So(err, ShouldNotBeNil)
+			Convey("Then it should return the status of the sink", func() {
+				So(st["state"], ShouldEqual, data.String("running"))
+				So(st, ShouldContainKey, "input_stats")
+				So(st, ShouldNotContainKey, "output_stats")
 			})
 		})
 
-		Convey("When loading a state which has not been created nor saved", func() {
-			err := addBQLToTopology(tb, `LOAD STATE s4 TYPE dummy_updatable_uds;`)
+		Convey("When issuing STATUS OF with a node of a different type", func() {
+			_, err := runStatus(`STATUS OF SINK s`)
 
 			Convey("Then it should fail", func() {
 				So(err, ShouldNotBeNil)
 			})
 		})
 
-		Convey("When loading a state which has not been created nor saved with LOAD OR CREATE IF NOT SAVED", func() {
-			err := addBQLToTopology(tb, `LOAD STATE s4 TYPE dummy_updatable_uds OR CREATE IF NOT SAVED WITH num=4;`)
+		Convey("When issuing STATUS OF with a nonexistent node", func() {
+			_, err := runStatus(`STATUS OF STREAM x`)
 
-			Convey("Then it should succeed", func() {
-				So(err, ShouldBeNil)
-				s, err := dt.Context().SharedStates.Get("s4")
-				So(err, ShouldBeNil)
-				So(s.(*dummyUpdatableUDS).num, ShouldEqual, 4)
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
 			})
 		})
 	})
 }
 
-func TestUpdateSourceStmt(t *testing.T) {
-	Convey("Given a BQL TopologyBuilder", t, func() {
+func TestShowAndDescribeStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with nodes and a state", t, func() {
 		dt := newTestTopology()
 		Reset(func() {
 			dt.Stop()
 		})
 		tb, err := NewTopologyBuilder(dt)
 		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy;
+			CREATE STREAM u AS SELECT ISTREAM * FROM s [RANGE 1 TUPLES];
+			CREATE STREAM t AS SELECT ISTREAM * FROM s [RANGE 1 TUPLES] UNION ALL SELECT ISTREAM * FROM u [RANGE 1 TUPLES];
+			CREATE SINK k TYPE collector;
+			INSERT INTO k FROM t;
+			CREATE STATE st TYPE dummy_uds WITH num=5;`), ShouldBeNil)
+
+		runShow := func(stmt string) ([]data.Map, error) {
+			istmt, _, err := parser.New().ParseStmt(stmt)
+			So(err, ShouldBeNil)
+			s := istmt.(parser.ShowStmt)
+			return tb.RunShowStmt(&s)
+		}
+		runDescribe := func(stmt string) (data.Map, error) {
+			istmt, _, err := parser.New().ParseStmt(stmt)
+			So(err, ShouldBeNil)
+			s := istmt.(parser.DescribeStmt)
+			return tb.RunDescribeStmt(&s)
+		}
 
-		Convey("When there is no updatable source", func() {
-			Convey("Then updating should fail", func() {
-				So(addBQLToTopology(tb, `UPDATE SOURCE hoge SET num=5;`), ShouldNotBeNil)
+		Convey("When issuing SHOW SOURCES", func() {
+			rows, err := runShow(`SHOW SOURCES`)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should return the source", func() {
+				So(len(rows), ShouldEqual, 1)
+				So(rows[0]["name"], ShouldEqual, data.String("s"))
+				So(rows[0]["type"], ShouldEqual, data.String("source"))
+				So(rows[0]["state"], ShouldEqual, data.String("paused"))
+				So(rows[0]["definition"], ShouldEqual, data.String("CREATE PAUSED SOURCE s TYPE dummy"))
 			})
 		})
 
-		Convey("Given a non-Updater source", func() {
-			So(addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy WITH num=4`), ShouldBeNil)
-
-			Convey("When updating the source", func() {
-				err := addBQLToTopology(tb, `UPDATE SOURCE hoge SET num=5;`)
+		Convey("When issuing SHOW STREAMS", func() {
+			rows, err := runShow(`SHOW STREAMS`)
+			So(err, ShouldBeNil)
 
-				Convey("There should be an error", func() {
-					So(err, ShouldNotBeNil)
-				})
+			Convey("Then it should return streams without temporary ones", func() {
+				So(len(rows), ShouldEqual, 2)
+				So(rows[0]["name"], ShouldEqual, data.String("t"))
+				So(rows[1]["name"], ShouldEqual, data.String("u"))
+				So(rows[1]["type"], ShouldEqual, data.String("stream"))
+				So(rows[1]["state"], ShouldEqual, data.String("running"))
+				So(rows[1], ShouldContainKey, "num_queued")
+				So(rows[1]["queue_size"], ShouldBeGreaterThan, data.Int(0))
 			})
 		})
 
-		Convey("Given an Updater source", func() {
-			So(addBQLToTopology(tb, `CREATE SOURCE hoge TYPE dummy_updatable WITH num=5;`), ShouldBeNil)
-
-			Convey("When updating the updatable source", func() {
-				err := addBQLToTopology(tb, `UPDATE SOURCE hoge SET num=5;`)
+		Convey("When issuing SHOW SINKS", func() {
+			rows, err := runShow(`SHOW SINKS`)
+			So(err, ShouldBeNil)
 
-				Convey("There should be no error", func() {
-					So(err, ShouldBeNil)
-				})
+			Convey("Then it should return the sink", func() {
+				So(len(rows), ShouldEqual, 1)
+				So(rows[0]["name"], ShouldEqual, data.String("k"))
+				So(rows[0]["type"], ShouldEqual, data.String("sink"))
 			})
 		})
-	})
-}
 
-func TestUpdateSinkStmt(t *testing.T) {
-	Convey("Given a BQL TopologyBuilder", t, func() {
-		dt := newTestTopology()
-		Reset(func() {
-			dt.Stop()
-		})
-		tb, err := NewTopologyBuilder(dt)
-		So(err, ShouldBeNil)
+		Convey("When issuing SHOW STATES", func() {
+			rows, err := runShow(`SHOW STATES`)
+			So(err, ShouldBeNil)
 
-		Convey("When there is no updatable sink", func() {
-			Convey("Then updating should fail", func() {
-				So(addBQLToTopology(tb, `UPDATE SINK hoge SET num=5;`), ShouldNotBeNil)
+			Convey("Then it should return the state", func() {
+				So(rows, ShouldResemble, []data.Map{{
+					"name":       data.String("st"),
+					"type":       data.String("state"),
+					"state_type": data.String("dummy_uds"),
+				}})
 			})
 		})
 
-		Convey("Given a non-Updater sink", func() {
-			So(addBQLToTopology(tb, `CREATE SINK hoge TYPE collector;`), ShouldBeNil)
-
-			Convey("When updating it", func() {
-				err := addBQLToTopology(tb, `UPDATE SINK hoge SET num=5;`)
+		Convey("When issuing DESCRIBE with a stream", func() {
+			d, err := runDescribe(`DESCRIBE u`)
+			So(err, ShouldBeNil)
 
-				Convey("There should be an error", func() {
-					So(err, ShouldNotBeNil)
-				})
+			Convey("Then it should return the detail of the stream", func() {
+				So(d["name"], ShouldEqual, data.String("u"))
+				So(d["type"], ShouldEqual, data.String("stream"))
+				So(d["definition"], ShouldEqual, data.String("CREATE STREAM u AS SELECT ISTREAM * FROM s [RANGE 1 TUPLES]"))
+				st, err := data.AsMap(d["status"])
+				So(err, ShouldBeNil)
+				So(st, ShouldContainKey, "input_stats")
 			})
 		})
 
-		Convey("Given an Updater sink", func() {
-			So(addBQLToTopology(tb, `CREATE SINK hoge TYPE collector_updatable;`), ShouldBeNil)
+		Convey("When issuing DESCRIBE with a state", func() {
+			d, err := runDescribe(`DESCRIBE st`)
+			So(err, ShouldBeNil)
 
-			Convey("When updating it", func() {
-				err := addBQLToTopology(tb, `UPDATE SINK hoge SET num=5;`)
+			Convey("Then it should return the detail of the state", func() {
+				So(d["type"], ShouldEqual, data.String("state"))
+				So(d["state_type"], ShouldEqual, data.String("dummy_uds"))
+			})
+		})
 
-				Convey("There should be no error", func() {
-					So(err, ShouldBeNil)
-				})
+		Convey("When issuing DESCRIBE with a nonexistent name", func() {
+			_, err := runDescribe(`DESCRIBE x`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(core.IsNotExist(err), ShouldBeTrue)
 			})
 		})
 	})
 }
 
-func TestSelectStmt(t *testing.T) {
-	Convey("Given a BQL TopologyBuilder with a source", t, func() {
+func TestShowUDFsAndDescribeFunctionStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with a UDF having metadata", t, func() {
 		dt := newTestTopology()
 		Reset(func() {
 			dt.Stop()
 		})
 		tb, err := NewTopologyBuilder(dt)
 		So(err, ShouldBeNil)
-		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy WITH num=4, resumable=false;`), ShouldBeNil)
-
-		Convey("When issuing a SELECT stmt", func() {
-			bp := parser.New()
-			istmt, _, err := bp.ParseStmt(`SELECT ISTREAM * FROM s [RANGE 1 TUPLES];`)
+		So(tb.Reg.RegisterWithMetadata("my_udf", udf.MustConvertGeneric(func(x int) int {
+			return x * 2
+		}), &udf.FunctionMetadata{
+			Description: "doubles the value",
+			Arguments:   []udf.ArgumentMetadata{{Name: "x", Type: "int"}},
+			ReturnType:  "int",
+		}), ShouldBeNil)
+		expected := data.Map{
+			"name":        data.String("my_udf"),
+			"description": data.String("doubles the value"),
+			"arguments": data.Array{data.Map{
+				"name": data.String("x"),
+				"type": data.String("int"),
+			}},
+			"return_type": data.String("int"),
+		}
+
+		Convey("When issuing SHOW UDFS", func() {
+			istmt, _, err := parser.New().ParseStmt(`SHOW UDFS`)
 			So(err, ShouldBeNil)
-			stmt := istmt.(parser.SelectStmt)
-			sn, ch, err := tb.AddSelectStmt(&stmt)
+			s := istmt.(parser.ShowUDFsStmt)
+			rows, err := tb.RunShowUDFsStmt(&s)
 			So(err, ShouldBeNil)
-			So(addBQLToTopology(tb, `RESUME SOURCE s;`), ShouldBeNil)
 
-			Convey("Then the chan should receive all tuples", func() {
-				cnt := 0
-				for _ = range ch {
-					cnt++
+			Convey("Then it should return all UDFs sorted by names", func() {
+				So(len(rows), ShouldBeGreaterThan, 1)
+				found := false
+				for i, r := range rows {
+					if i > 0 {
+						So(r["name"], ShouldBeGreaterThan, rows[i-1]["name"])
+					}
+					if r["name"] == data.String("my_udf") {
+						So(r, ShouldResemble, expected)
+						found = true
+					}
 				}
-				So(cnt, ShouldEqual, 4)
+				So(found, ShouldBeTrue)
+			})
+		})
 
-				Convey("And the Sink should be stopped", func() {
-					So(sn.State().Wait(core.TSStopped), ShouldEqual, core.TSStopped)
-				})
+		runDescribe := func(stmt string) (data.Map, error) {
+			istmt, _, err := parser.New().ParseStmt(stmt)
+			So(err, ShouldBeNil)
+			s := istmt.(parser.DescribeFunctionStmt)
+			return tb.RunDescribeFunctionStmt(&s)
+		}
 
-				Convey("And the Sink should eventually be removed from the topology", func() {
-					waitForExpectedCondition(func() bool {
-						_, err := dt.Sink(sn.Name())
-						return err != nil
-					})
-					_, err := dt.Sink(sn.Name())
-					So(err, ShouldNotBeNil)
-				})
+		Convey("When issuing DESCRIBE FUNCTION", func() {
+			d, err := runDescribe(`DESCRIBE FUNCTION MY_UDF`)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should return the metadata", func() {
+				So(d, ShouldResemble, expected)
 			})
 		})
 
-		Convey("When issuing a SELECT stmt referencing an unknown source", func() {
-			bp := parser.New()
-			numNodes := len(tb.topology.Nodes())
-			istmt, _, err := bp.ParseStmt(`SELECT ISTREAM * FROM hoge [RANGE 1 TUPLES];`)
-			So(err, ShouldBeNil)
-			stmt := istmt.(parser.SelectStmt)
-			_, _, err = tb.AddSelectStmt(&stmt)
-			So(err, ShouldNotBeNil) // unknown data source
-			waitForExpectedCondition(func() bool {
-				return len(tb.topology.Sinks()) == 0
+		Convey("When issuing DESCRIBE FUNCTION with a nonexistent name", func() {
+			_, err := runDescribe(`DESCRIBE FUNCTION no_such_udf`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(core.IsNotExist(err), ShouldBeTrue)
 			})
-			So(len(tb.topology.Nodes()), ShouldEqual, numNodes)
 		})
 	})
 }
 
-func TestSelectUnionStmt(t *testing.T) {
-	Convey("Given a BQL TopologyBuilder with a source", t, func() {
+func TestCreateFunctionStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder", t, func() {
 		dt := newTestTopology()
 		Reset(func() {
 			dt.Stop()
 		})
 		tb, err := NewTopologyBuilder(dt)
 		So(err, ShouldBeNil)
-		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy WITH num=4, resumable=false;`), ShouldBeNil)
 
-		Convey("When issuing a SELECT stmt", func() {
-			bp := parser.New()
-			istmt, _, err := bp.ParseStmt(`SELECT ISTREAM * FROM s [RANGE 1 TUPLES] WHERE int%2=0
-				UNION ALL SELECT ISTREAM * FROM s [RANGE 1 TUPLES] WHERE int%2=1`)
+		runEval := func(stmt string) (data.Value, error) {
+			istmt, _, err := parser.New().ParseStmt(stmt)
 			So(err, ShouldBeNil)
-			stmt := istmt.(parser.SelectUnionStmt)
-			sn, ch, err := tb.AddSelectUnionStmt(&stmt)
+			s := istmt.(parser.EvalStmt)
+			return tb.RunEvalStmt(&s)
+		}
+
+		Convey("When creating a function written in Lua", func() {
+			err := addBQLToTopology(tb, `CREATE FUNCTION weighted_sum(a, w) LANGUAGE lua AS $$
+				local s = 0; for i, v in ipairs(a) do s = s + v * w end
+				return s
+			$$; CREATE FUNCTION nargs LANGUAGE LUA AS $$ return select("#", ...) $$`)
 			So(err, ShouldBeNil)
-			So(addBQLToTopology(tb, `RESUME SOURCE s;`), ShouldBeNil)
 
-			Convey("Then the chan should receive all tuples", func() {
-				cnt := 0
-				for _ = range ch {
-					cnt++
-				}
-				So(cnt, ShouldEqual, 4)
+			Convey("Then it should be callable from BQL", func() {
+				v, err := runEval(`EVAL weighted_sum([1, 2, 3], 0.5)`)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(3))
 
-				Convey("And the Sink should be stopped", func() {
-					So(sn.State().Wait(core.TSStopped), ShouldEqual, core.TSStopped)
+				v, err = runEval(`EVAL nargs(1, 2)`)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(2))
+			})
+
+			Convey("Then it should have metadata", func() {
+				istmt, _, err := parser.New().ParseStmt(`DESCRIBE FUNCTION weighted_sum`)
+				So(err, ShouldBeNil)
+				s := istmt.(parser.DescribeFunctionStmt)
+				d, err := tb.RunDescribeFunctionStmt(&s)
+				So(err, ShouldBeNil)
+				So(d["arguments"], ShouldResemble, data.Array{
+					data.Map{"name": data.String("a"), "type": data.String("any")},
+					data.Map{"name": data.String("w"), "type": data.String("any")},
 				})
+			})
+
+			Convey("Then it should not be visible from other topologies", func() {
+				dt2 := newTestTopology()
+				defer dt2.Stop()
+				tb2, err := NewTopologyBuilder(dt2)
+				So(err, ShouldBeNil)
+				_, err = tb2.Reg.Lookup("weighted_sum", 2)
+				So(core.IsNotExist(err), ShouldBeTrue)
+			})
+
+			Convey("And creating a function having the same name again", func() {
+				err := addBQLToTopology(tb, `CREATE FUNCTION nargs() LANGUAGE lua AS $$ return 0 $$`)
 
-				Convey("And the Sink should be removed from the topology", func() {
-					waitForExpectedCondition(func() bool {
-						_, err := dt.Sink(sn.Name())
-						return err != nil
-					})
-					_, err := dt.Sink(sn.Name())
+				Convey("Then it should fail", func() {
 					So(err, ShouldNotBeNil)
 				})
 			})
 		})
 
-		Convey("When issuing a SELECT stmt referencing an unknown source (1)", func() {
-			bp := parser.New()
-			numNodes := len(tb.topology.Nodes())
-			istmt, _, err := bp.ParseStmt(`SELECT ISTREAM * FROM hoge [RANGE 1 TUPLES] WHERE int%2=0
-				UNION ALL SELECT ISTREAM * FROM s [RANGE 1 TUPLES] WHERE int%2=1`)
-			So(err, ShouldBeNil)
-			stmt := istmt.(parser.SelectUnionStmt)
-			_, _, err = tb.AddSelectUnionStmt(&stmt)
-			So(err, ShouldNotBeNil) // unknown data source
-			So(len(tb.topology.Nodes()), ShouldEqual, numNodes)
+		Convey("When creating a function in an unsupported language", func() {
+			err := addBQLToTopology(tb, `CREATE FUNCTION f() LANGUAGE cobol AS $$ $$`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "cobol")
+			})
 		})
 
-		Convey("When issuing a SELECT stmt referencing an unknown source (2)", func() {
-			bp := parser.New()
-			numNodes := len(tb.topology.Nodes())
-			istmt, _, err := bp.ParseStmt(`SELECT ISTREAM * FROM s [RANGE 1 TUPLES] WHERE int%2=0
-				UNION ALL SELECT ISTREAM * FROM hoge [RANGE 1 TUPLES] WHERE int%2=1`)
-			So(err, ShouldBeNil)
-			stmt := istmt.(parser.SelectUnionStmt)
-			_, _, err = tb.AddSelectUnionStmt(&stmt)
-			So(err, ShouldNotBeNil) // unknown data source
-			So(len(tb.topology.Nodes()), ShouldEqual, numNodes)
+		Convey("When creating a function having a syntax error", func() {
+			err := addBQLToTopology(tb, `CREATE FUNCTION f() LANGUAGE lua AS $$ return + $$`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("And the function should not be registered", func() {
+				_, err := tb.Reg.Lookup("f", 0)
+				So(core.IsNotExist(err), ShouldBeTrue)
+			})
 		})
 	})
 }
 
-func TestEvalStmt(t *testing.T) {
+func init() {
+	// test_remote creates a function adding offset given in WITH clause
+	udf.MustRegisterGlobalUDFCreator("test_remote", udf.UDFCreatorFunc(
+		func(ctx *core.Context, params data.Map) (udf.UDF, error) {
+			v, ok := params["offset"]
+			if !ok {
+				return nil, errors.New("offset is missing")
+			}
+			offset, err := data.AsInt(v)
+			if err != nil {
+				return nil, err
+			}
+			return udf.ConvertGeneric(func(x int64) int64 {
+				return x + offset
+			})
+		}))
+}
+
+func TestCreateRemoteFunctionStmt(t *testing.T) {
 	Convey("Given a BQL TopologyBuilder", t, func() {
 		dt := newTestTopology()
 		Reset(func() {
@@ -934,100 +2824,108 @@ func TestEvalStmt(t *testing.T) {
 		tb, err := NewTopologyBuilder(dt)
 		So(err, ShouldBeNil)
 
-		// foldable
-
-		Convey("When issuing an EVAL stmt with a foldable expression without ON", func() {
-			bp := parser.New()
-			istmt, _, err := bp.ParseStmt(`EVAL "日本" || (2+3)::string`)
+		Convey("When creating a function of a registered type", func() {
+			err := addBQLToTopology(tb, `CREATE FUNCTION add_offset TYPE TEST_REMOTE WITH offset=3`)
 			So(err, ShouldBeNil)
-			stmt := istmt.(parser.EvalStmt)
-			val, err := tb.RunEvalStmt(&stmt)
 
-			Convey("Then the correct result is returned", func() {
+			Convey("Then it should be callable from BQL", func() {
+				istmt, _, err := parser.New().ParseStmt(`EVAL add_offset(2)`)
 				So(err, ShouldBeNil)
-				So(val, ShouldResemble, data.String("日本5"))
+				s := istmt.(parser.EvalStmt)
+				v, err := tb.RunEvalStmt(&s)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(5))
 			})
-		})
-
-		Convey("When issuing an EVAL stmt with a foldable expression and a foldable ON expression", func() {
-			bp := parser.New()
-			istmt, _, err := bp.ParseStmt(`EVAL "日本" || (2+3)::string ON {"key": 5}`)
-			So(err, ShouldBeNil)
-			stmt := istmt.(parser.EvalStmt)
-			val, err := tb.RunEvalStmt(&stmt)
 
-			Convey("Then the correct result is returned", func() {
+			Convey("Then it should have metadata", func() {
+				istmt, _, err := parser.New().ParseStmt(`DESCRIBE FUNCTION add_offset`)
 				So(err, ShouldBeNil)
-				So(val, ShouldResemble, data.String("日本5"))
+				s := istmt.(parser.DescribeFunctionStmt)
+				d, err := tb.RunDescribeFunctionStmt(&s)
+				So(err, ShouldBeNil)
+				So(d["description"], ShouldEqual, data.String("A function of type test_remote."))
+			})
+
+			Convey("And creating a function having the same name again", func() {
+				err := addBQLToTopology(tb, `CREATE FUNCTION add_offset TYPE test_remote WITH offset=1`)
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
 			})
 		})
 
-		Convey("When issuing an EVAL stmt with a foldable expression and a non-foldable ON expression", func() {
-			bp := parser.New()
-			istmt, _, err := bp.ParseStmt(`EVAL "日本" || (2+3)::string ON {"key": a}`)
-			So(err, ShouldBeNil)
-			stmt := istmt.(parser.EvalStmt)
-			_, err = tb.RunEvalStmt(&stmt)
+		Convey("When creating a function of an unregistered type", func() {
+			err := addBQLToTopology(tb, `CREATE FUNCTION f TYPE no_such_type`)
 
-			Convey("Then an error is returned", func() {
+			Convey("Then it should fail", func() {
 				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldEqual, `expression is not foldable: {"key":a}`)
+				So(err.Error(), ShouldContainSubstring, "no_such_type")
 			})
 		})
 
-		// non-foldable
-
-		Convey("When issuing an EVAL stmt with a non-foldable expression without ON", func() {
-			bp := parser.New()
-			istmt, _, err := bp.ParseStmt(`EVAL "日本" || key`)
-			So(err, ShouldBeNil)
-			stmt := istmt.(parser.EvalStmt)
-			_, err = tb.RunEvalStmt(&stmt)
+		Convey("When creating a function with invalid parameters", func() {
+			err := addBQLToTopology(tb, `CREATE FUNCTION f TYPE test_remote`)
 
-			Convey("Then an error is returned", func() {
+			Convey("Then it should fail", func() {
 				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldEqual, `expression is not foldable: "日本" || key`)
+			})
+
+			Convey("And the function should not be registered", func() {
+				_, err := tb.Reg.Lookup("f", 1)
+				So(core.IsNotExist(err), ShouldBeTrue)
 			})
 		})
+	})
+}
 
-		Convey("When issuing an EVAL stmt with a non-foldable expression and a foldable ON expression", func() {
-			bp := parser.New()
-			istmt, _, err := bp.ParseStmt(`EVAL "日本" || key ON {"key": "5"}`)
+func TestExplainStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		runExplain := func(stmt string) (data.Map, error) {
+			istmt, _, err := parser.New().ParseStmt(stmt)
 			So(err, ShouldBeNil)
-			stmt := istmt.(parser.EvalStmt)
-			val, err := tb.RunEvalStmt(&stmt)
+			s := istmt.(parser.ExplainStmt)
+			return tb.RunExplainStmt(&s)
+		}
 
-			Convey("Then the correct result is returned", func() {
-				So(err, ShouldBeNil)
-				So(val, ShouldResemble, data.String("日本5"))
+		Convey("When explaining a SELECT statement", func() {
+			m, err := runExplain(`EXPLAIN SELECT ISTREAM a, count(*) FROM s [RANGE 2 SECONDS] GROUP BY a`)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should describe the plan without creating nodes", func() {
+				So(m["plan"], ShouldEqual, data.String("groupby"))
+				So(m["join_order"], ShouldResemble, data.Array{data.String("s")})
+				So(m, ShouldNotContainKey, "with")
+				So(dt.Nodes(), ShouldBeEmpty)
 			})
 		})
 
-		Convey("When issuing an EVAL stmt with a non-foldable expression and a non-foldable ON expression", func() {
-			bp := parser.New()
-			istmt, _, err := bp.ParseStmt(`EVAL "日本" || key ON {"key": a}`)
+		Convey("When explaining a SELECT statement with a WITH clause", func() {
+			m, err := runExplain(`EXPLAIN WITH a AS (SELECT RSTREAM x FROM s [RANGE 1 TUPLES])
+				SELECT ISTREAM x FROM a [RANGE 3 TUPLES]`)
 			So(err, ShouldBeNil)
-			stmt := istmt.(parser.EvalStmt)
-			_, err = tb.RunEvalStmt(&stmt)
 
-			Convey("Then an error is returned", func() {
-				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldEqual, `expression is not foldable: {"key":a}`)
+			Convey("Then it should also describe the named statement", func() {
+				So(m["plan"], ShouldEqual, data.String("default"))
+				with := m["with"].(data.Array)
+				So(len(with), ShouldEqual, 1)
+				So(with[0].(data.Map)["name"], ShouldEqual, data.String("a"))
+				So(with[0].(data.Map)["plan"].(data.Map)["plan"], ShouldEqual, data.String("filter"))
 			})
 		})
 
-		// stream prefixes
-
-		Convey("When issuing an EVAL stmt with an expression using a stream prefix", func() {
-			bp := parser.New()
-			istmt, _, err := bp.ParseStmt(`EVAL "日本" || s:key ON {"key": "5"}`)
-			So(err, ShouldBeNil)
-			stmt := istmt.(parser.EvalStmt)
-			_, err = tb.RunEvalStmt(&stmt)
+		Convey("When explaining an invalid SELECT statement", func() {
+			_, err := runExplain(`EXPLAIN SELECT ISTREAM a, count(*) FROM s [RANGE 2 SECONDS]`)
 
-			Convey("Then an error is returned", func() {
+			Convey("Then it should fail", func() {
 				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldEqual, "stream prefixes cannot be used inside EVAL")
 			})
 		})
 	})
@@ -1046,6 +2944,10 @@ func TestDropSourceStmt(t *testing.T) {
 			Convey("Then dropping should fail", func() {
 				So(addBQLToTopology(tb, `DROP SOURCE hoge;`), ShouldNotBeNil)
 			})
+
+			Convey("Then dropping with IF EXISTS should succeed", func() {
+				So(addBQLToTopology(tb, `DROP SOURCE hoge IF EXISTS;`), ShouldBeNil)
+			})
 		})
 
 		Convey("When adding a source", func() {
@@ -1087,6 +2989,117 @@ func TestDropStreamStmt(t *testing.T) {
 				So(addBQLToTopology(tb, `DROP STREAM t;`), ShouldBeNil)
 			})
 		})
+
+		Convey("When dropping a missing stream with IF EXISTS", func() {
+			err := addBQLToTopology(tb, `DROP STREAM t IF EXISTS CASCADE;`)
+
+			Convey("Then there should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When there are dependent streams and sinks", func() {
+			So(addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 1 TUPLES];
+				CREATE STREAM u AS SELECT ISTREAM int FROM t [RANGE 1 TUPLES];
+				CREATE STREAM v AS SELECT ISTREAM t:int FROM t [RANGE 1 TUPLES], u [RANGE 1 TUPLES];
+				CREATE STREAM w AS SELECT ISTREAM int FROM s [RANGE 1 TUPLES];
+				CREATE SINK k TYPE collector;
+				INSERT INTO k FROM v;
+				CREATE SINK k2 TYPE collector;
+				INSERT INTO k2 FROM w;`), ShouldBeNil)
+
+			Convey("Then dropping the stream with CASCADE should remove all dependents", func() {
+				So(addBQLToTopology(tb, `DROP STREAM t CASCADE;`), ShouldBeNil)
+				nodes := tb.topology.Nodes()
+				So(len(nodes), ShouldEqual, 3)
+				for _, n := range []string{"s", "w", "k2"} {
+					_, ok := nodes[n]
+					So(ok, ShouldBeTrue)
+				}
+			})
+
+			Convey("Then dropping the source with CASCADE should remove everything", func() {
+				So(addBQLToTopology(tb, `DROP SOURCE s CASCADE;`), ShouldBeNil)
+				So(tb.topology.Nodes(), ShouldBeEmpty)
+			})
+
+			Convey("Then dropping the stream without CASCADE should only remove it", func() {
+				So(addBQLToTopology(tb, `DROP STREAM w;`), ShouldBeNil)
+				_, err := tb.topology.Sink("k2")
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestAlterStreamStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with a stream", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy WITH num=10000;
+			CREATE STREAM t AS SELECT RSTREAM * FROM s [RANGE 1 TUPLES];
+			CREATE SINK snk TYPE collector;
+			INSERT INTO snk FROM t;`), ShouldBeNil)
+
+		sin, err := dt.Sink("snk")
+		So(err, ShouldBeNil)
+		si := sin.Sink().(*tupleCollectorSink)
+
+		inputStatus := func() data.Map {
+			bn, err := dt.Box("t")
+			So(err, ShouldBeNil)
+			v, err := bn.Status().Get(data.MustCompilePath("input_stats.inputs.s"))
+			So(err, ShouldBeNil)
+			m, err := data.AsMap(v)
+			So(err, ShouldBeNil)
+			return m
+		}
+
+		Convey("When altering a nonexistent stream", func() {
+			err := addBQLToTopology(tb, `ALTER STREAM u SET BUFFER SIZE 16`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When altering a source", func() {
+			err := addBQLToTopology(tb, `ALTER STREAM s SET BUFFER SIZE 16`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When altering the stream while the source is emitting tuples", func() {
+			So(addBQLToTopology(tb, `RESUME SOURCE s`), ShouldBeNil)
+			So(addBQLToTopology(tb, `ALTER STREAM t SET BUFFER SIZE 16, WAIT IF FULL`), ShouldBeNil)
+
+			Convey("Then the input should have the new capacity and drop mode", func() {
+				st := inputStatus()
+				So(st["queue_size"], ShouldEqual, data.Int(16))
+				So(st["drop_mode"], ShouldEqual, data.String("none"))
+			})
+
+			Convey("Then the sink should receive all tuples", func() {
+				si.Wait(10000)
+				So(si.len(), ShouldEqual, 10000)
+			})
+		})
+
+		Convey("When altering only the shedding option", func() {
+			So(addBQLToTopology(tb, `ALTER STREAM t SET DROP OLDEST IF FULL`), ShouldBeNil)
+
+			Convey("Then only the drop mode of the input should be changed", func() {
+				st := inputStatus()
+				So(st["queue_size"], ShouldEqual, data.Int(1024))
+				So(st["drop_mode"], ShouldEqual, data.String("oldest"))
+			})
+		})
 	})
 }
 
@@ -1129,6 +3142,10 @@ func TestDropStateStmt(t *testing.T) {
 			Convey("Then dropping should fail", func() {
 				So(addBQLToTopology(tb, `DROP STATE hoge;`), ShouldNotBeNil)
 			})
+
+			Convey("Then dropping with IF EXISTS should succeed", func() {
+				So(addBQLToTopology(tb, `DROP STATE hoge IF EXISTS;`), ShouldBeNil)
+			})
 		})
 
 		Convey("When adding an UDS", func() {
@@ -1141,6 +3158,145 @@ func TestDropStateStmt(t *testing.T) {
 	})
 }
 
+func TestAddPreparedStmt(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with source", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		err = addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy`)
+		So(err, ShouldBeNil)
+		ps, err := parser.New().Prepare(
+			`CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 2 SECONDS] WHERE int > $min`)
+		So(err, ShouldBeNil)
+
+		Convey("When adding the prepared statement with parameters", func() {
+			_, err := tb.AddPreparedStmt(ps, data.Map{"min": data.Int(2)})
+
+			Convey("Then the stream should be created", func() {
+				So(err, ShouldBeNil)
+				_, err := tb.topology.Box("t")
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When adding the prepared statement without parameters", func() {
+			_, err := tb.AddPreparedStmt(ps, nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				_, err := tb.topology.Box("t")
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When adding a statement having an unbound placeholder", func() {
+			err := addBQLToTopology(tb, `CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 2 SECONDS] WHERE int > $min`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "not bound")
+			})
+		})
+	})
+}
+
+func TestAddStmtsAtomically(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder with source, stream, and sink", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+		So(addBQLToTopology(tb, `CREATE PAUSED SOURCE s TYPE dummy;
+			CREATE STREAM x AS SELECT ISTREAM int FROM s [RANGE 1 TUPLES];
+			CREATE SINK k TYPE collector;`), ShouldBeNil)
+		prevNodes := len(tb.topology.Nodes())
+		ctx := tb.topology.Context()
+
+		addStmts := func(bql string) ([]core.Node, error) {
+			stmts, err := parser.New().ParseStmts(bql)
+			So(err, ShouldBeNil)
+			return tb.AddStmtsAtomically(stmts)
+		}
+
+		Convey("When adding valid statements atomically", func() {
+			nodes, err := addStmts(`CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 1 TUPLES];
+				CREATE STATE st TYPE dummy_uds WITH num=5;
+				CREATE SINK k2 TYPE collector;
+				INSERT INTO k2 FROM t;
+				INSERT INTO k FROM t;
+				DROP STREAM x;`)
+
+			Convey("Then all of them should be applied", func() {
+				So(err, ShouldBeNil)
+				So(len(nodes), ShouldEqual, 6)
+				So(nodes[0].Name(), ShouldEqual, "t")
+				So(nodes[1], ShouldBeNil)
+				So(nodes[2].Name(), ShouldEqual, "k2")
+				_, err := ctx.SharedStates.Get("st")
+				So(err, ShouldBeNil)
+				_, err = tb.topology.Box("x")
+				So(err, ShouldNotBeNil)
+				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes+1)
+			})
+		})
+
+		Convey("When one of the statements fails", func() {
+			_, err := addStmts(`CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 1 TUPLES];
+				CREATE STATE st TYPE dummy_uds WITH num=5;
+				DROP STREAM x;
+				INSERT INTO k FROM t;
+				CREATE STREAM u AS SELECT ISTREAM int FROM no_such_stream [RANGE 1 TUPLES];`)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Then the preceding statements should be rolled back", func() {
+				_, err := tb.topology.Box("t")
+				So(err, ShouldNotBeNil)
+				_, err = ctx.SharedStates.Get("st")
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Then deferred statements shouldn't be applied", func() {
+				_, err := tb.topology.Box("x")
+				So(err, ShouldBeNil)
+				So(len(tb.topology.Nodes()), ShouldEqual, prevNodes)
+			})
+		})
+
+		Convey("When a deferred statement refers to a missing node", func() {
+			_, err := addStmts(`CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 1 TUPLES];
+				DROP STREAM x;
+				DROP SINK no_such_sink;`)
+
+			Convey("Then it should fail without applying any statement", func() {
+				So(err, ShouldNotBeNil)
+				_, err := tb.topology.Box("t")
+				So(err, ShouldNotBeNil)
+				_, err = tb.topology.Box("x")
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When adding a statement which cannot be rolled back", func() {
+			_, err := addStmts(`CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 1 TUPLES];
+				RESUME SOURCE s;`)
+
+			Convey("Then it should fail without applying any statement", func() {
+				So(err, ShouldNotBeNil)
+				_, err := tb.topology.Box("t")
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
 func waitForExpectedCondition(f func() bool) {
 	for !f() {
 		time.Sleep(time.Nanosecond)
@@ -0,0 +1,127 @@
+package bql
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+)
+
+// tupleTemplatePart is a part of a tupleTemplate. It's either a literal
+// string or a value of a tuple.
+type tupleTemplatePart struct {
+	literal string
+
+	// path is the path of the value. When both path and timestamp are
+	// unset, the part is a literal.
+	path data.Path
+
+	// timestamp is true when the part refers to the timestamp of a tuple.
+	timestamp bool
+
+	// layout is a layout of time.Format used to format the value as a
+	// timestamp.
+	layout string
+}
+
+// tupleTemplate is a template of a string such as an index name or a routing
+// key created from each tuple written to a sink. "{path}" in a template is
+// replaced with the value of the path in a tuple and "{path:layout}" is
+// replaced with the value formatted as a timestamp in UTC with the layout of
+// time.Format. "@timestamp" refers to the timestamp of the tuple.
+type tupleTemplate struct {
+	// name is the name of the parameter having the template. It's used in
+	// error messages.
+	name  string
+	parts []tupleTemplatePart
+}
+
+func parseTupleTemplate(name, s string) (*tupleTemplate, error) {
+	t := &tupleTemplate{name: name}
+	src := s
+	for len(s) > 0 {
+		i := strings.IndexAny(s, "{}")
+		if i < 0 {
+			t.parts = append(t.parts, tupleTemplatePart{literal: s})
+			break
+		}
+		if s[i] == '}' {
+			return nil, fmt.Errorf("unmatched '}' in %v: %v", name, src)
+		}
+		if i > 0 {
+			t.parts = append(t.parts, tupleTemplatePart{literal: s[:i]})
+		}
+		s = s[i+1:]
+
+		j := strings.IndexByte(s, '}')
+		if j < 0 {
+			return nil, fmt.Errorf("'{' in %v isn't closed: %v", name, src)
+		}
+		p, err := t.parsePart(s[:j])
+		if err != nil {
+			return nil, err
+		}
+		t.parts = append(t.parts, p)
+		s = s[j+1:]
+	}
+	return t, nil
+}
+
+func (t *tupleTemplate) parsePart(s string) (tupleTemplatePart, error) {
+	p := tupleTemplatePart{}
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		p.layout = s[i+1:]
+		s = s[:i]
+		if p.layout == "" {
+			return p, fmt.Errorf("the layout of {%v} in %v is empty", s, t.name)
+		}
+	}
+	if s == "@timestamp" {
+		p.timestamp = true
+		if p.layout == "" {
+			return p, fmt.Errorf("{@timestamp} in %v must have a layout", t.name)
+		}
+		return p, nil
+	}
+	path, err := data.CompilePath(s)
+	if err != nil {
+		return p, fmt.Errorf("{%v} in %v has an invalid path: %v", s, t.name, err)
+	}
+	p.path = path
+	return p, nil
+}
+
+// render creates a string from the tuple.
+func (t *tupleTemplate) render(tuple *core.Tuple) (string, error) {
+	b := bytes.NewBuffer(nil)
+	for _, p := range t.parts {
+		if p.timestamp {
+			b.WriteString(tuple.Timestamp.UTC().Format(p.layout))
+			continue
+		}
+		if p.path == nil {
+			b.WriteString(p.literal)
+			continue
+		}
+
+		v, err := tuple.Data.Get(p.path)
+		if err != nil {
+			return "", fmt.Errorf("the tuple doesn't have a value for %v: %v", t.name, err)
+		}
+		if p.layout != "" {
+			ts, err := data.ToTimestamp(v)
+			if err != nil {
+				return "", fmt.Errorf("the value for %v isn't a timestamp: %v", t.name, err)
+			}
+			b.WriteString(ts.UTC().Format(p.layout))
+			continue
+		}
+		s, err := data.ToString(v)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s)
+	}
+	return b.String(), nil
+}
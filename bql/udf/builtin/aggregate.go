@@ -35,6 +35,156 @@ func (f *singleParamAggFunc) Call(ctx *core.Context, args ...data.Value) (data.V
 	return f.aggFun(arr)
 }
 
+// mergeableAggFunc is a singleParamAggFunc whose result can also be
+// computed by merging partial states computed from chunks of the input.
+type mergeableAggFunc struct {
+	singleParamAggFunc
+	// partial computes the partial state of a chunk. aggFun is used when
+	// it's nil.
+	partial func([]data.Value) (data.Value, error)
+	// combine merges two partial states. aggFun is applied to both states
+	// when it's nil.
+	combine func(a, b data.Value) (data.Value, error)
+	// final computes the result from a partial state. The partial state is
+	// the result itself when it's nil.
+	final func(data.Value) (data.Value, error)
+}
+
+func (f *mergeableAggFunc) Partial(ctx *core.Context, values data.Array) (data.Value, error) {
+	if f.partial == nil {
+		return f.aggFun(values)
+	}
+	return f.partial(values)
+}
+
+func (f *mergeableAggFunc) Combine(ctx *core.Context, a, b data.Value) (data.Value, error) {
+	if f.combine == nil {
+		return f.aggFun([]data.Value{a, b})
+	}
+	return f.combine(a, b)
+}
+
+func (f *mergeableAggFunc) Final(ctx *core.Context, state data.Value) (data.Value, error) {
+	if f.final == nil {
+		return state, nil
+	}
+	return f.final(state)
+}
+
+// incrementalAggFunc is a mergeableAggFunc whose result can also be
+// computed incrementally by udf.Accumulators.
+type incrementalAggFunc struct {
+	mergeableAggFunc
+	newAccumulator func() udf.Accumulator
+}
+
+func (f *incrementalAggFunc) NewAccumulator(ctx *core.Context) (udf.Accumulator, error) {
+	return f.newAccumulator(), nil
+}
+
+// numericAccumulator computes the sum or, when avg is true, the average
+// of numeric values incrementally for sumFunc and avgFunc. Non-numeric
+// values are kept so that Result fails as long as any of them is held,
+// in the same way as the functions computing the result from all values.
+type numericAccumulator struct {
+	avg bool
+	// count is the number of non-null numeric values and numFloats is
+	// the number of Float values among them.
+	count     int64
+	numFloats int64
+	intSum    int64
+	floatSum  float64
+	invalid   []data.Value
+}
+
+func (a *numericAccumulator) Add(v data.Value) error {
+	switch v.Type() {
+	case data.TypeInt:
+		i, _ := data.AsInt(v)
+		// an overflow is fixed by later operations as in sumFunc
+		a.intSum += i
+	case data.TypeFloat:
+		f, _ := data.AsFloat(v)
+		a.floatSum += f
+		a.numFloats++
+	case data.TypeNull:
+		return nil
+	default:
+		a.invalid = append(a.invalid, v)
+		return nil
+	}
+	a.count++
+	return nil
+}
+
+func (a *numericAccumulator) Remove(v data.Value) error {
+	switch v.Type() {
+	case data.TypeInt:
+		i, _ := data.AsInt(v)
+		a.intSum -= i
+	case data.TypeFloat:
+		f, _ := data.AsFloat(v)
+		a.floatSum -= f
+		a.numFloats--
+		if a.numFloats == 0 {
+			// drop the rounding error accumulated by subtractions
+			a.floatSum = 0
+		}
+	case data.TypeNull:
+		return nil
+	default:
+		for i, x := range a.invalid {
+			if data.Equal(x, v) {
+				a.invalid = append(a.invalid[:i], a.invalid[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("%s (%T) hasn't been added", v, v)
+	}
+	a.count--
+	return nil
+}
+
+func (a *numericAccumulator) Result() (data.Value, error) {
+	if len(a.invalid) > 0 {
+		v := a.invalid[0]
+		return nil, fmt.Errorf("cannot interpret %s (%T) as a number", v, v)
+	}
+	if a.count == 0 {
+		// empty input or only null inputs
+		return data.Null{}, nil
+	}
+	sum := float64(a.intSum) + a.floatSum
+	if a.avg {
+		return data.Float(sum / float64(a.count)), nil
+	}
+	if a.numFloats == 0 {
+		return data.Int(a.intSum), nil
+	}
+	return data.Float(sum), nil
+}
+
+// avgState returns the sum and the number of values in a partial state of
+// avgFunc.
+func avgState(state data.Value) (float64, int64, error) {
+	arr, err := data.AsArray(state)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(arr) != 2 {
+		return 0, 0, fmt.Errorf("invalid partial state of avg: %v", state)
+	}
+	sum, err := data.AsFloat(arr[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	count, err := data.AsInt(arr[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return sum, count, nil
+}
+
 // twoParamAggFunc is a template for aggregate functions that
 // have exactly two (aggregation) parameters
 type twoParamAggFunc struct {
@@ -71,19 +221,60 @@ func (f *twoParamAggFunc) Call(ctx *core.Context, args ...data.Value) (data.Valu
 //
 //  Input: anything (aggregated)
 //  Return Type: Int
-var countFunc udf.UDF = &singleParamAggFunc{
-	aggFun: func(arr []data.Value) (data.Value, error) {
-		// count() is O(n) in the spirit of PostgreSQL
-		c := int64(0)
-		for _, item := range arr {
-			if item.Type() != data.TypeNull {
-				c++
+var countFunc udf.UDF = &incrementalAggFunc{
+	mergeableAggFunc: mergeableAggFunc{
+		singleParamAggFunc: singleParamAggFunc{
+			aggFun: func(arr []data.Value) (data.Value, error) {
+				// count() is O(n) in the spirit of PostgreSQL
+				c := int64(0)
+				for _, item := range arr {
+					if item.Type() != data.TypeNull {
+						c++
+					}
+				}
+				return data.Int(c), nil
+			},
+		},
+		combine: func(a, b data.Value) (data.Value, error) {
+			ca, err := data.AsInt(a)
+			if err != nil {
+				return nil, err
 			}
-		}
-		return data.Int(c), nil
+			cb, err := data.AsInt(b)
+			if err != nil {
+				return nil, err
+			}
+			return data.Int(ca + cb), nil
+		},
+	},
+	newAccumulator: func() udf.Accumulator {
+		return &countAccumulator{}
 	},
 }
 
+// countAccumulator counts non-null values incrementally for countFunc.
+type countAccumulator struct {
+	count int64
+}
+
+func (a *countAccumulator) Add(v data.Value) error {
+	if v.Type() != data.TypeNull {
+		a.count++
+	}
+	return nil
+}
+
+func (a *countAccumulator) Remove(v data.Value) error {
+	if v.Type() != data.TypeNull {
+		a.count--
+	}
+	return nil
+}
+
+func (a *countAccumulator) Result() (data.Value, error) {
+	return data.Int(a.count), nil
+}
+
 // arrayAggFunc is an aggregate function that concatenates
 // input values (including nulls), into an array.
 //
@@ -108,34 +299,77 @@ var arrayAggFunc udf.UDF = &singleParamAggFunc{
 //
 //  Input: Int or Float (aggregated)
 //  Return Type: Float (Null on empty input)
-var avgFunc udf.UDF = &singleParamAggFunc{
-	aggFun: func(arr []data.Value) (data.Value, error) {
-		if len(arr) == 0 {
-			return data.Null{}, nil
-		}
-		sum := float64(0.0)
-		count := int64(0)
-		for _, item := range arr {
-			if item.Type() == data.TypeInt {
-				i, _ := data.AsInt(item)
-				sum += float64(i)
-				count++
-			} else if item.Type() == data.TypeFloat {
-				f, _ := data.AsFloat(item)
-				sum += f
-				count++
-			} else if item.Type() == data.TypeNull {
-				continue
-			} else {
+var avgFunc udf.UDF = &incrementalAggFunc{
+	mergeableAggFunc: mergeableAggFunc{
+		singleParamAggFunc: singleParamAggFunc{
+			aggFun: func(arr []data.Value) (data.Value, error) {
+				if len(arr) == 0 {
+					return data.Null{}, nil
+				}
+				sum := float64(0.0)
+				count := int64(0)
+				for _, item := range arr {
+					if item.Type() == data.TypeInt {
+						i, _ := data.AsInt(item)
+						sum += float64(i)
+						count++
+					} else if item.Type() == data.TypeFloat {
+						f, _ := data.AsFloat(item)
+						sum += f
+						count++
+					} else if item.Type() == data.TypeNull {
+						continue
+					} else {
+						return nil, fmt.Errorf("cannot interpret %s (%T) as a number",
+							item, item)
+					}
+				}
+				if count == 0 {
+					// only null inputs
+					return data.Null{}, nil
+				}
+				return data.Float(sum / float64(count)), nil
+			},
+		},
+		// the partial state is an array of the sum and the number of non-null
+		// values
+		partial: func(arr []data.Value) (data.Value, error) {
+			a := &numericAccumulator{}
+			for _, item := range arr {
+				a.Add(item)
+			}
+			if len(a.invalid) > 0 {
+				item := a.invalid[0]
 				return nil, fmt.Errorf("cannot interpret %s (%T) as a number",
 					item, item)
 			}
-		}
-		if count == 0 {
-			// only null inputs
-			return data.Null{}, nil
-		}
-		return data.Float(sum / float64(count)), nil
+			return data.Array{data.Float(float64(a.intSum) + a.floatSum), data.Int(a.count)}, nil
+		},
+		combine: func(a, b data.Value) (data.Value, error) {
+			sa, ca, err := avgState(a)
+			if err != nil {
+				return nil, err
+			}
+			sb, cb, err := avgState(b)
+			if err != nil {
+				return nil, err
+			}
+			return data.Array{data.Float(sa + sb), data.Int(ca + cb)}, nil
+		},
+		final: func(state data.Value) (data.Value, error) {
+			sum, count, err := avgState(state)
+			if err != nil {
+				return nil, err
+			}
+			if count == 0 {
+				// empty input or only null inputs
+				return data.Null{}, nil
+			}
+			return data.Float(sum / float64(count)), nil
+		},
+	},
+	newAccumulator: func() udf.Accumulator {
+		return &numericAccumulator{avg: true}
 	},
 }
 
@@ -187,46 +421,196 @@ var medianFunc udf.UDF = &singleParamAggFunc{
 	},
 }
 
-// skipping bit_and and bit_or here since they are quite low-level
+// numericItem is a non-null numeric input value of an aggregate function
+// with its float representation.
+type numericItem struct {
+	value data.Value
+	f     float64
+}
 
-// boolAndFunc is an aggregate function that returns true if
-// all input values are true, false otherwise. Null values are
-// ignored, non-boolean values lead to an error.
+type numericItems []numericItem
+
+func (n numericItems) Len() int           { return len(n) }
+func (n numericItems) Less(i, j int) bool { return n[i].f < n[j].f }
+func (n numericItems) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+
+// sortedNumericItems collects all non-null numeric values in arr and
+// returns them in ascending order. Non-numeric values lead to an error.
+func sortedNumericItems(arr []data.Value) (numericItems, error) {
+	items := make(numericItems, 0, len(arr))
+	for _, item := range arr {
+		if item.Type() == data.TypeInt {
+			i, _ := data.AsInt(item)
+			items = append(items, numericItem{item, float64(i)})
+		} else if item.Type() == data.TypeFloat {
+			f, _ := data.AsFloat(item)
+			items = append(items, numericItem{item, f})
+		} else if item.Type() == data.TypeNull {
+			continue
+		} else {
+			return nil, fmt.Errorf("cannot interpret %s (%T) as a number",
+				item, item)
+		}
+	}
+	sort.Stable(items)
+	return items, nil
+}
+
+func checkFraction(p float64) error {
+	if math.IsNaN(p) || p < 0 || p > 1 {
+		return fmt.Errorf("percentile must be between 0 and 1: %v", p)
+	}
+	return nil
+}
+
+// percentileContFunc(expr, p) is an aggregate function that computes
+// the value at the given fraction p (0 <= p <= 1) of all input values,
+// interpolating between adjacent input values if needed. Null values
+// are ignored, non-numeric values lead to an error.
 //
-// It can be used in BQL as `bool_and`.
+// It can be used in BQL as `percentile_cont`.
 //
-//  Input: Bool (aggregated)
-//  Return Type: Bool (Null on empty input)
-var boolAndFunc udf.UDF = &singleParamAggFunc{
-	aggFun: func(arr []data.Value) (data.Value, error) {
-		if len(arr) == 0 {
+//  Input: Int or Float (aggregated), Float
+//  Return Type: Float (Null on empty input)
+var percentileContFunc = udf.MustConvertGenericAggregate(
+	func(arr []data.Value, p float64) (data.Value, error) {
+		if err := checkFraction(p); err != nil {
+			return nil, err
+		}
+		items, err := sortedNumericItems(arr)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) == 0 {
 			return data.Null{}, nil
 		}
-		result := true
-		onlyNulls := true
+		pos := p * float64(len(items)-1)
+		lower := int(math.Floor(pos))
+		if lower == len(items)-1 {
+			return data.Float(items[lower].f), nil
+		}
+		frac := pos - float64(lower)
+		return data.Float(items[lower].f +
+			frac*(items[lower+1].f-items[lower].f)), nil
+	}, []bool{true, false})
+
+// percentileDiscFunc(expr, p) is an aggregate function that returns
+// the first input value whose position in the sorted input values is
+// equal to or greater than the given fraction p (0 <= p <= 1). Null
+// values are ignored, non-numeric values lead to an error.
+//
+// It can be used in BQL as `percentile_disc`.
+//
+//  Input: Int or Float (aggregated), Float
+//  Return Type: same as the selected input value (Null on empty input)
+var percentileDiscFunc = udf.MustConvertGenericAggregate(
+	func(arr []data.Value, p float64) (data.Value, error) {
+		if err := checkFraction(p); err != nil {
+			return nil, err
+		}
+		items, err := sortedNumericItems(arr)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) == 0 {
+			return data.Null{}, nil
+		}
+		idx := int(math.Ceil(p*float64(len(items)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return items[idx].value, nil
+	}, []bool{true, false})
+
+// approxPercentileFunc(expr, p[, accuracy]) is an aggregate function
+// that estimates the value at the given fraction p (0 <= p <= 1) of
+// all input values using a Greenwald-Khanna quantile summary. The rank
+// of the returned value differs from the exact rank by at most
+// accuracy * (the number of non-null input values). The default
+// accuracy is 0.01. Null values are ignored, non-numeric values lead
+// to an error.
+//
+// It can be used in BQL as `approx_percentile`.
+//
+//  Input: Int or Float (aggregated), Float, Float (optional)
+//  Return Type: Float (Null on empty input)
+var approxPercentileFunc = udf.MustConvertGenericAggregate(
+	func(arr []data.Value, p float64, accuracy ...float64) (data.Value, error) {
+		if err := checkFraction(p); err != nil {
+			return nil, err
+		}
+		eps := 0.01
+		if len(accuracy) > 1 {
+			return nil, fmt.Errorf("function takes at most three arguments")
+		} else if len(accuracy) == 1 {
+			eps = accuracy[0]
+		}
+		if math.IsNaN(eps) || eps <= 0 || eps >= 1 {
+			return nil, fmt.Errorf("accuracy must be greater than 0 and less than 1: %v", eps)
+		}
+		s := newGKSummary(eps)
 		for _, item := range arr {
-			if item.Type() == data.TypeBool {
-				b, _ := data.AsBool(item)
-				if !b {
-					result = b
-					// note that if we break here, we will not notice
-					// if there are un-boolable values further below
-					// and therefore become dependent on the order
-					// of rows, which is not good. therefore we do
-					// not break here.
-				}
-				onlyNulls = false
+			if item.Type() == data.TypeInt {
+				i, _ := data.AsInt(item)
+				s.insert(float64(i))
+			} else if item.Type() == data.TypeFloat {
+				f, _ := data.AsFloat(item)
+				s.insert(f)
 			} else if item.Type() == data.TypeNull {
 				continue
 			} else {
-				return nil, fmt.Errorf("cannot interpret %s (%T) as a bool",
+				return nil, fmt.Errorf("cannot interpret %s (%T) as a number",
 					item, item)
 			}
 		}
-		if onlyNulls {
+		if s.n == 0 {
 			return data.Null{}, nil
 		}
-		return data.Bool(result), nil
+		return data.Float(s.query(p)), nil
+	}, []bool{true, false, false})
+
+// skipping bit_and and bit_or here since they are quite low-level
+
+// boolAndFunc is an aggregate function that returns true if
+// all input values are true, false otherwise. Null values are
+// ignored, non-boolean values lead to an error.
+//
+// It can be used in BQL as `bool_and`.
+//
+//  Input: Bool (aggregated)
+//  Return Type: Bool (Null on empty input)
+var boolAndFunc udf.UDF = &mergeableAggFunc{
+	singleParamAggFunc: singleParamAggFunc{
+		aggFun: func(arr []data.Value) (data.Value, error) {
+			if len(arr) == 0 {
+				return data.Null{}, nil
+			}
+			result := true
+			onlyNulls := true
+			for _, item := range arr {
+				if item.Type() == data.TypeBool {
+					b, _ := data.AsBool(item)
+					if !b {
+						result = b
+						// note that if we break here, we will not notice
+						// if there are un-boolable values further below
+						// and therefore become dependent on the order
+						// of rows, which is not good. therefore we do
+						// not break here.
+					}
+					onlyNulls = false
+				} else if item.Type() == data.TypeNull {
+					continue
+				} else {
+					return nil, fmt.Errorf("cannot interpret %s (%T) as a bool",
+						item, item)
+				}
+			}
+			if onlyNulls {
+				return data.Null{}, nil
+			}
+			return data.Bool(result), nil
+		},
 	},
 }
 
@@ -238,36 +622,38 @@ var boolAndFunc udf.UDF = &singleParamAggFunc{
 //
 //  Input: Bool (aggregated)
 //  Return Type: Bool (Null on empty input)
-var boolOrFunc udf.UDF = &singleParamAggFunc{
-	aggFun: func(arr []data.Value) (data.Value, error) {
-		if len(arr) == 0 {
-			return data.Null{}, nil
-		}
-		result := false
-		onlyNulls := true
-		for _, item := range arr {
-			if item.Type() == data.TypeBool {
-				b, _ := data.AsBool(item)
-				if b {
-					result = b
-					// note that if we break here, we will not notice
-					// if there are un-boolable values further below
-					// and therefore become dependent on the order
-					// of rows, which is not good. therefore we do
-					// not break here.
+var boolOrFunc udf.UDF = &mergeableAggFunc{
+	singleParamAggFunc: singleParamAggFunc{
+		aggFun: func(arr []data.Value) (data.Value, error) {
+			if len(arr) == 0 {
+				return data.Null{}, nil
+			}
+			result := false
+			onlyNulls := true
+			for _, item := range arr {
+				if item.Type() == data.TypeBool {
+					b, _ := data.AsBool(item)
+					if b {
+						result = b
+						// note that if we break here, we will not notice
+						// if there are un-boolable values further below
+						// and therefore become dependent on the order
+						// of rows, which is not good. therefore we do
+						// not break here.
+					}
+					onlyNulls = false
+				} else if item.Type() == data.TypeNull {
+					continue
+				} else {
+					return nil, fmt.Errorf("cannot interpret %s (%T) as a bool",
+						item, item)
 				}
-				onlyNulls = false
-			} else if item.Type() == data.TypeNull {
-				continue
-			} else {
-				return nil, fmt.Errorf("cannot interpret %s (%T) as a bool",
-					item, item)
 			}
-		}
-		if onlyNulls {
-			return data.Null{}, nil
-		}
-		return data.Bool(result), nil
+			if onlyNulls {
+				return data.Null{}, nil
+			}
+			return data.Bool(result), nil
+		},
 	},
 }
 
@@ -322,65 +708,67 @@ var jsonObjectAggFunc udf.UDF = &twoParamAggFunc{
 //
 //  Input: Int or Float (aggregated)
 //  Return Type: same as maximal input value (Null on empty input)
-var maxFunc udf.UDF = &singleParamAggFunc{
-	aggFun: func(arr []data.Value) (data.Value, error) {
-		if len(arr) == 0 {
-			return data.Null{}, nil
-		}
-		// deal with the case of leading nulls and only nulls
-		firstNonNull := -1
-		for i, item := range arr {
-			if item.Type() != data.TypeNull {
-				firstNonNull = i
-				break
+var maxFunc udf.UDF = &mergeableAggFunc{
+	singleParamAggFunc: singleParamAggFunc{
+		aggFun: func(arr []data.Value) (data.Value, error) {
+			if len(arr) == 0 {
+				return data.Null{}, nil
 			}
-		}
-		if firstNonNull == -1 {
-			return data.Null{}, nil
-		}
-		// if we have timestamp-shaped data
-		if arr[firstNonNull].Type() == data.TypeTimestamp {
-			maxTime, _ := data.AsTimestamp(arr[firstNonNull])
+			// deal with the case of leading nulls and only nulls
+			firstNonNull := -1
+			for i, item := range arr {
+				if item.Type() != data.TypeNull {
+					firstNonNull = i
+					break
+				}
+			}
+			if firstNonNull == -1 {
+				return data.Null{}, nil
+			}
+			// if we have timestamp-shaped data
+			if arr[firstNonNull].Type() == data.TypeTimestamp {
+				maxTime, _ := data.AsTimestamp(arr[firstNonNull])
+				for _, item := range arr[firstNonNull:] {
+					if item.Type() == data.TypeTimestamp {
+						t, _ := data.AsTimestamp(item)
+						if maxTime.Sub(t).Seconds() < 0 {
+							maxTime = t
+						}
+					} else if item.Type() == data.TypeNull {
+						continue
+					} else {
+						return nil, fmt.Errorf("cannot interpret %s (%T) as a timestamp",
+							item, item)
+					}
+				}
+				return data.Timestamp(maxTime), nil
+			}
+			// else: numeric
+			maxFloat := -float64(math.MaxFloat64)
+			maxInt := int64(math.MinInt64)
 			for _, item := range arr[firstNonNull:] {
-				if item.Type() == data.TypeTimestamp {
-					t, _ := data.AsTimestamp(item)
-					if maxTime.Sub(t).Seconds() < 0 {
-						maxTime = t
+				if item.Type() == data.TypeInt {
+					i, _ := data.AsInt(item)
+					if i > maxInt {
+						maxInt = i
+					}
+				} else if item.Type() == data.TypeFloat {
+					f, _ := data.AsFloat(item)
+					if f > maxFloat {
+						maxFloat = f
 					}
 				} else if item.Type() == data.TypeNull {
 					continue
 				} else {
-					return nil, fmt.Errorf("cannot interpret %s (%T) as a timestamp",
+					return nil, fmt.Errorf("cannot interpret %s (%T) as a number",
 						item, item)
 				}
 			}
-			return data.Timestamp(maxTime), nil
-		}
-		// else: numeric
-		maxFloat := -float64(math.MaxFloat64)
-		maxInt := int64(math.MinInt64)
-		for _, item := range arr[firstNonNull:] {
-			if item.Type() == data.TypeInt {
-				i, _ := data.AsInt(item)
-				if i > maxInt {
-					maxInt = i
-				}
-			} else if item.Type() == data.TypeFloat {
-				f, _ := data.AsFloat(item)
-				if f > maxFloat {
-					maxFloat = f
-				}
-			} else if item.Type() == data.TypeNull {
-				continue
-			} else {
-				return nil, fmt.Errorf("cannot interpret %s (%T) as a number",
-					item, item)
+			if float64(maxInt) >= maxFloat {
+				return data.Int(maxInt), nil
 			}
-		}
-		if float64(maxInt) >= maxFloat {
-			return data.Int(maxInt), nil
-		}
-		return data.Float(maxFloat), nil
+			return data.Float(maxFloat), nil
+		},
 	},
 }
 
@@ -392,65 +780,67 @@ var maxFunc udf.UDF = &singleParamAggFunc{
 //
 //  Input: Int or Float (aggregated)
 //  Return Type: same as minimal input value (Null on empty input)
-var minFunc udf.UDF = &singleParamAggFunc{
-	aggFun: func(arr []data.Value) (data.Value, error) {
-		if len(arr) == 0 {
-			return data.Null{}, nil
-		}
-		// deal with the case of leading nulls and only nulls
-		firstNonNull := -1
-		for i, item := range arr {
-			if item.Type() != data.TypeNull {
-				firstNonNull = i
-				break
+var minFunc udf.UDF = &mergeableAggFunc{
+	singleParamAggFunc: singleParamAggFunc{
+		aggFun: func(arr []data.Value) (data.Value, error) {
+			if len(arr) == 0 {
+				return data.Null{}, nil
 			}
-		}
-		if firstNonNull == -1 {
-			return data.Null{}, nil
-		}
-		// if we have timestamp-shaped data
-		if arr[firstNonNull].Type() == data.TypeTimestamp {
-			minTime, _ := data.AsTimestamp(arr[firstNonNull])
+			// deal with the case of leading nulls and only nulls
+			firstNonNull := -1
+			for i, item := range arr {
+				if item.Type() != data.TypeNull {
+					firstNonNull = i
+					break
+				}
+			}
+			if firstNonNull == -1 {
+				return data.Null{}, nil
+			}
+			// if we have timestamp-shaped data
+			if arr[firstNonNull].Type() == data.TypeTimestamp {
+				minTime, _ := data.AsTimestamp(arr[firstNonNull])
+				for _, item := range arr[firstNonNull:] {
+					if item.Type() == data.TypeTimestamp {
+						t, _ := data.AsTimestamp(item)
+						if minTime.Sub(t).Seconds() > 0 {
+							minTime = t
+						}
+					} else if item.Type() == data.TypeNull {
+						continue
+					} else {
+						return nil, fmt.Errorf("cannot interpret %s (%T) as a timestamp",
+							item, item)
+					}
+				}
+				return data.Timestamp(minTime), nil
+			}
+			// else: numeric
+			minFloat := float64(math.MaxFloat64)
+			minInt := int64(math.MaxInt64)
 			for _, item := range arr[firstNonNull:] {
-				if item.Type() == data.TypeTimestamp {
-					t, _ := data.AsTimestamp(item)
-					if minTime.Sub(t).Seconds() > 0 {
-						minTime = t
+				if item.Type() == data.TypeInt {
+					i, _ := data.AsInt(item)
+					if i < minInt {
+						minInt = i
+					}
+				} else if item.Type() == data.TypeFloat {
+					f, _ := data.AsFloat(item)
+					if f < minFloat {
+						minFloat = f
 					}
 				} else if item.Type() == data.TypeNull {
 					continue
 				} else {
-					return nil, fmt.Errorf("cannot interpret %s (%T) as a timestamp",
+					return nil, fmt.Errorf("cannot interpret %s (%T) as a number",
 						item, item)
 				}
 			}
-			return data.Timestamp(minTime), nil
-		}
-		// else: numeric
-		minFloat := float64(math.MaxFloat64)
-		minInt := int64(math.MaxInt64)
-		for _, item := range arr[firstNonNull:] {
-			if item.Type() == data.TypeInt {
-				i, _ := data.AsInt(item)
-				if i < minInt {
-					minInt = i
-				}
-			} else if item.Type() == data.TypeFloat {
-				f, _ := data.AsFloat(item)
-				if f < minFloat {
-					minFloat = f
-				}
-			} else if item.Type() == data.TypeNull {
-				continue
-			} else {
-				return nil, fmt.Errorf("cannot interpret %s (%T) as a number",
-					item, item)
+			if float64(minInt) <= minFloat {
+				return data.Int(minInt), nil
 			}
-		}
-		if float64(minInt) <= minFloat {
-			return data.Int(minInt), nil
-		}
-		return data.Float(minFloat), nil
+			return data.Float(minFloat), nil
+		},
 	},
 }
 
@@ -513,49 +903,56 @@ var stringAggFunc udf.UDF = &stringAggFuncTmpl{}
 //  Input: Int or Float (aggregated)
 //  Return Type: Float if the input contains a Float, Int otherwise
 //   (Null on empty input)
-var sumFunc udf.UDF = &singleParamAggFunc{
-	aggFun: func(arr []data.Value) (data.Value, error) {
-		if len(arr) == 0 {
-			return data.Null{}, nil
-		}
-		sum := float64(0.0)
-		intSum := int64(0)
-		hadFloat := false
-		onlyNulls := true
-		for _, item := range arr {
-			if item.Type() == data.TypeInt {
-				i, _ := data.AsInt(item)
-				// if intSum overflows here, so be it. maybe later
-				// additions will fix the situation again. if we
-				// try to detect this here and return an error, we
-				// become dependent on the input order of numbers.
-				intSum += i
-				f := float64(i)
-				sum += f
-				onlyNulls = false
-			} else if item.Type() == data.TypeFloat {
-				f, _ := data.AsFloat(item)
-				sum += f
-				hadFloat = true
-				onlyNulls = false
-			} else if item.Type() == data.TypeNull {
-				continue
-			} else {
-				return nil, fmt.Errorf("cannot interpret %s (%T) as a number",
-					item, item)
-			}
-		}
-		if onlyNulls {
-			return data.Null{}, nil
-		}
-		if !hadFloat {
-			// if we had only integers, return the integer sum
-			// (this is better than converting the float sum
-			// back to int64 because we inherit Go's way of dealing
-			// with overflows)
-			return data.Int(intSum), nil
-		}
-		return data.Float(sum), nil
+var sumFunc udf.UDF = &incrementalAggFunc{
+	mergeableAggFunc: mergeableAggFunc{
+		singleParamAggFunc: singleParamAggFunc{
+			aggFun: func(arr []data.Value) (data.Value, error) {
+				if len(arr) == 0 {
+					return data.Null{}, nil
+				}
+				sum := float64(0.0)
+				intSum := int64(0)
+				hadFloat := false
+				onlyNulls := true
+				for _, item := range arr {
+					if item.Type() == data.TypeInt {
+						i, _ := data.AsInt(item)
+						// if intSum overflows here, so be it. maybe later
+						// additions will fix the situation again. if we
+						// try to detect this here and return an error, we
+						// become dependent on the input order of numbers.
+						intSum += i
+						f := float64(i)
+						sum += f
+						onlyNulls = false
+					} else if item.Type() == data.TypeFloat {
+						f, _ := data.AsFloat(item)
+						sum += f
+						hadFloat = true
+						onlyNulls = false
+					} else if item.Type() == data.TypeNull {
+						continue
+					} else {
+						return nil, fmt.Errorf("cannot interpret %s (%T) as a number",
+							item, item)
+					}
+				}
+				if onlyNulls {
+					return data.Null{}, nil
+				}
+				if !hadFloat {
+					// if we had only integers, return the integer sum
+					// (this is better than converting the float sum
+					// back to int64 because we inherit Go's way of dealing
+					// with overflows)
+					return data.Int(intSum), nil
+				}
+				return data.Float(sum), nil
+			},
+		},
+	},
+	newAccumulator: func() udf.Accumulator {
+		return &numericAccumulator{}
 	},
 }
 
@@ -6,6 +6,7 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"math"
+	"math/rand"
 	"testing"
 	"time"
 )
@@ -374,3 +375,296 @@ func TestBinaryAggregateFuncs(t *testing.T) {
 		})
 	}
 }
+
+func TestPercentileFuncs(t *testing.T) {
+	reg := udf.CopyGlobalUDFRegistry(nil)
+	input := data.Array{data.Int(3), data.Float(1), data.Null{}, data.Int(4), data.Int(2)}
+
+	Convey("Given the percentile_cont function", t, func() {
+		f, err := reg.Lookup("percentile_cont", 2)
+		So(err, ShouldBeNil)
+		So(f.IsAggregationParameter(0), ShouldBeTrue)
+		So(f.IsAggregationParameter(1), ShouldBeFalse)
+
+		Convey("When computing percentiles of a small dataset", func() {
+			cases := []struct {
+				p        float64
+				expected float64
+			}{
+				{0, 1}, {0.25, 1.75}, {0.5, 2.5}, {0.95, 3.85}, {1, 4},
+			}
+
+			Convey("Then they should be interpolated", func() {
+				for _, c := range cases {
+					v, err := f.Call(nil, input, data.Float(c.p))
+					So(err, ShouldBeNil)
+					So(v, ShouldAlmostEqual, data.Float(c.expected), 0.0000001)
+				}
+			})
+		})
+
+		Convey("When computing a percentile of empty input", func() {
+			v, err := f.Call(nil, data.Array{data.Null{}}, data.Float(0.5))
+
+			Convey("Then it should return null", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Null{})
+			})
+		})
+
+		Convey("When computing a percentile with invalid arguments", func() {
+			Convey("Then it should fail", func() {
+				_, err := f.Call(nil, input, data.Float(1.5))
+				So(err, ShouldNotBeNil)
+				_, err = f.Call(nil, input, data.Float(-0.1))
+				So(err, ShouldNotBeNil)
+				_, err = f.Call(nil, data.Array{data.Int(1), data.String("a")}, data.Float(0.5))
+				So(err, ShouldNotBeNil)
+				_, err = f.Call(nil, data.Int(1), data.Float(0.5))
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given the percentile_disc function", t, func() {
+		f, err := reg.Lookup("percentile_disc", 2)
+		So(err, ShouldBeNil)
+		So(f.IsAggregationParameter(0), ShouldBeTrue)
+		So(f.IsAggregationParameter(1), ShouldBeFalse)
+
+		Convey("When computing percentiles of a small dataset", func() {
+			cases := []struct {
+				p        float64
+				expected data.Value
+			}{
+				{0, data.Float(1)}, {0.25, data.Float(1)}, {0.5, data.Int(2)},
+				{0.6, data.Int(3)}, {0.95, data.Int(4)}, {1, data.Int(4)},
+			}
+
+			Convey("Then they should be one of the input values", func() {
+				for _, c := range cases {
+					v, err := f.Call(nil, input, data.Float(c.p))
+					So(err, ShouldBeNil)
+					So(v, ShouldResemble, c.expected)
+				}
+			})
+		})
+
+		Convey("When computing a percentile of empty input", func() {
+			v, err := f.Call(nil, data.Array{}, data.Float(0.5))
+
+			Convey("Then it should return null", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Null{})
+			})
+		})
+
+		Convey("When computing a percentile with an invalid fraction", func() {
+			_, err := f.Call(nil, input, data.Float(2))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given the approx_percentile function", t, func() {
+		f, err := reg.Lookup("approx_percentile", 3)
+		So(err, ShouldBeNil)
+		So(f.IsAggregationParameter(0), ShouldBeTrue)
+		So(f.IsAggregationParameter(1), ShouldBeFalse)
+		So(f.IsAggregationParameter(2), ShouldBeFalse)
+		So(f.Accept(2), ShouldBeTrue)
+
+		Convey("When computing percentiles of a large shuffled stream", func() {
+			// values are 1..n, so the exact rank of a value is the value
+			n := 10000
+			arr := make(data.Array, n)
+			for i, v := range rand.New(rand.NewSource(1)).Perm(n) {
+				arr[i] = data.Int(v + 1)
+			}
+
+			for _, eps := range []float64{0.01, 0.001} {
+				eps := eps
+				Convey(fmt.Sprintf("Then ranks should be within the error bound %v", eps), func() {
+					for _, p := range []float64{0, 0.5, 0.95, 0.99, 1} {
+						v, err := f.Call(nil, arr, data.Float(p), data.Float(eps))
+						So(err, ShouldBeNil)
+						rank, err := data.AsFloat(v)
+						So(err, ShouldBeNil)
+						So(math.Abs(rank-p*float64(n)), ShouldBeLessThanOrEqualTo, eps*float64(n)+1)
+					}
+				})
+			}
+
+			Convey("Then the default accuracy should be used without the third argument", func() {
+				v, err := f.Call(nil, arr, data.Float(0.5))
+				So(err, ShouldBeNil)
+				rank, err := data.AsFloat(v)
+				So(err, ShouldBeNil)
+				So(math.Abs(rank-0.5*float64(n)), ShouldBeLessThanOrEqualTo, 0.01*float64(n)+1)
+			})
+		})
+
+		Convey("When computing a percentile of a small dataset", func() {
+			v, err := f.Call(nil, input, data.Float(0.5))
+
+			Convey("Then it should be exact", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Float(2))
+			})
+		})
+
+		Convey("When computing a percentile of empty input", func() {
+			v, err := f.Call(nil, data.Array{data.Null{}}, data.Float(0.5))
+
+			Convey("Then it should return null", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Null{})
+			})
+		})
+
+		Convey("When computing a percentile with invalid arguments", func() {
+			Convey("Then it should fail", func() {
+				_, err := f.Call(nil, input, data.Float(1.1))
+				So(err, ShouldNotBeNil)
+				_, err = f.Call(nil, input, data.Float(0.5), data.Float(0))
+				So(err, ShouldNotBeNil)
+				_, err = f.Call(nil, input, data.Float(0.5), data.Float(1))
+				So(err, ShouldNotBeNil)
+				_, err = f.Call(nil, input, data.Float(0.5), data.Float(0.1), data.Float(0.1))
+				So(err, ShouldNotBeNil)
+				_, err = f.Call(nil, data.Array{data.Bool(true)}, data.Float(0.5))
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestIncrementalAggregateFuncs(t *testing.T) {
+	someTime := time.Date(2015, time.May, 1, 14, 27, 0, 0, time.UTC)
+	inputs := []data.Array{
+		{},
+		{data.Null{}},
+		{data.Int(7), data.Int(3), data.Int(-2)},
+		{data.Int(7), data.Null{}, data.Float(3.5), data.Int(1)},
+		{data.Float(2.3), data.Float(3.2), data.Null{}, data.Int(4)},
+		{data.Int(math.MaxInt64), data.Int(10), data.Int(-20)},
+		{data.Int(7), data.Timestamp(someTime), data.Int(3)},
+		{data.String("a"), data.Int(3), data.String("b")},
+	}
+
+	for _, name := range []string{"count", "sum", "avg"} {
+		name := name
+		f, err := udf.CopyGlobalUDFRegistry(nil).Lookup(name, 1)
+		if dispatcher, ok := f.(*arityDispatcher); ok {
+			f = dispatcher.unary
+		}
+
+		Convey(fmt.Sprintf("Given the %s function", name), t, func() {
+			So(err, ShouldBeNil)
+			ia, ok := f.(udf.IncrementalAggregate)
+			So(ok, ShouldBeTrue)
+
+			for i, in := range inputs {
+				in := in
+
+				Convey(fmt.Sprintf("[%d] When adding and removing %s", i, in), func() {
+					acc, err := ia.NewAccumulator(nil)
+					So(err, ShouldBeNil)
+					for _, v := range in {
+						So(acc.Add(v), ShouldBeNil)
+					}
+
+					Convey("Then the result should equal the one of Call on the remaining values", func() {
+						for j := 0; j <= len(in); j++ {
+							expected, expectedErr := f.Call(nil, in[j:])
+							actual, err := acc.Result()
+							if expectedErr != nil {
+								So(err, ShouldNotBeNil)
+							} else {
+								So(err, ShouldBeNil)
+								if actual.Type() == data.TypeFloat && expected.Type() == data.TypeFloat {
+									So(actual, ShouldAlmostEqual, expected, 0.0000001)
+								} else {
+									So(actual, ShouldResemble, expected)
+								}
+							}
+							if j < len(in) {
+								So(acc.Remove(in[j]), ShouldBeNil)
+							}
+						}
+					})
+				})
+			}
+		})
+	}
+}
+
+func TestMergeableAggregateFuncs(t *testing.T) {
+	someTime := time.Date(2015, time.May, 1, 14, 27, 0, 0, time.UTC)
+	inputs := []data.Array{
+		{},
+		{data.Null{}},
+		{data.Int(7), data.Int(3), data.Int(-2)},
+		{data.Int(7), data.Null{}, data.Float(3.5), data.Int(1)},
+		{data.Float(2.3), data.Float(3.2), data.Null{}, data.Int(4)},
+		{data.Bool(true), data.Null{}, data.Bool(false)},
+		{data.Timestamp(someTime), data.Null{}, data.Timestamp(someTime.Add(time.Second))},
+		{data.Int(7), data.Timestamp(someTime), data.Int(3)},
+		{data.String("a"), data.Int(3), data.String("b")},
+	}
+
+	for _, name := range []string{"count", "sum", "avg", "max", "min", "bool_and", "bool_or"} {
+		name := name
+		f, err := udf.CopyGlobalUDFRegistry(nil).Lookup(name, 1)
+		if dispatcher, ok := f.(*arityDispatcher); ok {
+			f = dispatcher.unary
+		}
+
+		Convey(fmt.Sprintf("Given the %s function", name), t, func() {
+			So(err, ShouldBeNil)
+			m, ok := f.(udf.MergeableAggregate)
+			So(ok, ShouldBeTrue)
+
+			for i, in := range inputs {
+				in := in
+
+				Convey(fmt.Sprintf("[%d] When merging partial states of chunks of %s", i, in), func() {
+					expected, expectedErr := f.Call(nil, in)
+
+					Convey("Then the result should equal the one of Call on all values", func() {
+						// split the input at every position
+						for j := 0; j <= len(in); j++ {
+							actual, err := func() (data.Value, error) {
+								a, err := m.Partial(nil, in[:j])
+								if err != nil {
+									return nil, err
+								}
+								b, err := m.Partial(nil, in[j:])
+								if err != nil {
+									return nil, err
+								}
+								s, err := m.Combine(nil, a, b)
+								if err != nil {
+									return nil, err
+								}
+								return m.Final(nil, s)
+							}()
+							if expectedErr != nil {
+								So(err, ShouldNotBeNil)
+								continue
+							}
+							So(err, ShouldBeNil)
+							if actual.Type() == data.TypeFloat && expected.Type() == data.TypeFloat {
+								So(actual, ShouldAlmostEqual, expected, 0.0000001)
+							} else {
+								So(actual, ShouldResemble, expected)
+							}
+						}
+					})
+				})
+			}
+		})
+	}
+}
@@ -10,7 +10,7 @@ import (
 // arrayLengthFunc returns the length of the given array.
 // NULL elements are counted as well.
 //
-// It can be used in BQL as `array_length`.
+// It can be used in BQL as `array_length` or `len`.
 //
 //  Input: Array
 //  Return Type: Int
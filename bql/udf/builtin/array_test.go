@@ -33,6 +33,11 @@ func TestUnaryArrayFuncs(t *testing.T) {
 			{data.Array{data.Null{}}, data.Int(1)},
 			{data.Array{data.Int(2), data.Float(3)}, data.Int(2)},
 		}},
+		{"len", arrayLengthFunc, []udfUnaryTestCaseInput{
+			{data.Array{}, data.Int(0)},
+			{data.Array{data.Array{data.Int(1), data.Int(2)}}, data.Int(1)},
+			{data.Array{data.Int(2), data.Null{}, data.Map{}}, data.Int(3)},
+		}},
 	}
 
 	for _, testCase := range udfUnaryTestCases {
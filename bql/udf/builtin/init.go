@@ -2,6 +2,10 @@ package builtin
 
 import (
 	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	// script engines used by CREATE FUNCTION statement
+	_ "gopkg.in/sensorbee/sensorbee.v0/bql/udf/script"
+	// UDF types used by CREATE FUNCTION statement having TYPE clause
+	_ "gopkg.in/sensorbee/sensorbee.v0/bql/udf/remote"
 )
 
 func init() {
@@ -61,11 +65,19 @@ func init() {
 	udf.RegisterGlobalUDF("upper", upperFunc)
 	udf.RegisterGlobalUDF("encode_json", udf.UnaryFunc(encodeJSON))
 	udf.RegisterGlobalUDF("decode_json", udf.UnaryFunc(decodeJSON))
+	udf.RegisterGlobalUDF("to_json", udf.UnaryFunc(toJSON))
 	// time functions
 	udf.RegisterGlobalUDF("distance_us", diffUsFunc)
 	udf.RegisterGlobalUDF("clock_timestamp", clockTimestampFunc)
 	// array functions
 	udf.RegisterGlobalUDF("array_length", arrayLengthFunc)
+	udf.RegisterGlobalUDF("len", arrayLengthFunc)
+	// map functions
+	udf.RegisterGlobalUDF("num_keys", numKeysFunc)
+	udf.RegisterGlobalUDF("keys", keysFunc)
+	// state functions
+	udf.RegisterGlobalUDF("lookup", lookupFunc)
+	udf.RegisterGlobalUDF("lookup_exists", lookupExistsFunc)
 	// aggregate functions
 	udf.RegisterGlobalUDF("array_agg", arrayAggFunc)
 	udf.RegisterGlobalUDF("avg", avgFunc)
@@ -76,6 +88,9 @@ func init() {
 	udf.RegisterGlobalUDF("max", maxFunc)
 	udf.RegisterGlobalUDF("median", medianFunc)
 	udf.RegisterGlobalUDF("min", minFunc)
+	udf.RegisterGlobalUDF("percentile_cont", percentileContFunc)
+	udf.RegisterGlobalUDF("percentile_disc", percentileDiscFunc)
+	udf.RegisterGlobalUDF("approx_percentile", approxPercentileFunc)
 	udf.RegisterGlobalUDF("string_agg", stringAggFunc)
 	udf.RegisterGlobalUDF("sum", sumFunc)
 	// conversion functions
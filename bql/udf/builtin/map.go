@@ -0,0 +1,52 @@
+package builtin
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+)
+
+// numKeysFunc returns the number of keys in the given map.
+// Keys having NULL values are counted as well.
+//
+// It can be used in BQL as `num_keys`.
+//
+//  Input: Map
+//  Return Type: Int
+var numKeysFunc udf.UDF = udf.UnaryFunc(func(ctx *core.Context, arg data.Value) (val data.Value, err error) {
+	if arg.Type() == data.TypeNull {
+		return data.Null{}, nil
+	} else if arg.Type() == data.TypeMap {
+		m, _ := data.AsMap(arg)
+		return data.Int(len(m)), nil
+	}
+	return nil, fmt.Errorf("%v is not a map", arg)
+})
+
+// keysFunc returns an array of keys in the given map. The keys are
+// sorted in ascending order.
+//
+// It can be used in BQL as `keys`.
+//
+//  Input: Map
+//  Return Type: Array of String
+var keysFunc udf.UDF = udf.UnaryFunc(func(ctx *core.Context, arg data.Value) (val data.Value, err error) {
+	if arg.Type() == data.TypeNull {
+		return data.Null{}, nil
+	} else if arg.Type() == data.TypeMap {
+		m, _ := data.AsMap(arg)
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		a := make(data.Array, len(keys))
+		for i, k := range keys {
+			a[i] = data.String(k)
+		}
+		return a, nil
+	}
+	return nil, fmt.Errorf("%v is not a map", arg)
+})
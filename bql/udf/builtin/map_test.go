@@ -0,0 +1,74 @@
+package builtin
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestUnaryMapFuncs(t *testing.T) {
+	someTime := time.Date(2015, time.May, 1, 14, 27, 0, 0, time.UTC)
+
+	invalidInputs := []udfUnaryTestCaseInput{
+		// NULL input -> NULL output
+		{data.Null{}, data.Null{}},
+		// cannot process the following
+		{data.Array{}, nil},
+		{data.Blob{}, nil},
+		{data.Bool(true), nil},
+		{data.Float(1.0), nil},
+		{data.Int(1), nil},
+		{data.String("hoge"), nil},
+		{data.Timestamp(someTime), nil},
+	}
+
+	udfUnaryTestCases := []udfUnaryTestCase{
+		{"num_keys", numKeysFunc, []udfUnaryTestCaseInput{
+			{data.Map{}, data.Int(0)},
+			{data.Map{"a": data.Int(1)}, data.Int(1)},
+			{data.Map{"a": data.Null{}}, data.Int(1)},
+			{data.Map{"a": data.Int(1), "b": data.Map{"c": data.Int(2), "d": data.Int(3)}}, data.Int(2)},
+		}},
+		{"keys", keysFunc, []udfUnaryTestCaseInput{
+			{data.Map{}, data.Array{}},
+			{data.Map{"a": data.Int(1)}, data.Array{data.String("a")}},
+			{data.Map{"c": data.Null{}, "a": data.Array{}, "b": data.Map{"d": data.Int(1)}},
+				data.Array{data.String("a"), data.String("b"), data.String("c")}},
+		}},
+	}
+
+	for _, testCase := range udfUnaryTestCases {
+		f := testCase.f
+		allInputs := append(testCase.inputs, invalidInputs...)
+
+		Convey(fmt.Sprintf("Given the %s function", testCase.name), t, func() {
+			for _, tc := range allInputs {
+				tc := tc
+
+				Convey(fmt.Sprintf("When evaluating it on %s (%T)", tc.input, tc.input), func() {
+					val, err := f.Call(nil, tc.input)
+
+					if tc.expected == nil {
+						Convey("Then evaluation should fail", func() {
+							So(err, ShouldNotBeNil)
+						})
+					} else {
+						Convey(fmt.Sprintf("Then the result should be %s", tc.expected), func() {
+							So(err, ShouldBeNil)
+							So(val, ShouldResemble, tc.expected)
+						})
+					}
+				})
+			}
+
+			Convey("Then it should equal the one in the default registry", func() {
+				regFun, err := udf.CopyGlobalUDFRegistry(nil).Lookup(testCase.name, 1)
+				So(err, ShouldBeNil)
+				So(regFun, ShouldHaveSameTypeAs, f)
+			})
+		})
+	}
+}
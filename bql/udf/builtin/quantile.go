@@ -0,0 +1,84 @@
+package builtin
+
+import (
+	"math"
+	"sort"
+)
+
+// gkTuple is an entry of gkSummary. g is the difference between the minimum
+// rank of this entry and the one of the previous entry. delta is the
+// difference between the maximum and minimum rank of this entry.
+type gkTuple struct {
+	v     float64
+	g     int
+	delta int
+}
+
+// gkSummary is a quantile summary proposed in "Space-Efficient Online
+// Computation of Quantile Summaries" by Greenwald and Khanna. A quantile
+// returned from the summary has a rank within eps*n of the exact rank where
+// n is the number of inserted values.
+type gkSummary struct {
+	eps     float64
+	n       int
+	tuples  []gkTuple
+	compInt int
+}
+
+func newGKSummary(eps float64) *gkSummary {
+	compInt := int(math.Floor(1 / (2 * eps)))
+	if compInt < 1 {
+		compInt = 1
+	}
+	return &gkSummary{
+		eps:     eps,
+		compInt: compInt,
+	}
+}
+
+func (s *gkSummary) insert(v float64) {
+	i := sort.Search(len(s.tuples), func(i int) bool {
+		return s.tuples[i].v > v
+	})
+	delta := 0
+	if i != 0 && i != len(s.tuples) {
+		delta = int(math.Floor(2 * s.eps * float64(s.n)))
+	}
+	s.tuples = append(s.tuples, gkTuple{})
+	copy(s.tuples[i+1:], s.tuples[i:])
+	s.tuples[i] = gkTuple{v, 1, delta}
+	s.n++
+
+	if s.n%s.compInt == 0 {
+		s.compress()
+	}
+}
+
+// compress merges adjacent entries as long as the error bound is kept. The
+// first and the last entries, i.e. the minimum and the maximum, are always
+// kept.
+func (s *gkSummary) compress() {
+	threshold := int(math.Floor(2 * s.eps * float64(s.n)))
+	for i := len(s.tuples) - 2; i >= 1; i-- {
+		t, next := s.tuples[i], s.tuples[i+1]
+		if t.g+next.g+next.delta <= threshold {
+			s.tuples[i+1].g += t.g
+			s.tuples = append(s.tuples[:i], s.tuples[i+1:]...)
+		}
+	}
+}
+
+// query returns the estimated value at the fraction p of the inserted values.
+// It must not be called when the summary is empty.
+func (s *gkSummary) query(p float64) float64 {
+	rank := p * float64(s.n)
+	bound := s.eps * float64(s.n)
+	rmin := 0
+	for i, t := range s.tuples {
+		if i > 0 && float64(rmin+t.g+t.delta) > rank+bound {
+			return s.tuples[i-1].v
+		}
+		rmin += t.g
+	}
+	return s.tuples[len(s.tuples)-1].v
+}
@@ -0,0 +1,79 @@
+package builtin
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// lookupableState returns the state having the given name, which must
+// implement core.LookupableSharedState.
+func lookupableState(ctx *core.Context, name data.Value) (core.LookupableSharedState, error) {
+	n, err := data.AsString(name)
+	if err != nil {
+		return nil, fmt.Errorf("the name of a state must be a string: %v", name)
+	}
+	s, err := ctx.SharedStates.Get(n)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := s.(core.LookupableSharedState)
+	if !ok {
+		return nil, fmt.Errorf("state '%v' cannot be looked up", n)
+	}
+	return l, nil
+}
+
+// lookupFunc returns the value associated with the given key in a
+// user-defined state. The state must be created by CREATE STATE and
+// implement core.LookupableSharedState. If the state doesn't have the
+// key, NULL is returned.
+//
+// It can be used in BQL as `lookup`.
+//
+//  Input: String (name of the state), Any (key)
+//  Return Type: Any
+var lookupFunc udf.UDF = udf.BinaryFunc(func(ctx *core.Context, name, key data.Value) (data.Value, error) {
+	s, err := lookupableState(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if key.Type() == data.TypeNull {
+		return data.Null{}, nil
+	}
+	v, err := s.Lookup(ctx, key)
+	if err != nil {
+		if core.IsNotExist(err) {
+			return data.Null{}, nil
+		}
+		return nil, err
+	}
+	return v, nil
+})
+
+// lookupExistsFunc returns true when a user-defined state has the given
+// key. Unlike `lookup(state, key) IS NOT NULL`, it also returns true
+// for a key associated with NULL. The state must be created by CREATE
+// STATE and implement core.LookupableSharedState.
+//
+// It can be used in BQL as `lookup_exists`.
+//
+//  Input: String (name of the state), Any (key)
+//  Return Type: Bool
+var lookupExistsFunc udf.UDF = udf.BinaryFunc(func(ctx *core.Context, name, key data.Value) (data.Value, error) {
+	s, err := lookupableState(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if key.Type() == data.TypeNull {
+		return data.Null{}, nil
+	}
+	if _, err := s.Lookup(ctx, key); err != nil {
+		if core.IsNotExist(err) {
+			return data.Bool(false), nil
+		}
+		return nil, err
+	}
+	return data.Bool(true), nil
+})
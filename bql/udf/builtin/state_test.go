@@ -0,0 +1,141 @@
+package builtin
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+type lookupableTestState struct {
+	m data.Map
+}
+
+func (s *lookupableTestState) Terminate(ctx *core.Context) error {
+	return nil
+}
+
+func (s *lookupableTestState) Lookup(ctx *core.Context, key data.Value) (data.Value, error) {
+	k, err := data.AsString(key)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := s.m[k]
+	if !ok {
+		return nil, core.NotExistError(fmt.Errorf("key '%v' was not found", k))
+	}
+	return v, nil
+}
+
+type nonLookupableTestState struct {
+}
+
+func (s *nonLookupableTestState) Terminate(ctx *core.Context) error {
+	return nil
+}
+
+func TestLookupFuncs(t *testing.T) {
+	Convey("Given a context having states", t, func() {
+		ctx := core.NewContext(nil)
+		So(ctx.SharedStates.Add("users", "test", &lookupableTestState{
+			m: data.Map{
+				"a": data.Map{"name": data.String("Alice")},
+				"b": data.Null{},
+			},
+		}), ShouldBeNil)
+		So(ctx.SharedStates.Add("plain", "test", &nonLookupableTestState{}), ShouldBeNil)
+
+		Convey("When looking up an existing key", func() {
+			v, err := lookupFunc.Call(ctx, data.String("users"), data.String("a"))
+			So(err, ShouldBeNil)
+
+			Convey("Then the value should be returned", func() {
+				So(v, ShouldResemble, data.Map{"name": data.String("Alice")})
+			})
+
+			Convey("Then lookup_exists should return true", func() {
+				e, err := lookupExistsFunc.Call(ctx, data.String("users"), data.String("a"))
+				So(err, ShouldBeNil)
+				So(e, ShouldEqual, data.Bool(true))
+			})
+		})
+
+		Convey("When looking up a key associated with NULL", func() {
+			v, err := lookupFunc.Call(ctx, data.String("users"), data.String("b"))
+			So(err, ShouldBeNil)
+
+			Convey("Then NULL should be returned", func() {
+				So(v, ShouldEqual, data.Null{})
+			})
+
+			Convey("Then lookup_exists should return true", func() {
+				e, err := lookupExistsFunc.Call(ctx, data.String("users"), data.String("b"))
+				So(err, ShouldBeNil)
+				So(e, ShouldEqual, data.Bool(true))
+			})
+		})
+
+		Convey("When looking up a missing key", func() {
+			v, err := lookupFunc.Call(ctx, data.String("users"), data.String("c"))
+			So(err, ShouldBeNil)
+
+			Convey("Then NULL should be returned", func() {
+				So(v, ShouldEqual, data.Null{})
+			})
+
+			Convey("Then lookup_exists should return false", func() {
+				e, err := lookupExistsFunc.Call(ctx, data.String("users"), data.String("c"))
+				So(err, ShouldBeNil)
+				So(e, ShouldEqual, data.Bool(false))
+			})
+		})
+
+		Convey("When looking up a NULL key", func() {
+			Convey("Then both functions should return NULL", func() {
+				v, err := lookupFunc.Call(ctx, data.String("users"), data.Null{})
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Null{})
+				e, err := lookupExistsFunc.Call(ctx, data.String("users"), data.Null{})
+				So(err, ShouldBeNil)
+				So(e, ShouldEqual, data.Null{})
+			})
+		})
+
+		Convey("When the state returns an error other than NotExistError", func() {
+			Convey("Then both functions should fail", func() {
+				_, err := lookupFunc.Call(ctx, data.String("users"), data.Int(1))
+				So(err, ShouldNotBeNil)
+				_, err = lookupExistsFunc.Call(ctx, data.String("users"), data.Int(1))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When looking up a state which cannot be looked up", func() {
+			Convey("Then both functions should fail", func() {
+				_, err := lookupFunc.Call(ctx, data.String("plain"), data.String("a"))
+				So(err, ShouldNotBeNil)
+				_, err = lookupExistsFunc.Call(ctx, data.String("plain"), data.String("a"))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When looking up a state which doesn't exist", func() {
+			Convey("Then both functions should fail", func() {
+				_, err := lookupFunc.Call(ctx, data.String("nonexistent"), data.String("a"))
+				So(err, ShouldNotBeNil)
+				_, err = lookupExistsFunc.Call(ctx, data.String("nonexistent"), data.String("a"))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the name of a state isn't a string", func() {
+			Convey("Then both functions should fail", func() {
+				_, err := lookupFunc.Call(ctx, data.Int(1), data.String("a"))
+				So(err, ShouldNotBeNil)
+				_, err = lookupExistsFunc.Call(ctx, data.Int(1), data.String("a"))
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
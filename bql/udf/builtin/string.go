@@ -596,6 +596,20 @@ func encodeJSON(ctx *core.Context, v data.Value) (data.Value, error) {
 	return data.String(v.String()), nil
 }
 
+// toJSON converts any value into JSON and returns a string containing it.
+// Unlike encodeJSON, it also accepts values other than arrays and maps, e.g.,
+// a string is converted to a quoted JSON string and Null is converted to
+// "null". Keys of maps are sorted, so an array or a map is converted to the
+// same string as `CAST(x AS STRING)` and the result can be converted back by
+// `CAST(x AS MAP)` or `CAST(x AS ARRAY)`.
+func toJSON(ctx *core.Context, v data.Value) (data.Value, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert %v to JSON: %v", v.Type(), err)
+	}
+	return data.String(b), nil
+}
+
 // decodeJSON parses a JSON stored as string or blob. It returns data.Map.
 func decodeJSON(ctx *core.Context, v data.Value) (data.Value, error) {
 	var (
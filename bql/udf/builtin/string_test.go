@@ -569,6 +569,63 @@ func TestEncodeJSON(t *testing.T) {
 	})
 }
 
+func TestToJSON(t *testing.T) {
+	Convey("Given to_json udf", t, func() {
+		f, err := udf.CopyGlobalUDFRegistry(nil).Lookup("to_json", 1)
+		So(err, ShouldBeNil)
+
+		Convey("When passing a nested map", func() {
+			m := data.Map{
+				"b": data.Array{data.Int(1), data.Map{"y": data.Null{}, "x": data.Float(2.3)}},
+				"a": data.String("4"),
+				"c": data.Map{"e": data.True, "d": data.Map{}},
+			}
+			v, err := f.Call(nil, m)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should encode it with sorted keys", func() {
+				s, err := data.AsString(v)
+				So(err, ShouldBeNil)
+				So(s, ShouldEqual, `{"a":"4","b":[1,{"x":2.3,"y":null}],"c":{"d":{},"e":true}}`)
+			})
+
+			Convey("Then it should be the same as the string conversion", func() {
+				s, err := data.ToString(m)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.String(s))
+			})
+
+			Convey("Then it should be decoded to the original map", func() {
+				m2, err := data.ToMap(v)
+				So(err, ShouldBeNil)
+				So(m2, ShouldResemble, m)
+			})
+		})
+
+		Convey("When passing values other than arrays and maps", func() {
+			cases := []struct {
+				v        data.Value
+				expected string
+			}{
+				{data.Null{}, `null`},
+				{data.True, `true`},
+				{data.Int(1), `1`},
+				{data.Float(1.5), `1.5`},
+				{data.String("a\"b"), `"a\"b"`},
+				{data.Blob("hoge"), `"aG9nZQ=="`},
+			}
+			for _, c := range cases {
+				c := c
+				Convey(fmt.Sprintf("Then it should encode %v", c.v.Type()), func() {
+					v, err := f.Call(nil, c.v)
+					So(err, ShouldBeNil)
+					So(v, ShouldEqual, data.String(c.expected))
+				})
+			}
+		})
+	})
+}
+
 func TestDecodeJSON(t *testing.T) {
 	Convey("Given decode_json udf", t, func() {
 		mapData := `  {
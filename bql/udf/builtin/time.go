@@ -44,13 +44,14 @@ func (f *diffUsFuncTmpl) Call(ctx *core.Context, args ...data.Value) (val data.V
 //  Return Type: Int
 var diffUsFunc udf.UDF = &diffUsFuncTmpl{}
 
-// clockTimestampFunc returns the local time (in UTC) as a Timestamp.
-// See also: time.Now
+// clockTimestampFunc returns the current time (in UTC) of the clock tied to
+// the context as a Timestamp.
+// See also: core.Context.Now
 //
 // It can be used in BQL as `clock_timestamp`.
 //
 //  Input: None
 //  Return Type: Timestamp
-var clockTimestampFunc = udf.MustConvertGeneric(func() time.Time {
-	return time.Now().In(time.UTC)
+var clockTimestampFunc = udf.MustConvertGeneric(func(ctx *core.Context) time.Time {
+	return ctx.Now().In(time.UTC)
 })
@@ -2,6 +2,7 @@ package udf
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -25,6 +26,60 @@ type UDF interface {
 	IsAggregationParameter(k int) bool
 }
 
+// Deterministic is an optional interface which a UDF can implement to report
+// whether it always returns the same value for the same arguments.
+type Deterministic interface {
+	// IsDeterministic returns true if the UDF always returns the same value
+	// for the same arguments.
+	IsDeterministic() bool
+}
+
+// IncrementalAggregate is an optional interface which an aggregate UDF
+// having exactly one parameter, which is an aggregation parameter, can
+// implement. The result of such a function is updated incrementally as
+// tuples enter and leave the window instead of being recomputed from all
+// values in the window every time the statement is evaluated.
+type IncrementalAggregate interface {
+	// NewAccumulator returns a new Accumulator which doesn't hold any
+	// value.
+	NewAccumulator(ctx *core.Context) (Accumulator, error)
+}
+
+// Accumulator holds the state of an IncrementalAggregate computed from a
+// multiset of values.
+type Accumulator interface {
+	// Add adds a value to the multiset.
+	Add(v data.Value) error
+
+	// Remove removes a value from the multiset. The value has always been
+	// added before.
+	Remove(v data.Value) error
+
+	// Result returns the value which the UDF returns when it's called with
+	// an array of the values currently in the multiset.
+	Result() (data.Value, error)
+}
+
+// MergeableAggregate is an optional interface which an aggregate UDF having
+// exactly one parameter, which is an aggregation parameter, can implement.
+// Values passed to such a function can be split into chunks which are
+// aggregated by multiple goroutines in parallel. Partial states computed
+// from the chunks are merged into one instead of gathering all values on
+// one goroutine.
+type MergeableAggregate interface {
+	// Partial computes the partial state of a chunk of the values.
+	Partial(ctx *core.Context, values data.Array) (data.Value, error)
+
+	// Combine merges two partial states. a is computed from values
+	// preceding the ones from which b is computed. Combine must be
+	// associative.
+	Combine(ctx *core.Context, a, b data.Value) (data.Value, error)
+
+	// Final returns the value which the UDF returns when it's called with
+	// an array of all values merged into the partial state.
+	Final(ctx *core.Context, state data.Value) (data.Value, error)
+}
+
 type function struct {
 	f     func(*core.Context, ...data.Value) (data.Value, error)
 	arity int
@@ -134,12 +189,54 @@ type FunctionManager interface {
 
 	// Register allows to add a function.
 	Register(name string, f UDF) error
+
+	// RegisterWithMetadata is like Register but also adds the metadata of
+	// the function. The metadata can be nil.
+	RegisterWithMetadata(name string, f UDF, meta *FunctionMetadata) error
+}
+
+// FunctionMetadata describes a UDF for users. It's shown by SHOW UDFS and
+// DESCRIBE FUNCTION statements.
+type FunctionMetadata struct {
+	// Description is a human readable description of the function.
+	Description string
+
+	// Arguments describe the parameters of the function in order.
+	Arguments []ArgumentMetadata
+
+	// ReturnType is the name of the type of the return value such as
+	// "int" or "array".
+	ReturnType string
+}
+
+// ArgumentMetadata describes a parameter of a UDF.
+type ArgumentMetadata struct {
+	// Name is the name of the parameter.
+	Name string
+
+	// Type is the name of the type of the parameter such as "int" or
+	// "array".
+	Type string
+}
+
+// FunctionDescriber is an optional interface which a FunctionRegistry can
+// implement to provide metadata of functions registered to it.
+type FunctionDescriber interface {
+	// Functions returns the names of all functions in the registry in
+	// alphabetical order.
+	Functions() []string
+
+	// Metadata returns the metadata of the function having the given name
+	// or core.NotExistError if there is no such function. A function
+	// registered without metadata has empty metadata.
+	Metadata(name string) (*FunctionMetadata, error)
 }
 
 type defaultFunctionRegistry struct {
 	ctx   *core.Context
 	m     sync.RWMutex
 	funcs map[string]UDF
+	metas map[string]*FunctionMetadata
 }
 
 // NewDefaultFunctionRegistry returns a new instance of the default
@@ -148,6 +245,7 @@ func NewDefaultFunctionRegistry(ctx *core.Context) FunctionManager {
 	reg := &defaultFunctionRegistry{
 		ctx:   ctx,
 		funcs: map[string]UDF{},
+		metas: map[string]*FunctionMetadata{},
 	}
 	return reg
 }
@@ -169,6 +267,10 @@ func (fr *defaultFunctionRegistry) Lookup(name string, arity int) (UDF, error) {
 }
 
 func (fr *defaultFunctionRegistry) Register(name string, f UDF) error {
+	return fr.RegisterWithMetadata(name, f, nil)
+}
+
+func (fr *defaultFunctionRegistry) RegisterWithMetadata(name string, f UDF, meta *FunctionMetadata) error {
 	fr.m.Lock()
 	defer fr.m.Unlock()
 
@@ -178,7 +280,7 @@ func (fr *defaultFunctionRegistry) Register(name string, f UDF) error {
 	switch lowerName {
 	case "count", "avg", "max", "min", "sum",
 		"coalesce", "lower", "upper", "octet_length",
-		"substring":
+		"substring", "keys":
 		// skip check
 	default:
 		if err := core.ValidateSymbol(name); err != nil {
@@ -189,9 +291,33 @@ func (fr *defaultFunctionRegistry) Register(name string, f UDF) error {
 		return fmt.Errorf("there is already a function named '%s'", name)
 	}
 	fr.funcs[lowerName] = f
+	if meta == nil {
+		meta = &FunctionMetadata{}
+	}
+	fr.metas[lowerName] = meta
 	return nil
 }
 
+func (fr *defaultFunctionRegistry) Functions() []string {
+	fr.m.RLock()
+	defer fr.m.RUnlock()
+	names := make([]string, 0, len(fr.funcs))
+	for n := range fr.funcs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (fr *defaultFunctionRegistry) Metadata(name string) (*FunctionMetadata, error) {
+	fr.m.RLock()
+	defer fr.m.RUnlock()
+	if m, exists := fr.metas[strings.ToLower(name)]; exists {
+		return m, nil
+	}
+	return nil, core.NotExistError(fmt.Errorf("function '%s' is unknown", name))
+}
+
 var (
 	// globalUDFRegistry has UDFs visible to all topologies. Do NOT use this
 	// instance in running topologies because it doesn't have an actual
@@ -214,6 +340,21 @@ func MustRegisterGlobalUDF(name string, f UDF) {
 	}
 }
 
+// RegisterGlobalUDFWithMetadata is like RegisterGlobalUDF but also registers
+// the metadata of the UDF, which is shown by SHOW UDFS and DESCRIBE FUNCTION
+// statements.
+func RegisterGlobalUDFWithMetadata(name string, f UDF, meta *FunctionMetadata) error {
+	return globalUDFRegistry.RegisterWithMetadata(name, f, meta)
+}
+
+// MustRegisterGlobalUDFWithMetadata is like RegisterGlobalUDFWithMetadata but
+// panics if an error occurred.
+func MustRegisterGlobalUDFWithMetadata(name string, f UDF, meta *FunctionMetadata) {
+	if err := globalUDFRegistry.RegisterWithMetadata(name, f, meta); err != nil {
+		panic(fmt.Errorf("udf.MustRegisterGlobalUDFWithMetadata: cannot register '%v': %v", name, err))
+	}
+}
+
 // CopyGlobalUDFRegistry creates a new FunctionManager which has all UDFs
 // registered to the global function manager.
 func CopyGlobalUDFRegistry(ctx *core.Context) FunctionManager {
@@ -222,14 +363,50 @@ func CopyGlobalUDFRegistry(ctx *core.Context) FunctionManager {
 	reg := &defaultFunctionRegistry{
 		ctx:   ctx,
 		funcs: make(map[string]UDF, len(globalUDFRegistry.funcs)),
+		metas: make(map[string]*FunctionMetadata, len(globalUDFRegistry.metas)),
 	}
 
 	for n, f := range globalUDFRegistry.funcs {
 		reg.funcs[n] = f
 	}
+	for n, m := range globalUDFRegistry.metas {
+		reg.metas[n] = m
+	}
 	return reg
 }
 
+// ImportGlobalUDFs registers UDFs in the global function manager to reg
+// unless reg already has a UDF having the same name. It's used to make UDFs
+// registered after reg was created, such as ones registered by a plugin,
+// visible to reg. It returns the names of imported UDFs.
+func ImportGlobalUDFs(reg FunctionManager) ([]string, error) {
+	globalUDFRegistry.m.RLock()
+	funcs := make(map[string]UDF, len(globalUDFRegistry.funcs))
+	for n, f := range globalUDFRegistry.funcs {
+		funcs[n] = f
+	}
+	metas := make(map[string]*FunctionMetadata, len(globalUDFRegistry.metas))
+	for n, m := range globalUDFRegistry.metas {
+		metas[n] = m
+	}
+	globalUDFRegistry.m.RUnlock()
+
+	var imported []string
+	for n, f := range funcs {
+		// Lookup fails with an error other than NotExistError when the
+		// function exists but doesn't accept the arity.
+		if _, err := reg.Lookup(n, 0); !core.IsNotExist(err) {
+			continue
+		}
+		if err := reg.RegisterWithMetadata(n, f, metas[n]); err != nil {
+			return imported, err
+		}
+		imported = append(imported, n)
+	}
+	sort.Strings(imported)
+	return imported, nil
+}
+
 func init() {
 	// register some standard functions
 	toString := func(ctx *core.Context, v data.Value) (data.Value, error) {
@@ -121,3 +121,65 @@ func TestDefaultFunctionRegistry(t *testing.T) {
 		})
 	})
 }
+
+func TestFunctionMetadata(t *testing.T) {
+	Convey("Given a default function registry", t, func() {
+		fr := NewDefaultFunctionRegistry(&core.Context{})
+		fun := func(*core.Context, data.Value) (data.Value, error) {
+			return data.Bool(true), nil
+		}
+		meta := &FunctionMetadata{
+			Description: "returns true",
+			Arguments:   []ArgumentMetadata{{Name: "x", Type: "any"}},
+			ReturnType:  "bool",
+		}
+		So(fr.RegisterWithMetadata("Truth", UnaryFunc(fun), meta), ShouldBeNil)
+		So(fr.Register("another", UnaryFunc(fun)), ShouldBeNil)
+		d := fr.(FunctionDescriber)
+
+		Convey("When listing functions", func() {
+			names := d.Functions()
+
+			Convey("Then they should be sorted by names", func() {
+				So(names, ShouldResemble, []string{"another", "truth"})
+			})
+		})
+
+		Convey("When getting the metadata of a function", func() {
+			m, err := d.Metadata("TRUTH")
+			So(err, ShouldBeNil)
+
+			Convey("Then it should be the registered one", func() {
+				So(m, ShouldResemble, meta)
+			})
+		})
+
+		Convey("When getting the metadata of a function registered without it", func() {
+			m, err := d.Metadata("another")
+			So(err, ShouldBeNil)
+
+			Convey("Then it should be empty", func() {
+				So(m, ShouldResemble, &FunctionMetadata{})
+			})
+		})
+
+		Convey("When getting the metadata of an unknown function", func() {
+			_, err := d.Metadata("hoge")
+
+			Convey("Then it should fail", func() {
+				So(core.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+
+		Convey("When registering a function with the same name", func() {
+			err := fr.RegisterWithMetadata("truth", UnaryFunc(fun), nil)
+
+			Convey("Then it should fail and keep the metadata", func() {
+				So(err, ShouldNotBeNil)
+				m, err := d.Metadata("truth")
+				So(err, ShouldBeNil)
+				So(m, ShouldResemble, meta)
+			})
+		})
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"sync"
 	"time"
 
 	"gopkg.in/sensorbee/sensorbee.v0/core"
@@ -16,7 +17,8 @@ import (
 // allowed. The UDF returned provide a weak type conversion, that is it uses
 // data.To{Type} function to convert values. Therefore, a string may be
 // passed as an integer or vice versa. If the function wants to provide
-// strict type conversion, generate UDF by Func function.
+// strict type conversion, pass WithStrictConversion option or generate UDF by
+// Func function.
 //
 // Acceptable types:
 //	- bool
@@ -27,7 +29,19 @@ import (
 //	- data.Bool, data.Int, data.Float, data.String, data.Blob,
 //	  data.Timestamp, data.Array, data.Map, data.Value
 //	- a slice of types above
-func ConvertGeneric(function interface{}) (UDF, error) {
+//	- a struct or a pointer to a struct, which is decoded from data.Map by
+//	  data.Decoder (see data.Decoder for supported fields and tags). Fields
+//	  are converted as described in data.Decoder regardless of
+//	  WithStrictConversion, but the option makes keys which the struct
+//	  doesn't have an error.
+//
+// A struct or a pointer to a struct can also be returned from the function.
+// It's encoded into data.Map by data.Encode.
+//
+// The behavior of the UDF can be customized by passing GenericOptions such as
+// WithStrictConversion. Without any option, the UDF behaves as described
+// above.
+func ConvertGeneric(function interface{}, opts ...GenericOption) (UDF, error) {
 	t := reflect.TypeOf(function)
 	if t.Kind() != reflect.Func {
 		return nil, errors.New("the argument must be a function")
@@ -38,12 +52,12 @@ func ConvertGeneric(function interface{}) (UDF, error) {
 		numArgs--
 	}
 
-	return convertGenericAggregate(function, make([]bool, numArgs), false)
+	return convertGenericAggregate(function, make([]bool, numArgs), false, opts)
 }
 
 // MustConvertGeneric is like ConvertGeneric, but panics on errors.
-func MustConvertGeneric(function interface{}) UDF {
-	f, err := ConvertGeneric(function)
+func MustConvertGeneric(function interface{}, opts ...GenericOption) UDF {
+	f, err := ConvertGeneric(function, opts...)
 	if err != nil {
 		panic(err)
 	}
@@ -54,23 +68,29 @@ func MustConvertGeneric(function interface{}) UDF {
 // functions. aggParams argument is used to indicate which arguments of the
 // function are aggregation parameter.
 // receives aggregation parameter.
-// Supported and acceptable types are the same as ConvertGeneric.
-func ConvertGenericAggregate(function interface{}, aggParams []bool) (UDF, error) {
-	return convertGenericAggregate(function, aggParams, true)
+// Supported and acceptable types and options are the same as ConvertGeneric.
+func ConvertGenericAggregate(function interface{}, aggParams []bool, opts ...GenericOption) (UDF, error) {
+	return convertGenericAggregate(function, aggParams, true, opts)
 }
 
-func convertGenericAggregate(function interface{}, aggParams []bool, isAggregate bool) (UDF, error) {
+func convertGenericAggregate(function interface{}, aggParams []bool, isAggregate bool, opts []GenericOption) (UDF, error) {
 	t := reflect.TypeOf(function)
 	if t.Kind() != reflect.Func {
 		return nil, errors.New("the argument must be a function")
 	}
 
+	o := &genericOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	copiedParams := make([]bool, len(aggParams))
 	copy(copiedParams, aggParams)
 	g := &genericFunc{
 		function:             reflect.ValueOf(function),
 		hasContext:           genericFuncHasContext(t),
 		variadic:             t.IsVariadic(),
+		deterministic:        o.deterministic,
 		arity:                t.NumIn(),
 		aggregationParameter: copiedParams,
 	}
@@ -120,7 +140,7 @@ func convertGenericAggregate(function interface{}, aggParams []bool, isAggregate
 		g.hasError = hasError
 	}
 
-	if convs, err := createGenericConverters(t, t.NumIn()-g.arity); err != nil {
+	if convs, err := createGenericConverters(t, t.NumIn()-g.arity, o); err != nil {
 		return nil, err
 	} else {
 		g.converters = convs
@@ -130,8 +150,8 @@ func convertGenericAggregate(function interface{}, aggParams []bool, isAggregate
 
 // MustConvertGenericAggregate is like ConvertGenericAggregate,
 // but panics on errors.
-func MustConvertGenericAggregate(function interface{}, aggParams []bool) UDF {
-	f, err := ConvertGenericAggregate(function, aggParams)
+func MustConvertGenericAggregate(function interface{}, aggParams []bool, opts ...GenericOption) UDF {
+	f, err := ConvertGenericAggregate(function, aggParams, opts...)
 	if err != nil {
 		panic(err)
 	}
@@ -157,6 +177,10 @@ func checkGenericFuncReturnTypes(t reflect.Type) (bool, error) {
 				return false, fmt.Errorf("the return value isn't convertible to data.Value")
 			}
 		}
+		for out.Kind() == reflect.Ptr {
+			// a nil pointer is always converted to data.Null
+			out = out.Elem()
+		}
 		if _, err := data.NewValue(reflect.Zero(out).Interface()); err != nil {
 			return false, fmt.Errorf("the return value isn't convertible to data.Value")
 		}
@@ -175,7 +199,7 @@ func genericFuncHasContext(t reflect.Type) bool {
 	return reflect.TypeOf(&core.Context{}).AssignableTo(c)
 }
 
-func createGenericConverters(t reflect.Type, argStart int) ([]argumentConverter, error) {
+func createGenericConverters(t reflect.Type, argStart int, o *genericOptions) ([]argumentConverter, error) {
 	variadic := t.IsVariadic()
 	convs := make([]argumentConverter, 0, t.NumIn()-argStart)
 	for i := argStart; i < t.NumIn(); i++ {
@@ -184,7 +208,15 @@ func createGenericConverters(t reflect.Type, argStart int) ([]argumentConverter,
 			arg = arg.Elem()
 		}
 
-		c, err := genericFuncArgumentConverter(arg)
+		var (
+			c   argumentConverter
+			err error
+		)
+		if o.cache != nil {
+			c, err = o.cache.converter(arg, o.strict)
+		} else {
+			c, err = genericFuncArgumentConverter(arg, o.valueConverters())
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -195,17 +227,48 @@ func createGenericConverters(t reflect.Type, argStart int) ([]argumentConverter,
 
 type argumentConverter func(data.Value) (interface{}, error)
 
-func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
+// valueConverters has functions converting a data.Value to a Go value. They're
+// either data.To{Type} functions or data.As{Type} functions.
+type valueConverters struct {
+	toBool      func(data.Value) (bool, error)
+	toInt       func(data.Value) (int64, error)
+	toFloat     func(data.Value) (float64, error)
+	toString    func(data.Value) (string, error)
+	toBlob      func(data.Value) ([]byte, error)
+	toTimestamp func(data.Value) (time.Time, error)
+}
+
+var (
+	weakValueConverters = &valueConverters{
+		toBool:      data.ToBool,
+		toInt:       data.ToInt,
+		toFloat:     data.ToFloat,
+		toString:    data.ToString,
+		toBlob:      data.ToBlob,
+		toTimestamp: data.ToTimestamp,
+	}
+
+	strictValueConverters = &valueConverters{
+		toBool:      data.AsBool,
+		toInt:       data.AsInt,
+		toFloat:     data.AsFloat,
+		toString:    data.AsString,
+		toBlob:      data.AsBlob,
+		toTimestamp: data.AsTimestamp,
+	}
+)
+
+func genericFuncArgumentConverter(t reflect.Type, vc *valueConverters) (argumentConverter, error) {
 	// TODO: this function is too long.
 	switch t.Kind() {
 	case reflect.Bool:
 		return func(v data.Value) (interface{}, error) {
-			return data.ToBool(v)
+			return vc.toBool(v)
 		}, nil
 
 	case reflect.Int:
 		return func(v data.Value) (interface{}, error) {
-			i, err := data.ToInt(v)
+			i, err := vc.toInt(v)
 			if err != nil {
 				return nil, err
 			}
@@ -220,7 +283,7 @@ func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
 
 	case reflect.Int8:
 		return func(v data.Value) (interface{}, error) {
-			i, err := data.ToInt(v)
+			i, err := vc.toInt(v)
 			if err != nil {
 				return nil, err
 			}
@@ -235,7 +298,7 @@ func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
 
 	case reflect.Int16:
 		return func(v data.Value) (interface{}, error) {
-			i, err := data.ToInt(v)
+			i, err := vc.toInt(v)
 			if err != nil {
 				return nil, err
 			}
@@ -250,7 +313,7 @@ func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
 
 	case reflect.Int32:
 		return func(v data.Value) (interface{}, error) {
-			i, err := data.ToInt(v)
+			i, err := vc.toInt(v)
 			if err != nil {
 				return nil, err
 			}
@@ -265,12 +328,12 @@ func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
 
 	case reflect.Int64:
 		return func(v data.Value) (interface{}, error) {
-			return data.ToInt(v)
+			return vc.toInt(v)
 		}, nil
 
 	case reflect.Uint:
 		return func(v data.Value) (interface{}, error) {
-			i, err := data.ToInt(v)
+			i, err := vc.toInt(v)
 			if err != nil {
 				return nil, err
 			}
@@ -285,7 +348,7 @@ func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
 
 	case reflect.Uint8:
 		return func(v data.Value) (interface{}, error) {
-			i, err := data.ToInt(v)
+			i, err := vc.toInt(v)
 			if err != nil {
 				return nil, err
 			}
@@ -300,7 +363,7 @@ func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
 
 	case reflect.Uint16:
 		return func(v data.Value) (interface{}, error) {
-			i, err := data.ToInt(v)
+			i, err := vc.toInt(v)
 			if err != nil {
 				return nil, err
 			}
@@ -315,7 +378,7 @@ func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
 
 	case reflect.Uint32:
 		return func(v data.Value) (interface{}, error) {
-			i, err := data.ToInt(v)
+			i, err := vc.toInt(v)
 			if err != nil {
 				return nil, err
 			}
@@ -330,7 +393,7 @@ func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
 
 	case reflect.Uint64:
 		return func(v data.Value) (interface{}, error) {
-			i, err := data.ToInt(v)
+			i, err := vc.toInt(v)
 			if err != nil {
 				return nil, err
 			}
@@ -343,7 +406,7 @@ func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
 
 	case reflect.Float32:
 		return func(v data.Value) (interface{}, error) {
-			f, err := data.ToFloat(v)
+			f, err := vc.toFloat(v)
 			if err != nil {
 				return nil, err
 			}
@@ -352,12 +415,12 @@ func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
 
 	case reflect.Float64:
 		return func(v data.Value) (interface{}, error) {
-			return data.ToFloat(v)
+			return vc.toFloat(v)
 		}, nil
 
 	case reflect.String:
 		return func(v data.Value) (interface{}, error) {
-			return data.ToString(v)
+			return vc.toString(v)
 		}, nil
 
 	case reflect.Slice:
@@ -368,7 +431,7 @@ func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
 				// This function explicitly returns nil to avoid returning
 				// nils having non-empty type information for later nil
 				// equality checks.
-				res, err := data.ToBlob(v)
+				res, err := vc.toBlob(v)
 				if err != nil {
 					return nil, err
 				}
@@ -379,7 +442,7 @@ func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
 			}, nil
 		}
 
-		c, err := genericFuncArgumentConverter(elemType)
+		c, err := genericFuncArgumentConverter(elemType, vc)
 		if err != nil {
 			return nil, err
 		}
@@ -415,7 +478,7 @@ func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
 
 		case time.Time:
 			return func(v data.Value) (interface{}, error) {
-				return data.ToTimestamp(v)
+				return vc.toTimestamp(v)
 			}, nil
 
 		default:
@@ -428,18 +491,64 @@ func genericFuncArgumentConverter(t reflect.Type) (argumentConverter, error) {
 					return v, nil
 				}, nil
 			}
+			if t.Kind() == reflect.Struct {
+				return genericFuncStructConverter(t, vc)
+			}
+			if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct &&
+				!t.Elem().ConvertibleTo(reflect.TypeOf(time.Time{})) {
+				c, err := genericFuncStructConverter(t.Elem(), vc)
+				if err != nil {
+					return nil, err
+				}
+				return func(v data.Value) (interface{}, error) {
+					if v.Type() == data.TypeNull {
+						return reflect.Zero(t).Interface(), nil
+					}
+					s, err := c(v)
+					if err != nil {
+						return nil, err
+					}
+					p := reflect.New(t.Elem())
+					p.Elem().Set(reflect.ValueOf(s))
+					return p.Interface(), nil
+				}, nil
+			}
 			// other tuple types are covered in Kind() switch above
 			return nil, fmt.Errorf("unsupported type: %v", t)
 		}
 	}
 }
 
+// genericFuncStructConverter returns a converter decoding a data.Map into
+// a struct with data.Decoder. Keys which the struct doesn't have are
+// reported as an error only when vc has strict converters.
+func genericFuncStructConverter(t reflect.Type, vc *valueConverters) (argumentConverter, error) {
+	if t.ConvertibleTo(reflect.TypeOf(time.Time{})) {
+		return nil, fmt.Errorf("unsupported type: %v", t)
+	}
+	d := data.NewDecoder(&data.DecoderConfig{
+		ErrorUnused: vc == strictValueConverters,
+	})
+	return func(v data.Value) (interface{}, error) {
+		m, err := data.AsMap(v)
+		if err != nil {
+			return nil, err
+		}
+		p := reflect.New(t)
+		if err := d.Decode(m, p.Interface()); err != nil {
+			return nil, err
+		}
+		return p.Elem().Interface(), nil
+	}, nil
+}
+
 type genericFunc struct {
 	function reflect.Value
 
-	hasContext bool
-	hasError   bool
-	variadic   bool
+	hasContext    bool
+	hasError      bool
+	variadic      bool
+	deterministic bool
 
 	// arity is the number of arguments. If the function is variadic, arity
 	// counts the last variadic parameter. For example, if the function is
@@ -532,3 +641,101 @@ func (g *genericFunc) IsAggregationParameter(k int) bool {
 	}
 	return g.aggregationParameter[k]
 }
+
+func (g *genericFunc) IsDeterministic() bool {
+	return g.deterministic
+}
+
+// GenericOption is an option to customize UDFs created by ConvertGeneric or
+// ConvertGenericAggregate.
+type GenericOption func(o *genericOptions)
+
+type genericOptions struct {
+	strict        bool
+	deterministic bool
+	cache         *ConverterCache
+}
+
+func (o *genericOptions) valueConverters() *valueConverters {
+	if o.strict {
+		return strictValueConverters
+	}
+	return weakValueConverters
+}
+
+// WithStrictConversion makes the UDF convert its arguments with data.As{Type}
+// functions instead of data.To{Type} functions. Therefore, the UDF returns an
+// error when a string is passed as an integer or vice versa.
+func WithStrictConversion() GenericOption {
+	return func(o *genericOptions) {
+		o.strict = true
+	}
+}
+
+// WithDeterministic specifies whether the UDF always returns the same value
+// for the same arguments. The flag is reported by IsDeterministic method of
+// the UDF. UDFs are not regarded as deterministic by default.
+func WithDeterministic(d bool) GenericOption {
+	return func(o *genericOptions) {
+		o.deterministic = d
+	}
+}
+
+// WithConverterCache makes the UDF share argument converters with other UDFs
+// created with the same cache. It reduces the cost of creating many UDFs
+// having arguments of the same types.
+func WithConverterCache(c *ConverterCache) GenericOption {
+	return func(o *genericOptions) {
+		o.cache = c
+	}
+}
+
+// ConverterCache caches argument converters created by ConvertGeneric and
+// ConvertGenericAggregate. It can safely be shared by multiple goroutines.
+type ConverterCache struct {
+	m     sync.RWMutex
+	convs map[converterCacheKey]argumentConverter
+}
+
+type converterCacheKey struct {
+	t      reflect.Type
+	strict bool
+}
+
+// NewConverterCache creates a new empty ConverterCache.
+func NewConverterCache() *ConverterCache {
+	return &ConverterCache{
+		convs: map[converterCacheKey]argumentConverter{},
+	}
+}
+
+// Len returns the number of converters cached.
+func (c *ConverterCache) Len() int {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return len(c.convs)
+}
+
+func (c *ConverterCache) converter(t reflect.Type, strict bool) (argumentConverter, error) {
+	key := converterCacheKey{t: t, strict: strict}
+	c.m.RLock()
+	conv, ok := c.convs[key]
+	c.m.RUnlock()
+	if ok {
+		return conv, nil
+	}
+
+	vc := weakValueConverters
+	if strict {
+		vc = strictValueConverters
+	}
+	conv, err := genericFuncArgumentConverter(t, vc)
+	if err != nil {
+		return nil, err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.convs[key] = conv
+	return conv, nil
+}
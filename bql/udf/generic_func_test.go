@@ -463,7 +463,8 @@ func TestGenericFuncInvalidCases(t *testing.T) {
 			{"with non-function type", 10, nil},
 			{"with non-error second return type", func() (int, int) { return 0, 0 }, nil},
 			{"with an unsupported type and non-error second return type", func(error) (int, int) { return 0, 0 }, nil},
-			{"with an unsupported return type", func() *core.Context { return nil }, nil},
+			{"with an unsupported return type", func() chan int { return nil }, nil},
+			{"with an unsupported struct return type", func() *struct{ C chan int } { return nil }, nil},
 			{"with an unsupported interface return type", func() error { return nil }, nil},
 			{"with an invalid aggParams 1", func(int) int { return 0 }, []bool{}},
 			{"with an invalid aggParams 2", func(int) int { return 0 }, []bool{false, false}},
@@ -848,3 +849,201 @@ func TestGenericArrayFunc(t *testing.T) {
 		})
 	})
 }
+
+func TestGenericStructFunc(t *testing.T) {
+	ctx := core.NewContext(nil)
+	type config struct {
+		Name  string `bql:",required"`
+		Scale float64
+	}
+	type result struct {
+		Label string
+		Value float64
+	}
+
+	Convey("Given a function receiving and returning structs", t, func() {
+		f, err := ConvertGeneric(func(c config, v float64) result {
+			return result{Label: c.Name, Value: c.Scale * v}
+		})
+		So(err, ShouldBeNil)
+
+		Convey("When passing a map", func() {
+			v, err := f.Call(ctx, data.Map{"name": data.String("a"), "scale": data.Int(2),
+				"unknown": data.Null{}}, data.Float(1.5))
+			So(err, ShouldBeNil)
+
+			Convey("Then it should return the struct as a map", func() {
+				So(v, ShouldResemble, data.Map{"label": data.String("a"), "value": data.Float(3)})
+			})
+		})
+
+		Convey("When passing a map lacking a required field", func() {
+			_, err := f.Call(ctx, data.Map{"scale": data.Int(2)}, data.Float(1.5))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When passing a non-map value", func() {
+			_, err := f.Call(ctx, data.Int(1), data.Float(1.5))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a function receiving a pointer to a struct with strict conversion", t, func() {
+		f, err := ConvertGeneric(func(c *config) *result {
+			if c == nil {
+				return nil
+			}
+			return &result{Label: c.Name}
+		}, WithStrictConversion())
+		So(err, ShouldBeNil)
+
+		Convey("When passing a map", func() {
+			v, err := f.Call(ctx, data.Map{"name": data.String("a")})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should return the struct as a map", func() {
+				So(v, ShouldResemble, data.Map{"label": data.String("a"), "value": data.Float(0)})
+			})
+		})
+
+		Convey("When passing null", func() {
+			v, err := f.Call(ctx, data.Null{})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should receive nil", func() {
+				So(v, ShouldResemble, data.Null{})
+			})
+		})
+
+		Convey("When passing a map having an unknown key", func() {
+			_, err := f.Call(ctx, data.Map{"name": data.String("a"), "unknown": data.Null{}})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestGenericFuncOptions(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a function receiving an int and a string", t, func() {
+		fun := func(i int, s string) string {
+			return fmt.Sprint(s, i)
+		}
+
+		Convey("When converting it without options", func() {
+			f, err := ConvertGeneric(fun)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should convert arguments weakly", func() {
+				v, err := f.Call(ctx, data.String("1"), data.Int(2))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.String("21"))
+			})
+
+			Convey("Then it should not be deterministic", func() {
+				d, ok := f.(Deterministic)
+				So(ok, ShouldBeTrue)
+				So(d.IsDeterministic(), ShouldBeFalse)
+			})
+		})
+
+		Convey("When converting it with WithStrictConversion", func() {
+			f, err := ConvertGeneric(fun, WithStrictConversion())
+			So(err, ShouldBeNil)
+
+			Convey("Then it should accept arguments having exact types", func() {
+				v, err := f.Call(ctx, data.Int(1), data.String("a"))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.String("a1"))
+			})
+
+			Convey("Then it should reject arguments needing conversion", func() {
+				_, err := f.Call(ctx, data.String("1"), data.String("a"))
+				So(err, ShouldNotBeNil)
+				_, err = f.Call(ctx, data.Int(1), data.Int(2))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When converting it with WithDeterministic", func() {
+			f, err := ConvertGeneric(fun, WithDeterministic(true))
+			So(err, ShouldBeNil)
+
+			Convey("Then it should be deterministic", func() {
+				So(f.(Deterministic).IsDeterministic(), ShouldBeTrue)
+			})
+
+			Convey("Then the later option should win", func() {
+				f, err := ConvertGeneric(fun, WithDeterministic(true), WithDeterministic(false))
+				So(err, ShouldBeNil)
+				So(f.(Deterministic).IsDeterministic(), ShouldBeFalse)
+			})
+		})
+
+		Convey("When converting it with WithConverterCache", func() {
+			c := NewConverterCache()
+			f, err := ConvertGeneric(fun, WithConverterCache(c))
+			So(err, ShouldBeNil)
+
+			Convey("Then the cache should have converters of the arguments", func() {
+				So(c.Len(), ShouldEqual, 2)
+			})
+
+			Convey("Then the udf should return a correct value", func() {
+				v, err := f.Call(ctx, data.String("1"), data.Int(2))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.String("21"))
+			})
+
+			Convey("Then another function having the same types should reuse converters", func() {
+				_, err := ConvertGeneric(func(s string, i int) int {
+					return i
+				}, WithConverterCache(c))
+				So(err, ShouldBeNil)
+				So(c.Len(), ShouldEqual, 2)
+			})
+
+			Convey("Then strict converters should be cached separately", func() {
+				g, err := ConvertGeneric(fun, WithConverterCache(c), WithStrictConversion())
+				So(err, ShouldBeNil)
+				So(c.Len(), ShouldEqual, 4)
+
+				_, err = g.Call(ctx, data.String("1"), data.Int(2))
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given an aggregate function", t, func() {
+		fun := func(a []int) int {
+			s := 0
+			for _, i := range a {
+				s += i
+			}
+			return s
+		}
+
+		Convey("When converting it with WithStrictConversion", func() {
+			f, err := ConvertGenericAggregate(fun, []bool{true}, WithStrictConversion())
+			So(err, ShouldBeNil)
+
+			Convey("Then it should reject elements needing conversion", func() {
+				v, err := f.Call(ctx, data.Array{data.Int(1), data.Int(2)})
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(3))
+
+				_, err = f.Call(ctx, data.Array{data.Int(1), data.String("2")})
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
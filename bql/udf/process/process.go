@@ -0,0 +1,304 @@
+package process
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Config has parameters to run an external process implementing a UDF or
+// a UDSF.
+//
+// The process communicates with SensorBee through its stdin and stdout. Each
+// message is a JSON object written in a line. SensorBee writes a request to
+// stdin of the process and the process writes responses to its stdout. Only
+// one request is sent at a time, so a slow process slows down the stream
+// feeding it instead of accumulating unprocessed tuples. Values are encoded
+// in the same way as the JSON representation of tuples, e.g. a timestamp is
+// an RFC3339 string and a blob is a base64 encoded string. See NewUDF and
+// NewUDSFCreator for the messages of each protocol.
+//
+// When the process exits, fails to respond in time, or writes a line which
+// isn't a JSON object, the request fails and the process is killed. The
+// process is started again for the next request as long as it hasn't been
+// restarted more than MaxRestarts times.
+type Config struct {
+	// Path is the path to the executable. When it doesn't contain a path
+	// separator, it's looked up in the directories in PATH.
+	Path string
+
+	// Args has the command line arguments, not including the command name.
+	Args []string
+
+	// Env has environment variables of the process in the form of
+	// "key=value". When it's nil, the process uses the environment of
+	// SensorBee.
+	Env []string
+
+	// Dir is the working directory of the process. When it's empty, the
+	// process runs in the current directory of SensorBee.
+	Dir string
+
+	// Stderr receives the stderr of the process. It's discarded when Stderr
+	// is nil.
+	Stderr io.Writer
+
+	// Timeout is the maximum duration to wait for the response to a request.
+	// There's no timeout when it's 0.
+	Timeout time.Duration
+
+	// MaxRestarts is the maximum number of times the process is restarted.
+	// The process isn't restarted when it's 0 and it's always restarted when
+	// it's negative.
+	MaxRestarts int
+}
+
+// terminationTimeout is the duration to wait for a process to exit after its
+// stdin was closed before the process is killed.
+var terminationTimeout = 3 * time.Second
+
+// process is a running external process.
+type process struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan []byte
+	exit  chan struct{}
+	err   error // set before lines is closed
+}
+
+func startProcess(config *Config) (*process, error) {
+	cmd := exec.Command(config.Path, config.Args...)
+	cmd.Env = config.Env
+	cmd.Dir = config.Dir
+	cmd.Stderr = config.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot start the process: %v", err)
+	}
+
+	p := &process{
+		cmd:   cmd,
+		stdin: stdin,
+		lines: make(chan []byte),
+		exit:  make(chan struct{}),
+	}
+	go func() {
+		defer close(p.lines)
+		r := bufio.NewReader(stdout)
+		for {
+			line, err := r.ReadBytes('\n')
+			if len(line) > 0 {
+				select {
+				case p.lines <- line:
+				case <-p.exit:
+					return
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = errors.New("the process closed its stdout")
+				}
+				p.err = err
+				return
+			}
+		}
+	}()
+	return p, nil
+}
+
+// kill kills the process and waits for its exit.
+func (p *process) kill() {
+	close(p.exit)
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	p.cmd.Wait()
+}
+
+// stop closes stdin of the process and waits for its exit. The process is
+// killed when it doesn't exit in terminationTimeout.
+func (p *process) stop() error {
+	close(p.exit)
+	p.stdin.Close()
+	done := make(chan error, 1)
+	go func() {
+		done <- p.cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(terminationTimeout):
+		p.cmd.Process.Kill()
+		<-done
+		return errors.New("the process was killed because it didn't exit")
+	}
+}
+
+// conn sends requests to a process and restarts the process when necessary.
+type conn struct {
+	config Config
+
+	// init is called every time after the process is started. It can send
+	// requests to the process.
+	init func(c *conn) error
+
+	m        sync.Mutex
+	p        *process
+	restarts int
+	closed   bool
+}
+
+func newConn(config *Config, init func(c *conn) error) (*conn, error) {
+	if config.Path == "" {
+		return nil, errors.New("the path to the executable must be given")
+	}
+	c := &conn{
+		config: *config,
+		init:   init,
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	if err := c.start(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// start starts the process. The caller must hold the lock.
+func (c *conn) start() error {
+	p, err := startProcess(&c.config)
+	if err != nil {
+		return err
+	}
+	c.p = p
+	if c.init != nil {
+		if err := c.init(c); err != nil {
+			if c.p != nil {
+				c.p.kill()
+				c.p = nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureProcess starts the process again when it isn't running. The caller
+// must hold the lock.
+func (c *conn) ensureProcess() error {
+	if c.closed {
+		return errors.New("the process has already been terminated")
+	}
+	if c.p != nil {
+		return nil
+	}
+	if c.config.MaxRestarts >= 0 && c.restarts >= c.config.MaxRestarts {
+		return fmt.Errorf("the process has exited and cannot be restarted more than %v times",
+			c.config.MaxRestarts)
+	}
+	c.restarts++
+	return c.start()
+}
+
+// request sends a request to the process and passes responses to handle
+// until it returns true or an error. When the process doesn't respond
+// properly, it's killed. The caller must hold the lock.
+func (c *conn) request(req data.Map, handle func(res data.Map) (bool, error)) error {
+	if err := c.ensureProcess(); err != nil {
+		return err
+	}
+	if err := c.doRequest(req, handle); err != nil {
+		if _, ok := err.(*responseError); !ok && c.p != nil {
+			c.p.kill()
+			c.p = nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *conn) doRequest(req data.Map, handle func(res data.Map) (bool, error)) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("cannot encode the request: %v", err)
+	}
+	if _, err := c.p.stdin.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("cannot write the request to the process: %v", err)
+	}
+
+	var timeout <-chan time.Time
+	if c.config.Timeout > 0 {
+		timer := time.NewTimer(c.config.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		var line []byte
+		select {
+		case l, ok := <-c.p.lines:
+			if !ok {
+				return fmt.Errorf("cannot read the response from the process: %v", c.p.err)
+			}
+			line = l
+		case <-timeout:
+			return fmt.Errorf("the process didn't respond in %v", c.config.Timeout)
+		}
+
+		res, err := data.UnmarshalJSONMap(line, data.JSONNumberPreserve)
+		if err != nil {
+			return fmt.Errorf("the response of the process isn't a JSON object: %v", err)
+		}
+		if e, ok := res["error"]; ok {
+			msg, err := data.AsString(e)
+			if err != nil {
+				msg = e.String()
+			}
+			return &responseError{msg}
+		}
+		done, err := handle(res)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// close stops the process.
+func (c *conn) close() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.p == nil {
+		return nil
+	}
+	err := c.p.stop()
+	c.p = nil
+	return err
+}
+
+// responseError is an error reported by the process. The process can still
+// handle later requests.
+type responseError struct {
+	msg string
+}
+
+func (e *responseError) Error() string {
+	return e.msg
+}
@@ -0,0 +1,127 @@
+package process
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess isn't a real test. It's run as an external process by
+// other tests.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("SENSORBEE_PROCESS_TEST_HELPER") != "1" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "no mode is given")
+		os.Exit(2)
+	}
+	switch args[1] {
+	case "udf":
+		helperUDF()
+	case "udsf":
+		helperUDSF()
+	default:
+		fmt.Fprintln(os.Stderr, "unknown mode:", args[1])
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+type helperMessage struct {
+	Args  []interface{}          `json:"args"`
+	Input string                 `json:"input"`
+	Tuple map[string]interface{} `json:"tuple"`
+}
+
+func helperRespond(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	os.Stdout.Write(append(b, '\n'))
+}
+
+// helperUDF returns arguments as an array. When the first argument is a
+// string, it changes the behavior of the process.
+func helperUDF() {
+	s := bufio.NewScanner(os.Stdin)
+	for s.Scan() {
+		var msg helperMessage
+		if err := json.Unmarshal(s.Bytes(), &msg); err != nil {
+			panic(err)
+		}
+		if len(msg.Args) > 0 {
+			switch msg.Args[0] {
+			case "error":
+				helperRespond(map[string]interface{}{"error": "failed"})
+				continue
+			case "exit":
+				os.Exit(1)
+			case "hang":
+				time.Sleep(time.Hour)
+			case "invalid":
+				fmt.Println("not a json object")
+				continue
+			case "no_result":
+				helperRespond(map[string]interface{}{})
+				continue
+			}
+		}
+		helperRespond(map[string]interface{}{"result": msg.Args})
+	}
+}
+
+// helperUDSF emits n tuples for each input tuple having n in "n" field. It
+// fails to start when the first argument is "fail".
+func helperUDSF() {
+	s := bufio.NewScanner(os.Stdin)
+	if !s.Scan() {
+		return
+	}
+	var init helperMessage
+	if err := json.Unmarshal(s.Bytes(), &init); err != nil {
+		panic(err)
+	}
+	if len(init.Args) > 0 && init.Args[0] == "fail" {
+		helperRespond(map[string]interface{}{"error": "cannot start"})
+		return
+	}
+	helperRespond(map[string]interface{}{"done": true})
+
+	for s.Scan() {
+		var msg helperMessage
+		if err := json.Unmarshal(s.Bytes(), &msg); err != nil {
+			panic(err)
+		}
+		if _, ok := msg.Tuple["exit"]; ok {
+			os.Exit(1)
+		}
+		n, _ := msg.Tuple["n"].(float64)
+		for i := 0; i < int(n); i++ {
+			helperRespond(map[string]interface{}{
+				"tuple": map[string]interface{}{"i": i, "input": msg.Input, "args": init.Args},
+			})
+		}
+		if _, ok := msg.Tuple["error"]; ok {
+			helperRespond(map[string]interface{}{"error": "failed"})
+			continue
+		}
+		helperRespond(map[string]interface{}{"done": true})
+	}
+}
+
+func helperConfig(mode string) *Config {
+	return &Config{
+		Path: os.Args[0],
+		Args: []string{"-test.run=TestHelperProcess", "--", mode},
+		Env:  append(os.Environ(), "SENSORBEE_PROCESS_TEST_HELPER=1"),
+	}
+}
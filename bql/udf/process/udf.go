@@ -0,0 +1,90 @@
+package process
+
+import (
+	"errors"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// UDF is a UDF implemented by an external process. It can be registered
+// to a FunctionRegistry like other UDFs:
+//
+//	f, err := process.NewUDF(&process.Config{
+//		Path: "python3",
+//		Args: []string{"/opt/models/predict.py"},
+//	}, 2)
+//	if err != nil {
+//		...
+//	}
+//	udf.MustRegisterGlobalUDF("predict", f)
+//
+// For each call, the process receives a line having arguments as an array:
+//
+//	{"args":[1.5,"a"]}
+//
+// and writes a line having the result of the call or an error message:
+//
+//	{"result":0.8}
+//	{"error":"the model isn't loaded"}
+//
+// An error reported by the process only fails the call and the process keeps
+// handling later calls.
+//
+// Calls are serialized because the process handles one request at a time.
+// The process is stopped when Close is called.
+type UDF struct {
+	c *conn
+
+	// arity is the number of parameters. It's negative when the function is
+	// variadic.
+	arity int
+}
+
+// NewUDF starts a process and returns a UDF calling it. The UDF accepts arity
+// arguments, or any number of arguments when arity is negative.
+func NewUDF(config *Config, arity int) (*UDF, error) {
+	c, err := newConn(config, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &UDF{
+		c:     c,
+		arity: arity,
+	}, nil
+}
+
+// Call sends arguments to the process and returns the result.
+func (f *UDF) Call(ctx *core.Context, args ...data.Value) (data.Value, error) {
+	f.c.m.Lock()
+	defer f.c.m.Unlock()
+
+	var ret data.Value
+	err := f.c.request(data.Map{"args": data.Array(args)}, func(res data.Map) (bool, error) {
+		v, ok := res["result"]
+		if !ok {
+			return false, errors.New("the process didn't return 'result' nor 'error'")
+		}
+		ret = v
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Accept returns true when the UDF accepts the given number of arguments.
+func (f *UDF) Accept(arity int) bool {
+	return f.arity < 0 || f.arity == arity
+}
+
+// IsAggregationParameter returns false because the UDF doesn't receive
+// aggregated values.
+func (f *UDF) IsAggregationParameter(k int) bool {
+	return false
+}
+
+// Close stops the process. The UDF cannot be called after it's closed.
+func (f *UDF) Close() error {
+	return f.c.close()
+}
@@ -0,0 +1,122 @@
+package process
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestUDF(t *testing.T) {
+	Convey("Given a UDF implemented by a process", t, func() {
+		config := helperConfig("udf")
+		config.Timeout = 10 * time.Second
+		config.MaxRestarts = 1
+		f, err := NewUDF(config, 2)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			f.Close()
+		})
+
+		Convey("Then it should only accept the number of arguments", func() {
+			So(f.Accept(2), ShouldBeTrue)
+			So(f.Accept(1), ShouldBeFalse)
+		})
+
+		Convey("When calling it", func() {
+			v, err := f.Call(nil, data.Int(1), data.Map{"a": data.String("b")})
+
+			Convey("Then it should return the result", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Array{data.Int(1), data.Map{"a": data.String("b")}})
+			})
+		})
+
+		Convey("When the process returns an error", func() {
+			_, err := f.Call(nil, data.String("error"), data.Null{})
+
+			Convey("Then the call should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "failed")
+			})
+
+			Convey("And the process should handle the next call", func() {
+				v, err := f.Call(nil, data.Int(1), data.Int(2))
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Array{data.Int(1), data.Int(2)})
+			})
+		})
+
+		for _, c := range []string{"exit", "invalid", "no_result"} {
+			c := c
+			Convey("When the process fails with "+c, func() {
+				_, err := f.Call(nil, data.String(c), data.Null{})
+
+				Convey("Then the call should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+
+				Convey("And the process should be restarted for the next call", func() {
+					v, err := f.Call(nil, data.Int(1), data.Int(2))
+					So(err, ShouldBeNil)
+					So(v, ShouldResemble, data.Array{data.Int(1), data.Int(2)})
+
+					Convey("But it shouldn't be restarted more than MaxRestarts", func() {
+						_, err := f.Call(nil, data.String(c), data.Null{})
+						So(err, ShouldNotBeNil)
+						_, err = f.Call(nil, data.Int(1), data.Int(2))
+						So(err, ShouldNotBeNil)
+					})
+				})
+			})
+		}
+
+		Convey("When closing it", func() {
+			So(f.Close(), ShouldBeNil)
+
+			Convey("Then it cannot be called", func() {
+				_, err := f.Call(nil, data.Int(1), data.Int(2))
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a UDF implemented by a process which doesn't respond", t, func() {
+		config := helperConfig("udf")
+		config.Timeout = 100 * time.Millisecond
+		f, err := NewUDF(config, -1)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			f.Close()
+		})
+
+		Convey("Then it should accept any number of arguments", func() {
+			So(f.Accept(0), ShouldBeTrue)
+			So(f.Accept(3), ShouldBeTrue)
+		})
+
+		Convey("When calling it", func() {
+			_, err := f.Call(nil, data.String("hang"))
+
+			Convey("Then it should time out", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "respond")
+			})
+		})
+	})
+
+	Convey("Given invalid configurations", t, func() {
+		for _, c := range []*Config{
+			{},
+			{Path: "/no/such/executable"},
+		} {
+			Convey("When creating a UDF with "+c.Path, func() {
+				_, err := NewUDF(c, 1)
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
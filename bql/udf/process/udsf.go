@@ -0,0 +1,125 @@
+package process
+
+import (
+	"errors"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+type udsfCreator struct {
+	config Config
+}
+
+// NewUDSFCreator returns a UDSFCreator which starts a process for each UDSF.
+// The first argument of the UDSF is the name of the input stream and the rest
+// of arguments are passed to the process:
+//
+//	udf.MustRegisterGlobalUDSFCreator("detect_anomaly", process.NewUDSFCreator(&process.Config{
+//		Path: "python3",
+//		Args: []string{"/opt/models/anomaly.py"},
+//	}))
+//
+//	SELECT RSTREAM * FROM detect_anomaly("sensors", 0.9) [RANGE 1 TUPLES];
+//
+// Right after the process is started, it receives a line having arguments
+// other than the input stream name:
+//
+//	{"args":[0.9]}
+//
+// and writes {"done":true} when it's ready or an error message. Then, for
+// each input tuple, the process receives a line having the input name and the
+// data of the tuple:
+//
+//	{"input":"sensors","tuple":{"temp":30.2}}
+//
+// and writes zero or more tuples followed by {"done":true}:
+//
+//	{"tuple":{"temp":30.2,"score":0.95}}
+//	{"done":true}
+//
+// The process can write an error message instead of {"done":true} to report
+// an error. Tuples written before the error are still emitted. When the
+// process is restarted, it receives the arguments again.
+func NewUDSFCreator(config *Config) udf.UDSFCreator {
+	return &udsfCreator{
+		config: *config,
+	}
+}
+
+func (c *udsfCreator) CreateUDSF(ctx *core.Context, decl udf.UDSFDeclarer, args ...data.Value) (udf.UDSF, error) {
+	if len(args) < 1 {
+		return nil, errors.New("the name of the input stream must be given")
+	}
+	input, err := data.AsString(args[0])
+	if err != nil {
+		return nil, errors.New("the name of the input stream must be a string")
+	}
+	if err := decl.Input(input, nil); err != nil {
+		return nil, err
+	}
+
+	initReq := data.Map{"args": data.Array(args[1:])}
+	conn, err := newConn(&c.config, func(conn *conn) error {
+		return conn.doRequest(initReq, func(res data.Map) (bool, error) {
+			if err := checkDone(res); err != nil {
+				return false, err
+			}
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &udsf{c: conn}, nil
+}
+
+func (c *udsfCreator) Accept(arity int) bool {
+	return arity >= 1
+}
+
+// checkDone returns an error when res isn't {"done":true}.
+func checkDone(res data.Map) error {
+	v, ok := res["done"]
+	if !ok {
+		return errors.New("the process didn't return 'tuple', 'done', nor 'error'")
+	}
+	if b, err := data.AsBool(v); err != nil || !b {
+		return errors.New("'done' must be true")
+	}
+	return nil
+}
+
+type udsf struct {
+	c *conn
+}
+
+func (u *udsf) Process(ctx *core.Context, t *core.Tuple, w core.Writer) error {
+	u.c.m.Lock()
+	defer u.c.m.Unlock()
+
+	req := data.Map{
+		"input": data.String(t.InputName),
+		"tuple": t.Data,
+	}
+	return u.c.request(req, func(res data.Map) (bool, error) {
+		v, ok := res["tuple"]
+		if !ok {
+			return true, checkDone(res)
+		}
+		m, err := data.AsMap(v)
+		if err != nil {
+			return false, errors.New("'tuple' must be a map")
+		}
+		out := t.Copy()
+		out.Data = m
+		if err := w.Write(ctx, out); err != nil {
+			return false, err
+		}
+		return false, nil
+	})
+}
+
+func (u *udsf) Terminate(ctx *core.Context) error {
+	return u.c.close()
+}
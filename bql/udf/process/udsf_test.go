@@ -0,0 +1,106 @@
+package process
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestUDSF(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a UDSF creator implemented by a process", t, func() {
+		config := helperConfig("udsf")
+		config.Timeout = 10 * time.Second
+		config.MaxRestarts = -1
+		c := NewUDSFCreator(config)
+
+		Convey("Then it should require the input stream name", func() {
+			So(c.Accept(0), ShouldBeFalse)
+			So(c.Accept(1), ShouldBeTrue)
+			So(c.Accept(3), ShouldBeTrue)
+		})
+
+		Convey("When creating a UDSF", func() {
+			decl := udf.NewUDSFDeclarer()
+			f, err := c.CreateUDSF(ctx, decl, data.String("input_stream"), data.Int(1))
+			So(err, ShouldBeNil)
+			Reset(func() {
+				f.Terminate(ctx)
+			})
+
+			Convey("Then it should declare the input", func() {
+				So(decl.ListInputs(), ShouldContainKey, "input_stream")
+			})
+
+			var written []*core.Tuple
+			w := core.WriterFunc(func(ctx *core.Context, t *core.Tuple) error {
+				written = append(written, t)
+				return nil
+			})
+			in := core.NewTuple(data.Map{"n": data.Int(2)})
+			in.InputName = "*"
+
+			Convey("Then it should emit tuples written by the process", func() {
+				So(f.Process(ctx, in, w), ShouldBeNil)
+				So(len(written), ShouldEqual, 2)
+				for i, t := range written {
+					So(t.Data, ShouldResemble, data.Map{
+						"i":     data.Int(i),
+						"input": data.String("*"),
+						"args":  data.Array{data.Int(1)},
+					})
+					So(t.Timestamp, ShouldResemble, in.Timestamp)
+				}
+			})
+
+			Convey("Then it should emit nothing when the process writes no tuple", func() {
+				So(f.Process(ctx, core.NewTuple(data.Map{}), w), ShouldBeNil)
+				So(written, ShouldBeEmpty)
+			})
+
+			Convey("Then it should fail when the process returns an error", func() {
+				in.Data["error"] = data.True
+				So(f.Process(ctx, in, w), ShouldNotBeNil)
+				So(len(written), ShouldEqual, 2)
+
+				Convey("And it should process the next tuple", func() {
+					So(f.Process(ctx, core.NewTuple(data.Map{"n": data.Int(1)}), w), ShouldBeNil)
+					So(len(written), ShouldEqual, 3)
+				})
+			})
+
+			Convey("Then it should restart the process after it exited", func() {
+				So(f.Process(ctx, core.NewTuple(data.Map{"exit": data.True}), w), ShouldNotBeNil)
+				So(f.Process(ctx, in, w), ShouldBeNil)
+				So(len(written), ShouldEqual, 2)
+				So(written[0].Data["args"], ShouldResemble, data.Array{data.Int(1)})
+			})
+
+			Convey("Then it should fail after it's terminated", func() {
+				So(f.Terminate(ctx), ShouldBeNil)
+				So(f.Process(ctx, in, w), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When creating a UDSF failing to start", func() {
+			_, err := c.CreateUDSF(ctx, udf.NewUDSFDeclarer(), data.String("input_stream"), data.String("fail"))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "cannot start")
+			})
+		})
+
+		Convey("When creating a UDSF with an invalid input stream name", func() {
+			_, err := c.CreateUDSF(ctx, udf.NewUDSFDeclarer(), data.Int(1))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
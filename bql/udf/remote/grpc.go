@@ -0,0 +1,368 @@
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	udf.MustRegisterGlobalUDFCreator("grpc", udf.UDFCreatorFunc(createGRPCUDF))
+}
+
+func createGRPCUDF(ctx *core.Context, params data.Map) (udf.UDF, error) {
+	config := DefaultGRPCConfig
+	if err := data.Decode(params, &config); err != nil {
+		return nil, err
+	}
+	return NewGRPCUDF(&config)
+}
+
+// DefaultGRPCMethod is the full name of the method called by GRPCUDF by
+// default.
+const DefaultGRPCMethod = "/sensorbee.udf.RemoteFunction/Call"
+
+// GRPCConfig has parameters of GRPCUDF. It's decoded from parameters given
+// in WITH clause of CREATE FUNCTION statement:
+//
+//	CREATE FUNCTION predict TYPE grpc
+//	  WITH address="model-server:50051", batch_size=32, timeout=1.5;
+type GRPCConfig struct {
+	// Address is the address of the server, e.g. "localhost:50051". It
+	// accepts any target supported by gRPC.
+	Address string `bql:",required"`
+
+	// Method is the full name of the method called by the UDF. The default
+	// value is DefaultGRPCMethod.
+	Method string
+
+	// TLS enables TLS verified with the system's root certificates.
+	TLS bool
+
+	// Timeout is the maximum duration of each request. There's no timeout
+	// when it's 0. The default value is 10 seconds.
+	Timeout time.Duration
+
+	// BatchSize is the maximum number of calls sent in a request. The
+	// default value is 64.
+	BatchSize int
+
+	// BatchWait is the duration to wait for other calls to fill a batch
+	// after the first call of the batch. Calls made while all requests are
+	// in flight are batched even when BatchWait is 0, which is the default.
+	BatchWait time.Duration
+
+	// PoolSize is the number of connections to the server. Requests are
+	// distributed to connections in a round robin manner. The default value
+	// is 1.
+	PoolSize int
+
+	// MaxInFlight is the maximum number of concurrent requests. The default
+	// value is 4.
+	MaxInFlight int
+}
+
+// DefaultGRPCConfig has the default values of GRPCConfig.
+var DefaultGRPCConfig = GRPCConfig{
+	Method:      DefaultGRPCMethod,
+	Timeout:     10 * time.Second,
+	BatchSize:   64,
+	PoolSize:    1,
+	MaxInFlight: 4,
+}
+
+// GRPCUDF is a UDF calling a function on a gRPC server. It accepts any number
+// of arguments.
+//
+// Calls made concurrently are sent to the server in a batch. A request is a
+// google.protobuf.BytesValue having a msgpack encoded map which has arguments
+// of each call as an array in "calls" field:
+//
+//	{"calls": [[1.5, "a"], [2.5, "b"]]}
+//
+// The response is also a google.protobuf.BytesValue having a msgpack encoded
+// map which has results of the calls in the same order in "results" field.
+// Each result is a map having the return value in "result" field or an error
+// message in "error" field:
+//
+//	{"results": [{"result": 0.8}, {"error": "invalid input"}]}
+//
+// The response can be a map only having "error" field to fail all calls in
+// the batch. Because only well-known protobuf types are used, a server can be
+// implemented in any language supported by gRPC without compiling service
+// definitions of SensorBee.
+//
+// A GRPCUDF created by CREATE FUNCTION statement lives as long as the
+// process. Close must be called when the UDF is created by NewGRPCUDF and
+// becomes unnecessary.
+type GRPCUDF struct {
+	config GRPCConfig
+	conns  []*grpc.ClientConn
+	next   uint32
+
+	calls    chan *grpcCall
+	inFlight chan struct{}
+	done     chan struct{}
+	closeMu  sync.Mutex
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+type grpcCall struct {
+	args data.Array
+	res  chan grpcResult
+}
+
+type grpcResult struct {
+	v   data.Value
+	err error
+}
+
+// NewGRPCUDF creates a new GRPCUDF. It doesn't wait for connections to be
+// established.
+func NewGRPCUDF(config *GRPCConfig) (*GRPCUDF, error) {
+	c := *config
+	if c.Address == "" {
+		return nil, errors.New("address must be given")
+	}
+	if c.Method == "" {
+		c.Method = DefaultGRPCMethod
+	}
+	if c.Timeout < 0 {
+		return nil, errors.New("timeout must not be negative")
+	}
+	if c.BatchSize <= 0 {
+		return nil, errors.New("batch_size must be positive")
+	}
+	if c.BatchWait < 0 {
+		return nil, errors.New("batch_wait must not be negative")
+	}
+	if c.PoolSize <= 0 {
+		return nil, errors.New("pool_size must be positive")
+	}
+	if c.MaxInFlight <= 0 {
+		return nil, errors.New("max_in_flight must be positive")
+	}
+
+	creds := insecure.NewCredentials()
+	if c.TLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	f := &GRPCUDF{
+		config:   c,
+		calls:    make(chan *grpcCall),
+		inFlight: make(chan struct{}, c.MaxInFlight),
+		done:     make(chan struct{}),
+	}
+	for i := 0; i < c.PoolSize; i++ {
+		conn, err := grpc.NewClient(c.Address, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			f.closeConns()
+			return nil, fmt.Errorf("cannot connect to %v: %v", c.Address, err)
+		}
+		f.conns = append(f.conns, conn)
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.batch()
+	}()
+	return f, nil
+}
+
+// batch collects calls into batches and sends them. A new batch is started
+// only when the number of requests in flight is less than MaxInFlight so
+// that calls made while waiting for responses are sent together.
+func (f *GRPCUDF) batch() {
+	for {
+		select {
+		case f.inFlight <- struct{}{}:
+		case <-f.done:
+			return
+		}
+
+		var calls []*grpcCall
+		select {
+		case c := <-f.calls:
+			calls = f.collect(c)
+		case <-f.done:
+			return
+		}
+
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			defer func() {
+				<-f.inFlight
+			}()
+			f.send(calls)
+		}()
+	}
+}
+
+// collect returns a batch starting with the given call. It waits for other
+// calls for BatchWait.
+func (f *GRPCUDF) collect(first *grpcCall) []*grpcCall {
+	calls := []*grpcCall{first}
+	if f.config.BatchWait == 0 {
+		for len(calls) < f.config.BatchSize {
+			select {
+			case c := <-f.calls:
+				calls = append(calls, c)
+			default:
+				return calls
+			}
+		}
+		return calls
+	}
+
+	timer := time.NewTimer(f.config.BatchWait)
+	defer timer.Stop()
+	for len(calls) < f.config.BatchSize {
+		select {
+		case c := <-f.calls:
+			calls = append(calls, c)
+		case <-timer.C:
+			return calls
+		}
+	}
+	return calls
+}
+
+func (f *GRPCUDF) send(calls []*grpcCall) {
+	results, err := f.request(calls)
+	for i, c := range calls {
+		if err != nil {
+			c.res <- grpcResult{err: err}
+		} else {
+			c.res <- results[i]
+		}
+	}
+}
+
+func (f *GRPCUDF) request(calls []*grpcCall) ([]grpcResult, error) {
+	args := make(data.Array, len(calls))
+	for i, c := range calls {
+		args[i] = c.args
+	}
+	b, err := data.MarshalMsgpack(data.Map{"calls": args})
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode arguments: %v", err)
+	}
+
+	ctx := context.Background()
+	if f.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.config.Timeout)
+		defer cancel()
+	}
+	conn := f.conns[int(atomic.AddUint32(&f.next, 1))%len(f.conns)]
+	out := &wrapperspb.BytesValue{}
+	if err := conn.Invoke(ctx, f.config.Method, wrapperspb.Bytes(b), out); err != nil {
+		return nil, err
+	}
+
+	res, err := data.UnmarshalMsgpack(out.Value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode the response: %v", err)
+	}
+	if e, ok := res["error"]; ok {
+		return nil, responseError(e)
+	}
+	v, ok := res["results"]
+	if !ok {
+		return nil, errors.New("the response has neither 'results' nor 'error'")
+	}
+	rs, err := data.AsArray(v)
+	if err != nil || len(rs) != len(calls) {
+		return nil, fmt.Errorf("'results' must be an array having %v elements", len(calls))
+	}
+
+	results := make([]grpcResult, len(rs))
+	for i, r := range rs {
+		m, err := data.AsMap(r)
+		if err != nil {
+			results[i].err = errors.New("each result must be a map")
+			continue
+		}
+		if e, ok := m["error"]; ok {
+			results[i].err = responseError(e)
+		} else if v, ok := m["result"]; ok {
+			results[i].v = v
+		} else {
+			results[i].err = errors.New("the result has neither 'result' nor 'error'")
+		}
+	}
+	return results, nil
+}
+
+func responseError(e data.Value) error {
+	if s, err := data.AsString(e); err == nil {
+		return errors.New(s)
+	}
+	return errors.New(e.String())
+}
+
+// Call sends arguments to the server and returns the result. It blocks until
+// the batch having the call is processed.
+func (f *GRPCUDF) Call(ctx *core.Context, args ...data.Value) (data.Value, error) {
+	c := &grpcCall{
+		args: data.Array(args),
+		res:  make(chan grpcResult, 1),
+	}
+	select {
+	case f.calls <- c:
+	case <-f.done:
+		return nil, errors.New("the function has already been closed")
+	}
+	r := <-c.res
+	return r.v, r.err
+}
+
+// Accept returns true for any arity.
+func (f *GRPCUDF) Accept(arity int) bool {
+	return true
+}
+
+// IsAggregationParameter returns false because the UDF doesn't receive
+// aggregated values.
+func (f *GRPCUDF) IsAggregationParameter(k int) bool {
+	return false
+}
+
+// Close waits for requests in flight and closes connections to the server.
+func (f *GRPCUDF) Close() error {
+	f.closeMu.Lock()
+	if f.closed {
+		f.closeMu.Unlock()
+		return nil
+	}
+	f.closed = true
+	close(f.done)
+	f.closeMu.Unlock()
+
+	f.wg.Wait()
+	return f.closeConns()
+}
+
+func (f *GRPCUDF) closeConns() error {
+	var err error
+	for _, c := range f.conns {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
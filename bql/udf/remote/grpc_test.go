@@ -0,0 +1,276 @@
+package remote
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer handles all methods by a function receiving decoded requests.
+type testServer struct {
+	addr   string
+	server *grpc.Server
+
+	m       sync.Mutex
+	methods []string
+	batches []int
+}
+
+func newTestServer(handle func(req data.Map) data.Map) (*testServer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &testServer{addr: l.Addr().String()}
+	s.server = grpc.NewServer(grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		in := &wrapperspb.BytesValue{}
+		if err := stream.RecvMsg(in); err != nil {
+			return err
+		}
+		req, err := data.UnmarshalMsgpack(in.Value)
+		if err != nil {
+			return err
+		}
+		calls, _ := data.AsArray(req["calls"])
+		s.m.Lock()
+		s.methods = append(s.methods, method)
+		s.batches = append(s.batches, len(calls))
+		s.m.Unlock()
+
+		b, err := data.MarshalMsgpack(handle(req))
+		if err != nil {
+			return err
+		}
+		return stream.SendMsg(wrapperspb.Bytes(b))
+	}))
+	go s.server.Serve(l)
+	return s, nil
+}
+
+func (s *testServer) stats() ([]string, []int) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]string{}, s.methods...), append([]int{}, s.batches...)
+}
+
+// sumHandler returns the sum of integer arguments of each call. A call having
+// a string argument fails with the string as the error message.
+func sumHandler(req data.Map) data.Map {
+	calls, _ := data.AsArray(req["calls"])
+	results := make(data.Array, len(calls))
+	for i, c := range calls {
+		args, _ := data.AsArray(c)
+		sum := int64(0)
+		var res data.Value
+		for _, a := range args {
+			if s, err := data.AsString(a); err == nil {
+				res = data.Map{"error": data.String(s)}
+				break
+			}
+			n, _ := data.AsInt(a)
+			sum += n
+		}
+		if res == nil {
+			res = data.Map{"result": data.Int(sum)}
+		}
+		results[i] = res
+	}
+	return data.Map{"results": results}
+}
+
+func TestGRPCUDF(t *testing.T) {
+	Convey("Given a gRPC server", t, func() {
+		s, err := newTestServer(sumHandler)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.server.Stop()
+		})
+
+		Convey("When creating a UDF by the registered creator", func() {
+			c, err := udf.LookupGlobalUDFCreator("GRPC")
+			So(err, ShouldBeNil)
+			f, err := c.CreateUDF(nil, data.Map{
+				"address":    data.String(s.addr),
+				"method":     data.String("/test.Func/Sum"),
+				"timeout":    data.Float(5),
+				"batch_size": data.Int(8),
+				"pool_size":  data.Int(2),
+			})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				f.(*GRPCUDF).Close()
+			})
+
+			Convey("Then it should accept any number of arguments", func() {
+				So(f.Accept(0), ShouldBeTrue)
+				So(f.Accept(5), ShouldBeTrue)
+			})
+
+			Convey("Then calling it should return the result from the server", func() {
+				v, err := f.Call(nil, data.Int(1), data.Int(2), data.Int(3))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(6))
+
+				methods, _ := s.stats()
+				So(methods, ShouldResemble, []string{"/test.Func/Sum"})
+			})
+
+			Convey("Then a call failing on the server should return the error", func() {
+				_, err := f.Call(nil, data.Int(1), data.String("bad input"))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "bad input")
+			})
+		})
+
+		Convey("When calling a UDF concurrently", func() {
+			f, err := NewGRPCUDF(&GRPCConfig{
+				Address:     s.addr,
+				BatchSize:   10,
+				BatchWait:   50 * time.Millisecond,
+				PoolSize:    1,
+				MaxInFlight: 1,
+			})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				f.Close()
+			})
+
+			var wg sync.WaitGroup
+			errs := make([]error, 20)
+			for i := range errs {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					v, err := f.Call(nil, data.Int(i), data.Int(1))
+					if err == nil && v != data.Int(i+1) {
+						err = fmt.Errorf("unexpected result: %v", v)
+					}
+					errs[i] = err
+				}(i)
+			}
+			wg.Wait()
+
+			Convey("Then all calls should succeed", func() {
+				for _, err := range errs {
+					So(err, ShouldBeNil)
+				}
+			})
+
+			Convey("Then calls should be sent in batches", func() {
+				methods, batches := s.stats()
+				So(methods[0], ShouldEqual, DefaultGRPCMethod)
+				So(len(batches), ShouldBeLessThan, len(errs))
+				total := 0
+				for _, b := range batches {
+					So(b, ShouldBeLessThanOrEqualTo, 10)
+					total += b
+				}
+				So(total, ShouldEqual, len(errs))
+			})
+		})
+
+		Convey("When calling a closed UDF", func() {
+			f, err := NewGRPCUDF(&GRPCConfig{
+				Address:     s.addr,
+				BatchSize:   1,
+				PoolSize:    1,
+				MaxInFlight: 1,
+			})
+			So(err, ShouldBeNil)
+			So(f.Close(), ShouldBeNil)
+			_, err = f.Call(nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a gRPC server returning invalid responses", t, func() {
+		cases := []struct {
+			title string
+			res   data.Map
+		}{
+			{"an error", data.Map{"error": data.String("unavailable")}},
+			{"no results", data.Map{}},
+			{"a wrong number of results", data.Map{"results": data.Array{}}},
+			{"an invalid result", data.Map{"results": data.Array{data.Int(1)}}},
+			{"an empty result", data.Map{"results": data.Array{data.Map{}}}},
+		}
+		for _, c := range cases {
+			c := c
+			Convey("When the server returns "+c.title, func() {
+				s, err := newTestServer(func(data.Map) data.Map {
+					return c.res
+				})
+				So(err, ShouldBeNil)
+				Reset(func() {
+					s.server.Stop()
+				})
+				config := DefaultGRPCConfig
+				config.Address = s.addr
+				f, err := NewGRPCUDF(&config)
+				So(err, ShouldBeNil)
+				Reset(func() {
+					f.Close()
+				})
+
+				Convey("Then the call should fail", func() {
+					_, err := f.Call(nil, data.Int(1))
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+
+	Convey("Given a UDF connecting to a server which doesn't respond", t, func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			l.Close()
+		})
+		config := DefaultGRPCConfig
+		config.Address = l.Addr().String()
+		config.Timeout = 100 * time.Millisecond
+		f, err := NewGRPCUDF(&config)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			f.Close()
+		})
+
+		Convey("When calling it", func() {
+			_, err := f.Call(nil, data.Int(1))
+
+			Convey("Then it should time out", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given invalid parameters", t, func() {
+		c, err := udf.LookupGlobalUDFCreator("grpc")
+		So(err, ShouldBeNil)
+		for _, params := range []data.Map{
+			{},
+			{"address": data.String("localhost:1"), "batch_size": data.Int(0)},
+			{"address": data.String("localhost:1"), "pool_size": data.Int(-1)},
+			{"address": data.String("localhost:1"), "no_such_param": data.Int(1)},
+		} {
+			Convey(fmt.Sprintf("When creating a UDF with %v", params), func() {
+				_, err := c.CreateUDF(nil, params)
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
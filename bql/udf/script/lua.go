@@ -0,0 +1,311 @@
+package script
+
+import (
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"strings"
+	"sync"
+)
+
+func init() {
+	udf.MustRegisterGlobalScriptEngine("lua", &luaEngine{})
+}
+
+// luaEngine creates UDFs written in Lua 5.1. Only base, table, string, and
+// math libraries are available in functions, and functions loading files or
+// modules are removed from the base library.
+//
+// Values are converted between BQL and Lua as follows:
+//
+//	* null <-> nil
+//	* bool <-> boolean
+//	* int, float -> number
+//	* number -> int if it's integral, float otherwise
+//	* string, blob -> string
+//	* timestamp -> number in seconds since the Unix epoch
+//	* array <-> table having keys 1 to n
+//	* map <-> table having string keys
+//
+// An empty table is converted to an empty array.
+type luaEngine struct {
+}
+
+// luaKeywords cannot be used as names of parameters.
+var luaKeywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true,
+	"end": true, "false": true, "for": true, "function": true, "if": true,
+	"in": true, "local": true, "nil": true, "not": true, "or": true,
+	"repeat": true, "return": true, "then": true, "true": true,
+	"until": true, "while": true,
+}
+
+func (e *luaEngine) CreateFunction(params []string, variadic bool, body string) (udf.UDF, error) {
+	for _, p := range params {
+		if luaKeywords[p] {
+			return nil, fmt.Errorf("'%v' is a reserved word in Lua and cannot be a parameter name", p)
+		}
+	}
+	if variadic {
+		params = []string{"..."}
+	}
+
+	// The body is written in the same line as the function header so that
+	// line numbers in error messages match the ones in the body.
+	src := fmt.Sprintf("return function(%v) %v\nend", strings.Join(params, ", "), body)
+	chunk, err := parse.Parse(strings.NewReader(src), "<function>")
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the function: %v", err)
+	}
+	proto, err := lua.Compile(chunk, "<function>")
+	if err != nil {
+		return nil, fmt.Errorf("cannot compile the function: %v", err)
+	}
+
+	f := &luaFunc{
+		proto: proto,
+		arity: len(params),
+	}
+	if variadic {
+		f.arity = -1
+	}
+
+	// create a state to check that the function can be initialized
+	s, err := f.newState()
+	if err != nil {
+		return nil, err
+	}
+	f.put(s)
+	return f, nil
+}
+
+// maxIdleLuaStates is the maximum number of Lua states each function keeps
+// for later calls.
+const maxIdleLuaStates = 16
+
+// luaFunc is a UDF calling a Lua function. Because a Lua state cannot be used
+// concurrently, luaFunc creates a state for each concurrent call and reuses
+// it for later calls.
+type luaFunc struct {
+	proto *lua.FunctionProto
+
+	// arity is the number of parameters. It's -1 when the function is
+	// variadic.
+	arity int
+
+	m    sync.Mutex
+	idle []*luaState
+}
+
+type luaState struct {
+	l  *lua.LState
+	fn *lua.LFunction
+}
+
+func (f *luaFunc) newState() (*luaState, error) {
+	l := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		if err := l.CallByParam(lua.P{Fn: l.NewFunction(lib.open), NRet: 0, Protect: true},
+			lua.LString(lib.name)); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	for _, n := range []string{"dofile", "loadfile", "module", "require"} {
+		l.SetGlobal(n, lua.LNil)
+	}
+
+	if err := l.CallByParam(lua.P{Fn: l.NewFunctionFromProto(f.proto), NRet: 1, Protect: true}); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("cannot initialize the function: %v", err)
+	}
+	fn, ok := l.Get(-1).(*lua.LFunction)
+	if !ok {
+		l.Close()
+		return nil, fmt.Errorf("the body doesn't define a function")
+	}
+	l.Pop(1)
+	return &luaState{l: l, fn: fn}, nil
+}
+
+func (f *luaFunc) get() (*luaState, error) {
+	f.m.Lock()
+	if n := len(f.idle); n > 0 {
+		s := f.idle[n-1]
+		f.idle = f.idle[:n-1]
+		f.m.Unlock()
+		return s, nil
+	}
+	f.m.Unlock()
+	return f.newState()
+}
+
+func (f *luaFunc) put(s *luaState) {
+	// remove values left by an error
+	s.l.SetTop(0)
+
+	f.m.Lock()
+	defer f.m.Unlock()
+	if len(f.idle) >= maxIdleLuaStates {
+		s.l.Close()
+		return
+	}
+	f.idle = append(f.idle, s)
+}
+
+func (f *luaFunc) Call(ctx *core.Context, args ...data.Value) (data.Value, error) {
+	s, err := f.get()
+	if err != nil {
+		return nil, err
+	}
+	defer f.put(s)
+
+	largs := make([]lua.LValue, len(args))
+	for i, a := range args {
+		v, err := toLuaValue(s.l, a)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert the argument %v: %v", i+1, err)
+		}
+		largs[i] = v
+	}
+	if err := s.l.CallByParam(lua.P{Fn: s.fn, NRet: 1, Protect: true}, largs...); err != nil {
+		return nil, err
+	}
+	ret := s.l.Get(-1)
+	s.l.Pop(1)
+	return fromLuaValue(ret, map[*lua.LTable]bool{})
+}
+
+func (f *luaFunc) Accept(arity int) bool {
+	return f.arity < 0 || f.arity == arity
+}
+
+func (f *luaFunc) IsAggregationParameter(k int) bool {
+	return false
+}
+
+func toLuaValue(l *lua.LState, v data.Value) (lua.LValue, error) {
+	switch v.Type() {
+	case data.TypeNull:
+		return lua.LNil, nil
+	case data.TypeBool:
+		b, _ := data.AsBool(v)
+		return lua.LBool(b), nil
+	case data.TypeInt, data.TypeFloat:
+		f, _ := data.ToFloat(v)
+		return lua.LNumber(f), nil
+	case data.TypeString:
+		s, _ := data.AsString(v)
+		return lua.LString(s), nil
+	case data.TypeBlob:
+		b, _ := data.AsBlob(v)
+		return lua.LString(b), nil
+	case data.TypeTimestamp:
+		t, _ := data.AsTimestamp(v)
+		return lua.LNumber(float64(t.UnixNano()) / 1e9), nil
+	case data.TypeArray:
+		a, _ := data.AsArray(v)
+		t := l.CreateTable(len(a), 0)
+		for i, e := range a {
+			le, err := toLuaValue(l, e)
+			if err != nil {
+				return nil, err
+			}
+			t.RawSetInt(i+1, le)
+		}
+		return t, nil
+	case data.TypeMap:
+		m, _ := data.AsMap(v)
+		t := l.CreateTable(0, len(m))
+		for k, e := range m {
+			le, err := toLuaValue(l, e)
+			if err != nil {
+				return nil, err
+			}
+			t.RawSetString(k, le)
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("unsupported type: %v", v.Type())
+}
+
+// fromLuaValue converts a Lua value to a data.Value. visiting has tables being
+// converted to detect cyclic references.
+func fromLuaValue(v lua.LValue, visiting map[*lua.LTable]bool) (data.Value, error) {
+	switch v := v.(type) {
+	case *lua.LNilType:
+		return data.Null{}, nil
+	case lua.LBool:
+		return data.Bool(v), nil
+	case lua.LNumber:
+		f := float64(v)
+		if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return data.Int(f), nil
+		}
+		return data.Float(f), nil
+	case lua.LString:
+		return data.String(v), nil
+	case *lua.LTable:
+		if visiting[v] {
+			return nil, fmt.Errorf("a table cannot refer to itself")
+		}
+		visiting[v] = true
+		defer delete(visiting, v)
+		return fromLuaTable(v, visiting)
+	}
+	return nil, fmt.Errorf("unsupported type: %v", v.Type())
+}
+
+func fromLuaTable(t *lua.LTable, visiting map[*lua.LTable]bool) (data.Value, error) {
+	n, keys := t.Len(), 0
+	isMap := true
+	t.ForEach(func(k, _ lua.LValue) {
+		keys++
+		if _, ok := k.(lua.LString); !ok {
+			isMap = false
+		}
+	})
+
+	if keys == n { // including an empty table
+		a := make(data.Array, n)
+		for i := range a {
+			e, err := fromLuaValue(t.RawGetInt(i+1), visiting)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = e
+		}
+		return a, nil
+	}
+	if !isMap {
+		return nil, fmt.Errorf("a table must be a sequence or only have string keys")
+	}
+
+	m := make(data.Map, keys)
+	var err error
+	t.ForEach(func(k, e lua.LValue) {
+		if err != nil {
+			return
+		}
+		var v data.Value
+		if v, err = fromLuaValue(e, visiting); err == nil {
+			m[string(k.(lua.LString))] = v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,211 @@
+package script
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLuaFunction(t *testing.T) {
+	e, err := udf.LookupGlobalScriptEngine("LUA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Given a Lua function having parameters", t, func() {
+		f, err := e.CreateFunction([]string{"a", "b"}, false, "return a + b")
+		So(err, ShouldBeNil)
+
+		Convey("Then it should only accept the number of parameters", func() {
+			So(f.Accept(2), ShouldBeTrue)
+			So(f.Accept(1), ShouldBeFalse)
+			So(f.Accept(3), ShouldBeFalse)
+		})
+
+		Convey("When calling it", func() {
+			v, err := f.Call(nil, data.Int(1), data.Float(2.5))
+
+			Convey("Then it should return the result", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Float(3.5))
+			})
+		})
+
+		Convey("When calling it with integers", func() {
+			v, err := f.Call(nil, data.Int(1), data.Int(2))
+
+			Convey("Then it should return an int", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(3))
+			})
+		})
+
+		Convey("When calling it with invalid arguments", func() {
+			_, err := f.Call(nil, data.Int(1), data.Map{})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("And it should still be callable", func() {
+				v, err := f.Call(nil, data.Int(1), data.Int(2))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(3))
+			})
+		})
+
+		Convey("When calling it concurrently", func() {
+			var wg sync.WaitGroup
+			errs := make([]error, 32)
+			for i := range errs {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					v, err := f.Call(nil, data.Int(i), data.Int(1))
+					if err == nil && v != data.Int(i+1) {
+						err = fmt.Errorf("unexpected result: %v", v)
+					}
+					errs[i] = err
+				}(i)
+			}
+			wg.Wait()
+
+			Convey("Then all calls should succeed", func() {
+				for _, err := range errs {
+					So(err, ShouldBeNil)
+				}
+			})
+		})
+	})
+
+	Convey("Given a variadic Lua function", t, func() {
+		f, err := e.CreateFunction(nil, true, `return select("#", ...)`)
+		So(err, ShouldBeNil)
+
+		Convey("Then it should accept any number of parameters", func() {
+			So(f.Accept(0), ShouldBeTrue)
+			So(f.Accept(5), ShouldBeTrue)
+		})
+
+		Convey("When calling it", func() {
+			v, err := f.Call(nil, data.Int(1), data.Null{}, data.String("a"))
+
+			Convey("Then it should receive all arguments", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(3))
+			})
+		})
+	})
+
+	Convey("Given a Lua function returning its argument", t, func() {
+		f, err := e.CreateFunction([]string{"v"}, false, "return v")
+		So(err, ShouldBeNil)
+
+		cases := []struct {
+			title    string
+			input    data.Value
+			expected data.Value
+		}{
+			{"null", data.Null{}, data.Null{}},
+			{"bool", data.True, data.True},
+			{"int", data.Int(-3), data.Int(-3)},
+			{"float", data.Float(1.5), data.Float(1.5)},
+			{"string", data.String("日本語"), data.String("日本語")},
+			{"blob", data.Blob("abc"), data.String("abc")},
+			{"timestamp", data.Timestamp(time.Unix(10, 500000000)), data.Float(10.5)},
+			{"empty array", data.Array{}, data.Array{}},
+			{"array", data.Array{data.Int(1), data.String("a")}, data.Array{data.Int(1), data.String("a")}},
+			{"map", data.Map{"a": data.Array{data.True}, "b": data.Map{"c": data.Float(0.5)}},
+				data.Map{"a": data.Array{data.True}, "b": data.Map{"c": data.Float(0.5)}}},
+		}
+		for _, c := range cases {
+			c := c
+			Convey("When calling it with "+c.title, func() {
+				v, err := f.Call(nil, c.input)
+
+				Convey("Then it should be converted correctly", func() {
+					So(err, ShouldBeNil)
+					So(v, ShouldResemble, c.expected)
+				})
+			})
+		}
+	})
+
+	Convey("Given Lua functions returning unsupported values", t, func() {
+		for _, body := range []string{
+			"return function() end",
+			"return {1, 2, x = 3}",
+			"local t = {}; t.t = t; return t",
+		} {
+			f, err := e.CreateFunction(nil, true, body)
+			So(err, ShouldBeNil)
+
+			Convey("When calling "+body, func() {
+				_, err := f.Call(nil)
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+
+	Convey("Given a Lua function raising an error", t, func() {
+		f, err := e.CreateFunction(nil, true, `error("failed")`)
+		So(err, ShouldBeNil)
+
+		Convey("When calling it", func() {
+			_, err := f.Call(nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "failed")
+			})
+		})
+	})
+
+	Convey("Given a Lua function using restricted functions", t, func() {
+		for _, body := range []string{
+			`return os.time()`,
+			`return io.write("a")`,
+			`return dofile("a.lua")`,
+			`return require("a")`,
+		} {
+			f, err := e.CreateFunction(nil, true, body)
+			So(err, ShouldBeNil)
+
+			Convey("When calling "+body, func() {
+				_, err := f.Call(nil)
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+
+	Convey("Given invalid Lua functions", t, func() {
+		cases := []struct {
+			title  string
+			params []string
+			body   string
+		}{
+			{"a syntax error", nil, "return +"},
+			{"a reserved word as a parameter", []string{"end"}, "return 1"},
+		}
+		for _, c := range cases {
+			c := c
+			Convey("When creating a function having "+c.title, func() {
+				_, err := e.CreateFunction(c.params, c.params == nil, c.body)
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
@@ -0,0 +1,302 @@
+package script
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+func init() {
+	udf.MustRegisterGlobalScriptEngine("wasm", &wasmEngine{})
+}
+
+// wasmEngine creates UDFs from WebAssembly modules. The body of CREATE
+// FUNCTION is the path to a .wasm file on the server or a base64 encoded
+// module:
+//
+//	CREATE FUNCTION score(x, y) LANGUAGE wasm AS $$/opt/udfs/score.wasm$$;
+//
+// A module must export the following memory and functions:
+//
+//	* memory: the memory used to pass arguments and results
+//	* sensorbee_alloc(size i32) i32: allocates size bytes of memory and
+//	  returns the address
+//	* sensorbee_call(ptr i32, len i32) i64: calls the function
+//
+// and can optionally export:
+//
+//	* sensorbee_free(ptr i32, len i32): releases the memory allocated by
+//	  sensorbee_alloc or returned from sensorbee_call
+//
+// sensorbee_call receives a msgpack encoded map having arguments of the
+// function as an array in "args" field. It returns the address of a msgpack
+// encoded map in the upper 32 bits and the length of the map in the lower 32
+// bits. The map has the result of the function in "result" field or an error
+// message in "error" field. Timestamps are passed as integers in the same way
+// as msgpack encoded tuples.
+//
+// A module is instantiated for each concurrent call and instances are reused.
+// The module can import WASI functions, but it cannot access files,
+// environment variables, or the network. When the module exports
+// "_initialize", it's called after each instantiation. An instance which
+// failed to process a call is discarded.
+type wasmEngine struct {
+}
+
+// wasmMemoryLimitPages is the maximum number of 64KiB pages of memory each
+// instance of a module can use.
+const wasmMemoryLimitPages = 1024
+
+func (e *wasmEngine) CreateFunction(params []string, variadic bool, body string) (udf.UDF, error) {
+	bin, err := readWasmModule(body)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithMemoryLimitPages(wasmMemoryLimitPages))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+	m, err := r.CompileModule(ctx, bin)
+	if err != nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("cannot compile the module: %v", err)
+	}
+	if err := validateWasmExports(m); err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+
+	f := &wasmFunc{
+		runtime: r,
+		module:  m,
+		arity:   len(params),
+	}
+	if variadic {
+		f.arity = -1
+	}
+
+	// create an instance to check that the module can be instantiated
+	inst, err := f.newInstance(ctx)
+	if err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+	f.put(ctx, inst)
+	return f, nil
+}
+
+// readWasmModule reads a module from a file when body is a path ending with
+// ".wasm". Otherwise, body is decoded as base64 ignoring whitespace.
+func readWasmModule(body string) ([]byte, error) {
+	body = strings.TrimSpace(body)
+	if strings.HasSuffix(body, ".wasm") {
+		bin, err := ioutil.ReadFile(body)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the module: %v", err)
+		}
+		return bin, nil
+	}
+	bin, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return nil, fmt.Errorf("the body must be a path to a .wasm file or a base64 encoded module: %v", err)
+	}
+	return bin, nil
+}
+
+func validateWasmExports(m wazero.CompiledModule) error {
+	if _, ok := m.ExportedMemories()["memory"]; !ok {
+		return fmt.Errorf("the module doesn't export 'memory'")
+	}
+	fs := m.ExportedFunctions()
+	i32, i64 := api.ValueTypeI32, api.ValueTypeI64
+	for _, s := range []struct {
+		name     string
+		params   []api.ValueType
+		results  []api.ValueType
+		optional bool
+	}{
+		{"sensorbee_alloc", []api.ValueType{i32}, []api.ValueType{i32}, false},
+		{"sensorbee_call", []api.ValueType{i32, i32}, []api.ValueType{i64}, false},
+		{"sensorbee_free", []api.ValueType{i32, i32}, nil, true},
+	} {
+		f, ok := fs[s.name]
+		if !ok {
+			if s.optional {
+				continue
+			}
+			return fmt.Errorf("the module doesn't export '%v'", s.name)
+		}
+		if !equalValueTypes(f.ParamTypes(), s.params) || !equalValueTypes(f.ResultTypes(), s.results) {
+			return fmt.Errorf("'%v' has a wrong signature", s.name)
+		}
+	}
+	return nil
+}
+
+func equalValueTypes(a, b []api.ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// maxIdleWasmInstances is the maximum number of instances each function keeps
+// for later calls.
+const maxIdleWasmInstances = 16
+
+// wasmFunc is a UDF calling a WebAssembly module.
+type wasmFunc struct {
+	runtime wazero.Runtime
+	module  wazero.CompiledModule
+
+	// arity is the number of parameters. It's -1 when the function is
+	// variadic.
+	arity int
+
+	m    sync.Mutex
+	idle []*wasmInstance
+}
+
+type wasmInstance struct {
+	mod   api.Module
+	alloc api.Function
+	call  api.Function
+	free  api.Function // can be nil
+}
+
+func (f *wasmFunc) newInstance(ctx context.Context) (*wasmInstance, error) {
+	mod, err := f.runtime.InstantiateModule(ctx, f.module,
+		wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot instantiate the module: %v", err)
+	}
+	return &wasmInstance{
+		mod:   mod,
+		alloc: mod.ExportedFunction("sensorbee_alloc"),
+		call:  mod.ExportedFunction("sensorbee_call"),
+		free:  mod.ExportedFunction("sensorbee_free"),
+	}, nil
+}
+
+func (f *wasmFunc) get(ctx context.Context) (*wasmInstance, error) {
+	f.m.Lock()
+	if n := len(f.idle); n > 0 {
+		inst := f.idle[n-1]
+		f.idle = f.idle[:n-1]
+		f.m.Unlock()
+		return inst, nil
+	}
+	f.m.Unlock()
+	return f.newInstance(ctx)
+}
+
+func (f *wasmFunc) put(ctx context.Context, inst *wasmInstance) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if len(f.idle) >= maxIdleWasmInstances {
+		inst.mod.Close(ctx)
+		return
+	}
+	f.idle = append(f.idle, inst)
+}
+
+func (f *wasmFunc) Call(ctx *core.Context, args ...data.Value) (data.Value, error) {
+	in, err := data.MarshalMsgpack(data.Map{"args": data.Array(args)})
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode arguments: %v", err)
+	}
+
+	c := context.Background()
+	inst, err := f.get(c)
+	if err != nil {
+		return nil, err
+	}
+	out, err := inst.invoke(c, in)
+	if err != nil {
+		// the state of the instance might be broken
+		inst.mod.Close(c)
+		return nil, err
+	}
+	f.put(c, inst)
+
+	m, err := data.UnmarshalMsgpack(out)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode the result: %v", err)
+	}
+	if e, ok := m["error"]; ok {
+		return nil, fmt.Errorf("%v", e)
+	}
+	v, ok := m["result"]
+	if !ok {
+		return nil, fmt.Errorf("the module didn't return 'result' nor 'error'")
+	}
+	return v, nil
+}
+
+// invoke passes the encoded arguments to sensorbee_call and returns a copy of
+// the encoded result.
+func (inst *wasmInstance) invoke(ctx context.Context, in []byte) ([]byte, error) {
+	res, err := inst.alloc.Call(ctx, uint64(len(in)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot allocate memory for arguments: %v", err)
+	}
+	ptr := uint32(res[0])
+	if !inst.mod.Memory().Write(ptr, in) {
+		return nil, fmt.Errorf("sensorbee_alloc returned an invalid address: %v", ptr)
+	}
+
+	res, err = inst.call.Call(ctx, uint64(ptr), uint64(len(in)))
+	if err != nil {
+		return nil, err
+	}
+	if err := inst.release(ctx, ptr, uint32(len(in))); err != nil {
+		return nil, err
+	}
+
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	b, ok := inst.mod.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("sensorbee_call returned an invalid range: %v+%v", outPtr, outLen)
+	}
+	out := make([]byte, len(b))
+	copy(out, b)
+	if err := inst.release(ctx, outPtr, outLen); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (inst *wasmInstance) release(ctx context.Context, ptr, size uint32) error {
+	if inst.free == nil {
+		return nil
+	}
+	if _, err := inst.free.Call(ctx, uint64(ptr), uint64(size)); err != nil {
+		return fmt.Errorf("cannot release memory: %v", err)
+	}
+	return nil
+}
+
+func (f *wasmFunc) Accept(arity int) bool {
+	return f.arity < 0 || f.arity == arity
+}
+
+func (f *wasmFunc) IsAggregationParameter(k int) bool {
+	return false
+}
@@ -0,0 +1,206 @@
+package script
+
+import (
+	"encoding/base64"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func uleb128(v uint64) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func sleb128(v int64) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func wasmSection(id byte, content ...[]byte) []byte {
+	var c []byte
+	for _, b := range content {
+		c = append(c, b...)
+	}
+	return append(append([]byte{id}, uleb128(uint64(len(c)))...), c...)
+}
+
+func wasmName(s string) []byte {
+	return append(uleb128(uint64(len(s))), s...)
+}
+
+// wasmTestModule builds a module exporting memory, sensorbee_alloc returning
+// 4096, and sensorbee_call having the given code. The memory has out at 1024.
+func wasmTestModule(call []byte, out []byte) []byte {
+	allocBody := []byte{0x00, 0x41, 0x80, 0x20, 0x0b} // i32.const 4096
+	callBody := append([]byte{0x00}, call...)
+	m := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	m = append(m, wasmSection(1, []byte{0x02,
+		0x60, 0x01, 0x7f, 0x01, 0x7f, // (i32) -> i32
+		0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e, // (i32, i32) -> i64
+	})...)
+	m = append(m, wasmSection(3, []byte{0x02, 0x00, 0x01})...)
+	m = append(m, wasmSection(5, []byte{0x01, 0x00, 0x01})...)
+	m = append(m, wasmSection(7, []byte{0x03},
+		wasmName("memory"), []byte{0x02, 0x00},
+		wasmName("sensorbee_alloc"), []byte{0x00, 0x00},
+		wasmName("sensorbee_call"), []byte{0x00, 0x01})...)
+	m = append(m, wasmSection(10, []byte{0x02},
+		uleb128(uint64(len(allocBody))), allocBody,
+		uleb128(uint64(len(callBody))), callBody)...)
+	m = append(m, wasmSection(11, []byte{0x01, 0x00, 0x41, 0x80, 0x08, 0x0b},
+		uleb128(uint64(len(out))), out)...)
+	return m
+}
+
+// wasmReturn returns the code of sensorbee_call returning out at 1024.
+func wasmReturn(out []byte) []byte {
+	return append(append([]byte{0x42}, sleb128(1024<<32|int64(len(out)))...), 0x0b)
+}
+
+func TestWasmFunction(t *testing.T) {
+	e, err := udf.LookupGlobalScriptEngine("wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(m data.Map) []byte {
+		b, err := data.MarshalMsgpack(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	create := func(params []string, variadic bool, module []byte) (udf.UDF, error) {
+		return e.CreateFunction(params, variadic, base64.StdEncoding.EncodeToString(module))
+	}
+
+	Convey("Given a wasm function returning a result", t, func() {
+		out := encode(data.Map{"result": data.Map{"a": data.Int(42)}})
+		f, err := create([]string{"a", "b"}, false, wasmTestModule(wasmReturn(out), out))
+		So(err, ShouldBeNil)
+
+		Convey("Then it should only accept the number of parameters", func() {
+			So(f.Accept(2), ShouldBeTrue)
+			So(f.Accept(1), ShouldBeFalse)
+		})
+
+		Convey("When calling it", func() {
+			v, err := f.Call(nil, data.Int(1), data.String("b"))
+
+			Convey("Then it should return the result", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Map{"a": data.Int(42)})
+			})
+
+			Convey("And calling it again should return the same result", func() {
+				v, err := f.Call(nil, data.Int(1), data.String("b"))
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Map{"a": data.Int(42)})
+			})
+		})
+	})
+
+	Convey("Given a wasm function in a file", t, func() {
+		dir, err := ioutil.TempDir("", "sensorbee_wasm_test")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		out := encode(data.Map{"result": data.Int(1)})
+		path := filepath.Join(dir, "f.wasm")
+		So(ioutil.WriteFile(path, wasmTestModule(wasmReturn(out), out), 0644), ShouldBeNil)
+
+		Convey("When creating a variadic function from it", func() {
+			f, err := e.CreateFunction(nil, true, " "+path+"\n")
+			So(err, ShouldBeNil)
+
+			Convey("Then it should accept any number of arguments", func() {
+				So(f.Accept(0), ShouldBeTrue)
+				So(f.Accept(3), ShouldBeTrue)
+			})
+
+			Convey("Then it should return the result", func() {
+				v, err := f.Call(nil)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("When creating a function from a nonexistent file", func() {
+			_, err := e.CreateFunction(nil, true, filepath.Join(dir, "no_such_file.wasm"))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given wasm functions failing at runtime", t, func() {
+		errOut := encode(data.Map{"error": data.String("something failed")})
+		cases := []struct {
+			title  string
+			module []byte
+		}{
+			{"returning an error", wasmTestModule(wasmReturn(errOut), errOut)},
+			{"trapping", wasmTestModule([]byte{0x00, 0x0b}, nil)}, // unreachable
+			{"returning its input", wasmTestModule([]byte{
+				0x20, 0x00, 0xad, 0x42, 0x20, 0x86, // i64(ptr) << 32
+				0x20, 0x01, 0xad, 0x84, 0x0b, // | i64(len)
+			}, nil)},
+			{"returning an invalid range", wasmTestModule([]byte{
+				0x42, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01, 0x0b, // 1<<48
+			}, nil)},
+		}
+		for _, c := range cases {
+			c := c
+			Convey("When calling a function "+c.title, func() {
+				f, err := create(nil, true, c.module)
+				So(err, ShouldBeNil)
+				_, err = f.Call(nil, data.Int(1))
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+
+	Convey("Given invalid wasm modules", t, func() {
+		cases := []struct {
+			title string
+			body  string
+		}{
+			{"invalid base64", "not base64!"},
+			{"an invalid module", base64.StdEncoding.EncodeToString([]byte("abc"))},
+			{"no exports", base64.StdEncoding.EncodeToString([]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00})},
+		}
+		for _, c := range cases {
+			c := c
+			Convey("When creating a function from "+c.title, func() {
+				_, err := e.CreateFunction(nil, true, c.body)
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
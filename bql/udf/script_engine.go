@@ -0,0 +1,63 @@
+package udf
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"strings"
+	"sync"
+)
+
+// ScriptEngine creates UDFs from functions written in a script language.
+// It's used by CREATE FUNCTION statement:
+//
+//	CREATE FUNCTION add(a, b) LANGUAGE lua AS $$ return a + b $$;
+type ScriptEngine interface {
+	// CreateFunction compiles the body of a function and returns a UDF
+	// calling it. params has the names of the parameters. When variadic is
+	// true, params is empty and the function accepts any number of arguments.
+	CreateFunction(params []string, variadic bool, body string) (UDF, error)
+}
+
+var (
+	globalScriptEngines = struct {
+		m       sync.RWMutex
+		engines map[string]ScriptEngine
+	}{
+		engines: map[string]ScriptEngine{},
+	}
+)
+
+// RegisterGlobalScriptEngine adds a ScriptEngine of the language which can be
+// used from all topologies. The name of the language is case-insensitive.
+func RegisterGlobalScriptEngine(language string, e ScriptEngine) error {
+	if err := core.ValidateSymbol(language); err != nil {
+		return fmt.Errorf("invalid name for language: %s", err.Error())
+	}
+	globalScriptEngines.m.Lock()
+	defer globalScriptEngines.m.Unlock()
+	l := strings.ToLower(language)
+	if _, ok := globalScriptEngines.engines[l]; ok {
+		return fmt.Errorf("script engine for '%v' is already registered", language)
+	}
+	globalScriptEngines.engines[l] = e
+	return nil
+}
+
+// MustRegisterGlobalScriptEngine is like RegisterGlobalScriptEngine but
+// panics if an error occurred.
+func MustRegisterGlobalScriptEngine(language string, e ScriptEngine) {
+	if err := RegisterGlobalScriptEngine(language, e); err != nil {
+		panic(fmt.Errorf("udf.MustRegisterGlobalScriptEngine: cannot register '%v': %v", language, err))
+	}
+}
+
+// LookupGlobalScriptEngine returns a ScriptEngine of the language. It returns
+// core.NotExistError if the language isn't supported.
+func LookupGlobalScriptEngine(language string) (ScriptEngine, error) {
+	globalScriptEngines.m.RLock()
+	defer globalScriptEngines.m.RUnlock()
+	if e, ok := globalScriptEngines.engines[strings.ToLower(language)]; ok {
+		return e, nil
+	}
+	return nil, core.NotExistError(fmt.Errorf("language '%v' is not supported", language))
+}
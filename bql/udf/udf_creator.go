@@ -0,0 +1,71 @@
+package udf
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+	"sync"
+)
+
+// UDFCreator creates UDFs calling functions running outside of SensorBee,
+// e.g. on a gRPC server. It's used by CREATE FUNCTION statement having TYPE
+// clause:
+//
+//	CREATE FUNCTION predict TYPE grpc WITH address="localhost:50051";
+type UDFCreator interface {
+	// CreateUDF returns a UDF configured by params given in WITH clause.
+	CreateUDF(ctx *core.Context, params data.Map) (UDF, error)
+}
+
+// UDFCreatorFunc is a function implementing UDFCreator.
+type UDFCreatorFunc func(ctx *core.Context, params data.Map) (UDF, error)
+
+// CreateUDF calls f.
+func (f UDFCreatorFunc) CreateUDF(ctx *core.Context, params data.Map) (UDF, error) {
+	return f(ctx, params)
+}
+
+var (
+	globalUDFCreators = struct {
+		m        sync.RWMutex
+		creators map[string]UDFCreator
+	}{
+		creators: map[string]UDFCreator{},
+	}
+)
+
+// RegisterGlobalUDFCreator adds a UDFCreator of the type which can be used
+// from all topologies. The name of the type is case-insensitive.
+func RegisterGlobalUDFCreator(typeName string, c UDFCreator) error {
+	if err := core.ValidateSymbol(typeName); err != nil {
+		return fmt.Errorf("invalid name for function type: %s", err.Error())
+	}
+	globalUDFCreators.m.Lock()
+	defer globalUDFCreators.m.Unlock()
+	t := strings.ToLower(typeName)
+	if _, ok := globalUDFCreators.creators[t]; ok {
+		return fmt.Errorf("function type '%v' is already registered", typeName)
+	}
+	globalUDFCreators.creators[t] = c
+	return nil
+}
+
+// MustRegisterGlobalUDFCreator is like RegisterGlobalUDFCreator but panics if
+// an error occurred.
+func MustRegisterGlobalUDFCreator(typeName string, c UDFCreator) {
+	if err := RegisterGlobalUDFCreator(typeName, c); err != nil {
+		panic(fmt.Errorf("udf.MustRegisterGlobalUDFCreator: cannot register '%v': %v", typeName, err))
+	}
+}
+
+// LookupGlobalUDFCreator returns a UDFCreator of the type. It returns
+// core.NotExistError if the type isn't registered.
+func LookupGlobalUDFCreator(typeName string) (UDFCreator, error) {
+	globalUDFCreators.m.RLock()
+	defer globalUDFCreators.m.RUnlock()
+	if c, ok := globalUDFCreators.creators[strings.ToLower(typeName)]; ok {
+		return c, nil
+	}
+	return nil, core.NotExistError(fmt.Errorf("function type '%v' is not registered", typeName))
+}
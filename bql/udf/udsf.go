@@ -85,7 +85,7 @@ func ConvertToUDSFCreator(function interface{}) (UDSFCreator, error) {
 		return nil, err
 	}
 
-	if convs, err := createGenericConverters(t, t.NumIn()-g.arity); err != nil {
+	if convs, err := createGenericConverters(t, t.NumIn()-g.arity, &genericOptions{}); err != nil {
 		return nil, err
 	} else {
 		g.converters = convs
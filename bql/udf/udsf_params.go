@@ -0,0 +1,107 @@
+package udf
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// UDSFParamNamer is implemented by a UDSFCreator whose parameters have
+// names. A UDSF created by such a creator can be called with named arguments
+// in a BQL statement, e.g. `duplicate(stream => 'source', times => 3)`.
+type UDSFParamNamer interface {
+	// ParamNames returns the names of the parameters of the UDSF in the
+	// order of arguments passed to UDSFCreator.CreateUDSF.
+	ParamNames() []string
+}
+
+type namedUDSFCreator struct {
+	UDSFCreator
+	names []string
+}
+
+func (c *namedUDSFCreator) ParamNames() []string {
+	names := make([]string, len(c.names))
+	copy(names, c.names)
+	return names
+}
+
+// WithParamNames returns a UDSFCreator which behaves like c and has the
+// given names of its parameters. For example, a creator converted from
+//
+//	func createDuplicateUDSF(decl udf.UDSFDeclarer, stream string, times int) (udf.UDSF, error)
+//
+// can be registered as
+//
+//	c, err := udf.WithParamNames(udf.MustConvertToUDSFCreator(createDuplicateUDSF),
+//		"stream", "times")
+//
+// so that it can be called as `duplicate(stream => 'source', times => 3)`.
+func WithParamNames(c UDSFCreator, names ...string) (UDSFCreator, error) {
+	seen := make(map[string]bool, len(names))
+	for _, n := range names {
+		if n == "" {
+			return nil, errors.New("the name of a parameter cannot be empty")
+		}
+		if seen[n] {
+			return nil, fmt.Errorf("the parameter name is duplicated: %v", n)
+		}
+		seen[n] = true
+	}
+	return &namedUDSFCreator{
+		UDSFCreator: c,
+		names:       names,
+	}, nil
+}
+
+// MustWithParamNames is like WithParamNames but panics if an error occurred.
+func MustWithParamNames(c UDSFCreator, names ...string) UDSFCreator {
+	nc, err := WithParamNames(c, names...)
+	if err != nil {
+		panic(err)
+	}
+	return nc
+}
+
+// ArrangeUDSFArgs returns the arguments to be passed to c.CreateUDSF. args
+// are positional arguments and named has named arguments which are placed
+// at the positions of the parameters having their names. Named arguments
+// can only be given when c implements UDSFParamNamer. It fails when a
+// parameter receives more than one argument, or a parameter preceding a
+// named argument doesn't receive one.
+func ArrangeUDSFArgs(c UDSFCreator, args []data.Value, named data.Map) ([]data.Value, error) {
+	if len(named) == 0 {
+		return args, nil
+	}
+	namer, ok := c.(UDSFParamNamer)
+	if !ok {
+		return nil, errors.New("the UDSF doesn't accept named arguments")
+	}
+	names := namer.ParamNames()
+	idx := make(map[string]int, len(names))
+	for i, n := range names {
+		idx[n] = i
+	}
+
+	res := make([]data.Value, len(args), len(args)+len(named))
+	copy(res, args)
+	for n, v := range named {
+		i, ok := idx[n]
+		if !ok {
+			return nil, fmt.Errorf("the UDSF doesn't have parameter '%v'", n)
+		}
+		if i < len(args) {
+			return nil, fmt.Errorf("parameter '%v' is given more than once", n)
+		}
+		for len(res) <= i {
+			res = append(res, nil)
+		}
+		res[i] = v
+	}
+	for i, v := range res {
+		if v == nil {
+			return nil, fmt.Errorf("parameter '%v' isn't given", names[i])
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,105 @@
+package udf
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestUDSFParamNames(t *testing.T) {
+	ctx := core.NewContext(nil)
+
+	Convey("Given a UDSFCreator having names of its parameters", t, func() {
+		c, err := WithParamNames(MustConvertToUDSFCreator(createDuplicateUDSF), "stream", "times")
+		So(err, ShouldBeNil)
+
+		Convey("When arranging named arguments", func() {
+			args, err := ArrangeUDSFArgs(c, nil, data.Map{
+				"times":  data.Int(2),
+				"stream": data.String("test_stream"),
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then they should be in the order of the parameters", func() {
+				So(args, ShouldResemble, []data.Value{data.String("test_stream"), data.Int(2)})
+
+				Convey("And the UDSF should be created with them", func() {
+					decl := newUDSFDeclarer()
+					f, err := c.CreateUDSF(ctx, decl, args...)
+					So(err, ShouldBeNil)
+					So(f.(*duplicateUDSF).dup, ShouldEqual, 2)
+					So(decl.inputs["test_stream"], ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("When arranging positional and named arguments", func() {
+			args, err := ArrangeUDSFArgs(c, []data.Value{data.String("test_stream")},
+				data.Map{"times": data.Int(2)})
+			So(err, ShouldBeNil)
+
+			Convey("Then the named one should follow the positional one", func() {
+				So(args, ShouldResemble, []data.Value{data.String("test_stream"), data.Int(2)})
+			})
+		})
+
+		Convey("When a parameter receives both positional and named arguments", func() {
+			_, err := ArrangeUDSFArgs(c, []data.Value{data.String("test_stream")},
+				data.Map{"stream": data.String("test_stream")})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a named argument has an unknown name", func() {
+			_, err := ArrangeUDSFArgs(c, nil, data.Map{"count": data.Int(2)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a parameter preceding a named argument isn't given", func() {
+			_, err := ArrangeUDSFArgs(c, nil, data.Map{"times": data.Int(2)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "stream")
+			})
+		})
+	})
+
+	Convey("Given a UDSFCreator without names of its parameters", t, func() {
+		c := MustConvertToUDSFCreator(createDuplicateUDSF)
+
+		Convey("When arranging only positional arguments", func() {
+			args := []data.Value{data.String("test_stream"), data.Int(2)}
+			res, err := ArrangeUDSFArgs(c, args, nil)
+			So(err, ShouldBeNil)
+
+			Convey("Then they should be returned as they are", func() {
+				So(res, ShouldResemble, args)
+			})
+		})
+
+		Convey("When arranging named arguments", func() {
+			_, err := ArrangeUDSFArgs(c, nil, data.Map{"times": data.Int(2)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given duplicated parameter names", t, func() {
+		Convey("When creating a UDSFCreator with them", func() {
+			_, err := WithParamNames(MustConvertToUDSFCreator(createDuplicateUDSF), "stream", "stream")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,180 @@
+package bql
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/bql/execution"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
+)
+
+// ValidationErrorKind is the kind of an error found by Validate.
+type ValidationErrorKind int
+
+const (
+	// ParseValidationError means that a statement has a syntax error or an
+	// invalid component such as an overflowing numeric literal.
+	ParseValidationError ValidationErrorKind = iota
+
+	// AnalysisValidationError means that a statement is syntactically valid
+	// but cannot be executed, e.g. because it uses an unknown source type or
+	// has a non-constant UDSF parameter.
+	AnalysisValidationError
+)
+
+func (k ValidationErrorKind) String() string {
+	switch k {
+	case ParseValidationError:
+		return "parse"
+	case AnalysisValidationError:
+		return "analysis"
+	default:
+		return "unknown"
+	}
+}
+
+// ValidationError is an error found in a BQL document by Validate.
+type ValidationError struct {
+	Kind ValidationErrorKind
+
+	// Line and Symbol are the 1-origin position of the error in the
+	// document. For an analysis error, they point at the beginning of the
+	// statement.
+	Line   int
+	Symbol int
+
+	// Statement is the text of the statement having the error.
+	Statement string
+
+	// Err is the error.
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+// Validate parses and analyzes all statements in the given BQL document and
+// returns errors found in them. It returns an empty slice when the document
+// is valid. Unlike AddStmt, it doesn't modify the topology, so it can be used
+// to check a document before applying it to a running topology.
+//
+// Because statements are validated independently, a statement referring to
+// a node created by a preceding statement isn't reported as an error even if
+// the preceding one is invalid. Validate continues after a statement having
+// an error so that all errors in the document are reported at once.
+func (tb *TopologyBuilder) Validate(doc string) []*ValidationError {
+	errs := []*ValidationError{}
+	p := parser.New()
+	for _, r := range parser.SplitStatements(doc) {
+		text := doc[r.Begin:r.End]
+		stmt, _, err := p.ParseStmt(text)
+		if err != nil {
+			offset := r.Begin
+			if o, ok := parser.ErrorOffset(err); ok {
+				offset += runeOffsetToByteOffset(text, o)
+			}
+			line, symbol := textPosition(doc, offset)
+			errs = append(errs, &ValidationError{
+				Kind:      ParseValidationError,
+				Line:      line,
+				Symbol:    symbol,
+				Statement: text,
+				Err:       err,
+			})
+			continue
+		}
+
+		if err := tb.analyzeStmt(stmt); err != nil {
+			line, symbol := textPosition(doc, r.Begin)
+			errs = append(errs, &ValidationError{
+				Kind:      AnalysisValidationError,
+				Line:      line,
+				Symbol:    symbol,
+				Statement: text,
+				Err:       err,
+			})
+		}
+	}
+	return errs
+}
+
+// analyzeStmt checks a parsed statement without executing it.
+func (tb *TopologyBuilder) analyzeStmt(stmt interface{}) error {
+	analyzeSelects := func(selects ...parser.SelectStmt) error {
+		for _, s := range selects {
+			if _, err := execution.Analyze(s, tb.Reg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch stmt := stmt.(type) {
+	case parser.SelectStmt:
+		return analyzeSelects(stmt)
+	case parser.SelectUnionStmt:
+		return analyzeSelects(stmt.Selects...)
+	case parser.ExplainStmt:
+		return analyzeSelects(stmt.Select)
+	case parser.CreateStreamAsSelectStmt:
+		params, err := tb.mkParamsMap(stmt.Params)
+		if err != nil {
+			return err
+		}
+		if _, err := tb.streamParams(params); err != nil {
+			return err
+		}
+		return analyzeSelects(stmt.Select)
+	case parser.CreateStreamAsSelectUnionStmt:
+		return analyzeSelects(stmt.Selects...)
+	case parser.CreateSourceStmt:
+		if _, err := tb.mkParamsMap(stmt.Params); err != nil {
+			return err
+		}
+		_, err := tb.SourceCreators.Lookup(string(stmt.Type))
+		return err
+	case parser.CreateSinkStmt:
+		if _, err := tb.mkParamsMap(stmt.Params); err != nil {
+			return err
+		}
+		if _, err := schemaValidator(stmt.SchemaAST); err != nil {
+			return err
+		}
+		_, err := tb.SinkCreators.Lookup(string(stmt.Type))
+		return err
+	case parser.CreateStateStmt:
+		if _, err := tb.mkParamsMap(stmt.Params); err != nil {
+			return err
+		}
+		_, err := tb.UDSCreators.Lookup(string(stmt.Type))
+		return err
+	}
+	return nil
+}
+
+// runeOffsetToByteOffset converts an offset in runes in s to the one in
+// bytes. The length of s is returned when the offset exceeds it.
+func runeOffsetToByteOffset(s string, offset int) int {
+	for i := range s {
+		if offset == 0 {
+			return i
+		}
+		offset--
+	}
+	return len(s)
+}
+
+// textPosition returns the 1-origin line and symbol numbers of the character
+// at the given byte offset in s.
+func textPosition(s string, offset int) (int, int) {
+	line, symbol := 1, 1
+	for i, c := range s {
+		if i >= offset {
+			break
+		}
+		if c == '\n' {
+			line, symbol = line+1, 1
+		} else {
+			symbol++
+		}
+	}
+	return line, symbol
+}
@@ -0,0 +1,66 @@
+package bql
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	Convey("Given a BQL TopologyBuilder", t, func() {
+		dt := newTestTopology()
+		Reset(func() {
+			dt.Stop()
+		})
+		tb, err := NewTopologyBuilder(dt)
+		So(err, ShouldBeNil)
+
+		Convey("When validating a valid document", func() {
+			errs := tb.Validate(`CREATE SOURCE s TYPE dummy;
+				CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 1 TUPLES] WHERE int > 1;
+				CREATE SINK snk TYPE collector;
+				INSERT INTO snk FROM t;`)
+
+			Convey("Then there should be no error", func() {
+				So(errs, ShouldBeEmpty)
+			})
+
+			Convey("Then the topology shouldn't be modified", func() {
+				So(dt.Sources(), ShouldBeEmpty)
+				So(dt.Boxes(), ShouldBeEmpty)
+				So(dt.Sinks(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When validating a document having multiple errors", func() {
+			errs := tb.Validate(`CREATE SOURCE s TYPE dummy;
+CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 1 UPLES];
+CREATE SINK snk TYPE no_such_sink;
+  CREATE STREAM u AS SELECT ISTREAM count(int) FROM s [RANGE 1 TUPLES] WHERE count(int) > 1;
+EVAL 1 + 99999999999999999999;`)
+
+			Convey("Then all errors should be reported with their positions", func() {
+				So(len(errs), ShouldEqual, 4)
+
+				So(errs[0].Kind, ShouldEqual, ParseValidationError)
+				So(errs[0].Line, ShouldEqual, 2)
+				So(errs[0].Symbol, ShouldEqual, 55)
+				So(errs[0].Statement, ShouldStartWith, "CREATE STREAM t")
+
+				So(errs[1].Kind, ShouldEqual, AnalysisValidationError)
+				So(errs[1].Line, ShouldEqual, 3)
+				So(errs[1].Symbol, ShouldEqual, 1)
+				So(errs[1].Error(), ShouldContainSubstring, "not registered")
+
+				So(errs[2].Kind, ShouldEqual, AnalysisValidationError)
+				So(errs[2].Line, ShouldEqual, 4)
+				So(errs[2].Symbol, ShouldEqual, 3)
+				So(errs[2].Error(), ShouldContainSubstring, "aggregates not allowed in WHERE clause")
+
+				So(errs[3].Kind, ShouldEqual, ParseValidationError)
+				So(errs[3].Line, ShouldEqual, 5)
+				So(errs[3].Symbol, ShouldEqual, 10)
+				So(errs[3].Error(), ShouldContainSubstring, "out of the range of int64")
+			})
+		})
+	})
+}
@@ -186,6 +186,201 @@ func TestTopologiesQueries(t *testing.T) {
 	})
 }
 
+func TestTopologiesValidate(t *testing.T) {
+	s := testutil.NewServer()
+	defer s.Close()
+	r := newTestRequester(s)
+
+	Convey("Given an API server with a topology", t, func() {
+		res, _, err := do(r, Post, "/topologies", map[string]interface{}{
+			"name": "test_topology",
+		})
+		So(err, ShouldBeNil)
+		So(res.Raw.StatusCode, ShouldEqual, http.StatusOK)
+		Reset(func() {
+			do(r, Delete, "/topologies/test_topology", nil)
+		})
+
+		Convey("When validating valid queries", func() {
+			res, js, err := do(r, Post, "/topologies/test_topology/validate", map[string]interface{}{
+				"queries": `CREATE SOURCE s TYPE dummy;
+					CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 1 TUPLES];`,
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should succeed without errors", func() {
+				So(res.Raw.StatusCode, ShouldEqual, http.StatusOK)
+				So(jscan(js, "/topology_name"), ShouldEqual, "test_topology")
+				So(jscan(js, "/errors"), ShouldBeEmpty)
+			})
+
+			Convey("Then the queries shouldn't be executed", func() {
+				res, js, err := do(r, Get, "/topologies/test_topology/sources", nil)
+				So(err, ShouldBeNil)
+				So(res.Raw.StatusCode, ShouldEqual, http.StatusOK)
+				So(jscan(js, "/sources"), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When validating queries having multiple errors", func() {
+			res, js, err := do(r, Post, "/topologies/test_topology/validate", map[string]interface{}{
+				"queries": `CREATE SOURCE s TYPE no_such_source;
+CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 1 UPLES];`,
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should report each error with its code and position", func() {
+				So(res.Raw.StatusCode, ShouldEqual, http.StatusOK)
+				So(jscan(js, "/errors"), ShouldHaveLength, 2)
+
+				So(jscan(js, "/errors[0]/code"), ShouldEqual, "E0007")
+				So(jscan(js, "/errors[0]/line"), ShouldEqual, 1)
+				So(jscan(js, "/errors[0]/symbol"), ShouldEqual, 1)
+				So(jscan(js, "/errors[0]/statement"), ShouldEqual, "CREATE SOURCE s TYPE no_such_source")
+				So(jscan(js, "/errors[0]/message"), ShouldNotBeBlank)
+
+				So(jscan(js, "/errors[1]/code"), ShouldEqual, "E0006")
+				So(jscan(js, "/errors[1]/line"), ShouldEqual, 2)
+				So(jscan(js, "/errors[1]/symbol"), ShouldEqual, 55)
+				So(jscan(js, "/errors[1]/message"), ShouldNotBeBlank)
+			})
+		})
+
+		Convey("When validating a request without queries", func() {
+			res, _, err := do(r, Post, "/topologies/test_topology/validate", map[string]interface{}{})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should fail", func() {
+				So(res.Raw.StatusCode, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestTopologiesDiff(t *testing.T) {
+	s := testutil.NewServer()
+	defer s.Close()
+	r := newTestRequester(s)
+
+	Convey("Given an API server with a topology having nodes", t, func() {
+		res, _, err := do(r, Post, "/topologies", map[string]interface{}{
+			"name": "test_topology",
+		})
+		So(err, ShouldBeNil)
+		So(res.Raw.StatusCode, ShouldEqual, http.StatusOK)
+		Reset(func() {
+			do(r, Delete, "/topologies/test_topology", nil)
+		})
+
+		deployed := `CREATE PAUSED SOURCE s TYPE dummy;
+			CREATE STREAM t AS SELECT RSTREAM * FROM s [RANGE 1 TUPLES];
+			CREATE SINK snk TYPE stdout;
+			INSERT INTO snk FROM t;`
+		res, _, err = do(r, Post, "/topologies/test_topology/queries", map[string]interface{}{
+			"queries": deployed,
+		})
+		So(err, ShouldBeNil)
+		So(res.Raw.StatusCode, ShouldEqual, http.StatusOK)
+
+		Convey("When comparing the same queries", func() {
+			res, js, err := do(r, Post, "/topologies/test_topology/diff", map[string]interface{}{
+				"queries": deployed,
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should succeed without differences", func() {
+				So(res.Raw.StatusCode, ShouldEqual, http.StatusOK)
+				So(jscan(js, "/topology_name"), ShouldEqual, "test_topology")
+				So(jscan(js, "/diff/added_nodes"), ShouldBeEmpty)
+				So(jscan(js, "/diff/removed_nodes"), ShouldBeEmpty)
+				So(jscan(js, "/diff/changed_nodes"), ShouldBeEmpty)
+				So(jscan(js, "/diff/added_edges"), ShouldBeEmpty)
+				So(jscan(js, "/diff/removed_edges"), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When comparing queries adding a stream", func() {
+			res, js, err := do(r, Post, "/topologies/test_topology/diff", map[string]interface{}{
+				"queries": deployed + `
+					CREATE STREAM u AS SELECT RSTREAM * FROM t [RANGE 1 TUPLES];`,
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should report the stream and its edge", func() {
+				So(res.Raw.StatusCode, ShouldEqual, http.StatusOK)
+				So(jscan(js, "/diff/added_nodes"), ShouldHaveLength, 1)
+				So(jscan(js, "/diff/added_nodes[0]/name"), ShouldEqual, "u")
+				So(jscan(js, "/diff/added_nodes[0]/node_type"), ShouldEqual, "box")
+				So(jscan(js, "/diff/added_nodes[0]/definition"), ShouldEqual,
+					"CREATE STREAM u AS SELECT RSTREAM * FROM t [RANGE 1 TUPLES]")
+				So(jscan(js, "/diff/added_edges"), ShouldHaveLength, 1)
+				So(jscan(js, "/diff/added_edges[0]/from"), ShouldEqual, "t")
+				So(jscan(js, "/diff/added_edges[0]/to"), ShouldEqual, "u")
+				So(jscan(js, "/diff/removed_nodes"), ShouldBeEmpty)
+				So(jscan(js, "/diff/removed_edges"), ShouldBeEmpty)
+			})
+
+			Convey("Then the queries shouldn't be executed", func() {
+				res, js, err := do(r, Get, "/topologies/test_topology/streams", nil)
+				So(err, ShouldBeNil)
+				So(res.Raw.StatusCode, ShouldEqual, http.StatusOK)
+				So(jscan(js, "/count"), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When comparing queries dropping a sink", func() {
+			res, js, err := do(r, Post, "/topologies/test_topology/diff", map[string]interface{}{
+				"queries": deployed + `
+					DROP SINK snk;`,
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should report the sink and its edge", func() {
+				So(res.Raw.StatusCode, ShouldEqual, http.StatusOK)
+				So(jscan(js, "/diff/removed_nodes"), ShouldHaveLength, 1)
+				So(jscan(js, "/diff/removed_nodes[0]/name"), ShouldEqual, "snk")
+				So(jscan(js, "/diff/removed_nodes[0]/node_type"), ShouldEqual, "sink")
+				So(jscan(js, "/diff/removed_edges"), ShouldHaveLength, 1)
+				So(jscan(js, "/diff/removed_edges[0]/from"), ShouldEqual, "t")
+				So(jscan(js, "/diff/removed_edges[0]/to"), ShouldEqual, "snk")
+			})
+		})
+
+		Convey("When comparing queries having a syntax error", func() {
+			res, js, err := do(r, Post, "/topologies/test_topology/diff", map[string]interface{}{
+				"queries": `CREATE STREAM t AS SELECT ISTREAM int FROM s [RANGE 1 UPLES];`,
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should fail", func() {
+				So(res.Raw.StatusCode, ShouldEqual, http.StatusBadRequest)
+				So(jscan(js, "/error/meta/parse_errors"), ShouldNotBeEmpty)
+			})
+		})
+
+		Convey("When comparing queries using an undefined UDSF", func() {
+			res, js, err := do(r, Post, "/topologies/test_topology/diff", map[string]interface{}{
+				"queries": `CREATE STREAM t AS SELECT ISTREAM * FROM no_such_udsf("s") [RANGE 1 TUPLES];`,
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should fail", func() {
+				So(res.Raw.StatusCode, ShouldEqual, http.StatusBadRequest)
+				So(jscan(js, "/error/meta/error"), ShouldNotBeBlank)
+			})
+		})
+
+		Convey("When comparing a request without queries", func() {
+			res, _, err := do(r, Post, "/topologies/test_topology/diff", map[string]interface{}{})
+			So(err, ShouldBeNil)
+
+			Convey("Then it should fail", func() {
+				So(res.Raw.StatusCode, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
 func TestTopologiesQueriesSelectStmt(t *testing.T) {
 	// TODO: Because results from a SELECT stmt needs to be returned through
 	// hijacking, a real HTTP server is required. Support Hijack method in test
@@ -379,7 +379,7 @@ func executeTarget(t core.Topology, ent *CacheEntry, stmt *Statement, resumeAll
 		}
 		sn.State().Wait(core.TSStopped)
 
-	case parser.InsertIntoFromStmt:
+	case parser.InsertIntoFromStmt, parser.TeeStmt:
 		if err := resumeAll(); err != nil {
 			return err
 		}
@@ -6,7 +6,6 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/bql/parser"
 	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
-	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"sort"
 )
 
@@ -21,12 +20,14 @@ type Statement struct {
 //	* SELECT (CREATE STREAM is supported)
 //	* UPDATE SOURCE/SINK/STATE
 //	* DROP SOURCE/STREAM/SINK/STATE
+//	* ALTER STREAM
 //	* SAVE/LOAD STATE (they are automatically saved)
 func NewStatement(s interface{}) (*Statement, error) {
 	switch s.(type) {
 	case parser.SelectStmt, parser.SelectUnionStmt,
 		parser.UpdateSourceStmt, parser.UpdateSinkStmt, parser.UpdateStateStmt,
 		parser.DropSourceStmt, parser.DropStreamStmt, parser.DropSinkStmt, parser.DropStateStmt,
+		parser.AlterStreamStmt,
 		parser.SaveStateStmt, parser.LoadStateStmt, parser.LoadStateOrCreateStmt:
 		return nil, fmt.Errorf("statement isn't supported by sensorbee exp command: %v", s)
 	}
@@ -51,10 +52,17 @@ func (s *Statement) Input() ([]string, error) {
 			if err != nil {
 				return nil, err
 			}
-			names = append(names, ns...)
+			for _, n := range ns {
+				if stmt.Recursive && n == string(stmt.Name) {
+					continue
+				}
+				names = append(names, n)
+			}
 		}
 	case parser.InsertIntoFromStmt:
 		return []string{string(stmt.Input)}, nil
+	case parser.TeeStmt:
+		return []string{string(stmt.Stream)}, nil
 	}
 	if err != nil {
 		return nil, err
@@ -63,22 +71,41 @@ func (s *Statement) Input() ([]string, error) {
 }
 
 func inputFromSelect(stmt *parser.SelectStmt) ([]string, error) {
+	// names defined in the WITH clause refer to intermediate streams
+	// created for the statement, so their inputs are used instead
 	var names []string
-	for _, rel := range stmt.Relations {
+	defined := map[string]bool{}
+	for _, named := range stmt.With {
+		ns, err := inputFromRelations(named.Select.Relations, defined)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, ns...)
+		defined[string(named.Name)] = true
+	}
+	ns, err := inputFromRelations(stmt.Relations, defined)
+	if err != nil {
+		return nil, err
+	}
+	return append(names, ns...), nil
+}
+
+func inputFromRelations(rels []parser.AliasedStreamWindowAST, defined map[string]bool) ([]string, error) {
+	var names []string
+	for _, rel := range rels {
 		switch rel.Type {
-		case parser.ActualStream:
+		case parser.ActualStream, parser.MatchRecognizeStream:
+			if defined[rel.Name] {
+				continue
+			}
 			names = append(names, rel.Name)
 
 		case parser.UDSFStream:
 			ctx := core.NewContext(nil)
 			udfReg := udf.CopyGlobalUDFRegistry(ctx)
-			params := make([]data.Value, len(rel.Params))
-			for i, expr := range rel.Params {
-				p, err := execution.EvaluateFoldable(expr, udfReg)
-				if err != nil {
-					return nil, err
-				}
-				params[i] = p
+			args, named, err := execution.EvaluateUDSFArgs(&rel, udfReg)
+			if err != nil {
+				return nil, err
 			}
 
 			reg, err := udf.CopyGlobalUDSFCreatorRegistry()
@@ -86,7 +113,11 @@ func inputFromSelect(stmt *parser.SelectStmt) ([]string, error) {
 				return nil, err
 			}
 
-			udsfc, err := reg.Lookup(rel.Name, len(params))
+			udsfc, err := reg.Lookup(rel.Name, len(args)+len(named))
+			if err != nil {
+				return nil, err
+			}
+			params, err := udf.ArrangeUDSFArgs(udsfc, args, named)
 			if err != nil {
 				return nil, err
 			}
@@ -140,6 +171,8 @@ func (s *Statement) NodeName() string {
 		return string(stmt.Name)
 	case parser.InsertIntoFromStmt:
 		return string(stmt.Sink)
+	case parser.TeeStmt:
+		return string(stmt.Sink)
 	}
 	// There's no need to cache the result of sinks.
 	// CREATE STATE returns "" because it doesn't create a node.
@@ -171,10 +204,10 @@ func (s *Statement) IsDataSourceNodeQuery() bool {
 	return false
 }
 
-// IsInsertStatement returns true when the statement is INSERT INTO.
+// IsInsertStatement returns true when the statement is INSERT INTO or TEE.
 func (s *Statement) IsInsertStatement() bool {
 	switch s.Stmt.(type) {
-	case parser.InsertIntoFromStmt:
+	case parser.InsertIntoFromStmt, parser.TeeStmt:
 		return true
 	}
 	return false
@@ -216,3 +249,31 @@ func Parse(bql string) (*Statements, error) {
 	}
 	return ss, nil
 }
+
+// UnusedNodes returns names of sources and streams which are created by the
+// statements but never referenced by any INSERT INTO or downstream SELECT
+// statement. Such nodes are likely to be dead and can be removed from the
+// program. Names are returned in the order of their creation.
+func (ss *Statements) UnusedNodes() ([]string, error) {
+	used := map[string]bool{}
+	for _, s := range ss.Stmts {
+		inputs, err := s.Input()
+		if err != nil {
+			return nil, err
+		}
+		for _, in := range inputs {
+			used[in] = true
+		}
+	}
+
+	var unused []string
+	for _, s := range ss.Stmts {
+		if !s.IsDataSourceNodeQuery() {
+			continue
+		}
+		if n := s.NodeName(); !used[n] {
+			unused = append(unused, n)
+		}
+	}
+	return unused, nil
+}
@@ -0,0 +1,48 @@
+package exp
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestStatementsUnusedNodes(t *testing.T) {
+	Convey("Given statements having a consumed stream and an orphan stream", t, func() {
+		stmts, err := Parse(`
+			CREATE PAUSED SOURCE src TYPE dummy;
+			CREATE STREAM consumed AS SELECT RSTREAM * FROM src [RANGE 1 TUPLES];
+			CREATE STREAM orphan AS SELECT RSTREAM * FROM src [RANGE 1 TUPLES];
+			CREATE STREAM out AS SELECT RSTREAM * FROM consumed [RANGE 1 TUPLES];
+			CREATE SINK snk TYPE stdout;
+			INSERT INTO snk FROM out;`)
+		So(err, ShouldBeNil)
+
+		Convey("When detecting unused nodes", func() {
+			unused, err := stmts.UnusedNodes()
+			So(err, ShouldBeNil)
+
+			Convey("Then only the orphan stream should be reported", func() {
+				So(unused, ShouldResemble, []string{"orphan"})
+			})
+		})
+	})
+
+	Convey("Given statements having an unused source", t, func() {
+		stmts, err := Parse(`
+			CREATE PAUSED SOURCE src1 TYPE dummy;
+			CREATE PAUSED SOURCE src2 TYPE dummy;
+			CREATE STREAM s AS SELECT RSTREAM * FROM src1 [RANGE 1 TUPLES]
+				UNION ALL SELECT RSTREAM * FROM src1 [RANGE 2 TUPLES];
+			CREATE SINK snk TYPE stdout;
+			INSERT INTO snk FROM s;`)
+		So(err, ShouldBeNil)
+
+		Convey("When detecting unused nodes", func() {
+			unused, err := stmts.UnusedNodes()
+			So(err, ShouldBeNil)
+
+			Convey("Then the unused source should be reported", func() {
+				So(unused, ShouldResemble, []string{"src2"})
+			})
+		})
+	})
+}
@@ -71,7 +71,7 @@ func (b *bqlCmd) Init() error {
 
 // Name returns BQL start words.
 func (b *bqlCmd) Name() []string {
-	return []string{"select", "create", "update", "insert", "pause", "resume",
+	return []string{"select", "create", "update", "insert", "tee", "pause", "resume",
 		"rewind", "drop", "save", "load", "eval"}
 }
 
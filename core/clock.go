@@ -0,0 +1,61 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the current time. It's used by a Context to assign system
+// timestamps to tuples and to compute now() in BQL so that tests can control
+// the time by replacing the clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// RealClock returns a Clock which returns the system time.
+func RealClock() Clock {
+	return realClock{}
+}
+
+// FakeClock is a Clock which only advances when Set or Advance is called.
+// It's mainly used in tests which need deterministic timestamps.
+type FakeClock struct {
+	m   sync.RWMutex
+	now time.Time
+}
+
+// NewFakeClock creates a new FakeClock returning the given time.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{
+		now: t,
+	}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.now
+}
+
+// Set sets the current time of the clock.
+func (c *FakeClock) Set(t time.Time) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = t
+}
+
+// Advance moves the clock forward by d and returns the new time.
+func (c *FakeClock) Advance(d time.Duration) time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
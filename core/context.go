@@ -4,8 +4,10 @@ import (
 	"errors"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
@@ -30,9 +32,13 @@ type Context struct {
 	topologyName string
 	Flags        ContextFlags
 	SharedStates SharedStateRegistry
+	clock        Clock
 
 	dtMutex   sync.RWMutex
 	dtSources map[int64]*droppedTupleCollectorSource
+
+	maxUDSFInstances int
+	udsfMutex        sync.Mutex
 }
 
 // ContextConfig has configuration parameters of a Context.
@@ -40,6 +46,14 @@ type ContextConfig struct {
 	// Logger provides a logrus's logger used by the Context.
 	Logger *logrus.Logger
 	Flags  ContextFlags
+
+	// Clock provides the time used for system timestamps of tuples and
+	// now() in BQL. The system time is used when it's nil.
+	Clock Clock
+
+	// MaxUDSFInstances is the maximum number of UDSFs running in the
+	// topology at the same time. It's unlimited when it's 0.
+	MaxUDSFInstances int
 }
 
 // NewContext creates a new Context based on the config. If config is nil,
@@ -52,15 +66,41 @@ func NewContext(config *ContextConfig) *Context {
 	if logger == nil {
 		logger = logrus.StandardLogger()
 	}
+	clock := config.Clock
+	if clock == nil {
+		clock = RealClock()
+	}
 	c := &Context{
 		logger:    logger,
 		Flags:     config.Flags,
+		clock:     clock,
 		dtSources: map[int64]*droppedTupleCollectorSource{},
+
+		maxUDSFInstances: config.MaxUDSFInstances,
 	}
 	c.SharedStates = NewDefaultSharedStateRegistry(c)
 	return c
 }
 
+// Now returns the current time of the clock tied to the Context. The system
+// time is returned when c is nil so that components which can run without a
+// Context don't have to check it.
+func (c *Context) Now() time.Time {
+	if c == nil || c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
+
+// UDSFInstanceLimit returns the maximum number of UDSFs running in the
+// topology and the lock which has to be held while checking the number and
+// adding UDSF nodes. The lock is shared by all users of the Context so that
+// multiple builders working on the same topology cannot exceed the limit
+// together. The limit is 0 when it's unlimited.
+func (c *Context) UDSFInstanceLimit() (int, sync.Locker) {
+	return c.maxUDSFInstances, &c.udsfMutex
+}
+
 // Log returns the logger tied to the Context.
 func (c *Context) Log() *logrus.Entry {
 	return c.log(1)
@@ -71,6 +111,35 @@ func (c *Context) ErrLog(err error) *logrus.Entry {
 	return c.log(1).WithField("err", err)
 }
 
+// NodeLogger returns a logger bound to the node having the given type and
+// name. Entries created by the logger have "node_type" and "node_name"
+// fields.
+func (c *Context) NodeLogger(t NodeType, name string) *NodeLogger {
+	return &NodeLogger{
+		ctx:    c,
+		fields: nodeLogFields(t, name),
+	}
+}
+
+// NodeLogger is a logger bound to a node. It can be kept by the node or its
+// components so that they don't have to build logging fields of the node
+// every time they write logs.
+type NodeLogger struct {
+	ctx    *Context
+	fields logrus.Fields
+}
+
+// Log returns the logger tied to the Context having the node information.
+func (l *NodeLogger) Log() *logrus.Entry {
+	return l.ctx.log(1).WithFields(l.fields)
+}
+
+// ErrLog returns the logger tied to the Context having the node and error
+// information.
+func (l *NodeLogger) ErrLog(err error) *logrus.Entry {
+	return l.ctx.log(1).WithFields(l.fields).WithField("err", err)
+}
+
 func (c *Context) log(depth int) *logrus.Entry {
 	// TODO: This is a temporary solution until logrus support filename and line number
 	_, file, line, ok := runtime.Caller(depth + 1)
@@ -99,7 +168,7 @@ func (c *Context) droppedTuple(t *Tuple, nodeType NodeType, nodeName string, et
 			js = t.Data.String()
 		}
 
-		l := c.Log().WithFields(nodeLogFields(nodeType, nodeName)).WithFields(logrus.Fields{
+		l := c.NodeLogger(nodeType, nodeName).Log().WithFields(logrus.Fields{
 			"event_type": et.String(),
 			"tuple": logrus.Fields{
 				"timestamp": data.Timestamp(t.Timestamp),
@@ -139,6 +208,9 @@ func (c *Context) droppedTuple(t *Tuple, nodeType NodeType, nodeName string, et
 	} // Otherwise, the value of TFShared should not be modified.
 
 	for _, s := range c.dtSources {
+		if s.nodeName != "" && !strings.EqualFold(s.nodeName, nodeName) {
+			continue
+		}
 		s.w.Write(c, dt) // There isn't much meaning to report errors here.
 	}
 }
@@ -213,6 +285,10 @@ type droppedTupleCollectorSource struct {
 	id    int64
 	m     sync.Mutex
 	state *topologyStateHolder
+
+	// nodeName is the name of the node whose dropped tuples are collected.
+	// Tuples dropped by all nodes are collected when it's empty.
+	nodeName string
 }
 
 // NewDroppedTupleCollectorSource returns a source which generates a stream
@@ -235,6 +311,19 @@ func NewDroppedTupleCollectorSource() Source {
 	return src
 }
 
+// NewNodeDroppedTupleCollectorSource returns a source which generates a
+// stream containing tuples dropped by the node having the given name. The
+// name is case-insensitive and the node doesn't have to exist when the source
+// is created. Tuples generated from this source have the same fields as ones
+// generated from the source returned by NewDroppedTupleCollectorSource.
+func NewNodeDroppedTupleCollectorSource(nodeName string) Source {
+	src := &droppedTupleCollectorSource{
+		nodeName: nodeName,
+	}
+	src.state = newTopologyStateHolder(&src.m)
+	return src
+}
+
 func (s *droppedTupleCollectorSource) GenerateStream(ctx *Context, w Writer) error {
 	s.m.Lock()
 	defer s.m.Unlock()
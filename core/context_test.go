@@ -1,8 +1,13 @@
 package core
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
+	"time"
 )
 
 func TestAtomicFlag(t *testing.T) {
@@ -44,3 +49,87 @@ func TestAtomicFlag(t *testing.T) {
 		})
 	})
 }
+
+func TestNodeLogger(t *testing.T) {
+	Convey("Given a Context writing logs to a buffer", t, func() {
+		buf := bytes.NewBuffer(nil)
+		logger := logrus.New()
+		logger.Out = buf
+		logger.Formatter = &logrus.JSONFormatter{}
+		ctx := NewContext(&ContextConfig{
+			Logger: logger,
+		})
+		l := ctx.NodeLogger(NTBox, "test_box")
+
+		readEntry := func() map[string]interface{} {
+			m := map[string]interface{}{}
+			So(json.Unmarshal(buf.Bytes(), &m), ShouldBeNil)
+			return m
+		}
+
+		Convey("When writing a log with the node logger", func() {
+			l.Log().Info("hello")
+			e := readEntry()
+
+			Convey("Then it should have the node type and name", func() {
+				So(e["node_type"], ShouldEqual, "box")
+				So(e["node_name"], ShouldEqual, "test_box")
+				So(e["msg"], ShouldEqual, "hello")
+			})
+
+			Convey("Then it should have the location of the caller", func() {
+				So(e["file"], ShouldEqual, "context_test.go")
+			})
+		})
+
+		Convey("When writing an error log with the node logger", func() {
+			l.ErrLog(errors.New("test error")).Error("failure")
+			e := readEntry()
+
+			Convey("Then it should have the node and error information", func() {
+				So(e["node_type"], ShouldEqual, "box")
+				So(e["node_name"], ShouldEqual, "test_box")
+				So(e["err"], ShouldEqual, "test error")
+				So(e["file"], ShouldEqual, "context_test.go")
+			})
+		})
+	})
+}
+
+func TestContextClock(t *testing.T) {
+	Convey("Given a context having a fake clock", t, func() {
+		t0 := time.Date(2015, time.April, 10, 10, 23, 0, 0, time.UTC)
+		clock := NewFakeClock(t0)
+		ctx := NewContext(&ContextConfig{
+			Clock: clock,
+		})
+
+		Convey("When getting the current time", func() {
+			Convey("Then it should be the time of the clock", func() {
+				So(ctx.Now(), ShouldResemble, t0)
+			})
+		})
+
+		Convey("When advancing the clock", func() {
+			t1 := clock.Advance(3 * time.Second)
+
+			Convey("Then the context should return the new time", func() {
+				So(t1, ShouldResemble, t0.Add(3*time.Second))
+				So(ctx.Now(), ShouldResemble, t1)
+			})
+		})
+	})
+
+	Convey("Given a context without a clock", t, func() {
+		ctx := NewContext(nil)
+
+		Convey("When getting the current time", func() {
+			before := time.Now()
+			now := ctx.Now()
+
+			Convey("Then it should be the system time", func() {
+				So(now, ShouldHappenOnOrBetween, before, time.Now())
+			})
+		})
+	})
+}
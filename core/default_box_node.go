@@ -54,6 +54,27 @@ func (db *defaultBoxNode) Input(refname string, config *BoxInputConfig) error {
 	return nil
 }
 
+func (db *defaultBoxNode) SetInputCapacity(refname string, capacity int) error {
+	config := &BoxInputConfig{Capacity: capacity}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	s, err := db.topology.dataSource(refname)
+	if err != nil {
+		return err
+	}
+	return db.srcs.setCapacity(s.Name(), config.capacity())
+}
+
+func (db *defaultBoxNode) SetInputDropMode(refname string, mode QueueDropMode) error {
+	s, err := db.topology.dataSource(refname)
+	if err != nil {
+		return err
+	}
+	return db.srcs.setDropMode(s.Name(), mode)
+}
+
 func (db *defaultBoxNode) run() (runErr error) {
 	if err := db.checkAndPrepareForRunning("box"); err != nil {
 		return err
@@ -65,7 +86,7 @@ func (db *defaultBoxNode) run() (runErr error) {
 				if db.runErr == nil {
 					db.runErr = fmt.Errorf("the box couldn't be terminated due to panic: %v", e)
 				} else {
-					db.topology.ctx.ErrLog(fmt.Errorf("%v", e)).WithFields(nodeLogFields(NTBox, db.name)).
+					db.topology.ctx.NodeLogger(NTBox, db.name).ErrLog(fmt.Errorf("%v", e)).
 						Error("Cannot terminate the box due to panic")
 				}
 			}
@@ -78,7 +99,7 @@ func (db *defaultBoxNode) run() (runErr error) {
 				if db.runErr == nil {
 					db.runErr = err
 				} else {
-					db.topology.ctx.ErrLog(err).WithFields(nodeLogFields(NTBox, db.name)).
+					db.topology.ctx.NodeLogger(NTBox, db.name).ErrLog(err).
 						Error("Cannot terminate the box")
 				}
 			}
@@ -86,7 +107,7 @@ func (db *defaultBoxNode) run() (runErr error) {
 	}()
 	db.state.Set(TSRunning)
 	w := newBoxWriterAdapter(db.box, db.name, db.dsts)
-	db.runErr = db.srcs.pour(db.topology.ctx, w, 1) // TODO: make parallelism configurable
+	db.runErr = db.srcs.pourPartitioned(db.topology.ctx, w, db.config.Parallelism, db.config.PartitionKey)
 	return
 }
 
@@ -3,6 +3,9 @@ package core
 import (
 	"fmt"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type defaultSinkNode struct {
@@ -11,6 +14,22 @@ type defaultSinkNode struct {
 	srcs   *dataSources
 	sink   Sink
 
+	// deadLetter is the pipe to the dead-letter sink. It's nil when the sink
+	// doesn't have one.
+	deadLetter *pipeSender
+
+	// numRetries, numDeadLetters, numBatches, and numDryRun are accessed
+	// atomically.
+	numRetries     int64
+	numDeadLetters int64
+	numBatches     int64
+	numDryRun      int64
+
+	// dryRunSince is the time at which the first dry-run input was added.
+	// It's zero when the sink doesn't have any dry-run input. It's protected
+	// by stateMutex.
+	dryRunSince time.Time
+
 	gracefulStopEnabled     bool
 	stopOnDisconnectEnabled bool
 	runErr                  error
@@ -45,7 +64,13 @@ func (ds *defaultSinkNode) Input(refname string, config *SinkInputConfig) error
 		return err
 	}
 
-	recv, send := newPipe("output", config.capacity())
+	inputName := "output"
+	if config.DryRun {
+		// tuples from a dry-run input are marked by the input name so that
+		// they can be discarded before being written to the sink
+		inputName = dryRunInputName
+	}
+	recv, send := newPipe(inputName, config.capacity())
 	send.dropMode = config.DropMode
 	if err := s.destinations().add(ds.name, send); err != nil {
 		return err
@@ -54,9 +79,19 @@ func (ds *defaultSinkNode) Input(refname string, config *SinkInputConfig) error
 		s.destinations().remove(ds.name)
 		return err
 	}
+	if config.DryRun {
+		ds.stateMutex.Lock()
+		if ds.dryRunSince.IsZero() {
+			ds.dryRunSince = ds.topology.ctx.Now()
+		}
+		ds.stateMutex.Unlock()
+	}
 	return nil
 }
 
+// dryRunInputName is the input name of tuples from dry-run inputs.
+const dryRunInputName = "*dry_run*"
+
 func (ds *defaultSinkNode) run() (runErr error) {
 	if err := ds.checkAndPrepareForRunning("sink"); err != nil {
 		return err
@@ -69,7 +104,7 @@ func (ds *defaultSinkNode) run() (runErr error) {
 				if ds.runErr == nil {
 					ds.runErr = fmt.Errorf("the box couldn't be terminated due to panic: %v", e)
 				} else {
-					ds.topology.ctx.ErrLog(fmt.Errorf("%v", e)).WithFields(nodeLogFields(NTBox, ds.name)).
+					ds.topology.ctx.NodeLogger(NTSink, ds.name).ErrLog(fmt.Errorf("%v", e)).
 						Error("Cannot terminate the box due to panic")
 				}
 			}
@@ -77,12 +112,85 @@ func (ds *defaultSinkNode) run() (runErr error) {
 		}()
 		if err := ds.sink.Close(ds.topology.ctx); err != nil {
 			ds.runErr = err
-			ds.topology.ctx.ErrLog(err).WithFields(nodeLogFields(NTSink, ds.name)).
+			ds.topology.ctx.NodeLogger(NTSink, ds.name).ErrLog(err).
 				Error("Cannot stop the sink")
 		}
 	}()
+	if ds.deadLetter != nil {
+		// the dead-letter sink stops reading from the pipe when it's closed
+		defer ds.deadLetter.close()
+	}
+
 	ds.state.Set(TSRunning)
-	ds.runErr = ds.srcs.pour(ds.topology.ctx, newTraceWriter(ds.sink, ETInput, ds.name), 1)
+	logger := ds.topology.ctx.NodeLogger(NTSink, ds.name)
+	var w Writer = newTraceWriter(ds.sink, ETInput, ds.name)
+	var pw *sinkPolicyWriter
+	if ds.config.Retry != nil || ds.deadLetter != nil {
+		pw = &sinkPolicyWriter{
+			w:              w,
+			retry:          ds.config.Retry,
+			deadLetter:     ds.deadLetter,
+			numRetries:     &ds.numRetries,
+			numDeadLetters: &ds.numDeadLetters,
+			logger:         logger,
+		}
+		w = pw
+	}
+
+	var bw *sinkBatchWriter
+	if bs, ok := ds.batchSink(); ok {
+		writeBatch := func(ctx *Context, ts []*Tuple) error {
+			for _, t := range ts {
+				tracing(t, ctx, ETInput, ds.name)
+			}
+			return bs.WriteBatch(ctx, ts)
+		}
+		if pw != nil {
+			f := writeBatch
+			writeBatch = func(ctx *Context, ts []*Tuple) error {
+				return pw.write(ctx, func() error { return f(ctx, ts) }, ts...)
+			}
+		}
+		bw = &sinkBatchWriter{
+			ctx:        ds.topology.ctx,
+			policy:     ds.config.Batch,
+			write:      writeBatch,
+			numBatches: &ds.numBatches,
+			logger:     logger,
+		}
+		w = bw
+	}
+
+	ds.runErr = ds.srcs.pour(ds.topology.ctx, WriterFunc(func(ctx *Context, t *Tuple) error {
+		// heartbeats are only meaningful to boxes
+		if t.Flags.IsSet(TFHeartbeat) {
+			return nil
+		}
+		if t.InputName == dryRunInputName {
+			atomic.AddInt64(&ds.numDryRun, 1)
+			return nil
+		}
+		if v := ds.config.Validator; v != nil {
+			if err := v.Validate(t); err != nil {
+				return err
+			}
+		}
+		if g := ds.config.IDGenerator; g != nil {
+			id, err := g.GenerateID(t)
+			if err != nil {
+				return err
+			}
+			if t.Flags.IsSet(TFShared) {
+				t = t.ShallowCopy()
+			}
+			t.ID = id
+		}
+		return w.Write(ctx, t)
+	}), 1)
+	if bw != nil {
+		// write tuples remaining in the last batch before closing the sink
+		bw.close()
+	}
 	return
 }
 
@@ -119,6 +227,7 @@ func (ds *defaultSinkNode) Status() data.Map {
 	gstop := ds.gracefulStopEnabled
 	stopOnDisconnect := ds.stopOnDisconnectEnabled
 	removeOnStop := ds.config.RemoveOnStop
+	dryRunSince := ds.dryRunSince
 	ds.stateMutex.Unlock()
 
 	m := data.Map{
@@ -133,12 +242,52 @@ func (ds *defaultSinkNode) Status() data.Map {
 	if st == TSStopped && ds.runErr != nil {
 		m["error"] = data.String(ds.runErr.Error())
 	}
+	if r := ds.config.Retry; r != nil {
+		m["retry"] = data.Map{
+			"max_retries": data.Int(r.MaxRetries),
+			"num_retries": data.Int(atomic.LoadInt64(&ds.numRetries)),
+		}
+	}
+	if ds.deadLetter != nil {
+		m["dead_letter"] = data.Map{
+			"sink":             data.String(ds.config.DeadLetter),
+			"num_dead_letters": data.Int(atomic.LoadInt64(&ds.numDeadLetters)),
+		}
+	}
+	if !dryRunSince.IsZero() {
+		n := atomic.LoadInt64(&ds.numDryRun)
+		throughput := 0.0
+		if d := ds.topology.ctx.Now().Sub(dryRunSince).Seconds(); d > 0 {
+			throughput = float64(n) / d
+		}
+		m["dry_run"] = data.Map{
+			"num_discarded": data.Int(n),
+			"throughput":    data.Float(throughput),
+		}
+	}
+	if _, ok := ds.batchSink(); ok {
+		m["batch"] = data.Map{
+			"size":        data.Int(ds.config.Batch.Size),
+			"timeout":     data.Float(ds.config.Batch.Timeout.Seconds()),
+			"num_batches": data.Int(atomic.LoadInt64(&ds.numBatches)),
+		}
+	}
 	if s, ok := ds.sink.(Statuser); ok {
 		m["sink"] = s.Status()
 	}
 	return m
 }
 
+// batchSink returns the sink as a BatchSink when tuples should be written to
+// it in micro-batches.
+func (ds *defaultSinkNode) batchSink() (BatchSink, bool) {
+	if ds.config.Batch == nil {
+		return nil, false
+	}
+	bs, ok := ds.sink.(BatchSink)
+	return bs, ok
+}
+
 func (ds *defaultSinkNode) RemoveOnStop() {
 	ds.stateMutex.Lock()
 	ds.config.RemoveOnStop = true
@@ -149,3 +298,137 @@ func (ds *defaultSinkNode) RemoveOnStop() {
 		ds.topology.Remove(ds.name)
 	}
 }
+
+// sinkPolicyWriter retries writes failed with a temporary error and writes
+// tuples which couldn't be written to the dead-letter sink. A fatal error is
+// returned as it is so that the sink stops.
+type sinkPolicyWriter struct {
+	w          Writer
+	retry      *SinkRetryPolicy
+	deadLetter *pipeSender
+
+	numRetries     *int64
+	numDeadLetters *int64
+	logger         *NodeLogger
+}
+
+func (pw *sinkPolicyWriter) Write(ctx *Context, t *Tuple) error {
+	return pw.write(ctx, func() error { return pw.w.Write(ctx, t) }, t)
+}
+
+// write calls f, which writes ts to the sink, with the policy. f is called
+// again on retries and all tuples in ts are written to the dead-letter sink
+// when f finally fails.
+func (pw *sinkPolicyWriter) write(ctx *Context, f func() error, ts ...*Tuple) error {
+	err := f()
+	if pw.retry != nil {
+		for n := 1; n <= pw.retry.MaxRetries && err != nil && IsTemporaryError(err); n++ {
+			time.Sleep(pw.retry.interval(n))
+			atomic.AddInt64(pw.numRetries, 1)
+			err = f()
+		}
+	}
+	if err == nil || IsFatalError(err) || pw.deadLetter == nil {
+		return err
+	}
+
+	for _, t := range ts {
+		if dlErr := pw.deadLetter.Write(ctx, t); dlErr != nil {
+			pw.logger.ErrLog(dlErr).Error("Cannot write a tuple to the dead-letter sink")
+			return err
+		}
+		atomic.AddInt64(pw.numDeadLetters, 1)
+	}
+	pw.logger.ErrLog(err).Warn("A tuple was written to the dead-letter sink")
+	return nil
+}
+
+// sinkBatchWriter accumulates tuples and writes them at once when the batch
+// becomes full or when the timeout of the batch expires.
+type sinkBatchWriter struct {
+	m      sync.Mutex
+	ctx    *Context
+	policy *SinkBatchPolicy
+	write  func(ctx *Context, ts []*Tuple) error
+	batch  []*Tuple
+
+	// seq identifies the current batch so that a timer set for a batch which
+	// has already been written doesn't write the next one.
+	seq   int64
+	timer *time.Timer
+
+	// fatalErr is a fatal error returned from a write triggered by the
+	// timeout. It's returned from the next Write so that the sink stops.
+	fatalErr error
+
+	numBatches *int64
+	logger     *NodeLogger
+}
+
+func (bw *sinkBatchWriter) Write(ctx *Context, t *Tuple) error {
+	bw.m.Lock()
+	defer bw.m.Unlock()
+	if bw.fatalErr != nil {
+		return bw.fatalErr
+	}
+
+	bw.batch = append(bw.batch, t)
+	if len(bw.batch) >= bw.policy.Size {
+		return bw.flush(ctx)
+	}
+	if len(bw.batch) == 1 && bw.policy.Timeout > 0 {
+		seq := bw.seq
+		bw.timer = time.AfterFunc(bw.policy.Timeout, func() {
+			bw.timeout(seq)
+		})
+	}
+	return nil
+}
+
+func (bw *sinkBatchWriter) timeout(seq int64) {
+	bw.m.Lock()
+	defer bw.m.Unlock()
+	if seq != bw.seq {
+		return
+	}
+	bw.handleError(bw.flush(bw.ctx))
+}
+
+// close writes the remaining tuples and stops the timer.
+func (bw *sinkBatchWriter) close() {
+	bw.m.Lock()
+	defer bw.m.Unlock()
+	bw.handleError(bw.flush(bw.ctx))
+}
+
+// flush writes the current batch and starts a new one. The caller must hold
+// the lock.
+func (bw *sinkBatchWriter) flush(ctx *Context) error {
+	if bw.timer != nil {
+		bw.timer.Stop()
+		bw.timer = nil
+	}
+	bw.seq++
+	if len(bw.batch) == 0 {
+		return nil
+	}
+
+	err := bw.write(ctx, bw.batch)
+	atomic.AddInt64(bw.numBatches, 1)
+	for i := range bw.batch {
+		bw.batch[i] = nil // release tuples
+	}
+	bw.batch = bw.batch[:0]
+	return err
+}
+
+// handleError handles an error of a write which isn't triggered by Write.
+func (bw *sinkBatchWriter) handleError(err error) {
+	if err == nil {
+		return
+	}
+	if IsFatalError(err) {
+		bw.fatalErr = err
+	}
+	bw.logger.ErrLog(err).Error("Cannot write a batch of tuples to the sink")
+}
@@ -4,6 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type defaultSourceNode struct {
@@ -14,8 +18,44 @@ type defaultSourceNode struct {
 	pausedOnStartup         bool
 	stopOnDisconnectEnabled bool
 	runErr                  error
+
+	// autoPaused is true when the source is paused due to backpressure. It's
+	// protected by stateMutex.
+	autoPaused bool
+
+	// numAutoPauses is the number of times the source has been paused due to
+	// backpressure. It's accessed atomically.
+	numAutoPauses int64
+
+	// numLimitedTuples is the number of tuples counted against MaxTuples.
+	// It's accessed atomically.
+	numLimitedTuples int64
+
+	// lateOutput is the pipe to the side output sink receiving late tuples.
+	// It's nil unless EventTime.Late is LateSideOutput.
+	lateOutput *pipeSender
+
+	// latestEventTime is the UnixNano of the latest event time of tuples
+	// emitted by the source, or noEventTime when no tuple has been emitted.
+	// It's accessed atomically.
+	latestEventTime int64
+
+	// numLateTuples is the number of tuples regarded as late. It's accessed
+	// atomically.
+	numLateTuples int64
+
+	// numInvalidEventTimes is the number of tuples dropped because their
+	// event time couldn't be obtained. It's accessed atomically.
+	numInvalidEventTimes int64
 }
 
+// noEventTime is the value of latestEventTime before the first tuple.
+const noEventTime = math.MinInt64
+
+// backpressureCheckInterval is the interval at which a source checks its
+// output queues when automatic pausing is enabled.
+const backpressureCheckInterval = 10 * time.Millisecond
+
 func (ds *defaultSourceNode) Type() NodeType {
 	return NTSource
 }
@@ -25,12 +65,16 @@ func (ds *defaultSourceNode) Source() Source {
 }
 
 func (ds *defaultSourceNode) run() (runErr error) {
+	if ds.lateOutput != nil {
+		// the side output sink stops reading from the pipe when it's closed
+		defer ds.lateOutput.close()
+	}
 	if err := ds.checkAndPrepareForRunning("source"); err != nil {
 		return err
 	}
 
 	defer func() {
-		defer ds.state.Set(TSStopped)
+		defer ds.setStopped()
 		if e := recover(); e != nil {
 			// ds.runErr is always nil here
 			ds.runErr = fmt.Errorf("the source failed to generate a stream due to panic: %v", e)
@@ -56,10 +100,354 @@ func (ds *defaultSourceNode) run() (runErr error) {
 		return
 	}
 
-	ds.runErr = ds.source.GenerateStream(ds.topology.ctx, newTraceWriter(ds.dsts, ETOutput, ds.name))
+	var w Writer = newTraceWriter(ds.dsts, ETOutput, ds.name)
+	if ds.config.CorrelationIDPath != nil {
+		w = &correlationIDWriter{
+			w:    w,
+			path: ds.config.CorrelationIDPath,
+		}
+	}
+	if ds.config.MaxTuples > 0 {
+		w = &maxTuplesWriter{
+			w:   w,
+			max: ds.config.MaxTuples,
+			num: &ds.numLimitedTuples,
+			stop: func() {
+				// Stop cannot be called synchronously because it waits for
+				// GenerateStream, which is calling Write, to return.
+				go ds.Stop()
+			},
+		}
+	}
+	if ds.config.EventTime != nil {
+		w = &eventTimeWriter{
+			w:          w,
+			policy:     ds.config.EventTime,
+			lateOutput: ds.lateOutput,
+			nodeName:   ds.name,
+			latest:     &ds.latestEventTime,
+			numLate:    &ds.numLateTuples,
+			numInvalid: &ds.numInvalidEventTimes,
+		}
+	}
+	if ds.config.Heartbeat > 0 {
+		hw := &heartbeatWriter{
+			w:         w,
+			lastWrite: time.Now().UnixNano(),
+		}
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ds.emitHeartbeats(hw, ds.config.Heartbeat, stop)
+		}()
+		defer func() {
+			// heartbeats must be stopped before dsts is closed
+			close(stop)
+			wg.Wait()
+		}()
+		w = hw
+	}
+	if ds.config.PauseThreshold > 0 {
+		bw := &backpressureWriter{
+			w:         w,
+			dsts:      ds.dsts,
+			threshold: ds.config.PauseThreshold,
+			notify:    make(chan chan struct{}),
+		}
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ds.monitorBackpressure(bw.notify, stop)
+		}()
+		defer func() {
+			close(stop)
+			wg.Wait()
+		}()
+		w = bw
+	}
+	ds.runErr = ds.source.GenerateStream(ds.topology.ctx, w)
 	return
 }
 
+// emitHeartbeats writes a heartbeat tuple to the writer every time the source
+// has been idle for the given interval. It returns when stop is closed.
+func (ds *defaultSourceNode) emitHeartbeats(hw *heartbeatWriter, interval time.Duration, stop <-chan struct{}) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		idle := now.Sub(time.Unix(0, atomic.LoadInt64(&hw.lastWrite)))
+		if idle < interval {
+			timer.Reset(interval - idle)
+			continue
+		}
+		if ds.state.Get() == TSRunning {
+			// the idle time is measured by the system time, but the
+			// timestamp of a heartbeat has to be consistent with tuples
+			ts := ds.topology.ctx.Now()
+			if err := hw.Write(ds.topology.ctx, NewHeartbeatTuple(ts)); err != nil {
+				ds.topology.ctx.NodeLogger(NTSource, ds.name).ErrLog(err).
+					Error("Cannot write a heartbeat tuple")
+			}
+		} else {
+			// a paused source doesn't emit heartbeats
+			hw.touch(now)
+		}
+		timer.Reset(interval)
+	}
+}
+
+// monitorBackpressure checks the output queues of the source periodically
+// and every time backpressureWriter sends a request to notify. A request has
+// a channel which is closed after the check. It returns when stop is closed.
+func (ds *defaultSourceNode) monitorBackpressure(notify <-chan chan struct{}, stop <-chan struct{}) {
+	ticker := time.NewTicker(backpressureCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case done := <-notify:
+			ds.checkBackpressure()
+			close(done)
+		case <-ticker.C:
+			ds.checkBackpressure()
+		}
+	}
+}
+
+// checkBackpressure pauses the source when any of its output queues is
+// filled up to the pause threshold and resumes the source when all queues
+// fall to the resume threshold or below. A source paused by Pause method
+// isn't resumed.
+func (ds *defaultSourceNode) checkBackpressure() {
+	ratio := ds.dsts.maxQueueRatio()
+	ds.stateMutex.Lock()
+	defer ds.stateMutex.Unlock()
+	switch ds.state.getWithoutLock() {
+	case TSRunning:
+		if ratio < ds.config.PauseThreshold {
+			return
+		}
+		if err := ds.pause(); err != nil {
+			ds.topology.ctx.NodeLogger(NTSource, ds.name).ErrLog(err).
+				Error("Cannot pause the source on backpressure")
+			return
+		}
+		ds.autoPaused = true
+		atomic.AddInt64(&ds.numAutoPauses, 1)
+		ds.topology.ctx.NodeLogger(NTSource, ds.name).Log().
+			Info("The source is paused on backpressure")
+
+	case TSPaused:
+		if !ds.autoPaused || ratio > ds.config.ResumeThreshold {
+			return
+		}
+		if err := ds.resume(); err != nil {
+			ds.topology.ctx.NodeLogger(NTSource, ds.name).ErrLog(err).
+				Error("Cannot resume the source paused on backpressure")
+			return
+		}
+		ds.topology.ctx.NodeLogger(NTSource, ds.name).Log().
+			Info("The source is resumed as backpressure is relieved")
+	}
+}
+
+// backpressureWriter is a Writer which asks monitorBackpressure to check
+// output queues as soon as any of them is filled up to the threshold so that
+// the source can be paused before the queue overflows. Because pausing a
+// source might require the goroutine writing tuples to proceed, the writer
+// only waits for the check for a limited time.
+type backpressureWriter struct {
+	w         Writer
+	dsts      *dataDestinations
+	threshold float64
+	notify    chan chan struct{}
+}
+
+func (bw *backpressureWriter) Write(ctx *Context, t *Tuple) error {
+	err := bw.w.Write(ctx, t)
+	if bw.dsts.maxQueueRatio() < bw.threshold {
+		return err
+	}
+
+	timer := time.NewTimer(backpressureCheckInterval)
+	defer timer.Stop()
+	done := make(chan struct{})
+	select {
+	case bw.notify <- done:
+	case <-timer.C:
+		return err
+	}
+	select {
+	case <-done:
+	case <-timer.C:
+	}
+	return err
+}
+
+// heartbeatWriter is a Writer which records the time when a tuple was written
+// last so that heartbeats are only emitted while the source is idle.
+type heartbeatWriter struct {
+	w Writer
+
+	// lastWrite is the UnixNano of the last write and accessed atomically.
+	lastWrite int64
+}
+
+func (hw *heartbeatWriter) Write(ctx *Context, t *Tuple) error {
+	hw.touch(time.Now())
+	return hw.w.Write(ctx, t)
+}
+
+func (hw *heartbeatWriter) touch(t time.Time) {
+	atomic.StoreInt64(&hw.lastWrite, t.UnixNano())
+}
+
+// maxTuplesWriter is a Writer which only passes the given number of tuples
+// and calls stop when the last one is written. Heartbeat tuples aren't
+// counted, but they're discarded after the last tuple as well.
+type maxTuplesWriter struct {
+	w    Writer
+	max  int64
+	num  *int64
+	stop func()
+}
+
+func (mw *maxTuplesWriter) Write(ctx *Context, t *Tuple) error {
+	if t.Flags.IsSet(TFHeartbeat) {
+		if atomic.LoadInt64(mw.num) >= mw.max {
+			return nil
+		}
+		return mw.w.Write(ctx, t)
+	}
+
+	n := atomic.AddInt64(mw.num, 1)
+	if n > mw.max {
+		atomic.StoreInt64(mw.num, mw.max)
+		return nil
+	}
+	err := mw.w.Write(ctx, t)
+	if n == mw.max {
+		mw.stop()
+	}
+	return err
+}
+
+// eventTimeWriter is a Writer which assigns the event time of a tuple to its
+// Timestamp and handles tuples older than the watermark as EventTimePolicy
+// specifies. The timestamp of a heartbeat tuple is replaced with the
+// watermark.
+type eventTimeWriter struct {
+	w          Writer
+	policy     *EventTimePolicy
+	lateOutput *pipeSender
+	nodeName   string
+	latest     *int64
+	numLate    *int64
+	numInvalid *int64
+}
+
+func (ew *eventTimeWriter) Write(ctx *Context, t *Tuple) error {
+	if t.Flags.IsSet(TFHeartbeat) {
+		wm, ok := ew.watermark()
+		if !ok {
+			return nil
+		}
+		if t.Flags.IsSet(TFShared) {
+			t = t.ShallowCopy()
+		}
+		t.Timestamp = wm
+		return ew.w.Write(ctx, t)
+	}
+
+	ts := t.Timestamp
+	if ew.policy.Timestamp != nil {
+		var err error
+		ts, err = ew.policy.Timestamp(t)
+		if err != nil {
+			atomic.AddInt64(ew.numInvalid, 1)
+			ctx.droppedTuple(t, NTSource, ew.nodeName, ETOutput,
+				fmt.Errorf("cannot obtain the event time: %v", err))
+			return nil
+		}
+	}
+
+	if wm, ok := ew.watermark(); ok && ts.Before(wm) {
+		atomic.AddInt64(ew.numLate, 1)
+		if ew.lateOutput == nil {
+			ctx.droppedTuple(t, NTSource, ew.nodeName, ETOutput,
+				fmt.Errorf("the event time %v is older than the watermark %v", ts, wm))
+			return nil
+		}
+		if err := ew.lateOutput.Write(ctx, t); err != nil {
+			ctx.NodeLogger(NTSource, ew.nodeName).ErrLog(err).
+				Error("Cannot write a late tuple to the side output sink")
+		}
+		return nil
+	}
+	ew.advance(ts.UnixNano())
+
+	if !ts.Equal(t.Timestamp) {
+		if t.Flags.IsSet(TFShared) {
+			t = t.ShallowCopy()
+		}
+		t.Timestamp = ts
+	}
+	return ew.w.Write(ctx, t)
+}
+
+// watermark returns the current watermark. It returns false when no tuple
+// has been written yet.
+func (ew *eventTimeWriter) watermark() (time.Time, bool) {
+	latest := atomic.LoadInt64(ew.latest)
+	if latest == noEventTime {
+		return time.Time{}, false
+	}
+	return time.Unix(0, latest).Add(-ew.policy.AllowedLateness), true
+}
+
+// advance updates the latest event time when ts is newer than it.
+func (ew *eventTimeWriter) advance(ts int64) {
+	for {
+		cur := atomic.LoadInt64(ew.latest)
+		if ts <= cur || atomic.CompareAndSwapInt64(ew.latest, cur, ts) {
+			return
+		}
+	}
+}
+
+// correlationIDWriter is a Writer which assigns a correlation ID to a tuple
+// from a field of the tuple.
+type correlationIDWriter struct {
+	w    Writer
+	path data.Path
+}
+
+func (cw *correlationIDWriter) Write(ctx *Context, t *Tuple) error {
+	if t.CorrelationID == "" && !t.Flags.IsSet(TFHeartbeat) {
+		if v, err := t.Data.Get(cw.path); err == nil && v.Type() != data.TypeNull {
+			if id, err := data.ToString(v); err == nil {
+				if t.Flags.IsSet(TFShared) {
+					t = t.ShallowCopy()
+				}
+				t.CorrelationID = id
+			}
+		}
+	}
+	return cw.w.Write(ctx, t)
+}
+
 func (ds *defaultSourceNode) Stop() error {
 	ds.stateMutex.Lock()
 	defer ds.stateMutex.Unlock()
@@ -73,6 +461,8 @@ func (ds *defaultSourceNode) Stop() error {
 	} else if stopped {
 		return nil
 	}
+	// The source is no longer paused on backpressure once it's stopping.
+	ds.autoPaused = false
 
 	if paused {
 		// The source doesn't have to be resumed since Stop must stop the source
@@ -106,6 +496,15 @@ func (ds *defaultSourceNode) Stop() error {
 	return nil
 }
 
+// setStopped sets TSStopped to the state. autoPaused is cleared, too, because
+// the source can stop by itself while it's paused on backpressure.
+func (ds *defaultSourceNode) setStopped() {
+	ds.stateMutex.Lock()
+	defer ds.stateMutex.Unlock()
+	ds.autoPaused = false
+	ds.state.setWithoutLock(TSStopped)
+}
+
 func (ds *defaultSourceNode) Pause() error {
 	ds.stateMutex.Lock()
 	defer ds.stateMutex.Unlock()
@@ -119,7 +518,12 @@ func (ds *defaultSourceNode) Pause() error {
 	default:
 		return fmt.Errorf("source '%v' is already stopped", ds.name)
 	}
-	return ds.pause()
+	if err := ds.pause(); err != nil {
+		return err
+	}
+	// The source explicitly paused won't automatically be resumed.
+	ds.autoPaused = false
+	return nil
 }
 
 func (ds *defaultSourceNode) pause() error {
@@ -163,17 +567,20 @@ func (ds *defaultSourceNode) Resume() error {
 	default:
 		return fmt.Errorf("source '%v' is already stopped", ds.name)
 	}
+	return ds.resume()
+}
 
+func (ds *defaultSourceNode) resume() error {
+	// resume doesn't acquire lock
 	if rn, ok := ds.source.(Resumable); ok {
 		// prefer the implementation of the source to the default one.
 		if err := rn.Resume(ds.topology.ctx); err != nil {
 			return err
 		}
-		ds.state.setWithoutLock(TSRunning)
-		return nil
+	} else {
+		ds.dsts.resume(ds.topology.ctx)
 	}
-
-	ds.dsts.resume()
+	ds.autoPaused = false
 	ds.state.setWithoutLock(TSRunning)
 	return nil
 }
@@ -197,6 +604,7 @@ func (ds *defaultSourceNode) Status() data.Map {
 	st := ds.state.getWithoutLock()
 	stopOnDisconnect := ds.stopOnDisconnectEnabled
 	removeOnStop := ds.config.RemoveOnStop
+	autoPaused := ds.autoPaused
 	ds.stateMutex.Unlock()
 
 	m := data.Map{
@@ -205,8 +613,38 @@ func (ds *defaultSourceNode) Status() data.Map {
 		"behaviors": data.Map{
 			"stop_on_disconnect": data.Bool(stopOnDisconnect),
 			"remove_on_stop":     data.Bool(removeOnStop),
+			"paused_write_mode":  data.String(ds.config.PausedWriteMode.String()),
 		},
 	}
+	if ds.config.PauseThreshold > 0 {
+		m["backpressure"] = data.Map{
+			"pause_threshold":  data.Float(ds.config.PauseThreshold),
+			"resume_threshold": data.Float(ds.config.ResumeThreshold),
+			"auto_paused":      data.Bool(autoPaused),
+			"num_auto_pauses":  data.Int(atomic.LoadInt64(&ds.numAutoPauses)),
+		}
+	}
+	if ds.config.MaxTuples > 0 {
+		m["max_tuples"] = data.Map{
+			"max":         data.Int(ds.config.MaxTuples),
+			"num_emitted": data.Int(atomic.LoadInt64(&ds.numLimitedTuples)),
+		}
+	}
+	if et := ds.config.EventTime; et != nil {
+		em := data.Map{
+			"allowed_lateness": data.Float(et.AllowedLateness.Seconds()),
+			"late_mode":        data.String(et.Late.String()),
+			"num_late":         data.Int(atomic.LoadInt64(&ds.numLateTuples)),
+			"num_invalid":      data.Int(atomic.LoadInt64(&ds.numInvalidEventTimes)),
+		}
+		if latest := atomic.LoadInt64(&ds.latestEventTime); latest != noEventTime {
+			em["watermark"] = data.Timestamp(time.Unix(0, latest).Add(-et.AllowedLateness))
+		}
+		if et.Late == LateSideOutput {
+			em["side_output"] = data.String(et.SideOutput)
+		}
+		m["event_time"] = em
+	}
 	if st == TSStopped && ds.runErr != nil {
 		m["error"] = data.String(ds.runErr.Error())
 	}
@@ -62,6 +62,28 @@ func (t *defaultTopology) AddSource(name string, s Source, config *SourceConfig)
 	if config == nil {
 		config = &SourceConfig{}
 	}
+	if config.PauseThreshold < 0 || config.PauseThreshold > 1 {
+		return nil, fmt.Errorf("the pause threshold must be in [0, 1]: %v", config.PauseThreshold)
+	}
+	if config.PauseThreshold > 0 &&
+		(config.ResumeThreshold < 0 || config.ResumeThreshold >= config.PauseThreshold) {
+		return nil, fmt.Errorf("the resume threshold must be in [0, %v): %v",
+			config.PauseThreshold, config.ResumeThreshold)
+	}
+
+	if config.PausedWriteMode == PausedBuffer && config.PausedBufferSize <= 0 {
+		return nil, fmt.Errorf("the paused buffer size must be positive: %v", config.PausedBufferSize)
+	}
+
+	if config.MaxTuples < 0 {
+		return nil, fmt.Errorf("the maximum number of tuples must not be negative: %v", config.MaxTuples)
+	}
+
+	if config.EventTime != nil {
+		if err := config.EventTime.Validate(); err != nil {
+			return nil, err
+		}
+	}
 
 	// This method assumes adding a Source having a duplicated name is rare.
 	// Under this assumption, acquiring wlock without checking the existence
@@ -86,21 +108,37 @@ func (t *defaultTopology) AddSource(name string, s Source, config *SourceConfig)
 		source:          s,
 		dsts:            newDataDestinations(NTSource, name),
 		pausedOnStartup: config.PausedOnStartup,
+		latestEventTime: noEventTime,
 	}
 	ds.config = &SourceConfig{}
 	*ds.config = *config
 	ds.dsts.callback = ds.dstCallback
+	ds.dsts.pausedMode = config.PausedWriteMode
+	ds.dsts.pausedBufferSize = config.PausedBufferSize
 	if err := t.checkNodeNameDuplication(name); err != nil {
 		// Because the source isn't started yet, it doesn't return an error.
 		ds.Stop()
 		return nil, err
 	}
+	if et := config.EventTime; et != nil && et.Late == LateSideOutput {
+		so, ok := t.sinks[strings.ToLower(et.SideOutput)]
+		if !ok {
+			ds.Stop()
+			return nil, fmt.Errorf("the side output sink '%v' was not found", et.SideOutput)
+		}
+		recv, send := newPipe("output", defaultSinkInputConfig.capacity())
+		if err := so.srcs.add(name, recv); err != nil {
+			ds.Stop()
+			return nil, err
+		}
+		ds.lateOutput = send
+	}
 	t.sources[strings.ToLower(name)] = ds
 
 	go func() {
 		// TODO: Support lazy invocation
 		if err := ds.run(); err != nil {
-			t.ctx.ErrLog(err).WithFields(nodeLogFields(NTSource, name)).
+			t.ctx.NodeLogger(NTSource, name).ErrLog(err).
 				Error("Cannot generate a stream from the source")
 		}
 		ds.stateMutex.Lock()
@@ -109,7 +147,7 @@ func (t *defaultTopology) AddSource(name string, s Source, config *SourceConfig)
 		if removeOnStop {
 			if err := t.Remove(name); err != nil {
 				if !IsNotExist(err) {
-					t.ctx.ErrLog(err).WithFields(nodeLogFields(NTSource, name)).
+					t.ctx.NodeLogger(NTSource, name).ErrLog(err).
 						Error("Cannot remove the source from topology")
 				}
 			}
@@ -149,6 +187,9 @@ func (t *defaultTopology) AddBox(name string, b Box, config *BoxConfig) (BoxNode
 	if config == nil {
 		config = &BoxConfig{}
 	}
+	if config.Parallelism < 0 {
+		return nil, fmt.Errorf("the parallelism of a box must not be negative: %v", config.Parallelism)
+	}
 
 	t.nodeMutex.Lock()
 	defer t.nodeMutex.Unlock()
@@ -191,7 +232,7 @@ func (t *defaultTopology) AddBox(name string, b Box, config *BoxConfig) (BoxNode
 
 	go func() {
 		if err := db.run(); err != nil {
-			t.ctx.ErrLog(err).WithFields(nodeLogFields(NTBox, db.name)).
+			t.ctx.NodeLogger(NTBox, db.name).ErrLog(err).
 				Error("The box failed")
 		}
 		db.stateMutex.Lock()
@@ -200,7 +241,7 @@ func (t *defaultTopology) AddBox(name string, b Box, config *BoxConfig) (BoxNode
 		if removeOnStop {
 			if err := t.Remove(name); err != nil {
 				if !IsNotExist(err) {
-					t.ctx.ErrLog(err).WithFields(nodeLogFields(NTBox, db.name)).
+					t.ctx.NodeLogger(NTBox, db.name).ErrLog(err).
 						Error("Cannot remove the box from topology")
 				}
 			}
@@ -220,12 +261,12 @@ func (t *defaultTopology) AddSink(name string, s Sink, config *SinkConfig) (Sink
 		}
 		defer func() {
 			if e := recover(); e != nil {
-				t.ctx.Log().WithFields(nodeLogFields(NTSink, name)).
+				t.ctx.NodeLogger(NTSink, name).Log().
 					Errorf("Cannot close the sink which hasn't been added to the topology: %v", e)
 			}
 		}()
 		if err := s.Close(t.ctx); err != nil {
-			t.ctx.ErrLog(err).WithFields(nodeLogFields(NTSink, name)).
+			t.ctx.NodeLogger(NTSink, name).ErrLog(err).
 				Error("Cannot close the sink which hasn't been added to the topology")
 		}
 	}()
@@ -238,6 +279,18 @@ func (t *defaultTopology) AddSink(name string, s Sink, config *SinkConfig) (Sink
 	if config == nil {
 		config = &SinkConfig{}
 	}
+	if config.Retry != nil {
+		if err := config.Retry.Validate(); err != nil {
+			closeSinkFlag = true
+			return nil, err
+		}
+	}
+	if config.Batch != nil {
+		if err := config.Batch.Validate(); err != nil {
+			closeSinkFlag = true
+			return nil, err
+		}
+	}
 
 	t.nodeMutex.Lock()
 	defer t.nodeMutex.Unlock()
@@ -251,10 +304,26 @@ func (t *defaultTopology) AddSink(name string, s Sink, config *SinkConfig) (Sink
 		return nil, err
 	}
 
+	var deadLetter *pipeSender
+	if config.DeadLetter != "" {
+		dl, ok := t.sinks[strings.ToLower(config.DeadLetter)]
+		if !ok {
+			closeSinkFlag = true
+			return nil, fmt.Errorf("the dead-letter sink '%v' was not found", config.DeadLetter)
+		}
+		recv, send := newPipe("output", defaultSinkInputConfig.capacity())
+		if err := dl.srcs.add(name, recv); err != nil {
+			closeSinkFlag = true
+			return nil, err
+		}
+		deadLetter = send
+	}
+
 	ds := &defaultSinkNode{
 		defaultNode: newDefaultNode(t, name, config.Meta),
 		srcs:        newDataSources(NTSink, name),
 		sink:        s,
+		deadLetter:  deadLetter,
 	}
 	ds.config = &SinkConfig{}
 	*ds.config = *config
@@ -262,7 +331,7 @@ func (t *defaultTopology) AddSink(name string, s Sink, config *SinkConfig) (Sink
 
 	go func() {
 		if err := ds.run(); err != nil {
-			t.ctx.ErrLog(err).WithFields(nodeLogFields(NTSink, ds.name)).
+			t.ctx.NodeLogger(NTSink, ds.name).ErrLog(err).
 				Error("The sink failed")
 		}
 		ds.stateMutex.Lock()
@@ -271,7 +340,7 @@ func (t *defaultTopology) AddSink(name string, s Sink, config *SinkConfig) (Sink
 		if removeOnStop {
 			if err := t.Remove(name); err != nil {
 				if !IsNotExist(err) {
-					t.ctx.ErrLog(err).WithFields(nodeLogFields(NTSink, ds.name)).
+					t.ctx.NodeLogger(NTSink, ds.name).ErrLog(err).
 						Error("Cannot remove the sink from topology")
 				}
 			}
@@ -297,7 +366,7 @@ func (t *defaultTopology) Stop() error {
 		if err := src.Stop(); err != nil { // Stop doesn't panic
 			lastErr = err
 			src.dsts.Close(t.ctx)
-			t.ctx.ErrLog(err).WithFields(nodeLogFields(NTSource, name)).
+			t.ctx.NodeLogger(NTSource, name).ErrLog(err).
 				Error("Cannot stop the source")
 		}
 	}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"errors"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"sync"
@@ -1528,3 +1529,801 @@ func waitForInputTuplesExhausted(si *TupleCollectorSink, lastTuple *Tuple) {
 		time.Sleep(time.Nanosecond)
 	}
 }
+
+func TestDefaultTopologyHeartbeat(t *testing.T) {
+	Convey("Given a simple linear topology with a heartbeat source", t, func() {
+		dt, err := NewDefaultTopology(NewContext(nil), "dt1")
+		So(err, ShouldBeNil)
+		t := dt.(*defaultTopology)
+		Reset(func() {
+			t.Stop()
+		})
+
+		ts := freshTuples()
+		so := NewTupleIncrementalEmitterSource(ts)
+		_, err = t.AddSource("source", so, &SourceConfig{
+			Heartbeat: 20 * time.Millisecond,
+		})
+		So(err, ShouldBeNil)
+
+		var (
+			m          sync.Mutex
+			heartbeats []*Tuple
+		)
+		bn, err := t.AddBox("box", BoxFunc(func(ctx *Context, t *Tuple, w Writer) error {
+			if t.Flags.IsSet(TFHeartbeat) {
+				m.Lock()
+				heartbeats = append(heartbeats, t)
+				m.Unlock()
+			}
+			return w.Write(ctx, t)
+		}), nil)
+		So(err, ShouldBeNil)
+		So(bn.Input("source", nil), ShouldBeNil)
+
+		si := NewTupleCollectorSink()
+		sin, err := t.AddSink("sink", si, nil)
+		So(err, ShouldBeNil)
+		So(sin.Input("box", nil), ShouldBeNil)
+
+		Convey("When the source emits some tuples and becomes idle", func() {
+			so.EmitTuples(2)
+			si.Wait(2)
+			time.Sleep(100 * time.Millisecond)
+
+			Convey("Then the box should receive heartbeats", func() {
+				m.Lock()
+				defer m.Unlock()
+				So(len(heartbeats), ShouldBeGreaterThan, 0)
+				for _, h := range heartbeats {
+					So(h.Data, ShouldBeEmpty)
+					So(h.Timestamp, ShouldHappenAfter, ts[1].Timestamp)
+				}
+			})
+
+			Convey("Then the sink shouldn't receive any heartbeat", func() {
+				So(si.len(), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the source is paused", func() {
+			so.EmitTuples(2)
+			si.Wait(2)
+			sn, err := t.Source("source")
+			So(err, ShouldBeNil)
+			So(sn.Pause(), ShouldBeNil)
+			time.Sleep(30 * time.Millisecond)
+			m.Lock()
+			n := len(heartbeats)
+			m.Unlock()
+			time.Sleep(100 * time.Millisecond)
+
+			Convey("Then no heartbeat should be emitted", func() {
+				m.Lock()
+				defer m.Unlock()
+				So(len(heartbeats), ShouldEqual, n)
+			})
+		})
+	})
+}
+
+func TestDefaultTopologyBackpressurePause(t *testing.T) {
+	const numTuples = 200
+
+	Convey("Given a topology having a fast source and a slow box dropping tuples", t, func() {
+		dt, err := NewDefaultTopology(NewContext(nil), "dt1")
+		So(err, ShouldBeNil)
+		t := dt.(*defaultTopology)
+		Reset(func() {
+			t.Stop()
+		})
+
+		ts := make([]*Tuple, numTuples)
+		for i := range ts {
+			ts[i] = &Tuple{
+				Data: data.Map{"seq": data.Int(i)},
+			}
+		}
+
+		var received int64
+		build := func(config *SourceConfig) SourceNode {
+			config.PausedOnStartup = true
+			sn, err := t.AddSource("source", NewTupleEmitterSource(ts), config)
+			So(err, ShouldBeNil)
+
+			bn, err := t.AddBox("box", BoxFunc(func(ctx *Context, t *Tuple, w Writer) error {
+				time.Sleep(time.Millisecond)
+				atomic.AddInt64(&received, 1)
+				return nil
+			}), nil)
+			So(err, ShouldBeNil)
+			So(bn.Input("source", &BoxInputConfig{
+				Capacity: 10,
+				DropMode: DropLatest,
+			}), ShouldBeNil)
+			return sn
+		}
+
+		// waitForBox waits until the box processes all tuples in its queue.
+		waitForBox := func() int64 {
+			prev := int64(-1)
+			for {
+				time.Sleep(50 * time.Millisecond)
+				n := atomic.LoadInt64(&received)
+				if n == prev {
+					return n
+				}
+				prev = n
+			}
+		}
+
+		Convey("When the source automatically pauses on backpressure", func() {
+			sn := build(&SourceConfig{
+				PauseThreshold:  0.5,
+				ResumeThreshold: 0.2,
+			})
+			So(sn.Resume(), ShouldBeNil)
+			sn.State().Wait(TSStopped)
+			n := waitForBox()
+
+			Convey("Then the box should receive almost all tuples", func() {
+				So(numTuples-n, ShouldBeLessThanOrEqualTo, numTuples/10)
+			})
+
+			Convey("Then the source should have been paused and resumed", func() {
+				st := sn.Status()
+				v, err := st.Get(data.MustCompilePath("backpressure.num_auto_pauses"))
+				So(err, ShouldBeNil)
+				So(v, ShouldBeGreaterThan, data.Int(0))
+				v, err = st.Get(data.MustCompilePath("backpressure.auto_paused"))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.False)
+			})
+		})
+
+		Convey("When the source doesn't pause on backpressure", func() {
+			sn := build(&SourceConfig{})
+			So(sn.Resume(), ShouldBeNil)
+			sn.State().Wait(TSStopped)
+			n := waitForBox()
+
+			Convey("Then many tuples should be dropped", func() {
+				So(numTuples-n, ShouldBeGreaterThan, numTuples/2)
+			})
+
+			Convey("Then the status shouldn't have backpressure information", func() {
+				_, err := sn.Status().Get(data.MustCompilePath("backpressure"))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the source is stopped while it's paused on backpressure", func() {
+			sn, err := t.AddSource("source", NewTupleEmitterSource(ts), &SourceConfig{
+				PausedOnStartup: true,
+				PauseThreshold:  0.5,
+				ResumeThreshold: 0.2,
+			})
+			So(err, ShouldBeNil)
+			block := make(chan struct{})
+			Reset(func() {
+				close(block)
+			})
+			bn, err := t.AddBox("box", BoxFunc(func(ctx *Context, t *Tuple, w Writer) error {
+				<-block
+				return nil
+			}), nil)
+			So(err, ShouldBeNil)
+			So(bn.Input("source", &BoxInputConfig{
+				Capacity: 10,
+				DropMode: DropLatest,
+			}), ShouldBeNil)
+			So(sn.Resume(), ShouldBeNil)
+
+			autoPaused := func() data.Value {
+				v, err := sn.Status().Get(data.MustCompilePath("backpressure.auto_paused"))
+				So(err, ShouldBeNil)
+				return v
+			}
+			for i := 0; autoPaused() != data.True; i++ {
+				So(i, ShouldBeLessThan, 1000)
+				time.Sleep(5 * time.Millisecond)
+			}
+			So(sn.Stop(), ShouldBeNil)
+
+			Convey("Then the source shouldn't be reported as paused on backpressure", func() {
+				So(sn.State().Get(), ShouldEqual, TSStopped)
+				So(autoPaused(), ShouldEqual, data.False)
+			})
+		})
+
+		Convey("When adding a source with invalid thresholds", func() {
+			_, err := t.AddSource("source", NewTupleEmitterSource(ts), &SourceConfig{
+				PauseThreshold:  0.5,
+				ResumeThreshold: 0.5,
+			})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestDefaultTopologyMaxTuples(t *testing.T) {
+	Convey("Given a simple linear topology", t, func() {
+		dt, err := NewDefaultTopology(NewContext(nil), "dt1")
+		So(err, ShouldBeNil)
+		t := dt.(*defaultTopology)
+		Reset(func() {
+			t.Stop()
+		})
+
+		ts := freshTuples()
+		si := NewTupleCollectorSink()
+		build := func(so Source, config *SourceConfig) SourceNode {
+			config.PausedOnStartup = true
+			sn, err := t.AddSource("source", so, config)
+			So(err, ShouldBeNil)
+			sin, err := t.AddSink("sink", si, nil)
+			So(err, ShouldBeNil)
+			So(sin.Input("source", nil), ShouldBeNil)
+			So(sn.Resume(), ShouldBeNil)
+			return sn
+		}
+
+		Convey("When the source emits more tuples than the maximum", func() {
+			so := NewTupleIncrementalEmitterSource(ts)
+			sn := build(so, &SourceConfig{
+				MaxTuples: 3,
+			})
+			so.EmitTuplesNB(len(ts))
+			sn.State().Wait(TSStopped)
+
+			Convey("Then the sink should receive exactly the maximum number of tuples", func() {
+				si.Wait(3)
+				So(si.len(), ShouldEqual, 3)
+				for i := 0; i < 3; i++ {
+					So(si.get(i).Data, ShouldResemble, ts[i].Data)
+				}
+			})
+
+			Convey("Then the source should be stopped without an error", func() {
+				st := sn.Status()
+				So(st["state"], ShouldEqual, data.String("stopped"))
+				So(st, ShouldNotContainKey, "error")
+				v, err := st.Get(data.MustCompilePath("max_tuples.num_emitted"))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(3))
+			})
+		})
+
+		Convey("When the source emits fewer tuples than the maximum", func() {
+			sn := build(NewTupleEmitterSource(ts), &SourceConfig{
+				MaxTuples: int64(len(ts) + 1),
+			})
+			sn.State().Wait(TSStopped)
+
+			Convey("Then the sink should receive all tuples", func() {
+				si.Wait(len(ts))
+				So(si.len(), ShouldEqual, len(ts))
+			})
+		})
+
+		Convey("When adding a source with a negative maximum", func() {
+			_, err := t.AddSource("source", NewTupleEmitterSource(ts), &SourceConfig{
+				MaxTuples: -1,
+			})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestDefaultTopologyEventTime(t *testing.T) {
+	Convey("Given a topology having a side output sink", t, func() {
+		dt, err := NewDefaultTopology(NewContext(nil), "dt1")
+		So(err, ShouldBeNil)
+		t := dt.(*defaultTopology)
+		Reset(func() {
+			t.Stop()
+		})
+
+		late := NewTupleCollectorSink()
+		_, err = t.AddSink("late", late, nil)
+		So(err, ShouldBeNil)
+
+		// event times in seconds: 10, 12, 7, 11, 5, 13
+		base := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+		var ts []*Tuple
+		for i, sec := range []int{10, 12, 7, 11, 5, 13} {
+			ts = append(ts, &Tuple{
+				Data: data.Map{
+					"seq": data.Int(i + 1),
+					"ts":  data.Timestamp(base.Add(time.Duration(sec) * time.Second)),
+				},
+				Timestamp: base.Add(time.Hour),
+			})
+		}
+		policy := &EventTimePolicy{
+			Timestamp: func(t *Tuple) (time.Time, error) {
+				v, err := t.Data.Get(data.MustCompilePath("ts"))
+				if err != nil {
+					return time.Time{}, err
+				}
+				return data.ToTimestamp(v)
+			},
+			AllowedLateness: 3 * time.Second,
+		}
+
+		si := NewTupleCollectorSink()
+		build := func(config *SourceConfig) SourceNode {
+			config.PausedOnStartup = true
+			sn, err := t.AddSource("source", NewTupleEmitterSource(ts), config)
+			So(err, ShouldBeNil)
+			sin, err := t.AddSink("sink", si, nil)
+			So(err, ShouldBeNil)
+			So(sin.Input("source", nil), ShouldBeNil)
+			So(sn.Resume(), ShouldBeNil)
+			sn.State().Wait(TSStopped)
+			return sn
+		}
+
+		Convey("When the source drops late tuples", func() {
+			sn := build(&SourceConfig{
+				EventTime: policy,
+			})
+
+			Convey("Then the sink should receive tuples within the allowed lateness", func() {
+				si.Wait(4)
+				So(si.len(), ShouldEqual, 4)
+				for i, seq := range []int{1, 2, 4, 6} {
+					So(si.get(i).Data["seq"], ShouldEqual, data.Int(seq))
+				}
+			})
+
+			Convey("Then the timestamps of the tuples should be their event times", func() {
+				si.Wait(4)
+				for i, sec := range []int{10, 12, 11, 13} {
+					So(si.get(i).Timestamp.Equal(base.Add(time.Duration(sec)*time.Second)), ShouldBeTrue)
+				}
+			})
+
+			Convey("Then the status should have the watermark and the number of late tuples", func() {
+				st := sn.Status()
+				v, err := st.Get(data.MustCompilePath("event_time.num_late"))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(2))
+				v, err = st.Get(data.MustCompilePath("event_time.watermark"))
+				So(err, ShouldBeNil)
+				wm, err := data.AsTimestamp(v)
+				So(err, ShouldBeNil)
+				So(wm.Equal(base.Add(10*time.Second)), ShouldBeTrue)
+				So(late.len(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the source writes late tuples to the side output sink", func() {
+			policy.Late = LateSideOutput
+			policy.SideOutput = "late"
+			build(&SourceConfig{
+				EventTime: policy,
+			})
+
+			Convey("Then the side output sink should receive the late tuples", func() {
+				late.Wait(2)
+				So(late.len(), ShouldEqual, 2)
+				So(late.get(0).Data["seq"], ShouldEqual, data.Int(3))
+				So(late.get(1).Data["seq"], ShouldEqual, data.Int(5))
+			})
+		})
+
+		Convey("When a tuple doesn't have its event time", func() {
+			delete(ts[1].Data, "ts")
+			sn := build(&SourceConfig{
+				EventTime: policy,
+			})
+
+			Convey("Then it should be dropped", func() {
+				si.Wait(4)
+				So(si.len(), ShouldEqual, 4)
+				v, err := sn.Status().Get(data.MustCompilePath("event_time.num_invalid"))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("When adding a source with a nonexistent side output sink", func() {
+			policy.Late = LateSideOutput
+			policy.SideOutput = "no_such_sink"
+			_, err := t.AddSource("source", NewTupleEmitterSource(ts), &SourceConfig{
+				EventTime: policy,
+			})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When adding a source with a negative allowed lateness", func() {
+			policy.AllowedLateness = -time.Second
+			_, err := t.AddSource("source", NewTupleEmitterSource(ts), &SourceConfig{
+				EventTime: policy,
+			})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a topology with an idle event-time source emitting heartbeats", t, func() {
+		dt, err := NewDefaultTopology(NewContext(nil), "dt1")
+		So(err, ShouldBeNil)
+		t := dt.(*defaultTopology)
+		Reset(func() {
+			t.Stop()
+		})
+
+		base := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+		// the source stops after emitting all tuples, so one of them is kept
+		ts := freshTuples()[:2]
+		ts[0].Timestamp = base
+		so := NewTupleIncrementalEmitterSource(ts)
+		_, err = t.AddSource("source", so, &SourceConfig{
+			Heartbeat: 20 * time.Millisecond,
+			EventTime: &EventTimePolicy{
+				AllowedLateness: time.Second,
+			},
+		})
+		So(err, ShouldBeNil)
+
+		var (
+			m          sync.Mutex
+			heartbeats []*Tuple
+		)
+		bn, err := t.AddBox("box", BoxFunc(func(ctx *Context, t *Tuple, w Writer) error {
+			if t.Flags.IsSet(TFHeartbeat) {
+				m.Lock()
+				heartbeats = append(heartbeats, t)
+				m.Unlock()
+			}
+			return w.Write(ctx, t)
+		}), nil)
+		So(err, ShouldBeNil)
+		So(bn.Input("source", nil), ShouldBeNil)
+
+		Convey("When the source hasn't emitted any tuple", func() {
+			time.Sleep(100 * time.Millisecond)
+
+			Convey("Then no heartbeat should be emitted", func() {
+				m.Lock()
+				defer m.Unlock()
+				So(heartbeats, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the source emits a tuple and becomes idle", func() {
+			so.EmitTuples(1)
+			time.Sleep(100 * time.Millisecond)
+
+			Convey("Then heartbeats should have the watermark as their timestamp", func() {
+				m.Lock()
+				defer m.Unlock()
+				So(len(heartbeats), ShouldBeGreaterThan, 0)
+				for _, h := range heartbeats {
+					So(h.Timestamp.Equal(base.Add(-time.Second)), ShouldBeTrue)
+				}
+			})
+		})
+	})
+}
+
+// flakySink fails to write each tuple with the given error the given number
+// of times before it succeeds. It always fails when numFailures is negative.
+type flakySink struct {
+	m           sync.Mutex
+	err         error
+	numFailures int
+	attempts    map[*Tuple]int
+	written     []*Tuple
+}
+
+func (s *flakySink) Write(ctx *Context, t *Tuple) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.attempts == nil {
+		s.attempts = map[*Tuple]int{}
+	}
+	s.attempts[t]++
+	if s.numFailures < 0 || s.attempts[t] <= s.numFailures {
+		return s.err
+	}
+	s.written = append(s.written, t)
+	return nil
+}
+
+func (s *flakySink) Close(ctx *Context) error {
+	return nil
+}
+
+func (s *flakySink) len() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return len(s.written)
+}
+
+func TestDefaultTopologySinkRetry(t *testing.T) {
+	Convey("Given a simple linear topology with a dead-letter sink", t, func() {
+		dt, err := NewDefaultTopology(NewContext(nil), "dt1")
+		So(err, ShouldBeNil)
+		t := dt.(*defaultTopology)
+		Reset(func() {
+			t.Stop()
+		})
+
+		ts := freshTuples()[:4]
+		dl := NewTupleCollectorSink()
+		_, err = t.AddSink("dead_letter", dl, nil)
+		So(err, ShouldBeNil)
+
+		build := func(si Sink, config *SinkConfig) SinkNode {
+			sn, err := t.AddSource("source", NewTupleEmitterSource(ts), &SourceConfig{
+				PausedOnStartup: true,
+			})
+			So(err, ShouldBeNil)
+			sin, err := t.AddSink("sink", si, config)
+			So(err, ShouldBeNil)
+			So(sin.Input("source", nil), ShouldBeNil)
+			// tuples queued in the sink are written when it's removed
+			sin.EnableGracefulStop()
+			So(sn.Resume(), ShouldBeNil)
+			sn.State().Wait(TSStopped)
+			return sin
+		}
+		policy := &SinkRetryPolicy{
+			MaxRetries:  3,
+			Interval:    time.Millisecond,
+			MaxInterval: 2 * time.Millisecond,
+		}
+
+		Convey("When the sink fails temporarily and then succeeds", func() {
+			si := &flakySink{
+				err:         TemporaryError(errors.New("temporary failure")),
+				numFailures: 2,
+			}
+			sin := build(si, &SinkConfig{
+				Retry:      policy,
+				DeadLetter: "dead_letter",
+			})
+			So(t.Remove("sink"), ShouldBeNil)
+
+			Convey("Then all tuples should be delivered via retries", func() {
+				So(si.len(), ShouldEqual, len(ts))
+				So(dl.len(), ShouldEqual, 0)
+
+				st := sin.Status()
+				v, err := st.Get(data.MustCompilePath("retry.num_retries"))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(2*len(ts)))
+				v, err = st.Get(data.MustCompilePath("dead_letter.num_dead_letters"))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(0))
+			})
+		})
+
+		Convey("When the sink always fails", func() {
+			si := &flakySink{
+				err:         TemporaryError(errors.New("temporary failure")),
+				numFailures: -1,
+			}
+			sin := build(si, &SinkConfig{
+				Retry:      policy,
+				DeadLetter: "dead_letter",
+			})
+			dl.Wait(len(ts))
+			So(t.Remove("sink"), ShouldBeNil)
+
+			Convey("Then all tuples should be written to the dead-letter sink after retries", func() {
+				So(si.len(), ShouldEqual, 0)
+				So(dl.len(), ShouldEqual, len(ts))
+				for i := range ts {
+					So(dl.get(i).Data, ShouldResemble, ts[i].Data)
+				}
+				for _, n := range si.attempts {
+					So(n, ShouldEqual, policy.MaxRetries+1)
+				}
+
+				st := sin.Status()
+				v, err := st.Get(data.MustCompilePath("retry.num_retries"))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(policy.MaxRetries*len(ts)))
+				v, err = st.Get(data.MustCompilePath("dead_letter.num_dead_letters"))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(len(ts)))
+			})
+		})
+
+		Convey("When the sink fails with a non-temporary error", func() {
+			si := &flakySink{
+				err:         errors.New("permanent failure"),
+				numFailures: -1,
+			}
+			build(si, &SinkConfig{
+				Retry:      policy,
+				DeadLetter: "dead_letter",
+			})
+			dl.Wait(len(ts))
+			So(t.Remove("sink"), ShouldBeNil)
+
+			Convey("Then tuples should be written to the dead-letter sink without retries", func() {
+				So(dl.len(), ShouldEqual, len(ts))
+				for _, n := range si.attempts {
+					So(n, ShouldEqual, 1)
+				}
+			})
+		})
+
+		Convey("When adding a sink with a nonexistent dead-letter sink", func() {
+			_, err := t.AddSink("sink", &flakySink{}, &SinkConfig{
+				DeadLetter: "no_such_sink",
+			})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When adding a sink with an invalid retry policy", func() {
+			_, err := t.AddSink("sink", &flakySink{}, &SinkConfig{
+				Retry: &SinkRetryPolicy{
+					MaxRetries: -1,
+				},
+			})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestSinkRetryPolicyInterval(t *testing.T) {
+	Convey("Given a retry policy", t, func() {
+		p := &SinkRetryPolicy{
+			MaxRetries:  10,
+			Interval:    time.Second,
+			MaxInterval: 5 * time.Second,
+		}
+
+		Convey("When computing intervals of retries", func() {
+			Convey("Then they should be doubled up to the maximum", func() {
+				So(p.interval(1), ShouldEqual, time.Second)
+				So(p.interval(2), ShouldEqual, 2*time.Second)
+				So(p.interval(3), ShouldEqual, 4*time.Second)
+				So(p.interval(4), ShouldEqual, 5*time.Second)
+				So(p.interval(10), ShouldEqual, 5*time.Second)
+			})
+		})
+	})
+}
+
+// batchCollectorSink is a BatchSink collecting tuples and sizes of batches
+// written to it.
+type batchCollectorSink struct {
+	*TupleCollectorSink
+	batchSizes []int
+}
+
+func (s *batchCollectorSink) WriteBatch(ctx *Context, ts []*Tuple) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.Tuples = append(s.Tuples, ts...)
+	s.batchSizes = append(s.batchSizes, len(ts))
+	s.c.Broadcast()
+	return nil
+}
+
+func (s *batchCollectorSink) sizes() []int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]int{}, s.batchSizes...)
+}
+
+func TestDefaultTopologySinkBatch(t *testing.T) {
+	Convey("Given a simple linear topology", t, func() {
+		dt, err := NewDefaultTopology(NewContext(nil), "dt1")
+		So(err, ShouldBeNil)
+		t := dt.(*defaultTopology)
+		Reset(func() {
+			t.Stop()
+		})
+
+		build := func(ts []*Tuple, si Sink, config *SinkConfig) SinkNode {
+			sn, err := t.AddSource("source", NewTupleEmitterSource(ts), &SourceConfig{
+				PausedOnStartup: true,
+			})
+			So(err, ShouldBeNil)
+			sin, err := t.AddSink("sink", si, config)
+			So(err, ShouldBeNil)
+			So(sin.Input("source", nil), ShouldBeNil)
+			sin.EnableGracefulStop()
+			So(sn.Resume(), ShouldBeNil)
+			sn.State().Wait(TSStopped)
+			return sin
+		}
+
+		Convey("When writing tuples to a batch sink without a timeout", func() {
+			ts := freshTuples()
+			si := &batchCollectorSink{TupleCollectorSink: NewTupleCollectorSink()}
+			sin := build(ts, si, &SinkConfig{
+				Batch: &SinkBatchPolicy{
+					Size: 3,
+				},
+			})
+			// full batches are written while the sink is running
+			si.Wait(6)
+			So(t.Remove("sink"), ShouldBeNil)
+
+			Convey("Then the last partial batch should be written when the sink stops", func() {
+				So(si.sizes(), ShouldResemble, []int{3, 3, 2})
+				v, err := sin.Status().Get(data.MustCompilePath("batch.num_batches"))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(3))
+				So(si.len(), ShouldEqual, len(ts))
+				for i := range ts {
+					So(si.get(i).Data, ShouldResemble, ts[i].Data)
+				}
+			})
+		})
+
+		Convey("When writing fewer tuples than the batch size with a timeout", func() {
+			ts := freshTuples()[:2]
+			si := &batchCollectorSink{TupleCollectorSink: NewTupleCollectorSink()}
+			build(ts, si, &SinkConfig{
+				Batch: &SinkBatchPolicy{
+					Size:    10,
+					Timeout: 10 * time.Millisecond,
+				},
+			})
+
+			Convey("Then the partial batch should be written by the timeout", func() {
+				// this blocks forever if the timeout doesn't flush the batch
+				si.Wait(len(ts))
+				So(si.sizes(), ShouldResemble, []int{2})
+			})
+		})
+
+		Convey("When writing tuples to a sink not supporting batches", func() {
+			ts := freshTuples()
+			si := &flakySink{}
+			sin := build(ts, si, &SinkConfig{
+				Batch: &SinkBatchPolicy{
+					Size:    3,
+					Timeout: time.Hour,
+				},
+			})
+			So(t.Remove("sink"), ShouldBeNil)
+
+			Convey("Then tuples should be written one by one", func() {
+				So(si.len(), ShouldEqual, len(ts))
+				for _, n := range si.attempts {
+					So(n, ShouldEqual, 1)
+				}
+				_, err := sin.Status().Get(data.MustCompilePath("batch"))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When adding a sink with an invalid batch policy", func() {
+			_, err := t.AddSink("sink", NewTupleCollectorSink(), &SinkConfig{
+				Batch: &SinkBatchPolicy{},
+			})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
 )
 
 type writeFailSink struct {
@@ -167,5 +168,38 @@ func TestDroppedTupleCollectorSource(t *testing.T) {
 				})
 			})
 		})
+
+		Convey("When a collector only collects tuples dropped by a Sink", func() {
+			dtso3 := NewNodeDroppedTupleCollectorSource("FAIL_SINK").(*droppedTupleCollectorSource)
+			_, err := t.AddSource("dropped_tuples3", dtso3, nil)
+			So(err, ShouldBeNil)
+			dtso3.state.Wait(TSRunning)
+			si3 := NewTupleCollectorSink()
+			sin3, err := t.AddSink("sink3", si3, nil)
+			So(err, ShouldBeNil)
+			So(sin3.Input("dropped_tuples3", nil), ShouldBeNil)
+
+			bn, err := t.AddBox("box", BoxFunc(func(ctx *Context, t *Tuple, w Writer) error {
+				if s, _ := t.Data["seq"].(data.Int); s%2 == 0 {
+					return errors.New("box write error")
+				}
+				return w.Write(ctx, t)
+			}), nil)
+			So(err, ShouldBeNil)
+			So(bn.Input("source", nil), ShouldBeNil)
+			sin2, err := t.AddSink("fail_sink", &writeFailSink{}, nil)
+			So(err, ShouldBeNil)
+			So(sin2.Input("box", nil), ShouldBeNil)
+			So(son.Resume(), ShouldBeNil)
+
+			Convey("Then it should only receive tuples dropped by the Sink", func() {
+				si.Wait(8)
+				si3.Wait(4)
+				So(si3.len(), ShouldEqual, 4)
+				si3.forEachTuple(func(t *Tuple) {
+					locationChecker(t, sin2)
+				})
+			})
+		})
 	})
 }
@@ -153,6 +153,7 @@ type Node interface {
 	//	* num_received: the number of tuples the node has received so far
 	//	* queue_size: the size of the queue connected to the node
 	//	* num_queued: the number of tuples buffered in the queue
+	//	* drop_mode: the drop mode of the queue ("none", "latest", or "oldest")
 	//
 	// "output_stats" contains statistical information of the node's output. It
 	// has following fields:
@@ -225,6 +226,16 @@ type BoxNode interface {
 	// tuples. There must be a Source or a Box having the name.
 	Input(refname string, config *BoxInputConfig) error
 
+	// SetInputCapacity changes the capacity of the input pipe from the node
+	// having refname at runtime. Tuples queued in the pipe before the change
+	// won't be dropped even if the new capacity is smaller than the number of
+	// them. When capacity is 0, the default value is used.
+	SetInputCapacity(refname string, capacity int) error
+
+	// SetInputDropMode changes the drop mode of the input pipe from the node
+	// having refname at runtime.
+	SetInputDropMode(refname string, mode QueueDropMode) error
+
 	// EnableGracefulStop activates a graceful stop mode. If it is enabled,
 	// Stop method waits until the Box doesn't have an incoming tuple. The Box
 	// doesn't wait until, for example, a source generates all tuples. It only
@@ -267,6 +278,10 @@ const (
 const (
 	// MaxCapacity is the maximum capacity or buffer size of pipes.
 	MaxCapacity int = 1<<17 - 1
+
+	// DefaultCapacity is the capacity or buffer size of pipes used when it
+	// isn't specified.
+	DefaultCapacity int = 1024
 )
 
 func validateCapacity(c int) error {
@@ -311,7 +326,7 @@ func (c *BoxInputConfig) inputName() string {
 
 func (c *BoxInputConfig) capacity() int {
 	if c.Capacity == 0 {
-		return 1024
+		return DefaultCapacity
 	}
 	return c.Capacity
 }
@@ -356,6 +371,11 @@ type SinkInputConfig struct {
 	// DropMode is a mode which controls the behavior of dropping tuples at the
 	// output side of the queue when it is full.
 	DropMode QueueDropMode
+
+	// DryRun is true when tuples from the input should only be counted and
+	// discarded without being written to the sink. It's used to measure the
+	// throughput of a topology before connecting it to a real sink.
+	DryRun bool
 }
 
 // Validate validates values of SinkInputConfig.
@@ -365,7 +385,7 @@ func (c *SinkInputConfig) Validate() error {
 
 func (c *SinkInputConfig) capacity() int {
 	if c.Capacity == 0 {
-		return 1024
+		return DefaultCapacity
 	}
 	return c.Capacity
 }
@@ -20,6 +20,7 @@ func newPipe(inputName string, capacity int) (*pipeReceiver, *pipeSender) {
 	s := &pipeSender{
 		inputName: inputName,
 		out:       p,
+		closing:   make(chan struct{}),
 	}
 	r.sender = s
 	return r, s
@@ -38,7 +39,10 @@ func (r *pipeReceiver) close() {
 	// goroutine because it might be dead-locked when the channel is full.
 	// In that case pipeSender.Write blocks at s.out <- t having RLock.
 	// Then, calling sender.close() is blocked until someone reads a tuple
-	// from r.in.
+	// from r.in. Because the receiver might never read the channel again,
+	// blocked writers are notified via startClosing so that they give up
+	// sending and the goroutine eventually terminates.
+	r.sender.startClosing()
 	go func() {
 		r.sender.close()
 	}()
@@ -66,6 +70,54 @@ const (
 	DropOldest
 )
 
+// String returns a string representation of a QueueDropMode.
+func (m QueueDropMode) String() string {
+	switch m {
+	case DropNone:
+		return "none"
+	case DropLatest:
+		return "latest"
+	case DropOldest:
+		return "oldest"
+	default:
+		return "unknown"
+	}
+}
+
+// PausedWriteMode is a mode which controls the behavior of a Source writing
+// tuples while it is paused. It's only used when the Source doesn't implement
+// Resumable because such a Source doesn't write tuples while paused.
+type PausedWriteMode int
+
+const (
+	// PausedBlock is one of PausedWriteMode that blocks writes until the
+	// Source is resumed. This is the default mode.
+	PausedBlock PausedWriteMode = iota
+
+	// PausedDrop is one of PausedWriteMode that drops tuples written while
+	// the Source is paused.
+	PausedDrop
+
+	// PausedBuffer is one of PausedWriteMode that buffers a limited number of
+	// tuples written while the Source is paused and drops the rest of them.
+	// Buffered tuples are written when the Source is resumed.
+	PausedBuffer
+)
+
+// String returns a string representation of a PausedWriteMode.
+func (m PausedWriteMode) String() string {
+	switch m {
+	case PausedBlock:
+		return "block"
+	case PausedDrop:
+		return "drop"
+	case PausedBuffer:
+		return "buffer"
+	default:
+		return "unknown"
+	}
+}
+
 // pipeSender represents a pipe sender. An object of this struct must be
 // placed in a global variable or in memory allocated from the heap.
 // Using an array or a slice of pipeSender may cause panic even if it is
@@ -88,6 +140,12 @@ type pipeSender struct {
 	// rwm protects out from write-close conflicts.
 	rwm sync.RWMutex
 
+	// closing is closed when the receiver starts closing the pipe. Writers
+	// blocked at sending a tuple to the full channel give up when it's
+	// closed so that they release rwm.
+	closing     chan struct{}
+	closingOnce sync.Once
+
 	registeredDsts []struct {
 		registeredName string
 		dst            *dataDestinations
@@ -118,7 +176,14 @@ func (s *pipeSender) write(ctx *Context, in *Tuple, droppedTuple func(*Tuple)) e
 	t.InputName = s.inputName
 
 	if s.dropMode == DropNone {
-		s.out <- t
+		select {
+		case s.out <- t:
+		case <-s.closing:
+			ctx.Log().WithField("input_name", s.inputName).
+				Warn("A tuple was dropped because the pipe was closed " +
+					"by its receiver while the tuple was being written")
+			return errPipeClosed
+		}
 	} else {
 	sendLoop:
 		for {
@@ -154,6 +219,15 @@ func (s *pipeSender) Close(ctx *Context) error {
 	return nil
 }
 
+// startClosing notifies writers blocked at the full channel that the pipe is
+// going to be closed. It doesn't acquire rwm and can be called while writers
+// are blocked.
+func (s *pipeSender) startClosing() {
+	s.closingOnce.Do(func() {
+		close(s.closing)
+	})
+}
+
 func (s *pipeSender) close() {
 	s.rwm.Lock()
 	defer s.rwm.Unlock()
@@ -176,6 +250,33 @@ func (s *pipeSender) close() {
 	s.registeredDsts = nil
 }
 
+// resize replaces the channel of the pipe with a new one having the given
+// capacity. Writers are blocked while the channel is being replaced. The old
+// channel is returned without being closed so that the caller can close it
+// after the receiver starts reading the new one. The receiver can still read
+// tuples queued in the old channel after it is closed, so no tuple is lost.
+func (s *pipeSender) resize(capacity int) (oldCh, newCh chan *Tuple, err error) {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if s.closed {
+		return nil, nil, errPipeClosed
+	}
+	oldCh = s.out
+	s.out = make(chan *Tuple, capacity)
+	return oldCh, s.out, nil
+}
+
+// setDropMode changes the drop mode of the pipe.
+func (s *pipeSender) setDropMode(mode QueueDropMode) error {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if s.closed {
+		return errPipeClosed
+	}
+	s.dropMode = mode
+	return nil
+}
+
 func (s *pipeSender) registered(name string, dst *dataDestinations) {
 	s.rwm.Lock()
 	defer s.rwm.Unlock()
@@ -198,6 +299,12 @@ func (s *pipeSender) queueStatus() (int, int) {
 	return len(s.out), cap(s.out)
 }
 
+func (s *pipeSender) queueDropMode() QueueDropMode {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	return s.dropMode
+}
+
 func (s *pipeSender) isClosed() bool {
 	s.rwm.RLock()
 	defer s.rwm.RUnlock()
@@ -281,6 +388,67 @@ func (s *dataSources) add(name string, r *pipeReceiver) error {
 	return nil
 }
 
+// receiverWithoutLock returns the receiver of the pipe from the node having the given
+// name. The caller must hold the lock of s.
+func (s *dataSources) receiverWithoutLock(name string) (*pipeReceiver, error) {
+	if s.state.getWithoutLock() >= TSStopping {
+		return nil, fmt.Errorf("node '%v' already closed its input", s.nodeName)
+	}
+	r, ok := s.recvs[name]
+	if !ok {
+		return nil, fmt.Errorf("node '%v' isn't receiving tuples from '%v'", s.nodeName, name)
+	}
+	return r, nil
+}
+
+// setCapacity changes the capacity of the pipe receiving tuples from the node
+// having the given name. Tuples queued in the old pipe will still be
+// processed.
+func (s *dataSources) setCapacity(name string, capacity int) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	r, err := s.receiverWithoutLock(name)
+	if err != nil {
+		return err
+	}
+	if len(s.msgChs) == 0 {
+		// Tuples queued in the old channel cannot be read until pour is called.
+		return fmt.Errorf("node '%v' isn't receiving tuples yet", s.nodeName)
+	}
+
+	oldCh, newCh, err := r.sender.resize(capacity)
+	if err != nil {
+		return fmt.Errorf("the input from '%v' to '%v' is already closed", name, s.nodeName)
+	}
+	r.in = newCh
+
+	// The new channel has to be added before closing the old one. Otherwise,
+	// pouringThread might temporarily have no input and stop when
+	// stopOnDisconnect is enabled.
+	s.sendMessageWithoutLock(&dataSourcesMessage{
+		cmd: ddscAddReceiver,
+		v:   r,
+	})
+	// pouringThread removes the old channel after reading all tuples in it.
+	close(oldCh)
+	return nil
+}
+
+// setDropMode changes the drop mode of the pipe receiving tuples from the
+// node having the given name.
+func (s *dataSources) setDropMode(name string, mode QueueDropMode) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	r, err := s.receiverWithoutLock(name)
+	if err != nil {
+		return err
+	}
+	if err := r.sender.setDropMode(mode); err != nil {
+		return fmt.Errorf("the input from '%v' to '%v' is already closed", name, s.nodeName)
+	}
+	return nil
+}
+
 func (s *dataSources) sendMessage(msg *dataSourcesMessage) {
 	s.m.Lock()
 	defer s.m.Unlock()
@@ -350,7 +518,7 @@ func (s *dataSources) pour(ctx *Context, w Writer, parallelism int) error {
 		}
 
 		genCases := func(msgCh <-chan *dataSourcesMessage) []reflect.SelectCase {
-			cs := make([]reflect.SelectCase, 0, len(s.recvs)+2)
+			cs := make([]reflect.SelectCase, 0, len(s.recvs)+3)
 			cs = append(cs, reflect.SelectCase{
 				Dir:  reflect.SelectRecv,
 				Chan: reflect.ValueOf(msgCh),
@@ -363,6 +531,13 @@ func (s *dataSources) pour(ctx *Context, w Writer, parallelism int) error {
 				Dir: reflect.SelectRecv,
 			})
 
+			// This case receives tuples from inputs exceeding the limit of
+			// reflect.Select. It has a nil channel until such an input is
+			// added.
+			cs = append(cs, reflect.SelectCase{
+				Dir: reflect.SelectRecv,
+			})
+
 			for _, r := range s.recvs {
 				cs = append(cs, reflect.SelectCase{
 					Dir:  reflect.SelectRecv,
@@ -417,7 +592,7 @@ func (s *dataSources) pour(ctx *Context, w Writer, parallelism int) error {
 				if err != nil {
 					logOnce.Do(func() {
 						threadErr = err // return only one error
-						ctx.ErrLog(err).WithFields(nodeLogFields(s.nodeType, s.nodeName)).
+						ctx.NodeLogger(s.nodeType, s.nodeName).ErrLog(err).
 							Error("the node stopped with a fatal error")
 					})
 				}
@@ -450,18 +625,9 @@ func (s *dataSources) pour(ctx *Context, w Writer, parallelism int) error {
 	}
 	s.recvs = nil
 
-	go func() {
-		// drainTargets might have duplicated channels but it doesn't cause
-		// a problem.
-		for len(drainTargets) != 0 {
-			i, _, ok := reflect.Select(drainTargets)
-			if ok {
-				continue
-			}
-			drainTargets[i] = drainTargets[len(drainTargets)-1]
-			drainTargets = drainTargets[:len(drainTargets)-1]
-		}
-	}()
+	// drainTargets might have duplicated channels but it doesn't cause a
+	// problem.
+	drainSelectCases(drainTargets)
 
 	for _, ch := range s.msgChs {
 		close(ch)
@@ -470,16 +636,87 @@ func (s *dataSources) pour(ctx *Context, w Writer, parallelism int) error {
 	return threadErr
 }
 
+// maxSelectCases is the maximum number of cases which reflect.Select can
+// handle at once. It's a variable so that tests can lower it.
+var maxSelectCases = 65536
+
+// overflowInputClosed is sent through the overflow channel of pouringThread
+// when an input forwarded to the channel is closed.
+type overflowInputClosed struct{}
+
+// drainSelectCases reads values from all channels in cs in background until
+// they're closed. cs is split into chunks so that reflect.Select doesn't
+// exceed the limit of cases.
+func drainSelectCases(cs []reflect.SelectCase) {
+	for len(cs) > maxSelectCases {
+		drainSelectCases(cs[:maxSelectCases])
+		cs = cs[maxSelectCases:]
+	}
+	go func() {
+		for len(cs) != 0 {
+			i, _, ok := reflect.Select(cs)
+			if ok {
+				continue
+			}
+			cs[i] = cs[len(cs)-1]
+			cs = cs[:len(cs)-1]
+		}
+	}()
+}
+
 func (s *dataSources) pouringThread(ctx *Context, w Writer, cs []reflect.SelectCase) (inputs []reflect.SelectCase, retErr error) {
 	const (
 		message = iota
 		defaultCase
+		overflowCase
 
 		// maxControlIndex has the max index of special channels used to
 		// control this method.
-		maxControlIndex = defaultCase
+		maxControlIndex = overflowCase
 	)
 
+	// Inputs which cannot be added to cs due to the limit of reflect.Select
+	// are read by forwarding goroutines, which write tuples to the overflow
+	// channel. Because a channel can have any number of writers, this method
+	// keeps working with a high fan-in at the cost of an extra goroutine for
+	// each of those inputs.
+	var (
+		overflow          chan interface{}
+		forwarders        sync.WaitGroup
+		numOverflowInputs int
+	)
+	addInput := func(c reflect.SelectCase) {
+		if len(cs) < maxSelectCases {
+			cs = append(cs, c)
+			return
+		}
+
+		if overflow == nil {
+			overflow = make(chan interface{})
+			cs[overflowCase].Chan = reflect.ValueOf(overflow)
+		}
+		numOverflowInputs++
+		forwarders.Add(1)
+		go func(in reflect.Value, out chan<- interface{}) {
+			defer forwarders.Done()
+			for {
+				v, ok := in.Recv()
+				if !ok {
+					break
+				}
+				out <- v.Interface()
+			}
+			out <- overflowInputClosed{}
+		}(c.Chan, overflow)
+	}
+	if len(cs) > maxSelectCases {
+		ins := cs[maxSelectCases:]
+		cs = cs[:maxSelectCases:maxSelectCases]
+		for _, c := range ins {
+			addInput(c)
+		}
+	}
+
 	defer func() {
 		if e := recover(); e != nil {
 			if err, ok := e.(error); ok {
@@ -499,29 +736,27 @@ func (s *dataSources) pouringThread(ctx *Context, w Writer, cs []reflect.SelectC
 		}
 
 		// drain channels specific to pouringThread
-		go func() {
-			cs = cs[:1] // exclude defaultCase
-			for len(cs) != 0 {
-				i, _, ok := reflect.Select(cs)
-				if ok {
-					continue
-				}
-				cs[i] = cs[len(cs)-1]
-				cs = cs[:len(cs)-1]
-			}
-		}()
+		ctrl := []reflect.SelectCase{cs[message]} // exclude defaultCase
+		if overflow != nil {
+			// Forwarders keep reading their inputs until they're closed by
+			// pour method, so the overflow channel can be closed after that.
+			ctrl = append(ctrl, cs[overflowCase])
+			go func(ch chan interface{}) {
+				forwarders.Wait()
+				close(ch)
+			}(overflow)
+		}
+		drainSelectCases(ctrl)
 	}()
 
 	gracefulStopEnabled := false
+	stopping := false
 	stopOnDisconnect := false
-
-	reportDT := func(t *Tuple, err error) {
-		ctx.droppedTuple(t, s.nodeType, s.nodeName, ETInput, err)
-	}
+	logger := ctx.NodeLogger(s.nodeType, s.nodeName)
 
 receiveLoop:
 	for {
-		if stopOnDisconnect && len(cs) == maxControlIndex+1 {
+		if stopOnDisconnect && len(cs) == maxControlIndex+1 && numOverflowInputs == 0 {
 			// When stopOnDisconnect is enabled, this loop breaks if the data
 			// source doesn't have any input channel. Otherwise, it keeps
 			// running because a new input could dynamically be added.
@@ -540,12 +775,22 @@ receiveLoop:
 			cs = cs[:len(cs)-1]
 			continue
 		}
+		if i == overflowCase {
+			if _, ok := v.Interface().(overflowInputClosed); ok {
+				numOverflowInputs--
+				if stopping && numOverflowInputs == 0 {
+					cs[defaultCase].Dir = reflect.SelectDefault
+				}
+				continue
+			}
+			// a tuple from an overflow input is processed as usual
+		}
 
 		switch i {
 		case message:
 			msg, ok := v.Interface().(*dataSourcesMessage)
 			if !ok {
-				ctx.Log().WithFields(nodeLogFields(s.nodeType, s.nodeName)).
+				logger.Log().
 					Warnf("Received an invalid control message in dataSources: %v", v.Interface())
 				continue
 			}
@@ -554,11 +799,11 @@ receiveLoop:
 			case ddscAddReceiver:
 				c, ok := msg.v.(*pipeReceiver)
 				if !ok {
-					ctx.Log().WithFields(nodeLogFields(s.nodeType, s.nodeName)).
+					logger.Log().
 						Warn("Cannot add a new receiver due to a type error")
 					break
 				}
-				cs = append(cs, reflect.SelectCase{
+				addInput(reflect.SelectCase{
 					Dir:  reflect.SelectRecv,
 					Chan: reflect.ValueOf(c.in),
 				})
@@ -567,7 +812,13 @@ receiveLoop:
 				if !gracefulStopEnabled {
 					break receiveLoop
 				}
-				cs[defaultCase].Dir = reflect.SelectDefault // activate the default case
+				stopping = true
+				// Tuples held by forwarders of overflow inputs have to be
+				// processed before stopping. The default case is activated
+				// once all of those inputs are closed.
+				if numOverflowInputs == 0 {
+					cs[defaultCase].Dir = reflect.SelectDefault // activate the default case
+				}
 
 			case ddscToggleGracefulStop:
 				gracefulStopEnabled = true
@@ -585,35 +836,176 @@ receiveLoop:
 			t, ok := v.Interface().(*Tuple)
 			if !ok {
 				atomic.AddInt64(&s.numErrors, 1)
-				ctx.Log().WithFields(nodeLogFields(s.nodeType, s.nodeName)).
+				logger.Log().
 					Error("Cannot receive a tuple from a receiver due to a type error")
 				break
 			}
 
-			err := w.Write(ctx, t)
-			if err == nil {
-				break
-			}
-
-			atomic.AddInt64(&s.numErrors, 1)
-			switch {
-			case IsFatalError(err):
+			if err := s.write(ctx, w, t); err != nil {
 				// logging is done by pour method
 				retErr = err
-				reportDT(t, err)
 				return
+			}
+		}
+	}
+	return // return values will be set by the deferred function.
+}
 
-			case IsTemporaryError(err):
-				// TODO: retry
-				reportDT(t, err) // TODO: don't write a tuple until retry fails
+// write writes a tuple to w and reports it as a dropped tuple when w fails.
+// It only returns an error when the error is fatal and the caller has to
+// stop.
+func (s *dataSources) write(ctx *Context, w Writer, t *Tuple) error {
+	err := w.Write(ctx, t)
+	if err == nil {
+		return nil
+	}
 
-			default:
-				// Skip this tuple
-				reportDT(t, err)
+	atomic.AddInt64(&s.numErrors, 1)
+	ctx.droppedTuple(t, s.nodeType, s.nodeName, ETInput, err)
+	switch {
+	case IsFatalError(err):
+		return err
+
+	case IsTemporaryError(err):
+		// TODO: retry
+		// TODO: don't drop a tuple until retry fails
+		return nil
+
+	default:
+		// Skip this tuple
+		return nil
+	}
+}
+
+// pourPartitioned pours out tuples for the target Writer like pour, but
+// tuples having the same value at the key path are always written by the
+// same goroutine in the order they were received. Therefore, the order of
+// tuples is preserved for each key while tuples having different keys are
+// written in parallel. Tuples not having the key are treated as if they had
+// NULL. When key is nil, it's same as pour.
+func (s *dataSources) pourPartitioned(ctx *Context, w Writer, parallelism int, key data.Path) error {
+	if key == nil || parallelism <= 1 {
+		return s.pour(ctx, w, parallelism)
+	}
+
+	pw := newPartitionedWriter(ctx, s, w, parallelism, key)
+	err := s.pour(ctx, pw, 1) // a single reader keeps the order of inputs
+	if e := pw.close(); err == nil && e != nil {
+		err = e
+		ctx.NodeLogger(s.nodeType, s.nodeName).ErrLog(err).
+			Error("the node stopped with a fatal error")
+	}
+	return err
+}
+
+// partitionedQueueSize is the capacity of the queue of each goroutine of
+// partitionedWriter.
+const partitionedQueueSize = 64
+
+// partitionedWriter dispatches tuples to goroutines writing them to the
+// actual Writer based on the hash value of the partition key.
+type partitionedWriter struct {
+	s   *dataSources
+	w   Writer
+	key data.Path
+	chs []chan *Tuple
+	wg  sync.WaitGroup
+
+	m        sync.RWMutex
+	fatalErr error
+}
+
+func newPartitionedWriter(ctx *Context, s *dataSources, w Writer, parallelism int, key data.Path) *partitionedWriter {
+	pw := &partitionedWriter{
+		s:   s,
+		w:   w,
+		key: key,
+		chs: make([]chan *Tuple, parallelism),
+	}
+	for i := range pw.chs {
+		ch := make(chan *Tuple, partitionedQueueSize)
+		pw.chs[i] = ch
+		pw.wg.Add(1)
+		go func() {
+			defer pw.wg.Done()
+			pw.writeAll(ctx, ch)
+		}()
+	}
+	return pw
+}
+
+func (pw *partitionedWriter) Write(ctx *Context, t *Tuple) error {
+	if err := pw.err(); err != nil {
+		return err
+	}
+
+	v, err := t.Data.Get(pw.key)
+	if err != nil {
+		v = data.Null{}
+	}
+	pw.chs[uint64(data.Hash(v))%uint64(len(pw.chs))] <- t
+	return nil
+}
+
+// writeAll writes tuples received from ch until it's closed. Once one of
+// the goroutines gets a fatal error, the data sources are stopped and the
+// rest of tuples are dropped.
+func (pw *partitionedWriter) writeAll(ctx *Context, ch <-chan *Tuple) {
+	for t := range ch {
+		if err := pw.err(); err != nil {
+			atomic.AddInt64(&pw.s.numErrors, 1)
+			ctx.droppedTuple(t, pw.s.nodeType, pw.s.nodeName, ETInput, err)
+			continue
+		}
+		if err := pw.writeTuple(ctx, t); err != nil {
+			pw.m.Lock()
+			first := pw.fatalErr == nil
+			if first {
+				pw.fatalErr = err
+			}
+			pw.m.Unlock()
+
+			if first {
+				// Write returns the error for the next tuple, but there
+				// might not be one. stop has to be called asynchronously
+				// because pouringThread might be blocked while sending a
+				// tuple to this goroutine.
+				go pw.s.stop(ctx)
 			}
 		}
 	}
-	return // return values will be set by the deferred function.
+}
+
+func (pw *partitionedWriter) writeTuple(ctx *Context, t *Tuple) (retErr error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err, ok := e.(error)
+			if !ok {
+				err = fmt.Errorf("'%v' got an unknown error through panic: %v", pw.s.nodeName, e)
+			}
+			if !IsFatalError(err) {
+				err = FatalError(err)
+			}
+			retErr = err
+		}
+	}()
+	return pw.s.write(ctx, pw.w, t)
+}
+
+func (pw *partitionedWriter) err() error {
+	pw.m.RLock()
+	defer pw.m.RUnlock()
+	return pw.fatalErr
+}
+
+// close waits until all tuples dispatched to goroutines are written and
+// returns the fatal error if any.
+func (pw *partitionedWriter) close() error {
+	for _, ch := range pw.chs {
+		close(ch)
+	}
+	pw.wg.Wait()
+	return pw.err()
 }
 
 // enableGracefulStop enables graceful stop mode. If the mode is enabled, the
@@ -678,6 +1070,7 @@ func (s *dataSources) status() data.Map {
 			"num_received": data.Int(recv.sender.count() - int64(l)),
 			"queue_size":   data.Int(c),
 			"num_queued":   data.Int(l),
+			"drop_mode":    data.String(recv.sender.queueDropMode().String()),
 		}
 	}
 	st["inputs"] = m
@@ -710,6 +1103,16 @@ type dataDestinations struct {
 	dsts     map[string]*pipeSender
 	paused   bool
 
+	// pausedMode controls tuples written while paused. pausedBufferSize is
+	// the maximum number of tuples buffered in PausedBuffer mode.
+	pausedMode       PausedWriteMode
+	pausedBufferSize int
+
+	// pausedMutex protects pausedBuffer because it's modified while rwm is
+	// only read-locked.
+	pausedMutex  sync.Mutex
+	pausedBuffer []*Tuple
+
 	callback func(ddEvent)
 }
 
@@ -795,6 +1198,11 @@ func (d *dataDestinations) Write(ctx *Context, t *Tuple) error {
 		}
 	}()
 
+	if d.paused && d.pausedMode != PausedBlock {
+		d.writePaused(ctx, t)
+		return nil
+	}
+
 	// RLock will be acquired again by the end of the loop.
 	for d.paused {
 		d.rwm.RUnlock()
@@ -813,6 +1221,20 @@ func (d *dataDestinations) Write(ctx *Context, t *Tuple) error {
 	}
 	// It's safe even if Close method is called while waiting in the loop above.
 
+	closed := d.send(ctx, t)
+	if closed != nil {
+		shouldUnlock = false
+		d.rwm.RUnlock()
+		d.rwm.Lock()
+		defer d.rwm.Unlock()
+		d.removeClosed(closed)
+	}
+	return nil
+}
+
+// send writes a tuple to all destinations and returns names of destinations
+// which have already been closed. The caller must lock rwm.
+func (d *dataDestinations) send(ctx *Context, t *Tuple) []string {
 	if len(d.dsts) == 0 {
 		atomic.AddInt64(&d.numDropped, 1)
 		if ctx.Flags.DestinationlessTupleLog.Enabled() {
@@ -846,24 +1268,40 @@ func (d *dataDestinations) Write(ctx *Context, t *Tuple) error {
 			closed = append(closed, name)
 		}
 	}
+	atomic.AddInt64(&d.numSent, 1)
+	return closed
+}
 
-	if closed != nil {
-		shouldUnlock = false
-		d.rwm.RUnlock()
-		d.rwm.Lock()
-		defer d.rwm.Unlock()
-		for _, n := range closed {
-			delete(d.dsts, n)
+// removeClosed removes closed destinations. The caller must lock rwm for
+// writing.
+func (d *dataDestinations) removeClosed(closed []string) {
+	for _, n := range closed {
+		delete(d.dsts, n)
+	}
+	if len(d.dsts) == 0 && d.callback != nil {
+		// This has to be called asynchronously because Write may be called
+		// from dataSources.pour and callback would be able to call
+		// dataSources.stop, which might end up with a dead-lock.
+		go d.callback(ddeDisconnect)
+	}
+}
+
+// writePaused handles a tuple written while paused according to pausedMode.
+// The caller must lock rwm.
+func (d *dataDestinations) writePaused(ctx *Context, t *Tuple) {
+	if d.pausedMode == PausedBuffer {
+		d.pausedMutex.Lock()
+		buffered := len(d.pausedBuffer) < d.pausedBufferSize
+		if buffered {
+			d.pausedBuffer = append(d.pausedBuffer, t)
 		}
-		if len(d.dsts) == 0 && d.callback != nil {
-			// This has to be called asynchronously because Write may be called
-			// from dataSources.pour and callback would be able to call
-			// dataSources.stop, which might end up with a dead-lock.
-			go d.callback(ddeDisconnect)
+		d.pausedMutex.Unlock()
+		if buffered {
+			return
 		}
 	}
-	atomic.AddInt64(&d.numSent, 1)
-	return nil
+	atomic.AddInt64(&d.numDropped, 1)
+	ctx.droppedTuple(t, d.nodeType, d.nodeName, ETOutput, errors.New("the output is paused"))
 }
 
 func (d *dataDestinations) pause() {
@@ -872,10 +1310,23 @@ func (d *dataDestinations) pause() {
 	d.setPaused(true)
 }
 
-func (d *dataDestinations) resume() {
+func (d *dataDestinations) resume(ctx *Context) {
 	d.rwm.Lock()
 	defer d.rwm.Unlock()
 	d.setPaused(false)
+
+	d.pausedMutex.Lock()
+	buf := d.pausedBuffer
+	d.pausedBuffer = nil
+	d.pausedMutex.Unlock()
+
+	// Buffered tuples are written while rwm is locked so that they're
+	// delivered before tuples written after resuming.
+	for _, t := range buf {
+		if closed := d.send(ctx, t); closed != nil {
+			d.removeClosed(closed)
+		}
+	}
 }
 
 func (d *dataDestinations) setPaused(p bool) {
@@ -894,9 +1345,32 @@ func (d *dataDestinations) Close(ctx *Context) error {
 	}
 	d.dsts = nil
 	d.setPaused(false)
+
+	d.pausedMutex.Lock()
+	atomic.AddInt64(&d.numDropped, int64(len(d.pausedBuffer)))
+	d.pausedBuffer = nil
+	d.pausedMutex.Unlock()
 	return nil
 }
 
+// maxQueueRatio returns the largest ratio of the number of queued tuples to
+// the capacity among all destinations.
+func (d *dataDestinations) maxQueueRatio() float64 {
+	d.rwm.RLock()
+	defer d.rwm.RUnlock()
+	r := 0.0
+	for _, dst := range d.dsts {
+		l, c := dst.queueStatus()
+		if c == 0 {
+			continue
+		}
+		if x := float64(l) / float64(c); x > r {
+			r = x
+		}
+	}
+	return r
+}
+
 func (d *dataDestinations) status() data.Map {
 	d.rwm.RLock()
 	defer d.rwm.RUnlock()
@@ -904,6 +1378,11 @@ func (d *dataDestinations) status() data.Map {
 	st := data.Map{}
 	st["num_sent_total"] = data.Int(atomic.LoadInt64(&d.numSent))
 	st["num_dropped"] = data.Int(atomic.LoadInt64(&d.numDropped))
+	if d.pausedMode == PausedBuffer {
+		d.pausedMutex.Lock()
+		st["num_paused_buffered"] = data.Int(len(d.pausedBuffer))
+		d.pausedMutex.Unlock()
+	}
 
 	m := make(data.Map, len(d.dsts))
 	for name, dst := range d.dsts {
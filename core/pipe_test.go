@@ -3,7 +3,10 @@ package core
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
@@ -94,6 +97,35 @@ func TestPipe(t *testing.T) {
 			})
 		})
 
+		Convey("When closing the full pipe via the receiver which never reads it", func() {
+			So(s.Write(ctx, t), ShouldBeNil)
+			writeErr := make(chan error, 1)
+			go func() {
+				// This blocks because the pipe is full.
+				writeErr <- s.Write(ctx, t)
+			}()
+			time.Sleep(10 * time.Millisecond) // wait until the writer blocks
+			r.close()
+
+			Convey("Then the blocked writer should give up writing", func() {
+				select {
+				case err := <-writeErr:
+					So(err, ShouldPointTo, errPipeClosed)
+				case <-time.After(5 * time.Second):
+					So("the writer is still blocked", ShouldBeEmpty)
+				}
+
+				Convey("And the pipe should eventually be closed", func() {
+					deadline := time.Now().Add(5 * time.Second)
+					for !s.isClosed() && time.Now().Before(deadline) {
+						time.Sleep(time.Millisecond)
+					}
+					So(s.isClosed(), ShouldBeTrue)
+					So(s.Write(ctx, t), ShouldPointTo, errPipeClosed)
+				})
+			})
+		})
+
 		Convey("When sending tuples with DropLatest mode", func() {
 			t2 := t.Copy()
 			t2.Data["v"] = data.Int(2)
@@ -330,6 +362,52 @@ func TestDataSources(t *testing.T) {
 			})
 		})
 
+		Convey("When changing the capacity of an input while sending tuples", func() {
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 100; i++ {
+					dsts[0].Write(ctx, t)
+				}
+			}()
+			So(srcs.setCapacity("test_node_1", 10), ShouldBeNil)
+			<-done
+			si.Wait(100)
+			srcs.stop(ctx)
+			So(<-stopped, ShouldBeNil)
+
+			Convey("Then the sink should receive all tuples", func() {
+				So(si.len(), ShouldEqual, 100)
+			})
+
+			Convey("Then the pipe should have the new capacity", func() {
+				So(cap(dsts[0].out), ShouldEqual, 10)
+			})
+		})
+
+		Convey("When changing the capacity and the drop mode of an input", func() {
+			So(srcs.setCapacity("test_node_1", 2), ShouldBeNil)
+			So(srcs.setDropMode("test_node_1", DropOldest), ShouldBeNil)
+
+			Convey("Then the pipe should have the new capacity and drop mode", func() {
+				So(cap(dsts[0].out), ShouldEqual, 2)
+				So(dsts[0].dropMode, ShouldEqual, DropOldest)
+			})
+
+			Convey("Then the pipe should still deliver tuples", func() {
+				So(dsts[0].Write(ctx, t), ShouldBeNil)
+				si.Wait(1)
+				So(si.len(), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When changing the configuration of a nonexistent input", func() {
+			Convey("Then it should fail", func() {
+				So(srcs.setCapacity("test_node_3", 10), ShouldNotBeNil)
+				So(srcs.setDropMode("test_node_3", DropOldest), ShouldNotBeNil)
+			})
+		})
+
 		Convey("When remove an input after sending a tuple", func() {
 			So(dsts[0].Write(ctx, t), ShouldBeNil)
 			srcs.enableGracefulStop()
@@ -399,6 +477,241 @@ func TestDataSourcesFailure(t *testing.T) {
 	})
 }
 
+func TestDataSourcesOverflow(t *testing.T) {
+	ctx := NewContext(nil)
+
+	Convey("Given a data source having more inputs than reflect.Select can handle", t, func() {
+		// 3 control channels and 5 inputs
+		maxSelectCases = 8
+		Reset(func() {
+			maxSelectCases = 65536
+		})
+
+		const numInputs = 20
+		srcs := newDataSources(NTBox, "test_component")
+		dsts := make([]*pipeSender, numInputs)
+		addInput := func(i int) {
+			r, s := newPipe(fmt.Sprint("test", i+1), 1)
+			So(srcs.add(fmt.Sprint("test_node_", i+1), r), ShouldBeNil)
+			dsts[i] = s
+		}
+		for i := 0; i < numInputs/2; i++ {
+			addInput(i)
+		}
+		Reset(func() {
+			for _, d := range dsts {
+				if d != nil {
+					d.close()
+				}
+			}
+		})
+		si := NewTupleCollectorSink()
+
+		t := &Tuple{
+			InputName: "some_component",
+			Data: data.Map{
+				"v": data.Int(1),
+			},
+		}
+
+		stopped := make(chan error, 1)
+		go func() {
+			stopped <- srcs.pour(ctx, si, 2)
+		}()
+		Reset(func() {
+			srcs.stop(ctx)
+		})
+		srcs.state.Wait(TSRunning)
+		for i := numInputs / 2; i < numInputs; i++ {
+			addInput(i)
+		}
+
+		Convey("When sending tuples from all inputs", func() {
+			for i := 0; i < 3; i++ {
+				for _, d := range dsts {
+					So(d.Write(ctx, t), ShouldBeNil)
+				}
+			}
+			srcs.enableGracefulStop()
+			srcs.stop(ctx)
+			So(<-stopped, ShouldBeNil)
+
+			Convey("Then the sink should receive all tuples", func() {
+				So(si.len(), ShouldEqual, 3*numInputs)
+			})
+		})
+
+		Convey("When removing some inputs", func() {
+			for i := 0; i < numInputs; i += 2 {
+				srcs.remove(fmt.Sprint("test_node_", i+1))
+			}
+
+			Convey("Then the other inputs should still work", func() {
+				for i := 1; i < numInputs; i += 2 {
+					So(dsts[i].Write(ctx, t), ShouldBeNil)
+				}
+				si.Wait(numInputs / 2)
+				srcs.stop(ctx)
+				So(<-stopped, ShouldBeNil)
+				So(si.len(), ShouldEqual, numInputs/2)
+			})
+		})
+
+		Convey("When closing all inputs with stopOnDisconnect", func() {
+			srcs.stopOnDisconnect()
+			for _, d := range dsts {
+				d.close()
+			}
+
+			Convey("Then it should stop pouring", func() {
+				So(<-stopped, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given more channels than reflect.Select can handle", t, func() {
+		maxSelectCases = 8
+		Reset(func() {
+			maxSelectCases = 65536
+		})
+		chs := make([]chan int, 20)
+		cs := make([]reflect.SelectCase, len(chs))
+		for i := range chs {
+			chs[i] = make(chan int)
+			cs[i] = reflect.SelectCase{
+				Dir:  reflect.SelectRecv,
+				Chan: reflect.ValueOf(chs[i]),
+			}
+		}
+
+		Convey("When draining them", func() {
+			drainSelectCases(cs)
+
+			Convey("Then a value sent to any of them should be read", func() {
+				// this test is dead-locked if a channel isn't drained
+				for _, ch := range chs {
+					ch <- 1
+					close(ch)
+				}
+			})
+		})
+	})
+}
+
+func TestDataSourcesPartitioned(t *testing.T) {
+	ctx := NewContext(nil)
+
+	Convey("Given a data source pouring tuples partitioned by a key in parallel", t, func() {
+		srcs := newDataSources(NTBox, "test_component")
+		r, s := newPipe("test", 16)
+		So(srcs.add("test_node", r), ShouldBeNil)
+		Reset(func() {
+			s.close()
+		})
+
+		var (
+			m          sync.Mutex
+			seqs       = map[int64][]int64{}
+			running    int
+			maxRunning int
+			failOnKey  int64 = -1
+		)
+		w := WriterFunc(func(ctx *Context, t *Tuple) error {
+			k, _ := data.AsInt(t.Data["k"])
+			v, _ := data.AsInt(t.Data["v"])
+			m.Lock()
+			if k == failOnKey {
+				m.Unlock()
+				return FatalError(errors.New("fatal"))
+			}
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			m.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			m.Lock()
+			defer m.Unlock()
+			running--
+			seqs[k] = append(seqs[k], v)
+			return nil
+		})
+
+		const (
+			numKeys   = 16
+			numTuples = 10
+		)
+		writeTuples := func() error {
+			for i := 0; i < numTuples; i++ {
+				for k := 0; k < numKeys; k++ {
+					if err := s.Write(ctx, &Tuple{
+						InputName: "test",
+						Data: data.Map{
+							"k": data.Int(k),
+							"v": data.Int(i),
+						},
+					}); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+
+		stopped := make(chan error, 1)
+		start := func() {
+			go func() {
+				stopped <- srcs.pourPartitioned(ctx, w, 4, data.MustCompilePath("k"))
+			}()
+			srcs.state.Wait(TSRunning)
+		}
+		Reset(func() {
+			srcs.stop(ctx)
+		})
+
+		Convey("When writing tuples having different keys", func() {
+			start()
+			So(writeTuples(), ShouldBeNil)
+			srcs.enableGracefulStop()
+			srcs.stop(ctx)
+			So(<-stopped, ShouldBeNil)
+
+			Convey("Then all tuples should be written in order for each key", func() {
+				So(len(seqs), ShouldEqual, numKeys)
+				for k := int64(0); k < numKeys; k++ {
+					So(len(seqs[k]), ShouldEqual, numTuples)
+					for i, v := range seqs[k] {
+						So(v, ShouldEqual, i)
+					}
+				}
+			})
+
+			Convey("Then tuples should be written by multiple goroutines", func() {
+				So(maxRunning, ShouldBeGreaterThan, 1)
+			})
+		})
+
+		Convey("When a tuple causes a fatal error", func() {
+			failOnKey = 3
+			start()
+			writeTuples() // fails once the pipe is closed by the error
+
+			Convey("Then pouring should stop with the error", func() {
+				err := <-stopped
+				So(err, ShouldNotBeNil)
+				So(IsFatalError(err), ShouldBeTrue)
+			})
+
+			Convey("Then the tuple should be counted as an error", func() {
+				<-stopped
+				So(srcs.numErrors, ShouldBeGreaterThan, 0)
+			})
+		})
+	})
+}
+
 func (s *pipeSender) waitUntilClosed() {
 	for {
 		s.rwm.RLock()
@@ -604,7 +917,7 @@ func TestDataDestinations(t *testing.T) {
 
 			Convey("Then the write should be blocked", func() {
 				Reset(func() {
-					dsts.resume()
+					dsts.resume(ctx)
 					<-ch
 				})
 
@@ -618,10 +931,59 @@ func TestDataDestinations(t *testing.T) {
 			})
 
 			Convey("Then resume method unblocks the write", func() {
-				dsts.resume()
+				dsts.resume(ctx)
 				So(<-ch, ShouldBeNil)
 			})
 		})
+
+		Convey("When pausing with PausedDrop mode", func() {
+			dsts.pausedMode = PausedDrop
+			dsts.pause()
+			So(dsts.Write(ctx, t), ShouldBeNil)
+
+			Convey("Then the tuple should be dropped without blocking", func() {
+				So(dsts.status()["num_dropped"], ShouldEqual, data.Int(1))
+				So(dsts.status()["num_sent_total"], ShouldEqual, data.Int(0))
+			})
+
+			Convey("Then the tuple shouldn't be written after resuming", func() {
+				dsts.resume(ctx)
+				for _, r := range recvs {
+					So(len(r.in), ShouldEqual, 0)
+				}
+			})
+		})
+
+		Convey("When pausing with PausedBuffer mode", func() {
+			dsts.pausedMode = PausedBuffer
+			dsts.pausedBufferSize = 1
+			dsts.pause()
+			t2 := t.Copy()
+			t2.Data["v"] = data.Int(2)
+			So(dsts.Write(ctx, t), ShouldBeNil)
+			So(dsts.Write(ctx, t2), ShouldBeNil)
+
+			Convey("Then tuples beyond the buffer size should be dropped", func() {
+				So(dsts.status()["num_dropped"], ShouldEqual, data.Int(1))
+				So(dsts.status()["num_paused_buffered"], ShouldEqual, data.Int(1))
+			})
+
+			Convey("Then the buffered tuple should be written after resuming", func() {
+				dsts.resume(ctx)
+				for _, r := range recvs {
+					bt, ok := <-r.in
+					So(ok, ShouldBeTrue)
+					So(bt.Data["v"], ShouldEqual, data.Int(1))
+				}
+				So(dsts.status()["num_sent_total"], ShouldEqual, data.Int(1))
+				So(dsts.status()["num_paused_buffered"], ShouldEqual, data.Int(0))
+			})
+
+			Convey("Then the buffered tuple should be dropped when closing", func() {
+				So(dsts.Close(ctx), ShouldBeNil)
+				So(dsts.status()["num_dropped"], ShouldEqual, data.Int(2))
+			})
+		})
 	})
 }
 
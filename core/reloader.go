@@ -0,0 +1,13 @@
+package core
+
+// Reloader represents an entity that can reload its external configuration
+// such as files or credentials without being recreated (in particular
+// Source instances). Unlike Updater, it doesn't receive new parameters but
+// re-reads them from where they were originally loaded.
+type Reloader interface {
+	// Reload re-reads the external configuration of this entity and applies
+	// it. Reload may be called concurrently while the entity is running.
+	// When it fails, the entity should keep using the previous
+	// configuration.
+	Reload(ctx *Context) error
+}
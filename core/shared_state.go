@@ -68,6 +68,19 @@ type LoadableSharedState interface {
 	Load(ctx *Context, r io.Reader, params data.Map) error
 }
 
+// LookupableSharedState is a SharedState which provides values associated
+// with keys. Such a state can be queried from BQL by builtin functions like
+// lookup without implementing a UDF for each type of states.
+type LookupableSharedState interface {
+	SharedState
+
+	// Lookup returns the value associated with the key. It returns
+	// NotExistError when the state doesn't have the key.
+	//
+	// Lookup and other methods including Write can be called concurrently.
+	Lookup(ctx *Context, key data.Value) (data.Value, error)
+}
+
 // TODO: Add MixiableSharedState interface
 
 // SharedStateRegistry manages SharedState with names assigned to each state.
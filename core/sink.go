@@ -9,3 +9,19 @@ package core
 type Sink interface {
 	WriteCloser
 }
+
+// BatchSink is a Sink which can write multiple tuples at once. When a sink
+// node has SinkConfig.Batch, tuples are accumulated and written to a
+// BatchSink by WriteBatch. A Sink not implementing BatchSink always receives
+// tuples one by one through Write.
+//
+// WriteBatch may return fatal or temporary errors as Write does. An error
+// applies to the whole batch, e.g. all tuples in the batch are retried or
+// written to the dead-letter sink.
+type BatchSink interface {
+	Sink
+
+	// WriteBatch writes tuples at once. The slice must not be retained
+	// after WriteBatch returns although tuples in it can be.
+	WriteBatch(ctx *Context, ts []*Tuple) error
+}
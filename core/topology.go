@@ -1,5 +1,12 @@
 package core
 
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"time"
+)
+
 // Topology is a topology which can add Sources, Boxes, and Sinks
 // dynamically. Boxes and Sinks can also add inputs dynamically from running
 // Sources or Boxes.
@@ -97,15 +104,152 @@ type SourceConfig struct {
 	// If it is true, the source is removed.
 	RemoveOnStop bool
 
+	// Heartbeat is the interval of heartbeat tuples. When it is positive and
+	// the source doesn't emit any tuple for the interval, a tuple having
+	// TFHeartbeat flag is emitted so that downstream boxes can notice the
+	// progress of time. No heartbeat is emitted while the source is paused.
+	Heartbeat time.Duration
+
+	// PauseThreshold enables automatic pausing of the source based on
+	// backpressure from downstream nodes. When it is positive and the ratio
+	// of the number of queued tuples to the capacity of any output queue of
+	// the source reaches the threshold, the source is paused. The source is
+	// automatically resumed when the ratios of all output queues fall to
+	// ResumeThreshold or below. A source paused by Pause method isn't
+	// automatically resumed. The threshold must be at most 1.
+	PauseThreshold float64
+
+	// ResumeThreshold is the ratio of queued tuples to the capacity of output
+	// queues below which an automatically paused source is resumed. It's only
+	// used when PauseThreshold is positive and must be less than
+	// PauseThreshold.
+	ResumeThreshold float64
+
+	// PausedWriteMode controls tuples emitted while the source is paused.
+	// By default, the source is blocked until it's resumed. When it is
+	// PausedDrop or PausedBuffer, the source isn't blocked so that it can
+	// keep reading from its underlying input. It isn't used when the source
+	// implements Resumable.
+	PausedWriteMode PausedWriteMode
+
+	// PausedBufferSize is the maximum number of tuples buffered while the
+	// source is paused. It must be positive when PausedWriteMode is
+	// PausedBuffer.
+	PausedBufferSize int
+
+	// MaxTuples is the maximum number of tuples emitted by the source. When
+	// it is positive, the source is stopped after emitting the given number
+	// of tuples so that a pipeline processes a finite stream. Tuples written
+	// by the source after that are discarded. Heartbeat tuples aren't
+	// counted.
+	MaxTuples int64
+
+	// CorrelationIDPath is the path to a field in Data of each tuple emitted
+	// by the source. When it isn't nil, the value of the field converted to a
+	// string is assigned to Tuple.CorrelationID unless the tuple already has
+	// one. Tuples not having the field are emitted without a correlation ID.
+	CorrelationIDPath data.Path
+
+	// EventTime enables event-time processing of tuples emitted by the
+	// source. When it isn't nil, Tuple.Timestamp of each tuple is replaced
+	// with its event time and tuples arriving too late are handled as the
+	// policy specifies. See EventTimePolicy for details.
+	EventTime *EventTimePolicy
+
 	// Meta contains meta information of the source. This field won't be used
 	// by core package and application can store any form of information
 	// related to the source.
 	Meta interface{}
 }
 
+// LateTupleMode controls a tuple whose event time is older than the watermark
+// of the source emitting it.
+type LateTupleMode int
+
+const (
+	// LateDrop is one of LateTupleMode that drops late tuples. This is the
+	// default mode.
+	LateDrop LateTupleMode = iota
+
+	// LateSideOutput is one of LateTupleMode that writes late tuples to the
+	// sink given by EventTimePolicy.SideOutput instead of the destinations
+	// of the source.
+	LateSideOutput
+)
+
+// String returns a string representation of a LateTupleMode.
+func (m LateTupleMode) String() string {
+	switch m {
+	case LateDrop:
+		return "drop"
+	case LateSideOutput:
+		return "side_output"
+	default:
+		return "unknown"
+	}
+}
+
+// EventTimePolicy has parameters of event-time processing of a Source. The
+// source assigns the event time of each tuple to Tuple.Timestamp so that
+// time-based windows are computed on event time instead of arrival time.
+//
+// The source tracks a watermark, which is the latest event time seen so far
+// minus AllowedLateness. A tuple whose event time is older than the
+// watermark is regarded as late and handled according to Late. Heartbeat
+// tuples emitted by the source have the watermark as their timestamp, so
+// that downstream boxes don't regard the time as advanced beyond the
+// watermark while the source is idle. No heartbeat is emitted until the
+// first tuple is written.
+type EventTimePolicy struct {
+	// Timestamp returns the event time of a tuple. The timestamp assigned by
+	// the source is used as the event time when it's nil. A tuple whose
+	// event time cannot be obtained is dropped.
+	Timestamp func(t *Tuple) (time.Time, error)
+
+	// AllowedLateness is how far the event time of a tuple can go behind
+	// the latest event time before the tuple is regarded as late. It must
+	// not be negative.
+	AllowedLateness time.Duration
+
+	// Late controls late tuples.
+	Late LateTupleMode
+
+	// SideOutput is the name of a sink receiving late tuples when Late is
+	// LateSideOutput. The sink must exist when the source is added.
+	SideOutput string
+}
+
+// Validate checks if the policy has valid parameters.
+func (p *EventTimePolicy) Validate() error {
+	if p.AllowedLateness < 0 {
+		return fmt.Errorf("the allowed lateness must not be negative: %v", p.AllowedLateness)
+	}
+	switch p.Late {
+	case LateDrop:
+	case LateSideOutput:
+		if p.SideOutput == "" {
+			return fmt.Errorf("the side output sink must be given")
+		}
+	default:
+		return fmt.Errorf("invalid late tuple mode: %v", p.Late)
+	}
+	return nil
+}
+
 // BoxConfig has configuration parameters of a Box node.
 type BoxConfig struct {
-	// TODO: parallelism
+	// Parallelism is the number of goroutines writing tuples to the box
+	// concurrently. It's 1 when it's 0. Note that the order of tuples isn't
+	// preserved when it's greater than 1 unless PartitionKey is specified.
+	Parallelism int
+
+	// PartitionKey is the path to a field in Data of each tuple written to
+	// the box. When it isn't nil and Parallelism is greater than 1, tuples
+	// having the same value at the path are always processed by the same
+	// goroutine in the order they arrived, so that the order is preserved
+	// for each key while tuples having different keys are processed in
+	// parallel. Tuples not having the field are treated as if they had NULL.
+	PartitionKey data.Path
 
 	// RemoveOnStop is a flag which indicates the stop state of the topology.
 	// If it is true, the box is removed.
@@ -117,12 +261,106 @@ type BoxConfig struct {
 	Meta interface{}
 }
 
+// SinkRetryPolicy has parameters of retries of writes to a Sink failed with
+// a temporary error (see IsTemporaryError). The interval between retries is
+// doubled after every retry, i.e. the exponential backoff is used.
+type SinkRetryPolicy struct {
+	// MaxRetries is the maximum number of retries for a tuple. A tuple
+	// still failing after the retries is given up.
+	MaxRetries int
+
+	// Interval is the interval before the first retry.
+	Interval time.Duration
+
+	// MaxInterval is the upper limit of the interval. The interval isn't
+	// limited when it's 0.
+	MaxInterval time.Duration
+}
+
+// Validate checks if the policy has valid parameters.
+func (p *SinkRetryPolicy) Validate() error {
+	if p.MaxRetries < 0 {
+		return fmt.Errorf("the maximum number of retries must not be negative: %v", p.MaxRetries)
+	}
+	if p.Interval < 0 {
+		return fmt.Errorf("the retry interval must not be negative: %v", p.Interval)
+	}
+	if p.MaxInterval < 0 {
+		return fmt.Errorf("the maximum retry interval must not be negative: %v", p.MaxInterval)
+	}
+	return nil
+}
+
+// interval returns the interval before the n-th retry, which is 1-origin.
+func (p *SinkRetryPolicy) interval(n int) time.Duration {
+	d := p.Interval
+	for i := 1; i < n; i++ {
+		if (p.MaxInterval > 0 && d >= p.MaxInterval) || d > math.MaxInt64/2 {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxInterval > 0 && d > p.MaxInterval {
+		d = p.MaxInterval
+	}
+	return d
+}
+
+// SinkBatchPolicy has parameters of micro-batches written to a BatchSink.
+// A batch is written when it has Size tuples or when Timeout has passed
+// since the first tuple of the batch arrived, whichever comes first.
+type SinkBatchPolicy struct {
+	// Size is the maximum number of tuples in a batch.
+	Size int
+
+	// Timeout is the maximum time a tuple waits in a batch. A batch is only
+	// written when it's full if Timeout is 0.
+	Timeout time.Duration
+}
+
+// Validate checks if the policy has valid parameters.
+func (p *SinkBatchPolicy) Validate() error {
+	if p.Size <= 0 {
+		return fmt.Errorf("the batch size must be positive: %v", p.Size)
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("the batch timeout must not be negative: %v", p.Timeout)
+	}
+	return nil
+}
+
 // SinkConfig has configuration parameters of a Sink node.
 type SinkConfig struct {
 	// RemoveOnStop is a flag which indicates the stop state of the topology.
 	// If it is true, the sink is removed.
 	RemoveOnStop bool
 
+	// IDGenerator generates Tuple.ID of each tuple written to the sink. When
+	// it's nil, tuples are written to the sink as they are. Tuples whose ID
+	// cannot be generated aren't written to the sink.
+	IDGenerator TupleIDGenerator
+
+	// Validator validates each tuple written to the sink. When it's nil,
+	// tuples aren't validated. A tuple failing validation isn't written to
+	// the sink and is reported as a dropped tuple, so that a change in the
+	// schema of an upstream node is detected.
+	Validator TupleValidator
+
+	// Retry controls how a write failed with a temporary error is retried.
+	// A failed write isn't retried when it's nil.
+	Retry *SinkRetryPolicy
+
+	// DeadLetter is the name of another sink in the topology. A tuple which
+	// couldn't be written to the sink, including one given up after
+	// retries, is written to the dead-letter sink instead of being dropped.
+	// The dead-letter sink must exist when the sink is added.
+	DeadLetter string
+
+	// Batch controls how tuples are grouped into micro-batches. It's only
+	// used when the sink implements BatchSink, and tuples are written one by
+	// one when it's nil.
+	Batch *SinkBatchPolicy
+
 	// Meta contains meta information of the sink. This field won't be used
 	// by core package and application can store any form of information
 	// related to the sink.
@@ -33,6 +33,28 @@ type Tuple struct {
 	// BatchID is reserved for future use.
 	BatchID int64
 
+	// CorrelationID is an optional ID used to follow a tuple and tuples
+	// derived from it through a topology, e.g. for end-to-end tracing.
+	// Sources can assign it (see SourceConfig.CorrelationIDPath). Like Flags,
+	// a Box emitting a tuple derived from a received one should copy this
+	// field. Copy and ShallowCopy preserve it.
+	CorrelationID string
+
+	// ID is an optional ID identifying the content of a tuple. Sink nodes
+	// assign it right before writing a tuple to a Sink (see
+	// SinkConfig.IDGenerator) so that the Sink can deduplicate tuples written
+	// more than once, e.g. after a source is rewound. Copy and ShallowCopy
+	// preserve it.
+	ID string
+
+	// Columns is an optional list of the top-level keys of Data in the order
+	// declared by the producer of the tuple, e.g. the projection list of a
+	// SELECT statement. Because Data is an unordered map, sinks writing
+	// columns in a fixed order, such as CSV writers, can use it. It's nil
+	// when the order isn't declared. Copy and ShallowCopy share the slice, so
+	// it must not be modified.
+	Columns []string
+
 	// Flags has bit flags which controls behavior of this tuple. When a Box
 	// emits a tuple derived from a received one, it must copy this field
 	// otherwise a problem like infinite reporting of a dropped tuple could
@@ -102,6 +124,18 @@ func NewTuple(d data.Map) *Tuple {
 	}
 }
 
+// NewHeartbeatTuple creates a heartbeat tuple having the given timestamp.
+// The tuple has an empty Data and TFHeartbeat flag.
+func NewHeartbeatTuple(ts time.Time) *Tuple {
+	t := &Tuple{
+		Data:          data.Map{},
+		Timestamp:     ts,
+		ProcTimestamp: ts,
+	}
+	t.Flags.Set(TFHeartbeat)
+	return t
+}
+
 // TupleFlags has flags which controls behavior of a tuple.
 type TupleFlags uint32
 
@@ -132,6 +166,13 @@ const (
 	//	(false, true): a tuple returned from ShallowCopy
 	//	(false, false): a tuple returned from NewTuple or Copy
 	TFSharedData
+
+	// TFHeartbeat is a flag which is set when a tuple is a heartbeat emitted
+	// by an idle source (see SourceConfig.Heartbeat). A heartbeat tuple has an
+	// empty Data and only its Timestamp is meaningful. Boxes must ignore its
+	// payload but can use its Timestamp to advance time, e.g. to close
+	// time-based windows. Sinks never receive heartbeat tuples.
+	TFHeartbeat
 )
 
 // Set sets a set of flags at once.
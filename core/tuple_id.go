@@ -0,0 +1,46 @@
+package core
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// TupleIDGenerator generates an ID of a tuple. An ID is usually derived from
+// the content of the tuple so that the same tuple processed twice, e.g.
+// after a source is rewound, gets the same ID.
+type TupleIDGenerator interface {
+	// GenerateID returns the ID of the tuple. It must not modify the tuple.
+	// GenerateID must be safe to call concurrently.
+	GenerateID(t *Tuple) (string, error)
+}
+
+// NewColumnHashIDGenerator returns a TupleIDGenerator which generates an ID
+// from a hash value of the given columns of a tuple. Tuples having equal
+// values in the columns get the same ID even if other columns differ. The
+// hash value of a Map doesn't depend on the order of its keys. A missing
+// column is treated as if it had NULL.
+//
+// Because data.Hash is used to compute the ID, a Float having an integer
+// value, e.g. 2.0, results in the same ID as the Int, and a column having NaN
+// results in a different ID every time.
+func NewColumnHashIDGenerator(columns ...data.Path) TupleIDGenerator {
+	return &columnHashIDGenerator{
+		columns: columns,
+	}
+}
+
+type columnHashIDGenerator struct {
+	columns []data.Path
+}
+
+func (g *columnHashIDGenerator) GenerateID(t *Tuple) (string, error) {
+	values := make(data.Array, len(g.columns))
+	for i, p := range g.columns {
+		v, err := t.Data.Get(p)
+		if err != nil {
+			v = data.Null{}
+		}
+		values[i] = v
+	}
+	return fmt.Sprintf("%016x", uint64(data.Hash(values))), nil
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestColumnHashIDGenerator(t *testing.T) {
+	Convey("Given a column hash ID generator", t, func() {
+		g := NewColumnHashIDGenerator(data.MustCompilePath("a"), data.MustCompilePath("m.n"))
+		genID := func(m data.Map) string {
+			id, err := g.GenerateID(&Tuple{Data: m})
+			So(err, ShouldBeNil)
+			So(id, ShouldNotBeEmpty)
+			return id
+		}
+
+		Convey("When generating IDs of tuples having the same columns", func() {
+			id1 := genID(data.Map{
+				"a": data.Int(1),
+				"m": data.Map{"n": data.Map{"x": data.Int(1), "y": data.Array{data.String("z")}}},
+				"b": data.Int(1),
+			})
+			id2 := genID(data.Map{
+				"a": data.Int(1),
+				"m": data.Map{"n": data.Map{"y": data.Array{data.String("z")}, "x": data.Int(1)}},
+				"b": data.Int(2),
+			})
+
+			Convey("Then they should be the same", func() {
+				So(id2, ShouldEqual, id1)
+			})
+		})
+
+		Convey("When generating IDs of tuples having different columns", func() {
+			base := data.Map{
+				"a": data.Int(1),
+				"m": data.Map{"n": data.Map{"x": data.Int(1)}},
+			}
+			others := []data.Map{
+				{"a": data.Int(2), "m": data.Map{"n": data.Map{"x": data.Int(1)}}},
+				{"a": data.Int(1), "m": data.Map{"n": data.Map{"x": data.Int(2)}}},
+				{"a": data.Int(1), "m": data.Map{"n": data.Map{"y": data.Int(1)}}},
+				{"a": data.Int(1), "m": data.Map{"n": data.Map{"x": data.Int(1), "y": data.Int(1)}}},
+				{"a": data.String("1"), "m": data.Map{"n": data.Map{"x": data.Int(1)}}},
+				{"a": data.Int(1)},
+			}
+
+			Convey("Then they should be different", func() {
+				id := genID(base)
+				for _, m := range others {
+					So(genID(m), ShouldNotEqual, id)
+				}
+			})
+		})
+
+		Convey("When generating an ID of a tuple missing a column", func() {
+			id1 := genID(data.Map{"a": data.Int(1)})
+			id2 := genID(data.Map{"a": data.Int(1), "m": data.Map{"n": data.Null{}}})
+
+			Convey("Then it should be the same as the ID of a tuple having NULL", func() {
+				So(id2, ShouldEqual, id1)
+			})
+		})
+	})
+}
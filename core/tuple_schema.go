@@ -0,0 +1,51 @@
+package core
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// TupleValidator validates tuples written to a node against a contract such
+// as a schema.
+type TupleValidator interface {
+	// Validate returns an error when the tuple violates the contract. It
+	// must not modify the tuple. Validate must be safe to call concurrently.
+	Validate(t *Tuple) error
+}
+
+// SchemaColumn is a column of a schema given to NewSchemaValidator.
+type SchemaColumn struct {
+	// Name is the key of the column in Data of a tuple.
+	Name string
+
+	// Type is the type of values of the column.
+	Type data.TypeID
+}
+
+// NewSchemaValidator returns a TupleValidator which checks if Data of a tuple
+// has all the given columns and their values have the declared types. NULL
+// is accepted for a column of any type, but a missing column is a violation.
+// Types aren't converted, so an Int isn't accepted for a float column.
+// Columns not declared in the schema are ignored.
+func NewSchemaValidator(columns ...SchemaColumn) TupleValidator {
+	return &schemaValidator{
+		columns: columns,
+	}
+}
+
+type schemaValidator struct {
+	columns []SchemaColumn
+}
+
+func (s *schemaValidator) Validate(t *Tuple) error {
+	for _, c := range s.columns {
+		v, ok := t.Data[c.Name]
+		if !ok {
+			return fmt.Errorf("the tuple doesn't have the column '%v'", c.Name)
+		}
+		if typ := v.Type(); typ != c.Type && typ != data.TypeNull {
+			return fmt.Errorf("the column '%v' must be %v but it's %v", c.Name, c.Type, typ)
+		}
+	}
+	return nil
+}
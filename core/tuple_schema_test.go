@@ -0,0 +1,55 @@
+package core
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestSchemaValidator(t *testing.T) {
+	Convey("Given a schema validator", t, func() {
+		v := NewSchemaValidator(
+			SchemaColumn{Name: "a", Type: data.TypeInt},
+			SchemaColumn{Name: "b", Type: data.TypeString},
+		)
+		validate := func(m data.Map) error {
+			return v.Validate(&Tuple{Data: m})
+		}
+
+		Convey("When validating a tuple matching the schema", func() {
+			Convey("Then it should succeed", func() {
+				So(validate(data.Map{"a": data.Int(1), "b": data.String("x")}), ShouldBeNil)
+			})
+		})
+
+		Convey("When validating a tuple having extra columns", func() {
+			Convey("Then it should succeed", func() {
+				So(validate(data.Map{"a": data.Int(1), "b": data.String("x"), "c": data.True}), ShouldBeNil)
+			})
+		})
+
+		Convey("When validating a tuple having NULL", func() {
+			Convey("Then it should succeed", func() {
+				So(validate(data.Map{"a": data.Null{}, "b": data.String("x")}), ShouldBeNil)
+			})
+		})
+
+		Convey("When validating a tuple missing a column", func() {
+			err := validate(data.Map{"a": data.Int(1)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "'b'")
+			})
+		})
+
+		Convey("When validating a tuple having a column of a wrong type", func() {
+			err := validate(data.Map{"a": data.Float(1), "b": data.String("x")})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "must be int but it's float")
+			})
+		})
+	})
+}
@@ -25,6 +25,8 @@ func TestTuple(t *testing.T) {
 		Timestamp:     time.Date(2015, time.April, 10, 10, 23, 0, 0, time.UTC),
 		ProcTimestamp: time.Date(2015, time.April, 10, 10, 24, 0, 0, time.UTC),
 		BatchID:       7,
+		CorrelationID: "cid",
+		ID:            "id",
 	}
 	start := time.Now()
 
@@ -72,6 +74,9 @@ func TestTuple(t *testing.T) {
 
 				So(tup.BatchID, ShouldResemble, copy.BatchID)
 				So(&tup.BatchID, ShouldNotPointTo, &copy.BatchID)
+
+				So(copy.CorrelationID, ShouldEqual, "cid")
+				So(copy.ID, ShouldEqual, "id")
 			})
 
 			Convey("Then all values should be the same", func() {
@@ -79,6 +84,15 @@ func TestTuple(t *testing.T) {
 			})
 		})
 
+		Convey("When shallow-copying the Tuple", func() {
+			copy := tup.ShallowCopy()
+
+			Convey("Then the correlation ID and the ID should be preserved", func() {
+				So(copy.CorrelationID, ShouldEqual, "cid")
+				So(copy.ID, ShouldEqual, "id")
+			})
+		})
+
 		Convey("When creating a Tuple by NewTuple", func() {
 			t := NewTuple(testData)
 
@@ -89,6 +103,8 @@ func TestTuple(t *testing.T) {
 				So(t.InputName, ShouldBeEmpty)
 				So(t.BatchID, ShouldEqual, 0)
 				So(t.Trace, ShouldBeEmpty)
+				So(t.CorrelationID, ShouldBeEmpty)
+				So(t.ID, ShouldBeEmpty)
 			})
 
 			Convey("Then all values should be the same", func() {
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Encode encodes a struct into a Map. The argument must be a struct or a
+// pointer to a struct. It's the inverse of Decode and follows the same naming
+// rules: the name of a field is converted to snake_case unless a custom name
+// is given by the "bql" tag. Options in the tag are ignored. Fields of an
+// embedded struct are encoded as if they were fields of the outer struct.
+// Unexported fields are not encoded.
+//
+// Following types of fields are supported:
+//
+//	* types supported by NewValue
+//	* types whose underlying type is bool, int (all sizes), float32,
+//	  float64, or string
+//	* map with string keys
+//	* struct, embedded struct
+//	* time.Duration (encoded as a Float in seconds)
+//	* pointer of these types (a field having a nil pointer is omitted)
+func Encode(v interface{}) (Map, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, errors.New("the argument must not be nil")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct || rv.Type().ConvertibleTo(reflect.TypeOf(time.Time{})) {
+		return nil, fmt.Errorf("the argument must be a struct: %T", v)
+	}
+	m := Map{}
+	if err := encodeFields(m, rv); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func encodeFields(m Map, src reflect.Value) error {
+	t := src.Type()
+	for i, n := 0, t.NumField(); i < n; i++ {
+		f := t.Field(i)
+		fv := src.Field(i)
+		if f.Anonymous {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() != reflect.Struct {
+				return fmt.Errorf("unsupported embedded field: %v", f.Name)
+			}
+			if err := encodeFields(m, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		if fv.Kind() == reflect.Ptr && fv.IsNil() {
+			// omitted so that Decode leaves the field nil
+			continue
+		}
+
+		name := strings.TrimSpace(strings.Split(f.Tag.Get("bql"), ",")[0])
+		if name == "" {
+			name = toSnakeCase(f.Name)
+		}
+		v, err := encodeValue(fv)
+		if err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+		m[name] = v
+	}
+	return nil
+}
+
+// encodeValue converts a value which NewValue doesn't directly support.
+func encodeValue(v reflect.Value) (Value, error) {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		return Float(time.Duration(v.Int()).Seconds()), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return Bool(v.Bool()), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Int(v.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > uint64(MaxInt) {
+			return nil, fmt.Errorf("an int value must be less than %v: %v", MaxInt, v.Uint())
+		}
+		return Int(v.Uint()), nil
+
+	case reflect.Float32, reflect.Float64:
+		return Float(v.Float()), nil
+
+	case reflect.String:
+		return String(v.String()), nil
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return Null{}, nil
+		}
+		return NewValue(v.Interface())
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return Null{}, nil
+		}
+		return NewValue(v.Elem().Interface())
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return Blob(v.Bytes()), nil
+		}
+		a := make(Array, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elem, err := NewValue(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			a[i] = elem
+		}
+		return a, nil
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("a key of a map must be a string: %v", v.Type())
+		}
+		m := make(Map, v.Len())
+		for _, k := range v.MapKeys() {
+			elem, err := NewValue(v.MapIndex(k).Interface())
+			if err != nil {
+				return nil, err
+			}
+			m[k.String()] = elem
+		}
+		return m, nil
+
+	case reflect.Struct:
+		if v.Type().ConvertibleTo(reflect.TypeOf(time.Time{})) {
+			return Timestamp(v.Convert(reflect.TypeOf(time.Time{})).Interface().(time.Time)), nil
+		}
+		m := Map{}
+		if err := encodeFields(m, v); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", v.Type())
+}
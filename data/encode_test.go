@@ -0,0 +1,116 @@
+package data
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	type nested struct {
+		X int    `bql:"nested_int,required"`
+		Z string `bql:"nested_str"`
+	}
+	type Embedded struct {
+		E float32
+	}
+	type level int
+	type record struct {
+		Embedded
+		B          bool
+		I          int
+		F          float64
+		S          string `bql:"str_key"`
+		L          level
+		V          Value
+		FloatMap   map[string]float64
+		IntArray   []int
+		Blob       []byte
+		Struct     nested `bql:"inner"`
+		Nested     []nested
+		Time       time.Time
+		Duration   time.Duration
+		IPtr       *int
+		NilPtr     *nested
+		unexported int
+	}
+
+	Convey("Given a struct", t, func() {
+		now := time.Date(2015, time.May, 1, 14, 27, 0, 0, time.UTC)
+		i := 5
+		r := &record{
+			Embedded:   Embedded{E: 0.5},
+			B:          true,
+			I:          10,
+			F:          3.14,
+			S:          "str",
+			L:          2,
+			V:          Array{Int(1)},
+			FloatMap:   map[string]float64{"a": 1.5},
+			IntArray:   []int{1, 2},
+			Blob:       []byte("blob"),
+			Struct:     nested{X: 1, Z: "a"},
+			Nested:     []nested{{X: 2}},
+			Time:       now,
+			Duration:   1500 * time.Millisecond,
+			IPtr:       &i,
+			unexported: 1,
+		}
+
+		Convey("When encoding it", func() {
+			m, err := Encode(r)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have all exported non-nil fields", func() {
+				So(m, ShouldResemble, Map{
+					"e":         Float(0.5),
+					"b":         True,
+					"i":         Int(10),
+					"f":         Float(3.14),
+					"str_key":   String("str"),
+					"l":         Int(2),
+					"v":         Array{Int(1)},
+					"float_map": Map{"a": Float(1.5)},
+					"int_array": Array{Int(1), Int(2)},
+					"blob":      Blob("blob"),
+					"inner": Map{
+						"nested_int": Int(1),
+						"nested_str": String("a"),
+					},
+					"nested": Array{Map{
+						"nested_int": Int(2),
+						"nested_str": String(""),
+					}},
+					"time":     Timestamp(now),
+					"duration": Float(1.5),
+					"i_ptr":    Int(5),
+				})
+			})
+
+			Convey("Then it should be decoded to the same struct", func() {
+				d := &record{}
+				So(Decode(m, d), ShouldBeNil)
+				r.unexported = 0
+				So(d, ShouldResemble, r)
+			})
+		})
+	})
+
+	Convey("Given values which cannot be encoded", t, func() {
+		for _, v := range []interface{}{
+			10,
+			time.Now(),
+			(*nested)(nil),
+			struct{ C chan int }{},
+			struct{ M map[int]int }{},
+		} {
+			Convey("When encoding it", func() {
+				_, err := Encode(v)
+
+				Convey("Then it should fail", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
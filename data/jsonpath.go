@@ -37,7 +37,23 @@ func MustCompilePath(s string) Path {
 // CompilePath takes a JSON Path as a string and returns an
 // instance of Path representing that JSON Path, or an error
 // if the parameter is not a valid JSON Path.
-func CompilePath(s string) (p Path, err error) {
+func CompilePath(s string) (Path, error) {
+	return compilePath(s, false)
+}
+
+// CompileCaseInsensitivePath works like CompilePath, but the returned
+// Path matches Map keys case-insensitively, i.e., `temp` also finds an
+// entry stored with the key `Temp`. When a key matching exactly exists,
+// it is always preferred. Otherwise, all keys of the Map are compared
+// using a case-normalized comparison, so a lookup that does not match
+// exactly is O(n) in the number of keys of the Map rather than O(1).
+// When a Map contains multiple keys only differing in case and none of
+// them matches exactly, which one is returned is undefined.
+func CompileCaseInsensitivePath(s string) (Path, error) {
+	return compilePath(s, true)
+}
+
+func compilePath(s string, ignoreCase bool) (p Path, err error) {
 	// catch any parser errors
 	defer func() {
 		if r := recover(); r != nil {
@@ -61,6 +77,14 @@ func CompilePath(s string) (p Path, err error) {
 			}
 			containsSlice = true
 		}
+		if ignoreCase {
+			switch e := c.(type) {
+			case *mapValueExtractor:
+				e.ignoreCase = true
+			case *recursiveExtractor:
+				e.ignoreCase = true
+			}
+		}
 	}
 	return j, nil
 }
@@ -170,13 +194,33 @@ type extractor interface {
 // addMapAccess is called when we discover `foo` or `["bar"]`
 // in a JSON Path string.
 func (j *jsonPeg) addMapAccess(s string) {
-	j.components = append(j.components, &mapValueExtractor{s})
+	j.components = append(j.components, &mapValueExtractor{key: s})
 }
 
 // mapValueExtractor can extract a value from a Map using the
 // given key.
 type mapValueExtractor struct {
 	key string
+	// ignoreCase is true when the key should be matched
+	// case-insensitively.
+	ignoreCase bool
+}
+
+// lookupKey returns the key of cont that should be used to access the
+// entry designated by a.key. The second return value is false when cont
+// does not have such an entry.
+func (a *mapValueExtractor) lookupKey(cont Map) (string, bool) {
+	if _, ok := cont[a.key]; ok {
+		return a.key, true
+	}
+	if a.ignoreCase {
+		for k := range cont {
+			if strings.EqualFold(k, a.key) {
+				return k, true
+			}
+		}
+	}
+	return "", false
 }
 
 func (a *mapValueExtractor) extract(v Value, next *Value) error {
@@ -184,8 +228,8 @@ func (a *mapValueExtractor) extract(v Value, next *Value) error {
 	if err != nil {
 		return err
 	}
-	if elem, ok := cont[a.key]; ok {
-		*next = elem
+	if key, ok := a.lookupKey(cont); ok {
+		*next = cont[key]
 		return nil
 	}
 	return fmt.Errorf("key '%s' was not found in map", a.key)
@@ -204,15 +248,17 @@ func (a *mapValueExtractor) extractForSet(v Value, next *Value, setInParent *fun
 		return fmt.Errorf("cannot access a %T using key \"%s\"", v, a.key)
 	}
 	// if the Map does not have the key, add it (so that we
-	// can "descend" further into cont[a.key])
-	if _, ok := cont[a.key]; !ok {
-		cont[a.key] = Null{}
+	// can "descend" further into cont[key])
+	key, ok := a.lookupKey(cont)
+	if !ok {
+		key = a.key
+		cont[key] = Null{}
 	}
-	// invariant: cont[a.key] is a valid entry here, possibly NULL
+	// invariant: cont[key] is a valid entry here, possibly NULL
 	*setInParent = func(v Value) {
-		cont[a.key] = v
+		cont[key] = v
 	}
-	*next = cont[a.key]
+	*next = cont[key]
 	return nil
 }
 
@@ -223,13 +269,16 @@ func (a *mapValueExtractor) resultMultiplicity() multiplicity {
 // addRecursiveAccess is called when we discover `..foo` or `..["bar"]`
 // in a JSON Path string.
 func (j *jsonPeg) addRecursiveAccess(s string) {
-	j.components = append(j.components, &recursiveExtractor{s})
+	j.components = append(j.components, &recursiveExtractor{key: s})
 }
 
 // recursiveExtractor can extract a list of all items with a certain key,
 // no matter where they are located in the Map
 type recursiveExtractor struct {
 	key string
+	// ignoreCase is true when the key should be matched
+	// case-insensitively.
+	ignoreCase bool
 }
 
 func (a *recursiveExtractor) extract(v Value, next *Value) error {
@@ -241,7 +290,7 @@ func (a *recursiveExtractor) extract(v Value, next *Value) error {
 		// contained containers
 		cont, _ := v.asMap()
 		for key, value := range cont {
-			if key == a.key {
+			if key == a.key || (a.ignoreCase && strings.EqualFold(key, a.key)) {
 				// NB. We do NOT descend further into `value` even if
 				// it is itself a Map or Array!
 				results = append(results, value)
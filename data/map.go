@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 )
 
@@ -80,6 +82,117 @@ func (m *Map) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// JSONNumberPolicy controls how numbers in JSON are converted into Values.
+// Because Equal and Hash regard Float having an integral value as the same as
+// Int, policies only affect the types of values and results of arithmetic
+// operations, e.g. 3 / 2 is 1 with Ints and 1.5 with Floats.
+type JSONNumberPolicy int
+
+const (
+	// JSONNumberPreserve converts a number written as an integer, e.g. 1,
+	// into Int and other numbers, e.g. 1.0 or 1e3, into Float. This is the
+	// policy used by Map.UnmarshalJSON.
+	JSONNumberPreserve JSONNumberPolicy = iota
+
+	// JSONNumberPreferInt converts a number having an integral value into
+	// Int even if it's written as 1.0 or 1e3. A number which cannot be
+	// represented by Int is converted into Float.
+	JSONNumberPreferInt
+
+	// JSONNumberFloat always converts a number into Float.
+	JSONNumberFloat
+)
+
+// ParseJSONNumberPolicy returns the JSONNumberPolicy having the given name.
+// Names are "preserve", "int", and "float", and they're case-insensitive.
+func ParseJSONNumberPolicy(s string) (JSONNumberPolicy, error) {
+	switch strings.ToLower(s) {
+	case "preserve":
+		return JSONNumberPreserve, nil
+	case "int":
+		return JSONNumberPreferInt, nil
+	case "float":
+		return JSONNumberFloat, nil
+	default:
+		return 0, fmt.Errorf("unknown JSON number policy: %v", s)
+	}
+}
+
+func (p JSONNumberPolicy) String() string {
+	switch p {
+	case JSONNumberPreserve:
+		return "preserve"
+	case JSONNumberPreferInt:
+		return "int"
+	case JSONNumberFloat:
+		return "float"
+	default:
+		return "unknown"
+	}
+}
+
+// UnmarshalJSONMap reconstructs a Map from JSON. Numbers are converted
+// according to the given policy.
+func UnmarshalJSONMap(data []byte, p JSONNumberPolicy) (Map, error) {
+	var j map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&j); err != nil {
+		return nil, err
+	}
+	if p != JSONNumberPreserve {
+		if err := p.convertNumbers(j); err != nil {
+			return nil, err
+		}
+	}
+	return NewMap(j)
+}
+
+// convertNumbers replaces json.Numbers in the given map or array with Values
+// converted according to the policy.
+func (p JSONNumberPolicy) convertNumbers(v interface{}) error {
+	conv := func(e interface{}) (interface{}, error) {
+		n, ok := e.(json.Number)
+		if !ok {
+			return e, p.convertNumbers(e)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, err
+		}
+		if p == JSONNumberFloat {
+			return Float(f), nil
+		}
+		if i, err := n.Int64(); err == nil {
+			return Int(i), nil
+		}
+		if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return Int(int64(f)), nil
+		}
+		return Float(f), nil
+	}
+
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		for k, e := range vt {
+			c, err := conv(e)
+			if err != nil {
+				return err
+			}
+			vt[k] = c
+		}
+	case []interface{}:
+		for i, e := range vt {
+			c, err := conv(e)
+			if err != nil {
+				return err
+			}
+			vt[i] = c
+		}
+	}
+	return nil
+}
+
 // Copy performs deep copy of a Map. The Map returned from this method can
 // safely be modified without affecting the original.
 func (m Map) Copy() Map {
@@ -2,7 +2,9 @@ package data
 
 import (
 	"encoding/json"
+	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
+	"strings"
 	"testing"
 	"time"
 )
@@ -59,3 +61,164 @@ func TestMapMarshalJSON(t *testing.T) {
 		})
 	})
 }
+
+func TestUnmarshalJSONMap(t *testing.T) {
+	Convey("Given JSON objects having numbers", t, func() {
+		cases := []struct {
+			json     string
+			policy   JSONNumberPolicy
+			expected Value
+		}{
+			{`{"n":1}`, JSONNumberPreserve, Int(1)},
+			{`{"n":1.0}`, JSONNumberPreserve, Float(1)},
+			{`{"n":1e3}`, JSONNumberPreserve, Float(1000)},
+			{`{"n":1}`, JSONNumberPreferInt, Int(1)},
+			{`{"n":1.0}`, JSONNumberPreferInt, Int(1)},
+			{`{"n":1e3}`, JSONNumberPreferInt, Int(1000)},
+			{`{"n":1.5}`, JSONNumberPreferInt, Float(1.5)},
+			{`{"n":1e100}`, JSONNumberPreferInt, Float(1e100)},
+			{`{"n":1}`, JSONNumberFloat, Float(1)},
+			{`{"n":1.5}`, JSONNumberFloat, Float(1.5)},
+		}
+
+		for _, c := range cases {
+			c := c
+			Convey(fmt.Sprintf("When parsing %v with the %v policy", c.json, c.policy), func() {
+				m, err := UnmarshalJSONMap([]byte(c.json), c.policy)
+				So(err, ShouldBeNil)
+
+				Convey("Then the number should have the expected type", func() {
+					So(m["n"], ShouldResemble, c.expected)
+				})
+
+				Convey("Then its equality against an Int should not depend on the type", func() {
+					f, err := ToFloat(c.expected)
+					So(err, ShouldBeNil)
+					So(Equal(m["n"], Int(1)), ShouldEqual, f == 1)
+					So(Hash(m["n"]) == Hash(Int(1)), ShouldEqual, f == 1)
+				})
+			})
+		}
+
+		Convey("When parsing nested numbers with the float policy", func() {
+			m, err := UnmarshalJSONMap([]byte(`{"a":[1,{"b":2}],"s":"3"}`), JSONNumberFloat)
+			So(err, ShouldBeNil)
+
+			Convey("Then all numbers should be Floats", func() {
+				So(m, ShouldResemble, Map{
+					"a": Array{Float(1), Map{"b": Float(2)}},
+					"s": String("3"),
+				})
+			})
+		})
+
+		Convey("When parsing an invalid JSON", func() {
+			_, err := UnmarshalJSONMap([]byte(`{"n":`), JSONNumberPreferInt)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given names of policies", t, func() {
+		Convey("When parsing them", func() {
+			Convey("Then they should be converted to policies", func() {
+				for _, p := range []JSONNumberPolicy{JSONNumberPreserve, JSONNumberPreferInt, JSONNumberFloat} {
+					q, err := ParseJSONNumberPolicy(strings.ToUpper(p.String()))
+					So(err, ShouldBeNil)
+					So(q, ShouldEqual, p)
+				}
+				_, err := ParseJSONNumberPolicy("decimal")
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestMapCaseInsensitivePath(t *testing.T) {
+	Convey("Given a Map having keys with upper case letters", t, func() {
+		m := Map{
+			"Temp": Float(25.5),
+			"Sensor": Map{
+				"ID": String("a"),
+			},
+			"readings": Array{
+				Map{"Temp": Int(1)},
+				Map{"Temp": Int(2)},
+			},
+		}
+
+		Convey("When accessing it with a strict path", func() {
+			Convey("Then a key with the exact case should be found", func() {
+				v, err := m.Get(MustCompilePath("Temp"))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, Float(25.5))
+			})
+
+			Convey("Then a key with a different case should not be found", func() {
+				_, err := m.Get(MustCompilePath("temp"))
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Then setting a key with a different case should add a new key", func() {
+				So(m.Set(MustCompilePath("temp"), Int(3)), ShouldBeNil)
+				So(m["temp"], ShouldEqual, Int(3))
+				So(m["Temp"], ShouldEqual, Float(25.5))
+			})
+		})
+
+		Convey("When accessing it with a case-insensitive path", func() {
+			Convey("Then a key with a different case should be found", func() {
+				p, err := CompileCaseInsensitivePath("temp")
+				So(err, ShouldBeNil)
+				v, err := m.Get(p)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, Float(25.5))
+			})
+
+			Convey("Then nested keys should be found", func() {
+				p, err := CompileCaseInsensitivePath(`sensor["id"]`)
+				So(err, ShouldBeNil)
+				v, err := m.Get(p)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, String("a"))
+			})
+
+			Convey("Then recursive access should find all keys", func() {
+				p, err := CompileCaseInsensitivePath("readings..temp")
+				So(err, ShouldBeNil)
+				v, err := m.Get(p)
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, Array{Int(1), Int(2)})
+			})
+
+			Convey("Then a missing key should not be found", func() {
+				p, err := CompileCaseInsensitivePath("humidity")
+				So(err, ShouldBeNil)
+				_, err = m.Get(p)
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Then setting a key should overwrite the existing entry", func() {
+				p, err := CompileCaseInsensitivePath("temp")
+				So(err, ShouldBeNil)
+				So(m.Set(p, Int(3)), ShouldBeNil)
+				So(m["Temp"], ShouldEqual, Int(3))
+				So(m, ShouldNotContainKey, "temp")
+			})
+		})
+
+		Convey("When the Map has keys only differing in case", func() {
+			m["temp"] = Float(30)
+
+			Convey("Then a case-insensitive path should prefer the exact match", func() {
+				p, err := CompileCaseInsensitivePath("temp")
+				So(err, ShouldBeNil)
+				v, err := m.Get(p)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, Float(30))
+			})
+		})
+	})
+}
@@ -245,6 +245,8 @@ func ToFloat(v Value) (float64, error) {
 //  * String: the actual string
 //  * Blob: base64-encoded string
 //  * Timestamp: ISO 8601 representation, see time.RFC3339
+//  * Array, Map: JSON representation (keys of maps are sorted, so the
+//    result is deterministic and can be converted back by ToArray or ToMap)
 //  * other: Go's "%#v" representation
 func ToString(v Value) (string, error) {
 	switch v.Type() {
@@ -369,3 +371,53 @@ func ToDuration(v Value) (time.Duration, error) {
 		return 0, fmt.Errorf("cannot convert %T to Duration", v)
 	}
 }
+
+// ToArray converts a given Value to an Array, if possible.
+// The conversion rules are as follows:
+//
+//  * Null: nil
+//  * String: Array parsed from the JSON representation
+//  * Array: actual value
+//  * other: (error)
+func ToArray(v Value) (Array, error) {
+	switch v.Type() {
+	case TypeNull:
+		return nil, nil
+	case TypeString:
+		s, _ := v.asString()
+		var a Array
+		if err := a.UnmarshalJSON([]byte(s)); err != nil {
+			return nil, fmt.Errorf("cannot convert the string to Array: %v", err)
+		}
+		return a, nil
+	case TypeArray:
+		return v.asArray()
+	default:
+		return nil, fmt.Errorf("cannot convert %T to Array", v)
+	}
+}
+
+// ToMap converts a given Value to a Map, if possible.
+// The conversion rules are as follows:
+//
+//  * Null: nil
+//  * String: Map parsed from the JSON representation
+//  * Map: actual value
+//  * other: (error)
+func ToMap(v Value) (Map, error) {
+	switch v.Type() {
+	case TypeNull:
+		return nil, nil
+	case TypeString:
+		s, _ := v.asString()
+		var m Map
+		if err := m.UnmarshalJSON([]byte(s)); err != nil {
+			return nil, fmt.Errorf("cannot convert the string to Map: %v", err)
+		}
+		return m, nil
+	case TypeMap:
+		return v.asMap()
+	default:
+		return nil, fmt.Errorf("cannot convert %T to Map", v)
+	}
+}
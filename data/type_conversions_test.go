@@ -268,10 +268,9 @@ func TestToString(t *testing.T) {
 		"Map": {
 			{"empty", Map{}, `{}`},
 			{"one-key", Map{"a": Int(1)}, `{"a":1}`},
-			// the following test would fail once in a while because
-			// golang randomizes the keys for Maps, i.e., we cannot be sure
-			// that we will always get the same string
-			// convTestInput{"non-empty", Map{"a": Int(2), "b": String("foo")}, `data.Map{"a":2, "b":"foo"}`},
+			// keys are sorted
+			{"non-empty", Map{"b": String("foo"), "a": Int(2), "c": Map{"e": Null{}, "d": Array{}}},
+				`{"a":2,"b":"foo","c":{"d":[],"e":null}}`},
 		},
 	}
 
@@ -282,6 +281,94 @@ func TestToString(t *testing.T) {
 	runConversionTestCases(t, toFun, "ToString", testCases)
 }
 
+func TestToArray(t *testing.T) {
+	testCases := map[string][]convTestInput{
+		"Null": {
+			{"Null", Null{}, Array(nil)},
+		},
+		"Bool": {
+			{"true", Bool(true), nil},
+		},
+		"Int": {
+			{"positive", Int(2), nil},
+		},
+		"Float": {
+			{"positive", Float(3.14), nil},
+		},
+		"String": {
+			{"empty", String(""), nil},
+			{"empty array", String("[]"), Array{}},
+			{"non-empty array", String(`[2,"foo",{"a":[1.5]}]`),
+				Array{Int(2), String("foo"), Map{"a": Array{Float(1.5)}}}},
+			{"map", String(`{"a":1}`), nil},
+			{"invalid", String("hoge"), nil},
+		},
+		"Blob": {
+			{"non-empty", Blob("hoge"), nil},
+		},
+		"Timestamp": {
+			{"now", Timestamp(time.Now()), nil},
+		},
+		"Array": {
+			{"empty", Array{}, Array{}},
+			{"non-empty", Array{Int(2), String("foo")}, Array{Int(2), String("foo")}},
+		},
+		"Map": {
+			{"non-empty", Map{"a": Int(2)}, nil},
+		},
+	}
+
+	toFun := func(v Value) (interface{}, error) {
+		val, err := ToArray(v)
+		return val, err
+	}
+	runConversionTestCases(t, toFun, "ToArray", testCases)
+}
+
+func TestToMap(t *testing.T) {
+	testCases := map[string][]convTestInput{
+		"Null": {
+			{"Null", Null{}, Map(nil)},
+		},
+		"Bool": {
+			{"true", Bool(true), nil},
+		},
+		"Int": {
+			{"positive", Int(2), nil},
+		},
+		"Float": {
+			{"positive", Float(3.14), nil},
+		},
+		"String": {
+			{"empty", String(""), nil},
+			{"empty map", String("{}"), Map{}},
+			{"non-empty map", String(`{"a":2,"b":"foo","c":{"d":[1.5]}}`),
+				Map{"a": Int(2), "b": String("foo"), "c": Map{"d": Array{Float(1.5)}}}},
+			{"array", String("[1]"), nil},
+			{"invalid", String("hoge"), nil},
+		},
+		"Blob": {
+			{"non-empty", Blob("hoge"), nil},
+		},
+		"Timestamp": {
+			{"now", Timestamp(time.Now()), nil},
+		},
+		"Array": {
+			{"non-empty", Array{Int(2), String("foo")}, nil},
+		},
+		"Map": {
+			{"empty", Map{}, Map{}},
+			{"non-empty", Map{"a": Int(2)}, Map{"a": Int(2)}},
+		},
+	}
+
+	toFun := func(v Value) (interface{}, error) {
+		val, err := ToMap(v)
+		return val, err
+	}
+	runConversionTestCases(t, toFun, "ToMap", testCases)
+}
+
 func TestToBlob(t *testing.T) {
 	testCases := map[string][]convTestInput{
 		"Null": {
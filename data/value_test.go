@@ -779,7 +779,7 @@ func TestNewValueFromSlice(t *testing.T) {
 		})
 
 		Convey("When passing a slice of inconvertible type", func() {
-			_, err := NewValue([]struct{}{struct{}{}})
+			_, err := NewValue([]chan int{make(chan int)})
 
 			Convey("Then it should fail", func() {
 				So(err, ShouldNotBeNil)
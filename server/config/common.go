@@ -36,6 +36,14 @@ func mustAsMap(v data.Value) data.Map {
 	return m
 }
 
+func mustToInt(v data.Value) int {
+	i, err := data.ToInt(v)
+	if err != nil {
+		panic(err)
+	}
+	return int(i)
+}
+
 func mustToBool(v data.Value) bool {
 	b, err := data.ToBool(v)
 	if err != nil {
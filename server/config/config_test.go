@@ -90,10 +90,12 @@ func TestConfigToMap(t *testing.T) {
 					},
 					"topologies": data.Map{
 						"t1": data.Map{
-							"bql_file": data.String("t1.bql"),
+							"bql_file":           data.String("t1.bql"),
+							"max_udsf_instances": data.Int(0),
 						},
 						"t2": data.Map{
-							"bql_file": data.String("t2.bql"),
+							"bql_file":           data.String("t2.bql"),
+							"max_udsf_instances": data.Int(0),
 						},
 					},
 					"storage": data.Map{
@@ -13,6 +13,10 @@ type Topology struct {
 
 	// BQLFile is a file path to the BQL file executed on start up.
 	BQLFile string `json:"bql_file" yaml:"bql_file"`
+
+	// MaxUDSFInstances is the maximum number of UDSFs running in the
+	// topology at the same time. It's unlimited when it's 0.
+	MaxUDSFInstances int `json:"max_udsf_instances" yaml:"max_udsf_instances"`
 }
 
 // Topologies is a set of configuration of topologies.
@@ -32,6 +36,10 @@ var (
 						"bql_file": {
 							"type": "string",
 							"minLength": 1
+						},
+						"max_udsf_instances": {
+							"type": "integer",
+							"minimum": 0
 						}
 					},
 					"additionalProperties": false
@@ -73,8 +81,9 @@ func newTopologies(m data.Map) Topologies {
 			conf = data.Map{}
 		}
 		t := &Topology{
-			Name:    name,
-			BQLFile: mustAsString(getWithDefault(mustAsMap(conf), "bql_file", data.String(""))),
+			Name:             name,
+			BQLFile:          mustAsString(getWithDefault(mustAsMap(conf), "bql_file", data.String(""))),
+			MaxUDSFInstances: mustToInt(getWithDefault(mustAsMap(conf), "max_udsf_instances", data.Int(0))),
 		}
 		ts[name] = t
 	}
@@ -87,7 +96,8 @@ func (ts *Topologies) ToMap() data.Map {
 	for k, v := range *ts {
 		v := v
 		m[k] = data.Map{
-			"bql_file": data.String(v.BQLFile),
+			"bql_file":           data.String(v.BQLFile),
+			"max_udsf_instances": data.Int(v.MaxUDSFInstances),
 		}
 	}
 	return m
@@ -9,14 +9,16 @@ import (
 func TestTopologies(t *testing.T) {
 	Convey("Given a JSON config for logging section", t, func() {
 		Convey("When the config is valid", func() {
-			ts, err := NewTopologies(toMap(`{"test1":{},"test2":{"bql_file":"/path/to/hoge.bql"},"test3":null}`))
+			ts, err := NewTopologies(toMap(`{"test1":{},"test2":{"bql_file":"/path/to/hoge.bql","max_udsf_instances":10},"test3":null}`))
 			So(err, ShouldBeNil)
 
 			Convey("Then it should have given parameters", func() {
 				So(ts["test1"].Name, ShouldEqual, "test1")
 				So(ts["test1"].BQLFile, ShouldEqual, "")
+				So(ts["test1"].MaxUDSFInstances, ShouldEqual, 0)
 				So(ts["test2"].Name, ShouldEqual, "test2")
 				So(ts["test2"].BQLFile, ShouldEqual, "/path/to/hoge.bql")
+				So(ts["test2"].MaxUDSFInstances, ShouldEqual, 10)
 				So(ts["test3"].Name, ShouldEqual, "test3")
 				So(ts["test3"].BQLFile, ShouldEqual, "")
 			})
@@ -57,5 +59,14 @@ func TestTopologies(t *testing.T) {
 				})
 			}
 		})
+
+		Convey("When validating max_udsf_instances", func() {
+			for _, b := range [][]interface{}{{"negative", -1}, {"float", 1.5}, {"invalid type", `"1"`}} {
+				Convey(fmt.Sprintf("Then it should reject %v value", b[0]), func() {
+					_, err := NewTopologies(toMap(fmt.Sprintf(`{"test":{"max_udsf_instances":%v}}`, b[1])))
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
 	})
 }
@@ -172,7 +172,8 @@ func setUpTopologies(logger *logrus.Logger, r TopologyRegistry, conf *config.Con
 
 func setUpTopology(logger *logrus.Logger, name string, conf *config.Config, us udf.UDSStorage) (*bql.TopologyBuilder, error) {
 	cc := &core.ContextConfig{
-		Logger: logger,
+		Logger:           logger,
+		MaxUDSFInstances: conf.Topologies[name].MaxUDSFInstances,
 	}
 	cc.Flags.DroppedTupleLog.Set(conf.Logging.LogDroppedTuples)
 	cc.Flags.DestinationlessTupleLog.Set(conf.Logging.LogDestinationlessTuples)
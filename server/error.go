@@ -25,4 +25,9 @@ const (
 	// nonWebSocketRequestErrorCode is returned when a requested action only
 	// supports WebSocket and a request is a regular HTTP request.
 	nonWebSocketRequestErrorCode = "E0008"
+
+	// tuplePushErrorCode is returned when tuples cannot be pushed to a
+	// source. It's also returned when the source doesn't accept pushed
+	// tuples.
+	tuplePushErrorCode = "E0009"
 )
@@ -0,0 +1,61 @@
+package response
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/bql"
+)
+
+// GraphNode is a node in GraphDiff.
+type GraphNode struct {
+	NodeType   string `json:"node_type"`
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+// GraphEdge is an edge in GraphDiff.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// GraphDiff is a part of the response which is returned by topologies.diff
+// action.
+type GraphDiff struct {
+	AddedNodes   []*GraphNode `json:"added_nodes"`
+	RemovedNodes []*GraphNode `json:"removed_nodes"`
+	ChangedNodes []*GraphNode `json:"changed_nodes"`
+	AddedEdges   []*GraphEdge `json:"added_edges"`
+	RemovedEdges []*GraphEdge `json:"removed_edges"`
+}
+
+// NewGraphDiff creates a new response of a difference between two graphs.
+func NewGraphDiff(d *bql.GraphDiff) *GraphDiff {
+	nodes := func(ns []*bql.GraphNode) []*GraphNode {
+		res := make([]*GraphNode, 0, len(ns))
+		for _, n := range ns {
+			res = append(res, &GraphNode{
+				NodeType:   n.Type.String(),
+				Name:       n.Name,
+				Definition: n.Definition,
+			})
+		}
+		return res
+	}
+	edges := func(es []bql.GraphEdge) []*GraphEdge {
+		res := make([]*GraphEdge, 0, len(es))
+		for _, e := range es {
+			res = append(res, &GraphEdge{
+				From: e.From,
+				To:   e.To,
+			})
+		}
+		return res
+	}
+
+	return &GraphDiff{
+		AddedNodes:   nodes(d.AddedNodes),
+		RemovedNodes: nodes(d.RemovedNodes),
+		ChangedNodes: nodes(d.ChangedNodes),
+		AddedEdges:   edges(d.AddedEdges),
+		RemovedEdges: edges(d.RemovedEdges),
+	}
+}
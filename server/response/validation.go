@@ -0,0 +1,29 @@
+package response
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/bql"
+)
+
+// ValidationError is an error in a BQL document. It is a part of the
+// response which is returned by topologies.validate action.
+type ValidationError struct {
+	// Code is the error code which would be returned if the statement was
+	// executed.
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Statement string `json:"statement"`
+	Line      int    `json:"line"`
+	Symbol    int    `json:"symbol"`
+}
+
+// NewValidationError creates a new response of an error found by
+// bql.TopologyBuilder.Validate.
+func NewValidationError(code string, e *bql.ValidationError) *ValidationError {
+	return &ValidationError{
+		Code:      code,
+		Message:   e.Error(),
+		Statement: e.Statement,
+		Line:      e.Line,
+		Symbol:    e.Symbol,
+	}
+}
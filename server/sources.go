@@ -1,8 +1,10 @@
 package server
 
 import (
+	"errors"
 	"github.com/gocraft/web"
 	"gopkg.in/pfnet/jasco.v1"
+	"gopkg.in/sensorbee/sensorbee.v0/bql"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/server/response"
 	"net/http"
@@ -18,6 +20,7 @@ func setUpSourcesRouter(prefix string, router *web.Router) {
 	root.Middleware((*sources).fetchSource)
 	root.Get("/", (*sources).Index)
 	root.Get("/:sourceName", (*sources).Show)
+	root.Post("/:sourceName/push", (*sources).Push)
 }
 
 func (sc *sources) fetchSource(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
@@ -63,5 +66,34 @@ func (sc *sources) Show(rw web.ResponseWriter, req *web.Request) {
 	})
 }
 
+// Push writes tuples in the request body to the source. The source must
+// implement bql.HTTPPushSource.
+func (sc *sources) Push(rw web.ResponseWriter, req *web.Request) {
+	s, ok := sc.src.Source().(bql.HTTPPushSource)
+	if !ok {
+		err := errors.New("the source doesn't accept pushed tuples")
+		sc.ErrLog(err).Error("Cannot push tuples to the source")
+		sc.RenderError(jasco.NewError(tuplePushErrorCode, "The source doesn't accept pushed tuples",
+			http.StatusBadRequest, err))
+		return
+	}
+
+	n, err := s.PushHTTP(req.Request)
+	if err != nil {
+		status := http.StatusBadRequest
+		if e, ok := err.(*bql.HTTPPushError); ok {
+			status = e.StatusCode
+		}
+		sc.ErrLog(err).Error("Cannot push tuples to the source")
+		sc.RenderError(jasco.NewError(tuplePushErrorCode, "Cannot push tuples to the source", status, err))
+		return
+	}
+	sc.Render(map[string]interface{}{
+		"topology": sc.topologyName,
+		"source":   sc.src.Name(),
+		"count":    n,
+	})
+}
+
 // TODO: Support Update(e.g. pause/resume) and Destroy if necessary. They can be
 // done by queries.
@@ -36,7 +36,11 @@ func setUpTopologiesRouter(prefix string, router *web.Router) {
 	root.Get(`/:topologyName`, (*topologies).Show)
 	root.Delete(`/:topologyName`, (*topologies).Destroy)
 	root.Post(`/:topologyName/queries`, (*topologies).Queries)
+	root.Post(`/:topologyName/diff`, (*topologies).Diff)
+	root.Post(`/:topologyName/validate`, (*topologies).Validate)
 	root.Get(`/:topologyName/wsqueries`, (*topologies).WebSocketQueries)
+	root.Get(`/:topologyName/udfs`, (*topologies).UDFs)
+	root.Post(`/:topologyName/plugins`, (*topologies).Plugins)
 
 	setUpSourcesRouter(prefix, root)
 	setUpStreamsRouter(prefix, root)
@@ -273,6 +277,24 @@ func (tc *topologies) Queries(rw web.ResponseWriter, req *web.Request) {
 		} else if stmt, ok := stmts[0].(parser.EvalStmt); ok {
 			tc.handleEvalStmt(rw, stmt, stmtStr)
 			return
+		} else if stmt, ok := stmts[0].(parser.StatusStmt); ok {
+			tc.handleStatusStmt(rw, stmt, stmtStr)
+			return
+		} else if stmt, ok := stmts[0].(parser.ShowStmt); ok {
+			tc.handleShowStmt(rw, stmt, stmtStr)
+			return
+		} else if stmt, ok := stmts[0].(parser.DescribeStmt); ok {
+			tc.handleDescribeStmt(rw, stmt, stmtStr)
+			return
+		} else if stmt, ok := stmts[0].(parser.ShowUDFsStmt); ok {
+			tc.handleShowUDFsStmt(rw, stmt, stmtStr)
+			return
+		} else if stmt, ok := stmts[0].(parser.DescribeFunctionStmt); ok {
+			tc.handleDescribeFunctionStmt(rw, stmt, stmtStr)
+			return
+		} else if stmt, ok := stmts[0].(parser.ExplainStmt); ok {
+			tc.handleExplainStmt(rw, stmt, stmtStr)
+			return
 		}
 	}
 
@@ -298,23 +320,210 @@ func (tc *topologies) Queries(rw web.ResponseWriter, req *web.Request) {
 	})
 }
 
-func (tc *topologies) parseQueries(form data.Map) ([]interface{}, *jasco.Error) {
+// Diff compares the graph built from the given BQL statements with the graph
+// of the running topology. The statements aren't executed, but UDSFs used in
+// them are created and terminated to obtain their inputs as described in
+// bql.TopologyBuilder.StmtsGraph.
+func (tc *topologies) Diff(rw web.ResponseWriter, req *web.Request) {
+	tb := tc.fetchTopology()
+	if tb == nil {
+		return
+	}
+
+	var js map[string]interface{}
+	if apiErr := tc.ParseBody(&js); apiErr != nil {
+		tc.ErrLog(apiErr.Err).Error("Cannot parse the request json")
+		tc.RenderError(apiErr)
+		return
+	}
+
+	form, err := data.NewMap(js)
+	if err != nil {
+		tc.ErrLog(err).WithField("body", js).
+			Error("The request json may contain invalid value")
+		tc.RenderError(jasco.NewError(formValidationErrorCode, "The request json may contain invalid values.",
+			http.StatusBadRequest, err))
+		return
+	}
+
+	stmts, apiErr := tc.parseQueries(form)
+	if apiErr != nil {
+		tc.RenderError(apiErr)
+		return
+	}
+
+	newGraph, err := tb.StmtsGraph(stmts)
+	if err != nil {
+		tc.ErrLog(err).Error("Cannot build a graph from the statements")
+		e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot process a statement", http.StatusBadRequest, err)
+		e.Meta["error"] = err.Error()
+		tc.RenderError(e)
+		return
+	}
+	curGraph, err := tb.Graph()
+	if err != nil {
+		tc.ErrLog(err).Error("Cannot build a graph of the topology")
+		tc.RenderError(jasco.NewInternalServerError(err))
+		return
+	}
+
+	tc.Render(map[string]interface{}{
+		"topology_name": tc.topologyName,
+		"diff":          response.NewGraphDiff(bql.DiffGraphs(curGraph, newGraph)),
+	})
+}
+
+// Validate parses and analyzes the given BQL statements and returns all
+// errors found in them with their positions. The statements aren't executed
+// and the topology isn't modified. The response has an empty list of errors
+// when the statements are valid.
+func (tc *topologies) Validate(rw web.ResponseWriter, req *web.Request) {
+	tb := tc.fetchTopology()
+	if tb == nil {
+		return
+	}
+
+	var js map[string]interface{}
+	if apiErr := tc.ParseBody(&js); apiErr != nil {
+		tc.ErrLog(apiErr.Err).Error("Cannot parse the request json")
+		tc.RenderError(apiErr)
+		return
+	}
+
+	form, err := data.NewMap(js)
+	if err != nil {
+		tc.ErrLog(err).WithField("body", js).
+			Error("The request json may contain invalid value")
+		tc.RenderError(jasco.NewError(formValidationErrorCode, "The request json may contain invalid values.",
+			http.StatusBadRequest, err))
+		return
+	}
+
+	queries, apiErr := tc.queriesParam(form)
+	if apiErr != nil {
+		tc.RenderError(apiErr)
+		return
+	}
+
+	errs := []*response.ValidationError{}
+	for _, e := range tb.Validate(queries) {
+		code := bqlStmtProcessingErrorCode
+		if e.Kind == bql.ParseValidationError {
+			code = bqlStmtParseErrorCode
+		}
+		errs = append(errs, response.NewValidationError(code, e))
+	}
+	tc.Render(map[string]interface{}{
+		"topology_name": tc.topologyName,
+		"errors":        errs,
+	})
+}
+
+// UDFs returns the metadata of UDFs registered to the topology. It returns
+// the same result as SHOW UDFS statement.
+func (tc *topologies) UDFs(rw web.ResponseWriter, req *web.Request) {
+	tb := tc.fetchTopology()
+	if tb == nil {
+		return
+	}
+
+	udfs, err := tb.RunShowUDFsStmt(&parser.ShowUDFsStmt{})
+	if err != nil {
+		tc.ErrLog(err).Error("Cannot list UDFs")
+		tc.RenderError(jasco.NewInternalServerError(err))
+		return
+	}
+	tc.Render(map[string]interface{}{
+		"topology_name": tc.topologyName,
+		"count":         len(udfs),
+		"udfs":          udfs,
+	})
+}
+
+// Plugins loads a Go plugin and makes components registered by the plugin
+// available in the topology. It's the same as LOAD PLUGIN statement.
+func (tc *topologies) Plugins(rw web.ResponseWriter, req *web.Request) {
+	tb := tc.fetchTopology()
+	if tb == nil {
+		return
+	}
+
+	var js map[string]interface{}
+	if apiErr := tc.ParseBody(&js); apiErr != nil {
+		tc.ErrLog(apiErr.Err).Error("Cannot parse the request json")
+		tc.RenderError(apiErr)
+		return
+	}
+
+	form, err := data.NewMap(js)
+	if err != nil {
+		tc.ErrLog(err).WithField("body", js).
+			Error("The request json may contain invalid value")
+		tc.RenderError(jasco.NewError(formValidationErrorCode, "The request json may contain invalid values.",
+			http.StatusBadRequest, err))
+		return
+	}
+
+	p, ok := form["path"]
+	if !ok {
+		tc.Log().Error("The required 'path' field is missing")
+		e := jasco.NewError(formValidationErrorCode, "The request body is invalid.",
+			http.StatusBadRequest, nil)
+		e.Meta["path"] = []string{"field is missing"}
+		tc.RenderError(e)
+		return
+	}
+	path, err := data.AsString(p)
+	if err != nil {
+		tc.ErrLog(err).Error("'path' field isn't a string")
+		e := jasco.NewError(formValidationErrorCode, "The request body is invalid.",
+			http.StatusBadRequest, nil)
+		e.Meta["path"] = []string{"value must be a string"}
+		tc.RenderError(e)
+		return
+	}
+
+	stmt := parser.LoadPluginStmt{Path: path}
+	if _, err := tb.AddStmt(stmt); err != nil {
+		tc.ErrLog(err).WithField("path", path).Error("Cannot load the plugin")
+		e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot load the plugin", http.StatusBadRequest, err)
+		e.Meta["error"] = err.Error()
+		e.Meta["statement"] = stmt.String()
+		tc.RenderError(e)
+		return
+	}
+	tc.Render(map[string]interface{}{
+		"topology_name": tc.topologyName,
+		"path":          path,
+	})
+}
+
+// queriesParam returns the value of 'queries' field of the request json.
+func (tc *topologies) queriesParam(form data.Map) (string, *jasco.Error) {
 	// TODO: use mapstructure when parameters get too many
-	var queries string
-	if v, ok := form["queries"]; !ok {
+	v, ok := form["queries"]
+	if !ok {
 		errMsg := "The request json doesn't have 'queries' field"
 		tc.Log().Error(errMsg)
 		e := jasco.NewError(formValidationErrorCode, "'queries' field is missing",
 			http.StatusBadRequest, nil)
-		return nil, e
-	} else if f, err := data.AsString(v); err != nil {
+		return "", e
+	}
+	queries, err := data.AsString(v)
+	if err != nil {
 		errMsg := "'queries' must be a string"
 		tc.ErrLog(err).Error(errMsg)
 		e := jasco.NewError(formValidationErrorCode, "'queries' field must be a string",
 			http.StatusBadRequest, err)
-		return nil, e
-	} else {
-		queries = f
+		return "", e
+	}
+	return queries, nil
+}
+
+func (tc *topologies) parseQueries(form data.Map) ([]interface{}, *jasco.Error) {
+	queries, apiErr := tc.queriesParam(form)
+	if apiErr != nil {
+		return nil, apiErr
 	}
 
 	bp := parser.New()
@@ -336,6 +545,18 @@ func (tc *topologies) parseQueries(form data.Map) ([]interface{}, *jasco.Error)
 			dataReturningStmtIndex = len(stmts)
 		} else if _, ok := stmt.(parser.EvalStmt); ok {
 			dataReturningStmtIndex = len(stmts)
+		} else if _, ok := stmt.(parser.StatusStmt); ok {
+			dataReturningStmtIndex = len(stmts)
+		} else if _, ok := stmt.(parser.ShowStmt); ok {
+			dataReturningStmtIndex = len(stmts)
+		} else if _, ok := stmt.(parser.DescribeStmt); ok {
+			dataReturningStmtIndex = len(stmts)
+		} else if _, ok := stmt.(parser.ShowUDFsStmt); ok {
+			dataReturningStmtIndex = len(stmts)
+		} else if _, ok := stmt.(parser.DescribeFunctionStmt); ok {
+			dataReturningStmtIndex = len(stmts)
+		} else if _, ok := stmt.(parser.ExplainStmt); ok {
+			dataReturningStmtIndex = len(stmts)
 		}
 
 		stmts = append(stmts, stmt)
@@ -344,10 +565,10 @@ func (tc *topologies) parseQueries(form data.Map) ([]interface{}, *jasco.Error)
 
 	if dataReturningStmtIndex >= 0 {
 		if len(stmts) != 1 {
-			errMsg := "A SELECT or EVAL statement cannot be issued with other statements"
+			errMsg := "A SELECT, EVAL, STATUS, SHOW, DESCRIBE, or EXPLAIN statement cannot be issued with other statements"
 			tc.Log().Error(errMsg)
 			e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot process a statement", http.StatusBadRequest, nil)
-			e.Meta["error"] = "a SELECT or EVAL statement cannot be issued with other statements"
+			e.Meta["error"] = "a SELECT, EVAL, STATUS, SHOW, DESCRIBE, or EXPLAIN statement cannot be issued with other statements"
 			e.Meta["statement"] = fmt.Sprint(stmts[dataReturningStmtIndex])
 			return nil, e
 		}
@@ -356,7 +577,7 @@ func (tc *topologies) parseQueries(form data.Map) ([]interface{}, *jasco.Error)
 }
 
 func (tc *topologies) handleSelectStmt(rw web.ResponseWriter, stmt parser.SelectStmt, stmtStr string) {
-	tmpStmt := parser.SelectUnionStmt{[]parser.SelectStmt{stmt}}
+	tmpStmt := parser.SelectUnionStmt{Selects: []parser.SelectStmt{stmt}}
 	tc.handleSelectUnionStmt(rw, tmpStmt, stmtStr)
 }
 
@@ -524,6 +745,138 @@ func (tc *topologies) handleEvalStmt(rw web.ResponseWriter, stmt parser.EvalStmt
 	})
 }
 
+func (tc *topologies) handleStatusStmt(rw web.ResponseWriter, stmt parser.StatusStmt, stmtStr string) {
+	tb := tc.fetchTopology()
+	if tb == nil { // just in case
+		return
+	}
+
+	result, err := tb.RunStatusStmt(&stmt)
+	if err != nil {
+		tc.ErrLog(err).Error("Cannot process a statement")
+		e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot process a statement", http.StatusBadRequest, err)
+		e.Meta["error"] = err.Error()
+		e.Meta["statement"] = stmtStr
+		tc.RenderError(e)
+		return
+	}
+
+	// return value with JSON wrapper so it can be parsed on the client side
+	tc.Render(map[string]interface{}{
+		"result": result,
+	})
+}
+
+func (tc *topologies) handleShowStmt(rw web.ResponseWriter, stmt parser.ShowStmt, stmtStr string) {
+	tb := tc.fetchTopology()
+	if tb == nil { // just in case
+		return
+	}
+
+	result, err := tb.RunShowStmt(&stmt)
+	if err != nil {
+		tc.ErrLog(err).Error("Cannot process a statement")
+		e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot process a statement", http.StatusBadRequest, err)
+		e.Meta["error"] = err.Error()
+		e.Meta["statement"] = stmtStr
+		tc.RenderError(e)
+		return
+	}
+
+	// return value with JSON wrapper so it can be parsed on the client side
+	tc.Render(map[string]interface{}{
+		"result": result,
+	})
+}
+
+func (tc *topologies) handleDescribeStmt(rw web.ResponseWriter, stmt parser.DescribeStmt, stmtStr string) {
+	tb := tc.fetchTopology()
+	if tb == nil { // just in case
+		return
+	}
+
+	result, err := tb.RunDescribeStmt(&stmt)
+	if err != nil {
+		tc.ErrLog(err).Error("Cannot process a statement")
+		e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot process a statement", http.StatusBadRequest, err)
+		e.Meta["error"] = err.Error()
+		e.Meta["statement"] = stmtStr
+		tc.RenderError(e)
+		return
+	}
+
+	// return value with JSON wrapper so it can be parsed on the client side
+	tc.Render(map[string]interface{}{
+		"result": result,
+	})
+}
+
+func (tc *topologies) handleShowUDFsStmt(rw web.ResponseWriter, stmt parser.ShowUDFsStmt, stmtStr string) {
+	tb := tc.fetchTopology()
+	if tb == nil { // just in case
+		return
+	}
+
+	result, err := tb.RunShowUDFsStmt(&stmt)
+	if err != nil {
+		tc.ErrLog(err).Error("Cannot process a statement")
+		e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot process a statement", http.StatusBadRequest, err)
+		e.Meta["error"] = err.Error()
+		e.Meta["statement"] = stmtStr
+		tc.RenderError(e)
+		return
+	}
+
+	// return value with JSON wrapper so it can be parsed on the client side
+	tc.Render(map[string]interface{}{
+		"result": result,
+	})
+}
+
+func (tc *topologies) handleDescribeFunctionStmt(rw web.ResponseWriter, stmt parser.DescribeFunctionStmt, stmtStr string) {
+	tb := tc.fetchTopology()
+	if tb == nil { // just in case
+		return
+	}
+
+	result, err := tb.RunDescribeFunctionStmt(&stmt)
+	if err != nil {
+		tc.ErrLog(err).Error("Cannot process a statement")
+		e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot process a statement", http.StatusBadRequest, err)
+		e.Meta["error"] = err.Error()
+		e.Meta["statement"] = stmtStr
+		tc.RenderError(e)
+		return
+	}
+
+	// return value with JSON wrapper so it can be parsed on the client side
+	tc.Render(map[string]interface{}{
+		"result": result,
+	})
+}
+
+func (tc *topologies) handleExplainStmt(rw web.ResponseWriter, stmt parser.ExplainStmt, stmtStr string) {
+	tb := tc.fetchTopology()
+	if tb == nil { // just in case
+		return
+	}
+
+	result, err := tb.RunExplainStmt(&stmt)
+	if err != nil {
+		tc.ErrLog(err).Error("Cannot process a statement")
+		e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot process a statement", http.StatusBadRequest, err)
+		e.Meta["error"] = err.Error()
+		e.Meta["statement"] = stmtStr
+		tc.RenderError(e)
+		return
+	}
+
+	// return value with JSON wrapper so it can be parsed on the client side
+	tc.Render(map[string]interface{}{
+		"result": result,
+	})
+}
+
 // WebSocketQueries handles requests using WebSocket. A single WebSocket
 // connection can concurrently issue multiple requests including requests
 // containing a SELECT statement.
@@ -711,6 +1064,24 @@ func (tc *topologies) processWebSocketMessage(conn *websocket.Conn, tb *bql.Topo
 			} else if stmt, ok := stmts[0].(parser.EvalStmt); ok {
 				w.handleEvalStmtWebSocket(conn, stmt, stmtStr)
 				return
+			} else if stmt, ok := stmts[0].(parser.StatusStmt); ok {
+				w.handleStatusStmtWebSocket(conn, stmt, stmtStr)
+				return
+			} else if stmt, ok := stmts[0].(parser.ShowStmt); ok {
+				w.handleShowStmtWebSocket(conn, stmt, stmtStr)
+				return
+			} else if stmt, ok := stmts[0].(parser.DescribeStmt); ok {
+				w.handleDescribeStmtWebSocket(conn, stmt, stmtStr)
+				return
+			} else if stmt, ok := stmts[0].(parser.ShowUDFsStmt); ok {
+				w.handleShowUDFsStmtWebSocket(conn, stmt, stmtStr)
+				return
+			} else if stmt, ok := stmts[0].(parser.DescribeFunctionStmt); ok {
+				w.handleDescribeFunctionStmtWebSocket(conn, stmt, stmtStr)
+				return
+			} else if stmt, ok := stmts[0].(parser.ExplainStmt); ok {
+				w.handleExplainStmtWebSocket(conn, stmt, stmtStr)
+				return
 			}
 		}
 
@@ -774,7 +1145,7 @@ func (w *webSocketTopologyQueryHandler) sendErr(e *jasco.Error) bool {
 }
 
 func (w *webSocketTopologyQueryHandler) handleSelectStmtWebSocket(conn *websocket.Conn, stmt parser.SelectStmt, stmtStr string) {
-	tmpStmt := parser.SelectUnionStmt{[]parser.SelectStmt{stmt}}
+	tmpStmt := parser.SelectUnionStmt{Selects: []parser.SelectStmt{stmt}}
 	w.handleSelectUnionStmtWebSocket(conn, tmpStmt, stmtStr)
 }
 
@@ -876,3 +1247,147 @@ func (w *webSocketTopologyQueryHandler) handleEvalStmtWebSocket(conn *websocket.
 		return
 	}
 }
+
+func (w *webSocketTopologyQueryHandler) handleStatusStmtWebSocket(conn *websocket.Conn, stmt parser.StatusStmt, stmtStr string) {
+	tb := w.tc.fetchTopology()
+	if tb == nil { // just in case
+		return
+	}
+
+	result, err := tb.RunStatusStmt(&stmt)
+	if err != nil {
+		w.ErrLog(err).Error("Cannot process a statement")
+		e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot process a statement", http.StatusBadRequest, err)
+		e.Meta["error"] = err.Error()
+		e.Meta["statement"] = stmtStr
+		w.sendErr(e)
+		return
+	}
+
+	if err := w.send("result", map[string]interface{}{
+		"result": result,
+	}); err != nil {
+		w.ErrLog(err).Error("Cannot send data to the WebSocket client")
+		return
+	}
+}
+
+func (w *webSocketTopologyQueryHandler) handleShowStmtWebSocket(conn *websocket.Conn, stmt parser.ShowStmt, stmtStr string) {
+	tb := w.tc.fetchTopology()
+	if tb == nil { // just in case
+		return
+	}
+
+	result, err := tb.RunShowStmt(&stmt)
+	if err != nil {
+		w.ErrLog(err).Error("Cannot process a statement")
+		e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot process a statement", http.StatusBadRequest, err)
+		e.Meta["error"] = err.Error()
+		e.Meta["statement"] = stmtStr
+		w.sendErr(e)
+		return
+	}
+
+	if err := w.send("result", map[string]interface{}{
+		"result": result,
+	}); err != nil {
+		w.ErrLog(err).Error("Cannot send data to the WebSocket client")
+		return
+	}
+}
+
+func (w *webSocketTopologyQueryHandler) handleDescribeStmtWebSocket(conn *websocket.Conn, stmt parser.DescribeStmt, stmtStr string) {
+	tb := w.tc.fetchTopology()
+	if tb == nil { // just in case
+		return
+	}
+
+	result, err := tb.RunDescribeStmt(&stmt)
+	if err != nil {
+		w.ErrLog(err).Error("Cannot process a statement")
+		e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot process a statement", http.StatusBadRequest, err)
+		e.Meta["error"] = err.Error()
+		e.Meta["statement"] = stmtStr
+		w.sendErr(e)
+		return
+	}
+
+	if err := w.send("result", map[string]interface{}{
+		"result": result,
+	}); err != nil {
+		w.ErrLog(err).Error("Cannot send data to the WebSocket client")
+		return
+	}
+}
+
+func (w *webSocketTopologyQueryHandler) handleShowUDFsStmtWebSocket(conn *websocket.Conn, stmt parser.ShowUDFsStmt, stmtStr string) {
+	tb := w.tc.fetchTopology()
+	if tb == nil { // just in case
+		return
+	}
+
+	result, err := tb.RunShowUDFsStmt(&stmt)
+	if err != nil {
+		w.ErrLog(err).Error("Cannot process a statement")
+		e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot process a statement", http.StatusBadRequest, err)
+		e.Meta["error"] = err.Error()
+		e.Meta["statement"] = stmtStr
+		w.sendErr(e)
+		return
+	}
+
+	if err := w.send("result", map[string]interface{}{
+		"result": result,
+	}); err != nil {
+		w.ErrLog(err).Error("Cannot send data to the WebSocket client")
+		return
+	}
+}
+
+func (w *webSocketTopologyQueryHandler) handleDescribeFunctionStmtWebSocket(conn *websocket.Conn, stmt parser.DescribeFunctionStmt, stmtStr string) {
+	tb := w.tc.fetchTopology()
+	if tb == nil { // just in case
+		return
+	}
+
+	result, err := tb.RunDescribeFunctionStmt(&stmt)
+	if err != nil {
+		w.ErrLog(err).Error("Cannot process a statement")
+		e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot process a statement", http.StatusBadRequest, err)
+		e.Meta["error"] = err.Error()
+		e.Meta["statement"] = stmtStr
+		w.sendErr(e)
+		return
+	}
+
+	if err := w.send("result", map[string]interface{}{
+		"result": result,
+	}); err != nil {
+		w.ErrLog(err).Error("Cannot send data to the WebSocket client")
+		return
+	}
+}
+
+func (w *webSocketTopologyQueryHandler) handleExplainStmtWebSocket(conn *websocket.Conn, stmt parser.ExplainStmt, stmtStr string) {
+	tb := w.tc.fetchTopology()
+	if tb == nil { // just in case
+		return
+	}
+
+	result, err := tb.RunExplainStmt(&stmt)
+	if err != nil {
+		w.ErrLog(err).Error("Cannot process a statement")
+		e := jasco.NewError(bqlStmtProcessingErrorCode, "Cannot process a statement", http.StatusBadRequest, err)
+		e.Meta["error"] = err.Error()
+		e.Meta["statement"] = stmtStr
+		w.sendErr(e)
+		return
+	}
+
+	if err := w.send("result", map[string]interface{}{
+		"result": result,
+	}); err != nil {
+		w.ErrLog(err).Error("Cannot send data to the WebSocket client")
+		return
+	}
+}